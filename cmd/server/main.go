@@ -2,30 +2,20 @@ package main
 
 import (
 	"log"
-	"os"
 
 	"vessel-telemetry-api/internal/app"
+	"vessel-telemetry-api/internal/config"
 )
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data/telemetry.db"
-	}
-
-	allowUnsafeDuplicateIngest := os.Getenv("ALLOW_UNSAFE_DUPLICATE_INGEST") == "true"
+	cfg := config.Load()
 
-	app, err := app.New(dbPath, allowUnsafeDuplicateIngest)
+	app, err := app.New(cfg)
 	if err != nil {
 		log.Fatal("Failed to initialize app:", err)
 	}
 	defer app.Close()
 
-	log.Printf("Starting server on port %s", port)
-	log.Fatal(app.Listen(":" + port))
+	log.Printf("Starting server on port %s", cfg.Port)
+	log.Fatal(app.Listen(":" + cfg.Port))
 }
@@ -0,0 +1,269 @@
+// Package ais enriches vessel positions from an external AIS provider.
+//
+// The provider is any HTTP endpoint that returns the current position for a
+// vessel as JSON. The URL is configured as a template containing {imo} and/or
+// {mmsi} placeholders, e.g. https://ais.example.com/v1/positions?imo={imo}.
+package ais
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/util"
+)
+
+// Source is the value stored in location_readings.source for AIS positions.
+const Source = models.SourceSynced
+
+// Position is a single AIS position report.
+type Position struct {
+	Timestamp time.Time
+	Latitude  float64
+	Longitude float64
+	Course    *float64
+	Speed     *float64
+	Status    *string
+}
+
+// rawPosition accepts the field names used by the common AIS providers.
+type rawPosition struct {
+	Timestamp string   `json:"timestamp"`
+	Time      string   `json:"time"`
+	Lat       *float64 `json:"lat"`
+	Latitude  *float64 `json:"latitude"`
+	Lon       *float64 `json:"lon"`
+	Lng       *float64 `json:"lng"`
+	Longitude *float64 `json:"longitude"`
+	Course    *float64 `json:"course"`
+	COG       *float64 `json:"cog"`
+	Speed     *float64 `json:"speed"`
+	SOG       *float64 `json:"sog"`
+	Status    *string  `json:"status"`
+	NavStatus *string  `json:"nav_status"`
+}
+
+// ParsePositions decodes a provider response holding either a single position
+// object, an array of positions, or an object with a "positions"/"data" array.
+// Entries without coordinates or a parseable timestamp are skipped.
+func ParsePositions(body []byte) ([]Position, error) {
+	var raws []rawPosition
+
+	trimmed := strings.TrimSpace(string(body))
+	switch {
+	case strings.HasPrefix(trimmed, "["):
+		if err := json.Unmarshal(body, &raws); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(trimmed, "{"):
+		var wrapper struct {
+			Positions []rawPosition `json:"positions"`
+			Data      []rawPosition `json:"data"`
+		}
+		if err := json.Unmarshal(body, &wrapper); err != nil {
+			return nil, err
+		}
+		raws = append(wrapper.Positions, wrapper.Data...)
+		if len(raws) == 0 {
+			var single rawPosition
+			if err := json.Unmarshal(body, &single); err != nil {
+				return nil, err
+			}
+			raws = []rawPosition{single}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected AIS response")
+	}
+
+	var positions []Position
+	for _, r := range raws {
+		lat := util.FirstFloat(r.Latitude, r.Lat)
+		lon := util.FirstFloat(r.Longitude, r.Lon, r.Lng)
+		if lat == nil || lon == nil {
+			continue
+		}
+
+		tsStr := r.Timestamp
+		if tsStr == "" {
+			tsStr = r.Time
+		}
+		ts, err := time.Parse(time.RFC3339, tsStr)
+		if err != nil {
+			continue
+		}
+
+		pos := Position{
+			Timestamp: ts,
+			Latitude:  *lat,
+			Longitude: *lon,
+			Course:    util.FirstFloat(r.Course, r.COG),
+			Speed:     util.FirstFloat(r.Speed, r.SOG),
+			Status:    r.Status,
+		}
+		if pos.Status == nil {
+			pos.Status = r.NavStatus
+		}
+		positions = append(positions, pos)
+	}
+
+	return positions, nil
+}
+
+// BuildURL fills the {imo} and {mmsi} placeholders of a URL template. It
+// returns false when the template needs an identifier the vessel lacks.
+func BuildURL(template, imo, mmsi string) (string, bool) {
+	if strings.Contains(template, "{imo}") && imo == "" {
+		return "", false
+	}
+	if strings.Contains(template, "{mmsi}") && mmsi == "" {
+		return "", false
+	}
+	u := strings.ReplaceAll(template, "{imo}", url.QueryEscape(imo))
+	u = strings.ReplaceAll(u, "{mmsi}", url.QueryEscape(mmsi))
+	return u, true
+}
+
+// Store lists the vessels polled and writes their positions.
+type Store interface {
+	ListVessels(ctx context.Context, f store.VesselFilter) ([]models.Vessel, error)
+	WriteReading(ctx context.Context, w store.ReadingWrite, upsert bool) (store.WriteResult, error)
+	SetStreamLatest(ctx context.Context, vesselID int64, stream string, ts time.Time) error
+}
+
+// Poller fetches positions for all active vessels and stores them as
+// location_readings tagged source=synced.
+type Poller struct {
+	store       Store
+	urlTemplate string
+	apiKey      string
+	client      *http.Client
+	out         *outbound.Integration
+	quota       Quota
+}
+
+// Quota limits the rows a vessel may write per day. Positions are written
+// past the ingest processor, so the poller checks and counts them itself.
+type Quota interface {
+	CheckQuota(ctx context.Context, vesselID int64) error
+	RecordUsage(ctx context.Context, vesselID int64, rows int) string
+}
+
+// NewPoller creates a poller whose provider calls are guarded by policy.
+func NewPoller(st Store, urlTemplate, apiKey string, policy outbound.Policy) *Poller {
+	return &Poller{
+		store:       st,
+		urlTemplate: urlTemplate,
+		apiKey:      apiKey,
+		client:      &http.Client{}, // timeouts come from the policy
+		out:         outbound.New("ais", policy),
+	}
+}
+
+// SetQuota makes the poller skip throttled vessels over their daily quota
+// and count the positions it stores against it.
+func (p *Poller) SetQuota(q Quota) {
+	p.quota = q
+}
+
+// PollOnce fetches and stores the current position of every active vessel.
+func (p *Poller) PollOnce(ctx context.Context) {
+	vessels, err := p.store.ListVessels(ctx, store.VesselFilter{})
+	if err != nil {
+		log.Printf("ais: listing vessels: %v", err)
+		return
+	}
+
+	for _, v := range vessels {
+		if ctx.Err() != nil {
+			return
+		}
+		if v.IMO == nil && v.MMSI == nil {
+			continue
+		}
+
+		u, ok := BuildURL(p.urlTemplate, deref(v.IMO), deref(v.MMSI))
+		if !ok {
+			continue
+		}
+		if p.quota != nil {
+			if err := p.quota.CheckQuota(ctx, v.ID); err != nil {
+				log.Printf("ais: vessel %d: %v", v.ID, err)
+				continue
+			}
+		}
+
+		positions, err := p.fetch(ctx, u)
+		if err != nil {
+			log.Printf("ais: vessel %d: %v", v.ID, err)
+			continue
+		}
+
+		if n, err := p.write(ctx, v.ID, positions); err != nil {
+			log.Printf("ais: vessel %d: storing positions: %v", v.ID, err)
+		} else if n > 0 {
+			log.Printf("ais: vessel %d: stored %d position(s)", v.ID, n)
+			if p.quota != nil {
+				if warn := p.quota.RecordUsage(ctx, v.ID, n); warn != "" {
+					log.Printf("ais: vessel %d: %s", v.ID, warn)
+				}
+			}
+		}
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func (p *Poller) fetch(ctx context.Context, u string) ([]Position, error) {
+	header := http.Header{"Accept": {"application/json"}}
+	if p.apiKey != "" {
+		header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	body, err := p.out.Get(ctx, p.client, u, header, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePositions(body)
+}
+
+// write stores positions not stored before and records when the vessel's
+// location stream was last written.
+func (p *Poller) write(ctx context.Context, vesselID int64, positions []Position) (int, error) {
+	stored := 0
+	for _, pos := range positions {
+		result, err := p.store.WriteReading(ctx, store.ReadingWrite{
+			Table:    "location_readings",
+			VesselID: vesselID, TS: pos.Timestamp,
+			RowHash: util.HashRow(vesselID, pos.Timestamp, "location", "source:"+models.OriginAIS),
+			Cols:    []string{"latitude", "longitude", "course_degrees", "speed_knots", "status", "source", "origin", "extra_json"},
+			Vals:    []interface{}{pos.Latitude, pos.Longitude, pos.Course, pos.Speed, pos.Status, Source, models.OriginAIS, json.RawMessage("{}")},
+		}, false)
+		if err != nil {
+			return stored, err
+		}
+		if result != store.WriteSkipped {
+			stored++
+		}
+	}
+
+	if stored > 0 {
+		if err := p.store.SetStreamLatest(ctx, vesselID, "location", time.Now().UTC()); err != nil {
+			return stored, err
+		}
+	}
+	return stored, nil
+}
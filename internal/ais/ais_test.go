@@ -0,0 +1,122 @@
+package ais
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/store"
+)
+
+func TestParsePositions(t *testing.T) {
+	// Single object with provider-style field names
+	positions, err := ParsePositions([]byte(`{"lat": 1.25, "lng": 103.8, "sog": 12.5, "timestamp": "2025-08-08T10:00:00Z"}`))
+	if err != nil || len(positions) != 1 {
+		t.Fatalf("Expected 1 position, got %d, err: %v", len(positions), err)
+	}
+	if positions[0].Latitude != 1.25 || positions[0].Longitude != 103.8 {
+		t.Errorf("Unexpected coordinates: %+v", positions[0])
+	}
+	if positions[0].Speed == nil || *positions[0].Speed != 12.5 {
+		t.Errorf("Expected speed 12.5, got %v", positions[0].Speed)
+	}
+
+	// Wrapped array, entries without coordinates are skipped
+	positions, err = ParsePositions([]byte(`{"data": [
+		{"latitude": 1, "longitude": 2, "time": "2025-08-08T10:00:00Z"},
+		{"latitude": 1, "time": "2025-08-08T11:00:00Z"}
+	]}`))
+	if err != nil || len(positions) != 1 {
+		t.Errorf("Expected 1 position, got %d, err: %v", len(positions), err)
+	}
+
+	// Garbage
+	if _, err := ParsePositions([]byte("not json")); err == nil {
+		t.Errorf("Expected error for invalid response")
+	}
+}
+
+func TestBuildURL(t *testing.T) {
+	if u, ok := BuildURL("https://ais.example/v1?imo={imo}", "9811000", ""); !ok || u != "https://ais.example/v1?imo=9811000" {
+		t.Errorf("Unexpected URL %s, ok: %v", u, ok)
+	}
+
+	// Template needs MMSI, vessel has none
+	if _, ok := BuildURL("https://ais.example/v1/{mmsi}", "9811000", ""); ok {
+		t.Errorf("Expected URL to be rejected without MMSI")
+	}
+}
+
+// fakeQuota refuses the vessels in over and counts the rows of the others.
+type fakeQuota struct {
+	over map[int64]bool
+	used map[int64]int
+}
+
+func (q *fakeQuota) CheckQuota(ctx context.Context, vesselID int64) error {
+	if q.over[vesselID] {
+		return errors.New("daily row quota exceeded")
+	}
+	return nil
+}
+
+func (q *fakeQuota) RecordUsage(ctx context.Context, vesselID int64, rows int) string {
+	q.used[vesselID] += rows
+	return ""
+}
+
+func TestPollOnceQuota(t *testing.T) {
+	database, err := db.Connect(filepath.Join(t.TempDir(), "ais.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	for _, imo := range []string{"9811000", "9811001"} {
+		if _, err := database.Exec("INSERT INTO vessels (imo, name) VALUES (?, ?)", imo, "Vessel-"+imo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetched := map[string]bool{}
+	var mu sync.Mutex
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Query().Get("imo")] = true
+		mu.Unlock()
+		w.Write([]byte(`{"lat": 1.25, "lng": 103.8, "timestamp": "2025-08-08T10:00:00Z"}`))
+	}))
+	defer provider.Close()
+
+	// Vessel 2 used up its quota
+	quota := &fakeQuota{over: map[int64]bool{2: true}, used: map[int64]int{}}
+	p := NewPoller(store.New(database), provider.URL+"?imo={imo}", "", outbound.Policy{Timeout: 5 * time.Second})
+	p.SetQuota(quota)
+	p.PollOnce(context.Background())
+
+	if !fetched["9811000"] || fetched["9811001"] {
+		t.Errorf("Expected only the vessel under its quota polled, got %v", fetched)
+	}
+	var stored int
+	database.QueryRow("SELECT COUNT(*) FROM location_readings WHERE vessel_id = 2").Scan(&stored)
+	if stored != 0 {
+		t.Errorf("Expected no position stored for the vessel over its quota, got %d", stored)
+	}
+	if quota.used[1] != 1 || quota.used[2] != 0 {
+		t.Errorf("Expected the stored position counted against vessel 1, got %v", quota.used)
+	}
+
+	// Positions already stored are not counted again
+	p.PollOnce(context.Background())
+	if quota.used[1] != 1 {
+		t.Errorf("Expected a position polled again not counted, got %v", quota.used)
+	}
+}
@@ -0,0 +1,209 @@
+// Package alarms turns the free-text alarms column of engine readings into
+// structured alarm events.
+package alarms
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Severities, lowest first.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Severities lists the valid severities, lowest first.
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// severityWords map explicit severity prefixes ("CRIT: ...", "[warn] ...").
+var severityWords = map[string]string{
+	"info": SeverityInfo, "notice": SeverityInfo,
+	"warn": SeverityWarning, "warning": SeverityWarning, "minor": SeverityWarning,
+	"crit": SeverityCritical, "critical": SeverityCritical, "major": SeverityCritical,
+	"emergency": SeverityCritical, "fatal": SeverityCritical,
+}
+
+// criticalWords make an alarm without an explicit severity critical.
+var criticalWords = []string{"SHUTDOWN", "FIRE", "EMERGENCY", "OVERSPEED", "FLOOD"}
+
+// noAlarm are cell values meaning "nothing active", compared lowercased.
+var noAlarm = map[string]bool{
+	"": true, "-": true, "--": true, "0": true, "ok": true, "none": true, "nil": true,
+	"n/a": true, "na": true, "normal": true, "no alarm": true, "no alarms": true,
+	"clear": true, "cleared": true, "ninguna": true, "ninguno": true, "sin alarmas": true,
+}
+
+// Alarm is one alarm raised in a reading.
+type Alarm struct {
+	Code     string // normalized, e.g. LOW_OIL_PRESSURE
+	Severity string
+	Message  string // the text as written, without the severity prefix
+}
+
+// Parse splits an alarms cell such as "HIGH TEMP; crit: low oil pressure"
+// into alarms. Values meaning "no alarm" ("OK", "None", "-"...) yield
+// nothing, and a code is only returned once.
+func Parse(text string) []Alarm {
+	var alarms []Alarm
+	seen := make(map[string]bool)
+	for _, part := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ';' || r == '|' || r == '\n'
+	}) {
+		part = strings.TrimSpace(part)
+		if noAlarm[strings.ToLower(part)] {
+			continue
+		}
+
+		severity, message := splitSeverity(part)
+		code := Code(message)
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		if severity == "" {
+			severity = SeverityWarning
+			for _, word := range criticalWords {
+				if strings.Contains(code, word) {
+					severity = SeverityCritical
+				}
+			}
+		}
+		alarms = append(alarms, Alarm{Code: code, Severity: severity, Message: message})
+	}
+	return alarms
+}
+
+// splitSeverity strips a leading "[word]", "word:" or "word -" severity
+// marker, returning the severity it names (empty if none).
+func splitSeverity(s string) (string, string) {
+	var word, rest string
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return "", s
+		}
+		word, rest = s[1:end], s[end+1:]
+	default:
+		i := strings.IndexAny(s, ":-")
+		if i < 0 {
+			return "", s
+		}
+		word, rest = s[:i], s[i+1:]
+	}
+
+	severity, ok := severityWords[strings.ToLower(strings.TrimSpace(word))]
+	rest = strings.TrimSpace(rest)
+	if !ok || rest == "" {
+		return "", s
+	}
+	return severity, rest
+}
+
+// Code normalizes alarm text to an upper-case code: "lowOilPressure",
+// "Low oil pressure" and "LOW-OIL-PRESSURE" all become LOW_OIL_PRESSURE.
+func Code(s string) string {
+	var b strings.Builder
+	var prev rune
+	gap := false
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			// camelCase boundary
+			if unicode.IsUpper(r) && unicode.IsLower(prev) {
+				gap = true
+			}
+			if gap && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			gap = false
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			gap = true
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+// Rank orders severities: higher is more severe, -1 for unknown ones.
+func Rank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// Reading is the alarms shown by one unit at one time.
+type Reading struct {
+	TS     time.Time
+	Alarms []Alarm
+}
+
+// Event is an alarm from the first reading that showed it until the first
+// reading that no longer did.
+type Event struct {
+	Code        string
+	Severity    string // highest severity seen
+	Message     string // text of the first occurrence
+	Start       time.Time
+	End         *time.Time // nil while the alarm is still active
+	LastSeen    time.Time
+	Occurrences int // readings that showed the alarm
+}
+
+// Pair folds the readings of one unit, oldest first, into events: an alarm
+// repeated in consecutive readings is a single event, which ends at the first
+// reading without it. Readings with the same timestamp are merged.
+func Pair(readings []Reading) []Event {
+	var events []Event
+	active := make(map[string]int) // code -> index into events
+
+	for i := 0; i < len(readings); {
+		ts := readings[i].TS
+		shown := make(map[string]Alarm)
+		for ; i < len(readings) && readings[i].TS.Equal(ts); i++ {
+			for _, a := range readings[i].Alarms {
+				if _, ok := shown[a.Code]; !ok {
+					shown[a.Code] = a
+				}
+			}
+		}
+
+		for code, n := range active {
+			if _, ok := shown[code]; !ok {
+				end := ts
+				events[n].End = &end
+				delete(active, code)
+			}
+		}
+		for code, a := range shown {
+			n, ok := active[code]
+			if !ok {
+				events = append(events, Event{Code: code, Severity: a.Severity, Message: a.Message, Start: ts})
+				n = len(events) - 1
+				active[code] = n
+			}
+			if Rank(a.Severity) > Rank(events[n].Severity) {
+				events[n].Severity = a.Severity
+			}
+			events[n].LastSeen = ts
+			events[n].Occurrences++
+		}
+	}
+
+	sort.SliceStable(events, func(a, b int) bool {
+		if !events[a].Start.Equal(events[b].Start) {
+			return events[a].Start.Before(events[b].Start)
+		}
+		return events[a].Code < events[b].Code
+	})
+	return events
+}
@@ -0,0 +1,60 @@
+package alarms
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Alarm
+	}{
+		{"", nil},
+		{"OK", nil},
+		{" Ninguna ", nil},
+		{"lowOilPressure", []Alarm{{"LOW_OIL_PRESSURE", SeverityWarning, "lowOilPressure"}}},
+		{"HIGH TEMP", []Alarm{{"HIGH_TEMP", SeverityWarning, "HIGH TEMP"}}},
+		{"HIGH TEMP; crit: low oil pressure", []Alarm{
+			{"HIGH_TEMP", SeverityWarning, "HIGH TEMP"},
+			{"LOW_OIL_PRESSURE", SeverityCritical, "low oil pressure"},
+		}},
+		{"[info] filter due, none", []Alarm{{"FILTER_DUE", SeverityInfo, "filter due"}}},
+		{"Overspeed shutdown", []Alarm{{"OVERSPEED_SHUTDOWN", SeverityCritical, "Overspeed shutdown"}}},
+		{"LOW-OIL | low oil", []Alarm{{"LOW_OIL", SeverityWarning, "LOW-OIL"}}},
+		{"T-101 high", []Alarm{{"T_101_HIGH", SeverityWarning, "T-101 high"}}},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPair(t *testing.T) {
+	at := func(min int) time.Time { return time.Date(2025, 1, 1, 0, min, 0, 0, time.UTC) }
+	high := Alarm{Code: "HIGH_TEMP", Severity: SeverityWarning, Message: "HIGH TEMP"}
+	highCrit := Alarm{Code: "HIGH_TEMP", Severity: SeverityCritical, Message: "crit: HIGH TEMP"}
+	low := Alarm{Code: "LOW_OIL", Severity: SeverityWarning, Message: "LOW OIL"}
+
+	events := Pair([]Reading{
+		{TS: at(0)},
+		{TS: at(1), Alarms: []Alarm{high}},
+		{TS: at(2), Alarms: []Alarm{high, low}},
+		{TS: at(3), Alarms: []Alarm{highCrit}},
+		{TS: at(4)},
+		{TS: at(5), Alarms: []Alarm{high}},
+		{TS: at(5)}, // same time, other row: still active
+	})
+
+	end2, end4 := at(3), at(4)
+	want := []Event{
+		{Code: "HIGH_TEMP", Severity: SeverityCritical, Message: "HIGH TEMP", Start: at(1), End: &end4, LastSeen: at(3), Occurrences: 3},
+		{Code: "LOW_OIL", Severity: SeverityWarning, Message: "LOW OIL", Start: at(2), End: &end2, LastSeen: at(2), Occurrences: 1},
+		{Code: "HIGH_TEMP", Severity: SeverityWarning, Message: "HIGH TEMP", Start: at(5), LastSeen: at(5), Occurrences: 1},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("Pair() =\n%+v\nwant\n%+v", events, want)
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/alarms"
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetVesselAlarms lists the vessel's engine alarm events, oldest first.
+func (h *Handlers) GetVesselAlarms(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	filter := store.AlarmFilter{
+		VesselID:   vesselID,
+		Code:       alarms.Code(c.Query("code")),
+		ActiveOnly: c.QueryBool("active"),
+	}
+	if filter.From, filter.To, err = parseTimeRange(c); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if filter.Severities, err = parseSeverities(c.Query("severity")); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if s := c.Query("engine_no"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid engine_no"})
+		}
+		filter.EngineNo = &n
+	}
+
+	events, err := h.store.AlarmEvents(c.UserContext(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     events,
+	})
+}
+
+// parseSeverities parses a comma-separated severity list; empty means all.
+func parseSeverities(list string) ([]string, error) {
+	var severities []string
+	for _, s := range strings.Split(list, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if alarms.Rank(s) < 0 {
+			return nil, fmt.Errorf("invalid severity %q, use %s", s, strings.Join(alarms.Severities, ", "))
+		}
+		severities = append(severities, s)
+	}
+	return severities, nil
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// headerAliasBody is the body of POST and PUT /header-aliases.
+type headerAliasBody struct {
+	VesselID *int64  `json:"vessel_id"`
+	Stream   *string `json:"stream"`
+	Header   string  `json:"header"`
+	Field    string  `json:"field"`
+}
+
+// headerAlias reads and checks an alias from the request body, answering
+// the request itself on errors. id is that of the alias replaced, 0 for a
+// new one.
+func (h *Handlers) headerAlias(c *fiber.Ctx, id int64) (models.HeaderAlias, bool, error) {
+	var body headerAliasBody
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return models.HeaderAlias{}, false, c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	a := models.HeaderAlias{
+		ID:       id,
+		VesselID: body.VesselID,
+		Stream:   trimmedOrNil(body.Stream),
+		Header:   strings.TrimSpace(body.Header),
+		Field:    strings.TrimSpace(body.Field),
+	}
+	if a.Header == "" || len(a.Header) > 200 {
+		return a, false, c.Status(400).JSON(fiber.Map{"error": "header must be 1 to 200 characters"})
+	}
+	if a.VesselID != nil {
+		if _, err := h.store.GetVessel(c.UserContext(), *a.VesselID); errors.Is(err, store.ErrNotFound) {
+			return a, false, c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("vessel %d not found", *a.VesselID)})
+		} else if err != nil {
+			return a, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	fields, err := h.aliasFields(c, a.Stream)
+	if err != nil {
+		return a, false, c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !fields[a.Field] {
+		where := "any stream read from sheets"
+		if a.Stream != nil {
+			where = *a.Stream
+		}
+		return a, false, c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("%q is not a field of %s", a.Field, where)})
+	}
+
+	aliases, err := h.store.HeaderAliases(c.UserContext())
+	if err != nil {
+		return a, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, other := range aliases {
+		if other.ID != a.ID && sameID(other.VesselID, a.VesselID) && sameText(other.Stream, a.Stream) && strings.EqualFold(other.Header, a.Header) {
+			return a, false, c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("header alias %d already maps %q", other.ID, other.Header)})
+		}
+	}
+	return a, true, nil
+}
+
+// aliasFields returns the fields an alias for stream may name: those of the
+// stream, or of every stream read from sheets (built-in and custom) if nil.
+func (h *Handlers) aliasFields(c *fiber.Ctx, stream *string) (map[string]bool, error) {
+	fields := make(map[string]bool)
+	builtIn := ingest.SheetStreams()
+	if stream != nil {
+		builtIn = []string{*stream}
+	}
+	for _, name := range builtIn {
+		names, ok := ingest.SheetFields(name)
+		if !ok {
+			continue
+		}
+		for _, f := range names {
+			fields[f] = true
+		}
+		if stream != nil {
+			return fields, nil
+		}
+	}
+
+	var custom []models.CustomStream
+	if stream != nil {
+		def, err := h.store.CustomStream(c.UserContext(), *stream)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("unknown stream %q", *stream)
+		} else if err != nil {
+			return nil, err
+		}
+		custom = []models.CustomStream{*def}
+	} else {
+		var err error
+		if custom, err = h.store.CustomStreams(c.UserContext()); err != nil {
+			return nil, err
+		}
+	}
+	for _, def := range custom {
+		fields["ts"] = true
+		for _, col := range def.Columns {
+			fields[col.Name] = true
+		}
+	}
+	return fields, nil
+}
+
+func sameID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameText(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// loadHeaderAlias loads the alias whose ID is in the path, answering the
+// request itself on errors.
+func (h *Handlers) loadHeaderAlias(c *fiber.Ctx) (*models.HeaderAlias, error) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "invalid header alias id"})
+	}
+	a, err := h.store.HeaderAlias(c.UserContext(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "header alias not found"})
+	} else if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return a, nil
+}
+
+// GetHeaderAliases lists the header aliases; with vessel_id, those applying
+// to the vessel's sheets: its own, then the global ones.
+func (h *Handlers) GetHeaderAliases(c *fiber.Ctx) error {
+	var vesselID *int64
+	if s := c.Query("vessel_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid vessel_id"})
+		}
+		vesselID = &id
+	}
+	aliases, err := h.store.HeaderAliases(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if vesselID != nil {
+		applying := []models.HeaderAlias{}
+		for _, a := range aliases {
+			if a.VesselID == nil || *a.VesselID == *vesselID {
+				applying = append(applying, a)
+			}
+		}
+		aliases = applying
+	}
+	return c.JSON(fiber.Map{"items": aliases})
+}
+
+// GetHeaderAlias returns one header alias.
+func (h *Handlers) GetHeaderAlias(c *fiber.Ctx) error {
+	a, err := h.loadHeaderAlias(c)
+	if a == nil {
+		return err
+	}
+	return c.JSON(a)
+}
+
+// PostHeaderAlias creates a header alias, used from the next ingest on.
+func (h *Handlers) PostHeaderAlias(c *fiber.Ctx) error {
+	a, ok, err := h.headerAlias(c, 0)
+	if !ok {
+		return err
+	}
+	a.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	a.UpdatedAt = a.CreatedAt
+	if a.ID, err = h.store.CreateHeaderAlias(c.UserContext(), a); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(a)
+}
+
+// PutHeaderAlias replaces a header alias.
+func (h *Handlers) PutHeaderAlias(c *fiber.Ctx) error {
+	existing, err := h.loadHeaderAlias(c)
+	if existing == nil {
+		return err
+	}
+	a, ok, err := h.headerAlias(c, existing.ID)
+	if !ok {
+		return err
+	}
+	a.CreatedAt = existing.CreatedAt
+	a.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := h.store.UpdateHeaderAlias(c.UserContext(), a); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "header alias not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(a)
+}
+
+// DeleteHeaderAlias removes a header alias.
+func (h *Handlers) DeleteHeaderAlias(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid header alias id"})
+	}
+	if err := h.store.DeleteHeaderAlias(c.UserContext(), id); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "header alias not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
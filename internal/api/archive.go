@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/util"
+)
+
+// PostIngestArchive ingests the XLSX and CSV files of an uploaded ZIP
+// archive, reporting on each file.
+func (h *Handlers) PostIngestArchive(c *fiber.Ctx) error {
+	params, err := parseIngestParams(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "file is required"})
+	}
+	fileReader, err := file.Open()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to open file"})
+	}
+	defer fileReader.Close()
+	data, err := io.ReadAll(fileReader)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to read file"})
+	}
+
+	response, err := h.processor.ProcessArchive(c.UserContext(), data, params)
+	if err == nil {
+		c.Locals(auditDetailKey, map[string]interface{}{"filename": file.Filename, "file_sha256": util.SHA256Hex(data), "files": len(response.Files)})
+	}
+	return h.sendArchiveResponse(c, response, err)
+}
+
+// sendArchiveResponse answers an ingest of a ZIP archive with its result or
+// error.
+func (h *Handlers) sendArchiveResponse(c *fiber.Ctx, response *models.ArchiveResponse, err error) error {
+	if errors.Is(err, ingest.ErrInvalidArchive) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if response.Status == "already_ingested" && !h.allowUnsafeDuplicateIngest {
+		return c.Status(409).JSON(response)
+	}
+	if wantsHAL(c) {
+		links := halLinks{}
+		if response.VesselID != nil {
+			links["vessel"] = vesselLinks(*response.VesselID)["self"]
+		}
+		return sendHAL(c, response, links)
+	}
+	return c.JSON(response)
+}
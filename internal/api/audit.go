@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/audit"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/util"
+	"vessel-telemetry-api/internal/watermark"
+)
+
+// auditDetailKey names the fiber local a handler may set to add details
+// (a JSON-able map) to its audit entry.
+const auditDetailKey = "audit_detail"
+
+// actor identifies who made a request in the audit log: the organization and
+// fingerprint of its API key, or the client IP without a key.
+func (h *Handlers) actor(c *fiber.Ctx) string {
+	key := c.Get("X-API-Key")
+	if key == "" {
+		return "ip:" + c.IP()
+	}
+	if org, ok := h.apiKeyOrgs[key]; ok {
+		return org + ":" + watermark.Fingerprint(key)
+	}
+	return "key:" + watermark.Fingerprint(key)
+}
+
+// audited records successful requests of the rest of the chain in the audit
+// log as action. The vessel comes from the :id parameter or the response's
+// vessel_id. Failing to record is logged; the change itself has happened.
+func (h *Handlers) audited(action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !h.auditChain {
+			return c.Next()
+		}
+		requestDigest := util.SHA256Hex(c.Body())
+		if err := c.Next(); err != nil {
+			return err
+		}
+		status := c.Response().StatusCode()
+		if status < 200 || status >= 300 {
+			return nil
+		}
+
+		var vesselID *int64
+		if id, err := strconv.ParseInt(c.Params("id"), 10, 64); err == nil {
+			vesselID = &id
+		} else {
+			var body struct {
+				VesselID *int64 `json:"vessel_id"`
+			}
+			if json.Unmarshal(c.Response().Body(), &body) == nil {
+				vesselID = body.VesselID
+			}
+		}
+
+		detail := map[string]interface{}{}
+		if extra, ok := c.Locals(auditDetailKey).(map[string]interface{}); ok {
+			for k, v := range extra {
+				detail[k] = v
+			}
+		}
+		detail["method"] = c.Method()
+		detail["status"] = status
+		detail["request_sha256"] = requestDigest
+		if q := string(c.Request().URI().QueryString()); q != "" {
+			detail["query"] = q
+		}
+		raw, err := json.Marshal(detail)
+		if err != nil {
+			return err
+		}
+
+		_, err = h.store.AppendAudit(c.UserContext(), audit.Entry{
+			Action:   action,
+			Actor:    h.actor(c),
+			VesselID: vesselID,
+			Subject:  c.Path(),
+			Detail:   string(raw),
+		})
+		if err != nil {
+			log.Printf("audit log: recording %s %s failed: %v", action, c.Path(), err)
+		}
+		return nil
+	}
+}
+
+// GetAudit lists audit log entries in seq order; page with after_seq.
+func (h *Handlers) GetAudit(c *fiber.Ctx) error {
+	limits := h.limitsFor(c)
+	f := store.AuditFilter{Limit: limits.Default, Kind: c.Query("kind")}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= limits.Max {
+		f.Limit = l
+	}
+	if s := c.Query("after_seq"); s != "" {
+		after, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || after < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid after_seq"})
+		}
+		f.AfterSeq = after
+	}
+	if s := c.Query("vessel_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid vessel_id"})
+		}
+		f.VesselID = &id
+	}
+	if f.Kind != "" && f.Kind != audit.KindAudit && f.Kind != audit.KindReading {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid kind, use audit or reading"})
+	}
+
+	entries, err := h.store.AuditEntries(c.UserContext(), f)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	response := fiber.Map{"items": entries}
+	if len(entries) == f.Limit {
+		response["next_after_seq"] = entries[len(entries)-1].Seq
+	}
+	return c.JSON(response)
+}
+
+// GetAuditVerify recomputes the whole chain and compares chained readings
+// (of vessel_id, if set) with what was recorded. Removing the newest entries
+// leaves a valid shorter chain, so pass a head kept from an earlier run as
+// anchor_seq and anchor_hash to check it is still there.
+func (h *Handlers) GetAuditVerify(c *fiber.Ctx) error {
+	var vesselID *int64
+	if s := c.Query("vessel_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid vessel_id"})
+		}
+		vesselID = &id
+	}
+	var anchorSeq int64
+	anchorHash := c.Query("anchor_hash")
+	if s := c.Query("anchor_seq"); s != "" || anchorHash != "" {
+		seq, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || seq < 1 || anchorHash == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "anchor_seq and anchor_hash go together"})
+		}
+		anchorSeq = seq
+	}
+
+	checker, readings, err := h.store.VerifyAudit(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if anchorSeq > 0 {
+		entries, err := h.store.AuditEntries(c.UserContext(), store.AuditFilter{AfterSeq: anchorSeq - 1, Limit: 1})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		switch {
+		case len(entries) == 0 || entries[0].Seq != anchorSeq:
+			checker.Report(anchorSeq, "anchored entry is missing, the log was cut back")
+		case entries[0].Hash != anchorHash:
+			checker.Report(anchorSeq, "anchored entry's hash differs, the log was rewritten")
+		}
+	}
+
+	response := fiber.Map{
+		"ok":            checker.OK(),
+		"entries":       checker.Entries,
+		"problems":      checker.Problems,
+		"more_problems": checker.MoreProblems,
+		"readings":      readings,
+		"head":          nil,
+	}
+	if checker.Head != nil {
+		response["head"] = fiber.Map{"seq": checker.Head.Seq, "hash": checker.Head.Hash, "recorded_at": checker.Head.RecordedAt}
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/s3ingest"
+)
+
+// PostIngestS3Events takes the event notifications of the watched bucket,
+// as S3 and MinIO post them to a webhook, and queues the objects created
+// for ingest.
+func (h *Handlers) PostIngestS3Events(c *fiber.Ctx) error {
+	if h.bucket == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "bucket ingest is not configured"})
+	}
+	var event s3ingest.Event
+	if err := json.Unmarshal(c.Body(), &event); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	queued := h.bucket.Notify(event.CreatedKeys(h.bucket.Bucket())...)
+	return c.Status(202).JSON(fiber.Map{"queued": queued})
+}
+
+// GetIngestS3Objects lists the objects of the watched bucket seen so far,
+// most recently tried first; status=failed lists those that failed.
+func (h *Handlers) GetIngestS3Objects(c *fiber.Ctx) error {
+	if h.bucket == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "bucket ingest is not configured"})
+	}
+	limits := h.limitsFor(c)
+	limit := limits.Default
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= limits.Max {
+		limit = l
+	}
+	objects, err := h.store.BucketObjects(c.UserContext(), h.bucket.Bucket(), c.Query("status"), limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"bucket": h.bucket.Bucket(), "items": objects})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errUncacheable stops a response other than 200 from being cached; it was
+// sent as is.
+var errUncacheable = errors.New("response not cacheable")
+
+// cached serves handler's 200 responses from the response cache, shared for
+// CACHE_TTL between the requests with the same key.
+func (h *Handlers) cached(key func(c *fiber.Ctx) string, handler fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if h.cache == nil || h.cacheTTL <= 0 {
+			return handler(c)
+		}
+		value, err := h.cache.Get(c.UserContext(), key(c), h.cacheTTL, func() ([]byte, error) {
+			if err := handler(c); err != nil {
+				return nil, err
+			}
+			if c.Response().StatusCode() != fiber.StatusOK {
+				return nil, errUncacheable
+			}
+			// The media type differs, e.g. HAL or not
+			value := append([]byte(c.GetRespHeader(fiber.HeaderContentType)), '\n')
+			return append(value, c.Response().Body()...), nil
+		})
+		if errors.Is(err, errUncacheable) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		contentType, body, _ := bytes.Cut(value, []byte("\n"))
+		c.Set(fiber.HeaderContentType, string(contentType))
+		return c.Send(body)
+	}
+}
+
+// vesselsKey keys the vessel list on its query and representation.
+func vesselsKey(c *fiber.Ctx) string {
+	return "vessels:" + strconv.FormatBool(wantsHAL(c)) + ":" + string(c.Request().URI().QueryString())
+}
+
+// kioskKey keys a vessel's kiosk snapshot.
+func kioskKey(c *fiber.Ctx) string {
+	return "kiosk:" + c.Params("id")
+}
+
+// InvalidateCacheOnWrite drops the cached responses after every successful
+// request that may have written, such as an upload or a vessel edit.
+func (h *Handlers) InvalidateCacheOnWrite(c *fiber.Ctx) error {
+	err := c.Next()
+	if h.cache == nil {
+		return err
+	}
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return err
+	}
+	if err == nil && c.Response().StatusCode() < 400 {
+		if err := h.cache.Invalidate(c.UserContext()); err != nil {
+			log.Printf("cache: %v", err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// defaultCCTVStaleAfter is how old a camera's latest reading may be before
+// the camera counts as stale.
+const defaultCCTVStaleAfter = 6 * time.Hour
+
+// healthyCameraStatuses are the status values of a working camera.
+var healthyCameraStatuses = map[string]bool{"OK": true, "ONLINE": true, "RECORDING": true, "ACTIVE": true}
+
+type cameraHealth struct {
+	CamID         *string   `json:"cam_id"`
+	Status        *string   `json:"status"`
+	UptimePercent *float64  `json:"uptime_percent"`
+	TS            time.Time `json:"ts"`
+	AgeSeconds    int64     `json:"age_seconds"` // since the latest reading
+	Stale         bool      `json:"stale"`
+	Healthy       bool      `json:"healthy"` // working status and not stale
+}
+
+type vesselCameras struct {
+	VesselID  int64          `json:"vessel_id"`
+	Name      string         `json:"name"`
+	IMO       *string        `json:"imo"`
+	Unhealthy int            `json:"unhealthy"`
+	Cameras   []cameraHealth `json:"cameras"`
+}
+
+type cctvSummary struct {
+	Vessels   int            `json:"vessels"`
+	Cameras   int            `json:"cameras"`
+	Healthy   int            `json:"healthy"`
+	Unhealthy int            `json:"unhealthy"`
+	Stale     int            `json:"stale"`
+	ByStatus  map[string]int `json:"by_status"` // upper-cased status; "" for none
+}
+
+// cctvStatus groups the latest camera readings by vessel. The summary covers
+// every camera; with problemsOnly only unhealthy cameras (and their vessels)
+// are listed.
+func cctvStatus(cameras []models.CameraStatus, now time.Time, staleAfter time.Duration, problemsOnly bool) (cctvSummary, []vesselCameras) {
+	summary := cctvSummary{ByStatus: map[string]int{}}
+	items := []vesselCameras{}
+	seen := map[int64]bool{}
+
+	for _, cam := range cameras {
+		status := ""
+		if cam.Status != nil {
+			status = strings.ToUpper(strings.TrimSpace(*cam.Status))
+		}
+		age := now.Sub(cam.TS)
+		health := cameraHealth{
+			CamID:         cam.CamID,
+			Status:        cam.Status,
+			UptimePercent: cam.UptimePercent,
+			TS:            cam.TS,
+			AgeSeconds:    int64(age / time.Second),
+			Stale:         age > staleAfter,
+		}
+		health.Healthy = healthyCameraStatuses[status] && !health.Stale
+
+		if !seen[cam.VesselID] {
+			seen[cam.VesselID] = true
+			summary.Vessels++
+		}
+		summary.Cameras++
+		summary.ByStatus[status]++
+		if health.Stale {
+			summary.Stale++
+		}
+		if health.Healthy {
+			summary.Healthy++
+		} else {
+			summary.Unhealthy++
+		}
+
+		if problemsOnly && health.Healthy {
+			continue
+		}
+		if len(items) == 0 || items[len(items)-1].VesselID != cam.VesselID {
+			items = append(items, vesselCameras{VesselID: cam.VesselID, Name: cam.VesselName, IMO: cam.IMO})
+		}
+		vessel := &items[len(items)-1]
+		vessel.Cameras = append(vessel.Cameras, health)
+		if !health.Healthy {
+			vessel.Unhealthy++
+		}
+	}
+	return summary, items
+}
+
+// GetCCTVStatus reports every camera's latest status across the fleet, grouped
+// by vessel, so offline and silent cameras can be spotted in one place.
+func (h *Handlers) GetCCTVStatus(c *fiber.Ctx) error {
+	staleAfter := defaultCCTVStaleAfter
+	if s := c.Query("stale_after"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid stale_after, use e.g. 6h"})
+		}
+		staleAfter = d
+	}
+
+	cameras, err := h.store.LatestCameraStatuses(c.UserContext(), c.QueryBool("include_archived"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	now := time.Now().UTC()
+	summary, items := cctvStatus(cameras, now, staleAfter, c.QueryBool("problems_only"))
+	return c.JSON(fiber.Map{
+		"generated_at":        now,
+		"stale_after_seconds": int64(staleAfter / time.Second),
+		"summary":             summary,
+		"items":               items,
+	})
+}
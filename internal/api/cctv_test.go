@@ -0,0 +1,42 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+func TestCCTVStatus(t *testing.T) {
+	now := time.Date(2025, 8, 8, 12, 0, 0, 0, time.UTC)
+	str := func(s string) *string { return &s }
+	cameras := []models.CameraStatus{
+		{VesselID: 1, VesselName: "Alpha", CamID: str("bridge"), Status: str("ok"), TS: now.Add(-time.Hour)},
+		{VesselID: 1, VesselName: "Alpha", CamID: str("deck"), Status: str("OFFLINE"), TS: now.Add(-time.Hour)},
+		{VesselID: 2, VesselName: "Bravo", CamID: str("engine"), Status: str("OK"), TS: now.Add(-48 * time.Hour)},
+		{VesselID: 3, VesselName: "Charlie", CamID: str("gangway"), Status: str("Recording"), TS: now},
+	}
+
+	summary, items := cctvStatus(cameras, now, 6*time.Hour, false)
+	if summary.Vessels != 3 || summary.Cameras != 4 || summary.Healthy != 2 || summary.Unhealthy != 2 || summary.Stale != 1 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if summary.ByStatus["OK"] != 2 || summary.ByStatus["OFFLINE"] != 1 || summary.ByStatus["RECORDING"] != 1 {
+		t.Errorf("Unexpected status counts %v", summary.ByStatus)
+	}
+	if len(items) != 3 || len(items[0].Cameras) != 2 || items[0].Unhealthy != 1 {
+		t.Fatalf("Expected cameras grouped by vessel, got %+v", items)
+	}
+	if stale := items[1].Cameras[0]; !stale.Stale || stale.Healthy || stale.AgeSeconds != 48*3600 {
+		t.Errorf("Expected an OK but stale camera to be unhealthy, got %+v", stale)
+	}
+
+	// Problems only keeps the summary but lists just the unhealthy cameras
+	problemSummary, problems := cctvStatus(cameras, now, 6*time.Hour, true)
+	if problemSummary.Cameras != 4 {
+		t.Errorf("Expected the summary to cover every camera, got %+v", problemSummary)
+	}
+	if len(problems) != 2 || *problems[0].Cameras[0].CamID != "deck" || *problems[1].Cameras[0].CamID != "engine" {
+		t.Errorf("Expected the offline and the stale camera, got %+v", problems)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetCDC returns the changes to readings after the since token, in order.
+// Pass next_token as since for the following page; head_token is the
+// newest change, so a consumer copying the data first can start from it.
+func (h *Handlers) GetCDC(c *fiber.Ctx) error {
+	var since int64
+	if s := c.Query("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseInt(s, 10, 64); err != nil || since < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid since token"})
+		}
+	}
+	limits := h.limitsFor(c)
+	limit := limits.Default
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= limits.Max {
+		limit = l
+	}
+
+	changes, head, err := h.store.Changes(c.UserContext(), since, limit)
+	switch {
+	case errors.Is(err, store.ErrCDCToken):
+		return c.Status(400).JSON(fiber.Map{"error": "since token is ahead of the change log"})
+	case errors.Is(err, store.ErrCDCGone):
+		return c.Status(410).JSON(fiber.Map{
+			"error":      "changes after this token have been pruned; copy the data again and resume from head_token",
+			"head_token": strconv.FormatInt(head, 10),
+		})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	next := since
+	if len(changes) > 0 {
+		next = changes[len(changes)-1].Seq
+	}
+	return c.JSON(fiber.Map{
+		"items":      changes,
+		"next_token": strconv.FormatInt(next, 10),
+		"head_token": strconv.FormatInt(head, 10),
+		"has_more":   next < head,
+	})
+}
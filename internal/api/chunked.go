@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/chunked"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/util"
+)
+
+// chunkedUploadResponse is an upload in progress, with the largest chunk
+// the server takes.
+func chunkedUploadResponse(c *fiber.Ctx, upload *models.ChunkedUpload) fiber.Map {
+	return fiber.Map{"upload": upload, "max_chunk_size": c.App().Config().BodyLimit}
+}
+
+// chunkedError answers the errors of the upload manager.
+func chunkedError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, chunked.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, chunked.ErrTooLarge):
+		return c.Status(413).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, chunked.ErrInvalid), errors.Is(err, chunked.ErrChecksum):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+}
+
+// PostChunkedUpload starts a resumable upload of a file of the size given,
+// to be sent in chunks.
+func (h *Handlers) PostChunkedUpload(c *fiber.Ctx) error {
+	if h.uploads == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "chunked uploads are not configured"})
+	}
+	var body struct {
+		Filename string `json:"filename"`
+		Size     int64  `json:"size"`
+		SHA256   string `json:"sha256"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	upload, err := h.uploads.Create(c.UserContext(), body.Filename, body.Size, body.SHA256)
+	if err != nil {
+		return chunkedError(c, err)
+	}
+	c.Set("Location", "/ingest/uploads/"+upload.ID)
+	return c.Status(201).JSON(chunkedUploadResponse(c, upload))
+}
+
+// GetChunkedUpload returns an upload in progress; received is where the
+// next chunk starts.
+func (h *Handlers) GetChunkedUpload(c *fiber.Ctx) error {
+	if h.uploads == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "chunked uploads are not configured"})
+	}
+	upload, err := h.uploads.Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return chunkedError(c, err)
+	}
+	return c.JSON(chunkedUploadResponse(c, upload))
+}
+
+// PostChunkedUploadChunk appends the request body to an upload at offset,
+// if its SHA-256 is the one in X-Chunk-SHA256. A chunk not at the bytes
+// received is refused with 409 and the bytes received, to resume from.
+func (h *Handlers) PostChunkedUploadChunk(c *fiber.Ctx) error {
+	if h.uploads == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "chunked uploads are not configured"})
+	}
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "offset is required"})
+	}
+	checksum := c.Get("X-Chunk-SHA256")
+	if checksum == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "X-Chunk-SHA256 header is required"})
+	}
+
+	upload, err := h.uploads.Append(c.UserContext(), c.Params("id"), offset, c.Body(), checksum)
+	if errors.Is(err, chunked.ErrOffset) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error(), "received": upload.Received})
+	}
+	if err != nil {
+		return chunkedError(c, err)
+	}
+	return c.JSON(chunkedUploadResponse(c, upload))
+}
+
+// PostChunkedUploadComplete ingests the file of an upload all chunks of
+// which arrived, as /ingest/xlsx would (or /ingest/archive for a ZIP file),
+// then drops the upload unless the ingest may succeed if tried again.
+func (h *Handlers) PostChunkedUploadComplete(c *fiber.Ctx) error {
+	if h.uploads == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "chunked uploads are not configured"})
+	}
+	params, err := parseIngestParams(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	id := c.Params("id")
+	upload, data, err := h.uploads.Assemble(c.UserContext(), id)
+	switch {
+	case errors.Is(err, chunked.ErrIncomplete):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error(), "received": upload.Received, "size": upload.Size})
+	case errors.Is(err, chunked.ErrChecksum):
+		// Chunks were checked, so the file sent is not the one announced
+		h.uploads.Remove(c.UserContext(), id)
+		return c.Status(400).JSON(fiber.Map{"error": "file does not match the sha256 announced"})
+	case err != nil:
+		return chunkedError(c, err)
+	}
+	c.Locals(auditDetailKey, map[string]interface{}{"filename": upload.Filename, "file_sha256": util.SHA256Hex(data), "upload": id})
+
+	if strings.EqualFold(path.Ext(upload.Filename), ".zip") {
+		response, err := h.processor.ProcessArchive(c.UserContext(), data, params)
+		err = h.sendArchiveResponse(c, response, err)
+		h.dropCompletedUpload(c, id)
+		return err
+	}
+	response, err := h.processor.ProcessFile(c.UserContext(), data, upload.Filename, params)
+	err = h.sendIngestResponse(c, response, err)
+	h.dropCompletedUpload(c, id)
+	return err
+}
+
+// dropCompletedUpload drops an upload once ingested, or refused for good;
+// after a quota refusal or a server error it is kept to complete again.
+func (h *Handlers) dropCompletedUpload(c *fiber.Ctx, id string) {
+	if status := c.Response().StatusCode(); status == 429 || status >= 500 {
+		return
+	}
+	h.uploads.Remove(c.UserContext(), id)
+}
+
+// DeleteChunkedUpload abandons an upload.
+func (h *Handlers) DeleteChunkedUpload(c *fiber.Ctx) error {
+	if h.uploads == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "chunked uploads are not configured"})
+	}
+	if _, err := h.uploads.Get(c.UserContext(), c.Params("id")); err != nil {
+		return chunkedError(c, err)
+	}
+	if err := h.uploads.Remove(c.UserContext(), c.Params("id")); err != nil {
+		return chunkedError(c, err)
+	}
+	return c.SendStatus(204)
+}
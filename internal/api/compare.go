@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxCompareVessels bounds the vessels in one comparison.
+const maxCompareVessels = 20
+
+// minCompareBucket keeps fine buckets from turning a comparison into a raw dump.
+const minCompareBucket = time.Minute
+
+// compareSeries holds one vessel's values, aligned with the response buckets.
+// Buckets without data are null (count 0). Uncertainty, the ± of avg, is
+// only present if some bucket has readings with an uncertainty estimate.
+type compareSeries struct {
+	VesselID    int64      `json:"vessel_id"`
+	Name        string     `json:"name"`
+	Avg         []*float64 `json:"avg"`
+	Min         []*float64 `json:"min"`
+	Max         []*float64 `json:"max"`
+	Count       []int64    `json:"count"`
+	Uncertainty []*float64 `json:"uncertainty,omitempty"`
+}
+
+// parseBucket parses a bucket size: a Go duration (15m, 6h) or a number of
+// days or weeks (1d, 2w).
+func parseBucket(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	switch {
+	case strings.HasSuffix(s, "d") || strings.HasSuffix(s, "w"):
+		n, convErr := strconv.Atoi(s[:len(s)-1])
+		if convErr != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid bucket %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+		if strings.HasSuffix(s, "w") {
+			d *= 7
+		}
+	default:
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid bucket %q, use e.g. 1h, 1d or 1w", s)
+		}
+	}
+	if d < minCompareBucket || d%time.Second != 0 {
+		return 0, fmt.Errorf("bucket must be whole seconds and at least %s", minCompareBucket)
+	}
+	return d, nil
+}
+
+// parseVesselIDs parses a comma-separated list of distinct vessel ids.
+func parseVesselIDs(s string) ([]int64, error) {
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vessel id %q", part)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("vessels is required, e.g. vessels=1,2,3")
+	}
+	if len(ids) > maxCompareVessels {
+		return nil, fmt.Errorf("at most %d vessels can be compared", maxCompareVessels)
+	}
+	return ids, nil
+}
+
+// alignSeries puts every vessel on the same bucket axis: the sorted starts of
+// all buckets in which any vessel has data.
+func alignSeries(ids []int64, names map[int64]string, stats []store.BucketStats) ([]time.Time, []compareSeries) {
+	index := make(map[time.Time]int)
+	var buckets []time.Time
+	for _, b := range stats {
+		if _, ok := index[b.Start]; !ok {
+			index[b.Start] = 0
+			buckets = append(buckets, b.Start)
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Before(buckets[j]) })
+	for i, start := range buckets {
+		index[start] = i
+	}
+
+	series := make([]compareSeries, len(ids))
+	position := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		position[id] = i
+		series[i] = compareSeries{
+			VesselID: id,
+			Name:     names[id],
+			Avg:      make([]*float64, len(buckets)),
+			Min:      make([]*float64, len(buckets)),
+			Max:      make([]*float64, len(buckets)),
+			Count:    make([]int64, len(buckets)),
+		}
+	}
+
+	for _, b := range stats {
+		p, ok := position[b.VesselID]
+		if !ok {
+			continue
+		}
+		i := index[b.Start]
+		avg, min, max := b.Avg, b.Min, b.Max
+		series[p].Avg[i], series[p].Min[i], series[p].Max[i] = &avg, &min, &max
+		series[p].Count[i] = b.Count
+		if b.Uncertainty != nil {
+			if series[p].Uncertainty == nil {
+				series[p].Uncertainty = make([]*float64, len(buckets))
+			}
+			series[p].Uncertainty[i] = b.Uncertainty
+		}
+	}
+
+	if buckets == nil {
+		buckets = []time.Time{}
+	}
+	return buckets, series
+}
+
+// GetCompare returns one metric of a stream for several vessels as
+// time-bucketed series on a shared bucket axis, to benchmark sister vessels
+// side by side.
+func (h *Handlers) GetCompare(c *fiber.Ctx) error {
+	ids, err := parseVesselIDs(c.Query("vessels"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	def, ok := store.Streams[c.Query("stream")]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid stream"})
+	}
+
+	metric := c.Query("metric")
+	if !def.IsMetric(metric) {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid metric for %s", def.Name)})
+	}
+
+	bucketParam := c.Query("bucket", "1d")
+	bucket, err := parseBucket(bucketParam)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	sources, err := parseSources(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	weighting := c.Query("weighting", "reading")
+	if weighting != "reading" && weighting != "time" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid weighting, use reading or time"})
+	}
+	maxGap := store.DefaultWeightMaxGap
+	if s := c.Query("max_gap"); s != "" {
+		if maxGap, err = time.ParseDuration(s); err != nil || maxGap <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid max_gap, use e.g. 1h"})
+		}
+	}
+
+	names := make(map[int64]string, len(ids))
+	for _, id := range ids {
+		vessel, err := h.store.GetVessel(c.UserContext(), id)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && vessel.ArchivedAt != nil && !c.QueryBool("include_archived")) {
+			return c.Status(404).JSON(fiber.Map{"error": fmt.Sprintf("vessel %d not found", id)})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		names[id] = vessel.Name
+	}
+
+	q := store.SeriesQuery{
+		Stream:    def,
+		Metric:    metric,
+		VesselIDs: ids,
+		Bucket:    bucket,
+		From:      from,
+		To:        to,
+		Sources:   sources,
+	}
+	q.TimeWeighted, q.MaxGap = weighting == "time", maxGap
+	q.Unit, _ = def.ParseUnit(c.Query(def.Unit))
+
+	stats, err := h.store.BucketSeries(c.UserContext(), q)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	buckets, series := alignSeries(ids, names, stats)
+	return c.JSON(fiber.Map{
+		"stream":    def.Name,
+		"metric":    metric,
+		"bucket":    bucketParam,
+		"weighting": weighting,
+		"buckets":   buckets,
+		"series":    series,
+	})
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+func TestParseBucket(t *testing.T) {
+	tests := map[string]time.Duration{
+		"1d":  24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"6h":  6 * time.Hour,
+		"15m": 15 * time.Minute,
+	}
+	for s, want := range tests {
+		if got, err := parseBucket(s); err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s (%v)", s, want, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "d", "0d", "-1d", "30s", "1.5s", "1y", "abc"} {
+		if _, err := parseBucket(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestParseVesselIDs(t *testing.T) {
+	ids, err := parseVesselIDs("3, 1,3,,2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != 3 || ids[1] != 1 || ids[2] != 2 {
+		t.Errorf("Expected [3 1 2], got %v", ids)
+	}
+
+	for _, s := range []string{"", ",", "1,x"} {
+		if _, err := parseVesselIDs(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestAlignSeries(t *testing.T) {
+	day1 := time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	half := 0.5
+	stats := []store.BucketStats{
+		{VesselID: 1, Start: day1, Avg: 10, Min: 5, Max: 15, Count: 2},
+		{VesselID: 2, Start: day2, Avg: 20, Min: 20, Max: 20, Count: 1},
+		{VesselID: 1, Start: day2, Avg: 12, Min: 12, Max: 12, Count: 1, Uncertainty: &half},
+	}
+
+	buckets, series := alignSeries([]int64{2, 1, 3}, map[int64]string{1: "A", 2: "B"}, stats)
+	if len(buckets) != 2 || !buckets[0].Equal(day1) || !buckets[1].Equal(day2) {
+		t.Fatalf("Expected buckets [day1 day2], got %v", buckets)
+	}
+
+	// Series keep the requested vessel order
+	if series[0].VesselID != 2 || series[0].Name != "B" || series[1].VesselID != 1 {
+		t.Fatalf("Unexpected series order %+v", series)
+	}
+	if series[0].Avg[0] != nil || series[0].Count[0] != 0 || *series[0].Avg[1] != 20 {
+		t.Errorf("Expected vessel 2 to have a gap on day 1, got %+v", series[0])
+	}
+	if *series[1].Avg[0] != 10 || *series[1].Min[0] != 5 || *series[1].Max[0] != 15 || series[1].Count[0] != 2 {
+		t.Errorf("Unexpected vessel 1 day 1 values %+v", series[1])
+	}
+
+	// Only vessel 1 has an estimate, on day 2
+	if u := series[1].Uncertainty; len(u) != 2 || u[0] != nil || *u[1] != 0.5 || series[0].Uncertainty != nil {
+		t.Errorf("Unexpected uncertainties %v and %v", series[1].Uncertainty, series[0].Uncertainty)
+	}
+
+	// A vessel without data is all gaps
+	if series[2].Avg[0] != nil || series[2].Avg[1] != nil {
+		t.Errorf("Expected vessel 3 to be empty, got %+v", series[2])
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+// versionTag is a weak ETag for a representation of data at the stream
+// versions given: parts name what else it depends on, such as the query
+// and the media type.
+func versionTag(versions map[string]store.StreamVersion, parts ...string) string {
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%s\x1f", part)
+	}
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%d\x1f", name, versions[name].Version)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// notModified sets the ETag and Last-Modified of a response, and reports
+// whether If-None-Match names the ETag, so the client's copy is current
+// and 304 can be sent without building the body. If-Modified-Since is not
+// honored: its one-second resolution misses writes within the same second.
+func notModified(c *fiber.Ctx, etag string, modified time.Time) bool {
+	c.Set(fiber.HeaderETag, etag)
+	if !modified.IsZero() {
+		c.Set(fiber.HeaderLastModified, modified.UTC().Format(http.TimeFormat))
+	}
+	match := c.Get(fiber.HeaderIfNoneMatch)
+	if match == "" {
+		return false
+	}
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.TrimSpace(tag)
+		// Weak comparison, as the body may be compressed differently
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// lastModified is the latest of t and the stream versions' updates.
+func lastModified(t time.Time, versions map[string]store.StreamVersion) time.Time {
+	for _, v := range versions {
+		if v.UpdatedAt.After(t) {
+			t = v.UpdatedAt
+		}
+	}
+	return t
+}
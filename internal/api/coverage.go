@@ -0,0 +1,134 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+const (
+	coverageDateLayout = "2006-01-02"
+	maxCoverageDays    = 1000
+)
+
+type coverageDay struct {
+	Date    string           `json:"date"`
+	Rows    map[string]int64 `json:"rows"`
+	Missing []string         `json:"missing"`
+}
+
+// parseStreamList parses a comma separated stream list; empty means every stream.
+func parseStreamList(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return store.StreamOrder, nil
+	}
+
+	var streams []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := store.Streams[name]; !ok {
+			return nil, fmt.Errorf("invalid stream: %s", name)
+		}
+		streams = append(streams, name)
+	}
+	return streams, nil
+}
+
+// buildCoverageCalendar expands per-stream daily row counts into one entry per
+// calendar day between start and end (inclusive), so days without any data
+// show up explicitly instead of being absent.
+func buildCoverageCalendar(start, end time.Time, streams []string, counts map[string]map[string]int64) []coverageDay {
+	days := []coverageDay{}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		date := d.Format(coverageDateLayout)
+		day := coverageDay{Date: date, Rows: make(map[string]int64, len(streams)), Missing: []string{}}
+		for _, stream := range streams {
+			n := counts[stream][date]
+			day.Rows[stream] = n
+			if n == 0 {
+				day.Missing = append(day.Missing, stream)
+			}
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// GetVesselCoverage returns a per-day, per-stream calendar of whether any
+// telemetry exists for the vessel, for "which days are missing" heatmaps.
+func (h *Handlers) GetVesselCoverage(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	streams, err := parseStreamList(c.Query("stream"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	counts := make(map[string]map[string]int64, len(streams))
+	var first, last string
+
+	for _, stream := range streams {
+		daily, err := h.store.DailyCounts(c.UserContext(), store.Streams[stream], vesselID, from, to)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		counts[stream] = daily
+		for day := range daily {
+			if first == "" || day < first {
+				first = day
+			}
+			if day > last {
+				last = day
+			}
+		}
+	}
+
+	// Without an explicit range the calendar spans the data that exists
+	var start, end time.Time
+	if from != nil {
+		start = from.UTC()
+	} else if first != "" {
+		start, _ = time.Parse(coverageDateLayout, first)
+	}
+	if to != nil {
+		end = to.UTC()
+	} else if last != "" {
+		end, _ = time.Parse(coverageDateLayout, last)
+	}
+
+	days := []coverageDay{}
+	if !start.IsZero() && !end.IsZero() {
+		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+		if end.Sub(start) > maxCoverageDays*24*time.Hour {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("range too large, maximum is %d days", maxCoverageDays)})
+		}
+		days = buildCoverageCalendar(start, end, streams, counts)
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"streams":   streams,
+		"days":      days,
+	})
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+func TestBuildCoverageCalendar(t *testing.T) {
+	start := time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 8, 10, 0, 0, 0, 0, time.UTC)
+	counts := map[string]map[string]int64{
+		"engines": {"2025-08-08": 12, "2025-08-10": 3},
+		"fuel":    {"2025-08-09": 1},
+	}
+
+	days := buildCoverageCalendar(start, end, []string{"engines", "fuel"}, counts)
+	if len(days) != 3 {
+		t.Fatalf("Expected 3 days, got %d", len(days))
+	}
+
+	if days[0].Date != "2025-08-08" || days[0].Rows["engines"] != 12 {
+		t.Errorf("Expected 12 engine rows on 2025-08-08, got %+v", days[0])
+	}
+
+	// Day without engine data must be reported as missing
+	if len(days[1].Missing) != 1 || days[1].Missing[0] != "engines" {
+		t.Errorf("Expected engines missing on 2025-08-09, got %v", days[1].Missing)
+	}
+}
+
+func TestParseStreamList(t *testing.T) {
+	// Empty means all streams
+	if streams, err := parseStreamList(""); err != nil || len(streams) != len(store.StreamOrder) {
+		t.Errorf("Expected all streams, got %v, err: %v", streams, err)
+	}
+
+	if streams, err := parseStreamList("engines, fuel"); err != nil || len(streams) != 2 {
+		t.Errorf("Expected 2 streams, got %v, err: %v", streams, err)
+	}
+
+	if _, err := parseStreamList("engines,radar"); err == nil {
+		t.Errorf("Expected error for unknown stream")
+	}
+}
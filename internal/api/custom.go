@@ -0,0 +1,309 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxCustomColumns bounds the columns of one custom stream.
+const maxCustomColumns = 50
+
+// customName is the form of custom stream and column names.
+var customName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// validateCustomStream checks a custom stream definition and fills in the
+// defaults: the name as sheet match and as header of each column.
+func validateCustomStream(def *models.CustomStream) error {
+	if !customName.MatchString(def.Name) {
+		return errors.New("invalid name, use lower-case letters, digits and underscores")
+	}
+	if _, ok := store.Streams[def.Name]; ok {
+		return fmt.Errorf("%s is a built-in stream", def.Name)
+	}
+
+	sheets := def.Sheets[:0]
+	for _, s := range def.Sheets {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			sheets = append(sheets, s)
+		}
+	}
+	if len(sheets) == 0 {
+		sheets = []string{def.Name}
+	}
+	def.Sheets = sheets
+
+	if len(def.Columns) == 0 || len(def.Columns) > maxCustomColumns {
+		return fmt.Errorf("a custom stream needs 1 to %d columns", maxCustomColumns)
+	}
+	seen := make(map[string]bool, len(def.Columns))
+	for i := range def.Columns {
+		col := &def.Columns[i]
+		if !customName.MatchString(col.Name) {
+			return fmt.Errorf("invalid column name %q, use lower-case letters, digits and underscores", col.Name)
+		}
+		if seen[col.Name] {
+			return fmt.Errorf("duplicate column %s", col.Name)
+		}
+		seen[col.Name] = true
+
+		switch col.Type {
+		case models.CustomInt, models.CustomFloat:
+			if col.Min != nil && col.Max != nil && *col.Min > *col.Max {
+				return fmt.Errorf("column %s: min must not exceed max", col.Name)
+			}
+		case models.CustomText:
+			if col.Min != nil || col.Max != nil {
+				return fmt.Errorf("column %s: only numeric columns have a range", col.Name)
+			}
+		default:
+			return fmt.Errorf("column %s: invalid type, use int, float or text", col.Name)
+		}
+
+		headers := col.Headers[:0]
+		for _, h := range col.Headers {
+			if h = strings.TrimSpace(h); h != "" {
+				headers = append(headers, h)
+			}
+		}
+		if len(headers) == 0 {
+			headers = []string{col.Name}
+		}
+		col.Headers = headers
+	}
+
+	if def.UnitColumn = trimmedOrNil(def.UnitColumn); def.UnitColumn != nil {
+		unit, ok := customColumn(def, *def.UnitColumn)
+		if !ok {
+			return fmt.Errorf("unit_column %s is not a column", *def.UnitColumn)
+		}
+		if unit.Type == models.CustomFloat {
+			return errors.New("unit_column must be an int or text column")
+		}
+	}
+	return nil
+}
+
+func customColumn(def *models.CustomStream, name string) (models.CustomColumn, bool) {
+	for _, col := range def.Columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return models.CustomColumn{}, false
+}
+
+// GetCustomStreams lists the custom stream definitions.
+func (h *Handlers) GetCustomStreams(c *fiber.Ctx) error {
+	defs, err := h.store.CustomStreams(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if wantsHAL(c) {
+		items := make([]map[string]interface{}, len(defs))
+		for i, def := range defs {
+			if items[i], err = withLinks(def, halLinks{"self": customStreamLink(def.Name)}); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		return sendHAL(c, fiber.Map{"items": items}, halLinks{
+			"self":     {Href: "/streams/custom"},
+			"built_in": {Href: "/streams", Title: "Built-in stream definitions"},
+		})
+	}
+	return c.JSON(fiber.Map{"items": defs})
+}
+
+// GetCustomStream returns one custom stream definition.
+func (h *Handlers) GetCustomStream(c *fiber.Ctx) error {
+	def, err := h.store.CustomStream(c.UserContext(), c.Params("name"))
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "custom stream not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if wantsHAL(c) {
+		return sendHAL(c, def, halLinks{"self": customStreamLink(def.Name), "collection": {Href: "/streams/custom"}})
+	}
+	return c.JSON(def)
+}
+
+// PutCustomStream defines or redefines a custom stream; the name comes from
+// the path. Readings already ingested keep their values.
+func (h *Handlers) PutCustomStream(c *fiber.Ctx) error {
+	var def models.CustomStream
+	if err := json.Unmarshal(c.Body(), &def); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	name := c.Params("name")
+	if def.Name != "" && def.Name != name {
+		return c.Status(400).JSON(fiber.Map{"error": "name in body does not match the path"})
+	}
+	def.Name = name
+	def.Description = trimmedOrNil(def.Description)
+	if err := validateCustomStream(&def); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	def.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	created, err := h.store.PutCustomStream(c.UserContext(), def)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	saved, err := h.store.CustomStream(c.UserContext(), name)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if created {
+		return c.Status(201).JSON(saved)
+	}
+	return c.JSON(saved)
+}
+
+// DeleteCustomStream removes a custom stream. A stream with readings is only
+// removed, readings and all, with purge=true.
+func (h *Handlers) DeleteCustomStream(c *fiber.Ctx) error {
+	def, err := h.store.CustomStream(c.UserContext(), c.Params("name"))
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "custom stream not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	readings, err := h.store.CountCustomReadings(c.UserContext(), def.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if readings > 0 && !c.QueryBool("purge") {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("custom stream has %d readings; add purge=true to delete them too", readings)})
+	}
+	c.Locals(auditDetailKey, map[string]interface{}{"readings_deleted": readings})
+
+	if err := h.store.DeleteCustomStream(c.UserContext(), def.Name); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "custom stream not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// customQuery reads the vessel, custom stream and unit of a custom stream
+// request, answering it itself on errors.
+func (h *Handlers) customQuery(c *fiber.Ctx) (store.CustomQuery, bool, error) {
+	var q store.CustomQuery
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return q, false, c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return q, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return q, false, c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	def, err := h.store.CustomStream(c.UserContext(), c.Params("name"))
+	if errors.Is(err, store.ErrNotFound) {
+		return q, false, c.Status(404).JSON(fiber.Map{"error": "custom stream not found"})
+	} else if err != nil {
+		return q, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	q.StreamID, q.VesselID = def.ID, vesselID
+	if unit := c.Query("unit"); unit != "" {
+		if def.UnitColumn == nil {
+			return q, false, c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("custom stream %s has no unit column", def.Name)})
+		}
+		q.Unit = &unit
+	}
+	return q, true, nil
+}
+
+// GetVesselCustomReadings pages through a vessel's readings of a custom
+// stream, oldest first unless order=desc.
+func (h *Handlers) GetVesselCustomReadings(c *fiber.Ctx) error {
+	q, ok, err := h.customQuery(c)
+	if !ok {
+		return err
+	}
+
+	limits := h.limitsFor(c)
+	limit := limits.Default
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= limits.Max {
+		limit = l
+	}
+
+	var page Cursor
+	switch c.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "invalid order, use asc or desc"})
+	}
+	cursor, err := ParseCursor(c.Query("cursor"))
+	if err != nil || (c.Query("cursor") != "" && (cursor.Desc != page.Desc || cursor.Sort != "")) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid cursor"})
+	}
+
+	fromParam, toParam, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	q.From, q.To = fromParam, toParam
+	q.Desc, q.AfterTS, q.AfterID = page.Desc, cursor.TS, cursor.ID
+	q.Limit = limit + 1 // one extra to see if there is a next page
+
+	readings, err := h.store.CustomReadings(c.UserContext(), q)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	response, next := fiber.Map{"items": readings}, ""
+	if len(readings) > limit {
+		last := readings[limit-1]
+		page.TS, page.ID = last.TS, last.ID
+		next = page.Encode()
+		response["items"] = readings[:limit]
+		response["next_cursor"] = next
+	}
+	if wantsHAL(c) {
+		links := selfLinks(c.OriginalURL(), next)
+		links["vessel"] = vesselLinks(q.VesselID)["self"]
+		links["stream"] = customStreamLink(c.Params("name"))
+		return sendHAL(c, response, links)
+	}
+	return c.JSON(response)
+}
+
+// GetVesselCustomLatest returns a vessel's newest reading of a custom
+// stream, of one unit with unit=.
+func (h *Handlers) GetVesselCustomLatest(c *fiber.Ctx) error {
+	q, ok, err := h.customQuery(c)
+	if !ok {
+		return err
+	}
+	q.Desc, q.Limit = true, 1
+
+	readings, err := h.store.CustomReadings(c.UserContext(), q)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(readings) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "no data found"})
+	}
+	if wantsHAL(c) {
+		links := selfLinks(c.OriginalURL(), "")
+		links["vessel"] = vesselLinks(q.VesselID)["self"]
+		links["stream"] = customStreamLink(c.Params("name"))
+		return sendHAL(c, readings[0], links)
+	}
+	return c.JSON(readings[0])
+}
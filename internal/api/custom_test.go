@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+func TestValidateCustomStream(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"name": "ballast", "columns": [{"name": "pump_no", "type": "int"}, {"name": "flow_m3h", "type": "float", "min": 0, "max": 500}], "unit_column": "pump_no"}`: "",
+		`{"name": "Ballast", "columns": [{"name": "flow", "type": "float"}]}`:                                                                                         "invalid name, use lower-case letters, digits and underscores",
+		`{"name": "engines", "columns": [{"name": "flow", "type": "float"}]}`:                                                                                         "engines is a built-in stream",
+		`{"name": "ballast", "columns": []}`: "a custom stream needs 1 to 50 columns",
+		`{"name": "ballast", "columns": [{"name": "flow", "type": "float"}, {"name": "flow", "type": "int"}]}`: "duplicate column flow",
+		`{"name": "ballast", "columns": [{"name": "flow", "type": "bool"}]}`:                                   "column flow: invalid type, use int, float or text",
+		`{"name": "ballast", "columns": [{"name": "flow", "type": "float", "min": 5, "max": 1}]}`:              "column flow: min must not exceed max",
+		`{"name": "ballast", "columns": [{"name": "mode", "type": "text", "max": 1}]}`:                         "column mode: only numeric columns have a range",
+		`{"name": "ballast", "columns": [{"name": "flow", "type": "float"}], "unit_column": "pump"}`:           "unit_column pump is not a column",
+		`{"name": "ballast", "columns": [{"name": "flow", "type": "float"}], "unit_column": "flow"}`:           "unit_column must be an int or text column",
+	} {
+		var def models.CustomStream
+		if err := json.Unmarshal([]byte(body), &def); err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if err := validateCustomStream(&def); err != nil {
+			got = err.Error()
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", body, want, got)
+		}
+	}
+
+	// Sheets and headers default to the names
+	def := models.CustomStream{Name: "ballast", Sheets: []string{" Ballast Log ", ""}, Columns: []models.CustomColumn{{Name: "flow", Type: models.CustomFloat}}}
+	if err := validateCustomStream(&def); err != nil {
+		t.Fatal(err)
+	}
+	if len(def.Sheets) != 1 || def.Sheets[0] != "ballast log" || len(def.Columns[0].Headers) != 1 || def.Columns[0].Headers[0] != "flow" {
+		t.Errorf("Expected cleaned sheets and default headers, got %v %v", def.Sheets, def.Columns[0].Headers)
+	}
+}
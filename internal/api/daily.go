@@ -0,0 +1,42 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/daily"
+)
+
+// GetVesselDaily returns the vessel's daily summaries from the nightly
+// daily-summary job, oldest first, for the days from..to (YYYY-MM-DD,
+// inclusive).
+func (h *Handlers) GetVesselDaily(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to := c.Query("from"), c.Query("to")
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse(daily.DayLayout, day); day != "" && err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid day " + strconv.Quote(day) + ", use YYYY-MM-DD"})
+		}
+	}
+
+	summaries, err := h.store.DailySummaries(c.UserContext(), vesselID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     summaries,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/dcs"
+	"vessel-telemetry-api/internal/noon"
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetVesselDCS returns the vessel's IMO Data Collection System figures of a
+// calendar year, by default the last one, aggregated from its telemetry and
+// noon reports with the breakdown a verifier checks them against.
+func (h *Handlers) GetVesselDCS(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+
+	now := time.Now().UTC()
+	year := c.QueryInt("year", now.Year()-1)
+	if year < 2000 || year > now.Year() {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid year, use 2000 to %d", now.Year())})
+	}
+	opts := dcs.DefaultOptions
+	code := strings.ToLower(c.Query("fuel_type", "hfo"))
+	fuel, ok := dcs.FuelTypes[code]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid fuel_type, use hfo, lfo or diesel_gas_oil"})
+	}
+	opts.Fuel = fuel
+	if opts.Fuel.Density = c.QueryFloat("density", fuel.Density); opts.Fuel.Density <= 0 || opts.Fuel.Density > 1.1 {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid density, use t/m3 up to 1.1"})
+	}
+	switch opts.Source = c.Query("source"); opts.Source {
+	case "", dcs.Telemetry, dcs.NoonReports:
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "invalid source, use telemetry or noon_reports"})
+	}
+
+	ctx := c.UserContext()
+	from, to := dcs.Period(year, now)
+	var in dcs.Inputs
+	vessel, err := h.store.GetVessel(ctx, vesselID)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	in.Vessel = *vessel
+	if in.Engines, err = h.store.Engines(ctx, vesselID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if in.Fixes, err = h.store.Positions(ctx, vesselID, &from, &to); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	tanks, err := h.store.MetricSamples(ctx, store.Streams["fuel"], vesselID, []string{"volume_liters"}, nil, &from, &to, store.SourceFilter{})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, t := range tanks {
+		in.Tanks = append(in.Tanks, t.Metrics["volume_liters"])
+	}
+	if in.Generators, err = h.store.GeneratorReadings(ctx, vesselID, &from, &to); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	// From the report before the year, whose fuel on board the first report
+	// of the year is measured from
+	reportsFrom := from.Add(-noon.MaxPeriod)
+	if in.NoonReports, err = h.store.NoonReports(ctx, store.NoonReportFilter{VesselID: vesselID, From: &reportsFrom, To: &to}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(dcs.Build(from, to, in, opts))
+}
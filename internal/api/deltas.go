@@ -0,0 +1,128 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/deltas"
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxDeltas bounds the deltas of one response.
+const maxDeltas = 10000
+
+// unitDeltas are the deltas of one unit's readings.
+type unitDeltas struct {
+	Unit   interface{}    `json:"unit"`
+	Total  float64        `json:"total"`
+	Deltas []deltas.Delta `json:"deltas"`
+}
+
+// parseAmount parses an optional non-negative query number.
+func parseAmount(c *fiber.Ctx, name string) (*float64, error) {
+	s := c.Query(name)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("invalid %s, use a non-negative number", name)
+	}
+	return &v, nil
+}
+
+// GetVesselTelemetryDeltas returns the change of a metric, or of a numeric
+// key of extra_json such as a running hours counter, between consecutive
+// readings of each unit, with its rate, leaving out jumps like bunkering.
+func (h *Handlers) GetVesselTelemetryDeltas(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	def, ok := store.Streams[c.Query("stream")]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid stream"})
+	}
+	metric, extraKey := c.Query("metric"), c.Query("extra")
+	if (metric == "") == (extraKey == "") {
+		return c.Status(400).JSON(fiber.Map{"error": "give either metric or extra, e.g. metric=volume_liters or extra=Running Hours"})
+	}
+	if metric != "" && !def.IsMetric(metric) {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid metric for %s", def.Name)})
+	}
+
+	var opts deltas.Options
+	perParam := c.Query("per", "1h")
+	if opts.Per, err = parseInterval("per", perParam); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if s := c.Query("max_gap"); s != "" {
+		if opts.MaxGap, err = parseInterval("max_gap", s); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if opts.MaxIncrease, err = parseAmount(c, "max_increase"); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if opts.MaxDecrease, err = parseAmount(c, "max_decrease"); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	sources, err := parseSources(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	unit, _ := def.ParseUnit(c.Query(def.Unit))
+
+	var samples []store.UnitSamples
+	name := metric
+	if metric != "" {
+		samples, err = h.store.MetricSamples(c.UserContext(), def, vesselID, []string{metric}, unit, from, to, sources)
+	} else {
+		name = extraKey
+		samples, err = h.store.ExtraSamples(c.UserContext(), def, vesselID, extraKey, unit, from, to, sources)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	units := make([]unitDeltas, 0, len(samples))
+	count := 0
+	for _, u := range samples {
+		points := u.Metrics[name]
+		if len(points) == 0 {
+			continue
+		}
+		if count += len(points) - 1; count > maxDeltas {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("more than %d deltas, use a shorter range or one unit", maxDeltas)})
+		}
+		d, total := deltas.Compute(points, opts)
+		units = append(units, unitDeltas{Unit: u.Unit, Total: total, Deltas: d})
+	}
+
+	result := fiber.Map{
+		"vessel_id": vesselID,
+		"stream":    def.Name,
+		"per":       perParam,
+		"units":     units,
+	}
+	if metric != "" {
+		result["metric"] = metric
+	} else {
+		result["extra"] = extraKey
+	}
+	return c.JSON(result)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetVesselEngines lists the vessel's registered engines.
+func (h *Handlers) GetVesselEngines(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, true); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	engines, err := h.store.Engines(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     engines,
+	})
+}
+
+// trimmedOrNil trims s, turning a blank string into nil.
+func trimmedOrNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	if v := strings.TrimSpace(*s); v != "" {
+		return &v
+	}
+	return nil
+}
+
+// validateEngine checks an engine's rated limits and commissioning date.
+func validateEngine(e models.Engine) error {
+	if e.RatedRPM != nil && *e.RatedRPM <= 0 {
+		return errors.New("rated_rpm must be a positive number")
+	}
+	if e.RatedPowerKW != nil && *e.RatedPowerKW <= 0 {
+		return errors.New("rated_power_kw must be a positive number")
+	}
+	if e.CommissionedOn != nil {
+		if _, err := time.Parse("2006-01-02", *e.CommissionedOn); err != nil {
+			return errors.New("invalid commissioned_on, use YYYY-MM-DD")
+		}
+	}
+	return nil
+}
+
+// PutVesselEngine registers or replaces an engine; the engine number comes
+// from the path.
+func (h *Handlers) PutVesselEngine(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	engineNo, err := strconv.Atoi(c.Params("engine_no"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid engine number"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, true); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	var engine models.Engine
+	if err := json.Unmarshal(c.Body(), &engine); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	if engine.EngineNo != 0 && engine.EngineNo != engineNo {
+		return c.Status(400).JSON(fiber.Map{"error": "engine_no in body does not match the path"})
+	}
+	engine.EngineNo = engineNo
+	engine.Name = trimmedOrNil(engine.Name)
+	engine.Maker = trimmedOrNil(engine.Maker)
+	engine.Model = trimmedOrNil(engine.Model)
+	engine.CommissionedOn = trimmedOrNil(engine.CommissionedOn)
+	if err := validateEngine(engine); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	engine.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	created, err := h.store.PutEngine(c.UserContext(), vesselID, engine)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if created {
+		return c.Status(201).JSON(engine)
+	}
+	return c.JSON(engine)
+}
+
+// DeleteVesselEngine removes an engine from the registry; its readings are
+// kept.
+func (h *Handlers) DeleteVesselEngine(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	engineNo, err := strconv.Atoi(c.Params("engine_no"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid engine number"})
+	}
+
+	err = h.store.DeleteEngine(c.UserContext(), vesselID, engineNo)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "engine not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/maintenance"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// recentMaintenance is how many maintenance entries the vessel detail shows.
+const recentMaintenance = 5
+
+// equipmentLogBody is the body of POST and PUT /vessels/:id/equipment-log.
+type equipmentLogBody struct {
+	Kind              string  `json:"kind"`
+	Equipment         *string `json:"equipment"`
+	Unit              *string `json:"unit"`
+	MaintenanceItemID *int64  `json:"maintenance_item_id"`
+	Title             string  `json:"title"`
+	Description       *string `json:"description"`
+	Severity          *string `json:"severity"`
+	OccurredOn        string  `json:"occurred_on"`
+	Status            *string `json:"status"`
+	ClosedOn          *string `json:"closed_on"`
+}
+
+// equipmentKinds returns the sensor kinds of the built-in streams, sorted,
+// and the stream of each.
+func equipmentKinds() ([]string, map[string]string) {
+	streams := make(map[string]string)
+	var kinds []string
+	for name, def := range store.Streams {
+		if def.Kind != "" {
+			streams[def.Kind] = name
+			kinds = append(kinds, def.Kind)
+		}
+	}
+	sort.Strings(kinds)
+	return kinds, streams
+}
+
+// equipmentLogEntry reads and checks an entry from the request body,
+// answering the request itself on errors. A missing occurred_on means today.
+func (h *Handlers) equipmentLogEntry(c *fiber.Ctx, vesselID int64, now time.Time) (models.EquipmentLogEntry, bool, error) {
+	bad := func(msg string) (models.EquipmentLogEntry, bool, error) {
+		return models.EquipmentLogEntry{}, false, c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	var body equipmentLogBody
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return bad("invalid JSON body")
+	}
+	e := models.EquipmentLogEntry{
+		VesselID:    vesselID,
+		Kind:        strings.ToLower(strings.TrimSpace(body.Kind)),
+		Equipment:   trimmedOrNil(body.Equipment),
+		Unit:        trimmedOrNil(body.Unit),
+		Title:       strings.TrimSpace(body.Title),
+		Description: trimmedOrNil(body.Description),
+		OccurredOn:  strings.TrimSpace(body.OccurredOn),
+	}
+	if e.OccurredOn == "" {
+		e.OccurredOn = now.Format(maintenance.DayLayout)
+	}
+	if err := checkDoneOn(e.OccurredOn, now); err != nil {
+		return bad(err.Error())
+	}
+
+	switch e.Kind {
+	case models.LogMaintenance:
+		if body.Severity != nil || body.Status != nil || body.ClosedOn != nil {
+			return bad("severity, status and closed_on apply to defects only")
+		}
+		if body.MaintenanceItemID != nil {
+			item, err := h.store.MaintenanceItem(c.UserContext(), vesselID, *body.MaintenanceItemID)
+			if errors.Is(err, store.ErrNotFound) {
+				return bad(fmt.Sprintf("maintenance item %d not found", *body.MaintenanceItemID))
+			} else if err != nil {
+				return e, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			e.MaintenanceItemID = &item.ID
+			// The item's engine or generator unless given
+			if e.Equipment == nil && e.Unit == nil {
+				unit := strconv.Itoa(item.UnitNo)
+				e.Equipment, e.Unit = &item.Equipment, &unit
+			}
+			if e.Title == "" {
+				e.Title = item.Task
+			}
+		}
+	case models.LogDefect:
+		if body.MaintenanceItemID != nil {
+			return bad("maintenance_item_id applies to maintenance only")
+		}
+		severity, status := "minor", models.DefectOpen
+		if body.Severity != nil {
+			severity = strings.ToLower(strings.TrimSpace(*body.Severity))
+		}
+		if !contains(models.DefectSeverities, severity) {
+			return bad("invalid severity, use " + strings.Join(models.DefectSeverities, ", "))
+		}
+		if body.Status != nil {
+			status = strings.ToLower(strings.TrimSpace(*body.Status))
+		}
+		switch status {
+		case models.DefectOpen:
+			if trimmedOrNil(body.ClosedOn) != nil {
+				return bad("an open defect has no closed_on")
+			}
+		case models.DefectClosed:
+			closedOn := now.Format(maintenance.DayLayout)
+			if day := trimmedOrNil(body.ClosedOn); day != nil {
+				closedOn = *day
+			}
+			if err := checkDoneOn(closedOn, now); err != nil {
+				return bad(err.Error())
+			}
+			if closedOn < e.OccurredOn {
+				return bad("closed_on is before occurred_on")
+			}
+			e.ClosedOn = &closedOn
+		default:
+			return bad("invalid status, use open or closed")
+		}
+		e.Severity, e.Status = &severity, &status
+	default:
+		return bad("invalid kind, use maintenance or defect")
+	}
+
+	if e.Title == "" || len(e.Title) > 200 {
+		return bad("title must be 1 to 200 characters")
+	}
+	if e.Description != nil && len(*e.Description) > 4000 {
+		return bad("description must be at most 4000 characters")
+	}
+
+	if (e.Equipment == nil) != (e.Unit == nil) {
+		return bad("give equipment and unit together, or neither for the vessel itself")
+	}
+	if e.Equipment != nil {
+		kinds, streams := equipmentKinds()
+		kind := strings.ToLower(*e.Equipment)
+		stream, ok := streams[kind]
+		if !ok {
+			return bad("invalid equipment, use one of " + strings.Join(kinds, ", "))
+		}
+		e.Equipment = &kind
+		sensorID, known, err := h.registeredUnit(c.UserContext(), vesselID, kind, stream, *e.Unit)
+		if err != nil {
+			return e, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !known {
+			return bad(fmt.Sprintf("%s %s is not registered for the vessel", kind, *e.Unit))
+		}
+		e.SensorID = sensorID
+	}
+	return e, true, nil
+}
+
+// registeredUnit reports whether a unit of equipment is in the sensor
+// registry, with its sensor ID, or else in the engine or tank registry.
+func (h *Handlers) registeredUnit(ctx context.Context, vesselID int64, kind, stream, unit string) (*int64, bool, error) {
+	sensors, err := h.store.Sensors(ctx, vesselID, stream)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, s := range sensors {
+		if s.Unit == unit {
+			return &s.ID, true, nil
+		}
+	}
+	n, err := strconv.Atoi(unit)
+	if err != nil {
+		return nil, false, nil
+	}
+	switch kind {
+	case "engine":
+		engines, err := h.store.Engines(ctx, vesselID)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, e := range engines {
+			if e.EngineNo == n {
+				return nil, true, nil
+			}
+		}
+	case "tank":
+		tanks, err := h.store.Tanks(ctx, vesselID)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, t := range tanks {
+			if t.TankNo == n {
+				return nil, true, nil
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// loadEquipmentLogEntry loads the vessel's entry whose ID is in the path,
+// answering the request itself on errors.
+func (h *Handlers) loadEquipmentLogEntry(c *fiber.Ctx, vesselID int64) (*models.EquipmentLogEntry, error) {
+	id, err := strconv.ParseInt(c.Params("entry_id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "invalid log entry id"})
+	}
+	e, err := h.store.EquipmentLogEntry(c.UserContext(), vesselID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "log entry not found"})
+	} else if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return e, nil
+}
+
+// GetVesselEquipmentLog lists the vessel's completed maintenance and
+// defects, oldest first, to line up with its telemetry.
+func (h *Handlers) GetVesselEquipmentLog(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	f := store.EquipmentLogFilter{
+		VesselID:  vesselID,
+		Kind:      c.Query("kind"),
+		Equipment: c.Query("equipment"),
+		Unit:      c.Query("unit"),
+		Status:    c.Query("status"),
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+	}
+	for _, day := range []string{f.From, f.To} {
+		if _, err := time.Parse(maintenance.DayLayout, day); day != "" && err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid day " + strconv.Quote(day) + ", use YYYY-MM-DD"})
+		}
+	}
+
+	entries, err := h.store.EquipmentLog(c.UserContext(), f)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     entries,
+	})
+}
+
+// GetVesselEquipmentLogEntry returns one log entry.
+func (h *Handlers) GetVesselEquipmentLogEntry(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	e, err := h.loadEquipmentLogEntry(c, vesselID)
+	if e == nil {
+		return err
+	}
+	return c.JSON(e)
+}
+
+// PostVesselEquipmentLog records completed maintenance or a defect.
+func (h *Handlers) PostVesselEquipmentLog(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	e, ok, err := h.equipmentLogEntry(c, vesselID, now)
+	if !ok {
+		return err
+	}
+	e.CreatedAt, e.UpdatedAt = now, now
+	if e.ID, err = h.store.CreateEquipmentLogEntry(c.UserContext(), e); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(e)
+}
+
+// PutVesselEquipmentLogEntry replaces a log entry, e.g. to close a defect.
+func (h *Handlers) PutVesselEquipmentLogEntry(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	existing, err := h.loadEquipmentLogEntry(c, vesselID)
+	if existing == nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	e, ok, err := h.equipmentLogEntry(c, vesselID, now)
+	if !ok {
+		return err
+	}
+	e.ID, e.CreatedAt, e.UpdatedAt = existing.ID, existing.CreatedAt, now
+	if err := h.store.UpdateEquipmentLogEntry(c.UserContext(), e); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "log entry not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(e)
+}
+
+// DeleteVesselEquipmentLogEntry removes a log entry.
+func (h *Handlers) DeleteVesselEquipmentLogEntry(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Params("entry_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid log entry id"})
+	}
+	if err := h.store.DeleteEquipmentLogEntry(c.UserContext(), vesselID, id); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "log entry not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/watermark"
+)
+
+// exportRow is one reading in an export, with values in Stream.Fields order.
+type exportRow struct {
+	ID        int64
+	Timestamp time.Time
+	Values    []interface{}
+	Extra     string // canonical extra_json (keys sorted)
+}
+
+// canonicalJSON re-encodes a JSON object with sorted keys so payloads that
+// differ only in key order compare equal. Invalid JSON is returned unchanged.
+func canonicalJSON(raw []byte) string {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return "{}"
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	out, err := json.Marshal(v) // map keys are marshalled in sorted order
+	if err != nil {
+		return string(raw)
+	}
+	return string(out)
+}
+
+// formatExportValue renders a scanned SQLite value for CSV output.
+func formatExportValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// duplicateKey identifies a row by its content, ignoring id and row_hash.
+func (r exportRow) duplicateKey() string {
+	parts := make([]string, 0, len(r.Values)+2)
+	parts = append(parts, r.Timestamp.UTC().Format(time.RFC3339Nano))
+	for _, v := range r.Values {
+		parts = append(parts, formatExportValue(v))
+	}
+	parts = append(parts, r.Extra)
+	return strings.Join(parts, "\x1f")
+}
+
+// duplicateFilter drops rows whose content repeats an earlier row with the
+// same timestamp. Rows must arrive ordered by timestamp, so only the current
+// timestamp group has to be remembered.
+type duplicateFilter struct {
+	currentTS time.Time
+	seen      map[string]bool
+	Dropped   int
+}
+
+func (f *duplicateFilter) Keep(row exportRow) bool {
+	if f.seen == nil || !row.Timestamp.Equal(f.currentTS) {
+		f.currentTS = row.Timestamp
+		f.seen = make(map[string]bool)
+	}
+	key := row.duplicateKey()
+	if f.seen[key] {
+		f.Dropped++
+		return false
+	}
+	f.seen[key] = true
+	return true
+}
+
+// lineWriter receives an export line by line, each with its newline.
+// Notes (see watermark.Note) follow the rows.
+type lineWriter interface {
+	WriteLine(line []byte) error
+	WriteNote(line []byte) error
+}
+
+// plainLines writes lines unchanged.
+type plainLines struct{ w io.Writer }
+
+func (p plainLines) WriteLine(line []byte) error {
+	_, err := p.w.Write(line)
+	return err
+}
+
+func (p plainLines) WriteNote(line []byte) error { return p.WriteLine(line) }
+
+// GetVesselExport exports a stream as CSV or NDJSON. Rows are always ordered by
+// (ts, unit, id) so repeated exports of the same data are byte-identical and
+// diff-able; dedupe=true collapses rows that differ only in row_hash or
+// extra_json key order. watermark=true (or EXPORT_WATERMARK) frames the file
+// with the recipient's watermark and a hash-chained manifest. The body is
+// streamed, so errors after the first row truncate the output instead of
+// changing the status code.
+func (h *Handlers) GetVesselExport(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	stream := c.Query("stream")
+	if stream == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "stream parameter is required"})
+	}
+	def, ok := store.Streams[stream]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid stream"})
+	}
+
+	format := c.Query("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid format, use csv or ndjson"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	sources, err := parseSources(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var mark *watermark.Mark
+	if h.exportWatermark || c.QueryBool("watermark") {
+		// Watermarks are recorded, which a read-only standby cannot do
+		if h.standby != nil && h.standby.ReadOnly() {
+			return c.Status(503).JSON(fiber.Map{"error": "read-only standby; watermarked exports are served by the primary"})
+		}
+		if mark, err = h.recordWatermark(c, vesselID, stream, format, from, to); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Set("X-Export-Id", mark.ExportID)
+	}
+
+	rows, err := h.store.ExportReadings(c.UserContext(), def, vesselID, from, to, sources)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var filter *duplicateFilter
+	if c.QueryBool("dedupe") {
+		filter = &duplicateFilter{}
+	}
+
+	if format == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	} else {
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("vessel-%d-%s.%s", vesselID, stream, format)))
+
+	// Rows are written as they are scanned so exports of any size run in
+	// constant memory. The writer owns (and closes) rows.
+	streamBody(c, func(w *bufio.Writer) {
+		defer rows.Close()
+		if mark == nil {
+			if err := writeExport(plainLines{w}, rows, def, format, filter); err != nil {
+				log.Printf("export of vessel %d %s aborted: %v", vesselID, stream, err)
+			}
+			return
+		}
+		if err := h.writeWatermarkedExport(w, *mark, rows, def, format, filter); err != nil {
+			log.Printf("export %s of vessel %d %s aborted: %v", mark.ExportID, vesselID, stream, err)
+		}
+	})
+
+	return nil
+}
+
+// writeExport renders rows one line at a time, so a watermark can chain them.
+func writeExport(out lineWriter, rows store.Rows, def *store.Stream, format string, filter *duplicateFilter) error {
+	var line bytes.Buffer
+	var csvWriter *csv.Writer
+	var enc *json.Encoder
+
+	// emit passes the rendered line on
+	emit := func() error {
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		err := out.WriteLine(line.Bytes())
+		line.Reset()
+		return err
+	}
+
+	if format == "csv" {
+		csvWriter = csv.NewWriter(&line)
+		header := append([]string{"id", "ts"}, def.FieldNames()...)
+		header = append(header, "extra_json")
+		if err := csvWriter.Write(header); err != nil {
+			return err
+		}
+		if err := emit(); err != nil {
+			return err
+		}
+	} else {
+		enc = json.NewEncoder(&line)
+	}
+
+	for rows.Next() {
+		row := exportRow{Values: make([]interface{}, len(def.Fields))}
+		var extra []byte
+
+		dest := []interface{}{&row.ID, &row.Timestamp}
+		for i := range row.Values {
+			dest = append(dest, &row.Values[i])
+		}
+		dest = append(dest, &extra)
+
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		row.Extra = canonicalJSON(extra)
+
+		if filter != nil && !filter.Keep(row) {
+			continue
+		}
+
+		if csvWriter != nil {
+			record := []string{strconv.FormatInt(row.ID, 10), formatExportValue(row.Timestamp)}
+			for _, v := range row.Values {
+				record = append(record, formatExportValue(v))
+			}
+			record = append(record, row.Extra)
+			if err := csvWriter.Write(record); err != nil {
+				return err
+			}
+			if err := emit(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		item := make(map[string]interface{}, len(def.Fields)+3)
+		item["id"] = row.ID
+		item["ts"] = row.Timestamp.UTC()
+		for i, field := range def.Fields {
+			if b, ok := row.Values[i].([]byte); ok {
+				item[field.Name] = string(b)
+			} else {
+				item[field.Name] = row.Values[i]
+			}
+		}
+		item["extra_json"] = json.RawMessage(row.Extra)
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		if err := emit(); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The number of rows collapsed is only known once they are written, so
+	// it follows them
+	if filter != nil {
+		note, err := watermark.Note(format, "duplicates_collapsed", filter.Dropped)
+		if err != nil {
+			return err
+		}
+		return out.WriteNote(note)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/watermark"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	a := canonicalJSON([]byte(`{"b":"2","a":"1"}`))
+	b := canonicalJSON([]byte(`{"a":"1","b":"2"}`))
+	if a != b {
+		t.Errorf("Expected key order to be ignored, got %s and %s", a, b)
+	}
+
+	if got := canonicalJSON(nil); got != "{}" {
+		t.Errorf("Expected {} for empty payload, got %s", got)
+	}
+}
+
+func TestDuplicateFilter(t *testing.T) {
+	ts := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+	rows := []exportRow{
+		{ID: 1, Timestamp: ts, Values: []interface{}{int64(1), 1500.0}, Extra: `{"a":"1"}`},
+		{ID: 2, Timestamp: ts, Values: []interface{}{int64(1), 1500.0}, Extra: `{"a":"1"}`},
+		{ID: 3, Timestamp: ts, Values: []interface{}{int64(2), 1500.0}, Extra: `{"a":"1"}`},
+		{ID: 4, Timestamp: ts.Add(time.Hour), Values: []interface{}{int64(1), 1500.0}, Extra: `{"a":"1"}`},
+	}
+
+	filter := &duplicateFilter{}
+	var out []exportRow
+	for _, row := range rows {
+		if filter.Keep(row) {
+			out = append(out, row)
+		}
+	}
+	if filter.Dropped != 1 || len(out) != 3 {
+		t.Fatalf("Expected 1 duplicate dropped and 3 rows kept, got %d dropped, %d kept", filter.Dropped, len(out))
+	}
+
+	// The first occurrence is kept
+	if out[0].ID != 1 || out[1].ID != 3 || out[2].ID != 4 {
+		t.Errorf("Unexpected rows kept: %d, %d, %d", out[0].ID, out[1].ID, out[2].ID)
+	}
+}
+
+func TestTraceProblems(t *testing.T) {
+	rows, hash := int64(2), "abc"
+	manifest := &watermark.Manifest{ExportID: "x", Rows: rows, ChainHash: hash}
+	intact := &watermark.Verification{Manifest: manifest, Rows: rows, ChainHash: hash, Intact: true}
+	issued := &watermark.Record{Rows: &rows, ChainHash: &hash}
+
+	if problems := traceProblems(intact, issued); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+
+	other := "def"
+	for name, tt := range map[string]struct {
+		v      *watermark.Verification
+		record *watermark.Record
+	}{
+		"cut short":       {&watermark.Verification{Rows: 1, ChainHash: hash}, issued},
+		"edited":          {&watermark.Verification{Manifest: manifest, Rows: rows, ChainHash: other}, issued},
+		"unknown export":  {intact, nil},
+		"never completed": {intact, &watermark.Record{}},
+		"re-manifested":   {intact, &watermark.Record{Rows: &rows, ChainHash: &other}},
+	} {
+		if problems := traceProblems(tt.v, tt.record); len(problems) == 0 {
+			t.Errorf("%s: expected a problem", name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/gensets"
+)
+
+// defaultGeneratorMaxGap caps the time one generator reading stands for.
+const defaultGeneratorMaxGap = time.Hour
+
+// GetVesselGeneratorReport reports per-generator running hours, load and
+// specific fuel consumption, and the load imbalance between generators
+// running in parallel, over from..to.
+func (h *Handlers) GetVesselGeneratorReport(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	opts := gensets.Options{MinLoadKW: c.QueryFloat("min_load_kw", 0), MaxGap: defaultGeneratorMaxGap}
+	if opts.MinLoadKW < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "min_load_kw must not be negative"})
+	}
+	if s := c.Query("max_gap"); s != "" {
+		if opts.MaxGap, err = time.ParseDuration(s); err != nil || opts.MaxGap <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid max_gap, use e.g. 1h"})
+		}
+	}
+
+	readings, err := h.store.GeneratorReadings(c.UserContext(), vesselID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	report := gensets.Build(readings, opts)
+
+	return c.JSON(fiber.Map{
+		"vessel_id":       vesselID,
+		"from":            from,
+		"to":              to,
+		"min_load_kw":     opts.MinLoadKW,
+		"max_gap_seconds": int64(opts.MaxGap / time.Second),
+		"readings":        len(readings),
+		"generators":      report.Generators,
+		"parallel":        report.Parallel,
+		"energy_kwh":      report.EnergyKWh,
+		"fuel_liters":     report.FuelLiters,
+		"sfc_l_per_kwh":   report.SFCLPerKWh,
+		// ± from the fuel rates' uncertainty estimates, null if none has one
+		"fuel_liters_uncertainty": report.FuelLitersUncertainty,
+		"sfc_uncertainty":         report.SFCUncertainty,
+	})
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ha"
+)
+
+// RejectWritesOnStandby answers 503 to anything but reads while the instance
+// is an unpromoted standby, since the next sync would overwrite the write.
+func (h *Handlers) RejectWritesOnStandby(c *fiber.Ctx) error {
+	if h.standby == nil || !h.standby.ReadOnly() {
+		return c.Next()
+	}
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return c.Next()
+	}
+	// Verifying an export file only reads
+	if c.Path() == "/ha/promote" || c.Path() == "/exports/verify" {
+		return c.Next()
+	}
+	return c.Status(503).JSON(fiber.Map{"error": "read-only standby; write to the primary or promote this instance"})
+}
+
+// GetHAStatus reports the instance's replication role and, on a standby,
+// how fresh its copy of the primary is.
+func (h *Handlers) GetHAStatus(c *fiber.Ctx) error {
+	if h.standby != nil {
+		return c.JSON(h.standby.Status())
+	}
+	role := h.haRole
+	if role == "" {
+		role = ha.RoleStandalone
+	}
+	return c.JSON(ha.Status{Role: role})
+}
+
+// validHAToken reports whether the request carries the shared replication
+// token. Without HA_TOKEN no request does.
+func (h *Handlers) validHAToken(c *fiber.Ctx) bool {
+	return h.haToken != "" && subtle.ConstantTimeCompare([]byte(c.Get(ha.TokenHeader)), []byte(h.haToken)) == 1
+}
+
+// GetHASnapshot sends a consistent copy of the database to a standby. Only
+// the primary serves it, and only with the shared token, so HA_TOKEN must be
+// set for it to serve at all.
+func (h *Handlers) GetHASnapshot(c *fiber.Ctx) error {
+	if h.haRole != ha.RolePrimary {
+		return c.Status(404).JSON(fiber.Map{"error": "not a primary"})
+	}
+	if h.haToken == "" {
+		return c.Status(403).JSON(fiber.Map{"error": "snapshots are not served without HA_TOKEN"})
+	}
+	if !h.validHAToken(c) {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid replication token"})
+	}
+
+	dir, err := os.MkdirTemp("", "telemetry-snapshot")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	path := filepath.Join(dir, "snapshot.db")
+	if err := h.store.Snapshot(c.UserContext(), path); err != nil {
+		os.RemoveAll(dir)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Sent chunked, so a standby notices a cut-off transfer
+	c.Set(fiber.HeaderContentType, "application/vnd.sqlite3")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer os.RemoveAll(dir)
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("ha: opening snapshot: %v", err)
+			return
+		}
+		defer f.Close()
+		if _, err := io.Copy(w, f); err != nil {
+			log.Printf("ha: sending snapshot: %v", err)
+		}
+	})
+	return nil
+}
+
+// PostHAPromote makes a standby writable. Promote the standby only once the
+// old primary is down or fenced off, or both will accept writes. Promotion
+// cannot be undone, so it takes the replication token or an admin API key.
+func (h *Handlers) PostHAPromote(c *fiber.Ctx) error {
+	if !h.validHAToken(c) && !h.isAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "replication token or admin API key required"})
+	}
+	if h.standby == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "not a standby"})
+	}
+	if !h.standby.Promote() {
+		return c.Status(409).JSON(fiber.Map{"error": "already promoted"})
+	}
+	return c.JSON(h.standby.Status())
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// halMIME is the media type of hypermedia responses. Clients opt in with
+// Accept: application/hal+json; everyone else gets plain JSON.
+const halMIME = "application/hal+json"
+
+// wantsHAL reports whether the request prefers HAL over plain JSON.
+func wantsHAL(c *fiber.Ctx) bool {
+	return c.Accepts(fiber.MIMEApplicationJSON, halMIME) == halMIME
+}
+
+type halLink struct {
+	Href      string `json:"href"`
+	Templated bool   `json:"templated,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// halLinks are the _links of a resource by relation.
+type halLinks map[string]halLink
+
+// sendHAL sends body, a JSON object, with links added as _links.
+func sendHAL(c *fiber.Ctx, body interface{}, links halLinks) error {
+	resource, err := withLinks(body, links)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(resource, halMIME)
+}
+
+// withLinks returns the JSON object v with links added as _links.
+func withLinks(v interface{}, links halLinks) (map[string]interface{}, error) {
+	resource, ok := v.(map[string]interface{})
+	if m, isMap := v.(fiber.Map); isMap {
+		resource, ok = m, true
+	}
+	if !ok {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &resource); err != nil {
+			return nil, err
+		}
+	}
+	resource["_links"] = links
+	return resource, nil
+}
+
+// selfLinks links self, the request's URL, and with a next cursor the same
+// request for the next page.
+func selfLinks(self, next string) halLinks {
+	links := halLinks{"self": {Href: self}}
+	if next != "" {
+		u, err := url.Parse(self)
+		if err == nil {
+			q := u.Query()
+			q.Set("cursor", next)
+			u.RawQuery = q.Encode()
+			links["next"] = halLink{Href: u.String()}
+		}
+	}
+	return links
+}
+
+// vesselLinks are the links from a vessel to what can be read about it.
+func vesselLinks(id int64) halLinks {
+	base := fmt.Sprintf("/vessels/%d", id)
+	return halLinks{
+		"self":          {Href: base},
+		"telemetry":     {Href: base + "/telemetry{?stream,from,to,order,sort,limit,cursor}", Templated: true},
+		"latest":        {Href: base + "/latest{?stream}", Templated: true},
+		"stats":         {Href: base + "/stats"},
+		"alarms":        {Href: base + "/alarms"},
+		"sensors":       {Href: base + "/sensors"},
+		"equipment_log": {Href: base + "/equipment-log{?kind,equipment,unit,status,from,to}", Templated: true},
+		"streams":       {Href: "/streams", Title: "Stream definitions"},
+	}
+}
+
+// streamLink links a built-in stream's definition.
+func streamLink(name string) halLink {
+	return halLink{Href: "/streams/" + name}
+}
+
+// customStreamLink links a custom stream's definition.
+func customStreamLink(name string) halLink {
+	return halLink{Href: "/streams/custom/" + name}
+}
+
+// ingestLinks links an ingest result to its vessel and, if it was recorded,
+// its upload.
+func (h *Handlers) ingestLinks(c *fiber.Ctx, response *models.IngestResponse) halLinks {
+	links := halLinks{}
+	if response.VesselID != nil {
+		links["vessel"] = vesselLinks(*response.VesselID)["self"]
+	}
+	if response.UploadID != nil {
+		if _, err := h.store.GetUpload(c.UserContext(), *response.UploadID); err == nil {
+			links["upload"] = halLink{Href: fmt.Sprintf("/uploads/%d", *response.UploadID)}
+		}
+	}
+	return links
+}
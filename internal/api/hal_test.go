@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+func TestWithLinks(t *testing.T) {
+	links := halLinks{"self": {Href: "/uploads/1"}}
+	for _, v := range []interface{}{
+		models.Upload{ID: 1, VesselID: 2},
+		fiber.Map{"id": 1},
+		map[string]interface{}{"id": 1},
+	} {
+		resource, err := withLinks(v, links)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resource["id"] == nil || resource["_links"].(halLinks)["self"].Href != "/uploads/1" {
+			t.Errorf("%T: expected the fields with _links, got %v", v, resource)
+		}
+	}
+	if _, err := withLinks([]int{1}, links); err == nil {
+		t.Error("Expected an error for a non-object")
+	}
+}
@@ -1,35 +1,159 @@
 package api
 
 import (
-	"database/sql"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log"
+	"net"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-
+	"github.com/gofiber/fiber/v2/utils"
+
+	"vessel-telemetry-api/internal/cache"
+	"vessel-telemetry-api/internal/chunked"
+	"vessel-telemetry-api/internal/config"
+	"vessel-telemetry-api/internal/cron"
+	"vessel-telemetry-api/internal/fair"
+	"vessel-telemetry-api/internal/fueldrop"
+	"vessel-telemetry-api/internal/ha"
 	"vessel-telemetry-api/internal/ingest"
 	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/objectstore"
+	"vessel-telemetry-api/internal/outbox"
+	"vessel-telemetry-api/internal/replication"
+	"vessel-telemetry-api/internal/report"
+	"vessel-telemetry-api/internal/s3ingest"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/urlfetch"
+	"vessel-telemetry-api/internal/util"
 )
 
 type Handlers struct {
-	db                         *sql.DB
+	store                      store.Store
 	processor                  *ingest.XLSXProcessor
+	fetcher                    *urlfetch.Fetcher
+	bucket                     *s3ingest.Watcher // nil unless a bucket is watched
+	uploads                    *chunked.Manager  // nil in tests
+	objects                    objectstore.Store
 	allowUnsafeDuplicateIngest bool
+	pageLimits                 config.PageLimits
+	apiKeyClasses              map[string]string
+	classPageLimits            map[string]config.PageLimits
+	apiKeyOrgs                 map[string]string
+	adminAPIKeys               []string
+	kioskAPIKeys               map[string]int64
+	kioskNetworks              []*net.IPNet
+	exportWatermark            bool
+	signedURLSecrets           []string
+	signedURLMaxTTL            time.Duration
+	auditChain                 bool
+	ingestScheduler            *fair.Scheduler // set by SetupRoutes, shared with the workers
+	queryScheduler             *fair.Scheduler
+	haRole                     string
+	haToken                    string
+	replicationRole            string
+	replicationToken           string
+	replicationOrigin          string
+	replicationBudget          replication.Budget
+	standby                    *ha.Standby // nil unless running as a standby
+	jobs                       *cron.Scheduler
+	dispatcher                 *outbox.Dispatcher
+	cache                      cache.Cache    // nil in tests
+	reports                    *report.Sender // nil unless email is configured
+	cacheTTL                   time.Duration
+}
+
+// NewProcessor creates the ingest processor of a deployment, for uploads
+// and for the workers that collect files themselves.
+func NewProcessor(st store.Store, cfg config.Config) *ingest.XLSXProcessor {
+	processor := ingest.NewXLSXProcessor(st, cfg.AllowUnsafeDuplicateIngest)
+	processor.SetDefaultQuota(models.QuotaPolicy{
+		DailyRowLimit: cfg.VesselDailyRowQuota,
+		Throttle:      cfg.QuotaThrottle,
+	})
+	if cfg.FuelDrop != (fueldrop.Options{}) {
+		processor.SetFuelDropOptions(cfg.FuelDrop)
+	}
+	return processor
 }
 
-func NewHandlers(db *sql.DB, allowUnsafeDuplicateIngest bool) *Handlers {
+func NewHandlers(st store.Store, cfg config.Config) *Handlers {
+	processor := NewProcessor(st, cfg)
+
+	pageLimits := cfg.PageLimits
+	if pageLimits == (config.PageLimits{}) {
+		pageLimits = config.DefaultPageLimits
+	}
+
+	urlMaxBytes := cfg.IngestURLMaxBytes
+	if urlMaxBytes <= 0 {
+		urlMaxBytes = config.DefaultIngestURLMaxBytes
+	}
+
+	objectDir := cfg.ObjectStoreDir
+	if objectDir == "" {
+		objectDir = filepath.Join(filepath.Dir(cfg.DBPath), "objects")
+	}
+
+	// Vessel edits are stamped with the instance that made them
+	origin := cfg.ReplicationEdgeID
+	if cfg.ReplicationRole == replication.RoleCentral {
+		origin = replication.RoleCentral
+	}
+
 	return &Handlers{
-		db:                         db,
-		processor:                  ingest.NewXLSXProcessor(db, allowUnsafeDuplicateIngest),
-		allowUnsafeDuplicateIngest: allowUnsafeDuplicateIngest,
+		store:                      st,
+		processor:                  processor,
+		fetcher:                    urlfetch.NewFetcher(urlMaxBytes, cfg.IngestURLAllowPrivate, cfg.Outbound),
+		objects:                    objectstore.NewDir(objectDir),
+		allowUnsafeDuplicateIngest: cfg.AllowUnsafeDuplicateIngest,
+		pageLimits:                 pageLimits,
+		apiKeyClasses:              cfg.APIKeyClasses,
+		classPageLimits:            cfg.ClassPageLimits,
+		apiKeyOrgs:                 cfg.APIKeyOrgs,
+		adminAPIKeys:               cfg.AdminAPIKeys,
+		kioskAPIKeys:               cfg.KioskAPIKeys,
+		kioskNetworks:              cfg.KioskNetworks,
+		exportWatermark:            cfg.ExportWatermark,
+		signedURLSecrets:           cfg.SignedURLSecrets,
+		signedURLMaxTTL:            cfg.SignedURLMaxTTL,
+		auditChain:                 cfg.AuditChain,
+		queryScheduler:             fair.New("query", cfg.QueryLimits),
+		haRole:                     cfg.HARole,
+		haToken:                    cfg.HAToken,
+		replicationRole:            cfg.ReplicationRole,
+		replicationToken:           cfg.ReplicationToken,
+		replicationOrigin:          origin,
+		replicationBudget:          replication.Budget{Bytes: cfg.ReplicationBudgetBytes, Window: cfg.ReplicationBudgetWindow},
+		cacheTTL:                   cfg.CacheTTL,
 	}
 }
 
+// keyClass returns the class of the request's API key (X-API-Key header),
+// empty for requests without a configured key.
+func (h *Handlers) keyClass(c *fiber.Ctx) string {
+	return h.apiKeyClasses[c.Get("X-API-Key")]
+}
+
+// limitsFor returns the page size limits for the request's API key class.
+func (h *Handlers) limitsFor(c *fiber.Ctx) config.PageLimits {
+	if limits, ok := h.classPageLimits[h.keyClass(c)]; ok {
+		return limits
+	}
+	return h.pageLimits
+}
+
 // GetHealthz provides a health check endpoint for Docker deployments
 func (h *Handlers) GetHealthz(c *fiber.Ctx) error {
 	// Check database connectivity
-	if err := h.db.Ping(); err != nil {
+	if err := h.store.Ping(c.UserContext()); err != nil {
 		return c.Status(503).JSON(fiber.Map{
 			"status":  "unhealthy",
 			"error":   "database connection failed",
@@ -38,8 +162,7 @@ func (h *Handlers) GetHealthz(c *fiber.Ctx) error {
 	}
 
 	// Check if we can query the database
-	var count int
-	err := h.db.QueryRow("SELECT COUNT(*) FROM vessels").Scan(&count)
+	count, err := h.store.CountVessels(c.UserContext())
 	if err != nil {
 		return c.Status(503).JSON(fiber.Map{
 			"status":  "unhealthy",
@@ -56,25 +179,83 @@ func (h *Handlers) GetHealthz(c *fiber.Ctx) error {
 	})
 }
 
-func (h *Handlers) PostIngestXLSX(c *fiber.Ctx) error {
+// parseIngestParams reads the query parameters shared by the ingest
+// endpoints.
+func parseIngestParams(c *fiber.Ctx) (ingest.IngestOptions, error) {
+	// At least one identifier is required
+	if c.Query("imo") == "" && c.Query("vessel_name") == "" {
+		return ingest.IngestOptions{}, errors.New("either 'imo' or 'vessel_name' parameter is required")
+	}
+	return parseIngestOptions(c)
+}
+
+// parseIngestOptions reads the ingest parameters without requiring a
+// vessel identifier, for files that carry their own.
+func parseIngestOptions(c *fiber.Ctx) (ingest.IngestOptions, error) {
+	var params ingest.IngestOptions
+
 	// Primary: Use IMO if provided
-	imo := c.Query("imo")
+	params.IMO = c.Query("imo")
 
 	// Fallback: Use vessel_name (for backwards compatibility or when IMO is unknown)
-	vesselName := c.Query("vessel_name")
+	params.VesselName = c.Query("vessel_name")
 
-	// At least one identifier is required
-	if imo == "" && vesselName == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "either 'imo' or 'vessel_name' parameter is required"})
+	if periodStartStr := c.Query("period_start"); periodStartStr != "" {
+		ts, err := time.Parse(time.RFC3339, periodStartStr)
+		if err != nil {
+			return params, errors.New("invalid period_start format, use ISO 8601")
+		}
+		params.PeriodStart = &ts
 	}
 
-	var periodStart *time.Time
-	if periodStartStr := c.Query("period_start"); periodStartStr != "" {
-		if ts, err := time.Parse(time.RFC3339, periodStartStr); err == nil {
-			periodStart = &ts
-		} else {
-			return c.Status(400).JSON(fiber.Map{"error": "invalid period_start format, use ISO 8601"})
+	// mode=upsert replaces readings matched by (vessel, ts, unit no) instead of ignoring them
+	mode, err := ingest.ParseIngestMode(c.Query("mode"))
+	if err != nil {
+		return params, err
+	}
+	params.Mode = mode
+
+	// source tags every reading of the upload, e.g. manual for hand-keyed noon reports
+	params.Source = strings.ToLower(c.Query("source", models.SourceSensor))
+	if !validSource(params.Source) {
+		return params, fmt.Errorf("invalid source %q, use %s", params.Source, strings.Join(models.ReadingSources, ", "))
+	}
+
+	// uncertainty_percent is the ± of fuel levels, volumes and fuel rates
+	// estimated rather than metered, e.g. 3 for soundings
+	if v := c.Query("uncertainty_percent"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || len(ingest.ValidateUncertainty(&parsed)) > 0 {
+			return params, errors.New("invalid uncertainty_percent, use a percentage between 0 and 100")
 		}
+		params.Uncertainty = &parsed
+	}
+
+	params.Sheets, err = parseSheetOverrides(c)
+	return params, err
+}
+
+// parseSheetOverrides reads the sheet=<sheet name>=<stream> parameters,
+// repeated, that read sheets whose names lack the keywords of their stream.
+func parseSheetOverrides(c *fiber.Ctx) (ingest.SheetOverrides, error) {
+	var overrides ingest.SheetOverrides
+	for _, v := range c.Context().QueryArgs().PeekMulti("sheet") {
+		sheet, stream, err := ingest.ParseSheetOverride(string(v))
+		if err != nil {
+			return nil, err
+		}
+		if overrides == nil {
+			overrides = make(ingest.SheetOverrides)
+		}
+		overrides[sheet] = stream
+	}
+	return overrides, nil
+}
+
+func (h *Handlers) PostIngestXLSX(c *fiber.Ctx) error {
+	params, err := parseIngestParams(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	// Get uploaded file
@@ -94,9 +275,64 @@ func (h *Handlers) PostIngestXLSX(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to read file"})
 	}
+	c.Locals(auditDetailKey, map[string]interface{}{"filename": file.Filename, "file_sha256": util.SHA256Hex(fileData)})
 
 	// Process file - pass both IMO and vessel name, processor will prioritize IMO
-	response, err := h.processor.ProcessFile(fileData, file.Filename, imo, vesselName, periodStart)
+	response, err := h.processor.ProcessFile(c.UserContext(), fileData, file.Filename, params)
+	return h.sendIngestResponse(c, response, err)
+}
+
+// PostIngestInspect reports how an uploaded file would be read, sheet by
+// sheet, without ingesting it; with vessel_id, using that vessel's header
+// aliases as well as the global ones, and with the sheet overrides of the
+// ingest endpoints.
+func (h *Handlers) PostIngestInspect(c *fiber.Ctx) error {
+	var vesselID int64
+	if s := c.Query("vessel_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid vessel_id"})
+		}
+		vesselID = id
+	}
+	overrides, err := parseSheetOverrides(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "file is required"})
+	}
+	fileReader, err := file.Open()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to open file"})
+	}
+	defer fileReader.Close()
+
+	fileData, err := io.ReadAll(fileReader)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to read file"})
+	}
+
+	response, err := h.processor.Inspect(c.UserContext(), fileData, file.Filename, vesselID, overrides)
+	if errors.Is(err, ingest.ErrUnsupportedFormat) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(response)
+}
+
+// sendIngestResponse answers an ingest of one file with its result or
+// error.
+func (h *Handlers) sendIngestResponse(c *fiber.Ctx, response *models.IngestResponse, err error) error {
+	if errors.Is(err, ingest.ErrQuotaExceeded) {
+		return c.Status(429).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, ingest.ErrUnsupportedFormat) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -107,149 +343,116 @@ func (h *Handlers) PostIngestXLSX(c *fiber.Ctx) error {
 		}
 	}
 
+	if wantsHAL(c) {
+		return sendHAL(c, response, h.ingestLinks(c, response))
+	}
 	return c.JSON(response)
 }
 
 func (h *Handlers) GetVessels(c *fiber.Ctx) error {
-	query := `
-		SELECT v.id, v.imo, v.name, v.flag, v.type, v.created_at, v.updated_at
-		FROM vessels v
-		ORDER BY v.name
-	`
+	filter, err := parseVesselFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	rows, err := h.db.Query(query)
+	list, err := h.store.ListVessels(c.UserContext(), filter)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	defer rows.Close()
 
 	var vessels []map[string]interface{}
 
-	for rows.Next() {
-		var vessel models.Vessel
-		var imo, flag, vesselType sql.NullString
-
-		err := rows.Scan(
-			&vessel.ID, &imo, &vessel.Name, &flag, &vesselType,
-			&vessel.CreatedAt, &vessel.UpdatedAt,
-		)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	for _, vessel := range list {
+		// Latest timestamps per stream, which the store keeps in memory
+		latest, err := h.store.StreamLatest(c.UserContext(), vessel.ID)
+		if err == nil {
+			vessels = append(vessels, vesselResponse(vessel, latest))
 		}
+	}
 
-		if imo.Valid {
-			vessel.IMO = &imo.String
-		}
-		if flag.Valid {
-			vessel.Flag = &flag.String
+	if wantsHAL(c) {
+		for _, v := range vessels {
+			v["_links"] = vesselLinks(v["id"].(int64))
 		}
-		if vesselType.Valid {
-			vessel.Type = &vesselType.String
-		}
-
-		// Get latest timestamps per stream
-		latestQuery := `
-			SELECT stream, latest_ts 
-			FROM vessel_stream_latest 
-			WHERE vessel_id = ?
-		`
-		latestRows, err := h.db.Query(latestQuery, vessel.ID)
-		if err == nil {
-			latest := make(map[string]time.Time)
-			for latestRows.Next() {
-				var stream string
-				var ts time.Time
-				if err := latestRows.Scan(&stream, &ts); err == nil {
-					latest[stream] = ts
-				}
-			}
-			latestRows.Close()
-
-			vesselMap := map[string]interface{}{
-				"id":         vessel.ID,
-				"imo":        vessel.IMO,
-				"name":       vessel.Name,
-				"flag":       vessel.Flag,
-				"type":       vessel.Type,
-				"created_at": vessel.CreatedAt,
-				"updated_at": vessel.UpdatedAt,
-				"latest":     latest,
-			}
-			vessels = append(vessels, vesselMap)
+		if vessels == nil {
+			vessels = []map[string]interface{}{}
 		}
+		return sendHAL(c, fiber.Map{"_embedded": fiber.Map{"vessels": vessels}, "count": len(vessels)}, selfLinks(c.OriginalURL(), ""))
 	}
-
 	return c.JSON(vessels)
 }
 
+func vesselResponse(vessel models.Vessel, latest map[string]time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          vessel.ID,
+		"imo":         vessel.IMO,
+		"mmsi":        vessel.MMSI,
+		"name":        vessel.Name,
+		"flag":        vessel.Flag,
+		"type":        vessel.Type,
+		"fleet":       vessel.Fleet,
+		"archived_at": vessel.ArchivedAt,
+		"created_at":  vessel.CreatedAt,
+		"updated_at":  vessel.UpdatedAt,
+		"latest":      latest,
+	}
+}
+
 func (h *Handlers) GetVessel(c *fiber.Ctx) error {
 	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
 	}
 
-	query := `
-		SELECT id, imo, name, flag, type, created_at, updated_at
-		FROM vessels 
-		WHERE id = ?
-	`
-
-	var vessel models.Vessel
-	var imo, flag, vesselType sql.NullString
-
-	err = h.db.QueryRow(query, id).Scan(
-		&vessel.ID, &imo, &vessel.Name, &flag, &vesselType,
-		&vessel.CreatedAt, &vessel.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
+	vessel, err := h.store.GetVessel(c.UserContext(), id)
+	if errors.Is(err, store.ErrNotFound) {
 		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
 	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	if vessel.ArchivedAt != nil && !c.QueryBool("include_archived") {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
 
-	if imo.Valid {
-		vessel.IMO = &imo.String
+	// Polling clients get 304 while neither the vessel nor its streams changed
+	versions, err := h.store.StreamVersions(c.UserContext(), id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	record, err := json.Marshal(vessel)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defects, err := h.store.EquipmentLog(c.UserContext(), store.EquipmentLogFilter{VesselID: id, Kind: models.LogDefect, Status: models.DefectOpen})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	if flag.Valid {
-		vessel.Flag = &flag.String
+	done, err := h.store.EquipmentLog(c.UserContext(), store.EquipmentLogFilter{VesselID: id, Kind: models.LogMaintenance, NewestFirst: true, Limit: recentMaintenance})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	if vesselType.Valid {
-		vessel.Type = &vesselType.String
+	logRecord, err := json.Marshal([]interface{}{defects, done})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Vary(fiber.HeaderAccept)
+	if notModified(c, versionTag(versions, string(record), string(logRecord), strconv.FormatBool(wantsHAL(c))), lastModified(vessel.UpdatedAt, versions)) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 
 	// Get latest timestamps per stream
-	latestQuery := `
-		SELECT stream, latest_ts 
-		FROM vessel_stream_latest 
-		WHERE vessel_id = ?
-	`
-	latestRows, err := h.db.Query(latestQuery, id)
+	latest, err := h.store.StreamLatest(c.UserContext(), id)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	defer latestRows.Close()
 
-	latest := make(map[string]time.Time)
-	for latestRows.Next() {
-		var stream string
-		var ts time.Time
-		if err := latestRows.Scan(&stream, &ts); err == nil {
-			latest[stream] = ts
-		}
+	response := vesselResponse(*vessel, latest)
+	response["open_defects"] = defects
+	response["recent_maintenance"] = done
+	if wantsHAL(c) {
+		return sendHAL(c, response, vesselLinks(id))
 	}
-
-	response := map[string]interface{}{
-		"id":         vessel.ID,
-		"imo":        vessel.IMO,
-		"name":       vessel.Name,
-		"flag":       vessel.Flag,
-		"type":       vessel.Type,
-		"created_at": vessel.CreatedAt,
-		"updated_at": vessel.UpdatedAt,
-		"latest":     latest,
-	}
-
 	return c.JSON(response)
 }
 
@@ -264,354 +467,265 @@ func (h *Handlers) GetVesselTelemetry(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "stream parameter is required"})
 	}
 
-	limit := 200
+	// Historical telemetry of archived vessels stays queryable with include_archived=true
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	limits := h.limitsFor(c)
+	limit := limits.Default
 	if limitStr := c.Query("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 1000 {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= limits.Max {
 			limit = l
 		}
 	}
 
-	cursor := c.Query("cursor")
-	cursorTS, cursorID, err := DecodeCursor(cursor)
+	def, ok := store.Streams[stream]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid stream"})
+	}
+	asCSV, err := wantsTelemetryCSV(c)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid cursor"})
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	fields, err := parseFields(def, c.Query("fields"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	var query string
-	var args []interface{}
-
-	switch stream {
-	case "engines":
-		query = `
-			SELECT id, vessel_id, engine_no, ts, rpm, temp_c, oil_pressure_bar, alarms, row_hash, extra_json, created_at
-			FROM engine_readings 
-			WHERE vessel_id = ?
-		`
-		args = append(args, vesselID)
-
-		if engineNoStr := c.Query("engine_no"); engineNoStr != "" {
-			if engineNo, err := strconv.Atoi(engineNoStr); err == nil {
-				query += " AND engine_no = ?"
-				args = append(args, engineNo)
-			}
-		}
-
-	case "fuel":
-		query = `
-			SELECT id, vessel_id, tank_no, ts, level_percent, volume_liters, temp_c, row_hash, extra_json, created_at
-			FROM fuel_tank_readings 
-			WHERE vessel_id = ?
-		`
-		args = append(args, vesselID)
-
-		if tankNoStr := c.Query("tank_no"); tankNoStr != "" {
-			if tankNo, err := strconv.Atoi(tankNoStr); err == nil {
-				query += " AND tank_no = ?"
-				args = append(args, tankNo)
-			}
-		}
-
-	case "generators":
-		query = `
-			SELECT id, vessel_id, gen_no, ts, load_kw, voltage_v, frequency_hz, fuel_rate_lph, row_hash, extra_json, created_at
-			FROM generator_readings 
-			WHERE vessel_id = ?
-		`
-		args = append(args, vesselID)
-
-		if genNoStr := c.Query("gen_no"); genNoStr != "" {
-			if genNo, err := strconv.Atoi(genNoStr); err == nil {
-				query += " AND gen_no = ?"
-				args = append(args, genNo)
-			}
-		}
-
-	case "cctv":
-		query = `
-			SELECT id, vessel_id, cam_id, ts, status, uptime_percent, row_hash, extra_json, created_at
-			FROM cctv_status_readings 
-			WHERE vessel_id = ?
-		`
-		args = append(args, vesselID)
-
-		if camID := c.Query("cam_id"); camID != "" {
-			query += " AND cam_id = ?"
-			args = append(args, camID)
-		}
-
-	case "impact":
-		query = `
-			SELECT id, vessel_id, sensor_id, ts, accel_g, shock_g, notes, row_hash, extra_json, created_at
-			FROM impact_vibration_readings 
-			WHERE vessel_id = ?
-		`
-		args = append(args, vesselID)
-
-		if sensorID := c.Query("sensor_id"); sensorID != "" {
-			query += " AND sensor_id = ?"
-			args = append(args, sensorID)
-		}
-
-	case "location":
-		query = `
-			SELECT id, vessel_id, ts, latitude, longitude, course_degrees, speed_knots, status, row_hash, extra_json, created_at
-			FROM location_readings 
-			WHERE vessel_id = ?
-		`
-		args = append(args, vesselID)
-
+	// Pages run oldest first unless order=desc; sort=<unit column> orders
+	// readings sharing a timestamp by unit
+	var page Cursor
+	switch c.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		page.Desc = true
 	default:
-		return c.Status(400).JSON(fiber.Map{"error": "invalid stream"})
+		return c.Status(400).JSON(fiber.Map{"error": "invalid order, use asc or desc"})
+	}
+	switch sort := c.Query("sort", "ts"); {
+	case sort == "ts":
+	case sort == def.Unit && def.Unit != "":
+		page.Sort = sort
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid sort for stream %s", stream)})
+	}
+
+	cursor, err := ParseCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid cursor"})
+	}
+	if c.Query("cursor") != "" && (cursor.Desc != page.Desc || cursor.Sort != page.Sort) {
+		return c.Status(400).JSON(fiber.Map{"error": "cursor does not match order and sort"})
+	}
+
+	q := store.ReadingQuery{
+		Stream:   def,
+		VesselID: vesselID,
+		Desc:     page.Desc,
+		ByUnit:   page.Sort != "",
+		AfterTS:  cursor.TS,
+		AfterID:  cursor.ID,
+		Limit:    limit + 1, // Get one extra to check if there's a next page
+	}
+	if q.NotNull, err = parseNotNull(def, c.Query("not_null"), c.QueryBool("alarms_only")); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if q.Sources, err = parseSources(c); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if q.Extra, err = parseExtraFilters(c); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if q.ByUnit && c.Query("cursor") != "" {
+		if q.AfterUnit, err = def.ParseUnitSortKey(cursor.Key); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+	}
+	q.Unit, _ = def.ParseUnit(c.Query(def.Unit))
+	if sensor := c.Query("sensor"); sensor != "" {
+		if def.Unit == "" {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("stream %s has no sensors", stream)})
+		}
+		if q.SensorRef, err = strconv.ParseInt(sensor, 10, 64); err != nil || q.SensorRef <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid sensor"})
+		}
 	}
 
 	// Add time range filters
 	if from := c.Query("from"); from != "" {
 		if fromTime, err := time.Parse(time.RFC3339, from); err == nil {
-			query += " AND ts >= ?"
-			args = append(args, fromTime)
+			q.From = &fromTime
 		}
 	}
 
 	if to := c.Query("to"); to != "" {
 		if toTime, err := time.Parse(time.RFC3339, to); err == nil {
-			query += " AND ts <= ?"
-			args = append(args, toTime)
+			q.To = &toTime
 		}
 	}
 
-	// Add cursor pagination
-	if !cursorTS.IsZero() {
-		query += " AND (ts > ? OR (ts = ? AND id > ?))"
-		args = append(args, cursorTS, cursorTS, cursorID)
+	rows, err := h.store.QueryReadings(c.UserContext(), q)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Vary(fiber.HeaderAccept)
+	if asCSV {
+		return sendTelemetryCSV(c, rows, def, fields, limit, page)
+	}
+
+	// Rows are encoded straight to the response as they are scanned, so the
+	// page is never held in memory. The writer owns (and closes) rows.
+	var links func(next string) halLinks
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if wantsHAL(c) {
+		// The page is written after the handler returns, when c is gone
+		self := utils.CopyString(c.OriginalURL())
+		links = func(next string) halLinks {
+			l := selfLinks(self, next)
+			l["vessel"] = vesselLinks(vesselID)["self"]
+			l["stream"] = streamLink(def.Name)
+			return l
+		}
+		c.Set(fiber.HeaderContentType, halMIME)
 	}
+	streamBody(c, func(w *bufio.Writer) {
+		defer rows.Close()
+		if err := writeTelemetryPage(w, rows, def, fields, limit, page, links); err != nil {
+			log.Printf("telemetry stream for vessel %d aborted: %v", vesselID, err)
+		}
+	})
 
-	query += " ORDER BY ts, id LIMIT ?"
-	args = append(args, limit+1) // Get one extra to check if there's a next page
+	return nil
+}
 
-	rows, err := h.db.Query(query, args...)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+// parseExtraFilters reads the repeatable extra=<key><op><value>, e.g.
+// extra=Running Hours>5000, filtering on the unmapped columns in extra_json.
+func parseExtraFilters(c *fiber.Ctx) ([]store.ExtraFilter, error) {
+	var filters []store.ExtraFilter
+	for _, v := range c.Context().QueryArgs().PeekMulti("extra") {
+		f, err := store.ParseExtraFilter(string(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid extra filter %q: %v", v, err)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// parseFields reads fields=<key,...>, the keys of each reading to return,
+// so clients on slow links can leave out e.g. row_hash and extra_json.
+func parseFields(def *store.Stream, list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	known := make(map[string]bool)
+	for _, key := range def.ReadingKeys() {
+		known[key] = true
 	}
-	defer rows.Close()
+	var fields []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("invalid field for stream %s: %s", def.Name, name)
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
 
-	var items []interface{}
-	var lastTS time.Time
-	var lastID int64
+// parseNotNull reads not_null=<field,...>, the fields a row must have set.
+// alarmsOnly is shorthand for not_null=alarms.
+func parseNotNull(def *store.Stream, list string, alarmsOnly bool) ([]string, error) {
+	var fields []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, ok := def.Field(name); !ok {
+			return nil, fmt.Errorf("invalid not_null field for stream %s: %s", def.Name, name)
+		}
+		fields = append(fields, name)
+	}
+	if alarmsOnly {
+		if _, ok := def.Field("alarms"); !ok {
+			return nil, fmt.Errorf("alarms_only is not supported for stream %s", def.Name)
+		}
+		fields = append(fields, "alarms")
+	}
+	return fields, nil
+}
+
+// writeTelemetryPage writes {"items":[...],"next_cursor":"..."} for up to limit
+// rows. The query must request limit+1 rows so the next page can be detected.
+// next carries the page's order and sort into the cursor. fields, if not
+// nil, are the keys of the items. With links the page ends with their _links
+// for the next cursor, empty on the last page.
+func writeTelemetryPage(w io.Writer, rows store.Rows, def *store.Stream, fields []string, limit int, next Cursor, links func(next string) halLinks) error {
+	if _, err := io.WriteString(w, `{"items":[`); err != nil {
+		return err
+	}
 
 	count := 0
-	for rows.Next() && count < limit {
+	for count < limit && rows.Next() {
+		item, err := def.ScanReading(rows)
+		if err != nil {
+			return err
+		}
+
+		selected := item
+		if fields != nil {
+			selected = item.Select(fields)
+		}
+		data, err := json.Marshal(selected)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			data = append([]byte{','}, data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+
 		count++
+		next.TS, next.ID = item.Timestamp, item.ID
+		if next.Sort != "" {
+			next.Key = fmt.Sprint(def.UnitSortKey(item.Values[0]))
+		}
+	}
 
-		switch stream {
-		case "engines":
-			var reading models.EngineReading
-			var engineNo sql.NullInt64
-			var rpm, tempC, oilPressure sql.NullFloat64
-			var alarms sql.NullString
-
-			err := rows.Scan(
-				&reading.ID, &reading.VesselID, &engineNo, &reading.Timestamp,
-				&rpm, &tempC, &oilPressure, &alarms,
-				&reading.RowHash, &reading.ExtraJSON, &reading.CreatedAt,
-			)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-			}
-
-			if engineNo.Valid {
-				val := int(engineNo.Int64)
-				reading.EngineNo = &val
-			}
-			if rpm.Valid {
-				reading.RPM = &rpm.Float64
-			}
-			if tempC.Valid {
-				reading.TempC = &tempC.Float64
-			}
-			if oilPressure.Valid {
-				reading.OilPressureBar = &oilPressure.Float64
-			}
-			if alarms.Valid {
-				reading.Alarms = &alarms.String
-			}
-
-			items = append(items, reading)
-			lastTS = reading.Timestamp
-			lastID = reading.ID
-
-		case "fuel":
-			var reading models.FuelTankReading
-			var tankNo sql.NullInt64
-			var level, volume, tempC sql.NullFloat64
-
-			err := rows.Scan(
-				&reading.ID, &reading.VesselID, &tankNo, &reading.Timestamp,
-				&level, &volume, &tempC,
-				&reading.RowHash, &reading.ExtraJSON, &reading.CreatedAt,
-			)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-			}
-
-			if tankNo.Valid {
-				val := int(tankNo.Int64)
-				reading.TankNo = &val
-			}
-			if level.Valid {
-				reading.LevelPercent = &level.Float64
-			}
-			if volume.Valid {
-				reading.VolumeLiters = &volume.Float64
-			}
-			if tempC.Valid {
-				reading.TempC = &tempC.Float64
-			}
-
-			items = append(items, reading)
-			lastTS = reading.Timestamp
-			lastID = reading.ID
-
-		case "generators":
-			var reading models.GeneratorReading
-			var genNo sql.NullInt64
-			var loadKW, voltageV, frequencyHz, fuelRateLPH sql.NullFloat64
-
-			err := rows.Scan(
-				&reading.ID, &reading.VesselID, &genNo, &reading.Timestamp,
-				&loadKW, &voltageV, &frequencyHz, &fuelRateLPH,
-				&reading.RowHash, &reading.ExtraJSON, &reading.CreatedAt,
-			)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-			}
-
-			if genNo.Valid {
-				val := int(genNo.Int64)
-				reading.GenNo = &val
-			}
-			if loadKW.Valid {
-				reading.LoadKW = &loadKW.Float64
-			}
-			if voltageV.Valid {
-				reading.VoltageV = &voltageV.Float64
-			}
-			if frequencyHz.Valid {
-				reading.FrequencyHz = &frequencyHz.Float64
-			}
-			if fuelRateLPH.Valid {
-				reading.FuelRateLPH = &fuelRateLPH.Float64
-			}
-
-			items = append(items, reading)
-			lastTS = reading.Timestamp
-			lastID = reading.ID
-
-		case "cctv":
-			var reading models.CCTVStatusReading
-			var camID, status sql.NullString
-			var uptimePercent sql.NullFloat64
-
-			err := rows.Scan(
-				&reading.ID, &reading.VesselID, &camID, &reading.Timestamp,
-				&status, &uptimePercent,
-				&reading.RowHash, &reading.ExtraJSON, &reading.CreatedAt,
-			)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-			}
-
-			if camID.Valid {
-				reading.CamID = &camID.String
-			}
-			if status.Valid {
-				reading.Status = &status.String
-			}
-			if uptimePercent.Valid {
-				reading.UptimePercent = &uptimePercent.Float64
-			}
-
-			items = append(items, reading)
-			lastTS = reading.Timestamp
-			lastID = reading.ID
-
-		case "impact":
-			var reading models.ImpactVibrationReading
-			var sensorID, notes sql.NullString
-			var accelG, shockG sql.NullFloat64
-
-			err := rows.Scan(
-				&reading.ID, &reading.VesselID, &sensorID, &reading.Timestamp,
-				&accelG, &shockG, &notes,
-				&reading.RowHash, &reading.ExtraJSON, &reading.CreatedAt,
-			)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-			}
-
-			if sensorID.Valid {
-				reading.SensorID = &sensorID.String
-			}
-			if accelG.Valid {
-				reading.AccelG = &accelG.Float64
-			}
-			if shockG.Valid {
-				reading.ShockG = &shockG.Float64
-			}
-			if notes.Valid {
-				reading.Notes = &notes.String
-			}
-
-			items = append(items, reading)
-			lastTS = reading.Timestamp
-			lastID = reading.ID
-
-		case "location":
-			var reading models.LocationReading
-			var latitude, longitude, course, speed sql.NullFloat64
-			var status sql.NullString
-
-			err := rows.Scan(
-				&reading.ID, &reading.VesselID, &reading.Timestamp,
-				&latitude, &longitude, &course, &speed, &status,
-				&reading.RowHash, &reading.ExtraJSON, &reading.CreatedAt,
-			)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-			}
-
-			if latitude.Valid {
-				reading.Latitude = &latitude.Float64
-			}
-			if longitude.Valid {
-				reading.Longitude = &longitude.Float64
-			}
-			if course.Valid {
-				reading.CourseDegrees = &course.Float64
-			}
-			if speed.Valid {
-				reading.SpeedKnots = &speed.Float64
-			}
-			if status.Valid {
-				reading.Status = &status.String
-			}
-
-			items = append(items, reading)
-			lastTS = reading.Timestamp
-			lastID = reading.ID
-		}
-	}
-
-	response := models.PaginatedResponse{
-		Items: items,
+	if _, err := io.WriteString(w, "]"); err != nil {
+		return err
 	}
 
 	// Check if there's a next page
-	if rows.Next() {
-		nextCursor := EncodeCursor(lastTS, lastID)
-		response.NextCursor = &nextCursor
+	nextCursor := ""
+	if count == limit && rows.Next() {
+		nextCursor = next.Encode()
+		if _, err := fmt.Fprintf(w, `,"next_cursor":%q`, nextCursor); err != nil {
+			return err
+		}
 	}
 
-	return c.JSON(response)
+	if links != nil {
+		data, err := json.Marshal(links(nextCursor))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, `,"_links":%s`, data); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, "}"); err != nil {
+		return err
+	}
+	return rows.Err()
 }
 
 func (h *Handlers) GetVesselLatest(c *fiber.Ctx) error {
@@ -625,66 +739,129 @@ func (h *Handlers) GetVesselLatest(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "stream parameter is required"})
 	}
 
-	var query string
-	var args []interface{}
+	// Archived vessels have no "current" state
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, false); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
 
-	switch stream {
-	case "engines":
-		query = `
-			SELECT id, vessel_id, engine_no, ts, rpm, temp_c, oil_pressure_bar, alarms, row_hash, extra_json, created_at
-			FROM engine_readings 
-			WHERE vessel_id = ?
-		`
-		args = append(args, vesselID)
+	def, ok := store.Streams[stream]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid stream"})
+	}
 
-		if engineNoStr := c.Query("engine_no"); engineNoStr != "" {
-			if engineNo, err := strconv.Atoi(engineNoStr); err == nil {
-				query += " AND engine_no = ?"
-				args = append(args, engineNo)
-			}
+	fields, err := parseFields(def, c.Query("fields"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	q := store.ReadingQuery{Stream: def, VesselID: vesselID}
+	q.Unit, _ = def.ParseUnit(c.Query(def.Unit))
+	if q.Sources, err = parseSources(c); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if q.Extra, err = parseExtraFilters(c); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// The latest reading changes only when the stream is written to
+	versions, err := h.store.StreamVersions(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Vary(fiber.HeaderAccept)
+	if version, ok := versions[def.Name]; ok {
+		tag := versionTag(map[string]store.StreamVersion{def.Name: version}, string(c.Request().URI().QueryString()), strconv.FormatBool(wantsHAL(c)))
+		if notModified(c, tag, version.UpdatedAt) {
+			return c.SendStatus(fiber.StatusNotModified)
 		}
+	}
+
+	reading, err := h.store.LatestReading(c.UserContext(), q)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "no data found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if fields != nil {
+		*reading = reading.Select(fields)
+	}
 
-		query += " ORDER BY ts DESC, id DESC LIMIT 1"
+	if wantsHAL(c) {
+		links := selfLinks(c.OriginalURL(), "")
+		links["vessel"] = vesselLinks(vesselID)["self"]
+		links["stream"] = streamLink(def.Name)
+		links["telemetry"] = halLink{Href: fmt.Sprintf("/vessels/%d/telemetry?stream=%s", vesselID, def.Name)}
+		return sendHAL(c, reading, links)
+	}
+	return c.JSON(reading)
+}
 
-		var reading models.EngineReading
-		var engineNo sql.NullInt64
-		var rpm, tempC, oilPressure sql.NullFloat64
-		var alarms sql.NullString
+// PostVesselArchive soft-deletes a decommissioned vessel. Its telemetry is kept.
+func (h *Handlers) PostVesselArchive(c *fiber.Ctx) error {
+	return h.setVesselArchived(c, true)
+}
 
-		err := h.db.QueryRow(query, args...).Scan(
-			&reading.ID, &reading.VesselID, &engineNo, &reading.Timestamp,
-			&rpm, &tempC, &oilPressure, &alarms,
-			&reading.RowHash, &reading.ExtraJSON, &reading.CreatedAt,
-		)
-		if err == sql.ErrNoRows {
-			return c.Status(404).JSON(fiber.Map{"error": "no data found"})
-		}
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
+// PostVesselUnarchive restores an archived vessel to the default listings.
+func (h *Handlers) PostVesselUnarchive(c *fiber.Ctx) error {
+	return h.setVesselArchived(c, false)
+}
 
-		if engineNo.Valid {
-			val := int(engineNo.Int64)
-			reading.EngineNo = &val
-		}
-		if rpm.Valid {
-			reading.RPM = &rpm.Float64
-		}
-		if tempC.Valid {
-			reading.TempC = &tempC.Float64
-		}
-		if oilPressure.Valid {
-			reading.OilPressureBar = &oilPressure.Float64
+func (h *Handlers) setVesselArchived(c *fiber.Ctx, archived bool) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	archivedAt, err := h.store.SetVesselArchived(c.UserContext(), id, archived)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"id": id, "archived_at": archivedAt})
+}
+
+// PatchVessel edits a vessel's metadata. Fields left out are kept; null
+// clears one. With replication the edit goes to the other side too.
+func (h *Handlers) PatchVessel(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	var body map[string]*string
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body, use an object of strings or null"})
+	}
+	if len(body) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "no fields to edit"})
+	}
+	for field, value := range body {
+		if !store.ValidVesselField(field) {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("unknown field %q, use %s", field, strings.Join(store.VesselFields, ", "))})
 		}
-		if alarms.Valid {
-			reading.Alarms = &alarms.String
+		if field == "name" && (value == nil || strings.TrimSpace(*value) == "") {
+			return c.Status(400).JSON(fiber.Map{"error": "name must not be empty"})
 		}
+	}
 
-		return c.JSON(reading)
-
-	default:
-		return c.Status(400).JSON(fiber.Map{"error": "stream not implemented for latest endpoint"})
+	err = h.store.EditVessel(c.UserContext(), id, body, h.replicationOrigin, time.Now().UTC())
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
 	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	vessel, err := h.store.GetVessel(c.UserContext(), id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(vessel)
 }
 
 func (h *Handlers) GetUpload(c *fiber.Ctx) error {
@@ -693,33 +870,58 @@ func (h *Handlers) GetUpload(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid upload id"})
 	}
 
-	query := `
-		SELECT id, vessel_id, source_filename, file_hash, uploaded_at, note
-		FROM uploads 
-		WHERE id = ?
-	`
-
-	var upload models.Upload
-	var note sql.NullString
-
-	err = h.db.QueryRow(query, id).Scan(
-		&upload.ID, &upload.VesselID, &upload.SourceFilename,
-		&upload.FileHash, &upload.UploadedAt, &note,
-	)
-	if err == sql.ErrNoRows {
+	upload, err := h.store.GetUpload(c.UserContext(), id)
+	if errors.Is(err, store.ErrNotFound) {
 		return c.Status(404).JSON(fiber.Map{"error": "upload not found"})
 	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if note.Valid {
-		upload.Note = &note.String
+	if wantsHAL(c) {
+		return sendHAL(c, upload, halLinks{
+			"self":   {Href: fmt.Sprintf("/uploads/%d", upload.ID)},
+			"vessel": vesselLinks(upload.VesselID)["self"],
+		})
 	}
-
 	return c.JSON(upload)
 }
 
+// GetUploadWarnings lists the warnings of an upload's ingest in the order
+// they were raised; page with after_id.
+func (h *Handlers) GetUploadWarnings(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid upload id"})
+	}
+	limits := h.limitsFor(c)
+	limit := limits.Default
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= limits.Max {
+		limit = l
+	}
+	var afterID int64
+	if s := c.Query("after_id"); s != "" {
+		if afterID, err = strconv.ParseInt(s, 10, 64); err != nil || afterID < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid after_id"})
+		}
+	}
+
+	if _, err := h.store.GetUpload(c.UserContext(), id); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "upload not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	warnings, err := h.store.UploadWarnings(c.UserContext(), id, afterID, limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	response := fiber.Map{"items": warnings}
+	if len(warnings) == limit {
+		response["next_after_id"] = warnings[len(warnings)-1].ID
+	}
+	return c.JSON(response)
+}
+
 func (h *Handlers) GetOpenAPI(c *fiber.Ctx) error {
 	openAPISpec := map[string]interface{}{
 		"openapi": "3.0.0",
@@ -770,6 +972,17 @@ func (h *Handlers) GetOpenAPI(c *fiber.Ctx) error {
 			"/vessels": map[string]interface{}{
 				"get": map[string]interface{}{
 					"summary": "List vessels",
+					"parameters": []map[string]interface{}{
+						{"name": "q", "in": "query", "description": "Case-insensitive substring of the vessel name", "schema": map[string]string{"type": "string"}},
+						{"name": "imo", "in": "query", "schema": map[string]string{"type": "string"}},
+						{"name": "flag", "in": "query", "schema": map[string]string{"type": "string"}},
+						{"name": "type", "in": "query", "schema": map[string]string{"type": "string"}},
+						{"name": "fleet", "in": "query", "schema": map[string]string{"type": "string"}},
+						{"name": "has_data_since", "in": "query", "description": "Only vessels with a reading at or after this time", "schema": map[string]string{"type": "string", "format": "date-time"}},
+						{"name": "sort", "in": "query", "schema": map[string]interface{}{"type": "string", "enum": []string{"name", "imo", "flag", "type", "fleet", "created_at", "updated_at", "last_data"}}},
+						{"name": "order", "in": "query", "schema": map[string]interface{}{"type": "string", "enum": []string{"asc", "desc"}}},
+						{"name": "include_archived", "in": "query", "schema": map[string]string{"type": "boolean"}},
+					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
 							"description": "Success",
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/config"
+	"vessel-telemetry-api/internal/fair"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// fakeStore serves vessels from memory. Methods it doesn't override panic
+// through the nil embedded Store.
+type fakeStore struct {
+	store.Store
+	vessels map[int64]models.Vessel
+}
+
+func (f *fakeStore) GetVessel(ctx context.Context, id int64) (*models.Vessel, error) {
+	v, ok := f.vessels[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &v, nil
+}
+
+func (f *fakeStore) StreamLatest(ctx context.Context, vesselID int64) (map[string]time.Time, error) {
+	return map[string]time.Time{}, nil
+}
+
+func (f *fakeStore) StreamVersions(ctx context.Context, vesselID int64) (map[string]store.StreamVersion, error) {
+	return map[string]store.StreamVersion{}, nil
+}
+
+func (f *fakeStore) EquipmentLog(ctx context.Context, filter store.EquipmentLogFilter) ([]models.EquipmentLogEntry, error) {
+	return []models.EquipmentLogEntry{}, nil
+}
+
+func TestGetVessel(t *testing.T) {
+	archived := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := &fakeStore{vessels: map[int64]models.Vessel{
+		1: {ID: 1, Name: "Active"},
+		2: {ID: 2, Name: "Retired", ArchivedAt: &archived},
+	}}
+	h := NewHandlers(st, config.Config{})
+
+	app := fiber.New()
+	app.Get("/vessels/:id", h.GetVessel)
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"/vessels/1", 200},
+		{"/vessels/2", 404},
+		{"/vessels/2?include_archived=true", 200},
+		{"/vessels/3", 404},
+		{"/vessels/abc", 400},
+	}
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", tt.url, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.url, tt.status, resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/vessels/1", nil))
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["name"] != "Active" {
+		t.Errorf("Expected vessel name Active, got %v", body["name"])
+	}
+}
+
+func TestLimitsFor(t *testing.T) {
+	h := NewHandlers(&fakeStore{}, config.Config{
+		PageLimits:      config.PageLimits{Default: 100, Max: 500},
+		APIKeyClasses:   map[string]string{"k-onboard": "onboard", "k-other": "other"},
+		ClassPageLimits: map[string]config.PageLimits{"onboard": {Default: 20, Max: 50}},
+	})
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		limits := h.limitsFor(c)
+		return c.JSON(fiber.Map{"default": limits.Default, "max": limits.Max})
+	})
+
+	tests := []struct {
+		key          string
+		def, maximum int
+	}{
+		{"", 100, 500},
+		{"k-onboard", 20, 50},
+		{"k-other", 100, 500}, // class without its own limits
+		{"unknown", 100, 500},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]int
+		json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if got["default"] != tt.def || got["max"] != tt.maximum {
+			t.Errorf("key %q: expected %d/%d, got %v", tt.key, tt.def, tt.maximum, got)
+		}
+	}
+
+	// Unset limits fall back to the built-in defaults
+	if limits := NewHandlers(&fakeStore{}, config.Config{}).pageLimits; limits != config.DefaultPageLimits {
+		t.Errorf("Expected default limits, got %+v", limits)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	h := NewHandlers(&fakeStore{}, config.Config{
+		APIKeyOrgs:    map[string]string{"k-1": "acme", "k-2": "acme"},
+		APIKeyClasses: map[string]string{"k-3": "bulk"},
+		QueryLimits:   fair.Limits{Slots: 1, MaxWait: 10 * time.Millisecond},
+	})
+
+	app := fiber.New()
+	app.Get("/", h.schedule(h.queryScheduler), func(c *fiber.Ctx) error {
+		return c.SendString(h.tenant(c))
+	})
+	inFlight := -1
+	app.Get("/stream", h.schedule(h.queryScheduler), func(c *fiber.Ctx) error {
+		streamBody(c, func(w *bufio.Writer) {
+			time.Sleep(20 * time.Millisecond) // the handler has returned
+			inFlight = h.queryScheduler.Status().InFlight
+			w.WriteString("streamed")
+		})
+		return nil
+	})
+
+	// acme's second key waits for the slot held through its first key
+	release, err := h.queryScheduler.Acquire(context.Background(), "org:acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", "k-2")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Errorf("Expected 503 while the organization's slot is busy, got %d", resp.StatusCode)
+	}
+	release()
+
+	// Keys nobody configured count as the client's IP
+	for key, want := range map[string]string{"k-1": "org:acme", "k-3": "key:k-3", "other": "ip:0.0.0.0", "": "ip:0.0.0.0"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 || string(body) != want {
+			t.Errorf("key %q: expected tenant %q, got %d %q", key, want, resp.StatusCode, body)
+		}
+	}
+
+	// A streamed body holds the slot until it is written
+	resp, err = app.Test(httptest.NewRequest("GET", "/stream", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "streamed" || inFlight != 1 {
+		t.Errorf("Expected the slot held while streaming, got %q with %d in flight", body, inFlight)
+	}
+	if n := h.queryScheduler.Status().InFlight; n != 0 {
+		t.Errorf("Expected the slot released once streamed, got %d in flight", n)
+	}
+}
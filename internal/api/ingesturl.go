@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/urlfetch"
+	"vessel-telemetry-api/internal/util"
+)
+
+// PostIngestURL downloads the workbook a link points at, e.g. a Google
+// Sheets document shared with anyone who has the link, and ingests it as
+// PostIngestXLSX would.
+func (h *Handlers) PostIngestURL(c *fiber.Ctx) error {
+	params, err := parseIngestParams(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var body struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	if body.URL == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "url is required"})
+	}
+
+	file, err := h.fetcher.Fetch(c.UserContext(), body.URL)
+	switch {
+	case errors.Is(err, urlfetch.ErrInvalidURL), errors.Is(err, urlfetch.ErrForbiddenHost):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, urlfetch.ErrTooLarge):
+		return c.Status(413).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, urlfetch.ErrUnsupportedContent):
+		return c.Status(415).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, outbound.ErrCircuitOpen):
+		return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(502).JSON(fiber.Map{"error": "download failed: " + err.Error()})
+	}
+	// Query strings of shared links often carry access tokens
+	audited, _ := url.Parse(file.URL)
+	audited.RawQuery = ""
+	c.Locals(auditDetailKey, map[string]interface{}{"url": audited.String(), "filename": file.Name, "file_sha256": util.SHA256Hex(file.Data)})
+
+	response, err := h.processor.ProcessFile(c.UserContext(), file.Data, file.Name, params)
+	return h.sendIngestResponse(c, response, err)
+}
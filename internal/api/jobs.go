@@ -0,0 +1,17 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/cron"
+)
+
+// GetAdminJobs lists the recurring jobs with when they last ran, for how
+// long and how it went, and when they run next.
+func (h *Handlers) GetAdminJobs(c *fiber.Ctx) error {
+	jobs := []cron.Status{}
+	if h.jobs != nil {
+		jobs = h.jobs.Jobs()
+	}
+	return c.JSON(fiber.Map{"items": jobs})
+}
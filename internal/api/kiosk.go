@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+// kioskWindow is how far back the kiosk view aggregates.
+const kioskWindow = 24 * time.Hour
+
+// RestrictKiosk confines kiosk API keys to reads of their own vessel's kiosk
+// view and latest readings, from the onboard LAN. Other keys pass through.
+func (h *Handlers) RestrictKiosk(c *fiber.Ctx) error {
+	vesselID, ok := h.kioskAPIKeys[c.Get("X-API-Key")]
+	if !ok {
+		return c.Next()
+	}
+	if !h.onKioskNetwork(net.ParseIP(c.IP())) {
+		return c.Status(403).JSON(fiber.Map{"error": "kiosk API keys are only accepted from the onboard network"})
+	}
+	if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+		return c.Status(403).JSON(fiber.Map{"error": "kiosk API keys are read-only"})
+	}
+	if !kioskPath(c.Path(), vesselID) {
+		return c.Status(403).JSON(fiber.Map{"error": "not available to kiosk API keys"})
+	}
+	return c.Next()
+}
+
+func (h *Handlers) onKioskNetwork(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.kioskNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// kioskPath reports whether a kiosk key of the vessel may request path.
+func kioskPath(path string, vesselID int64) bool {
+	if path == "/healthz" {
+		return true
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "vessels" || parts[1] != strconv.FormatInt(vesselID, 10) {
+		return false
+	}
+	return parts[2] == "kiosk" || parts[2] == "latest"
+}
+
+// kioskStream is one stream of the kiosk view.
+type kioskStream struct {
+	Stream     string            `json:"stream"`
+	Latest     []store.Reading   `json:"latest"`
+	Aggregates []store.UnitStats `json:"aggregates"`
+}
+
+// GetVesselKiosk returns what the engine control room display shows: the
+// latest reading of every unit of every stream and each unit's metrics over
+// the last 24 hours.
+func (h *Handlers) GetVesselKiosk(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	// Archived vessels have no "current" state
+	vessel, err := h.store.GetVessel(c.UserContext(), vesselID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && vessel.ArchivedAt != nil) {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-kioskWindow)
+	streams := make([]kioskStream, 0, len(store.StreamOrder))
+	for _, name := range store.StreamOrder {
+		def := store.Streams[name]
+		latest, err := h.store.LatestPerUnit(c.UserContext(), def, vesselID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		aggregates, err := h.store.AggregateUnits(c.UserContext(), def, vesselID, &from, &to)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		streams = append(streams, kioskStream{Stream: name, Latest: latest, Aggregates: aggregates})
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id":    vessel.ID,
+		"name":         vessel.Name,
+		"imo":          vessel.IMO,
+		"generated_at": to,
+		"from":         from,
+		"to":           to,
+		"streams":      streams,
+	})
+}
@@ -0,0 +1,20 @@
+package api
+
+import "testing"
+
+func TestKioskPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/healthz":             true,
+		"/vessels/3/kiosk":     true,
+		"/vessels/3/latest/":   true,
+		"/vessels/3":           false,
+		"/vessels/4/kiosk":     false,
+		"/vessels/3/telemetry": false,
+		"/vessels/03/kiosk":    false,
+		"/compare":             false,
+	} {
+		if got := kioskPath(path, 3); got != want {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+}
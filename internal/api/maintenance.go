@@ -0,0 +1,343 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/maintenance"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// maintenanceItemBody is the body of POST and PUT /vessels/:id/maintenance.
+type maintenanceItemBody struct {
+	Equipment     string   `json:"equipment"`
+	UnitNo        int      `json:"unit_no"`
+	Task          string   `json:"task"`
+	IntervalHours *float64 `json:"interval_hours"`
+	IntervalDays  *int     `json:"interval_days"`
+	LastDoneOn    string   `json:"last_done_on"`
+	Notes         *string  `json:"notes"`
+}
+
+// maintenanceItem reads and checks an item from the request body. A missing
+// last_done_on means today.
+func maintenanceItem(c *fiber.Ctx, vesselID int64, today time.Time) (models.MaintenanceItem, error) {
+	var body maintenanceItemBody
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return models.MaintenanceItem{}, errors.New("invalid JSON body")
+	}
+	item := models.MaintenanceItem{
+		VesselID:      vesselID,
+		Equipment:     strings.ToLower(strings.TrimSpace(body.Equipment)),
+		UnitNo:        body.UnitNo,
+		Task:          strings.TrimSpace(body.Task),
+		IntervalHours: body.IntervalHours,
+		IntervalDays:  body.IntervalDays,
+		LastDoneOn:    strings.TrimSpace(body.LastDoneOn),
+		Notes:         trimmedOrNil(body.Notes),
+	}
+	if item.Equipment != models.EquipmentEngine && item.Equipment != models.EquipmentGenerator {
+		return item, errors.New("invalid equipment, use engine or generator")
+	}
+	if item.UnitNo <= 0 {
+		return item, errors.New("unit_no must be a positive engine or generator number")
+	}
+	if item.Task == "" || len(item.Task) > 200 {
+		return item, errors.New("task must be 1 to 200 characters")
+	}
+	if item.IntervalHours == nil && item.IntervalDays == nil {
+		return item, errors.New("give interval_hours, interval_days or both")
+	}
+	if item.IntervalHours != nil && *item.IntervalHours <= 0 {
+		return item, errors.New("interval_hours must be a positive number")
+	}
+	if item.IntervalDays != nil && *item.IntervalDays <= 0 {
+		return item, errors.New("interval_days must be a positive number")
+	}
+	if item.LastDoneOn == "" {
+		item.LastDoneOn = today.Format(maintenance.DayLayout)
+	}
+	if err := checkDoneOn(item.LastDoneOn, today); err != nil {
+		return item, err
+	}
+	return item, nil
+}
+
+// checkDoneOn checks a day maintenance was done on.
+func checkDoneOn(day string, today time.Time) error {
+	if _, err := time.Parse(maintenance.DayLayout, day); err != nil {
+		return fmt.Errorf("invalid day %q, use YYYY-MM-DD", day)
+	}
+	if day > today.Format(maintenance.DayLayout) {
+		return fmt.Errorf("%s is in the future", day)
+	}
+	return nil
+}
+
+// parseMargins reads how far ahead items count as due, defaulting to
+// maintenance.DefaultMargins.
+func parseMargins(c *fiber.Ctx) (maintenance.Margins, error) {
+	m := maintenance.DefaultMargins
+	if s := c.Query("within_hours"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 {
+			return m, errors.New("invalid within_hours, use a non-negative number")
+		}
+		m.Hours = v
+	}
+	if s := c.Query("within_days"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return m, errors.New("invalid within_days, use a non-negative number of days")
+		}
+		m.Days = v
+	}
+	return m, nil
+}
+
+// visibleVessel parses the vessel ID in the path and checks the vessel
+// exists, answering the request itself on errors.
+func (h *Handlers) visibleVessel(c *fiber.Ctx) (int64, bool, error) {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return 0, false, c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, true); err != nil {
+		return 0, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return 0, false, c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+	return vesselID, true, nil
+}
+
+// loadMaintenanceItem loads the vessel's item whose ID is in the path,
+// answering the request itself on errors.
+func (h *Handlers) loadMaintenanceItem(c *fiber.Ctx, vesselID int64) (*models.MaintenanceItem, error) {
+	id, err := strconv.ParseInt(c.Params("item_id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "invalid maintenance item id"})
+	}
+	item, err := h.store.MaintenanceItem(c.UserContext(), vesselID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "maintenance item not found"})
+	} else if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return item, nil
+}
+
+// GetVesselMaintenance lists the vessel's maintenance items with their
+// status, those of one status or equipment with status and equipment.
+func (h *Handlers) GetVesselMaintenance(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	margins, err := parseMargins(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	status, equipment := c.Query("status"), c.Query("equipment")
+	if status != "" && status != maintenance.OK && maintenance.Rank(status) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid status, use ok, due or overdue"})
+	}
+
+	all, err := h.store.MaintenanceItems(c.UserContext(), []int64{vesselID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	today := time.Now().UTC()
+	items := []models.MaintenanceItem{}
+	for _, item := range all {
+		maintenance.Evaluate(&item, today, margins)
+		if (status == "" || item.Status == status) && (equipment == "" || item.Equipment == equipment) {
+			items = append(items, item)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     items,
+	})
+}
+
+// GetVesselMaintenanceItem returns one maintenance item with its status.
+func (h *Handlers) GetVesselMaintenanceItem(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	margins, err := parseMargins(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	item, err := h.loadMaintenanceItem(c, vesselID)
+	if item == nil {
+		return err
+	}
+	maintenance.Evaluate(item, time.Now().UTC(), margins)
+	return c.JSON(item)
+}
+
+// PostVesselMaintenance adds a maintenance item.
+func (h *Handlers) PostVesselMaintenance(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	item, err := maintenanceItem(c, vesselID, now)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	item.CreatedAt, item.UpdatedAt = now, now
+	if item.ID, err = h.store.CreateMaintenanceItem(c.UserContext(), item); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return h.sendMaintenanceItem(c, vesselID, item.ID, 201)
+}
+
+// PutVesselMaintenanceItem replaces a maintenance item.
+func (h *Handlers) PutVesselMaintenanceItem(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	existing, err := h.loadMaintenanceItem(c, vesselID)
+	if existing == nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	item, err := maintenanceItem(c, vesselID, now)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	item.ID, item.CreatedAt, item.UpdatedAt = existing.ID, existing.CreatedAt, now
+	if err := h.store.UpdateMaintenanceItem(c.UserContext(), item); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "maintenance item not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return h.sendMaintenanceItem(c, vesselID, item.ID, 200)
+}
+
+// PostVesselMaintenanceDone records that a maintenance item was done, on
+// done_on or today, restarting its intervals.
+func (h *Handlers) PostVesselMaintenanceDone(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	item, err := h.loadMaintenanceItem(c, vesselID)
+	if item == nil {
+		return err
+	}
+	var body struct {
+		DoneOn string `json:"done_on"`
+	}
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if item.LastDoneOn = strings.TrimSpace(body.DoneOn); item.LastDoneOn == "" {
+		item.LastDoneOn = now.Format(maintenance.DayLayout)
+	}
+	if err := checkDoneOn(item.LastDoneOn, now); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	item.UpdatedAt = now
+	if err := h.store.UpdateMaintenanceItem(c.UserContext(), *item); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "maintenance item not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return h.sendMaintenanceItem(c, vesselID, item.ID, 200)
+}
+
+// sendMaintenanceItem answers with an item as stored, with its status.
+func (h *Handlers) sendMaintenanceItem(c *fiber.Ctx, vesselID, id int64, status int) error {
+	item, err := h.store.MaintenanceItem(c.UserContext(), vesselID, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	maintenance.Evaluate(item, time.Now().UTC(), maintenance.DefaultMargins)
+	return c.Status(status).JSON(item)
+}
+
+// DeleteVesselMaintenanceItem removes a maintenance item.
+func (h *Handlers) DeleteVesselMaintenanceItem(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Params("item_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid maintenance item id"})
+	}
+	if err := h.store.DeleteMaintenanceItem(c.UserContext(), vesselID, id); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "maintenance item not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// dueMaintenanceItem is an item of the fleet-wide due list.
+type dueMaintenanceItem struct {
+	VesselName string `json:"vessel_name"`
+	models.MaintenanceItem
+}
+
+// GetMaintenanceDue lists the maintenance items due or overdue across a
+// fleet, or all vessels without fleet, overdue first.
+func (h *Handlers) GetMaintenanceDue(c *fiber.Ctx) error {
+	margins, err := parseMargins(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	fleet := strings.TrimSpace(c.Query("fleet"))
+	vessels, err := h.store.ListVessels(c.UserContext(), store.VesselFilter{Fleet: fleet})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	names := make(map[int64]string, len(vessels))
+	ids := make([]int64, 0, len(vessels))
+	for _, v := range vessels {
+		names[v.ID] = v.Name
+		ids = append(ids, v.ID)
+	}
+
+	all, err := h.store.MaintenanceItems(c.UserContext(), ids)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	today := time.Now().UTC()
+	items := []dueMaintenanceItem{}
+	for _, item := range all {
+		maintenance.Evaluate(&item, today, margins)
+		if item.Status != maintenance.OK {
+			items = append(items, dueMaintenanceItem{VesselName: names[item.VesselID], MaintenanceItem: item})
+		}
+	}
+	// Vessel order within each status
+	sort.SliceStable(items, func(i, j int) bool {
+		return maintenance.Rank(items[i].Status) > maintenance.Rank(items[j].Status)
+	})
+
+	return c.JSON(fiber.Map{
+		"fleet":        fleet,
+		"within_hours": margins.Hours,
+		"within_days":  margins.Days,
+		"items":        items,
+	})
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/track"
+)
+
+// defaultMetMaxGap is how far apart a met reading and the position it is
+// paired with may be by default.
+const defaultMetMaxGap = 10 * time.Minute
+
+// metPosition is the position paired with a met reading.
+type metPosition struct {
+	TS         time.Time `json:"ts"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	SpeedKnots *float64  `json:"speed_knots"`
+}
+
+// GetVesselMet pages through the vessel's onboard weather readings, oldest
+// first, each paired with the position closest in time within max_gap.
+func (h *Handlers) GetVesselMet(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	maxGap := defaultMetMaxGap
+	if s := c.Query("max_gap"); s != "" {
+		if maxGap, err = time.ParseDuration(s); err != nil || maxGap < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid max_gap, use e.g. 10m"})
+		}
+	}
+
+	limits := h.limitsFor(c)
+	limit := limits.Default
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= limits.Max {
+		limit = l
+	}
+	cursor, err := ParseCursor(c.Query("cursor"))
+	if err != nil || cursor.Desc || cursor.Sort != "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid cursor"})
+	}
+
+	def := store.Streams["met"]
+	rows, err := h.store.QueryReadings(c.UserContext(), store.ReadingQuery{
+		Stream: def, VesselID: vesselID, From: from, To: to,
+		AfterTS: cursor.TS, AfterID: cursor.ID,
+		Limit: limit + 1, // one extra to see if there is a next page
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var readings []store.Reading
+	for rows.Next() {
+		reading, err := def.ScanReading(rows)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		readings = append(readings, reading)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	rows.Close()
+
+	response, next := fiber.Map{}, ""
+	if len(readings) > limit {
+		readings = readings[:limit]
+		last := readings[limit-1]
+		next = Cursor{TS: last.Timestamp, ID: last.ID}.Encode()
+		response["next_cursor"] = next
+	}
+
+	// Only positions that can pair with this page are read
+	var fixes []ports.Fix
+	if len(readings) > 0 {
+		first, last := readings[0].Timestamp.Add(-maxGap), readings[len(readings)-1].Timestamp.Add(maxGap)
+		if fixes, err = h.store.Positions(c.UserContext(), vesselID, &first, &last); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	items := make([]fiber.Map, len(readings))
+	for i, reading := range readings {
+		items[i] = fiber.Map{"reading": reading, "position": nil}
+		if fix, ok := track.Nearest(fixes, reading.Timestamp, maxGap); ok {
+			items[i]["position"] = metPosition{fix.Timestamp, fix.Latitude, fix.Longitude, fix.Speed}
+		}
+	}
+	response["items"] = items
+	response["max_gap_seconds"] = int64(maxGap / time.Second)
+	if wantsHAL(c) {
+		links := selfLinks(c.OriginalURL(), next)
+		links["vessel"] = vesselLinks(vesselID)["self"]
+		links["stream"] = streamLink("met")
+		return sendHAL(c, response, links)
+	}
+	return c.JSON(response)
+}
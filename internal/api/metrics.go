@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/fair"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// GetMetrics reports the state of outbound integrations and of the fair
+// schedulers in the Prometheus text format.
+func (h *Handlers) GetMetrics(c *fiber.Ctx) error {
+	var b strings.Builder
+	writeOutboundMetrics(&b, outbound.Statuses())
+	writeSchedulerMetrics(&b, fair.Statuses())
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.SendString(b.String())
+}
+
+func writeOutboundMetrics(w io.Writer, statuses []outbound.Status) {
+	fmt.Fprintln(w, "# HELP outbound_circuit_state Circuit breaker state per integration (1 for the current state).")
+	fmt.Fprintln(w, "# TYPE outbound_circuit_state gauge")
+	for _, s := range statuses {
+		for _, state := range []string{outbound.StateClosed, outbound.StateOpen, outbound.StateHalfOpen} {
+			v := 0
+			if s.State == state {
+				v = 1
+			}
+			fmt.Fprintf(w, "outbound_circuit_state{name=%q,state=%q} %d\n", s.Name, state, v)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP outbound_consecutive_failures Failed calls since the last success.")
+	fmt.Fprintln(w, "# TYPE outbound_consecutive_failures gauge")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "outbound_consecutive_failures{name=%q} %d\n", s.Name, s.ConsecutiveFailures)
+	}
+
+	fmt.Fprintln(w, "# HELP outbound_calls_total Calls per integration by result.")
+	fmt.Fprintln(w, "# TYPE outbound_calls_total counter")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "outbound_calls_total{name=%q,result=\"success\"} %d\n", s.Name, s.Successes)
+		fmt.Fprintf(w, "outbound_calls_total{name=%q,result=\"failure\"} %d\n", s.Name, s.Failures)
+		fmt.Fprintf(w, "outbound_calls_total{name=%q,result=\"rejected\"} %d\n", s.Name, s.Rejected)
+	}
+
+	fmt.Fprintln(w, "# HELP outbound_retries_total Retried attempts per integration.")
+	fmt.Fprintln(w, "# TYPE outbound_retries_total counter")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "outbound_retries_total{name=%q} %d\n", s.Name, s.Retries)
+	}
+}
+
+func writeSchedulerMetrics(w io.Writer, statuses []fair.Status) {
+	fmt.Fprintln(w, "# HELP scheduler_in_flight Requests holding a slot.")
+	fmt.Fprintln(w, "# TYPE scheduler_in_flight gauge")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "scheduler_in_flight{name=%q} %d\n", s.Name, s.InFlight)
+	}
+
+	fmt.Fprintln(w, "# HELP scheduler_queued Requests waiting for a slot.")
+	fmt.Fprintln(w, "# TYPE scheduler_queued gauge")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "scheduler_queued{name=%q} %d\n", s.Name, s.Queued)
+	}
+
+	fmt.Fprintln(w, "# HELP scheduler_tenants Tenants with requests in flight or waiting.")
+	fmt.Fprintln(w, "# TYPE scheduler_tenants gauge")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "scheduler_tenants{name=%q} %d\n", s.Name, s.Tenants)
+	}
+
+	fmt.Fprintln(w, "# HELP scheduler_rejected_total Requests refused because the tenant's queue was full or the wait timed out.")
+	fmt.Fprintln(w, "# TYPE scheduler_rejected_total counter")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "scheduler_rejected_total{name=%q} %d\n", s.Name, s.Rejected)
+	}
+}
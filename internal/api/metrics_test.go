@@ -0,0 +1,49 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"vessel-telemetry-api/internal/fair"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+func TestWriteOutboundMetrics(t *testing.T) {
+	var b strings.Builder
+	writeOutboundMetrics(&b, []outbound.Status{
+		{Name: "ais", State: outbound.StateOpen, ConsecutiveFailures: 5, Failures: 5, Rejected: 2, Retries: 10},
+	})
+	out := b.String()
+
+	for _, line := range []string{
+		`outbound_circuit_state{name="ais",state="open"} 1`,
+		`outbound_circuit_state{name="ais",state="closed"} 0`,
+		`outbound_consecutive_failures{name="ais"} 5`,
+		`outbound_calls_total{name="ais",result="failure"} 5`,
+		`outbound_calls_total{name="ais",result="rejected"} 2`,
+		`outbound_retries_total{name="ais"} 10`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestWriteSchedulerMetrics(t *testing.T) {
+	var b strings.Builder
+	writeSchedulerMetrics(&b, []fair.Status{
+		{Name: "ingest", InFlight: 4, Queued: 120, Tenants: 3, Rejected: 7},
+	})
+	out := b.String()
+
+	for _, line := range []string{
+		`scheduler_in_flight{name="ingest"} 4`,
+		`scheduler_queued{name="ingest"} 120`,
+		`scheduler_tenants{name="ingest"} 3`,
+		`scheduler_rejected_total{name="ingest"} 7`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected %q in output:\n%s", line, out)
+		}
+	}
+}
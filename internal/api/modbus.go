@@ -0,0 +1,243 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/modbus"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// modbusStreams are the streams Modbus registers are read into.
+var modbusStreams = []string{"engines", "generators", "fuel"}
+
+// modbusRegisterBody is the body of POST and PUT
+// /vessels/:id/modbus-registers.
+type modbusRegisterBody struct {
+	Device   string   `json:"device"`
+	SlaveID  *int     `json:"slave_id"`
+	Table    string   `json:"table"`
+	Address  *int     `json:"address"`
+	DataType string   `json:"data_type"`
+	WordSwap bool     `json:"word_swap"`
+	Scale    *float64 `json:"scale"`
+	Offset   float64  `json:"offset"`
+	Stream   string   `json:"stream"`
+	Field    string   `json:"field"`
+	Unit     *string  `json:"unit"`
+}
+
+// modbusFields returns the fields of a stream registers may be read into:
+// its numeric sheet columns.
+func modbusFields(stream string) []string {
+	names, _ := ingest.SheetFields(stream)
+	def := store.Streams[stream]
+	var fields []string
+	for _, name := range names {
+		if f, ok := def.Field(name); name == "ts" || name == def.Unit || ok && f.Kind == store.TextField {
+			continue
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// modbusRegister reads and checks a register from the request body,
+// answering the request itself on errors. id is that of the register
+// replaced, 0 for a new one. A missing slave_id means 1, table holding,
+// data_type uint16 and scale 1.
+func (h *Handlers) modbusRegister(c *fiber.Ctx, vesselID, id int64) (models.ModbusRegister, bool, error) {
+	var body modbusRegisterBody
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return models.ModbusRegister{}, false, c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	r := models.ModbusRegister{
+		ID:       id,
+		VesselID: vesselID,
+		Device:   strings.TrimSpace(body.Device),
+		SlaveID:  1,
+		Table:    strings.ToLower(strings.TrimSpace(body.Table)),
+		DataType: strings.ToLower(strings.TrimSpace(body.DataType)),
+		WordSwap: body.WordSwap,
+		Scale:    1,
+		Offset:   body.Offset,
+		Stream:   strings.TrimSpace(body.Stream),
+		Field:    strings.TrimSpace(body.Field),
+		Unit:     trimmedOrNil(body.Unit),
+	}
+	fail := func(msg string) (models.ModbusRegister, bool, error) {
+		return r, false, c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	if host, port, err := net.SplitHostPort(r.Device); err != nil || host == "" {
+		return fail("device must be the host:port of the Modbus TCP server")
+	} else if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fail("invalid device port " + port)
+	}
+	if body.SlaveID != nil {
+		r.SlaveID = *body.SlaveID
+	}
+	if r.SlaveID < 0 || r.SlaveID > 255 {
+		return fail("slave_id must be 0 to 255")
+	}
+	if r.Table == "" {
+		r.Table = modbus.TableHolding
+	}
+	if r.Table != modbus.TableHolding && r.Table != modbus.TableInput {
+		return fail("invalid table, use holding or input")
+	}
+	if r.DataType == "" {
+		r.DataType = modbus.DataTypes[0]
+	}
+	if modbus.Words(r.DataType) == 0 {
+		return fail("invalid data_type, use one of " + strings.Join(modbus.DataTypes, ", "))
+	}
+	if body.Address == nil {
+		return fail("address is required")
+	}
+	r.Address = *body.Address
+	if r.Address < 0 || r.Address+modbus.Words(r.DataType) > 65536 {
+		return fail("address must be 0 to 65535, the register the value starts at")
+	}
+	if body.Scale != nil {
+		r.Scale = *body.Scale
+	}
+	if r.Scale == 0 {
+		return fail("scale must not be 0")
+	}
+
+	known := false
+	for _, s := range modbusStreams {
+		known = known || s == r.Stream
+	}
+	if !known {
+		return fail("unknown stream " + r.Stream + ", use one of " + strings.Join(modbusStreams, ", "))
+	}
+	fields := modbusFields(r.Stream)
+	known = false
+	for _, f := range fields {
+		known = known || f == r.Field
+	}
+	if !known {
+		return fail("unknown " + r.Stream + " field " + r.Field + ", use one of " + strings.Join(fields, ", "))
+	}
+	unit := store.Streams[r.Stream].Unit
+	if r.Unit == nil {
+		return fail("unit is required for " + r.Stream + " registers (the " + unit + ")")
+	}
+	if n, err := strconv.Atoi(*r.Unit); err != nil || n <= 0 {
+		return fail("unit must be a positive number")
+	}
+
+	registers, err := h.store.ModbusRegisters(c.UserContext(), vesselID)
+	if err != nil {
+		return r, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, other := range registers {
+		if other.ID != r.ID && other.Stream == r.Stream && other.Field == r.Field && sameText(other.Unit, r.Unit) {
+			return r, false, c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("modbus register %d already reads %s %s of %s %s", other.ID, r.Stream, r.Field, unit, *r.Unit)})
+		}
+	}
+	return r, true, nil
+}
+
+// GetVesselModbusRegisters lists the Modbus registers polled for the
+// vessel, with the outcome of their latest poll.
+func (h *Handlers) GetVesselModbusRegisters(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	registers, err := h.store.ModbusRegisters(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     registers,
+	})
+}
+
+// PostVesselModbusRegister adds a Modbus register to poll for the vessel.
+func (h *Handlers) PostVesselModbusRegister(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	r, ok, err := h.modbusRegister(c, vesselID, 0)
+	if !ok {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	r.CreatedAt, r.UpdatedAt = now, now
+	if r.ID, err = h.store.CreateModbusRegister(c.UserContext(), r); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(r)
+}
+
+// PutVesselModbusRegister replaces a Modbus register of the vessel.
+func (h *Handlers) PutVesselModbusRegister(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	existing, err := h.loadModbusRegister(c, vesselID)
+	if existing == nil {
+		return err
+	}
+	r, ok, err := h.modbusRegister(c, vesselID, existing.ID)
+	if !ok {
+		return err
+	}
+	r.CreatedAt, r.UpdatedAt = existing.CreatedAt, time.Now().UTC().Truncate(time.Second)
+	if err := h.store.UpdateModbusRegister(c.UserContext(), r); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "modbus register not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(r)
+}
+
+// DeleteVesselModbusRegister stops polling a Modbus register.
+func (h *Handlers) DeleteVesselModbusRegister(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Params("register_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid modbus register id"})
+	}
+	if err := h.store.DeleteModbusRegister(c.UserContext(), vesselID, id); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "modbus register not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// loadModbusRegister loads the vessel's register whose ID is in the path,
+// answering the request itself on errors.
+func (h *Handlers) loadModbusRegister(c *fiber.Ctx, vesselID int64) (*models.ModbusRegister, error) {
+	id, err := strconv.ParseInt(c.Params("register_id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "invalid modbus register id"})
+	}
+	r, err := h.store.ModbusRegister(c.UserContext(), vesselID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "modbus register not found"})
+	} else if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return r, nil
+}
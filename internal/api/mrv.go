@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+
+	"vessel-telemetry-api/internal/dcs"
+	"vessel-telemetry-api/internal/mrv"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/reference"
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetVesselMRV returns the vessel's EU MRV figures of a calendar year, by
+// default the last one, voyage by voyage: as JSON, or with format=csv or
+// format=xlsx in the layout of the EMSA per-voyage template.
+func (h *Handlers) GetVesselMRV(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+
+	now := time.Now().UTC()
+	year := c.QueryInt("year", now.Year()-1)
+	if year < 2000 || year > now.Year() {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid year, use 2000 to %d", now.Year())})
+	}
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" && format != "xlsx" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid format, use json, csv or xlsx"})
+	}
+	opts := mrv.DefaultOptions
+	if c.Query("cargo_tonnes") != "" {
+		cargo := c.QueryFloat("cargo_tonnes", -1)
+		if cargo < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "cargo_tonnes must be a non-negative number"})
+		}
+		opts.CargoTonnes = &cargo
+	}
+	maxSpeed := c.QueryFloat("max_speed", defaultPortMaxSpeed)
+	if maxSpeed < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "max_speed must not be negative"})
+	}
+
+	ctx := c.UserContext()
+	entries, err := h.store.ListReference(ctx, reference.KindEmissionFactors)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	in := mrv.Inputs{Factors: make(map[string]float64, len(entries))}
+	for _, e := range entries {
+		in.Factors[e.Code] = e.Attributes["co2_factor"]
+	}
+	opts.DefaultFuel = reference.NormalizeCode(c.Query("fuel_type", opts.DefaultFuel))
+	if _, ok := in.Factors[opts.DefaultFuel]; !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown fuel_type " + opts.DefaultFuel + ", see /reference/" + reference.KindEmissionFactors})
+	}
+
+	from, to := dcs.Period(year, now)
+	readFrom := from.Add(-mrv.Lookback)
+	vessel, err := h.store.GetVessel(ctx, vesselID)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	in.Vessel = *vessel
+	if in.Fixes, err = h.store.Positions(ctx, vesselID, &readFrom, &to); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	index, err := h.store.ListPorts(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	in.Calls = ports.DetectCalls(in.Fixes, index, maxSpeed)
+
+	registered, err := h.store.Tanks(ctx, vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	fuelTypes := make(map[string]string, len(registered))
+	for _, t := range registered {
+		if t.FuelType != nil {
+			fuelTypes[fmt.Sprint(t.TankNo)] = *t.FuelType
+		}
+	}
+	tanks, err := h.store.MetricSamples(ctx, store.Streams["fuel"], vesselID, []string{"volume_liters"}, nil, &readFrom, &to, store.SourceFilter{})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, t := range tanks {
+		in.Tanks = append(in.Tanks, mrv.Tank{FuelType: fuelTypes[fmt.Sprint(t.Unit)], Points: t.Metrics["volume_liters"]})
+	}
+
+	report := mrv.Build(from, to, in, opts)
+	filename := fmt.Sprintf("vessel-%d-mrv-%d.%s", vesselID, year, format)
+	switch format {
+	case "csv":
+		return writeMRVCSV(c, report, filename)
+	case "xlsx":
+		return writeMRVXLSX(c, report, filename)
+	}
+	return c.JSON(report)
+}
+
+// writeMRVCSV sends the per-voyage table.
+func writeMRVCSV(c *fiber.Ctx, report mrv.Report, filename string) error {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.WriteAll(report.Table())
+	if err := w.Error(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.SendString(b.String())
+}
+
+// writeMRVXLSX sends a workbook with the per-voyage table and the annual
+// figures on sheets of their own.
+func writeMRVXLSX(c *fiber.Ctx, report mrv.Report, filename string) error {
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName("Sheet1", "Per voyage")
+	f.NewSheet("Annual")
+	for sheet, rows := range map[string][][]string{"Per voyage": report.Table(), "Annual": report.Summary()} {
+		for i, row := range rows {
+			cell, _ := excelize.CoordinatesToCellName(1, i+1)
+			values := make([]interface{}, len(row))
+			for j, v := range row {
+				values[j] = v
+			}
+			if err := f.SetSheetRow(sheet, cell, &values); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set(fiber.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Send(buf.Bytes())
+}
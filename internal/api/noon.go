@@ -0,0 +1,56 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/noon"
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetVesselNoonReports lists the vessel's noon reports, oldest first, with
+// the values computed from its telemetry; flagged=true lists only those
+// with discrepancies.
+func (h *Handlers) GetVesselNoonReports(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	reports, err := h.store.NoonReports(c.UserContext(), store.NoonReportFilter{
+		VesselID: vesselID, From: from, To: to, FlaggedOnly: c.QueryBool("flagged"),
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     reports,
+	})
+}
+
+// PostVesselNoonReconcile reconciles the vessel's noon reports from from on,
+// or all of them, with its telemetry again, e.g. after positions or tank
+// readings of their periods arrived after the reports.
+func (h *Handlers) PostVesselNoonReconcile(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	from, _, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	reports, err := noon.ReconcileFrom(c.UserContext(), h.store, vesselID, from, noon.DefaultOptions)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     reports,
+	})
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/onvif"
+	"vessel-telemetry-api/internal/snmp"
+	"vessel-telemetry-api/internal/store"
+)
+
+// onvifCameraBody is the body of POST and PUT /vessels/:id/onvif-cameras.
+type onvifCameraBody struct {
+	CamID    string  `json:"cam_id"`
+	Endpoint string  `json:"endpoint"`
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+}
+
+// onvifCamera reads and checks a camera from the request body, answering
+// the request itself on errors. existing is the camera replaced, nil for a
+// new one. An endpoint given as a bare host is its usual device service; a
+// missing password is none, or that of the camera replaced.
+func (h *Handlers) onvifCamera(c *fiber.Ctx, vesselID int64, existing *models.ONVIFCamera) (models.ONVIFCamera, bool, error) {
+	var body onvifCameraBody
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return models.ONVIFCamera{}, false, c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	cam := models.ONVIFCamera{
+		VesselID: vesselID,
+		CamID:    strings.TrimSpace(body.CamID),
+		Endpoint: strings.TrimSpace(body.Endpoint),
+		Username: trimmedOrNil(body.Username),
+	}
+	if existing != nil {
+		cam.ID, cam.Password = existing.ID, existing.Password
+	}
+	fail := func(msg string) (models.ONVIFCamera, bool, error) {
+		return cam, false, c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	if cam.CamID == "" {
+		return fail("cam_id is required")
+	}
+	if cam.Endpoint != "" && !strings.Contains(cam.Endpoint, "://") {
+		cam.Endpoint = "http://" + cam.Endpoint + onvif.DevicePath
+	}
+	if u, err := url.Parse(cam.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fail("endpoint must be the http(s) URL of the camera's device service, or its host")
+	}
+	if body.Password != nil {
+		cam.Password = *body.Password
+	}
+
+	ctx := c.UserContext()
+	cameras, err := h.store.ONVIFCameras(ctx, vesselID)
+	if err != nil {
+		return cam, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, other := range cameras {
+		if other.ID != cam.ID && strings.EqualFold(other.CamID, cam.CamID) {
+			return cam, false, c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("onvif camera %d is already %s", other.ID, other.CamID)})
+		}
+	}
+	// Both pollers would report the camera's status
+	devices, err := h.store.SNMPDevices(ctx, vesselID)
+	if err != nil {
+		return cam, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, d := range devices {
+		if snmp.Stream(d.Kind) == "cctv" && strings.EqualFold(d.Name, cam.CamID) {
+			return cam, false, c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("snmp device %d already reports %s", d.ID, d.Name)})
+		}
+	}
+	return cam, true, nil
+}
+
+// GetVesselONVIFCameras lists the ONVIF cameras polled for the vessel, with
+// the outcome of their latest poll. Passwords are not shown.
+func (h *Handlers) GetVesselONVIFCameras(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	cameras, err := h.store.ONVIFCameras(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     cameras,
+	})
+}
+
+// PostVesselONVIFCamera adds a camera to poll over ONVIF for the vessel.
+func (h *Handlers) PostVesselONVIFCamera(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	cam, ok, err := h.onvifCamera(c, vesselID, nil)
+	if !ok {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	cam.CreatedAt, cam.UpdatedAt = now, now
+	if cam.ID, err = h.store.CreateONVIFCamera(c.UserContext(), cam); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(cam)
+}
+
+// PutVesselONVIFCamera replaces an ONVIF camera of the vessel.
+func (h *Handlers) PutVesselONVIFCamera(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	existing, err := h.loadONVIFCamera(c, vesselID)
+	if existing == nil {
+		return err
+	}
+	cam, ok, err := h.onvifCamera(c, vesselID, existing)
+	if !ok {
+		return err
+	}
+	cam.CreatedAt, cam.UpdatedAt = existing.CreatedAt, time.Now().UTC().Truncate(time.Second)
+	if err := h.store.UpdateONVIFCamera(c.UserContext(), cam); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "onvif camera not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(cam)
+}
+
+// DeleteVesselONVIFCamera stops polling an ONVIF camera. Its readings and
+// alerts are kept.
+func (h *Handlers) DeleteVesselONVIFCamera(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Params("camera_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid onvif camera id"})
+	}
+	if err := h.store.DeleteONVIFCamera(c.UserContext(), vesselID, id); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "onvif camera not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// loadONVIFCamera loads the vessel's camera whose ID is in the path,
+// answering the request itself on errors.
+func (h *Handlers) loadONVIFCamera(c *fiber.Ctx, vesselID int64) (*models.ONVIFCamera, error) {
+	id, err := strconv.ParseInt(c.Params("camera_id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "invalid onvif camera id"})
+	}
+	cam, err := h.store.ONVIFCamera(c.UserContext(), vesselID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "onvif camera not found"})
+	} else if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return cam, nil
+}
+
+// GetVesselCameraAlerts lists the alerts raised for the vessel's ONVIF
+// cameras that stopped responding, newest first; with open=true, those not
+// resolved yet.
+func (h *Handlers) GetVesselCameraAlerts(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	alerts, err := h.store.CameraAlerts(c.UserContext(), vesselID, c.QueryBool("open"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     alerts,
+	})
+}
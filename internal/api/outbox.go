@@ -0,0 +1,27 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/outbox"
+)
+
+// GetAdminOutbox reports the newest outbox event and how far each webhook
+// and reading sink has been delivered.
+func (h *Handlers) GetAdminOutbox(c *fiber.Ctx) error {
+	head, err := h.store.OutboxHead(c.UserContext())
+	if err != nil {
+		return err
+	}
+	type consumer struct {
+		outbox.Status
+		Lag int64 `json:"lag"` // seqs behind head, events of other streams included
+	}
+	consumers := []consumer{}
+	if h.dispatcher != nil {
+		for _, s := range h.dispatcher.Statuses() {
+			consumers = append(consumers, consumer{Status: s, Lag: head - s.Cursor})
+		}
+	}
+	return c.JSON(fiber.Map{"head": head, "consumers": consumers})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetVesselOutliers lists the readings of the vessel its sensors' spike
+// filters replaced, with their raw values, oldest first; stream=<name> keeps
+// one stream's.
+func (h *Handlers) GetVesselOutliers(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	stream := c.Query("stream")
+	if def, ok := store.Streams[stream]; stream != "" && (!ok || def.Unit == "") {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid stream, use one with units"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items, err := h.store.Outliers(c.UserContext(), vesselID, stream, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     items,
+	})
+}
@@ -8,35 +8,76 @@ import (
 	"time"
 )
 
-func EncodeCursor(ts time.Time, id int64) string {
-	cursor := fmt.Sprintf("%s|%d", ts.Format(time.RFC3339), id)
+// Cursor is the position of the last row of a telemetry page, together with
+// the order it was issued for, so it can't be replayed against another order.
+type Cursor struct {
+	TS   time.Time
+	ID   int64
+	Desc bool   // issued for order=desc
+	Sort string // secondary sort column, empty for plain ts order
+	Key  string // value of Sort in the last row
+}
+
+// Encode returns the opaque cursor string. Ascending ts cursors keep the
+// original "ts|id" form.
+func (c Cursor) Encode() string {
+	cursor := fmt.Sprintf("%s|%d", c.TS.Format(time.RFC3339Nano), c.ID)
+	if c.Desc || c.Sort != "" {
+		order := "asc"
+		if c.Desc {
+			order = "desc"
+		}
+		cursor += fmt.Sprintf("|%s|%s|%s", order, c.Sort, c.Key)
+	}
 	return base64.StdEncoding.EncodeToString([]byte(cursor))
 }
 
-func DecodeCursor(s string) (time.Time, int64, error) {
+// ParseCursor decodes a cursor from Encode. The empty string is the zero
+// Cursor (first page).
+func ParseCursor(s string) (Cursor, error) {
 	if s == "" {
-		return time.Time{}, 0, nil
+		return Cursor{}, nil
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(s)
 	if err != nil {
-		return time.Time{}, 0, fmt.Errorf("invalid cursor format")
+		return Cursor{}, fmt.Errorf("invalid cursor format")
 	}
 
-	parts := strings.Split(string(decoded), "|")
-	if len(parts) != 2 {
-		return time.Time{}, 0, fmt.Errorf("invalid cursor format")
+	parts := strings.SplitN(string(decoded), "|", 5)
+	if len(parts) != 2 && len(parts) != 5 {
+		return Cursor{}, fmt.Errorf("invalid cursor format")
 	}
 
 	ts, err := time.Parse(time.RFC3339, parts[0])
 	if err != nil {
-		return time.Time{}, 0, fmt.Errorf("invalid timestamp in cursor")
+		return Cursor{}, fmt.Errorf("invalid timestamp in cursor")
 	}
 
 	id, err := strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
-		return time.Time{}, 0, fmt.Errorf("invalid id in cursor")
+		return Cursor{}, fmt.Errorf("invalid id in cursor")
+	}
+
+	c := Cursor{TS: ts, ID: id}
+	if len(parts) == 5 {
+		switch parts[2] {
+		case "asc":
+		case "desc":
+			c.Desc = true
+		default:
+			return Cursor{}, fmt.Errorf("invalid order in cursor")
+		}
+		c.Sort, c.Key = parts[3], parts[4]
 	}
+	return c, nil
+}
+
+func EncodeCursor(ts time.Time, id int64) string {
+	return Cursor{TS: ts, ID: id}.Encode()
+}
 
-	return ts, id, nil
+func DecodeCursor(s string) (time.Time, int64, error) {
+	c, err := ParseCursor(s)
+	return c.TS, c.ID, err
 }
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/base64"
 	"testing"
 	"time"
 )
@@ -51,3 +52,23 @@ func TestDecodeInvalid(t *testing.T) {
 		t.Errorf("Expected error for invalid cursor")
 	}
 }
+
+func TestCursorOrder(t *testing.T) {
+	want := Cursor{TS: time.Date(2025, 8, 8, 10, 0, 0, 500, time.UTC), ID: 7, Desc: true, Sort: "cam_id", Key: "cam|1"}
+	got, err := ParseCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("Expected no error decoding, got: %v", err)
+	}
+	if !got.TS.Equal(want.TS) || got.ID != want.ID || got.Desc != want.Desc || got.Sort != want.Sort || got.Key != want.Key {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	// Ascending ts cursors keep the original format
+	if plain := (Cursor{TS: want.TS, ID: 7}).Encode(); plain != EncodeCursor(want.TS, 7) {
+		t.Errorf("Expected the plain cursor format, got %s", plain)
+	}
+
+	if _, err := ParseCursor(base64.StdEncoding.EncodeToString([]byte("2025-08-08T10:00:00Z|7|up||"))); err == nil {
+		t.Error("Expected error for an unknown order")
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ports"
+)
+
+// defaultPortMaxSpeed is the speed (knots) at or below which a vessel inside
+// a port polygon counts as stationary.
+const defaultPortMaxSpeed = 1.0
+
+// GetPorts lists the port index.
+func (h *Handlers) GetPorts(c *fiber.Ctx) error {
+	index, err := h.store.ListPorts(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": index})
+}
+
+// PostPortsImport adds or replaces ports (matched by code) from a JSON array
+// of {code, name, country, polygon: [[lat, lon], ...]}.
+func (h *Handlers) PostPortsImport(c *fiber.Ctx) error {
+	index, err := ports.ParseIndex(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	n, err := h.store.ImportPorts(c.UserContext(), index)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"imported": n})
+}
+
+// GetVesselPortCalls detects port calls from the vessel's positions.
+func (h *Handlers) GetVesselPortCalls(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	maxSpeed := c.QueryFloat("max_speed", defaultPortMaxSpeed)
+	if maxSpeed < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "max_speed must not be negative"})
+	}
+
+	var minDuration time.Duration
+	if s := c.Query("min_duration"); s != "" {
+		if minDuration, err = time.ParseDuration(s); err != nil || minDuration < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid min_duration, use e.g. 2h"})
+		}
+	}
+
+	index, err := h.store.ListPorts(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	fixes, err := h.store.Positions(c.UserContext(), vesselID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	calls := []ports.Call{}
+	for _, call := range ports.DetectCalls(fixes, index, maxSpeed) {
+		// Open calls are kept: the vessel may still be in port
+		if call.Departure != nil && call.Duration() < minDuration {
+			continue
+		}
+		calls = append(calls, call)
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     calls,
+	})
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+const profileSampleSize = 5
+
+type fieldProfile struct {
+	Field         string        `json:"field"`
+	NullCount     int64         `json:"null_count"`
+	NullRate      float64       `json:"null_rate"`
+	Min           interface{}   `json:"min"`
+	Max           interface{}   `json:"max"`
+	DistinctCount int64         `json:"distinct_count"`
+	Samples       []interface{} `json:"samples"`
+}
+
+// parseTimeRange reads the optional from/to query parameters.
+func parseTimeRange(c *fiber.Ctx) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+	if s := c.Query("from"); s != "" {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid from format, use ISO 8601")
+		}
+		from = &ts
+	}
+	if s := c.Query("to"); s != "" {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid to format, use ISO 8601")
+		}
+		to = &ts
+	}
+	return from, to, nil
+}
+
+// GetVesselTelemetryProfile reports per-field data quality for one stream so
+// analysts can judge whether the data is usable before building reports.
+func (h *Handlers) GetVesselTelemetryProfile(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	stream := c.Query("stream")
+	if stream == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "stream parameter is required"})
+	}
+	def, ok := store.Streams[stream]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid stream"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	total, stats, err := h.store.ProfileStream(c.UserContext(), def, vesselID, from, to, profileSampleSize)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	fields := make([]fieldProfile, 0, len(stats))
+	for _, fs := range stats {
+		profile := fieldProfile{
+			Field:         fs.Field,
+			NullCount:     total - fs.NonNull,
+			Min:           fs.Min,
+			Max:           fs.Max,
+			DistinctCount: fs.Distinct,
+			Samples:       fs.Samples,
+		}
+		if total > 0 {
+			profile.NullRate = float64(profile.NullCount) / float64(total)
+		}
+		fields = append(fields, profile)
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"stream":    stream,
+		"from":      from,
+		"to":        to,
+		"row_count": total,
+		"fields":    fields,
+	})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// GetVesselQuota returns the vessel's effective daily row quota, today's usage
+// and the days on which the quota was exceeded.
+func (h *Handlers) GetVesselQuota(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, true); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	status, err := h.processor.QuotaStatus(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(status)
+}
+
+// PutVesselQuota sets a per-vessel quota override. Sending {"reset": true}
+// removes the override so the deployment default applies again.
+func (h *Handlers) PutVesselQuota(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, true); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	var body struct {
+		models.QuotaPolicy
+		Reset bool `json:"reset"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if body.DailyRowLimit < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "daily_row_limit must be >= 0"})
+	}
+
+	if body.Reset {
+		err = h.processor.ClearQuota(c.UserContext(), vesselID)
+	} else {
+		err = h.processor.SetQuota(c.UserContext(), vesselID, body.QuotaPolicy)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	status, err := h.processor.QuotaStatus(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(status)
+}
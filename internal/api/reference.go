@@ -0,0 +1,163 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/reference"
+	"vessel-telemetry-api/internal/store"
+)
+
+// referencePorts is the port index's name among the reference data.
+const referencePorts = "ports"
+
+// RequireAdmin refuses requests without one of the admin API keys.
+func (h *Handlers) RequireAdmin(c *fiber.Ctx) error {
+	if h.isAdmin(c) {
+		return c.Next()
+	}
+	return c.Status(403).JSON(fiber.Map{"error": "admin API key required"})
+}
+
+// isAdmin reports whether the request carries one of the admin API keys.
+func (h *Handlers) isAdmin(c *fiber.Ctx) bool {
+	key := []byte(c.Get("X-API-Key"))
+	for _, admin := range h.adminAPIKeys {
+		if subtle.ConstantTimeCompare(key, []byte(admin)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetReferenceKinds lists the available reference data.
+func (h *Handlers) GetReferenceKinds(c *fiber.Ctx) error {
+	kinds := append(reference.Kinds(), referencePorts)
+	return c.JSON(fiber.Map{"items": kinds})
+}
+
+// referenceKind returns the :kind parameter, answering 404 for unknown kinds.
+func referenceKind(c *fiber.Ctx) (string, bool) {
+	kind := c.Params("kind")
+	return kind, reference.Known(kind)
+}
+
+// GetReference lists the entries of one kind.
+func (h *Handlers) GetReference(c *fiber.Ctx) error {
+	kind, ok := referenceKind(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "unknown reference data"})
+	}
+	entries, err := h.store.ListReference(c.UserContext(), kind)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": entries})
+}
+
+// GetReferenceEntry returns one entry by code.
+func (h *Handlers) GetReferenceEntry(c *fiber.Ctx) error {
+	kind, ok := referenceKind(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "unknown reference data"})
+	}
+	entry, err := h.store.GetReference(c.UserContext(), kind, reference.NormalizeCode(c.Params("code")))
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "entry not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(entry)
+}
+
+// PutReferenceEntry creates or replaces an entry; the code comes from the path.
+func (h *Handlers) PutReferenceEntry(c *fiber.Ctx) error {
+	kind, ok := referenceKind(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "unknown reference data"})
+	}
+
+	var entry reference.Entry
+	if err := json.Unmarshal(c.Body(), &entry); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	code := reference.NormalizeCode(c.Params("code"))
+	if entry.Code != "" && reference.NormalizeCode(entry.Code) != code {
+		return c.Status(400).JSON(fiber.Map{"error": "code in body does not match the path"})
+	}
+	entry.Code = code
+	if err := reference.Validate(kind, &entry); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	created, err := h.store.PutReference(c.UserContext(), kind, entry)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if created {
+		return c.Status(201).JSON(entry)
+	}
+	return c.JSON(entry)
+}
+
+// DeleteReferenceEntry removes an entry.
+func (h *Handlers) DeleteReferenceEntry(c *fiber.Ctx) error {
+	kind, ok := referenceKind(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "unknown reference data"})
+	}
+	err := h.store.DeleteReference(c.UserContext(), kind, reference.NormalizeCode(c.Params("code")))
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "entry not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// GetReferencePort returns one port of the index by UN/LOCODE.
+func (h *Handlers) GetReferencePort(c *fiber.Ctx) error {
+	port, err := h.store.GetPort(c.UserContext(), reference.NormalizeCode(c.Params("code")))
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "port not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(port)
+}
+
+// PutReferencePort creates or replaces one port of the index.
+func (h *Handlers) PutReferencePort(c *fiber.Ctx) error {
+	var port ports.Port
+	if err := json.Unmarshal(c.Body(), &port); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	code := reference.NormalizeCode(c.Params("code"))
+	if port.Code != "" && reference.NormalizeCode(port.Code) != code {
+		return c.Status(400).JSON(fiber.Map{"error": "code in body does not match the path"})
+	}
+	port.Code = code
+	if err := port.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if _, err := h.store.ImportPorts(c.UserContext(), []ports.Port{port}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return h.GetReferencePort(c)
+}
+
+// DeleteReferencePort removes a port from the index.
+func (h *Handlers) DeleteReferencePort(c *fiber.Ctx) error {
+	err := h.store.DeletePort(c.UserContext(), reference.NormalizeCode(c.Params("code")))
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "port not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
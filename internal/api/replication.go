@@ -0,0 +1,69 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/replication"
+)
+
+// PostReplicationBatch writes a batch of readings or uploads pushed by an
+// edge instance, gzipped or not. Only the central instance takes them, and
+// only with the shared token.
+func (h *Handlers) PostReplicationBatch(c *fiber.Ctx) error {
+	if h.replicationRole != replication.RoleCentral {
+		return c.Status(404).JSON(fiber.Map{"error": "not a central instance"})
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Get(replication.TokenHeader)), []byte(h.replicationToken)) != 1 {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid replication token"})
+	}
+
+	// Decoded here rather than by fiber, to bound a gzipped body
+	batch, err := replication.DecodeBatch(c.Request().Body(), c.Get(fiber.HeaderContentEncoding))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	result, err := replication.Apply(c.UserContext(), h.store, batch)
+	if errors.Is(err, replication.ErrInvalid) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
+
+// GetAdminReplication reports the instance's replication role and, on an
+// edge, the cursor of every stream, how many rows still wait to go ashore
+// and how much of the window's budget is spent.
+func (h *Handlers) GetAdminReplication(c *fiber.Ctx) error {
+	if h.replicationRole != replication.RoleEdge {
+		return c.JSON(fiber.Map{"role": h.replicationRole})
+	}
+	cursors, err := h.store.ReplicationCursors(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	pending, err := h.store.PendingReplication(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	response := fiber.Map{"role": h.replicationRole, "cursors": cursors, "pending": pending}
+	if budget := h.replicationBudget; budget.Bytes > 0 {
+		start := budget.WindowStart(time.Now())
+		used, err := h.store.ReplicationUsage(c.UserContext(), start)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		response["budget"] = fiber.Map{
+			"bytes":        budget.Bytes,
+			"window":       budget.Window.String(),
+			"window_start": start,
+			"window_end":   start.Add(budget.Window),
+			"used":         used,
+		}
+	}
+	return c.JSON(response)
+}
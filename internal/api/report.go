@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/report"
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetVesselReport renders the vessel's report of a month (?period=YYYY-MM,
+// UTC): track, fuel and engine hours per day, alarms and data quality, as a
+// PDF for people who do not use the API, or as JSON with format=json.
+// ?template= lays it out by a report template.
+func (h *Handlers) GetVesselReport(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	period, err := report.Month(c.Query("period"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid period " + strconv.Quote(c.Query("period")) + ", use YYYY-MM"})
+	}
+	format := c.Query("format", "pdf")
+	if format != "pdf" && format != "json" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid format, use pdf or json"})
+	}
+
+	var tpl *models.ReportTemplate
+	if name := c.Query("template"); name != "" {
+		if tpl, err = h.store.ReportTemplate(c.UserContext(), name); errors.Is(err, store.ErrNotFound) {
+			return c.Status(400).JSON(fiber.Map{"error": "report template " + strconv.Quote(name) + " not found"})
+		} else if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	r, err := report.Gather(c.UserContext(), h.store, vesselID, period, tpl, time.Now())
+	if errors.Is(err, report.ErrFuturePeriod) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if format == "json" {
+		return c.JSON(r)
+	}
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", r.Filename()))
+	return c.Send(r.PDF())
+}
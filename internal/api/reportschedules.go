@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/report"
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxReportRecipients bounds the recipients of one report schedule.
+const maxReportRecipients = 50
+
+// reportScheduleBody is the body of POST and PUT /report-schedules;
+// enabled defaults to true and template to the default layout.
+type reportScheduleBody struct {
+	Name       string   `json:"name"`
+	Frequency  string   `json:"frequency"`
+	VesselID   *int64   `json:"vessel_id"`
+	Fleet      *string  `json:"fleet"`
+	Recipients []string `json:"recipients"`
+	Template   *string  `json:"template"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// reportSchedule reads and checks a schedule from the request body,
+// answering it itself on errors.
+func (h *Handlers) reportSchedule(c *fiber.Ctx) (models.ReportSchedule, bool, error) {
+	var body reportScheduleBody
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return models.ReportSchedule{}, false, c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	rs := models.ReportSchedule{
+		Name:      strings.TrimSpace(body.Name),
+		Frequency: body.Frequency,
+		VesselID:  body.VesselID,
+		Fleet:     trimmedOrNil(body.Fleet),
+		Template:  trimmedOrNil(body.Template),
+		Enabled:   body.Enabled == nil || *body.Enabled,
+	}
+	if err := validateReportSchedule(&rs, body.Recipients); err != nil {
+		return rs, false, c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rs.VesselID != nil {
+		if _, err := h.store.GetVessel(c.UserContext(), *rs.VesselID); errors.Is(err, store.ErrNotFound) {
+			return rs, false, c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("vessel %d not found", *rs.VesselID)})
+		} else if err != nil {
+			return rs, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if rs.Template != nil {
+		if _, err := h.store.ReportTemplate(c.UserContext(), *rs.Template); errors.Is(err, store.ErrNotFound) {
+			return rs, false, c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("report template %s not found", *rs.Template)})
+		} else if err != nil {
+			return rs, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	return rs, true, nil
+}
+
+// validateReportSchedule checks a schedule and sets its recipients, trimmed.
+func validateReportSchedule(rs *models.ReportSchedule, recipients []string) error {
+	if rs.Name == "" || len(rs.Name) > 200 {
+		return errors.New("name must be 1 to 200 characters")
+	}
+	switch rs.Frequency {
+	case models.ReportDaily, models.ReportWeekly, models.ReportMonthly:
+	default:
+		return errors.New("invalid frequency, use daily, weekly or monthly")
+	}
+	if (rs.VesselID == nil) == (rs.Fleet == nil) {
+		return errors.New("set either vessel_id or fleet")
+	}
+	if len(recipients) == 0 || len(recipients) > maxReportRecipients {
+		return fmt.Errorf("a report schedule needs 1 to %d recipients", maxReportRecipients)
+	}
+	rs.Recipients = make([]string, len(recipients))
+	for i, r := range recipients {
+		r = strings.TrimSpace(r)
+		if _, err := mail.ParseAddress(r); err != nil {
+			return fmt.Errorf("invalid recipient %q", r)
+		}
+		rs.Recipients[i] = r
+	}
+	return nil
+}
+
+// loadReportSchedule loads the schedule whose ID is in the path, answering
+// the request itself on errors.
+func (h *Handlers) loadReportSchedule(c *fiber.Ctx) (*models.ReportSchedule, error) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "invalid report schedule id"})
+	}
+	rs, err := h.store.ReportSchedule(c.UserContext(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "report schedule not found"})
+	} else if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return rs, nil
+}
+
+// GetReportSchedules lists the report schedules.
+func (h *Handlers) GetReportSchedules(c *fiber.Ctx) error {
+	schedules, err := h.store.ReportSchedules(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": schedules})
+}
+
+// GetReportSchedule returns one report schedule.
+func (h *Handlers) GetReportSchedule(c *fiber.Ctx) error {
+	rs, err := h.loadReportSchedule(c)
+	if rs == nil {
+		return err
+	}
+	return c.JSON(rs)
+}
+
+// PostReportSchedule creates a report schedule. Its first report is of the
+// first period to end after it was created.
+func (h *Handlers) PostReportSchedule(c *fiber.Ctx) error {
+	rs, ok, err := h.reportSchedule(c)
+	if !ok {
+		return err
+	}
+	rs.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	rs.UpdatedAt = rs.CreatedAt
+	if rs.ID, err = h.store.CreateReportSchedule(c.UserContext(), rs); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(rs)
+}
+
+// PutReportSchedule replaces a report schedule.
+func (h *Handlers) PutReportSchedule(c *fiber.Ctx) error {
+	existing, err := h.loadReportSchedule(c)
+	if existing == nil {
+		return err
+	}
+	rs, ok, err := h.reportSchedule(c)
+	if !ok {
+		return err
+	}
+	rs.ID, rs.CreatedAt = existing.ID, existing.CreatedAt
+	rs.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := h.store.UpdateReportSchedule(c.UserContext(), rs); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "report schedule not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(rs)
+}
+
+// DeleteReportSchedule removes a report schedule and its send history.
+func (h *Handlers) DeleteReportSchedule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid report schedule id"})
+	}
+	if err := h.store.DeleteReportSchedule(c.UserContext(), id); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "report schedule not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// PostReportScheduleSend emails the schedule's report of its last period
+// now, whether or not it was sent already, and returns the delivery.
+func (h *Handlers) PostReportScheduleSend(c *fiber.Ctx) error {
+	if h.reports == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "email is not configured"})
+	}
+	rs, err := h.loadReportSchedule(c)
+	if rs == nil {
+		return err
+	}
+	now := time.Now()
+	period, err := report.Last(rs.Frequency, now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	delivery, err := h.reports.Send(c.UserContext(), *rs, period, now, true)
+	if err != nil {
+		return c.Status(502).JSON(fiber.Map{"error": err.Error(), "delivery": delivery})
+	}
+	return c.JSON(delivery)
+}
+
+// GetReportScheduleDeliveries returns the schedule's send history, most
+// recent first.
+func (h *Handlers) GetReportScheduleDeliveries(c *fiber.Ctx) error {
+	rs, err := h.loadReportSchedule(c)
+	if rs == nil {
+		return err
+	}
+	limits := h.limitsFor(c)
+	limit := limits.Default
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= limits.Max {
+		limit = l
+	}
+	deliveries, err := h.store.ReportDeliveries(c.UserContext(), rs.ID, c.Query("period"), limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"schedule_id": rs.ID, "items": deliveries})
+}
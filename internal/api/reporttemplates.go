@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxReportSections bounds the sections of one report template.
+const maxReportSections = 30
+
+// hexColor is the form of a report template's colour.
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// validateReportTemplate checks a report template and tidies its text.
+// Template names take the form of custom stream names.
+func validateReportTemplate(t *models.ReportTemplate) error {
+	if !customName.MatchString(t.Name) {
+		return errors.New("invalid name, use lower-case letters, digits and underscores")
+	}
+	if len(t.Sections) == 0 || len(t.Sections) > maxReportSections {
+		return fmt.Errorf("a report template needs 1 to %d sections", maxReportSections)
+	}
+	for i := range t.Sections {
+		if err := validateReportSection(&t.Sections[i]); err != nil {
+			return fmt.Errorf("section %d: %w", i+1, err)
+		}
+	}
+
+	b := &t.Branding
+	b.Company, b.Color, b.Footer = trimmedOrNil(b.Company), trimmedOrNil(b.Color), trimmedOrNil(b.Footer)
+	if b.Company != nil && len(*b.Company) > 100 {
+		return errors.New("branding company must be at most 100 characters")
+	}
+	if b.Footer != nil && len(*b.Footer) > 300 {
+		return errors.New("branding footer must be at most 300 characters")
+	}
+	if b.Color != nil && !hexColor.MatchString(*b.Color) {
+		return errors.New("branding color must be #rrggbb")
+	}
+	return nil
+}
+
+func validateReportSection(s *models.ReportSection) error {
+	if s.Title = trimmedOrNil(s.Title); s.Title != nil && len(*s.Title) > 100 {
+		return errors.New("title must be at most 100 characters")
+	}
+	switch s.Type {
+	case models.SectionSummary, models.SectionTrack, models.SectionFuel, models.SectionEngines,
+		models.SectionAlarms, models.SectionDataQuality:
+		if s.Stream != "" || s.Metric != "" || s.Unit != nil || s.Aggregate != "" {
+			return fmt.Errorf("only chart sections have a stream, metric, unit or aggregate")
+		}
+		return nil
+	case models.SectionChart:
+	default:
+		return errors.New("invalid type, use summary, track, fuel, engines, alarms, data_quality or chart")
+	}
+
+	def, ok := store.Streams[s.Stream]
+	if !ok {
+		return fmt.Errorf("unknown stream %q", s.Stream)
+	}
+	if !def.IsMetric(s.Metric) {
+		return fmt.Errorf("%q is not a metric of %s", s.Metric, def.Name)
+	}
+	if s.Unit = trimmedOrNil(s.Unit); s.Unit != nil {
+		if _, ok := def.ParseUnit(*s.Unit); !ok {
+			return fmt.Errorf("invalid %s unit %q", def.Name, *s.Unit)
+		}
+	}
+	switch s.Aggregate {
+	case "":
+		s.Aggregate = "avg"
+	case "avg", "min", "max":
+	default:
+		return errors.New("invalid aggregate, use avg, min or max")
+	}
+	return nil
+}
+
+// GetReportTemplates lists the report templates.
+func (h *Handlers) GetReportTemplates(c *fiber.Ctx) error {
+	templates, err := h.store.ReportTemplates(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"items": templates})
+}
+
+// GetReportTemplate returns one report template.
+func (h *Handlers) GetReportTemplate(c *fiber.Ctx) error {
+	t, err := h.store.ReportTemplate(c.UserContext(), c.Params("name"))
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "report template not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(t)
+}
+
+// PutReportTemplate creates or replaces a report template; the name comes
+// from the path.
+func (h *Handlers) PutReportTemplate(c *fiber.Ctx) error {
+	var t models.ReportTemplate
+	if err := json.Unmarshal(c.Body(), &t); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	name := c.Params("name")
+	if t.Name != "" && t.Name != name {
+		return c.Status(400).JSON(fiber.Map{"error": "name in body does not match the path"})
+	}
+	t.Name = name
+	t.Description = trimmedOrNil(t.Description)
+	if err := validateReportTemplate(&t); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	t.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	created, err := h.store.PutReportTemplate(c.UserContext(), t)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	saved, err := h.store.ReportTemplate(c.UserContext(), name)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if created {
+		return c.Status(201).JSON(saved)
+	}
+	return c.JSON(saved)
+}
+
+// DeleteReportTemplate removes a report template that no report schedule
+// uses.
+func (h *Handlers) DeleteReportTemplate(c *fiber.Ctx) error {
+	name := c.Params("name")
+	schedules, err := h.store.ReportSchedules(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	var users []string
+	for _, rs := range schedules {
+		if rs.Template != nil && *rs.Template == name {
+			users = append(users, fmt.Sprintf("%d (%s)", rs.ID, rs.Name))
+		}
+	}
+	if len(users) > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "report template is used by report schedule(s) " + strings.Join(users, ", ")})
+	}
+
+	if err := h.store.DeleteReportTemplate(c.UserContext(), name); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "report template not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/resample"
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxResamplePoints bounds the points of one resampled series.
+const maxResamplePoints = 10000
+
+// resampledUnit is one unit's resampled metrics, aligned with the response
+// timestamps.
+type resampledUnit struct {
+	Unit   interface{}           `json:"unit"`
+	Values map[string][]*float64 `json:"values"`
+}
+
+// parseInterval parses a resampling step: a Go duration of whole seconds.
+func parseInterval(name, s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Second || d%time.Second != 0 {
+		return 0, fmt.Errorf("invalid %s %q, use whole seconds of at least 1s, e.g. 30s or 5m", name, s)
+	}
+	return d, nil
+}
+
+// GetVesselTelemetryResample returns a stream's metrics as evenly spaced
+// series per unit, interpolated linearly or carried forward from the
+// readings, whose timestamps are irregular.
+func (h *Handlers) GetVesselTelemetryResample(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	def, ok := store.Streams[c.Query("stream")]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid stream"})
+	}
+	intervalParam := c.Query("interval")
+	if intervalParam == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "interval parameter is required, e.g. interval=5m"})
+	}
+	interval, err := parseInterval("interval", intervalParam)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	method := c.Query("method", resample.Linear)
+	if method != resample.Linear && method != resample.LOCF {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid method, use linear or locf"})
+	}
+	var maxGap time.Duration
+	if s := c.Query("max_gap"); s != "" {
+		if maxGap, err = parseInterval("max_gap", s); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	var metrics []string
+	if s := c.Query("metrics"); s != "" {
+		for _, m := range strings.Split(s, ",") {
+			m = strings.TrimSpace(m)
+			if !def.IsMetric(m) {
+				return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid metric %q for %s", m, def.Name)})
+			}
+			metrics = append(metrics, m)
+		}
+	} else {
+		for _, name := range def.FieldNames() {
+			if def.IsMetric(name) {
+				metrics = append(metrics, name)
+			}
+		}
+	}
+	if len(metrics) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("stream %s has no metrics", def.Name)})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	sources, err := parseSources(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	unit, _ := def.ParseUnit(c.Query(def.Unit))
+
+	samples, err := h.store.MetricSamples(c.UserContext(), def, vesselID, metrics, unit, from, to, sources)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Without from or to, the series start or end with the readings
+	start, end := from, to
+	for _, u := range samples {
+		for _, points := range u.Metrics {
+			if first := points[0].TS; from == nil && (start == nil || first.Before(*start)) {
+				start = &first
+			}
+			if last := points[len(points)-1].TS; to == nil && (end == nil || last.After(*end)) {
+				end = &last
+			}
+		}
+	}
+	grid := []time.Time{}
+	if start != nil && end != nil {
+		if n := resample.Count(*start, *end, interval); n > maxResamplePoints {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("%d points at %s, at most %d; use a longer interval or a shorter range", n, intervalParam, maxResamplePoints)})
+		}
+		grid = resample.Grid(*start, *end, interval)
+	}
+
+	series := make([]resampledUnit, 0, len(samples))
+	for _, u := range samples {
+		values := make(map[string][]*float64, len(metrics))
+		for _, m := range metrics {
+			values[m] = resample.Series(u.Metrics[m], grid, method, maxGap)
+		}
+		series = append(series, resampledUnit{Unit: u.Unit, Values: values})
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id":  vesselID,
+		"stream":     def.Name,
+		"interval":   intervalParam,
+		"method":     method,
+		"metrics":    metrics,
+		"timestamps": grid,
+		"series":     series,
+	})
+}
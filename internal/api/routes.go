@@ -1,28 +1,253 @@
 package api
 
 import (
-	"database/sql"
+	"context"
 
 	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/cache"
+	"vessel-telemetry-api/internal/chunked"
+	"vessel-telemetry-api/internal/config"
+	"vessel-telemetry-api/internal/cron"
+	"vessel-telemetry-api/internal/fair"
+	"vessel-telemetry-api/internal/ha"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbox"
+	"vessel-telemetry-api/internal/report"
+	"vessel-telemetry-api/internal/s3ingest"
+	"vessel-telemetry-api/internal/store"
 )
 
-func SetupRoutes(app *fiber.App, db *sql.DB, allowUnsafeDuplicateIngest bool) {
-	handlers := NewHandlers(db, allowUnsafeDuplicateIngest)
+// SetupRoutes registers all endpoints. standby is nil unless the instance
+// runs as a standby; its routes then refuse writes until it is promoted.
+// bucket is nil unless an S3 bucket is watched for files to ingest; jobs
+// runs the recurring jobs, dispatcher delivers the outbox and uploads keeps
+// the chunked uploads. responses
+// caches hot reads; writes invalidate it. reports is nil unless email is
+// configured to send reports through. ingested, if not nil, is called after
+// each file uploaded is ingested.
+// ingestSlots, if not nil, are the ingest slots uploads share with the
+// workers collecting files.
+func SetupRoutes(app *fiber.App, st store.Store, cfg config.Config, standby *ha.Standby, bucket *s3ingest.Watcher, jobs *cron.Scheduler, dispatcher *outbox.Dispatcher, uploads *chunked.Manager, responses cache.Cache, reports *report.Sender, ingested func(ctx context.Context, filename string, resp *models.IngestResponse), ingestSlots *fair.Scheduler) {
+	handlers := NewHandlers(st, cfg)
+	if ingestSlots == nil {
+		ingestSlots = fair.New("ingest", cfg.IngestLimits)
+	}
+	handlers.ingestScheduler = ingestSlots
+	handlers.standby = standby
+	handlers.bucket = bucket
+	handlers.jobs = jobs
+	handlers.dispatcher = dispatcher
+	handlers.uploads = uploads
+	handlers.cache = responses
+	handlers.reports = reports
+	if ingested != nil {
+		handlers.processor.OnIngest(ingested)
+	}
+	app.Use(handlers.RejectWritesOnStandby)
+	app.Use(handlers.InvalidateCacheOnWrite)
+	app.Use(handlers.RestrictKiosk)
 
 	// Health check endpoint
 	app.Get("/healthz", handlers.GetHealthz)
 
-	// Ingest endpoint
-	app.Post("/ingest/xlsx", handlers.PostIngestXLSX)
+	// Primary/standby replication
+	app.Get("/ha/status", handlers.GetHAStatus)
+	app.Get("/ha/snapshot", handlers.GetHASnapshot)
+	app.Post("/ha/promote", handlers.audited("ha.promote"), handlers.PostHAPromote)
+
+	// Edge-to-shore replication
+	app.Post("/replication/batches", handlers.PostReplicationBatch)
+	app.Get("/admin/replication", handlers.RequireAdmin, handlers.GetAdminReplication)
+
+	// Outbound integration metrics (Prometheus text format)
+	app.Get("/metrics", handlers.GetMetrics)
+
+	// Recurring jobs and how they last ran
+	app.Get("/admin/jobs", handlers.RequireAdmin, handlers.GetAdminJobs)
+	app.Get("/admin/outbox", handlers.RequireAdmin, handlers.GetAdminOutbox)
+
+	// Uploads and heavy reads share slots fairly between tenants
+	ingest := handlers.schedule(handlers.ingestScheduler)
+	query := handlers.schedule(handlers.queryScheduler)
+
+	// Ingest endpoints
+	app.Post("/ingest/xlsx", ingest, handlers.audited("ingest"), handlers.PostIngestXLSX)
+	app.Post("/ingest/inspect", ingest, handlers.PostIngestInspect)
+	app.Post("/ingest/archive", ingest, handlers.audited("ingest.archive"), handlers.PostIngestArchive)
+	app.Post("/ingest/url", ingest, handlers.audited("ingest.url"), handlers.PostIngestURL)
+	app.Post("/ingest/iso19848", ingest, handlers.audited("ingest.iso19848"), handlers.PostIngestISO19848)
+	app.Post("/ingest/s3/events", handlers.PostIngestS3Events)
+	app.Get("/ingest/s3/objects", handlers.RequireAdmin, handlers.GetIngestS3Objects)
+
+	// Resumable uploads: announce, send chunks, then ingest the whole file
+	app.Post("/ingest/uploads", handlers.PostChunkedUpload)
+	app.Get("/ingest/uploads/:id", handlers.GetChunkedUpload)
+	app.Delete("/ingest/uploads/:id", handlers.DeleteChunkedUpload)
+	app.Post("/ingest/uploads/:id/chunks", handlers.PostChunkedUploadChunk)
+	app.Post("/ingest/uploads/:id/complete", ingest, handlers.audited("ingest.chunked"), handlers.PostChunkedUploadComplete)
 
 	// Vessel endpoints
-	app.Get("/vessels", handlers.GetVessels)
+	app.Get("/vessels", handlers.cached(vesselsKey, handlers.GetVessels))
 	app.Get("/vessels/:id", handlers.GetVessel)
-	app.Get("/vessels/:id/telemetry", handlers.GetVesselTelemetry)
+	app.Get("/vessels/:id/telemetry", query, handlers.GetVesselTelemetry)
+	app.Get("/vessels/:id/telemetry/profile", query, handlers.GetVesselTelemetryProfile)
+	app.Get("/vessels/:id/telemetry/resample", query, handlers.GetVesselTelemetryResample)
+	app.Get("/vessels/:id/telemetry/deltas", query, handlers.GetVesselTelemetryDeltas)
+	app.Get("/vessels/:id/export", handlers.verifySignedURL, query, handlers.GetVesselExport)
 	app.Get("/vessels/:id/latest", handlers.GetVesselLatest)
+	app.Get("/vessels/:id/kiosk", handlers.cached(kioskKey, handlers.GetVesselKiosk))
+	app.Get("/vessels/:id/alarms", handlers.GetVesselAlarms)
+	app.Get("/vessels/:id/fuel-drops", handlers.GetVesselFuelDrops)
+	app.Get("/vessels/:id/coverage", query, handlers.GetVesselCoverage)
+	app.Get("/vessels/:id/stats", query, handlers.GetVesselStats)
+	app.Get("/vessels/:id/daily", handlers.GetVesselDaily)
+	app.Get("/vessels/:id/noon-reports", handlers.GetVesselNoonReports)
+	app.Post("/vessels/:id/noon-reports/reconcile", handlers.audited("vessel.noon.reconcile"), handlers.PostVesselNoonReconcile)
+	app.Get("/vessels/:id/dcs", handlers.GetVesselDCS)
+	app.Get("/vessels/:id/mrv", handlers.GetVesselMRV)
+	app.Get("/vessels/:id/quota", handlers.GetVesselQuota)
+	app.Get("/vessels/:id/weather", handlers.GetVesselWeather)
+	app.Get("/vessels/:id/weather/fuel", query, handlers.GetVesselFuelWeather)
+	app.Get("/vessels/:id/port-calls", handlers.GetVesselPortCalls)
+	app.Get("/vessels/:id/track", query, handlers.GetVesselTrack)
+	app.Get("/vessels/:id/met", query, handlers.GetVesselMet)
+	app.Get("/vessels/:id/generators/report", handlers.verifySignedURL, query, handlers.GetVesselGeneratorReport)
+	app.Get("/vessels/:id/report", handlers.verifySignedURL, query, handlers.GetVesselReport)
+	app.Put("/vessels/:id/quota", handlers.audited("vessel.quota"), handlers.PutVesselQuota)
+	app.Get("/vessels/:id/tanks", handlers.GetVesselTanks)
+	app.Put("/vessels/:id/tanks/:tank_no", handlers.audited("vessel.tank"), handlers.PutVesselTank)
+	app.Delete("/vessels/:id/tanks/:tank_no", handlers.audited("vessel.tank.delete"), handlers.DeleteVesselTank)
+	// ISO 19848 data channels: their mappings to stream fields, and the
+	// readings of those mapped to none
+	app.Get("/vessels/:id/data-channels", handlers.GetVesselDataChannels)
+	app.Put("/vessels/:id/data-channels", handlers.audited("vessel.data_channel"), handlers.PutVesselDataChannel)
+	app.Delete("/vessels/:id/data-channels", handlers.audited("vessel.data_channel.delete"), handlers.DeleteVesselDataChannel)
+	app.Get("/vessels/:id/modbus-registers", handlers.GetVesselModbusRegisters)
+	app.Post("/vessels/:id/modbus-registers", handlers.RequireAdmin, handlers.audited("vessel.modbus_register.create"), handlers.PostVesselModbusRegister)
+	app.Put("/vessels/:id/modbus-registers/:register_id", handlers.RequireAdmin, handlers.audited("vessel.modbus_register.put"), handlers.PutVesselModbusRegister)
+	app.Delete("/vessels/:id/modbus-registers/:register_id", handlers.RequireAdmin, handlers.audited("vessel.modbus_register.delete"), handlers.DeleteVesselModbusRegister)
+	app.Get("/vessels/:id/snmp-devices", handlers.GetVesselSNMPDevices)
+	app.Post("/vessels/:id/snmp-devices", handlers.RequireAdmin, handlers.audited("vessel.snmp_device.create"), handlers.PostVesselSNMPDevice)
+	app.Put("/vessels/:id/snmp-devices/:device_id", handlers.RequireAdmin, handlers.audited("vessel.snmp_device.put"), handlers.PutVesselSNMPDevice)
+	app.Delete("/vessels/:id/snmp-devices/:device_id", handlers.RequireAdmin, handlers.audited("vessel.snmp_device.delete"), handlers.DeleteVesselSNMPDevice)
+	app.Get("/vessels/:id/onvif-cameras", handlers.GetVesselONVIFCameras)
+	app.Post("/vessels/:id/onvif-cameras", handlers.RequireAdmin, handlers.audited("vessel.onvif_camera.create"), handlers.PostVesselONVIFCamera)
+	app.Put("/vessels/:id/onvif-cameras/:camera_id", handlers.RequireAdmin, handlers.audited("vessel.onvif_camera.put"), handlers.PutVesselONVIFCamera)
+	app.Delete("/vessels/:id/onvif-cameras/:camera_id", handlers.RequireAdmin, handlers.audited("vessel.onvif_camera.delete"), handlers.DeleteVesselONVIFCamera)
+	app.Get("/vessels/:id/camera-alerts", handlers.GetVesselCameraAlerts)
+	app.Get("/vessels/:id/channels", handlers.GetVesselChannels)
+	app.Get("/vessels/:id/channels/readings", handlers.GetVesselChannelReadings)
+	app.Get("/vessels/:id/engines", handlers.GetVesselEngines)
+	app.Get("/vessels/:id/engines/running-hours", handlers.GetVesselEngineRunningHours)
+	app.Get("/vessels/:id/maintenance", handlers.GetVesselMaintenance)
+	app.Post("/vessels/:id/maintenance", handlers.audited("vessel.maintenance.create"), handlers.PostVesselMaintenance)
+	app.Get("/vessels/:id/maintenance/:item_id", handlers.GetVesselMaintenanceItem)
+	app.Put("/vessels/:id/maintenance/:item_id", handlers.audited("vessel.maintenance.put"), handlers.PutVesselMaintenanceItem)
+	app.Delete("/vessels/:id/maintenance/:item_id", handlers.audited("vessel.maintenance.delete"), handlers.DeleteVesselMaintenanceItem)
+	app.Post("/vessels/:id/maintenance/:item_id/done", handlers.audited("vessel.maintenance.done"), handlers.PostVesselMaintenanceDone)
+	app.Get("/vessels/:id/equipment-log", handlers.GetVesselEquipmentLog)
+	app.Post("/vessels/:id/equipment-log", handlers.audited("vessel.log.create"), handlers.PostVesselEquipmentLog)
+	app.Get("/vessels/:id/equipment-log/:entry_id", handlers.GetVesselEquipmentLogEntry)
+	app.Put("/vessels/:id/equipment-log/:entry_id", handlers.audited("vessel.log.put"), handlers.PutVesselEquipmentLogEntry)
+	app.Delete("/vessels/:id/equipment-log/:entry_id", handlers.audited("vessel.log.delete"), handlers.DeleteVesselEquipmentLogEntry)
+	app.Put("/vessels/:id/engines/:engine_no", handlers.audited("vessel.engine"), handlers.PutVesselEngine)
+	app.Delete("/vessels/:id/engines/:engine_no", handlers.audited("vessel.engine.delete"), handlers.DeleteVesselEngine)
+	app.Get("/vessels/:id/sensors", handlers.GetVesselSensors)
+	app.Get("/vessels/:id/sensors/:sensor_id", handlers.GetVesselSensor)
+	app.Put("/vessels/:id/sensors/:sensor_id", handlers.audited("vessel.sensor"), handlers.PutVesselSensor)
+	app.Put("/vessels/:id/sensors/:sensor_id/filters", handlers.audited("vessel.sensor.filters"), handlers.PutVesselSensorFilters)
+	app.Get("/vessels/:id/outliers", handlers.GetVesselOutliers)
+	app.Post("/vessels/:id/cctv/:cam_id/snapshots", ingest, handlers.audited("cctv.snapshot"), handlers.PostCCTVSnapshot)
+	app.Get("/vessels/:id/cctv/:cam_id/snapshots/latest", handlers.GetLatestCCTVSnapshot)
+	app.Get("/vessels/:id/cctv/snapshots/:snapshot_id/image", handlers.GetCCTVSnapshotImage)
+	app.Get("/vessels/:id/custom/:name", query, handlers.GetVesselCustomReadings)
+	app.Get("/vessels/:id/custom/:name/latest", handlers.GetVesselCustomLatest)
+	app.Patch("/vessels/:id", handlers.audited("vessel.edit"), handlers.PatchVessel)
+	app.Post("/vessels/:id/archive", handlers.audited("vessel.archive"), handlers.PostVesselArchive)
+	app.Post("/vessels/:id/unarchive", handlers.audited("vessel.unarchive"), handlers.PostVesselUnarchive)
+
+	// Fleet endpoints
+	app.Get("/compare", query, handlers.GetCompare)
+	app.Get("/utilization", query, handlers.GetUtilization)
+	app.Get("/maintenance/due", handlers.GetMaintenanceDue)
+	app.Get("/cctv/status", query, handlers.GetCCTVStatus)
+
+	// Change data capture feed of every reading table
+	app.Get("/cdc", query, handlers.GetCDC)
+
+	// Export tracing; watermarks name the recipient, so admins only
+	app.Get("/exports/:id", handlers.RequireAdmin, handlers.GetExportWatermark)
+	app.Post("/exports/verify", handlers.RequireAdmin, handlers.PostExportVerify)
+
+	// Time-limited download links for people without an API key
+	app.Post("/signed-urls", handlers.RequireAdmin, handlers.audited("signed_url.create"), handlers.PostSignedURL)
+
+	// Read-only views of one vessel over a date range, shared by token
+	app.Post("/share", handlers.RequireAdmin, handlers.audited("share.create"), handlers.PostShare)
+	app.Get("/share/:token", handlers.verifyShare, handlers.GetShare)
+	app.Get("/share/:token/track", handlers.verifyShare, handlers.GetShareTrack)
+
+	// Reports emailed on schedule; recipients are personal data, so admins only
+	app.Get("/report-schedules", handlers.RequireAdmin, handlers.GetReportSchedules)
+	app.Post("/report-schedules", handlers.RequireAdmin, handlers.audited("report_schedule.create"), handlers.PostReportSchedule)
+	app.Get("/report-schedules/:id", handlers.RequireAdmin, handlers.GetReportSchedule)
+	app.Put("/report-schedules/:id", handlers.RequireAdmin, handlers.audited("report_schedule.put"), handlers.PutReportSchedule)
+	app.Delete("/report-schedules/:id", handlers.RequireAdmin, handlers.audited("report_schedule.delete"), handlers.DeleteReportSchedule)
+	app.Post("/report-schedules/:id/send", handlers.RequireAdmin, handlers.audited("report_schedule.send"), handlers.PostReportScheduleSend)
+	app.Get("/report-schedules/:id/deliveries", handlers.RequireAdmin, handlers.GetReportScheduleDeliveries)
+
+	// Report layouts and branding, e.g. per charterer; see ?template= of /vessels/:id/report
+	app.Get("/report-templates", handlers.GetReportTemplates)
+	app.Get("/report-templates/:name", handlers.GetReportTemplate)
+	app.Put("/report-templates/:name", handlers.RequireAdmin, handlers.audited("report_template.put"), handlers.PutReportTemplate)
+	app.Delete("/report-templates/:name", handlers.RequireAdmin, handlers.audited("report_template.delete"), handlers.DeleteReportTemplate)
+
+	// Port index endpoints
+	app.Get("/ports", handlers.GetPorts)
+	app.Post("/ports/import", handlers.RequireAdmin, handlers.audited("ports.import"), handlers.PostPortsImport)
+
+	// Reference data (lookup values); changes need an admin API key
+	app.Get("/reference", handlers.GetReferenceKinds)
+	app.Get("/reference/ports", handlers.GetPorts)
+	app.Get("/reference/ports/:code", handlers.GetReferencePort)
+	app.Put("/reference/ports/:code", handlers.RequireAdmin, handlers.audited("reference.put"), handlers.PutReferencePort)
+	app.Delete("/reference/ports/:code", handlers.RequireAdmin, handlers.audited("reference.delete"), handlers.DeleteReferencePort)
+	app.Get("/reference/:kind", handlers.GetReference)
+	app.Get("/reference/:kind/:code", handlers.GetReferenceEntry)
+	app.Put("/reference/:kind/:code", handlers.RequireAdmin, handlers.audited("reference.put"), handlers.PutReferenceEntry)
+	app.Delete("/reference/:kind/:code", handlers.RequireAdmin, handlers.audited("reference.delete"), handlers.DeleteReferenceEntry)
+
+	// Stream definitions; custom streams are defined at runtime and changes
+	// need an admin API key
+	app.Get("/streams", handlers.GetStreams)
+	app.Get("/streams/custom", handlers.GetCustomStreams)
+	app.Get("/streams/custom/:name", handlers.GetCustomStream)
+	app.Put("/streams/custom/:name", handlers.RequireAdmin, handlers.audited("custom_stream.put"), handlers.PutCustomStream)
+	app.Delete("/streams/custom/:name", handlers.RequireAdmin, handlers.audited("custom_stream.delete"), handlers.DeleteCustomStream)
+	app.Get("/streams/:name", handlers.GetStream)
+
+	// Header aliases for vendor spreadsheets; changes need an admin API key
+	app.Get("/header-aliases", handlers.GetHeaderAliases)
+	app.Post("/header-aliases", handlers.RequireAdmin, handlers.audited("header_alias.create"), handlers.PostHeaderAlias)
+	app.Get("/header-aliases/:id", handlers.GetHeaderAlias)
+	app.Put("/header-aliases/:id", handlers.RequireAdmin, handlers.audited("header_alias.put"), handlers.PutHeaderAlias)
+	app.Delete("/header-aliases/:id", handlers.RequireAdmin, handlers.audited("header_alias.delete"), handlers.DeleteHeaderAlias)
+
+	// Plausibility rules checked on ingest; changes need an admin API key
+	app.Get("/validation-rules", handlers.GetValidationRules)
+	app.Post("/validation-rules", handlers.RequireAdmin, handlers.audited("validation_rule.create"), handlers.PostValidationRule)
+	app.Get("/validation-rules/:id", handlers.GetValidationRule)
+	app.Put("/validation-rules/:id", handlers.RequireAdmin, handlers.audited("validation_rule.put"), handlers.PutValidationRule)
+	app.Delete("/validation-rules/:id", handlers.RequireAdmin, handlers.audited("validation_rule.delete"), handlers.DeleteValidationRule)
+
+	// Tamper-evident audit log
+	app.Get("/audit", handlers.RequireAdmin, handlers.GetAudit)
+	app.Get("/audit/verify", query, handlers.GetAuditVerify)
 
 	// Upload endpoints
 	app.Get("/uploads/:id", handlers.GetUpload)
+	app.Get("/uploads/:id/warnings", handlers.GetUploadWarnings)
 
 	// OpenAPI endpoint
 	app.Get("/.well-known/openapi.json", handlers.GetOpenAPI)
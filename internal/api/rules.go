@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/rules"
+	"vessel-telemetry-api/internal/store"
+)
+
+// validationRuleBody is the body of POST and PUT /validation-rules.
+type validationRuleBody struct {
+	Stream      string  `json:"stream"`
+	Expression  string  `json:"expression"`
+	Action      string  `json:"action"`
+	Description *string `json:"description"`
+}
+
+// validationRule reads and checks a rule from the request body, answering
+// the request itself on errors. id is that of the rule replaced, 0 for a
+// new one.
+func (h *Handlers) validationRule(c *fiber.Ctx, id int64) (models.ValidationRule, bool, error) {
+	var body validationRuleBody
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return models.ValidationRule{}, false, c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	r := models.ValidationRule{
+		ID:          id,
+		Stream:      strings.TrimSpace(body.Stream),
+		Expression:  strings.TrimSpace(body.Expression),
+		Action:      body.Action,
+		Description: trimmedOrNil(body.Description),
+	}
+	if r.Action == "" {
+		r.Action = models.RuleReject
+	}
+	if r.Action != models.RuleReject && r.Action != models.RuleWarn {
+		return r, false, c.Status(400).JSON(fiber.Map{"error": "invalid action, use reject or warn"})
+	}
+	if len(r.Expression) > 1000 {
+		return r, false, c.Status(400).JSON(fiber.Map{"error": "expression must be at most 1000 characters"})
+	}
+	rule, err := rules.Parse(r.Expression)
+	if err != nil {
+		return r, false, c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid expression: %v", err)})
+	}
+
+	fields, ok := ingest.RuleFields(r.Stream)
+	if !ok {
+		def, err := h.store.CustomStream(c.UserContext(), r.Stream)
+		if errors.Is(err, store.ErrNotFound) {
+			return r, false, c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("unknown stream %q", r.Stream)})
+		} else if err != nil {
+			return r, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		for _, col := range def.Columns {
+			fields = append(fields, col.Name)
+		}
+	}
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f] = true
+	}
+	for _, name := range rule.Vars() {
+		if !known[name] {
+			return r, false, c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("%q is not a field of %s", name, r.Stream), "fields": fields})
+		}
+	}
+	return r, true, nil
+}
+
+// loadValidationRule loads the rule whose ID is in the path, answering the
+// request itself on errors.
+func (h *Handlers) loadValidationRule(c *fiber.Ctx) (*models.ValidationRule, error) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "invalid validation rule id"})
+	}
+	r, err := h.store.ValidationRule(c.UserContext(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "validation rule not found"})
+	} else if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return r, nil
+}
+
+// GetValidationRules lists the validation rules, those of one stream with
+// stream.
+func (h *Handlers) GetValidationRules(c *fiber.Ctx) error {
+	all, err := h.store.ValidationRules(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if stream := c.Query("stream"); stream != "" {
+		matching := []models.ValidationRule{}
+		for _, r := range all {
+			if r.Stream == stream {
+				matching = append(matching, r)
+			}
+		}
+		all = matching
+	}
+	return c.JSON(fiber.Map{"items": all})
+}
+
+// GetValidationRule returns one validation rule.
+func (h *Handlers) GetValidationRule(c *fiber.Ctx) error {
+	r, err := h.loadValidationRule(c)
+	if r == nil {
+		return err
+	}
+	return c.JSON(r)
+}
+
+// PostValidationRule creates a validation rule, checked from the next
+// ingest on.
+func (h *Handlers) PostValidationRule(c *fiber.Ctx) error {
+	r, ok, err := h.validationRule(c, 0)
+	if !ok {
+		return err
+	}
+	r.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	r.UpdatedAt = r.CreatedAt
+	if r.ID, err = h.store.CreateValidationRule(c.UserContext(), r); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(r)
+}
+
+// PutValidationRule replaces a validation rule.
+func (h *Handlers) PutValidationRule(c *fiber.Ctx) error {
+	existing, err := h.loadValidationRule(c)
+	if existing == nil {
+		return err
+	}
+	r, ok, err := h.validationRule(c, existing.ID)
+	if !ok {
+		return err
+	}
+	r.CreatedAt = existing.CreatedAt
+	r.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := h.store.UpdateValidationRule(c.UserContext(), r); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "validation rule not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(r)
+}
+
+// DeleteValidationRule removes a validation rule.
+func (h *Handlers) DeleteValidationRule(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid validation rule id"})
+	}
+	if err := h.store.DeleteValidationRule(c.UserContext(), id); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "validation rule not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/runhours"
+)
+
+// engineHoursTotal sums an engine's running hours over the requested days.
+type engineHoursTotal struct {
+	EngineNo *int    `json:"engine_no"`
+	Hours    float64 `json:"hours"`
+	Days     int     `json:"days"`
+	// CounterHours is the engine's last counter reading in the range
+	CounterHours *float64 `json:"counter_hours"`
+}
+
+// GetVesselEngineRunningHours returns the running hours of the vessel's
+// engines per day, as derived at ingest, with their totals per engine.
+func (h *Handlers) GetVesselEngineRunningHours(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to := c.Query("from"), c.Query("to")
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse(runhours.DayLayout, day); day != "" && err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid day " + strconv.Quote(day) + ", use YYYY-MM-DD"})
+		}
+	}
+	var engineNo *int
+	if s := c.Query("engine_no"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid engine_no"})
+		}
+		engineNo = &n
+	}
+
+	items, err := h.store.RunningHours(c.UserContext(), vesselID, engineNo, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Items come by engine then day
+	totals := []engineHoursTotal{}
+	for _, item := range items {
+		if n := len(totals); n == 0 || !sameEngine(totals[n-1].EngineNo, item.EngineNo) {
+			totals = append(totals, engineHoursTotal{EngineNo: item.EngineNo})
+		}
+		t := &totals[len(totals)-1]
+		t.Hours += item.Hours
+		t.Days++
+		if item.CounterHours != nil {
+			t.CounterHours = item.CounterHours
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"totals":    totals,
+		"items":     items,
+	})
+}
+
+// sameEngine reports whether two engine numbers, nil when a sheet had none,
+// are the same.
+func sameEngine(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/fair"
+)
+
+// slotKey names the fiber local holding the *slot of a scheduled request.
+const slotKey = "fair_slot"
+
+// tenant identifies who a request counts against for fair scheduling: the
+// organization of its API key, else the key itself if it is configured,
+// else the client IP. Keys nobody configured count as their client's IP, so
+// a client cannot get a fresh share by sending a new key per request.
+func (h *Handlers) tenant(c *fiber.Ctx) string {
+	key := c.Get("X-API-Key")
+	if org, ok := h.apiKeyOrgs[key]; ok && key != "" {
+		return "org:" + org
+	}
+	if key != "" && h.knownKey(key) {
+		return "key:" + key
+	}
+	return "ip:" + c.IP()
+}
+
+// knownKey reports whether key is configured as an API key of any kind.
+func (h *Handlers) knownKey(key string) bool {
+	if _, ok := h.apiKeyClasses[key]; ok {
+		return true
+	}
+	if _, ok := h.kioskAPIKeys[key]; ok {
+		return true
+	}
+	for _, admin := range h.adminAPIKeys {
+		if key == admin {
+			return true
+		}
+	}
+	return false
+}
+
+// slot is a request's hold on a scheduler slot.
+type slot struct {
+	release  func()
+	once     sync.Once
+	streamed bool // released by the body stream writer instead
+}
+
+func (s *slot) free() { s.once.Do(s.release) }
+
+// schedule runs the rest of the chain in a slot of s shared fairly between
+// tenants. The slot is released when the handler returns, or for bodies
+// streamed with streamBody, once they are written.
+func (h *Handlers) schedule(s *fair.Scheduler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		release, err := s.Acquire(c.UserContext(), h.tenant(c))
+		switch {
+		case errors.Is(err, fair.ErrQueueFull):
+			return c.Status(429).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, fair.ErrWaitTimeout):
+			return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return c.Status(503).JSON(fiber.Map{"error": "request cancelled while waiting for a free slot"})
+		case err != nil:
+			return err
+		}
+		held := &slot{release: release}
+		c.Locals(slotKey, held)
+		err = c.Next()
+		if !held.streamed {
+			held.free()
+		}
+		return err
+	}
+}
+
+// streamBody makes write the response body, run after the handler returns.
+// The request's scheduler slot, if it has one, is held until write is done,
+// which fasthttp guarantees even when the client goes away.
+func streamBody(c *fiber.Ctx, write func(w *bufio.Writer)) {
+	held, _ := c.Locals(slotKey).(*slot)
+	if held != nil {
+		held.streamed = true
+	}
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if held != nil {
+			defer held.free()
+		}
+		write(w)
+	})
+}
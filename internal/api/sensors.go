@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outliers"
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetVesselSensors lists the vessel's sensors, registered as their readings
+// were ingested; stream=<name> keeps one stream's.
+func (h *Handlers) GetVesselSensors(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	stream := c.Query("stream")
+	if def, ok := store.Streams[stream]; stream != "" && (!ok || def.Unit == "") {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid stream, use one with units"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, true); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	sensors, err := h.store.Sensors(c.UserContext(), vesselID, stream)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     sensors,
+	})
+}
+
+// GetVesselSensor returns one sensor of the vessel.
+func (h *Handlers) GetVesselSensor(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	sensorID, err := strconv.ParseInt(c.Params("sensor_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid sensor id"})
+	}
+
+	sensor, err := h.store.Sensor(c.UserContext(), vesselID, sensorID)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "sensor not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(sensor)
+}
+
+// PutVesselSensor replaces a sensor's editable metadata: where it is on the
+// vessel and when it was installed. Its identity comes from the readings.
+func (h *Handlers) PutVesselSensor(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	sensorID, err := strconv.ParseInt(c.Params("sensor_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid sensor id"})
+	}
+
+	var body struct {
+		Location    *string `json:"location"`
+		InstalledOn *string `json:"installed_on"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	body.Location = trimmedOrNil(body.Location)
+	body.InstalledOn = trimmedOrNil(body.InstalledOn)
+	if body.InstalledOn != nil {
+		if _, err := time.Parse("2006-01-02", *body.InstalledOn); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid installed_on, use YYYY-MM-DD"})
+		}
+	}
+
+	sensor, err := h.store.Sensor(c.UserContext(), vesselID, sensorID)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "sensor not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sensor.Location, sensor.InstalledOn, sensor.UpdatedAt = body.Location, body.InstalledOn, &now
+	if err := h.store.UpdateSensor(c.UserContext(), vesselID, *sensor); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "sensor not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(sensor)
+}
+
+// PutVesselSensorFilters replaces the spike filters applied to a sensor's
+// readings from its next ingest on. Replaced values are kept as outliers.
+func (h *Handlers) PutVesselSensorFilters(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	sensorID, err := strconv.ParseInt(c.Params("sensor_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid sensor id"})
+	}
+
+	var body struct {
+		Filters []models.SensorFilter `json:"filters"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+
+	sensor, err := h.store.Sensor(c.UserContext(), vesselID, sensorID)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "sensor not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	stream := store.Streams[sensor.Stream]
+	filters := make([]models.SensorFilter, 0, len(body.Filters))
+	seen := make(map[string]bool)
+	for _, sf := range body.Filters {
+		if field, ok := stream.Field(sf.Field); !ok || field.Kind != store.FloatField || !stream.IsMetric(sf.Field) {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("%q is not a metric of %s", sf.Field, stream.Name)})
+		}
+		if seen[sf.Field] {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("more than one filter on %s", sf.Field)})
+		}
+		seen[sf.Field] = true
+		filter := outliers.Filter{Method: sf.Method, Window: sf.Window, Threshold: sf.Threshold, Low: sf.Low, High: sf.High}
+		if err := filter.Validate(); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("%s: %v", sf.Field, err)})
+		}
+		filters = append(filters, models.SensorFilter{
+			Field: sf.Field, Method: filter.Method, Window: filter.Window,
+			Threshold: filter.Threshold, Low: filter.Low, High: filter.High,
+		})
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := h.store.SetSensorFilters(c.UserContext(), vesselID, sensorID, filters, now); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "sensor not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	sensor.Filters, sensor.UpdatedAt = filters, &now
+	return c.JSON(sensor)
+}
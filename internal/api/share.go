@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/daily"
+	"vessel-telemetry-api/internal/signedurl"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/watermark"
+)
+
+// shareKey names the fiber local holding the *signedurl.Share of a request
+// made with a share token.
+const shareKey = "share"
+
+// defaultShareTTL is how long a share token stays valid without expires_in.
+const defaultShareTTL = 7 * 24 * time.Hour
+
+// PostShare signs a token granting read-only access to one vessel's
+// dashboard and track over a date range, e.g. a voyage shown to a customer
+// who has no API key.
+func (h *Handlers) PostShare(c *fiber.Ctx) error {
+	if len(h.signedURLSecrets) == 0 {
+		return c.Status(503).JSON(fiber.Map{"error": "signed URLs are not configured"})
+	}
+
+	var body struct {
+		VesselID  int64     `json:"vessel_id"`
+		From      time.Time `json:"from"`
+		To        time.Time `json:"to"`
+		ExpiresIn string    `json:"expires_in"`
+		Recipient string    `json:"recipient"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body, from and to are ISO 8601"})
+	}
+	if body.From.IsZero() || body.To.IsZero() || !body.To.After(body.From) {
+		return c.Status(400).JSON(fiber.Map{"error": "from and to are required, from before to"})
+	}
+	if len(body.Recipient) > 200 {
+		return c.Status(400).JSON(fiber.Map{"error": "recipient is limited to 200 characters"})
+	}
+	if _, err := h.store.GetVessel(c.UserContext(), body.VesselID); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ttl := defaultShareTTL
+	if body.ExpiresIn != "" {
+		var err error
+		if ttl, err = time.ParseDuration(body.ExpiresIn); err != nil || ttl <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid expires_in, use e.g. 72h"})
+		}
+	}
+	if h.signedURLMaxTTL > 0 && ttl > h.signedURLMaxTTL {
+		if body.ExpiresIn != "" {
+			return c.Status(400).JSON(fiber.Map{"error": "expires_in exceeds the maximum of " + h.signedURLMaxTTL.String()})
+		}
+		ttl = h.signedURLMaxTTL
+	}
+
+	share := signedurl.Share{
+		VesselID:  body.VesselID,
+		From:      body.From.UTC().Truncate(time.Second),
+		To:        body.To.UTC().Truncate(time.Second),
+		Signer:    watermark.Fingerprint(c.Get("X-API-Key")),
+		Recipient: body.Recipient,
+		Expires:   time.Now().Add(ttl).Truncate(time.Second).UTC(),
+	}
+	token := signedurl.SignShare(h.signedURLSecrets[0], share)
+	return c.Status(201).JSON(fiber.Map{
+		"token":      token,
+		"url":        c.BaseURL() + "/share/" + token,
+		"vessel_id":  share.VesselID,
+		"from":       share.From,
+		"to":         share.To,
+		"signer":     share.Signer,
+		"recipient":  share.Recipient,
+		"expires_at": share.Expires,
+	})
+}
+
+// verifyShare checks the token in the path and refuses tampered (403) or
+// expired (410) ones.
+func (h *Handlers) verifyShare(c *fiber.Ctx) error {
+	share, err := signedurl.VerifyShare(h.signedURLSecrets, c.Params("token"), time.Now())
+	if errors.Is(err, signedurl.ErrExpired) {
+		return c.Status(410).JSON(fiber.Map{"error": "share link expired"})
+	} else if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "invalid share token"})
+	}
+	c.Locals(shareKey, share)
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Next()
+}
+
+// sharedRange returns the share of the request and the part of its range up
+// to now.
+func sharedRange(c *fiber.Ctx) (*signedurl.Share, time.Time, time.Time) {
+	share := c.Locals(shareKey).(*signedurl.Share)
+	to := share.To
+	if now := time.Now().UTC(); now.Before(to) {
+		to = now
+	}
+	return share, share.From, to
+}
+
+// sharedStream is one stream of the shared dashboard.
+type sharedStream struct {
+	Stream     string            `json:"stream"`
+	Aggregates []store.UnitStats `json:"aggregates"`
+}
+
+// GetShare returns the shared dashboard: the vessel, its last position and
+// daily summaries in the range, and each unit's metrics over it.
+func (h *Handlers) GetShare(c *fiber.Ctx) error {
+	share, from, to := sharedRange(c)
+	vessel, err := h.store.GetVessel(c.UserContext(), share.VesselID)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var position fiber.Map
+	fixes, err := h.store.Positions(c.UserContext(), vessel.ID, &from, &to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(fixes) > 0 {
+		last := fixes[len(fixes)-1]
+		position = fiber.Map{"ts": last.Timestamp, "latitude": last.Latitude, "longitude": last.Longitude, "speed_knots": last.Speed}
+	}
+
+	days, err := h.store.DailySummaries(c.UserContext(), vessel.ID, from.Format(daily.DayLayout), to.Format(daily.DayLayout))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	streams := []sharedStream{}
+	for _, name := range store.StreamOrder {
+		aggregates, err := h.store.AggregateUnits(c.UserContext(), store.Streams[name], vessel.ID, &from, &to)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if len(aggregates) > 0 {
+			streams = append(streams, sharedStream{Stream: name, Aggregates: aggregates})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel": fiber.Map{
+			"id":   vessel.ID,
+			"name": vessel.Name,
+			"imo":  vessel.IMO,
+			"flag": vessel.Flag,
+			"type": vessel.Type,
+		},
+		"from":            from,
+		"to":              to,
+		"expires_at":      share.Expires,
+		"recipient":       share.Recipient,
+		"latest_position": position,
+		"days":            days,
+		"streams":         streams,
+	})
+}
+
+// GetShareTrack returns the shared vessel's track over the range as
+// /vessels/:id/track does.
+func (h *Handlers) GetShareTrack(c *fiber.Ctx) error {
+	share, from, to := sharedRange(c)
+	tolerance := c.QueryFloat("tolerance", 0)
+	if tolerance < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "tolerance must not be negative"})
+	}
+	fixes, err := h.store.Positions(c.UserContext(), share.VesselID, &from, &to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(trackFeature(share.VesselID, fixes, tolerance))
+}
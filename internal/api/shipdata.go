@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/shipdata"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/util"
+)
+
+// PostIngestISO19848 ingests an ISO 19848 ship data package sent as the
+// JSON body. The vessel is that of the IMO number in the package's ShipID
+// unless imo is given; the other ingest parameters apply as to spreadsheets.
+func (h *Handlers) PostIngestISO19848(c *fiber.Ctx) error {
+	params, err := parseIngestOptions(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	body := c.Body()
+	pkg, err := shipdata.Parse(body)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if params.IMO == "" && pkg.IMO() == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "the package's ShipID has no IMO number, 'imo' parameter is required"})
+	}
+	filename := c.Query("filename", "iso19848.json")
+	c.Locals(auditDetailKey, map[string]interface{}{"filename": filename, "file_sha256": util.SHA256Hex(body), "ship_id": pkg.Package.Header.ShipID})
+
+	response, err := h.processor.ProcessShipData(c.UserContext(), body, pkg, filename, params.IMO, params.VesselName, params.Mode, params.Source)
+	return h.sendIngestResponse(c, response, err)
+}
+
+// GetVesselDataChannels lists the data channel mappings ship data packages
+// of the vessel are read with: its own, then those of the bundled catalog
+// it does not override.
+func (h *Handlers) GetVesselDataChannels(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	mappings, err := h.store.DataChannelMappings(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	catalog, err := shipdata.Catalog()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	own := make(map[string]bool, len(mappings))
+	for _, m := range mappings {
+		own[strings.ToLower(shipdata.LocalID(m.ChannelID))] = true
+	}
+	for _, m := range catalog {
+		if !own[strings.ToLower(shipdata.LocalID(m.ChannelID))] {
+			mappings = append(mappings, models.DataChannelMapping{ChannelID: m.ChannelID, Stream: m.Stream, Field: m.Field, Unit: m.Unit, Source: "catalog"})
+		}
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     mappings,
+	})
+}
+
+// PutVesselDataChannel maps a data channel of the vessel to a stream field,
+// replacing its mapping or the catalog's. Channels of streams with units
+// name the engine, tank, generator etc. as unit.
+func (h *Handlers) PutVesselDataChannel(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+
+	var m models.DataChannelMapping
+	if err := json.Unmarshal(c.Body(), &m); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	m.ChannelID = shipdata.LocalID(m.ChannelID)
+	if m.ChannelID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "channel_id is required"})
+	}
+	m.Stream, m.Field = strings.TrimSpace(m.Stream), strings.TrimSpace(m.Field)
+	m.Unit = trimmedOrNil(m.Unit)
+
+	var fields []string
+	unit := ""
+	if m.Stream == shipdata.Location {
+		fields = shipdata.LocationFields
+	} else if streamFields, found := ingest.SheetFields(m.Stream); found {
+		unit = store.Streams[m.Stream].Unit
+		for _, f := range streamFields {
+			if f != "ts" && f != unit {
+				fields = append(fields, f)
+			}
+		}
+	} else {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown stream " + m.Stream + ", use " + shipdata.Location + " or one of " + strings.Join(ingest.SheetStreams(), ", ")})
+	}
+	known := false
+	for _, f := range fields {
+		known = known || f == m.Field
+	}
+	if !known {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown " + m.Stream + " field " + m.Field + ", use one of " + strings.Join(fields, ", ")})
+	}
+	switch {
+	case unit != "" && m.Unit == nil:
+		return c.Status(400).JSON(fiber.Map{"error": "unit is required for " + m.Stream + " channels (the " + unit + ")"})
+	case unit == "" && m.Unit != nil:
+		return c.Status(400).JSON(fiber.Map{"error": m.Stream + " channels have no unit"})
+	case unit != "":
+		if _, err := strconv.Atoi(*m.Unit); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "unit must be a number"})
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	m.UpdatedAt, m.Source = &now, "vessel"
+	created, err := h.store.PutDataChannelMapping(c.UserContext(), vesselID, m)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if created {
+		return c.Status(201).JSON(m)
+	}
+	return c.JSON(m)
+}
+
+// DeleteVesselDataChannel removes the vessel's mapping of the channel_id
+// channel; the catalog's, if any, applies again.
+func (h *Handlers) DeleteVesselDataChannel(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	channelID := shipdata.LocalID(c.Query("channel_id"))
+	if channelID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "channel_id is required"})
+	}
+	err = h.store.DeleteDataChannelMapping(c.UserContext(), vesselID, channelID)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "data channel mapping not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// GetVesselChannels lists the data channels the vessel has generic readings
+// of, with their count and time span.
+func (h *Handlers) GetVesselChannels(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	channels, err := h.store.ChannelSummaries(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     channels,
+	})
+}
+
+// GetVesselChannelReadings lists the vessel's readings of the channel_id
+// channel, oldest first.
+func (h *Handlers) GetVesselChannelReadings(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	channelID := shipdata.LocalID(c.Query("channel_id"))
+	if channelID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "channel_id is required"})
+	}
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	limits := h.limitsFor(c)
+	f := store.ChannelReadingFilter{VesselID: vesselID, ChannelID: channelID, From: from, To: to, Limit: limits.Default}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= limits.Max {
+		f.Limit = l
+	}
+
+	readings, err := h.store.ChannelReadings(c.UserContext(), f)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id":  vesselID,
+		"channel_id": channelID,
+		"items":      readings,
+	})
+}
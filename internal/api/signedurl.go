@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/signedurl"
+	"vessel-telemetry-api/internal/watermark"
+)
+
+// signedLinkKey names the fiber local holding the *signedurl.Link of a
+// request made through a signed link.
+const signedLinkKey = "signed_link"
+
+// defaultSignedURLTTL is how long a link stays valid without expires_in.
+const defaultSignedURLTTL = 24 * time.Hour
+
+// signablePaths are the downloads a signed link may point at; the first
+// group is the vessel ID.
+var signablePaths = []*regexp.Regexp{
+	regexp.MustCompile(`^/vessels/(\d+)/export$`),
+	regexp.MustCompile(`^/vessels/(\d+)/generators/report$`),
+	regexp.MustCompile(`^/vessels/(\d+)/report$`),
+}
+
+// signedLink returns the link a request was made through, nil without one.
+func signedLink(c *fiber.Ctx) *signedurl.Link {
+	link, _ := c.Locals(signedLinkKey).(*signedurl.Link)
+	return link
+}
+
+// verifySignedURL checks the signature of requests carrying one and refuses
+// tampered (403) or expired (410) links. Requests without a signature pass.
+func (h *Handlers) verifySignedURL(c *fiber.Ctx) error {
+	query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil || !signedurl.Signed(query) {
+		return c.Next()
+	}
+	link, err := signedurl.Verify(h.signedURLSecrets, c.Method(), c.Path(), query, time.Now())
+	if errors.Is(err, signedurl.ErrExpired) {
+		return c.Status(410).JSON(fiber.Map{"error": "link expired"})
+	} else if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "invalid link signature"})
+	}
+	c.Locals(signedLinkKey, link)
+	// Shared links should not end up in caches on the way
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.Next()
+}
+
+// PostSignedURL signs a time-limited link to a download (export or
+// report) that works without an API key.
+func (h *Handlers) PostSignedURL(c *fiber.Ctx) error {
+	if len(h.signedURLSecrets) == 0 {
+		return c.Status(503).JSON(fiber.Map{"error": "signed URLs are not configured"})
+	}
+
+	var body struct {
+		URL       string `json:"url"`
+		ExpiresIn string `json:"expires_in"`
+		Recipient string `json:"recipient"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	target, err := url.Parse(body.URL)
+	if err != nil || body.URL == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid url"})
+	}
+	var vesselID int64
+	for _, re := range signablePaths {
+		if m := re.FindStringSubmatch(target.Path); m != nil {
+			vesselID, _ = strconv.ParseInt(m[1], 10, 64)
+			break
+		}
+	}
+	if vesselID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "url is not a download that can be signed"})
+	}
+	if len(body.Recipient) > 200 {
+		return c.Status(400).JSON(fiber.Map{"error": "recipient is limited to 200 characters"})
+	}
+
+	ttl := defaultSignedURLTTL
+	if body.ExpiresIn != "" {
+		if ttl, err = time.ParseDuration(body.ExpiresIn); err != nil || ttl <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid expires_in, use e.g. 24h"})
+		}
+	}
+	if h.signedURLMaxTTL > 0 && ttl > h.signedURLMaxTTL {
+		return c.Status(400).JSON(fiber.Map{"error": "expires_in exceeds the maximum of " + h.signedURLMaxTTL.String()})
+	}
+
+	link := signedurl.Link{
+		Signer:    watermark.Fingerprint(c.Get("X-API-Key")),
+		Recipient: body.Recipient,
+		Expires:   time.Now().Add(ttl).Truncate(time.Second).UTC(),
+	}
+	path := target.Path + "?" + signedurl.Sign(h.signedURLSecrets[0], fiber.MethodGet, target.Path, target.Query(), link)
+	return c.Status(201).JSON(fiber.Map{
+		"vessel_id":  vesselID,
+		"url":        c.BaseURL() + path,
+		"path":       path,
+		"signer":     link.Signer,
+		"recipient":  link.Recipient,
+		"expires_at": link.Expires,
+	})
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/objectstore"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/util"
+)
+
+// snapshotTypes are the sniffed image types accepted as snapshot uploads, with
+// the extension of their object key.
+var snapshotTypes = map[string]string{"image/jpeg": "jpg", "image/png": "png", "image/webp": "webp"}
+
+type snapshotResponse struct {
+	*models.CCTVSnapshot
+	ImageURL *string `json:"image_url"` // download path of an uploaded image
+}
+
+func newSnapshotResponse(vesselID int64, s *models.CCTVSnapshot) snapshotResponse {
+	resp := snapshotResponse{CCTVSnapshot: s}
+	if s.ObjectKey != nil {
+		path := fmt.Sprintf("/vessels/%d/cctv/snapshots/%d/image", vesselID, s.ID)
+		resp.ImageURL = &path
+	}
+	return resp
+}
+
+// snapshotKeySegment makes a camera id safe for an object key.
+func snapshotKeySegment(camID string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, camID)
+}
+
+// PostCCTVSnapshot records a snapshot of a camera from a multipart form: an
+// image file (stored in the object store), a url reference, or both. ts
+// defaults to now; the snapshot is linked to the camera's status reading at
+// ts, whether that is ingested before or after.
+func (h *Handlers) PostCCTVSnapshot(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	camID := strings.TrimSpace(c.Params("cam_id"))
+	if camID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid camera id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, false); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	snapshot := models.CCTVSnapshot{CamID: camID, TS: time.Now().UTC().Truncate(time.Second)}
+	if v := c.FormValue("ts"); v != "" {
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid ts, use RFC 3339"})
+		}
+		snapshot.TS = ts.UTC()
+	}
+	if v := c.FormValue("url"); v != "" {
+		snapshotURL, err := ingest.ParseSnapshotURL(v)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		snapshot.URL = &snapshotURL
+	}
+
+	detail := map[string]interface{}{"cam_id": camID}
+	if file, err := c.FormFile("image"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to open image"})
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to read image"})
+		}
+
+		contentType := http.DetectContentType(data)
+		ext, ok := snapshotTypes[contentType]
+		if !ok {
+			return c.Status(415).JSON(fiber.Map{"error": "image must be a JPEG, PNG or WebP file"})
+		}
+		sum := util.SHA256Hex(data)
+		key := fmt.Sprintf("snapshots/%d/%s/%s-%s.%s", vesselID, snapshotKeySegment(camID), snapshot.TS.Format("20060102T150405Z"), sum[:12], ext)
+		if err := h.objects.Put(c.UserContext(), key, data); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		size := int64(len(data))
+		snapshot.ObjectKey, snapshot.ContentType, snapshot.SizeBytes = &key, &contentType, &size
+		detail["image_sha256"] = sum
+	}
+	if snapshot.URL == nil && snapshot.ObjectKey == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "image or url is required"})
+	}
+	c.Locals(auditDetailKey, detail)
+
+	id, err := h.store.PutCCTVSnapshot(c.UserContext(), vesselID, snapshot)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	saved, err := h.store.CCTVSnapshot(c.UserContext(), vesselID, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(newSnapshotResponse(vesselID, saved))
+}
+
+// GetLatestCCTVSnapshot returns a camera's newest snapshot with the status
+// reading it belongs to, for the security dashboard.
+func (h *Handlers) GetLatestCCTVSnapshot(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	snapshot, err := h.store.LatestCCTVSnapshot(c.UserContext(), vesselID, strings.TrimSpace(c.Params("cam_id")))
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "no snapshot of this camera"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(newSnapshotResponse(vesselID, snapshot))
+}
+
+// GetCCTVSnapshotImage sends an uploaded snapshot image.
+func (h *Handlers) GetCCTVSnapshotImage(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	snapshotID, err := strconv.ParseInt(c.Params("snapshot_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid snapshot id"})
+	}
+
+	snapshot, err := h.store.CCTVSnapshot(c.UserContext(), vesselID, snapshotID)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "snapshot not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if snapshot.ObjectKey == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "snapshot has no uploaded image"})
+	}
+
+	data, err := h.objects.Get(c.UserContext(), *snapshot.ObjectKey)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "snapshot image is missing from the object store"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if snapshot.ContentType != nil {
+		c.Set(fiber.HeaderContentType, *snapshot.ContentType)
+	}
+	return c.Send(data)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/snmp"
+	"vessel-telemetry-api/internal/store"
+)
+
+// snmpDeviceBody is the body of POST and PUT /vessels/:id/snmp-devices.
+type snmpDeviceBody struct {
+	Name      string  `json:"name"`
+	Kind      string  `json:"kind"`
+	Address   string  `json:"address"`
+	Version   string  `json:"version"`
+	Community *string `json:"community"`
+	StatusOID *string `json:"status_oid"`
+}
+
+// snmpDevice reads and checks a device from the request body, answering
+// the request itself on errors. existing is the device replaced, nil for a
+// new one. A missing version means 2c, and a missing community public, or
+// that of the device replaced.
+func (h *Handlers) snmpDevice(c *fiber.Ctx, vesselID int64, existing *models.SNMPDevice) (models.SNMPDevice, bool, error) {
+	var body snmpDeviceBody
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return models.SNMPDevice{}, false, c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	d := models.SNMPDevice{
+		VesselID:  vesselID,
+		Name:      strings.TrimSpace(body.Name),
+		Kind:      strings.ToLower(strings.TrimSpace(body.Kind)),
+		Address:   strings.TrimSpace(body.Address),
+		Version:   strings.ToLower(strings.TrimSpace(body.Version)),
+		Community: "public",
+		StatusOID: trimmedOrNil(body.StatusOID),
+	}
+	if existing != nil {
+		d.ID, d.Community = existing.ID, existing.Community
+	}
+	fail := func(msg string) (models.SNMPDevice, bool, error) {
+		return d, false, c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	if d.Name == "" {
+		return fail("name is required, the cam_id or device_id of the device's readings")
+	}
+	known := false
+	for _, k := range snmp.Kinds {
+		known = known || k == d.Kind
+	}
+	if !known {
+		return fail("invalid kind, use one of " + strings.Join(snmp.Kinds, ", "))
+	}
+	if host, port, err := net.SplitHostPort(d.Address); err == nil {
+		if n, err := strconv.Atoi(port); host == "" || err != nil || n <= 0 || n > 65535 {
+			return fail("address must be the host or host:port of the SNMP agent")
+		}
+	} else if d.Address == "" || strings.ContainsAny(d.Address, " /") {
+		return fail("address must be the host or host:port of the SNMP agent")
+	}
+	if d.Version == "" {
+		d.Version = snmp.Version2c
+	}
+	if d.Version != snmp.Version1 && d.Version != snmp.Version2c {
+		return fail("invalid version, use 1 or 2c")
+	}
+	if body.Community != nil {
+		if *body.Community == "" {
+			return fail("community must not be empty")
+		}
+		d.Community = *body.Community
+	}
+	if d.StatusOID != nil {
+		oid := strings.TrimPrefix(*d.StatusOID, ".")
+		if !snmp.ValidOID(oid) {
+			return fail("status_oid must be a dotted OID, e.g. 1.3.6.1.4.1.9.9.1.0")
+		}
+		d.StatusOID = &oid
+	}
+
+	devices, err := h.store.SNMPDevices(c.UserContext(), vesselID)
+	if err != nil {
+		return d, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, other := range devices {
+		if other.ID != d.ID && strings.EqualFold(other.Name, d.Name) {
+			return d, false, c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("snmp device %d is already named %s", other.ID, other.Name)})
+		}
+	}
+	if snmp.Stream(d.Kind) == "cctv" {
+		cameras, err := h.store.ONVIFCameras(c.UserContext(), vesselID)
+		if err != nil {
+			return d, false, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		for _, cam := range cameras {
+			if strings.EqualFold(cam.CamID, d.Name) {
+				return d, false, c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("onvif camera %d already reports %s", cam.ID, cam.CamID)})
+			}
+		}
+	}
+	return d, true, nil
+}
+
+// GetVesselSNMPDevices lists the SNMP devices polled for the vessel, with
+// the outcome of their latest poll. Communities are not shown.
+func (h *Handlers) GetVesselSNMPDevices(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	devices, err := h.store.SNMPDevices(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     devices,
+	})
+}
+
+// PostVesselSNMPDevice adds a device to poll over SNMP for the vessel.
+func (h *Handlers) PostVesselSNMPDevice(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	d, ok, err := h.snmpDevice(c, vesselID, nil)
+	if !ok {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	d.CreatedAt, d.UpdatedAt = now, now
+	if d.ID, err = h.store.CreateSNMPDevice(c.UserContext(), d); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(d)
+}
+
+// PutVesselSNMPDevice replaces an SNMP device of the vessel.
+func (h *Handlers) PutVesselSNMPDevice(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	existing, err := h.loadSNMPDevice(c, vesselID)
+	if existing == nil {
+		return err
+	}
+	d, ok, err := h.snmpDevice(c, vesselID, existing)
+	if !ok {
+		return err
+	}
+	d.CreatedAt, d.UpdatedAt = existing.CreatedAt, time.Now().UTC().Truncate(time.Second)
+	if err := h.store.UpdateSNMPDevice(c.UserContext(), d); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "snmp device not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(d)
+}
+
+// DeleteVesselSNMPDevice stops polling an SNMP device. Its readings are
+// kept.
+func (h *Handlers) DeleteVesselSNMPDevice(c *fiber.Ctx) error {
+	vesselID, ok, err := h.visibleVessel(c)
+	if !ok {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Params("device_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid snmp device id"})
+	}
+	if err := h.store.DeleteSNMPDevice(c.UserContext(), vesselID, id); errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "snmp device not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// loadSNMPDevice loads the vessel's device whose ID is in the path,
+// answering the request itself on errors.
+func (h *Handlers) loadSNMPDevice(c *fiber.Ctx, vesselID int64) (*models.SNMPDevice, error) {
+	id, err := strconv.ParseInt(c.Params("device_id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "invalid snmp device id"})
+	}
+	d, err := h.store.SNMPDevice(c.UserContext(), vesselID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "snmp device not found"})
+	} else if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return d, nil
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// parseSources reads source=<source,...> (only these) and
+// exclude_source=<source,...> (all but these). Besides the reading sources,
+// ais selects the synced positions from the AIS provider.
+func parseSources(c *fiber.Ctx) (store.SourceFilter, error) {
+	var f store.SourceFilter
+	var err error
+	if f.Only, err = parseSourceList(c.Query("source")); err != nil {
+		return f, err
+	}
+	if f.Exclude, err = parseSourceList(c.Query("exclude_source")); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// parseSourceList parses a comma-separated list of reading sources.
+func parseSourceList(list string) ([]string, error) {
+	var sources []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s == "" {
+			continue
+		}
+		if !validSource(s) {
+			return nil, fmt.Errorf("invalid source %q, use %s or %s", s, strings.Join(models.ReadingSources, ", "), models.SourceAIS)
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+func validSource(s string) bool {
+	if s == models.SourceAIS {
+		return true
+	}
+	for _, source := range models.ReadingSources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
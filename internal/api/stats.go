@@ -0,0 +1,65 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+type streamStats struct {
+	Stream       string     `json:"stream"`
+	Rows         int64      `json:"rows"`
+	Earliest     *time.Time `json:"earliest"`
+	Latest       *time.Time `json:"latest"`
+	Units        *int64     `json:"units"` // null for streams without units
+	LastUploadAt *time.Time `json:"last_upload_at"`
+}
+
+// GetVesselStats summarises each stream of a vessel: row count, time span,
+// distinct units and when data last arrived.
+func (h *Handlers) GetVesselStats(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	streams, err := parseStreamList(c.Query("stream"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items := make([]streamStats, 0, len(streams))
+	for _, name := range streams {
+		def := store.Streams[name]
+		summary, err := h.store.SummarizeStream(c.UserContext(), def, vesselID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		stats := streamStats{
+			Stream:       name,
+			Rows:         summary.Rows,
+			Earliest:     summary.Earliest,
+			Latest:       summary.Latest,
+			LastUploadAt: summary.LastIngestedAt,
+		}
+		if def.Unit != "" {
+			stats.Units = &summary.Units
+		}
+		items = append(items, stats)
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     items,
+	})
+}
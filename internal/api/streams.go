@@ -0,0 +1,69 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// streamDefinition describes a built-in stream in the terms of custom stream
+// columns, so clients read both alike.
+func streamDefinition(def *store.Stream) fiber.Map {
+	columns := make([]fiber.Map, len(def.Fields))
+	for i, f := range def.Fields {
+		kind := models.CustomText
+		switch f.Kind {
+		case store.IntField:
+			kind = models.CustomInt
+		case store.FloatField:
+			kind = models.CustomFloat
+		}
+		columns[i] = fiber.Map{"name": f.Name, "type": kind}
+	}
+	var unit, kind interface{}
+	if def.Unit != "" {
+		unit, kind = def.Unit, def.Kind
+	}
+	return fiber.Map{
+		"name":        def.Name,
+		"unit_column": unit,
+		"unit_kind":   kind,
+		"columns":     columns,
+		"uncertain":   def.Uncertain,
+	}
+}
+
+// GetStreams lists the built-in stream definitions; custom streams are
+// listed at /streams/custom.
+func (h *Handlers) GetStreams(c *fiber.Ctx) error {
+	items := make([]fiber.Map, len(store.StreamOrder))
+	for i, name := range store.StreamOrder {
+		items[i] = streamDefinition(store.Streams[name])
+	}
+	if !wantsHAL(c) {
+		return c.JSON(fiber.Map{"items": items})
+	}
+	for _, item := range items {
+		item["_links"] = halLinks{"self": streamLink(item["name"].(string))}
+	}
+	return sendHAL(c, fiber.Map{"items": items}, halLinks{
+		"self":   {Href: "/streams"},
+		"custom": {Href: "/streams/custom", Title: "Custom stream definitions"},
+	})
+}
+
+// GetStream returns one built-in stream definition.
+func (h *Handlers) GetStream(c *fiber.Ctx) error {
+	def, ok := store.Streams[c.Params("name")]
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "stream not found"})
+	}
+	if !wantsHAL(c) {
+		return c.JSON(streamDefinition(def))
+	}
+	return sendHAL(c, streamDefinition(def), halLinks{
+		"self":       streamLink(def.Name),
+		"collection": {Href: "/streams"},
+	})
+}
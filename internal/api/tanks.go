@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/reference"
+	"vessel-telemetry-api/internal/store"
+)
+
+// GetVesselTanks lists the vessel's registered fuel tanks.
+func (h *Handlers) GetVesselTanks(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, true); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	tanks, err := h.store.Tanks(c.UserContext(), vesselID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     tanks,
+	})
+}
+
+// PutVesselTank registers or replaces a tank; the tank number comes from the
+// path. The fuel type must be an emission-factors code.
+func (h *Handlers) PutVesselTank(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	tankNo, err := strconv.Atoi(c.Params("tank_no"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid tank number"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, true); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	var tank models.Tank
+	if err := json.Unmarshal(c.Body(), &tank); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	if tank.TankNo != 0 && tank.TankNo != tankNo {
+		return c.Status(400).JSON(fiber.Map{"error": "tank_no in body does not match the path"})
+	}
+	tank.TankNo = tankNo
+	if tank.CapacityLiters <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "capacity_liters must be a positive number"})
+	}
+	if tank.Name != nil {
+		if name := strings.TrimSpace(*tank.Name); name != "" {
+			tank.Name = &name
+		} else {
+			tank.Name = nil
+		}
+	}
+	if tank.FuelType != nil {
+		code := reference.NormalizeCode(*tank.FuelType)
+		if _, err := h.store.GetReference(c.UserContext(), reference.KindEmissionFactors, code); errors.Is(err, store.ErrNotFound) {
+			return c.Status(400).JSON(fiber.Map{"error": "unknown fuel_type " + code + ", see /reference/" + reference.KindEmissionFactors})
+		} else if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		tank.FuelType = &code
+	}
+
+	tank.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	created, err := h.store.PutTank(c.UserContext(), vesselID, tank)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if created {
+		return c.Status(201).JSON(tank)
+	}
+	return c.JSON(tank)
+}
+
+// DeleteVesselTank removes a tank from the registry; its readings are kept.
+func (h *Handlers) DeleteVesselTank(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+	tankNo, err := strconv.Atoi(c.Params("tank_no"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid tank number"})
+	}
+
+	err = h.store.DeleteTank(c.UserContext(), vesselID, tankNo)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "tank not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+// telemetryCSV is the media type of telemetry pages as delimited rows.
+const telemetryCSV = "text/csv"
+
+// wantsTelemetryCSV reports whether a telemetry page is asked for as CSV,
+// with format=csv or, without format, an Accept header preferring text/csv.
+func wantsTelemetryCSV(c *fiber.Ctx) (bool, error) {
+	switch c.Query("format") {
+	case "csv":
+		return true, nil
+	case "json":
+		return false, nil
+	case "":
+		return c.Accepts(fiber.MIMEApplicationJSON, halMIME, telemetryCSV) == telemetryCSV, nil
+	}
+	return false, errors.New("invalid format, use json or csv")
+}
+
+// sendTelemetryCSV sends up to limit rows in the columns of the CSV export,
+// or those of fields if not nil. The query must request limit+1 rows; the
+// URL of the next page, if any, is in the Link header. The page is bounded
+// by the page limits, so it is rendered before sending, as the header comes
+// first.
+func sendTelemetryCSV(c *fiber.Ctx, rows store.Rows, def *store.Stream, fields []string, limit int, next Cursor) error {
+	defer rows.Close()
+
+	columns := fields
+	if columns == nil {
+		columns = append([]string{"id", "ts"}, def.FieldNames()...)
+		columns = append(columns, "extra_json")
+	}
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(columns)
+
+	count := 0
+	for count < limit && rows.Next() {
+		item, err := def.ScanReading(rows)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			v, _ := item.Get(column)
+			if extra, ok := v.(json.RawMessage); ok {
+				record[i] = canonicalJSON(extra)
+			} else {
+				record[i] = formatExportValue(v)
+			}
+		}
+		w.Write(record)
+
+		count++
+		next.TS, next.ID = item.Timestamp, item.ID
+		if next.Sort != "" {
+			next.Key = fmt.Sprint(def.UnitSortKey(item.Values[0]))
+		}
+	}
+	if count == limit && rows.Next() {
+		if link, ok := selfLinks(c.OriginalURL(), next.Encode())["next"]; ok {
+			c.Set(fiber.HeaderLink, fmt.Sprintf(`<%s>; rel="next"`, link.Href))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	return c.Send(b.Bytes())
+}
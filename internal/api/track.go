@@ -0,0 +1,71 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/track"
+)
+
+// GetVesselTrack returns the vessel's positions as a GeoJSON LineString
+// feature. tolerance (metres) simplifies the line with Douglas-Peucker so long
+// ranges stay small enough to draw.
+func (h *Handlers) GetVesselTrack(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tolerance := c.QueryFloat("tolerance", 0)
+	if tolerance < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "tolerance must not be negative"})
+	}
+
+	fixes, err := h.store.Positions(c.UserContext(), vesselID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(trackFeature(vesselID, fixes, tolerance))
+}
+
+// trackFeature simplifies a track to tolerance metres as a GeoJSON
+// LineString feature, with the time of each point.
+func trackFeature(vesselID int64, fixes []ports.Fix, tolerance float64) fiber.Map {
+	simplified := track.Simplify(fixes, tolerance)
+
+	coordinates := make([][2]float64, len(simplified))
+	times := make([]time.Time, len(simplified))
+	for i, fix := range simplified {
+		coordinates[i] = [2]float64{fix.Longitude, fix.Latitude}
+		times[i] = fix.Timestamp
+	}
+
+	return fiber.Map{
+		"type": "Feature",
+		"geometry": fiber.Map{
+			"type":        "LineString",
+			"coordinates": coordinates,
+		},
+		"properties": fiber.Map{
+			"vessel_id":     vesselID,
+			"tolerance_m":   tolerance,
+			"source_points": len(fixes),
+			"points":        len(simplified),
+			"times":         times,
+		},
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/utilization"
+)
+
+// maxUtilizationMonths bounds the months of one utilization report.
+const maxUtilizationMonths = 36
+
+// vesselUtilization is one vessel's row of the fleet utilization report.
+type vesselUtilization struct {
+	VesselID int64               `json:"vessel_id"`
+	Name     string              `json:"name"`
+	IMO      *string             `json:"imo"`
+	Months   []utilization.Month `json:"months"`
+}
+
+// GetUtilization reports engine run hours, time underway and time in port
+// per vessel per month, for one fleet or all vessels. from defaults to the
+// start of the month eleven months ago and to to now, so twelve months.
+func (h *Handlers) GetUtilization(c *fiber.Ctx) error {
+	fromParam, toParam, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	to := time.Now().UTC()
+	if toParam != nil {
+		to = toParam.UTC()
+	}
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -11, 0)
+	if fromParam != nil {
+		from = fromParam.UTC()
+	}
+	if !from.Before(to) {
+		return c.Status(400).JSON(fiber.Map{"error": "from must be before to"})
+	}
+	if len(utilization.Months(from, to)) > maxUtilizationMonths {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("at most %d months can be reported at once", maxUtilizationMonths)})
+	}
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid format, use json or csv"})
+	}
+
+	opts := utilization.DefaultOptions
+	opts.UnderwayKnots = c.QueryFloat("max_speed", defaultPortMaxSpeed)
+	if opts.UnderwayKnots < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "max_speed must not be negative"})
+	}
+
+	fleet := strings.TrimSpace(c.Query("fleet"))
+	vessels, err := h.store.ListVessels(c.UserContext(), store.VesselFilter{Fleet: fleet, IncludeArchived: c.QueryBool("include_archived")})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	index, err := h.store.ListPorts(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items := make([]vesselUtilization, 0, len(vessels))
+	for _, vessel := range vessels {
+		engines, err := h.store.EngineRPMs(c.UserContext(), vessel.ID, &from, &to)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		fixes, err := h.store.Positions(c.UserContext(), vessel.ID, &from, &to)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		calls := ports.DetectCalls(fixes, index, opts.UnderwayKnots)
+		items = append(items, vesselUtilization{
+			VesselID: vessel.ID,
+			Name:     vessel.Name,
+			IMO:      vessel.IMO,
+			Months:   utilization.Build(from, to, engines, fixes, calls, opts),
+		})
+	}
+
+	if format == "csv" {
+		return writeUtilizationCSV(c, items)
+	}
+	return c.JSON(fiber.Map{
+		"fleet": fleet,
+		"from":  from,
+		"to":    to,
+		"items": items,
+	})
+}
+
+// writeUtilizationCSV sends one row per vessel and month, the layout the
+// chartering spreadsheets use.
+func writeUtilizationCSV(c *fiber.Ctx, items []vesselUtilization) error {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write([]string{"vessel_id", "name", "imo", "month", "period_hours", "engine_hours", "underway_hours", "port_hours", "underway_percent", "port_percent"})
+	number := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, item := range items {
+		imo := ""
+		if item.IMO != nil {
+			imo = *item.IMO
+		}
+		for _, m := range item.Months {
+			w.Write([]string{
+				strconv.FormatInt(item.VesselID, 10), item.Name, imo, m.Month,
+				number(m.PeriodHours), number(m.EngineHours), number(m.UnderwayHours), number(m.PortHours),
+				number(m.UnderwayPercent), number(m.PortPercent),
+			})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	return c.SendString(b.String())
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+// parseVesselFilter reads the GET /vessels search, filter and sort
+// parameters. Archived (decommissioned) vessels are hidden unless explicitly
+// requested.
+func parseVesselFilter(c *fiber.Ctx) (store.VesselFilter, error) {
+	f := store.VesselFilter{
+		IncludeArchived: c.QueryBool("include_archived"),
+		Name:            strings.TrimSpace(c.Query("q")),
+		IMO:             strings.TrimSpace(c.Query("imo")),
+		Flag:            strings.TrimSpace(c.Query("flag")),
+		Type:            strings.TrimSpace(c.Query("type")),
+		Fleet:           strings.TrimSpace(c.Query("fleet")),
+		Sort:            c.Query("sort", "name"),
+	}
+
+	if s := c.Query("has_data_since"); s != "" {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return f, fmt.Errorf("invalid has_data_since format, use ISO 8601")
+		}
+		f.DataSince = &ts
+	}
+
+	if _, ok := store.VesselSorts[f.Sort]; !ok {
+		keys := make([]string, 0, len(store.VesselSorts))
+		for k := range store.VesselSorts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return f, fmt.Errorf("invalid sort %q, use one of %s", f.Sort, strings.Join(keys, ", "))
+	}
+
+	switch c.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		f.Desc = true
+	default:
+		return f, fmt.Errorf("invalid order, use asc or desc")
+	}
+
+	return f, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/watermark"
+)
+
+// recordWatermark creates the watermark of an export for the requesting key
+// and stores it, so the file can be traced even if it never completes.
+func (h *Handlers) recordWatermark(c *fiber.Ctx, vesselID int64, stream, format string, from, to *time.Time) (*watermark.Mark, error) {
+	id, err := watermark.NewID()
+	if err != nil {
+		return nil, err
+	}
+	key := c.Get("X-API-Key")
+	mark := watermark.Mark{
+		ExportID:  id,
+		Recipient: watermark.Fingerprint(key),
+		Org:       h.apiKeyOrgs[key],
+		IssuedAt:  time.Now().UTC(),
+		VesselID:  vesselID,
+		Stream:    stream,
+		From:      from,
+		To:        to,
+	}
+	// Through a signed link, the export goes to the link's recipient on
+	// behalf of the key that signed it
+	if link := signedLink(c); link != nil {
+		mark.Recipient, mark.Org = link.Signer, link.Recipient
+	}
+	record := watermark.Record{Mark: mark, Format: format, ClientIP: c.IP()}
+	if err := h.store.CreateExportWatermark(c.UserContext(), record); err != nil {
+		return nil, err
+	}
+	return &mark, nil
+}
+
+// writeWatermarkedExport writes the export between its watermark and its
+// manifest, then records the manifest. The request context is gone by the
+// time the body is streamed, hence the background context.
+func (h *Handlers) writeWatermarkedExport(w *bufio.Writer, mark watermark.Mark, rows store.Rows, def *store.Stream, format string, filter *duplicateFilter) error {
+	wm, err := watermark.NewWriter(w, format, mark)
+	if err != nil {
+		return err
+	}
+	if err := writeExport(wm, rows, def, format, filter); err != nil {
+		return err
+	}
+	manifest, err := wm.Close()
+	if err != nil {
+		return err
+	}
+	return h.store.CompleteExportWatermark(context.Background(), manifest, time.Now().UTC())
+}
+
+// GetExportWatermark returns the recorded watermark of an export.
+func (h *Handlers) GetExportWatermark(c *fiber.Ctx) error {
+	record, err := h.store.GetExportWatermark(c.UserContext(), c.Params("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "export not found"})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(record)
+}
+
+// traceProblems lists why a file found in the wild does not match the
+// export it claims to be; record is nil if the export is unknown.
+func traceProblems(v *watermark.Verification, record *watermark.Record) []string {
+	problems := []string{}
+	switch {
+	case v.Manifest == nil:
+		problems = append(problems, "manifest missing, the file was cut short")
+	case !v.Intact:
+		problems = append(problems, "rows or watermark do not match the manifest")
+	}
+	switch {
+	case record == nil:
+		problems = append(problems, "export not recorded on this server")
+	case record.ChainHash == nil:
+		problems = append(problems, "export never completed")
+	case *record.ChainHash != v.ChainHash || *record.Rows != v.Rows:
+		problems = append(problems, "rows differ from the export as issued")
+	}
+	return problems
+}
+
+// PostExportVerify traces an export file (the request body) to its
+// recipient and checks it against the export as issued.
+func (h *Handlers) PostExportVerify(c *fiber.Ctx) error {
+	v, err := watermark.Verify(bytes.NewReader(c.Body()))
+	if errors.Is(err, watermark.ErrNoWatermark) {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	record, err := h.store.GetExportWatermark(c.UserContext(), v.Mark.ExportID)
+	if errors.Is(err, store.ErrNotFound) {
+		record = nil
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	problems := traceProblems(v, record)
+	return c.JSON(fiber.Map{
+		"watermark":  v.Mark,
+		"manifest":   v.Manifest,
+		"format":     v.Format,
+		"rows":       v.Rows,
+		"chain_hash": v.ChainHash,
+		"record":     record,
+		"intact":     len(problems) == 0,
+		"problems":   problems,
+	})
+}
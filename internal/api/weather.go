@@ -0,0 +1,141 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type beaufortBand struct {
+	Beaufort       int     `json:"beaufort"`
+	Hours          int     `json:"hours"`
+	AvgFuelRateLPH float64 `json:"avg_fuel_rate_lph"`
+}
+
+// GetVesselWeather lists the enriched weather conditions for a vessel.
+func (h *Handlers) GetVesselWeather(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	readings, err := h.store.WeatherReadings(c.UserContext(), vesselID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"vessel_id": vesselID,
+		"items":     readings,
+	})
+}
+
+// GetVesselFuelWeather lines up hourly generator fuel consumption with the
+// weather for the same hour, grouped by Beaufort force, to show how much
+// weather costs in fuel.
+func (h *Handlers) GetVesselFuelWeather(c *fiber.Ctx) error {
+	vesselID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid vessel id"})
+	}
+
+	if visible, err := h.store.VesselVisible(c.UserContext(), vesselID, c.QueryBool("include_archived")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if !visible {
+		return c.Status(404).JSON(fiber.Map{"error": "vessel not found"})
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	hours, err := h.store.HourlyFuelWeather(c.UserContext(), vesselID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	bands := make(map[int]*beaufortBand)
+	var fuel, wind, wave []float64
+	var fuelForWave []float64
+
+	for _, hour := range hours {
+		r, rate := hour.WeatherReading, hour.FuelRateLPH
+
+		if r.WindSpeedKnots != nil {
+			fuel = append(fuel, rate)
+			wind = append(wind, *r.WindSpeedKnots)
+
+			band, ok := bands[*r.Beaufort]
+			if !ok {
+				band = &beaufortBand{Beaufort: *r.Beaufort}
+				bands[*r.Beaufort] = band
+			}
+			band.AvgFuelRateLPH = (band.AvgFuelRateLPH*float64(band.Hours) + rate) / float64(band.Hours+1)
+			band.Hours++
+		}
+		if r.WaveHeightM != nil {
+			fuelForWave = append(fuelForWave, rate)
+			wave = append(wave, *r.WaveHeightM)
+		}
+	}
+
+	byBeaufort := make([]beaufortBand, 0, len(bands))
+	for _, band := range bands {
+		byBeaufort = append(byBeaufort, *band)
+	}
+	sort.Slice(byBeaufort, func(i, j int) bool { return byBeaufort[i].Beaufort < byBeaufort[j].Beaufort })
+
+	return c.JSON(fiber.Map{
+		"vessel_id":   vesselID,
+		"hours":       hours,
+		"by_beaufort": byBeaufort,
+		"correlation": fiber.Map{
+			"fuel_vs_wind_speed":  pearson(fuel, wind),
+			"fuel_vs_wave_height": pearson(fuelForWave, wave),
+		},
+	})
+}
+
+// pearson returns the Pearson correlation coefficient of two equally long
+// series, or nil when it is undefined (fewer than 3 points or no variance).
+func pearson(xs, ys []float64) *float64 {
+	n := len(xs)
+	if n < 3 || n != len(ys) {
+		return nil
+	}
+
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/float64(n), sumY/float64(n)
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return nil
+	}
+
+	r := cov / math.Sqrt(varX*varY)
+	return &r
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPearson(t *testing.T) {
+	// Perfect positive correlation
+	if r := pearson([]float64{1, 2, 3, 4}, []float64{10, 20, 30, 40}); r == nil || math.Abs(*r-1) > 1e-9 {
+		t.Errorf("Expected 1, got %v", r)
+	}
+
+	// Perfect negative correlation
+	if r := pearson([]float64{1, 2, 3}, []float64{3, 2, 1}); r == nil || math.Abs(*r+1) > 1e-9 {
+		t.Errorf("Expected -1, got %v", r)
+	}
+
+	// Too few points / no variance
+	if r := pearson([]float64{1, 2}, []float64{1, 2}); r != nil {
+		t.Errorf("Expected nil for two points, got %v", *r)
+	}
+	if r := pearson([]float64{1, 1, 1}, []float64{1, 2, 3}); r != nil {
+		t.Errorf("Expected nil without variance, got %v", *r)
+	}
+}
@@ -1,23 +1,63 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 
+	"vessel-telemetry-api/internal/ais"
 	"vessel-telemetry-api/internal/api"
+	"vessel-telemetry-api/internal/cache"
+	"vessel-telemetry-api/internal/chunked"
+	"vessel-telemetry-api/internal/config"
+	"vessel-telemetry-api/internal/cron"
+	"vessel-telemetry-api/internal/daily"
 	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/fair"
+	"vessel-telemetry-api/internal/folderingest"
+	"vessel-telemetry-api/internal/ha"
+	"vessel-telemetry-api/internal/imapingest"
+	"vessel-telemetry-api/internal/kafka"
+	"vessel-telemetry-api/internal/mailer"
+	"vessel-telemetry-api/internal/modbus"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/nats"
+	"vessel-telemetry-api/internal/nmea2000"
+	"vessel-telemetry-api/internal/onvif"
+	"vessel-telemetry-api/internal/outbox"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/reference"
+	"vessel-telemetry-api/internal/replication"
+	"vessel-telemetry-api/internal/report"
+	"vessel-telemetry-api/internal/s3ingest"
+	"vessel-telemetry-api/internal/sftpingest"
+	"vessel-telemetry-api/internal/sink"
+	"vessel-telemetry-api/internal/snmp"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/weather"
+	"vessel-telemetry-api/internal/webhooks"
 )
 
 type App struct {
 	*fiber.App
-	db *sql.DB
+	db      *sql.DB
+	standby *ha.Standby
+	cancel  context.CancelFunc
 }
 
-func New(dbPath string, allowUnsafeDuplicateIngest bool) (*App, error) {
-	database, err := db.Connect(dbPath)
+func New(cfg config.Config) (*App, error) {
+	database, err := db.Connect(cfg.DBPath)
 	if err != nil {
 		return nil, err
 	}
@@ -26,6 +66,229 @@ func New(dbPath string, allowUnsafeDuplicateIngest bool) (*App, error) {
 		return nil, err
 	}
 
+	st := store.New(database)
+	if cfg.AuditChain {
+		var chained []*store.Stream
+		for _, name := range cfg.AuditChainStreams {
+			stream, ok := store.Streams[name]
+			if !ok {
+				return nil, fmt.Errorf("AUDIT_CHAIN_STREAMS: unknown stream %q", name)
+			}
+			chained = append(chained, stream)
+		}
+		st.ChainStreams(chained...)
+	}
+
+	for _, name := range cfg.WebhookStreams {
+		if _, ok := store.Streams[name]; !ok {
+			return nil, fmt.Errorf("WEBHOOK_STREAMS: unknown stream %q", name)
+		}
+	}
+	for _, name := range cfg.SinkStreams {
+		if _, ok := store.Streams[name]; !ok {
+			return nil, fmt.Errorf("SINK_STREAMS: unknown stream %q", name)
+		}
+	}
+	if cfg.OutboxBatchSize <= 0 && (len(cfg.WebhookURLs) > 0 || len(cfg.KafkaBrokers) > 0 || len(cfg.NATSURLs) > 0) {
+		return nil, fmt.Errorf("OUTBOX_BATCH_SIZE: must be positive")
+	}
+	if !kafka.ValidTopicPrefix(cfg.KafkaTopicPrefix) {
+		return nil, fmt.Errorf("KAFKA_TOPIC_PREFIX: %q is not a valid topic name", cfg.KafkaTopicPrefix)
+	}
+	if !nats.ValidSubjectPrefix(cfg.NATSSubjectPrefix) {
+		return nil, fmt.Errorf("NATS_SUBJECT_PREFIX: %q is not a valid subject prefix, end it with a dot", cfg.NATSSubjectPrefix)
+	}
+	var pusher *replication.Pusher
+	switch cfg.ReplicationRole {
+	case "":
+	case replication.RoleCentral:
+		if cfg.ReplicationToken == "" {
+			return nil, fmt.Errorf("REPLICATION_ROLE=central needs REPLICATION_TOKEN")
+		}
+	case replication.RoleEdge:
+		if cfg.ReplicationCentralURL == "" {
+			return nil, fmt.Errorf("REPLICATION_ROLE=edge needs REPLICATION_CENTRAL_URL")
+		}
+		if cfg.ReplicationBatchSize <= 0 {
+			return nil, fmt.Errorf("REPLICATION_BATCH_SIZE: must be positive")
+		}
+		edge := cfg.ReplicationEdgeID
+		if edge == "" {
+			if edge, err = os.Hostname(); err != nil {
+				return nil, fmt.Errorf("REPLICATION_EDGE_ID: %w", err)
+			}
+		}
+		cfg.ReplicationEdgeID = edge
+		if cfg.ReplicationBudgetBytes < 0 {
+			return nil, fmt.Errorf("REPLICATION_BUDGET_MB: must not be negative")
+		}
+		if cfg.ReplicationBudgetBytes > 0 && cfg.ReplicationBudgetWindow <= 0 {
+			return nil, fmt.Errorf("REPLICATION_BUDGET_WINDOW: must be positive")
+		}
+		budget := replication.Budget{Bytes: cfg.ReplicationBudgetBytes, Window: cfg.ReplicationBudgetWindow}
+		pusher = replication.NewPusher(st, cfg.ReplicationCentralURL, cfg.ReplicationToken, edge, cfg.ReplicationBatchSize, budget, cfg.Outbound)
+	default:
+		return nil, fmt.Errorf("invalid REPLICATION_ROLE %q, use edge or central", cfg.ReplicationRole)
+	}
+
+	// New-data webhooks and reading sinks are delivered from the outbox
+	dispatcher := outbox.New(st, cfg.OutboxBatchSize)
+	if len(cfg.WebhookURLs) > 0 {
+		notifier := webhooks.NewNotifier(st, cfg.WebhookStreams, cfg.WebhookURLs, cfg.WebhookSecret, cfg.WebhookInterval, cfg.Outbound)
+		for _, c := range notifier.Consumers() {
+			dispatcher.Add(c)
+		}
+	}
+	if len(cfg.KafkaBrokers) > 0 {
+		publisher := kafka.NewPublisher(kafka.NewProducer(cfg.KafkaBrokers, cfg.Outbound), cfg.KafkaTopicPrefix)
+		dispatcher.Add(sink.New(st, publisher, cfg.SinkStreams, cfg.SinkInterval).Consumer())
+	}
+	if len(cfg.NATSURLs) > 0 {
+		publisher, err := nats.NewPublisher(cfg.NATSURLs, cfg.NATSSubjectPrefix, cfg.Outbound)
+		if err != nil {
+			return nil, fmt.Errorf("NATS_URLS: %w", err)
+		}
+		dispatcher.Add(sink.New(st, publisher, cfg.SinkStreams, cfg.SinkInterval).Consumer())
+	}
+
+	bundledPorts, err := ports.Bundled()
+	if err != nil {
+		return nil, err
+	}
+	if err := st.SeedPorts(context.Background(), bundledPorts); err != nil {
+		return nil, err
+	}
+
+	bundledReference, err := reference.Bundled()
+	if err != nil {
+		return nil, err
+	}
+	if err := st.SeedReference(context.Background(), bundledReference); err != nil {
+		return nil, err
+	}
+
+	if err := st.BackfillRollups(context.Background()); err != nil {
+		return nil, fmt.Errorf("building rollups: %w", err)
+	}
+
+	var sftpRemotes []sftpingest.Remote
+	if cfg.SFTPRemotesFile != "" {
+		if sftpRemotes, err = sftpingest.LoadRemotes(cfg.SFTPRemotesFile); err != nil {
+			return nil, fmt.Errorf("SFTP_REMOTES_FILE: %w", err)
+		}
+	}
+
+	// Hot reads are cached until anything is ingested
+	var responses cache.Cache = cache.NewMemory(cacheMaxEntries)
+	if cfg.RedisAddr != "" {
+		if responses, err = cache.NewRedis(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, cfg.Outbound); err != nil {
+			return nil, fmt.Errorf("REDIS_ADDR: %w", err)
+		}
+	}
+	invalidate := func(ctx context.Context) {
+		if err := responses.Invalidate(ctx); err != nil {
+			log.Printf("cache: %v", err)
+		}
+	}
+	// Downstream systems hear of each file ingested, whichever way it came in
+	var ingestNotifier *webhooks.IngestNotifier
+	if len(cfg.IngestWebhookURLs) > 0 {
+		ingestNotifier = webhooks.NewIngestNotifier(cfg.IngestWebhookURLs, cfg.WebhookSecret, cfg.Outbound)
+	}
+	notifyIngested := func(ctx context.Context, filename string, resp *models.IngestResponse) {
+		if ingestNotifier != nil {
+			ingestNotifier.Notify(filename, resp)
+		}
+	}
+	onIngest := func(ctx context.Context, filename string, resp *models.IngestResponse) {
+		invalidate(ctx)
+		notifyIngested(ctx, filename, resp)
+	}
+
+	// Files the workers collect take ingest slots like uploads, each worker
+	// as a tenant of its own
+	ingestSlots := fair.New("ingest", cfg.IngestLimits)
+
+	var bucket *s3ingest.Watcher
+	if cfg.S3Bucket != "" {
+		processor := api.NewProcessor(st, cfg)
+		processor.OnIngest(onIngest)
+		processor.SetScheduler(ingestSlots, "worker:s3")
+		bucket, err = s3ingest.NewWatcher(st, processor, s3ingest.Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			Prefix:    cfg.S3Prefix,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			// Interval is left 0: listings are a job of the scheduler
+			MaxAttempts:  cfg.S3MaxAttempts,
+			RetryBackoff: cfg.S3RetryBackoff,
+		}, cfg.Outbound)
+		if err != nil {
+			return nil, fmt.Errorf("S3_BUCKET: %w", err)
+		}
+	}
+
+	var dropDir *folderingest.Watcher
+	if cfg.DropDir != "" {
+		processor := api.NewProcessor(st, cfg)
+		processor.OnIngest(onIngest)
+		processor.SetScheduler(ingestSlots, "worker:folder")
+		dropDir, err = folderingest.NewWatcher(processor, folderingest.Config{
+			Dir:    cfg.DropDir,
+			IMO:    cfg.DropDirIMO,
+			Settle: cfg.DropDirSettle,
+			Rescan: cfg.DropDirRescan,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("DROP_DIR: %w", err)
+		}
+	}
+
+	var n2k *nmea2000.Listener
+	if cfg.N2KUDPAddr != "" || cfg.N2KDevice != "" {
+		processor := api.NewProcessor(st, cfg)
+		processor.OnIngest(onIngest)
+		n2k, err = nmea2000.NewListener(processor, nmea2000.Config{
+			UDPAddr:  cfg.N2KUDPAddr,
+			Device:   cfg.N2KDevice,
+			IMO:      cfg.N2KIMO,
+			Interval: cfg.N2KInterval,
+			Flush:    cfg.N2KFlush,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("N2K_UDP_ADDR: %w", err)
+		}
+	}
+
+	// A nil *mailer.Mailer must not become a non-nil interface
+	var replies imapingest.Mailer
+	var reports *report.Sender
+	if cfg.SMTPAddr != "" {
+		m, err := mailer.New(cfg.SMTPAddr, cfg.SMTPUser, cfg.SMTPPassword, cfg.SMTPFrom, cfg.Outbound)
+		if err != nil {
+			return nil, fmt.Errorf("SMTP_ADDR: %w", err)
+		}
+		replies = m
+		reports = report.NewSender(st, m)
+	}
+
+	compression, ok := compressionLevels[cfg.Compression]
+	if !ok {
+		return nil, fmt.Errorf("COMPRESSION: unknown level %q, use off, speed, default or best", cfg.Compression)
+	}
+
+	// Schedules are checked before anything starts
+	for name, spec := range cfg.JobSchedules {
+		if !jobNames[name] {
+			return nil, fmt.Errorf("JOB_SCHEDULES: unknown job %q", name)
+		}
+		if _, err := cron.Parse(spec); err != nil {
+			return nil, fmt.Errorf("JOB_SCHEDULES: %s: %w", name, err)
+		}
+	}
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
@@ -40,18 +303,324 @@ func New(dbPath string, allowUnsafeDuplicateIngest bool) (*App, error) {
 
 	app.Use(logger.New())
 	app.Use(cors.New())
+	// gzip, deflate or brotli, whichever the client prefers of those it accepts
+	app.Use(compress.New(compress.Config{Level: compression}))
 
 	// Serve static files
 	app.Static("/", "./web")
 
-	api.SetupRoutes(app, database, allowUnsafeDuplicateIngest)
+	// Background workers stop when the app is closed
+	ctx, cancel := context.WithCancel(context.Background())
+
+	uploadDir := cfg.ChunkedUploadDir
+	if uploadDir == "" {
+		uploadDir = filepath.Join(filepath.Dir(cfg.DBPath), "uploads")
+	}
+	uploads := chunked.New(st, uploadDir, cfg.ChunkedUploadTTL, int64(cfg.ChunkedUploadMaxMB)<<20)
+
+	// Recurring work runs on the scheduler, each job every interval
+	// configured for it unless JOB_SCHEDULES says otherwise
+	jobs := cron.New()
+	schedule := func(name, spec string, run func(ctx context.Context) error) {
+		if s, ok := cfg.JobSchedules[name]; ok {
+			spec = s
+		}
+		if err := jobs.Add(name, spec, run); err != nil {
+			log.Printf("cron: %v", err)
+			return
+		}
+		log.Printf("Job %s scheduled %s", name, spec)
+	}
+	every := func(d time.Duration) string {
+		return "@every " + d.String()
+	}
+
+	startWorkers := func() {
+		if cfg.AISProviderURL != "" {
+			poller := ais.NewPoller(st, cfg.AISProviderURL, cfg.AISAPIKey, cfg.Outbound)
+			poller.SetQuota(api.NewProcessor(st, cfg))
+			schedule("ais", every(cfg.AISPollInterval), func(ctx context.Context) error {
+				poller.PollOnce(ctx)
+				// Positions are written without refreshing rollups; fixes
+				// are at most a day old
+				since := time.Now().Add(-24 * time.Hour)
+				if err := st.RebuildRollups(ctx, store.Streams["location"], &since); err != nil {
+					log.Printf("ais: rollups: %v", err)
+				}
+				invalidate(ctx)
+				return nil
+			})
+		}
+
+		if cfg.CDCRetention > 0 {
+			schedule("cdc-prune", "@every 1h", func(ctx context.Context) error {
+				return pruneChanges(ctx, st, cfg.CDCRetention, cfg.ReplicationRole == replication.RoleEdge)
+			})
+		}
+
+		schedule("extra-prune", "@every 1h", func(ctx context.Context) error {
+			n, err := st.PruneExtraPayloads(ctx, time.Now())
+			if n > 0 {
+				log.Printf("extra_json: pruned %d unreferenced payload(s)", n)
+			}
+			return err
+		})
+
+		schedule("upload-prune", "@every 1h", func(ctx context.Context) error {
+			n, err := uploads.PruneExpired(ctx)
+			if n > 0 {
+				log.Printf("uploads: dropped %d expired chunked upload(s)", n)
+			}
+			return err
+		})
+
+		if cfg.DailySummaryDays > 0 {
+			schedule("daily-summary", "30 0 * * *", func(ctx context.Context) error {
+				return summarizeDays(ctx, st, cfg.DailySummaryDays, time.Now())
+			})
+		}
+
+		if reports != nil {
+			schedule("reports", "15 * * * *", func(ctx context.Context) error {
+				return reports.SendDue(ctx, time.Now())
+			})
+		}
+
+		if cfg.BackupDir != "" {
+			schedule("backup", "0 3 * * *", func(ctx context.Context) error {
+				return backup(ctx, st, cfg.BackupDir, cfg.BackupKeep)
+			})
+		}
+
+		// Consumers resume from their cursors, so nothing is lost while
+		// the workers are stopped or the instance is a standby
+		go dispatcher.Run(ctx)
+		schedule("outbox-prune", "@every 1h", func(ctx context.Context) error {
+			n, err := dispatcher.Prune(ctx)
+			if n > 0 {
+				log.Printf("outbox: pruned %d delivered event(s)", n)
+			}
+			return err
+		})
+
+		if pusher != nil {
+			schedule("replication", every(cfg.ReplicationInterval), pusher.PushOnce)
+		}
+
+		if len(sftpRemotes) > 0 {
+			processor := api.NewProcessor(st, cfg)
+			processor.OnIngest(onIngest)
+			processor.SetScheduler(ingestSlots, "worker:sftp")
+			poller := sftpingest.NewPoller(processor, sftpRemotes, cfg.SFTPMinFileAge, cfg.Outbound)
+			schedule("sftp", every(cfg.SFTPPollInterval), func(ctx context.Context) error {
+				poller.PollOnce(ctx)
+				return nil
+			})
+		}
+
+		if bucket != nil {
+			// Run only takes the objects notified; listings are a job
+			go bucket.Run(ctx)
+			if cfg.S3PollInterval > 0 {
+				schedule("s3", every(cfg.S3PollInterval), func(ctx context.Context) error {
+					bucket.PollOnce(ctx)
+					return nil
+				})
+			}
+			log.Printf("S3 ingest enabled for bucket %s", cfg.S3Bucket)
+		}
+
+		if dropDir != nil {
+			go dropDir.Run(ctx)
+			log.Printf("Drop folder %s watched, scanned every %s", cfg.DropDir, cfg.DropDirRescan)
+		}
+
+		if n2k != nil {
+			go n2k.Run(ctx)
+			log.Printf("NMEA 2000 readings of %s ingested every %s", cfg.N2KIMO, cfg.N2KFlush)
+		}
+
+		if cfg.IMAPAddr != "" {
+			processor := api.NewProcessor(st, cfg)
+			processor.OnIngest(onIngest)
+			processor.SetScheduler(ingestSlots, "worker:imap")
+			poller := imapingest.NewPoller(processor, replies, imapingest.Config{
+				Addr:     cfg.IMAPAddr,
+				TLS:      cfg.IMAPTLS,
+				User:     cfg.IMAPUser,
+				Password: cfg.IMAPPassword,
+				Mailbox:  cfg.IMAPMailbox,
+				Senders:  cfg.IMAPSenders,
+			}, cfg.Outbound)
+			schedule("imap", every(cfg.IMAPPollInterval), poller.PollOnce)
+			log.Printf("IMAP ingest enabled for %s on %s (%d sender(s))", cfg.IMAPMailbox, cfg.IMAPAddr, len(cfg.IMAPSenders))
+		}
+
+		// Vessels without registers cost a query
+		if cfg.ModbusPollInterval > 0 {
+			processor := api.NewProcessor(st, cfg)
+			processor.OnIngest(onIngest)
+			policy := cfg.Outbound
+			policy.Timeout = cfg.ModbusTimeout
+			schedule("modbus", every(cfg.ModbusPollInterval), modbus.NewPoller(st, processor, policy).PollOnce)
+		}
+
+		// Likewise vessels without SNMP devices
+		if cfg.SNMPPollInterval > 0 {
+			processor := api.NewProcessor(st, cfg)
+			processor.OnIngest(onIngest)
+			policy := cfg.Outbound
+			policy.Timeout = cfg.SNMPTimeout
+			schedule("snmp", every(cfg.SNMPPollInterval), snmp.NewPoller(st, processor, policy).PollOnce)
+		}
+
+		// And without ONVIF cameras
+		if cfg.ONVIFPollInterval > 0 {
+			processor := api.NewProcessor(st, cfg)
+			processor.OnIngest(onIngest)
+			policy := cfg.Outbound
+			policy.Timeout = cfg.ONVIFTimeout
+			schedule("onvif", every(cfg.ONVIFPollInterval), onvif.NewPoller(st, processor, policy, cfg.ONVIFAlertAfter).PollOnce)
+		}
+
+		if cfg.WeatherProviderURL != "" {
+			enricher := weather.NewEnricher(st, cfg.WeatherProviderURL, cfg.WeatherAPIKey, cfg.WeatherPollInterval, cfg.Outbound)
+			schedule("weather", every(cfg.WeatherPollInterval), func(ctx context.Context) error {
+				enricher.EnrichOnce(ctx)
+				return nil
+			})
+		}
+
+		go jobs.Run(ctx)
+	}
+
+	// A standby only writes once promoted, so its workers wait until then
+	var standby *ha.Standby
+	switch cfg.HARole {
+	case "", ha.RolePrimary:
+		startWorkers()
+		if cfg.HARole == ha.RolePrimary && cfg.HAToken == "" {
+			log.Printf("HA_ROLE=primary without HA_TOKEN: snapshots are refused, so standbys cannot sync")
+		}
+	case ha.RoleStandby:
+		if cfg.HAPrimaryURL == "" {
+			cancel()
+			return nil, fmt.Errorf("HA_ROLE=standby needs HA_PRIMARY_URL")
+		}
+		policy := cfg.Outbound
+		policy.Timeout = cfg.HASyncTimeout
+		standby = ha.NewStandby(st, cfg.HAPrimaryURL, cfg.HAToken, cfg.HASyncInterval, policy, startWorkers)
+		go standby.Run(ctx)
+		log.Printf("Running as read-only standby of %s, syncing every %s", cfg.HAPrimaryURL, cfg.HASyncInterval)
+	default:
+		cancel()
+		return nil, fmt.Errorf("invalid HA_ROLE %q, use primary or standby", cfg.HARole)
+	}
+
+	api.SetupRoutes(app, st, cfg, standby, bucket, jobs, dispatcher, uploads, responses, reports, notifyIngested, ingestSlots)
 
 	return &App{
-		App: app,
-		db:  database,
+		App:     app,
+		db:      database,
+		standby: standby,
+		cancel:  cancel,
 	}, nil
 }
 
+// compressionLevels are the values of COMPRESSION; unset is default.
+var compressionLevels = map[string]compress.Level{
+	"off": compress.LevelDisabled, "speed": compress.LevelBestSpeed,
+	"": compress.LevelDefault, "default": compress.LevelDefault, "best": compress.LevelBestCompression,
+}
+
+// cacheMaxEntries bounds the in-process response cache.
+const cacheMaxEntries = 1000
+
+// jobNames are the recurring jobs JOB_SCHEDULES may name.
+var jobNames = map[string]bool{
+	"ais": true, "weather": true, "replication": true, "sftp": true, "s3": true, "imap": true,
+	"cdc-prune": true, "extra-prune": true, "outbox-prune": true, "upload-prune": true, "backup": true, "daily-summary": true, "reports": true,
+	"modbus": true, "snmp": true, "onvif": true,
+}
+
+// pruneChanges drops changes older than retention from the change data
+// capture feed. An edge keeps the updates not yet pushed ashore, from the
+// lowest of its streams' update cursors on.
+func pruneChanges(ctx context.Context, st store.Store, retention time.Duration, edge bool) error {
+	maxSeq := int64(math.MaxInt64)
+	if edge {
+		cursors, err := st.ReplicationCursors(ctx)
+		if err != nil {
+			return fmt.Errorf("pruning changes: %w", err)
+		}
+		for name := range store.Streams {
+			maxSeq = min(maxSeq, cursors[store.UpdatesCursor(name)])
+		}
+	}
+	n, err := st.PruneChanges(ctx, time.Now().Add(-retention), maxSeq)
+	if err != nil {
+		return fmt.Errorf("pruning changes: %w", err)
+	}
+	if n > 0 {
+		log.Printf("cdc: pruned %d change(s) older than %s", n, retention)
+	}
+	return nil
+}
+
+// summarizeDays writes the daily summaries of every vessel for the last
+// days completed before now.
+func summarizeDays(ctx context.Context, st store.Store, days int, now time.Time) error {
+	vessels, err := st.ListVessels(ctx, store.VesselFilter{})
+	if err != nil {
+		return err
+	}
+	today := now.UTC().Truncate(24 * time.Hour)
+	for _, vessel := range vessels {
+		for i := days; i > 0; i-- {
+			day := today.AddDate(0, 0, -i)
+			summary, err := daily.Summarize(ctx, st, vessel.ID, day)
+			if err != nil {
+				return fmt.Errorf("summarizing vessel %d on %s: %w", vessel.ID, day.Format(daily.DayLayout), err)
+			}
+			if err := st.PutDailySummary(ctx, summary); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("daily: summarized %d day(s) of %d vessel(s)", days, len(vessels))
+	return nil
+}
+
+// backup writes a snapshot of the database into dir, then deletes all but
+// the keep most recent ones (all are kept if keep is 0).
+func backup(ctx context.Context, st store.Store, dir string, keep int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, "telemetry-"+time.Now().UTC().Format("20060102T150405Z")+".db")
+	if err := st.Snapshot(ctx, file); err != nil {
+		return err
+	}
+	log.Printf("backup: wrote %s", file)
+
+	if keep <= 0 {
+		return nil
+	}
+	// The names sort by time
+	snapshots, err := filepath.Glob(filepath.Join(dir, "telemetry-*.db"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(snapshots)
+	for _, old := range snapshots[:max(0, len(snapshots)-keep)] {
+		if err := os.Remove(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (a *App) Close() error {
+	a.cancel()
 	return a.db.Close()
 }
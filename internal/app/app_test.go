@@ -0,0 +1,5977 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"vessel-telemetry-api/internal/ais"
+	"vessel-telemetry-api/internal/api"
+	"vessel-telemetry-api/internal/config"
+	"vessel-telemetry-api/internal/cron"
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/dcs"
+	"vessel-telemetry-api/internal/deltas"
+	"vessel-telemetry-api/internal/modbus"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/mrv"
+	"vessel-telemetry-api/internal/nmea2000"
+	"vessel-telemetry-api/internal/onvif"
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/signedurl"
+	"vessel-telemetry-api/internal/snmp"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/util"
+	"vessel-telemetry-api/internal/webhooks"
+)
+
+// These tests boot the whole app on a temporary database, ingest workbooks
+// laid out the way vessels actually send them and check what the API returns,
+// so mapper changes show up as failing assertions rather than in production.
+
+type sheet struct {
+	name string
+	rows [][]interface{}
+}
+
+// workbook builds an XLSX file. Cell values keep their Go type, so a
+
+// time.Time becomes a date cell and a float64 a number cell.
+
+func workbook(t *testing.T, sheets ...sheet) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+
+	for i, s := range sheets {
+		if i == 0 {
+			f.SetSheetName("Sheet1", s.name)
+		} else if _, err := f.NewSheet(s.name); err != nil {
+			t.Fatal(err)
+		}
+		for r, row := range s.rows {
+			for c, v := range row {
+				cell, _ := excelize.CoordinatesToCellName(c+1, r+1)
+				if err := f.SetCellValue(s.name, cell, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func do(t *testing.T, a *App, req *http.Request, out interface{}) int {
+	t.Helper()
+	resp, err := a.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if out != nil {
+		if err := json.Unmarshal(body, out); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q: %v", req.Method, req.URL, body, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func get(t *testing.T, a *App, url string, out interface{}) int {
+	t.Helper()
+	return do(t, a, httptest.NewRequest("GET", url, nil), out)
+}
+
+type ingestResult struct {
+	Status       string         `json:"status"`
+	UploadID     int64          `json:"upload_id"`
+	VesselID     int64          `json:"vessel_id"`
+	RowsInserted map[string]int `json:"rows_inserted"`
+	Warnings     []string       `json:"warnings"`
+	Error        string         `json:"error"`
+}
+
+func ingest(t *testing.T, a *App, file []byte, query string) ingestResult {
+	t.Helper()
+	var result ingestResult
+	if status := postIngest(t, a, file, query, &result); status != 200 {
+		t.Fatalf("ingest: expected status 200, got %d (%s)", status, result.Error)
+	}
+	return result
+}
+
+// postIngest posts file to /ingest/xlsx and returns the status.
+
+func postIngest(t *testing.T, a *App, file []byte, query string, out interface{}) int {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", "telemetry.xlsx")
+	part.Write(file)
+	w.Close()
+
+	req := httptest.NewRequest("POST", "/ingest/xlsx?"+query, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return do(t, a, req, out)
+}
+
+type telemetryPage struct {
+	Items      []map[string]interface{} `json:"items"`
+	NextCursor string                   `json:"next_cursor"`
+}
+
+func telemetry(t *testing.T, a *App, vesselID int64, query string) []map[string]interface{} {
+	t.Helper()
+	var page telemetryPage
+	url := fmt.Sprintf("/vessels/%d/telemetry?%s", vesselID, query)
+	if status := get(t, a, url, &page); status != 200 {
+		t.Fatalf("%s: expected status 200, got %d", url, status)
+	}
+	return page.Items
+}
+
+func TestIngestLongFormat(t *testing.T) {
+	a := newTestApp(t)
+	file := workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO", "Flag", "Type"},
+			{"Ever Given", "9811000", "Panama", "Container Ship"},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM", "Temperature C", "Oil Pressure Bar", "Alarms", "Custom Field"},
+			{"2025-08-08T10:00:00Z", "1", "1500", "85.5", "4.2", "OK", "Custom Value 1"},
+			{"2025-08-08T10:30:00Z", "1", "1600", "87.2", "4.5", "OK", "Custom Value 2"},
+		}},
+		sheet{"Fuel Tanks", [][]interface{}{
+			{"Timestamp", "Tank No", "Level %", "Volume Liters", "Temperature C"},
+			{"2025-08-08T10:00:00Z", "1", "75.5", "15000", "25"},
+		}},
+	)
+
+	result := ingest(t, a, file, "imo=9811000")
+	if result.RowsInserted["engines"] != 2 || result.RowsInserted["fuel"] != 1 {
+		t.Fatalf("Expected 2 engine and 1 fuel rows, got %v", result.RowsInserted)
+	}
+
+	var vessels []map[string]interface{}
+	get(t, a, "/vessels", &vessels)
+	if len(vessels) != 1 || vessels[0]["name"] != "Ever Given" || vessels[0]["imo"] != "9811000" || vessels[0]["flag"] != "Panama" {
+		t.Fatalf("Expected vessel from Ship Info, got %v", vessels)
+	}
+
+	engines := telemetry(t, a, result.VesselID, "stream=engines")
+	if len(engines) != 2 {
+		t.Fatalf("Expected 2 engine readings, got %d", len(engines))
+	}
+	first := engines[0]
+	if first["ts"] != "2025-08-08T10:00:00Z" || first["engine_no"] != 1.0 || first["rpm"] != 1500.0 ||
+		first["temp_c"] != 85.5 || first["oil_pressure_bar"] != 4.2 || first["alarms"] != "OK" {
+		t.Errorf("Unexpected engine reading %v", first)
+	}
+	if extra, _ := first["extra_json"].(map[string]interface{}); extra["Custom Field"] != "Custom Value 1" {
+		t.Errorf("Expected unmapped columns in extra_json, got %v", first["extra_json"])
+	}
+
+	fuel := telemetry(t, a, result.VesselID, "stream=fuel")
+	if len(fuel) != 1 || fuel[0]["tank_no"] != 1.0 || fuel[0]["volume_liters"] != 15000.0 || fuel[0]["temp_c"] != 25.0 {
+		t.Errorf("Unexpected fuel readings %v", fuel)
+	}
+
+	var latest map[string]interface{}
+	get(t, a, fmt.Sprintf("/vessels/%d/latest?stream=engines", result.VesselID), &latest)
+	if latest["ts"] != "2025-08-08T10:30:00Z" {
+		t.Errorf("Expected latest engine reading at 10:30, got %v", latest["ts"])
+	}
+
+	// The same file again is refused
+	var dup ingestResult
+	if status := postIngest(t, a, file, "imo=9811000", &dup); status != 409 || dup.Status != "already_ingested" {
+		t.Errorf("Expected 409 already_ingested for the same file, got %d %+v", status, dup)
+	}
+
+	// Ingesting the same rows again in another file adds nothing
+	again := ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO", "Flag", "Type"},
+			{"Ever Given", "9811000", "Panama", "Container Ship"},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM", "Temperature C", "Oil Pressure Bar", "Alarms", "Custom Field"},
+			{"2025-08-08T10:00:00Z", "1", "1500", "85.5", "4.2", "OK", "Custom Value 1"},
+			{"2025-08-08T10:30:00Z", "1", "1600", "87.2", "4.5", "OK", "Custom Value 2"},
+		}},
+		sheet{"Fuel Tanks", [][]interface{}{
+			{"Timestamp", "Tank No", "Level %", "Volume Liters", "Temperature C"},
+			{"2025-08-08T10:00:00Z", "1", "75.5", "15000", "25"},
+		}},
+		sheet{"Notes", [][]interface{}{{"Resent"}}},
+	), "imo=9811000")
+	if again.VesselID != result.VesselID || again.RowsInserted["engines"] != 0 || again.RowsInserted["fuel"] != 0 {
+		t.Errorf("Expected re-ingest to insert nothing for the same vessel, got %+v", again)
+	}
+}
+
+func TestIngestWideEquipmentLayout(t *testing.T) {
+	// One row per engine/tank/generator with units in the headers and no
+	// per-row timestamps, as exported by onboard monitoring systems
+	a := newTestApp(t)
+	file := workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Category", "ID", "Name", "IMO", "Timestamp", "Status", "Latitude", "Longitude", "Course", "Speed(knots)"},
+			{"Ship Info", "SHIP-12345", "MV Sea Voyager", "9799707", "2023-11-15T09:00:45Z", "underway", "34.061", "-118.2305", "218.7", "13.1"},
+		}},
+		sheet{"Fuel Tanks", [][]interface{}{
+			{"Tank ID", "Capacity(m3)", "Current Level(m3)", "Temp(C)", "Consumption Rate(L/h)"},
+			{"fuelTank1", "1500", "500", "28", "12.3"},
+			{"fuelTank2", "1500", "400", "27", "10.8"},
+		}},
+		sheet{"Generators", [][]interface{}{
+			{"Generator", "Status", "Output(kW)", "Voltage(V)", "Frequency(Hz)", "Load(%)", "Fuel Rate(L/h)"},
+			{"Generator 1", "running", "450", "440", "60", "65", "25.3"},
+			{"Generator 2", "standby", "0", "440", "0", "0", "0"},
+		}},
+		sheet{"Impact & Vibration", [][]interface{}{
+			{"Location", "Sensor Type", "Value", "Unit", "Timestamp"},
+			{"Engine Room", "Vibration", "2.5", "mm/s RMS", "2023-11-15T08:25:00Z"},
+		}},
+	)
+
+	result := ingest(t, a, file, "imo=9799707&period_start=2023-11-15T09:00:00Z")
+	if result.RowsInserted["fuel"] != 2 || result.RowsInserted["location"] != 1 || result.RowsInserted["impact"] != 1 {
+		t.Fatalf("Unexpected row counts %v", result.RowsInserted)
+	}
+
+	// Volumes in m3 are converted to litres; level is current over capacity
+	fuel := telemetry(t, a, result.VesselID, "stream=fuel")
+	if len(fuel) != 2 {
+		t.Fatalf("Expected 2 fuel readings, got %d", len(fuel))
+	}
+	tank1 := fuel[0]
+	if tank1["tank_no"] != 1.0 || tank1["volume_liters"] != 500000.0 || tank1["temp_c"] != 28.0 {
+		t.Errorf("Unexpected tank reading %v", tank1)
+	}
+	if level, _ := tank1["level_percent"].(float64); level < 33.3 || level > 33.4 {
+		t.Errorf("Expected level ~33.3%%, got %v", tank1["level_percent"])
+	}
+	if tank1["ts"] != "2023-11-15T09:00:00Z" {
+		t.Errorf("Expected rows without a timestamp to use period_start, got %v", tank1["ts"])
+	}
+
+	// Out-of-range readings are skipped with a warning
+	generators := telemetry(t, a, result.VesselID, "stream=generators")
+	if len(generators) != 1 || generators[0]["gen_no"] != 1.0 || generators[0]["fuel_rate_lph"] != 25.3 {
+		t.Errorf("Expected only generator 1, got %v", generators)
+	}
+	if len(result.Warnings) == 0 {
+		t.Errorf("Expected a warning for generator 2")
+	}
+
+	location := telemetry(t, a, result.VesselID, "stream=location")
+	if len(location) != 1 || location[0]["latitude"] != 34.061 || location[0]["longitude"] != -118.2305 ||
+		location[0]["speed_knots"] != 13.1 || location[0]["ts"] != "2023-11-15T09:00:45Z" {
+		t.Errorf("Expected position from Ship Info, got %v", location)
+	}
+
+	impact := telemetry(t, a, result.VesselID, "stream=impact")
+	if len(impact) != 1 || impact[0]["ts"] != "2023-11-15T08:25:00Z" {
+		t.Errorf("Unexpected impact readings %v", impact)
+	}
+}
+
+func TestIngestLocalizedHeaders(t *testing.T) {
+	// Spanish headers: the ones containing a known keyword are mapped, the
+	// rest end up in extra_json
+	a := newTestApp(t)
+	file := workbook(t,
+		sheet{"Motores (Engines)", [][]interface{}{
+			{"Hora UTC", "Motor", "RPM", "Temperatura (°C)", "Presión de aceite (bar)", "Alarmas"},
+			{"2025-03-01 06:00:00", "Principal", "720", "81.5", "3.9", "Ninguna"},
+		}},
+	)
+
+	result := ingest(t, a, file, "vessel_name=Buque%20Prueba")
+	if result.RowsInserted["engines"] != 1 {
+		t.Fatalf("Expected 1 engine row, got %v", result.RowsInserted)
+	}
+
+	engines := telemetry(t, a, result.VesselID, "stream=engines")
+	if len(engines) != 1 {
+		t.Fatalf("Expected 1 engine reading, got %d", len(engines))
+	}
+	reading := engines[0]
+	if reading["ts"] != "2025-03-01T06:00:00Z" || reading["rpm"] != 720.0 || reading["temp_c"] != 81.5 || reading["alarms"] != "Ninguna" {
+		t.Errorf("Unexpected engine reading %v", reading)
+	}
+	if reading["engine_no"] != nil || reading["oil_pressure_bar"] != nil {
+		t.Errorf("Expected unmatched headers to stay unmapped, got %v", reading)
+	}
+	extra, _ := reading["extra_json"].(map[string]interface{})
+	if extra["Motor"] != "Principal" || extra["Presión de aceite (bar)"] != "3.9" {
+		t.Errorf("Expected unmapped columns in extra_json, got %v", reading["extra_json"])
+	}
+}
+
+func TestIngestLowConfidenceHeaders(t *testing.T) {
+	// A header run together with another word is still read, with a warning
+	// naming the guess
+	a := newTestApp(t)
+	file := workbook(t,
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine", "RPM", "ExhaustTemp"},
+			{"2025-03-01T06:00:00Z", "ME-1", "720", "81.5"},
+		}},
+	)
+	result := ingest(t, a, file, "vessel_name=Alpha")
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], `"ExhaustTemp" read as temp_c with low confidence`) {
+		t.Errorf("Expected a low-confidence warning, got %v", result.Warnings)
+	}
+	engines := telemetry(t, a, result.VesselID, "stream=engines")
+	if len(engines) != 1 || engines[0]["temp_c"] != 81.5 {
+		t.Errorf("Expected the column read, got %v", engines)
+	}
+}
+
+func TestUploadWarnings(t *testing.T) {
+	// Warnings are kept with the upload, rows with the cells they were read from
+	a := newTestApp(t)
+	file := workbook(t,
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine", "RPM", "ExhaustTemp"},
+			{"2025-03-01T06:00:00Z", "ME-1", "720", "81.5"},
+			{"2025-03-01T07:00:00Z", "ME-1", "-5", "80.1"},
+			{"2025-03-01T08:00:00Z", "ME-1", "-7", "80.4"},
+		}},
+	)
+	result := ingest(t, a, file, "vessel_name=Alpha")
+	if len(result.Warnings) != 3 {
+		t.Fatalf("Expected 3 warnings, got %v", result.Warnings)
+	}
+
+	type warningsPage struct {
+		Items []struct {
+			ID        int64             `json:"id"`
+			Sheet     *string           `json:"sheet"`
+			RowNumber *int              `json:"row_number"`
+			Message   string            `json:"message"`
+			Row       map[string]string `json:"row"`
+		} `json:"items"`
+		NextAfterID *int64 `json:"next_after_id"`
+	}
+	var page warningsPage
+	url := fmt.Sprintf("/uploads/%d/warnings?limit=2", result.UploadID)
+	if status := get(t, a, url, &page); status != 200 || len(page.Items) != 2 || page.NextAfterID == nil {
+		t.Fatalf("Expected a first page of 2, got %d %+v", status, page)
+	}
+	header := page.Items[0]
+	if header.Sheet == nil || *header.Sheet != "Engines" || header.RowNumber != nil || header.Message != result.Warnings[0] {
+		t.Errorf("Expected the header warning first, got %+v", header)
+	}
+	row := page.Items[1]
+	if row.RowNumber == nil || *row.RowNumber != 3 || row.Message != "row 3 engines: negative rpm" || row.Row["RPM"] != "-5" || row.Row["Engine"] != "ME-1" {
+		t.Errorf("Expected row 3 with its cells, got %+v", row)
+	}
+
+	var rest warningsPage
+	get(t, a, fmt.Sprintf("/uploads/%d/warnings?limit=2&after_id=%d", result.UploadID, *page.NextAfterID), &rest)
+	if len(rest.Items) != 1 || rest.Items[0].RowNumber == nil || *rest.Items[0].RowNumber != 4 || rest.NextAfterID != nil {
+		t.Errorf("Expected row 4 on the last page, got %+v", rest)
+	}
+
+	if status := get(t, a, "/uploads/999/warnings", nil); status != 404 {
+		t.Errorf("Expected 404 for an unknown upload, got %d", status)
+	}
+	if status := get(t, a, fmt.Sprintf("/uploads/%d/warnings?after_id=x", result.UploadID), nil); status != 400 {
+		t.Errorf("Expected 400 for a bad after_id, got %d", status)
+	}
+}
+
+func TestIngestSerialDates(t *testing.T) {
+	// Timestamps as real date cells and as bare serial numbers (date cells
+	// whose format was lost on export)
+	a := newTestApp(t)
+	file := workbook(t,
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM"},
+			{time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC), 1, 1500},
+			{45877.4375, 1, 1550}, // 2025-08-08 10:30
+		}},
+	)
+
+	result := ingest(t, a, file, "vessel_name=Serial%20Dates&period_start=2025-01-01T00:00:00Z")
+	if result.RowsInserted["engines"] != 2 {
+		t.Fatalf("Expected 2 engine rows, got %v", result.RowsInserted)
+	}
+
+	engines := telemetry(t, a, result.VesselID, "stream=engines")
+	if len(engines) != 2 {
+		t.Fatalf("Expected 2 engine readings, got %d", len(engines))
+	}
+	if engines[0]["ts"] != "2025-08-08T10:00:00Z" || engines[1]["ts"] != "2025-08-08T10:30:00Z" {
+		t.Errorf("Expected timestamps from the date cells, got %v and %v", engines[0]["ts"], engines[1]["ts"])
+	}
+}
+
+func TestCompareVessels(t *testing.T) {
+	a := newTestApp(t)
+	fuelSheet := func(rows ...[]interface{}) sheet {
+		return sheet{"Fuel Tanks", append([][]interface{}{{"Timestamp", "Tank No", "Volume Liters"}}, rows...)}
+	}
+
+	first := ingest(t, a, workbook(t, fuelSheet(
+		[]interface{}{"2025-08-08T06:00:00Z", "1", "1000"},
+		[]interface{}{"2025-08-08T18:00:00Z", "1", "800"},
+		[]interface{}{"2025-08-09T06:00:00Z", "1", "600"},
+	)), "vessel_name=Sister%20A")
+	second := ingest(t, a, workbook(t, fuelSheet(
+		[]interface{}{"2025-08-09T12:00:00Z", "1", "2000"},
+	)), "vessel_name=Sister%20B")
+
+	var result struct {
+		Buckets []string `json:"buckets"`
+		Series  []struct {
+			VesselID int64      `json:"vessel_id"`
+			Name     string     `json:"name"`
+			Avg      []*float64 `json:"avg"`
+			Count    []int64    `json:"count"`
+		} `json:"series"`
+	}
+	url := fmt.Sprintf("/compare?vessels=%d,%d&stream=fuel&metric=volume_liters&bucket=1d", first.VesselID, second.VesselID)
+	if status := get(t, a, url, &result); status != 200 {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+
+	if len(result.Buckets) != 2 || result.Buckets[0] != "2025-08-08T00:00:00Z" || result.Buckets[1] != "2025-08-09T00:00:00Z" {
+		t.Fatalf("Expected daily buckets for 8 and 9 August, got %v", result.Buckets)
+	}
+	if len(result.Series) != 2 || result.Series[0].Name != "Sister A" || result.Series[1].Name != "Sister B" {
+		t.Fatalf("Unexpected series %+v", result.Series)
+	}
+	a1 := result.Series[0]
+	if *a1.Avg[0] != 900 || a1.Count[0] != 2 || *a1.Avg[1] != 600 {
+		t.Errorf("Unexpected series for vessel A: avg %v count %v", a1.Avg, a1.Count)
+	}
+	b := result.Series[1]
+	if b.Avg[0] != nil || *b.Avg[1] != 2000 {
+		t.Errorf("Expected vessel B to start on 9 August, got avg %v", b.Avg)
+	}
+
+	// Tank 1 of vessel C logs every 45 minutes, then every 15: the plain
+	// average of 300, 100 and 100 is 166.7, the time-weighted one 220
+	third := ingest(t, a, workbook(t, fuelSheet(
+		[]interface{}{"2025-08-08T00:00:00Z", "1", "300"},
+		[]interface{}{"2025-08-08T00:45:00Z", "1", "100"},
+		[]interface{}{"2025-08-08T01:00:00Z", "1", "100"},
+	)), "vessel_name=Sister%20C")
+	weightedURL := fmt.Sprintf("/compare?vessels=%d&stream=fuel&metric=volume_liters&bucket=1d&weighting=time", third.VesselID)
+	result.Series = nil
+	if status := get(t, a, weightedURL, &result); status != 200 {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if c := result.Series[0]; len(c.Avg) != 1 || *c.Avg[0] != 220 || c.Count[0] != 3 {
+		t.Errorf("Expected a time-weighted average of 220, got avg %v count %v", c.Avg, c.Count)
+	}
+	// With readings standing for 30 minutes at most: (300*30 + 100*15 + 100*15) / 60
+	result.Series = nil
+	if get(t, a, weightedURL+"&max_gap=30m", &result); *result.Series[0].Avg[0] != 200 {
+		t.Errorf("Expected an average of 200 with max_gap, got %v", *result.Series[0].Avg[0])
+	}
+	if status := get(t, a, strings.Replace(weightedURL, "=time", "=mean", 1), nil); status != 400 {
+		t.Errorf("Expected 400 for an unknown weighting, got %d", status)
+	}
+
+	if status := get(t, a, "/compare?vessels=1,99&stream=fuel&metric=volume_liters", nil); status != 404 {
+		t.Errorf("Expected 404 for an unknown vessel, got %d", status)
+	}
+	if status := get(t, a, "/compare?vessels=1&stream=fuel&metric=tank_no", nil); status != 400 {
+		t.Errorf("Expected 400 for a non-metric column, got %d", status)
+	}
+}
+
+func TestTelemetryResample(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine", "RPM", "Temp C"},
+		{"2025-08-08T10:01:00Z", "1", "700", "80"},
+		{"2025-08-08T10:06:00Z", "1", "800", ""},
+		{"2025-08-08T10:11:00Z", "1", "900", "90"},
+		{"2025-08-08T10:03:00Z", "2", "500", "70"},
+	}}), "imo=9811000")
+	url := fmt.Sprintf("/vessels/%d/telemetry/resample?stream=engines&interval=5m", result.VesselID)
+
+	type resampled struct {
+		Timestamps []time.Time `json:"timestamps"`
+		Series     []struct {
+			Unit   interface{}           `json:"unit"`
+			Values map[string][]*float64 `json:"values"`
+		} `json:"series"`
+	}
+	var linear resampled
+	if status := get(t, a, url+"&metrics=rpm,temp_c", &linear); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	// 10:05 and 10:10, aligned to the interval
+	if len(linear.Timestamps) != 2 || linear.Timestamps[0].Minute() != 5 || linear.Timestamps[1].Minute() != 10 {
+		t.Fatalf("Unexpected timestamps %v", linear.Timestamps)
+	}
+	if len(linear.Series) != 2 || linear.Series[0].Unit != 1.0 || linear.Series[1].Unit != 2.0 {
+		t.Fatalf("Expected a series per engine, got %+v", linear.Series)
+	}
+	rpm, temp := linear.Series[0].Values["rpm"], linear.Series[0].Values["temp_c"]
+	if *rpm[0] != 780 || *rpm[1] != 880 || *temp[0] != 84 || *temp[1] != 89 {
+		t.Errorf("Unexpected interpolated engine 1 values %v %v", rpm, temp)
+	}
+	// Engine 2 has a single reading, before both points
+	if v := linear.Series[1].Values["rpm"]; v[0] != nil || v[1] != nil {
+		t.Errorf("Expected engine 2 to have no linear values, got %v", v)
+	}
+
+	var locf resampled
+	get(t, a, url+"&method=locf&engine_no=2&from=2025-08-08T10:00:00Z&to=2025-08-08T10:15:00Z", &locf)
+	if len(locf.Timestamps) != 4 || len(locf.Series) != 1 {
+		t.Fatalf("Expected 4 points of engine 2, got %+v", locf)
+	}
+	if v := locf.Series[0].Values["rpm"]; v[0] != nil || *v[1] != 500 || *v[3] != 500 {
+		t.Errorf("Expected engine 2's reading carried forward, got %v", v)
+	}
+	locf = resampled{}
+	get(t, a, url+"&method=locf&engine_no=2&max_gap=5m&to=2025-08-08T10:15:00Z", &locf)
+	if v := locf.Series[0].Values["rpm"]; len(v) != 3 || *v[0] != 500 || v[1] != nil {
+		t.Errorf("Expected nothing carried past max_gap, got %v", v)
+	}
+
+	for _, bad := range []string{
+		"stream=engines",
+		"stream=engines&interval=0s",
+		"stream=engines&interval=1500ms",
+		"stream=engines&interval=5m&method=cubic",
+		"stream=engines&interval=5m&metrics=alarms",
+		"stream=engines&interval=1s&from=2020-01-01T00:00:00Z",
+	} {
+		if status := get(t, a, fmt.Sprintf("/vessels/%d/telemetry/resample?%s", result.VesselID, bad), nil); status != 400 {
+			t.Errorf("Expected 400 for %s, got %d", bad, status)
+		}
+	}
+}
+
+func TestTelemetryDeltas(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t,
+		sheet{"Fuel Tanks", [][]interface{}{
+			{"Timestamp", "Tank No", "Volume Liters"},
+			{"2025-08-08T00:00:00Z", "1", "1000"},
+			{"2025-08-08T00:30:00Z", "1", "950"},
+			{"2025-08-08T02:30:00Z", "1", "850"},
+			{"2025-08-08T03:00:00Z", "1", "5850"},
+			{"2025-08-08T00:00:00Z", "2", "400"},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine", "RPM", "Running Hours"},
+			{"2025-08-08T00:00:00Z", "1", "700", "5200 h"},
+			{"2025-08-08T06:00:00Z", "1", "700", "5206 h"},
+			{"2025-08-08T12:00:00Z", "1", "0", "n/a"},
+			{"2025-08-09T00:00:00Z", "1", "700", "5212 h"},
+		}},
+	), "imo=9811000")
+	base := fmt.Sprintf("/vessels/%d/telemetry/deltas?", result.VesselID)
+
+	type deltasResult struct {
+		Units []struct {
+			Unit   interface{}    `json:"unit"`
+			Total  float64        `json:"total"`
+			Deltas []deltas.Delta `json:"deltas"`
+		} `json:"units"`
+	}
+	var fuel deltasResult
+	if status := get(t, a, base+"stream=fuel&metric=volume_liters&max_increase=500", &fuel); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	// Tank 2 has a single reading, so no deltas
+	if len(fuel.Units) != 2 || fuel.Units[0].Unit != 1.0 || len(fuel.Units[0].Deltas) != 3 || len(fuel.Units[1].Deltas) != 0 {
+		t.Fatalf("Unexpected units %+v", fuel.Units)
+	}
+	tank := fuel.Units[0]
+	if d := tank.Deltas[0]; *d.Delta != -50 || *d.Rate != -100 {
+		t.Errorf("Expected -50 liters at -100 per hour, got %+v", d)
+	}
+	if d := tank.Deltas[2]; d.Suppressed != deltas.Increase || d.Delta != nil || tank.Total != -150 {
+		t.Errorf("Expected the bunkering to be suppressed, got %+v, total %v", d, tank.Total)
+	}
+
+	// A running hours counter unmapped in extra_json, per day
+	var hours deltasResult
+	get(t, a, base+"stream=engines&extra=Running%20Hours&per=24h&engine_no=1", &hours)
+	if len(hours.Units) != 1 || len(hours.Units[0].Deltas) != 2 || hours.Units[0].Total != 12 {
+		t.Fatalf("Expected 2 running hours deltas totalling 12, got %+v", hours.Units)
+	}
+	if d := hours.Units[0].Deltas[1]; *d.Delta != 6 || *d.Rate != 8 {
+		t.Errorf("Expected 6 hours over 18, 8 a day, got %+v", d)
+	}
+
+	for _, bad := range []string{
+		"stream=fuel",
+		"stream=fuel&metric=volume_liters&extra=Running%20Hours",
+		"stream=fuel&metric=tank_no",
+		"stream=fuel&metric=volume_liters&per=0s",
+		"stream=fuel&metric=volume_liters&max_increase=-1",
+	} {
+		if status := get(t, a, base+bad, nil); status != 400 {
+			t.Errorf("Expected 400 for %s, got %d", bad, status)
+		}
+	}
+}
+
+func TestFleetUtilization(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := func(name, imo, fleet, ts string, speed float64) sheet {
+		return sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO", "Fleet", "Timestamp", "Latitude", "Longitude", "Speed(knots)"},
+			{name, imo, fleet, ts, "1.2", "103.8", speed},
+		}}
+	}
+
+	// Underway from 10:00 to 11:00; engine 1 runs 10:00-10:30 on 1 August
+	// and 23:30-00:30 across the end of the month
+	ingest(t, a, workbook(t, shipInfo("Ever Given", "9811000", "Evergreen", "2025-08-01T10:00:00Z", 12), sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-01T10:00:00Z", "1", "700"},
+		{"2025-08-01T10:30:00Z", "1", "0"},
+		{"2025-08-31T23:30:00Z", "1", "700"},
+		{"2025-09-01T00:30:00Z", "1", "0"},
+	}}), "imo=9811000")
+	ingest(t, a, workbook(t, shipInfo("Ever Given", "9811000", "Evergreen", "2025-08-01T11:00:00Z", 0)), "imo=9811000")
+	ingest(t, a, workbook(t, shipInfo("Ever Ace", "9893890", "Other", "2025-08-01T10:00:00Z", 12)), "imo=9893890")
+
+	var report struct {
+		Items []struct {
+			Name   string `json:"name"`
+			Months []struct {
+				Month         string  `json:"month"`
+				PeriodHours   float64 `json:"period_hours"`
+				EngineHours   float64 `json:"engine_hours"`
+				UnderwayHours float64 `json:"underway_hours"`
+			} `json:"months"`
+		} `json:"items"`
+	}
+	url := "/utilization?fleet=evergreen&from=2025-08-01T00:00:00Z&to=2025-10-01T00:00:00Z"
+	if status := get(t, a, url, &report); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(report.Items) != 1 || report.Items[0].Name != "Ever Given" || len(report.Items[0].Months) != 2 {
+		t.Fatalf("Expected two months of the Evergreen vessel, got %+v", report.Items)
+	}
+	aug, sep := report.Items[0].Months[0], report.Items[0].Months[1]
+	if aug.Month != "2025-08" || aug.PeriodHours != 31*24 || aug.EngineHours != 1 || aug.UnderwayHours != 1 || sep.EngineHours != 0.5 {
+		t.Errorf("Unexpected months %+v, %+v", aug, sep)
+	}
+
+	req := httptest.NewRequest("GET", url+"&format=csv", nil)
+	resp, err := a.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if lines := strings.Split(strings.TrimSpace(string(body)), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[1], "1,Ever Given,9811000,2025-08,744.00,1.00,1.00,") {
+		t.Errorf("Unexpected CSV:\n%s", body)
+	}
+
+	for _, query := range []string{
+		"from=2025-09-01T00:00:00Z&to=2025-08-01T00:00:00Z",
+		"from=2020-01-01T00:00:00Z&to=2025-01-01T00:00:00Z",
+		"format=xml",
+	} {
+		if status := get(t, a, "/utilization?"+query, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", query, status)
+		}
+	}
+}
+
+func TestVesselStats(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T10:00:00Z", "1", "1500"},
+		{"2025-08-08T11:00:00Z", "2", "1400"},
+		{"2025-08-09T10:00:00Z", "1", "1550"},
+	}}), "vessel_name=Stats")
+
+	var stats struct {
+		Items []struct {
+			Stream       string  `json:"stream"`
+			Rows         int64   `json:"rows"`
+			Earliest     *string `json:"earliest"`
+			Latest       *string `json:"latest"`
+			Units        *int64  `json:"units"`
+			LastUploadAt *string `json:"last_upload_at"`
+		} `json:"items"`
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/stats?stream=engines,location", result.VesselID), &stats); status != 200 {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if len(stats.Items) != 2 {
+		t.Fatalf("Expected 2 streams, got %d", len(stats.Items))
+	}
+
+	engines := stats.Items[0]
+	if engines.Stream != "engines" || engines.Rows != 3 || engines.Units == nil || *engines.Units != 2 {
+		t.Errorf("Unexpected engine stats %+v", engines)
+	}
+	if engines.Earliest == nil || *engines.Earliest != "2025-08-08T10:00:00Z" || engines.Latest == nil || *engines.Latest != "2025-08-09T10:00:00Z" {
+		t.Errorf("Unexpected engine time span %v - %v", engines.Earliest, engines.Latest)
+	}
+	if engines.LastUploadAt == nil {
+		t.Error("Expected a last upload time for engines")
+	}
+
+	location := stats.Items[1]
+	if location.Rows != 0 || location.Earliest != nil || location.Units != nil || location.LastUploadAt != nil {
+		t.Errorf("Expected empty location stats without units, got %+v", location)
+	}
+}
+
+func TestVesselSearch(t *testing.T) {
+	a := newTestApp(t)
+	vessel := func(imo, name, flag, vesselType, fleet, ts string) {
+		ingest(t, a, workbook(t,
+			sheet{"Ship Info", [][]interface{}{
+				{"Name", "IMO", "Flag", "Type", "Fleet", "Timestamp"},
+				{name, imo, flag, vesselType, fleet, ts},
+			}},
+			sheet{"Engines", [][]interface{}{{"Timestamp", "Engine No", "RPM"}, {ts, "1", "1500"}}},
+		), "imo="+imo)
+	}
+	vessel("9811001", "Nordic Star", "NO", "Tanker", "North", "2025-08-01T10:00:00Z")
+	vessel("9811002", "Nordic_Wind", "NO", "Bulk Carrier", "North", "2025-08-10T10:00:00Z")
+	vessel("9811003", "Southern Cross", "PA", "Tanker", "South", "2025-08-05T10:00:00Z")
+
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"", []string{"Nordic Star", "Nordic_Wind", "Southern Cross"}},
+		{"q=nordic", []string{"Nordic Star", "Nordic_Wind"}},
+		{"q=c_w", []string{"Nordic_Wind"}}, // _ is literal, not a wildcard
+		{"imo=9811003", []string{"Southern Cross"}},
+		{"flag=no&type=tanker", []string{"Nordic Star"}},
+		{"fleet=South", []string{"Southern Cross"}},
+		{"has_data_since=2025-08-05T00:00:00Z", []string{"Nordic_Wind", "Southern Cross"}},
+		{"sort=last_data&order=desc", []string{"Nordic_Wind", "Southern Cross", "Nordic Star"}},
+		{"sort=fleet&order=desc&q=nordic", []string{"Nordic Star", "Nordic_Wind"}},
+	}
+	for _, tt := range tests {
+		var vessels []struct {
+			Name  string  `json:"name"`
+			Fleet *string `json:"fleet"`
+		}
+		if status := get(t, a, "/vessels?"+tt.query, &vessels); status != 200 {
+			t.Fatalf("%s: expected status 200, got %d", tt.query, status)
+		}
+		var names []string
+		for _, v := range vessels {
+			names = append(names, v.Name)
+			if v.Fleet == nil {
+				t.Errorf("%s: expected fleet for %s", tt.query, v.Name)
+			}
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.names, names)
+		}
+	}
+
+	for _, query := range []string{"sort=size", "order=up", "has_data_since=yesterday"} {
+		if status := get(t, a, "/vessels?"+query, nil); status != 400 {
+			t.Errorf("%s: expected status 400, got %d", query, status)
+		}
+	}
+}
+
+func TestTelemetryOrder(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T10:00:00Z", "2", "1200"},
+		{"2025-08-08T10:00:00Z", "1", "1100"},
+		{"2025-08-08T11:00:00Z", "1", "1300"},
+		{"2025-08-08T12:00:00Z", "2", "1400"},
+		{"2025-08-08T12:00:00Z", "", "1500"},
+	}}), "vessel_name=Order")
+
+	// pages walks all pages two rows at a time and returns "ts engine_no" per row
+	pages := func(query string) []string {
+		var rows []string
+		cursor := ""
+		for n := 0; n < 10; n++ {
+			var page telemetryPage
+			u := fmt.Sprintf("/vessels/%d/telemetry?stream=engines&limit=2&%s&cursor=%s", result.VesselID, query, cursor)
+			if status := get(t, a, u, &page); status != 200 {
+				t.Fatalf("%s: expected status 200, got %d", u, status)
+			}
+			for _, item := range page.Items {
+				rows = append(rows, fmt.Sprintf("%s %v", item["ts"], item["engine_no"]))
+			}
+			if page.NextCursor == "" {
+				return rows
+			}
+			cursor = url.QueryEscape(page.NextCursor)
+		}
+		t.Fatalf("%s: too many pages", query)
+		return nil
+	}
+
+	tests := []struct {
+		query string
+		rows  []string
+	}{
+		{"order=asc&sort=engine_no", []string{
+			"2025-08-08T10:00:00Z 1", "2025-08-08T10:00:00Z 2", "2025-08-08T11:00:00Z 1",
+			"2025-08-08T12:00:00Z <nil>", "2025-08-08T12:00:00Z 2",
+		}},
+		{"order=desc&sort=engine_no", []string{
+			"2025-08-08T12:00:00Z 2", "2025-08-08T12:00:00Z <nil>", "2025-08-08T11:00:00Z 1",
+			"2025-08-08T10:00:00Z 2", "2025-08-08T10:00:00Z 1",
+		}},
+	}
+	for _, tt := range tests {
+		if got := pages(tt.query); fmt.Sprint(got) != fmt.Sprint(tt.rows) {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.rows, got)
+		}
+	}
+
+	// Plain desc pages run newest first without gaps or repeats
+	desc := pages("order=desc")
+	if len(desc) != 5 || desc[0][:20] != "2025-08-08T12:00:00Z" || desc[4][:20] != "2025-08-08T10:00:00Z" {
+		t.Errorf("Unexpected descending rows %v", desc)
+	}
+
+	var first telemetryPage
+	get(t, a, fmt.Sprintf("/vessels/%d/telemetry?stream=engines&limit=2&order=desc", result.VesselID), &first)
+	for _, query := range []string{
+		"order=sideways",
+		"sort=rpm",
+		"cursor=" + url.QueryEscape(first.NextCursor), // desc cursor on an asc request
+	} {
+		url := fmt.Sprintf("/vessels/%d/telemetry?stream=engines&%s", result.VesselID, query)
+		if status := get(t, a, url, nil); status != 400 {
+			t.Errorf("%s: expected status 400, got %d", query, status)
+		}
+	}
+}
+
+func TestTelemetryCSV(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM", "Remarks"},
+		{"2025-08-08T10:00:00Z", "1", "1100", "check, later"},
+		{"2025-08-08T11:00:00Z", "1", "1200", ""},
+		{"2025-08-08T12:00:00Z", "1", "1300", ""},
+	}}), "vessel_name=Delimited")
+
+	// fetch returns the status, Content-Type, Link and body of a page
+	fetch := func(path, accept string) (int, string, string, string) {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d/telemetry?stream=engines&%s", result.VesselID, path), nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := a.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), resp.Header.Get("Link"), string(body)
+	}
+
+	status, contentType, link, body := fetch("limit=2", "text/csv")
+	if status != 200 || !strings.HasPrefix(contentType, "text/csv") {
+		t.Fatalf("Expected CSV, got %d %q", status, contentType)
+	}
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id,ts,engine_no,rpm,") || !strings.Contains(lines[1], ",2025-08-08T10:00:00Z,1,1100,") {
+		t.Fatalf("Unexpected CSV %q", body)
+	}
+	if !strings.Contains(body, `"check, later"`) {
+		t.Errorf("Expected the delimiter in a value to be quoted, got %q", body)
+	}
+	if !strings.HasPrefix(link, "</vessels/") || !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Fatalf("Expected a link to the next page, got %q", link)
+	}
+	next := strings.TrimPrefix(strings.TrimSuffix(link, `>; rel="next"`), "<")
+	req := httptest.NewRequest("GET", next, nil)
+	req.Header.Set("Accept", "text/csv")
+	resp, err := a.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if lines := strings.Split(strings.TrimSpace(string(rest)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], ",1300,") || resp.Header.Get("Link") != "" {
+		t.Errorf("Unexpected last page %q (Link %q)", rest, resp.Header.Get("Link"))
+	}
+
+	if _, contentType, _, _ := fetch("format=csv", ""); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("Expected CSV for format=csv, got %q", contentType)
+	}
+	if _, contentType, _, _ := fetch("format=json", "text/csv"); contentType != "application/json" {
+		t.Errorf("Expected format=json to win over Accept, got %q", contentType)
+	}
+	if _, contentType, _, _ := fetch("", "text/csv;q=0.5, application/json"); contentType != "application/json" {
+		t.Errorf("Expected the preferred type, got %q", contentType)
+	}
+	if status, _, _, _ := fetch("format=xml", ""); status != 400 {
+		t.Errorf("Expected 400 for an unknown format, got %d", status)
+	}
+}
+
+func TestTelemetryFields(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM", "Remarks"},
+		{"2025-08-08T10:00:00Z", "1", "1100", "ok"},
+		{"2025-08-08T11:00:00Z", "1", "1200", "ok"},
+	}}), "vessel_name=Slim")
+
+	items := telemetry(t, a, result.VesselID, "stream=engines&fields=ts,rpm")
+	if len(items) != 2 || len(items[0]) != 2 || items[0]["ts"] != "2025-08-08T10:00:00Z" || items[0]["rpm"] != 1100.0 {
+		t.Errorf("Expected only ts and rpm, got %v", items)
+	}
+	var page telemetryPage
+	if get(t, a, fmt.Sprintf("/vessels/%d/telemetry?stream=engines&fields=ts&limit=1", result.VesselID), &page); page.NextCursor == "" {
+		t.Error("Expected pages of selected fields to continue")
+	}
+
+	var latest map[string]interface{}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/latest?stream=engines&fields=rpm", result.VesselID), &latest); status != 200 || len(latest) != 1 || latest["rpm"] != 1200.0 {
+		t.Errorf("Expected only rpm of the latest reading, got %d %v", status, latest)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d/telemetry?stream=engines&format=csv&fields=rpm,ts", result.VesselID), nil)
+	resp, err := a.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := "rpm,ts\n1100,2025-08-08T10:00:00Z\n1200,2025-08-08T11:00:00Z\n"; string(body) != want {
+		t.Errorf("Expected the CSV columns asked for, got %q", body)
+	}
+
+	for _, path := range []string{"telemetry?stream=engines&fields=ts,voltage_v", "latest?stream=engines&fields=tank_no"} {
+		if status := get(t, a, fmt.Sprintf("/vessels/%d/%s", result.VesselID, path), nil); status != 400 {
+			t.Errorf("%s: expected 400 for an unknown field, got %d", path, status)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	a := newTestApp(t)
+	rows := [][]interface{}{{"Timestamp", "Engine No", "RPM"}}
+	for i := 0; i < 100; i++ {
+		rows = append(rows, []interface{}{fmt.Sprintf("2025-08-08T%02d:%02d:00Z", i/60, i%60), "1", fmt.Sprint(1000 + i)})
+	}
+	result := ingest(t, a, workbook(t, sheet{"Engines", rows}), "vessel_name=Compressed")
+
+	for _, encoding := range []string{"gzip", "br"} {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d/telemetry?stream=engines&limit=100", result.VesselID), nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		resp, err := a.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 || resp.Header.Get("Content-Encoding") != encoding {
+			t.Errorf("%s: expected a compressed page, got %d %q", encoding, resp.StatusCode, resp.Header.Get("Content-Encoding"))
+		}
+		if json.Valid(body) {
+			t.Errorf("%s: expected the body not to be plain JSON", encoding)
+		}
+	}
+
+	var page telemetryPage
+	if get(t, a, fmt.Sprintf("/vessels/%d/telemetry?stream=engines&limit=100", result.VesselID), &page); len(page.Items) != 100 {
+		t.Errorf("Expected a plain page without Accept-Encoding, got %d items", len(page.Items))
+	}
+	if _, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), Compression: "max"}); err == nil {
+		t.Error("Expected an unknown compression level to be refused")
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	a := newTestApp(t)
+	engines := func(rpm string) []byte {
+		return workbook(t,
+			sheet{"Ship Info", [][]interface{}{{"IMO", "Name"}, {"9811000", "Polled"}}},
+			sheet{"Engines", [][]interface{}{
+				{"Timestamp", "Engine No", "RPM"},
+				{"2025-08-08T10:00:00Z", "1", rpm},
+			}},
+		)
+	}
+	result := ingest(t, a, engines("1100"), "imo=9811000")
+
+	// fetch returns the status and ETag of a GET, sent with If-None-Match
+	// and Accept if not empty
+	fetch := func(path, etag, accept string) (int, string) {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d%s", result.VesselID, path), nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := a.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == 200 && resp.Header.Get("Last-Modified") == "" {
+			t.Errorf("%s: expected Last-Modified", path)
+		}
+		return resp.StatusCode, resp.Header.Get("ETag")
+	}
+
+	for _, path := range []string{"", "/latest?stream=engines"} {
+		status, etag := fetch(path, "", "")
+		if status != 200 || !strings.HasPrefix(etag, `W/"`) {
+			t.Fatalf("%s: expected 200 with an ETag, got %d %q", path, status, etag)
+		}
+		if status, _ := fetch(path, etag, ""); status != 304 {
+			t.Errorf("%s: expected 304 for the current ETag, got %d", path, status)
+		}
+		if status, _ := fetch(path, `W/"other", `+etag, ""); status != 304 {
+			t.Errorf("%s: expected 304 when one of the ETags matches, got %d", path, status)
+		}
+		if status, halTag := fetch(path, etag, "application/hal+json"); status != 200 || halTag == etag {
+			t.Errorf("%s: expected the HAL representation to have its own ETag, got %d %q", path, status, halTag)
+		}
+
+		// An upsert that only updates a reading changes the ETag too
+		ingest(t, a, engines(fmt.Sprint(1200+len(path))), "imo=9811000&mode=upsert")
+		if status, newTag := fetch(path, etag, ""); status != 200 || newTag == etag {
+			t.Errorf("%s: expected 200 with a new ETag after ingest, got %d %q", path, status, newTag)
+		}
+	}
+
+	// Streams not written to have no validators to match
+	if status, etag := fetch("/latest?stream=fuel", "*", ""); status != 404 || etag != "" {
+		t.Errorf("Expected 404 without ETag for a stream without data, got %d %q", status, etag)
+	}
+}
+
+func TestStandby(t *testing.T) {
+	primary, err := New(config.Config{
+		DBPath:  filepath.Join(t.TempDir(), "primary.db"),
+		HARole:  "primary",
+		HAToken: "s3cret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { primary.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go primary.Listener(ln)
+	t.Cleanup(func() { primary.Shutdown() })
+
+	result := ingest(t, primary, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T10:00:00Z", "1", "1500"},
+	}}), "vessel_name=Replicated")
+
+	newStandby := func(token string) *App {
+		a, err := New(config.Config{
+			DBPath:         filepath.Join(t.TempDir(), "standby.db"),
+			HARole:         "standby",
+			HAPrimaryURL:   "http://" + ln.Addr().String(),
+			HAToken:        token,
+			HASyncInterval: time.Hour,
+			HASyncTimeout:  10 * time.Second,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { a.Close() })
+		return a
+	}
+
+	if err := newStandby("wrong").standby.SyncOnce(context.Background()); err == nil {
+		t.Error("Expected a sync with the wrong token to fail")
+	}
+
+	standby := newStandby("s3cret")
+	if err := standby.standby.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if rows := telemetry(t, standby, result.VesselID, "stream=engines"); len(rows) != 1 {
+		t.Errorf("Expected the standby to serve 1 replicated row, got %d", len(rows))
+	}
+
+	var status struct {
+		Role             string  `json:"role"`
+		ReadOnly         bool    `json:"read_only"`
+		PrimaryReachable *bool   `json:"primary_reachable"`
+		LastSyncAt       *string `json:"last_sync_at"`
+	}
+	get(t, standby, "/ha/status", &status)
+	if status.Role != "standby" || !status.ReadOnly || status.PrimaryReachable == nil || !*status.PrimaryReachable || status.LastSyncAt == nil {
+		t.Errorf("Unexpected standby status %+v", status)
+	}
+
+	// Writes are refused until the standby is promoted
+	file := workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T11:00:00Z", "1", "1600"},
+	}})
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", "telemetry.xlsx")
+	part.Write(file)
+	w.Close()
+	req := httptest.NewRequest("POST", "/ingest/xlsx?vessel_name=Promoted", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	if status := do(t, standby, req, nil); status != 503 {
+		t.Errorf("Expected ingest on a standby to be refused with 503, got %d", status)
+	}
+
+	if status := do(t, standby, httptest.NewRequest("POST", "/ha/promote", nil), nil); status != 403 {
+		t.Errorf("Expected promotion without the token to be refused with 403, got %d", status)
+	}
+	promote := func() *http.Request {
+		req := httptest.NewRequest("POST", "/ha/promote", nil)
+		req.Header.Set("X-HA-Token", "s3cret")
+		return req
+	}
+	if status := do(t, standby, promote(), &status); status != 200 {
+		t.Fatalf("Expected promotion to succeed, got %d", status)
+	}
+	if status.Role != "primary" || status.ReadOnly {
+		t.Errorf("Unexpected status after promotion %+v", status)
+	}
+	written := ingest(t, standby, file, "vessel_name=Promoted")
+	if rows := telemetry(t, standby, written.VesselID, "stream=engines"); len(rows) != 1 || written.VesselID == result.VesselID {
+		t.Errorf("Expected a new vessel with 1 row on the promoted standby, got vessel %d with %d rows", written.VesselID, len(rows))
+	}
+
+	if status := do(t, standby, promote(), nil); status != 409 {
+		t.Errorf("Expected a second promotion to be refused with 409, got %d", status)
+	}
+	if status := get(t, standby, "/ha/snapshot", nil); status != 404 {
+		t.Errorf("Expected a promoted standby not to serve snapshots, got %d", status)
+	}
+
+	// A primary without HA_TOKEN serves its database to no one
+	open, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "open.db"), HARole: "primary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { open.Close() })
+	if status := get(t, open, "/ha/snapshot", nil); status != 403 {
+		t.Errorf("Expected snapshots refused without HA_TOKEN, got %d", status)
+	}
+}
+
+func TestTelemetryProfile(t *testing.T) {
+	a := newTestApp(t)
+	rows := [][]interface{}{{"Timestamp", "Engine No", "RPM", "Temperature C", "Alarms"}}
+	for i, rpm := range []string{"1500", "1500", "1600", "", "1700", "1800", "1900", "2000"} {
+		temp := ""
+		if i == 0 {
+			temp = "85.5"
+		}
+		rows = append(rows, []interface{}{fmt.Sprintf("2025-08-08T%02d:00:00Z", i+1), "1", rpm, temp, "OK"})
+	}
+	result := ingest(t, a, workbook(t, sheet{"Engines", rows}), "imo=9811000&vessel_name=Alpha")
+
+	type profile struct {
+		RowCount int64 `json:"row_count"`
+		Fields   []struct {
+			Field         string        `json:"field"`
+			NullCount     int64         `json:"null_count"`
+			NullRate      float64       `json:"null_rate"`
+			Min           interface{}   `json:"min"`
+			Max           interface{}   `json:"max"`
+			DistinctCount int64         `json:"distinct_count"`
+			Samples       []interface{} `json:"samples"`
+		} `json:"fields"`
+	}
+	fetch := func(query string) profile {
+		t.Helper()
+		var p profile
+		url := fmt.Sprintf("/vessels/%d/telemetry/profile?stream=engines%s", result.VesselID, query)
+		if status := get(t, a, url, &p); status != 200 {
+			t.Fatalf("%s: expected 200, got %d", url, status)
+		}
+		return p
+	}
+
+	p := fetch("")
+	if p.RowCount != 8 {
+		t.Fatalf("Expected 8 rows, got %d", p.RowCount)
+	}
+	for _, f := range p.Fields {
+		switch f.Field {
+		case "rpm":
+			// Distinct values above the sample size give 5 samples
+			if f.NullCount != 1 || f.NullRate != 0.125 || f.Min != 1500.0 || f.Max != 2000.0 || f.DistinctCount != 6 || len(f.Samples) != 5 {
+				t.Errorf("Unexpected rpm profile %+v", f)
+			}
+		case "temp_c":
+			if f.NullCount != 7 || f.NullRate != 0.875 || f.Min != 85.5 || f.Max != 85.5 || f.DistinctCount != 1 || len(f.Samples) != 1 {
+				t.Errorf("Unexpected temp_c profile %+v", f)
+			}
+		case "alarms":
+			if f.NullRate != 0 || f.Min != "OK" || f.DistinctCount != 1 {
+				t.Errorf("Unexpected alarms profile %+v", f)
+			}
+		}
+	}
+
+	// from and to bound the rows profiled, both included
+	p = fetch("&from=2025-08-08T03:00:00Z&to=2025-08-08T05:00:00Z")
+	if p.RowCount != 3 {
+		t.Fatalf("Expected 3 rows from 03:00 to 05:00, got %d", p.RowCount)
+	}
+	for _, f := range p.Fields {
+		if f.Field == "rpm" && (f.NullCount != 1 || f.NullRate != 1.0/3 || f.Min != 1600.0 || f.Max != 1700.0 || f.DistinctCount != 2 || len(f.Samples) != 2) {
+			t.Errorf("Unexpected rpm profile from 03:00 to 05:00: %+v", f)
+		}
+	}
+
+	// No rows, no null rate
+	p = fetch("&from=2025-08-09T00:00:00Z")
+	for _, f := range p.Fields {
+		if p.RowCount != 0 || f.NullRate != 0 || f.Min != nil || len(f.Samples) != 0 {
+			t.Errorf("Expected an empty profile, got %d rows, %+v", p.RowCount, f)
+		}
+	}
+
+	for url, want := range map[string]int{
+		fmt.Sprintf("/vessels/%d/telemetry/profile", result.VesselID):                               400,
+		fmt.Sprintf("/vessels/%d/telemetry/profile?stream=radar", result.VesselID):                  400,
+		fmt.Sprintf("/vessels/%d/telemetry/profile?stream=engines&from=yesterday", result.VesselID): 400,
+		"/vessels/999/telemetry/profile?stream=engines":                                             404,
+	} {
+		if status := get(t, a, url, nil); status != want {
+			t.Errorf("%s: expected %d, got %d", url, want, status)
+		}
+	}
+}
+
+func TestVesselQuota(t *testing.T) {
+	a := newTestApp(t)
+	file := func(hour int) []byte {
+		return workbook(t, sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM"},
+			{fmt.Sprintf("2025-08-08T%02d:00:00Z", hour), "1", "1500"},
+			{fmt.Sprintf("2025-08-08T%02d:30:00Z", hour), "1", "1500"},
+		}})
+	}
+	result := ingest(t, a, file(10), "imo=9811000")
+	quotaURL := fmt.Sprintf("/vessels/%d/quota", result.VesselID)
+	put := func(body string, out interface{}) int {
+		req := httptest.NewRequest("PUT", quotaURL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+
+	var quota models.QuotaStatus
+	if status := put(`{"daily_row_limit": 2, "throttle": true}`, &quota); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if !quota.Override || quota.DailyRowLimit != 2 || !quota.Throttle || quota.RowsToday != 2 || quota.Exceeded {
+		t.Errorf("Unexpected quota %+v", quota)
+	}
+	var refused struct {
+		Error string `json:"error"`
+	}
+	if status := postIngest(t, a, file(11), "imo=9811000", &refused); status != 429 || !strings.Contains(refused.Error, "quota") {
+		t.Errorf("Expected 429 once the quota is used up, got %d %q", status, refused.Error)
+	}
+	if rows := telemetry(t, a, result.VesselID, "stream=engines"); len(rows) != 2 {
+		t.Errorf("Expected the refused file not written, got %d rows", len(rows))
+	}
+	if status := put(`{"daily_row_limit": -1}`, nil); status != 400 {
+		t.Errorf("Expected 400 for a negative limit, got %d", status)
+	}
+
+	// Resetting applies the deployment default, none here
+	if status := put(`{"reset": true}`, &quota); status != 200 || quota.Override || quota.DailyRowLimit != 0 {
+		t.Fatalf("Expected the override removed, got %d %+v", status, quota)
+	}
+	ingest(t, a, file(11), "imo=9811000")
+	get(t, a, quotaURL, &quota)
+	if quota.RowsToday != 4 || quota.Exceeded {
+		t.Errorf("Expected 4 rows today without a limit, got %+v", quota)
+	}
+}
+
+func TestTelemetryNotNull(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM", "Temperature C", "Alarms"},
+		{"2025-08-08T10:00:00Z", "1", "1500", "80", ""},
+		{"2025-08-08T11:00:00Z", "1", "1500", "", "HIGH TEMP"},
+		{"2025-08-08T12:00:00Z", "1", "1500", "95", "  "},
+		{"2025-08-08T13:00:00Z", "1", "1500", "96", "LOW OIL"},
+	}}), "vessel_name=Alarms")
+
+	alarms := telemetry(t, a, result.VesselID, "stream=engines&alarms_only=true")
+	if len(alarms) != 2 || alarms[0]["alarms"] != "HIGH TEMP" || alarms[1]["alarms"] != "LOW OIL" {
+		t.Errorf("Expected the two rows with alarms, got %v", alarms)
+	}
+	if rows := telemetry(t, a, result.VesselID, "stream=engines&alarms_only=true&not_null=temp_c"); len(rows) != 1 {
+		t.Errorf("Expected 1 row with alarms and temperature, got %d", len(rows))
+	}
+
+	for _, query := range []string{"stream=fuel&alarms_only=true", "stream=engines&not_null=nonsense"} {
+		if status := get(t, a, fmt.Sprintf("/vessels/%d/telemetry?%s", result.VesselID, query), nil); status != 400 {
+			t.Errorf("%s: expected status 400, got %d", query, status)
+		}
+	}
+}
+
+type alarmEvent struct {
+	EngineNo    *int    `json:"engine_no"`
+	Code        string  `json:"code"`
+	Severity    string  `json:"severity"`
+	Start       string  `json:"start"`
+	End         *string `json:"end"`
+	Occurrences int     `json:"occurrences"`
+}
+
+func alarmEvents(t *testing.T, a *App, vesselID int64, query string) []alarmEvent {
+	t.Helper()
+	var page struct {
+		Items []alarmEvent `json:"items"`
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/alarms?%s", vesselID, query), &page); status != 200 {
+		t.Fatalf("alarms %s: status %d", query, status)
+	}
+	return page.Items
+}
+
+func TestAlarmEvents(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO"},
+			{"Ever Given", "9811000"},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM", "Alarms"},
+			{"2025-08-08T10:00:00Z", "1", "1500", "HIGH TEMP"},
+			{"2025-08-08T10:00:00Z", "2", "1500", "Overspeed shutdown"},
+			{"2025-08-08T11:00:00Z", "1", "1500", "high temp; crit: LOW OIL"},
+			{"2025-08-08T12:00:00Z", "1", "1500", "OK"},
+		}},
+	), "imo=9811000")
+
+	events := alarmEvents(t, a, result.VesselID, "")
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 alarm events, got %+v", events)
+	}
+	high, overspeed, low := events[0], events[1], events[2]
+	if high.Code != "HIGH_TEMP" || *high.EngineNo != 1 || high.Start != "2025-08-08T10:00:00Z" ||
+		high.End == nil || *high.End != "2025-08-08T12:00:00Z" || high.Occurrences != 2 {
+		t.Errorf("Expected the repeated HIGH TEMP to pair into one event, got %+v", high)
+	}
+	if overspeed.Code != "OVERSPEED_SHUTDOWN" || overspeed.Severity != "critical" || overspeed.End != nil {
+		t.Errorf("Expected an active critical overspeed event, got %+v", overspeed)
+	}
+	if low.Code != "LOW_OIL" || low.Severity != "critical" || low.Start != "2025-08-08T11:00:00Z" {
+		t.Errorf("Unexpected LOW OIL event %+v", low)
+	}
+
+	for query, want := range map[string]int{
+		"severity=critical":         2,
+		"severity=warning,info":     1,
+		"active=true":               1,
+		"engine_no=1":               2,
+		"code=low oil":              1,
+		"to=2025-08-08T10:30:00Z":   2,
+		"from=2025-08-08T12:30:00Z": 1,
+		"from=2025-08-08T11:30:00Z": 3,
+	} {
+		if got := alarmEvents(t, a, result.VesselID, url.PathEscape(query)); len(got) != want {
+			t.Errorf("%s: expected %d events, got %d", query, want, len(got))
+		}
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/alarms?severity=bad", result.VesselID), nil); status != 400 {
+		t.Errorf("Expected 400 for an unknown severity, got %d", status)
+	}
+
+	// A corrected sheet keeps the alarm active at 12:00; the event is extended
+	// rather than duplicated
+	ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO"},
+			{"Ever Given", "9811000"},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM", "Alarms"},
+			{"2025-08-08T12:00:00Z", "1", "1500", "HIGH TEMP"},
+			{"2025-08-08T13:00:00Z", "1", "1500", "OK"},
+		}},
+	), "imo=9811000&mode=upsert")
+
+	events = alarmEvents(t, a, result.VesselID, "code=HIGH_TEMP")
+	if len(events) != 1 || events[0].End == nil || *events[0].End != "2025-08-08T13:00:00Z" || events[0].Occurrences != 3 {
+		t.Errorf("Expected one HIGH TEMP event until 13:00, got %+v", events)
+	}
+	if all := alarmEvents(t, a, result.VesselID, ""); len(all) != 3 {
+		t.Errorf("Expected still 3 events, got %+v", all)
+	}
+}
+
+func TestEngineRunningHours(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO"},
+		{"Ever Given", "9811000"},
+	}}
+	// Engine 1 logs its hour counter at noon, engine 2 only rpm
+	result := ingest(t, a, workbook(t, shipInfo,
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM", "Running Hours"},
+			{"2025-08-08T12:00:00Z", "1", "700", "5000 h"},
+			{"2025-08-09T12:00:00Z", "1", "700", "5020 h"},
+			{"2025-08-10T12:00:00Z", "1", "0", "5030 h"},
+			{"2025-08-08T22:00:00Z", "2", "700", ""},
+			{"2025-08-08T23:00:00Z", "2", "700", ""},
+			{"2025-08-09T00:00:00Z", "2", "0", ""},
+		}},
+	), "imo=9811000")
+	hoursURL := fmt.Sprintf("/vessels/%d/engines/running-hours", result.VesselID)
+
+	type runningHours struct {
+		Totals []struct {
+			EngineNo     *int     `json:"engine_no"`
+			Hours        float64  `json:"hours"`
+			Days         int      `json:"days"`
+			CounterHours *float64 `json:"counter_hours"`
+		} `json:"totals"`
+		Items []models.EngineRunningHours `json:"items"`
+	}
+	var hours runningHours
+	if status := get(t, a, hoursURL, &hours); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(hours.Totals) != 2 || len(hours.Items) != 4 {
+		t.Fatalf("Expected 2 engines over 4 days, got %+v", hours)
+	}
+	// The counter gains 20 and 10 hours between noons, split across the days
+	if total := hours.Totals[0]; *total.EngineNo != 1 || total.Hours != 30 || total.Days != 3 || *total.CounterHours != 5030 {
+		t.Errorf("Expected 30 counter hours on engine 1, got %+v", total)
+	}
+	if item := hours.Items[1]; item.Day != "2025-08-09" || item.Hours != 15 || item.Source != "counter" {
+		t.Errorf("Expected 15 hours on the 9th, got %+v", item)
+	}
+	if total := hours.Totals[1]; *total.EngineNo != 2 || total.Hours != 2 || total.CounterHours != nil || hours.Items[3].Source != "rpm" {
+		t.Errorf("Expected 2 rpm hours on engine 2, got %+v", total)
+	}
+
+	// The next noon reading adds to the 10th as well
+	ingest(t, a, workbook(t, shipInfo,
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM", "Running Hours"},
+			{"2025-08-11T12:00:00Z", "1", "700", "5054 h"},
+		}},
+	), "imo=9811000")
+	hours = runningHours{}
+	get(t, a, hoursURL+"?engine_no=1&from=2025-08-10", &hours)
+	if len(hours.Items) != 2 || hours.Items[0].Hours != 17 || hours.Items[1].Hours != 12 || hours.Totals[0].Hours != 29 {
+		t.Errorf("Expected 17 and 12 hours on the 10th and 11th, got %+v", hours)
+	}
+
+	for _, query := range []string{"?from=08/10/2025", "?engine_no=main"} {
+		if status := get(t, a, hoursURL+query, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", query, status)
+		}
+	}
+}
+
+func TestMaintenanceItems(t *testing.T) {
+	a := newTestApp(t)
+	day := func(offset int) string { return time.Now().UTC().AddDate(0, 0, offset).Format("2006-01-02") }
+	at := func(offset, hour int) string { return day(offset) + fmt.Sprintf("T%02d:00:00Z", hour) }
+	shipInfo := func(name, imo, fleet string) sheet {
+		return sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO", "Fleet"},
+			{name, imo, fleet},
+		}}
+	}
+	// The hour counter of engine 1 gains 20 hours a day; generator 1 runs
+	// three hours under load two days ago
+	result := ingest(t, a, workbook(t, shipInfo("Ever Given", "9811000", "Evergreen"),
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM", "Running Hours"},
+			{at(-21, 12), "1", "700", "5000"},
+			{at(-16, 12), "1", "700", "5100"},
+			{at(-11, 12), "1", "700", "5200"},
+			{at(-6, 12), "1", "700", "5300"},
+			{at(-1, 12), "1", "700", "5400"},
+		}},
+		sheet{"Generators", [][]interface{}{
+			{"Timestamp", "Gen No", "Load kW"},
+			{at(-2, 10), "1", "300"},
+			{at(-2, 11), "1", "300"},
+			{at(-2, 12), "1", "300"},
+			{at(-2, 13), "1", "0"},
+		}},
+	), "imo=9811000")
+	other := ingest(t, a, workbook(t, shipInfo("Ever Ace", "9893890", "Other")), "imo=9893890")
+	base := fmt.Sprintf("/vessels/%d/maintenance", result.VesselID)
+
+	post := func(path, body string, out interface{}) int {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	var overhaul models.MaintenanceItem
+	body := fmt.Sprintf(`{"equipment":"engine","unit_no":1,"task":" Overhaul injectors ","interval_hours":250,"last_done_on":%q}`, day(-11))
+	if status := post(base, body, &overhaul); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	// 9 days at 20 hours and half of yesterday since it was done
+	if overhaul.Task != "Overhaul injectors" || overhaul.HoursSinceDone != 190 || *overhaul.HoursRemaining != 60 || overhaul.Status != "due" {
+		t.Errorf("Expected the overhaul due in 60 hours, got %+v", overhaul)
+	}
+	post(base, `{"equipment":"engine","unit_no":1,"task":"Replace turbocharger","interval_hours":20000}`, nil)
+	var filters models.MaintenanceItem
+	post(base, fmt.Sprintf(`{"equipment":"generator","unit_no":1,"task":"Change oil filters","interval_hours":2,"interval_days":30,"last_done_on":%q}`, day(-40)), &filters)
+	if filters.HoursSinceDone != 3 || *filters.DueOn != day(-10) || *filters.DaysRemaining != -10 || filters.Status != "overdue" {
+		t.Errorf("Expected the filters 10 days overdue after 3 generator hours, got %+v", filters)
+	}
+	post(fmt.Sprintf("/vessels/%d/maintenance", other.VesselID), `{"equipment":"engine","unit_no":2,"task":"Inspect liners","interval_days":7,"last_done_on":"2020-01-01"}`, nil)
+
+	var list struct {
+		Items []models.MaintenanceItem `json:"items"`
+	}
+	get(t, a, base, &list)
+	if len(list.Items) != 3 || list.Items[1].Task != "Replace turbocharger" || list.Items[1].Status != "ok" || list.Items[1].LastDoneOn != day(0) {
+		t.Errorf("Expected 3 items, the turbocharger ok and done today, got %+v", list.Items)
+	}
+	list.Items = nil
+	get(t, a, base+"?status=due&within_hours=50", &list)
+	if len(list.Items) != 0 {
+		t.Errorf("Expected nothing due within 50 hours, got %+v", list.Items)
+	}
+
+	type dueList struct {
+		Items []struct {
+			VesselName string `json:"vessel_name"`
+			models.MaintenanceItem
+		} `json:"items"`
+	}
+	var due dueList
+	get(t, a, "/maintenance/due", &due)
+	if len(due.Items) != 3 || due.Items[0].Status != "overdue" || due.Items[2].ID != overhaul.ID || due.Items[2].VesselName != "Ever Given" {
+		t.Errorf("Expected 2 overdue items then the overhaul, got %+v", due.Items)
+	}
+	due = dueList{}
+	get(t, a, "/maintenance/due?fleet=evergreen", &due)
+	if len(due.Items) != 2 {
+		t.Errorf("Expected 2 items due in the fleet, got %+v", due.Items)
+	}
+
+	// Done yesterday: only yesterday's 10 hours count
+	var done models.MaintenanceItem
+	if status := post(fmt.Sprintf("%s/%d/done", base, overhaul.ID), fmt.Sprintf(`{"done_on":%q}`, day(-2)), &done); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if done.LastDoneOn != day(-2) || done.HoursSinceDone != 10 || done.Status != "ok" {
+		t.Errorf("Expected the overhaul ok after being done, got %+v", done)
+	}
+
+	for _, bad := range []string{
+		`{"equipment":"boiler","unit_no":1,"task":"Clean","interval_days":7}`,
+		`{"equipment":"engine","unit_no":0,"task":"Clean","interval_days":7}`,
+		`{"equipment":"engine","unit_no":1,"task":" ","interval_days":7}`,
+		`{"equipment":"engine","unit_no":1,"task":"Clean"}`,
+		`{"equipment":"engine","unit_no":1,"task":"Clean","interval_hours":-5}`,
+		fmt.Sprintf(`{"equipment":"engine","unit_no":1,"task":"Clean","interval_days":7,"last_done_on":%q}`, day(2)),
+	} {
+		if status := post(base, bad, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", bad, status)
+		}
+	}
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/vessels/%d/maintenance/%d", other.VesselID, overhaul.ID), nil)
+	if status := do(t, a, req, nil); status != 404 {
+		t.Errorf("Expected 404 deleting another vessel's item, got %d", status)
+	}
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("%s/%d", base, overhaul.ID), nil)
+	if status := do(t, a, req, nil); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if status := get(t, a, fmt.Sprintf("%s/%d", base, overhaul.ID), nil); status != 404 {
+		t.Errorf("Expected 404 after delete, got %d", status)
+	}
+}
+
+func TestEquipmentLog(t *testing.T) {
+	a := newTestApp(t)
+	day := func(offset int) string { return time.Now().UTC().AddDate(0, 0, offset).Format("2006-01-02") }
+	result := ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO"},
+			{"Ever Given", "9811000"},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM"},
+			{day(-5) + "T12:00:00Z", "1", "700"},
+		}},
+		sheet{"Fuel Tanks", [][]interface{}{
+			{"Timestamp", "Tank No", "Volume Liters"},
+			{day(-5) + "T12:00:00Z", "1", "1000"},
+		}},
+	), "imo=9811000")
+	vesselURL := fmt.Sprintf("/vessels/%d", result.VesselID)
+	logURL := vesselURL + "/equipment-log"
+
+	post := func(path, body string, out interface{}) int {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	var item models.MaintenanceItem
+	post(vesselURL+"/maintenance", fmt.Sprintf(`{"equipment":"engine","unit_no":1,"task":"Replace injectors","interval_days":90,"last_done_on":%q}`, day(-60)), &item)
+
+	// Maintenance completing the item takes its engine and task
+	var replaced models.EquipmentLogEntry
+	body := fmt.Sprintf(`{"kind":"maintenance","maintenance_item_id":%d,"description":"Injector 3 replaced","occurred_on":%q}`, item.ID, day(-3))
+	if status := post(logURL, body, &replaced); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if replaced.Title != "Replace injectors" || *replaced.Equipment != "engine" || *replaced.Unit != "1" || replaced.SensorID == nil || replaced.Status != nil {
+		t.Errorf("Expected the item's engine and task, got %+v", replaced)
+	}
+	get(t, a, fmt.Sprintf("%s/maintenance/%d", vesselURL, item.ID), &item)
+	if item.LastDoneOn != day(-3) || *item.DaysRemaining != 87 {
+		t.Errorf("Expected the item done 3 days ago, got %+v", item)
+	}
+
+	var defect models.EquipmentLogEntry
+	if status := post(logURL, `{"kind":"defect","equipment":"Tank","unit":"1","title":"Sounding pipe cap missing","severity":"major"}`, &defect); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if *defect.Equipment != "tank" || *defect.Status != "open" || *defect.Severity != "major" || defect.OccurredOn != day(0) || defect.ClosedOn != nil {
+		t.Errorf("Expected an open major tank defect found today, got %+v", defect)
+	}
+	post(logURL, fmt.Sprintf(`{"kind":"defect","title":"Hull paint damage","status":"closed","occurred_on":%q,"closed_on":%q}`, day(-10), day(-8)), nil)
+
+	var vessel struct {
+		OpenDefects       []models.EquipmentLogEntry `json:"open_defects"`
+		RecentMaintenance []models.EquipmentLogEntry `json:"recent_maintenance"`
+	}
+	req := httptest.NewRequest("GET", vesselURL, nil)
+	resp, err := a.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := resp.Header.Get("ETag")
+	if err := json.NewDecoder(resp.Body).Decode(&vessel); err != nil {
+		t.Fatal(err)
+	}
+	if len(vessel.OpenDefects) != 1 || vessel.OpenDefects[0].ID != defect.ID || len(vessel.RecentMaintenance) != 1 {
+		t.Errorf("Expected the open defect and the maintenance on the vessel, got %+v", vessel)
+	}
+
+	// Closing the defect
+	req = httptest.NewRequest("PUT", fmt.Sprintf("%s/%d", logURL, defect.ID),
+		strings.NewReader(`{"kind":"defect","equipment":"tank","unit":"1","title":"Sounding pipe cap missing","severity":"major","status":"closed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if status := do(t, a, req, &defect); status != 200 || *defect.ClosedOn != day(0) {
+		t.Errorf("Expected the defect closed today, got %d %+v", status, defect)
+	}
+	req = httptest.NewRequest("GET", vesselURL, nil)
+	req.Header.Set("If-None-Match", etag)
+	vessel.OpenDefects = nil
+	if status := do(t, a, req, &vessel); status != 200 || len(vessel.OpenDefects) != 0 {
+		t.Errorf("Expected the vessel to change with no open defects, got %d %+v", status, vessel.OpenDefects)
+	}
+
+	for query, want := range map[string]int{
+		"":                         3,
+		"?kind=defect":             2,
+		"?equipment=engine&unit=1": 1,
+		"?status=closed":           2,
+		"?from=" + day(-4):         2,
+		"?to=" + day(-4):           1,
+	} {
+		var list struct {
+			Items []models.EquipmentLogEntry `json:"items"`
+		}
+		get(t, a, logURL+query, &list)
+		if len(list.Items) != want {
+			t.Errorf("%q: expected %d entries, got %+v", query, want, list.Items)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"kind":"note","title":"x"}`,
+		`{"kind":"defect","equipment":"engine","unit":"9","title":"Leak"}`,
+		`{"kind":"defect","equipment":"boiler","unit":"1","title":"Leak"}`,
+		`{"kind":"defect","equipment":"engine","title":"Leak"}`,
+		`{"kind":"defect","title":"Leak","severity":"urgent"}`,
+		`{"kind":"maintenance","title":"Clean","severity":"minor"}`,
+		`{"kind":"maintenance","maintenance_item_id":999}`,
+		fmt.Sprintf(`{"kind":"defect","title":"Leak","status":"closed","occurred_on":%q,"closed_on":%q}`, day(-2), day(-3)),
+	} {
+		if status := post(logURL, bad, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", bad, status)
+		}
+	}
+}
+
+func TestNoonReports(t *testing.T) {
+	a := newTestApp(t)
+	// A day's sailing due east along the equator: 5 degrees, about 300 nm
+	day := func(lon, rob string, noonReport []interface{}, ts string) []byte {
+		return workbook(t,
+			sheet{"Ship Info", [][]interface{}{
+				{"Name", "IMO", "Timestamp", "Latitude", "Longitude"},
+				{"Equator", "9811000", ts, "0", lon},
+			}},
+			sheet{"Fuel", [][]interface{}{
+				{"Timestamp", "Tank", "Current Level(m3)"},
+				{ts, "1", rob},
+			}},
+			sheet{"Noon Report", [][]interface{}{
+				{"Date", "ROB", "Distance", "Avg Speed", "Weather", "Remarks"},
+				noonReport,
+			}},
+		)
+	}
+	reports := func(vesselID int64, query string) []models.NoonReport {
+		t.Helper()
+		var page struct {
+			Items []models.NoonReport `json:"items"`
+		}
+		if status := get(t, a, fmt.Sprintf("/vessels/%d/noon-reports?%s", vesselID, query), &page); status != 200 {
+			t.Fatalf("noon-reports %s: status %d", query, status)
+		}
+		return page.Items
+	}
+
+	// The first report has no previous position to measure from
+	result := ingest(t, a, day("0", "500", []interface{}{"2025-08-10T12:00:00Z", "500000", "290", "12.1", "BF 4", "Steaming"}, "2025-08-10T12:00:00Z"), "imo=9811000")
+	if result.RowsInserted["noon_reports"] != 1 {
+		t.Fatalf("Expected a noon report, got %v", result.RowsInserted)
+	}
+	// Distance and speed are under-reported by 20%
+	result = ingest(t, a, day("5", "480", []interface{}{"2025-08-11T12:00:00Z", "479500", "240", "10", "BF 5", ""}, "2025-08-11T12:00:00Z"), "imo=9811000")
+	flagged := 0
+	for _, w := range result.Warnings {
+		if strings.HasPrefix(w, "noon report 2025-08-11T12:00:00Z: ") {
+			flagged++
+		}
+	}
+	if flagged != 2 {
+		t.Errorf("Expected distance and speed warnings, got %v", result.Warnings)
+	}
+
+	items := reports(result.VesselID, "")
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 noon reports, got %+v", items)
+	}
+	first, second := items[0], items[1]
+	if first.Flagged || first.ComputedDistanceNM != nil || first.ComputedROBLiters == nil || *first.ComputedROBLiters != 500000 ||
+		first.Weather == nil || *first.Weather != "BF 4" {
+		t.Errorf("Unexpected first report %+v", first)
+	}
+	if !second.PeriodStart.Equal(first.ReportedAt) || second.ComputedDistanceNM == nil || *second.ComputedDistanceNM < 299 || *second.ComputedDistanceNM > 301 ||
+		second.ComputedAvgSpeedKnots == nil || *second.ComputedAvgSpeedKnots < 12.4 || *second.ComputedAvgSpeedKnots > 12.6 {
+		t.Fatalf("Unexpected second report %+v", second)
+	}
+	// 500 L off is within the tolerance
+	if len(second.Discrepancies) != 2 || second.Discrepancies[0].Field != "distance_nm" || second.Discrepancies[1].Field != "avg_speed_knots" ||
+		second.Discrepancies[0].Percent < 19.9 || second.Discrepancies[0].Percent > 20.1 {
+		t.Errorf("Unexpected discrepancies %+v", second.Discrepancies)
+	}
+	if got := reports(result.VesselID, "flagged=true"); len(got) != 1 || got[0].ID != second.ID {
+		t.Errorf("Expected the second report flagged, got %+v", got)
+	}
+	if got := reports(result.VesselID, "from=2025-08-11T00:00:00Z"); len(got) != 1 {
+		t.Errorf("Expected 1 report from 2025-08-11, got %+v", got)
+	}
+
+	// A corrected report replaces the flagged one in upsert mode
+	result = ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{{"Name", "IMO"}, {"Equator", "9811000"}}},
+		sheet{"Noon Report", [][]interface{}{
+			{"Date", "ROB", "Distance", "Avg Speed"},
+			{"2025-08-11T12:00:00Z", "479500", "300", "12.5"},
+		}},
+	), "imo=9811000&mode=upsert")
+	items = reports(result.VesselID, "")
+	if len(items) != 2 || items[1].ID != second.ID || items[1].Flagged || *items[1].DistanceNM != 300 {
+		t.Errorf("Expected the corrected report, got %+v", items)
+	}
+
+	var reconciled struct {
+		Items []models.NoonReport `json:"items"`
+	}
+	if status := do(t, a, httptest.NewRequest("POST", fmt.Sprintf("/vessels/%d/noon-reports/reconcile?from=2025-08-11T00:00:00Z", result.VesselID), nil), &reconciled); status != 200 || len(reconciled.Items) != 1 {
+		t.Errorf("reconcile: status %d, %+v", status, reconciled.Items)
+	}
+	if status := get(t, a, "/vessels/999/noon-reports", nil); status != 404 {
+		t.Errorf("Expected 404 for an unknown vessel, got %d", status)
+	}
+}
+
+func TestVesselDCS(t *testing.T) {
+	a := newTestApp(t)
+	day := func(ts, lon, volume string, noonReport ...interface{}) []byte {
+		return workbook(t,
+			sheet{"Ship Info", [][]interface{}{
+				{"Name", "IMO", "Type", "Timestamp", "Latitude", "Longitude", "Speed(knots)"},
+				{"Equator", "9811000", "Bulk Carrier", ts, "0", lon, "12.5"},
+			}},
+			sheet{"Fuel", [][]interface{}{{"Timestamp", "Tank", "Current"}, {ts, "1", volume}}},
+			sheet{"Noon Report", [][]interface{}{{"Date", "ROB", "Distance", "Avg Speed"}, noonReport}},
+		)
+	}
+	ingest(t, a, day("2025-08-10T12:00:00Z", "0", "500000", "2025-08-10T12:00:00Z", "500000", "290", "12.1"), "imo=9811000")
+	result := ingest(t, a, day("2025-08-11T12:00:00Z", "5", "480000", "2025-08-11T12:00:00Z", "481000", "300", "12.5"), "imo=9811000")
+
+	var report dcs.Report
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/dcs?year=2025&fuel_type=diesel_gas_oil", result.VesselID), &report); status != 200 {
+		t.Fatalf("dcs: status %d", status)
+	}
+	if *report.IMONumber != "9811000" || *report.ShipType != "Bulk Carrier" || report.Year != 2025 || report.PeriodStart != "2025-01-01" {
+		t.Errorf("Unexpected particulars %+v", report)
+	}
+	if report.Sources.Distance != dcs.Telemetry || report.DistanceNM == nil || *report.DistanceNM < 299 || *report.DistanceNM > 301 {
+		t.Errorf("Expected 300 nm from the telemetry, got %v from %s", report.DistanceNM, report.Sources.Distance)
+	}
+	if len(report.FuelConsumption) != 1 || report.FuelConsumption[0].Liters != 20000 || report.FuelConsumption[0].Tonnes != 17.8 ||
+		report.FuelConsumption[0].FuelType != "Diesel/Gas Oil" {
+		t.Errorf("Unexpected fuel consumption %+v", report.FuelConsumption)
+	}
+	v := report.Verification
+	if v.DistanceNM.NoonReports == nil || *v.DistanceNM.NoonReports != 590 || v.FuelLiters.NoonReports == nil || *v.FuelLiters.NoonReports != 19000 ||
+		v.NoonReports != 2 || v.Positions != 2 || len(v.Months) != 12 {
+		t.Errorf("Unexpected verification %+v", v)
+	}
+
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/dcs?year=2025&source=noon_reports", result.VesselID), &report); status != 200 ||
+		*report.DistanceNM != 590 || report.FuelConsumption[0].FuelType != "HFO" {
+		t.Errorf("Expected the noon report figures, got %d %+v", status, report)
+	}
+	for _, query := range []string{"year=1999", "year=3000", "fuel_type=lng", "density=0", "source=bdn"} {
+		if status := get(t, a, fmt.Sprintf("/vessels/%d/dcs?%s", result.VesselID, query), nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", query, status)
+		}
+	}
+}
+
+func TestVesselMRV(t *testing.T) {
+	a := newTestApp(t)
+	// Ship Info holds one position per workbook
+	position := func(ts, lat, lon, speed string, more ...sheet) ingestResult {
+		return ingest(t, a, workbook(t, append([]sheet{{"Ship Info", [][]interface{}{
+			{"Name", "IMO", "Timestamp", "Latitude", "Longitude", "Speed(knots)"},
+			{"Channel Trader", "9811000", ts, lat, lon, speed},
+		}}}, more...)...), "imo=9811000")
+	}
+	// Rotterdam to Felixstowe, a voyage departing from the EU
+	position("2025-08-10T00:00:00Z", "51.9", "4.2", "0")
+	position("2025-08-10T02:00:00Z", "51.9", "4.2", "0")
+	position("2025-08-10T06:00:00Z", "51.95", "3.0", "12")
+	position("2025-08-10T12:00:00Z", "51.95", "1.32", "0")
+	position("2025-08-10T14:00:00Z", "51.95", "1.32", "0")
+	result := position("2025-08-10T16:00:00Z", "51.9", "2.0", "12", sheet{"Fuel", [][]interface{}{
+		{"Timestamp", "Tank", "Current"},
+		{"2025-08-10T00:00:00Z", "1", "100000"},
+		{"2025-08-10T02:00:00Z", "1", "99900"},
+		{"2025-08-10T12:00:00Z", "1", "98000"},
+	}})
+
+	var report mrv.Report
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/mrv?year=2025&fuel_type=mgo&cargo_tonnes=5000", result.VesselID), &report); status != 200 {
+		t.Fatalf("mrv: status %d", status)
+	}
+	if len(report.Voyages) != 1 || len(report.Berths) != 1 {
+		t.Fatalf("Expected one voyage and one berth, got %+v %+v", report.Voyages, report.Berths)
+	}
+	v := report.Voyages[0]
+	if v.Type != mrv.FromEU || v.DeparturePort != "NLRTM" || v.ArrivalPort != "GBFXT" || v.HoursAtSea != 10 || v.TransportWork == nil {
+		t.Errorf("Unexpected voyage %+v", v)
+	}
+	if len(v.Fuel) != 1 || v.Fuel[0].FuelType != "MGO" || v.Fuel[0].Liters != 1900 || v.Fuel[0].Tonnes != 1.691 || v.CO2Tonnes != 5.421 {
+		t.Errorf("Unexpected voyage fuel %+v, %v t CO2", v.Fuel, v.CO2Tonnes)
+	}
+	if report.Berths[0].PortCode != "NLRTM" || report.Totals.CO2AtBerth != 0.285 || report.Totals.CO2Tonnes != 5.707 {
+		t.Errorf("Unexpected berth %+v, totals %+v", report.Berths[0], report.Totals)
+	}
+
+	fetch := func(format string) (string, []byte) {
+		t.Helper()
+		resp, err := a.Test(httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d/mrv?year=2025&format=%s", result.VesselID, format), nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			t.Fatalf("mrv %s: status %d %s", format, resp.StatusCode, body)
+		}
+		return resp.Header.Get("Content-Type"), body
+	}
+	contentType, body := fetch("csv")
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if !strings.HasPrefix(contentType, "text/csv") || len(lines) != 3 ||
+		!strings.HasPrefix(lines[1], "1,EU-non-EU,NLRTM,GBFXT,2025-08-10T02:00:00Z,2025-08-10T12:00:00Z,10.00,") {
+		t.Errorf("Unexpected CSV %q:\n%s", contentType, body)
+	}
+
+	_, body = fetch("xlsx")
+	f, err := excelize.OpenReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows("Per voyage")
+	if err != nil || len(rows) != 3 || rows[0][0] != "Voyage No" || rows[1][1] != mrv.FromEU {
+		t.Errorf("Unexpected voyage sheet %v (%v)", rows, err)
+	}
+	if annual, err := f.GetRows("Annual"); err != nil || len(annual) == 0 || annual[0][1] != "9811000" {
+		t.Errorf("Unexpected annual sheet %v (%v)", annual, err)
+	}
+
+	for _, query := range []string{"year=1999", "format=pdf", "fuel_type=kerosene", "cargo_tonnes=-1"} {
+		if status := get(t, a, fmt.Sprintf("/vessels/%d/mrv?%s", result.VesselID, query), nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", query, status)
+		}
+	}
+}
+
+func TestFuelDropAlerts(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO"},
+		{"Ever Given", "9811000"},
+	}}
+	engines := sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T09:00:00Z", "1", "1500"},
+		{"2025-08-08T10:00:00Z", "1", "0"},
+		{"2025-08-08T11:30:00Z", "1", "0"},
+		{"2025-08-08T12:30:00Z", "1", "0"},
+	}}
+	fuelDrops := func(vesselID int64, query string) []models.FuelDropAlert {
+		t.Helper()
+		var page struct {
+			Items []models.FuelDropAlert `json:"items"`
+		}
+		if status := get(t, a, fmt.Sprintf("/vessels/%d/fuel-drops?%s", vesselID, query), &page); status != 200 {
+			t.Fatalf("fuel-drops %s: status %d", query, status)
+		}
+		return page.Items
+	}
+
+	// Without engine or speed readings a drop is not suspicious
+	result := ingest(t, a, workbook(t, shipInfo, sheet{"Fuel", [][]interface{}{
+		{"Timestamp", "Tank", "Current"},
+		{"2025-08-08T10:00:00Z", "1", "10000"},
+		{"2025-08-08T11:00:00Z", "1", "9900"},
+		{"2025-08-08T12:00:00Z", "1", "9000"},
+		{"2025-08-08T13:00:00Z", "1", "8400"},
+		{"2025-08-08T14:00:00Z", "1", "8350"},
+	}}), "imo=9811000")
+	if got := fuelDrops(result.VesselID, ""); len(got) != 0 {
+		t.Fatalf("Expected no alerts without engine data, got %+v", got)
+	}
+
+	// Engines stopped from 10:00, so 11:00-13:00 is a suspicious drop
+	result = ingest(t, a, workbook(t, shipInfo, engines), "imo=9811000")
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "suspicious fuel drop: tank 1 lost 1500 L") {
+		t.Errorf("Expected a fuel drop warning, got %v", result.Warnings)
+	}
+	alerts := fuelDrops(result.VesselID, "")
+	if len(alerts) != 1 {
+		t.Fatalf("Expected one alert, got %+v", alerts)
+	}
+	alert := alerts[0]
+	if alert.TankNo == nil || *alert.TankNo != 1 || alert.DropLiters != 1500 || alert.RateLPH != 750 || alert.Reason != "engines_off" ||
+		!alert.Start.Equal(time.Date(2025, 8, 8, 11, 0, 0, 0, time.UTC)) || !alert.End.Equal(time.Date(2025, 8, 8, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected alert %+v", alert)
+	}
+
+	// Re-sending the engines rebuilds the alert without raising it again
+	result = ingest(t, a, workbook(t, shipInfo, engines), "imo=9811000&mode=upsert")
+	for _, w := range result.Warnings {
+		if strings.Contains(w, "fuel drop") {
+			t.Errorf("Expected the alert not to be raised again, got %q", w)
+		}
+	}
+	if again := fuelDrops(result.VesselID, ""); len(again) != 1 || !again[0].RaisedAt.Equal(alert.RaisedAt) {
+		t.Errorf("Expected the same alert, got %+v", again)
+	}
+
+	for query, want := range map[string]int{
+		"from=2025-08-08T13:30:00Z": 0,
+		"to=2025-08-08T11:00:00Z":   1,
+		"to=2025-08-08T10:30:00Z":   0,
+	} {
+		if got := fuelDrops(result.VesselID, url.PathEscape(query)); len(got) != want {
+			t.Errorf("%s: expected %d alerts, got %d", query, want, len(got))
+		}
+	}
+}
+
+func TestReadingSources(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO"},
+		{"Ever Given", "9811000"},
+	}}
+	result := ingest(t, a, workbook(t, shipInfo, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T10:00:00Z", "1", "1500"},
+	}}), "imo=9811000")
+	ingest(t, a, workbook(t, shipInfo, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T11:00:00Z", "1", "1450"},
+	}}), "imo=9811000&source=manual")
+
+	// A reading stored before sources were recorded
+	_, err := a.db.Exec(`INSERT INTO engine_readings (vessel_id, engine_no, ts, rpm, row_hash, extra_json) VALUES (?, 1, ?, 1400, 'legacy', ?)`,
+		result.VesselID, time.Date(2025, 8, 8, 12, 0, 0, 0, time.UTC), json.RawMessage("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := telemetry(t, a, result.VesselID, "stream=engines")
+	if len(all) != 3 || all[0]["source"] != "sensor" || all[1]["source"] != "manual" || all[2]["source"] != nil {
+		t.Fatalf("Expected sensor, manual and untagged readings, got %v", all)
+	}
+	for query, want := range map[string]int{
+		"source=sensor":                       1,
+		"source=manual,sensor":                2,
+		"exclude_source=manual":               2,
+		"source=sensor&exclude_source=sensor": 0,
+	} {
+		if got := telemetry(t, a, result.VesselID, "stream=engines&"+query); len(got) != want {
+			t.Errorf("%s: expected %d readings, got %d", query, want, len(got))
+		}
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/telemetry?stream=engines&source=guess", result.VesselID), nil); status != 400 {
+		t.Errorf("Expected 400 for an unknown source, got %d", status)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d/export?stream=engines&exclude_source=manual", result.VesselID), nil)
+	resp, err := a.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "source") || !strings.Contains(lines[1], "sensor") {
+		t.Errorf("Expected a header and two readings without the manual one, got %q", body)
+	}
+
+	var upload bytes.Buffer
+	w := multipart.NewWriter(&upload)
+	part, _ := w.CreateFormFile("file", "telemetry.xlsx")
+	part.Write(workbook(t, shipInfo))
+	w.Close()
+	req = httptest.NewRequest("POST", "/ingest/xlsx?imo=9811000&source=guess", &upload)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	if status := do(t, a, req, nil); status != 400 {
+		t.Errorf("Expected 400 for an upload with an unknown source, got %d", status)
+	}
+}
+
+func TestAISSource(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO", "Timestamp", "Latitude", "Longitude"},
+		{"Ever Given", "9811000", "2025-08-08T10:00:00Z", "1.25", "103.8"},
+	}}), "imo=9811000&source=synced")
+	vesselID := result.VesselID
+
+	// Positions as the AIS poller stores them
+	for hour := 11; hour <= 12; hour++ {
+		ts := time.Date(2025, 8, 8, hour, 0, 0, 0, time.UTC)
+		_, err := a.db.Exec(`INSERT INTO location_readings (vessel_id, ts, latitude, longitude, source, origin, row_hash, extra_json) VALUES (?, ?, 1.5, 104, ?, ?, ?, ?)`,
+			vesselID, ts, models.SourceSynced, models.OriginAIS, util.HashRow(vesselID, ts, "location", "source:ais"), json.RawMessage("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for query, want := range map[string]int{
+		"source=ais":                       2,
+		"source=synced":                    3,
+		"exclude_source=ais":               1,
+		"source=synced&exclude_source=ais": 1,
+		"source=ais,sensor":                2,
+	} {
+		if got := telemetry(t, a, vesselID, "stream=location&"+query); len(got) != want {
+			t.Errorf("%s: expected %d positions, got %d", query, want, len(got))
+		}
+	}
+	if got := telemetry(t, a, vesselID, "stream=engines&source=ais"); len(got) != 0 {
+		t.Errorf("Expected no AIS engine readings, got %v", got)
+	}
+}
+
+func TestTankRegistry(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO"},
+		{"Ever Given", "9811000"},
+	}}
+	result := ingest(t, a, workbook(t, shipInfo), "imo=9811000")
+	tankURL := fmt.Sprintf("/vessels/%d/tanks", result.VesselID)
+
+	put := func(path, body string, out interface{}) int {
+		req := httptest.NewRequest("PUT", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	var tank models.Tank
+	if status := put(tankURL+"/1", `{"name":"No. 1 HFO port","capacity_liters":50000,"fuel_type":"hfo"}`, &tank); status != 201 {
+		t.Fatalf("Expected 201 for a new tank, got %d", status)
+	}
+	if tank.TankNo != 1 || tank.FuelType == nil || *tank.FuelType != "HFO" || tank.CapacityLiters != 50000 {
+		t.Errorf("Unexpected tank %+v", tank)
+	}
+	if status := put(tankURL+"/1", `{"name":"No. 1 HFO port","capacity_liters":40000,"fuel_type":"HFO"}`, nil); status != 200 {
+		t.Errorf("Expected 200 for a replaced tank, got %d", status)
+	}
+	for body, want := range map[string]int{
+		`{"capacity_liters":0}`:                            400,
+		`{"capacity_liters":1000,"fuel_type":"COAL"}`:      400,
+		`{"tank_no":2,"capacity_liters":1000}`:             400,
+		`{"capacity_liters":1000,"name":"  ","tank_no":3}`: 200,
+	} {
+		if status := put(tankURL+"/3", body, nil); status != want && !(want == 200 && status == 201) {
+			t.Errorf("%s: expected %d, got %d", body, want, status)
+		}
+	}
+
+	var list struct {
+		Items []models.Tank `json:"items"`
+	}
+	get(t, a, tankURL, &list)
+	if len(list.Items) != 2 || list.Items[0].CapacityLiters != 40000 || list.Items[1].Name != nil {
+		t.Errorf("Unexpected tanks %+v", list.Items)
+	}
+
+	// Without a capacity column the registry fills in level_percent, and
+	// volumes above capacity are refused
+	result = ingest(t, a, workbook(t, shipInfo, sheet{"Fuel", [][]interface{}{
+		{"Timestamp", "Tank", "Current"},
+		{"2025-08-08T10:00:00Z", "1", "10000"},
+		{"2025-08-08T11:00:00Z", "1", "45000"},
+		{"2025-08-08T12:00:00Z", "2", "45000"},
+	}}), "imo=9811000")
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "exceeds the 40000 L capacity of tank 1") {
+		t.Errorf("Expected a capacity warning, got %v", result.Warnings)
+	}
+	fuel := telemetry(t, a, result.VesselID, "stream=fuel")
+	if len(fuel) != 2 || fuel[0]["level_percent"] != 25.0 || fuel[1]["level_percent"] != nil {
+		t.Errorf("Expected level_percent from the registry for tank 1 only, got %v", fuel)
+	}
+
+	del := func(path string) int {
+		return do(t, a, httptest.NewRequest("DELETE", path, nil), nil)
+	}
+	if status := del(tankURL + "/3"); status != 204 {
+		t.Errorf("Expected 204 deleting a tank, got %d", status)
+	}
+	if status := del(tankURL + "/3"); status != 404 {
+		t.Errorf("Expected 404 deleting it again, got %d", status)
+	}
+}
+
+func TestEngineRegistry(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO"},
+		{"Ever Given", "9811000"},
+	}}
+	result := ingest(t, a, workbook(t, shipInfo), "imo=9811000")
+	engineURL := fmt.Sprintf("/vessels/%d/engines", result.VesselID)
+
+	put := func(path, body string, out interface{}) int {
+		req := httptest.NewRequest("PUT", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	var engine models.Engine
+	body := `{"name":" Main engine ","maker":"MAN","model":"11G95ME-C","rated_rpm":80,"rated_power_kw":59300,"commissioned_on":"2018-09-01"}`
+	if status := put(engineURL+"/1", body, &engine); status != 201 {
+		t.Fatalf("Expected 201 for a new engine, got %d", status)
+	}
+	if engine.EngineNo != 1 || engine.Name == nil || *engine.Name != "Main engine" || engine.RatedRPM == nil || *engine.RatedRPM != 80 {
+		t.Errorf("Unexpected engine %+v", engine)
+	}
+	if status := put(engineURL+"/1", `{"name":"ME","rated_rpm":80}`, nil); status != 200 {
+		t.Errorf("Expected 200 for a replaced engine, got %d", status)
+	}
+	for body, want := range map[string]int{
+		`{"rated_rpm":0}`:                     400,
+		`{"rated_power_kw":-1}`:               400,
+		`{"commissioned_on":"01/09/2018"}`:    400,
+		`{"engine_no":3}`:                     400,
+		`{"name":"Aux engine","engine_no":2}`: 201,
+	} {
+		if status := put(engineURL+"/2", body, nil); status != want {
+			t.Errorf("%s: expected %d, got %d", body, want, status)
+		}
+	}
+
+	var list struct {
+		Items []models.Engine `json:"items"`
+	}
+	get(t, a, engineURL, &list)
+	if len(list.Items) != 2 || list.Items[0].Maker != nil || list.Items[1].RatedRPM != nil {
+		t.Errorf("Unexpected engines %+v", list.Items)
+	}
+
+	// Readings above the rated rpm are flagged but kept
+	result = ingest(t, a, workbook(t, shipInfo, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine", "RPM"},
+		{"2025-08-08T10:00:00Z", "1", "78"},
+		{"2025-08-08T11:00:00Z", "1", "86"},
+		{"2025-08-08T11:00:00Z", "2", "900"},
+	}}), "imo=9811000")
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "rpm 86 exceeds the rated 80 rpm of engine 1") {
+		t.Errorf("Expected an overspeed warning, got %v", result.Warnings)
+	}
+	if engines := telemetry(t, a, result.VesselID, "stream=engines"); len(engines) != 3 {
+		t.Errorf("Expected all 3 readings to be kept, got %d", len(engines))
+	}
+
+	del := func(path string) int {
+		return do(t, a, httptest.NewRequest("DELETE", path, nil), nil)
+	}
+	if status := del(engineURL + "/2"); status != 204 {
+		t.Errorf("Expected 204 deleting an engine, got %d", status)
+	}
+	if status := del(engineURL + "/2"); status != 404 {
+		t.Errorf("Expected 404 deleting it again, got %d", status)
+	}
+}
+
+func TestSensorRegistry(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO"},
+		{"Ever Given", "9811000"},
+	}}
+	result := ingest(t, a, workbook(t, shipInfo,
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine", "RPM"},
+			{"2025-08-08T10:00:00Z", "2", "700"},
+			{"2025-08-08T11:00:00Z", "10", "710"},
+			{"2025-08-08T12:00:00Z", "2", "720"},
+		}},
+		sheet{"CCTV", [][]interface{}{
+			{"Timestamp", "Camera", "Status"},
+			{"2025-08-08T10:00:00Z", "CAM-01", "OK"},
+		}},
+	), "imo=9811000")
+	sensorURL := fmt.Sprintf("/vessels/%d/sensors", result.VesselID)
+
+	var list struct {
+		Items []models.Sensor `json:"items"`
+	}
+	get(t, a, sensorURL, &list)
+	if len(list.Items) != 3 {
+		t.Fatalf("Expected 3 sensors, got %+v", list.Items)
+	}
+	cam, engine := list.Items[0], list.Items[1]
+	if cam.Kind != "camera" || cam.Unit != "CAM-01" || engine.Kind != "engine" || engine.Unit != "2" || list.Items[2].Unit != "10" {
+		t.Errorf("Unexpected sensors %+v", list.Items)
+	}
+	if !engine.FirstSeen.Equal(time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)) || !engine.LastSeen.Equal(time.Date(2025, 8, 8, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected first and last seen %v, %v", engine.FirstSeen, engine.LastSeen)
+	}
+	list.Items = nil
+	if get(t, a, sensorURL+"?stream=cctv", &list); len(list.Items) != 1 {
+		t.Errorf("Expected 1 camera, got %+v", list.Items)
+	}
+	if status := get(t, a, sensorURL+"?stream=location", nil); status != 400 {
+		t.Errorf("Expected 400 for a stream without units, got %d", status)
+	}
+
+	// Readings are linked to their sensor
+	byUnit := telemetry(t, a, result.VesselID, fmt.Sprintf("stream=engines&sensor=%d", engine.ID))
+	if len(byUnit) != 2 || byUnit[0]["engine_no"] != 2.0 || byUnit[1]["engine_no"] != 2.0 {
+		t.Errorf("Expected engine 2's readings, got %v", byUnit)
+	}
+
+	put := func(body string, out interface{}) int {
+		req := httptest.NewRequest("PUT", fmt.Sprintf("%s/%d", sensorURL, cam.ID), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	var edited models.Sensor
+	if status := put(`{"location":" Bridge wing ","installed_on":"2024-03-01"}`, &edited); status != 200 {
+		t.Fatalf("Expected 200 editing a sensor, got %d", status)
+	}
+	if edited.Location == nil || *edited.Location != "Bridge wing" || edited.UpdatedAt == nil || edited.Unit != "CAM-01" {
+		t.Errorf("Unexpected sensor %+v", edited)
+	}
+	if status := put(`{"installed_on":"01/03/2024"}`, nil); status != 400 {
+		t.Errorf("Expected 400 for an invalid date, got %d", status)
+	}
+	var fetched models.Sensor
+	get(t, a, fmt.Sprintf("%s/%d", sensorURL, cam.ID), &fetched)
+	if fetched.InstalledOn == nil || *fetched.InstalledOn != "2024-03-01" {
+		t.Errorf("Expected the edit to be kept, got %+v", fetched)
+	}
+	if status := get(t, a, sensorURL+"/999", nil); status != 404 {
+		t.Errorf("Expected 404 for an unknown sensor, got %d", status)
+	}
+
+	// Readings stored before the registry are registered and linked on start
+	_, err := a.db.Exec(`INSERT INTO engine_readings (vessel_id, engine_no, ts, rpm, row_hash, extra_json) VALUES (?, 3, ?, 650, 'legacy', ?)`,
+		result.VesselID, time.Date(2025, 8, 7, 12, 0, 0, 0, time.UTC), json.RawMessage("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(a.db); err != nil {
+		t.Fatal(err)
+	}
+	list.Items = nil
+	get(t, a, sensorURL+"?stream=engines", &list)
+	if len(list.Items) != 3 || list.Items[1].Unit != "3" {
+		t.Fatalf("Expected the legacy engine to be registered, got %+v", list.Items)
+	}
+	if legacy := telemetry(t, a, result.VesselID, fmt.Sprintf("stream=engines&sensor=%d", list.Items[1].ID)); len(legacy) != 1 {
+		t.Errorf("Expected the legacy reading to be linked, got %v", legacy)
+	}
+}
+
+func TestSensorSpikeFilters(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO"},
+		{"Ever Given", "9811000"},
+	}}
+	engines := func(rows ...[]interface{}) sheet {
+		return sheet{"Engines", append([][]interface{}{{"Timestamp", "Engine", "RPM", "Temp C"}}, rows...)}
+	}
+	result := ingest(t, a, workbook(t, shipInfo, engines(
+		[]interface{}{"2025-08-08T10:00:00Z", "1", "700", "81"},
+		[]interface{}{"2025-08-08T10:01:00Z", "1", "700", "82"},
+		[]interface{}{"2025-08-08T10:02:00Z", "1", "700", "80.5"},
+		[]interface{}{"2025-08-08T10:03:00Z", "1", "700", "83"},
+	)), "imo=9811000")
+	sensorURL := fmt.Sprintf("/vessels/%d/sensors", result.VesselID)
+	var list struct {
+		Items []models.Sensor `json:"items"`
+	}
+	get(t, a, sensorURL, &list)
+	if len(list.Items) != 1 || len(list.Items[0].Filters) != 0 {
+		t.Fatalf("Expected one sensor without filters, got %+v", list.Items)
+	}
+	filtersURL := fmt.Sprintf("%s/%d/filters", sensorURL, list.Items[0].ID)
+
+	put := func(body string, out interface{}) int {
+		req := httptest.NewRequest("PUT", filtersURL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	for _, bad := range []string{
+		`{"filters":[{"field":"alarms","method":"hampel"}]}`,
+		`{"filters":[{"field":"temp_c","method":"mean"}]}`,
+		`{"filters":[{"field":"temp_c","method":"median"}]}`,
+		`{"filters":[{"field":"temp_c","method":"clamp","low":90,"high":10}]}`,
+		`{"filters":[{"field":"temp_c","method":"hampel"},{"field":"temp_c","method":"clamp"}]}`,
+	} {
+		if status := put(bad, nil); status != 400 {
+			t.Errorf("Expected 400 for %s, got %d", bad, status)
+		}
+	}
+	var sensor models.Sensor
+	if status := put(`{"filters":[{"field":"temp_c","method":"hampel"}]}`, &sensor); status != 200 {
+		t.Fatalf("Expected 200 setting filters, got %d", status)
+	}
+	if len(sensor.Filters) != 1 || sensor.Filters[0].Window != 7 || sensor.Filters[0].Threshold != 3 {
+		t.Errorf("Expected the hampel defaults, got %+v", sensor.Filters)
+	}
+
+	// A disconnected sensor's reading is stored as the median of those before
+	result = ingest(t, a, workbook(t, shipInfo, engines(
+		[]interface{}{"2025-08-08T10:04:00Z", "1", "700", "65535"},
+		[]interface{}{"2025-08-08T10:05:00Z", "1", "700", "82.5"},
+	)), "imo=9811000")
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "temp_c 65535 is an outlier (hampel), stored as 81.5") {
+		t.Errorf("Expected an outlier warning, got %v", result.Warnings)
+	}
+	readings := telemetry(t, a, result.VesselID, "stream=engines")
+	if len(readings) != 6 || readings[4]["temp_c"] != 81.5 || readings[5]["temp_c"] != 82.5 {
+		t.Errorf("Expected the spike to be replaced, got %v", readings)
+	}
+
+	var outliers struct {
+		Items []models.Outlier `json:"items"`
+	}
+	get(t, a, fmt.Sprintf("/vessels/%d/outliers?stream=engines", result.VesselID), &outliers)
+	if len(outliers.Items) != 1 {
+		t.Fatalf("Expected 1 outlier, got %+v", outliers.Items)
+	}
+	if o := outliers.Items[0]; o.Raw != 65535 || o.Stored != 81.5 || o.Field != "temp_c" || o.Unit != "1" || o.Method != "hampel" {
+		t.Errorf("Unexpected outlier %+v", o)
+	}
+	outliers.Items = nil
+	if get(t, a, fmt.Sprintf("/vessels/%d/outliers?from=2025-08-08T11:00:00Z", result.VesselID), &outliers); len(outliers.Items) != 0 {
+		t.Errorf("Expected no outliers after 11:00, got %+v", outliers.Items)
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/outliers?stream=location", result.VesselID), nil); status != 400 {
+		t.Errorf("Expected 400 for a stream without units, got %d", status)
+	}
+}
+
+func TestCCTVSnapshots(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO"},
+		{"Ever Given", "9811000"},
+	}}
+	result := ingest(t, a, workbook(t, shipInfo, sheet{"CCTV", [][]interface{}{
+		{"Timestamp", "Camera", "Status", "Snapshot URL"},
+		{"2025-08-08T10:00:00Z", "CAM-01", "OK", "https://cams.example.com/CAM-01/1000.jpg"},
+		{"2025-08-08T11:00:00Z", "CAM-01", "OFFLINE", "ftp://cams.example.com/x.jpg"},
+	}}), "imo=9811000")
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "invalid snapshot url") {
+		t.Errorf("Expected an invalid snapshot url warning, got %v", result.Warnings)
+	}
+	camURL := fmt.Sprintf("/vessels/%d/cctv/CAM-01/snapshots", result.VesselID)
+
+	type snapshot struct {
+		ID       int64     `json:"id"`
+		TS       time.Time `json:"ts"`
+		URL      *string   `json:"url"`
+		ImageURL *string   `json:"image_url"`
+		Status   *string   `json:"status"`
+	}
+	var latest snapshot
+	if status := get(t, a, camURL+"/latest", &latest); status != 200 {
+		t.Fatalf("Expected the sheet's snapshot, got %d", status)
+	}
+	if latest.URL == nil || *latest.URL != "https://cams.example.com/CAM-01/1000.jpg" || latest.Status == nil || *latest.Status != "OK" || latest.ImageURL != nil {
+		t.Errorf("Unexpected snapshot %+v", latest)
+	}
+
+	upload := func(fields map[string]string, image []byte, out interface{}) int {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		for k, v := range fields {
+			w.WriteField(k, v)
+		}
+		if image != nil {
+			part, _ := w.CreateFormFile("image", "snapshot")
+			part.Write(image)
+		}
+		w.Close()
+		req := httptest.NewRequest("POST", camURL, &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return do(t, a, req, out)
+	}
+
+	// An image uploaded before its status reading is ingested
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+	if status := upload(map[string]string{"ts": "2025-08-08T12:00:00Z"}, png, nil); status != 201 {
+		t.Fatalf("Expected 201 uploading a snapshot, got %d", status)
+	}
+	ingest(t, a, workbook(t, shipInfo, sheet{"CCTV", [][]interface{}{
+		{"Timestamp", "Camera", "Status"},
+		{"2025-08-08T12:00:00Z", "CAM-01", "RECORDING"},
+	}}), "imo=9811000")
+	latest = snapshot{}
+	get(t, a, camURL+"/latest", &latest)
+	if latest.ImageURL == nil || latest.Status == nil || *latest.Status != "RECORDING" || !latest.TS.Equal(time.Date(2025, 8, 8, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the uploaded snapshot linked to its reading, got %+v", latest)
+	}
+
+	resp, err := a.Test(httptest.NewRequest("GET", *latest.ImageURL, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "image/png" || !bytes.Equal(image, png) {
+		t.Errorf("Expected the uploaded PNG, got %d %s (%d bytes)", resp.StatusCode, resp.Header.Get("Content-Type"), len(image))
+	}
+
+	for _, tc := range []struct {
+		name         string
+		status, want int
+	}{
+		{"text file", upload(nil, []byte("not an image"), nil), 415},
+		{"nothing", upload(map[string]string{"ts": "2025-08-08T13:00:00Z"}, nil, nil), 400},
+		{"bad ts", upload(map[string]string{"ts": "yesterday", "url": "https://cams.example.com/a.jpg"}, nil, nil), 400},
+		{"url only", upload(map[string]string{"url": "https://cams.example.com/a.jpg"}, nil, nil), 201},
+		{"no camera", get(t, a, fmt.Sprintf("/vessels/%d/cctv/CAM-09/snapshots/latest", result.VesselID), nil), 404},
+		{"no image", get(t, a, fmt.Sprintf("/vessels/%d/cctv/snapshots/1/image", result.VesselID), nil), 404},
+		{"no vessel", get(t, a, "/vessels/999/cctv/snapshots/1/image", nil), 404},
+	} {
+		if tc.status != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, tc.status)
+		}
+	}
+}
+
+func TestExtraFilters(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO"},
+			{"Ever Given", "9811000"},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine", "RPM", "Running Hours", "Mode"},
+			{"2025-08-08T10:00:00Z", "1", "700", "4800", "ECO"},
+			{"2025-08-08T11:00:00Z", "1", "710", "5200 h", "ECO"},
+			{"2025-08-08T12:00:00Z", "1", "720", "n/a", "FULL"},
+			{"2025-08-08T13:00:00Z", "1", "730", "", "FULL"},
+		}},
+	), "imo=9811000")
+
+	extra := func(filters ...string) string {
+		q := url.Values{"stream": {"engines"}, "extra": filters}
+		return q.Encode()
+	}
+	for _, tc := range []struct {
+		filters []string
+		want    int
+	}{
+		{[]string{"Running Hours>5000"}, 1},
+		{[]string{"Running Hours<=5200"}, 2},
+		{[]string{"Running Hours!=4800"}, 1}, // n/a and missing values never match
+		{[]string{"Mode=ECO"}, 2},
+		{[]string{"Mode=FULL", "Running Hours>0"}, 0},
+		{[]string{"mode=ECO"}, 0}, // keys match exactly
+	} {
+		if got := telemetry(t, a, result.VesselID, extra(tc.filters...)); len(got) != tc.want {
+			t.Errorf("%v: expected %d readings, got %d", tc.filters, tc.want, len(got))
+		}
+	}
+
+	var latest map[string]interface{}
+	get(t, a, fmt.Sprintf("/vessels/%d/latest?%s", result.VesselID, extra("Mode=ECO")), &latest)
+	if latest["rpm"] != 710.0 {
+		t.Errorf("Expected the latest ECO reading, got %v", latest)
+	}
+
+	for _, bad := range []string{"Running Hours", "Mode>ECO", ">5"} {
+		if status := get(t, a, fmt.Sprintf("/vessels/%d/telemetry?%s", result.VesselID, extra(bad)), nil); status != 400 {
+			t.Errorf("%q: expected 400, got %d", bad, status)
+		}
+	}
+}
+
+func TestKiosk(t *testing.T) {
+	// app.Test connections come from 0.0.0.0
+	_, onboard, _ := net.ParseCIDR("0.0.0.0/32")
+	newApp := func(networks []*net.IPNet) *App {
+		a, err := New(config.Config{
+			DBPath:        filepath.Join(t.TempDir(), "telemetry.db"),
+			KioskAPIKeys:  map[string]int64{"ecr-display": 1},
+			KioskNetworks: networks,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { a.Close() })
+		return a
+	}
+	a := newApp([]*net.IPNet{onboard})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	at := func(d time.Duration) string { return now.Add(-d).Format(time.RFC3339) }
+	own := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{at(30 * time.Hour), "1", "100"}, // outside the 24 h window
+		{at(2 * time.Hour), "1", "600"},
+		{at(75 * time.Minute), "1", "800"},
+		{at(time.Hour), "1", "700"},
+		{at(time.Hour), "2", "650"},
+	}}), "vessel_name=Alpha")
+	other := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{at(time.Hour), "1", "500"},
+	}}), "vessel_name=Beta")
+	if own.VesselID != 1 {
+		t.Fatalf("Expected the kiosk vessel to be 1, got %d", own.VesselID)
+	}
+
+	kiosk := func(a *App, method, url string, out interface{}) int {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("X-API-Key", "ecr-display")
+		return do(t, a, req, out)
+	}
+
+	var view struct {
+		VesselID int64  `json:"vessel_id"`
+		Name     string `json:"name"`
+		Streams  []struct {
+			Stream     string                   `json:"stream"`
+			Latest     []map[string]interface{} `json:"latest"`
+			Aggregates []struct {
+				Unit    interface{} `json:"unit"`
+				Metrics map[string]struct {
+					Count int64    `json:"count"`
+					Min   *float64 `json:"min"`
+					Avg   *float64 `json:"avg"`
+					Max   *float64 `json:"max"`
+				} `json:"metrics"`
+			} `json:"aggregates"`
+		} `json:"streams"`
+	}
+	if status := kiosk(a, "GET", "/vessels/1/kiosk", &view); status != 200 {
+		t.Fatalf("Expected the kiosk view, got %d", status)
+	}
+	if view.Name != "Alpha" || len(view.Streams) != len(store.StreamOrder) || view.Streams[0].Stream != "engines" {
+		t.Fatalf("Unexpected kiosk view %+v", view)
+	}
+	engines := view.Streams[0]
+	if len(engines.Latest) != 2 || engines.Latest[0]["rpm"] != 700.0 || engines.Latest[1]["rpm"] != 650.0 {
+		t.Errorf("Expected the latest rpm of both engines, got %v", engines.Latest)
+	}
+	if len(engines.Aggregates) != 2 {
+		t.Fatalf("Expected aggregates of both engines, got %+v", engines.Aggregates)
+	}
+	// 600 for 45 minutes, 800 and 700 for 15 each: the plain average is 700
+	rpm := engines.Aggregates[0].Metrics["rpm"]
+	if engines.Aggregates[0].Unit != 1.0 || rpm.Count != 3 || *rpm.Min != 600 || *rpm.Avg != 660 || *rpm.Max != 800 {
+		t.Errorf("Expected time-weighted 24 h aggregates of engine 1, got %+v", engines.Aggregates[0])
+	}
+	if fuel := view.Streams[1]; len(fuel.Latest) != 0 || len(fuel.Aggregates) != 0 {
+		t.Errorf("Expected no fuel data, got %+v", fuel)
+	}
+
+	if status := kiosk(a, "GET", "/vessels/1/latest?stream=engines", nil); status != 200 {
+		t.Errorf("Expected the latest reading of the own vessel, got %d", status)
+	}
+	for _, tc := range []struct{ method, url string }{
+		{"GET", fmt.Sprintf("/vessels/%d/kiosk", other.VesselID)},
+		{"GET", fmt.Sprintf("/vessels/%d/latest?stream=engines", other.VesselID)},
+		{"GET", "/vessels"},
+		{"GET", "/vessels/1/telemetry?stream=engines"},
+		{"GET", "/compare?stream=engines&metric=rpm"},
+		{"PUT", "/vessels/1/quota"},
+		{"POST", "/ingest/xlsx"},
+	} {
+		if status := kiosk(a, tc.method, tc.url, nil); status != 403 {
+			t.Errorf("%s %s: expected 403 for a kiosk key, got %d", tc.method, tc.url, status)
+		}
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/kiosk", other.VesselID), nil); status != 200 {
+		t.Errorf("Expected other keys to be unrestricted, got %d", status)
+	}
+
+	offboard := newApp(nil)
+	if status := kiosk(offboard, "GET", "/vessels/1/kiosk", nil); status != 403 {
+		t.Errorf("Expected a kiosk key from outside the onboard network to be refused, got %d", status)
+	}
+}
+
+func TestReadingUncertainty(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO"},
+		{"Ever Given", "9811000"},
+	}}
+
+	// Soundings at ±3% from the sheet, one reading out of range
+	result := ingest(t, a, workbook(t, shipInfo, sheet{"Fuel", [][]interface{}{
+		{"Timestamp", "Tank", "Capacity", "Current", "Uncertainty (%)"},
+		{"2025-08-08T10:00:00Z", "1", "50000", "10000", "3"},
+		{"2025-08-08T11:00:00Z", "1", "50000", "30000", ""},
+		{"2025-08-08T12:00:00Z", "1", "50000", "20000", "150"},
+	}}), "imo=9811000")
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "uncertainty out of range") {
+		t.Errorf("Expected an uncertainty warning, got %v", result.Warnings)
+	}
+	fuel := telemetry(t, a, result.VesselID, "stream=fuel")
+	if len(fuel) != 2 || fuel[0]["uncertainty_percent"] != 3.0 || fuel[1]["uncertainty_percent"] != nil {
+		t.Fatalf("Expected the estimate on the first reading only, got %v", fuel)
+	}
+
+	// The daily average of 20000 L is ±(10000 × 3% + 0) / 2
+	var compare struct {
+		Series []struct {
+			Avg         []*float64 `json:"avg"`
+			Uncertainty []*float64 `json:"uncertainty"`
+		} `json:"series"`
+	}
+	get(t, a, fmt.Sprintf("/compare?vessels=%d&stream=fuel&metric=volume_liters", result.VesselID), &compare)
+	if s := compare.Series[0]; len(s.Uncertainty) != 1 || *s.Avg[0] != 20000 || *s.Uncertainty[0] != 150 {
+		t.Errorf("Expected 20000 ± 150 L, got %+v", s)
+	}
+	compare.Series = nil
+	get(t, a, fmt.Sprintf("/compare?vessels=%d&stream=fuel&metric=temp_c", result.VesselID), &compare)
+	if compare.Series[0].Uncertainty != nil {
+		t.Errorf("Expected no uncertainty for temperatures, got %v", compare.Series[0].Uncertainty)
+	}
+
+	// The upload's default applies to fuel rates
+	result = ingest(t, a, workbook(t, shipInfo, sheet{"Generators", [][]interface{}{
+		{"Timestamp", "Generator", "Load", "Fuel Rate"},
+		{"2025-08-08T10:00:00Z", "1", "400", "100"},
+		{"2025-08-08T11:00:00Z", "1", "400", "100"},
+	}}), "imo=9811000&uncertainty_percent=5")
+	var report struct {
+		FuelLiters            float64  `json:"fuel_liters"`
+		FuelLitersUncertainty *float64 `json:"fuel_liters_uncertainty"`
+	}
+	get(t, a, fmt.Sprintf("/vessels/%d/generators/report", result.VesselID), &report)
+	if report.FuelLiters != 100 || report.FuelLitersUncertainty == nil || *report.FuelLitersUncertainty != 5 {
+		t.Errorf("Expected 100 ± 5 L, got %v ± %v", report.FuelLiters, report.FuelLitersUncertainty)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", "telemetry.xlsx")
+	part.Write(workbook(t, shipInfo))
+	w.Close()
+	req := httptest.NewRequest("POST", "/ingest/xlsx?imo=9811000&uncertainty_percent=-2", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	if status := do(t, a, req, nil); status != 400 {
+		t.Errorf("Expected 400 for a negative uncertainty, got %d", status)
+	}
+}
+
+func TestReferenceData(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	send := func(method, path, key, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		return do(t, a, req, nil)
+	}
+
+	var kinds struct{ Items []string }
+	get(t, a, "/reference", &kinds)
+	if len(kinds.Items) != 4 {
+		t.Errorf("Expected 4 kinds of reference data, got %v", kinds.Items)
+	}
+
+	// Bundled values are seeded
+	var hfo struct {
+		Code       string
+		Attributes map[string]float64
+	}
+	if status := get(t, a, "/reference/emission-factors/hfo", &hfo); status != 200 || hfo.Attributes["co2_factor"] != 3.114 {
+		t.Errorf("Expected the seeded HFO factor, got %d %+v", status, hfo)
+	}
+	if status := get(t, a, "/reference/ports/NLRTM", nil); status != 200 {
+		t.Errorf("Expected the seeded Rotterdam port, got %d", status)
+	}
+	if status := get(t, a, "/reference/colours", nil); status != 404 {
+		t.Errorf("Expected 404 for unknown reference data, got %d", status)
+	}
+
+	// Changes need an admin key
+	entry := `{"name": "Biodiesel (FAME)", "attributes": {"co2_factor": 2.834}}`
+	for _, key := range []string{"", "other-key"} {
+		if status := send("PUT", "/reference/emission-factors/FAME", key, entry); status != 403 {
+			t.Errorf("key %q: expected 403, got %d", key, status)
+		}
+	}
+	if status := send("PUT", "/reference/emission-factors/fame", "admin-key", entry); status != 201 {
+		t.Errorf("Expected 201 for a new entry, got %d", status)
+	}
+	if status := send("PUT", "/reference/emission-factors/FAME", "admin-key", entry); status != 200 {
+		t.Errorf("Expected 200 for a replaced entry, got %d", status)
+	}
+	if status := send("PUT", "/reference/emission-factors/FAME", "admin-key", `{"name": "No factor"}`); status != 400 {
+		t.Errorf("Expected 400 without co2_factor, got %d", status)
+	}
+	if status := send("PUT", "/reference/flags/PA", "admin-key", `{"code": "LR", "name": "Panama"}`); status != 400 {
+		t.Errorf("Expected 400 for a mismatched code, got %d", status)
+	}
+
+	var flags struct{ Items []struct{ Code string } }
+	get(t, a, "/reference/flags", &flags)
+	n := len(flags.Items)
+	if status := send("DELETE", "/reference/flags/PA", "admin-key", ""); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if status := send("DELETE", "/reference/flags/PA", "admin-key", ""); status != 404 {
+		t.Errorf("Expected 404 for a deleted flag, got %d", status)
+	}
+	get(t, a, "/reference/flags", &flags)
+	if len(flags.Items) != n-1 {
+		t.Errorf("Expected %d flags after deleting one, got %d", n-1, len(flags.Items))
+	}
+
+	port := `{"name": "Test Harbour", "country": "XX", "polygon": [[1, 1], [1, 2], [2, 2]]}`
+	if status := send("PUT", "/reference/ports/XXTST", "admin-key", port); status != 200 {
+		t.Errorf("Expected 200 for a stored port, got %d", status)
+	}
+	if status := send("DELETE", "/reference/ports/XXTST", "", ""); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	if status := send("DELETE", "/reference/ports/XXTST", "admin-key", ""); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+
+	// So does an import of the port index
+	ports := `[{"code": "XXTST", "name": "Test Harbour", "country": "XX", "polygon": [[1, 1], [1, 2], [2, 2]]}]`
+	for _, key := range []string{"", "other-key"} {
+		if status := send("POST", "/ports/import", key, ports); status != 403 {
+			t.Errorf("key %q: expected 403 for a port import, got %d", key, status)
+		}
+	}
+	if status := get(t, a, "/reference/ports/XXTST", nil); status != 404 {
+		t.Errorf("Expected the refused import not stored, got %d", status)
+	}
+	if status := send("POST", "/ports/import", "admin-key", ports); status != 200 {
+		t.Errorf("Expected 200 for an admin's port import, got %d", status)
+	}
+	if status := get(t, a, "/reference/ports/XXTST", nil); status != 200 {
+		t.Errorf("Expected the imported port, got %d", status)
+	}
+}
+
+func TestCCTVStatus(t *testing.T) {
+	a := newTestApp(t)
+	recent := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	earlier := time.Now().UTC().Add(-2 * time.Hour).Format(time.RFC3339)
+	old := time.Now().UTC().Add(-72 * time.Hour).Format(time.RFC3339)
+
+	ingest(t, a, workbook(t, sheet{"CCTV", [][]interface{}{
+		{"Timestamp", "Camera", "Status", "Uptime %"},
+		{earlier, "CAM-1", "OFFLINE", "10"},
+		{recent, "CAM-1", "OK", "99.5"},
+		{recent, "CAM-2", "OFFLINE", "0"},
+	}}), "vessel_name=Alpha")
+	ingest(t, a, workbook(t, sheet{"CCTV", [][]interface{}{
+		{"Timestamp", "Camera", "Status", "Uptime %"},
+		{old, "CAM-1", "OK", "100"},
+	}}), "vessel_name=Bravo")
+
+	var status struct {
+		Summary struct {
+			Cameras, Healthy, Unhealthy, Stale int
+		}
+		Items []struct {
+			Name    string
+			Cameras []struct {
+				CamID         string   `json:"cam_id"`
+				Status        string   `json:"status"`
+				UptimePercent *float64 `json:"uptime_percent"`
+				Stale         bool     `json:"stale"`
+			}
+		}
+	}
+	if code := get(t, a, "/cctv/status", &status); code != 200 {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if status.Summary.Cameras != 3 || status.Summary.Healthy != 1 || status.Summary.Unhealthy != 2 || status.Summary.Stale != 1 {
+		t.Errorf("Unexpected summary %+v", status.Summary)
+	}
+	if len(status.Items) != 2 || status.Items[0].Name != "Alpha" || len(status.Items[0].Cameras) != 2 {
+		t.Fatalf("Expected cameras grouped by vessel, got %+v", status.Items)
+	}
+	if cam := status.Items[0].Cameras[0]; cam.CamID != "CAM-1" || cam.Status != "OK" || cam.UptimePercent == nil || *cam.UptimePercent != 99.5 {
+		t.Errorf("Expected CAM-1's latest reading, got %+v", cam)
+	}
+	if !status.Items[1].Cameras[0].Stale {
+		t.Errorf("Expected Bravo's camera to be stale")
+	}
+
+	get(t, a, "/cctv/status?problems_only=true&stale_after=100h", &status)
+	if len(status.Items) != 1 || len(status.Items[0].Cameras) != 1 || status.Items[0].Cameras[0].CamID != "CAM-2" {
+		t.Errorf("Expected only the offline camera, got %+v", status.Items)
+	}
+	if code := get(t, a, "/cctv/status?stale_after=soon", nil); code != 400 {
+		t.Errorf("Expected 400 for an invalid stale_after, got %d", code)
+	}
+}
+
+func TestExportDedupe(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T10:00:00Z", "1", "1500"},
+	}}), "vessel_name=Alpha")
+
+	// The same reading stored twice under different row hashes
+	ts := time.Date(2025, 8, 8, 12, 0, 0, 0, time.UTC)
+	for _, hash := range []string{"first", "second"} {
+		_, err := a.db.Exec(`INSERT INTO engine_readings (vessel_id, engine_no, ts, rpm, source, row_hash, extra_json) VALUES (?, 1, ?, 1400, 'sensor', ?, ?)`,
+			result.VesselID, ts, hash, json.RawMessage(`{"note":"copy"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for query, want := range map[string]struct {
+		lines int
+		last  string
+	}{
+		"":                            {4, ""},
+		"&dedupe=true":                {4, "# duplicates_collapsed 1"},
+		"&dedupe=true&format=ndjson":  {3, `{"duplicates_collapsed":1}`},
+		"&dedupe=true&watermark=true": {6, "# duplicates_collapsed 1"},
+	} {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d/export?stream=engines%s", result.VesselID, query), nil)
+		resp, err := a.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		if len(lines) != want.lines {
+			t.Errorf("%q: expected %d lines, got %q", query, want.lines, body)
+			continue
+		}
+		if strings.Contains(query, "watermark") {
+			// The count is chained before the manifest, which does not count it
+			var v struct {
+				Intact bool  `json:"intact"`
+				Rows   int64 `json:"rows"`
+			}
+			verify := httptest.NewRequest("POST", "/exports/verify", bytes.NewReader(body))
+			verify.Header.Set("X-API-Key", "admin-key")
+			if status := do(t, a, verify, &v); status != 200 || !v.Intact || v.Rows != 2 {
+				t.Errorf("Expected an intact export of 2 rows, got %d %+v", status, v)
+			}
+			lines = lines[:len(lines)-1]
+		}
+		if want.last != "" && lines[len(lines)-1] != want.last {
+			t.Errorf("%q: expected the export to end with %s, got %q", query, want.last, body)
+		}
+	}
+}
+
+func TestExportWatermark(t *testing.T) {
+	a, err := New(config.Config{
+		DBPath:       filepath.Join(t.TempDir(), "telemetry.db"),
+		AdminAPIKeys: []string{"admin-key"},
+		APIKeyOrgs:   map[string]string{"partner-key": "acme"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T10:00:00Z", "1", "1500"},
+		{"2025-08-08T11:00:00Z", "1", "1510"},
+	}}), "vessel_name=Alpha")
+
+	export := func(query string) (string, string) {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d/export?stream=engines&%s", result.VesselID, query), nil)
+		req.Header.Set("X-API-Key", "partner-key")
+		resp, err := a.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.Header.Get("X-Export-Id")
+	}
+	verify := func(file, key string, out interface{}) int {
+		req := httptest.NewRequest("POST", "/exports/verify", strings.NewReader(file))
+		req.Header.Set("X-API-Key", key)
+		return do(t, a, req, out)
+	}
+
+	if plain, id := export("format=csv"); strings.HasPrefix(plain, "#") || id != "" {
+		t.Errorf("Expected no watermark unless requested, got %q", plain)
+	}
+
+	for _, format := range []string{"csv", "ndjson"} {
+		file, id := export("watermark=true&format=" + format)
+		if id == "" || !strings.Contains(file, id) {
+			t.Fatalf("%s: expected the export ID in the file, got %q", format, file)
+		}
+
+		var trace struct {
+			Watermark struct {
+				ExportID string `json:"export_id"`
+				Org      string `json:"org"`
+			}
+			Rows     int64
+			Intact   bool
+			Problems []string
+		}
+		if status := verify(file, "admin-key", &trace); status != 200 || !trace.Intact || trace.Watermark.Org != "acme" || trace.Rows != 2 {
+			t.Errorf("%s: expected an intact export for acme, got %d %+v", format, status, trace)
+		}
+
+		tampered := strings.Replace(file, "1510", "1600", 1)
+		if verify(tampered, "admin-key", &trace); trace.Intact || trace.Watermark.ExportID != id || len(trace.Problems) == 0 {
+			t.Errorf("%s: expected a tampered export to be traced but not intact, got %+v", format, trace)
+		}
+
+		var record struct {
+			Org  string
+			Rows *int64
+		}
+		if status := get(t, a, "/exports/"+id, nil); status != 403 {
+			t.Errorf("Expected 403 without an admin key, got %d", status)
+		}
+		req := httptest.NewRequest("GET", "/exports/"+id, nil)
+		req.Header.Set("X-API-Key", "admin-key")
+		if status := do(t, a, req, &record); status != 200 || record.Org != "acme" || record.Rows == nil || *record.Rows != 2 {
+			t.Errorf("%s: expected the completed export record, got %d %+v", format, status, record)
+		}
+	}
+
+	if status := verify("id,ts\n", "partner-key", nil); status != 403 {
+		t.Errorf("Expected 403 for a non-admin key, got %d", status)
+	}
+	if status := verify("id,ts\n", "admin-key", nil); status != 422 {
+		t.Errorf("Expected 422 for a file without a watermark, got %d", status)
+	}
+}
+
+func TestAuditChain(t *testing.T) {
+	a, err := New(config.Config{
+		DBPath:            filepath.Join(t.TempDir(), "telemetry.db"),
+		AdminAPIKeys:      []string{"admin-key"},
+		AuditChain:        true,
+		AuditChainStreams: []string{"fuel"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	fuel := func(volume string) []byte {
+		return workbook(t,
+			sheet{"Ship Info", [][]interface{}{{"Name", "IMO"}, {"Ever Given", "9811000"}}},
+			sheet{"Fuel Tanks", [][]interface{}{
+				{"Timestamp", "Tank No", "Volume Liters"},
+				{"2025-08-08T10:00:00Z", "1", "15000"},
+				{"2025-08-08T10:00:00Z", "2", volume},
+			}},
+			sheet{"Engines", [][]interface{}{
+				{"Timestamp", "Engine No", "RPM"},
+				{"2025-08-08T10:00:00Z", "1", "1500"},
+			}},
+		)
+	}
+	result := ingest(t, a, fuel("9000"), "imo=9811000")
+	do(t, a, httptest.NewRequest("POST", fmt.Sprintf("/vessels/%d/archive", result.VesselID), nil), nil)
+	ingest(t, a, fuel("8000"), "imo=9811000&mode=upsert&include_archived=true")
+
+	type verification struct {
+		OK       bool
+		Entries  int64
+		Problems []struct{ Seq int64 }
+		Head     struct {
+			Seq  int64
+			Hash string
+		}
+		Readings struct {
+			Checked, Changed, Deleted int64
+			Unchained                 map[string]int64
+		}
+	}
+	var v verification
+	get(t, a, "/audit/verify", &v)
+	// 2 fuel inserts, ingest, archive, 1 fuel update, ingest
+	if !v.OK || v.Entries != 6 || v.Readings.Checked != 2 || v.Readings.Unchained["fuel"] != 0 {
+		t.Fatalf("Expected an intact log of 6 entries over 2 readings, got %+v", v)
+	}
+	head := v.Head
+
+	var entries struct {
+		Items []struct {
+			Action   string
+			Actor    string
+			VesselID *int64 `json:"vessel_id"`
+			Detail   string
+		}
+	}
+	if status := get(t, a, "/audit?kind=audit", nil); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	req := httptest.NewRequest("GET", "/audit?kind=audit", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	do(t, a, req, &entries)
+	if len(entries.Items) != 3 || entries.Items[0].Action != "ingest" || entries.Items[1].Action != "vessel.archive" {
+		t.Fatalf("Expected ingest, archive and ingest entries, got %+v", entries.Items)
+	}
+	if e := entries.Items[0]; e.VesselID == nil || *e.VesselID != result.VesselID || !strings.Contains(e.Detail, "file_sha256") || !strings.HasPrefix(e.Actor, "ip:") {
+		t.Errorf("Expected the ingest entry to name the vessel, file and client, got %+v", e)
+	}
+
+	if _, err := a.db.Exec("DELETE FROM audit_log"); err == nil {
+		t.Error("Expected the audit log to refuse deletes")
+	}
+	if _, err := a.db.Exec("UPDATE audit_log SET action = 'x' WHERE seq = 1"); err == nil {
+		t.Error("Expected the audit log to refuse updates")
+	}
+
+	// Editing a chained reading behind the API's back is detected
+	if _, err := a.db.Exec("UPDATE fuel_tank_readings SET volume_liters = 1 WHERE tank_no = 2"); err != nil {
+		t.Fatal(err)
+	}
+	get(t, a, fmt.Sprintf("/audit/verify?anchor_seq=%d&anchor_hash=%s", head.Seq, head.Hash), &v)
+	if v.OK || v.Readings.Changed != 1 || len(v.Problems) != 1 {
+		t.Errorf("Expected the changed reading to be reported, got %+v", v)
+	}
+	get(t, a, fmt.Sprintf("/audit/verify?anchor_seq=%d&anchor_hash=bogus", head.Seq), &v)
+	if len(v.Problems) != 2 {
+		t.Errorf("Expected a mismatched anchor to be reported, got %+v", v.Problems)
+	}
+	if status := get(t, a, "/audit/verify?anchor_seq=1", nil); status != 400 {
+		t.Errorf("Expected 400 for an anchor without a hash, got %d", status)
+	}
+}
+
+func TestAuditChainAIS(t *testing.T) {
+	a, err := New(config.Config{
+		DBPath:            filepath.Join(t.TempDir(), "telemetry.db"),
+		AuditChain:        true,
+		AuditChainStreams: []string{"fuel", "location"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	result := ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{{"Name", "IMO"}, {"Ever Given", "9811000"}}}), "imo=9811000")
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"lat": 1.25, "lng": 103.8, "timestamp": "2025-08-08T10:00:00Z"}, {"lat": 1.5, "lng": 104, "timestamp": "2025-08-08T11:00:00Z"}]`))
+	}))
+	defer provider.Close()
+
+	// A poller on its own store, chaining like the app's
+	st := store.New(a.db)
+	st.ChainStreams(store.Streams["fuel"], store.Streams["location"])
+	ais.NewPoller(st, provider.URL+"?imo={imo}", "", outbound.Policy{Timeout: 5 * time.Second}).PollOnce(context.Background())
+
+	var v struct {
+		OK       bool
+		Readings struct {
+			Checked, Changed int64
+			Unchained        map[string]int64
+		}
+	}
+	get(t, a, "/audit/verify", &v)
+	if !v.OK || v.Readings.Checked != 2 || v.Readings.Unchained["location"] != 0 {
+		t.Fatalf("Expected both AIS positions chained and intact, got %+v", v)
+	}
+
+	if _, err := a.db.Exec("UPDATE location_readings SET latitude = 0 WHERE vessel_id = ? AND origin = ?", result.VesselID, models.OriginAIS); err != nil {
+		t.Fatal(err)
+	}
+	get(t, a, "/audit/verify", &v)
+	if v.OK || v.Readings.Changed != 2 {
+		t.Errorf("Expected the edited AIS positions reported, got %+v", v)
+	}
+}
+
+func TestGeneratorReport(t *testing.T) {
+	a := newTestApp(t)
+	file := workbook(t,
+		sheet{"Generators", [][]interface{}{
+			{"Timestamp", "Generator", "Load (kW)", "Fuel Rate"},
+			{"2025-08-08T10:00:00Z", "1", "300", "60"},
+			{"2025-08-08T10:00:00Z", "2", "100", "25"},
+			{"2025-08-08T11:00:00Z", "1", "200", "40"},
+			{"2025-08-08T11:00:00Z", "2", "200", "40"},
+			{"2025-08-08T12:00:00Z", "1", "0", "0"},
+			{"2025-08-08T12:00:00Z", "2", "0", "0"},
+		}},
+	)
+	result := ingest(t, a, file, "imo=9811000")
+
+	var report struct {
+		Readings   int
+		Generators []struct {
+			GenNo        int      `json:"gen_no"`
+			RunningHours float64  `json:"running_hours"`
+			AvgLoadKW    *float64 `json:"avg_load_kw"`
+			PeakLoadKW   *float64 `json:"peak_load_kw"`
+		}
+		Parallel struct {
+			Samples             int
+			MaxImbalancePercent *float64 `json:"max_imbalance_percent"`
+		}
+		EnergyKWh  float64  `json:"energy_kwh"`
+		SFCLPerKWh *float64 `json:"sfc_l_per_kwh"`
+	}
+	url := fmt.Sprintf("/vessels/%d/generators/report", result.VesselID)
+	if status := get(t, a, url, &report); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if report.Readings != 6 || len(report.Generators) != 2 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	gen1 := report.Generators[0]
+	if gen1.GenNo != 1 || gen1.RunningHours != 2 || *gen1.AvgLoadKW != 250 || *gen1.PeakLoadKW != 300 {
+		t.Errorf("Unexpected generator 1 %+v", gen1)
+	}
+	if report.EnergyKWh != 800 || *report.SFCLPerKWh != 165.0/800 {
+		t.Errorf("Expected 800 kWh at 165 L, got %v kWh and SFC %v", report.EnergyKWh, *report.SFCLPerKWh)
+	}
+	// 300/100 deviates 100 kW from the 200 kW mean
+	if report.Parallel.Samples != 2 || *report.Parallel.MaxImbalancePercent != 50 {
+		t.Errorf("Unexpected parallel stats %+v", report.Parallel)
+	}
+
+	if status := get(t, a, url+"?max_gap=soon", nil); status != 400 {
+		t.Errorf("Expected 400 for an invalid max_gap, got %d", status)
+	}
+	if status := get(t, a, "/vessels/999/generators/report", nil); status != 404 {
+		t.Errorf("Expected 404 for an unknown vessel, got %d", status)
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	a, err := New(config.Config{
+		DBPath:           filepath.Join(t.TempDir(), "telemetry.db"),
+		AdminAPIKeys:     []string{"admin-key"},
+		SignedURLSecrets: []string{"link-secret"},
+		SignedURLMaxTTL:  48 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T10:00:00Z", "1", "1500"},
+	}}), "vessel_name=Alpha")
+
+	sign := func(key, body string, out interface{}) int {
+		req := httptest.NewRequest("POST", "/signed-urls", strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		return do(t, a, req, out)
+	}
+	download := func(path string) (int, string, http.Header) {
+		resp, err := a.Test(httptest.NewRequest("GET", path, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), resp.Header
+	}
+
+	target := fmt.Sprintf(`"/vessels/%d/export?stream=engines&format=csv&watermark=true"`, result.VesselID)
+	if status := sign("partner-key", `{"url": `+target+`}`, nil); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	if status := sign("admin-key", `{"url": "/vessels"}`, nil); status != 400 {
+		t.Errorf("Expected 400 for a path that cannot be signed, got %d", status)
+	}
+	if status := sign("admin-key", `{"url": `+target+`, "expires_in": "72h"}`, nil); status != 400 {
+		t.Errorf("Expected 400 beyond SIGNED_URL_MAX_TTL, got %d", status)
+	}
+
+	var link struct {
+		VesselID  int64 `json:"vessel_id"`
+		Path      string
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if status := sign("admin-key", `{"url": `+target+`, "expires_in": "1h", "recipient": "Surveyor Ltd"}`, &link); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if link.VesselID != result.VesselID || time.Until(link.ExpiresAt) > time.Hour {
+		t.Errorf("Unexpected link %+v", link)
+	}
+
+	status, body, header := download(link.Path)
+	if status != 200 || !strings.Contains(body, "1500") || header.Get("Cache-Control") != "private, no-store" {
+		t.Fatalf("Expected the export through the link, got %d %q", status, body)
+	}
+	// The watermark names the key that signed the link and its recipient
+	var record struct {
+		Recipient string
+		Org       string
+	}
+	req := httptest.NewRequest("GET", "/exports/"+header.Get("X-Export-Id"), nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	do(t, a, req, &record)
+	if record.Org != "Surveyor Ltd" || record.Recipient == "" {
+		t.Errorf("Unexpected watermark record %+v", record)
+	}
+
+	if status, _, _ := download(strings.Replace(link.Path, "stream=engines", "stream=fuel", 1)); status != 403 {
+		t.Errorf("Expected 403 for a changed link, got %d", status)
+	}
+	if status, _, _ := download(strings.Replace(link.Path, "/export", "/generators/report", 1)); status != 403 {
+		t.Errorf("Expected 403 for a link moved to another download, got %d", status)
+	}
+	forged := url.Values{"stream": {"engines"}, "expires": {"9999999999"}, "signer": {"x"}, "signature": {"bogus"}}
+	if status, _, _ := download(fmt.Sprintf("/vessels/%d/export?%s", result.VesselID, forged.Encode())); status != 403 {
+		t.Errorf("Expected 403 for a forged signature, got %d", status)
+	}
+	path := fmt.Sprintf("/vessels/%d/export", result.VesselID)
+	expired := signedurl.Sign("link-secret", "GET", path, url.Values{"stream": {"engines"}}, signedurl.Link{Signer: "x", Expires: time.Now().Add(-time.Minute)})
+	if status, _, _ := download(path + "?" + expired); status != 410 {
+		t.Errorf("Expected 410 for an expired link, got %d", status)
+	}
+}
+
+func TestNewDataWebhook(t *testing.T) {
+	deliveries := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- body
+	}))
+	defer srv.Close()
+
+	a, err := New(config.Config{
+		DBPath:          filepath.Join(t.TempDir(), "telemetry.db"),
+		WebhookURLs:     []string{srv.URL},
+		WebhookStreams:  []string{"engines"},
+		WebhookInterval: 20 * time.Millisecond,
+		OutboxBatchSize: 100,
+		AdminAPIKeys:    []string{"admin-key"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T11:00:00Z", "1", "1500"},
+		{"2025-08-08T10:00:00Z", "2", "1400"},
+	}}), "vessel_name=Alpha")
+
+	type payload struct {
+		Event string
+		Items []struct {
+			VesselID  int64     `json:"vessel_id"`
+			Stream    string    `json:"stream"`
+			RowsAdded int64     `json:"rows_added"`
+			FirstTS   time.Time `json:"first_ts"`
+			LatestTS  time.Time `json:"latest_ts"`
+		}
+		HighWaterMarks map[string]int64 `json:"high_water_marks"`
+	}
+	// Rows are written one by one, so a run may catch the upload half done
+	var rows int64
+	var last payload
+	var firstTS time.Time
+	for rows < 2 {
+		select {
+		case body := <-deliveries:
+			last = payload{}
+			if err := json.Unmarshal(body, &last); err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected new-data webhooks for 2 rows, got %d", rows)
+		}
+		if last.Event != "data.available" || len(last.Items) != 1 {
+			t.Fatalf("Unexpected payload %+v", last)
+		}
+		item := last.Items[0]
+		if item.VesselID != result.VesselID || item.Stream != "engines" {
+			t.Errorf("Unexpected item %+v", item)
+		}
+		if firstTS.IsZero() || item.FirstTS.Before(firstTS) {
+			firstTS = item.FirstTS
+		}
+		rows += item.RowsAdded
+	}
+	if rows != 2 || last.HighWaterMarks["engines"] != 2 || !firstTS.Equal(time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)) ||
+		!last.Items[0].LatestTS.Equal(time.Date(2025, 8, 8, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected final payload %+v after %d rows", last, rows)
+	}
+
+	select {
+	case body := <-deliveries:
+		t.Errorf("Expected no further delivery without new data, got %s", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The cursor of the target has caught up with the outbox
+	req := httptest.NewRequest("GET", "/admin/outbox", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	var status struct {
+		Head      int64 `json:"head"`
+		Consumers []struct {
+			Consumer string `json:"consumer"`
+			Cursor   int64  `json:"cursor"`
+			Lag      int64  `json:"lag"`
+		} `json:"consumers"`
+	}
+	if code := do(t, a, req, &status); code != 200 {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if status.Head != 2 || len(status.Consumers) != 1 || status.Consumers[0].Consumer != "webhook:"+srv.URL || status.Consumers[0].Cursor != 2 || status.Consumers[0].Lag != 0 {
+		t.Errorf("Unexpected outbox status %+v", status)
+	}
+}
+
+func TestEdgeReplication(t *testing.T) {
+	central, err := New(config.Config{
+		DBPath:           filepath.Join(t.TempDir(), "central.db"),
+		ReplicationRole:  "central",
+		ReplicationToken: "s3cret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer central.Close()
+	// Pushes reach the central app over HTTP
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := httptest.NewRequest(r.Method, r.URL.String(), r.Body)
+		req.Header = r.Header
+		resp, err := central.Test(req, -1)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer srv.Close()
+
+	edge, err := New(config.Config{
+		DBPath:                filepath.Join(t.TempDir(), "edge.db"),
+		AdminAPIKeys:          []string{"admin-key"},
+		ReplicationRole:       "edge",
+		ReplicationCentralURL: srv.URL,
+		ReplicationToken:      "s3cret",
+		ReplicationEdgeID:     "alpha",
+		ReplicationInterval:   20 * time.Millisecond,
+		ReplicationBatchSize:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer edge.Close()
+
+	ingest(t, edge, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T10:00:00Z", "1", "1500"},
+		{"2025-08-08T11:00:00Z", "2", "1400"},
+	}}), "vessel_name=Alpha")
+
+	req := httptest.NewRequest("GET", "/admin/replication", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	var status struct {
+		Role    string           `json:"role"`
+		Cursors map[string]int64 `json:"cursors"`
+		Pending map[string]int64 `json:"pending"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if code := do(t, edge, req, &status); code != 200 {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		if status.Cursors["engines"] == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if status.Role != "edge" || status.Cursors["engines"] != 2 || status.Pending["engines"] != 0 {
+		t.Fatalf("Unexpected replication status %+v", status)
+	}
+
+	var vessels []map[string]interface{}
+	get(t, central, "/vessels", &vessels)
+	if len(vessels) != 1 || vessels[0]["name"] != "Alpha" {
+		t.Fatalf("Expected Alpha ashore, got %v", vessels)
+	}
+	engines := telemetry(t, central, int64(vessels[0]["id"].(float64)), "stream=engines")
+	if len(engines) != 2 || engines[1]["rpm"] != 1400.0 {
+		t.Errorf("Unexpected engine readings ashore %v", engines)
+	}
+
+	// An edit ashore reaches the edge
+	patch := func(a *App, id int64, body string) int {
+		req := httptest.NewRequest("PATCH", fmt.Sprintf("/vessels/%d", id), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, nil)
+	}
+	shoreID := int64(vessels[0]["id"].(float64))
+	if code := patch(central, shoreID, `{"name":"MV Alpha","flag":"PA"}`); code != 200 {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	for _, body := range []string{`{"imo":"9811000"}`, `{"name":null}`, `{}`, `[]`} {
+		if code := patch(central, shoreID, body); code != 400 {
+			t.Errorf("%s: expected 400, got %d", body, code)
+		}
+	}
+	if code := patch(central, 999, `{"flag":"PA"}`); code != 404 {
+		t.Errorf("Expected 404 for an unknown vessel, got %d", code)
+	}
+	var edgeVessels []map[string]interface{}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		get(t, edge, "/vessels", &edgeVessels)
+		if edgeVessels[0]["name"] == "MV Alpha" {
+			break
+		}
+	}
+	if edgeVessels[0]["name"] != "MV Alpha" || edgeVessels[0]["flag"] != "PA" {
+		t.Errorf("Expected the edit on the edge, got %v", edgeVessels)
+	}
+
+	// Pushes need the token, and only a central instance takes them
+	push := func(a *App, token string) int {
+		req := httptest.NewRequest("POST", "/replication/batches", strings.NewReader(`{"edge":"alpha","stream":"engines","vessels":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Replication-Token", token)
+		return do(t, a, req, nil)
+	}
+	if code := push(central, "wrong"); code != 401 {
+		t.Errorf("Expected 401 for a wrong token, got %d", code)
+	}
+	if code := push(central, "s3cret"); code != 200 {
+		t.Errorf("Expected 200 for an empty batch, got %d", code)
+	}
+	if code := push(edge, "s3cret"); code != 404 {
+		t.Errorf("Expected 404 from an edge, got %d", code)
+	}
+}
+
+func TestIngestWebhook(t *testing.T) {
+	deliveries := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	a, err := New(config.Config{
+		DBPath:            filepath.Join(t.TempDir(), "telemetry.db"),
+		IngestWebhookURLs: []string{srv.URL},
+		WebhookSecret:     "s3cret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-08T11:00:00Z", "1", "1500"},
+		{"2025-08-08T10:00:00Z", "2", "1400"},
+	}}), "vessel_name=Alpha")
+
+	var event struct {
+		Event        string         `json:"event"`
+		VesselID     int64          `json:"vessel_id"`
+		Filename     string         `json:"filename"`
+		Streams      []string       `json:"streams"`
+		RowsInserted map[string]int `json:"rows_inserted"`
+	}
+	select {
+	case r := <-deliveries:
+		body := <-bodies
+		if r.Header.Get("X-Webhook-Event") != "upload.ingested" || r.Header.Get("X-Webhook-Signature") != webhooks.Sign("s3cret", body) {
+			t.Errorf("Unexpected headers %v", r.Header)
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an upload.ingested webhook")
+	}
+	if event.Event != "upload.ingested" || event.VesselID != result.VesselID || event.Filename != "telemetry.xlsx" ||
+		len(event.Streams) != 1 || event.Streams[0] != "engines" || event.RowsInserted["engines"] != 2 {
+		t.Errorf("Unexpected event %+v", event)
+	}
+}
+
+func TestCDCFeed(t *testing.T) {
+	a := newTestApp(t)
+
+	engines := func(rpm string) []byte {
+		return workbook(t,
+			sheet{"Ship Info", [][]interface{}{{"Name", "IMO"}, {"Ever Given", "9811000"}}},
+			sheet{"Engines", [][]interface{}{
+				{"Timestamp", "Engine No", "RPM"},
+				{"2025-08-08T10:00:00Z", "1", rpm},
+				{"2025-08-08T10:00:00Z", "2", "1400"},
+			}},
+		)
+	}
+	result := ingest(t, a, engines("1500"), "imo=9811000")
+
+	type feed struct {
+		Items []struct {
+			Seq       int64
+			Op        string
+			Stream    string
+			VesselID  int64 `json:"vessel_id"`
+			ReadingID int64 `json:"reading_id"`
+			Row       map[string]interface{}
+		}
+		NextToken string `json:"next_token"`
+		HeadToken string `json:"head_token"`
+		HasMore   bool   `json:"has_more"`
+	}
+
+	var page feed
+	if status := get(t, a, "/cdc?limit=1", &page); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(page.Items) != 1 || page.Items[0].Op != "insert" || page.Items[0].Stream != "engines" ||
+		page.Items[0].VesselID != result.VesselID || !page.HasMore || page.NextToken != "1" || page.HeadToken != "2" {
+		t.Fatalf("Unexpected first page %+v", page)
+	}
+
+	// Updates carry the row as it is now; deletes carry none
+	ingest(t, a, engines("1550"), "imo=9811000&mode=upsert")
+	if _, err := a.db.Exec("DELETE FROM engine_readings WHERE engine_no = 2"); err != nil {
+		t.Fatal(err)
+	}
+	get(t, a, "/cdc?since="+page.NextToken, &page)
+	var ops []string
+	for _, item := range page.Items {
+		ops = append(ops, item.Op)
+	}
+	if strings.Join(ops, ",") != "insert,update,delete" || page.HasMore || page.NextToken != "4" {
+		t.Fatalf("Unexpected changes %v in %+v", ops, page)
+	}
+	if page.Items[1].Row["rpm"] != 1550.0 {
+		t.Errorf("Expected the updated row, got %v", page.Items[1].Row)
+	}
+	// The insert of the deleted reading no longer has a row
+	if page.Items[0].Row != nil || page.Items[2].Row != nil {
+		t.Errorf("Expected no row for the deleted reading, got %v and %v", page.Items[0].Row, page.Items[2].Row)
+	}
+
+	get(t, a, "/cdc?since=4", &page)
+	if len(page.Items) != 0 || page.NextToken != "4" {
+		t.Errorf("Expected an empty page at the head, got %+v", page)
+	}
+	if status := get(t, a, "/cdc?since=99", nil); status != 400 {
+		t.Errorf("Expected 400 for a token ahead of the log, got %d", status)
+	}
+
+	// A consumer whose next change was pruned has to start over
+	if _, err := a.db.Exec("DELETE FROM cdc_log WHERE seq <= 2"); err != nil {
+		t.Fatal(err)
+	}
+	var gone struct {
+		HeadToken string `json:"head_token"`
+	}
+	if status := get(t, a, "/cdc?since=1", &gone); status != 410 || gone.HeadToken != "4" {
+		t.Errorf("Expected 410 with the head token, got %d %+v", status, gone)
+	}
+	if status := get(t, a, "/cdc?since=2", nil); status != 200 {
+		t.Errorf("Expected 200 right after the pruned changes, got %d", status)
+	}
+}
+
+func TestCustomStreams(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+
+	send := func(method, path, key, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		return do(t, a, req, nil)
+	}
+
+	def := `{
+		"description": "Scrubber washwater pumps",
+		"sheets": ["Scrubber"],
+		"unit_column": "pump_no",
+		"columns": [
+			{"name": "pump_no", "type": "int", "headers": ["Pump No", "pump"]},
+			{"name": "flow_m3h", "type": "float", "headers": ["Flow"], "min": 0, "max": 500},
+			{"name": "mode", "type": "text"}
+		]
+	}`
+	if status := send("PUT", "/streams/custom/scrubber", "", def); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	if status := send("PUT", "/streams/custom/scrubber", "admin-key", def); status != 201 {
+		t.Fatalf("Expected 201 for a new stream, got %d", status)
+	}
+	if status := send("PUT", "/streams/custom/scrubber", "admin-key", def); status != 200 {
+		t.Errorf("Expected 200 for a redefined stream, got %d", status)
+	}
+	if status := send("PUT", "/streams/custom/fuel", "admin-key", def); status != 400 {
+		t.Errorf("Expected 400 for a built-in name, got %d", status)
+	}
+
+	var defs struct {
+		Items []struct {
+			Name    string
+			Sheets  []string
+			Columns []struct{ Name, Type string }
+		}
+	}
+	get(t, a, "/streams/custom", &defs)
+	if len(defs.Items) != 1 || defs.Items[0].Sheets[0] != "scrubber" || len(defs.Items[0].Columns) != 3 {
+		t.Fatalf("Expected the scrubber stream, got %+v", defs.Items)
+	}
+
+	result := ingest(t, a, workbook(t, sheet{"Scrubber Log", [][]interface{}{
+		{"Timestamp", "Pump No", "Flow", "Mode", "Operator"},
+		{"2024-01-01T00:00:00Z", "P1", "120", "fill", "AB"},
+		{"2024-01-01T00:00:00Z", "P2", "80", "", ""},
+		{"2024-01-01T01:00:00Z", "P1", "900", "fill", ""}, // out of range
+		{"2024-01-01T02:00:00Z", "P1", "130", "drain", ""},
+	}}), "vessel_name=Alpha")
+	if result.RowsInserted["scrubber"] != 3 {
+		t.Errorf("Expected 3 scrubber rows, got %v", result.RowsInserted)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "flow_m3h out of range (0-500)") {
+		t.Errorf("Expected a range warning, got %v", result.Warnings)
+	}
+
+	var page struct {
+		Items []struct {
+			TS        time.Time
+			Unit      *string
+			Values    map[string]interface{}
+			ExtraJSON map[string]interface{} `json:"extra_json"`
+		}
+		NextCursor string `json:"next_cursor"`
+	}
+	url := fmt.Sprintf("/vessels/%d/custom/scrubber?limit=2", result.VesselID)
+	if status := get(t, a, url, &page); status != 200 || len(page.Items) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected a first page of 2, got %d %+v", status, page)
+	}
+	if first := page.Items[0]; *first.Unit != "1" || first.Values["flow_m3h"] != 120.0 || first.Values["mode"] != "fill" || first.ExtraJSON["Operator"] != "AB" {
+		t.Errorf("Unexpected first reading %+v", first)
+	}
+	cursor := page.NextCursor
+	page.Items, page.NextCursor = nil, ""
+	get(t, a, url+"&cursor="+cursor, &page)
+	if len(page.Items) != 1 || page.NextCursor != "" || page.Items[0].Values["mode"] != "drain" {
+		t.Errorf("Expected the last reading on the second page, got %+v", page)
+	}
+	page.Items = nil
+	get(t, a, fmt.Sprintf("/vessels/%d/custom/scrubber?unit=2", result.VesselID), &page)
+	if len(page.Items) != 1 || page.Items[0].Values["flow_m3h"] != 80.0 {
+		t.Errorf("Expected the reading of pump 2, got %+v", page.Items)
+	}
+
+	var latest struct{ Values map[string]interface{} }
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/custom/scrubber/latest?unit=1", result.VesselID), &latest); status != 200 || latest.Values["flow_m3h"] != 130.0 {
+		t.Errorf("Expected the latest reading of pump 1, got %d %+v", status, latest)
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/custom/bilge", result.VesselID), nil); status != 404 {
+		t.Errorf("Expected 404 for an unknown stream, got %d", status)
+	}
+
+	if status := send("DELETE", "/streams/custom/scrubber", "admin-key", ""); status != 409 {
+		t.Errorf("Expected 409 for a stream with readings, got %d", status)
+	}
+	if status := send("DELETE", "/streams/custom/scrubber?purge=true", "admin-key", ""); status != 204 {
+		t.Errorf("Expected 204 with purge, got %d", status)
+	}
+	if status := get(t, a, "/streams/custom/scrubber", nil); status != 404 {
+		t.Errorf("Expected 404 for a deleted stream, got %d", status)
+	}
+}
+
+func TestHypermedia(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2024-01-01T00:00:00Z", "1", "600"},
+		{"2024-01-01T01:00:00Z", "1", "650"},
+	}}), "vessel_name=Alpha")
+
+	type links map[string]struct {
+		Href      string
+		Templated bool
+	}
+	hal := func(url string, out interface{}) {
+		t.Helper()
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", "application/hal+json")
+		resp, err := a.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/hal+json" {
+			t.Fatalf("%s: expected a HAL response, got %d %s", url, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Plain JSON stays the default
+	var plain []map[string]interface{}
+	if status := get(t, a, "/vessels", &plain); status != 200 || len(plain) != 1 || plain[0]["_links"] != nil {
+		t.Fatalf("Expected the plain vessel list, got %d %v", status, plain)
+	}
+
+	var vessels struct {
+		Embedded struct {
+			Vessels []struct {
+				Name  string
+				Links links `json:"_links"`
+			}
+		} `json:"_embedded"`
+		Links links `json:"_links"`
+	}
+	hal("/vessels", &vessels)
+	if len(vessels.Embedded.Vessels) != 1 || vessels.Links["self"].Href != "/vessels" {
+		t.Fatalf("Unexpected vessel list %+v", vessels)
+	}
+	vessel := vessels.Embedded.Vessels[0].Links
+	if vessel["self"].Href != fmt.Sprintf("/vessels/%d", result.VesselID) || !vessel["telemetry"].Templated {
+		t.Errorf("Unexpected vessel links %+v", vessel)
+	}
+
+	var page struct {
+		Items []map[string]interface{}
+		Links links `json:"_links"`
+	}
+	hal(fmt.Sprintf("/vessels/%d/telemetry?stream=engines&limit=1", result.VesselID), &page)
+	if len(page.Items) != 1 || page.Links["next"].Href == "" || page.Links["stream"].Href != "/streams/engines" || page.Links["vessel"].Href != vessel["self"].Href {
+		t.Fatalf("Unexpected first page %+v", page)
+	}
+	next := page.Links["next"].Href
+	page.Links = nil
+	hal(next, &page)
+	if len(page.Items) != 1 || page.Items[0]["rpm"] != 650.0 || page.Links["next"].Href != "" || page.Links["self"].Href != next {
+		t.Errorf("Unexpected last page %+v", page)
+	}
+
+	var stream struct {
+		Name    string
+		Columns []struct{ Name, Type string }
+		Links   links `json:"_links"`
+	}
+	hal("/streams/engines", &stream)
+	if stream.Name != "engines" || stream.Columns[0].Name != "engine_no" || stream.Columns[0].Type != "int" || stream.Links["collection"].Href != "/streams" {
+		t.Errorf("Unexpected stream definition %+v", stream)
+	}
+
+	// Uploads recorded by the store link back to their vessel
+	res, err := a.db.Exec(`INSERT INTO uploads (vessel_id, source_filename, file_hash, uploaded_at) VALUES (?, 'manual.xlsx', 'abc', ?)`,
+		result.VesselID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadID, _ := res.LastInsertId()
+	var upload struct {
+		SourceFilename string `json:"source_filename"`
+		Links          links  `json:"_links"`
+	}
+	hal(fmt.Sprintf("/uploads/%d", uploadID), &upload)
+	if upload.SourceFilename != "manual.xlsx" || upload.Links["vessel"].Href != vessel["self"].Href {
+		t.Errorf("Unexpected upload %+v", upload)
+	}
+}
+
+func TestBilgeBallast(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t,
+		sheet{"Bilge Wells", [][]interface{}{
+			{"Timestamp", "Well", "Level %", "Pump Status", "Alarm"},
+			{"2024-01-01T00:00:00Z", "BW-AFT", "35", "STOPPED", ""},
+			{"2024-01-01T01:00:00Z", "BW-AFT", "82", "RUNNING", "HIGH LEVEL"},
+			{"2024-01-01T02:00:00Z", "BW-AFT", "140", "RUNNING", ""}, // invalid level
+		}},
+		sheet{"Ballast Tanks", [][]interface{}{
+			{"Timestamp", "Tank", "Level", "Volume (m3)", "Pump"},
+			{"2024-01-01T00:00:00Z", "WBT 3P", "60", "412.5", "AUTO"},
+		}},
+	), "vessel_name=Alpha")
+	if result.RowsInserted["bilge"] != 3 {
+		t.Errorf("Expected 3 bilge/ballast rows, got %v", result.RowsInserted)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "invalid water level percentage") {
+		t.Errorf("Expected a level warning, got %v", result.Warnings)
+	}
+
+	rows := telemetry(t, a, result.VesselID, "stream=bilge&tank_id=BW-AFT")
+	if len(rows) != 2 || rows[1]["level_percent"] != 82.0 || rows[1]["pump_status"] != "RUNNING" || rows[1]["alarm"] != "HIGH LEVEL" {
+		t.Fatalf("Expected 2 bilge well readings, got %v", rows)
+	}
+	if rows := telemetry(t, a, result.VesselID, "stream=bilge&not_null=alarm"); len(rows) != 1 {
+		t.Errorf("Expected 1 reading with an alarm, got %d", len(rows))
+	}
+
+	var latest map[string]interface{}
+	url := fmt.Sprintf("/vessels/%d/latest?stream=bilge&tank_id=WBT%%203P", result.VesselID)
+	if status := get(t, a, url, &latest); status != 200 || latest["volume_m3"] != 412.5 || latest["pump_status"] != "AUTO" {
+		t.Errorf("Expected the ballast tank reading, got %d %v", status, latest)
+	}
+
+	var sensors struct {
+		Items []struct{ Kind, Unit string }
+	}
+	get(t, a, fmt.Sprintf("/vessels/%d/sensors?stream=bilge", result.VesselID), &sensors)
+	if len(sensors.Items) != 2 || sensors.Items[0].Kind != "water_tank" {
+		t.Errorf("Expected 2 registered water tanks, got %+v", sensors.Items)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Name", "Latitude", "Longitude", "Heading"},
+			{"Alpha", "51.9", "4.1", "90"},
+		}},
+		sheet{"Nav Data", [][]interface{}{
+			{"Timestamp", "Heading", "Rudder Angle", "ROT", "Depth Under Keel"},
+			{"2024-01-01T00:00:00Z", "90", "0", "0", "12.4"},
+			{"2024-01-01T00:01:00Z", "95.5", "10", "5.5", "11.8"},
+			{"2024-01-01T00:02:00Z", "400", "10", "5", "11"}, // invalid heading
+		}},
+	), "vessel_name=Alpha")
+	if result.RowsInserted["navigation"] != 2 || result.RowsInserted["location"] != 1 {
+		t.Errorf("Expected 2 navigation rows next to the position, got %v", result.RowsInserted)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "heading out of range") {
+		t.Errorf("Expected a heading warning, got %v", result.Warnings)
+	}
+
+	rows := telemetry(t, a, result.VesselID, "stream=navigation&order=desc")
+	if len(rows) != 2 || rows[0]["rudder_angle_degrees"] != 10.0 || rows[0]["rot_degrees_per_min"] != 5.5 || rows[0]["depth_under_keel_m"] != 11.8 {
+		t.Fatalf("Expected 2 navigation readings, newest first, got %v", rows)
+	}
+
+	var latest map[string]interface{}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/latest?stream=navigation", result.VesselID), &latest); status != 200 || latest["heading_degrees"] != 95.5 {
+		t.Errorf("Expected the latest heading, got %d %v", status, latest)
+	}
+	if location := telemetry(t, a, result.VesselID, "stream=location"); len(location) != 1 || location[0]["course_degrees"] != 90.0 {
+		t.Errorf("Expected the position with its course, got %v", location)
+	}
+}
+
+func TestMetStream(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t, sheet{"Met Station", [][]interface{}{
+		{"Timestamp", "Wind Speed", "Wind Dir", "Air Temp", "Pressure", "Sea State", "Sea Temp"},
+		{"2024-01-01T00:00:00Z", "12", "200", "8.5", "1013", "3", "11.2"},
+		{"2024-01-01T01:00:00Z", "25", "220", "7.9", "1004", "5", "11.0"},
+		{"2024-01-01T02:00:00Z", "30", "230", "7.5", "95", "5", "10.9"}, // pressure in kPa
+	}}), "vessel_name=Alpha")
+	if result.RowsInserted["met"] != 2 {
+		t.Errorf("Expected 2 met rows, got %v", result.RowsInserted)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "pressure out of range") {
+		t.Errorf("Expected a pressure warning, got %v", result.Warnings)
+	}
+
+	// Positions from AIS-like updates: one close to the first reading only
+	_, err := a.db.Exec(`INSERT INTO location_readings (vessel_id, ts, latitude, longitude, speed_knots, row_hash) VALUES (?, ?, 51.9, 4.1, 12, 'pos')`,
+		result.VesselID, time.Date(2024, 1, 1, 0, 3, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := telemetry(t, a, result.VesselID, "stream=met")
+	if len(rows) != 2 || rows[1]["sea_state"] != 5.0 || rows[1]["pressure_hpa"] != 1004.0 {
+		t.Fatalf("Expected 2 met readings, got %v", rows)
+	}
+
+	var page struct {
+		Items []struct {
+			Reading  map[string]interface{}
+			Position *struct {
+				TS        time.Time
+				Latitude  float64
+				Longitude float64
+			}
+		}
+		NextCursor string `json:"next_cursor"`
+	}
+	url := fmt.Sprintf("/vessels/%d/met?limit=1", result.VesselID)
+	if status := get(t, a, url, &page); status != 200 || len(page.Items) != 1 || page.NextCursor == "" {
+		t.Fatalf("Expected a first page of 1, got %d %+v", status, page)
+	}
+	if p := page.Items[0].Position; p == nil || p.Latitude != 51.9 || page.Items[0].Reading["wind_speed_knots"] != 12.0 {
+		t.Errorf("Expected the first reading with its position, got %+v", page.Items[0])
+	}
+	cursor := page.NextCursor
+	page.Items, page.NextCursor = nil, ""
+	get(t, a, url+"&cursor="+cursor, &page)
+	if len(page.Items) != 1 || page.Items[0].Position != nil || page.NextCursor != "" {
+		t.Errorf("Expected the second reading without a position, got %+v", page)
+	}
+	get(t, a, fmt.Sprintf("/vessels/%d/met?max_gap=2h", result.VesselID), &page)
+	if len(page.Items) != 2 || page.Items[1].Position == nil {
+		t.Errorf("Expected both readings to have a position within 2h, got %+v", page.Items)
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/met?max_gap=soon", result.VesselID), nil); status != 400 {
+		t.Errorf("Expected 400 for an invalid max_gap, got %d", status)
+	}
+}
+
+func TestPowerStream(t *testing.T) {
+	a := newTestApp(t)
+	result := ingest(t, a, workbook(t,
+		sheet{"Shore Power", [][]interface{}{
+			{"Timestamp", "Shore Connection", "Shore kW"},
+			{"2024-01-01T00:00:00Z", "CONNECTED", "420"},
+			{"2024-01-01T06:00:00Z", "DISCONNECTED", "0"},
+		}},
+		sheet{"Battery ESS", [][]interface{}{
+			{"Timestamp", "Bank", "SOC %", "Charge kW", "Discharge kW"},
+			{"2024-01-01T00:00:00Z", "ESS-1", "55", "300", "0"},
+			{"2024-01-01T06:00:00Z", "ESS-1", "98", "0", "250"},
+			{"2024-01-01T07:00:00Z", "ESS-1", "104", "0", "250"}, // invalid state of charge
+		}},
+	), "vessel_name=Alpha")
+	if result.RowsInserted["power"] != 4 {
+		t.Errorf("Expected 4 power rows, got %v", result.RowsInserted)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "invalid state of charge") {
+		t.Errorf("Expected a state of charge warning, got %v", result.Warnings)
+	}
+
+	rows := telemetry(t, a, result.VesselID, "stream=power&bank_id=ESS-1")
+	if len(rows) != 2 || rows[0]["battery_kw"] != 300.0 || rows[1]["battery_kw"] != -250.0 || rows[1]["soc_percent"] != 98.0 {
+		t.Fatalf("Expected charging then discharging, got %v", rows)
+	}
+	rows = telemetry(t, a, result.VesselID, "stream=power&not_null=shore_status")
+	if len(rows) != 2 || rows[0]["shore_status"] != "CONNECTED" || rows[0]["shore_kw"] != 420.0 || rows[0]["bank_id"] != nil {
+		t.Errorf("Expected the shore connection readings, got %v", rows)
+	}
+
+	// A lone discharge column is not read as charging
+	lone := ingest(t, a, workbook(t, sheet{"ESS", [][]interface{}{
+		{"Timestamp", "Bank", "Discharge kW"},
+		{"2024-01-02T00:00:00Z", "ESS-2", "120"},
+	}}), "vessel_name=Alpha")
+	var latest map[string]interface{}
+	url := fmt.Sprintf("/vessels/%d/latest?stream=power&bank_id=ESS-2", lone.VesselID)
+	if status := get(t, a, url, &latest); status != 200 || latest["battery_kw"] != -120.0 {
+		t.Errorf("Expected -120 kW, got %d %v", status, latest)
+	}
+
+	var sensors struct {
+		Items []struct{ Kind, Unit string }
+	}
+	get(t, a, fmt.Sprintf("/vessels/%d/sensors?stream=power", result.VesselID), &sensors)
+	if len(sensors.Items) != 1 || sensors.Items[0].Kind != "battery" || sensors.Items[0].Unit != "ESS-1" {
+		t.Errorf("Expected the registered battery bank, got %+v", sensors.Items)
+	}
+}
+
+func TestIngestArchive(t *testing.T) {
+	a := newTestApp(t)
+	day1 := workbook(t,
+		sheet{"Ship Info", [][]interface{}{{"Name", "Flag"}, {"Alpha", "NL"}}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine", "RPM"},
+			{"2024-01-01T00:00:00Z", "ME-1", "700"},
+		}},
+	)
+	day2 := workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine", "RPM"},
+		{"2024-01-02T00:00:00Z", "ME-1", "710"},
+		{"2024-01-02T01:00:00Z", "ME-1", "720"},
+	}})
+	fuel := "Timestamp,Tank,Capacity,Current\n2024-01-02T00:00:00Z,T1,1000,600\n"
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"2024-01-01.xlsx", day1},
+		{"2024-01-02.xlsx", day2},
+		{"fuel_2024-01-02.csv", []byte(fuel)},
+		{"copy/2024-01-01.xlsx", day1},
+		{"README.txt", []byte("daily exports")},
+	} {
+		w, _ := zw.Create(f.name)
+		w.Write(f.data)
+	}
+	zw.Close()
+
+	post := func(archive []byte, out interface{}) int {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("file", "week.zip")
+		part.Write(archive)
+		w.Close()
+		req := httptest.NewRequest("POST", "/ingest/archive?vessel_name=Alpha", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return do(t, a, req, out)
+	}
+
+	var result models.ArchiveResponse
+	if status := post(buf.Bytes(), &result); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if result.Status != "ingested" || result.VesselID == nil || result.RowsInserted["engines"] != 3 || result.RowsInserted["fuel"] != 1 {
+		t.Fatalf("Unexpected combined report %+v", result)
+	}
+	statuses := []string{}
+	for _, f := range result.Files {
+		statuses = append(statuses, f.Status)
+		if f.VesselID != nil && *f.VesselID != *result.VesselID {
+			t.Errorf("Expected every file on vessel %d, got %+v", *result.VesselID, f)
+		}
+	}
+	if strings.Join(statuses, ",") != "ingested,ingested,ingested,duplicate,skipped" || result.Files[3].DuplicateOf != "2024-01-01.xlsx" {
+		t.Errorf("Unexpected per-file report %+v", result.Files)
+	}
+	if rows := telemetry(t, a, *result.VesselID, "stream=fuel"); len(rows) != 1 || rows[0]["volume_liters"] != 600.0 {
+		t.Errorf("Expected the fuel reading from the CSV file, got %v", rows)
+	}
+	var vessels []map[string]interface{}
+	if get(t, a, "/vessels", &vessels); len(vessels) != 1 {
+		t.Errorf("Expected one vessel for the archive, got %d", len(vessels))
+	}
+
+	var failure struct{ Error string }
+	if status := post([]byte("not a zip"), &failure); status != 400 || !strings.Contains(failure.Error, "invalid archive") {
+		t.Errorf("Expected 400 for an invalid archive, got %d %q", status, failure.Error)
+	}
+}
+
+func TestIngestLegacyExcel(t *testing.T) {
+	a := newTestApp(t)
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", "engines.xls")
+	// An Excel 4.0 worksheet: a bare BIFF4 BOF record
+	part.Write([]byte{0x09, 0x04, 0x06, 0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00})
+	w.Close()
+	req := httptest.NewRequest("POST", "/ingest/xlsx?vessel_name=Alpha", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	var result struct{ Error string }
+	if status := do(t, a, req, &result); status != 400 || !strings.Contains(result.Error, "save the file as .xlsx") {
+		t.Errorf("Expected 400 explaining the format, got %d %q", status, result.Error)
+	}
+}
+
+func TestIngestInspect(t *testing.T) {
+	a := newTestApp(t)
+	file := workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"IMO", "Vessel Name", "Lat", "Lon", "Captain"},
+			{"9811000", "Alpha", 51.9, 4.1, "Smith"},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine", "RPM", "Exhaust Temp", "Load Factor"},
+			{"2024-01-01T00:00:00Z", "ME-1", 900.0, 350.0, ""},
+			{"2024-01-01T01:00:00Z", "ME-1", 910.0, 351.0, ""},
+			{"2024-01-01T02:00:00Z", "ME-1", 920.0, 352.0, 0.8},
+			{"2024-01-01T03:00:00Z", "ME-1", 930.0, 353.0, 0.9},
+		}},
+		sheet{"Notes", [][]interface{}{{"Remark"}, {"all well"}}},
+	)
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("file", "telemetry.xlsx")
+	part.Write(file)
+	w.Close()
+	req := httptest.NewRequest("POST", "/ingest/inspect", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	var result struct {
+		Sheets []models.SheetInspection `json:"sheets"`
+	}
+	if status := do(t, a, req, &result); status != 200 || len(result.Sheets) != 3 {
+		t.Fatalf("Expected 3 sheets, got %d %+v", status, result)
+	}
+	fields := func(s models.SheetInspection) map[string]string {
+		m := make(map[string]string)
+		for _, h := range s.Headers {
+			m[h.Header] = h.Field
+		}
+		return m
+	}
+
+	info := result.Sheets[0]
+	if info.Stream == nil || *info.Stream != "location" {
+		t.Errorf("Expected Ship Info read as location, got %v", info.Stream)
+	}
+	if f := fields(info); f["Vessel Name"] != "name" || f["Lat"] != "latitude" || f["Captain"] != "unmapped" {
+		t.Errorf("Unexpected Ship Info mapping %v", f)
+	}
+
+	engines := result.Sheets[1]
+	if engines.Stream == nil || *engines.Stream != "engines" || engines.Rows != 4 {
+		t.Fatalf("Expected 4 engine rows, got %+v", engines)
+	}
+	want := map[string]string{"Timestamp": "ts", "Engine": "engine_no", "RPM": "rpm", "Exhaust Temp": "temp_c", "Load Factor": "unmapped"}
+	if f := fields(engines); fmt.Sprint(f) != fmt.Sprint(want) {
+		t.Errorf("Expected engine mapping %v, got %v", want, f)
+	}
+	for _, h := range engines.Headers {
+		switch h.Header {
+		case "RPM":
+			if fmt.Sprint(h.Samples) != "[900 910 920]" {
+				t.Errorf("Expected the first 3 RPM cells, got %v", h.Samples)
+			}
+		case "Load Factor":
+			if fmt.Sprint(h.Samples) != "[0.8 0.9]" {
+				t.Errorf("Expected the non-empty load cells, got %v", h.Samples)
+			}
+		}
+	}
+
+	if notes := result.Sheets[2]; notes.Stream != nil || fields(notes)["Remark"] != "unmapped" {
+		t.Errorf("Expected Notes matched to no stream, got %+v", notes)
+	}
+
+	// Nothing was ingested
+	var vessels []interface{}
+	if get(t, a, "/vessels", &vessels); len(vessels) != 0 {
+		t.Errorf("Expected no vessels after inspecting, got %v", vessels)
+	}
+}
+
+func TestIngestSheetOverrides(t *testing.T) {
+	a := newTestApp(t)
+	file := workbook(t,
+		sheet{"Sheet3", [][]interface{}{
+			{"Timestamp", "Generator", "Load", "Voltage"},
+			{"2025-03-01T06:00:00Z", "DG-1", "410", "440"},
+		}},
+		// Named like a fuel sheet, but holds engine readings
+		sheet{"Fuel Engines", [][]interface{}{
+			{"Timestamp", "Engine", "RPM"},
+			{"2025-03-01T06:00:00Z", "ME-1", "720"},
+		}},
+		sheet{"Data", [][]interface{}{{"Timestamp", "Value"}, {"2025-03-01T06:00:00Z", "1"}}},
+	)
+	query := "vessel_name=Alpha&sheet=Sheet3=generators&sheet=fuel%20engines=engines&sheet=Data=nope&sheet=Missing=engines"
+	result := ingest(t, a, file, query)
+	if fmt.Sprint(result.RowsInserted) != "map[engines:1 generators:1]" {
+		t.Errorf("Expected the overridden sheets read, got %v", result.RowsInserted)
+	}
+	want := []string{"sheet Data: unknown stream nope, sheet skipped", "sheet override Missing: no such sheet"}
+	if fmt.Sprint(result.Warnings) != fmt.Sprint(want) {
+		t.Errorf("Expected warnings %q, got %q", want, result.Warnings)
+	}
+	if gens := telemetry(t, a, result.VesselID, "stream=generators"); len(gens) != 1 || gens[0]["load_kw"] != 410.0 {
+		t.Errorf("Expected the generator reading, got %v", gens)
+	}
+
+	var body struct{ Error string }
+	req := httptest.NewRequest("POST", "/ingest/xlsx?vessel_name=Alpha&sheet=generators", nil)
+	if status := do(t, a, req, &body); status != 400 || !strings.Contains(body.Error, "invalid sheet override") {
+		t.Errorf("Expected 400 for a malformed override, got %d %q", status, body.Error)
+	}
+}
+
+func TestHeaderAliases(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	send := func(method, path, key, body string, out interface{}) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		return do(t, a, req, out)
+	}
+	engines := func(imo string, hour int) []byte {
+		return workbook(t,
+			sheet{"Ship Info", [][]interface{}{{"IMO"}, {imo}}},
+			sheet{"Engines", [][]interface{}{
+				{"Waktu", "Engine", "Putaran", "Suhu Mesin"},
+				{fmt.Sprintf("2025-03-01T%02d:00:00Z", hour), "ME-1", "720", "81.5"},
+			}},
+		)
+	}
+
+	// Unknown to the built-in keywords, so the columns go to extra_json
+	alpha := ingest(t, a, engines("9811001", 6), "imo=9811001").VesselID
+	if r := telemetry(t, a, alpha, "stream=engines")[0]; r["rpm"] != nil || r["temp_c"] != nil {
+		t.Fatalf("Expected unmapped columns, got %v", r)
+	}
+
+	var global, own models.HeaderAlias
+	if status := send("POST", "/header-aliases", "", `{"header": "Suhu Mesin", "field": "temp_c"}`, nil); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	if status := send("POST", "/header-aliases", "admin-key", `{"header": " Suhu Mesin ", "field": "temp_c", "stream": "engines"}`, &global); status != 201 || global.Header != "Suhu Mesin" {
+		t.Fatalf("Expected the alias created, got %d %+v", status, global)
+	}
+	if status := send("POST", "/header-aliases", "admin-key", `{"header": "Waktu", "field": "ts"}`, nil); status != 201 {
+		t.Errorf("Expected a timestamp alias created, got %d", status)
+	}
+	body := fmt.Sprintf(`{"vessel_id": %d, "header": "Putaran", "field": "rpm"}`, alpha)
+	if status := send("POST", "/header-aliases", "admin-key", body, &own); status != 201 {
+		t.Fatalf("Expected the vessel's alias created, got %d", status)
+	}
+	for _, body := range []string{
+		`{"header": "suhu mesin", "field": "temp_c", "stream": "engines"}`, // the same header
+	} {
+		if status := send("POST", "/header-aliases", "admin-key", body, nil); status != 409 {
+			t.Errorf("%s: expected 409, got %d", body, status)
+		}
+	}
+	for _, body := range []string{
+		`{"header": "", "field": "rpm"}`,
+		`{"header": "X", "field": "rpm", "stream": "fuel"}`,
+		`{"header": "X", "field": "nope"}`,
+		`{"header": "X", "field": "rpm", "stream": "nope"}`,
+		`{"header": "X", "field": "rpm", "vessel_id": 999}`,
+	} {
+		if status := send("POST", "/header-aliases", "admin-key", body, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", body, status)
+		}
+	}
+
+	// The next ingest reads the aliased columns, the vessel's own aliases
+	// only for its sheets
+	ingest(t, a, engines("9811001", 7), "imo=9811001")
+	if r := telemetry(t, a, alpha, "stream=engines&from=2025-03-01T07:00:00Z&to=2025-03-01T08:00:00Z")[0]; r["ts"] != "2025-03-01T07:00:00Z" || r["rpm"] != 720.0 || r["temp_c"] != 81.5 {
+		t.Errorf("Expected the aliased columns read, got %v", r)
+	}
+	beta := ingest(t, a, engines("9811002", 7), "imo=9811002").VesselID
+	if r := telemetry(t, a, beta, "stream=engines")[0]; r["rpm"] != nil || r["temp_c"] != 81.5 {
+		t.Errorf("Expected only the global alias applied, got %v", r)
+	}
+
+	var list struct{ Items []models.HeaderAlias }
+	if get(t, a, fmt.Sprintf("/header-aliases?vessel_id=%d", beta), &list); len(list.Items) != 2 {
+		t.Errorf("Expected the 2 global aliases for beta, got %+v", list.Items)
+	}
+	if get(t, a, fmt.Sprintf("/header-aliases?vessel_id=%d", alpha), &list); len(list.Items) != 3 || list.Items[0].ID != own.ID {
+		t.Errorf("Expected alpha's alias first, got %+v", list.Items)
+	}
+
+	path := fmt.Sprintf("/header-aliases/%d", global.ID)
+	var updated models.HeaderAlias
+	if status := send("PUT", path, "admin-key", `{"header": "Suhu", "field": "temp_c"}`, &updated); status != 200 || updated.Header != "Suhu" || updated.Stream != nil || !updated.CreatedAt.Equal(global.CreatedAt) {
+		t.Errorf("Expected the alias replaced, got %d %+v", status, updated)
+	}
+	if status := send("DELETE", path, "admin-key", "", nil); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if status := get(t, a, path, nil); status != 404 {
+		t.Errorf("Expected 404 after delete, got %d", status)
+	}
+}
+
+func TestValidationRules(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	send := func(method, path, key, body string, out interface{}) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		return do(t, a, req, out)
+	}
+	shipInfo := sheet{"Ship Info", [][]interface{}{{"IMO"}, {"9811000"}}}
+	vesselID := ingest(t, a, workbook(t, shipInfo), "imo=9811000").VesselID
+	if status := send("PUT", fmt.Sprintf("/vessels/%d/engines/1", vesselID), "", `{"rated_rpm": 800}`, nil); status != 201 {
+		t.Fatalf("Expected the engine registered, got %d", status)
+	}
+
+	var overspeed, pressure models.ValidationRule
+	if status := send("POST", "/validation-rules", "", `{"stream": "engines", "expression": "rpm > 0"}`, nil); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	body := `{"stream": "engines", "expression": "rpm < rated_rpm * 1.1", "description": "overspeed"}`
+	if status := send("POST", "/validation-rules", "admin-key", body, &overspeed); status != 201 || overspeed.Action != "reject" {
+		t.Fatalf("Expected a rejecting rule created, got %d %+v", status, overspeed)
+	}
+	body = `{"stream": "engines", "expression": "oil_pressure_bar > 1 when rpm > 600", "action": "warn"}`
+	if status := send("POST", "/validation-rules", "admin-key", body, &pressure); status != 201 {
+		t.Fatalf("Expected a warning rule created, got %d", status)
+	}
+	for _, body := range []string{
+		`{"stream": "engines", "expression": "rpm >"}`,
+		`{"stream": "engines", "expression": "rpm"}`,
+		`{"stream": "engines", "expression": "load_kw > 0"}`,
+		`{"stream": "nope", "expression": "rpm > 0"}`,
+		`{"stream": "engines", "expression": "rpm > 0", "action": "drop"}`,
+	} {
+		if status := send("POST", "/validation-rules", "admin-key", body, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", body, status)
+		}
+	}
+
+	result := ingest(t, a, workbook(t, shipInfo, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine", "RPM", "Oil Pressure"},
+		{"2025-03-01T06:00:00Z", "ME-1", "720", "4.2"},
+		{"2025-03-01T07:00:00Z", "ME-1", "700", "0.4"},
+		{"2025-03-01T08:00:00Z", "ME-1", "950", "4.0"},
+		{"2025-03-01T09:00:00Z", "ME-2", "950", "4.0"}, // no rated rpm
+	}}), "imo=9811000")
+	if result.RowsInserted["engines"] != 3 {
+		t.Errorf("Expected the overspeed row skipped, got %v", result.RowsInserted)
+	}
+	want := []string{
+		fmt.Sprintf("row 3 engines: fails validation rule %d (oil_pressure_bar > 1 when rpm > 600)", pressure.ID),
+		fmt.Sprintf("row 4 engines: fails validation rule %d (overspeed)", overspeed.ID),
+	}
+	if len(result.Warnings) != 2 || result.Warnings[0] != want[0] || result.Warnings[1] != want[1] {
+		t.Errorf("Expected %q, got %q", want, result.Warnings)
+	}
+
+	var list struct {
+		Items []models.ValidationRule `json:"items"`
+	}
+	if get(t, a, "/validation-rules?stream=engines", &list); len(list.Items) != 2 {
+		t.Errorf("Expected 2 rules, got %+v", list.Items)
+	}
+	body = `{"stream": "engines", "expression": "rpm < rated_rpm * 1.25", "description": "overspeed"}`
+	if status := send("PUT", fmt.Sprintf("/validation-rules/%d", overspeed.ID), "admin-key", body, &overspeed); status != 200 || overspeed.Expression != "rpm < rated_rpm * 1.25" {
+		t.Errorf("Expected the rule replaced, got %d %+v", status, overspeed)
+	}
+	if status := send("DELETE", fmt.Sprintf("/validation-rules/%d", pressure.ID), "admin-key", "", nil); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if status := get(t, a, fmt.Sprintf("/validation-rules/%d", pressure.ID), nil); status != 404 {
+		t.Errorf("Expected 404 after delete, got %d", status)
+	}
+}
+
+func TestIngestURL(t *testing.T) {
+	file := workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine", "RPM"},
+		{"2024-01-01T00:00:00Z", "ME-1", "700"},
+	}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/daily.xlsx":
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+			w.Write(file)
+		case "/shared":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>Sign in</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), IngestURLAllowPrivate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	post := func(a *App, link string, out interface{}) int {
+		req := httptest.NewRequest("POST", "/ingest/url?vessel_name=Alpha", strings.NewReader(`{"url":"`+link+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+
+	var result models.IngestResponse
+	if status := post(a, srv.URL+"/daily.xlsx?token=secret", &result); status != 200 || result.RowsInserted["engines"] != 1 {
+		t.Fatalf("Expected one engine row, got %d %+v", status, result)
+	}
+	var failure struct{ Error string }
+	if status := post(a, srv.URL+"/shared", &failure); status != 415 || !strings.Contains(failure.Error, "web page") {
+		t.Errorf("Expected 415 for a web page, got %d %q", status, failure.Error)
+	}
+	if status := post(a, srv.URL+"/missing.xlsx", &failure); status != 502 {
+		t.Errorf("Expected 502 for a failed download, got %d %q", status, failure.Error)
+	}
+	if status := post(a, "file:///etc/passwd", &failure); status != 400 {
+		t.Errorf("Expected 400 for a file link, got %d", status)
+	}
+
+	// Private addresses are refused by default
+	if status := post(newTestApp(t), srv.URL+"/daily.xlsx", &failure); status != 400 || !strings.Contains(failure.Error, "private address") {
+		t.Errorf("Expected 400 for a loopback link, got %d %q", status, failure.Error)
+	}
+}
+
+func TestIngestS3Events(t *testing.T) {
+	var event struct{ Queued int }
+	post := func(a *App, out interface{}) int {
+		req := httptest.NewRequest("POST", "/ingest/s3/events", strings.NewReader(`{"Records":[
+			{"eventName":"s3:ObjectCreated:Put","s3":{"bucket":{"name":"telemetry"},"object":{"key":"inbox/9811000/day1.xlsx"}}},
+			{"eventName":"s3:ObjectCreated:Put","s3":{"bucket":{"name":"telemetry"},"object":{"key":"elsewhere/day1.xlsx"}}}
+		]}`))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	if status := post(newTestApp(t), &event); status != 404 {
+		t.Errorf("Expected 404 without a bucket, got %d", status)
+	}
+
+	// Listing is off, so the bucket is only read once objects are announced
+	a, err := New(config.Config{
+		DBPath:       filepath.Join(t.TempDir(), "telemetry.db"),
+		AdminAPIKeys: []string{"admin-key"},
+		S3Endpoint:   "http://127.0.0.1:1",
+		S3Bucket:     "telemetry",
+		S3Prefix:     "inbox/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if status := post(a, &event); status != 202 || event.Queued != 1 {
+		t.Errorf("Expected the object under the prefix queued, got %d %+v", status, event)
+	}
+
+	req := httptest.NewRequest("GET", "/ingest/s3/objects?status=failed", nil)
+	if status := do(t, a, req, nil); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	var objects struct {
+		Bucket string
+		Items  []models.BucketObject
+	}
+	req.Header.Set("X-API-Key", "admin-key")
+	if status := do(t, a, req, &objects); status != 200 || objects.Bucket != "telemetry" || objects.Items == nil {
+		t.Errorf("Expected the bucket's objects, got %d %+v", status, objects)
+	}
+
+	if _, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), S3Bucket: "telemetry", S3Endpoint: "minio:9000"}); err == nil {
+		t.Error("Expected an endpoint without scheme to be refused")
+	}
+}
+
+func TestAdminJobs(t *testing.T) {
+	if _, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), JobSchedules: map[string]string{"nightly": "@daily"}}); err == nil {
+		t.Error("Expected an unknown job to be refused")
+	}
+	if _, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), JobSchedules: map[string]string{"backup": "0 25 * * *"}}); err == nil {
+		t.Error("Expected an invalid schedule to be refused")
+	}
+
+	// Older backups beyond BACKUP_KEEP go
+	backups := t.TempDir()
+	for _, old := range []string{"telemetry-20260101T030000Z.db", "telemetry-20260102T030000Z.db", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(backups, old), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := New(config.Config{
+		DBPath:       filepath.Join(t.TempDir(), "telemetry.db"),
+		AdminAPIKeys: []string{"admin-key"},
+		CDCRetention: time.Hour,
+		BackupDir:    backups,
+		BackupKeep:   2,
+		JobSchedules: map[string]string{"backup": "@every 1h"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	req := httptest.NewRequest("GET", "/admin/jobs", nil)
+	if status := do(t, a, req, nil); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	req.Header.Set("X-API-Key", "admin-key")
+	var jobs struct{ Items []cron.Status }
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if status := do(t, a, req, &jobs); status != 200 {
+			t.Fatalf("Expected 200, got %d", status)
+		}
+		ran := len(jobs.Items) == 5
+		for _, job := range jobs.Items {
+			ran = ran && job.Runs == 1
+		}
+		if ran || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(jobs.Items) != 5 || jobs.Items[0].Name != "backup" || jobs.Items[1].Name != "cdc-prune" || jobs.Items[2].Name != "extra-prune" || jobs.Items[3].Name != "outbox-prune" || jobs.Items[4].Name != "upload-prune" {
+		t.Fatalf("Unexpected jobs %+v", jobs.Items)
+	}
+	for _, job := range jobs.Items {
+		if job.LastResult != cron.ResultOK || job.LastRun == nil || job.NextRun == nil || job.LastDurationMS == nil {
+			t.Errorf("Unexpected job %+v", job)
+		}
+	}
+	if jobs.Items[0].Schedule != "@every 1h" || jobs.Items[1].Schedule != "@every 1h" {
+		t.Errorf("Unexpected schedules %q, %q", jobs.Items[0].Schedule, jobs.Items[1].Schedule)
+	}
+	snapshots, _ := filepath.Glob(filepath.Join(backups, "*"))
+	if len(snapshots) != 3 || filepath.Base(snapshots[0]) != "notes.txt" || filepath.Base(snapshots[1]) != "telemetry-20260102T030000Z.db" {
+		t.Errorf("Expected a new backup and the last one before, got %v", snapshots)
+	}
+}
+
+func TestPollerJobs(t *testing.T) {
+	// Every job scheduled may be named by JOB_SCHEDULES
+	schedules := map[string]string{"modbus": "*/5 * * * *", "snmp": "*/10 * * * *", "onvif": "*/15 * * * *"}
+	a, err := New(config.Config{
+		DBPath:             filepath.Join(t.TempDir(), "telemetry.db"),
+		AdminAPIKeys:       []string{"admin-key"},
+		ModbusPollInterval: time.Minute,
+		SNMPPollInterval:   time.Minute,
+		ONVIFPollInterval:  time.Minute,
+		JobSchedules:       schedules,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	req := httptest.NewRequest("GET", "/admin/jobs", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	var jobs struct{ Items []cron.Status }
+	if status := do(t, a, req, &jobs); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	scheduled := map[string]string{}
+	for _, job := range jobs.Items {
+		if !jobNames[job.Name] {
+			t.Errorf("Expected JOB_SCHEDULES to accept job %s", job.Name)
+		}
+		scheduled[job.Name] = job.Schedule
+	}
+	for name, spec := range schedules {
+		if scheduled[name] != spec {
+			t.Errorf("Expected job %s scheduled %q, got %q", name, spec, scheduled[name])
+		}
+	}
+
+	// A poll interval of 0 disables the poller
+	b, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if status := do(t, b, req, &jobs); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	for _, job := range jobs.Items {
+		if schedules[job.Name] != "" {
+			t.Errorf("Expected no %s job without an interval", job.Name)
+		}
+	}
+}
+
+func TestChunkedUpload(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), ChunkedUploadMaxMB: 1, ChunkedUploadTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	file := workbook(t, sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine", "RPM"},
+		{"2024-01-01T00:00:00Z", "ME-1", "700"},
+		{"2024-01-01T01:00:00Z", "ME-1", "710"},
+	}})
+
+	type upload struct {
+		Upload       models.ChunkedUpload `json:"upload"`
+		MaxChunkSize int                  `json:"max_chunk_size"`
+		Received     int64                `json:"received"`
+		Error        string               `json:"error"`
+	}
+	create := func(body string, out interface{}) int {
+		req := httptest.NewRequest("POST", "/ingest/uploads", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	send := func(id string, offset int, chunk []byte, checksum string, out interface{}) int {
+		req := httptest.NewRequest("POST", fmt.Sprintf("/ingest/uploads/%s/chunks?offset=%d", id, offset), bytes.NewReader(chunk))
+		req.Header.Set("X-Chunk-SHA256", checksum)
+		return do(t, a, req, out)
+	}
+
+	if status := create(`{"filename":"day1.xlsx","size":2000000}`, nil); status != 413 {
+		t.Errorf("Expected 413 over CHUNKED_UPLOAD_MAX_MB, got %d", status)
+	}
+	var u upload
+	if status := create(fmt.Sprintf(`{"filename":"day1.xlsx","size":%d,"sha256":%q}`, len(file), util.SHA256Hex(file)), &u); status != 201 {
+		t.Fatalf("Expected 201, got %d %q", status, u.Error)
+	}
+	if u.Upload.ID == "" || u.Upload.Received != 0 || u.MaxChunkSize <= 0 {
+		t.Fatalf("Unexpected upload %+v", u)
+	}
+	id := u.Upload.ID
+
+	half := len(file) / 2
+	if status := send(id, 0, file[:half], util.SHA256Hex(file[:half]), &u); status != 200 || u.Upload.Received != int64(half) {
+		t.Fatalf("Expected the first chunk, got %d %+v", status, u)
+	}
+	if status := send(id, half, file[half:], util.SHA256Hex(file[:half]), nil); status != 400 {
+		t.Errorf("Expected 400 for a chunk checksum mismatch, got %d", status)
+	}
+	if status := send(id, half, file[half:], "", nil); status != 400 {
+		t.Errorf("Expected 400 without X-Chunk-SHA256, got %d", status)
+	}
+	// A client resending a chunk it did not hear back about learns where to resume
+	var conflict upload
+	if status := send(id, 0, file[:half], util.SHA256Hex(file[:half]), &conflict); status != 409 || conflict.Received != int64(half) {
+		t.Errorf("Expected 409 at %d, got %d %+v", half, status, conflict)
+	}
+	if status := do(t, a, httptest.NewRequest("POST", "/ingest/uploads/"+id+"/complete?imo=9822000", nil), &conflict); status != 409 {
+		t.Errorf("Expected 409 completing an incomplete upload, got %d", status)
+	}
+	if status := get(t, a, "/ingest/uploads/"+id, &u); status != 200 || u.Upload.Received != int64(half) {
+		t.Errorf("Expected the upload in progress, got %d %+v", status, u)
+	}
+
+	if status := send(id, half, file[half:], util.SHA256Hex(file[half:]), &u); status != 200 || u.Upload.Received != int64(len(file)) {
+		t.Fatalf("Expected the last chunk, got %d %+v", status, u)
+	}
+	var result ingestResult
+	if status := do(t, a, httptest.NewRequest("POST", "/ingest/uploads/"+id+"/complete?imo=9822000", nil), &result); status != 200 {
+		t.Fatalf("Expected 200, got %d %+v", status, result)
+	}
+	if result.Status != "ingested" || result.RowsInserted["engines"] != 2 {
+		t.Errorf("Unexpected ingest %+v", result)
+	}
+	if status := get(t, a, "/ingest/uploads/"+id, nil); status != 404 {
+		t.Errorf("Expected the upload to be gone once ingested, got %d", status)
+	}
+
+	// A file other than the one announced is refused and dropped
+	if status := create(fmt.Sprintf(`{"filename":"day1.xlsx","size":4,"sha256":%q}`, util.SHA256Hex([]byte("abcd"))), &u); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	send(u.Upload.ID, 0, []byte("abce"), util.SHA256Hex([]byte("abce")), nil)
+	if status := do(t, a, httptest.NewRequest("POST", "/ingest/uploads/"+u.Upload.ID+"/complete?imo=9822000", nil), &u); status != 400 || !strings.Contains(u.Error, "sha256") {
+		t.Errorf("Expected 400 for a file checksum mismatch, got %d %q", status, u.Error)
+	}
+	if status := do(t, a, httptest.NewRequest("DELETE", "/ingest/uploads/"+u.Upload.ID, nil), nil); status != 404 {
+		t.Errorf("Expected the mismatched upload to be gone, got %d", status)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), CacheTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+
+	first := ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{{"IMO", "Name"}, {"9833000", "Cached"}}}), "imo=9833000")
+	names := func() []string {
+		var vessels []struct{ Name string }
+		if status := get(t, a, "/vessels", &vessels); status != 200 {
+			t.Fatalf("Expected 200, got %d", status)
+		}
+		var names []string
+		for _, v := range vessels {
+			names = append(names, v.Name)
+		}
+		return names
+	}
+	if got := names(); len(got) != 1 || got[0] != "Cached" {
+		t.Fatalf("Unexpected vessels %v", got)
+	}
+
+	// A write behind the API's back is not seen until the cache is dropped
+	if _, err := a.db.Exec(`UPDATE vessels SET name = 'Renamed' WHERE id = ?`, first.VesselID); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); got[0] != "Cached" {
+		t.Errorf("Expected the list to be served from the cache, got %v", got)
+	}
+
+	ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{{"IMO", "Name"}, {"9833001", "Second"}}}), "imo=9833001")
+	if got := names(); len(got) != 2 || got[0] != "Renamed" {
+		t.Errorf("Expected an ingest to drop the cached list, got %v", got)
+	}
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/vessels/%d/archive", first.VesselID), nil)
+	if status := do(t, a, req, nil); status != 200 {
+		t.Fatalf("Expected the vessel to be archived, got %d", status)
+	}
+	if got := names(); len(got) != 1 || got[0] != "Second" {
+		t.Errorf("Expected archiving to drop the cached list, got %v", got)
+	}
+}
+
+func TestVesselListLatest(t *testing.T) {
+	a := newTestApp(t)
+	engines := func(imo, name string) []byte {
+		return workbook(t,
+			sheet{"Ship Info", [][]interface{}{{"IMO", "Name"}, {imo, name}}},
+			sheet{"Engines", [][]interface{}{
+				{"Timestamp", "Engine No", "RPM"},
+				{"2025-08-08T10:00:00Z", "1", "1100"},
+			}},
+		)
+	}
+	latest := func() map[string]map[string]time.Time {
+		var vessels []struct {
+			Name   string
+			Latest map[string]time.Time
+		}
+		if status := get(t, a, "/vessels", &vessels); status != 200 {
+			t.Fatalf("Expected 200, got %d", status)
+		}
+		byName := make(map[string]map[string]time.Time)
+		for _, v := range vessels {
+			byName[v.Name] = v.Latest
+		}
+		return byName
+	}
+
+	ingest(t, a, engines("9844000", "Alpha"), "imo=9844000")
+	ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{{"IMO", "Name"}, {"9844001", "Bravo"}}}), "imo=9844001")
+	got := latest()
+	if _, ok := got["Alpha"]["engines"]; !ok || len(got["Bravo"]) != 0 {
+		t.Fatalf("Unexpected latest timestamps %v", got)
+	}
+
+	// Written after the list was read, so the copy in memory must follow
+	ingest(t, a, engines("9844001", "Bravo"), "imo=9844001&mode=upsert")
+	if _, ok := latest()["Bravo"]["engines"]; !ok {
+		t.Errorf("Expected the new stream of Bravo in the list, got %v", latest())
+	}
+}
+
+func TestCompareRollups(t *testing.T) {
+	a := newTestApp(t)
+	fuelSheet := func(rows ...[]interface{}) []byte {
+		return workbook(t,
+			sheet{"Ship Info", [][]interface{}{{"IMO", "Name"}, {"9855000", "Rolled"}}},
+			sheet{"Fuel Tanks", append([][]interface{}{{"Timestamp", "Tank No", "Volume Liters"}}, rows...)},
+		)
+	}
+	vessel := ingest(t, a, fuelSheet(
+		[]interface{}{"2025-08-08T06:00:00Z", "1", "1000"},
+		[]interface{}{"2025-08-08T06:30:00Z", "1", "900"},
+		[]interface{}{"2025-08-08T07:15:00Z", "1", "700"},
+		[]interface{}{"2025-08-09T06:00:00Z", "1", "600"},
+	), "imo=9855000").VesselID
+
+	type series struct {
+		Buckets []string `json:"buckets"`
+		Series  []struct {
+			Avg   []*float64 `json:"avg"`
+			Max   []*float64 `json:"max"`
+			Count []int64    `json:"count"`
+		} `json:"series"`
+	}
+	compare := func(query string) series {
+		t.Helper()
+		var result series
+		url := fmt.Sprintf("/compare?vessels=%d&stream=fuel&metric=volume_liters&%s", vessel, query)
+		if status := get(t, a, url, &result); status != 200 || len(result.Series) != 1 {
+			t.Fatalf("%s: expected one series, got %d %+v", query, status, result)
+		}
+		return result
+	}
+
+	// Partial periods at either end come from the readings, the rest from
+	// the rollups, and add up to the same buckets
+	hourly := compare("bucket=1h&from=2025-08-08T06:10:00Z&to=2025-08-09T06:00:00Z")
+	if len(hourly.Buckets) != 3 || hourly.Buckets[0] != "2025-08-08T06:00:00Z" {
+		t.Fatalf("Unexpected buckets %v", hourly.Buckets)
+	}
+	if s := hourly.Series[0]; *s.Avg[0] != 900 || *s.Avg[1] != 700 || *s.Avg[2] != 600 || s.Count[0] != 1 {
+		t.Errorf("Unexpected hourly series avg %v count %v", s.Avg, s.Count)
+	}
+	if s := compare("bucket=1d").Series[0]; s.Count[0] != 3 || *s.Avg[0] != 2600.0/3 || *s.Max[0] != 1000 {
+		t.Errorf("Unexpected daily series avg %v count %v", s.Avg, s.Count)
+	}
+
+	// Written past ingest, so only seen in a rollup once the hour is written
+	if _, err := a.db.Exec("UPDATE fuel_tank_readings SET volume_liters = 5000 WHERE ts = ?", time.Date(2025, 8, 8, 6, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if s := compare("bucket=1h").Series[0]; *s.Max[0] != 1000 {
+		t.Errorf("Expected whole hours to be read from the rollups, got max %v", s.Max)
+	}
+	if s := compare("bucket=1h&exclude_source=manual").Series[0]; *s.Max[0] != 5000 {
+		t.Errorf("Expected a source filter to read the readings, got max %v", s.Max)
+	}
+	ingest(t, a, fuelSheet([]interface{}{"2025-08-08T06:45:00Z", "1", "800"}), "imo=9855000")
+	if s := compare("bucket=1h").Series[0]; s.Count[0] != 3 || *s.Max[0] != 5000 {
+		t.Errorf("Expected the hour written to be rolled up again, got max %v count %v", s.Max, s.Count)
+	}
+}
+
+func TestDailySummaries(t *testing.T) {
+	a := newTestApp(t)
+	shipInfo := func(ts, lat string, speed float64) sheet {
+		return sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO", "Timestamp", "Latitude", "Longitude", "Speed(knots)"},
+			{"Daily", "9866000", ts, lat, "103.8", speed},
+		}}
+	}
+	// Half a degree north between 10:00 and 11:00; engine 1 runs 10:00-10:30
+	vessel := ingest(t, a, workbook(t, shipInfo("2025-08-01T10:00:00Z", "1.0", 12), sheet{"Engines", [][]interface{}{
+		{"Timestamp", "Engine No", "RPM"},
+		{"2025-08-01T10:00:00Z", "1", "700"},
+		{"2025-08-01T10:30:00Z", "1", "0"},
+	}}), "imo=9866000").VesselID
+	ingest(t, a, workbook(t, shipInfo("2025-08-01T11:00:00Z", "1.5", 10)), "imo=9866000")
+
+	now := time.Date(2025, 8, 2, 0, 30, 0, 0, time.UTC)
+	if err := summarizeDays(context.Background(), store.New(a.db), 1, now); err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		VesselID int64                 `json:"vessel_id"`
+		Items    []models.DailySummary `json:"items"`
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/daily?from=2025-08-01&to=2025-08-01", vessel), &result); status != 200 || len(result.Items) != 1 {
+		t.Fatalf("Expected one summary, got %d %+v", status, result)
+	}
+	d := result.Items[0]
+	if d.Day != "2025-08-01" || d.DistanceNM < 29.9 || d.DistanceNM > 30.1 || d.AvgSpeedKnots == nil || *d.AvgSpeedKnots != 11 {
+		t.Errorf("Unexpected track in %+v", d)
+	}
+	// Locations in 2 of 24 hours, engines in 1
+	if d.EngineRunningHours != 0.5 || d.CompletenessPercent != 6.25 {
+		t.Errorf("Unexpected engine hours or completeness in %+v", d)
+	}
+
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/daily?from=2025-08-02", vessel), &result); status != 200 || len(result.Items) != 0 {
+		t.Errorf("Expected no summaries after the day, got %d %+v", status, result)
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/daily?from=yesterday", vessel), nil); status != 400 {
+		t.Errorf("Expected 400 for an invalid day, got %d", status)
+	}
+}
+
+func TestVesselReport(t *testing.T) {
+	a := newTestApp(t)
+	vessel := ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO", "Timestamp", "Latitude", "Longitude", "Speed(knots)"},
+			{"Reported", "9867000", "2025-08-01T10:00:00Z", "1.0", "103.8", 12},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM"},
+			{"2025-08-01T10:00:00Z", "1", "700"},
+			{"2025-08-01T10:30:00Z", "1", "0"},
+		}},
+	), "imo=9867000").VesselID
+
+	resp, err := a.Test(httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d/report?period=2025-08", vessel), nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(body, []byte("%PDF-")) {
+		t.Fatalf("Expected a PDF, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, fmt.Sprintf("vessel-%d-2025-08.pdf", vessel)) {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+
+	var report struct {
+		Days    []models.DailySummary `json:"days"`
+		Streams []struct {
+			Stream       string `json:"stream"`
+			Readings     int64  `json:"readings"`
+			DaysWithData int    `json:"days_with_data"`
+		} `json:"streams"`
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/report?period=2025-08&format=json", vessel), &report); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(report.Days) != 31 || report.Days[0].EngineRunningHours != 0.5 || report.Days[1].EngineRunningHours != 0 {
+		t.Errorf("Expected every day of August, got %+v", report.Days)
+	}
+	if len(report.Streams) != 2 || report.Streams[0].Stream != "engines" || report.Streams[0].Readings != 2 || report.Streams[0].DaysWithData != 1 {
+		t.Errorf("Unexpected data quality %+v", report.Streams)
+	}
+
+	for _, query := range []string{"period=", "period=2025-8-1", "period=2999-01", "period=2025-08&format=docx"} {
+		if status := get(t, a, fmt.Sprintf("/vessels/%d/report?%s", vessel, query), nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", query, status)
+		}
+	}
+	if status := get(t, a, "/vessels/999/report?period=2025-08", nil); status != 404 {
+		t.Errorf("Expected 404 for an unknown vessel, got %d", status)
+	}
+}
+
+func TestReportSchedules(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	vessel := ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{{"Name", "IMO"}, {"Scheduled", "9868000"}}}), "imo=9868000").VesselID
+
+	send := func(method, path, key, body string, out interface{}) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		return do(t, a, req, out)
+	}
+
+	def := fmt.Sprintf(`{"name": "Charterer weekly", "frequency": "weekly", "vessel_id": %d, "recipients": [" ops@charterer.example "]}`, vessel)
+	if status := send("POST", "/report-schedules", "", def, nil); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	var created models.ReportSchedule
+	if status := send("POST", "/report-schedules", "admin-key", def, &created); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if created.ID == 0 || !created.Enabled || created.Recipients[0] != "ops@charterer.example" || created.Frequency != models.ReportWeekly {
+		t.Errorf("Unexpected schedule %+v", created)
+	}
+
+	for _, body := range []string{
+		`{"name": "x", "frequency": "hourly", "fleet": "North", "recipients": ["a@example.com"]}`,
+		`{"name": "x", "frequency": "daily", "recipients": ["a@example.com"]}`,
+		fmt.Sprintf(`{"name": "x", "frequency": "daily", "vessel_id": %d, "fleet": "North", "recipients": ["a@example.com"]}`, vessel),
+		`{"name": "x", "frequency": "daily", "fleet": "North", "recipients": ["not an address"]}`,
+		`{"name": "x", "frequency": "daily", "fleet": "North", "recipients": []}`,
+		`{"name": "x", "frequency": "daily", "vessel_id": 999, "recipients": ["a@example.com"]}`,
+		`{"name": " ", "frequency": "daily", "fleet": "North", "recipients": ["a@example.com"]}`,
+	} {
+		if status := send("POST", "/report-schedules", "admin-key", body, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", body, status)
+		}
+	}
+
+	path := fmt.Sprintf("/report-schedules/%d", created.ID)
+	var updated models.ReportSchedule
+	if status := send("PUT", path, "admin-key", `{"name": "North fleet monthly", "frequency": "monthly", "fleet": "North", "recipients": ["a@example.com", "b@example.com"], "enabled": false}`, &updated); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if updated.VesselID != nil || *updated.Fleet != "North" || updated.Enabled || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Unexpected updated schedule %+v", updated)
+	}
+
+	var list struct{ Items []models.ReportSchedule }
+	if status := send("GET", "/report-schedules", "admin-key", "", &list); status != 200 || len(list.Items) != 1 || list.Items[0].Name != "North fleet monthly" {
+		t.Errorf("Unexpected schedules %d %+v", status, list)
+	}
+	var history struct{ Items []models.ReportDelivery }
+	if status := send("GET", path+"/deliveries", "admin-key", "", &history); status != 200 || len(history.Items) != 0 {
+		t.Errorf("Expected no deliveries yet, got %d %+v", status, history)
+	}
+	// Without SMTP_ADDR nothing can be sent
+	if status := send("POST", path+"/send", "admin-key", "", nil); status != 503 {
+		t.Errorf("Expected 503 without email, got %d", status)
+	}
+
+	if status := send("DELETE", path, "admin-key", "", nil); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if status := send("GET", path, "admin-key", "", nil); status != 404 {
+		t.Errorf("Expected 404 after delete, got %d", status)
+	}
+}
+
+func TestReportTemplates(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	vessel := ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{{"Name", "IMO"}, {"Templated", "9869000"}}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM"},
+			{"2025-08-01T10:00:00Z", "1", "700"},
+			{"2025-08-01T11:00:00Z", "1", "740"},
+			{"2025-08-03T10:00:00Z", "2", "650"},
+		}},
+	), "imo=9869000").VesselID
+
+	send := func(method, path, key, body string, out interface{}) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		return do(t, a, req, out)
+	}
+
+	def := `{"description": "Acme charter", "sections": [
+		{"type": "summary", "title": " Overview "},
+		{"type": "chart", "stream": "engines", "metric": "rpm", "unit": "1", "aggregate": "max"},
+		{"type": "alarms"}
+	], "branding": {"company": "Acme Chartering", "color": "#1a5fb4", "footer": "Confidential"}}`
+	if status := send("PUT", "/report-templates/acme", "", def, nil); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	var created models.ReportTemplate
+	if status := send("PUT", "/report-templates/acme", "admin-key", def, &created); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if len(created.Sections) != 3 || *created.Sections[0].Title != "Overview" || *created.Branding.Company != "Acme Chartering" {
+		t.Errorf("Unexpected template %+v", created)
+	}
+	if status := send("PUT", "/report-templates/acme", "admin-key", def, nil); status != 200 {
+		t.Errorf("Expected 200 on replace, got %d", status)
+	}
+
+	for _, body := range []string{
+		`{"sections": []}`,
+		`{"sections": [{"type": "appendix"}]}`,
+		`{"sections": [{"type": "chart", "stream": "engines", "metric": "alarms"}]}`,
+		`{"sections": [{"type": "chart", "stream": "location", "metric": "speed_knots", "unit": "1"}]}`,
+		`{"sections": [{"type": "chart", "stream": "engines", "metric": "rpm", "aggregate": "sum"}]}`,
+		`{"sections": [{"type": "summary", "stream": "engines"}]}`,
+		`{"sections": [{"type": "summary"}], "branding": {"color": "blue"}}`,
+		`{"name": "other", "sections": [{"type": "summary"}]}`,
+	} {
+		if status := send("PUT", "/report-templates/acme", "admin-key", body, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", body, status)
+		}
+	}
+	if status := send("PUT", "/report-templates/Bad-Name", "admin-key", `{"sections": [{"type": "summary"}]}`, nil); status != 400 {
+		t.Errorf("Expected 400 for an invalid name, got %d", status)
+	}
+
+	var list struct{ Items []models.ReportTemplate }
+	if status := get(t, a, "/report-templates", &list); status != 200 || len(list.Items) != 1 {
+		t.Errorf("Unexpected templates %d %+v", status, list)
+	}
+
+	var report struct {
+		Charts []struct {
+			Values []*float64 `json:"values"`
+		} `json:"charts"`
+		Template *models.ReportTemplate `json:"template"`
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/report?period=2025-08&format=json&template=acme", vessel), &report); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if report.Template == nil || len(report.Charts) != 1 || len(report.Charts[0].Values) != 31 {
+		t.Fatalf("Unexpected templated report %+v", report)
+	}
+	// Engine 1 only: its daily maximum, none on days without readings
+	if v := report.Charts[0].Values; v[0] == nil || *v[0] != 740 || v[1] != nil || v[2] != nil {
+		t.Errorf("Unexpected chart values %v", v)
+	}
+	resp, err := a.Test(httptest.NewRequest("GET", fmt.Sprintf("/vessels/%d/report?period=2025-08&template=acme", vessel), nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("Expected a templated PDF, got %d", resp.StatusCode)
+	}
+	if status := get(t, a, fmt.Sprintf("/vessels/%d/report?period=2025-08&template=missing", vessel), nil); status != 400 {
+		t.Errorf("Expected 400 for an unknown template, got %d", status)
+	}
+
+	// Schedules refer to templates by name; a template in use is kept
+	schedule := fmt.Sprintf(`{"name": "Acme monthly", "frequency": "monthly", "vessel_id": %d, "recipients": ["ops@acme.example"], "template": "%%s"}`, vessel)
+	if status := send("POST", "/report-schedules", "admin-key", fmt.Sprintf(schedule, "missing"), nil); status != 400 {
+		t.Errorf("Expected 400 for an unknown template, got %d", status)
+	}
+	var rs models.ReportSchedule
+	if status := send("POST", "/report-schedules", "admin-key", fmt.Sprintf(schedule, "acme"), &rs); status != 201 || rs.Template == nil || *rs.Template != "acme" {
+		t.Fatalf("Expected a templated schedule, got %d %+v", status, rs)
+	}
+	if status := send("DELETE", "/report-templates/acme", "admin-key", "", nil); status != 409 {
+		t.Errorf("Expected 409 for a template in use, got %d", status)
+	}
+	if status := send("DELETE", fmt.Sprintf("/report-schedules/%d", rs.ID), "admin-key", "", nil); status != 204 {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+	if status := send("DELETE", "/report-templates/acme", "admin-key", "", nil); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if status := get(t, a, "/report-templates/acme", nil); status != 404 {
+		t.Errorf("Expected 404 after delete, got %d", status)
+	}
+}
+
+func TestShareLinks(t *testing.T) {
+	a, err := New(config.Config{
+		DBPath:           filepath.Join(t.TempDir(), "telemetry.db"),
+		AdminAPIKeys:     []string{"admin-key"},
+		SignedURLSecrets: []string{"share-secret"},
+		SignedURLMaxTTL:  48 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	vessel := ingest(t, a, workbook(t,
+		sheet{"Ship Info", [][]interface{}{
+			{"Name", "IMO", "Timestamp", "Latitude", "Longitude", "Speed(knots)"},
+			{"Voyager", "9870000", "2025-08-02T10:00:00Z", "1.5", "104.2", 12},
+		}},
+		sheet{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM"},
+			{"2025-08-02T10:00:00Z", "1", "700"},
+			{"2025-08-20T10:00:00Z", "1", "900"},
+		}},
+	), "imo=9870000").VesselID
+	ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{
+		{"Name", "IMO", "Timestamp", "Latitude", "Longitude", "Speed(knots)"},
+		{"Voyager", "9870000", "2025-08-20T10:00:00Z", "5.0", "110.0", 13},
+	}}), "imo=9870000")
+
+	create := func(key, body string, out interface{}) int {
+		req := httptest.NewRequest("POST", "/share", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		return do(t, a, req, out)
+	}
+	body := fmt.Sprintf(`{"vessel_id": %d, "from": "2025-08-01T00:00:00Z", "to": "2025-08-10T00:00:00Z", "recipient": "Acme"}`, vessel)
+	if status := create("", body, nil); status != 403 {
+		t.Errorf("Expected 403 without an admin key, got %d", status)
+	}
+	var created struct {
+		Token     string    `json:"token"`
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if status := create("admin-key", body, &created); status != 201 || created.Token == "" || !strings.HasSuffix(created.URL, "/share/"+created.Token) {
+		t.Fatalf("Expected a share token, got %d %+v", status, created)
+	}
+	// Without expires_in the token lasts as long as SIGNED_URL_MAX_TTL allows
+	if d := time.Until(created.ExpiresAt); d > 48*time.Hour || d < 47*time.Hour {
+		t.Errorf("Unexpected expiry %v", created.ExpiresAt)
+	}
+
+	var dashboard struct {
+		Vessel struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"vessel"`
+		LatestPosition *struct {
+			Latitude float64 `json:"latitude"`
+		} `json:"latest_position"`
+		Streams []struct {
+			Stream string `json:"stream"`
+		} `json:"streams"`
+	}
+	if status := get(t, a, "/share/"+created.Token, &dashboard); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	// Only the shared range: not the position or engine reading of 20 August
+	if dashboard.Vessel.ID != vessel || dashboard.LatestPosition == nil || dashboard.LatestPosition.Latitude != 1.5 {
+		t.Errorf("Unexpected dashboard %+v", dashboard)
+	}
+	if len(dashboard.Streams) != 2 || dashboard.Streams[0].Stream != "engines" {
+		t.Errorf("Unexpected streams %+v", dashboard.Streams)
+	}
+
+	var track struct {
+		Geometry struct {
+			Coordinates [][2]float64 `json:"coordinates"`
+		} `json:"geometry"`
+	}
+	if status := get(t, a, "/share/"+created.Token+"/track", &track); status != 200 || len(track.Geometry.Coordinates) != 1 {
+		t.Errorf("Expected the position in range, got %d %+v", status, track)
+	}
+
+	if status := get(t, a, "/share/"+created.Token[:len(created.Token)-2]+"xx", nil); status != 403 {
+		t.Errorf("Expected 403 for a tampered token, got %d", status)
+	}
+	for _, bad := range []string{
+		fmt.Sprintf(`{"vessel_id": %d, "from": "2025-08-10T00:00:00Z", "to": "2025-08-01T00:00:00Z"}`, vessel),
+		fmt.Sprintf(`{"vessel_id": %d, "from": "2025-08-01"}`, vessel),
+		fmt.Sprintf(`{"vessel_id": %d, "from": "2025-08-01T00:00:00Z", "to": "2025-08-10T00:00:00Z", "expires_in": "720h"}`, vessel),
+	} {
+		if status := create("admin-key", bad, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", bad, status)
+		}
+	}
+	if status := create("admin-key", `{"vessel_id": 999, "from": "2025-08-01T00:00:00Z", "to": "2025-08-10T00:00:00Z"}`, nil); status != 404 {
+		t.Errorf("Expected 404 for an unknown vessel, got %d", status)
+	}
+}
+
+func TestIngestISO19848(t *testing.T) {
+	a := newTestApp(t)
+	const (
+		rpm     = "/dnv-v2/vis-3-4a/411.1-1/C101.31/meta/qty-revolution"
+		lat     = "/dnv-v2/vis-3-4a/411.1/meta/qty-latitude"
+		lon     = "/dnv-v2/vis-3-4a/411.1/meta/qty-longitude"
+		draught = "/dnv-v2/vis-3-4a/411.1/meta/qty-draught/pos-aft"
+		hatch   = "/dnv-v2/vis-3-4a/622.1/meta/state-opened"
+	)
+	post := func(body, query string, out interface{}) int {
+		req := httptest.NewRequest("POST", "/ingest/iso19848?"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	pkg := func(shipID string, rows ...string) string {
+		return fmt.Sprintf(`{"Package": {"Header": {"ShipID": %q}, "TimeSeriesData": [{
+			"TabularData": [{"DataChannelID": ["data.dnv.com/IMO9811000%s", %q, %q, %q], "DataSet": [%s]}],
+			"EventData": {"DataSet": [{"TimeStamp": "2025-08-08T10:05:00Z", "DataChannelID": %q, "Value": "open", "Quality": "0"}]}
+		}]}}`, shipID, rpm, lat, lon, draught, strings.Join(rows, ","), hatch)
+	}
+	first := pkg("IMO9811000",
+		`{"TimeStamp": "2025-08-08T10:00:00Z", "Value": ["80", "51.9", "4.2", "11.2"]}`,
+		`{"TimeStamp": "2025-08-08T11:00:00Z", "Value": ["82", "51.95", "3.9", ""]}`)
+
+	var result ingestResult
+	if status := post(first, "vessel_name=Equator", &result); status != 200 {
+		t.Fatalf("Expected 200, got %d (%s)", status, result.Error)
+	}
+	// The positions and the unmapped draught and hatch are kept as channel readings
+	if result.RowsInserted["engines"] != 2 || result.RowsInserted["location"] != 1 || result.RowsInserted["channels"] != 6 {
+		t.Errorf("Unexpected rows %v, warnings %v", result.RowsInserted, result.Warnings)
+	}
+	engines := telemetry(t, a, result.VesselID, "stream=engines")
+	if len(engines) != 2 || engines[1]["ts"] != "2025-08-08T11:00:00Z" || engines[1]["engine_no"] != 1.0 || engines[1]["rpm"] != 82.0 {
+		t.Errorf("Unexpected engine readings %v", engines)
+	}
+	location := telemetry(t, a, result.VesselID, "stream=location")
+	if len(location) != 1 || location[0]["ts"] != "2025-08-08T11:00:00Z" || location[0]["latitude"] != 51.95 {
+		t.Errorf("Expected the newest position, got %v", location)
+	}
+	var vessels []map[string]interface{}
+	get(t, a, "/vessels", &vessels)
+	if len(vessels) != 1 || vessels[0]["name"] != "Equator" || vessels[0]["imo"] != "9811000" {
+		t.Fatalf("Unexpected vessels %v", vessels)
+	}
+	if status := post(first, "", nil); status != 409 {
+		t.Errorf("Expected 409 for a package ingested before, got %d", status)
+	}
+
+	vesselURL := fmt.Sprintf("/vessels/%d", result.VesselID)
+	var channels struct {
+		Items []models.ChannelSummary `json:"items"`
+	}
+	get(t, a, vesselURL+"/channels", &channels)
+	if len(channels.Items) != 4 || channels.Items[0].ChannelID != draught || channels.Items[0].Readings != 1 {
+		t.Errorf("Unexpected channels %+v", channels.Items)
+	}
+	var readings struct {
+		Items []models.ChannelReading `json:"items"`
+	}
+	get(t, a, vesselURL+"/channels/readings?channel_id="+url.QueryEscape(hatch), &readings)
+	if len(readings.Items) != 1 || readings.Items[0].Value != nil || readings.Items[0].TextValue == nil || *readings.Items[0].TextValue != "open" || !readings.Items[0].Event {
+		t.Errorf("Unexpected readings %+v", readings.Items)
+	}
+
+	// Mapping the draught channel reads it as the vessel's, naming no stream
+	// the vessel has not got
+	put := func(body string, out interface{}) int {
+		req := httptest.NewRequest("PUT", vesselURL+"/data-channels", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return do(t, a, req, out)
+	}
+	for body, want := range map[string]int{
+		fmt.Sprintf(`{"channel_id": %q, "stream": "engines", "field": "rpm"}`, draught):                             400,
+		fmt.Sprintf(`{"channel_id": %q, "stream": "navigation", "field": "rpm"}`, draught):                          400,
+		fmt.Sprintf(`{"channel_id": %q, "stream": "hull", "field": "draught"}`, draught):                            400,
+		fmt.Sprintf(`{"channel_id": %q, "stream": "navigation", "field": "heading_degrees", "unit": "1"}`, draught): 400,
+	} {
+		if status := put(body, nil); status != want {
+			t.Errorf("%s: expected %d, got %d", body, want, status)
+		}
+	}
+	var mapping models.DataChannelMapping
+	if status := put(fmt.Sprintf(`{"channel_id": %q, "stream": "engines", "field": "temp_c", "unit": "1"}`, "data.dnv.com/IMO9811000"+draught), &mapping); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if mapping.ChannelID != draught || mapping.Source != "vessel" {
+		t.Errorf("Unexpected mapping %+v", mapping)
+	}
+	var mappings struct {
+		Items []models.DataChannelMapping `json:"items"`
+	}
+	get(t, a, vesselURL+"/data-channels", &mappings)
+	if len(mappings.Items) < 2 || mappings.Items[0].ChannelID != draught || mappings.Items[1].Source != "catalog" {
+		t.Errorf("Unexpected mappings %+v", mappings.Items)
+	}
+
+	second := pkg("9811000", `{"TimeStamp": "2025-08-08T12:00:00Z", "Value": ["84", "", "", "85.5"]}`)
+	if status := post(second, "", &result); status != 200 {
+		t.Fatalf("Expected 200, got %d (%s)", status, result.Error)
+	}
+	engines = telemetry(t, a, result.VesselID, "stream=engines")
+	if len(engines) != 3 || engines[2]["rpm"] != 84.0 || engines[2]["temp_c"] != 85.5 {
+		t.Errorf("Expected the mapped channel in the engine reading, got %v", engines)
+	}
+	get(t, a, "/vessels", &vessels)
+	if len(vessels) != 1 || vessels[0]["name"] != "Equator" {
+		t.Errorf("Expected the vessel kept, got %v", vessels)
+	}
+
+	req := httptest.NewRequest("DELETE", vesselURL+"/data-channels?channel_id="+url.QueryEscape(draught), nil)
+	if status := do(t, a, req, nil); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if status := do(t, a, httptest.NewRequest("DELETE", vesselURL+"/data-channels?channel_id="+url.QueryEscape(draught), nil), nil); status != 404 {
+		t.Errorf("Expected 404 once deleted, got %d", status)
+	}
+
+	for body, query := range map[string]string{
+		`{"Package": {}}`: "imo=9811000",
+		pkg("Equator", `{"TimeStamp": "2025-08-08T13:00:00Z", "Value": ["84"]}`):             "imo=9811000",
+		pkg("Equator", `{"TimeStamp": "2025-08-08T13:00:00Z", "Value": ["84", "", "", ""]}`): "",
+	} {
+		if status := post(body, query, nil); status != 400 {
+			t.Errorf("%s: expected 400, got %d", body, status)
+		}
+	}
+}
+
+func TestNMEA2000Feed(t *testing.T) {
+	a := newTestApp(t)
+	ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{
+		{"IMO", "Name", "Flag", "Type"},
+		{"9811000", "Equator", "NO", "Tanker"},
+	}}), "imo=9811000")
+
+	processor := api.NewProcessor(store.New(a.db), config.Config{})
+	listener, err := nmea2000.NewListener(processor, nmea2000.Config{UDPAddr: ":0", IMO: "9811000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.AddDatagram([]byte(
+		"2025-08-08T10:00:01Z,2,127488,17,255,8,00,c0,12,ff,ff,7f,ff,ff\n"+
+			// Fuel tank 2 at 75 % of 20000 l
+			"2025-08-08T10:00:02Z,6,127505,17,255,8,01,3e,49,40,0d,03,00,ff\n"+
+			// Gray water tank 1 at 20 %
+			"2025-08-08T10:00:02Z,6,127505,17,255,8,20,88,13,ff,ff,ff,ff,ff\n"+
+			// 52.0 N 4.5 E, in fast-packet frames
+			"2025-08-08T10:00:03Z,3,129029,17,255,8,40,2b,00,00,00,00,00,00\n"+
+			"2025-08-08T10:00:03Z,3,129029,17,255,8,41,00,00,00,34,b3,3e,69\n"+
+			"2025-08-08T10:00:03Z,3,129029,17,255,8,42,37,07,00,80,e4,f6,42\n"+
+			"2025-08-08T10:00:03Z,3,129029,17,255,8,43,df,9f,00,ff,ff,ff,ff\n"+
+			"2025-08-08T10:00:03Z,3,129029,17,255,8,44,ff,ff,ff,ff,ff,ff,ff\n"+
+			"2025-08-08T10:00:03Z,3,129029,17,255,8,45,ff,ff,ff,ff,ff,ff,ff\n"+
+			"2025-08-08T10:00:03Z,3,129029,17,255,8,46,ff,ff,ff,ff,ff,ff,ff\n"), time.Now())
+	if err := listener.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var vessels []map[string]interface{}
+	get(t, a, "/vessels", &vessels)
+	if len(vessels) != 1 || vessels[0]["name"] != "Equator" || vessels[0]["flag"] != "NO" {
+		t.Fatalf("Expected the vessel as it was, got %v", vessels)
+	}
+	vesselID := int64(vessels[0]["id"].(float64))
+	engines := telemetry(t, a, vesselID, "stream=engines")
+	if len(engines) != 1 || engines[0]["ts"] != "2025-08-08T10:00:00Z" || engines[0]["engine_no"] != 1.0 || engines[0]["rpm"] != 1200.0 {
+		t.Errorf("Unexpected engine readings %v", engines)
+	}
+	fuel := telemetry(t, a, vesselID, "stream=fuel")
+	if len(fuel) != 1 || fuel[0]["tank_no"] != 2.0 || fuel[0]["level_percent"] != 75.0 || fuel[0]["volume_liters"] != 15000.0 {
+		t.Errorf("Unexpected fuel readings %v", fuel)
+	}
+	bilge := telemetry(t, a, vesselID, "stream=bilge")
+	if len(bilge) != 1 || bilge[0]["tank_id"] != "gray_water_1" || bilge[0]["level_percent"] != 20.0 {
+		t.Errorf("Unexpected bilge readings %v", bilge)
+	}
+	location := telemetry(t, a, vesselID, "stream=location")
+	if len(location) != 1 || location[0]["latitude"] != 52.0 || location[0]["longitude"] != 4.5 {
+		t.Errorf("Unexpected position %v", location)
+	}
+}
+
+func TestModbusRegisters(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	result := ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{
+		{"Name"},
+		{"Equator"},
+	}}), "vessel_name=Equator")
+	registersURL := fmt.Sprintf("/vessels/%d/modbus-registers", result.VesselID)
+
+	// A switchboard answering every holding register with 1200
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req := make([]byte, 12)
+				for {
+					if _, err := io.ReadFull(conn, req); err != nil {
+						return
+					}
+					count := int(req[11])
+					resp := append(req[:7:7], 3, byte(2*count))
+					for i := 0; i < count; i++ {
+						resp = append(resp, 0x04, 0xb0)
+					}
+					resp[4], resp[5] = 0, byte(len(resp)-6)
+					conn.Write(resp)
+				}
+			}()
+		}
+	}()
+
+	post := func(body string, out interface{}) int {
+		req := httptest.NewRequest("POST", registersURL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "admin-key")
+		return do(t, a, req, out)
+	}
+	var rpm models.ModbusRegister
+	body := fmt.Sprintf(`{"device": %q, "address": 40, "stream": "engines", "field": "rpm", "unit": "1"}`, ln.Addr())
+	req := httptest.NewRequest("POST", registersURL, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if status := do(t, a, req, nil); status != 403 {
+		t.Errorf("Expected 403 without the admin key, got %d", status)
+	}
+	if status := post(body, &rpm); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if rpm.SlaveID != 1 || rpm.Table != "holding" || rpm.DataType != "uint16" || rpm.Scale != 1 {
+		t.Errorf("Expected the defaults, got %+v", rpm)
+	}
+	if status := post(body, nil); status != 409 {
+		t.Errorf("Expected 409 for a field read by another register, got %d", status)
+	}
+	for _, bad := range []string{
+		`{"device": "switchboard", "address": 1, "stream": "engines", "field": "rpm", "unit": "2"}`,
+		`{"device": "10.0.0.5:502", "stream": "engines", "field": "rpm", "unit": "2"}`,
+		`{"device": "10.0.0.5:502", "address": 1, "stream": "bilge", "field": "level_percent", "unit": "2"}`,
+		`{"device": "10.0.0.5:502", "address": 1, "stream": "engines", "field": "alarms", "unit": "2"}`,
+		`{"device": "10.0.0.5:502", "address": 1, "stream": "engines", "field": "rpm"}`,
+		`{"device": "10.0.0.5:502", "address": 1, "data_type": "int64", "stream": "engines", "field": "rpm", "unit": "2"}`,
+		`{"device": "10.0.0.5:502", "address": 65535, "data_type": "float32", "stream": "engines", "field": "rpm", "unit": "2"}`,
+		`{"device": "10.0.0.5:502", "address": 1, "scale": 0, "stream": "engines", "field": "rpm", "unit": "2"}`,
+	} {
+		if status := post(bad, nil); status != 400 {
+			t.Errorf("Expected 400 for %s, got %d", bad, status)
+		}
+	}
+	var fuel models.ModbusRegister
+	if status := post(fmt.Sprintf(`{"device": %q, "address": 41, "scale": 10, "stream": "fuel", "field": "volume_liters", "unit": "3"}`, ln.Addr()), &fuel); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	// Unreachable
+	var gen models.ModbusRegister
+	if status := post(`{"device": "127.0.0.1:1", "address": 1, "stream": "generators", "field": "load_kw", "unit": "1"}`, &gen); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+
+	put := func(key string) *http.Request {
+		req := httptest.NewRequest("PUT", fmt.Sprintf("%s/%d", registersURL, rpm.ID), strings.NewReader(
+			fmt.Sprintf(`{"device": %q, "address": 40, "scale": 0.25, "stream": "engines", "field": "rpm", "unit": "1"}`, ln.Addr())))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		return req
+	}
+	if status := do(t, a, put(""), nil); status != 403 {
+		t.Errorf("Expected 403 without the admin key, got %d", status)
+	}
+	if status := do(t, a, put("admin-key"), &rpm); status != 200 || rpm.Scale != 0.25 {
+		t.Errorf("Expected the register updated, got %d %+v", status, rpm)
+	}
+
+	processor := api.NewProcessor(store.New(a.db), config.Config{})
+	if err := modbus.NewPoller(store.New(a.db), processor, outbound.Policy{Timeout: time.Second}).PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	engines := telemetry(t, a, result.VesselID, "stream=engines")
+	if len(engines) != 1 || engines[0]["engine_no"] != 1.0 || engines[0]["rpm"] != 300.0 || engines[0]["source"] != "sensor" {
+		t.Errorf("Unexpected engine readings %v", engines)
+	}
+	fuelReadings := telemetry(t, a, result.VesselID, "stream=fuel")
+	if len(fuelReadings) != 1 || fuelReadings[0]["tank_no"] != 3.0 || fuelReadings[0]["volume_liters"] != 12000.0 {
+		t.Errorf("Unexpected fuel readings %v", fuelReadings)
+	}
+
+	var list struct {
+		Items []models.ModbusRegister `json:"items"`
+	}
+	get(t, a, registersURL, &list)
+	if len(list.Items) != 3 {
+		t.Fatalf("Expected 3 registers, got %+v", list.Items)
+	}
+	for _, r := range list.Items {
+		switch {
+		case r.ID == gen.ID && (r.LastError == nil || r.LastValue != nil):
+			t.Errorf("Expected the unreachable register to have failed, got %+v", r)
+		case r.ID != gen.ID && (r.LastError != nil || r.LastValue == nil || r.LastPolledAt == nil):
+			t.Errorf("Expected register %d read, got %+v", r.ID, r)
+		}
+	}
+
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("%s/%d", registersURL, gen.ID), nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	if status := do(t, a, req, nil); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("%s/%d", registersURL, gen.ID), nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	if status := do(t, a, req, nil); status != 404 {
+		t.Errorf("Expected 404 for a deleted register, got %d", status)
+	}
+}
+
+func TestSNMPDevices(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	result := ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{
+		{"Name"},
+		{"Equator"},
+	}}), "vessel_name=Equator")
+	devicesURL := fmt.Sprintf("/vessels/%d/snmp-devices", result.VesselID)
+
+	// An agent of community public answering every request with a
+	// sysUpTime of 100 hours
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		tlv := func(tag byte, content ...byte) []byte { return append([]byte{tag, byte(len(content))}, content...) }
+		cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+			if n < 17 || string(req[7:13]) != "public" {
+				continue
+			}
+			id := req[17 : 17+int(req[16])]
+			varbind := tlv(0x30, cat(tlv(0x06, 0x2b, 6, 1, 2, 1, 1, 3, 0), tlv(0x43, 0x02, 0x25, 0x51, 0x00))...)
+			pdu := cat(tlv(0x02, id...), tlv(0x02, 0), tlv(0x02, 0), tlv(0x30, varbind...))
+			conn.WriteTo(tlv(0x30, cat(tlv(0x02, req[4]), tlv(0x04, []byte("public")...), tlv(0xa2, pdu...))...), from)
+		}
+	}()
+
+	post := func(body string, out interface{}) int {
+		req := httptest.NewRequest("POST", devicesURL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "admin-key")
+		return do(t, a, req, out)
+	}
+	// Of a community the agent ignores
+	var camera models.SNMPDevice
+	body := fmt.Sprintf(`{"name": "CAM-07", "kind": "camera", "address": %q, "community": "secret"}`, conn.LocalAddr())
+	req := httptest.NewRequest("POST", devicesURL, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if status := do(t, a, req, nil); status != 403 {
+		t.Errorf("Expected 403 without the admin key, got %d", status)
+	}
+	if status := post(body, &camera); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if camera.Version != "2c" || camera.StatusOID != nil {
+		t.Errorf("Expected the defaults, got %+v", camera)
+	}
+	if status := post(body, nil); status != 409 {
+		t.Errorf("Expected 409 for a device of the same name, got %d", status)
+	}
+	for _, bad := range []string{
+		`{"kind": "camera", "address": "10.0.0.7"}`,
+		`{"name": "CAM-08", "kind": "printer", "address": "10.0.0.7"}`,
+		`{"name": "CAM-08", "kind": "camera"}`,
+		`{"name": "CAM-08", "kind": "camera", "address": "10.0.0.7:99999"}`,
+		`{"name": "CAM-08", "kind": "camera", "address": "10.0.0.7", "version": "3"}`,
+		`{"name": "CAM-08", "kind": "camera", "address": "10.0.0.7", "status_oid": "enterprises.9"}`,
+		`{"name": "CAM-08", "kind": "camera", "address": "10.0.0.7", "community": ""}`,
+	} {
+		if status := post(bad, nil); status != 400 {
+			t.Errorf("Expected 400 for %s, got %d", bad, status)
+		}
+	}
+	var sw models.SNMPDevice
+	if status := post(fmt.Sprintf(`{"name": "SW-BRIDGE", "kind": "switch", "address": %q, "version": "1"}`, conn.LocalAddr()), &sw); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	// Unreachable
+	var nvr models.SNMPDevice
+	if status := post(`{"name": "NVR-1", "kind": "nvr", "address": "127.0.0.1:1"}`, &nvr); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+
+	// The community is kept when a replacement leaves it out
+	put := func(key string) *http.Request {
+		req := httptest.NewRequest("PUT", fmt.Sprintf("%s/%d", devicesURL, camera.ID), strings.NewReader(
+			fmt.Sprintf(`{"name": "CAM-07", "kind": "camera", "address": %q, "version": "2C"}`, conn.LocalAddr())))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		return req
+	}
+	if status := do(t, a, put(""), nil); status != 403 {
+		t.Errorf("Expected 403 without the admin key, got %d", status)
+	}
+	if status := do(t, a, put("admin-key"), &camera); status != 200 || camera.Version != "2c" {
+		t.Errorf("Expected the device updated, got %d %+v", status, camera)
+	}
+	processor := api.NewProcessor(store.New(a.db), config.Config{})
+	if err := snmp.NewPoller(store.New(a.db), processor, outbound.Policy{Timeout: 200 * time.Millisecond}).PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cctv := telemetry(t, a, result.VesselID, "stream=cctv")
+	want := map[string]string{"CAM-07": "OFFLINE", "NVR-1": "OFFLINE"}
+	if len(cctv) != 2 {
+		t.Fatalf("Expected 2 CCTV readings, got %v", cctv)
+	}
+	for _, r := range cctv {
+		if r["status"] != want[r["cam_id"].(string)] || r["uptime_percent"] != 0.0 || r["source"] != "sensor" {
+			t.Errorf("Unexpected CCTV reading %v", r)
+		}
+	}
+	network := telemetry(t, a, result.VesselID, "stream=network_device")
+	if len(network) != 1 || network[0]["device_id"] != "SW-BRIDGE" || network[0]["device_type"] != "switch" || network[0]["status"] != "ONLINE" ||
+		network[0]["uptime_hours"] != 100.0 || network[0]["availability_percent"] != 100.0 {
+		t.Errorf("Unexpected network device readings %v", network)
+	}
+
+	var list struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	get(t, a, devicesURL, &list)
+	if len(list.Items) != 3 {
+		t.Fatalf("Expected 3 devices, got %+v", list.Items)
+	}
+	for _, d := range list.Items {
+		if _, ok := d["community"]; ok {
+			t.Errorf("Expected the community hidden, got %v", d)
+		}
+		if d["name"] == "SW-BRIDGE" && (d["last_error"] != nil || d["last_uptime_hours"] != 100.0 || d["last_status"] != "ONLINE") {
+			t.Errorf("Expected the switch polled, got %v", d)
+		}
+		if d["name"] != "SW-BRIDGE" && (d["last_error"] == nil || d["last_status"] != "OFFLINE") {
+			t.Errorf("Expected %v to have failed", d["name"])
+		}
+	}
+
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("%s/%d", devicesURL, nvr.ID), nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	if status := do(t, a, req, nil); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("%s/%d", devicesURL, nvr.ID), nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	if status := do(t, a, req, nil); status != 404 {
+		t.Errorf("Expected 404 for a deleted device, got %d", status)
+	}
+}
+
+func TestONVIFCameras(t *testing.T) {
+	a, err := New(config.Config{DBPath: filepath.Join(t.TempDir(), "telemetry.db"), AdminAPIKeys: []string{"admin-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	result := ingest(t, a, workbook(t, sheet{"Ship Info", [][]interface{}{
+		{"Name"},
+		{"Equator"},
+	}}), "vessel_name=Equator")
+	camerasURL := fmt.Sprintf("/vessels/%d/onvif-cameras", result.VesselID)
+
+	// A camera without a recording service, which asks for no credentials
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body string
+		switch {
+		case bytes.Contains(data, []byte("GetSystemDateAndTime")):
+			body = `<GetSystemDateAndTimeResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><SystemDateAndTime/></GetSystemDateAndTimeResponse>`
+		case bytes.Contains(data, []byte("GetDeviceInformation")):
+			body = `<GetDeviceInformationResponse xmlns="http://www.onvif.org/ver10/device/wsdl"><Manufacturer>Hikvision</Manufacturer><Model>DS-2CD2143</Model><FirmwareVersion>V5.7.3</FirmwareVersion></GetDeviceInformationResponse>`
+		default:
+			body = `<GetServicesResponse xmlns="http://www.onvif.org/ver10/device/wsdl"/>`
+		}
+		io.WriteString(w, `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>`+body+`</s:Body></s:Envelope>`)
+	}))
+	defer camera.Close()
+
+	post := func(url, body string, out interface{}) int {
+		req := httptest.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "admin-key")
+		return do(t, a, req, out)
+	}
+	body := fmt.Sprintf(`{"cam_id": "CAM-07", "endpoint": %q, "username": "admin", "password": "secret"}`, camera.URL+onvif.DevicePath)
+	req := httptest.NewRequest("POST", camerasURL, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if status := do(t, a, req, nil); status != 403 {
+		t.Errorf("Expected 403 without the admin key, got %d", status)
+	}
+	var cam7 models.ONVIFCamera
+	if status := post(camerasURL, body, &cam7); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	// Unreachable, given as a bare host
+	var cam8 models.ONVIFCamera
+	if status := post(camerasURL, `{"cam_id": "CAM-08", "endpoint": "127.0.0.1:1"}`, &cam8); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if cam8.Endpoint != "http://127.0.0.1:1/onvif/device_service" {
+		t.Errorf("Expected the usual device service, got %s", cam8.Endpoint)
+	}
+	if status := post(camerasURL, `{"cam_id": "cam-07", "endpoint": "10.0.0.7"}`, nil); status != 409 {
+		t.Errorf("Expected 409 for a camera of the same cam_id, got %d", status)
+	}
+	if status := post(fmt.Sprintf("/vessels/%d/snmp-devices", result.VesselID), `{"name": "CAM-09", "kind": "camera", "address": "10.0.0.9"}`, nil); status != 201 {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if status := post(camerasURL, `{"cam_id": "CAM-09", "endpoint": "10.0.0.9"}`, nil); status != 409 {
+		t.Errorf("Expected 409 for a camera polled over SNMP, got %d", status)
+	}
+	if status := post(fmt.Sprintf("/vessels/%d/snmp-devices", result.VesselID), `{"name": "CAM-07", "kind": "nvr", "address": "10.0.0.7"}`, nil); status != 409 {
+		t.Errorf("Expected 409 for an SNMP device of an ONVIF camera, got %d", status)
+	}
+	for _, bad := range []string{
+		`{"endpoint": "10.0.0.7"}`,
+		`{"cam_id": "CAM-10"}`,
+		`{"cam_id": "CAM-10", "endpoint": "rtsp://10.0.0.10/stream"}`,
+		`{"cam_id": "CAM-10", "endpoint": "http://"}`,
+	} {
+		if status := post(camerasURL, bad, nil); status != 400 {
+			t.Errorf("Expected 400 for %s, got %d", bad, status)
+		}
+	}
+
+	// The password is kept when a replacement leaves it out
+	req = httptest.NewRequest("PUT", fmt.Sprintf("%s/%d", camerasURL, cam7.ID), strings.NewReader(
+		fmt.Sprintf(`{"cam_id": "CAM-07", "endpoint": %q, "username": " admin "}`, camera.URL+onvif.DevicePath)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "admin-key")
+	if status := do(t, a, req, &cam7); status != 200 || cam7.Username == nil || *cam7.Username != "admin" {
+		t.Errorf("Expected the camera updated, got %d %+v", status, cam7)
+	}
+	if stored, err := store.New(a.db).ONVIFCamera(context.Background(), result.VesselID, cam7.ID); err != nil || stored.Password != "secret" {
+		t.Errorf("Expected the password kept, got %+v %v", stored, err)
+	}
+
+	// CAM-08 has not answered for an hour
+	if _, err := a.db.Exec("UPDATE onvif_cameras SET updated_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Hour), cam8.ID); err != nil {
+		t.Fatal(err)
+	}
+	processor := api.NewProcessor(store.New(a.db), config.Config{})
+	poller := onvif.NewPoller(store.New(a.db), processor, outbound.Policy{Timeout: 200 * time.Millisecond}, 5*time.Minute)
+	if err := poller.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cctv := telemetry(t, a, result.VesselID, "stream=cctv")
+	want := map[string]string{"CAM-07": "ONLINE", "CAM-08": "OFFLINE"}
+	if len(cctv) != 2 {
+		t.Fatalf("Expected 2 CCTV readings, got %v", cctv)
+	}
+	for _, r := range cctv {
+		if r["status"] != want[r["cam_id"].(string)] || r["source"] != "sensor" {
+			t.Errorf("Unexpected CCTV reading %v", r)
+		}
+	}
+
+	var list struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	get(t, a, camerasURL, &list)
+	if len(list.Items) != 2 {
+		t.Fatalf("Expected 2 cameras, got %+v", list.Items)
+	}
+	for _, c := range list.Items {
+		if _, ok := c["password"]; ok {
+			t.Errorf("Expected the password hidden, got %v", c)
+		}
+		if c["cam_id"] == "CAM-07" && (c["model"] != "DS-2CD2143" || c["last_status"] != "ONLINE" || c["last_seen_at"] == nil) {
+			t.Errorf("Expected CAM-07 polled, got %v", c)
+		}
+		if c["cam_id"] == "CAM-08" && (c["last_error"] == nil || c["last_status"] != "OFFLINE" || c["last_seen_at"] != nil) {
+			t.Errorf("Expected CAM-08 to have failed, got %v", c)
+		}
+	}
+
+	alertsURL := fmt.Sprintf("/vessels/%d/camera-alerts?open=true", result.VesselID)
+	var alerts struct {
+		Items []models.CameraAlert `json:"items"`
+	}
+	get(t, a, alertsURL, &alerts)
+	if len(alerts.Items) != 1 || alerts.Items[0].CamID != "CAM-08" || alerts.Items[0].ResolvedAt != nil {
+		t.Fatalf("Expected an open alert for CAM-08, got %+v", alerts.Items)
+	}
+
+	// CAM-08 answers once pointed at the camera
+	req = httptest.NewRequest("PUT", fmt.Sprintf("%s/%d", camerasURL, cam8.ID), strings.NewReader(
+		fmt.Sprintf(`{"cam_id": "CAM-08", "endpoint": %q}`, camera.URL+onvif.DevicePath)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "admin-key")
+	if status := do(t, a, req, nil); status != 200 {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if err := poller.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	get(t, a, alertsURL, &alerts)
+	if len(alerts.Items) != 0 {
+		t.Errorf("Expected no open alerts, got %+v", alerts.Items)
+	}
+	get(t, a, fmt.Sprintf("/vessels/%d/camera-alerts", result.VesselID), &alerts)
+	if len(alerts.Items) != 1 || alerts.Items[0].ResolvedAt == nil {
+		t.Errorf("Expected the alert resolved, got %+v", alerts.Items)
+	}
+
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("%s/%d", camerasURL, cam8.ID), nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	if status := do(t, a, req, nil); status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("%s/%d", camerasURL, cam8.ID), nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	if status := do(t, a, req, nil); status != 404 {
+		t.Errorf("Expected 404 for a deleted camera, got %d", status)
+	}
+}
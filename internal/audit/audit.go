@@ -0,0 +1,143 @@
+// Package audit implements the tamper-evident log: an append-only list of
+// entries where each entry's hash covers its content and the previous
+// entry's hash. Changing, removing or reordering an entry breaks every hash
+// after it, so a log that verifies, together with its head hash kept
+// elsewhere, shows nothing was rewritten.
+//
+// Entries record API changes (kind audit) and writes of chained telemetry
+// streams (kind reading). A reading entry carries a digest of the reading as
+// written, so later edits to the reading itself are detected too.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of entries.
+const (
+	KindAudit   = "audit"
+	KindReading = "reading"
+)
+
+// Entry is one link of the chain.
+type Entry struct {
+	Seq        int64     `json:"seq"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Kind       string    `json:"kind"`
+	Action     string    `json:"action"` // e.g. vessel.archive, or insert/update for readings
+	Actor      string    `json:"actor,omitempty"`
+	VesselID   *int64    `json:"vessel_id"`
+	Subject    string    `json:"subject,omitempty"` // what an audit entry is about, e.g. reference/flags/PA
+	Stream     string    `json:"stream,omitempty"`  // reading entries only
+	ReadingID  *int64    `json:"reading_id,omitempty"`
+	Digest     string    `json:"digest,omitempty"` // of the reading, or of Detail
+	Detail     string    `json:"detail,omitempty"` // JSON
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+}
+
+// TimeFormat is how RecordedAt is stored and hashed.
+const TimeFormat = time.RFC3339Nano
+
+// ComputeHash returns the hash of e, which covers every field but Hash.
+func (e Entry) ComputeHash() string {
+	vesselID, readingID := "", ""
+	if e.VesselID != nil {
+		vesselID = strconv.FormatInt(*e.VesselID, 10)
+	}
+	if e.ReadingID != nil {
+		readingID = strconv.FormatInt(*e.ReadingID, 10)
+	}
+	parts := []string{
+		e.PrevHash,
+		strconv.FormatInt(e.Seq, 10),
+		e.RecordedAt.UTC().Format(TimeFormat),
+		e.Kind, e.Action, e.Actor, vesselID, e.Subject, e.Stream, readingID, e.Digest, e.Detail,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Digest hashes scanned column values. Values are tagged with their type so
+// NULL, "" and 0 differ.
+func Digest(values ...interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		switch val := v.(type) {
+		case nil:
+			parts[i] = "n"
+		case int64:
+			parts[i] = "i" + strconv.FormatInt(val, 10)
+		case float64:
+			parts[i] = "f" + strconv.FormatFloat(val, 'g', -1, 64)
+		case string:
+			parts[i] = "s" + val
+		case []byte:
+			parts[i] = "s" + string(val)
+		case time.Time:
+			parts[i] = "t" + val.UTC().Format(time.RFC3339Nano)
+		case bool:
+			parts[i] = "b" + strconv.FormatBool(val)
+		default:
+			parts[i] = "?" + fmt.Sprint(val)
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Problem is a verification failure at an entry.
+type Problem struct {
+	Seq     int64  `json:"seq"`
+	Problem string `json:"problem"`
+}
+
+// MaxProblems bounds the problems a Checker lists; further ones are only
+// counted.
+const MaxProblems = 100
+
+// Checker verifies entries in seq order.
+type Checker struct {
+	Entries      int64     `json:"entries"`
+	Head         *Entry    `json:"head"` // last entry seen
+	Problems     []Problem `json:"problems"`
+	MoreProblems int64     `json:"more_problems"` // beyond MaxProblems
+}
+
+// Report records a problem at seq.
+func (c *Checker) Report(seq int64, problem string) {
+	if len(c.Problems) >= MaxProblems {
+		c.MoreProblems++
+		return
+	}
+	c.Problems = append(c.Problems, Problem{seq, problem})
+}
+
+// OK reports whether no problem was found.
+func (c *Checker) OK() bool {
+	return len(c.Problems) == 0
+}
+
+// Add checks e against its predecessor.
+func (c *Checker) Add(e Entry) {
+	prev := ""
+	if c.Head != nil {
+		prev = c.Head.Hash
+		if e.Seq <= c.Head.Seq {
+			c.Report(e.Seq, "out of order")
+		}
+	}
+	if e.PrevHash != prev {
+		c.Report(e.Seq, "previous hash does not match, an entry before it was changed or removed")
+	}
+	if e.Hash != e.ComputeHash() {
+		c.Report(e.Seq, "hash does not match the entry's content")
+	}
+	c.Entries++
+	c.Head = &e
+}
@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+func chain(n int) []Entry {
+	vesselID := int64(1)
+	var entries []Entry
+	prev := ""
+	for i := 1; i <= n; i++ {
+		e := Entry{
+			Seq:        int64(i),
+			RecordedAt: time.Date(2025, 1, 1, 0, i, 0, 0, time.UTC),
+			Kind:       KindAudit,
+			Action:     "vessel.archive",
+			VesselID:   &vesselID,
+			PrevHash:   prev,
+		}
+		e.Hash = e.ComputeHash()
+		prev = e.Hash
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func check(entries []Entry) *Checker {
+	c := &Checker{}
+	for _, e := range entries {
+		c.Add(e)
+	}
+	return c
+}
+
+func TestChecker(t *testing.T) {
+	if c := check(chain(3)); !c.OK() || c.Entries != 3 || c.Head.Seq != 3 {
+		t.Errorf("Expected an intact chain, got %+v", c)
+	}
+
+	edited := chain(3)
+	edited[1].Action = "vessel.unarchive"
+	if c := check(edited); len(c.Problems) != 1 || c.Problems[0].Seq != 2 {
+		t.Errorf("Expected the edited entry to be reported, got %+v", c.Problems)
+	}
+
+	// Rehashing the edited entry moves the break to its successor
+	edited[1].Hash = edited[1].ComputeHash()
+	if c := check(edited); len(c.Problems) != 1 || c.Problems[0].Seq != 3 {
+		t.Errorf("Expected the next entry to be reported, got %+v", c.Problems)
+	}
+
+	removed := chain(3)
+	removed = append(removed[:1], removed[2:]...)
+	if c := check(removed); len(c.Problems) != 1 || c.Problems[0].Seq != 3 {
+		t.Errorf("Expected the gap to be reported, got %+v", c.Problems)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	if Digest(nil) == Digest("") || Digest(int64(1)) == Digest(1.0) || Digest("a", "b") == Digest("ab") {
+		t.Error("Expected distinct values to have distinct digests")
+	}
+	if Digest([]byte("x"), 2.5) != Digest("x", 2.5) {
+		t.Error("Expected text to digest the same as bytes or string")
+	}
+}
@@ -0,0 +1,90 @@
+// Package cache keeps the responses of hot reads (the vessel list, kiosk
+// snapshots) so polling clients do not each cost a round of SQLite queries.
+//
+// Values are cached under a generation that Invalidate moves on, which is
+// how ingest drops every value at once without knowing their keys. A value
+// loaded while the generation moved is stored under the generation it was
+// read in, so it is never served after the invalidation.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is a store of values shared by the requests that read them.
+type Cache interface {
+	// Get returns the value cached for key, or else the one load returns,
+	// cached for ttl. Errors of the cache itself only make it a miss.
+	Get(ctx context.Context, key string, ttl time.Duration, load func() ([]byte, error)) ([]byte, error)
+	// Invalidate drops every value, after the data they came from changed.
+	Invalidate(ctx context.Context) error
+}
+
+// Memory is a Cache in the process, for single-server deployments.
+type Memory struct {
+	maxEntries int
+
+	mu         sync.Mutex
+	generation uint64
+	entries    map[string]entry
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory creates a cache of up to maxEntries values; when full, expired
+// values are dropped, and all of them if none had.
+func NewMemory(maxEntries int) *Memory {
+	return &Memory{maxEntries: maxEntries, entries: make(map[string]entry)}
+}
+
+func (m *Memory) Get(ctx context.Context, key string, ttl time.Duration, load func() ([]byte, error)) ([]byte, error) {
+	m.mu.Lock()
+	e, ok := m.entries[key]
+	generation := m.generation
+	m.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.generation != generation {
+		return value, nil // invalidated while loading
+	}
+	if len(m.entries) >= m.maxEntries {
+		m.evict()
+	}
+	m.entries[key] = entry{value: value, expires: time.Now().Add(ttl)}
+	return value, nil
+}
+
+func (m *Memory) Invalidate(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generation++
+	m.entries = make(map[string]entry)
+	return nil
+}
+
+// evict makes room; the caller holds mu.
+func (m *Memory) evict() {
+	now := time.Now()
+	for key, e := range m.entries {
+		if !now.Before(e.expires) {
+			delete(m.entries, key)
+		}
+	}
+	if len(m.entries) >= m.maxEntries {
+		m.entries = make(map[string]entry)
+	}
+}
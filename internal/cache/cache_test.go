@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// fakeRedis serves GET, SET, INCR, AUTH and SELECT from a map.
+type fakeRedis struct {
+	addr     string
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{addr: ln.Addr().String(), password: password, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args[0])
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			if authed = args[1] == f.password; authed {
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			if v, ok := f.values[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			f.values[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case args[0] == "INCR":
+			n, _ := strconv.Atoi(f.values[args[1]])
+			f.values[args[1]] = strconv.Itoa(n + 1)
+			reply = fmt.Sprintf(":%d\r\n", n+1)
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+// testCache runs the behaviour every Cache shares.
+func testCache(t *testing.T, c Cache) {
+	ctx := context.Background()
+	loads := 0
+	load := func(value string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			loads++
+			return []byte(value), nil
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if v, err := c.Get(ctx, "vessels", time.Minute, load("a")); err != nil || string(v) != "a" {
+			t.Fatalf("Unexpected value %q %v", v, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("Expected the second read to be cached, loaded %d times", loads)
+	}
+
+	if err := c.Invalidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.Get(ctx, "vessels", time.Minute, load("b")); string(v) != "b" || loads != 2 {
+		t.Errorf("Expected a new value once invalidated, got %q after %d loads", v, loads)
+	}
+
+	// A value loaded while invalidated must not outlive the invalidation
+	c.Get(ctx, "kiosk", time.Minute, func() ([]byte, error) {
+		c.Invalidate(ctx)
+		return []byte("stale"), nil
+	})
+	if v, _ := c.Get(ctx, "kiosk", time.Minute, load("fresh")); string(v) != "fresh" {
+		t.Errorf("Expected the value loaded during the invalidation to be dropped, got %q", v)
+	}
+
+	if _, err := c.Get(ctx, "failing", time.Minute, func() ([]byte, error) { return nil, fmt.Errorf("db down") }); err == nil {
+		t.Error("Expected the error of load")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testCache(t, NewMemory(10))
+
+	c := NewMemory(2)
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		c.Get(ctx, key, time.Minute, func() ([]byte, error) { return []byte(key), nil })
+	}
+	if len(c.entries) > 2 {
+		t.Errorf("Expected at most 2 entries, got %d", len(c.entries))
+	}
+	c.Get(ctx, "short", -time.Second, func() ([]byte, error) { return []byte("1"), nil })
+	if v, _ := c.Get(ctx, "short", time.Minute, func() ([]byte, error) { return []byte("2"), nil }); string(v) != "2" {
+		t.Errorf("Expected an expired value to be loaded again, got %q", v)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	server := newFakeRedis(t, "s3cret")
+	c, err := NewRedis(server.addr, "s3cret", 2, outbound.Policy{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCache(t, c)
+
+	server.mu.Lock()
+	commands := strings.Join(server.commands, " ")
+	server.mu.Unlock()
+	if !strings.HasPrefix(commands, "AUTH SELECT GET") || strings.Count(commands, "AUTH") != 1 {
+		t.Errorf("Expected one authenticated connection to be reused, got %s", commands)
+	}
+
+	if _, err := NewRedis("localhost", "", 0, outbound.Policy{}); err == nil {
+		t.Error("Expected an address without port to be refused")
+	}
+}
+
+func TestRedisDown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c, _ := NewRedis(addr, "", 0, outbound.Policy{Timeout: time.Second})
+	loads := 0
+	for i := 0; i < 2; i++ {
+		v, err := c.Get(context.Background(), "vessels", time.Minute, func() ([]byte, error) {
+			loads++
+			return []byte("a"), nil
+		})
+		if err != nil || string(v) != "a" {
+			t.Fatalf("Expected reads to fall back to load, got %q %v", v, err)
+		}
+	}
+	if loads != 2 {
+		t.Errorf("Expected every read to load, loaded %d times", loads)
+	}
+	if err := c.Invalidate(context.Background()); err == nil {
+		t.Error("Expected invalidating to fail while the server is down")
+	}
+}
@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// keyPrefix namespaces the keys of the cache in a shared Redis server.
+const keyPrefix = "vessel-telemetry:"
+
+// maxIdle is the number of connections kept open between requests.
+const maxIdle = 8
+
+// Redis is a Cache in a Redis server, shared by all servers of a deployment.
+type Redis struct {
+	addr     string // host:port
+	password string
+	db       int
+	out      *outbound.Integration
+	idle     chan *redisConn
+}
+
+// NewRedis creates a cache in the Redis server at addr, authenticating with
+// password if set and using database db. Calls are guarded by policy; while
+// the server is unreachable every read is a miss.
+func NewRedis(addr, password string, db int, policy outbound.Policy) (*Redis, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid Redis address %q, use host:port", addr)
+	}
+	// A miss costs less than waiting for a retry
+	policy.Retries = 0
+	return &Redis{
+		addr:     addr,
+		password: password,
+		db:       db,
+		out:      outbound.New("redis", policy),
+		idle:     make(chan *redisConn, maxIdle),
+	}, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string, ttl time.Duration, load func() ([]byte, error)) ([]byte, error) {
+	generation, err := r.generation(ctx)
+	if err == nil {
+		var value interface{}
+		err = r.out.Do(ctx, func(ctx context.Context) (err error) {
+			value, err = r.do(ctx, "GET", keyPrefix+generation+":"+key)
+			return err
+		})
+		if cached, ok := value.([]byte); ok && err == nil {
+			return cached, nil
+		}
+	}
+	logError(err)
+
+	value, err := load()
+	if err != nil || generation == "" {
+		return value, err
+	}
+	logError(r.out.Do(ctx, func(ctx context.Context) error {
+		_, err := r.do(ctx, "SET", keyPrefix+generation+":"+key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+		return err
+	}))
+	return value, nil
+}
+
+// Invalidate moves the generation on; the values of earlier ones are left
+// to expire.
+func (r *Redis) Invalidate(ctx context.Context) error {
+	return r.out.Do(ctx, func(ctx context.Context) error {
+		_, err := r.do(ctx, "INCR", keyPrefix+"generation")
+		return err
+	})
+}
+
+// generation returns the current generation, "0" before any invalidation.
+func (r *Redis) generation(ctx context.Context) (string, error) {
+	var reply interface{}
+	err := r.out.Do(ctx, func(ctx context.Context) (err error) {
+		reply, err = r.do(ctx, "GET", keyPrefix+"generation")
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if b, ok := reply.([]byte); ok {
+		return string(b), nil
+	}
+	return "0", nil
+}
+
+// logError logs errors of the server, but not each read refused while the
+// circuit is open.
+func logError(err error) {
+	if err != nil && !errors.Is(err, outbound.ErrCircuitOpen) {
+		log.Printf("cache: %v", err)
+	}
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends one command and returns its reply: nil, a string, an int64 or
+// []byte for a bulk string.
+func (r *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(ctx, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.Close() // the stream may be out of step
+		return nil, err
+	}
+	select {
+	case r.idle <- c:
+	default:
+		c.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection, or a new one, authenticated and on db.
+func (r *Redis) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if r.password != "" {
+		if _, err := c.do(ctx, "AUTH", r.password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := c.do(ctx, "SELECT", strconv.Itoa(r.db)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, _ := ctx.Deadline() // none if zero
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+// reply reads a RESP reply; arrays are not needed by the commands sent.
+func (c *redisConn) reply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,309 @@
+// Package chunked receives files in chunks, so uploads over unreliable
+// links (a satellite connection dropping mid-upload) resume where they
+// stopped instead of starting over.
+//
+// An upload is announced with its size, and optionally the SHA-256 of the
+// whole file, then sent as chunks appended in order, each with its own
+// SHA-256. A chunk whose offset is not the number of bytes received so far
+// is refused with that number, which is also what a client that lost track
+// asks for before resuming. Chunks are written to a file per upload; the
+// state is kept in the database so uploads survive a restart. Uploads no
+// chunk arrived for within the expiry are dropped.
+package chunked
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+var (
+	// ErrInvalid is returned for uploads announced without a name or size,
+	// or with a malformed checksum, and empty chunks.
+	ErrInvalid = errors.New("invalid upload")
+	// ErrNotFound is returned for uploads that do not exist, or no longer.
+	ErrNotFound = errors.New("upload not found")
+	// ErrOffset is returned for chunks that do not continue the upload.
+	ErrOffset = errors.New("chunk does not start at the bytes received")
+	// ErrChecksum is returned for chunks, or whole files, whose SHA-256
+	// is not the one announced.
+	ErrChecksum = errors.New("checksum mismatch")
+	// ErrTooLarge is returned for uploads over the size limit, and chunks
+	// past the size announced.
+	ErrTooLarge = errors.New("upload too large")
+	// ErrIncomplete is returned when assembling an upload not all bytes
+	// of which were received.
+	ErrIncomplete = errors.New("upload is incomplete")
+)
+
+// Store is what is needed of the database.
+type Store interface {
+	CreateChunkedUpload(ctx context.Context, u models.ChunkedUpload) error
+	ChunkedUpload(ctx context.Context, id string) (*models.ChunkedUpload, error)
+	AdvanceChunkedUpload(ctx context.Context, id string, from, to int64, expiresAt time.Time) (bool, error)
+	DeleteChunkedUpload(ctx context.Context, id string) error
+	ExpiredChunkedUploads(ctx context.Context, now time.Time) ([]string, error)
+}
+
+// Manager keeps the uploads in progress.
+type Manager struct {
+	store   Store
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex // one per upload, so its chunks are written in turn
+}
+
+// New creates a manager keeping the chunks received in dir, created when
+// needed, for uploads of up to maxSize bytes that expire ttl after their
+// last chunk.
+func New(st Store, dir string, ttl time.Duration, maxSize int64) *Manager {
+	return &Manager{store: st, dir: dir, ttl: ttl, maxSize: maxSize, locks: make(map[string]*sync.Mutex)}
+}
+
+// MaxSize returns the largest upload accepted.
+func (m *Manager) MaxSize() int64 {
+	return m.maxSize
+}
+
+// Create starts an upload of a file of size bytes. fileSHA256, if not empty,
+// is the hex SHA-256 of the whole file, checked once it is assembled.
+func (m *Manager) Create(ctx context.Context, filename string, size int64, fileSHA256 string) (*models.ChunkedUpload, error) {
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if filename == "" || filename == "." || filename == "/" {
+		return nil, fmt.Errorf("%w: filename is required", ErrInvalid)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: size must be positive", ErrInvalid)
+	}
+	if size > m.maxSize {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrTooLarge, m.maxSize)
+	}
+	fileSHA256 = strings.ToLower(fileSHA256)
+	if fileSHA256 != "" && !isSHA256(fileSHA256) {
+		return nil, fmt.Errorf("%w: sha256 must be 64 hex digits", ErrInvalid)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	u := models.ChunkedUpload{
+		ID:        hex.EncodeToString(id),
+		Filename:  filename,
+		Size:      size,
+		SHA256:    fileSHA256,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.ttl),
+	}
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(m.file(u.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err := m.store.CreateChunkedUpload(ctx, u); err != nil {
+		os.Remove(m.file(u.ID))
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Get returns an upload in progress.
+func (m *Manager) Get(ctx context.Context, id string) (*models.ChunkedUpload, error) {
+	if !isID(id) {
+		return nil, ErrNotFound
+	}
+	u, err := m.store.ChunkedUpload(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	return u, err
+}
+
+// Append adds a chunk at offset, which must be the bytes received so far,
+// if its hex SHA-256 is chunkSHA256. On ErrOffset the upload returned says
+// where to resume.
+func (m *Manager) Append(ctx context.Context, id string, offset int64, chunk []byte, chunkSHA256 string) (*models.ChunkedUpload, error) {
+	lock := m.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	u, err := m.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != u.Received {
+		return u, ErrOffset
+	}
+	if len(chunk) == 0 {
+		return u, fmt.Errorf("%w: chunk is empty", ErrInvalid)
+	}
+	if offset+int64(len(chunk)) > u.Size {
+		return u, fmt.Errorf("%w: chunk ends past the %d bytes announced", ErrTooLarge, u.Size)
+	}
+	sum := sha256.Sum256(chunk)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), chunkSHA256) {
+		return u, ErrChecksum
+	}
+
+	f, err := os.OpenFile(m.file(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// Drop what a write cut short by a crash left past the bytes received
+	if err := f.Truncate(offset); err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteAt(chunk, offset); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().UTC().Add(m.ttl)
+	ok, err := m.store.AdvanceChunkedUpload(ctx, id, offset, offset+int64(len(chunk)), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound // removed meanwhile
+	}
+	u.Received += int64(len(chunk))
+	u.ExpiresAt = expiresAt
+	return u, nil
+}
+
+// Assemble returns the whole file of an upload all bytes of which were
+// received, after checking its SHA-256 if one was announced.
+func (m *Manager) Assemble(ctx context.Context, id string) (*models.ChunkedUpload, []byte, error) {
+	lock := m.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	u, err := m.get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Received != u.Size {
+		return u, nil, ErrIncomplete
+	}
+	f, err := os.Open(m.file(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, u.Size))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) != u.Size {
+		return u, nil, fmt.Errorf("%w: %d of %d bytes on disk", ErrIncomplete, len(data), u.Size)
+	}
+	if u.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != u.SHA256 {
+			return u, nil, ErrChecksum
+		}
+	}
+	return u, data, nil
+}
+
+// Remove drops an upload and its chunks.
+func (m *Manager) Remove(ctx context.Context, id string) error {
+	if !isID(id) {
+		return ErrNotFound
+	}
+	lock := m.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := m.store.DeleteChunkedUpload(ctx, id); err != nil {
+		return err
+	}
+	if err := os.Remove(m.file(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.locks, id)
+	m.mu.Unlock()
+	return nil
+}
+
+// PruneExpired drops the uploads that expired and returns how many.
+func (m *Manager) PruneExpired(ctx context.Context) (int, error) {
+	ids, err := m.store.ExpiredChunkedUploads(ctx, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if err := m.Remove(ctx, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// get is Get for callers holding the lock of id, dropping the lock of an
+// upload that does not exist.
+func (m *Manager) get(ctx context.Context, id string) (*models.ChunkedUpload, error) {
+	u, err := m.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		m.mu.Lock()
+		delete(m.locks, id)
+		m.mu.Unlock()
+	}
+	return u, err
+}
+
+func (m *Manager) lock(id string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock, ok := m.locks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.locks[id] = lock
+	}
+	return lock
+}
+
+func (m *Manager) file(id string) string {
+	return filepath.Join(m.dir, id+".part")
+}
+
+// isID reports whether id can be an upload ID, so it is safe in a path.
+func isID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func isSHA256(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,123 @@
+package chunked
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/store"
+)
+
+func newTestManager(t *testing.T, ttl time.Duration) *Manager {
+	t.Helper()
+	database, err := db.Connect(filepath.Join(t.TempDir(), "chunked.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	return New(store.New(database), filepath.Join(t.TempDir(), "uploads"), ttl, 1000)
+}
+
+func sum(data []byte) string {
+	s := sha256.Sum256(data)
+	return hex.EncodeToString(s[:])
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, time.Hour)
+	file := make([]byte, 250)
+	for i := range file {
+		file[i] = byte(i)
+	}
+
+	if _, err := m.Create(ctx, "day1.xlsx", 1001, ""); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+	if _, err := m.Create(ctx, "day1.xlsx", 10, "abc"); err == nil {
+		t.Error("Expected an invalid checksum to be refused")
+	}
+	u, err := m.Create(ctx, `C:\Reports\day1.xlsx`, int64(len(file)), sum(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Filename != "day1.xlsx" || u.Received != 0 {
+		t.Errorf("Unexpected upload %+v", u)
+	}
+
+	if _, err := m.Append(ctx, u.ID, 0, file[:100], sum(file[:100])); err != nil {
+		t.Fatal(err)
+	}
+	// A chunk sent again, e.g. after losing the answer, says where to resume
+	if got, err := m.Append(ctx, u.ID, 0, file[:100], sum(file[:100])); !errors.Is(err, ErrOffset) || got.Received != 100 {
+		t.Errorf("Expected ErrOffset at 100, got %+v %v", got, err)
+	}
+	if _, err := m.Append(ctx, u.ID, 100, file[100:200], sum(file[:100])); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected ErrChecksum, got %v", err)
+	}
+	if _, err := m.Append(ctx, u.ID, 100, append(file[100:], 'x'), sum(append(file[100:], 'x'))); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected a chunk past the size to be refused, got %v", err)
+	}
+	if _, _, err := m.Assemble(ctx, u.ID); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("Expected ErrIncomplete, got %v", err)
+	}
+
+	// What a cut-off write left behind is overwritten
+	f, _ := os.OpenFile(m.file(u.ID), os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte("garbage"))
+	f.Close()
+	if got, err := m.Append(ctx, u.ID, 100, file[100:], sum(file[100:])); err != nil || got.Received != int64(len(file)) {
+		t.Fatalf("Unexpected append %+v %v", got, err)
+	}
+
+	_, data, err := m.Assemble(ctx, u.ID)
+	if err != nil || !bytes.Equal(data, file) {
+		t.Fatalf("Unexpected file (%v)", err)
+	}
+	if err := m.Remove(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(ctx, u.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound once removed, got %v", err)
+	}
+	if _, err := os.Stat(m.file(u.ID)); !os.IsNotExist(err) {
+		t.Errorf("Expected the chunks to be deleted, got %v", err)
+	}
+	if _, err := m.Get(ctx, "../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestAssembleChecksum(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, time.Hour)
+	u, _ := m.Create(ctx, "day1.xlsx", 4, sum([]byte("abcd")))
+	if _, err := m.Append(ctx, u.ID, 0, []byte("abce"), sum([]byte("abce"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Assemble(ctx, u.ID); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected ErrChecksum, got %v", err)
+	}
+}
+
+func TestPruneExpired(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, -time.Second)
+	u, _ := m.Create(ctx, "day1.xlsx", 4, "")
+	if n, err := m.PruneExpired(ctx); err != nil || n != 1 {
+		t.Errorf("Expected one upload pruned, got %d %v", n, err)
+	}
+	if _, err := m.Get(ctx, u.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound once pruned, got %v", err)
+	}
+}
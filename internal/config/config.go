@@ -0,0 +1,565 @@
+package config
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/fair"
+	"vessel-telemetry-api/internal/fueldrop"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// PageLimits are the default and maximum page size of paginated endpoints.
+type PageLimits struct {
+	Default int
+	Max     int
+}
+
+// DefaultKioskNetworks are the loopback, private and link-local ranges, the
+// networks an onboard display connects from.
+const DefaultKioskNetworks = "127.0.0.0/8,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,169.254.0.0/16,::1/128,fc00::/7,fe80::/10"
+
+// DefaultIngestURLMaxBytes applies when INGEST_URL_MAX_MB is unset.
+const DefaultIngestURLMaxBytes = 50 << 20
+
+// DefaultPageLimits apply when PAGE_LIMIT_DEFAULT and PAGE_LIMIT_MAX are unset.
+var DefaultPageLimits = PageLimits{Default: 200, Max: 1000}
+
+// Config holds deployment settings read from the environment.
+type Config struct {
+	Port   string
+	DBPath string
+	// ObjectStoreDir keeps uploaded objects such as camera snapshots;
+	// empty means an objects directory next to the database.
+	ObjectStoreDir string
+
+	AllowUnsafeDuplicateIngest bool
+
+	// Compression is how hard responses are compressed for clients that
+	// accept it: off, speed, default or best.
+	Compression string
+
+	// CacheTTL is how long responses of hot reads (vessel list, kiosk
+	// snapshots) are shared between requests; 0 disables the cache. They
+	// are kept in RedisAddr (host:port) if set, otherwise in the process.
+	CacheTTL      time.Duration
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	// IngestURLMaxBytes bounds the files /ingest/url downloads.
+	// IngestURLAllowPrivate lets it download from loopback, private and
+	// link-local addresses, e.g. a file server on the vessel's LAN.
+	IngestURLMaxBytes     int64
+	IngestURLAllowPrivate bool
+
+	// VesselDailyRowQuota is the default number of rows a vessel may ingest
+	// per UTC day before warnings are raised (0 disables the quota).
+	// Per-vessel overrides live in the vessel_quotas table.
+	VesselDailyRowQuota int
+	// QuotaThrottle rejects further ingests for a vessel once its quota is used up.
+	QuotaThrottle bool
+
+	// FuelDrop tunes the suspicious fuel drop alerts raised on ingest; a zero
+	// MinDropLiters disables them.
+	FuelDrop fueldrop.Options
+
+	// AISProviderURL enables AIS position enrichment. It is a URL template
+	// with {imo} and/or {mmsi} placeholders; empty disables the poller.
+	AISProviderURL  string
+	AISAPIKey       string
+	AISPollInterval time.Duration
+
+	// WeatherProviderURL enables weather enrichment of positions. It is a URL
+	// template with {lat}, {lon} and {time} placeholders; empty disables it.
+	WeatherProviderURL  string
+	WeatherAPIKey       string
+	WeatherPollInterval time.Duration
+
+	// SFTPRemotesFile lists the SFTP directories telemetry files are
+	// collected from (see sftpingest.Remote); empty disables collection.
+	// Files are picked up every SFTPPollInterval once unchanged for
+	// SFTPMinFileAge.
+	SFTPRemotesFile  string
+	SFTPPollInterval time.Duration
+	SFTPMinFileAge   time.Duration
+
+	// S3Bucket names an S3-compatible bucket whose objects under S3Prefix
+	// are ingested; empty disables it. The bucket is listed every
+	// S3PollInterval (0: only objects announced by bucket events), and a
+	// failing object is tried S3MaxAttempts times, waiting S3RetryBackoff,
+	// doubled each time, in between.
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3Prefix       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3PollInterval time.Duration
+	S3MaxAttempts  int
+	S3RetryBackoff time.Duration
+
+	// ChunkedUploadDir keeps the chunks of resumable uploads in progress
+	// (default: uploads next to the database). Uploads are limited to
+	// ChunkedUploadMaxMB and dropped ChunkedUploadTTL after their last
+	// chunk.
+	ChunkedUploadDir   string
+	ChunkedUploadMaxMB int
+	ChunkedUploadTTL   time.Duration
+
+	// DropDir is a local folder whose telemetry files are ingested, e.g. a
+	// share the monitoring PC copies them to; empty disables it. Files are
+	// ingested once unchanged for DropDirSettle, for the vessel DropDirIMO
+	// unless in a folder named by an IMO number, and the folder is scanned
+	// every DropDirRescan besides the changes reported.
+	DropDir       string
+	DropDirIMO    string
+	DropDirSettle time.Duration
+	DropDirRescan time.Duration
+
+	// N2KUDPAddr is the address NMEA 2000 gateways send bus messages to, and
+	// N2KDevice the serial port of an Actisense NGT-1; both empty disables
+	// it. Readings are those of the vessel N2KIMO, kept at N2KInterval
+	// resolution and ingested every N2KFlush.
+	N2KUDPAddr  string
+	N2KDevice   string
+	N2KIMO      string
+	N2KInterval time.Duration
+	N2KFlush    time.Duration
+
+	// ModbusPollInterval is how often the Modbus TCP registers mapped to
+	// vessels' stream fields are read (0 disables it); connections and
+	// requests time out after ModbusTimeout.
+	ModbusPollInterval time.Duration
+	ModbusTimeout      time.Duration
+
+	// SNMPPollInterval is how often the cameras, NVRs and network devices
+	// registered for vessels are polled over SNMP (0 disables it); each
+	// request is sent again after SNMPTimeout, then given up.
+	SNMPPollInterval time.Duration
+	SNMPTimeout      time.Duration
+
+	// ONVIFPollInterval is how often the ONVIF cameras registered for
+	// vessels are polled (0 disables it), each call timing out after
+	// ONVIFTimeout; a camera that has not answered for ONVIFAlertAfter gets
+	// an alert.
+	ONVIFPollInterval time.Duration
+	ONVIFTimeout      time.Duration
+	ONVIFAlertAfter   time.Duration
+
+	// IMAPAddr is the IMAP server (host:port) whose IMAPMailbox is checked
+	// every IMAPPollInterval for emailed telemetry files; empty disables it.
+	// IMAPSenders maps a lower-case sender address, or @domain, to the IMO
+	// of the vessel it reports for.
+	IMAPAddr         string
+	IMAPTLS          bool
+	IMAPUser         string
+	IMAPPassword     string
+	IMAPMailbox      string
+	IMAPSenders      map[string]string
+	IMAPPollInterval time.Duration
+
+	// SMTPAddr is the relay (host:port) email is sent through as SMTPFrom,
+	// e.g. replies to emailed files that failed; empty disables sending.
+	SMTPAddr     string
+	SMTPUser     string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// JobSchedules overrides when recurring jobs run, by job name, as cron
+	// expressions (see cron.Parse); a job not listed runs every interval
+	// configured for it.
+	JobSchedules map[string]string
+
+	// BackupDir receives a snapshot of the database nightly (the backup
+	// job), keeping the last BackupKeep; empty disables backups.
+	BackupDir  string
+	BackupKeep int
+
+	// DailySummaryDays is how many completed days the nightly daily-summary
+	// job summarizes again, so uploads arriving late are counted.
+	DailySummaryDays int
+
+	// CDCRetention is how long the change data capture feed keeps changes;
+	// 0 keeps them forever.
+	CDCRetention time.Duration
+
+	// WebhookURLs receive a new-data event for WebhookStreams (all if
+	// empty) every WebhookInterval in which readings arrived, signed with
+	// WebhookSecret if set; empty disables them.
+	WebhookURLs     []string
+	WebhookSecret   string
+	WebhookStreams  []string
+	WebhookInterval time.Duration
+
+	// IngestWebhookURLs receive an upload.ingested event as each file is
+	// ingested, signed with WebhookSecret if set; empty disables them.
+	IngestWebhookURLs []string
+
+	// The reading sinks publish every reading inserted into SinkStreams (all
+	// if empty) every SinkInterval: to the
+	// Kafka cluster of KafkaBrokers (host:port) on topics named
+	// KafkaTopicPrefix and the stream, and to the NATS JetStream server of
+	// NATSURLs on subjects named NATSSubjectPrefix, IMO and stream. Empty
+	// brokers or URLs disable that sink.
+	SinkStreams       []string
+	SinkInterval      time.Duration
+	KafkaBrokers      []string
+	KafkaTopicPrefix  string
+	NATSURLs          []string
+	NATSSubjectPrefix string
+
+	// OutboxBatchSize is how many outbox events the webhooks and sinks are
+	// delivered at a time.
+	OutboxBatchSize int
+
+	// HARole is "primary", "standby" or empty for a standalone instance. A
+	// standby pulls a snapshot from HAPrimaryURL every HASyncInterval and
+	// serves it read-only until promoted; HAToken authenticates the pulls
+	// and promotion, and a primary serves no snapshots without it.
+	HARole         string
+	HAPrimaryURL   string
+	HAToken        string
+	HASyncInterval time.Duration
+	HASyncTimeout  time.Duration
+
+	// ReplicationRole is "edge" onboard, "central" ashore or empty. An edge
+	// pushes new readings and uploads to the central API at
+	// ReplicationCentralURL every ReplicationInterval, ReplicationBatchSize
+	// rows at a time, as ReplicationEdgeID (the host name if empty);
+	// ReplicationToken authenticates the pushes and is required on central.
+	// An edge pushes at most ReplicationBudgetBytes (zero for no bound) per
+	// ReplicationBudgetWindow.
+	ReplicationRole         string
+	ReplicationCentralURL   string
+	ReplicationToken        string
+	ReplicationEdgeID       string
+	ReplicationInterval     time.Duration
+	ReplicationBatchSize    int
+	ReplicationBudgetBytes  int64
+	ReplicationBudgetWindow time.Duration
+
+	// Outbound bounds every call to an external service: per-attempt
+	// timeout, retries and the circuit breaker.
+	Outbound outbound.Policy
+
+	// PageLimits apply to requests without a known API key class.
+	PageLimits PageLimits
+	// APIKeyClasses maps API keys (X-API-Key header) to a class such as
+	// "onboard" or "shore". Keys only select limits; they are not checked
+	// for access.
+	APIKeyClasses map[string]string
+	// ClassPageLimits overrides PageLimits per API key class.
+	ClassPageLimits map[string]PageLimits
+
+	// AuditChain keeps the tamper-evident audit log of API changes and of
+	// writes to AuditChainStreams.
+	AuditChain        bool
+	AuditChainStreams []string
+
+	// ExportWatermark watermarks every export, not only those requested
+	// with watermark=true.
+	ExportWatermark bool
+
+	// SignedURLSecrets sign download links for people without an API key;
+	// the first signs, all verify, so a secret can be rotated. With none
+	// set, links cannot be signed. SignedURLMaxTTL bounds their lifetime.
+	SignedURLSecrets []string
+	SignedURLMaxTTL  time.Duration
+
+	// AdminAPIKeys may change reference data. With none set, admin
+	// endpoints refuse every request.
+	AdminAPIKeys []string
+
+	// KioskAPIKeys maps the API keys of onboard displays to the one vessel
+	// whose kiosk view and latest readings they may read. Kiosk keys cannot
+	// write and are refused from outside KioskNetworks.
+	KioskAPIKeys  map[string]int64
+	KioskNetworks []*net.IPNet
+
+	// APIKeyOrgs maps API keys to the organization they belong to. Fair
+	// scheduling shares ingest and query slots per organization; requests
+	// with an unmapped key count as their own tenant, requests without a
+	// key as their client IP.
+	APIKeyOrgs map[string]string
+	// IngestLimits and QueryLimits bound concurrent uploads and heavy
+	// queries, overall and per tenant.
+	IngestLimits fair.Limits
+	QueryLimits  fair.Limits
+}
+
+// Load reads the configuration from environment variables, applying defaults.
+func Load() Config {
+	return Config{
+		Port:                       getEnv("PORT", "8080"),
+		DBPath:                     getEnv("DB_PATH", "./data/telemetry.db"),
+		ObjectStoreDir:             os.Getenv("OBJECT_STORE_DIR"),
+		AllowUnsafeDuplicateIngest: os.Getenv("ALLOW_UNSAFE_DUPLICATE_INGEST") == "true",
+		IngestURLMaxBytes:          int64(getEnvInt("INGEST_URL_MAX_MB", DefaultIngestURLMaxBytes>>20)) << 20,
+		IngestURLAllowPrivate:      os.Getenv("INGEST_URL_ALLOW_PRIVATE") == "true",
+		VesselDailyRowQuota:        getEnvInt("VESSEL_DAILY_ROW_QUOTA", 0),
+		QuotaThrottle:              os.Getenv("QUOTA_THROTTLE") == "true",
+		FuelDrop: fueldrop.Options{
+			MinDropLiters:    getEnvFloat("FUEL_DROP_MIN_LITERS", fueldrop.DefaultOptions.MinDropLiters),
+			MinRateLPH:       getEnvFloat("FUEL_DROP_MIN_RATE_LPH", fueldrop.DefaultOptions.MinRateLPH),
+			EngineRunningRPM: getEnvFloat("FUEL_DROP_ENGINE_OFF_RPM", fueldrop.DefaultOptions.EngineRunningRPM),
+			StationaryKnots:  getEnvFloat("FUEL_DROP_STATIONARY_KNOTS", fueldrop.DefaultOptions.StationaryKnots),
+			Window:           getEnvDuration("FUEL_DROP_WINDOW", fueldrop.DefaultOptions.Window),
+		},
+		AISProviderURL:          os.Getenv("AIS_PROVIDER_URL"),
+		AISAPIKey:               os.Getenv("AIS_API_KEY"),
+		AISPollInterval:         getEnvDuration("AIS_POLL_INTERVAL", 10*time.Minute),
+		WeatherProviderURL:      os.Getenv("WEATHER_PROVIDER_URL"),
+		WeatherAPIKey:           os.Getenv("WEATHER_API_KEY"),
+		WeatherPollInterval:     getEnvDuration("WEATHER_POLL_INTERVAL", time.Hour),
+		SFTPRemotesFile:         os.Getenv("SFTP_REMOTES_FILE"),
+		SFTPPollInterval:        getEnvDuration("SFTP_POLL_INTERVAL", 5*time.Minute),
+		SFTPMinFileAge:          getEnvDuration("SFTP_MIN_FILE_AGE", time.Minute),
+		S3Endpoint:              os.Getenv("S3_ENDPOINT"),
+		S3Region:                getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:                os.Getenv("S3_BUCKET"),
+		S3Prefix:                os.Getenv("S3_PREFIX"),
+		S3AccessKey:             os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:             os.Getenv("S3_SECRET_KEY"),
+		S3PollInterval:          getEnvDuration("S3_POLL_INTERVAL", 5*time.Minute),
+		S3MaxAttempts:           getEnvInt("S3_MAX_ATTEMPTS", 5),
+		S3RetryBackoff:          getEnvDuration("S3_RETRY_BACKOFF", 5*time.Minute),
+		ChunkedUploadDir:        os.Getenv("CHUNKED_UPLOAD_DIR"),
+		ChunkedUploadMaxMB:      getEnvInt("CHUNKED_UPLOAD_MAX_MB", 256),
+		ChunkedUploadTTL:        getEnvDuration("CHUNKED_UPLOAD_TTL", 24*time.Hour),
+		DropDir:                 os.Getenv("DROP_DIR"),
+		DropDirIMO:              os.Getenv("DROP_DIR_IMO"),
+		DropDirSettle:           getEnvDuration("DROP_DIR_SETTLE", 10*time.Second),
+		DropDirRescan:           getEnvDuration("DROP_DIR_RESCAN", time.Minute),
+		N2KUDPAddr:              os.Getenv("N2K_UDP_ADDR"),
+		N2KDevice:               os.Getenv("N2K_SERIAL_DEVICE"),
+		N2KIMO:                  os.Getenv("N2K_IMO"),
+		N2KInterval:             getEnvDuration("N2K_INTERVAL", 10*time.Second),
+		N2KFlush:                getEnvDuration("N2K_FLUSH_INTERVAL", time.Minute),
+		ModbusPollInterval:      getEnvDuration("MODBUS_POLL_INTERVAL", time.Minute),
+		ModbusTimeout:           getEnvDuration("MODBUS_TIMEOUT", 5*time.Second),
+		SNMPPollInterval:        getEnvDuration("SNMP_POLL_INTERVAL", time.Minute),
+		SNMPTimeout:             getEnvDuration("SNMP_TIMEOUT", 3*time.Second),
+		ONVIFPollInterval:       getEnvDuration("ONVIF_POLL_INTERVAL", time.Minute),
+		ONVIFTimeout:            getEnvDuration("ONVIF_TIMEOUT", 5*time.Second),
+		ONVIFAlertAfter:         getEnvDuration("ONVIF_ALERT_AFTER", 5*time.Minute),
+		IMAPAddr:                os.Getenv("IMAP_ADDR"),
+		IMAPTLS:                 os.Getenv("IMAP_TLS") != "false",
+		IMAPUser:                os.Getenv("IMAP_USER"),
+		IMAPPassword:            os.Getenv("IMAP_PASSWORD"),
+		IMAPMailbox:             getEnv("IMAP_MAILBOX", "INBOX"),
+		IMAPSenders:             parseSenders(os.Getenv("IMAP_SENDERS")),
+		IMAPPollInterval:        getEnvDuration("IMAP_POLL_INTERVAL", 5*time.Minute),
+		SMTPAddr:                os.Getenv("SMTP_ADDR"),
+		SMTPUser:                os.Getenv("SMTP_USER"),
+		SMTPPassword:            os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:                os.Getenv("SMTP_FROM"),
+		JobSchedules:            parseSchedules(os.Getenv("JOB_SCHEDULES")),
+		BackupDir:               os.Getenv("BACKUP_DIR"),
+		BackupKeep:              getEnvInt("BACKUP_KEEP", 7),
+		DailySummaryDays:        getEnvInt("DAILY_SUMMARY_DAYS", 3),
+		CDCRetention:            getEnvDuration("CDC_RETENTION", 30*24*time.Hour),
+		WebhookURLs:             parseKeys(os.Getenv("WEBHOOK_URLS")),
+		WebhookSecret:           os.Getenv("WEBHOOK_SECRET"),
+		WebhookStreams:          parseKeys(os.Getenv("WEBHOOK_STREAMS")),
+		WebhookInterval:         getEnvDuration("WEBHOOK_INTERVAL", time.Minute),
+		IngestWebhookURLs:       parseKeys(os.Getenv("INGEST_WEBHOOK_URLS")),
+		SinkStreams:             parseKeys(os.Getenv("SINK_STREAMS")),
+		SinkInterval:            getEnvDuration("SINK_INTERVAL", 10*time.Second),
+		KafkaBrokers:            parseKeys(os.Getenv("KAFKA_BROKERS")),
+		KafkaTopicPrefix:        getEnv("KAFKA_TOPIC_PREFIX", "telemetry."),
+		NATSURLs:                parseKeys(os.Getenv("NATS_URLS")),
+		NATSSubjectPrefix:       getEnv("NATS_SUBJECT_PREFIX", "telemetry."),
+		OutboxBatchSize:         getEnvInt("OUTBOX_BATCH_SIZE", 500),
+		HARole:                  os.Getenv("HA_ROLE"),
+		HAPrimaryURL:            os.Getenv("HA_PRIMARY_URL"),
+		HAToken:                 os.Getenv("HA_TOKEN"),
+		HASyncInterval:          getEnvDuration("HA_SYNC_INTERVAL", 5*time.Minute),
+		HASyncTimeout:           getEnvDuration("HA_SYNC_TIMEOUT", 10*time.Minute),
+		ReplicationRole:         os.Getenv("REPLICATION_ROLE"),
+		ReplicationCentralURL:   os.Getenv("REPLICATION_CENTRAL_URL"),
+		ReplicationToken:        os.Getenv("REPLICATION_TOKEN"),
+		ReplicationEdgeID:       os.Getenv("REPLICATION_EDGE_ID"),
+		ReplicationInterval:     getEnvDuration("REPLICATION_INTERVAL", time.Minute),
+		ReplicationBatchSize:    getEnvInt("REPLICATION_BATCH_SIZE", 500),
+		ReplicationBudgetBytes:  int64(getEnvInt("REPLICATION_BUDGET_MB", 0)) << 20,
+		ReplicationBudgetWindow: getEnvDuration("REPLICATION_BUDGET_WINDOW", 24*time.Hour),
+		Outbound: outbound.Policy{
+			Timeout:          getEnvDuration("OUTBOUND_TIMEOUT", 15*time.Second),
+			Retries:          getEnvInt("OUTBOUND_RETRIES", 2),
+			RetryBackoff:     getEnvDuration("OUTBOUND_RETRY_BACKOFF", 500*time.Millisecond),
+			FailureThreshold: getEnvInt("OUTBOUND_BREAKER_THRESHOLD", 5),
+			OpenDuration:     getEnvDuration("OUTBOUND_BREAKER_COOLDOWN", time.Minute),
+		},
+		PageLimits: PageLimits{
+			Default: getEnvInt("PAGE_LIMIT_DEFAULT", DefaultPageLimits.Default),
+			Max:     getEnvInt("PAGE_LIMIT_MAX", DefaultPageLimits.Max),
+		}.normalize(),
+		APIKeyClasses:     parseList(os.Getenv("API_KEY_CLASSES"), ":"),
+		ClassPageLimits:   parseClassPageLimits(os.Getenv("CLASS_PAGE_LIMITS")),
+		AuditChain:        os.Getenv("AUDIT_CHAIN") == "true",
+		AuditChainStreams: parseKeys(getEnv("AUDIT_CHAIN_STREAMS", "fuel,location")),
+		ExportWatermark:   os.Getenv("EXPORT_WATERMARK") == "true",
+		Compression:       getEnv("COMPRESSION", "default"),
+		CacheTTL:          getEnvDuration("CACHE_TTL", 30*time.Second),
+		RedisAddr:         os.Getenv("REDIS_ADDR"),
+		RedisPassword:     os.Getenv("REDIS_PASSWORD"),
+		RedisDB:           getEnvInt("REDIS_DB", 0),
+		SignedURLSecrets:  parseKeys(os.Getenv("SIGNED_URL_SECRETS")),
+		SignedURLMaxTTL:   getEnvDuration("SIGNED_URL_MAX_TTL", 7*24*time.Hour),
+		AdminAPIKeys:      parseKeys(os.Getenv("ADMIN_API_KEYS")),
+		KioskAPIKeys:      parseKioskKeys(os.Getenv("KIOSK_API_KEYS")),
+		KioskNetworks:     parseNetworks(getEnv("KIOSK_NETWORKS", DefaultKioskNetworks)),
+		APIKeyOrgs:        parseList(os.Getenv("API_KEY_ORGS"), ":"),
+		IngestLimits: fair.Limits{
+			Slots:          getEnvInt("INGEST_CONCURRENCY", 4),
+			PerTenant:      getEnvInt("INGEST_TENANT_CONCURRENCY", 2),
+			QueuePerTenant: getEnvInt("INGEST_TENANT_QUEUE", 100),
+			MaxWait:        getEnvDuration("SCHEDULER_MAX_WAIT", time.Minute),
+		},
+		QueryLimits: fair.Limits{
+			Slots:          getEnvInt("QUERY_CONCURRENCY", 16),
+			PerTenant:      getEnvInt("QUERY_TENANT_CONCURRENCY", 8),
+			QueuePerTenant: getEnvInt("QUERY_TENANT_QUEUE", 200),
+			MaxWait:        getEnvDuration("SCHEDULER_MAX_WAIT", time.Minute),
+		},
+	}
+}
+
+// normalize keeps the limits usable: Max at least 1, Default within 1..Max.
+func (l PageLimits) normalize() PageLimits {
+	if l.Max < 1 {
+		l.Max = 1
+	}
+	if l.Default < 1 || l.Default > l.Max {
+		l.Default = l.Max
+	}
+	return l
+}
+
+// parseList parses "a<sep>b,c<sep>d" into a map, skipping malformed entries.
+func parseList(s, sep string) map[string]string {
+	m := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(entry), sep)
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if ok && k != "" && v != "" {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// parseSenders parses "master@alpha.example=9811000,@fleet.example=9822000",
+// lower-casing the addresses.
+func parseSenders(s string) map[string]string {
+	senders := make(map[string]string)
+	for addr, imo := range parseList(s, "=") {
+		senders[strings.ToLower(addr)] = imo
+	}
+	return senders
+}
+
+// parseSchedules parses "sftp=*/10 * * * *;backup=@daily", separated by
+// semicolons as cron expressions have commas.
+func parseSchedules(s string) map[string]string {
+	schedules := make(map[string]string)
+	for _, entry := range strings.Split(s, ";") {
+		name, spec, ok := strings.Cut(entry, "=")
+		name, spec = strings.TrimSpace(name), strings.TrimSpace(spec)
+		if ok && name != "" && spec != "" {
+			schedules[name] = spec
+		}
+	}
+	return schedules
+}
+
+// parseKeys parses a comma-separated list, skipping blank entries.
+func parseKeys(s string) []string {
+	var keys []string
+	for _, key := range strings.Split(s, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// parseClassPageLimits parses "onboard=50/200,shore=500/5000" (default/max
+// per class), skipping malformed entries.
+func parseClassPageLimits(s string) map[string]PageLimits {
+	limits := make(map[string]PageLimits)
+	for class, v := range parseList(s, "=") {
+		def, max, ok := strings.Cut(v, "/")
+		if !ok {
+			continue
+		}
+		d, err1 := strconv.Atoi(strings.TrimSpace(def))
+		m, err2 := strconv.Atoi(strings.TrimSpace(max))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		limits[class] = PageLimits{Default: d, Max: m}.normalize()
+	}
+	return limits
+}
+
+// parseKioskKeys parses "key:vessel_id,...", skipping malformed entries.
+func parseKioskKeys(s string) map[string]int64 {
+	keys := make(map[string]int64)
+	for key, v := range parseList(s, ":") {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil && id > 0 {
+			keys[key] = id
+		}
+	}
+	return keys
+}
+
+// parseNetworks parses a comma-separated list of CIDR ranges, skipping
+// malformed entries.
+func parseNetworks(s string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range parseKeys(s) {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
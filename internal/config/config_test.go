@@ -0,0 +1,80 @@
+package config
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPageLimitsNormalize(t *testing.T) {
+	tests := []struct {
+		in, want PageLimits
+	}{
+		{PageLimits{200, 1000}, PageLimits{200, 1000}},
+		{PageLimits{500, 100}, PageLimits{100, 100}},
+		{PageLimits{0, 100}, PageLimits{100, 100}},
+		{PageLimits{10, 0}, PageLimits{1, 1}},
+	}
+	for _, tt := range tests {
+		if got := tt.in.normalize(); got != tt.want {
+			t.Errorf("%+v: expected %+v, got %+v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestParseList(t *testing.T) {
+	m := parseList(" k1:onboard , k2:shore,broken,:x,k3:", ":")
+	if len(m) != 2 || m["k1"] != "onboard" || m["k2"] != "shore" {
+		t.Errorf("Unexpected map %v", m)
+	}
+	if m := parseList("", ":"); len(m) != 0 {
+		t.Errorf("Expected an empty map, got %v", m)
+	}
+}
+
+func TestParseSenders(t *testing.T) {
+	m := parseSenders("Master@Alpha.example=9811000, @Fleet.example = 9822000,junk")
+	if len(m) != 2 || m["master@alpha.example"] != "9811000" || m["@fleet.example"] != "9822000" {
+		t.Errorf("Unexpected senders %v", m)
+	}
+}
+
+func TestParseSchedules(t *testing.T) {
+	m := parseSchedules(" sftp = 0,30 * * * * ;backup=@daily;;junk")
+	if len(m) != 2 || m["sftp"] != "0,30 * * * *" || m["backup"] != "@daily" {
+		t.Errorf("Unexpected schedules %v", m)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys(" a1 ,, b2 ,")
+	if len(keys) != 2 || keys[0] != "a1" || keys[1] != "b2" {
+		t.Errorf("Unexpected keys %q", keys)
+	}
+}
+
+func TestParseClassPageLimits(t *testing.T) {
+	limits := parseClassPageLimits("onboard=50/200, shore=500/5000, bad=10, worse=a/b")
+	if len(limits) != 2 {
+		t.Fatalf("Expected 2 classes, got %v", limits)
+	}
+	if limits["onboard"] != (PageLimits{50, 200}) || limits["shore"] != (PageLimits{500, 5000}) {
+		t.Errorf("Unexpected limits %v", limits)
+	}
+}
+
+func TestParseKioskKeys(t *testing.T) {
+	keys := parseKioskKeys("display:3, bridge:x, ecr:0,other:12")
+	if len(keys) != 2 || keys["display"] != 3 || keys["other"] != 12 {
+		t.Errorf("Unexpected kiosk keys %v", keys)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks := parseNetworks(DefaultKioskNetworks + ",bogus,10.0.0.1")
+	if len(networks) != 8 {
+		t.Fatalf("Expected the 8 default networks, got %v", networks)
+	}
+	if !networks[3].Contains(net.ParseIP("192.168.1.20")) || networks[3].Contains(net.ParseIP("8.8.8.8")) {
+		t.Errorf("Unexpected network %v", networks[3])
+	}
+}
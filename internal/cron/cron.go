@@ -0,0 +1,192 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job results.
+const (
+	ResultOK      = "ok"
+	ResultError   = "error"
+	ResultSkipped = "skipped" // the previous run had not finished
+)
+
+// Status is how a job last ran.
+type Status struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Running        bool       `json:"running"`
+	NextRun        *time.Time `json:"next_run"`
+	LastRun        *time.Time `json:"last_run"`
+	LastDurationMS *int64     `json:"last_duration_ms"`
+	LastResult     string     `json:"last_result,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	Runs           int        `json:"runs"`
+	Failures       int        `json:"failures"`
+}
+
+type job struct {
+	Status
+	schedule Schedule
+	run      func(ctx context.Context) error
+	next     time.Time
+}
+
+// Scheduler runs jobs on their schedules. A job is never run twice at once:
+// a run due while the previous one is still going is skipped.
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    map[string]*job
+	started bool
+	wake    chan struct{}
+	now     func() time.Time
+}
+
+// New creates a scheduler with no jobs.
+func New() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*job), wake: make(chan struct{}, 1), now: time.Now}
+}
+
+// Add schedules run under name, on spec as Parse reads it. A job added to a
+// running scheduler is picked up at once.
+func (s *Scheduler) Add(name, spec string, run func(ctx context.Context) error) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %s is already scheduled", name)
+	}
+	j := &job{Status: Status{Name: name, Schedule: spec}, schedule: schedule, run: run}
+	if s.started {
+		j.next = s.first(j)
+	}
+	s.jobs[name] = j
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// first returns when a job first runs: at once for an interval, else when
+// its expression next matches.
+func (s *Scheduler) first(j *job) time.Time {
+	now := s.now()
+	if _, ok := j.schedule.(every); ok {
+		return now
+	}
+	return j.schedule.Next(now)
+}
+
+// Run runs the jobs until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.started = true
+	for _, j := range s.jobs {
+		j.next = s.first(j)
+	}
+	s.mu.Unlock()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		wait := s.runDue(ctx)
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// runDue starts the jobs that are due and returns how long until the next
+// one is.
+func (s *Scheduler) runDue(ctx context.Context) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	wait := time.Hour
+	for _, j := range s.jobs {
+		if j.next.IsZero() {
+			continue // never runs again
+		}
+		if !j.next.After(now) {
+			if j.Running {
+				j.LastResult, j.LastError = ResultSkipped, ""
+				log.Printf("cron: %s: skipped, still running", j.Name)
+			} else {
+				j.Running = true
+				go s.execute(ctx, j)
+			}
+			j.next = j.schedule.Next(now)
+			if j.next.IsZero() {
+				continue
+			}
+		}
+		if d := j.next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+func (s *Scheduler) execute(ctx context.Context, j *job) {
+	start := s.now()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return j.run(ctx)
+	}()
+	elapsed := time.Since(start).Milliseconds()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.Running = false
+	j.LastRun = &start
+	j.LastDurationMS = &elapsed
+	j.Runs++
+	if err != nil {
+		j.LastResult, j.LastError = ResultError, err.Error()
+		j.Failures++
+		log.Printf("cron: %s: %v", j.Name, err)
+	} else {
+		j.LastResult, j.LastError = ResultOK, ""
+	}
+}
+
+// Jobs returns the status of every job, by name.
+func (s *Scheduler) Jobs() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := j.Status
+		if !j.next.IsZero() {
+			next := j.next
+			status.NextRun = &next
+		}
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
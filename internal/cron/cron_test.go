@@ -0,0 +1,86 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	s := New()
+	var ok, slow atomic.Int32
+	release := make(chan struct{})
+	s.Add("ok", "@every 20ms", func(ctx context.Context) error {
+		ok.Add(1)
+		return nil
+	})
+	s.Add("failing", "@every 1h", func(ctx context.Context) error {
+		return errors.New("provider down")
+	})
+	s.Add("panicking", "@every 1h", func(ctx context.Context) error {
+		panic("bug")
+	})
+	s.Add("slow", "@every 20ms", func(ctx context.Context) error {
+		slow.Add(1)
+		<-release
+		return nil
+	})
+	s.Add("nightly", "0 3 * * *", func(ctx context.Context) error {
+		t.Error("Expected the nightly job not to run yet")
+		return nil
+	})
+	if err := s.Add("ok", "@hourly", nil); err == nil {
+		t.Error("Expected a second job of the same name to be refused")
+	}
+	if err := s.Add("bad", "99 * * * *", nil); err == nil {
+		t.Error("Expected an invalid schedule to be refused")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	time.Sleep(150 * time.Millisecond)
+	if slow.Load() != 1 {
+		t.Errorf("Expected the slow job to run once at a time, ran %d", slow.Load())
+	}
+	if j := s.Jobs(); j[4].Name != "slow" || !j[4].Running || j[4].LastResult != ResultSkipped {
+		t.Errorf("Unexpected slow job %+v", j[4])
+	}
+	close(release)
+
+	var late atomic.Bool
+	s.Add("late", "@every 1h", func(ctx context.Context) error {
+		late.Store(true)
+		return nil
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	if ok.Load() < 3 {
+		t.Errorf("Expected the interval job to have run several times, ran %d", ok.Load())
+	}
+	if !late.Load() {
+		t.Error("Expected a job added while running to run")
+	}
+
+	jobs := map[string]Status{}
+	for _, status := range s.Jobs() {
+		jobs[status.Name] = status
+	}
+	if len(jobs) != 6 {
+		t.Fatalf("Expected 6 jobs, got %+v", jobs)
+	}
+	if j := jobs["ok"]; j.LastResult != ResultOK || j.LastRun == nil || j.LastDurationMS == nil || j.NextRun == nil {
+		t.Errorf("Unexpected ok job %+v", j)
+	}
+	if j := jobs["failing"]; j.LastResult != ResultError || j.LastError != "provider down" || j.Failures != 1 {
+		t.Errorf("Unexpected failing job %+v", j)
+	}
+	if j := jobs["panicking"]; j.LastResult != ResultError || j.LastError != "panic: bug" {
+		t.Errorf("Unexpected panicking job %+v", j)
+	}
+	if j := jobs["nightly"]; j.Runs != 0 || j.LastRun != nil || j.NextRun == nil || j.NextRun.Hour() != 3 {
+		t.Errorf("Unexpected nightly job %+v", j)
+	}
+}
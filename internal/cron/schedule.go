@@ -0,0 +1,187 @@
+// Package cron runs recurring jobs, such as polls, pruning and backups, on
+// schedules given as cron expressions, and keeps how each last ran.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule says when a job runs.
+type Schedule interface {
+	// Next returns the first time after t the job runs, or the zero time
+	// if it never does.
+	Next(t time.Time) time.Time
+}
+
+// every runs a job at a fixed interval, starting at once.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// fields is a parsed cron expression: one bit per allowed value.
+type fields struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record an unrestricted day field; with both
+	// restricted, a day matching either runs, as cron has it
+	domStar, dowStar bool
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// Parse parses a schedule: five cron fields (minute, hour, day of month,
+// month, day of week, in UTC), a descriptor such as @daily, or
+// "@every <duration>", which runs at once and then every duration.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval in %q", spec)
+		}
+		return every(interval), nil
+	}
+	if expr, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expr
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: want 5 fields, a descriptor such as @daily, or @every <duration>", spec)
+	}
+	var f fields
+	var err error
+	if f.minute, err = parseField(parts[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute in %q: %w", spec, err)
+	}
+	if f.hour, err = parseField(parts[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour in %q: %w", spec, err)
+	}
+	if f.dom, err = parseField(parts[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month in %q: %w", spec, err)
+	}
+	if f.month, err = parseField(parts[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month in %q: %w", spec, err)
+	}
+	// 7 is Sunday too
+	if f.dow, err = parseField(parts[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("day of week in %q: %w", spec, err)
+	}
+	if f.dow&(1<<7) != 0 {
+		f.dow |= 1
+	}
+	f.domStar = strings.HasPrefix(parts[2], "*")
+	f.dowStar = strings.HasPrefix(parts[4], "*")
+
+	if f.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", spec)
+	}
+	return &f, nil
+}
+
+// parseField parses a comma-separated list of *, n, n-m, each optionally
+// with /step. names, if any, stand for min, min+1...
+func parseField(s string, min, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = fieldValue(first, min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = fieldValue(last, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max // n/step runs from n on
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func fieldValue(s string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("%q is not between %d and %d", s, min, max)
+	}
+	return v, nil
+}
+
+// Next returns the first minute after t the expression matches, in UTC.
+func (f *fields) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Every day of five years is more than any expression needs
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if f.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !f.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if f.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if f.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (f *fields) dayMatches(t time.Time) bool {
+	dom := f.dom&(1<<uint(t.Day())) != 0
+	dow := f.dow&(1<<uint(t.Weekday())) != 0
+	if f.domStar || f.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
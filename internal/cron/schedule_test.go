@@ -0,0 +1,57 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2026, 10, 14, 10, 17, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		want string
+	}{
+		{"* * * * *", "2026-10-14T10:18"},
+		{"*/5 * * * *", "2026-10-14T10:20"},
+		{"0 3 * * *", "2026-10-15T03:00"},
+		{"@daily", "2026-10-15T00:00"},
+		{"@hourly", "2026-10-14T11:00"},
+		{"30 2 1 * *", "2026-11-01T02:30"},
+		{"0 9 * * mon-fri", "2026-10-15T09:00"},
+		{"0 9 * * SAT,sun", "2026-10-17T09:00"},
+		{"0 0 * * 7", "2026-10-18T00:00"},
+		{"15,45 */6 * * *", "2026-10-14T12:15"},
+		{"0 0 1 jan *", "2027-01-01T00:00"},
+		{"10/20 * * * *", "2026-10-14T10:30"},
+		// With both day fields restricted, either may match
+		{"0 0 13 * fri", "2026-10-16T00:00"},
+		{"0 0 29 2 *", "2028-02-29T00:00"},
+	}
+	for _, tc := range cases {
+		s, err := Parse(tc.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tc.spec, err)
+			continue
+		}
+		if got := s.Next(from).Format("2006-01-02T15:04"); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.spec, tc.want, got)
+		}
+	}
+
+	s, _ := Parse("@every 90s")
+	if got := s.Next(from); !got.Equal(from.Add(90 * time.Second)) {
+		t.Errorf("@every: unexpected next run %s", got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "x * * * *", "0 0 30 2 *", "@every", "@every -1m", "@sometimes",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
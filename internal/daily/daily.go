@@ -0,0 +1,148 @@
+// Package daily summarizes a vessel's UTC day for the morning fleet report:
+// distance sailed, speed, fuel burnt by the generators, engine running
+// hours, alarms and how complete the day's data is.
+//
+// Running hours and fuel follow the utilization and generator reports, so
+// the summary of a day agrees with them over the same range.
+package daily
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"vessel-telemetry-api/internal/gensets"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/utilization"
+)
+
+// DayLayout is the format of DailySummary.Day.
+const DayLayout = "2006-01-02"
+
+// earthRadiusNM is the mean radius of the Earth in nautical miles.
+const earthRadiusNM = 3440.065
+
+// generatorMaxGap caps the time one generator reading stands for, as in the
+// generator report.
+const generatorMaxGap = time.Hour
+
+// speedMaxGap caps the time one fix's speed stands for in the average speed.
+const speedMaxGap = time.Hour
+
+// Inputs is the data of one vessel's day.
+type Inputs struct {
+	Fixes      []ports.Fix
+	Engines    []utilization.EngineSample
+	Generators []gensets.Reading
+	Alarms     int // alarm events active during the day
+	// HoursWithData is, for every stream the vessel reports, the number of
+	// the day's hours with at least one reading.
+	HoursWithData map[string]int
+}
+
+// Build computes the summary of the day starting at day, UTC midnight.
+func Build(vesselID int64, day time.Time, in Inputs) models.DailySummary {
+	summary := models.DailySummary{
+		VesselID:           vesselID,
+		Day:                day.Format(DayLayout),
+		DistanceNM:         Distance(in.Fixes),
+		FuelConsumedLiters: gensets.Build(in.Generators, gensets.Options{MaxGap: generatorMaxGap}).FuelLiters,
+		AlarmCount:         in.Alarms,
+	}
+
+	// Fixes come at varying intervals, so each speed counts for the time
+	// until the next
+	fixes := append([]ports.Fix(nil), in.Fixes...)
+	sort.SliceStable(fixes, func(i, j int) bool { return fixes[i].Timestamp.Before(fixes[j].Timestamp) })
+	var speeds []store.TimedValue
+	for _, f := range fixes {
+		if f.Speed != nil {
+			speeds = append(speeds, store.TimedValue{TS: f.Timestamp, Value: *f.Speed})
+		}
+	}
+	summary.AvgSpeedKnots = store.TimeWeightedMean(speeds, speedMaxGap)
+
+	if months := utilization.Build(day, day.AddDate(0, 0, 1), in.Engines, nil, nil, utilization.DefaultOptions); len(months) > 0 {
+		summary.EngineRunningHours = months[0].EngineHours
+	}
+
+	if len(in.HoursWithData) > 0 {
+		hours := 0
+		for _, h := range in.HoursWithData {
+			hours += h
+		}
+		summary.CompletenessPercent = float64(hours) / float64(24*len(in.HoursWithData)) * 100
+	}
+	return summary
+}
+
+// Distance returns the length in nautical miles of the track through the
+// fixes, taken in time order along great circles.
+func Distance(fixes []ports.Fix) float64 {
+	sorted := append([]ports.Fix(nil), fixes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+
+	var nm float64
+	for i := 1; i < len(sorted); i++ {
+		nm += greatCircleNM(sorted[i-1], sorted[i])
+	}
+	return nm
+}
+
+// greatCircleNM is the haversine distance between two fixes.
+func greatCircleNM(a, b ports.Fix) float64 {
+	rad := math.Pi / 180
+	dLat := (b.Latitude - a.Latitude) * rad
+	dLon := (b.Longitude - a.Longitude) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Latitude*rad)*math.Cos(b.Latitude*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusNM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Summarize reads the vessel's day starting at day, UTC midnight, and
+// computes its summary.
+func Summarize(ctx context.Context, st store.Store, vesselID int64, day time.Time) (models.DailySummary, error) {
+	from := day
+	// Ranges include their end; a reading at midnight belongs to the next day
+	to := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+
+	var in Inputs
+	var err error
+	if in.Fixes, err = st.Positions(ctx, vesselID, &from, &to); err != nil {
+		return models.DailySummary{}, err
+	}
+	if in.Engines, err = st.EngineRPMs(ctx, vesselID, &from, &to); err != nil {
+		return models.DailySummary{}, err
+	}
+	if in.Generators, err = st.GeneratorReadings(ctx, vesselID, &from, &to); err != nil {
+		return models.DailySummary{}, err
+	}
+	alarms, err := st.AlarmEvents(ctx, store.AlarmFilter{VesselID: vesselID, From: &from, To: &to})
+	if err != nil {
+		return models.DailySummary{}, err
+	}
+	in.Alarms = len(alarms)
+
+	// The streams the vessel reports at all are expected every hour
+	latest, err := st.StreamLatest(ctx, vesselID)
+	if err != nil {
+		return models.DailySummary{}, err
+	}
+	in.HoursWithData = make(map[string]int, len(latest))
+	for name := range latest {
+		def, ok := store.Streams[name]
+		if !ok {
+			continue
+		}
+		if in.HoursWithData[name], err = st.HoursWithData(ctx, def, vesselID, from, to); err != nil {
+			return models.DailySummary{}, err
+		}
+	}
+
+	summary := Build(vesselID, day, in)
+	summary.ComputedAt = time.Now().UTC()
+	return summary, nil
+}
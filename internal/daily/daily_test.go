@@ -0,0 +1,93 @@
+package daily
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/gensets"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/utilization"
+)
+
+func f(v float64) *float64 { return &v }
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+func TestDistance(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2025, 1, 1, hour, 0, 0, 0, time.UTC) }
+	// One degree of latitude is 60 nm; fixes out of order are sorted first
+	fixes := []ports.Fix{
+		{Timestamp: at(2), Latitude: 2, Longitude: 0},
+		{Timestamp: at(0), Latitude: 0, Longitude: 0},
+		{Timestamp: at(1), Latitude: 1, Longitude: 0},
+	}
+	if nm := Distance(fixes); math.Abs(nm-120) > 0.1 {
+		t.Errorf("Expected about 120 nm, got %v", nm)
+	}
+	if nm := Distance(fixes[:1]); nm != 0 {
+		t.Errorf("Expected 0 nm for one fix, got %v", nm)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time { return day.Add(time.Duration(hour) * time.Hour) }
+
+	summary := Build(7, day, Inputs{
+		Fixes: []ports.Fix{
+			{Timestamp: at(0), Latitude: 0, Longitude: 0, Speed: f(10)},
+			{Timestamp: at(1), Latitude: 0, Longitude: 0, Speed: f(12)},
+			{Timestamp: at(2), Latitude: 0, Longitude: 0},
+		},
+		Engines: []utilization.EngineSample{
+			{EngineNo: 1, TS: at(3), RPM: f(700)},
+			{EngineNo: 1, TS: at(5), RPM: f(700)},
+			{EngineNo: 1, TS: at(6), RPM: f(0)},
+		},
+		Generators: []gensets.Reading{
+			{GenNo: 1, TS: at(0), LoadKW: f(100), FuelRateLPH: f(20)},
+			{GenNo: 1, TS: at(1), LoadKW: f(100), FuelRateLPH: f(30)},
+			{GenNo: 1, TS: at(2), LoadKW: f(0), FuelRateLPH: f(0)},
+		},
+		Alarms:        4,
+		HoursWithData: map[string]int{"location": 24, "engines": 12},
+	})
+
+	if summary.VesselID != 7 || summary.Day != "2025-01-01" || summary.AlarmCount != 4 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if summary.DistanceNM != 0 {
+		t.Errorf("Expected no distance, got %v", summary.DistanceNM)
+	}
+	// Fixes without a speed are left out of the average
+	if summary.AvgSpeedKnots == nil || !near(*summary.AvgSpeedKnots, 11) {
+		t.Errorf("Expected 11 kn, got %v", summary.AvgSpeedKnots)
+	}
+	// Each speed counts for the time until the next
+	uneven := Build(7, day, Inputs{Fixes: []ports.Fix{
+		{Timestamp: at(0), Speed: f(10)},
+		{Timestamp: at(1), Speed: f(20)},
+		{Timestamp: at(1).Add(20 * time.Minute), Speed: f(20)},
+	}})
+	if uneven.AvgSpeedKnots == nil || !near(*uneven.AvgSpeedKnots, 14) {
+		t.Errorf("Expected a time-weighted 14 kn, got %v", uneven.AvgSpeedKnots)
+	}
+	// 03:00-05:00 and 05:00-06:00, the gap capped at an hour
+	if !near(summary.EngineRunningHours, 2) {
+		t.Errorf("Expected 2 engine hours, got %v", summary.EngineRunningHours)
+	}
+	if !near(summary.FuelConsumedLiters, 50) {
+		t.Errorf("Expected 50 l, got %v", summary.FuelConsumedLiters)
+	}
+	if !near(summary.CompletenessPercent, 75) {
+		t.Errorf("Expected 75%% complete, got %v", summary.CompletenessPercent)
+	}
+}
+
+func TestBuildEmpty(t *testing.T) {
+	summary := Build(1, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Inputs{})
+	if summary.AvgSpeedKnots != nil || summary.DistanceNM != 0 || summary.CompletenessPercent != 0 {
+		t.Errorf("Expected an empty summary, got %+v", summary)
+	}
+}
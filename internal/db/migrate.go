@@ -2,6 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 )
 
 // Embedded schema - more reliable for containerized deployments
@@ -15,9 +18,12 @@ PRAGMA cache_size=-20000;
 CREATE TABLE IF NOT EXISTS vessels (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     imo TEXT UNIQUE,            -- nullable if unknown
+    mmsi TEXT,                  -- used for AIS lookups
     name TEXT,
     flag TEXT,
     type TEXT,
+    fleet TEXT,                 -- operator's fleet grouping, from Ship Info
+    archived_at DATETIME,       -- set when decommissioned; hidden from default listings
     created_at DATETIME DEFAULT (datetime('now')),
     updated_at DATETIME DEFAULT (datetime('now'))
 );
@@ -34,7 +40,7 @@ CREATE TABLE IF NOT EXISTS uploads (
 );
 
 -- Generic pattern for time-series tables:
--- Common columns: id, vessel_id, ts, row_hash, extra_json, created_at
+-- Common columns: id, vessel_id, ts, row_hash, extra_json, extra_hash, created_at
 -- Add domain fields as needed.
 
 CREATE TABLE IF NOT EXISTS engine_readings (
@@ -46,8 +52,11 @@ CREATE TABLE IF NOT EXISTS engine_readings (
     temp_c REAL,
     oil_pressure_bar REAL,
     alarms TEXT,
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
-    extra_json TEXT,            -- JSON dump of unmapped cols
+    extra_json TEXT,            -- JSON dump of unmapped cols, NULL when in extra_payloads
+    extra_hash TEXT,            -- extra_payloads.hash of a payload kept there
     created_at DATETIME DEFAULT (datetime('now')),
     FOREIGN KEY(vessel_id) REFERENCES vessels(id),
     UNIQUE(vessel_id, ts, row_hash)
@@ -63,8 +72,12 @@ CREATE TABLE IF NOT EXISTS fuel_tank_readings (
     level_percent REAL,          -- 0..100
     volume_liters REAL,          -- >= 0
     temp_c REAL,
+    uncertainty_percent REAL,    -- ± of level and volume when estimated (e.g. soundings), NULL if exact
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
     extra_json TEXT,
+    extra_hash TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
     FOREIGN KEY(vessel_id) REFERENCES vessels(id),
     UNIQUE(vessel_id, ts, row_hash)
@@ -81,8 +94,12 @@ CREATE TABLE IF NOT EXISTS generator_readings (
     voltage_v REAL,
     frequency_hz REAL,
     fuel_rate_lph REAL,
+    uncertainty_percent REAL,    -- ± of fuel_rate_lph when estimated, NULL if exact
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
     extra_json TEXT,
+    extra_hash TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
     FOREIGN KEY(vessel_id) REFERENCES vessels(id),
     UNIQUE(vessel_id, ts, row_hash)
@@ -97,8 +114,11 @@ CREATE TABLE IF NOT EXISTS cctv_status_readings (
     ts DATETIME NOT NULL,
     status TEXT,               -- e.g., OK, OFFLINE
     uptime_percent REAL,
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
     extra_json TEXT,
+    extra_hash TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
     FOREIGN KEY(vessel_id) REFERENCES vessels(id),
     UNIQUE(vessel_id, ts, row_hash)
@@ -114,8 +134,11 @@ CREATE TABLE IF NOT EXISTS impact_vibration_readings (
     accel_g REAL,
     shock_g REAL,
     notes TEXT,
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
     extra_json TEXT,
+    extra_hash TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
     FOREIGN KEY(vessel_id) REFERENCES vessels(id),
     UNIQUE(vessel_id, ts, row_hash)
@@ -123,6 +146,108 @@ CREATE TABLE IF NOT EXISTS impact_vibration_readings (
 
 CREATE INDEX IF NOT EXISTS idx_imp_ts ON impact_vibration_readings(vessel_id, ts);
 
+CREATE TABLE IF NOT EXISTS bilge_ballast_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    tank_id TEXT,               -- bilge well or ballast tank, e.g. BW-AFT, WBT 3P
+    ts DATETIME NOT NULL,
+    level_percent REAL,
+    volume_m3 REAL,
+    pump_status TEXT,           -- e.g., RUNNING, STOPPED, AUTO
+    alarm TEXT,                 -- e.g., HIGH LEVEL
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    extra_hash TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bilge_ts ON bilge_ballast_readings(vessel_id, ts);
+
+CREATE TABLE IF NOT EXISTS navigation_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    ts DATETIME NOT NULL,
+    heading_degrees REAL,       -- 0-360, true heading
+    rudder_angle_degrees REAL,  -- negative to port, positive to starboard
+    rot_degrees_per_min REAL,   -- rate of turn, positive to starboard
+    depth_under_keel_m REAL,    -- >= 0
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    extra_hash TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_nav_ts ON navigation_readings(vessel_id, ts);
+
+CREATE TABLE IF NOT EXISTS met_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    ts DATETIME NOT NULL,
+    wind_speed_knots REAL,      -- >= 0, relative to the ship as measured
+    wind_direction_deg REAL,    -- 0-360, direction the wind comes from
+    air_temp_c REAL,
+    pressure_hpa REAL,          -- barometric pressure
+    sea_state INTEGER,          -- Douglas scale, 0-9
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    extra_hash TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_met_ts ON met_readings(vessel_id, ts);
+
+CREATE TABLE IF NOT EXISTS power_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    bank_id TEXT,               -- battery bank, e.g. ESS-1; NULL for shore-only rows
+    ts DATETIME NOT NULL,
+    shore_status TEXT,          -- e.g., CONNECTED, DISCONNECTED
+    shore_kw REAL,              -- >= 0, drawn from the shore connection
+    soc_percent REAL,           -- battery state of charge, 0-100
+    battery_kw REAL,            -- positive charging, negative discharging
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    extra_hash TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_power_ts ON power_readings(vessel_id, ts);
+
+CREATE TABLE IF NOT EXISTS network_device_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    device_id TEXT,             -- switch, router, access point, etc., e.g. SW-BRIDGE
+    ts DATETIME NOT NULL,
+    device_type TEXT,           -- e.g., switch, router, access_point
+    status TEXT,                -- e.g., ONLINE, OFFLINE, DEGRADED
+    uptime_hours REAL,          -- >= 0, since the device last started
+    availability_percent REAL,  -- 0-100, share of recent polls answered
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    extra_hash TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_network_device_ts ON network_device_readings(vessel_id, ts);
+
 CREATE TABLE IF NOT EXISTS location_readings (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     vessel_id INTEGER NOT NULL,
@@ -132,8 +257,11 @@ CREATE TABLE IF NOT EXISTS location_readings (
     course_degrees REAL,        -- 0-360
     speed_knots REAL,           -- >= 0
     status TEXT,                -- underway, anchored, moored, etc.
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    origin TEXT,                -- system a synced position came from: ais, NULL otherwise
     row_hash TEXT NOT NULL,
     extra_json TEXT,
+    extra_hash TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
     FOREIGN KEY(vessel_id) REFERENCES vessels(id),
     UNIQUE(vessel_id, ts, row_hash)
@@ -141,16 +269,914 @@ CREATE TABLE IF NOT EXISTS location_readings (
 
 CREATE INDEX IF NOT EXISTS idx_location_ts ON location_readings(vessel_id, ts);
 
+-- extra_json payloads repeated across readings, stored once and referenced
+-- by the readings' extra_hash (hex SHA-256 of the payload)
+CREATE TABLE IF NOT EXISTS extra_payloads (
+    hash TEXT PRIMARY KEY,
+    payload BLOB NOT NULL,
+    used_at TEXT                -- last write referencing it
+);
+
+-- hashes of long extra_json payloads seen once, kept inline; a payload seen
+-- again moves to extra_payloads
+CREATE TABLE IF NOT EXISTS extra_seen (
+    hash TEXT PRIMARY KEY,
+    seen_at TEXT NOT NULL
+);
+
+-- alarms parsed from engine_readings.alarms; repeated readings of the same
+-- alarm on the same engine form one event, ended by the first reading without it
+CREATE TABLE IF NOT EXISTS alarm_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    engine_no INTEGER,
+    code TEXT NOT NULL,         -- normalized, e.g. LOW_OIL_PRESSURE
+    severity TEXT NOT NULL,     -- info|warning|critical
+    message TEXT,               -- alarm text of the first reading
+    start_ts DATETIME NOT NULL,
+    end_ts DATETIME,            -- NULL while still active
+    last_seen_ts DATETIME NOT NULL,
+    occurrences INTEGER NOT NULL,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alarm_events_start ON alarm_events(vessel_id, start_ts);
+
+-- running hours of each engine per UTC day, from the running hours counter
+-- in engine_readings.extra_json or else rpm above idle (see internal/runhours);
+-- rebuilt like alarm_events
+CREATE TABLE IF NOT EXISTS engine_running_hours (
+    vessel_id INTEGER NOT NULL,
+    engine_no INTEGER,
+    day TEXT NOT NULL,          -- YYYY-MM-DD
+    hours REAL NOT NULL,        -- 0..24
+    source TEXT NOT NULL,       -- counter|rpm
+    counter_hours REAL,         -- last counter reading of the day, NULL if none
+    computed_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, engine_no, day)
+);
+
+-- the same for generators, running while under load
+CREATE TABLE IF NOT EXISTS generator_running_hours (
+    vessel_id INTEGER NOT NULL,
+    gen_no INTEGER,
+    day TEXT NOT NULL,          -- YYYY-MM-DD
+    hours REAL NOT NULL,        -- 0..24
+    source TEXT NOT NULL,       -- counter|load
+    counter_hours REAL,         -- last counter reading of the day, NULL if none
+    computed_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, gen_no, day)
+);
+
+-- recurring maintenance tasks of an engine or generator, due every
+-- interval_hours of tracked running hours and/or interval_days since last done
+CREATE TABLE IF NOT EXISTS maintenance_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    equipment TEXT NOT NULL,    -- engine|generator
+    unit_no INTEGER NOT NULL,   -- engine_no or gen_no
+    task TEXT NOT NULL,
+    interval_hours REAL,        -- > 0
+    interval_days INTEGER,      -- > 0
+    last_done_on TEXT NOT NULL, -- YYYY-MM-DD; hours count from the day after
+    notes TEXT,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_items_vessel ON maintenance_items(vessel_id, equipment, unit_no);
+
+-- completed maintenance and defects of a vessel or one of its engines, tanks,
+-- generators and other units of the sensor registry, to annotate telemetry
+CREATE TABLE IF NOT EXISTS equipment_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,         -- maintenance|defect
+    equipment TEXT,             -- sensor kind, e.g. engine or tank; NULL for the vessel
+    unit TEXT,                  -- the readings' unit value, e.g. 2 or CAM-01
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL if not seen in readings
+    maintenance_item_id INTEGER, -- maintenance_items.id the entry completed
+    title TEXT NOT NULL,
+    description TEXT,
+    severity TEXT,              -- defects: minor|major|critical
+    occurred_on TEXT NOT NULL,  -- YYYY-MM-DD done or found on
+    status TEXT,                -- defects: open|closed
+    closed_on TEXT,             -- YYYY-MM-DD, closed defects
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_equipment_log_vessel ON equipment_log(vessel_id, occurred_on);
+
+-- fuel tank volumes falling abnormally fast while the engines are off or the
+-- vessel is not moving (see internal/fueldrop); rebuilt like alarm_events
+CREATE TABLE IF NOT EXISTS fuel_drop_alerts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    tank_no INTEGER,
+    start_ts DATETIME NOT NULL,
+    end_ts DATETIME NOT NULL,
+    start_liters REAL NOT NULL,
+    end_liters REAL NOT NULL,
+    drop_liters REAL NOT NULL,
+    rate_lph REAL NOT NULL,
+    reason TEXT NOT NULL,       -- engines_off|stationary|engines_off_stationary
+    raised_at DATETIME NOT NULL, -- first detection, kept when rebuilt
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fuel_drop_alerts_start ON fuel_drop_alerts(vessel_id, start_ts);
+
+-- wind/wave conditions from the external weather provider, one row per vessel-hour
+CREATE TABLE IF NOT EXISTS weather_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    hour TEXT NOT NULL,         -- YYYY-MM-DDTHH:00:00Z (UTC)
+    ts DATETIME NOT NULL,
+    location_reading_id INTEGER,
+    latitude REAL,
+    longitude REAL,
+    wind_speed_knots REAL,
+    wind_direction_deg REAL,
+    wave_height_m REAL,
+    wave_period_s REAL,
+    raw_json TEXT,              -- provider response
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, hour)
+);
+
+-- vessel-hours with positions but no weather yet, one row per vessel-hour
+-- with its latest position; a failed fetch is retried after a backoff
+CREATE TABLE IF NOT EXISTS weather_pending (
+    vessel_id INTEGER NOT NULL,
+    hour TEXT NOT NULL,         -- YYYY-MM-DDTHH:00:00Z (UTC)
+    location_reading_id INTEGER NOT NULL,
+    latitude REAL NOT NULL,
+    longitude REAL NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TEXT NOT NULL, -- RFC 3339, UTC
+    last_error TEXT,
+    PRIMARY KEY (vessel_id, hour)
+);
+
+CREATE INDEX IF NOT EXISTS idx_weather_pending_due ON weather_pending(next_attempt_at);
+
+-- the highest location_readings id whose vessel-hour has been queued in
+-- weather_pending; a single row
+CREATE TABLE IF NOT EXISTS weather_cursor (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    last_id INTEGER NOT NULL
+);
+
+-- port index used for port-call detection; polygon_json is [[lat,lon],...]
+CREATE TABLE IF NOT EXISTS ports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT UNIQUE NOT NULL,  -- UN/LOCODE
+    name TEXT NOT NULL,
+    country TEXT,
+    polygon_json TEXT NOT NULL,
+    created_at DATETIME DEFAULT (datetime('now')),
+    updated_at DATETIME DEFAULT (datetime('now'))
+);
+
+-- lookup values shared across the system (emission-factors, flags,
+-- vessel-types); attributes_json holds kind-specific numbers
+CREATE TABLE IF NOT EXISTS reference_entries (
+    kind TEXT NOT NULL,
+    code TEXT NOT NULL,         -- upper case
+    name TEXT NOT NULL,
+    attributes_json TEXT,
+    updated_at DATETIME DEFAULT (datetime('now')),
+    PRIMARY KEY (kind, code)
+);
+
+-- per-vessel overrides of the default daily row quota
+CREATE TABLE IF NOT EXISTS vessel_quotas (
+    vessel_id INTEGER PRIMARY KEY,
+    daily_row_limit INTEGER NOT NULL,   -- 0 disables the quota
+    throttle INTEGER NOT NULL DEFAULT 0, -- refuse ingest once exceeded
+    updated_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- rows written per vessel per UTC day (by ingest time), used for quotas
+CREATE TABLE IF NOT EXISTS vessel_daily_usage (
+    vessel_id INTEGER NOT NULL,
+    day TEXT NOT NULL,          -- YYYY-MM-DD
+    rows INTEGER NOT NULL DEFAULT 0,
+    alerted_at DATETIME,        -- set the first time the quota was exceeded that day
+    PRIMARY KEY (vessel_id, day),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- watermarked exports, so a leaked file can be traced to its recipient;
+-- rows and chain_hash are set once the export has been written
+CREATE TABLE IF NOT EXISTS export_watermarks (
+    id TEXT PRIMARY KEY,        -- export_id in the file
+    recipient TEXT NOT NULL,    -- API key fingerprint, empty without a key
+    org TEXT,
+    client_ip TEXT,
+    vessel_id INTEGER NOT NULL,
+    stream TEXT NOT NULL,
+    format TEXT NOT NULL,       -- csv|ndjson
+    from_ts DATETIME,
+    to_ts DATETIME,
+    issued_at DATETIME NOT NULL,
+    rows INTEGER,
+    chain_hash TEXT,
+    completed_at DATETIME,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- tamper-evident log of API changes and chained readings; each hash covers
+-- the entry and prev_hash (see internal/audit). Rows are never changed once
+-- hashed nor deleted.
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    recorded_at TEXT NOT NULL,  -- RFC 3339 with nanoseconds, as hashed
+    kind TEXT NOT NULL,         -- audit|reading
+    action TEXT NOT NULL,
+    actor TEXT,                 -- org and/or API key fingerprint
+    vessel_id INTEGER,
+    subject TEXT,
+    stream TEXT,                -- reading entries: stream and reading id
+    reading_id INTEGER,
+    digest TEXT,
+    detail_json TEXT,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL          -- '' only while the entry is being appended
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_reading ON audit_log(stream, reading_id);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+WHEN OLD.hash != ''
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+-- transactional outbox: every reading inserted, in order, written by the
+-- outbox_* triggers in the transaction of the insert; the dispatcher
+-- delivers it to webhooks and reading sinks (see internal/outbox)
+CREATE TABLE IF NOT EXISTS outbox (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    stream TEXT NOT NULL,
+    vessel_id INTEGER NOT NULL,
+    reading_id INTEGER NOT NULL,
+    created_at TEXT NOT NULL    -- RFC 3339, UTC
+);
+
+-- the last outbox seq delivered to each consumer (webhook:<url>,
+-- kafka:<prefix>, nats:<prefix>)
+CREATE TABLE IF NOT EXISTS outbox_cursors (
+    consumer TEXT PRIMARY KEY,
+    last_seq INTEGER NOT NULL,
+    delivered_at DATETIME NOT NULL
+);
+
+-- on an edge instance, the highest id of each reading stream, and of
+-- uploads, already pushed to the central API (see internal/replication)
+CREATE TABLE IF NOT EXISTS replication_cursors (
+    stream TEXT PRIMARY KEY,    -- a stream name, or uploads
+    last_id INTEGER NOT NULL,
+    pushed_at DATETIME NOT NULL
+);
+
+-- bytes an edge pushed per window of REPLICATION_BUDGET_WINDOW
+CREATE TABLE IF NOT EXISTS replication_usage (
+    window_start DATETIME PRIMARY KEY,
+    bytes INTEGER NOT NULL
+);
+
+-- on the central instance, the vessel each edge's vessel ids stand for
+CREATE TABLE IF NOT EXISTS replica_vessels (
+    edge TEXT NOT NULL,         -- REPLICATION_EDGE_ID of the edge
+    edge_vessel_id INTEGER NOT NULL,
+    vessel_id INTEGER NOT NULL REFERENCES vessels(id),
+    PRIMARY KEY (edge, edge_vessel_id)
+);
+
+-- the last write of each edited vessel metadata field, replicated both ways
+-- between an edge and the central instance; seq orders the writes here
+CREATE TABLE IF NOT EXISTS vessel_field_versions (
+    vessel_id INTEGER NOT NULL REFERENCES vessels(id),
+    field TEXT NOT NULL,        -- name, mmsi, flag, type or fleet
+    value TEXT,
+    updated_at DATETIME NOT NULL,
+    origin TEXT NOT NULL,       -- REPLICATION_EDGE_ID of the edge, or central
+    seq INTEGER NOT NULL,
+    PRIMARY KEY (vessel_id, field)
+);
+CREATE INDEX IF NOT EXISTS idx_vessel_field_versions_seq ON vessel_field_versions(seq);
+
+-- objects of the watched S3 bucket seen by the bucket ingester, with the
+-- upload their file became; failed objects are retried from retry_at
+-- (see internal/s3ingest)
+CREATE TABLE IF NOT EXISTS bucket_objects (
+    bucket TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    etag TEXT NOT NULL,         -- version ingested or tried
+    status TEXT NOT NULL,       -- ingested, already_ingested or failed
+    upload_id INTEGER,          -- first upload of the file
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    retry_at DATETIME,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (bucket, object_key)
+);
+
+-- resumable uploads in progress; the bytes received so far are in a file
+-- named by id (see internal/chunked)
+CREATE TABLE IF NOT EXISTS chunked_uploads (
+    id TEXT PRIMARY KEY,
+    filename TEXT NOT NULL,
+    size INTEGER NOT NULL,              -- announced size of the whole file
+    sha256 TEXT,                        -- announced hash of the whole file
+    received INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL        -- pushed back by every chunk
+);
+
+-- change data capture: every insert, update and delete of a reading, in
+-- order; filled by the cdc_* triggers on each reading table
+CREATE TABLE IF NOT EXISTS cdc_log (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,  -- the feed's resume token
+    stream TEXT NOT NULL,
+    op TEXT NOT NULL,           -- insert|update|delete
+    vessel_id INTEGER NOT NULL,
+    reading_id INTEGER NOT NULL,
+    changed_at TEXT NOT NULL    -- RFC 3339, UTC
+);
+
+CREATE INDEX IF NOT EXISTS idx_cdc_log_changed ON cdc_log(changed_at);
+
+-- tank registry: capacities fill in level_percent when a fuel sheet has no
+-- capacity column and bound the volumes it may report
+CREATE TABLE IF NOT EXISTS tanks (
+    vessel_id INTEGER NOT NULL,
+    tank_no INTEGER NOT NULL,
+    name TEXT,
+    capacity_liters REAL NOT NULL, -- > 0
+    fuel_type TEXT,                -- emission-factors code, e.g. HFO
+    updated_at DATETIME DEFAULT (datetime('now')),
+    PRIMARY KEY (vessel_id, tank_no),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+CREATE TABLE IF NOT EXISTS engines (
+    vessel_id INTEGER NOT NULL,
+    engine_no INTEGER NOT NULL,
+    name TEXT,
+    maker TEXT,
+    model TEXT,
+    rated_rpm REAL,                -- > 0; readings above it are flagged on ingest
+    rated_power_kw REAL,           -- > 0
+    commissioned_on TEXT,          -- YYYY-MM-DD
+    updated_at DATETIME DEFAULT (datetime('now')),
+    PRIMARY KEY (vessel_id, engine_no),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- every unit (engine, tank, generator, camera, impact sensor) seen in the
+-- readings, registered on first sight; location and installed_on are edited
+-- through the API
+CREATE TABLE IF NOT EXISTS sensors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    stream TEXT NOT NULL,       -- engines|fuel|generators|cctv|impact
+    unit TEXT NOT NULL,         -- the readings' unit column as text, e.g. 2 or CAM-01
+    location TEXT,              -- where on the vessel, e.g. engine room port side
+    installed_on TEXT,          -- YYYY-MM-DD
+    first_seen DATETIME NOT NULL, -- earliest reading ts
+    last_seen DATETIME NOT NULL,  -- latest reading ts
+    updated_at DATETIME,        -- last metadata edit
+    filters_json TEXT,          -- spike filters applied on ingest (see internal/outliers)
+    UNIQUE(vessel_id, stream, unit),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- reading values sensor filters replaced on ingest, with what the sheet said
+CREATE TABLE IF NOT EXISTS reading_outliers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    stream TEXT NOT NULL,
+    sensor_id INTEGER NOT NULL,
+    ts DATETIME NOT NULL,       -- of the reading
+    field TEXT NOT NULL,
+    raw_value REAL NOT NULL,
+    stored_value REAL NOT NULL,
+    method TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    UNIQUE(sensor_id, ts, field),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    FOREIGN KEY(sensor_id) REFERENCES sensors(id)
+);
+CREATE INDEX IF NOT EXISTS idx_reading_outliers_vessel ON reading_outliers(vessel_id, ts);
+
+-- camera snapshots: a URL from the CCTV sheet or an image uploaded to the
+-- object store (object_key); linked to the camera's status reading at ts,
+-- if any, by (vessel_id, cam_id, ts)
+CREATE TABLE IF NOT EXISTS cctv_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    cam_id TEXT NOT NULL,
+    ts DATETIME NOT NULL,
+    url TEXT,                   -- external reference
+    object_key TEXT,            -- uploaded image
+    content_type TEXT,          -- of the uploaded image
+    size_bytes INTEGER,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, cam_id, ts)
+);
+
+-- streams defined at runtime by admins for sheet types without a built-in
+-- stream; their readings keep the column values as JSON in custom_readings
+CREATE TABLE IF NOT EXISTS custom_streams (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    sheets_json TEXT NOT NULL,  -- lower-case substrings of the sheet names it is read from
+    unit_column TEXT,           -- column identifying the unit, if any
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS custom_stream_columns (
+    stream_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,         -- int|float|text
+    headers_json TEXT NOT NULL, -- header aliases matched as for built-in streams
+    min_value REAL,             -- valid range of numeric columns
+    max_value REAL,
+    PRIMARY KEY (stream_id, position),
+    UNIQUE(stream_id, name),
+    FOREIGN KEY(stream_id) REFERENCES custom_streams(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS custom_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    stream_id INTEGER NOT NULL,
+    vessel_id INTEGER NOT NULL,
+    ts DATETIME NOT NULL,
+    unit TEXT,
+    values_json TEXT NOT NULL,
+    source TEXT,
+    row_hash TEXT NOT NULL UNIQUE,
+    extra_json BLOB,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(stream_id) REFERENCES custom_streams(id) ON DELETE CASCADE,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+CREATE INDEX IF NOT EXISTS idx_custom_ts ON custom_readings(stream_id, vessel_id, ts);
+
+-- headers of vendor spreadsheets mapped to stream fields, on top of the
+-- built-in keywords
+CREATE TABLE IF NOT EXISTS header_aliases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER,          -- NULL for every vessel
+    stream TEXT,                -- NULL for any stream with the field
+    header TEXT NOT NULL,       -- as it appears in the sheet
+    field TEXT NOT NULL,        -- stream field, or ts for the timestamp
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id) ON DELETE CASCADE
+);
+
+-- plausibility rules checked on the rows of a stream's sheets (see
+-- internal/rules)
+CREATE TABLE IF NOT EXISTS validation_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    stream TEXT NOT NULL,
+    expression TEXT NOT NULL,
+    action TEXT NOT NULL,       -- reject or warn
+    description TEXT,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+-- warnings of each upload, as returned by the ingest
+CREATE TABLE IF NOT EXISTS upload_warnings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    upload_id INTEGER NOT NULL,
+    sheet TEXT,                 -- NULL for warnings about the whole file
+    row_number INTEGER,         -- spreadsheet row, NULL if not about a row
+    message TEXT NOT NULL,
+    row_json TEXT,              -- cells of the row by header, as read
+    FOREIGN KEY(upload_id) REFERENCES uploads(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_upload_warnings_upload ON upload_warnings(upload_id, id);
+
 -- lightweight materialized view for "latest timestamp per stream"
 CREATE TABLE IF NOT EXISTS vessel_stream_latest (
     vessel_id INTEGER NOT NULL,
     stream TEXT NOT NULL,       -- engines|fuel|generators|cctv|impact|location
     latest_ts DATETIME NOT NULL,
+    version INTEGER NOT NULL DEFAULT 0, -- bumped on every write, for ETags
+    updated_at DATETIME,        -- time of the last write
     PRIMARY KEY (vessel_id, stream),
     FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- hourly and daily aggregates of every metric, rebuilt at ingest for the
+-- buckets written to; aggregate queries read them instead of the readings
+CREATE TABLE IF NOT EXISTS stream_rollups (
+    vessel_id INTEGER NOT NULL,
+    stream TEXT NOT NULL,
+    metric TEXT NOT NULL,
+    unit TEXT NOT NULL,          -- unit as text, '' for streams without units
+    period INTEGER NOT NULL,     -- bucket length in seconds: 3600 or 86400
+    bucket INTEGER NOT NULL,     -- bucket start, Unix seconds
+    count INTEGER NOT NULL,
+    sum REAL NOT NULL,
+    min REAL NOT NULL,
+    max REAL NOT NULL,
+    uncertainty_sum REAL NOT NULL,   -- sum of |value| * uncertainty_percent / 100
+    uncertainty_count INTEGER NOT NULL, -- readings with an uncertainty estimate
+    PRIMARY KEY (vessel_id, stream, metric, period, unit, bucket),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- one row per vessel and UTC day, written by the nightly daily-summary job
+CREATE TABLE IF NOT EXISTS vessel_daily_summaries (
+    vessel_id INTEGER NOT NULL,
+    day TEXT NOT NULL,           -- YYYY-MM-DD
+    distance_nm REAL NOT NULL,
+    avg_speed_knots REAL,
+    fuel_consumed_liters REAL NOT NULL,
+    engine_running_hours REAL NOT NULL,
+    alarm_count INTEGER NOT NULL,
+    completeness_percent REAL NOT NULL,
+    computed_at DATETIME NOT NULL,
+    PRIMARY KEY (vessel_id, day),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- noon reports from the noon report sheets, with the values computed from
+-- the telemetry of the period since the previous report (see internal/noon)
+CREATE TABLE IF NOT EXISTS noon_reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    reported_at DATETIME NOT NULL,
+    upload_id INTEGER,          -- uploads.id of the last upload writing the report
+    rob_fuel_liters REAL,
+    distance_nm REAL,
+    avg_speed_knots REAL,
+    weather TEXT,
+    remarks TEXT,
+    period_start DATETIME NOT NULL,
+    computed_rob_liters REAL,
+    computed_distance_nm REAL,
+    computed_avg_speed_knots REAL,
+    discrepancies_json TEXT NOT NULL, -- JSON array of models.NoonDiscrepancy
+    flagged INTEGER NOT NULL DEFAULT 0,
+    reconciled_at DATETIME NOT NULL,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, reported_at)
+);
+
+-- ISO 19848 data channels of a vessel mapped to stream fields, on top of the
+-- bundled catalog (see internal/shipdata)
+CREATE TABLE IF NOT EXISTS data_channel_mappings (
+    vessel_id INTEGER NOT NULL,
+    channel_id TEXT NOT NULL,   -- local ID
+    stream TEXT NOT NULL,
+    field TEXT NOT NULL,
+    unit TEXT,                  -- engine, tank, generator etc. of streams with units
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (vessel_id, channel_id),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id) ON DELETE CASCADE
+);
+
+-- values of ISO 19848 data channels no stream field is mapped to, kept as
+-- they came
+CREATE TABLE IF NOT EXISTS channel_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    channel_id TEXT NOT NULL,   -- local ID
+    ts DATETIME NOT NULL,
+    value REAL,                 -- numeric values
+    text_value TEXT,            -- other values
+    quality TEXT,
+    event INTEGER NOT NULL DEFAULT 0, -- from event data rather than tabular data
+    upload_id INTEGER,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, channel_id, ts)
+);
+
+-- Modbus TCP registers polled for a vessel's readings, e.g. of the
+-- switchboard, one stream field of a unit each
+CREATE TABLE IF NOT EXISTS modbus_registers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    device TEXT NOT NULL,              -- host:port of the Modbus TCP server
+    slave_id INTEGER NOT NULL,         -- unit identifier
+    register_table TEXT NOT NULL,      -- holding|input
+    address INTEGER NOT NULL,          -- 0-based
+    data_type TEXT NOT NULL,           -- uint16|int16|uint32|int32|float32
+    word_swap INTEGER NOT NULL DEFAULT 0, -- 32-bit values low word first
+    scale REAL NOT NULL DEFAULT 1,
+    value_offset REAL NOT NULL DEFAULT 0,  -- value = raw * scale + offset
+    stream TEXT NOT NULL,
+    field TEXT NOT NULL,
+    unit TEXT,                         -- engine, tank or generator number
+    last_value REAL,                   -- of the latest poll
+    last_polled_at DATETIME,
+    last_error TEXT,                   -- NULL if the latest poll read it
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id) ON DELETE CASCADE,
+    UNIQUE(vessel_id, stream, unit, field)
+);
+
+-- cameras, NVRs and network devices of a vessel polled over SNMP for their
+-- CCTV or network device readings
+CREATE TABLE IF NOT EXISTS snmp_devices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    name TEXT NOT NULL,                -- cam_id or device_id of its readings
+    kind TEXT NOT NULL,                -- camera|nvr|switch|router|firewall|access_point|other
+    address TEXT NOT NULL,             -- host or host:port of the agent
+    version TEXT NOT NULL,             -- 1|2c
+    community TEXT NOT NULL,
+    status_oid TEXT,                   -- reported as the status; NULL for ONLINE when it answers
+    last_status TEXT,                  -- of the latest poll
+    last_uptime_hours REAL,
+    last_polled_at DATETIME,
+    last_error TEXT,                   -- NULL if the latest poll was answered
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id) ON DELETE CASCADE,
+    UNIQUE(vessel_id, name)
+);
+
+-- cameras of a vessel polled over ONVIF for their CCTV readings
+CREATE TABLE IF NOT EXISTS onvif_cameras (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    cam_id TEXT NOT NULL,              -- of its CCTV readings
+    endpoint TEXT NOT NULL,            -- URL of the device service
+    username TEXT,                     -- NULL for cameras without authentication
+    password TEXT,
+    manufacturer TEXT,                 -- as the camera reported at the latest poll
+    model TEXT,
+    firmware_version TEXT,
+    last_status TEXT,                  -- of the latest poll
+    last_polled_at DATETIME,
+    last_seen_at DATETIME,             -- latest poll the camera answered
+    last_error TEXT,                   -- NULL if the latest poll was answered in full
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id) ON DELETE CASCADE,
+    UNIQUE(vessel_id, cam_id)
+);
+
+-- cameras that stopped responding to polls; the first poll answered after
+-- resolves the alert
+CREATE TABLE IF NOT EXISTS camera_alerts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    cam_id TEXT NOT NULL,
+    raised_at DATETIME NOT NULL,
+    last_seen_at DATETIME,             -- latest answer before, NULL if it never answered
+    message TEXT NOT NULL,             -- the error of the poll raising it
+    resolved_at DATETIME,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_camera_alerts_raised ON camera_alerts(vessel_id, raised_at);
+
+-- reports emailed after each day, week or month, of a vessel or a fleet
+CREATE TABLE IF NOT EXISTS report_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    frequency TEXT NOT NULL,     -- daily|weekly|monthly
+    vessel_id INTEGER,           -- set for a vessel's report
+    fleet TEXT,                  -- or for one report per vessel of the fleet
+    recipients_json TEXT NOT NULL,
+    template TEXT,               -- report_templates.name, NULL for the default layout
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- send history of the scheduled reports
+CREATE TABLE IF NOT EXISTS report_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    schedule_id INTEGER NOT NULL,
+    period TEXT NOT NULL,        -- YYYY-MM-DD, YYYY-Www or YYYY-MM
+    recipients_json TEXT NOT NULL,
+    vessels INTEGER NOT NULL,    -- reports attached
+    status TEXT NOT NULL,        -- sent|failed
+    error TEXT,
+    manual INTEGER NOT NULL DEFAULT 0,
+    at DATETIME NOT NULL,
+    FOREIGN KEY(schedule_id) REFERENCES report_schedules(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_report_deliveries ON report_deliveries(schedule_id, period);
+
+-- report layouts and branding, e.g. one per charterer
+CREATE TABLE IF NOT EXISTS report_templates (
+    name TEXT PRIMARY KEY,
+    description TEXT,
+    sections_json TEXT NOT NULL,
+    branding_json TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
 );`
 
+// columnMigrations adds columns introduced after a table first shipped.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so databases
+// created by older versions need these applied explicitly.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"vessels", "archived_at", "DATETIME"},
+	{"vessels", "mmsi", "TEXT"},
+	{"location_readings", "source", "TEXT"},
+	{"vessels", "fleet", "TEXT"},
+	{"engine_readings", "source", "TEXT"},
+	{"fuel_tank_readings", "source", "TEXT"},
+	{"generator_readings", "source", "TEXT"},
+	{"cctv_status_readings", "source", "TEXT"},
+	{"impact_vibration_readings", "source", "TEXT"},
+	{"fuel_tank_readings", "uncertainty_percent", "REAL"},
+	{"generator_readings", "uncertainty_percent", "REAL"},
+	{"engine_readings", "sensor_ref", "INTEGER"},
+	{"fuel_tank_readings", "sensor_ref", "INTEGER"},
+	{"generator_readings", "sensor_ref", "INTEGER"},
+	{"cctv_status_readings", "sensor_ref", "INTEGER"},
+	{"impact_vibration_readings", "sensor_ref", "INTEGER"},
+	{"vessel_stream_latest", "version", "INTEGER NOT NULL DEFAULT 0"},
+	{"vessel_stream_latest", "updated_at", "DATETIME"},
+	{"report_schedules", "template", "TEXT"},
+	{"engine_readings", "extra_hash", "TEXT"},
+	{"fuel_tank_readings", "extra_hash", "TEXT"},
+	{"generator_readings", "extra_hash", "TEXT"},
+	{"cctv_status_readings", "extra_hash", "TEXT"},
+	{"impact_vibration_readings", "extra_hash", "TEXT"},
+	{"bilge_ballast_readings", "extra_hash", "TEXT"},
+	{"navigation_readings", "extra_hash", "TEXT"},
+	{"met_readings", "extra_hash", "TEXT"},
+	{"power_readings", "extra_hash", "TEXT"},
+	{"location_readings", "extra_hash", "TEXT"},
+	{"sensors", "filters_json", "TEXT"},
+	{"location_readings", "origin", "TEXT"},
+}
+
+// dataMigrations rewrite values whose meaning changed. They run on every
+// start, so each must be idempotent.
+var dataMigrations = []string{
+	// Webhooks and sinks kept high-water marks before the outbox
+	"DROP TABLE IF EXISTS webhook_marks",
+}
+
+// SensorUnits maps each stream with units to its unit column, whose values
+// are registered in the sensors table. The store fills it from its stream
+// registry.
+var SensorUnits = map[string]string{}
+
+// sensorBackfill registers the units of readings written before the sensor
+// registry existed and links those readings to them. Only unlinked readings
+// are touched, so it is idempotent; the links reach cdc_log as updates.
+func sensorBackfill() []string {
+	var stmts []string
+	for stream, unit := range SensorUnits {
+		table := CDCTables[stream]
+		stmts = append(stmts, fmt.Sprintf(`
+INSERT OR IGNORE INTO sensors (vessel_id, stream, unit, first_seen, last_seen)
+SELECT vessel_id, '%[1]s', CAST(%[3]s AS TEXT), MIN(ts), MAX(ts) FROM %[2]s
+WHERE %[3]s IS NOT NULL AND sensor_ref IS NULL
+GROUP BY vessel_id, %[3]s`, stream, table, unit), fmt.Sprintf(`
+UPDATE %[2]s SET sensor_ref = (
+    SELECT s.id FROM sensors s
+    WHERE s.vessel_id = %[2]s.vessel_id AND s.stream = '%[1]s' AND s.unit = CAST(%[2]s.%[3]s AS TEXT))
+WHERE %[3]s IS NOT NULL AND sensor_ref IS NULL`, stream, table, unit))
+	}
+	return stmts
+}
+
+// extraHashIndexes index the readings referencing extra_payloads, for the
+// prune of those no reading references. extra_hash may be newer than the
+// table, so they are created after the column migrations.
+func extraHashIndexes() []string {
+	var stmts []string
+	for _, table := range CDCTables {
+		stmts = append(stmts, fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS idx_%[1]s_extra_hash ON %[1]s(extra_hash) WHERE extra_hash IS NOT NULL", table))
+	}
+	return stmts
+}
+
+// CDCTables maps each stream to the reading table whose changes cdc_log
+// and the outbox record. The store fills it from its stream registry, so
+// Migrate refuses to run without it.
+var CDCTables = map[string]string{}
+
+// cdcTriggers returns the triggers that fill cdc_log.
+func cdcTriggers() string {
+	var b strings.Builder
+	for stream, table := range CDCTables {
+		for _, op := range []struct{ name, event, row string }{
+			{"insert", "INSERT", "NEW"},
+			{"update", "UPDATE", "NEW"},
+			{"delete", "DELETE", "OLD"},
+		} {
+			fmt.Fprintf(&b, `
+CREATE TRIGGER IF NOT EXISTS cdc_%[1]s_%[2]s AFTER %[3]s ON %[1]s
+BEGIN
+    INSERT INTO cdc_log (stream, op, vessel_id, reading_id, changed_at)
+    VALUES ('%[4]s', '%[2]s', %[5]s.vessel_id, %[5]s.id, strftime('%%Y-%%m-%%dT%%H:%%M:%%fZ', 'now'));
+END;
+`, table, op.name, op.event, stream, op.row)
+		}
+	}
+	return b.String()
+}
+
+// outboxTriggers returns the triggers that fill the outbox.
+func outboxTriggers() string {
+	var b strings.Builder
+	for stream, table := range CDCTables {
+		fmt.Fprintf(&b, `
+CREATE TRIGGER IF NOT EXISTS outbox_%[1]s AFTER INSERT ON %[1]s
+BEGIN
+    INSERT INTO outbox (stream, vessel_id, reading_id, created_at)
+    VALUES ('%[2]s', NEW.vessel_id, NEW.id, strftime('%%Y-%%m-%%dT%%H:%%M:%%fZ', 'now'));
+END;
+`, table, stream)
+	}
+	return b.String()
+}
+
 func Migrate(db *sql.DB) error {
-	_, err := db.Exec(schema)
-	return err
+	if len(CDCTables) == 0 {
+		return errors.New("no reading tables; the store package registers them")
+	}
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	if _, err := db.Exec(cdcTriggers()); err != nil {
+		return fmt.Errorf("creating change data capture triggers: %w", err)
+	}
+	if _, err := db.Exec(outboxTriggers()); err != nil {
+		return fmt.Errorf("creating outbox triggers: %w", err)
+	}
+
+	for _, m := range columnMigrations {
+		exists, err := columnExists(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			return fmt.Errorf("adding %s.%s: %w", m.table, m.column, err)
+		}
+	}
+
+	for _, m := range append(append(dataMigrations, sensorBackfill()...), extraHashIndexes()...) {
+		if _, err := db.Exec(m); err != nil {
+			return fmt.Errorf("migrating data: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
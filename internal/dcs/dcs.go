@@ -0,0 +1,374 @@
+// Package dcs compiles a vessel's annual figures for the IMO Data Collection
+// System (MARPOL Annex VI, regulation 27 and appendix IX): the distance
+// travelled, the hours underway and the fuel oil consumed in a calendar
+// year. Each figure is taken from the telemetry or from the noon reports,
+// and both are broken down by month so a verifier can check one against the
+// other.
+package dcs
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"vessel-telemetry-api/internal/daily"
+	"vessel-telemetry-api/internal/deltas"
+	"vessel-telemetry-api/internal/gensets"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/resample"
+	"vessel-telemetry-api/internal/utilization"
+)
+
+// Sources of a figure.
+const (
+	Telemetry   = "telemetry"
+	NoonReports = "noon_reports"
+)
+
+// Methods of collecting fuel oil consumption data, as appendix IX names them.
+const (
+	MethodTankMonitoring = "Bunker fuel oil tank monitoring on-board"
+	MethodFlowMeters     = "Flow meters for applicable combustion processes"
+)
+
+// FuelType is a fuel oil type of appendix IX with its density, which
+// converts the liters measured to the metric tonnes reported.
+type FuelType struct {
+	Name    string
+	Density float64 // t/m3
+}
+
+// FuelTypes are the fuel types by the code the API takes.
+var FuelTypes = map[string]FuelType{
+	"diesel_gas_oil": {"Diesel/Gas Oil", 0.890},
+	"lfo":            {"LFO", 0.955},
+	"hfo":            {"HFO", 0.991},
+}
+
+// Options tune the figures.
+type Options struct {
+	Fuel FuelType
+	// Source is the source every figure is taken from; empty takes the
+	// telemetry where it has the figure and the noon reports otherwise
+	Source string
+	// BunkeringLiters is the rise of a tank's volume between two readings
+	// taken as bunkering, not consumption
+	BunkeringLiters float64
+	// TankMaxGap is the longest time between two tank readings whose
+	// difference still counts as consumption
+	TankMaxGap time.Duration
+	Underway   utilization.Options
+}
+
+// DefaultOptions report HFO, count tank rises of 1 m3 as bunkering and
+// take underway hours as the utilization report does.
+var DefaultOptions = Options{
+	Fuel:            FuelTypes["hfo"],
+	BunkeringLiters: 1000,
+	TankMaxGap:      48 * time.Hour,
+	Underway:        utilization.DefaultOptions,
+}
+
+// Inputs are a vessel's data of the year.
+type Inputs struct {
+	Vessel models.Vessel
+	// Engines are the registered engines, whose rated power is the main
+	// engines' power output
+	Engines []models.Engine
+	Fixes   []ports.Fix
+	// Tanks are the volume readings of each tank, oldest first
+	Tanks      [][]resample.Point
+	Generators []gensets.Reading
+	// NoonReports are those of the year, after the last one before it if
+	// any, oldest first
+	NoonReports []models.NoonReport
+}
+
+// Report is the data appendix IX asks of a ship for one year, with the
+// source of each figure and the breakdown verifying them. Ship particulars
+// the API does not hold are null and listed in Verification.Missing.
+type Report struct {
+	IMONumber         *string           `json:"imo_number"`
+	ShipName          string            `json:"ship_name"`
+	ShipType          *string           `json:"ship_type"`
+	Year              int               `json:"year"`
+	PeriodStart       string            `json:"period_start"` // YYYY-MM-DD
+	PeriodEnd         string            `json:"period_end"`   // YYYY-MM-DD, inclusive
+	GrossTonnage      *float64          `json:"gross_tonnage"`
+	NetTonnage        *float64          `json:"net_tonnage"`
+	Deadweight        *float64          `json:"deadweight_tonnage"`
+	MainEnginePowerKW *float64          `json:"main_engine_power_kw"`
+	AuxEnginePowerKW  *float64          `json:"auxiliary_engine_power_kw"`
+	EEDI              *float64          `json:"eedi"`
+	IceClass          *string           `json:"ice_class"`
+	DistanceNM        *float64          `json:"distance_travelled_nm"`
+	HoursUnderway     *float64          `json:"hours_underway"`
+	FuelConsumption   []FuelConsumption `json:"fuel_oil_consumption"`
+	FuelDataMethod    *string           `json:"fuel_data_collection_method"`
+	Sources           Sources           `json:"sources"`
+	Verification      Verification      `json:"verification"`
+}
+
+// FuelConsumption is the consumption of one fuel type.
+type FuelConsumption struct {
+	FuelType string  `json:"fuel_type"`
+	Tonnes   float64 `json:"metric_tonnes"`
+	Liters   float64 `json:"liters"`
+	Density  float64 `json:"density_t_per_m3"`
+}
+
+// Sources name where each figure was taken from, empty if it has none.
+type Sources struct {
+	Distance      string `json:"distance_travelled"`
+	HoursUnderway string `json:"hours_underway"`
+	Fuel          string `json:"fuel_oil_consumption"`
+}
+
+// Comparison is a figure from both sources, nil where a source has none,
+// and how far the noon reports are from the telemetry.
+type Comparison struct {
+	Telemetry         *float64 `json:"telemetry"`
+	NoonReports       *float64 `json:"noon_reports"`
+	DifferencePercent *float64 `json:"difference_percent"`
+}
+
+// Verification is the breakdown of the figures.
+type Verification struct {
+	DistanceNM    Comparison `json:"distance_travelled_nm"`
+	HoursUnderway Comparison `json:"hours_underway"`
+	// FuelLiters compares tank monitoring with the noon reports' fuel
+	// remaining on board
+	FuelLiters Comparison `json:"fuel_oil_consumption_liters"`
+	// GeneratorFuelLiters is what the generators' flow meters recorded, a
+	// part of the consumption
+	GeneratorFuelLiters *float64 `json:"generator_fuel_liters"`
+	Positions           int      `json:"positions"`
+	TankReadings        int      `json:"tank_readings"`
+	NoonReports         int      `json:"noon_reports"`
+	// FlaggedNoonReports are those with discrepancies from the telemetry
+	FlaggedNoonReports int     `json:"flagged_noon_reports"`
+	Months             []Month `json:"months"`
+	// Missing are the fields of appendix IX the API does not hold
+	Missing []string `json:"missing"`
+}
+
+// Month is the breakdown of one calendar month.
+type Month struct {
+	Month                  string  `json:"month"` // YYYY-MM
+	DistanceTelemetryNM    float64 `json:"distance_telemetry_nm"`
+	DistanceNoonReportsNM  float64 `json:"distance_noon_reports_nm"`
+	HoursUnderwayTelemetry float64 `json:"hours_underway_telemetry"`
+	HoursUnderwayNoon      float64 `json:"hours_underway_noon_reports"`
+	FuelTanksLiters        float64 `json:"fuel_tanks_liters"`
+	FuelNoonReportsLiters  float64 `json:"fuel_noon_reports_liters"`
+	GeneratorFuelLiters    float64 `json:"generator_fuel_liters"`
+	Positions              int     `json:"positions"`
+	NoonReports            int     `json:"noon_reports"`
+	FlaggedNoonReports     int     `json:"flagged_noon_reports"`
+}
+
+// Period returns the reporting period of a year as of now: the calendar
+// year, up to now for the year under way.
+func Period(year int, now time.Time) (start, end time.Time) {
+	start = time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	end = start.AddDate(1, 0, 0)
+	if now.Before(end) {
+		end = now.UTC()
+	}
+	return start, end
+}
+
+// Build compiles the report of the period from..to, within one year.
+func Build(from, to time.Time, in Inputs, opts Options) Report {
+	r := Report{
+		IMONumber:   in.Vessel.IMO,
+		ShipName:    in.Vessel.Name,
+		ShipType:    in.Vessel.Type,
+		Year:        from.Year(),
+		PeriodStart: from.Format(daily.DayLayout),
+		PeriodEnd:   to.Add(-time.Nanosecond).Format(daily.DayLayout),
+	}
+	months := utilization.Build(from, to, nil, in.Fixes, nil, opts.Underway)
+	v := Verification{Months: make([]Month, len(months))}
+	index := make(map[string]int, len(months))
+	for i, m := range months {
+		v.Months[i] = Month{Month: m.Month, HoursUnderwayTelemetry: m.UnderwayHours}
+		index[m.Month] = i
+	}
+	month := func(t time.Time) *Month {
+		if t.Before(from) || !t.Before(to) {
+			return nil
+		}
+		return &v.Months[index[t.UTC().Format("2006-01")]]
+	}
+
+	// Distance along the positions, each leg in the month it ends
+	fixes := append([]ports.Fix(nil), in.Fixes...)
+	sort.SliceStable(fixes, func(i, j int) bool { return fixes[i].Timestamp.Before(fixes[j].Timestamp) })
+	for i, f := range fixes {
+		m := month(f.Timestamp)
+		if m == nil {
+			continue
+		}
+		v.Positions++
+		m.Positions++
+		if i > 0 {
+			m.DistanceTelemetryNM += daily.Distance(fixes[i-1 : i+1])
+		}
+	}
+
+	// Tank volume falls, leaving out bunkering and gaps
+	tanks := false
+	for _, points := range in.Tanks {
+		d, _ := deltas.Compute(points, deltas.Options{MaxIncrease: &opts.BunkeringLiters, MaxGap: opts.TankMaxGap})
+		for _, p := range points {
+			if month(p.TS) != nil {
+				v.TankReadings++
+				tanks = true
+			}
+		}
+		for _, delta := range d {
+			if m := month(delta.To); m != nil && delta.Delta != nil {
+				m.FuelTanksLiters -= *delta.Delta
+			}
+		}
+	}
+
+	// Generator flow meters, month by month
+	var generators bool
+	byMonth := make(map[*Month][]gensets.Reading)
+	for _, g := range in.Generators {
+		if m := month(g.TS); m != nil {
+			byMonth[m] = append(byMonth[m], g)
+			generators = generators || g.FuelRateLPH != nil
+		}
+	}
+	for m, readings := range byMonth {
+		m.GeneratorFuelLiters = gensets.Build(readings, gensets.Options{MaxGap: opts.Underway.MaxGap}).FuelLiters
+	}
+
+	// Noon reports: distance and steaming time as reported, fuel as the fall
+	// of the fuel remaining on board since the previous report
+	var noonDistance, noonHours, noonFuel bool
+	var previousROB *float64
+	for _, nr := range in.NoonReports {
+		rob := previousROB
+		if nr.ROBFuelLiters != nil {
+			previousROB = nr.ROBFuelLiters
+		}
+		m := month(nr.ReportedAt)
+		if m == nil {
+			continue
+		}
+		v.NoonReports++
+		m.NoonReports++
+		if nr.Flagged {
+			v.FlaggedNoonReports++
+			m.FlaggedNoonReports++
+		}
+		if nr.DistanceNM != nil {
+			noonDistance = true
+			m.DistanceNoonReportsNM += *nr.DistanceNM
+			if nr.AvgSpeedKnots != nil && *nr.AvgSpeedKnots > 0 {
+				noonHours = true
+				m.HoursUnderwayNoon += *nr.DistanceNM / *nr.AvgSpeedKnots
+			}
+		}
+		// A rise is bunkering; the consumption since the previous report is
+		// not known
+		if rob != nil && nr.ROBFuelLiters != nil && *nr.ROBFuelLiters <= *rob {
+			noonFuel = true
+			m.FuelNoonReportsLiters += *rob - *nr.ROBFuelLiters
+		}
+	}
+
+	var distance, hours, fuel, noonDist, noonH, noonF, genFuel float64
+	for _, m := range v.Months {
+		distance += m.DistanceTelemetryNM
+		hours += m.HoursUnderwayTelemetry
+		fuel += m.FuelTanksLiters
+		noonDist += m.DistanceNoonReportsNM
+		noonH += m.HoursUnderwayNoon
+		noonF += m.FuelNoonReportsLiters
+		genFuel += m.GeneratorFuelLiters
+	}
+	v.DistanceNM = compare(v.Positions > 1, distance, noonDistance, noonDist)
+	v.HoursUnderway = compare(v.Positions > 1, hours, noonHours, noonH)
+	v.FuelLiters = compare(tanks, fuel, noonFuel, noonF)
+	if generators {
+		v.GeneratorFuelLiters = &genFuel
+	}
+
+	r.DistanceNM, r.Sources.Distance = pick(v.DistanceNM, opts.Source)
+	r.HoursUnderway, r.Sources.HoursUnderway = pick(v.HoursUnderway, opts.Source)
+	var liters *float64
+	liters, r.Sources.Fuel = pick(v.FuelLiters, opts.Source)
+	r.FuelConsumption = []FuelConsumption{}
+	switch {
+	case liters != nil:
+		method := MethodTankMonitoring
+		r.FuelDataMethod = &method
+		r.FuelConsumption = append(r.FuelConsumption, consumption(*liters, opts.Fuel))
+	case generators && opts.Source != NoonReports:
+		// Only the generators metered their fuel
+		method := MethodFlowMeters
+		r.FuelDataMethod, r.Sources.Fuel = &method, Telemetry
+		r.FuelConsumption = append(r.FuelConsumption, consumption(genFuel, opts.Fuel))
+	}
+
+	for _, e := range in.Engines {
+		if e.RatedPowerKW != nil {
+			if r.MainEnginePowerKW == nil {
+				r.MainEnginePowerKW = new(float64)
+			}
+			*r.MainEnginePowerKW += *e.RatedPowerKW
+		}
+	}
+	v.Missing = []string{"gross_tonnage", "net_tonnage", "deadweight_tonnage"}
+	if r.MainEnginePowerKW == nil {
+		v.Missing = append(v.Missing, "main_engine_power_kw")
+	}
+	v.Missing = append(v.Missing, "auxiliary_engine_power_kw", "eedi", "ice_class")
+	if r.IMONumber == nil {
+		v.Missing = append([]string{"imo_number"}, v.Missing...)
+	}
+	r.Verification = v
+	return r
+}
+
+func compare(hasTelemetry bool, telemetry float64, hasNoon bool, noon float64) Comparison {
+	var c Comparison
+	if hasTelemetry {
+		c.Telemetry = &telemetry
+	}
+	if hasNoon {
+		c.NoonReports = &noon
+	}
+	if hasTelemetry && hasNoon && telemetry != 0 {
+		diff := math.Round((noon-telemetry)/telemetry*1000) / 10
+		c.DifferencePercent = &diff
+	}
+	return c
+}
+
+// pick returns the figure of the source, or of the telemetry and else the
+// noon reports without one, and the source it came from.
+func pick(c Comparison, source string) (*float64, string) {
+	switch {
+	case source != NoonReports && c.Telemetry != nil:
+		return c.Telemetry, Telemetry
+	case source != Telemetry && c.NoonReports != nil:
+		return c.NoonReports, NoonReports
+	}
+	return nil, ""
+}
+
+func consumption(liters float64, fuel FuelType) FuelConsumption {
+	return FuelConsumption{
+		FuelType: fuel.Name,
+		Liters:   liters,
+		Tonnes:   math.Round(liters/1000*fuel.Density*1000) / 1000,
+		Density:  fuel.Density,
+	}
+}
@@ -0,0 +1,112 @@
+package dcs
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/gensets"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/resample"
+)
+
+func TestBuild(t *testing.T) {
+	from, to := Period(2025, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2025, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	value := func(v float64) *float64 { return &v }
+	imo := "9811000"
+
+	// 1 degree of longitude along the equator is about 60 nm; 12 knots
+	// between fixes an hour apart would be 12 nm, so speeds are reported only
+	// to count the hours underway
+	fix := func(ts time.Time, lon float64, speed float64) ports.Fix {
+		return ports.Fix{Timestamp: ts, Longitude: lon, Speed: &speed}
+	}
+	in := Inputs{
+		Vessel:  models.Vessel{IMO: &imo, Name: "Equator"},
+		Engines: []models.Engine{{EngineNo: 1, RatedPowerKW: value(8000)}, {EngineNo: 2}},
+		Fixes: []ports.Fix{
+			fix(at(1, 31, 23), 0, 12), fix(at(2, 1, 0), 0.2, 12), fix(at(2, 1, 1), 0.4, 0),
+		},
+		Tanks: [][]resample.Point{{
+			{TS: at(1, 31, 0), Value: 10000}, {TS: at(1, 31, 12), Value: 9000},
+			// Bunkering
+			{TS: at(2, 1, 0), Value: 50000}, {TS: at(2, 1, 12), Value: 49500},
+		}},
+		Generators: []gensets.Reading{{GenNo: 1, TS: at(2, 1, 0), LoadKW: value(500), FuelRateLPH: value(100)}, {GenNo: 1, TS: at(2, 1, 1), LoadKW: value(500)}},
+		NoonReports: []models.NoonReport{
+			// The year's first report is measured from this one
+			{ReportedAt: time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC), ROBFuelLiters: value(12000)},
+			{ReportedAt: at(1, 1, 12), ROBFuelLiters: value(11000), DistanceNM: value(240), AvgSpeedKnots: value(12)},
+			{ReportedAt: at(2, 1, 12), ROBFuelLiters: value(49000), DistanceNM: value(22), AvgSpeedKnots: value(11), Flagged: true},
+		},
+	}
+
+	r := Build(from, to, in, DefaultOptions)
+	if r.PeriodStart != "2025-01-01" || r.PeriodEnd != "2025-12-31" || len(r.Verification.Months) != 12 {
+		t.Fatalf("Unexpected period %s..%s, %d months", r.PeriodStart, r.PeriodEnd, len(r.Verification.Months))
+	}
+	if r.Sources != (Sources{Telemetry, Telemetry, Telemetry}) {
+		t.Errorf("Expected telemetry figures, got %+v", r.Sources)
+	}
+	if r.DistanceNM == nil || *r.DistanceNM < 23.9 || *r.DistanceNM > 24.1 {
+		t.Errorf("Expected 24 nm, got %v", r.DistanceNM)
+	}
+	// The 23:00 and 00:00 fixes are underway, an hour each
+	if r.HoursUnderway == nil || *r.HoursUnderway != 2 {
+		t.Errorf("Expected 2 hours underway, got %v", r.HoursUnderway)
+	}
+	if len(r.FuelConsumption) != 1 || r.FuelConsumption[0].Liters != 1500 || r.FuelConsumption[0].Tonnes != 1.487 ||
+		r.FuelConsumption[0].FuelType != "HFO" || *r.FuelDataMethod != MethodTankMonitoring {
+		t.Errorf("Unexpected fuel consumption %+v", r.FuelConsumption)
+	}
+	if *r.MainEnginePowerKW != 8000 {
+		t.Errorf("Expected 8000 kW, got %v", *r.MainEnginePowerKW)
+	}
+
+	v := r.Verification
+	if *v.DistanceNM.NoonReports != 262 || *v.HoursUnderway.NoonReports != 22 || *v.FuelLiters.NoonReports != 1000 {
+		t.Errorf("Unexpected noon report figures %+v %+v %+v", v.DistanceNM, v.HoursUnderway, v.FuelLiters)
+	}
+	if *v.FuelLiters.DifferencePercent != -33.3 || *v.GeneratorFuelLiters != 100 {
+		t.Errorf("Unexpected fuel verification %+v, generators %v", v.FuelLiters, *v.GeneratorFuelLiters)
+	}
+	if v.Positions != 3 || v.TankReadings != 4 || v.NoonReports != 2 || v.FlaggedNoonReports != 1 {
+		t.Errorf("Unexpected counts %+v", v)
+	}
+	jan, feb := v.Months[0], v.Months[1]
+	if jan.FuelTanksLiters != 1000 || feb.FuelTanksLiters != 500 || jan.FuelNoonReportsLiters != 1000 || feb.FuelNoonReportsLiters != 0 ||
+		jan.Positions != 1 || feb.Positions != 2 || feb.FlaggedNoonReports != 1 {
+		t.Errorf("Unexpected months %+v %+v", jan, feb)
+	}
+	if len(v.Missing) != 6 || v.Missing[0] != "gross_tonnage" {
+		t.Errorf("Unexpected missing fields %v", v.Missing)
+	}
+
+	// Noon reports only, as asked
+	opts := DefaultOptions
+	opts.Source = NoonReports
+	r = Build(from, to, in, opts)
+	if r.Sources != (Sources{NoonReports, NoonReports, NoonReports}) || *r.DistanceNM != 262 || r.FuelConsumption[0].Liters != 1000 {
+		t.Errorf("Expected the noon report figures, got %+v", r)
+	}
+
+	// Without tanks or noon reports only the generators metered fuel
+	r = Build(from, to, Inputs{Generators: in.Generators}, DefaultOptions)
+	if r.FuelDataMethod == nil || *r.FuelDataMethod != MethodFlowMeters || r.FuelConsumption[0].Liters != 100 ||
+		r.DistanceNM != nil || r.Verification.Missing[0] != "imo_number" {
+		t.Errorf("Expected flow meter figures, got %+v", r)
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	now := time.Date(2025, 8, 14, 10, 0, 0, 0, time.UTC)
+	if start, end := Period(2025, now); !start.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(now) {
+		t.Errorf("Expected the year to date, got %v..%v", start, end)
+	}
+	if _, end := Period(2024, now); !end.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the whole year, got ..%v", end)
+	}
+}
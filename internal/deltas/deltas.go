@@ -0,0 +1,73 @@
+// Package deltas computes the change of a metric between consecutive
+// readings, and its rate, such as the fuel a tank lost per hour or the
+// running hours an engine's counter gained. Jumps that are not wear or
+// consumption, like a tank filling up at bunkering, can be left out.
+package deltas
+
+import (
+	"time"
+
+	"vessel-telemetry-api/internal/resample"
+)
+
+// Reasons a Delta is suppressed.
+const (
+	Increase = "increase" // more than MaxIncrease, e.g. bunkering
+	Decrease = "decrease" // more than MaxDecrease, e.g. a counter reset
+	Gap      = "gap"      // readings more than MaxGap apart
+)
+
+// Delta is the change between two consecutive readings of a unit.
+type Delta struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Start float64   `json:"start"`
+	End   float64   `json:"end"`
+	// Delta is End - Start and Rate that per Options.Per, both nil when
+	// suppressed; Rate is also nil between readings at the same time
+	Delta      *float64 `json:"delta"`
+	Rate       *float64 `json:"rate"`
+	Suppressed string   `json:"suppressed,omitempty"`
+}
+
+// Options tune the deltas. Unset limits suppress nothing.
+type Options struct {
+	Per         time.Duration // what rates are per, one hour if zero
+	MaxIncrease *float64
+	MaxDecrease *float64 // a positive amount
+	MaxGap      time.Duration
+}
+
+// Compute returns the deltas between consecutive points, oldest first, and
+// the total of those not suppressed.
+func Compute(points []resample.Point, opts Options) ([]Delta, float64) {
+	per := opts.Per
+	if per <= 0 {
+		per = time.Hour
+	}
+	deltas := make([]Delta, 0, len(points))
+	total := 0.0
+	for i := 1; i < len(points); i++ {
+		prev, p := points[i-1], points[i]
+		d := Delta{From: prev.TS, To: p.TS, Start: prev.Value, End: p.Value}
+		change := p.Value - prev.Value
+		elapsed := p.TS.Sub(prev.TS)
+		switch {
+		case opts.MaxGap > 0 && elapsed > opts.MaxGap:
+			d.Suppressed = Gap
+		case opts.MaxIncrease != nil && change > *opts.MaxIncrease:
+			d.Suppressed = Increase
+		case opts.MaxDecrease != nil && -change > *opts.MaxDecrease:
+			d.Suppressed = Decrease
+		default:
+			d.Delta = &change
+			total += change
+			if elapsed > 0 {
+				rate := change * float64(per) / float64(elapsed)
+				d.Rate = &rate
+			}
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas, total
+}
@@ -0,0 +1,54 @@
+package deltas
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/resample"
+)
+
+func TestCompute(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2025, 8, 8, hour, minute, 0, 0, time.UTC) }
+	points := []resample.Point{
+		{TS: at(0, 0), Value: 1000},
+		{TS: at(0, 30), Value: 950},  // -50 in half an hour
+		{TS: at(2, 30), Value: 850},  // -100 in two hours
+		{TS: at(3, 0), Value: 5850},  // bunkering
+		{TS: at(3, 0), Value: 5840},  // same time
+		{TS: at(12, 0), Value: 5000}, // after an outage
+	}
+	bunkering := 500.0
+	deltas, total := Compute(points, Options{MaxIncrease: &bunkering, MaxGap: 6 * time.Hour})
+	if len(deltas) != 5 {
+		t.Fatalf("Expected 5 deltas, got %+v", deltas)
+	}
+	if d := deltas[0]; *d.Delta != -50 || *d.Rate != -100 || d.Suppressed != "" {
+		t.Errorf("Expected -50 at -100 per hour, got %+v", d)
+	}
+	if d := deltas[1]; *d.Delta != -100 || *d.Rate != -50 {
+		t.Errorf("Expected -100 at -50 per hour, got %+v", d)
+	}
+	if d := deltas[2]; d.Suppressed != Increase || d.Delta != nil || d.Rate != nil || d.Start != 850 || d.End != 5850 {
+		t.Errorf("Expected the bunkering to be suppressed, got %+v", d)
+	}
+	if d := deltas[3]; *d.Delta != -10 || d.Rate != nil {
+		t.Errorf("Expected no rate between readings at the same time, got %+v", d)
+	}
+	if d := deltas[4]; d.Suppressed != Gap {
+		t.Errorf("Expected the outage to be suppressed, got %+v", d)
+	}
+	if total != -160 {
+		t.Errorf("Expected a total of -160, got %v", total)
+	}
+
+	// Rates per day, and a drop beyond MaxDecrease
+	drop := 80.0
+	deltas, total = Compute(points[:3], Options{Per: 24 * time.Hour, MaxDecrease: &drop})
+	if *deltas[0].Rate != -2400 || deltas[1].Suppressed != Decrease || total != -50 {
+		t.Errorf("Unexpected deltas %+v, total %v", deltas, total)
+	}
+
+	if deltas, total := Compute(points[:1], Options{}); len(deltas) != 0 || total != 0 {
+		t.Errorf("Expected no deltas from one reading, got %+v", deltas)
+	}
+}
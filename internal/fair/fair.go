@@ -0,0 +1,272 @@
+// Package fair shares a fixed number of work slots (concurrent ingests,
+// concurrent heavy queries) between tenants.
+//
+// Each tenant may hold at most Limits.PerTenant slots and queue at most
+// Limits.QueuePerTenant requests. When a slot frees up it goes to the waiting
+// tenant with the fewest slots in use, then the one served least recently,
+// rather than to the oldest request, so one tenant's 500-file backfill waits
+// behind everyone else's real-time uploads instead of in front of them.
+package fair
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when the tenant already has QueuePerTenant
+	// requests waiting.
+	ErrQueueFull = errors.New("too many queued requests for this tenant")
+	// ErrWaitTimeout is returned when no slot became free within MaxWait.
+	ErrWaitTimeout = errors.New("timed out waiting for a free slot")
+)
+
+// Limits configures one scheduler. Slots <= 0 disables scheduling.
+type Limits struct {
+	Slots          int           // concurrent requests across all tenants
+	PerTenant      int           // concurrent requests per tenant; 0 means Slots
+	QueuePerTenant int           // waiting requests per tenant; 0 means unlimited
+	MaxWait        time.Duration // 0 means wait as long as the request lives
+}
+
+// Status is a snapshot of a scheduler for metrics.
+type Status struct {
+	Name     string
+	InFlight int
+	Queued   int
+	Tenants  int   // tenants with requests in flight or queued
+	Rejected int64 // requests refused with ErrQueueFull or ErrWaitTimeout
+}
+
+type waiter struct {
+	seq     uint64
+	ready   chan struct{} // closed when the slot is granted
+	granted bool
+}
+
+// Scheduler hands out slots fairly between tenants.
+type Scheduler struct {
+	name   string
+	limits Limits
+
+	mu       sync.Mutex
+	inFlight int
+	running  map[string]int       // slots held per tenant
+	queues   map[string][]*waiter // waiting requests per tenant
+	served   map[string]uint64    // seq of each active tenant's latest grant
+	seq      uint64
+	rejected int64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*Scheduler{}
+)
+
+// New creates a scheduler and registers it for Statuses, replacing any
+// earlier one with the same name.
+func New(name string, limits Limits) *Scheduler {
+	if limits.PerTenant <= 0 || limits.PerTenant > limits.Slots {
+		limits.PerTenant = limits.Slots
+	}
+	s := &Scheduler{
+		name:    name,
+		limits:  limits,
+		running: make(map[string]int),
+		queues:  make(map[string][]*waiter),
+		served:  make(map[string]uint64),
+	}
+	registryMu.Lock()
+	registry[name] = s
+	registryMu.Unlock()
+	return s
+}
+
+// Statuses returns every registered scheduler, ordered by name.
+func Statuses() []Status {
+	registryMu.Lock()
+	schedulers := make([]*Scheduler, 0, len(registry))
+	for _, s := range registry {
+		schedulers = append(schedulers, s)
+	}
+	registryMu.Unlock()
+
+	statuses := make([]Status, len(schedulers))
+	for n, s := range schedulers {
+		statuses[n] = s.Status()
+	}
+	sort.Slice(statuses, func(a, b int) bool { return statuses[a].Name < statuses[b].Name })
+	return statuses
+}
+
+// Status returns the scheduler's current load.
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Status{Name: s.name, InFlight: s.inFlight, Rejected: s.rejected}
+	tenants := make(map[string]bool)
+	for tenant := range s.running {
+		tenants[tenant] = true
+	}
+	for tenant, q := range s.queues {
+		st.Queued += len(q)
+		tenants[tenant] = true
+	}
+	st.Tenants = len(tenants)
+	return st
+}
+
+// Acquire waits for a slot for tenant. The returned release must be called
+// exactly once when the work is done.
+func (s *Scheduler) Acquire(ctx context.Context, tenant string) (release func(), err error) {
+	if s.limits.Slots <= 0 {
+		return func() {}, nil
+	}
+
+	s.mu.Lock()
+	if s.canRun(tenant) && len(s.queues[tenant]) == 0 {
+		s.start(tenant)
+		s.mu.Unlock()
+		return s.releaser(tenant), nil
+	}
+	if s.limits.QueuePerTenant > 0 && len(s.queues[tenant]) >= s.limits.QueuePerTenant {
+		s.rejected++
+		s.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	s.seq++
+	w := &waiter{seq: s.seq, ready: make(chan struct{})}
+	s.queues[tenant] = append(s.queues[tenant], w)
+	s.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if s.limits.MaxWait > 0 {
+		t := time.NewTimer(s.limits.MaxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-w.ready:
+		return s.releaser(tenant), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrWaitTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.granted {
+		// The slot arrived just as we gave up; pass it on
+		s.finish(tenant)
+	} else {
+		s.remove(tenant, w)
+	}
+	if err == ErrWaitTimeout {
+		s.rejected++
+	}
+	return nil, err
+}
+
+func (s *Scheduler) releaser(tenant string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.finish(tenant)
+		})
+	}
+}
+
+// canRun reports whether tenant may take a free slot. Callers hold mu.
+func (s *Scheduler) canRun(tenant string) bool {
+	return s.inFlight < s.limits.Slots && s.running[tenant] < s.limits.PerTenant
+}
+
+func (s *Scheduler) start(tenant string) {
+	s.seq++
+	s.inFlight++
+	s.running[tenant]++
+	s.served[tenant] = s.seq
+}
+
+// finish frees tenant's slot and hands free slots to waiting tenants.
+// Callers hold mu.
+func (s *Scheduler) finish(tenant string) {
+	s.inFlight--
+	if s.running[tenant]--; s.running[tenant] == 0 {
+		delete(s.running, tenant)
+	}
+	s.forget(tenant)
+
+	for s.inFlight < s.limits.Slots {
+		next, ok := s.pick()
+		if !ok {
+			return
+		}
+
+		w := s.queues[next][0]
+		if s.queues[next] = s.queues[next][1:]; len(s.queues[next]) == 0 {
+			delete(s.queues, next)
+		}
+		s.start(next)
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// pick returns the waiting tenant to serve next: fewest slots in use, then
+// least recently served, then longest waiting. Callers hold mu.
+func (s *Scheduler) pick() (string, bool) {
+	best, found := "", false
+	for tenant, q := range s.queues {
+		if !s.canRun(tenant) {
+			continue
+		}
+		if !found || s.before(tenant, q[0], best, s.queues[best][0]) {
+			best, found = tenant, true
+		}
+	}
+	return best, found
+}
+
+func (s *Scheduler) before(a string, wa *waiter, b string, wb *waiter) bool {
+	if s.running[a] != s.running[b] {
+		return s.running[a] < s.running[b]
+	}
+	if s.served[a] != s.served[b] {
+		return s.served[a] < s.served[b]
+	}
+	return wa.seq < wb.seq
+}
+
+// forget drops the bookkeeping of a tenant with nothing running or queued,
+// so served doesn't grow with every tenant ever seen. Callers hold mu.
+func (s *Scheduler) forget(tenant string) {
+	if s.running[tenant] == 0 && len(s.queues[tenant]) == 0 {
+		delete(s.served, tenant)
+	}
+}
+
+// remove drops a waiter that gave up. Callers hold mu.
+func (s *Scheduler) remove(tenant string, w *waiter) {
+	q := s.queues[tenant]
+	for i, other := range q {
+		if other == w {
+			q = append(q[:i], q[i+1:]...)
+			break
+		}
+	}
+	if len(q) > 0 {
+		s.queues[tenant] = q
+	} else {
+		delete(s.queues, tenant)
+	}
+	s.forget(tenant)
+}
@@ -0,0 +1,172 @@
+package fair
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// acquireAsync starts an Acquire and reports its release on the channel.
+func acquireAsync(s *Scheduler, tenant string) <-chan func() {
+	ch := make(chan func(), 1)
+	go func() {
+		release, err := s.Acquire(context.Background(), tenant)
+		if err != nil {
+			close(ch)
+			return
+		}
+		ch <- release
+	}()
+	return ch
+}
+
+// waitQueued waits until the scheduler has n requests queued.
+func waitQueued(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for s.Status().Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d queued, got %+v", n, s.Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func granted(ch <-chan func()) (func(), bool) {
+	select {
+	case release, ok := <-ch:
+		return release, ok
+	case <-time.After(50 * time.Millisecond):
+		return nil, false
+	}
+}
+
+func TestBackfillDoesNotStarveOthers(t *testing.T) {
+	s := New("test-fairness", Limits{Slots: 1})
+
+	release, err := s.Acquire(context.Background(), "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var backfill []<-chan func()
+	for i := 0; i < 3; i++ {
+		backfill = append(backfill, acquireAsync(s, "backfill"))
+		waitQueued(t, s, i+1)
+	}
+	realtime := acquireAsync(s, "realtime")
+	waitQueued(t, s, 4)
+
+	release()
+	next, ok := granted(realtime)
+	if !ok {
+		t.Fatal("Expected the other tenant to get the freed slot before the backfill")
+	}
+	for _, ch := range backfill {
+		if _, ok := granted(ch); ok {
+			t.Fatal("Expected the backfill to wait while the slot is in use")
+		}
+	}
+
+	next()
+	for i, ch := range backfill {
+		release, ok := granted(ch)
+		if !ok {
+			t.Fatalf("Expected backfill request %d to run", i)
+		}
+		release()
+	}
+
+	if st := s.Status(); st.InFlight != 0 || st.Queued != 0 || st.Tenants != 0 {
+		t.Errorf("Expected an idle scheduler, got %+v", st)
+	}
+}
+
+func TestPerTenantLimit(t *testing.T) {
+	s := New("test-per-tenant", Limits{Slots: 3, PerTenant: 2})
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Acquire(context.Background(), "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	third := acquireAsync(s, "a")
+	waitQueued(t, s, 1)
+	if _, ok := granted(third); ok {
+		t.Fatal("Expected a third request from the same tenant to wait")
+	}
+
+	if _, err := s.Acquire(context.Background(), "b"); err != nil {
+		t.Fatalf("Expected another tenant to use the free slot, got %v", err)
+	}
+	if st := s.Status(); st.InFlight != 3 || st.Queued != 1 || st.Tenants != 2 {
+		t.Errorf("Unexpected status %+v", st)
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	s := New("test-queue", Limits{Slots: 1, QueuePerTenant: 1, MaxWait: 20 * time.Millisecond})
+
+	release, err := s.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	queued := make(chan error, 1)
+	go func() {
+		_, err := s.Acquire(context.Background(), "a")
+		queued <- err
+	}()
+	waitQueued(t, s, 1)
+
+	if _, err := s.Acquire(context.Background(), "a"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	if err := <-queued; !errors.Is(err, ErrWaitTimeout) {
+		t.Errorf("Expected ErrWaitTimeout, got %v", err)
+	}
+	if st := s.Status(); st.Queued != 0 || st.Rejected != 2 {
+		t.Errorf("Expected both requests rejected and nothing queued, got %+v", st)
+	}
+}
+
+func TestCancelledWaiter(t *testing.T) {
+	s := New("test-cancel", Limits{Slots: 1})
+
+	release, err := s.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Acquire(ctx, "b")
+		done <- err
+	}()
+	waitQueued(t, s, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	release()
+	release() // a second call is a no-op
+	if st := s.Status(); st.InFlight != 0 || st.Queued != 0 {
+		t.Errorf("Expected an idle scheduler, got %+v", st)
+	}
+	if _, err := s.Acquire(context.Background(), "c"); err != nil {
+		t.Errorf("Expected the slot to be free, got %v", err)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	s := New("test-disabled", Limits{})
+	for i := 0; i < 10; i++ {
+		if _, err := s.Acquire(context.Background(), "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
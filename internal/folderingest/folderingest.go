@@ -0,0 +1,298 @@
+// Package folderingest ingests telemetry files copied into a local drop
+// folder, for shipboard installs where the monitoring PC can only write to
+// a shared folder.
+//
+// The folder is watched for changes, and also scanned every so often since
+// network shares do not always report them. A file is ingested once it has
+// not changed for a while, so files still being copied are left alone, then
+// moved to the archive folder, or to the failed folder next to a text file
+// saying why.
+package folderingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+)
+
+// maxFileSize bounds the files read.
+const maxFileSize = 256 << 20
+
+// Default folders, relative to the drop folder.
+const (
+	DefaultArchiveDir = "processed"
+	DefaultFailedDir  = "failed"
+)
+
+// Config says which folder to watch and how.
+type Config struct {
+	Dir string
+	// ArchiveDir and FailedDir receive the files ingested and those that
+	// failed; absolute, or relative to Dir.
+	ArchiveDir string
+	FailedDir  string
+	// IMO is the vessel files belong to unless they are in a folder named
+	// by an IMO number, e.g. 9811000/day1.xlsx; if empty, the vessel the
+	// workbook names.
+	IMO string
+	// Source tags the readings; sensor if empty.
+	Source string
+	// Settle is how long a file must be unchanged to be ingested.
+	Settle time.Duration
+	// Rescan is how often the whole folder is scanned; 0 relies on the
+	// changes reported alone.
+	Rescan time.Duration
+}
+
+// Processor ingests the files collected.
+type Processor interface {
+	ProcessDropped(ctx context.Context, data []byte, filename, imo, vesselName, source string) (ingest.DroppedResult, error)
+}
+
+// Watcher ingests the files copied into a folder.
+type Watcher struct {
+	processor Processor
+	cfg       Config
+}
+
+// NewWatcher creates a watcher of cfg.Dir, creating its archive and failed
+// folders.
+func NewWatcher(processor Processor, cfg Config) (*Watcher, error) {
+	fi, err := os.Stat(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", cfg.Dir)
+	}
+	if cfg.ArchiveDir == "" {
+		cfg.ArchiveDir = DefaultArchiveDir
+	}
+	if cfg.FailedDir == "" {
+		cfg.FailedDir = DefaultFailedDir
+	}
+	for _, dir := range []*string{&cfg.ArchiveDir, &cfg.FailedDir} {
+		if !filepath.IsAbs(*dir) {
+			*dir = filepath.Join(cfg.Dir, *dir)
+		}
+		if err := os.MkdirAll(*dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Source == "" {
+		cfg.Source = models.SourceSensor
+	}
+	return &Watcher{processor: processor, cfg: cfg}, nil
+}
+
+// Run watches the folder until ctx is cancelled. If the folder cannot be
+// watched, it is only scanned every cfg.Rescan.
+func (w *Watcher) Run(ctx context.Context) {
+	events := make(<-chan fsnotify.Event)
+	errs := make(<-chan error)
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("folder %s: watching: %v; scanning every %s only", w.cfg.Dir, err, w.cfg.Rescan)
+	} else {
+		defer fw.Close()
+		events, errs = fw.Events, fw.Errors
+	}
+	watched := map[string]bool{}
+	watch := func() {
+		if fw == nil {
+			return
+		}
+		for _, dir := range w.dirs() {
+			if watched[dir] {
+				continue
+			}
+			if err := fw.Add(dir); err != nil {
+				log.Printf("folder %s: watching %s: %v", w.cfg.Dir, dir, err)
+				continue
+			}
+			watched[dir] = true
+		}
+	}
+
+	var rescan <-chan time.Time
+	if w.cfg.Rescan > 0 {
+		ticker := time.NewTicker(w.cfg.Rescan)
+		defer ticker.Stop()
+		rescan = ticker.C
+	}
+	// Changed files are checked again once they may have settled
+	var settled <-chan time.Time
+
+	for {
+		watch()
+		settled = nil
+		if w.PollOnce(ctx) {
+			settled = time.After(w.cfg.Settle)
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-rescan:
+				break wait
+			case <-settled:
+				break wait
+			case err := <-errs:
+				log.Printf("folder %s: watching: %v", w.cfg.Dir, err)
+			case event := <-events:
+				// Rather than scan on every write, wait for the copy
+				// to finish
+				if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+					settled = time.After(w.cfg.Settle)
+				}
+			}
+		}
+	}
+}
+
+// dirs returns the folders files are picked up from: the drop folder and
+// its IMO-named subfolders.
+func (w *Watcher) dirs() []string {
+	dirs := []string{w.cfg.Dir}
+	entries, _ := os.ReadDir(w.cfg.Dir)
+	for _, e := range entries {
+		if e.IsDir() && isIMO(e.Name()) {
+			dirs = append(dirs, filepath.Join(w.cfg.Dir, e.Name()))
+		}
+	}
+	return dirs
+}
+
+// file is a file found in the drop folder.
+type file struct {
+	path    string
+	imo     string
+	modTime time.Time
+	size    int64
+}
+
+// PollOnce ingests the files of the folder that have settled, oldest
+// first, and reports whether others are still changing.
+func (w *Watcher) PollOnce(ctx context.Context) (unsettled bool) {
+	var files []file
+	now := time.Now()
+	for _, dir := range w.dirs() {
+		imo := w.cfg.IMO
+		if dir != w.cfg.Dir {
+			imo = filepath.Base(dir)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Printf("folder %s: %v", w.cfg.Dir, err)
+			continue
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || !ingest.IsDroppedFile(e.Name()) {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				continue // removed meanwhile
+			}
+			if now.Sub(fi.ModTime()) < w.cfg.Settle {
+				unsettled = true
+				continue
+			}
+			files = append(files, file{path: filepath.Join(dir, e.Name()), imo: imo, modTime: fi.ModTime(), size: fi.Size()})
+		}
+	}
+
+	// Oldest first, so readings arrive in the order they were sent
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return false
+		}
+		w.ingest(ctx, f, now)
+	}
+	return unsettled
+}
+
+// ingest ingests one file and moves it out of the drop folder.
+func (w *Watcher) ingest(ctx context.Context, f file, now time.Time) {
+	rel, _ := filepath.Rel(w.cfg.Dir, f.path)
+	status, err := w.process(ctx, f)
+	if errors.Is(err, ingest.ErrQuotaExceeded) {
+		// The file is fine; it is tried again next scan
+		log.Printf("folder %s: %s: %v", w.cfg.Dir, rel, err)
+		return
+	}
+	if err != nil {
+		log.Printf("folder %s: %s: %v", w.cfg.Dir, rel, err)
+		target, moveErr := move(f.path, w.cfg.FailedDir, now)
+		if moveErr != nil {
+			log.Printf("folder %s: %s: moving to %s: %v", w.cfg.Dir, rel, w.cfg.FailedDir, moveErr)
+			return
+		}
+		if err := os.WriteFile(target+".error.txt", []byte(err.Error()+"\n"), 0o644); err != nil {
+			log.Printf("folder %s: %s: %v", w.cfg.Dir, rel, err)
+		}
+		return
+	}
+	log.Printf("folder %s: %s: %s", w.cfg.Dir, rel, status)
+	if _, err := move(f.path, w.cfg.ArchiveDir, now); err != nil {
+		// Left in place it would be read again each scan, but never
+		// ingested twice
+		log.Printf("folder %s: %s: moving to %s: %v", w.cfg.Dir, rel, w.cfg.ArchiveDir, err)
+	}
+}
+
+func (w *Watcher) process(ctx context.Context, f file) (string, error) {
+	if f.size > maxFileSize {
+		return "", fmt.Errorf("file exceeds %d MB", maxFileSize>>20)
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	result, err := w.processor.ProcessDropped(ctx, data, filepath.Base(f.path), f.imo, "", w.cfg.Source)
+	if err != nil {
+		return "", err
+	}
+	if result.Status == "failed" {
+		return "", errors.New("no file of the archive could be ingested")
+	}
+	return result.Status, nil
+}
+
+// move moves a file into dir, adding a timestamp to its name if dir
+// already has a file of that name, and returns where it went.
+func move(file, dir string, now time.Time) (string, error) {
+	target := filepath.Join(dir, filepath.Base(file))
+	if _, err := os.Lstat(target); err == nil {
+		ext := filepath.Ext(target)
+		target = strings.TrimSuffix(target, ext) + now.UTC().Format(".20060102T150405Z") + ext
+	}
+	return target, os.Rename(file, target)
+}
+
+// isIMO reports whether a folder name is an IMO number.
+func isIMO(name string) bool {
+	if len(name) != 7 {
+		return false
+	}
+	for _, r := range name {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
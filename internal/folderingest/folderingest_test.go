@@ -0,0 +1,143 @@
+package folderingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+)
+
+type fakeProcessor struct {
+	mu       sync.Mutex
+	ingested []string // filename@imo
+}
+
+func (p *fakeProcessor) ProcessDropped(ctx context.Context, data []byte, filename, imo, vesselName, source string) (ingest.DroppedResult, error) {
+	switch string(data) {
+	case "broken":
+		return ingest.DroppedResult{}, ingest.ErrUnsupportedFormat
+	case "over quota":
+		return ingest.DroppedResult{}, ingest.ErrQuotaExceeded
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ingested = append(p.ingested, filename+"@"+imo)
+	return ingest.DroppedResult{Status: "ingested"}, nil
+}
+
+func (p *fakeProcessor) files() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.ingested...)
+}
+
+func writeFile(t *testing.T, name, data string, age time.Duration) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func TestPollOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "day2.xlsx"), "ok", time.Hour)
+	writeFile(t, filepath.Join(dir, "day1.xlsx"), "ok", 2*time.Hour)
+	writeFile(t, filepath.Join(dir, "9822000", "week.zip"), "ok", time.Hour)
+	writeFile(t, filepath.Join(dir, "copying.xlsx"), "ok", 0)
+	writeFile(t, filepath.Join(dir, "broken.xlsx"), "broken", time.Hour)
+	writeFile(t, filepath.Join(dir, "quota.xlsx"), "over quota", time.Hour)
+	writeFile(t, filepath.Join(dir, "notes.txt"), "ok", time.Hour)
+	writeFile(t, filepath.Join(dir, "~$day1.xlsx"), "ok", time.Hour)
+	writeFile(t, filepath.Join(dir, "other", "day3.xlsx"), "ok", time.Hour)
+	// Already archived once
+	writeFile(t, filepath.Join(dir, "processed", "day2.xlsx"), "ok", time.Hour)
+
+	processor := &fakeProcessor{}
+	w, err := NewWatcher(processor, Config{Dir: dir, IMO: "9811000", Settle: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unsettled := w.PollOnce(context.Background()); !unsettled {
+		t.Error("Expected the file being copied to be reported")
+	}
+
+	got := strings.Join(processor.files(), " ")
+	if got != "day1.xlsx@9811000 day2.xlsx@9811000 week.zip@9822000" {
+		t.Errorf("Unexpected files ingested: %s", got)
+	}
+	for _, name := range []string{"copying.xlsx", "quota.xlsx", "notes.txt", "~$day1.xlsx", "other/day3.xlsx", "processed/day1.xlsx", "processed/week.zip", "failed/broken.xlsx"} {
+		if !exists(filepath.Join(dir, name)) {
+			t.Errorf("Expected %s to exist", name)
+		}
+	}
+	for _, name := range []string{"day1.xlsx", "day2.xlsx", "broken.xlsx", "9822000/week.zip"} {
+		if exists(filepath.Join(dir, name)) {
+			t.Errorf("Expected %s to have been moved", name)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "processed", "day2.*.xlsx")); len(matches) != 1 {
+		t.Errorf("Expected the second day2.xlsx to be archived under a new name, got %v", matches)
+	}
+	reason, err := os.ReadFile(filepath.Join(dir, "failed", "broken.xlsx.error.txt"))
+	if err != nil || !strings.Contains(string(reason), ingest.ErrUnsupportedFormat.Error()) {
+		t.Errorf("Unexpected failure note %q (%v)", reason, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	processor := &fakeProcessor{}
+	w, err := NewWatcher(processor, Config{Dir: dir, Settle: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Without a rescan, only the change reported picks the file up
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(dir, "day1.xlsx"), []byte("ok"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !exists(filepath.Join(dir, "processed", "day1.xlsx")) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the file to be ingested, got %v", processor.files())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := processor.files(); len(got) != 1 || got[0] != "day1.xlsx@" {
+		t.Errorf("Unexpected files ingested: %v", got)
+	}
+}
+
+func TestNewWatcher(t *testing.T) {
+	if _, err := NewWatcher(&fakeProcessor{}, Config{Dir: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("Expected a missing folder to be refused")
+	}
+}
@@ -0,0 +1,137 @@
+// Package fueldrop detects fuel tank volumes falling faster than consumption
+// explains while the engines are off or the vessel is not moving, which
+// points at fuel theft or a faulty sensor.
+package fueldrop
+
+import (
+	"sort"
+	"time"
+)
+
+// Level is a tank volume reading.
+type Level struct {
+	TankNo *int
+	TS     time.Time
+	Liters float64
+}
+
+// Sample is a timestamped value: an engine's rpm or the vessel's speed.
+type Sample struct {
+	TS    time.Time
+	Value float64
+}
+
+// Options tune the detection. A zero MinDropLiters disables it.
+type Options struct {
+	MinDropLiters    float64       // total drop of an alert
+	MinRateLPH       float64       // drop rate between two readings to count as abnormal
+	EngineRunningRPM float64       // engines at or below it are off
+	StationaryKnots  float64       // speeds at or below it mean the vessel is not moving
+	Window           time.Duration // how far before a drop engine and speed readings count
+}
+
+// DefaultOptions flag drops of 500 L or more at 250 L/h or faster.
+var DefaultOptions = Options{
+	MinDropLiters:    500,
+	MinRateLPH:       250,
+	EngineRunningRPM: 10,
+	StationaryKnots:  0.5,
+	Window:           time.Hour,
+}
+
+// Alert is a run of abnormal drops of one tank.
+type Alert struct {
+	TankNo      *int      `json:"tank_no"`
+	Start       time.Time `json:"start_ts"`
+	End         time.Time `json:"end_ts"`
+	StartLiters float64   `json:"start_liters"`
+	EndLiters   float64   `json:"end_liters"`
+	DropLiters  float64   `json:"drop_liters"`
+	RateLPH     float64   `json:"rate_lph"`
+	EnginesOff  bool      `json:"engines_off"`
+	Stationary  bool      `json:"stationary"`
+}
+
+// Reason names why the drop is suspicious.
+func (a Alert) Reason() string {
+	switch {
+	case a.EnginesOff && a.Stationary:
+		return "engines_off_stationary"
+	case a.EnginesOff:
+		return "engines_off"
+	default:
+		return "stationary"
+	}
+}
+
+// allAtMost reports whether samples (sorted by time) hold values between
+// from and to, all of them at most max.
+func allAtMost(samples []Sample, from, to time.Time, max float64) bool {
+	i := sort.Search(len(samples), func(i int) bool { return !samples[i].TS.Before(from) })
+	known := false
+	for ; i < len(samples) && !samples[i].TS.After(to); i++ {
+		if samples[i].Value > max {
+			return false
+		}
+		known = true
+	}
+	return known
+}
+
+func sameTank(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Detect finds runs of abnormal drops. Levels must be sorted by tank, then
+// time; engines (all engines' rpm) and speeds by time. Without engine or
+// speed readings around a drop, that condition is taken as not met.
+func Detect(levels []Level, engines, speeds []Sample, opts Options) []Alert {
+	if opts.MinDropLiters <= 0 {
+		return nil
+	}
+
+	var alerts []Alert
+	var run *Alert
+	closeRun := func() {
+		if run != nil && run.DropLiters >= opts.MinDropLiters {
+			if hours := run.End.Sub(run.Start).Hours(); hours > 0 {
+				run.RateLPH = run.DropLiters / hours
+			}
+			alerts = append(alerts, *run)
+		}
+		run = nil
+	}
+
+	for i := 1; i < len(levels); i++ {
+		a, b := levels[i-1], levels[i]
+		if !sameTank(a.TankNo, b.TankNo) {
+			closeRun()
+			continue
+		}
+		drop, hours := a.Liters-b.Liters, b.TS.Sub(a.TS).Hours()
+		if drop <= 0 || hours <= 0 || drop/hours < opts.MinRateLPH {
+			closeRun()
+			continue
+		}
+		enginesOff := allAtMost(engines, a.TS.Add(-opts.Window), b.TS, opts.EngineRunningRPM)
+		stationary := allAtMost(speeds, a.TS.Add(-opts.Window), b.TS, opts.StationaryKnots)
+		if !enginesOff && !stationary {
+			closeRun()
+			continue
+		}
+
+		if run == nil || !run.End.Equal(a.TS) {
+			closeRun()
+			run = &Alert{TankNo: a.TankNo, Start: a.TS, StartLiters: a.Liters}
+		}
+		run.End, run.EndLiters = b.TS, b.Liters
+		run.DropLiters = run.StartLiters - run.EndLiters
+		run.EnginesOff = run.EnginesOff || enginesOff
+		run.Stationary = run.Stationary || stationary
+	}
+	closeRun()
+	return alerts
+}
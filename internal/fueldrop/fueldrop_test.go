@@ -0,0 +1,48 @@
+package fueldrop
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetect(t *testing.T) {
+	t0 := time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)
+	at := func(h float64) time.Time { return t0.Add(time.Duration(h * float64(time.Hour))) }
+	tank1, tank2 := 1, 2
+
+	levels := []Level{
+		// Tank 1 loses 1200 L in two hours at anchor with the engines off
+		{&tank1, at(0), 10000}, {&tank1, at(1), 9400}, {&tank1, at(2), 8800},
+		// then burns slowly, then fast again while under way
+		{&tank1, at(3), 8750}, {&tank1, at(12), 8000}, {&tank1, at(13), 7000},
+		// Tank 2 drops fast but only 300 L
+		{&tank2, at(0), 5000}, {&tank2, at(0.5), 4700},
+	}
+	engines := []Sample{{at(-0.5), 0}, {at(1.5), 0}, {at(12), 600}}
+	speeds := []Sample{{at(0), 0.1}, {at(12.5), 14}}
+
+	alerts := Detect(levels, engines, speeds, DefaultOptions)
+	if len(alerts) != 1 {
+		t.Fatalf("Expected one alert, got %+v", alerts)
+	}
+	a := alerts[0]
+	if *a.TankNo != 1 || !a.Start.Equal(at(0)) || !a.End.Equal(at(2)) || a.DropLiters != 1200 || a.RateLPH != 600 {
+		t.Errorf("Unexpected alert %+v", a)
+	}
+	if !a.EnginesOff || !a.Stationary || a.Reason() != "engines_off_stationary" {
+		t.Errorf("Expected engines off and stationary, got %+v", a)
+	}
+
+	// Without engine or speed readings nothing is suspicious
+	if alerts := Detect(levels, nil, nil, DefaultOptions); len(alerts) != 0 {
+		t.Errorf("Expected no alerts without context, got %+v", alerts)
+	}
+	// Engines running but not moving still counts
+	running := []Sample{{at(0), 500}, {at(2), 500}}
+	if alerts := Detect(levels[:3], running, speeds, DefaultOptions); len(alerts) != 1 || alerts[0].Reason() != "stationary" {
+		t.Errorf("Expected a stationary alert, got %+v", alerts)
+	}
+	if alerts := Detect(levels, engines, speeds, Options{}); alerts != nil {
+		t.Errorf("Expected detection to be off, got %+v", alerts)
+	}
+}
@@ -0,0 +1,247 @@
+// Package gensets reports how a vessel's generators share the electrical
+// load: running hours, load, imbalance between gensets running in parallel
+// and specific fuel consumption.
+//
+// Fuel rates can carry an uncertainty estimate (e.g. ±5% when derived from
+// tank soundings). Errors are taken as fully correlated, so the ± of fuel
+// totals is the sum of the readings' absolute uncertainties, an upper bound;
+// readings without an estimate count as exact.
+package gensets
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Reading is one generator reading.
+type Reading struct {
+	GenNo       int
+	TS          time.Time
+	LoadKW      *float64
+	FuelRateLPH *float64
+	// FuelRateUncertaintyPercent is the ± of FuelRateLPH, nil if exact.
+	FuelRateUncertaintyPercent *float64
+}
+
+// Options tune the report.
+type Options struct {
+	// MinLoadKW is the load above which a generator counts as running.
+	MinLoadKW float64
+	// MaxGap caps the time a reading stands for. A reading covers the time
+	// until the generator's next reading, so a logging outage does not count
+	// as hours at the last known load.
+	MaxGap time.Duration
+}
+
+// Generator is the report of one generator.
+type Generator struct {
+	GenNo        int        `json:"gen_no"`
+	Readings     int        `json:"readings"`
+	RunningHours float64    `json:"running_hours"`
+	AvgLoadKW    *float64   `json:"avg_load_kw"` // while running, time-weighted
+	PeakLoadKW   *float64   `json:"peak_load_kw"`
+	PeakAt       *time.Time `json:"peak_at"`
+	EnergyKWh    float64    `json:"energy_kwh"`
+	FuelLiters   float64    `json:"fuel_liters"` // while running, from readings with a fuel rate
+	// SFCLPerKWh is the specific fuel consumption, fuel over energy for the
+	// running time with both load and fuel rate recorded.
+	SFCLPerKWh *float64 `json:"sfc_l_per_kwh"`
+	// FuelLitersUncertainty and SFCUncertainty are the ± of FuelLiters and
+	// SFCLPerKWh, nil if no fuel rate had an estimate.
+	FuelLitersUncertainty *float64 `json:"fuel_liters_uncertainty"`
+	SFCUncertainty        *float64 `json:"sfc_uncertainty"`
+	// ParallelSharePercent is the generator's average share of the load
+	// while running in parallel with others.
+	ParallelSharePercent *float64 `json:"parallel_share_percent"`
+
+	sfcFuel, sfcEnergy float64 // over readings with both load and fuel rate
+	fuel               uncertainty
+	shareSum           float64
+	shareSamples       int
+}
+
+// Parallel summarizes the times two or more generators ran together.
+type Parallel struct {
+	Samples int     `json:"samples"`
+	Hours   float64 `json:"hours"`
+	// Imbalance is the largest deviation of a generator's load from the mean
+	// of the running generators, as a percentage of that mean.
+	AvgImbalancePercent *float64   `json:"avg_imbalance_percent"`
+	MaxImbalancePercent *float64   `json:"max_imbalance_percent"`
+	MaxImbalanceAt      *time.Time `json:"max_imbalance_at"`
+}
+
+// Report is the load-sharing report of a vessel.
+type Report struct {
+	Generators []Generator `json:"generators"`
+	Parallel   Parallel    `json:"parallel"`
+	EnergyKWh  float64     `json:"energy_kwh"`
+	FuelLiters float64     `json:"fuel_liters"`
+	SFCLPerKWh *float64    `json:"sfc_l_per_kwh"`
+	// FuelLitersUncertainty and SFCUncertainty are the ± of the totals.
+	FuelLitersUncertainty *float64 `json:"fuel_liters_uncertainty"`
+	SFCUncertainty        *float64 `json:"sfc_uncertainty"`
+}
+
+// uncertainty adds up absolute uncertainties, remembering whether any
+// reading had an estimate.
+type uncertainty struct {
+	sum       float64
+	estimated bool
+}
+
+func (u *uncertainty) add(value float64, percent *float64) {
+	if percent != nil {
+		u.sum += math.Abs(value) * *percent / 100
+		u.estimated = true
+	}
+}
+
+func (u *uncertainty) merge(other uncertainty) {
+	u.sum += other.sum
+	u.estimated = u.estimated || other.estimated
+}
+
+// over returns the uncertainty divided by d, nil without any estimate.
+func (u uncertainty) over(d float64) *float64 {
+	if !u.estimated || d == 0 {
+		return nil
+	}
+	v := u.sum / d
+	return &v
+}
+
+// Build computes the report. Readings may come in any order; readings at
+// the same timestamp form one sample for the parallel statistics.
+func Build(readings []Reading, opts Options) Report {
+	sorted := append([]Reading(nil), readings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].TS.Equal(sorted[j].TS) {
+			return sorted[i].TS.Before(sorted[j].TS)
+		}
+		return sorted[i].GenNo < sorted[j].GenNo
+	})
+
+	running := func(r Reading) bool {
+		return r.LoadKW != nil && *r.LoadKW > opts.MinLoadKW
+	}
+	// covered is the time a reading stands for, up to the next one
+	covered := func(from, next time.Time) float64 {
+		d := next.Sub(from)
+		if opts.MaxGap > 0 && d > opts.MaxGap {
+			d = opts.MaxGap
+		}
+		return d.Hours()
+	}
+
+	// Per generator, each reading stands for the time until the next one
+	byGen := map[int][]Reading{}
+	for _, r := range sorted {
+		byGen[r.GenNo] = append(byGen[r.GenNo], r)
+	}
+	gens := map[int]*Generator{}
+	for genNo, list := range byGen {
+		g := &Generator{GenNo: genNo, Readings: len(list)}
+		gens[genNo] = g
+		for i, r := range list {
+			if r.LoadKW != nil && (g.PeakLoadKW == nil || *r.LoadKW > *g.PeakLoadKW) {
+				peak, at := *r.LoadKW, r.TS
+				g.PeakLoadKW, g.PeakAt = &peak, &at
+			}
+			if !running(r) || i == len(list)-1 {
+				continue
+			}
+			hours := covered(r.TS, list[i+1].TS)
+			g.RunningHours += hours
+			g.EnergyKWh += *r.LoadKW * hours
+			if r.FuelRateLPH != nil {
+				g.FuelLiters += *r.FuelRateLPH * hours
+				g.sfcFuel += *r.FuelRateLPH * hours
+				g.sfcEnergy += *r.LoadKW * hours
+				g.fuel.add(*r.FuelRateLPH*hours, r.FuelRateUncertaintyPercent)
+			}
+		}
+		if g.RunningHours > 0 {
+			avg := g.EnergyKWh / g.RunningHours
+			g.AvgLoadKW = &avg
+		}
+		g.FuelLitersUncertainty = g.fuel.over(1)
+		if g.sfcEnergy > 0 {
+			sfc := g.sfcFuel / g.sfcEnergy
+			g.SFCLPerKWh = &sfc
+			g.SFCUncertainty = g.fuel.over(g.sfcEnergy)
+		}
+	}
+
+	// Samples: readings sharing a timestamp
+	var report Report
+	var imbalanceSum float64
+	for i := 0; i < len(sorted); {
+		j := i
+		for j < len(sorted) && sorted[j].TS.Equal(sorted[i].TS) {
+			j++
+		}
+		var loads []Reading
+		for _, r := range sorted[i:j] {
+			if running(r) {
+				loads = append(loads, r)
+			}
+		}
+		if len(loads) >= 2 {
+			var total float64
+			for _, r := range loads {
+				total += *r.LoadKW
+			}
+			mean := total / float64(len(loads))
+			var deviation float64
+			for _, r := range loads {
+				deviation = math.Max(deviation, math.Abs(*r.LoadKW-mean))
+				g := gens[r.GenNo]
+				g.shareSum += *r.LoadKW / total * 100
+				g.shareSamples++
+			}
+			imbalance := deviation / mean * 100
+
+			p := &report.Parallel
+			p.Samples++
+			if j < len(sorted) {
+				p.Hours += covered(sorted[i].TS, sorted[j].TS)
+			}
+			imbalanceSum += imbalance
+			if p.MaxImbalancePercent == nil || imbalance > *p.MaxImbalancePercent {
+				at := sorted[i].TS
+				p.MaxImbalancePercent, p.MaxImbalanceAt = &imbalance, &at
+			}
+		}
+		i = j
+	}
+	if n := report.Parallel.Samples; n > 0 {
+		avg := imbalanceSum / float64(n)
+		report.Parallel.AvgImbalancePercent = &avg
+	}
+
+	report.Generators = make([]Generator, 0, len(gens))
+	var sfcFuel, sfcEnergy float64
+	var fuel uncertainty
+	for _, g := range gens {
+		if g.shareSamples > 0 {
+			share := g.shareSum / float64(g.shareSamples)
+			g.ParallelSharePercent = &share
+		}
+		report.EnergyKWh += g.EnergyKWh
+		report.FuelLiters += g.FuelLiters
+		sfcFuel += g.sfcFuel
+		sfcEnergy += g.sfcEnergy
+		fuel.merge(g.fuel)
+		report.Generators = append(report.Generators, *g)
+	}
+	sort.Slice(report.Generators, func(i, j int) bool { return report.Generators[i].GenNo < report.Generators[j].GenNo })
+	report.FuelLitersUncertainty = fuel.over(1)
+	if sfcEnergy > 0 {
+		sfc := sfcFuel / sfcEnergy
+		report.SFCLPerKWh = &sfc
+		report.SFCUncertainty = fuel.over(sfcEnergy)
+	}
+	return report
+}
@@ -0,0 +1,90 @@
+package gensets
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func f(v float64) *float64 { return &v }
+
+func near(a *float64, b float64) bool {
+	return a != nil && math.Abs(*a-b) < 1e-9
+}
+
+func TestBuild(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2025, 1, 1, h, 0, 0, 0, time.UTC) }
+	readings := []Reading{
+		{GenNo: 1, TS: at(0), LoadKW: f(300), FuelRateLPH: f(75)},
+		{GenNo: 2, TS: at(0), LoadKW: f(100), FuelRateLPH: f(30)},
+		{GenNo: 1, TS: at(1), LoadKW: f(200), FuelRateLPH: f(50)},
+		{GenNo: 2, TS: at(1), LoadKW: f(0), FuelRateLPH: f(0)},
+		{GenNo: 1, TS: at(2), LoadKW: f(200)},
+		{GenNo: 2, TS: at(2), LoadKW: f(0)},
+		// after a 10 hour gap in logging
+		{GenNo: 1, TS: at(12), LoadKW: f(250)},
+	}
+	report := Build(readings, Options{MaxGap: 2 * time.Hour})
+
+	if len(report.Generators) != 2 {
+		t.Fatalf("Expected 2 generators, got %+v", report.Generators)
+	}
+	g1, g2 := report.Generators[0], report.Generators[1]
+
+	// Gen 1: 300 kW for 1 h, 200 kW for 1 h, 200 kW for 2 h (gap capped)
+	if g1.RunningHours != 4 || g1.EnergyKWh != 900 || !near(g1.AvgLoadKW, 225) || !near(g1.PeakLoadKW, 300) || !g1.PeakAt.Equal(at(0)) {
+		t.Errorf("Unexpected generator 1 report %+v", g1)
+	}
+	// SFC only over readings with a fuel rate: (75 + 50) L / (300 + 200) kWh
+	if !near(g1.SFCLPerKWh, 0.25) || g1.FuelLiters != 125 {
+		t.Errorf("Expected SFC 0.25 L/kWh from 125 L, got %v from %v", g1.SFCLPerKWh, g1.FuelLiters)
+	}
+	if g2.RunningHours != 1 || !near(g2.SFCLPerKWh, 0.3) {
+		t.Errorf("Unexpected generator 2 report %+v", g2)
+	}
+
+	// Parallel only at hour 0: mean 200, deviation 100
+	p := report.Parallel
+	if p.Samples != 1 || p.Hours != 1 || !near(p.MaxImbalancePercent, 50) || !near(p.AvgImbalancePercent, 50) || !p.MaxImbalanceAt.Equal(at(0)) {
+		t.Errorf("Unexpected parallel report %+v", p)
+	}
+	if !near(g1.ParallelSharePercent, 75) || !near(g2.ParallelSharePercent, 25) {
+		t.Errorf("Expected 75/25 load share, got %v/%v", *g1.ParallelSharePercent, *g2.ParallelSharePercent)
+	}
+
+	if report.EnergyKWh != 1000 || !near(report.SFCLPerKWh, 155.0/600) {
+		t.Errorf("Unexpected totals %v kWh, SFC %v", report.EnergyKWh, *report.SFCLPerKWh)
+	}
+
+	if g1.FuelLitersUncertainty != nil || report.SFCUncertainty != nil {
+		t.Errorf("Expected no uncertainty without estimates, got %v", g1.FuelLitersUncertainty)
+	}
+
+	if empty := Build(nil, Options{}); len(empty.Generators) != 0 || empty.SFCLPerKWh != nil {
+		t.Errorf("Expected an empty report, got %+v", empty)
+	}
+}
+
+func TestBuildUncertainty(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2025, 1, 1, h, 0, 0, 0, time.UTC) }
+	readings := []Reading{
+		// 100 L ±5% from soundings, then 50 L metered
+		{GenNo: 1, TS: at(0), LoadKW: f(400), FuelRateLPH: f(100), FuelRateUncertaintyPercent: f(5)},
+		{GenNo: 1, TS: at(1), LoadKW: f(200), FuelRateLPH: f(50)},
+		{GenNo: 1, TS: at(2), LoadKW: f(200)},
+		{GenNo: 2, TS: at(0), LoadKW: f(100), FuelRateLPH: f(30), FuelRateUncertaintyPercent: f(10)},
+		{GenNo: 2, TS: at(1), LoadKW: f(100)},
+	}
+	report := Build(readings, Options{})
+	g1, g2 := report.Generators[0], report.Generators[1]
+
+	if !near(g1.FuelLitersUncertainty, 5) || !near(g1.SFCUncertainty, 5.0/600) {
+		t.Errorf("Expected ±5 L and ±%v L/kWh, got %v and %v", 5.0/600, g1.FuelLitersUncertainty, g1.SFCUncertainty)
+	}
+	if !near(g2.FuelLitersUncertainty, 3) {
+		t.Errorf("Expected ±3 L, got %v", g2.FuelLitersUncertainty)
+	}
+	if !near(report.FuelLitersUncertainty, 8) || !near(report.SFCUncertainty, 8.0/700) {
+		t.Errorf("Expected ±8 L and ±%v L/kWh in total, got %v and %v", 8.0/700, report.FuelLitersUncertainty, report.SFCUncertainty)
+	}
+}
@@ -0,0 +1,243 @@
+// Package ha runs a warm standby of the shore instance.
+//
+// The standby pulls a consistent snapshot of the primary's database every
+// sync interval and serves it read-only. Each sync copies the whole
+// database rather than streaming the WAL, so its cost grows with the
+// database, not with the writes since the last sync. When the primary stops answering,
+// the standby keeps serving the last snapshot, so reads fail over to it
+// automatically; writes only move to it once it is promoted.
+package ha
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// Roles of an instance. Instances without a role run standalone.
+const (
+	RolePrimary    = "primary"
+	RoleStandby    = "standby"
+	RoleStandalone = "standalone"
+)
+
+// TokenHeader carries the shared token on snapshot requests.
+const TokenHeader = "X-HA-Token"
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Status is reported by GET /ha/status.
+type Status struct {
+	Role             string     `json:"role"`
+	ReadOnly         bool       `json:"read_only"`
+	PrimaryURL       string     `json:"primary_url,omitempty"`
+	PrimaryReachable *bool      `json:"primary_reachable,omitempty"`
+	LastSyncAt       *time.Time `json:"last_sync_at,omitempty"`
+	LastSyncError    string     `json:"last_sync_error,omitempty"`
+	LagSeconds       *float64   `json:"lag_seconds,omitempty"` // age of the data being served
+	PromotedAt       *time.Time `json:"promoted_at,omitempty"`
+}
+
+// Restorer replaces the local database with a snapshot file.
+type Restorer interface {
+	Restore(ctx context.Context, path string) error
+}
+
+// Standby keeps the local database in sync with the primary until promoted.
+type Standby struct {
+	store      Restorer
+	primaryURL string
+	token      string
+	interval   time.Duration
+	client     *http.Client
+	out        *outbound.Integration
+	onPromote  func()
+
+	restoreMu sync.Mutex // held while restoring; promotion waits for it
+
+	mu         sync.Mutex
+	synced     bool
+	lastSync   time.Time
+	lastErr    error
+	reachable  bool
+	promotedAt time.Time
+}
+
+// NewStandby creates a standby of the primary at primaryURL. onPromote runs
+// once when the standby is promoted, e.g. to start background writers.
+func NewStandby(store Restorer, primaryURL, token string, interval time.Duration, policy outbound.Policy, onPromote func()) *Standby {
+	return &Standby{
+		store:      store,
+		primaryURL: strings.TrimRight(primaryURL, "/"),
+		token:      token,
+		interval:   interval,
+		client:     &http.Client{}, // timeouts come from the policy
+		out:        outbound.New("ha_primary", policy),
+		onPromote:  onPromote,
+	}
+}
+
+// Run syncs from the primary until ctx is cancelled or the standby is
+// promoted.
+func (s *Standby) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if s.promoted() {
+			return
+		}
+		if err := s.SyncOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("ha: sync from %s: %v", s.primaryURL, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncOnce downloads a snapshot from the primary and restores it locally.
+func (s *Standby) SyncOnce(ctx context.Context) error {
+	err := s.sync(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err
+	s.reachable = err == nil
+	if err == nil {
+		s.synced, s.lastSync = true, time.Now()
+	}
+	return err
+}
+
+func (s *Standby) sync(ctx context.Context) error {
+	f, err := os.CreateTemp("", "telemetry-standby-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	err = s.out.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.primaryURL+"/ha/snapshot", nil)
+		if err != nil {
+			return outbound.Permanent(err)
+		}
+		if s.token != "" {
+			req.Header.Set(TokenHeader, s.token)
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			err := fmt.Errorf("primary returned %s", resp.Status)
+			if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+				return err
+			}
+			return outbound.Permanent(err)
+		}
+
+		// Start over on every attempt; a short body fails the copy
+		if err := f.Truncate(0); err != nil {
+			return outbound.Permanent(err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return outbound.Permanent(err)
+		}
+		_, err = io.Copy(f, resp.Body)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := f.ReadAt(header, 0); err != nil || !bytes.Equal(header, sqliteHeader) {
+		return fmt.Errorf("primary sent something other than a SQLite database")
+	}
+
+	// Promotion may have happened while downloading; never overwrite a
+	// promoted database
+	s.restoreMu.Lock()
+	defer s.restoreMu.Unlock()
+	if s.promoted() {
+		return nil
+	}
+	return s.store.Restore(ctx, f.Name())
+}
+
+func (s *Standby) promoted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.promotedAt.IsZero()
+}
+
+// ReadOnly reports whether writes must be refused.
+func (s *Standby) ReadOnly() bool {
+	return !s.promoted()
+}
+
+// Promote stops syncing and makes the standby writable. It reports false if
+// it was already promoted.
+func (s *Standby) Promote() bool {
+	s.restoreMu.Lock()
+	s.mu.Lock()
+	first := s.promotedAt.IsZero()
+	if first {
+		s.promotedAt = time.Now()
+	}
+	s.mu.Unlock()
+	s.restoreMu.Unlock()
+	if !first {
+		return false
+	}
+
+	log.Printf("ha: promoted to primary")
+	if s.onPromote != nil {
+		s.onPromote()
+	}
+	return true
+}
+
+// Status reports the sync state.
+func (s *Standby) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Status{Role: RoleStandby, ReadOnly: s.promotedAt.IsZero(), PrimaryURL: s.primaryURL}
+	if !s.promotedAt.IsZero() {
+		st.Role = RolePrimary
+		promotedAt := s.promotedAt
+		st.PromotedAt = &promotedAt
+		return st
+	}
+
+	reachable := s.reachable
+	st.PrimaryReachable = &reachable
+	if s.lastErr != nil {
+		st.LastSyncError = s.lastErr.Error()
+	}
+	if s.synced {
+		lastSync := s.lastSync
+		lag := time.Since(lastSync).Seconds()
+		st.LastSyncAt, st.LagSeconds = &lastSync, &lag
+	}
+	return st
+}
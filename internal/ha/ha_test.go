@@ -0,0 +1,194 @@
+package ha
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// fakeRestorer records the snapshots restored; while block is set, each
+// restore signals entered and waits for release.
+type fakeRestorer struct {
+	mu       sync.Mutex
+	restored []string // contents
+
+	block   bool
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (r *fakeRestorer) Restore(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if r.block {
+		r.entered <- struct{}{}
+		<-r.release
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.restored = append(r.restored, string(data))
+	return nil
+}
+
+func (r *fakeRestorer) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.restored)
+}
+
+// snapshot is what a primary sends: a SQLite header and some pages.
+var snapshot = string(sqliteHeader) + strings.Repeat("p", 4096)
+
+func primary(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func newStandby(url string, r Restorer) *Standby {
+	return NewStandby(r, url, "s3cret", time.Hour, outbound.Policy{Timeout: 5 * time.Second}, nil)
+}
+
+func TestSyncOnce(t *testing.T) {
+	url := primary(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ha/snapshot" || r.Header.Get(TokenHeader) != "s3cret" {
+			http.Error(w, "invalid replication token", 401)
+			return
+		}
+		w.Write([]byte(snapshot))
+	})
+	r := &fakeRestorer{}
+	s := newStandby(url+"/", r)
+	if err := s.SyncOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r.count() != 1 || r.restored[0] != snapshot {
+		t.Fatalf("Expected the snapshot restored, got %d restores", r.count())
+	}
+	if st := s.Status(); st.Role != RoleStandby || !st.ReadOnly || st.PrimaryReachable == nil || !*st.PrimaryReachable || st.LastSyncAt == nil || st.LastSyncError != "" {
+		t.Errorf("Unexpected status %+v", st)
+	}
+}
+
+func TestSyncOnceRejectsNonSQLite(t *testing.T) {
+	url := primary(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>captive portal</html>"))
+	})
+	r := &fakeRestorer{}
+	s := newStandby(url, r)
+	if err := s.SyncOnce(context.Background()); err == nil || !strings.Contains(err.Error(), "SQLite") {
+		t.Errorf("Expected a non-SQLite body to fail the sync, got %v", err)
+	}
+	if r.count() != 0 {
+		t.Error("Expected nothing restored")
+	}
+	if st := s.Status(); st.LastSyncError == "" || *st.PrimaryReachable || st.LastSyncAt != nil {
+		t.Errorf("Expected the failure reported, got %+v", st)
+	}
+}
+
+func TestSyncOnceRejectsCutOffBody(t *testing.T) {
+	// Announces the whole snapshot, sends half and hangs up
+	url := primary(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "8192")
+		w.Write([]byte(snapshot[:4096]))
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	})
+	r := &fakeRestorer{}
+	s := newStandby(url, r)
+	if err := s.SyncOnce(context.Background()); err == nil {
+		t.Error("Expected a cut-off body to fail the sync")
+	}
+	if r.count() != 0 {
+		t.Error("Expected a cut-off snapshot not to be restored")
+	}
+
+	// Chunked, cut off before the last chunk
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 4096)
+			conn.Read(buf)
+			conn.Write([]byte("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n1000\r\n" + snapshot[:4096] + "\r\n"))
+			conn.Close()
+		}
+	}()
+	s = newStandby("http://"+ln.Addr().String(), r)
+	if err := s.SyncOnce(context.Background()); err == nil {
+		t.Error("Expected a chunked body without its last chunk to fail the sync")
+	}
+	if r.count() != 0 {
+		t.Error("Expected a cut-off chunked snapshot not to be restored")
+	}
+}
+
+func TestPromoteWaitsForRestore(t *testing.T) {
+	url := primary(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(snapshot))
+	})
+	promotions := 0
+	r := &fakeRestorer{block: true, entered: make(chan struct{}, 2), release: make(chan struct{})}
+	s := NewStandby(r, url, "s3cret", time.Hour, outbound.Policy{Timeout: 5 * time.Second}, func() { promotions++ })
+
+	synced := make(chan error)
+	go func() { synced <- s.SyncOnce(context.Background()) }()
+	<-r.entered
+
+	promoted := make(chan bool)
+	go func() { promoted <- s.Promote() }()
+	select {
+	case <-promoted:
+		t.Fatal("Expected promotion to wait for the restore in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !s.ReadOnly() {
+		t.Error("Expected the standby read-only while restoring")
+	}
+
+	close(r.release)
+	if err := <-synced; err != nil {
+		t.Fatal(err)
+	}
+	if !<-promoted {
+		t.Fatal("Expected the first promotion to succeed")
+	}
+	if s.ReadOnly() || promotions != 1 {
+		t.Errorf("Expected the standby promoted once, read-only %v, %d promotions", s.ReadOnly(), promotions)
+	}
+
+	// A sync after promotion never overwrites the promoted database
+	if err := s.SyncOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r.count() != 1 {
+		t.Errorf("Expected no restore after promotion, got %d", r.count())
+	}
+	if s.Promote() || promotions != 1 {
+		t.Error("Expected a second promotion to be refused")
+	}
+	if st := s.Status(); st.Role != RolePrimary || st.ReadOnly || st.PromotedAt == nil {
+		t.Errorf("Unexpected status after promotion %+v", st)
+	}
+}
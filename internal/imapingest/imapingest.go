@@ -0,0 +1,355 @@
+// Package imapingest ingests the telemetry workbooks masters email in, from
+// a mailbox read over IMAP.
+//
+// Every poll reads the unseen messages of the mailbox. The sender's address
+// says which vessel a message is for; its XLSX, .xls, .ods and ZIP
+// attachments are ingested for that vessel and the message marked seen.
+// Messages that fail, or come from unknown senders, are flagged as well, and
+// known senders get a reply saying what went wrong when a mailer is set.
+// Messages from throttled vessels over their quota are left unseen, to be
+// read again next poll.
+package imapingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/mailer"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+const (
+	// maxMessageSize bounds the messages downloaded.
+	maxMessageSize = 64 << 20
+	// maxBatch bounds the messages read per poll; the rest wait for the next.
+	maxBatch = 20
+)
+
+// Config says which mailbox to read and whose messages to ingest.
+type Config struct {
+	Addr     string // host:port
+	TLS      bool   // implicit TLS; without it STARTTLS is used if offered
+	User     string
+	Password string
+	Mailbox  string
+	// Senders maps lower-case sender addresses, or @domain for any address
+	// of a domain, to the IMO number of their vessel.
+	Senders map[string]string
+}
+
+// Processor ingests the files collected.
+type Processor interface {
+	ProcessDropped(ctx context.Context, data []byte, filename, imo, vesselName, source string) (ingest.DroppedResult, error)
+}
+
+// Mailer sends replies, see mailer.Mailer.
+type Mailer interface {
+	Send(ctx context.Context, msg mailer.Message) error
+	From() string
+}
+
+// Poller reads a mailbox.
+type Poller struct {
+	processor Processor
+	mailer    Mailer // nil: no replies
+	cfg       Config
+	timeout   time.Duration
+	out       *outbound.Integration
+}
+
+// NewPoller creates a poller of the mailbox cfg names; failures are replied
+// to through m unless nil. Connections are guarded by policy.
+func NewPoller(processor Processor, m Mailer, cfg Config, policy outbound.Policy) *Poller {
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	return &Poller{processor: processor, mailer: m, cfg: cfg, timeout: policy.Timeout, out: outbound.New("imap", policy)}
+}
+
+// unseen is a message to ingest.
+type unseen struct {
+	uid  uint32
+	size uint32
+}
+
+// PollOnce ingests the unseen messages of the mailbox.
+func (p *Poller) PollOnce(ctx context.Context) error {
+	var c *client.Client
+	var messages []unseen
+	err := p.out.Do(ctx, func(ctx context.Context) error {
+		conn, err := p.connect(ctx)
+		if err != nil {
+			return err
+		}
+		if messages, err = listUnseen(conn); err != nil {
+			conn.Logout()
+			return err
+		}
+		c = conn
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	for _, m := range messages {
+		if ctx.Err() != nil {
+			return nil
+		}
+		seqset := new(imap.SeqSet)
+		seqset.AddNum(m.uid)
+		var raw []byte
+		if m.size <= maxMessageSize {
+			// One at a time, as the timeout applies to each command
+			if raw, err = fetchBody(c, seqset); err != nil {
+				return fmt.Errorf("reading message %d: %w", m.uid, err)
+			}
+		}
+		flags, err := p.handle(ctx, m, raw)
+		if err != nil {
+			log.Printf("imap %s: message %d: %v", p.cfg.Mailbox, m.uid, err)
+		}
+		if len(flags) == 0 {
+			continue
+		}
+		if err := c.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+			return fmt.Errorf("flagging message %d: %w", m.uid, err)
+		}
+	}
+	return nil
+}
+
+// connect logs in and selects the mailbox.
+func (p *Poller) connect(ctx context.Context) (*client.Client, error) {
+	host, _, err := net.SplitHostPort(p.cfg.Addr)
+	if err != nil {
+		return nil, outbound.Permanent(fmt.Errorf("invalid address %q, use host:port", p.cfg.Addr))
+	}
+	dialer := ctxDialer{ctx}
+	var c *client.Client
+	if p.cfg.TLS {
+		c, err = client.DialWithDialerTLS(dialer, p.cfg.Addr, &tls.Config{ServerName: host})
+	} else {
+		c, err = client.DialWithDialer(dialer, p.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Timeout = p.timeout
+	if !p.cfg.TLS {
+		if ok, _ := c.SupportStartTLS(); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				c.Logout()
+				return nil, err
+			}
+		}
+	}
+	if err := c.Login(p.cfg.User, p.cfg.Password); err != nil {
+		c.Logout()
+		return nil, outbound.Permanent(err)
+	}
+	if _, err := c.Select(p.cfg.Mailbox, false); err != nil {
+		c.Logout()
+		return nil, outbound.Permanent(err)
+	}
+	return c, nil
+}
+
+// ctxDialer dials with a context, and bounds the greeting by its deadline.
+type ctxDialer struct{ ctx context.Context }
+
+func (d ctxDialer) Dial(network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(d.ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := d.ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// listUnseen returns the oldest unseen messages with their size.
+func listUnseen(c *client.Client) ([]unseen, error) {
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil || len(uids) == 0 {
+		return nil, err
+	}
+	if len(uids) > maxBatch {
+		uids = uids[:maxBatch]
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	sizes := map[uint32]uint32{}
+	if err := fetch(c, seqset, []imap.FetchItem{imap.FetchUid, imap.FetchRFC822Size}, func(msg *imap.Message) {
+		sizes[msg.Uid] = msg.Size
+	}); err != nil {
+		return nil, err
+	}
+	var messages []unseen
+	for _, uid := range uids {
+		if size, ok := sizes[uid]; ok {
+			messages = append(messages, unseen{uid: uid, size: size})
+		}
+	}
+	return messages, nil
+}
+
+// fetchBody downloads a message without marking it seen.
+func fetchBody(c *client.Client, seqset *imap.SeqSet) ([]byte, error) {
+	section := &imap.BodySectionName{Peek: true}
+	var raw []byte
+	err := fetch(c, seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, func(msg *imap.Message) {
+		if body := msg.GetBody(section); body != nil {
+			var buf bytes.Buffer
+			buf.ReadFrom(body)
+			raw = buf.Bytes()
+		}
+	})
+	if err == nil && raw == nil {
+		err = errors.New("no content returned")
+	}
+	return raw, err
+}
+
+func fetch(c *client.Client, seqset *imap.SeqSet, items []imap.FetchItem, each func(*imap.Message)) error {
+	ch := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() { done <- c.UidFetch(seqset, items, ch) }()
+	for msg := range ch {
+		each(msg)
+	}
+	return <-done
+}
+
+// handle ingests the attachments of a message and returns the flags to add
+// to it; none leaves it unseen.
+func (p *Poller) handle(ctx context.Context, m unseen, raw []byte) ([]interface{}, error) {
+	failed := []interface{}{imap.SeenFlag, imap.FlaggedFlag}
+	if raw == nil {
+		return failed, fmt.Errorf("message of %d MB exceeds %d MB", m.size>>20, maxMessageSize>>20)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return failed, err
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return failed, fmt.Errorf("invalid sender: %w", err)
+	}
+	imo := p.vesselOf(from.Address)
+	if imo == "" {
+		// Replying to unknown senders would answer spam
+		return failed, fmt.Errorf("%s is not a known sender", from.Address)
+	}
+
+	files, err := attachments(msg)
+	if err != nil {
+		p.reply(ctx, msg, from.Address, []string{err.Error()})
+		return failed, err
+	}
+	if len(files) == 0 {
+		p.reply(ctx, msg, from.Address, []string{"No XLSX, .xls, .ods or ZIP file was attached."})
+		return failed, errors.New("no workbook attached")
+	}
+
+	var problems []string
+	for _, f := range files {
+		result, err := p.processor.ProcessDropped(ctx, f.data, f.filename, imo, "", models.SourceSensor)
+		if errors.Is(err, ingest.ErrQuotaExceeded) {
+			// Read again next poll; files ingested by then are not ingested twice
+			return nil, fmt.Errorf("%s: %w", f.filename, err)
+		}
+		if err == nil && result.Status == "failed" {
+			err = errors.New("no file of the archive could be ingested")
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.filename, err))
+			continue
+		}
+		log.Printf("imap %s: %s from %s: %s", p.cfg.Mailbox, f.filename, from.Address, result.Status)
+	}
+	if len(problems) > 0 {
+		p.reply(ctx, msg, from.Address, problems)
+		return failed, errors.New(strings.Join(problems, "; "))
+	}
+	return []interface{}{imap.SeenFlag}, nil
+}
+
+// vesselOf returns the IMO number of a sender's vessel, "" if unknown.
+func (p *Poller) vesselOf(address string) string {
+	address = strings.ToLower(address)
+	if imo, ok := p.cfg.Senders[address]; ok {
+		return imo
+	}
+	if _, domain, ok := strings.Cut(address, "@"); ok {
+		return p.cfg.Senders["@"+domain]
+	}
+	return ""
+}
+
+// reply tells the sender of a message what could not be ingested, unless
+// replies are off or the message is itself automatic.
+func (p *Poller) reply(ctx context.Context, msg *mail.Message, to string, problems []string) {
+	if p.mailer == nil || automatic(msg.Header) || strings.EqualFold(to, p.mailerAddress()) {
+		return
+	}
+	subject := msg.Header.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil && decoded != "" {
+		subject = decoded
+	}
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	headers := map[string]string{"Auto-Submitted": "auto-replied"}
+	if id := msg.Header.Get("Message-Id"); id != "" && !strings.ContainsAny(id, "\r\n") {
+		headers["In-Reply-To"] = id
+		headers["References"] = id
+	}
+	body := "Your telemetry email could not be ingested completely:\n\n- " +
+		strings.Join(problems, "\n- ") +
+		"\n\nPlease correct the file and send it again.\n"
+	if err := p.mailer.Send(ctx, mailer.Message{To: []string{to}, Subject: subject, Body: body, Headers: headers}); err != nil {
+		log.Printf("imap %s: replying to %s: %v", p.cfg.Mailbox, to, err)
+	}
+}
+
+func (p *Poller) mailerAddress() string {
+	addr, err := mail.ParseAddress(p.mailer.From())
+	if err != nil {
+		return ""
+	}
+	return addr.Address
+}
+
+// automatic reports whether a message was sent automatically (auto-replies,
+// bounces, mailing lists), which are never replied to, to avoid mail loops.
+func automatic(h mail.Header) bool {
+	if auto := strings.ToLower(h.Get("Auto-Submitted")); auto != "" && auto != "no" {
+		return true
+	}
+	switch strings.ToLower(h.Get("Precedence")) {
+	case "bulk", "junk", "list":
+		return true
+	}
+	return h.Get("List-Id") != ""
+}
@@ -0,0 +1,152 @@
+package imapingest
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/mailer"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+type fakeProcessor struct {
+	ingested map[string]string // filename to IMO
+}
+
+func (p *fakeProcessor) ProcessDropped(ctx context.Context, data []byte, filename, imo, vesselName, source string) (ingest.DroppedResult, error) {
+	switch string(data) {
+	case "broken":
+		return ingest.DroppedResult{}, ingest.ErrUnsupportedFormat
+	case "over quota":
+		return ingest.DroppedResult{}, ingest.ErrQuotaExceeded
+	}
+	p.ingested[filename] = imo
+	return ingest.DroppedResult{Status: "ingested"}, nil
+}
+
+type fakeMailer struct{ sent []mailer.Message }
+
+func (m *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *fakeMailer) From() string { return "Telemetry <telemetry@fleet.example>" }
+
+// email builds a message from a sender with files attached.
+func email(from, subject string, headers string, files map[string]string) string {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\nTo: telemetry@fleet.example\r\nSubject: " + subject + "\r\nMessage-Id: <" + subject + "@ship>\r\n" + headers)
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=BOUNDARY\r\n\r\n")
+	b.WriteString("--BOUNDARY\r\nContent-Type: text/plain\r\n\r\nNoon report attached.\r\n")
+	for name, data := range files {
+		b.WriteString("--BOUNDARY\r\nContent-Type: application/octet-stream; name=\"" + name + "\"\r\n" +
+			"Content-Disposition: attachment; filename=\"" + name + "\"\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+			base64.StdEncoding.EncodeToString([]byte(data)) + "\r\n")
+	}
+	b.WriteString("--BOUNDARY--\r\n")
+	return b.String()
+}
+
+func TestPollOnce(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.New(memory.New())
+	srv.AllowInsecureAuth = true
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	c, err := client.Dial(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Logout()
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{
+		email("Master Alpha <Master@Alpha.example>", "ok", "", map[string]string{"day1.xlsx": "ok", "photo.jpg": "x"}),
+		email("bosun@beta-fleet.example", "zip", "", map[string]string{"week.zip": "ok"}),
+		email("stranger@spam.example", "unknown", "", map[string]string{"day1.xlsx": "ok"}),
+		email("master@alpha.example", "broken", "", map[string]string{"day2.xlsx": "broken", "day3.xlsx": "ok"}),
+		email("master@alpha.example", "none", "Auto-Submitted: auto-replied\r\n", nil),
+		email("master@alpha.example", "quota", "", map[string]string{"day4.xlsx": "over quota"}),
+	} {
+		if err := c.Append("INBOX", nil, time.Now(), strings.NewReader(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	processor := &fakeProcessor{ingested: map[string]string{}}
+	replies := &fakeMailer{}
+	p := NewPoller(processor, replies, Config{
+		Addr: listener.Addr().String(), User: "username", Password: "password",
+		Senders: map[string]string{"master@alpha.example": "9811000", "@beta-fleet.example": "9822000"},
+	}, outbound.Policy{Timeout: 5 * time.Second})
+	if err := p.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"day1.xlsx": "9811000", "week.zip": "9822000", "day3.xlsx": "9811000"}
+	if len(processor.ingested) != len(want) {
+		t.Errorf("Expected %v ingested, got %v", want, processor.ingested)
+	}
+	for name, imo := range want {
+		if processor.ingested[name] != imo {
+			t.Errorf("%s: expected IMO %s, got %q", name, imo, processor.ingested[name])
+		}
+	}
+
+	// The broken file is replied to; the unknown sender and the automatic
+	// message are not
+	if len(replies.sent) != 1 {
+		t.Fatalf("Expected one reply, got %+v", replies.sent)
+	}
+	reply := replies.sent[0]
+	if reply.To[0] != "master@alpha.example" || reply.Subject != "Re: broken" || reply.Headers["In-Reply-To"] != "<broken@ship>" || !strings.Contains(reply.Body, "day2.xlsx") {
+		t.Errorf("Unexpected reply %+v", reply)
+	}
+
+	if _, err := c.Select("INBOX", true); err != nil {
+		t.Fatal(err)
+	}
+	flags := map[string][]string{}
+	seqset, _ := imap.ParseSeqSet("1:*")
+	section := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier}, Peek: true}
+	ch := make(chan *imap.Message, 10)
+	if err := c.Fetch(seqset, []imap.FetchItem{imap.FetchFlags, section.FetchItem()}, ch); err != nil {
+		t.Fatal(err)
+	}
+	for msg := range ch {
+		header := make([]byte, 4096)
+		n, _ := msg.GetBody(section).Read(header)
+		for _, line := range strings.Split(string(header[:n]), "\r\n") {
+			if subject, ok := strings.CutPrefix(line, "Subject: "); ok {
+				flags[subject] = msg.Flags
+			}
+		}
+	}
+	for subject, want := range map[string]string{
+		"ok":      `\Seen`,
+		"zip":     `\Seen`,
+		"unknown": `\Seen \Flagged`,
+		"broken":  `\Seen \Flagged`,
+		"none":    `\Seen \Flagged`,
+		"quota":   ``,
+	} {
+		if got := strings.Join(flags[subject], " "); got != want {
+			t.Errorf("%s: expected flags %q, got %q", subject, want, got)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package imapingest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"strings"
+
+	"vessel-telemetry-api/internal/ingest"
+)
+
+// maxParts bounds the MIME parts read of one message.
+const maxParts = 100
+
+// attachment is a file attached to an email.
+type attachment struct {
+	filename string
+	data     []byte
+}
+
+// attachments returns the files of a message worth ingesting (see
+// ingest.IsDroppedFile), in the order they are attached.
+func attachments(msg *mail.Message) ([]attachment, error) {
+	var files []attachment
+	parts := 0
+	var walk func(header mail.Header, body io.Reader, depth int) error
+	walk = func(header mail.Header, body io.Reader, depth int) error {
+		if parts++; parts > maxParts || depth > 10 {
+			return fmt.Errorf("message has too many parts")
+		}
+		mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+		if err != nil {
+			mediaType = "text/plain"
+		}
+		if strings.HasPrefix(mediaType, "multipart/") {
+			r := multipart.NewReader(body, params["boundary"])
+			for {
+				part, err := r.NextRawPart()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := walk(mail.Header(part.Header), part, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+
+		name := filename(header, params)
+		if name == "" || !ingest.IsDroppedFile(name) {
+			return nil
+		}
+		data, err := io.ReadAll(decode(header.Get("Content-Transfer-Encoding"), body))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		files = append(files, attachment{filename: name, data: data})
+		return nil
+	}
+	return files, walk(msg.Header, msg.Body, 0)
+}
+
+// filename returns the name a part is attached under, from its
+// Content-Disposition, else the name parameter of its Content-Type.
+func filename(header mail.Header, typeParams map[string]string) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = typeParams["name"]
+	}
+	if name == "" {
+		return ""
+	}
+	// Some mailers encode names as headers are, not as RFC 2231 wants
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	return path.Base(strings.ReplaceAll(name, `\`, "/"))
+}
+
+func decode(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r) // line breaks are skipped
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
@@ -0,0 +1,59 @@
+package ingest
+
+import (
+	"context"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// headerAliases returns the header aliases for a vessel's sheets: its own,
+// then the global ones. vesselID 0 means the global ones only.
+func (p *XLSXProcessor) headerAliases(ctx context.Context, vesselID int64) ([]models.HeaderAlias, error) {
+	all, err := p.store.HeaderAliases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var aliases []models.HeaderAlias
+	for _, a := range all {
+		if a.VesselID == nil || *a.VesselID == vesselID {
+			aliases = append(aliases, a)
+		}
+	}
+	return aliases, nil
+}
+
+// aliasedMapper returns a mapper of headers knowing the aliases for stream.
+func aliasedMapper(headers []string, stream string, aliases []models.HeaderAlias) *HeaderMapper {
+	mapper := NewHeaderMapper(headers)
+	for _, a := range aliases {
+		if a.Stream == nil || *a.Stream == stream {
+			mapper.AddAlias(a.Field, a.Header)
+		}
+	}
+	return mapper
+}
+
+// SheetStreams returns the names of the built-in streams read from sheets.
+func SheetStreams() []string {
+	names := make([]string, len(sheetStreams))
+	for i, def := range sheetStreams {
+		names[i] = def.stream.Name
+	}
+	return names
+}
+
+// SheetFields returns the fields of a built-in stream read from sheets, ts
+// first, that header aliases may name; false if no built-in stream is read
+// from sheets by that name.
+func SheetFields(stream string) ([]string, bool) {
+	for _, def := range sheetStreams {
+		if def.stream.Name == stream {
+			fields := []string{"ts"}
+			for _, col := range def.columns {
+				fields = append(fields, col.name)
+			}
+			return fields, true
+		}
+	}
+	return nil, false
+}
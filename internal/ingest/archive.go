@@ -0,0 +1,203 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/util"
+)
+
+// maxArchiveFiles bounds the files of one archive.
+const maxArchiveFiles = 200
+
+// ErrInvalidArchive is returned for uploads that are not a usable ZIP archive.
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// archiveEntry is a file of an archive to ingest.
+type archiveEntry struct {
+	name string
+	data []byte
+}
+
+// readArchive returns the files of a ZIP archive in archive order, leaving
+// out directories and the metadata macOS adds.
+func readArchive(data []byte) ([]archiveEntry, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	var entries []archiveEntry
+	var total int64
+	for _, zf := range r.File {
+		base := path.Base(zf.Name)
+		if zf.FileInfo().IsDir() || strings.HasPrefix(zf.Name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		if len(entries) == maxArchiveFiles {
+			return nil, fmt.Errorf("%w: more than %d files", ErrInvalidArchive, maxArchiveFiles)
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, zf.Name, err)
+		}
+		// The sizes in the headers are not trusted
+		content, err := io.ReadAll(io.LimitReader(rc, maxUnzippedSize-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, zf.Name, err)
+		}
+		if total += int64(len(content)); total > maxUnzippedSize {
+			return nil, fmt.Errorf("%w: uncompressed size exceeds %d MB", ErrInvalidArchive, maxUnzippedSize>>20)
+		}
+		entries = append(entries, archiveEntry{name: zf.Name, data: content})
+	}
+	return entries, nil
+}
+
+// csvSheetName derives the sheet name of a CSV file from its file name, so
+// that the file name picks the stream as a sheet name would.
+func csvSheetName(filename string) string {
+	return safeSheetName(strings.TrimSuffix(path.Base(filename), path.Ext(filename)))
+}
+
+// safeSheetName makes name a valid XLSX sheet name: at most 31 characters,
+// none of :\/?*[].
+func safeSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return ' '
+		}
+		return r
+	}, name)
+	if runes := []rune(strings.TrimSpace(name)); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = "Sheet1"
+	}
+	return name
+}
+
+// csvWorkbook reads a CSV file into a workbook of one sheet named after the
+// file.
+func csvWorkbook(filename string, data []byte) (*excelize.File, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+	return textWorkbook([]textSheet{{name: csvSheetName(filename), rows: records}})
+}
+
+// ProcessArchive ingests the XLSX, .xls, .ods and CSV files of a ZIP archive
+// in archive order, each as ProcessFile would. Files already ingested, or
+// repeated within the archive, are not read again. Files that name no vessel
+// by IMO go to the vessel of the first file ingested. opts apply to every
+// file.
+func (p *XLSXProcessor) ProcessArchive(ctx context.Context, data []byte, opts IngestOptions) (*models.ArchiveResponse, error) {
+	entries, err := readArchive(data)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.ArchiveResponse{RowsInserted: make(map[string]int)}
+	if opts.Mode == ModeUpsert {
+		response.RowsUpdated = make(map[string]int)
+	}
+	seen := make(map[string]string) // first file by hash
+	matcher := p.newSheetMatcher(ctx, opts.Sheets)
+	var archiveVessel int64
+	attempted, ingested, already := 0, 0, 0
+	for _, entry := range entries {
+		result := models.ArchiveFileResult{Filename: entry.name}
+		ext := strings.ToLower(path.Ext(entry.name))
+		if ext != ".xlsx" && ext != ".xls" && ext != ".ods" && ext != ".csv" {
+			result.Status = "skipped"
+			response.Files = append(response.Files, result)
+			continue
+		}
+		attempted++
+
+		fileHash := util.SHA256Hex(entry.data)
+		if first, ok := seen[fileHash]; ok {
+			result.Status, result.DuplicateOf = "duplicate", first
+			already++
+			response.Files = append(response.Files, result)
+			continue
+		}
+		seen[fileHash] = entry.name
+
+		res, err := p.processArchiveEntry(ctx, entry, fileHash, opts, archiveVessel, matcher)
+		if err != nil {
+			result.Status, result.Error = "failed", err.Error()
+			response.Files = append(response.Files, result)
+			continue
+		}
+		result.IngestResponse = *res
+		response.Files = append(response.Files, result)
+		if res.Status == "already_ingested" {
+			already++
+			continue
+		}
+
+		ingested++
+		if archiveVessel == 0 && res.VesselID != nil {
+			archiveVessel = *res.VesselID
+			response.VesselID = res.VesselID
+		}
+		for stream, n := range res.RowsInserted {
+			response.RowsInserted[stream] += n
+		}
+		for stream, n := range res.RowsUpdated {
+			response.RowsUpdated[stream] += n
+		}
+	}
+	if attempted == 0 {
+		return nil, fmt.Errorf("%w: no spreadsheet or CSV files", ErrInvalidArchive)
+	}
+
+	switch {
+	case ingested > 0:
+		response.Status = "ingested"
+	case already == attempted:
+		response.Status = "already_ingested"
+	default:
+		response.Status = "failed"
+	}
+	return response, nil
+}
+
+func (p *XLSXProcessor) processArchiveEntry(ctx context.Context, entry archiveEntry, fileHash string, opts IngestOptions, archiveVessel int64, matcher *sheetMatcher) (*models.IngestResponse, error) {
+	existingUploadID, err := p.store.FindUploadByHash(ctx, fileHash)
+	if err == nil {
+		return &models.IngestResponse{Status: "already_ingested", UploadID: &existingUploadID}, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("error checking file hash: %w", err)
+	}
+
+	var f *excelize.File
+	if strings.EqualFold(path.Ext(entry.name), ".csv") {
+		f, err = csvWorkbook(entry.name, entry.data)
+	} else {
+		f, err = openWorkbook(entry.data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return p.processWorkbook(ctx, f, entry.name, opts, archiveVessel, matcher, fileHash)
+}
@@ -0,0 +1,68 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func zipOf(t *testing.T, files map[string]string, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(files[name]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	files := map[string]string{"day2.csv": "b", "day1.csv": "a", "__MACOSX/._day1.csv": "x", ".DS_Store": "x", "logs/": ""}
+	entries, err := readArchive(zipOf(t, files, "day2.csv", "__MACOSX/._day1.csv", "logs/", ".DS_Store", "day1.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].name != "day2.csv" || string(entries[1].data) != "a" {
+		t.Errorf("Expected day2.csv then day1.csv, got %+v", entries)
+	}
+
+	if _, err := readArchive([]byte("not a zip")); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("Expected ErrInvalidArchive, got %v", err)
+	}
+}
+
+func TestCSVSheetName(t *testing.T) {
+	for filename, want := range map[string]string{
+		"week1/Engines 2024-01-01.csv":               "Engines 2024-01-01",
+		"fuel[tanks].csv":                            "fuel tanks",
+		"a-very-long-generator-log-file-name-01.csv": "a-very-long-generator-log-file-",
+		".csv": "Sheet1",
+	} {
+		if got := csvSheetName(filename); got != want {
+			t.Errorf("csvSheetName(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
+
+func TestCSVWorkbook(t *testing.T) {
+	f, err := csvWorkbook("engines.csv", []byte("\xef\xbb\xbfTimestamp,Engine,RPM\n2024-01-01T00:00:00Z,ME-1,\"1,200\"\n2024-01-01T01:00:00Z,ME-1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows("engines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "Timestamp" || rows[1][2] != "1,200" || len(rows[2]) != 2 {
+		t.Errorf("Unexpected rows %q", rows)
+	}
+}
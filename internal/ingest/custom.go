@@ -0,0 +1,132 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// customSheetStreams returns the custom streams, read like built-in ones.
+func (p *XLSXProcessor) customSheetStreams(ctx context.Context) ([]sheetStream, error) {
+	defs, err := p.store.CustomStreams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	streams := make([]sheetStream, len(defs))
+	for i := range defs {
+		streams[i] = customSheetStream(&defs[i])
+	}
+	return streams, nil
+}
+
+// customSheetStream maps a custom stream's columns onto sheet columns; rows
+// with a value outside a column's range are refused.
+func customSheetStream(def *models.CustomStream) sheetStream {
+	stream := &store.Stream{Name: def.Name}
+	if def.UnitColumn != nil {
+		stream.Unit = *def.UnitColumn
+	}
+	s := sheetStream{stream: stream, sheets: def.Sheets, custom: def}
+	for _, col := range def.Columns {
+		parse := parseNumber
+		switch col.Type {
+		case models.CustomInt:
+			parse = parseInteger
+			if col.Name == stream.Unit {
+				// Like built-in unit numbers, "P-2" is unit 2
+				parse = parseUnitNo
+			}
+		case models.CustomText:
+			parse = parseText
+		}
+		// Admins write headers as they appear in the sheet
+		headers := make([]string, len(col.Headers))
+		for i, h := range col.Headers {
+			headers[i] = normalizeHeader(h)
+		}
+		s.columns = append(s.columns, sheetColumn{col.Name, headers, parse})
+	}
+	s.validate = func(r *sheetRow) []string {
+		var problems []string
+		for _, col := range def.Columns {
+			if problem := checkCustomRange(col, customValue(r.values[col.Name])); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+		return problems
+	}
+	return s
+}
+
+func parseInteger(_, cell string) interface{} {
+	v, _ := ParseInt(cell)
+	return v
+}
+
+// customValue dereferences a parsed cell, nil if it is empty.
+func customValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *int:
+		if v != nil {
+			return *v
+		}
+	case *float64:
+		if v != nil {
+			return *v
+		}
+	case *string:
+		if v != nil {
+			return *v
+		}
+	}
+	return nil
+}
+
+// checkCustomRange describes a numeric value outside the column's range,
+// empty if it is inside or the column has none.
+func checkCustomRange(col models.CustomColumn, value interface{}) string {
+	var v float64
+	switch value := value.(type) {
+	case int:
+		v = float64(value)
+	case float64:
+		v = value
+	default:
+		return ""
+	}
+	switch {
+	case col.Min != nil && col.Max != nil && (v < *col.Min || v > *col.Max):
+		return fmt.Sprintf("%s out of range (%g-%g)", col.Name, *col.Min, *col.Max)
+	case col.Min != nil && col.Max == nil && v < *col.Min:
+		return fmt.Sprintf("%s below %g", col.Name, *col.Min)
+	case col.Max != nil && col.Min == nil && v > *col.Max:
+		return fmt.Sprintf("%s above %g", col.Name, *col.Max)
+	}
+	return ""
+}
+
+// customValues returns the row's values by column, leaving out empty cells.
+func customValues(def *models.CustomStream, r *sheetRow) map[string]interface{} {
+	values := make(map[string]interface{}, len(def.Columns))
+	for _, col := range def.Columns {
+		if v := customValue(r.values[col.Name]); v != nil {
+			values[col.Name] = v
+		}
+	}
+	return values
+}
+
+// customUnit returns the unit of a custom reading as stored, nil without one.
+func customUnit(unit interface{}) *string {
+	switch v := customValue(unit).(type) {
+	case int:
+		s := strconv.Itoa(v)
+		return &s
+	case string:
+		return &v
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package ingest
+
+import (
+	"testing"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+func TestCheckCustomRange(t *testing.T) {
+	min, max := 0.0, 500.0
+	both := models.CustomColumn{Name: "flow", Min: &min, Max: &max}
+	for _, tc := range []struct {
+		col   models.CustomColumn
+		value interface{}
+		want  string
+	}{
+		{both, 250.0, ""},
+		{both, 501.0, "flow out of range (0-500)"},
+		{both, -1, "flow out of range (0-500)"},
+		{both, nil, ""},
+		{both, "high", ""},
+		{models.CustomColumn{Name: "flow", Min: &min}, -0.5, "flow below 0"},
+		{models.CustomColumn{Name: "flow", Max: &max}, 600, "flow above 500"},
+		{models.CustomColumn{Name: "flow"}, 1e9, ""},
+	} {
+		if got := checkCustomRange(tc.col, tc.value); got != tc.want {
+			t.Errorf("%v in %+v: expected %q, got %q", tc.value, tc.col, tc.want, got)
+		}
+	}
+}
+
+func TestCustomSheetStream(t *testing.T) {
+	unit := "pump_no"
+	def := &models.CustomStream{
+		Name: "ballast", Sheets: []string{"ballast"}, UnitColumn: &unit,
+		Columns: []models.CustomColumn{
+			{Name: "pump_no", Type: models.CustomInt, Headers: []string{"Pump No"}},
+			{Name: "flow_m3h", Type: models.CustomFloat, Headers: []string{"Flow (m3/h)"}},
+			{Name: "mode", Type: models.CustomText, Headers: []string{"mode"}},
+		},
+	}
+	s := customSheetStream(def)
+	if s.stream.Name != "ballast" || s.stream.Unit != "pump_no" || s.custom != def {
+		t.Fatalf("Unexpected stream %+v", s.stream)
+	}
+	if h := s.columns[0].headers[0]; h != "pump_no" {
+		t.Errorf("Expected normalized header pump_no, got %q", h)
+	}
+
+	r := &sheetRow{values: map[string]interface{}{}}
+	for _, col := range s.columns {
+		r.values[col.name] = col.parse("", map[string]string{"pump_no": "2", "flow_m3h": "120.5", "mode": ""}[col.name])
+	}
+	values := customValues(def, r)
+	if len(values) != 2 || values["pump_no"] != 2 || values["flow_m3h"] != 120.5 {
+		t.Errorf("Expected pump_no and flow_m3h, got %v", values)
+	}
+	if u := customUnit(r.values["pump_no"]); u == nil || *u != "2" {
+		t.Errorf("Expected unit 2, got %v", u)
+	}
+}
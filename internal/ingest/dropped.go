@@ -0,0 +1,93 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"vessel-telemetry-api/internal/fair"
+)
+
+// droppedExts are the files picked up from drop locations (SFTP, folders...)
+var droppedExts = map[string]bool{".xlsx": true, ".xls": true, ".ods": true, ".zip": true}
+
+// IsDroppedFile reports whether a file found in a drop location is one to
+// ingest: a workbook or a ZIP archive of them, and not a hidden or
+// temporary file such as Excel's ~$ lock files.
+func IsDroppedFile(filename string) bool {
+	base := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if strings.HasPrefix(base, ".") || strings.HasPrefix(base, "~$") {
+		return false
+	}
+	return droppedExts[strings.ToLower(path.Ext(base))]
+}
+
+// DroppedResult is the outcome of ingesting a dropped file.
+type DroppedResult struct {
+	Status string
+	// UploadIDs are the uploads of the workbooks ingested, or found already
+	// ingested
+	UploadIDs []int64
+}
+
+// SetScheduler makes dropped files wait for a slot of s, as tenant, so the
+// workers collecting them share the ingest slots fairly with uploads.
+func (p *XLSXProcessor) SetScheduler(s *fair.Scheduler, tenant string) {
+	p.scheduler, p.tenant = s, tenant
+}
+
+// acquireSlot waits for a slot of the processor's scheduler, if it has one.
+// A worker ingests one file at a time, so it never fills its queue; when
+// MaxWait passes it waits again rather than failing the file.
+func (p *XLSXProcessor) acquireSlot(ctx context.Context) (release func(), err error) {
+	if p.scheduler == nil {
+		return func() {}, nil
+	}
+	for {
+		release, err = p.scheduler.Acquire(ctx, p.tenant)
+		if errors.Is(err, fair.ErrWaitTimeout) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("waiting for an ingest slot: %w", err)
+		}
+		return release, nil
+	}
+}
+
+// ProcessDropped ingests a file picked up from a drop location rather than
+// uploaded: a ZIP archive as ProcessArchive would, a workbook as ProcessFile
+// would, in insert mode, in a slot of the scheduler set with SetScheduler.
+func (p *XLSXProcessor) ProcessDropped(ctx context.Context, data []byte, filename, imo, vesselName, source string) (DroppedResult, error) {
+	release, err := p.acquireSlot(ctx)
+	if err != nil {
+		return DroppedResult{}, err
+	}
+	defer release()
+
+	opts := IngestOptions{IMO: imo, VesselName: vesselName, Mode: ModeInsert, Source: source}
+	if strings.EqualFold(path.Ext(filename), ".zip") {
+		response, err := p.ProcessArchive(ctx, data, opts)
+		if err != nil {
+			return DroppedResult{}, err
+		}
+		result := DroppedResult{Status: response.Status}
+		for _, file := range response.Files {
+			if file.UploadID != nil {
+				result.UploadIDs = append(result.UploadIDs, *file.UploadID)
+			}
+		}
+		return result, nil
+	}
+	response, err := p.ProcessFile(ctx, data, path.Base(filename), opts)
+	if err != nil {
+		return DroppedResult{}, err
+	}
+	result := DroppedResult{Status: response.Status}
+	if response.UploadID != nil {
+		result.UploadIDs = []int64{*response.UploadID}
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package ingest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/fair"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+func TestProcessDroppedWaitsForSlot(t *testing.T) {
+	database, err := db.Connect(filepath.Join(t.TempDir(), "dropped.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	processor := NewXLSXProcessor(store.New(database), false)
+	// MaxWait passes while the upload holds the only slot
+	slots := fair.New("ingest-test", fair.Limits{Slots: 1, MaxWait: 10 * time.Millisecond})
+	processor.SetScheduler(slots, "worker:folder")
+
+	release, err := slots.Acquire(context.Background(), "org:acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := quotaWorkbook(t, "Dropped", 1.25, 10)
+	done := make(chan error, 1)
+	go func() {
+		_, err := processor.ProcessDropped(context.Background(), data, "day.xlsx", "9811000", "", models.SourceSensor)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the file to wait for the upload's slot, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if st := slots.Status(); st.InFlight != 0 {
+		t.Errorf("Expected the slot released after the file, got %+v", st)
+	}
+
+	// A cancelled worker gives up waiting
+	release, _ = slots.Acquire(context.Background(), "org:acme")
+	defer release()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := processor.ProcessDropped(ctx, quotaWorkbook(t, "Dropped", 1.25, 11), "day2.xlsx", "9811000", "", models.SourceSensor); err == nil {
+		t.Error("Expected a cancelled wait to fail")
+	}
+}
@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// engineRatedRPM returns the vessel's registered rated rpm by engine number,
+// for engines that have one.
+func (p *XLSXProcessor) engineRatedRPM(ctx context.Context, vesselID int64) (map[int]float64, error) {
+	engines, err := p.store.Engines(ctx, vesselID)
+	if err != nil {
+		return nil, err
+	}
+	rated := make(map[int]float64, len(engines))
+	for _, e := range engines {
+		if e.RatedRPM != nil {
+			rated[e.EngineNo] = *e.RatedRPM
+		}
+	}
+	return rated, nil
+}
+
+// checkEngineRPM returns a warning if rpm exceeds the rated rpm of the
+// engine. Unlike an impossible tank volume, overspeed does happen, so the
+// reading is still kept.
+func checkEngineRPM(rated map[int]float64, engineNo *int, rpm *float64) string {
+	if engineNo == nil || rpm == nil {
+		return ""
+	}
+	limit, ok := rated[*engineNo]
+	if !ok || *rpm <= limit {
+		return ""
+	}
+	return fmt.Sprintf("rpm %.0f exceeds the rated %.0f rpm of engine %d", *rpm, limit, *engineNo)
+}
+
+// openEngineSheet flags overspeed against the engine registry, whose rated
+// rpm rules read as rated_rpm, and, once the sheet is written, rebuilds the
+// alarm events and running hours and re-checks fuel drops.
+func openEngineSheet(s *sheetRun) sheetHooks {
+	rated, err := s.p.engineRatedRPM(s.ctx, s.vesselID)
+	if err != nil {
+		s.warn("%s: error reading engine registry: %v", s.name, err)
+	}
+	return sheetHooks{
+		prepare: func(r *sheetRow) string {
+			if engineNo := r.int("engine_no"); engineNo != nil {
+				if limit, ok := rated[*engineNo]; ok {
+					r.values["rated_rpm"] = &limit
+				}
+			}
+			return ""
+		},
+		check: func(r *sheetRow) string {
+			return checkEngineRPM(rated, r.int("engine_no"), r.float("rpm"))
+		},
+		done: func(since *time.Time) {
+			if since != nil {
+				if err := s.p.store.RebuildAlarmEvents(s.ctx, s.vesselID, *since); err != nil {
+					s.warn("%s: error updating alarm events: %v", s.name, err)
+				}
+				if err := s.p.store.RebuildRunningHours(s.ctx, s.vesselID, *since); err != nil {
+					s.warn("%s: error updating running hours: %v", s.name, err)
+				}
+			}
+			// Engines stopping can make earlier drops suspicious
+			s.addWarnings(s.p.checkFuelDrops(s.ctx, s.vesselID, s.name, since)...)
+		},
+	}
+}
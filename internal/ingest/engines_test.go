@@ -0,0 +1,22 @@
+package ingest
+
+import "testing"
+
+func TestCheckEngineRPM(t *testing.T) {
+	rated := map[int]float64{1: 750}
+	one, two := 1, 2
+	full, over := 750.0, 800.0
+
+	if warn := checkEngineRPM(rated, &one, &full); warn != "" {
+		t.Errorf("Expected the rated rpm to pass, got %q", warn)
+	}
+	if warn := checkEngineRPM(rated, &one, &over); warn == "" {
+		t.Error("Expected a warning for an rpm above rated")
+	}
+	if warn := checkEngineRPM(rated, &two, &over); warn != "" {
+		t.Errorf("Expected unregistered engines to pass, got %q", warn)
+	}
+	if warn := checkEngineRPM(rated, nil, &over); warn != "" {
+		t.Errorf("Expected readings without an engine number to pass, got %q", warn)
+	}
+}
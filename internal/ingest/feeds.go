@@ -0,0 +1,237 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/util"
+)
+
+// FeedLocation is the stream of feed readings that are positions.
+const FeedLocation = "location"
+
+// FeedReading is a reading decoded from a data feed rather than read from
+// a sheet: values of the fields of a stream, by field name, for a unit
+// (the engine, tank etc. number; empty for streams without units) at a
+// time.
+type FeedReading struct {
+	Stream string
+	Unit   string
+	TS     time.Time
+	Values map[string]string
+}
+
+// FeedData returns readings as the data of their upload, which it is
+// recorded and deduplicated by: a line per reading, in order, with its
+// values sorted by field.
+func FeedData(readings []FeedReading) []byte {
+	var data bytes.Buffer
+	for _, r := range readings {
+		fields := make([]string, 0, len(r.Values))
+		for field, v := range r.Values {
+			fields = append(fields, field+"="+v)
+		}
+		sort.Strings(fields)
+		fmt.Fprintf(&data, "%s,%s,%s,%s\n", r.TS.UTC().Format(time.RFC3339Nano), r.Stream, r.Unit, strings.Join(fields, ";"))
+	}
+	return data.Bytes()
+}
+
+// ProcessFeed ingests readings decoded from data, e.g. a batch of bus
+// messages, for the vessel of imo, recording the upload as filename. They
+// are read as sheets of their streams would be; of the positions, the
+// newest is written, as a Ship Info sheet's is.
+func (p *XLSXProcessor) ProcessFeed(ctx context.Context, data []byte, readings []FeedReading, filename, imo string, mode IngestMode, source string) (*models.IngestResponse, error) {
+	fileHash := util.SHA256Hex(data)
+	if response, err := p.alreadyIngested(ctx, fileHash); response != nil || err != nil {
+		return response, err
+	}
+	if imo == "" {
+		return nil, errors.New("an IMO number is required")
+	}
+	vessel, _, err := p.feedVessel(ctx, imo, "")
+	if err != nil {
+		return nil, err
+	}
+
+	sheets, overrides, aliases := feedWorkbook(readings, &vessel)
+	f, err := textWorkbook(sheets)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	matcher := p.newSheetMatcher(ctx, overrides)
+	matcher.aliases = aliases
+	return p.processWorkbook(ctx, f, filename, IngestOptions{IMO: imo, VesselName: vessel.Name, Mode: mode, Source: source}, 0, matcher, fileHash)
+}
+
+// ProcessVesselFeed ingests readings decoded from data for an existing
+// vessel, recording the upload as filename, as ProcessFeed does. Positions
+// are not read.
+func (p *XLSXProcessor) ProcessVesselFeed(ctx context.Context, data []byte, readings []FeedReading, filename string, vesselID int64, mode IngestMode, source string) (*models.IngestResponse, error) {
+	fileHash := util.SHA256Hex(data)
+	if response, err := p.alreadyIngested(ctx, fileHash); response != nil || err != nil {
+		return response, err
+	}
+
+	sheets, overrides, aliases := feedWorkbook(readings, nil)
+	if len(sheets) == 0 {
+		return nil, errors.New("no readings of a sheet stream")
+	}
+	f, err := textWorkbook(sheets)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Without a Ship Info sheet the workbook goes to the vessel given
+	matcher := p.newSheetMatcher(ctx, overrides)
+	matcher.aliases = aliases
+	return p.processWorkbook(ctx, f, filename, IngestOptions{Mode: mode, Source: source}, vesselID, matcher, fileHash)
+}
+
+// alreadyIngested returns the response to a file whose hash was ingested
+// before, nil if it was not.
+func (p *XLSXProcessor) alreadyIngested(ctx context.Context, fileHash string) (*models.IngestResponse, error) {
+	existingUploadID, err := p.store.FindUploadByHash(ctx, fileHash)
+	if err == nil {
+		return &models.IngestResponse{
+			Status:   "already_ingested",
+			UploadID: &existingUploadID,
+		}, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("error checking file hash: %w", err)
+	}
+	return nil, nil
+}
+
+// feedVessel returns the vessel of imo as the Ship Info sheet of a feed
+// names it: an existing vessel as it is, since feeds do not carry its
+// name, flag or type, with its ID; else a new one called vesselName, with
+// ID 0.
+func (p *XLSXProcessor) feedVessel(ctx context.Context, imo, vesselName string) (models.Vessel, int64, error) {
+	id, err := p.store.FindVesselByIMO(ctx, imo)
+	if errors.Is(err, store.ErrNotFound) {
+		return models.Vessel{IMO: &imo, Name: vesselName}, 0, nil
+	} else if err != nil {
+		return models.Vessel{}, 0, fmt.Errorf("error finding vessel: %w", err)
+	}
+	vessel, err := p.store.GetVessel(ctx, id)
+	if err != nil {
+		return models.Vessel{}, 0, fmt.Errorf("error reading vessel: %w", err)
+	}
+	return *vessel, id, nil
+}
+
+// feedKey is a unit of a stream at a time.
+type feedKey struct {
+	unit string
+	ts   time.Time
+}
+
+// feedWorkbook lays out feed readings as sheets, with the overrides that
+// read each as its stream and the aliases of their headers: a Ship Info
+// sheet with the vessel and its newest position, unless vessel is nil, and
+// a sheet per stream, its headers the stream's fields, with a row per unit
+// and time. Readings of the same unit and time are merged.
+func feedWorkbook(readings []FeedReading, vessel *models.Vessel) ([]textSheet, SheetOverrides, []models.HeaderAlias) {
+	streams := make(map[string]map[feedKey]map[string]string)
+	for _, r := range readings {
+		key := feedKey{unit: r.Unit, ts: r.TS.UTC()}
+		if streams[r.Stream] == nil {
+			streams[r.Stream] = make(map[feedKey]map[string]string)
+		}
+		if streams[r.Stream][key] == nil {
+			streams[r.Stream][key] = make(map[string]string)
+		}
+		for field, v := range r.Values {
+			streams[r.Stream][key][field] = v
+		}
+	}
+
+	var sheets []textSheet
+	if vessel != nil {
+		sheets = append(sheets, shipInfoSheet(streams[FeedLocation], vessel))
+	}
+	overrides := SheetOverrides{}
+	var aliases []models.HeaderAlias
+	names := make([]string, 0, len(streams))
+	for name := range streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields, ok := SheetFields(name)
+		if !ok {
+			continue
+		}
+		unit := store.Streams[name].Unit
+		header := append([]string{"Timestamp"}, fields[1:]...)
+		for _, field := range fields[1:] {
+			stream := name
+			aliases = append(aliases, models.HeaderAlias{Stream: &stream, Header: field, Field: field})
+		}
+		keys := make([]feedKey, 0, len(streams[name]))
+		for key := range streams[name] {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if !keys[i].ts.Equal(keys[j].ts) {
+				return keys[i].ts.Before(keys[j].ts)
+			}
+			return keys[i].unit < keys[j].unit
+		})
+		sheet := textSheet{name: name, rows: [][]string{header}}
+		for _, key := range keys {
+			values := streams[name][key]
+			row := make([]string, len(header))
+			row[0] = key.ts.Format(time.RFC3339Nano)
+			for i, field := range header[1:] {
+				if field == unit {
+					row[i+1] = key.unit
+				} else {
+					row[i+1] = values[field]
+				}
+			}
+			sheet.rows = append(sheet.rows, row)
+		}
+		sheets = append(sheets, sheet)
+		overrides[name] = name
+	}
+	return sheets, overrides, aliases
+}
+
+// shipInfoSheet returns the Ship Info sheet of a feed: the vessel, with the
+// newest of the positions that has a latitude and longitude.
+func shipInfoSheet(positions map[feedKey]map[string]string, vessel *models.Vessel) textSheet {
+	info := textSheet{name: "Ship Info", rows: [][]string{{"IMO", "Name", "Flag", "Type", "Timestamp", "Latitude", "Longitude", "Speed(knots)", "Course"}}}
+	row := []string{*vessel.IMO, vessel.Name, "", "", "", "", "", "", ""}
+	if vessel.Flag != nil {
+		row[2] = *vessel.Flag
+	}
+	if vessel.Type != nil {
+		row[3] = *vessel.Type
+	}
+	var newest *feedKey
+	for key, pos := range positions {
+		if pos["latitude"] != "" && pos["longitude"] != "" && (newest == nil || key.ts.After(newest.ts)) {
+			k := key
+			newest = &k
+		}
+	}
+	if newest != nil {
+		pos := positions[*newest]
+		row[4] = newest.ts.Format(time.RFC3339Nano)
+		row[5], row[6], row[7], row[8] = pos["latitude"], pos["longitude"], pos["speed_knots"], pos["course_degrees"]
+	}
+	info.rows = append(info.rows, row)
+	return info
+}
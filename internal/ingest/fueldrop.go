@@ -0,0 +1,42 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"vessel-telemetry-api/internal/fueldrop"
+)
+
+// SetFuelDropOptions sets how suspicious fuel drops are detected; a zero
+// MinDropLiters disables the detection.
+func (p *XLSXProcessor) SetFuelDropOptions(opts fueldrop.Options) {
+	p.fuelDrop = opts
+}
+
+// checkFuelDrops re-runs fuel drop detection after fuel or engine readings
+// from since on were written. Newly raised alerts are logged and returned as
+// warnings.
+func (p *XLSXProcessor) checkFuelDrops(ctx context.Context, vesselID int64, sheetName string, since *time.Time) []string {
+	if since == nil || p.fuelDrop.MinDropLiters <= 0 {
+		return nil
+	}
+
+	alerts, err := p.store.RebuildFuelDropAlerts(ctx, vesselID, *since, p.fuelDrop)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: error updating fuel drop alerts: %v", sheetName, err)}
+	}
+	var warnings []string
+	for _, a := range alerts {
+		tank := "-"
+		if a.TankNo != nil {
+			tank = fmt.Sprint(*a.TankNo)
+		}
+		warning := fmt.Sprintf("suspicious fuel drop: tank %s lost %.0f L between %s and %s (%.0f L/h, %s)",
+			tank, a.DropLiters, a.Start.Format(time.RFC3339), a.End.Format(time.RFC3339), a.RateLPH, a.Reason)
+		log.Printf("ALERT: vessel %d %s", vesselID, warning)
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
@@ -0,0 +1,150 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// Fuzz targets for everything that reads crew-edited workbooks. Run one with
+// e.g. go test ./internal/ingest -run '^$' -fuzz FuzzProcessFile -fuzztime 1m;
+// plain go test runs the seed corpus and the crashers kept in testdata/fuzz.
+
+func FuzzParseTimestamp(f *testing.F) {
+	for _, s := range []string{
+		"2025-08-08T10:00:00Z", "2025-08-08 10:00:00", "2025-08-08", "10:00",
+		"8/8/25 10:00", "08-08-25", "45877.4375", "25569", "73050.99999", "-1", "1e308", "NaN", "",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		ts, err := ParseTimestamp(s)
+		if err != nil && !ts.IsZero() {
+			t.Errorf("%q: timestamp %s returned with error %v", s, ts, err)
+		}
+	})
+}
+
+func FuzzParseFloat(f *testing.F) {
+	for _, s := range []string{"123.45", " 7 ", "-0", "1e308", "1e309", "NaN", "Inf", "0x1p-2", "1,5", ""} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		val, err := ParseFloat(s)
+		if err != nil && val != nil {
+			t.Errorf("%q: value %v returned with error %v", s, *val, err)
+		}
+		if s == "" && val != nil {
+			t.Errorf("empty string parsed as %v", *val)
+		}
+
+		n, err := ParseInt(s)
+		if err != nil && n != nil {
+			t.Errorf("%q: int %v returned with error %v", s, *n, err)
+		}
+	})
+}
+
+func FuzzHeaderMapper(f *testing.F) {
+	f.Add("Timestamp\tEngine No\tRPM\tTemperature C")
+	f.Add("Tank ID\tCapacity(m3)\tCurrent Level(m3)\tTemp(C)")
+	f.Add("Hora UTC\tMotor\tTemperatura (°C)\t\t \t-")
+	f.Fuzz(func(t *testing.T, row string) {
+		headers := strings.Split(row, "\t")
+		known := make(map[string]bool, len(headers))
+		for _, h := range headers {
+			known[h] = true
+		}
+
+		mapper := NewHeaderMapper(headers)
+		for _, patterns := range [][]string{{"engine_no", "engine"}, {"rpm"}, {"temp", "temperature"}, {""}} {
+			if h, ok := mapper.FindHeader(patterns...); ok && !known[h] {
+				t.Errorf("FindHeader(%v) returned %q, not one of the headers", patterns, h)
+			}
+		}
+		if h, ok := mapper.FindTimestampHeader(); ok && !known[h] {
+			t.Errorf("FindTimestampHeader returned %q, not one of the headers", h)
+		}
+	})
+}
+
+// fuzzWorkbook is a small workbook with every sheet type, including the odd
+// cells crews leave behind: blank rows, short rows, stray text in numbers.
+func fuzzWorkbook(f *testing.F) []byte {
+	x := excelize.NewFile()
+	defer x.Close()
+
+	sheets := []struct {
+		name string
+		rows [][]interface{}
+	}{
+		{"Ship Info", [][]interface{}{
+			{"Name", "IMO", "Timestamp", "Latitude", "Longitude", "Speed(knots)"},
+			{"Fuzz Ship", "9811000", "2025-08-08T10:00:00Z", "91", "abc", ""},
+		}},
+		{"Engines", [][]interface{}{
+			{"Timestamp", "Engine No", "RPM", "Temperature C"},
+			{"2025-08-08T10:00:00Z", "Main Engine 1", "1500", "85.5"},
+			{},
+			{"garbage", "", "n/a"},
+		}},
+		{"Fuel Tanks", [][]interface{}{{"Tank ID", "Capacity(m3)", "Current Level(m3)"}, {"fuelTank1", "0", "500"}}},
+		{"Generators", [][]interface{}{{"Generator", "Output(kW)", "Frequency(Hz)"}, {"Generator 1", "-5", "999"}}},
+		{"CCTV", [][]interface{}{{"Camera ID", "Status"}, {"", "active"}}},
+		{"Impact", [][]interface{}{{"Location", "Sensor Type", "Value"}, {"Bow", "Impact", "1e400"}}},
+	}
+	for i, sheet := range sheets {
+		if i == 0 {
+			x.SetSheetName("Sheet1", sheet.name)
+		} else {
+			x.NewSheet(sheet.name)
+		}
+		for r, row := range sheet.rows {
+			for c, v := range row {
+				cell, _ := excelize.CoordinatesToCellName(c+1, r+1)
+				x.SetCellValue(sheet.name, cell, v)
+			}
+		}
+	}
+
+	buf, err := x.WriteToBuffer()
+	if err != nil {
+		f.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func FuzzProcessFile(f *testing.F) {
+	f.Add(fuzzWorkbook(f))
+	for _, name := range []string{"sample_telemetry.xlsx", "ship_telemetry_extended.xlsx"} {
+		if data, err := os.ReadFile(filepath.Join("..", "..", name)); err == nil {
+			f.Add(data)
+		}
+	}
+	f.Add([]byte("PK\x03\x04not really a zip"))
+	f.Add(compoundFile("Workbook", xlsEngines()))
+	f.Add(odsFile(odsEngines, nil))
+
+	database, err := db.Connect(filepath.Join(f.TempDir(), "fuzz.db"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		f.Fatal(err)
+	}
+	processor := NewXLSXProcessor(store.New(database), true)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Errors are expected for most inputs; panics and hangs are not
+		processor.ProcessFile(context.Background(), data, "fuzz.xlsx", IngestOptions{IMO: "9811000", Mode: ModeUpsert, Source: models.SourceSensor})
+	})
+}
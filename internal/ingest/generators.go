@@ -0,0 +1,17 @@
+package ingest
+
+import "time"
+
+// openGeneratorSheet rebuilds the generator running hours once the sheet is
+// written.
+func openGeneratorSheet(s *sheetRun) sheetHooks {
+	return sheetHooks{
+		done: func(since *time.Time) {
+			if since != nil {
+				if err := s.p.store.RebuildGeneratorRunningHours(s.ctx, s.vesselID, *since); err != nil {
+					s.warn("%s: error updating running hours: %v", s.name, err)
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,126 @@
+package ingest
+
+import (
+	"context"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// inspectSamples is how many cells of each header Inspect returns.
+const inspectSamples = 3
+
+// Inspect reports how each sheet of a workbook, or a CSV file going by
+// filename, would be read: the stream it is matched to and the field each
+// header fills, as ProcessFile would map them with the sheet overrides and
+// the header aliases of the vessel (the global ones only for vesselID 0).
+// Nothing is written.
+func (p *XLSXProcessor) Inspect(ctx context.Context, fileData []byte, filename string, vesselID int64, overrides SheetOverrides) (*models.InspectResponse, error) {
+	var f *excelize.File
+	var err error
+	if strings.EqualFold(path.Ext(filename), ".csv") {
+		f, err = csvWorkbook(filename, fileData)
+	} else {
+		f, err = openWorkbook(fileData)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	aliases, err := p.headerAliases(ctx, vesselID)
+	if err != nil {
+		return nil, err
+	}
+	matcher := p.newSheetMatcher(ctx, overrides)
+	matcher.reportMissing = true
+	shipInfo := false
+	response := &models.InspectResponse{Filename: filename, Sheets: []models.SheetInspection{}}
+	for _, sheetName := range f.GetSheetList() {
+		rows, err := f.GetRows(sheetName)
+		if err != nil {
+			return nil, err
+		}
+		if _, overridden := overrides.lookup(sheetName); !overridden && !shipInfo && isShipInfoSheet(sheetName) {
+			// Only the first row of the first Ship Info sheet is read
+			shipInfo = true
+			if len(rows) > 2 {
+				rows = rows[:2]
+			}
+			response.Sheets = append(response.Sheets, inspectSheet(sheetName, "location", shipInfoColumns, nil, rows))
+			continue
+		}
+		if matcher.channelSheet(sheetName) {
+			response.Sheets = append(response.Sheets, inspectSheet(sheetName, ChannelReadings, channelReadingColumns, aliases, rows))
+			continue
+		}
+		if _, overridden := overrides.lookup(sheetName); !overridden && isNoonReportSheet(sheetName) {
+			response.Sheets = append(response.Sheets, inspectSheet(sheetName, NoonReports, noonReportColumns, aliases, rows))
+			continue
+		}
+		def, warn := matcher.match(sheetName)
+		if matcher.err != nil {
+			return nil, matcher.err
+		}
+		if warn != "" {
+			response.Warnings = append(response.Warnings, warn)
+		}
+		var stream string
+		var columns []sheetColumn
+		if def != nil {
+			stream, columns = def.stream.Name, def.columns
+		}
+		response.Sheets = append(response.Sheets, inspectSheet(sheetName, stream, columns, aliases, rows))
+	}
+	response.Warnings = append(response.Warnings, matcher.missing()...)
+	return response, nil
+}
+
+// inspectSheet maps the headers of a sheet's rows to the columns of its
+// stream, none if stream is empty.
+func inspectSheet(name, stream string, columns []sheetColumn, aliases []models.HeaderAlias, rows [][]string) models.SheetInspection {
+	sheet := models.SheetInspection{Sheet: name, Headers: []models.HeaderInspection{}}
+	if len(rows) == 0 {
+		return sheet
+	}
+	sheet.Rows = len(rows) - 1
+	headers := rows[0]
+
+	matches := make(map[string]models.HeaderInspection)
+	if stream != "" {
+		sheet.Stream = &stream
+		mapper := aliasedMapper(headers, stream, aliases)
+		// As processSheet does, each column takes the header best matching
+		// it; the timestamp wins over the others
+		for _, col := range columns {
+			if header, confidence := mapper.MatchField(col.name, col.headers...); header != "" && matches[header].Field == "" {
+				matches[header] = models.HeaderInspection{Field: col.name, Confidence: confidence}
+			}
+		}
+		if header, confidence := mapper.MatchField("ts", timestampHeaders...); header != "" {
+			matches[header] = models.HeaderInspection{Field: "ts", Confidence: confidence}
+		}
+	}
+
+	for j, header := range headers {
+		h := models.HeaderInspection{Header: header, Field: "unmapped", Samples: []string{}}
+		if m := matches[header]; m.Field != "" {
+			h.Field, h.Confidence = m.Field, math.Round(m.Confidence*100)/100
+			h.LowConfidence = m.Confidence < LowConfidence
+		}
+		for _, row := range rows[1:] {
+			if len(h.Samples) == inspectSamples {
+				break
+			}
+			if j < len(row) && row[j] != "" {
+				h.Samples = append(h.Samples, row[j])
+			}
+		}
+		sheet.Headers = append(sheet.Headers, h)
+	}
+	return sheet
+}
@@ -6,23 +6,46 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Excel serial dates accepted as timestamps: 1970-01-01 up to 2100-01-01.
+// Narrower than Excel's range so small numbers are not mistaken for dates.
+const (
+	minExcelSerial = 25569
+	maxExcelSerial = 73051
 )
 
+// LowConfidence is the confidence below which a header matched by
+// HeaderMapper.Match is likely a guess, e.g. a misspelling or a keyword
+// inside a longer word; ingests warn about such mappings.
+const LowConfidence = 0.75
+
 // HeaderMapper provides fuzzy matching for column headers
 type HeaderMapper struct {
-	headers map[string]string // normalized -> original
+	headers []mappedHeader      // in column order
+	aliases map[string][]string // headers by field, see AddAlias
 }
 
-func NewHeaderMapper(headers []string) *HeaderMapper {
-	hm := &HeaderMapper{
-		headers: make(map[string]string),
-	}
+type mappedHeader struct {
+	original string
+	tokens   []string
+}
 
+func NewHeaderMapper(headers []string) *HeaderMapper {
+	hm := &HeaderMapper{}
+	seen := make(map[string]bool)
 	for _, h := range headers {
 		normalized := normalizeHeader(h)
-		hm.headers[normalized] = h
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		hm.headers = append(hm.headers, mappedHeader{original: h, tokens: headerTokens(normalized)})
 	}
-
 	return hm
 }
 
@@ -33,30 +56,155 @@ func normalizeHeader(header string) string {
 	return h
 }
 
+// headerTokens splits a normalized header into its words: runs of letters,
+// digits and %, so "temp_(°c)" is temp and c.
+func headerTokens(h string) []string {
+	return strings.FieldsFunc(h, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '%'
+	})
+}
+
 func (hm *HeaderMapper) FindHeader(patterns ...string) (string, bool) {
+	header, _ := hm.Match(patterns...)
+	return header, header != ""
+}
+
+// Match returns the header best matching any of patterns and the confidence
+// of the match, from 0 (none, with an empty header) to 1 (the same words).
+// A closer match wins whatever the order of patterns, so of "Engine Status"
+// and "Nav Status", patterns "status" and "nav_status" pick the latter. On a
+// tie the earlier pattern, then the earlier header, wins.
+func (hm *HeaderMapper) Match(patterns ...string) (string, float64) {
+	best, bestScore := "", 0.0
 	for _, pattern := range patterns {
-		// Exact match first
-		if original, exists := hm.headers[pattern]; exists {
-			return original, true
+		tokens := headerTokens(normalizeHeader(pattern))
+		for _, h := range hm.headers {
+			if score := matchScore(tokens, h.tokens); score > bestScore {
+				best, bestScore = h.original, score
+			}
 		}
+	}
+	return best, bestScore
+}
 
-		// Substring match
-		for normalized, original := range hm.headers {
-			if strings.Contains(normalized, pattern) {
-				return original, true
+// matchScore rates how well a header's words match a pattern's: the mean
+// of how well each pattern word matches its best header word, scaled down
+// by the share of header words left over. A pattern word matching no
+// header word means no match.
+func matchScore(pattern, header []string) float64 {
+	if len(pattern) == 0 || len(header) == 0 {
+		return 0
+	}
+	used := make([]bool, len(header))
+	total := 0.0
+	for _, p := range pattern {
+		best, at := 0.0, -1
+		for i, h := range header {
+			if s := tokenScore(p, h); s > best {
+				best, at = s, i
 			}
 		}
+		if best == 0 {
+			return 0
+		}
+		used[at] = true
+		total += best
 	}
-	return "", false
+	matched := 0
+	for _, u := range used {
+		if u {
+			matched++
+		}
+	}
+	return total / float64(len(pattern)) * (0.9 + 0.1*float64(matched)/float64(len(header)))
+}
+
+// tokenScore rates one pattern word against one header word: 1 if equal,
+// less if the header word starts with it ("temp" for "temperature"), is
+// misspelled ("presure") or contains it ("oilpressure").
+func tokenScore(p, h string) float64 {
+	switch {
+	case p == h:
+		return 1
+	case utf8.RuneCountInString(p) < 3:
+		// "ts" is not the timestamp of "alerts"
+		return 0
+	case strings.HasPrefix(h, p):
+		return 0.85
+	case closeSpelling(p, h):
+		return 0.7
+	case strings.Contains(h, p):
+		return 0.6
+	}
+	return 0
+}
+
+// closeSpelling reports whether two words of 5 letters or more differ by
+// one edit, or two for words of 8 or more.
+func closeSpelling(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	n := len(ra)
+	if len(rb) < n {
+		n = len(rb)
+	}
+	if n < 5 {
+		return false
+	}
+	limit := 1
+	if n >= 8 {
+		limit = 2
+	}
+	return editDistance(ra, rb) <= limit
+}
+
+// editDistance is the Levenshtein distance of two words.
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// AddAlias adds header to those MatchField tries for field, before its
+// built-in patterns and after aliases added earlier.
+func (hm *HeaderMapper) AddAlias(field, header string) {
+	if hm.aliases == nil {
+		hm.aliases = make(map[string][]string)
+	}
+	hm.aliases[field] = append(hm.aliases[field], header)
+}
+
+// MatchField is Match of the field's aliases, then of patterns.
+func (hm *HeaderMapper) MatchField(field string, patterns ...string) (string, float64) {
+	if aliases := hm.aliases[field]; len(aliases) > 0 {
+		patterns = append(append([]string{}, aliases...), patterns...)
+	}
+	return hm.Match(patterns...)
+}
+
+// timestampHeaders are the headers taken for a row's timestamp.
+var timestampHeaders = []string{
+	"timestamp", "ts", "time", "date", "datetime",
+	"date_time", "time_stamp", "record_time", "log_time",
+	"created_at", "recorded_at", "sample_time", "measurement_time",
+	"utc", "local_time", "system_time", "event_time",
 }
 
 func (hm *HeaderMapper) FindTimestampHeader() (string, bool) {
-	return hm.FindHeader(
-		"timestamp", "ts", "time", "date", "datetime",
-		"date_time", "time_stamp", "record_time", "log_time",
-		"created_at", "recorded_at", "sample_time", "measurement_time",
-		"utc", "local_time", "system_time", "event_time",
-	)
+	return hm.FindHeader(timestampHeaders...)
 }
 
 // ParseFloat safely parses a string to float64
@@ -102,6 +250,9 @@ func ParseTimestamp(s string) (time.Time, error) {
 		"2006-01-02",
 		"15:04:05",
 		"15:04",
+		// Excel's built-in date formats, as excelize renders date cells
+		"1/2/06 15:04",
+		"01-02-06",
 	}
 
 	s = strings.TrimSpace(s)
@@ -112,6 +263,13 @@ func ParseTimestamp(s string) (time.Time, error) {
 		}
 	}
 
+	// Date cells without a date format come through as Excel serial numbers
+	if serial, err := strconv.ParseFloat(s, 64); err == nil && serial >= minExcelSerial && serial < maxExcelSerial {
+		if t, err := excelize.ExcelDateToTime(serial, false); err == nil {
+			return t.Round(time.Second), nil
+		}
+	}
+
 	return time.Time{}, fmt.Errorf("unable to parse timestamp: %s", s)
 }
 
@@ -168,6 +326,101 @@ func ValidateGeneratorData(load, voltage, frequency, fuelRate *float64) []string
 	return warnings
 }
 
+// ValidateBilgeData validates bilge well and ballast tank reading data
+func ValidateBilgeData(level, volume *float64) []string {
+	var warnings []string
+
+	if level != nil && (*level < 0 || *level > 100) {
+		warnings = append(warnings, "invalid water level percentage")
+	}
+
+	if volume != nil && *volume < 0 {
+		warnings = append(warnings, "negative water volume")
+	}
+
+	return warnings
+}
+
+// ValidateNavigationData validates navigation reading data
+func ValidateNavigationData(heading, rudderAngle, depthUnderKeel *float64) []string {
+	var warnings []string
+
+	if heading != nil && (*heading < 0 || *heading > 360) {
+		warnings = append(warnings, "heading out of range (0-360)")
+	}
+
+	if rudderAngle != nil && (*rudderAngle < -90 || *rudderAngle > 90) {
+		warnings = append(warnings, "rudder angle out of range (-90 to 90)")
+	}
+
+	if depthUnderKeel != nil && *depthUnderKeel < 0 {
+		warnings = append(warnings, "negative depth under keel")
+	}
+
+	return warnings
+}
+
+// ValidateMetData validates onboard weather sensor reading data
+func ValidateMetData(windSpeed, windDirection, pressure *float64, seaState *int) []string {
+	var warnings []string
+
+	if windSpeed != nil && *windSpeed < 0 {
+		warnings = append(warnings, "negative wind speed")
+	}
+
+	if windDirection != nil && (*windDirection < 0 || *windDirection > 360) {
+		warnings = append(warnings, "wind direction out of range (0-360)")
+	}
+
+	if pressure != nil && (*pressure < 850 || *pressure > 1100) {
+		warnings = append(warnings, "pressure out of range (850-1100 hPa)")
+	}
+
+	if seaState != nil && (*seaState < 0 || *seaState > 9) {
+		warnings = append(warnings, "sea state out of range (0-9)")
+	}
+
+	return warnings
+}
+
+// ValidatePowerData validates shore power and battery reading data
+func ValidatePowerData(shoreKW, soc *float64) []string {
+	var warnings []string
+
+	if shoreKW != nil && *shoreKW < 0 {
+		warnings = append(warnings, "negative shore power")
+	}
+
+	if soc != nil && (*soc < 0 || *soc > 100) {
+		warnings = append(warnings, "invalid state of charge percentage")
+	}
+
+	return warnings
+}
+
+// ValidateNetworkDeviceData validates network device reading data
+func ValidateNetworkDeviceData(uptimeHours, availability *float64) []string {
+	var warnings []string
+
+	if uptimeHours != nil && *uptimeHours < 0 {
+		warnings = append(warnings, "negative uptime")
+	}
+
+	if availability != nil && (*availability < 0 || *availability > 100) {
+		warnings = append(warnings, "invalid availability percentage")
+	}
+
+	return warnings
+}
+
+// ValidateUncertainty validates a reading's uncertainty estimate in percent
+func ValidateUncertainty(percent *float64) []string {
+	if percent != nil && (*percent < 0 || *percent > 100) {
+		return []string{"uncertainty out of range (0-100%)"}
+	}
+	return nil
+}
+
 // BuildExtraJSON creates JSON from unmapped columns
 func BuildExtraJSON(row map[string]string, mappedCols []string) (json.RawMessage, error) {
 	extra := make(map[string]string)
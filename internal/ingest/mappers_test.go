@@ -2,6 +2,7 @@ package ingest
 
 import (
 	"testing"
+	"time"
 )
 
 func TestHeaderMapper(t *testing.T) {
@@ -24,6 +25,47 @@ func TestHeaderMapper(t *testing.T) {
 	}
 }
 
+func TestHeaderMapperConfidence(t *testing.T) {
+	mapper := NewHeaderMapper([]string{"Engine Status", "Nav Status", "Temprature", "Oilpressure", "Alerts"})
+
+	// The exact match wins over the earlier pattern's partial one
+	if header, confidence := mapper.Match("status", "nav_status"); header != "Nav Status" || confidence != 1 {
+		t.Errorf("Expected 'Nav Status' with confidence 1, got %q %v", header, confidence)
+	}
+	// Partial matches tie: the earlier header wins
+	if header, confidence := mapper.Match("status"); header != "Engine Status" || confidence < LowConfidence {
+		t.Errorf("Expected 'Engine Status' with high confidence, got %q %v", header, confidence)
+	}
+	// Misspelled or run-together headers still match, with low confidence
+	if header, confidence := mapper.Match("temperature"); header != "Temprature" || confidence >= LowConfidence {
+		t.Errorf("Expected 'Temprature' with low confidence, got %q %v", header, confidence)
+	}
+	if header, confidence := mapper.Match("pressure"); header != "Oilpressure" || confidence >= LowConfidence {
+		t.Errorf("Expected 'Oilpressure' with low confidence, got %q %v", header, confidence)
+	}
+	// Short patterns only match whole words
+	if header, found := mapper.FindHeader("ts"); found {
+		t.Errorf("Expected no match for 'ts', got %q", header)
+	}
+	if header, found := mapper.FindHeader("rpm", "speed"); found {
+		t.Errorf("Expected no match, got %q", header)
+	}
+}
+
+func TestHeaderMapperAliases(t *testing.T) {
+	mapper := NewHeaderMapper([]string{"Exhaust Temp", "Suhu Mesin"})
+	if header, _ := mapper.MatchField("temp_c", "temp"); header != "Exhaust Temp" {
+		t.Errorf("Expected 'Exhaust Temp' without aliases, got %q", header)
+	}
+	mapper.AddAlias("temp_c", "suhu mesin")
+	if header, confidence := mapper.MatchField("temp_c", "temp"); header != "Suhu Mesin" || confidence != 1 {
+		t.Errorf("Expected the alias to win, got %q %v", header, confidence)
+	}
+	if header, _ := mapper.MatchField("rpm", "rpm"); header != "" {
+		t.Errorf("Expected aliases of other fields ignored, got %q", header)
+	}
+}
+
 func TestParseFloat(t *testing.T) {
 	// Valid float
 	if val, err := ParseFloat("123.45"); err != nil || val == nil || *val != 123.45 {
@@ -56,6 +98,25 @@ func TestParseTimestamp(t *testing.T) {
 		t.Errorf("Expected year 2025, got %d", ts.Year())
 	}
 
+	// Excel serial date
+	if ts, err := ParseTimestamp("45877.4166666667"); err != nil {
+		t.Errorf("Expected valid serial date, got error: %v", err)
+	} else if want := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC); !ts.Equal(want) {
+		t.Errorf("Expected %s, got %s", want, ts)
+	}
+
+	// Date cell rendered with Excel's default date-time format
+	if ts, err := ParseTimestamp("8/8/25 10:00"); err != nil {
+		t.Errorf("Expected valid date cell, got error: %v", err)
+	} else if want := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC); !ts.Equal(want) {
+		t.Errorf("Expected %s, got %s", want, ts)
+	}
+
+	// Small numbers are not dates
+	if _, err := ParseTimestamp("85"); err == nil {
+		t.Errorf("Expected error for small number")
+	}
+
 	// Invalid timestamp
 	if _, err := ParseTimestamp("invalid"); err == nil {
 		t.Errorf("Expected error for invalid timestamp")
@@ -81,6 +142,22 @@ func TestValidateEngineData(t *testing.T) {
 	}
 }
 
+func TestValidateUncertainty(t *testing.T) {
+	for _, v := range []float64{0, 3, 100} {
+		if warnings := ValidateUncertainty(&v); len(warnings) != 0 {
+			t.Errorf("Expected %v%% to be valid, got: %v", v, warnings)
+		}
+	}
+	for _, v := range []float64{-1, 150} {
+		if warnings := ValidateUncertainty(&v); len(warnings) == 0 {
+			t.Errorf("Expected a warning for %v%%", v)
+		}
+	}
+	if warnings := ValidateUncertainty(nil); len(warnings) != 0 {
+		t.Errorf("Expected no warning without an estimate, got: %v", warnings)
+	}
+}
+
 func TestValidateFuelData(t *testing.T) {
 	// Valid data
 	level := 75.0
@@ -99,3 +176,68 @@ func TestValidateFuelData(t *testing.T) {
 		t.Errorf("Expected warning for invalid fuel level")
 	}
 }
+
+func TestValidateBilgeData(t *testing.T) {
+	level := 40.0
+	volume := 12.5
+	if warnings := ValidateBilgeData(&level, &volume); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for valid data, got: %v", warnings)
+	}
+
+	invalidLevel := 101.0
+	negativeVolume := -1.0
+	if warnings := ValidateBilgeData(&invalidLevel, &negativeVolume); len(warnings) != 2 {
+		t.Errorf("Expected warnings for level and volume, got: %v", warnings)
+	}
+	if warnings := ValidateBilgeData(nil, nil); len(warnings) != 0 {
+		t.Errorf("Expected no warnings without values, got: %v", warnings)
+	}
+}
+
+func TestValidateNavigationData(t *testing.T) {
+	heading, rudder, depth := 271.5, -15.0, 4.2
+	if warnings := ValidateNavigationData(&heading, &rudder, &depth); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for valid data, got: %v", warnings)
+	}
+
+	badHeading, badRudder, badDepth := 361.0, 95.0, -0.5
+	if warnings := ValidateNavigationData(&badHeading, &badRudder, &badDepth); len(warnings) != 3 {
+		t.Errorf("Expected warnings for heading, rudder angle and depth, got: %v", warnings)
+	}
+}
+
+func TestValidateMetData(t *testing.T) {
+	speed, direction, pressure, seaState := 18.0, 225.0, 1012.5, 4
+	if warnings := ValidateMetData(&speed, &direction, &pressure, &seaState); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for valid data, got: %v", warnings)
+	}
+
+	badSpeed, badDirection, badPressure, badSeaState := -1.0, 400.0, 101.3, 12
+	if warnings := ValidateMetData(&badSpeed, &badDirection, &badPressure, &badSeaState); len(warnings) != 4 {
+		t.Errorf("Expected warnings for every field, got: %v", warnings)
+	}
+}
+
+func TestValidatePowerData(t *testing.T) {
+	shore, soc := 350.0, 64.5
+	if warnings := ValidatePowerData(&shore, &soc); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for valid data, got: %v", warnings)
+	}
+
+	negativeShore, invalidSOC := -5.0, 120.0
+	if warnings := ValidatePowerData(&negativeShore, &invalidSOC); len(warnings) != 2 {
+		t.Errorf("Expected warnings for shore power and state of charge, got: %v", warnings)
+	}
+}
+
+func TestValidateNetworkDeviceData(t *testing.T) {
+	uptime, availability := 1250.5, 99.2
+	if warnings := ValidateNetworkDeviceData(&uptime, &availability); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for valid data, got: %v", warnings)
+	}
+
+	negativeUptime, invalidAvailability := -1.0, 101.0
+	if warnings := ValidateNetworkDeviceData(&negativeUptime, &invalidAvailability); len(warnings) != 2 {
+		t.Errorf("Expected warnings for uptime and availability, got: %v", warnings)
+	}
+}
@@ -0,0 +1,143 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/noon"
+	"vessel-telemetry-api/internal/store"
+)
+
+// NoonReports is the name noon report sheets are counted under in ingest
+// responses and header aliases are matched by.
+const NoonReports = "noon_reports"
+
+// noonReportColumns are the headers read from noon report sheets, one
+// report per row at the row's timestamp.
+var noonReportColumns = []sheetColumn{
+	// Fuel remaining on board, in liters or m3
+	{"rob_fuel_liters", []string{"rob", "rob_fuel", "fuel_rob", "rob_liters", "Fuel ROB(m3)", "remaining_on_board"}, parseLiters},
+	{"distance_nm", []string{"distance", "distance_nm", "dist", "distance_run", "miles"}, parseNumber},
+	{"avg_speed_knots", []string{"avg_speed", "average_speed", "avg_speed_knots", "speed"}, parseNumber},
+	{"weather", []string{"weather", "weather_conditions", "conditions"}, parseText},
+	{"remarks", []string{"remarks", "remark", "comments", "notes"}, parseText},
+}
+
+// isNoonReportSheet reports whether a sheet holds noon reports.
+func isNoonReportSheet(name string) bool {
+	return strings.Contains(strings.ToLower(name), "noon")
+}
+
+// ValidateNoonReport validates the values of a noon report
+func ValidateNoonReport(rob, distance, speed *float64) []string {
+	var warnings []string
+
+	if rob != nil && *rob < 0 {
+		warnings = append(warnings, "negative fuel remaining on board")
+	}
+
+	if distance != nil && *distance < 0 {
+		warnings = append(warnings, "negative distance")
+	}
+
+	if speed != nil && (*speed < 0 || *speed > 50) {
+		warnings = append(warnings, "average speed out of range (0-50 knots)")
+	}
+
+	return warnings
+}
+
+// processNoonSheet writes the reports of a noon report sheet, then
+// reconciles them, and the vessel's later reports whose period they end,
+// with the telemetry. Flagged reports are returned as warnings.
+func (p *XLSXProcessor) processNoonSheet(ctx context.Context, f *excelize.File, sheetName string, vesselID, uploadID int64, aliases []models.HeaderAlias, defaultTS time.Time, mode IngestMode) (int, int, []models.UploadWarning) {
+	rows, err := f.GetRows(sheetName)
+	if err != nil || len(rows) < 2 {
+		return 0, 0, []models.UploadWarning{{Sheet: &sheetName, Message: fmt.Sprintf("error reading %s sheet", sheetName)}}
+	}
+
+	headers := rows[0]
+	mapper := aliasedMapper(headers, NoonReports, aliases)
+	run := &sheetRun{p: p, ctx: ctx, name: sheetName, vesselID: vesselID, mapper: mapper, headers: make(map[string]string)}
+	tsCol, confidence := mapper.MatchField("ts", timestampHeaders...)
+	run.checkConfidence(tsCol, "ts", confidence)
+	for _, col := range noonReportColumns {
+		header, confidence := mapper.MatchField(col.name, col.headers...)
+		run.checkConfidence(header, col.name, confidence)
+		run.headers[col.name] = header
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	inserted, updated := 0, 0
+	// Earliest report written
+	var since *time.Time
+
+	for i := 1; i < len(rows); i++ {
+		r := &sheetRow{ts: defaultTS, cells: make(map[string]string, len(headers)), values: make(map[string]interface{})}
+		for j, cell := range rows[i] {
+			if j < len(headers) {
+				r.cells[headers[j]] = cell
+			}
+		}
+		if tsCol != "" {
+			if parsedTS, err := ParseTimestamp(r.cells[tsCol]); err == nil {
+				r.ts = parsedTS
+			}
+		}
+		for _, col := range noonReportColumns {
+			if header := run.headers[col.name]; header != "" {
+				r.values[col.name] = col.parse(header, r.cells[header])
+			}
+		}
+		if problems := ValidateNoonReport(r.float("rob_fuel_liters"), r.float("distance_nm"), r.float("avg_speed_knots")); len(problems) > 0 {
+			run.warnRow(i+1, r, "%s: %s", NoonReports, strings.Join(problems, ", "))
+			continue
+		}
+		if r.float("rob_fuel_liters") == nil && r.float("distance_nm") == nil && r.float("avg_speed_knots") == nil &&
+			r.text("weather") == nil && r.text("remarks") == nil {
+			continue
+		}
+
+		reportedAt := r.ts.UTC()
+		report := models.NoonReport{
+			VesselID: vesselID, ReportedAt: reportedAt, UploadID: &uploadID,
+			ROBFuelLiters: r.float("rob_fuel_liters"), DistanceNM: r.float("distance_nm"), AvgSpeedKnots: r.float("avg_speed_knots"),
+			Weather: r.text("weather"), Remarks: r.text("remarks"),
+			// Reconciled once the sheet is written
+			PeriodStart: noon.Period(reportedAt, nil), Discrepancies: []models.NoonDiscrepancy{}, ReconciledAt: now,
+		}
+		result, err := p.store.PutNoonReport(ctx, report, mode == ModeUpsert)
+		if err != nil {
+			run.warnRow(i+1, r, "%s insert error: %v", NoonReports, err)
+			continue
+		}
+		switch result {
+		case store.WriteInserted:
+			inserted++
+		case store.WriteUpdated:
+			updated++
+		}
+		if result != store.WriteSkipped && (since == nil || reportedAt.Before(*since)) {
+			since = &reportedAt
+		}
+	}
+
+	if since != nil {
+		reports, err := noon.ReconcileFrom(ctx, p.store, vesselID, since, noon.DefaultOptions)
+		if err != nil {
+			run.warn("%s: error reconciling noon reports: %v", sheetName, err)
+		}
+		for _, report := range reports {
+			for _, d := range report.Discrepancies {
+				run.warn("noon report %s: %s %.1f reported, %.1f computed (%.1f%% off)",
+					report.ReportedAt.Format(time.RFC3339), d.Field, d.Reported, d.Computed, d.Percent)
+			}
+		}
+	}
+	return inserted, updated, run.warnings
+}
@@ -0,0 +1,263 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// odsMimeType is the mimetype entry of OpenDocument spreadsheets.
+const odsMimeType = "application/vnd.oasis.opendocument.spreadsheet"
+
+// ODS limits. Spreadsheets repeat their last row or column to the end of the
+// sheet, so repeats are only written out up to a cell that holds something.
+const (
+	maxODSRows    = 1 << 20
+	maxODSColumns = 1 << 14
+	maxODSCells   = 1 << 24
+)
+
+// OpenDocument namespaces
+const (
+	odsTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// isODS reports whether data is an OpenDocument spreadsheet: a ZIP archive
+// whose first, stored entry is the mimetype.
+func isODS(data []byte) bool {
+	return len(data) >= 38+len(odsMimeType) && bytes.HasPrefix(data, []byte("PK\x03\x04")) &&
+		string(data[30:38]) == "mimetype" && bytes.HasPrefix(data[38:], []byte(odsMimeType))
+}
+
+// odsWorkbook reads the tables of an OpenDocument spreadsheet (.ods) into a
+// workbook of text cells, as xlsWorkbook does. Date cells become RFC 3339
+// timestamps.
+func odsWorkbook(data []byte) (*excelize.File, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not an OpenDocument spreadsheet: %v", ErrUnsupportedFormat, err)
+	}
+	var content *zip.File
+	for _, zf := range r.File {
+		switch zf.Name {
+		case "content.xml":
+			content = zf
+		case "META-INF/manifest.xml":
+			manifest, err := readODSEntry(zf)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Contains(manifest, []byte("encryption-data")) {
+				return nil, fmt.Errorf("%w: the spreadsheet is password-protected", ErrUnsupportedFormat)
+			}
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("%w: the file holds no spreadsheet content", ErrUnsupportedFormat)
+	}
+	xmlData, err := readODSEntry(content)
+	if err != nil {
+		return nil, err
+	}
+	sheets, err := parseODSContent(xmlData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: corrupt .ods file: %v", ErrUnsupportedFormat, err)
+	}
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("%w: the spreadsheet has no sheets", ErrUnsupportedFormat)
+	}
+	return textWorkbook(sheets)
+}
+
+// readODSEntry reads a file of an .ods archive, not trusting the size in its
+// header.
+func readODSEntry(zf *zip.File) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: corrupt .ods file: %v", ErrUnsupportedFormat, err)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, maxUnzippedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: corrupt .ods file: %v", ErrUnsupportedFormat, err)
+	}
+	if len(content) > maxUnzippedSize {
+		return nil, fmt.Errorf("%w: spreadsheet exceeds %d MB", ErrUnsupportedFormat, maxUnzippedSize>>20)
+	}
+	return content, nil
+}
+
+// odsCell is a cell being read.
+type odsCell struct {
+	value   string // typed value, if any
+	text    strings.Builder
+	paras   int
+	repeat  int
+	hasText bool
+}
+
+// parseODSContent reads the tables of an OpenDocument content.xml.
+func parseODSContent(data []byte) ([]textSheet, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var sheets []textSheet
+	var sheet *textSheet
+	var cell *odsCell
+	row, col := 0, 0
+	rowRepeat := 1
+	// Rows read since the last that held a cell
+	pendingRows := 0
+	rowHasCells := false
+	// Depth of text:p in the current cell
+	inPara := 0
+	cells := 0
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == odsTableNS && t.Name.Local == "table":
+				sheets = append(sheets, textSheet{name: safeSheetName(odsAttr(t, odsTableNS, "name"))})
+				sheet = &sheets[len(sheets)-1]
+				row, pendingRows = 0, 0
+			case sheet == nil:
+			case t.Name.Space == odsTableNS && t.Name.Local == "table-row":
+				col, rowHasCells = 0, false
+				rowRepeat = odsRepeat(t, "number-rows-repeated", maxODSRows)
+				// Empty rows only count once a later row holds a cell
+				row += pendingRows
+				pendingRows = 0
+			case t.Name.Space == odsTableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				cell = &odsCell{repeat: odsRepeat(t, "number-columns-repeated", maxODSColumns)}
+				cell.value = odsCellValue(t)
+			case cell == nil:
+			case t.Name.Space == odsOfficeNS && t.Name.Local == "annotation":
+				// Comments are not cell content
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+			case t.Name.Space == odsTextNS && t.Name.Local == "p":
+				if cell.paras > 0 {
+					cell.text.WriteByte('\n')
+				}
+				cell.paras++
+				inPara++
+			case inPara == 0:
+			case t.Name.Space == odsTextNS && t.Name.Local == "s":
+				n, err := strconv.Atoi(odsAttr(t, odsTextNS, "c"))
+				if err != nil || n < 1 {
+					n = 1
+				}
+				cell.text.WriteString(strings.Repeat(" ", min(n, 1000)))
+				cell.hasText = true
+			case t.Name.Space == odsTextNS && t.Name.Local == "tab":
+				cell.text.WriteByte('\t')
+				cell.hasText = true
+			case t.Name.Space == odsTextNS && t.Name.Local == "line-break":
+				cell.text.WriteByte('\n')
+				cell.hasText = true
+			}
+		case xml.CharData:
+			if cell != nil && inPara > 0 {
+				cell.text.Write(t)
+				cell.hasText = cell.hasText || len(t) > 0
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == odsTextNS && t.Name.Local == "p":
+				if inPara > 0 {
+					inPara--
+				}
+			case sheet == nil:
+			case t.Name.Space == odsTableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				if cell == nil {
+					break
+				}
+				value := cell.value
+				if value == "" && cell.hasText {
+					value = cell.text.String()
+				}
+				if value != "" {
+					for i := 0; i < cell.repeat && col+i < maxODSColumns; i++ {
+						for r := 0; r < rowRepeat && row+r < maxODSRows; r++ {
+							if cells++; cells > maxODSCells {
+								return nil, errors.New("too many cells")
+							}
+							sheet.set(row+r, col+i, value)
+						}
+					}
+					rowHasCells = true
+				}
+				col += cell.repeat
+				cell, inPara = nil, 0
+			case t.Name.Space == odsTableNS && t.Name.Local == "table-row":
+				if rowHasCells {
+					row += rowRepeat
+				} else {
+					pendingRows += rowRepeat
+				}
+			case t.Name.Space == odsTableNS && t.Name.Local == "table":
+				sheet = nil
+			}
+		}
+	}
+	return sheets, nil
+}
+
+// odsCellValue returns the typed value of a cell, "" for text cells.
+func odsCellValue(t xml.StartElement) string {
+	switch odsAttr(t, odsOfficeNS, "value-type") {
+	case "float", "percentage", "currency":
+		v := odsAttr(t, odsOfficeNS, "value")
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return v
+	case "date":
+		v := odsAttr(t, odsOfficeNS, "date-value")
+		for _, layout := range []string{"2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if ts, err := time.Parse(layout, v); err == nil {
+				return ts.UTC().Format(time.RFC3339Nano)
+			}
+		}
+		return v
+	case "boolean":
+		return strings.ToUpper(odsAttr(t, odsOfficeNS, "boolean-value"))
+	}
+	// Text, and times (durations such as PT06H00M00S), are read as shown
+	return ""
+}
+
+// odsRepeat returns a repeat count attribute, 1 if absent, at most limit.
+func odsRepeat(t xml.StartElement, name string, limit int) int {
+	n, err := strconv.Atoi(odsAttr(t, odsTableNS, name))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return min(n, limit)
+}
+
+func odsAttr(t xml.StartElement, space, local string) string {
+	for _, a := range t.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// odsContent wraps the tables of a spreadsheet in a content.xml document.
+func odsContent(body string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="` + odsOfficeNS + `" xmlns:table="` + odsTableNS + `" xmlns:text="` + odsTextNS + `">
+<office:body><office:spreadsheet>` + body + `</office:spreadsheet></office:body></office:document-content>`)
+}
+
+// odsFile builds an .ods spreadsheet of the given tables, as LibreOffice
+// writes it: the mimetype first and stored.
+func odsFile(body string, extra map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	mt, _ := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	mt.Write([]byte(odsMimeType))
+	content, _ := w.Create("content.xml")
+	content.Write(odsContent(body))
+	for name, data := range extra {
+		f, _ := w.Create(name)
+		f.Write([]byte(data))
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+// odsEngines is an Engines table with a date column, numbers, a cell
+// repeated across columns and the trailing rows LibreOffice repeats to the
+// end of the sheet, then a sheet of notes with empty rows.
+const odsEngines = `<table:table table:name="Engines">
+<table:table-row>
+ <table:table-cell office:value-type="string"><text:p>Timestamp</text:p></table:table-cell>
+ <table:table-cell office:value-type="string"><text:p>Engine</text:p></table:table-cell>
+ <table:table-cell office:value-type="string"><text:p>RPM</text:p></table:table-cell>
+ <table:table-cell office:value-type="string"><text:p>Temperature<text:s text:c="2"/>C</text:p><office:annotation><text:p>note</text:p></office:annotation></table:table-cell>
+</table:table-row>
+<table:table-row>
+ <table:table-cell office:value-type="date" office:date-value="2024-01-01T00:00:00"><text:p>01/01/24 00:00</text:p></table:table-cell>
+ <table:table-cell office:value-type="string"><text:p>ME-1</text:p></table:table-cell>
+ <table:table-cell office:value-type="float" office:value="700" table:number-columns-repeated="2"><text:p>700.00</text:p></table:table-cell>
+</table:table-row>
+<table:table-row>
+ <table:table-cell office:value-type="date" office:date-value="2024-01-01T06:00:00"><text:p>01/01/24 06:00</text:p></table:table-cell>
+ <table:table-cell><text:p>ME-1</text:p></table:table-cell>
+ <table:table-cell office:value-type="float" office:value="720.5"><text:p>720.50</text:p></table:table-cell>
+ <table:table-cell/>
+ <table:table-cell office:value-type="boolean" office:boolean-value="true"><text:p>TRUE</text:p></table:table-cell>
+</table:table-row>
+<table:table-row table:number-rows-repeated="1048570"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table>
+<table:table table:name="Notes: week 1">
+<table:table-row><table:table-cell><text:p>a</text:p><text:p>b</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="2"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+<table:table-row><table:covered-table-cell/><table:table-cell><text:p>c</text:p></table:table-cell></table:table-row>
+</table:table>`
+
+func TestODSWorkbook(t *testing.T) {
+	f, err := openWorkbook(odsFile(odsEngines, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if sheets := f.GetSheetList(); len(sheets) != 2 || sheets[0] != "Engines" || sheets[1] != "Notes  week 1" {
+		t.Fatalf("Expected Engines and Notes sheets, got %q", sheets)
+	}
+	rows, err := f.GetRows("Engines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Timestamp", "Engine", "RPM", "Temperature  C"},
+		{"2024-01-01T00:00:00Z", "ME-1", "700", "700"},
+		{"2024-01-01T06:00:00Z", "ME-1", "720.5", "", "TRUE"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("Expected %d rows, got %q", len(want), rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("Row %d: expected %q, got %q", i, want[i], rows[i])
+		}
+	}
+	if notes, _ := f.GetRows("Notes  week 1"); len(notes) != 4 || notes[0][0] != "a\nb" || len(notes[1]) != 0 || notes[3][1] != "c" {
+		t.Errorf("Expected paragraphs on lines of their own and two empty rows, got %q", notes)
+	}
+}
+
+func TestODSWorkbookErrors(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"encrypted":  odsFile(odsEngines, map[string]string{"META-INF/manifest.xml": `<manifest:encryption-data/>`}),
+		"no sheets":  odsFile("", nil),
+		"corrupt":    odsFile(`<table:table table:name="Engines"><table:table-row>`, nil),
+		"truncated":  odsFile(odsEngines, nil)[:200],
+		"no content": zipOf(t, map[string]string{"mimetype": odsMimeType}, "mimetype"),
+	} {
+		if _, err := odsWorkbook(data); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("%s: expected ErrUnsupportedFormat, got %v", name, err)
+		}
+	}
+	if isODS(zipOf(t, map[string]string{"content.xml": ""}, "content.xml")) {
+		t.Error("A ZIP archive without the mimetype is not a spreadsheet")
+	}
+}
+
+func TestProcessODSFile(t *testing.T) {
+	database, err := db.Connect(filepath.Join(t.TempDir(), "ods.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	processor := NewXLSXProcessor(store.New(database), false)
+
+	response, err := processor.ProcessFile(context.Background(), odsFile(odsEngines, nil), "engines.ods", IngestOptions{IMO: "9811000", Mode: ModeInsert, Source: models.SourceSensor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RowsInserted["engines"] != 2 || len(response.Warnings) != 0 {
+		t.Errorf("Expected 2 engine rows, got %+v", response)
+	}
+}
+
+func FuzzODSContent(f *testing.F) {
+	f.Add(odsContent(odsEngines))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Errors are expected for most inputs; panics and hangs are not
+		parseODSContent(data)
+	})
+}
@@ -0,0 +1,100 @@
+package ingest
+
+import (
+	"fmt"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outliers"
+	"vessel-telemetry-api/internal/store"
+)
+
+// spikeFilters apply the filters of the sensors of a sheet's stream to its
+// rows, replacing spikes before they are validated and written.
+type spikeFilters struct {
+	run     *sheetRun
+	stream  *store.Stream
+	sensors map[string]models.Sensor // by unit, those with filters
+	// history holds the values kept of each sensor and field, oldest first
+	history map[string][]float64
+}
+
+// newSpikeFilters returns the filters of the vessel's sensors of the stream,
+// nil if none has any.
+func newSpikeFilters(run *sheetRun, stream *store.Stream) *spikeFilters {
+	if stream.Unit == "" {
+		return nil
+	}
+	sensors, err := run.p.store.Sensors(run.ctx, run.vesselID, stream.Name)
+	if err != nil {
+		run.warn("%s: error reading sensor filters: %v", run.name, err)
+		return nil
+	}
+	f := &spikeFilters{run: run, stream: stream, sensors: make(map[string]models.Sensor), history: make(map[string][]float64)}
+	for _, s := range sensors {
+		if len(s.Filters) > 0 {
+			f.sensors[s.Unit] = s
+		}
+	}
+	if len(f.sensors) == 0 {
+		return nil
+	}
+	return f
+}
+
+// apply filters row n, replacing outliers in r, and returns them to be
+// recorded once the row is written.
+func (f *spikeFilters) apply(n int, r *sheetRow) []models.Outlier {
+	unit := customValue(r.values[f.stream.Unit])
+	if unit == nil {
+		return nil
+	}
+	sensor, ok := f.sensors[fmt.Sprint(unit)]
+	if !ok {
+		return nil
+	}
+
+	var found []models.Outlier
+	for _, sf := range sensor.Filters {
+		v := r.float(sf.Field)
+		if v == nil {
+			continue
+		}
+		key := fmt.Sprintf("%d/%s", sensor.ID, sf.Field)
+		history, loaded := f.history[key]
+		if !loaded {
+			var err error
+			if history, err = f.run.p.store.RecentValues(f.run.ctx, f.stream, sensor.ID, sf.Field, r.ts, sf.Window); err != nil {
+				f.run.warn("%s: error reading %s history of %s %s: %v", f.run.name, sf.Field, f.stream.Unit, sensor.Unit, err)
+				history = []float64{}
+			}
+		}
+		filter := outliers.Filter{Method: sf.Method, Window: sf.Window, Threshold: sf.Threshold, Low: sf.Low, High: sf.High}
+		kept, outlier := filter.Apply(history, *v)
+		if outlier {
+			f.run.warnRow(n, r, "%s: %s %g is an outlier (%s), stored as %g", f.stream.Name, sf.Field, *v, sf.Method, kept)
+			found = append(found, models.Outlier{
+				VesselID: f.run.vesselID, Stream: f.stream.Name, SensorID: sensor.ID, Unit: sensor.Unit,
+				TS: r.ts, Field: sf.Field, Raw: *v, Stored: kept, Method: sf.Method,
+			})
+			r.values[sf.Field] = &kept
+		}
+		history = append(history, kept)
+		if len(history) > sf.Window {
+			history = history[len(history)-sf.Window:]
+		}
+		f.history[key] = history
+	}
+	return found
+}
+
+// record keeps the raw values of a written row's outliers.
+func (f *spikeFilters) record(found []models.Outlier) {
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, o := range found {
+		o.CreatedAt = now
+		if err := f.run.p.store.AddOutlier(f.run.ctx, o); err != nil {
+			f.run.warn("%s: error recording outlier: %v", f.run.name, err)
+		}
+	}
+}
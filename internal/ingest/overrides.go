@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// SheetOverrides name the stream sheets of one upload are read as, by sheet
+// name, for workbooks whose sheet names lack the keywords streams are
+// matched by. Sheet names are compared case-insensitively.
+type SheetOverrides map[string]string
+
+// ParseSheetOverride reads an override of the form "Sheet3=generators"; the
+// sheet name is what comes before the last "=".
+func ParseSheetOverride(s string) (sheet, stream string, err error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid sheet override %q, use <sheet name>=<stream>", s)
+	}
+	sheet, stream = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	if sheet == "" || stream == "" {
+		return "", "", fmt.Errorf("invalid sheet override %q, use <sheet name>=<stream>", s)
+	}
+	return sheet, stream, nil
+}
+
+func (o SheetOverrides) lookup(sheetName string) (string, bool) {
+	for sheet, stream := range o {
+		if strings.EqualFold(strings.TrimSpace(sheetName), sheet) {
+			return stream, true
+		}
+	}
+	return "", false
+}
+
+// sheetMatcher picks the stream of each sheet of a workbook: that of its
+// override, else the first of the built-in and then the custom streams
+// whose sheet names it matches. Custom streams are loaded once a sheet
+// needs them.
+type sheetMatcher struct {
+	p         *XLSXProcessor
+	ctx       context.Context
+	overrides SheetOverrides
+	custom    []sheetStream
+	loaded    bool
+	// err is the error loading the custom streams, if any
+	err error
+	// matched are the overridden sheets seen
+	matched map[string]bool
+	// reportMissing is set when the matcher sees every sheet of the upload,
+	// so overrides of sheets it has not seen name no sheet of it
+	reportMissing bool
+	// aliases are header aliases of the upload itself, matched before the
+	// stored ones
+	aliases []models.HeaderAlias
+}
+
+func (p *XLSXProcessor) newSheetMatcher(ctx context.Context, overrides SheetOverrides) *sheetMatcher {
+	return &sheetMatcher{p: p, ctx: ctx, overrides: overrides, matched: make(map[string]bool)}
+}
+
+// match returns the stream a sheet is read as, nil if none. An override
+// naming no stream also gives nil; warning says why.
+func (m *sheetMatcher) match(sheetName string) (def *sheetStream, warning string) {
+	if name, ok := m.overrides.lookup(sheetName); ok {
+		m.matched[strings.ToLower(strings.TrimSpace(sheetName))] = true
+		if def := namedSheetStream(sheetStreams, name); def != nil {
+			return def, ""
+		}
+		if def := namedSheetStream(m.customStreams(), name); def != nil {
+			return def, ""
+		}
+		return nil, fmt.Sprintf("sheet %s: unknown stream %s, sheet skipped", sheetName, name)
+	}
+	if def := matchSheet(sheetStreams, sheetName); def != nil {
+		return def, ""
+	}
+	return matchSheet(m.customStreams(), sheetName), ""
+}
+
+func (m *sheetMatcher) customStreams() []sheetStream {
+	if !m.loaded {
+		m.loaded = true
+		m.custom, m.err = m.p.customSheetStreams(m.ctx)
+	}
+	return m.custom
+}
+
+// missing returns warnings about the overrides of sheets the upload does
+// not have, none unless reportMissing.
+func (m *sheetMatcher) missing() []string {
+	if !m.reportMissing {
+		return nil
+	}
+	var warnings []string
+	for sheet := range m.overrides {
+		if !m.matched[strings.ToLower(sheet)] {
+			warnings = append(warnings, fmt.Sprintf("sheet override %s: no such sheet", sheet))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// namedSheetStream returns the stream of streams with the name, nil if none.
+func namedSheetStream(streams []sheetStream, name string) *sheetStream {
+	for i := range streams {
+		if streams[i].stream.Name == name {
+			return &streams[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package ingest
+
+// openPowerSheet nets a separate discharge column into battery_kw, which is
+// negative while discharging.
+func openPowerSheet(s *sheetRun) sheetHooks {
+	if !s.has("discharge_kw") {
+		return sheetHooks{}
+	}
+	// "charge_kw" also matches a lone "Discharge kW" header
+	hasCharge := s.has("battery_kw") && s.headers["battery_kw"] != s.headers["discharge_kw"]
+	return sheetHooks{
+		prepare: func(r *sheetRow) string {
+			charge, discharge := r.float("battery_kw"), r.float("discharge_kw")
+			if !hasCharge {
+				charge = nil
+			}
+			if charge == nil && discharge == nil {
+				r.values["battery_kw"] = (*float64)(nil)
+				return ""
+			}
+			var net float64
+			if charge != nil {
+				net = *charge
+			}
+			if discharge != nil {
+				net -= *discharge
+			}
+			r.values["battery_kw"] = &net
+			return ""
+		},
+	}
+}
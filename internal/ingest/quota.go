@@ -0,0 +1,126 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// ErrQuotaExceeded is returned when a throttled vessel has used up its daily row quota.
+var ErrQuotaExceeded = errors.New("daily row quota exceeded")
+
+const quotaDayLayout = "2006-01-02"
+
+// SetDefaultQuota sets the policy used for vessels without an override.
+func (p *XLSXProcessor) SetDefaultQuota(policy models.QuotaPolicy) {
+	p.defaultQuota = policy
+}
+
+// QuotaFor returns the effective policy for a vessel and whether it comes from
+// a per-vessel override.
+func (p *XLSXProcessor) QuotaFor(ctx context.Context, vesselID int64) (models.QuotaPolicy, bool, error) {
+	policy, override, err := p.store.QuotaOverride(ctx, vesselID)
+	if err != nil {
+		return models.QuotaPolicy{}, false, err
+	}
+	if !override {
+		return p.defaultQuota, false, nil
+	}
+	return policy, true, nil
+}
+
+// CheckQuota refuses ingest for throttled vessels whose quota for today is
+// used up, with ErrQuotaExceeded. Sources that write past the processor,
+// such as the AIS poller, call it themselves.
+func (p *XLSXProcessor) CheckQuota(ctx context.Context, vesselID int64) error {
+	policy, _, err := p.QuotaFor(ctx, vesselID)
+	if err != nil {
+		return err
+	}
+	if policy.DailyRowLimit <= 0 || !policy.Throttle {
+		return nil
+	}
+
+	used, err := p.store.DailyUsage(ctx, vesselID, p.now().UTC().Format(quotaDayLayout))
+	if err != nil {
+		return err
+	}
+	if used >= policy.DailyRowLimit {
+		return fmt.Errorf("%w: vessel %d ingested %d of %d rows today", ErrQuotaExceeded, vesselID, used, policy.DailyRowLimit)
+	}
+	return nil
+}
+
+// RecordUsage adds written rows to today's counter and returns a warning when
+// the vessel is over its quota. The first crossing per day is logged as an alert.
+func (p *XLSXProcessor) RecordUsage(ctx context.Context, vesselID int64, rows int) string {
+	if rows <= 0 {
+		return ""
+	}
+
+	day := p.now().UTC().Format(quotaDayLayout)
+	if err := p.store.AddDailyUsage(ctx, vesselID, day, rows); err != nil {
+		return ""
+	}
+
+	policy, _, err := p.QuotaFor(ctx, vesselID)
+	if err != nil || policy.DailyRowLimit <= 0 {
+		return ""
+	}
+
+	used, err := p.store.DailyUsage(ctx, vesselID, day)
+	if err != nil || used <= policy.DailyRowLimit {
+		return ""
+	}
+
+	if first, err := p.store.MarkQuotaAlerted(ctx, vesselID, day, p.now().UTC()); err == nil && first {
+		log.Printf("ALERT: vessel %d exceeded daily row quota (%d/%d rows on %s), check onboard logger configuration",
+			vesselID, used, policy.DailyRowLimit, day)
+	}
+
+	return fmt.Sprintf("daily row quota exceeded: %d of %d rows ingested today", used, policy.DailyRowLimit)
+}
+
+// QuotaStatus reports a vessel's effective quota, today's usage and recent
+// days on which the quota was exceeded.
+func (p *XLSXProcessor) QuotaStatus(ctx context.Context, vesselID int64) (*models.QuotaStatus, error) {
+	policy, override, err := p.QuotaFor(ctx, vesselID)
+	if err != nil {
+		return nil, err
+	}
+
+	day := p.now().UTC().Format(quotaDayLayout)
+	used, err := p.store.DailyUsage(ctx, vesselID, day)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := p.store.QuotaAlerts(ctx, vesselID, 30)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.QuotaStatus{
+		VesselID:      vesselID,
+		DailyRowLimit: policy.DailyRowLimit,
+		Throttle:      policy.Throttle,
+		Override:      override,
+		Day:           day,
+		RowsToday:     used,
+		Exceeded:      policy.DailyRowLimit > 0 && used > policy.DailyRowLimit,
+		Alerts:        alerts,
+	}, nil
+}
+
+// SetQuota stores a per-vessel quota override.
+func (p *XLSXProcessor) SetQuota(ctx context.Context, vesselID int64, policy models.QuotaPolicy) error {
+	return p.store.SetQuotaOverride(ctx, vesselID, policy)
+}
+
+// ClearQuota removes a per-vessel override so the default policy applies again.
+func (p *XLSXProcessor) ClearQuota(ctx context.Context, vesselID int64) error {
+	return p.store.ClearQuotaOverride(ctx, vesselID)
+}
@@ -0,0 +1,125 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// quotaWorkbook is a day's file of the vessel named name: its Ship Info,
+// with a position half past the first of hours, and an engine reading per
+// hour of hours.
+func quotaWorkbook(t *testing.T, name string, lat float64, hours ...int) []byte {
+	t.Helper()
+	x := excelize.NewFile()
+	defer x.Close()
+	x.SetSheetName("Sheet1", "Ship Info")
+	x.SetSheetRow("Ship Info", "A1", &[]interface{}{"Name", "IMO", "Timestamp", "Latitude", "Longitude"})
+	x.SetSheetRow("Ship Info", "A2", &[]interface{}{name, "9811000", fmt.Sprintf("2025-08-08T%02d:30:00Z", hours[0]), lat, "103.8"})
+	x.NewSheet("Engines")
+	x.SetSheetRow("Engines", "A1", &[]interface{}{"Timestamp", "Engine No", "RPM"})
+	for i, h := range hours {
+		x.SetSheetRow("Engines", fmt.Sprintf("A%d", i+2), &[]interface{}{fmt.Sprintf("2025-08-08T%02d:00:00Z", h), "1", "1500"})
+	}
+	buf, err := x.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestQuota(t *testing.T) {
+	database, err := db.Connect(filepath.Join(t.TempDir(), "quota.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	st := store.New(database)
+	processor := NewXLSXProcessor(st, false)
+	today := time.Date(2025, 8, 8, 12, 0, 0, 0, time.UTC)
+	processor.now = func() time.Time { return today }
+	ctx := context.Background()
+
+	ingest := func(data []byte) (*models.IngestResponse, error) {
+		return processor.ProcessFile(ctx, data, "day.xlsx", IngestOptions{IMO: "9811000", Mode: ModeInsert, Source: models.SourceSensor})
+	}
+	// 3 rows: the position and 2 engine readings; each later file writes 2
+	first, err := ingest(quotaWorkbook(t, "Quota", 1.25, 10, 11))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vesselID := *first.VesselID
+
+	// Not throttled: over the quota is a warning, alerted once a day
+	if err := processor.SetQuota(ctx, vesselID, models.QuotaPolicy{DailyRowLimit: 6}); err != nil {
+		t.Fatal(err)
+	}
+	for i, hour := range []int{12, 13} {
+		response, err := ingest(quotaWorkbook(t, "Quota", 1.25, hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if over := len(response.Warnings) > 0; over != (i == 1) {
+			t.Errorf("File %d: expected a quota warning only once over the quota, got %+v", i+2, response.Warnings)
+		}
+	}
+	status, err := processor.QuotaStatus(ctx, vesselID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RowsToday != 7 || !status.Exceeded || status.Day != "2025-08-08" || len(status.Alerts) != 1 {
+		t.Errorf("Expected 7 rows over the quota with 1 alert, got %+v", status)
+	}
+	if _, err := ingest(quotaWorkbook(t, "Quota", 1.25, 14)); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := processor.QuotaStatus(ctx, vesselID); len(status.Alerts) != 1 {
+		t.Errorf("Expected still 1 alert for the day, got %+v", status.Alerts)
+	}
+
+	// Throttled: refused before the vessel or its position is written
+	if err := processor.SetQuota(ctx, vesselID, models.QuotaPolicy{DailyRowLimit: 6, Throttle: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ingest(quotaWorkbook(t, "Renamed", 2.5, 15)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	var name string
+	if err := database.QueryRow("SELECT name FROM vessels WHERE id = ?", vesselID).Scan(&name); err != nil || name != "Quota" {
+		t.Errorf("Expected the vessel left as it was, got %q, %v", name, err)
+	}
+	var positions int
+	database.QueryRow("SELECT COUNT(*) FROM location_readings WHERE vessel_id = ? AND latitude = 2.5", vesselID).Scan(&positions)
+	if positions != 0 {
+		t.Errorf("Expected no position written, got %d", positions)
+	}
+
+	// The quota starts over the next day
+	today = today.Add(24 * time.Hour)
+	if _, err := ingest(quotaWorkbook(t, "Renamed", 2.5, 15)); err != nil {
+		t.Fatalf("Expected the next day's file accepted, got %v", err)
+	}
+	if status, _ := processor.QuotaStatus(ctx, vesselID); status.RowsToday != 2 || status.Exceeded {
+		t.Errorf("Expected 2 rows on the new day, got %+v", status)
+	}
+
+	// Clearing the override applies the default, none here
+	if err := processor.ClearQuota(ctx, vesselID); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := processor.QuotaStatus(ctx, vesselID); status.Override || status.DailyRowLimit != 0 {
+		t.Errorf("Expected the default quota, got %+v", status)
+	}
+}
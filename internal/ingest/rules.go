@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/rules"
+)
+
+// ruleExtras are the fields rules may read besides a stream's own, which
+// its sheet hooks set on each row.
+var ruleExtras = map[string][]string{
+	"engines": {"rated_rpm"},
+}
+
+// streamRule is a validation rule ready to check rows with.
+type streamRule struct {
+	models.ValidationRule
+	rule *rules.Rule
+}
+
+// validationRules returns the validation rules by stream. Rules that no
+// longer parse are left out, with a warning each.
+func (p *XLSXProcessor) validationRules(ctx context.Context) (map[string][]streamRule, []string, error) {
+	all, err := p.store.ValidationRules(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byStream := make(map[string][]streamRule)
+	var warnings []string
+	for _, r := range all {
+		rule, err := rules.Parse(r.Expression)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("validation rule %d: %v, rule skipped", r.ID, err))
+			continue
+		}
+		byStream[r.Stream] = append(byStream[r.Stream], streamRule{r, rule})
+	}
+	return byStream, warnings, nil
+}
+
+// RuleFields returns the fields validation rules of a built-in stream read
+// from sheets may use; false if no built-in stream is read from sheets by
+// that name.
+func RuleFields(stream string) ([]string, bool) {
+	def := namedSheetStream(sheetStreams, stream)
+	if def == nil {
+		return nil, false
+	}
+	return ruleFields(def), true
+}
+
+// ruleFields returns the columns of a sheet stream, the fields derived from
+// them and its rule extras.
+func ruleFields(def *sheetStream) []string {
+	var fields []string
+	seen := map[string]bool{"source": true}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	for _, col := range def.columns {
+		add(col.name)
+	}
+	for _, name := range def.stream.FieldNames() {
+		add(name)
+	}
+	for _, name := range ruleExtras[def.stream.Name] {
+		add(name)
+	}
+	return fields
+}
+
+// rowRules are the validation rules of the stream a sheet is read as.
+type rowRules struct {
+	stream string
+	rules  []streamRule
+	fields map[string]bool
+}
+
+func newRowRules(def *sheetStream, rules []streamRule) *rowRules {
+	rr := &rowRules{stream: def.stream.Name, rules: rules, fields: make(map[string]bool)}
+	for _, name := range ruleFields(def) {
+		rr.fields[name] = true
+	}
+	return rr
+}
+
+// check checks row n against the rules, warning about each it fails, and
+// reports whether a failed rule rejects the row.
+func (rr *rowRules) check(s *sheetRun, n int, r *sheetRow) bool {
+	lookup := func(name string) (interface{}, bool) {
+		if !rr.fields[name] {
+			return nil, false
+		}
+		if v, ok := customValue(r.values[name]).(int); ok {
+			return float64(v), true
+		}
+		return customValue(r.values[name]), true
+	}
+	reject := false
+	for _, rule := range rr.rules {
+		holds, _, err := rule.rule.Eval(lookup)
+		if err != nil {
+			s.warnRow(n, r, "%s: validation rule %d: %v", rr.stream, rule.ID, err)
+			continue
+		}
+		if holds {
+			continue
+		}
+		about := rule.Expression
+		if rule.Description != nil {
+			about = *rule.Description
+		}
+		s.warnRow(n, r, "%s: fails validation rule %d (%s)", rr.stream, rule.ID, about)
+		if rule.Action == models.RuleReject {
+			reject = true
+		}
+	}
+	return reject
+}
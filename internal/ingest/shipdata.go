@@ -0,0 +1,196 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/shipdata"
+	"vessel-telemetry-api/internal/store"
+	"vessel-telemetry-api/internal/util"
+)
+
+// ChannelReadings is the stream sheets of generic data channel readings are
+// overridden to, and the name they are counted under in ingest responses
+// and header aliases are matched by.
+const ChannelReadings = "channels"
+
+// channelReadingColumns are the headers read from data channel sheets, one
+// reading of a channel per row at the row's timestamp.
+var channelReadingColumns = []sheetColumn{
+	{"channel_id", []string{"channel_id", "channel", "data_channel_id", "Channel ID"}, parseText},
+	{"value", []string{"value", "reading"}, parseText},
+	{"quality", []string{"quality"}, parseText},
+	{"event", []string{"event"}, parseText},
+}
+
+// channelSheet reports whether a sheet is overridden to data channel
+// readings, noting the override as seen.
+func (m *sheetMatcher) channelSheet(sheetName string) bool {
+	if name, ok := m.overrides.lookup(sheetName); ok && name == ChannelReadings {
+		m.matched[strings.ToLower(strings.TrimSpace(sheetName))] = true
+		return true
+	}
+	return false
+}
+
+// processChannelSheet writes the readings of a data channel sheet: numbers
+// as values, anything else as text.
+func (p *XLSXProcessor) processChannelSheet(ctx context.Context, f *excelize.File, sheetName string, vesselID, uploadID int64, aliases []models.HeaderAlias, defaultTS time.Time, mode IngestMode) (int, int, []models.UploadWarning) {
+	rows, err := f.GetRows(sheetName)
+	if err != nil || len(rows) < 2 {
+		return 0, 0, []models.UploadWarning{{Sheet: &sheetName, Message: fmt.Sprintf("error reading %s sheet", sheetName)}}
+	}
+
+	headers := rows[0]
+	mapper := aliasedMapper(headers, ChannelReadings, aliases)
+	run := &sheetRun{p: p, ctx: ctx, name: sheetName, vesselID: vesselID, mapper: mapper, headers: make(map[string]string)}
+	tsCol, confidence := mapper.MatchField("ts", timestampHeaders...)
+	run.checkConfidence(tsCol, "ts", confidence)
+	for _, col := range channelReadingColumns {
+		header, confidence := mapper.MatchField(col.name, col.headers...)
+		run.checkConfidence(header, col.name, confidence)
+		run.headers[col.name] = header
+	}
+
+	inserted, updated := 0, 0
+	for i := 1; i < len(rows); i++ {
+		r := &sheetRow{ts: defaultTS, cells: make(map[string]string, len(headers)), values: make(map[string]interface{})}
+		for j, cell := range rows[i] {
+			if j < len(headers) {
+				r.cells[headers[j]] = cell
+			}
+		}
+		if tsCol != "" {
+			if parsedTS, err := ParseTimestamp(r.cells[tsCol]); err == nil {
+				r.ts = parsedTS
+			}
+		}
+		for _, col := range channelReadingColumns {
+			if header := run.headers[col.name]; header != "" {
+				r.values[col.name] = col.parse(header, strings.TrimSpace(r.cells[header]))
+			}
+		}
+		channelID, value := r.text("channel_id"), r.text("value")
+		if channelID == nil || value == nil {
+			continue
+		}
+
+		reading := models.ChannelReading{ChannelID: shipdata.LocalID(*channelID), TS: r.ts.UTC(), Quality: r.text("quality"), UploadID: &uploadID}
+		if v, err := ParseFloat(*value); err == nil && v != nil {
+			reading.Value = v
+		} else {
+			reading.TextValue = value
+		}
+		if event := r.text("event"); event != nil {
+			switch strings.ToLower(*event) {
+			case "1", "true", "yes", "y", "event":
+				reading.Event = true
+			}
+		}
+		result, err := p.store.PutChannelReading(ctx, vesselID, reading, mode == ModeUpsert)
+		if err != nil {
+			run.warnRow(i+1, r, "%s insert error: %v", ChannelReadings, err)
+			continue
+		}
+		switch result {
+		case store.WriteInserted:
+			inserted++
+		case store.WriteUpdated:
+			updated++
+		}
+	}
+	return inserted, updated, run.warnings
+}
+
+// shipDataSheet is the name of the sheet of a ship data package's readings
+// of channels not mapped to a stream.
+const shipDataSheet = "Data Channels"
+
+// ProcessShipData ingests an ISO 19848 ship data package, fileData parsed
+// as pkg, for the vessel of imo, else of the IMO number in the package's
+// ship ID; vesselName names the vessel if it is new. Channels mapped to a
+// stream, by the vessel's mappings or else the bundled catalog, are written
+// as its readings; the newest position as the vessel's position. All other
+// channels, and the position channels, are kept as data channel readings.
+func (p *XLSXProcessor) ProcessShipData(ctx context.Context, fileData []byte, pkg *shipdata.Package, filename, imo, vesselName string, mode IngestMode, source string) (*models.IngestResponse, error) {
+	fileHash := util.SHA256Hex(fileData)
+	if response, err := p.alreadyIngested(ctx, fileHash); response != nil || err != nil {
+		return response, err
+	}
+
+	if imo == "" {
+		imo = pkg.IMO()
+	}
+	if imo == "" {
+		return nil, fmt.Errorf("%w: the package's ShipID has no IMO number, pass imo", ErrUnsupportedFormat)
+	}
+	vessel, vesselID, err := p.feedVessel(ctx, imo, vesselName)
+	if err != nil {
+		return nil, err
+	}
+	var own []shipdata.Mapping
+	if vesselID != 0 {
+		mappings, err := p.store.DataChannelMappings(ctx, vesselID)
+		if err != nil {
+			return nil, fmt.Errorf("error reading data channel mappings: %w", err)
+		}
+		for _, m := range mappings {
+			own = append(own, shipdata.Mapping{ChannelID: m.ChannelID, Stream: m.Stream, Field: m.Field, Unit: m.Unit})
+		}
+	}
+	catalog, err := shipdata.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	readings, channels := shipDataReadings(pkg.Samples(), shipdata.Resolve(own, catalog))
+	sheets, overrides, aliases := feedWorkbook(readings, &vessel)
+	if len(channels.rows) > 1 {
+		sheets = append(sheets, channels)
+		overrides[shipDataSheet] = ChannelReadings
+	}
+	f, err := textWorkbook(sheets)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	matcher := p.newSheetMatcher(ctx, overrides)
+	matcher.aliases = aliases
+	return p.processWorkbook(ctx, f, filename, IngestOptions{IMO: imo, VesselName: vessel.Name, Mode: mode, Source: source}, 0, matcher, fileHash)
+}
+
+// shipDataReadings returns the samples of a ship data package mapped to a
+// stream field as readings, and a sheet of the others and the positions as
+// data channel readings.
+func shipDataReadings(samples []shipdata.Sample, mappings map[string]shipdata.Mapping) ([]FeedReading, textSheet) {
+	var readings []FeedReading
+	channels := textSheet{name: shipDataSheet, rows: [][]string{{"Timestamp", "Channel ID", "Value", "Quality", "Event"}}}
+	for _, s := range samples {
+		m, ok := shipdata.Lookup(mappings, s.ChannelID)
+		if ok {
+			r := FeedReading{Stream: m.Stream, TS: s.TS, Values: map[string]string{m.Field: s.Value}}
+			if m.Unit != nil {
+				r.Unit = *m.Unit
+			}
+			readings = append(readings, r)
+			if m.Stream != shipdata.Location {
+				continue
+			}
+		}
+		quality, event := "", ""
+		if s.Quality != nil {
+			quality = *s.Quality
+		}
+		if s.Event {
+			event = "true"
+		}
+		channels.rows = append(channels.rows, []string{s.TS.Format(time.RFC3339Nano), s.ChannelID, s.Value, quality, event})
+	}
+	return readings, channels
+}
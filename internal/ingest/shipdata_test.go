@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/shipdata"
+	"vessel-telemetry-api/internal/store"
+)
+
+func TestShipDataCatalog(t *testing.T) {
+	catalog, err := shipdata.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range catalog {
+		fields, unit := shipdata.LocationFields, ""
+		if m.Stream != shipdata.Location {
+			var ok bool
+			if fields, ok = SheetFields(m.Stream); !ok {
+				t.Errorf("%s: unknown stream %s", m.ChannelID, m.Stream)
+				continue
+			}
+			unit = store.Streams[m.Stream].Unit
+		}
+		known := false
+		for _, f := range fields {
+			known = known || (f == m.Field && f != "ts" && f != unit)
+		}
+		if !known || (unit != "") != (m.Unit != nil) {
+			t.Errorf("%s: invalid mapping %+v", m.ChannelID, m)
+		}
+	}
+}
+
+func TestShipDataReadings(t *testing.T) {
+	at := func(minute int) time.Time {
+		return time.Date(2025, 8, 8, 10, minute, 0, 0, time.UTC)
+	}
+	one, two := "1", "2"
+	mappings := shipdata.Resolve([]shipdata.Mapping{
+		{ChannelID: "/rpm1", Stream: "engines", Field: "rpm", Unit: &one},
+		{ChannelID: "/rpm2", Stream: "engines", Field: "rpm", Unit: &two},
+		{ChannelID: "/temp1", Stream: "engines", Field: "temp_c", Unit: &one},
+		{ChannelID: "/lat", Stream: shipdata.Location, Field: "latitude"},
+		{ChannelID: "/lon", Stream: shipdata.Location, Field: "longitude"},
+	}, nil)
+	samples := []shipdata.Sample{
+		{ChannelID: "/rpm1", TS: at(0), Value: "80"},
+		{ChannelID: "/temp1", TS: at(0), Value: "85"},
+		{ChannelID: "/rpm2", TS: at(0), Value: "70"},
+		{ChannelID: "/lat", TS: at(0), Value: "51.9"},
+		{ChannelID: "/lon", TS: at(0), Value: "4.2"},
+		// No longitude, so not a position
+		{ChannelID: "/lat", TS: at(5), Value: "52"},
+		{ChannelID: "/draught", TS: at(5), Value: "11.2", Event: true},
+	}
+	imo, flag := "9811000", "PA"
+	readings, channels := shipDataReadings(samples, mappings)
+	sheets, overrides, aliases := feedWorkbook(readings, &models.Vessel{IMO: &imo, Name: "Equator", Flag: &flag})
+
+	if len(sheets) != 2 || sheets[0].name != "Ship Info" || sheets[1].name != "engines" {
+		t.Fatalf("Unexpected sheets %+v", sheets)
+	}
+	if info := sheets[0].rows[1]; info[0] != imo || info[2] != "PA" || info[4] != "2025-08-08T10:00:00Z" || info[5] != "51.9" || info[6] != "4.2" {
+		t.Errorf("Unexpected Ship Info row %v", info)
+	}
+	engines := sheets[1].rows
+	if len(engines) != 3 || engines[0][0] != "Timestamp" || engines[0][1] != "engine_no" || engines[1][1] != "1" || engines[1][2] != "80" || engines[2][1] != "2" {
+		t.Errorf("Unexpected engine rows %v", engines)
+	}
+	// The positions stay data channel readings too
+	if rows := channels.rows; len(rows) != 5 || rows[4][1] != "/draught" || rows[4][4] != "true" {
+		t.Errorf("Unexpected data channel rows %v", rows)
+	}
+	if overrides["engines"] != "engines" || len(aliases) != len(engines[0])-1 {
+		t.Errorf("Unexpected overrides %v, aliases %+v", overrides, aliases)
+	}
+}
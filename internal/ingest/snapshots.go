@@ -0,0 +1,41 @@
+package ingest
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// ParseSnapshotURL checks a camera snapshot reference: an absolute http or
+// https URL. Snapshots are only referenced, never downloaded on ingest.
+func ParseSnapshotURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("invalid snapshot url, use an http(s) URL")
+	}
+	return raw, nil
+}
+
+// openCCTVSheet records the snapshot a row references, linked to the reading
+// by camera and ts. The snapshot column is left in extra_json too, so row
+// hashes match sheets ingested before it was read.
+func openCCTVSheet(s *sheetRun) sheetHooks {
+	header, _ := s.mapper.FindHeader("snapshot", "snapshot_url", "image_url")
+	return sheetHooks{
+		written: func(r *sheetRow) error {
+			camID := r.text("cam_id")
+			if header == "" || camID == nil || strings.TrimSpace(r.cells[header]) == "" {
+				return nil
+			}
+			snapshotURL, err := ParseSnapshotURL(r.cells[header])
+			if err != nil {
+				return err
+			}
+			_, err = s.p.store.PutCCTVSnapshot(s.ctx, s.vesselID, models.CCTVSnapshot{CamID: *camID, TS: r.ts, URL: &snapshotURL})
+			return err
+		},
+	}
+}
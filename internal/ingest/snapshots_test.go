@@ -0,0 +1,22 @@
+package ingest
+
+import "testing"
+
+func TestParseSnapshotURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		" https://cams.example.com/v1/CAM-01/latest.jpg ": true,
+		"http://10.0.0.5/snap.png":                        true,
+		"ftp://cams.example.com/a.jpg":                    false,
+		"/snapshots/a.jpg":                                false,
+		"https://":                                        false,
+		"not a url":                                       false,
+	} {
+		got, err := ParseSnapshotURL(raw)
+		if (err == nil) != ok {
+			t.Errorf("ParseSnapshotURL(%q): unexpected error %v", raw, err)
+		}
+		if ok && (got == "" || got[0] == ' ') {
+			t.Errorf("ParseSnapshotURL(%q) = %q, expected it trimmed", raw, got)
+		}
+	}
+}
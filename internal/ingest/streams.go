@@ -0,0 +1,371 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// sheetStream describes how the sheets of one stream are read: which sheets
+// hold it, which headers fill which of its fields and which rows are
+// rejected. sheetStreams derives them from store.Streams.
+type sheetStream struct {
+	stream *store.Stream
+	// sheets are matched against lower-case sheet names by substring, words
+	// against their words, for names too short to match by substring
+	sheets  []string
+	words   []string
+	columns []sheetColumn
+	// validate returns the problems that reject a row
+	validate func(r *sheetRow) []string
+	// open sets up per-sheet checks, e.g. against a registry; optional
+	open func(s *sheetRun) sheetHooks
+	// custom is the definition of a custom stream, nil for built-in ones
+	custom *models.CustomStream
+}
+
+// sheetColumn maps the first header matching one of headers (see
+// HeaderMapper.FindHeader) to a field of the stream, or to an input that only
+// hooks read.
+type sheetColumn struct {
+	name    string
+	headers []string
+	parse   func(header, cell string) interface{}
+}
+
+// sheetHooks are the per-sheet extras of a stream. All are optional; the
+// strings returned are warnings about the row.
+type sheetHooks struct {
+	// prepare derives fields before validation; a warning rejects the row
+	prepare func(r *sheetRow) string
+	// check warns about a valid row, which is still written
+	check func(r *sheetRow) string
+	// written runs after each write attempt
+	written func(r *sheetRow) error
+	// done runs after the last row; since is the earliest reading written
+	done func(since *time.Time)
+}
+
+// sheetFormats holds how the sheets of the built-in streams are read.
+// Streams without an entry are read as defaultSheetStream says.
+var sheetFormats = map[string]sheetStream{
+	"engines": {
+		sheets: []string{"engine"},
+		columns: []sheetColumn{
+			{"engine_no", []string{"engine_no", "engine", "eng_no"}, parseUnitNo},
+			{"rpm", []string{"rpm"}, parseNumber},
+			{"temp_c", []string{"temp", "temperature", "temp_c"}, parseNumber},
+			{"oil_pressure_bar", []string{"oil_pressure", "pressure", "oil_press"}, parseNumber},
+			{"alarms", []string{"alarm", "alarms", "alert"}, parseText},
+		},
+		validate: func(r *sheetRow) []string {
+			return ValidateEngineData(r.float("rpm"), r.float("temp_c"), r.float("oil_pressure_bar"))
+		},
+		open: openEngineSheet,
+	},
+	"fuel": {
+		sheets: []string{"fuel"},
+		columns: []sheetColumn{
+			{"tank_no", []string{"tank_no", "tank", "tank_id", "Tank ID"}, parseUnitNo},
+			// Capacity and current volume may be in liters or m3
+			{"capacity", []string{"capacity", "Capacity(m3)", "volume", "volume_liters"}, parseLiters},
+			{"volume_liters", []string{"current", "Current Level(m3)", "current_level", "current_volume", "volume_liters"}, parseLiters},
+			{"temp_c", []string{"temp", "temperature", "temp_c"}, parseNumber},
+			// Uncertainty of level and volume in percent, e.g. 3 for soundings
+			{"uncertainty_percent", []string{"uncertainty_percent", "uncertainty"}, parseNumber},
+		},
+		validate: func(r *sheetRow) []string {
+			return ValidateFuelData(r.float("level_percent"), r.float("volume_liters"), r.float("temp_c"))
+		},
+		open: openFuelSheet,
+	},
+	"generators": {
+		sheets: []string{"generator"},
+		columns: []sheetColumn{
+			{"gen_no", []string{"gen_no", "generator", "gen", "generator_no"}, parseUnitNo},
+			{"load_kw", []string{"load", "load_kw", "power"}, parseNumber},
+			{"voltage_v", []string{"voltage", "volt", "voltage_v"}, parseNumber},
+			{"frequency_hz", []string{"frequency", "freq", "frequency_hz"}, parseNumber},
+			{"fuel_rate_lph", []string{"fuel_rate", "fuel_rate_lph", "consumption"}, parseNumber},
+			// Of the fuel rate
+			{"uncertainty_percent", []string{"uncertainty_percent", "uncertainty"}, parseNumber},
+		},
+		validate: func(r *sheetRow) []string {
+			return ValidateGeneratorData(r.float("load_kw"), r.float("voltage_v"), r.float("frequency_hz"), r.float("fuel_rate_lph"))
+		},
+		open: openGeneratorSheet,
+	},
+	"cctv": {
+		sheets: []string{"cctv"},
+		columns: []sheetColumn{
+			{"cam_id", []string{"cam_id", "camera", "camera_id", "cam"}, parseText},
+			{"status", []string{"status", "state"}, parseText},
+			{"uptime_percent", []string{"uptime", "uptime_percent", "availability"}, parseNumber},
+		},
+		open: openCCTVSheet,
+	},
+	"impact": {
+		sheets: []string{"impact", "vibration"},
+		columns: []sheetColumn{
+			{"sensor_id", []string{"sensor_id", "sensor", "device_id"}, parseText},
+			{"accel_g", []string{"accel", "acceleration", "accel_g"}, parseNumber},
+			{"shock_g", []string{"shock", "shock_g", "impact"}, parseNumber},
+			{"notes", []string{"notes", "note", "comment"}, parseText},
+		},
+	},
+	"bilge": {
+		sheets: []string{"bilge", "ballast"},
+		columns: []sheetColumn{
+			{"tank_id", []string{"tank_id", "tank", "well", "compartment"}, parseText},
+			{"level_percent", []string{"level_percent", "level_%", "level"}, parseNumber},
+			{"volume_m3", []string{"volume_m3", "volume"}, parseNumber},
+			{"pump_status", []string{"pump_status", "pump_state", "pump"}, parseText},
+			{"alarm", []string{"alarm", "alarms", "alert"}, parseText},
+		},
+		validate: func(r *sheetRow) []string {
+			return ValidateBilgeData(r.float("level_percent"), r.float("volume_m3"))
+		},
+	},
+	"navigation": {
+		sheets: []string{"nav"},
+		columns: []sheetColumn{
+			{"heading_degrees", []string{"heading_degrees", "heading", "hdg", "gyro"}, parseNumber},
+			{"rudder_angle_degrees", []string{"rudder_angle_degrees", "rudder_angle", "rudder"}, parseNumber},
+			{"rot_degrees_per_min", []string{"rot_degrees_per_min", "rate_of_turn", "rot", "turn_rate"}, parseNumber},
+			{"depth_under_keel_m", []string{"depth_under_keel_m", "depth_under_keel", "under_keel", "ukc", "depth"}, parseNumber},
+		},
+		validate: func(r *sheetRow) []string {
+			return ValidateNavigationData(r.float("heading_degrees"), r.float("rudder_angle_degrees"), r.float("depth_under_keel_m"))
+		},
+	},
+	"met": {
+		sheets: []string{"weather"},
+		words:  []string{"met"},
+		columns: []sheetColumn{
+			{"wind_speed_knots", []string{"wind_speed_knots", "wind_speed", "wind_kn", "wind_knots"}, parseNumber},
+			{"wind_direction_deg", []string{"wind_direction_deg", "wind_direction", "wind_dir"}, parseNumber},
+			{"air_temp_c", []string{"air_temp_c", "air_temp", "air_temperature"}, parseNumber},
+			{"pressure_hpa", []string{"pressure_hpa", "pressure", "baro", "barometer"}, parseNumber},
+			{"sea_state", []string{"sea_state", "douglas"}, parseInteger},
+		},
+		validate: func(r *sheetRow) []string {
+			return ValidateMetData(r.float("wind_speed_knots"), r.float("wind_direction_deg"), r.float("pressure_hpa"), r.int("sea_state"))
+		},
+	},
+	"power": {
+		sheets: []string{"shore", "batter"},
+		words:  []string{"ess", "bess"},
+		columns: []sheetColumn{
+			{"bank_id", []string{"bank_id", "battery_id", "bank", "string"}, parseText},
+			{"shore_status", []string{"shore_status", "shore_connection", "shore_conn", "connection"}, parseText},
+			{"shore_kw", []string{"shore_kw", "shore_power_kw", "shore_power", "shore_load"}, parseNumber},
+			{"soc_percent", []string{"soc_percent", "soc", "state_of_charge"}, parseNumber},
+			{"battery_kw", []string{"battery_kw", "battery_power", "charge_kw", "net_kw"}, parseNumber},
+			// Sheets with a separate discharge column; see openPowerSheet
+			{"discharge_kw", []string{"discharge_kw", "discharge"}, parseNumber},
+		},
+		validate: func(r *sheetRow) []string {
+			return ValidatePowerData(r.float("shore_kw"), r.float("soc_percent"))
+		},
+		open: openPowerSheet,
+	},
+	"network_device": {
+		sheets: []string{"network"},
+		words:  []string{"switch", "switches", "lan"},
+		columns: []sheetColumn{
+			{"device_id", []string{"device_id", "device", "hostname", "host"}, parseText},
+			{"device_type", []string{"device_type", "type", "model"}, parseText},
+			{"status", []string{"status", "state"}, parseText},
+			{"uptime_hours", []string{"uptime_hours", "uptime_h", "uptime"}, parseNumber},
+			{"availability_percent", []string{"availability_percent", "availability"}, parseNumber},
+		},
+		validate: func(r *sheetRow) []string {
+			return ValidateNetworkDeviceData(r.float("uptime_hours"), r.float("availability_percent"))
+		},
+	},
+}
+
+// sheetStreams lists the streams of store.Streams read from their own
+// sheets, in store.StreamOrder, which is the order sheet names are matched:
+// "Generator Fuel" is a fuel sheet. Location is read from the Ship Info sheet
+// instead; sheets matching none of these are tried against the custom
+// streams.
+var sheetStreams = registrySheetStreams()
+
+func registrySheetStreams() []sheetStream {
+	var streams []sheetStream
+	for _, name := range store.StreamOrder {
+		if name == "location" {
+			continue
+		}
+		def, ok := sheetFormats[name]
+		if !ok {
+			def = defaultSheetStream(store.Streams[name])
+		}
+		def.stream = store.Streams[name]
+		streams = append(streams, def)
+	}
+	return streams
+}
+
+// defaultSheetStream reads a stream from the sheets named like it, each
+// field from the column headed with its name.
+func defaultSheetStream(stream *store.Stream) sheetStream {
+	s := sheetStream{sheets: []string{strings.ReplaceAll(stream.Name, "_", " ")}}
+	for _, f := range stream.Fields {
+		if f.Name == "source" {
+			continue // set per upload
+		}
+		parse := parseNumber
+		switch {
+		case f.Kind == store.IntField && f.Name == stream.Unit:
+			parse = parseUnitNo
+		case f.Kind == store.IntField:
+			parse = parseInteger
+		case f.Kind == store.TextField:
+			parse = parseText
+		}
+		s.columns = append(s.columns, sheetColumn{f.Name, []string{f.Name}, parse})
+	}
+	return s
+}
+
+// matchSheet returns the first of streams that holds the sheet, nil if none.
+func matchSheet(streams []sheetStream, sheetName string) *sheetStream {
+	name := strings.ToLower(sheetName)
+	words := strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	for i := range streams {
+		for _, s := range streams[i].sheets {
+			if strings.Contains(name, s) {
+				return &streams[i]
+			}
+		}
+		for _, w := range streams[i].words {
+			for _, word := range words {
+				if word == w {
+					return &streams[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var digits = regexp.MustCompile(`\d+`)
+
+// parseUnitNo takes the digits of unit names like "ME-1" or "T2".
+func parseUnitNo(_, cell string) interface{} {
+	if v, err := strconv.Atoi(digits.FindString(cell)); err == nil {
+		return &v
+	}
+	return (*int)(nil)
+}
+
+func parseNumber(_, cell string) interface{} {
+	v, _ := ParseFloat(cell)
+	return v
+}
+
+// parseLiters converts volumes from columns with m3 in the header.
+func parseLiters(header, cell string) interface{} {
+	v, _ := ParseFloat(cell)
+	if v != nil && strings.Contains(strings.ToLower(header), "m3") {
+		*v *= 1000
+	}
+	return v
+}
+
+func parseText(_, cell string) interface{} {
+	if cell == "" {
+		return (*string)(nil)
+	}
+	return &cell
+}
+
+// sheetRun is one sheet being ingested.
+type sheetRun struct {
+	p        *XLSXProcessor
+	ctx      context.Context
+	name     string
+	vesselID int64
+	mapper   *HeaderMapper
+	headers  map[string]string // matched header by column name
+	warnings []models.UploadWarning
+}
+
+// has reports whether the sheet has the column.
+func (s *sheetRun) has(column string) bool {
+	return s.headers[column] != ""
+}
+
+func (s *sheetRun) warn(format string, args ...interface{}) {
+	s.addWarnings(fmt.Sprintf(format, args...))
+}
+
+// addWarnings adds warnings about the sheet as a whole.
+func (s *sheetRun) addWarnings(messages ...string) {
+	for _, m := range messages {
+		s.warnings = append(s.warnings, models.UploadWarning{Sheet: &s.name, Message: m})
+	}
+}
+
+// warnRow adds a warning about row n of the sheet, prefixed "row <n> ",
+// keeping the row's cells.
+func (s *sheetRun) warnRow(n int, r *sheetRow, format string, args ...interface{}) {
+	s.warnings = append(s.warnings, models.UploadWarning{
+		Sheet: &s.name, RowNumber: &n, Message: fmt.Sprintf("row %d ", n) + fmt.Sprintf(format, args...), Row: r.cells,
+	})
+}
+
+// checkConfidence warns about a header taken for a field on a weak match,
+// which may well be the wrong column.
+func (s *sheetRun) checkConfidence(header, field string, confidence float64) {
+	if header != "" && confidence < LowConfidence {
+		s.warn("%s: header %q read as %s with low confidence (%.2f)", s.name, header, field, confidence)
+	}
+}
+
+// sheetRow is one row of a sheet: its timestamp, its cells by header and the
+// parsed columns and derived fields by name.
+type sheetRow struct {
+	ts     time.Time
+	cells  map[string]string
+	values map[string]interface{}
+}
+
+func (r *sheetRow) float(name string) *float64 {
+	v, _ := r.values[name].(*float64)
+	return v
+}
+
+func (r *sheetRow) int(name string) *int {
+	v, _ := r.values[name].(*int)
+	return v
+}
+
+func (r *sheetRow) text(name string) *string {
+	v, _ := r.values[name].(*string)
+	return v
+}
+
+// unitKey is the row hash key of the row's unit, empty without one.
+func unitKey(stream *store.Stream, unit interface{}) string {
+	switch u := unit.(type) {
+	case *int:
+		if u != nil {
+			return fmt.Sprintf("%s:%d", stream.Unit, *u)
+		}
+	case *string:
+		if u != nil {
+			return fmt.Sprintf("%s:%s", stream.Unit, *u)
+		}
+	}
+	return ""
+}
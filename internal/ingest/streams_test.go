@@ -0,0 +1,94 @@
+package ingest
+
+import (
+	"testing"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+func TestSheetStreams(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, def := range sheetStreams {
+		if def.stream == nil {
+			t.Fatal("Sheet stream without a store stream")
+		}
+		covered[def.stream.Name] = true
+		if def.stream.Unit != "" && def.columns[0].name != def.stream.Unit {
+			t.Errorf("%s: expected the unit %s as first column, got %s", def.stream.Name, def.stream.Unit, def.columns[0].name)
+		}
+	}
+	for name := range store.Streams {
+		if name != "location" && !covered[name] {
+			t.Errorf("Stream %s has no sheet stream", name)
+		}
+	}
+}
+
+func TestDefaultSheetStream(t *testing.T) {
+	stream := &store.Stream{Name: "flow_meters", Unit: "meter_no", Fields: []store.Field{
+		{Name: "meter_no", Kind: store.IntField}, {Name: "flow_lph", Kind: store.FloatField},
+		{Name: "status", Kind: store.TextField}, {Name: "source", Kind: store.TextField},
+	}}
+	def := defaultSheetStream(stream)
+	if def := matchSheet([]sheetStream{def}, "Flow Meters"); def == nil {
+		t.Error("Expected the sheet matched by the stream's name")
+	}
+	if len(def.columns) != 3 || def.columns[0].name != "meter_no" || def.columns[2].headers[0] != "status" {
+		t.Fatalf("Expected a column per field but source, got %+v", def.columns)
+	}
+	if v := def.columns[0].parse("", "FM-3").(*int); v == nil || *v != 3 {
+		t.Errorf("Expected meter 3, got %v", v)
+	}
+}
+
+func TestMatchSheet(t *testing.T) {
+	for name, want := range map[string]string{
+		"Engine Log":      "engines",
+		"FUEL TANKS":      "fuel",
+		"Generator Fuel":  "fuel",
+		"Generators":      "generators",
+		"CCTV Status":     "cctv",
+		"Vibration":       "impact",
+		"Bilge Wells":     "bilge",
+		"Ballast Tanks":   "bilge",
+		"Navigation":      "navigation",
+		"NAV DATA":        "navigation",
+		"Weather Obs":     "met",
+		"MET":             "met",
+		"Met-Station 2":   "met",
+		"Flow Meters":     "",
+		"Shore Power":     "power",
+		"Battery Banks":   "power",
+		"ESS":             "power",
+		"Network Devices": "network_device",
+		"LAN Switches":    "network_device",
+		"Vessel Info":     "",
+		"Ship Info":       "",
+	} {
+		got := ""
+		if def := matchSheet(sheetStreams, name); def != nil {
+			got = def.stream.Name
+		}
+		if got != want {
+			t.Errorf("%q: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	if v := parseUnitNo("", "ME-2").(*int); v == nil || *v != 2 {
+		t.Errorf("Expected unit 2, got %v", v)
+	}
+	if v := parseUnitNo("", "main").(*int); v != nil {
+		t.Errorf("Expected no unit, got %v", *v)
+	}
+	if v := parseLiters("Current Level(m3)", "1.5").(*float64); v == nil || *v != 1500 {
+		t.Errorf("Expected 1500 L, got %v", v)
+	}
+	if v := parseLiters("Volume Liters", "1.5").(*float64); v == nil || *v != 1.5 {
+		t.Errorf("Expected 1.5 L, got %v", v)
+	}
+	if v := parseText("", "").(*string); v != nil {
+		t.Errorf("Expected no text, got %q", *v)
+	}
+}
@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// tankCapacities returns the vessel's registered tank capacities in liters
+// by tank number.
+func (p *XLSXProcessor) tankCapacities(ctx context.Context, vesselID int64) (map[int]float64, error) {
+	tanks, err := p.store.Tanks(ctx, vesselID)
+	if err != nil {
+		return nil, err
+	}
+	capacities := make(map[int]float64, len(tanks))
+	for _, t := range tanks {
+		capacities[t.TankNo] = t.CapacityLiters
+	}
+	return capacities, nil
+}
+
+// checkTankVolume returns a warning if volume exceeds the registered capacity
+// of the tank, which no real reading can.
+func checkTankVolume(capacities map[int]float64, tankNo *int, volume *float64) string {
+	if tankNo == nil || volume == nil {
+		return ""
+	}
+	capacity, ok := capacities[*tankNo]
+	if !ok || *volume <= capacity {
+		return ""
+	}
+	return fmt.Sprintf("volume %.0f L exceeds the %.0f L capacity of tank %d", *volume, capacity, *tankNo)
+}
+
+// openFuelSheet fills in registered capacities, refuses volumes above them
+// and derives the fill level. Fuel drops are re-checked once the sheet is
+// written.
+func openFuelSheet(s *sheetRun) sheetHooks {
+	capacities, err := s.p.tankCapacities(s.ctx, s.vesselID)
+	if err != nil {
+		s.warn("%s: error reading tank registry: %v", s.name, err)
+	}
+	return sheetHooks{
+		prepare: func(r *sheetRow) string {
+			// Some sheets only have one volume column; it is the current volume
+			if !s.has("volume_liters") {
+				r.values["volume_liters"] = r.float("capacity")
+			}
+			tankNo := r.int("tank_no")
+			if r.float("capacity") == nil && tankNo != nil {
+				if capacity, ok := capacities[*tankNo]; ok {
+					r.values["capacity"] = &capacity
+				}
+			}
+			volume, capacity := r.float("volume_liters"), r.float("capacity")
+			if warn := checkTankVolume(capacities, tankNo, volume); warn != "" {
+				return warn
+			}
+			if volume != nil && capacity != nil && *capacity > 0 {
+				level := *volume / *capacity * 100
+				r.values["level_percent"] = &level
+			}
+			return ""
+		},
+		done: func(since *time.Time) {
+			s.addWarnings(s.p.checkFuelDrops(s.ctx, s.vesselID, s.name, since)...)
+		},
+	}
+}
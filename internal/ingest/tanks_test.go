@@ -0,0 +1,22 @@
+package ingest
+
+import "testing"
+
+func TestCheckTankVolume(t *testing.T) {
+	capacities := map[int]float64{1: 50000}
+	one, two := 1, 2
+	full, over := 50000.0, 50001.0
+
+	if warn := checkTankVolume(capacities, &one, &full); warn != "" {
+		t.Errorf("Expected a full tank to pass, got %q", warn)
+	}
+	if warn := checkTankVolume(capacities, &one, &over); warn == "" {
+		t.Error("Expected a warning for a volume above capacity")
+	}
+	if warn := checkTankVolume(capacities, &two, &over); warn != "" {
+		t.Errorf("Expected unregistered tanks to pass, got %q", warn)
+	}
+	if warn := checkTankVolume(capacities, nil, &over); warn != "" {
+		t.Errorf("Expected readings without a tank number to pass, got %q", warn)
+	}
+}
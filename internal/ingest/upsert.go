@@ -0,0 +1,29 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IngestMode controls how rows that already exist for a vessel are treated.
+type IngestMode string
+
+const (
+	// ModeInsert keeps the first copy of a row and ignores later duplicates
+	// (matched by row_hash).
+	ModeInsert IngestMode = "insert"
+	// ModeUpsert replaces existing readings matched by vessel, timestamp and
+	// unit number, so corrected sheets overwrite previously ingested values.
+	ModeUpsert IngestMode = "upsert"
+)
+
+// ParseIngestMode validates a mode query parameter; empty means ModeInsert.
+func ParseIngestMode(s string) (IngestMode, error) {
+	switch IngestMode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ModeInsert:
+		return ModeInsert, nil
+	case ModeUpsert:
+		return ModeUpsert, nil
+	}
+	return "", fmt.Errorf("invalid mode %q, use insert or upsert", s)
+}
@@ -0,0 +1,22 @@
+package ingest
+
+import (
+	"testing"
+)
+
+func TestParseIngestMode(t *testing.T) {
+	// Default is insert
+	if mode, err := ParseIngestMode(""); err != nil || mode != ModeInsert {
+		t.Errorf("Expected insert mode for empty string, got %s, err: %v", mode, err)
+	}
+
+	// Case-insensitive upsert
+	if mode, err := ParseIngestMode("UPSERT"); err != nil || mode != ModeUpsert {
+		t.Errorf("Expected upsert mode, got %s, err: %v", mode, err)
+	}
+
+	// Unknown mode
+	if _, err := ParseIngestMode("merge"); err == nil {
+		t.Errorf("Expected error for unknown mode")
+	}
+}
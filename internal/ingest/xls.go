@@ -0,0 +1,590 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/richardlehane/mscfb"
+	"github.com/xuri/excelize/v2"
+)
+
+// ErrUnsupportedFormat is returned for workbooks in a format that cannot be
+// read, e.g. password-protected or pre-Excel 5 files.
+var ErrUnsupportedFormat = errors.New("unsupported workbook format")
+
+// cfbSignature starts the compound files legacy .xls workbooks are stored in.
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// BIFF record types read from .xls workbooks
+const (
+	biffBOF        = 0x0809
+	biffEOF        = 0x000A
+	biffContinue   = 0x003C
+	biffFilePass   = 0x002F
+	biffDateMode   = 0x0022
+	biffBoundSheet = 0x0085
+	biffSST        = 0x00FC
+	biffFormat     = 0x041E
+	biffXF         = 0x00E0
+	biffNumber     = 0x0203
+	biffRK         = 0x027E
+	biffMulRK      = 0x00BD
+	biffLabelSST   = 0x00FD
+	biffLabel      = 0x0204
+	biffRString    = 0x00D6
+	biffFormula    = 0x0006
+	biffString     = 0x0207
+	biffBoolErr    = 0x0205
+)
+
+// maxXLSColumns is the column limit of .xls worksheets.
+const maxXLSColumns = 256
+
+// isXLS reports whether data is a legacy .xls workbook rather than XLSX.
+func isXLS(data []byte) bool {
+	return bytes.HasPrefix(data, cfbSignature) || isOldBIFF(data)
+}
+
+// isOldBIFF reports whether data is an Excel 2.x-4.x worksheet, which starts
+// with a BOF record of its own rather than a compound file.
+func isOldBIFF(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x09 && (data[1] == 0x00 || data[1] == 0x02 || data[1] == 0x04)
+}
+
+// openWorkbook opens an XLSX, legacy .xls or OpenDocument (.ods) workbook.
+func openWorkbook(data []byte) (*excelize.File, error) {
+	if isXLS(data) {
+		return xlsWorkbook(data)
+	}
+	if isODS(data) {
+		return odsWorkbook(data)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data), excelize.Options{UnzipSizeLimit: maxUnzippedSize})
+	if err != nil {
+		return nil, fmt.Errorf("error opening XLSX: %w", err)
+	}
+	return f, nil
+}
+
+// xlsWorkbook reads the worksheets of an Excel 5-2003 (BIFF5/BIFF8) workbook
+// into a workbook of text cells, as csvWorkbook does. Numbers in a date
+// format become RFC 3339 timestamps.
+func xlsWorkbook(data []byte) (*excelize.File, error) {
+	if isOldBIFF(data) {
+		return nil, fmt.Errorf("%w: Excel 2.x-4.x worksheets cannot be read, save the file as .xlsx", ErrUnsupportedFormat)
+	}
+	if err := checkCompoundHeader(data); err != nil {
+		return nil, fmt.Errorf("%w: not an Excel workbook: %v", ErrUnsupportedFormat, err)
+	}
+	doc, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not an Excel workbook: %v", ErrUnsupportedFormat, err)
+	}
+
+	var stream []byte
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		switch entry.Name {
+		case "Workbook", "Book":
+			if entry.Size > maxUnzippedSize {
+				return nil, fmt.Errorf("%w: workbook exceeds %d MB", ErrUnsupportedFormat, maxUnzippedSize>>20)
+			}
+			stream = make([]byte, entry.Size)
+			if _, err := io.ReadFull(entry, stream); err != nil {
+				return nil, fmt.Errorf("%w: corrupt .xls file: %v", ErrUnsupportedFormat, err)
+			}
+		case "EncryptedPackage":
+			return nil, fmt.Errorf("%w: the workbook is password-protected", ErrUnsupportedFormat)
+		}
+	}
+	if stream == nil {
+		return nil, fmt.Errorf("%w: the file holds no Excel workbook", ErrUnsupportedFormat)
+	}
+
+	sheets, err := parseBIFF(stream)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	return textWorkbook(sheets)
+}
+
+// checkCompoundHeader checks the sector counts of a compound file header
+// against the file's size: mscfb allocates what they claim before reading.
+func checkCompoundHeader(data []byte) error {
+	if len(data) < 512 {
+		return errors.New("truncated header")
+	}
+	shift := binary.LittleEndian.Uint16(data[30:])
+	if shift != 9 && shift != 12 {
+		return errors.New("invalid sector size")
+	}
+	sectors := uint32(len(data)>>shift) + 1
+	for _, offset := range []int{40, 44, 64, 72} { // directory, FAT, mini FAT, DIFAT
+		if binary.LittleEndian.Uint32(data[offset:]) > sectors {
+			return errors.New("sector count exceeds the file size")
+		}
+	}
+	return nil
+}
+
+// textSheet is a sheet of text cells.
+type textSheet struct {
+	name string
+	rows [][]string
+}
+
+// set sets a cell, growing the sheet as needed.
+func (s *textSheet) set(row, col int, value string) {
+	for len(s.rows) <= row {
+		s.rows = append(s.rows, nil)
+	}
+	for len(s.rows[row]) <= col {
+		s.rows[row] = append(s.rows[row], "")
+	}
+	s.rows[row][col] = value
+}
+
+// textWorkbook builds a workbook of text cells.
+func textWorkbook(sheets []textSheet) (*excelize.File, error) {
+	f := excelize.NewFile()
+	for i, s := range sheets {
+		var err error
+		if i == 0 {
+			err = f.SetSheetName("Sheet1", s.name)
+		} else {
+			_, err = f.NewSheet(s.name)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		for r, cells := range s.rows {
+			row := make([]interface{}, len(cells))
+			for j, cell := range cells {
+				row[j] = cell
+			}
+			cell, _ := excelize.CoordinatesToCellName(1, r+1)
+			if err := f.SetSheetRow(s.name, cell, &row); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
+
+// biffRecord is one record of a BIFF stream.
+type biffRecord struct {
+	id   uint16
+	data []byte
+}
+
+// biffRecords splits a BIFF stream, from offset, into records up to and
+// including the first EOF.
+func biffRecords(stream []byte, offset int) ([]biffRecord, error) {
+	var records []biffRecord
+	for pos := offset; ; {
+		if pos < 0 || pos+4 > len(stream) {
+			return nil, errors.New("corrupt .xls file: truncated record")
+		}
+		id := binary.LittleEndian.Uint16(stream[pos:])
+		size := int(binary.LittleEndian.Uint16(stream[pos+2:]))
+		pos += 4
+		if pos+size > len(stream) {
+			return nil, errors.New("corrupt .xls file: truncated record")
+		}
+		records = append(records, biffRecord{id, stream[pos : pos+size]})
+		pos += size
+		if id == biffEOF {
+			return records, nil
+		}
+	}
+}
+
+// biffBook is what the workbook globals say about reading cells.
+type biffBook struct {
+	biff8    bool
+	date1904 bool
+	sst      []string
+	formats  map[uint16]string // custom number formats by index
+	xfs      []uint16          // number format index by XF
+}
+
+// parseBIFF reads the worksheets of a BIFF5 or BIFF8 workbook stream.
+func parseBIFF(stream []byte) ([]textSheet, error) {
+	globals, err := biffRecords(stream, 0)
+	if err != nil {
+		return nil, err
+	}
+	if globals[0].id != biffBOF || len(globals[0].data) < 4 {
+		return nil, errors.New("corrupt .xls file: no BOF record")
+	}
+	book := &biffBook{formats: make(map[uint16]string)}
+	switch binary.LittleEndian.Uint16(globals[0].data) {
+	case 0x0600:
+		book.biff8 = true
+	case 0x0500:
+	default:
+		return nil, errors.New("unknown BIFF version")
+	}
+
+	type boundSheet struct {
+		name   string
+		offset int
+	}
+	var bound []boundSheet
+	for i := 1; i < len(globals); i++ {
+		rec := globals[i]
+		r := &biffReader{segs: [][]byte{rec.data}}
+		switch rec.id {
+		case biffFilePass:
+			return nil, errors.New("the workbook is password-protected")
+		case biffDateMode:
+			book.date1904 = r.u16() == 1
+		case biffBoundSheet:
+			offset := int(r.u32())
+			r.u8() // visibility
+			kind := r.u8()
+			name := r.text(1, book.biff8)
+			// Charts and macro sheets hold no cells
+			if kind == 0 && r.err == nil {
+				bound = append(bound, boundSheet{name, offset})
+			}
+		case biffFormat:
+			index := r.u16()
+			lenBytes := 1
+			if book.biff8 {
+				lenBytes = 2
+			}
+			if code := r.text(lenBytes, book.biff8); r.err == nil {
+				book.formats[index] = code
+			}
+		case biffXF:
+			r.u16() // font
+			book.xfs = append(book.xfs, r.u16())
+		case biffSST:
+			// Strings run on into the CONTINUE records that follow
+			for i+1 < len(globals) && globals[i+1].id == biffContinue {
+				i++
+				r.segs = append(r.segs, globals[i].data)
+			}
+			book.sst = r.sst()
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("corrupt .xls file: %v", r.err)
+		}
+	}
+	if len(bound) == 0 {
+		return nil, errors.New("the workbook has no worksheets")
+	}
+
+	sheets := make([]textSheet, 0, len(bound))
+	for _, b := range bound {
+		records, err := biffRecords(stream, b.offset)
+		if err != nil {
+			return nil, err
+		}
+		sheet, err := book.sheet(b.name, records)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %v", b.name, err)
+		}
+		sheets = append(sheets, sheet)
+	}
+	return sheets, nil
+}
+
+// sheet reads the cells of a worksheet's records.
+func (b *biffBook) sheet(name string, records []biffRecord) (textSheet, error) {
+	s := textSheet{name: name}
+	set := func(row, col uint16, value string) {
+		if int(col) < maxXLSColumns {
+			s.set(int(row), int(col), value)
+		}
+	}
+	// A formula's text result follows in a STRING record
+	pendingRow, pendingCol, pending := uint16(0), uint16(0), false
+
+	for _, rec := range records {
+		r := &biffReader{segs: [][]byte{rec.data}}
+		switch rec.id {
+		case biffNumber:
+			row, col, xf := r.u16(), r.u16(), r.u16()
+			v := math.Float64frombits(r.u64())
+			if r.err == nil {
+				set(row, col, b.number(xf, v))
+			}
+		case biffRK:
+			row, col, xf, rk := r.u16(), r.u16(), r.u16(), r.u32()
+			if r.err == nil {
+				set(row, col, b.number(xf, rkValue(rk)))
+			}
+		case biffMulRK:
+			row, col := r.u16(), r.u16()
+			for n := (len(rec.data) - 6) / 6; n > 0 && r.err == nil; n-- {
+				xf, rk := r.u16(), r.u32()
+				if r.err == nil {
+					set(row, col, b.number(xf, rkValue(rk)))
+				}
+				col++
+			}
+		case biffLabelSST:
+			row, col := r.u16(), r.u16()
+			r.u16() // xf
+			if i := r.u32(); r.err == nil && int(i) < len(b.sst) {
+				set(row, col, b.sst[i])
+			}
+		case biffLabel, biffRString:
+			row, col := r.u16(), r.u16()
+			r.u16() // xf
+			if text := r.text(2, b.biff8); r.err == nil {
+				set(row, col, text)
+			}
+		case biffBoolErr:
+			row, col := r.u16(), r.u16()
+			r.u16() // xf
+			value, isError := r.u8(), r.u8()
+			if r.err == nil && isError == 0 {
+				set(row, col, boolText(value != 0))
+			}
+		case biffFormula:
+			row, col, xf := r.u16(), r.u16(), r.u16()
+			result := r.bytes(8)
+			if r.err != nil {
+				break
+			}
+			if result[6] != 0xFF || result[7] != 0xFF {
+				set(row, col, b.number(xf, math.Float64frombits(binary.LittleEndian.Uint64(result))))
+				break
+			}
+			switch result[0] {
+			case 0:
+				pendingRow, pendingCol, pending = row, col, true
+			case 1:
+				set(row, col, boolText(result[2] != 0))
+			}
+		case biffString:
+			if text := r.text(2, b.biff8); r.err == nil && pending {
+				set(pendingRow, pendingCol, text)
+			}
+			pending = false
+		}
+		if r.err != nil {
+			return s, fmt.Errorf("corrupt record %#04x: %v", rec.id, r.err)
+		}
+	}
+	return s, nil
+}
+
+// number renders a numeric cell, as a timestamp if its format is a date.
+func (b *biffBook) number(xf uint16, v float64) string {
+	if int(xf) < len(b.xfs) && b.isDateFormat(b.xfs[xf]) {
+		if t, err := excelize.ExcelDateToTime(v, b.date1904); err == nil {
+			return t.Round(time.Millisecond).Format(time.RFC3339Nano)
+		}
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// isDateFormat reports whether a number format shows dates or times.
+func (b *biffBook) isDateFormat(index uint16) bool {
+	switch {
+	case index >= 14 && index <= 22, index >= 45 && index <= 47:
+		return true
+	}
+	code, ok := b.formats[index]
+	if !ok || strings.EqualFold(code, "general") {
+		return false
+	}
+	// Leave out literal text and [colour]/[condition] sections
+	var plain strings.Builder
+	quoted, bracket := false, false
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\\':
+			i++
+		case c == '[':
+			bracket = true
+		case c == ']':
+			bracket = false
+		case !bracket:
+			plain.WriteByte(c)
+		}
+	}
+	return strings.ContainsAny(strings.ToLower(plain.String()), "ymdhs")
+}
+
+// rkValue decodes an RK number: a 30-bit integer or the high bits of a
+// double, optionally times 100.
+func rkValue(rk uint32) float64 {
+	var v float64
+	if rk&0x02 != 0 {
+		v = float64(int32(rk) >> 2)
+	} else {
+		v = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		v /= 100
+	}
+	return v
+}
+
+func boolText(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// biffReader reads little-endian values from a record and the CONTINUE
+// records after it. The first error sticks; reads after it return zeros.
+type biffReader struct {
+	segs [][]byte
+	seg  int
+	pos  int
+	err  error
+}
+
+// bytes reads n bytes, across record boundaries.
+func (r *biffReader) bytes(n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n && r.err == nil {
+		if r.seg >= len(r.segs) {
+			r.err = errors.New("record too short")
+			break
+		}
+		seg := r.segs[r.seg]
+		if r.pos >= len(seg) {
+			r.seg, r.pos = r.seg+1, 0
+			continue
+		}
+		take := n - len(out)
+		if rest := len(seg) - r.pos; take > rest {
+			take = rest
+		}
+		out = append(out, seg[r.pos:r.pos+take]...)
+		r.pos += take
+	}
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	return out
+}
+
+func (r *biffReader) u8() uint8   { return r.bytes(1)[0] }
+func (r *biffReader) u16() uint16 { return binary.LittleEndian.Uint16(r.bytes(2)) }
+func (r *biffReader) u32() uint32 { return binary.LittleEndian.Uint32(r.bytes(4)) }
+func (r *biffReader) u64() uint64 { return binary.LittleEndian.Uint64(r.bytes(8)) }
+
+// text reads a string with a lenBytes-byte length: in BIFF8 followed by
+// option flags and 8- or 16-bit characters, in BIFF5 8-bit characters.
+func (r *biffReader) text(lenBytes int, biff8 bool) string {
+	var cch int
+	if lenBytes == 1 {
+		cch = int(r.u8())
+	} else {
+		cch = int(r.u16())
+	}
+	if !biff8 {
+		return latin1(r.bytes(cch))
+	}
+	flags := r.u8()
+	return r.chars(cch, flags&0x01 != 0)
+}
+
+// chars reads cch characters of a BIFF8 string. A string continued in the
+// next record starts there with a new option byte, so the width can change.
+func (r *biffReader) chars(cch int, wide bool) string {
+	var units []uint16
+	for cch > 0 && r.err == nil {
+		if r.seg < len(r.segs) && r.pos >= len(r.segs[r.seg]) {
+			r.seg, r.pos = r.seg+1, 0
+			wide = r.u8()&0x01 != 0
+			continue
+		}
+		if r.seg >= len(r.segs) {
+			r.err = errors.New("string too short")
+			break
+		}
+		width := 1
+		if wide {
+			width = 2
+		}
+		n := (len(r.segs[r.seg]) - r.pos) / width
+		if n > cch {
+			n = cch
+		}
+		if n == 0 {
+			r.err = errors.New("string split inside a character")
+			break
+		}
+		raw := r.bytes(n * width)
+		for i := 0; i < n; i++ {
+			if wide {
+				units = append(units, binary.LittleEndian.Uint16(raw[2*i:]))
+			} else {
+				units = append(units, uint16(raw[i]))
+			}
+		}
+		cch -= n
+	}
+	return string(utf16.Decode(units))
+}
+
+// skip skips n bytes, across record boundaries.
+func (r *biffReader) skip(n int) {
+	for n > 0 && r.err == nil {
+		if r.seg >= len(r.segs) {
+			r.err = errors.New("record too short")
+			break
+		}
+		rest := len(r.segs[r.seg]) - r.pos
+		if rest >= n {
+			r.pos += n
+			break
+		}
+		n -= rest
+		r.seg, r.pos = r.seg+1, 0
+	}
+}
+
+// sst reads the shared string table.
+func (r *biffReader) sst() []string {
+	r.u32() // total references
+	unique := int(r.u32())
+	var table []string
+	for i := 0; i < unique && r.err == nil; i++ {
+		cch := int(r.u16())
+		flags := r.u8()
+		runs, ext := 0, 0
+		if flags&0x08 != 0 {
+			runs = int(r.u16())
+		}
+		if flags&0x04 != 0 {
+			ext = int(r.u32())
+		}
+		s := r.chars(cch, flags&0x01 != 0)
+		// Formatting runs and phonetic data are not needed
+		r.skip(4*runs + ext)
+		table = append(table, s)
+	}
+	return table
+}
+
+// latin1 decodes 8-bit BIFF5 text; code pages are not told apart.
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
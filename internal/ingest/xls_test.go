@@ -0,0 +1,288 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// biffRec encodes one BIFF record.
+func biffRec(id uint16, parts ...interface{}) []byte {
+	var data bytes.Buffer
+	for _, p := range parts {
+		binary.Write(&data, binary.LittleEndian, p)
+	}
+	out := binary.LittleEndian.AppendUint16(nil, id)
+	out = binary.LittleEndian.AppendUint16(out, uint16(data.Len()))
+	return append(out, data.Bytes()...)
+}
+
+// biffText encodes a BIFF8 string with a 16-bit length, wide if needed.
+func biffText(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := binary.LittleEndian.AppendUint16(nil, uint16(len(units)))
+	wide := false
+	for _, u := range units {
+		wide = wide || u > 0xFF
+	}
+	if !wide {
+		out = append(out, 0)
+		for _, u := range units {
+			out = append(out, byte(u))
+		}
+		return out
+	}
+	out = append(out, 1)
+	for _, u := range units {
+		out = binary.LittleEndian.AppendUint16(out, u)
+	}
+	return out
+}
+
+// xlsEngines builds the BIFF8 stream of a workbook with an Engines sheet.
+func xlsEngines() []byte {
+	// Shared strings, split over a CONTINUE record inside "Temperature",
+	// whose rest is stored wide
+	sst := []byte{}
+	sst = binary.LittleEndian.AppendUint32(sst, 4)
+	sst = binary.LittleEndian.AppendUint32(sst, 4)
+	for _, s := range []string{"Timestamp", "Engine", "RPM"} {
+		sst = append(sst, biffText(s)...)
+	}
+	sst = append(sst, 11, 0, 0)
+	sst = append(sst, "Tempe"...)
+	cont := []byte{1}
+	for _, c := range "rature" {
+		cont = binary.LittleEndian.AppendUint16(cont, uint16(c))
+	}
+
+	xf := func(format uint16) []byte {
+		return biffRec(biffXF, uint16(0), format, make([]byte, 16))
+	}
+	boundSheet := func(offset uint32) []byte {
+		return biffRec(biffBoundSheet, offset, uint8(0), uint8(0), uint8(7), uint8(0), []byte("Engines"))
+	}
+
+	var globals []byte
+	globals = append(globals, biffRec(biffBOF, uint16(0x0600), uint16(0x0005), make([]byte, 12))...)
+	globals = append(globals, biffRec(biffFormat, uint16(164), biffText("yyyy-mm-dd hh:mm"))...)
+	globals = append(globals, xf(0)...)   // 0: General
+	globals = append(globals, xf(164)...) // 1: custom date
+	globals = append(globals, xf(2)...)   // 2: 0.00
+	globals = append(globals, biffRec(biffSST, sst)...)
+	globals = append(globals, biffRec(biffContinue, cont)...)
+	offset := uint32(len(globals) + len(boundSheet(0)) + 4)
+	globals = append(globals, boundSheet(offset)...)
+	globals = append(globals, biffRec(biffEOF)...)
+
+	// 2024-01-01 00:00 and 06:00
+	day := 45292.0
+	var sheet []byte
+	sheet = append(sheet, biffRec(biffBOF, uint16(0x0600), uint16(0x0010), make([]byte, 12))...)
+	for col := uint16(0); col < 4; col++ {
+		sheet = append(sheet, biffRec(biffLabelSST, uint16(0), col, uint16(0), uint32(col))...)
+	}
+	sheet = append(sheet, biffRec(biffNumber, uint16(1), uint16(0), uint16(1), math.Float64bits(day))...)
+	sheet = append(sheet, biffRec(biffLabel, uint16(1), uint16(1), uint16(0), biffText("ME-1"))...)
+	// RPM 700 and temperature 82.5 as RK numbers
+	sheet = append(sheet, biffRec(biffMulRK, uint16(1), uint16(2), uint16(2), uint32(700<<2|2), uint16(2), uint32(8250<<2|3), uint16(3))...)
+	sheet = append(sheet, biffRec(biffFormula, uint16(2), uint16(0), uint16(1), math.Float64bits(day+0.25), uint16(0), uint32(0), []byte{0, 0})...)
+	// A formula with a text result, given in the STRING record after it
+	sheet = append(sheet, biffRec(biffFormula, uint16(2), uint16(1), uint16(0), []byte{0, 0, 0, 0, 0, 0, 0xFF, 0xFF}, uint16(0), uint32(0), []byte{0, 0})...)
+	sheet = append(sheet, biffRec(biffString, biffText("ME-1"))...)
+	sheet = append(sheet, biffRec(biffRK, uint16(2), uint16(2), uint16(0), uint32(720<<2|2))...)
+	sheet = append(sheet, biffRec(biffBoolErr, uint16(2), uint16(4), uint16(0), uint8(1), uint8(0))...)
+	sheet = append(sheet, biffRec(biffEOF)...)
+	return append(globals, sheet...)
+}
+
+// compoundFile wraps a stream in a minimal compound file, as .xls workbooks
+// are stored.
+func compoundFile(name string, stream []byte) []byte {
+	const sector = 512
+	const noStream, endOfChain, freeSect = 0xFFFFFFFF, 0xFFFFFFFE, 0xFFFFFFFF
+	// Streams under 4096 bytes would go in the mini stream
+	size := len(stream)
+	if size < 4096 {
+		size = 4096
+	}
+	data := make([]byte, (size+sector-1)/sector*sector)
+	copy(data, stream)
+	n := len(data) / sector
+
+	header := make([]byte, sector)
+	copy(header, cfbSignature)
+	le := binary.LittleEndian
+	le.PutUint16(header[24:], 0x3E)
+	le.PutUint16(header[26:], 3)
+	le.PutUint16(header[28:], 0xFFFE)
+	le.PutUint16(header[30:], 9)
+	le.PutUint16(header[32:], 6)
+	le.PutUint32(header[44:], 1) // FAT sectors
+	le.PutUint32(header[48:], 1) // first directory sector
+	le.PutUint32(header[56:], 4096)
+	le.PutUint32(header[60:], endOfChain)
+	le.PutUint32(header[68:], endOfChain)
+	le.PutUint32(header[76:], 0) // the FAT is sector 0
+	for i := 80; i < sector; i += 4 {
+		le.PutUint32(header[i:], freeSect)
+	}
+
+	fat := make([]byte, sector)
+	for i := 0; i < sector/4; i++ {
+		le.PutUint32(fat[4*i:], freeSect)
+	}
+	le.PutUint32(fat[0:], 0xFFFFFFFD)
+	le.PutUint32(fat[4:], endOfChain)
+	for i := 0; i < n; i++ {
+		next := uint32(3 + i)
+		if i == n-1 {
+			next = endOfChain
+		}
+		le.PutUint32(fat[4*(2+i):], next)
+	}
+
+	dir := make([]byte, sector)
+	entry := func(i int, name string, kind byte, child, start uint32, size uint64) {
+		e := dir[128*i : 128*(i+1)]
+		units := utf16.Encode([]rune(name))
+		for j, u := range units {
+			le.PutUint16(e[2*j:], u)
+		}
+		le.PutUint16(e[64:], uint16(2*len(units)+2))
+		e[66], e[67] = kind, 1
+		le.PutUint32(e[68:], noStream)
+		le.PutUint32(e[72:], noStream)
+		le.PutUint32(e[76:], child)
+		le.PutUint32(e[116:], start)
+		le.PutUint64(e[120:], size)
+	}
+	entry(0, "Root Entry", 5, 1, endOfChain, 0)
+	entry(1, name, 2, noStream, 2, uint64(size))
+	for i := 2; i < 4; i++ {
+		le.PutUint32(dir[128*i+68:], noStream)
+		le.PutUint32(dir[128*i+72:], noStream)
+		le.PutUint32(dir[128*i+76:], noStream)
+	}
+
+	out := append(header, fat...)
+	out = append(out, dir...)
+	return append(out, data...)
+}
+
+func TestXLSWorkbook(t *testing.T) {
+	f, err := xlsWorkbook(compoundFile("Workbook", xlsEngines()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if sheets := f.GetSheetList(); len(sheets) != 1 || sheets[0] != "Engines" {
+		t.Fatalf("Expected the Engines sheet, got %v", sheets)
+	}
+	rows, err := f.GetRows("Engines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Timestamp", "Engine", "RPM", "Temperature"},
+		{"2024-01-01T00:00:00Z", "ME-1", "700", "82.5"},
+		{"2024-01-01T06:00:00Z", "ME-1", "720", "", "TRUE"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("Expected %d rows, got %q", len(want), rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("Row %d: expected %q, got %q", i, want[i], rows[i])
+		}
+	}
+}
+
+func TestXLSWorkbookErrors(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"Excel 4":      {0x09, 0x04, 0x06, 0x00, 0x00, 0x00, 0x10, 0x00},
+		"encrypted":    compoundFile("EncryptedPackage", []byte("secret")),
+		"no workbook":  compoundFile("WordDocument", []byte("text")),
+		"truncated":    compoundFile("Workbook", xlsEngines()[:40]),
+		"not compound": append(append([]byte{}, cfbSignature...), "garbage"...),
+		"password": compoundFile("Workbook", append(
+			biffRec(biffBOF, uint16(0x0600), uint16(0x0005), make([]byte, 12)),
+			biffRec(biffFilePass, uint16(1))...)),
+	} {
+		if _, err := openWorkbook(data); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("%s: expected ErrUnsupportedFormat, got %v", name, err)
+		}
+	}
+}
+
+func TestRKValue(t *testing.T) {
+	for rk, want := range map[uint32]float64{
+		700<<2 | 2:  700,
+		8250<<2 | 3: 82.5,
+		0x3FF80000:  1.5,
+		0x3FF80001:  0.015,
+		0xFFFFFFFE:  -1,
+	} {
+		if got := rkValue(rk); got != want {
+			t.Errorf("rkValue(%#x) = %v, want %v", rk, got, want)
+		}
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	book := &biffBook{formats: map[uint16]string{
+		164: "yyyy-mm-dd hh:mm",
+		165: `0.0" kW"`,
+		166: "[Red]0.00",
+		167: "General",
+		168: `[$-409]d-mmm-yy`,
+	}}
+	for index, want := range map[uint16]bool{14: true, 22: true, 2: false, 164: true, 165: false, 166: false, 167: false, 168: true, 200: false} {
+		if got := book.isDateFormat(index); got != want {
+			t.Errorf("isDateFormat(%d) = %v, want %v", index, got, want)
+		}
+	}
+}
+
+func TestProcessXLSFile(t *testing.T) {
+	database, err := db.Connect(filepath.Join(t.TempDir(), "xls.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	processor := NewXLSXProcessor(store.New(database), false)
+
+	response, err := processor.ProcessFile(context.Background(), compoundFile("Workbook", xlsEngines()), "engines.xls", IngestOptions{IMO: "9811000", Mode: ModeInsert, Source: models.SourceSensor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RowsInserted["engines"] != 2 || len(response.Warnings) != 0 {
+		t.Errorf("Expected 2 engine rows, got %+v", response)
+	}
+}
+
+func FuzzXLSWorkbook(f *testing.F) {
+	f.Add(compoundFile("Workbook", xlsEngines()))
+	f.Add(xlsEngines())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Errors are expected for most inputs; panics and hangs are not
+		if f, err := xlsWorkbook(data); err == nil {
+			f.Close()
+		}
+		parseBIFF(data)
+	})
+}
@@ -1,191 +1,344 @@
 package ingest
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/xuri/excelize/v2"
 
+	"vessel-telemetry-api/internal/fair"
+	"vessel-telemetry-api/internal/fueldrop"
 	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
 	"vessel-telemetry-api/internal/util"
 )
 
+// maxUnzippedSize bounds the total uncompressed size of a workbook. excelize
+// allocates what the zip headers claim, so without it a few corrupt bytes can
+// make it ask for gigabytes.
+const maxUnzippedSize = 256 << 20
+
 type XLSXProcessor struct {
-	db                         *sql.DB
+	store                      store.Store
 	allowUnsafeDuplicateIngest bool
+	defaultQuota               models.QuotaPolicy
+	fuelDrop                   fueldrop.Options
+	onIngest                   func(ctx context.Context, filename string, resp *models.IngestResponse)
+	// now is the clock quota days are counted by
+	now func() time.Time
+	// scheduler, if set, shares ingest slots between dropped files and
+	// uploads; tenant is who the files count against
+	scheduler *fair.Scheduler
+	tenant    string
 }
 
-func NewXLSXProcessor(db *sql.DB, allowUnsafeDuplicateIngest bool) *XLSXProcessor {
+func NewXLSXProcessor(st store.Store, allowUnsafeDuplicateIngest bool) *XLSXProcessor {
 	return &XLSXProcessor{
-		db:                         db,
+		store:                      st,
 		allowUnsafeDuplicateIngest: allowUnsafeDuplicateIngest,
+		fuelDrop:                   fueldrop.DefaultOptions,
+		now:                        time.Now,
 	}
 }
 
-func (p *XLSXProcessor) ProcessFile(fileData []byte, filename, imo, vesselName string, periodStart *time.Time) (*models.IngestResponse, error) {
+// OnIngest sets a function called after each file is ingested, with its
+// response, e.g. to drop cached reads or tell downstream systems.
+func (p *XLSXProcessor) OnIngest(fn func(ctx context.Context, filename string, resp *models.IngestResponse)) {
+	p.onIngest = fn
+}
+
+// IngestOptions are the parameters of an upload, applying to every sheet
+// of its files.
+type IngestOptions struct {
+	// IMO identifies the vessel, over the IMO of the Ship Info sheet;
+	// VesselName names it when the sheet does not, or without an IMO
+	IMO, VesselName string
+	// PeriodStart dates the upload instead of the time of ingest; nil if none
+	PeriodStart *time.Time
+	Mode        IngestMode
+	// Source tags every reading (see models.ReadingSources)
+	Source string
+	// Uncertainty, in percent, is the estimate given to fuel and generator
+	// readings whose sheet has no uncertainty column; nil if they are exact
+	Uncertainty *float64
+	// Sheets override the streams of sheets by name; nil if none
+	Sheets SheetOverrides
+}
+
+// ProcessFile ingests an XLSX, .xls or .ods workbook with opts.
+func (p *XLSXProcessor) ProcessFile(ctx context.Context, fileData []byte, filename string, opts IngestOptions) (*models.IngestResponse, error) {
 	// Compute file hash
 	fileHash := util.SHA256Hex(fileData)
 
 	// Check if already processed
-	var existingUploadID int64
-	err := p.db.QueryRow("SELECT id FROM uploads WHERE file_hash = ?", fileHash).Scan(&existingUploadID)
+	existingUploadID, err := p.store.FindUploadByHash(ctx, fileHash)
 	if err == nil {
 		return &models.IngestResponse{
 			Status:   "already_ingested",
 			UploadID: &existingUploadID,
 		}, nil
-	} else if err != sql.ErrNoRows {
+	} else if !errors.Is(err, store.ErrNotFound) {
 		return nil, fmt.Errorf("error checking file hash: %w", err)
 	}
 
-	// Parse XLSX
-	f, err := excelize.OpenReader(strings.NewReader(string(fileData)))
+	// Parse XLSX, legacy .xls or .ods
+	f, err := openWorkbook(fileData)
 	if err != nil {
-		return nil, fmt.Errorf("error opening XLSX: %w", err)
+		return nil, err
 	}
 	defer f.Close()
 
+	matcher := p.newSheetMatcher(ctx, opts.Sheets)
+	matcher.reportMissing = true
+	return p.processWorkbook(ctx, f, filename, opts, 0, matcher, fileHash)
+}
+
+// fileWarnings returns warnings about the file as a whole.
+func fileWarnings(messages ...string) []models.UploadWarning {
+	warnings := make([]models.UploadWarning, len(messages))
+	for i, m := range messages {
+		warnings[i] = models.UploadWarning{Message: m}
+	}
+	return warnings
+}
+
+// processWorkbook ingests an opened workbook read from filename with opts,
+// picking the stream of each sheet with matcher rather than opts.Sheets.
+// archiveVessel is the vessel an
+// earlier file of the same archive was ingested for, 0 if none; a workbook
+// that names no vessel by IMO goes to it instead of creating a vessel.
+// The upload is recorded under fileHash, with its warnings.
+func (p *XLSXProcessor) processWorkbook(ctx context.Context, f *excelize.File, filename string, opts IngestOptions, archiveVessel int64, matcher *sheetMatcher, fileHash string) (*models.IngestResponse, error) {
 	uploadedAt := time.Now()
-	if periodStart != nil {
-		uploadedAt = *periodStart
+	if opts.PeriodStart != nil {
+		uploadedAt = *opts.PeriodStart
 	}
 
-	// Process Ship Info sheet first
-	vesselID, locationCount, locationWarnings, err := p.processShipInfo(f, imo, vesselName, uploadedAt)
+	// Process Ship Info sheet first, refusing data from throttled vessels
+	// that already used up today's quota before writing any of it
+	info, err := p.resolveShipInfo(ctx, f, opts.IMO, opts.VesselName, archiveVessel)
+	if err != nil {
+		return nil, fmt.Errorf("error processing ship info: %w", err)
+	}
+	if info.vesselID != 0 {
+		if err := p.CheckQuota(ctx, info.vesselID); err != nil {
+			return nil, err
+		}
+	}
+	vesselID, locationResult, locationWarnings, err := p.writeShipInfo(ctx, info, uploadedAt, opts.Mode, opts.Source)
 	if err != nil {
 		return nil, fmt.Errorf("error processing ship info: %w", err)
 	}
 
 	// Create upload record
-	//result, err := p.db.Exec(
-	//	"INSERT INTO uploads (vessel_id, source_filename, file_hash, uploaded_at) VALUES (?, ?, ?, ?)",
-	//	vesselID, filename, fileHash, uploadedAt,
-	//)
-	//if err != nil {
-	//	return nil, fmt.Errorf("error creating upload record: %w", err)
-	//}
-
-	//uploadID, _ := result.LastInsertId()
-	uploadID := int64(1)
+	uploadID, err := p.store.CreateUpload(ctx, models.Upload{
+		VesselID: vesselID, SourceFilename: filename, FileHash: fileHash, UploadedAt: uploadedAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating upload record: %w", err)
+	}
 
 	// Process telemetry sheets
 	rowsInserted := make(map[string]int)
-	var warnings []string
+	rowsUpdated := make(map[string]int)
+	var warnings []models.UploadWarning
 
 	// Add location data from Ship Info processing
-	if locationCount > 0 {
-		rowsInserted["location"] = locationCount
+	switch locationResult {
+	case store.WriteInserted:
+		rowsInserted["location"] = 1
+	case store.WriteUpdated:
+		rowsUpdated["location"] = 1
 	}
-	warnings = append(warnings, locationWarnings...)
+	warnings = append(warnings, fileWarnings(locationWarnings...)...)
+
+	aliases, err := p.headerAliases(ctx, vesselID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading header aliases: %w", err)
+	}
+	aliases = append(append([]models.HeaderAlias{}, matcher.aliases...), aliases...)
+	rules, ruleWarnings, err := p.validationRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reading validation rules: %w", err)
+	}
+	warnings = append(warnings, fileWarnings(ruleWarnings...)...)
+	customWarned := false
+	// Noon reports are read after the telemetry they are reconciled with,
+	// data channel readings after them
+	var noonSheets, channelSheets []string
 
 	sheets := f.GetSheetList()
 	for _, sheetName := range sheets {
-		sheetNameLower := strings.ToLower(sheetName)
-
-		switch {
-		case strings.Contains(sheetNameLower, "engine"):
-			count, warns := p.processEngineSheet(f, sheetName, vesselID, uploadedAt)
-			rowsInserted["engines"] = count
-			warnings = append(warnings, warns...)
-		case strings.Contains(sheetNameLower, "fuel"):
-			count, warns := p.processFuelSheet(f, sheetName, vesselID, uploadedAt)
-			rowsInserted["fuel"] = count
-			warnings = append(warnings, warns...)
-		case strings.Contains(sheetNameLower, "generator"):
-			count, warns := p.processGeneratorSheet(f, sheetName, vesselID, uploadedAt)
-			rowsInserted["generators"] = count
-			warnings = append(warnings, warns...)
-		case strings.Contains(sheetNameLower, "cctv"):
-			count, warns := p.processCCTVSheet(f, sheetName, vesselID, uploadedAt)
-			rowsInserted["cctv"] = count
-			warnings = append(warnings, warns...)
-		case strings.Contains(sheetNameLower, "impact") || strings.Contains(sheetNameLower, "vibration"):
-			count, warns := p.processImpactSheet(f, sheetName, vesselID, uploadedAt)
-			rowsInserted["impact"] = count
-			warnings = append(warnings, warns...)
+		if matcher.channelSheet(sheetName) {
+			channelSheets = append(channelSheets, sheetName)
+			continue
+		}
+		if _, overridden := matcher.overrides.lookup(sheetName); !overridden && isNoonReportSheet(sheetName) {
+			noonSheets = append(noonSheets, sheetName)
+			continue
 		}
+		def, warn := matcher.match(sheetName)
+		if warn != "" {
+			warnings = append(warnings, models.UploadWarning{Sheet: &sheetName, Message: warn})
+		}
+		if matcher.err != nil && !customWarned {
+			customWarned = true
+			warnings = append(warnings, fileWarnings(fmt.Sprintf("error reading custom streams: %v", matcher.err))...)
+		}
+		if def == nil {
+			continue
+		}
+		inserted, updated, warns := p.processSheet(ctx, f, sheetName, def, vesselID, aliases, rules[def.stream.Name], uploadedAt, opts.Mode, opts.Source, opts.Uncertainty)
+		rowsInserted[def.stream.Name] += inserted
+		if updated > 0 {
+			rowsUpdated[def.stream.Name] += updated
+		}
+		warnings = append(warnings, warns...)
 	}
+	warnings = append(warnings, fileWarnings(matcher.missing()...)...)
 
 	// Update vessel_stream_latest
-	p.updateStreamLatest(vesselID, rowsInserted, uploadedAt)
+	p.updateStreamLatest(ctx, vesselID, uploadedAt, rowsInserted, rowsUpdated)
+
+	for _, sheetName := range noonSheets {
+		inserted, updated, warns := p.processNoonSheet(ctx, f, sheetName, vesselID, uploadID, aliases, uploadedAt, opts.Mode)
+		rowsInserted[NoonReports] += inserted
+		if updated > 0 {
+			rowsUpdated[NoonReports] += updated
+		}
+		warnings = append(warnings, warns...)
+	}
+	for _, sheetName := range channelSheets {
+		inserted, updated, warns := p.processChannelSheet(ctx, f, sheetName, vesselID, uploadID, aliases, uploadedAt, opts.Mode)
+		rowsInserted[ChannelReadings] += inserted
+		if updated > 0 {
+			rowsUpdated[ChannelReadings] += updated
+		}
+		warnings = append(warnings, warns...)
+	}
 
-	return &models.IngestResponse{
+	written := 0
+	for _, n := range rowsInserted {
+		written += n
+	}
+	for _, n := range rowsUpdated {
+		written += n
+	}
+	if warn := p.RecordUsage(ctx, vesselID, written); warn != "" {
+		warnings = append(warnings, fileWarnings(warn)...)
+	}
+	response := &models.IngestResponse{
 		Status:       "ingested",
 		UploadID:     &uploadID,
 		VesselID:     &vesselID,
 		RowsInserted: rowsInserted,
-		Warnings:     warnings,
-	}, nil
+	}
+	for _, w := range warnings {
+		response.Warnings = append(response.Warnings, w.Message)
+	}
+	// Kept for GET /uploads/:id/warnings; the ingest stands without them
+	if err := p.store.AddUploadWarnings(ctx, uploadID, warnings); err != nil {
+		response.Warnings = append(response.Warnings, fmt.Sprintf("error saving warnings: %v", err))
+	}
+	if opts.Mode == ModeUpsert {
+		response.RowsUpdated = rowsUpdated
+	}
+	if p.onIngest != nil {
+		p.onIngest(ctx, filename, response)
+	}
+	return response, nil
+}
+
+// shipInfoColumns are the headers read from the Ship Info sheet: the
+// vessel's identity, then its position, written as a location reading.
+var shipInfoColumns = []sheetColumn{
+	{"imo", []string{"imo"}, nil},
+	{"name", []string{"name", "vessel_name", "ship_name"}, nil},
+	{"mmsi", []string{"mmsi"}, nil},
+	{"flag", []string{"flag"}, nil},
+	{"type", []string{"type", "vessel_type", "ship_type"}, nil},
+	{"fleet", []string{"fleet"}, nil},
+	{"latitude", []string{"latitude", "lat"}, nil},
+	{"longitude", []string{"longitude", "lon", "lng"}, nil},
+	{"course_degrees", []string{"course", "heading", "bearing"}, nil},
+	{"speed_knots", []string{"speed", "speed_knots", "speed(knots)"}, nil},
+	{"status", []string{"status", "vessel_status", "nav_status"}, nil},
+}
+
+// shipInfoHeaders returns the headers of a shipInfoColumns column.
+func shipInfoHeaders(name string) []string {
+	for _, col := range shipInfoColumns {
+		if col.name == name {
+			return col.headers
+		}
+	}
+	return nil
+}
+
+// isShipInfoSheet reports whether a sheet holds the vessel's details.
+func isShipInfoSheet(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "ship") && strings.Contains(name, "info")
+}
+
+// shipInfo is the vessel a workbook is for, as read from its Ship Info sheet
+// or the identifiers given, before anything is written.
+type shipInfo struct {
+	// vesselID is the existing vessel, 0 for one to create from vessel
+	vesselID int64
+	// vessel is what the vessel is created or updated with; nil to leave
+	// an existing vessel as it is
+	vessel *models.Vessel
+	// headers and data are the Ship Info sheet's header and first row, nil
+	// without one, for the position it may report
+	headers, data []string
+	mapper        *HeaderMapper
 }
 
-func (p *XLSXProcessor) processShipInfo(f *excelize.File, providedIMO, vesselName string, uploadedAt time.Time) (int64, int, []string, error) {
+// resolveShipInfo finds the vessel a workbook is for without writing
+// anything, so that the vessel's quota can be checked first.
+func (p *XLSXProcessor) resolveShipInfo(ctx context.Context, f *excelize.File, providedIMO, vesselName string, archiveVessel int64) (shipInfo, error) {
 	sheets := f.GetSheetList()
 	var shipInfoSheet string
 
 	for _, sheet := range sheets {
-		if strings.Contains(strings.ToLower(sheet), "ship") && strings.Contains(strings.ToLower(sheet), "info") {
+		if isShipInfoSheet(sheet) {
 			shipInfoSheet = sheet
 			break
 		}
 	}
 
-	if shipInfoSheet == "" {
-		// No ship info sheet, create vessel with provided identifiers
+	// Without a (readable) Ship Info sheet, the vessel is the one of the
+	// provided IMO, else created with the provided identifiers
+	fallback := func() (shipInfo, error) {
+		if archiveVessel != 0 {
+			return shipInfo{vesselID: archiveVessel}, nil
+		}
 		if providedIMO != "" {
+			if existingID, err := p.store.FindVesselByIMO(ctx, providedIMO); err == nil {
+				return shipInfo{vesselID: existingID}, nil
+			}
 			// Use provided vessel name or default to IMO-based name
 			name := vesselName
 			if name == "" {
 				name = fmt.Sprintf("Vessel-%s", providedIMO)
 			}
-			result, err := p.db.Exec("INSERT INTO vessels (imo, name) VALUES (?, ?)", providedIMO, name)
-			if err != nil {
-				return 0, 0, nil, err
-			}
-			id, _ := result.LastInsertId()
-			return id, 0, nil, nil
-		} else {
-			if vesselName == "" {
-				return 0, 0, nil, fmt.Errorf("vessel name is required when IMO is not provided")
-			}
-			result, err := p.db.Exec("INSERT INTO vessels (name) VALUES (?)", vesselName)
-			if err != nil {
-				return 0, 0, nil, err
-			}
-			id, _ := result.LastInsertId()
-			return id, 0, nil, nil
+			return shipInfo{vessel: &models.Vessel{IMO: &providedIMO, Name: name}}, nil
+		}
+		if vesselName == "" {
+			return shipInfo{}, fmt.Errorf("vessel name is required when IMO is not provided")
 		}
+		return shipInfo{vessel: &models.Vessel{Name: vesselName}}, nil
+	}
+	if shipInfoSheet == "" {
+		return fallback()
 	}
-
 	rows, err := f.GetRows(shipInfoSheet)
 	if err != nil || len(rows) < 2 {
-		// Fallback to provided identifiers
-		if providedIMO != "" {
-			// Use provided vessel name or default to IMO-based name
-			name := vesselName
-			if name == "" {
-				name = fmt.Sprintf("Vessel-%s", providedIMO)
-			}
-			result, err := p.db.Exec("INSERT INTO vessels (imo, name) VALUES (?, ?)", providedIMO, name)
-			if err != nil {
-				return 0, 0, nil, err
-			}
-			id, _ := result.LastInsertId()
-			return id, 0, nil, nil
-		} else {
-			if vesselName == "" {
-				return 0, 0, nil, fmt.Errorf("vessel name is required when IMO is not provided")
-			}
-			result, err := p.db.Exec("INSERT INTO vessels (name) VALUES (?)", vesselName)
-			if err != nil {
-				return 0, 0, nil, err
-			}
-			id, _ := result.LastInsertId()
-			return id, 0, nil, nil
-		}
+		return fallback()
 	}
 
 	headers := rows[0]
@@ -193,12 +346,12 @@ func (p *XLSXProcessor) processShipInfo(f *excelize.File, providedIMO, vesselNam
 
 	mapper := NewHeaderMapper(headers)
 
-	var imo, name, flag, vesselType *string
+	var imo, mmsi, name, flag, vesselType, fleet *string
 
 	// Prioritize provided IMO over extracted IMO
 	if providedIMO != "" {
 		imo = &providedIMO
-	} else if imoCol, found := mapper.FindHeader("imo"); found {
+	} else if imoCol, found := mapper.FindHeader(shipInfoHeaders("imo")...); found {
 		for i, h := range headers {
 			if h == imoCol && i < len(data) && data[i] != "" {
 				val := data[i]
@@ -208,7 +361,7 @@ func (p *XLSXProcessor) processShipInfo(f *excelize.File, providedIMO, vesselNam
 		}
 	}
 
-	if nameCol, found := mapper.FindHeader("name", "vessel_name", "ship_name"); found {
+	if nameCol, found := mapper.FindHeader(shipInfoHeaders("name")...); found {
 		for i, h := range headers {
 			if h == nameCol && i < len(data) && data[i] != "" {
 				val := data[i]
@@ -218,7 +371,17 @@ func (p *XLSXProcessor) processShipInfo(f *excelize.File, providedIMO, vesselNam
 		}
 	}
 
-	if flagCol, found := mapper.FindHeader("flag"); found {
+	if mmsiCol, found := mapper.FindHeader(shipInfoHeaders("mmsi")...); found {
+		for i, h := range headers {
+			if h == mmsiCol && i < len(data) && data[i] != "" {
+				val := data[i]
+				mmsi = &val
+				break
+			}
+		}
+	}
+
+	if flagCol, found := mapper.FindHeader(shipInfoHeaders("flag")...); found {
 		for i, h := range headers {
 			if h == flagCol && i < len(data) && data[i] != "" {
 				val := data[i]
@@ -228,7 +391,7 @@ func (p *XLSXProcessor) processShipInfo(f *excelize.File, providedIMO, vesselNam
 		}
 	}
 
-	if typeCol, found := mapper.FindHeader("type", "vessel_type", "ship_type"); found {
+	if typeCol, found := mapper.FindHeader(shipInfoHeaders("type")...); found {
 		for i, h := range headers {
 			if h == typeCol && i < len(data) && data[i] != "" {
 				val := data[i]
@@ -238,6 +401,16 @@ func (p *XLSXProcessor) processShipInfo(f *excelize.File, providedIMO, vesselNam
 		}
 	}
 
+	if fleetCol, found := mapper.FindHeader(shipInfoHeaders("fleet")...); found {
+		for i, h := range headers {
+			if h == fleetCol && i < len(data) && data[i] != "" {
+				val := data[i]
+				fleet = &val
+				break
+			}
+		}
+	}
+
 	if name == nil {
 		if vesselName != "" {
 			name = &vesselName
@@ -248,576 +421,234 @@ func (p *XLSXProcessor) processShipInfo(f *excelize.File, providedIMO, vesselNam
 		}
 	}
 
-	var vesselID int64
+	info := shipInfo{
+		vessel:  &models.Vessel{IMO: imo, MMSI: mmsi, Name: *name, Flag: flag, Type: vesselType, Fleet: fleet},
+		headers: headers, data: data, mapper: mapper,
+	}
 
-	// Try to find existing vessel by IMO or name
+	// Find the existing vessel by IMO, else the archive's
 	if imo != nil {
-		var existingID int64
-		err := p.db.QueryRow("SELECT id FROM vessels WHERE imo = ?", *imo).Scan(&existingID)
-		if err == nil {
-			// Update existing vessel
-			_, err = p.db.Exec(
-				"UPDATE vessels SET name = ?, flag = ?, type = ?, updated_at = datetime('now') WHERE id = ?",
-				*name, flag, vesselType, existingID,
-			)
-			if err != nil {
-				return 0, 0, nil, err
-			}
-			vesselID = existingID
+		if existingID, err := p.store.FindVesselByIMO(ctx, *imo); err == nil {
+			info.vesselID = existingID
 		}
 	}
+	if info.vesselID == 0 && imo == nil && archiveVessel != 0 {
+		info.vesselID = archiveVessel
+	}
+	return info, nil
+}
 
-	if vesselID == 0 {
-		// Create new vessel
-		result, err := p.db.Exec(
-			"INSERT INTO vessels (imo, name, flag, type) VALUES (?, ?, ?, ?)",
-			imo, *name, flag, vesselType,
-		)
+// writeShipInfo creates or updates the vessel resolved by resolveShipInfo
+// and writes the position its Ship Info sheet reports, returning the vessel.
+func (p *XLSXProcessor) writeShipInfo(ctx context.Context, info shipInfo, uploadedAt time.Time, mode IngestMode, source string) (int64, store.WriteResult, []string, error) {
+	vesselID := info.vesselID
+	switch {
+	case vesselID == 0:
+		id, err := p.store.CreateVessel(ctx, *info.vessel)
 		if err != nil {
 			return 0, 0, nil, err
 		}
-		vesselID, _ = result.LastInsertId()
+		vesselID = id
+	case info.vessel != nil:
+		if err := p.store.UpdateVesselInfo(ctx, vesselID, *info.vessel); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	if info.headers == nil {
+		return vesselID, 0, nil, nil
 	}
 
 	// Process location data from Ship Info sheet
-	locationCount, locationWarnings := p.processLocationFromShipInfo(headers, data, vesselID, uploadedAt, mapper)
+	locationResult, locationWarnings := p.processLocationFromShipInfo(ctx, info.headers, info.data, vesselID, uploadedAt, info.mapper, mode, source)
 
-	return vesselID, locationCount, locationWarnings, nil
+	return vesselID, locationResult, locationWarnings, nil
 }
 
-func (p *XLSXProcessor) processEngineSheet(f *excelize.File, sheetName string, vesselID int64, defaultTS time.Time) (int, []string) {
+// processSheet writes the rows of a sheet of the stream, with the vessel's
+// header aliases, checking them against the stream's rules. uncertainty is the default of streams with uncertainty
+// estimates, see ProcessFile.
+func (p *XLSXProcessor) processSheet(ctx context.Context, f *excelize.File, sheetName string, def *sheetStream, vesselID int64, aliases []models.HeaderAlias, rules []streamRule, defaultTS time.Time, mode IngestMode, source string, uncertainty *float64) (int, int, []models.UploadWarning) {
 	rows, err := f.GetRows(sheetName)
 	if err != nil || len(rows) < 2 {
-		return 0, []string{fmt.Sprintf("error reading %s sheet", sheetName)}
+		return 0, 0, []models.UploadWarning{{Sheet: &sheetName, Message: fmt.Sprintf("error reading %s sheet", sheetName)}}
 	}
 
 	headers := rows[0]
-	mapper := NewHeaderMapper(headers)
-
-	var warnings []string
-	inserted := 0
+	mapper := aliasedMapper(headers, def.stream.Name, aliases)
+	stream := def.stream
 
-	tsCol, hasTS := mapper.FindTimestampHeader()
-	if hasTS {
-		fmt.Printf("DEBUG: Found timestamp column '%s' in engine sheet\n", tsCol)
-	} else {
-		fmt.Printf("DEBUG: No timestamp column found in engine sheet. Available headers: %v\n", headers)
+	tsCol, confidence := mapper.MatchField("ts", timestampHeaders...)
+	hasTS := tsCol != ""
+	run := &sheetRun{p: p, ctx: ctx, name: sheetName, vesselID: vesselID, mapper: mapper, headers: make(map[string]string)}
+	run.checkConfidence(tsCol, "ts", confidence)
+	mappedCols := []string{tsCol}
+	for _, col := range def.columns {
+		header, confidence := mapper.MatchField(col.name, col.headers...)
+		run.checkConfidence(header, col.name, confidence)
+		run.headers[col.name] = header
+		mappedCols = append(mappedCols, header)
 	}
-	engineNoCol, _ := mapper.FindHeader("engine_no", "engine", "eng_no")
-	rpmCol, _ := mapper.FindHeader("rpm")
-	tempCol, _ := mapper.FindHeader("temp", "temperature", "temp_c")
-	pressureCol, _ := mapper.FindHeader("oil_pressure", "pressure", "oil_press")
-	alarmsCol, _ := mapper.FindHeader("alarm", "alarms", "alert")
-
-	mappedCols := []string{tsCol, engineNoCol, rpmCol, tempCol, pressureCol, alarmsCol}
-
-	for i := 1; i < len(rows); i++ {
-		row := make(map[string]string)
-		for j, cell := range rows[i] {
-			if j < len(headers) {
-				row[headers[j]] = cell
-			}
-		}
-
-		// Parse timestamp
-		ts := defaultTS
-		if hasTS && tsCol != "" {
-			if parsedTS, err := ParseTimestamp(row[tsCol]); err == nil {
-				ts = parsedTS
-			}
-		}
-
-		// Parse fields
-		var engineNo *int
-		var rpm, tempC, oilPressure *float64
-		var alarms *string
-
-		var numOnly = regexp.MustCompile(`\d+`)
-
-		if engineNoCol != "" {
-			match := numOnly.FindString(row[engineNoCol]) // extract only digits
-			if match != "" {
-				if val, err := strconv.Atoi(match); err == nil {
-					engineNo = &val // assign pointer to the parsed int
-				}
-			}
-		}
-		if rpmCol != "" {
-			rpm, _ = ParseFloat(row[rpmCol])
-		}
-		if tempCol != "" {
-			tempC, _ = ParseFloat(row[tempCol])
-		}
-		if pressureCol != "" {
-			oilPressure, _ = ParseFloat(row[pressureCol])
-		}
-		if alarmsCol != "" && row[alarmsCol] != "" {
-			val := row[alarmsCol]
-			alarms = &val
-		}
-
-		// Validate
-		if warns := ValidateEngineData(rpm, tempC, oilPressure); len(warns) > 0 {
-			warnings = append(warnings, fmt.Sprintf("row %d engines: %s", i+1, strings.Join(warns, ", ")))
-			continue
-		}
-
-		// Build extra JSON
-		extraJSON, _ := BuildExtraJSON(row, mappedCols)
-
-		// Create row hash
-		hashKeys := []string{}
-		if engineNo != nil {
-			hashKeys = append(hashKeys, fmt.Sprintf("engine_no:%d", *engineNo))
-		}
-		hashKeys = append(hashKeys, string(extraJSON))
-		rowHash := util.HashRow(vesselID, ts, "engines", hashKeys...)
-
-		// Insert
-		_, err := p.db.Exec(`
-			INSERT OR IGNORE INTO engine_readings 
-			(vessel_id, engine_no, ts, rpm, temp_c, oil_pressure_bar, alarms, row_hash, extra_json)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			vesselID, engineNo, ts, rpm, tempC, oilPressure, alarms, rowHash, extraJSON,
-		)
-		if err == nil {
-			inserted++
-		}
+	uncertain := len(stream.Uncertain) > 0
+	var checks *rowRules
+	if len(rules) > 0 {
+		checks = newRowRules(def, rules)
 	}
-
-	return inserted, warnings
-}
-
-func (p *XLSXProcessor) processFuelSheet(f *excelize.File, sheetName string, vesselID int64, defaultTS time.Time) (int, []string) {
-	rows, err := f.GetRows(sheetName)
-	if err != nil || len(rows) < 2 {
-		return 0, []string{fmt.Sprintf("error reading %s sheet", sheetName)}
+	var spikes *spikeFilters
+	if def.custom == nil {
+		spikes = newSpikeFilters(run, stream)
 	}
 
-	headers := rows[0]
-	mapper := NewHeaderMapper(headers)
-
-	var warnings []string
-	inserted := 0
-
-	// Header names (not values!)
-	tsCol, hasTS := mapper.FindTimestampHeader()
-	tankNoCol, _ := mapper.FindHeader("tank_no", "tank", "tank_id", "Tank ID")
-
-	// Capacity column (may be liters or m3)
-	capCol, _ := mapper.FindHeader("capacity", "Capacity(m3)", "volume", "volume_liters")
-
-	// Current volume column (often "Current Level(m3)" in your sheet)
-	curCol, _ := mapper.FindHeader("current", "Current Level(m3)", "current_level", "current_volume", "volume_liters")
-
-	tempCol, _ := mapper.FindHeader("temp", "temperature", "temp_c")
-
-	// for extra_json; keep the *source* headers that we read
-	mappedCols := []string{}
-	if tsCol != "" {
-		mappedCols = append(mappedCols, tsCol)
-	}
-	if tankNoCol != "" {
-		mappedCols = append(mappedCols, tankNoCol)
-	}
-	if capCol != "" {
-		mappedCols = append(mappedCols, capCol)
-	}
-	if curCol != "" {
-		mappedCols = append(mappedCols, curCol)
-	}
-	if tempCol != "" {
-		mappedCols = append(mappedCols, tempCol)
+	var hooks sheetHooks
+	if def.open != nil {
+		hooks = def.open(run)
 	}
 
-	// helper to detect m3 headers
-	isM3Header := func(h string) bool {
-		h = strings.ToLower(h)
-		return strings.Contains(h, "(m3)") || strings.Contains(h, "m3")
-	}
+	inserted, updated := 0, 0
+	// Earliest and latest reading written
+	var since, until *time.Time
 
 	for i := 1; i < len(rows); i++ {
-		// map row by header -> cell
-		row := make(map[string]string, len(headers))
+		r := &sheetRow{ts: defaultTS, cells: make(map[string]string, len(headers)), values: make(map[string]interface{})}
 		for j, cell := range rows[i] {
 			if j < len(headers) {
-				row[headers[j]] = cell
+				r.cells[headers[j]] = cell
 			}
 		}
-
-		// timestamp
-		ts := defaultTS
 		if hasTS && tsCol != "" {
-			if parsedTS, err := ParseTimestamp(row[tsCol]); err == nil {
-				ts = parsedTS
+			if parsedTS, err := ParseTimestamp(r.cells[tsCol]); err == nil {
+				r.ts = parsedTS
 			}
 		}
-
-		var numOnly = regexp.MustCompile(`\d+`)
-
-		var tankNo *int
-		if tankNoCol != "" {
-			match := numOnly.FindString(row[tankNoCol]) // extract only digits
-			if match != "" {
-				if val, err := strconv.Atoi(match); err == nil {
-					tankNo = &val // assign pointer to the parsed int
-				}
+		for _, col := range def.columns {
+			if header := run.headers[col.name]; header != "" {
+				r.values[col.name] = col.parse(header, r.cells[header])
 			}
 		}
-
-		// capacity (liters)
-		var capLiters *float64
-		if capCol != "" {
-			if v, _ := ParseFloat(row[capCol]); v != nil {
-				val := *v
-				if isM3Header(capCol) {
-					val *= 1000.0
-				}
-				capLiters = &val
-			}
+		if uncertain && !run.has("uncertainty_percent") {
+			r.values["uncertainty_percent"] = uncertainty
 		}
 
-		// current volume (liters) — prefer explicit "current" column; fallback to capCol if that's actually the only volume column
-		var curLiters *float64
-		if curCol != "" {
-			if v, _ := ParseFloat(row[curCol]); v != nil {
-				val := *v
-				if isM3Header(curCol) {
-					val *= 1000.0
-				}
-				curLiters = &val
-			}
-		} else if capCol != "" {
-			// Some sheets only provide one volume column; treat it as current volume
-			if v, _ := ParseFloat(row[capCol]); v != nil {
-				val := *v
-				if isM3Header(capCol) {
-					val *= 1000.0
-				}
-				curLiters = &val
+		if hooks.prepare != nil {
+			if warn := hooks.prepare(r); warn != "" {
+				run.warnRow(i+1, r, "%s: %s", stream.Name, warn)
+				continue
 			}
 		}
-
-		// temperature
-		var tempC *float64
-		if tempCol != "" {
-			tempC, _ = ParseFloat(row[tempCol])
+		var found []models.Outlier
+		if spikes != nil {
+			found = spikes.apply(i+1, r)
 		}
-
-		// level percent
-		var levelPercent *float64
-		if curLiters != nil && capLiters != nil && *capLiters > 0 {
-			val := (*curLiters / *capLiters) * 100.0
-			levelPercent = &val
+		var problems []string
+		if def.validate != nil {
+			problems = def.validate(r)
 		}
-
-		// Validate using current volume (liters) and temp
-		if warns := ValidateFuelData(levelPercent, curLiters, tempC); len(warns) > 0 {
-			warnings = append(warnings, fmt.Sprintf("row %d fuel: %s", i+1, strings.Join(warns, ", ")))
-			continue
+		if uncertain {
+			problems = append(problems, ValidateUncertainty(r.float("uncertainty_percent"))...)
 		}
-
-		// Build extra JSON from raw columns we used
-		extraJSON, _ := BuildExtraJSON(row, mappedCols)
-
-		// Hash
-		hashKeys := []string{}
-		if tankNo != nil {
-			hashKeys = append(hashKeys, fmt.Sprintf("tank_no:%d", *tankNo))
+		if len(problems) > 0 {
+			run.warnRow(i+1, r, "%s: %s", stream.Name, strings.Join(problems, ", "))
+			continue
 		}
-		hashKeys = append(hashKeys, string(extraJSON))
-		rowHash := util.HashRow(vesselID, ts, "fuel", hashKeys...)
-
-		// Insert (volume_liters = current volume in liters)
-		_, err := p.db.Exec(`
-			INSERT OR IGNORE INTO fuel_tank_readings 
-			(vessel_id, tank_no, ts, level_percent, volume_liters, temp_c, row_hash, extra_json)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			vesselID,
-			tankNo,
-			ts,
-			levelPercent,
-			curLiters,
-			tempC,
-			rowHash,
-			extraJSON,
-		)
-		if err == nil {
-			inserted++
-		} else {
-			warnings = append(warnings, fmt.Sprintf("row %d fuel insert error: %v", i+1, err))
+		if checks != nil && checks.check(run, i+1, r) {
+			continue
 		}
-	}
-
-	return inserted, warnings
-}
-
-func (p *XLSXProcessor) processGeneratorSheet(f *excelize.File, sheetName string, vesselID int64, defaultTS time.Time) (int, []string) {
-	rows, err := f.GetRows(sheetName)
-	if err != nil || len(rows) < 2 {
-		return 0, []string{fmt.Sprintf("error reading %s sheet", sheetName)}
-	}
-
-	headers := rows[0]
-	mapper := NewHeaderMapper(headers)
-
-	var warnings []string
-	inserted := 0
-
-	tsCol, hasTS := mapper.FindTimestampHeader()
-	genNoCol, _ := mapper.FindHeader("gen_no", "generator", "gen", "generator_no")
-	loadCol, _ := mapper.FindHeader("load", "load_kw", "power")
-	voltageCol, _ := mapper.FindHeader("voltage", "volt", "voltage_v")
-	freqCol, _ := mapper.FindHeader("frequency", "freq", "frequency_hz")
-	fuelRateCol, _ := mapper.FindHeader("fuel_rate", "fuel_rate_lph", "consumption")
-
-	mappedCols := []string{tsCol, genNoCol, loadCol, voltageCol, freqCol, fuelRateCol}
-
-	for i := 1; i < len(rows); i++ {
-		row := make(map[string]string)
-		for j, cell := range rows[i] {
-			if j < len(headers) {
-				row[headers[j]] = cell
+		if hooks.check != nil {
+			if warn := hooks.check(r); warn != "" {
+				run.warnRow(i+1, r, "%s: %s", stream.Name, warn)
 			}
 		}
 
-		// Parse timestamp
-		ts := defaultTS
-		if hasTS && tsCol != "" {
-			if parsedTS, err := ParseTimestamp(row[tsCol]); err == nil {
-				ts = parsedTS
+		extraJSON, _ := BuildExtraJSON(r.cells, mappedCols)
+
+		hashKeys := []string{}
+		var unit interface{}
+		if stream.Unit != "" {
+			unit = r.values[stream.Unit]
+			if key := unitKey(stream, unit); key != "" {
+				hashKeys = append(hashKeys, key)
 			}
 		}
-
-		// Parse fields
-		var genNo *int
-		var loadKW, voltageV, frequencyHz, fuelRateLPH *float64
-
-		var numOnly = regexp.MustCompile(`\d+`)
-
-		if genNoCol != "" {
-			match := numOnly.FindString(row[genNoCol]) // extract only digits
-			if match != "" {
-				if val, err := strconv.Atoi(match); err == nil {
-					genNo = &val // assign pointer to the parsed int
+		hashKeys = append(hashKeys, string(extraJSON))
+		rowHash := util.HashRow(vesselID, r.ts, stream.Name, hashKeys...)
+
+		// Insert (or update in upsert mode)
+		var result store.WriteResult
+		if def.custom != nil {
+			result, err = p.store.WriteCustomReading(ctx, store.CustomWrite{
+				StreamID: def.custom.ID, VesselID: vesselID, TS: r.ts, Unit: customUnit(unit),
+				Values: customValues(def.custom, r), Source: source, RowHash: rowHash, ExtraJSON: extraJSON,
+			}, mode == ModeUpsert)
+		} else {
+			cols := append(stream.FieldNames(), "extra_json")
+			vals := make([]interface{}, 0, len(cols))
+			for _, field := range stream.FieldNames() {
+				if field == "source" {
+					vals = append(vals, source)
+				} else {
+					vals = append(vals, r.values[field])
 				}
 			}
+			vals = append(vals, extraJSON)
+			result, err = p.store.WriteReading(ctx, store.ReadingWrite{
+				Table: stream.Table, UnitCol: stream.Unit, Unit: unit,
+				VesselID: vesselID, TS: r.ts, RowHash: rowHash,
+				Cols: cols, Vals: vals,
+			}, mode == ModeUpsert)
 		}
-		if loadCol != "" {
-			loadKW, _ = ParseFloat(row[loadCol])
-		}
-		if voltageCol != "" {
-			voltageV, _ = ParseFloat(row[voltageCol])
-		}
-		if freqCol != "" {
-			frequencyHz, _ = ParseFloat(row[freqCol])
-		}
-		if fuelRateCol != "" {
-			fuelRateLPH, _ = ParseFloat(row[fuelRateCol])
-		}
-
-		// Validate
-		if warns := ValidateGeneratorData(loadKW, voltageV, frequencyHz, fuelRateLPH); len(warns) > 0 {
-			warnings = append(warnings, fmt.Sprintf("row %d generators: %s", i+1, strings.Join(warns, ", ")))
-			continue
-		}
-
-		// Build extra JSON
-		extraJSON, _ := BuildExtraJSON(row, mappedCols)
-
-		// Create row hash
-		hashKeys := []string{}
-		if genNo != nil {
-			hashKeys = append(hashKeys, fmt.Sprintf("gen_no:%d", *genNo))
-		}
-		hashKeys = append(hashKeys, string(extraJSON))
-		rowHash := util.HashRow(vesselID, ts, "generators", hashKeys...)
-
-		// Insert
-		_, err := p.db.Exec(`
-			INSERT OR IGNORE INTO generator_readings 
-			(vessel_id, gen_no, ts, load_kw, voltage_v, frequency_hz, fuel_rate_lph, row_hash, extra_json)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			vesselID, genNo, ts, loadKW, voltageV, frequencyHz, fuelRateLPH, rowHash, extraJSON,
-		)
 		if err == nil {
-			inserted++
-		}
-	}
-
-	return inserted, warnings
-}
-
-func (p *XLSXProcessor) processCCTVSheet(f *excelize.File, sheetName string, vesselID int64, defaultTS time.Time) (int, []string) {
-	rows, err := f.GetRows(sheetName)
-	if err != nil || len(rows) < 2 {
-		return 0, []string{fmt.Sprintf("error reading %s sheet", sheetName)}
-	}
-
-	headers := rows[0]
-	mapper := NewHeaderMapper(headers)
-
-	var warnings []string
-	inserted := 0
-
-	tsCol, hasTS := mapper.FindTimestampHeader()
-	camIDCol, _ := mapper.FindHeader("cam_id", "camera", "camera_id", "cam")
-	statusCol, _ := mapper.FindHeader("status", "state")
-	uptimeCol, _ := mapper.FindHeader("uptime", "uptime_percent", "availability")
-
-	mappedCols := []string{tsCol, camIDCol, statusCol, uptimeCol}
-
-	for i := 1; i < len(rows); i++ {
-		row := make(map[string]string)
-		for j, cell := range rows[i] {
-			if j < len(headers) {
-				row[headers[j]] = cell
+			switch result {
+			case store.WriteInserted:
+				inserted++
+			case store.WriteUpdated:
+				updated++
 			}
-		}
-
-		// Parse timestamp
-		ts := defaultTS
-		if hasTS && tsCol != "" {
-			if parsedTS, err := ParseTimestamp(row[tsCol]); err == nil {
-				ts = parsedTS
+			if result != store.WriteSkipped && (since == nil || r.ts.Before(*since)) {
+				ts := r.ts
+				since = &ts
 			}
-		}
-
-		// Parse fields
-		var camID, status *string
-		var uptimePercent *float64
-
-		if camIDCol != "" && row[camIDCol] != "" {
-			val := row[camIDCol]
-			camID = &val
-		}
-		if statusCol != "" && row[statusCol] != "" {
-			val := row[statusCol]
-			status = &val
-		}
-		if uptimeCol != "" {
-			uptimePercent, _ = ParseFloat(row[uptimeCol])
-		}
-
-		// Build extra JSON
-		extraJSON, _ := BuildExtraJSON(row, mappedCols)
-
-		// Create row hash
-		hashKeys := []string{}
-		if camID != nil {
-			hashKeys = append(hashKeys, fmt.Sprintf("cam_id:%s", *camID))
-		}
-		hashKeys = append(hashKeys, string(extraJSON))
-		rowHash := util.HashRow(vesselID, ts, "cctv", hashKeys...)
-
-		// Insert
-		_, err := p.db.Exec(`
-			INSERT OR IGNORE INTO cctv_status_readings 
-			(vessel_id, cam_id, ts, status, uptime_percent, row_hash, extra_json)
-			VALUES (?, ?, ?, ?, ?, ?, ?)`,
-			vesselID, camID, ts, status, uptimePercent, rowHash, extraJSON,
-		)
-		if err == nil {
-			inserted++
-		}
-	}
-
-	return inserted, warnings
-}
-
-func (p *XLSXProcessor) processImpactSheet(f *excelize.File, sheetName string, vesselID int64, defaultTS time.Time) (int, []string) {
-	rows, err := f.GetRows(sheetName)
-	if err != nil || len(rows) < 2 {
-		return 0, []string{fmt.Sprintf("error reading %s sheet", sheetName)}
-	}
-
-	headers := rows[0]
-	mapper := NewHeaderMapper(headers)
-
-	var warnings []string
-	inserted := 0
-
-	tsCol, hasTS := mapper.FindTimestampHeader()
-	sensorIDCol, _ := mapper.FindHeader("sensor_id", "sensor", "device_id")
-	accelCol, _ := mapper.FindHeader("accel", "acceleration", "accel_g")
-	shockCol, _ := mapper.FindHeader("shock", "shock_g", "impact")
-	notesCol, _ := mapper.FindHeader("notes", "note", "comment")
-
-	mappedCols := []string{tsCol, sensorIDCol, accelCol, shockCol, notesCol}
-
-	for i := 1; i < len(rows); i++ {
-		row := make(map[string]string)
-		for j, cell := range rows[i] {
-			if j < len(headers) {
-				row[headers[j]] = cell
+			if result != store.WriteSkipped && (until == nil || r.ts.After(*until)) {
+				ts := r.ts
+				until = &ts
 			}
-		}
-
-		// Parse timestamp
-		ts := defaultTS
-		if hasTS && tsCol != "" {
-			if parsedTS, err := ParseTimestamp(row[tsCol]); err == nil {
-				ts = parsedTS
+			if len(found) > 0 && result != store.WriteSkipped {
+				spikes.record(found)
 			}
+		} else {
+			run.warnRow(i+1, r, "%s insert error: %v", stream.Name, err)
 		}
 
-		// Parse fields
-		var sensorID, notes *string
-		var accelG, shockG *float64
-
-		if sensorIDCol != "" && row[sensorIDCol] != "" {
-			val := row[sensorIDCol]
-			sensorID = &val
-		}
-		if accelCol != "" {
-			accelG, _ = ParseFloat(row[accelCol])
-		}
-		if shockCol != "" {
-			shockG, _ = ParseFloat(row[shockCol])
-		}
-		if notesCol != "" && row[notesCol] != "" {
-			val := row[notesCol]
-			notes = &val
+		if hooks.written != nil {
+			if err := hooks.written(r); err != nil {
+				run.warnRow(i+1, r, "%s: %v", stream.Name, err)
+			}
 		}
+	}
 
-		// Build extra JSON
-		extraJSON, _ := BuildExtraJSON(row, mappedCols)
-
-		// Create row hash
-		hashKeys := []string{}
-		if sensorID != nil {
-			hashKeys = append(hashKeys, fmt.Sprintf("sensor_id:%s", *sensorID))
-		}
-		hashKeys = append(hashKeys, string(extraJSON))
-		rowHash := util.HashRow(vesselID, ts, "impact", hashKeys...)
-
-		// Insert
-		_, err := p.db.Exec(`
-			INSERT OR IGNORE INTO impact_vibration_readings 
-			(vessel_id, sensor_id, ts, accel_g, shock_g, notes, row_hash, extra_json)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			vesselID, sensorID, ts, accelG, shockG, notes, rowHash, extraJSON,
-		)
-		if err == nil {
-			inserted++
+	if hooks.done != nil {
+		hooks.done(since)
+	}
+	if since != nil && def.custom == nil {
+		if err := p.store.RefreshRollups(ctx, stream, vesselID, *since, *until); err != nil {
+			run.warn("%s rollups: %v", stream.Name, err)
 		}
 	}
-
-	return inserted, warnings
+	return inserted, updated, run.warnings
 }
 
-func (p *XLSXProcessor) updateStreamLatest(vesselID int64, rowsInserted map[string]int, ts time.Time) {
-	for stream, count := range rowsInserted {
-		if count > 0 {
-			_, _ = p.db.Exec(`
-				INSERT OR REPLACE INTO vessel_stream_latest (vessel_id, stream, latest_ts)
-				VALUES (?, ?, ?)`,
-				vesselID, stream, ts,
-			)
+// updateStreamLatest records an upload on the streams it wrote to, so
+// their version changes even when rows were only updated.
+func (p *XLSXProcessor) updateStreamLatest(ctx context.Context, vesselID int64, ts time.Time, rowsInserted, rowsUpdated map[string]int) {
+	written := make(map[string]bool)
+	for _, counts := range []map[string]int{rowsInserted, rowsUpdated} {
+		for stream, count := range counts {
+			if count > 0 && !written[stream] {
+				written[stream] = true
+				_ = p.store.SetStreamLatest(ctx, vesselID, stream, ts)
+			}
 		}
 	}
 }
-func (p *XLSXProcessor) processLocationFromShipInfo(headers, data []string, vesselID int64, defaultTS time.Time, mapper *HeaderMapper) (int, []string) {
+func (p *XLSXProcessor) processLocationFromShipInfo(ctx context.Context, headers, data []string, vesselID int64, defaultTS time.Time, mapper *HeaderMapper, mode IngestMode, source string) (store.WriteResult, []string) {
 	var warnings []string
 
 	// Create row map
@@ -840,23 +671,23 @@ func (p *XLSXProcessor) processLocationFromShipInfo(headers, data []string, vess
 	var latitude, longitude, course, speed *float64
 	var status *string
 
-	if latCol, found := mapper.FindHeader("latitude", "lat"); found {
+	if latCol, found := mapper.FindHeader(shipInfoHeaders("latitude")...); found {
 		latitude, _ = ParseFloat(row[latCol])
 	}
 
-	if lonCol, found := mapper.FindHeader("longitude", "lon", "lng"); found {
+	if lonCol, found := mapper.FindHeader(shipInfoHeaders("longitude")...); found {
 		longitude, _ = ParseFloat(row[lonCol])
 	}
 
-	if courseCol, found := mapper.FindHeader("course", "heading", "bearing"); found {
+	if courseCol, found := mapper.FindHeader(shipInfoHeaders("course_degrees")...); found {
 		course, _ = ParseFloat(row[courseCol])
 	}
 
-	if speedCol, found := mapper.FindHeader("speed", "speed_knots", "speed(knots)"); found {
+	if speedCol, found := mapper.FindHeader(shipInfoHeaders("speed_knots")...); found {
 		speed, _ = ParseFloat(row[speedCol])
 	}
 
-	if statusCol, found := mapper.FindHeader("status", "vessel_status", "nav_status"); found && row[statusCol] != "" {
+	if statusCol, found := mapper.FindHeader(shipInfoHeaders("status")...); found && row[statusCol] != "" {
 		val := row[statusCol]
 		status = &val
 	}
@@ -864,12 +695,12 @@ func (p *XLSXProcessor) processLocationFromShipInfo(headers, data []string, vess
 	// Validate location data
 	if warns := ValidateLocationData(latitude, longitude, course, speed); len(warns) > 0 {
 		warnings = append(warnings, fmt.Sprintf("location data: %s", strings.Join(warns, ", ")))
-		return 0, warnings
+		return store.WriteSkipped, warnings
 	}
 
 	// Skip if no location data
 	if latitude == nil && longitude == nil && course == nil && speed == nil && status == nil {
-		return 0, warnings
+		return store.WriteSkipped, warnings
 	}
 
 	// Build extra JSON for unmapped columns
@@ -883,7 +714,8 @@ func (p *XLSXProcessor) processLocationFromShipInfo(headers, data []string, vess
 			strings.Contains(headerLower, "status") ||
 			strings.Contains(headerLower, "time") ||
 			strings.Contains(headerLower, "name") ||
-			strings.Contains(headerLower, "imo") {
+			strings.Contains(headerLower, "imo") ||
+			strings.Contains(headerLower, "mmsi") {
 			mappedCols = append(mappedCols, h)
 		}
 	}
@@ -898,16 +730,21 @@ func (p *XLSXProcessor) processLocationFromShipInfo(headers, data []string, vess
 	hashKeys = append(hashKeys, string(extraJSON))
 	rowHash := util.HashRow(vesselID, ts, "location", hashKeys...)
 
-	// Insert location reading
-	_, err := p.db.Exec(`
-		INSERT OR IGNORE INTO location_readings 
-		(vessel_id, ts, latitude, longitude, course_degrees, speed_knots, status, row_hash, extra_json)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		vesselID, ts, latitude, longitude, course, speed, status, rowHash, extraJSON,
-	)
+	// Insert location reading (or update in upsert mode)
+	result, err := p.store.WriteReading(ctx, store.ReadingWrite{
+		Table:    "location_readings",
+		VesselID: vesselID, TS: ts, RowHash: rowHash,
+		Cols: []string{"latitude", "longitude", "course_degrees", "speed_knots", "status", "source", "extra_json"},
+		Vals: []interface{}{latitude, longitude, course, speed, status, source, extraJSON},
+	}, mode == ModeUpsert)
 	if err == nil {
-		return 1, warnings
+		if result != store.WriteSkipped {
+			if err := p.store.RefreshRollups(ctx, store.Streams["location"], vesselID, ts, ts); err != nil {
+				warnings = append(warnings, fmt.Sprintf("location rollups: %v", err))
+			}
+		}
+		return result, warnings
 	}
 
-	return 0, warnings
+	return store.WriteSkipped, warnings
 }
@@ -0,0 +1,435 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// API keys and versions spoken. Both are the last versions before flexible
+// (tagged) encoding and are served by brokers from 1.0 to 4.x.
+const (
+	apiProduce       = 0
+	apiMetadata      = 3
+	produceVersion   = 3
+	metadataVersion  = 5
+	clientID         = "vessel-telemetry-api"
+	maxResponseBytes = 64 << 20
+)
+
+// Error is an error code returned by a broker.
+type Error int16
+
+// Codes the producer acts on; see the Kafka protocol guide for the rest.
+const (
+	errUnknownTopic       Error = 3
+	errLeaderNotAvailable Error = 5
+	errNotLeader          Error = 6
+	errRequestTimedOut    Error = 7
+	errMessageTooLarge    Error = 10
+	errNotEnoughReplicas  Error = 19
+	errNotEnoughAfter     Error = 20
+	errTopicAuthorization Error = 29
+	errClusterAuthz       Error = 31
+	errInvalidRecord      Error = 87
+)
+
+func (e Error) Error() string {
+	switch e {
+	case errUnknownTopic:
+		return "unknown topic or partition"
+	case errLeaderNotAvailable:
+		return "leader not available"
+	case errNotLeader:
+		return "not leader for partition"
+	case errRequestTimedOut:
+		return "request timed out"
+	case errMessageTooLarge:
+		return "message too large"
+	case errNotEnoughReplicas, errNotEnoughAfter:
+		return "not enough in-sync replicas"
+	case errTopicAuthorization:
+		return "topic authorization failed"
+	case errClusterAuthz:
+		return "cluster authorization failed"
+	case errInvalidRecord:
+		return "invalid record"
+	}
+	return "kafka error " + strconv.Itoa(int(e))
+}
+
+// retryable reports whether the request may succeed later, e.g. once a
+// leader is elected or a topic auto-created.
+func (e Error) retryable() bool {
+	switch e {
+	case errUnknownTopic, errLeaderNotAvailable, errNotLeader, errRequestTimedOut, errNotEnoughReplicas, errNotEnoughAfter:
+		return true
+	}
+	return false
+}
+
+// conn is a connection to one broker. Requests are sent one at a time.
+type conn struct {
+	net         net.Conn
+	r           *bufio.Reader
+	correlation int32
+}
+
+func dial(ctx context.Context, addr string) (*conn, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// Reads and writes do not watch ctx themselves
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	return &conn{net: c, r: bufio.NewReader(c)}, nil
+}
+
+func (c *conn) Close() error { return c.net.Close() }
+
+// roundTrip sends a request with body and returns the body of its response.
+func (c *conn) roundTrip(apiKey, version int16, body []byte) (*decoder, error) {
+	c.correlation++
+	var e encoder
+	e.int32(0) // size, set below
+	e.int16(apiKey)
+	e.int16(version)
+	e.int32(c.correlation)
+	e.string(clientID)
+	e.buf = append(e.buf, body...)
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+	if _, err := c.net.Write(e.buf); err != nil {
+		return nil, err
+	}
+
+	var head [8]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return nil, err
+	}
+	size := int32(binary.BigEndian.Uint32(head[:4]))
+	if size < 4 || size > maxResponseBytes {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	if got := int32(binary.BigEndian.Uint32(head[4:])); got != c.correlation {
+		return nil, fmt.Errorf("response to request %d, expected %d", got, c.correlation)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	return &decoder{buf: resp}, nil
+}
+
+// partition is one partition of a topic and the broker leading it.
+type partition struct {
+	id     int32
+	leader int32
+}
+
+// metadata is the part of a metadata response the producer needs.
+type metadata struct {
+	brokers map[int32]string // node id to host:port
+	topics  map[string][]partition
+}
+
+// metadata asks for the brokers and the partitions of topics, creating
+// missing topics if the cluster allows it. Partitions without a leader are
+// left out, and so are topics with an error.
+func (c *conn) metadata(topics []string) (*metadata, map[string]Error, error) {
+	var e encoder
+	e.int32(int32(len(topics)))
+	for _, t := range topics {
+		e.string(t)
+	}
+	e.bool(true) // allow_auto_topic_creation
+	d, err := c.roundTrip(apiMetadata, metadataVersion, e.buf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := &metadata{brokers: map[int32]string{}, topics: map[string][]partition{}}
+	errs := map[string]Error{}
+	d.int32() // throttle_time_ms
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id, host, port := d.int32(), d.string(), d.int32()
+		d.string() // rack
+		m.brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster_id
+	d.int32()  // controller_id
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		code, name := Error(d.int16()), d.string()
+		d.bool() // is_internal
+		var parts []partition
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			pcode, id, leader := d.int16(), d.int32(), d.int32()
+			d.int32s() // replica_nodes
+			d.int32s() // isr_nodes
+			d.int32s() // offline_replicas
+			if pcode == 0 && leader >= 0 {
+				parts = append(parts, partition{id: id, leader: leader})
+			}
+		}
+		if code != 0 {
+			errs[name] = code
+			continue
+		}
+		m.topics[name] = parts
+	}
+	if d.err != nil {
+		return nil, nil, fmt.Errorf("metadata response: %w", d.err)
+	}
+	return m, errs, nil
+}
+
+// produceKey names a partition of a topic.
+type produceKey struct {
+	topic     string
+	partition int32
+}
+
+// produce writes a record batch per partition, waiting for all in-sync
+// replicas, and returns the error of each partition that failed.
+func (c *conn) produce(batches map[produceKey][]byte, timeout time.Duration) (map[produceKey]Error, error) {
+	byTopic := map[string][]int32{}
+	var order []string
+	for k := range batches {
+		if _, ok := byTopic[k.topic]; !ok {
+			order = append(order, k.topic)
+		}
+		byTopic[k.topic] = append(byTopic[k.topic], k.partition)
+	}
+
+	var e encoder
+	e.int16(-1) // transactional_id: null
+	e.int16(-1) // acks: all in-sync replicas
+	e.int32(int32(timeout / time.Millisecond))
+	e.int32(int32(len(order)))
+	for _, topic := range order {
+		e.string(topic)
+		e.int32(int32(len(byTopic[topic])))
+		for _, p := range byTopic[topic] {
+			e.int32(p)
+			e.bytes(batches[produceKey{topic, p}])
+		}
+	}
+	d, err := c.roundTrip(apiProduce, produceVersion, e.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := map[produceKey]Error{}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		topic := d.string()
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			id, code := d.int32(), Error(d.int16())
+			d.int64() // base_offset
+			d.int64() // log_append_time_ms
+			if code != 0 {
+				errs[produceKey{topic, id}] = code
+			}
+		}
+	}
+	d.int32() // throttle_time_ms
+	if d.err != nil {
+		return nil, fmt.Errorf("produce response: %w", d.err)
+	}
+	return errs, nil
+}
+
+// Message is one record to publish.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// recordBatch encodes messages as an uncompressed record batch (magic 2)
+// timestamped at.
+func recordBatch(messages []Message, at time.Time) []byte {
+	var records encoder
+	for i, m := range messages {
+		var r encoder
+		r.int8(0)          // attributes
+		r.varint(0)        // timestamp_delta
+		r.varint(int64(i)) // offset_delta
+		r.varbytes(m.Key)
+		r.varbytes(m.Value)
+		r.varint(0) // headers
+		records.varint(int64(len(r.buf)))
+		records.buf = append(records.buf, r.buf...)
+	}
+
+	ms := at.UnixMilli()
+	var body encoder // from attributes on, the part the CRC covers
+	body.int16(0)    // attributes: no compression, create time
+	body.int32(int32(len(messages) - 1))
+	body.int64(ms) // first_timestamp
+	body.int64(ms) // max_timestamp
+	body.int64(-1) // producer_id
+	body.int16(-1) // producer_epoch
+	body.int32(-1) // base_sequence
+	body.int32(int32(len(messages)))
+	body.buf = append(body.buf, records.buf...)
+
+	var e encoder
+	e.int64(0) // base_offset, assigned by the broker
+	e.int32(int32(4 + 1 + 4 + len(body.buf)))
+	e.int32(-1) // partition_leader_epoch
+	e.int8(2)   // magic
+	e.int32(int32(crc32.Checksum(body.buf, castagnoli)))
+	e.buf = append(e.buf, body.buf...)
+	return e.buf
+}
+
+// murmur2 is the hash the Java client's default partitioner applies to
+// keys, so readings land on the partitions other producers would pick.
+func murmur2(data []byte) int32 {
+	const m, r = 0x5bd1e995, 24
+	length := len(data)
+	h := uint32(0x9747b28c) ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// partitionFor returns the index among n partitions of key.
+func partitionFor(key []byte, n int) int {
+	return int(murmur2(key)&0x7fffffff) % n
+}
+
+// encoder appends big-endian protocol fields.
+type encoder struct{ buf []byte }
+
+func (e *encoder) int8(v int8)   { e.buf = append(e.buf, byte(v)) }
+func (e *encoder) int16(v int16) { e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v)) }
+func (e *encoder) int32(v int32) { e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v)) }
+func (e *encoder) int64(v int64) { e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v)) }
+func (e *encoder) varint(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v) // zigzag, as records use
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.int8(1)
+	} else {
+		e.int8(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// varbytes writes b with a varint length, -1 for nil.
+func (e *encoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+var errShort = errors.New("response too short")
+
+// decoder reads big-endian protocol fields. After the first error every
+// read returns zero and err is kept.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errShort
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) bool() bool {
+	b := d.next(1)
+	return b != nil && b[0] != 0
+}
+
+// string reads a string, "" for null.
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *decoder) int32s() []int32 {
+	var v []int32
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		v = append(v, d.int32())
+	}
+	return v
+}
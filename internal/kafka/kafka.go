@@ -0,0 +1,173 @@
+// Package kafka is the Kafka publisher of the reading sink (see
+// internal/sink).
+//
+// Each stream has its own topic (prefix and stream name) and readings are
+// keyed by vessel id, so one vessel's readings stay on one partition and in
+// order. The producer speaks the few protocol requests needed (metadata and
+// uncompressed produce) itself, without TLS or SASL.
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/sink"
+)
+
+// topicChars are the characters Kafka allows in topic names.
+var topicChars = regexp.MustCompile(`^[a-zA-Z0-9._-]*$`)
+
+// ValidTopicPrefix reports whether topics named prefix and a stream name
+// are valid.
+func ValidTopicPrefix(prefix string) bool {
+	return len(prefix) <= 200 && topicChars.MatchString(prefix)
+}
+
+// Producer writes messages to a Kafka cluster.
+type Producer struct {
+	brokers []string
+	timeout time.Duration // how long brokers wait for replicas
+	out     *outbound.Integration
+}
+
+// NewProducer creates a producer for the cluster reached through brokers
+// (host:port), its calls guarded by policy as the "kafka" integration.
+func NewProducer(brokers []string, policy outbound.Policy) *Producer {
+	timeout := policy.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &Producer{brokers: brokers, timeout: timeout, out: outbound.New("kafka", policy)}
+}
+
+// Publish writes the messages of each topic, partitioned by key, and returns
+// once all in-sync replicas have them. On error any part may have been
+// written.
+func (p *Producer) Publish(ctx context.Context, topics map[string][]Message) error {
+	return p.out.Do(ctx, func(ctx context.Context) error {
+		return p.publish(ctx, topics)
+	})
+}
+
+func (p *Producer) publish(ctx context.Context, topics map[string][]Message) error {
+	names := make([]string, 0, len(topics))
+	for topic := range topics {
+		names = append(names, topic)
+	}
+
+	var bootstrap *conn
+	var meta *metadata
+	var topicErrs map[string]Error
+	var err error
+	for _, addr := range p.brokers {
+		if bootstrap, err = dial(ctx, addr); err != nil {
+			continue
+		}
+		if meta, topicErrs, err = bootstrap.metadata(names); err == nil {
+			break
+		}
+		bootstrap.Close()
+		bootstrap = nil
+	}
+	if bootstrap == nil {
+		return fmt.Errorf("no broker reachable: %w", err)
+	}
+	conns := map[string]*conn{}
+	defer func() {
+		bootstrap.Close()
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+
+	// Group the messages by the broker leading their partition
+	byLeader := map[int32]map[produceKey][]Message{}
+	for topic, messages := range topics {
+		if code, ok := topicErrs[topic]; ok {
+			return wrap(topic, code)
+		}
+		parts := meta.topics[topic]
+		if len(parts) == 0 {
+			return fmt.Errorf("%s: %w", topic, errLeaderNotAvailable)
+		}
+		for _, m := range messages {
+			part := parts[partitionFor(m.Key, len(parts))]
+			if byLeader[part.leader] == nil {
+				byLeader[part.leader] = map[produceKey][]Message{}
+			}
+			key := produceKey{topic, part.id}
+			byLeader[part.leader][key] = append(byLeader[part.leader][key], m)
+		}
+	}
+
+	now := time.Now()
+	for leader, partitions := range byLeader {
+		addr, ok := meta.brokers[leader]
+		if !ok {
+			return fmt.Errorf("broker %d: %w", leader, errLeaderNotAvailable)
+		}
+		c := conns[addr]
+		if c == nil {
+			if c, err = dial(ctx, addr); err != nil {
+				return err
+			}
+			conns[addr] = c
+		}
+
+		batches := make(map[produceKey][]byte, len(partitions))
+		for key, messages := range partitions {
+			batches[key] = recordBatch(messages, now)
+		}
+		errs, err := c.produce(batches, p.timeout)
+		if err != nil {
+			return err
+		}
+		for key, code := range errs {
+			return wrap(fmt.Sprintf("%s[%d]", key.topic, key.partition), code)
+		}
+	}
+	return nil
+}
+
+// wrap adds what failed to a broker error, marking it permanent unless a
+// retry can succeed.
+func wrap(what string, code Error) error {
+	err := fmt.Errorf("%s: %w", what, code)
+	if code.retryable() {
+		return err
+	}
+	return outbound.Permanent(err)
+}
+
+// Publisher is the sink publisher of a Kafka cluster: each stream has its
+// own topic, prefix and stream name, and readings are keyed by vessel id.
+type Publisher struct {
+	producer *Producer
+	prefix   string
+}
+
+// NewPublisher creates a publisher writing through producer to topics named
+// prefix and the stream.
+func NewPublisher(producer *Producer, prefix string) *Publisher {
+	return &Publisher{producer: producer, prefix: prefix}
+}
+
+// Target names the outbox cursor of the publisher; it follows the
+// topics, not the brokers.
+func (p *Publisher) Target() string {
+	return "kafka:" + p.prefix
+}
+
+// Publish writes events to the topics of their streams.
+func (p *Publisher) Publish(ctx context.Context, events []sink.Event) error {
+	topics := map[string][]Message{}
+	for _, e := range events {
+		topic := p.prefix + e.Stream
+		topics[topic] = append(topics[topic], Message{Key: []byte(strconv.FormatInt(e.VesselID, 10)), Value: e.Value})
+	}
+	return p.producer.Publish(ctx, topics)
+}
@@ -0,0 +1,294 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/sink"
+)
+
+func TestMurmur2(t *testing.T) {
+	// Values of the Java client's Utils.murmur2
+	for in, want := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		if got := murmur2([]byte(in)); got != want {
+			t.Errorf("murmur2(%q) = %d, expected %d", in, got, want)
+		}
+	}
+}
+
+// record is a message received by fakeBroker.
+type record struct {
+	topic     string
+	partition int32
+	key       string
+	value     []byte
+}
+
+// fakeBroker is a one-node cluster whose topics have two partitions. It
+// answers produce requests with code.
+type fakeBroker struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu      sync.Mutex
+	code    int16
+	records []record
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{t: t, ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) setCode(code Error) {
+	b.mu.Lock()
+	b.code = int16(code)
+	b.mu.Unlock()
+}
+
+func (b *fakeBroker) received() []record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]record(nil), b.records...)
+}
+
+func (b *fakeBroker) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		req := make([]byte, size)
+		if _, err := io.ReadFull(r, req); err != nil {
+			return
+		}
+		d := &decoder{buf: req}
+		apiKey, _, correlation := d.int16(), d.int16(), d.int32()
+		d.string() // client_id
+
+		var e encoder
+		e.int32(0)
+		e.int32(correlation)
+		switch apiKey {
+		case apiMetadata:
+			b.metadata(d, &e)
+		case apiProduce:
+			b.produce(d, &e)
+		default:
+			b.t.Errorf("Unexpected API key %d", apiKey)
+			return
+		}
+		binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+		if _, err := c.Write(e.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) metadata(d *decoder, e *encoder) {
+	var topics []string
+	for n := d.int32(); n > 0; n-- {
+		topics = append(topics, d.string())
+	}
+	host, port, _ := net.SplitHostPort(b.ln.Addr().String())
+	portNo, _ := strconv.Atoi(port)
+
+	e.int32(0) // throttle_time_ms
+	e.int32(1)
+	e.int32(1)
+	e.string(host)
+	e.int32(int32(portNo))
+	e.int16(-1) // rack
+	e.int16(-1) // cluster_id
+	e.int32(1)  // controller_id
+	e.int32(int32(len(topics)))
+	for _, topic := range topics {
+		e.int16(0)
+		e.string(topic)
+		e.bool(false)
+		e.int32(2)
+		for p := int32(0); p < 2; p++ {
+			e.int16(0)
+			e.int32(p)
+			e.int32(1) // leader
+			e.int32(1)
+			e.int32(1) // replicas
+			e.int32(1)
+			e.int32(1) // isr
+			e.int32(0) // offline
+		}
+	}
+}
+
+func (b *fakeBroker) produce(d *decoder, e *encoder) {
+	d.string() // transactional_id
+	if acks := d.int16(); acks != -1 {
+		b.t.Errorf("Expected acks=-1, got %d", acks)
+	}
+	d.int32() // timeout
+	b.mu.Lock()
+	code := b.code
+	b.mu.Unlock()
+
+	type result struct {
+		topic string
+		parts []int32
+	}
+	var results []result
+	for n := d.int32(); n > 0; n-- {
+		res := result{topic: d.string()}
+		for p := d.int32(); p > 0; p-- {
+			part := d.int32()
+			batch := d.next(int(d.int32()))
+			res.parts = append(res.parts, part)
+			if code == 0 {
+				b.decodeBatch(res.topic, part, batch)
+			}
+		}
+		results = append(results, res)
+	}
+
+	e.int32(int32(len(results)))
+	for _, res := range results {
+		e.string(res.topic)
+		e.int32(int32(len(res.parts)))
+		for _, part := range res.parts {
+			e.int32(part)
+			e.int16(code)
+			e.int64(0)
+			e.int64(-1)
+		}
+	}
+	e.int32(0) // throttle_time_ms
+}
+
+func (b *fakeBroker) decodeBatch(topic string, part int32, batch []byte) {
+	d := &decoder{buf: batch}
+	d.int64() // base_offset
+	if length := d.int32(); int(length) != len(d.buf) {
+		b.t.Errorf("Batch length %d, %d bytes follow", length, len(d.buf))
+	}
+	d.int32() // partition_leader_epoch
+	if magic := d.next(1); magic[0] != 2 {
+		b.t.Errorf("Expected magic 2, got %d", magic[0])
+	}
+	if crc := uint32(d.int32()); crc != crc32.Checksum(d.buf, crc32.MakeTable(crc32.Castagnoli)) {
+		b.t.Error("Batch CRC mismatch")
+	}
+	d.int16()
+	d.int32()
+	d.int64()
+	d.int64()
+	d.int64()
+	d.int16()
+	d.int32()
+	count := d.int32()
+
+	varint := func() int64 {
+		v, n := binary.Varint(d.buf)
+		d.buf = d.buf[n:]
+		return v
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := int32(0); i < count; i++ {
+		varint()  // length
+		d.next(1) // attributes
+		varint()  // timestamp_delta
+		if offset := varint(); offset != int64(i) {
+			b.t.Errorf("Record %d has offset delta %d", i, offset)
+		}
+		key := d.next(int(varint()))
+		value := d.next(int(varint()))
+		varint() // headers
+		b.records = append(b.records, record{topic, part, string(key), value})
+	}
+	if d.err != nil || len(d.buf) != 0 {
+		b.t.Errorf("Malformed batch: %v, %d bytes left", d.err, len(d.buf))
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	ctx := context.Background()
+	broker := newFakeBroker(t)
+	producer := NewProducer([]string{broker.ln.Addr().String()}, outbound.Policy{Timeout: 5 * time.Second})
+	publisher := NewPublisher(producer, "telemetry.")
+	if publisher.Target() != "kafka:telemetry." {
+		t.Errorf("Unexpected target %q", publisher.Target())
+	}
+
+	var events []sink.Event
+	for i, vesselID := range []int64{1, 2, 1, 3, 2} {
+		events = append(events, sink.Event{Stream: "engines", ReadingID: int64(i + 1), VesselID: vesselID, Value: []byte(fmt.Sprintf(`{"id":%d}`, i+1))})
+	}
+	events = append(events, sink.Event{Stream: "fuel", ReadingID: 1, VesselID: 1, Value: []byte(`{"id":1}`)})
+	if err := publisher.Publish(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	records := broker.received()
+	if len(records) != len(events) {
+		t.Fatalf("Expected %d records, got %d", len(events), len(records))
+	}
+	// Each vessel keeps one partition, where its readings are in order
+	lastID := map[string]float64{}
+	for _, r := range records {
+		var reading map[string]float64
+		if err := json.Unmarshal(r.value, &reading); err != nil {
+			t.Fatal(err)
+		}
+		if r.topic == "telemetry.fuel" {
+			continue
+		}
+		if r.topic != "telemetry.engines" || reading["id"] <= lastID[r.key] {
+			t.Errorf("Unexpected record %s %s %s", r.topic, r.key, r.value)
+		}
+		lastID[r.key] = reading["id"]
+		if want := int32(partitionFor([]byte(r.key), 2)); r.partition != want {
+			t.Errorf("Vessel %s on partition %d, expected %d", r.key, r.partition, want)
+		}
+	}
+	if len(lastID) != 3 {
+		t.Errorf("Expected records of 3 vessels, got %v", lastID)
+	}
+
+	broker.setCode(errTopicAuthorization)
+	if err := publisher.Publish(ctx, events[:1]); !errors.Is(err, errTopicAuthorization) {
+		t.Errorf("Expected a topic authorization error, got %v", err)
+	}
+}
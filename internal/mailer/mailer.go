@@ -0,0 +1,235 @@
+// Package mailer sends email through an SMTP relay, for replies to emailed
+// telemetry and for reports.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// Message is an email to send.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string // plain text
+	// Headers are added as they are, e.g. In-Reply-To.
+	Headers     map[string]string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer sends messages through one SMTP server.
+type Mailer struct {
+	addr     string // host:port
+	user     string
+	password string
+	from     string
+	out      *outbound.Integration
+}
+
+// New creates a mailer sending as from through the server at addr. The
+// connection is upgraded with STARTTLS when the server offers it; user and
+// password, if set, authenticate with PLAIN, which net/smtp only allows over
+// TLS or to localhost. Deliveries are guarded by policy.
+func New(addr, user, password, from string, policy outbound.Policy) (*Mailer, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q, use host:port", addr)
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+	return &Mailer{addr: addr, user: user, password: password, from: from, out: outbound.New("smtp", policy)}, nil
+}
+
+// From returns the address messages are sent as.
+func (m *Mailer) From() string {
+	return m.from
+}
+
+// Send delivers a message to its recipients.
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("no recipient")
+	}
+	var to []string
+	for _, addr := range msg.To {
+		parsed, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", addr, err)
+		}
+		to = append(to, parsed.Address)
+	}
+	from, _ := mail.ParseAddress(m.from)
+	data, err := m.compose(msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return m.out.Do(ctx, func(ctx context.Context) error {
+		return m.deliver(ctx, from.Address, to, data)
+	})
+}
+
+func (m *Mailer) deliver(ctx context.Context, from string, to []string, data []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// net/smtp does not watch ctx itself
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(m.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.user != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.user, m.password, host)); err != nil {
+			return outbound.Permanent(err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return permanentIf5xx(err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return permanentIf5xx(err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return permanentIf5xx(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return permanentIf5xx(err)
+	}
+	return c.Quit()
+}
+
+// permanentIf5xx marks rejections (5xx replies) as not worth retrying.
+func permanentIf5xx(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return outbound.Permanent(err)
+	}
+	return err
+}
+
+// compose renders a message in RFC 5322 form.
+func (m *Mailer) compose(msg Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", m.from)
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID(m.from))
+	header("MIME-Version", "1.0")
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.ContainsAny(name+msg.Headers[name], "\r\n") {
+			return nil, fmt.Errorf("invalid header %s", name)
+		}
+		header(name, msg.Headers[name])
+	}
+
+	if len(msg.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "base64")
+		buf.WriteString("\r\n")
+		writeBase64(&buf, []byte(msg.Body))
+		return buf.Bytes(), nil
+	}
+
+	w := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+w.Boundary())
+	buf.WriteString("\r\n")
+	part, _ := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	var body bytes.Buffer
+	writeBase64(&body, []byte(msg.Body))
+	part.Write(body.Bytes())
+	for _, a := range msg.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		var data bytes.Buffer
+		writeBase64(&data, a.Data)
+		part.Write(data.Bytes())
+	}
+	w.Close()
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes data base64-encoded in lines of 76 characters.
+func writeBase64(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+}
+
+// messageID returns a unique Message-ID in the domain of the sender.
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = d
+		}
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
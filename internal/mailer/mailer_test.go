@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// fakeSMTP accepts one message and sends its envelope and data on a channel.
+func fakeSMTP(t *testing.T, rejectRcpt bool) (string, <-chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	got := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch {
+			case cmd == "EHLO" || cmd == "HELO":
+				reply("250 localhost")
+			case cmd == "MAIL":
+				lines = append(lines, line)
+				reply("250 OK")
+			case cmd == "RCPT" && rejectRcpt:
+				reply("550 no such user")
+			case cmd == "RCPT":
+				lines = append(lines, line)
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+					lines = append(lines, strings.TrimRight(data, "\r\n"))
+				}
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				got <- lines
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), got
+}
+
+func TestSend(t *testing.T) {
+	addr, got := fakeSMTP(t, false)
+	m, err := New(addr, "", "", "Telemetry <telemetry@fleet.example>", outbound.Policy{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Send(context.Background(), Message{
+		To:          []string{"Master <master@alpha.example>"},
+		Subject:     "Re: Noon report – day 1",
+		Body:        "Could not be ingested.",
+		Headers:     map[string]string{"In-Reply-To": "<1@ship>"},
+		Attachments: []Attachment{{Filename: "report.pdf", ContentType: "application/pdf", Data: []byte("%PDF")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := <-got
+	if lines[0] != "MAIL FROM:<telemetry@fleet.example>" || lines[1] != "RCPT TO:<master@alpha.example>" {
+		t.Errorf("Unexpected envelope %q", lines[:2])
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(strings.Join(lines[2:], "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Re: Noon report – day 1" || msg.Header.Get("In-Reply-To") != "<1@ship>" ||
+		!strings.HasPrefix(msg.Header.Get("Content-Type"), "multipart/mixed") || !strings.HasSuffix(msg.Header.Get("Message-ID"), "@fleet.example>") {
+		t.Errorf("Unexpected headers %v (subject %q)", msg.Header, subject)
+	}
+}
+
+func TestSendRejected(t *testing.T) {
+	addr, _ := fakeSMTP(t, true)
+	m, _ := New(addr, "", "", "telemetry@fleet.example", outbound.Policy{Timeout: 5 * time.Second, Retries: 3})
+	err := m.Send(context.Background(), Message{To: []string{"nobody@alpha.example"}, Subject: "x"})
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Errorf("Expected the rejection, got %v", err)
+	}
+
+	if _, err := New("smtp.example", "", "", "telemetry@fleet.example", outbound.Policy{}); err == nil {
+		t.Error("Expected an address without port to be refused")
+	}
+	if err := m.Send(context.Background(), Message{To: []string{"a@b\r\nBcc: c@d"}}); err == nil {
+		t.Error("Expected an invalid recipient to be refused")
+	}
+}
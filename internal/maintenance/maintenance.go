@@ -0,0 +1,82 @@
+// Package maintenance evaluates recurring maintenance tasks against the
+// running hours tracked for their engine or generator and the calendar.
+package maintenance
+
+import (
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// Statuses of an item, from best to worst.
+const (
+	OK      = "ok"
+	Due     = "due"     // within the margins of its interval
+	Overdue = "overdue" // past its interval
+)
+
+// DayLayout is the format of last_done_on and due_on.
+const DayLayout = "2006-01-02"
+
+// Margins are how close to its interval an item is due.
+type Margins struct {
+	Hours float64
+	Days  int
+}
+
+// DefaultMargins flag items 100 running hours or two weeks ahead.
+var DefaultMargins = Margins{Hours: 100, Days: 14}
+
+// Evaluate fills in the item's remaining hours and days and its status as
+// of today, from its HoursSinceDone. An item with both intervals takes the
+// worse status.
+func Evaluate(item *models.MaintenanceItem, today time.Time, m Margins) {
+	item.Status = OK
+	item.HoursRemaining, item.DueOn, item.DaysRemaining = nil, nil, nil
+
+	if item.IntervalHours != nil {
+		remaining := *item.IntervalHours - item.HoursSinceDone
+		item.HoursRemaining = &remaining
+		item.Status = worse(item.Status, status(remaining < 0, remaining <= m.Hours))
+	}
+	if item.IntervalDays != nil {
+		done, err := time.Parse(DayLayout, item.LastDoneOn)
+		if err != nil {
+			return
+		}
+		due := done.AddDate(0, 0, *item.IntervalDays)
+		dueOn := due.Format(DayLayout)
+		day := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+		days := int(due.Sub(day).Hours() / 24)
+		item.DueOn, item.DaysRemaining = &dueOn, &days
+		item.Status = worse(item.Status, status(days < 0, days <= m.Days))
+	}
+}
+
+func status(overdue, due bool) string {
+	switch {
+	case overdue:
+		return Overdue
+	case due:
+		return Due
+	}
+	return OK
+}
+
+// Rank orders statuses from best (0) to worst.
+func Rank(status string) int {
+	switch status {
+	case Due:
+		return 1
+	case Overdue:
+		return 2
+	}
+	return 0
+}
+
+func worse(a, b string) string {
+	if Rank(b) > Rank(a) {
+		return b
+	}
+	return a
+}
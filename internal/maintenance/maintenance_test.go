@@ -0,0 +1,41 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+func TestEvaluate(t *testing.T) {
+	today := time.Date(2025, 8, 20, 15, 0, 0, 0, time.UTC)
+	hours := func(v float64) *float64 { return &v }
+	days := func(v int) *int { return &v }
+
+	tests := []struct {
+		name string
+		item models.MaintenanceItem
+		want string
+	}{
+		{"hours ok", models.MaintenanceItem{IntervalHours: hours(500), HoursSinceDone: 300, LastDoneOn: "2025-08-01"}, OK},
+		{"hours due", models.MaintenanceItem{IntervalHours: hours(500), HoursSinceDone: 450, LastDoneOn: "2025-08-01"}, Due},
+		{"hours overdue", models.MaintenanceItem{IntervalHours: hours(500), HoursSinceDone: 520, LastDoneOn: "2025-08-01"}, Overdue},
+		{"days ok", models.MaintenanceItem{IntervalDays: days(90), LastDoneOn: "2025-08-01"}, OK},
+		{"days due today", models.MaintenanceItem{IntervalDays: days(19), LastDoneOn: "2025-08-01"}, Due},
+		{"days overdue", models.MaintenanceItem{IntervalDays: days(18), LastDoneOn: "2025-08-01"}, Overdue},
+		{"worse of both", models.MaintenanceItem{IntervalHours: hours(500), IntervalDays: days(18), LastDoneOn: "2025-08-01"}, Overdue},
+	}
+	for _, tt := range tests {
+		item := tt.item
+		Evaluate(&item, today, DefaultMargins)
+		if item.Status != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, item.Status)
+		}
+	}
+
+	item := models.MaintenanceItem{IntervalHours: hours(500), IntervalDays: days(30), HoursSinceDone: 120, LastDoneOn: "2025-08-01"}
+	Evaluate(&item, today, DefaultMargins)
+	if *item.HoursRemaining != 380 || *item.DueOn != "2025-08-31" || *item.DaysRemaining != 11 || item.Status != Due {
+		t.Errorf("Unexpected evaluation %+v", item)
+	}
+}
@@ -0,0 +1,180 @@
+// Package modbus polls the Modbus TCP registers mapped to a vessel's stream
+// fields, e.g. those of the switchboard PLC or of an engine monitoring
+// gateway, and ingests the values read as engine, generator and fuel
+// readings.
+//
+// Registers are read with function 3 (holding) or 4 (input); 32-bit values
+// take two registers, high word first unless swapped.
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// Register tables.
+const (
+	TableHolding = "holding"
+	TableInput   = "input"
+)
+
+// DataTypes are the types register values are read as.
+var DataTypes = []string{"uint16", "int16", "uint32", "int32", "float32"}
+
+// MaxRegisters is the most registers one request reads.
+const MaxRegisters = 125
+
+// Words returns the number of registers a value of dataType takes, 0 for
+// an unknown type.
+func Words(dataType string) int {
+	switch dataType {
+	case "uint16", "int16":
+		return 1
+	case "uint32", "int32", "float32":
+		return 2
+	}
+	return 0
+}
+
+// Value returns the value of registers read as dataType.
+func Value(words []uint16, dataType string, wordSwap bool) (float64, error) {
+	if n := Words(dataType); n == 0 {
+		return 0, fmt.Errorf("unknown data type %q", dataType)
+	} else if len(words) < n {
+		return 0, fmt.Errorf("%s takes %d registers, got %d", dataType, n, len(words))
+	}
+	if Words(dataType) == 1 {
+		if dataType == "int16" {
+			return float64(int16(words[0])), nil
+		}
+		return float64(words[0]), nil
+	}
+	hi, lo := words[0], words[1]
+	if wordSwap {
+		hi, lo = lo, hi
+	}
+	v := uint32(hi)<<16 | uint32(lo)
+	switch dataType {
+	case "int32":
+		return float64(int32(v)), nil
+	case "float32":
+		f := math.Float32frombits(v)
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return 0, errors.New("not a number")
+		}
+		return float64(f), nil
+	}
+	return float64(v), nil
+}
+
+// ExceptionError is an exception a device answered a request with.
+type ExceptionError struct {
+	Code byte
+}
+
+var exceptions = map[byte]string{
+	1: "illegal function", 2: "illegal data address", 3: "illegal data value",
+	4: "server device failure", 6: "server device busy",
+	10: "gateway path unavailable", 11: "gateway target device failed to respond",
+}
+
+func (e *ExceptionError) Error() string {
+	if name, ok := exceptions[e.Code]; ok {
+		return fmt.Sprintf("modbus exception %d (%s)", e.Code, name)
+	}
+	return fmt.Sprintf("modbus exception %d", e.Code)
+}
+
+// Client is a connection to a Modbus TCP server. It is not safe for
+// concurrent use.
+type Client struct {
+	conn    net.Conn
+	timeout time.Duration
+	tid     uint16
+}
+
+// Dial connects to the server at address (host:port), each request then
+// bounded by timeout.
+func Dial(ctx context.Context, address string, timeout time.Duration) (*Client, error) {
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, timeout: timeout}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// ReadRegisters reads count registers of a table from address on, of the
+// unit slave.
+func (c *Client) ReadRegisters(slave byte, table string, address, count uint16) ([]uint16, error) {
+	function := byte(3)
+	switch table {
+	case TableHolding:
+	case TableInput:
+		function = 4
+	default:
+		return nil, fmt.Errorf("unknown register table %q", table)
+	}
+	if count == 0 || count > MaxRegisters {
+		return nil, fmt.Errorf("cannot read %d registers at once", count)
+	}
+
+	c.tid++
+	req := make([]byte, 12)
+	binary.BigEndian.PutUint16(req[0:], c.tid)
+	// Protocol 0, then the length of what follows
+	binary.BigEndian.PutUint16(req[4:], 6)
+	req[6], req[7] = slave, function
+	binary.BigEndian.PutUint16(req[8:], address)
+	binary.BigEndian.PutUint16(req[10:], count)
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	if _, err := c.conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	for {
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 || length > 256 {
+			return nil, fmt.Errorf("invalid response length %d", length)
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(c.conn, pdu); err != nil {
+			return nil, err
+		}
+		// Answers to requests that timed out before
+		if binary.BigEndian.Uint16(header[0:]) != c.tid {
+			continue
+		}
+		if pdu[0] == function|0x80 {
+			if len(pdu) < 2 {
+				return nil, errors.New("truncated exception response")
+			}
+			return nil, &ExceptionError{Code: pdu[1]}
+		}
+		if pdu[0] != function || len(pdu) < 2 || int(pdu[1]) != 2*int(count) || len(pdu) != 2+2*int(count) {
+			return nil, errors.New("unexpected response")
+		}
+		words := make([]uint16, count)
+		for i := range words {
+			words[i] = binary.BigEndian.Uint16(pdu[2+2*i:])
+		}
+		return words, nil
+	}
+}
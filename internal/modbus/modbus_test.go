@@ -0,0 +1,239 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// testServer is a Modbus TCP server of one unit whose holding and input
+// registers are those set; reading others answers exception 2.
+type testServer struct {
+	ln    net.Listener
+	slave byte
+
+	mu       sync.Mutex
+	holding  map[uint16]uint16
+	input    map[uint16]uint16
+	requests int
+}
+
+func newTestServer(t *testing.T, slave byte) *testServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{ln: ln, slave: slave, holding: map[uint16]uint16{}, input: map[uint16]uint16{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) addr() string { return s.ln.Addr().String() }
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		req := make([]byte, 12)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		function, address, count := req[7], binary.BigEndian.Uint16(req[8:]), binary.BigEndian.Uint16(req[10:])
+		s.mu.Lock()
+		s.requests++
+		table := s.holding
+		if function == 4 {
+			table = s.input
+		}
+		pdu := []byte{function, byte(2 * count)}
+		for a := address; a < address+count; a++ {
+			v, ok := table[a]
+			if !ok || req[6] != s.slave {
+				pdu = []byte{function | 0x80, 2}
+				break
+			}
+			pdu = binary.BigEndian.AppendUint16(pdu, v)
+		}
+		s.mu.Unlock()
+		resp := append([]byte{req[0], req[1], 0, 0, 0, 0, req[6]}, pdu...)
+		binary.BigEndian.PutUint16(resp[4:], uint16(len(pdu)+1))
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	f := math.Float32bits(-12.5)
+	tests := []struct {
+		words    []uint16
+		dataType string
+		swap     bool
+		want     float64
+	}{
+		{[]uint16{65535}, "uint16", false, 65535},
+		{[]uint16{65535}, "int16", false, -1},
+		{[]uint16{1, 2}, "uint32", false, 65538},
+		{[]uint16{2, 1}, "uint32", true, 65538},
+		{[]uint16{0xffff, 0xfffe}, "int32", false, -2},
+		{[]uint16{uint16(f >> 16), uint16(f)}, "float32", false, -12.5},
+		{[]uint16{uint16(f), uint16(f >> 16)}, "float32", true, -12.5},
+	}
+	for _, tt := range tests {
+		if got, err := Value(tt.words, tt.dataType, tt.swap); err != nil || got != tt.want {
+			t.Errorf("Value(%v, %s, %v) = %v, %v; want %v", tt.words, tt.dataType, tt.swap, got, err, tt.want)
+		}
+	}
+	if _, err := Value([]uint16{1}, "uint32", false); err == nil {
+		t.Error("Expected an error for a missing register")
+	}
+	if _, err := Value([]uint16{0x7fc0, 0}, "float32", false); err == nil {
+		t.Error("Expected an error for NaN")
+	}
+}
+
+func TestReadRegisters(t *testing.T) {
+	s := newTestServer(t, 1)
+	s.holding[100], s.holding[101] = 1500, 42
+	s.input[7] = 230
+
+	c, err := Dial(context.Background(), s.addr(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	words, err := c.ReadRegisters(1, TableHolding, 100, 2)
+	if err != nil || len(words) != 2 || words[0] != 1500 || words[1] != 42 {
+		t.Errorf("Unexpected holding registers %v, %v", words, err)
+	}
+	if words, err = c.ReadRegisters(1, TableInput, 7, 1); err != nil || words[0] != 230 {
+		t.Errorf("Unexpected input register %v, %v", words, err)
+	}
+	var exception *ExceptionError
+	if _, err = c.ReadRegisters(1, TableHolding, 200, 1); !errors.As(err, &exception) || exception.Code != 2 {
+		t.Errorf("Expected exception 2, got %v", err)
+	}
+	if _, err = c.ReadRegisters(1, "coil", 0, 1); err == nil {
+		t.Error("Expected an error for an unknown table")
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	registers := []models.ModbusRegister{
+		{ID: 1, Table: TableHolding, Address: 10, DataType: "uint16"},
+		{ID: 2, Table: TableHolding, Address: 11, DataType: "float32"},
+		{ID: 3, Table: TableHolding, Address: 20, DataType: "uint16"},
+		{ID: 4, Table: TableInput, Address: 11, DataType: "int16"},
+		{ID: 5, Table: TableHolding, Address: 12, DataType: "uint16"},
+	}
+	got := blocks(registers)
+	want := []struct {
+		table      string
+		start, end int
+		registers  int
+	}{
+		{TableHolding, 10, 13, 3},
+		{TableHolding, 20, 21, 1},
+		{TableInput, 11, 12, 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d blocks, got %+v", len(want), got)
+	}
+	for i, w := range want {
+		if b := got[i]; b.table != w.table || b.start != w.start || b.end != w.end || len(b.registers) != w.registers {
+			t.Errorf("Block %d: expected %+v, got %+v", i, w, b)
+		}
+	}
+}
+
+type fakeStore struct {
+	registers []models.ModbusRegister
+	polls     map[int64]*string // error by register
+}
+
+func (s *fakeStore) ModbusRegisters(ctx context.Context, vesselID int64) ([]models.ModbusRegister, error) {
+	return s.registers, nil
+}
+
+func (s *fakeStore) RecordModbusPoll(ctx context.Context, id int64, value *float64, at time.Time, pollErr *string) error {
+	s.polls[id] = pollErr
+	return nil
+}
+
+type fakeProcessor struct {
+	readings map[int64][]ingest.FeedReading
+}
+
+func (p *fakeProcessor) ProcessVesselFeed(ctx context.Context, data []byte, readings []ingest.FeedReading, filename string, vesselID int64, mode ingest.IngestMode, source string) (*models.IngestResponse, error) {
+	p.readings[vesselID] = readings
+	return &models.IngestResponse{Status: "success"}, nil
+}
+
+func TestPollOnce(t *testing.T) {
+	s := newTestServer(t, 3)
+	s.holding[0], s.holding[1] = 7200, 655
+	s.input[5] = 0xfff6
+
+	unit := func(n string) *string { return &n }
+	st := &fakeStore{polls: map[int64]*string{}, registers: []models.ModbusRegister{
+		{ID: 1, VesselID: 1, Device: s.addr(), SlaveID: 3, Table: TableHolding, Address: 0, DataType: "uint16", Scale: 0.25, Stream: "engines", Field: "rpm", Unit: unit("1")},
+		{ID: 2, VesselID: 1, Device: s.addr(), SlaveID: 3, Table: TableHolding, Address: 1, DataType: "uint16", Scale: 0.1, Stream: "engines", Field: "temp_c", Unit: unit("1")},
+		{ID: 3, VesselID: 1, Device: s.addr(), SlaveID: 3, Table: TableInput, Address: 5, DataType: "int16", Scale: 1, Offset: 100, Stream: "generators", Field: "load_kw", Unit: unit("2")},
+		// Not mapped by the device
+		{ID: 4, VesselID: 1, Device: s.addr(), SlaveID: 3, Table: TableHolding, Address: 50, DataType: "uint16", Scale: 1, Stream: "fuel", Field: "volume_liters", Unit: unit("1")},
+		// Unreachable
+		{ID: 5, VesselID: 2, Device: "127.0.0.1:1", SlaveID: 1, Table: TableHolding, Address: 0, DataType: "uint16", Scale: 1, Stream: "engines", Field: "rpm", Unit: unit("1")},
+	}}
+	processor := &fakeProcessor{readings: map[int64][]ingest.FeedReading{}}
+	if err := NewPoller(st, processor, outbound.Policy{Timeout: time.Second}).PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	readings := processor.readings[1]
+	if len(readings) != 3 || len(processor.readings) != 1 {
+		t.Fatalf("Expected 3 readings of vessel 1, got %+v", processor.readings)
+	}
+	want := []struct{ stream, unit, field, value string }{
+		{"engines", "1", "rpm", "1800"},
+		{"engines", "1", "temp_c", "65.5"},
+		{"generators", "2", "load_kw", "90"},
+	}
+	for i, w := range want {
+		r := readings[i]
+		if r.Stream != w.stream || r.Unit != w.unit || r.Values[w.field] != w.value || !r.TS.Equal(readings[0].TS) {
+			t.Errorf("Reading %d: expected %s %s %s=%s, got %+v", i, w.stream, w.unit, w.field, w.value, r)
+		}
+	}
+	// Registers 0-1 are read at once
+	if s.requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", s.requests)
+	}
+	if st.polls[1] != nil || st.polls[3] != nil {
+		t.Errorf("Expected registers 1 and 3 read, got %v %v", st.polls[1], st.polls[3])
+	}
+	if st.polls[4] == nil || *st.polls[4] != "modbus exception 2 (illegal data address)" {
+		t.Errorf("Expected register 4 to fail with exception 2, got %v", st.polls[4])
+	}
+	if st.polls[5] == nil {
+		t.Error("Expected register 5 to fail")
+	}
+}
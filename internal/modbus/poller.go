@@ -0,0 +1,201 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// Store holds the registers polled.
+type Store interface {
+	ModbusRegisters(ctx context.Context, vesselID int64) ([]models.ModbusRegister, error)
+	RecordModbusPoll(ctx context.Context, id int64, value *float64, at time.Time, pollErr *string) error
+}
+
+// Processor ingests the readings of a poll.
+type Processor interface {
+	ProcessVesselFeed(ctx context.Context, data []byte, readings []ingest.FeedReading, filename string, vesselID int64, mode ingest.IngestMode, source string) (*models.IngestResponse, error)
+}
+
+// Poller reads every vessel's registers and ingests their values.
+type Poller struct {
+	store     Store
+	processor Processor
+	timeout   time.Duration
+	out       *outbound.Integration
+}
+
+// NewPoller creates a poller whose connections to devices are guarded by
+// policy, its timeout bounding each request too.
+func NewPoller(st Store, processor Processor, policy outbound.Policy) *Poller {
+	return &Poller{store: st, processor: processor, timeout: policy.Timeout, out: outbound.New("modbus", policy)}
+}
+
+// device is a unit of a Modbus TCP server polled for a vessel.
+type device struct {
+	vesselID int64
+	address  string
+	slave    int
+}
+
+// PollOnce reads the registers of every vessel, each device over one
+// connection, and ingests the values of each vessel as one upload dated at
+// the poll. Registers that cannot be read are skipped, their error noted.
+func (p *Poller) PollOnce(ctx context.Context) error {
+	registers, err := p.store.ModbusRegisters(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("modbus: reading registers: %w", err)
+	}
+	devices := make(map[device][]models.ModbusRegister)
+	var order []device
+	for _, r := range registers {
+		d := device{vesselID: r.VesselID, address: r.Device, slave: r.SlaveID}
+		if devices[d] == nil {
+			order = append(order, d)
+		}
+		devices[d] = append(devices[d], r)
+	}
+
+	at := time.Now().UTC().Truncate(time.Second)
+	readings := make(map[int64][]ingest.FeedReading)
+	var vessels []int64
+	for _, d := range order {
+		values := p.pollDevice(ctx, d, devices[d], at)
+		if len(readings[d.vesselID]) == 0 {
+			vessels = append(vessels, d.vesselID)
+		}
+		for _, r := range devices[d] {
+			v, ok := values[r.ID]
+			if !ok {
+				continue
+			}
+			unit := ""
+			if r.Unit != nil {
+				unit = *r.Unit
+			}
+			readings[d.vesselID] = append(readings[d.vesselID], ingest.FeedReading{
+				Stream: r.Stream, Unit: unit, TS: at,
+				Values: map[string]string{r.Field: strconv.FormatFloat(v, 'f', -1, 64)},
+			})
+		}
+	}
+
+	var errs []error
+	for _, vesselID := range vessels {
+		if len(readings[vesselID]) == 0 {
+			continue
+		}
+		filename := fmt.Sprintf("modbus-%d-%s.txt", vesselID, at.Format("20060102T150405Z"))
+		response, err := p.processor.ProcessVesselFeed(ctx, ingest.FeedData(readings[vesselID]), readings[vesselID], filename, vesselID, ingest.ModeInsert, models.SourceSensor)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("modbus: vessel %d: %w", vesselID, err))
+			continue
+		}
+		for _, w := range response.Warnings {
+			log.Printf("modbus: %s: %s", filename, w)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pollDevice reads the registers of a device, returning their values by
+// register ID, and notes the outcome of each. A connection that fails is
+// tried again as a whole; registers the device refuses are not.
+func (p *Poller) pollDevice(ctx context.Context, d device, registers []models.ModbusRegister, at time.Time) map[int64]float64 {
+	values := make(map[int64]float64)
+	failures := make(map[int64]error)
+	err := p.out.Do(ctx, func(ctx context.Context) error {
+		// A failed attempt is read again from the start
+		values, failures = make(map[int64]float64), make(map[int64]error)
+		client, err := Dial(ctx, d.address, p.timeout)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		for _, b := range blocks(registers) {
+			words, err := client.ReadRegisters(byte(d.slave), b.table, uint16(b.start), uint16(b.end-b.start))
+			var exception *ExceptionError
+			if err != nil && !errors.As(err, &exception) {
+				return err
+			}
+			for _, r := range b.registers {
+				if err != nil {
+					failures[r.ID] = err
+					continue
+				}
+				offset := r.Address - b.start
+				v, err := Value(words[offset:offset+Words(r.DataType)], r.DataType, r.WordSwap)
+				if err != nil {
+					failures[r.ID] = err
+					continue
+				}
+				values[r.ID] = v*r.Scale + r.Offset
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("modbus: %s: %v", d.address, err)
+		values = make(map[int64]float64)
+		for _, r := range registers {
+			failures[r.ID] = err
+		}
+	}
+
+	for _, r := range registers {
+		var value *float64
+		var pollErr *string
+		if v, ok := values[r.ID]; ok {
+			value = &v
+		} else if err := failures[r.ID]; err != nil {
+			msg := err.Error()
+			pollErr = &msg
+		}
+		if err := p.store.RecordModbusPoll(ctx, r.ID, value, at, pollErr); err != nil {
+			log.Printf("modbus: recording poll of register %d: %v", r.ID, err)
+		}
+	}
+	return values
+}
+
+// block is a run of registers of one table read by one request.
+type block struct {
+	table      string
+	start, end int // end excluded
+	registers  []models.ModbusRegister
+}
+
+// blocks groups registers of a device into requests, joining those of a
+// table whose addresses touch or overlap. Gaps are not read through, as
+// devices may refuse addresses they do not map.
+func blocks(registers []models.ModbusRegister) []block {
+	sorted := append([]models.ModbusRegister(nil), registers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Table != sorted[j].Table {
+			return sorted[i].Table < sorted[j].Table
+		}
+		return sorted[i].Address < sorted[j].Address
+	})
+	var out []block
+	for _, r := range sorted {
+		end := r.Address + Words(r.DataType)
+		if n := len(out); n > 0 {
+			b := &out[n-1]
+			if b.table == r.Table && r.Address <= b.end && max(b.end, end)-b.start <= MaxRegisters {
+				b.end = max(b.end, end)
+				b.registers = append(b.registers, r)
+				continue
+			}
+		}
+		out = append(out, block{table: r.Table, start: r.Address, end: end, registers: []models.ModbusRegister{r}})
+	}
+	return out
+}
@@ -6,14 +6,36 @@ import (
 	"time"
 )
 
+// Reading sources, stored in each reading's source column so analytics can
+// leave out values nobody measured.
+const (
+	SourceSensor  = "sensor"  // logged by onboard equipment
+	SourceManual  = "manual"  // keyed in by hand, e.g. noon reports
+	SourceDerived = "derived" // computed from other readings
+	SourceSynced  = "synced"  // pulled from an external system such as AIS
+)
+
+// ReadingSources lists the valid sources.
+var ReadingSources = []string{SourceSensor, SourceManual, SourceDerived, SourceSynced}
+
+// SourceAIS selects the positions pulled from the AIS provider in source
+// filters. They are stored as SourceSynced with origin OriginAIS.
+const SourceAIS = "ais"
+
+// OriginAIS is the origin of synced positions pulled from the AIS provider.
+const OriginAIS = "ais"
+
 type Vessel struct {
-	ID        int64     `json:"id"`
-	IMO       *string   `json:"imo"`
-	Name      string    `json:"name"`
-	Flag      *string   `json:"flag"`
-	Type      *string   `json:"type"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64      `json:"id"`
+	IMO        *string    `json:"imo"`
+	MMSI       *string    `json:"mmsi"`
+	Name       string     `json:"name"`
+	Flag       *string    `json:"flag"`
+	Type       *string    `json:"type"`
+	Fleet      *string    `json:"fleet"`
+	ArchivedAt *time.Time `json:"archived_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
 }
 
 type Upload struct {
@@ -25,6 +47,18 @@ type Upload struct {
 	Note           *string   `json:"note"`
 }
 
+// UploadWarning is a warning of an upload's ingest. Sheet and RowNumber are
+// nil for warnings not about one sheet or row; Row holds the cells of the
+// row by header, as read.
+type UploadWarning struct {
+	ID        int64             `json:"id"`
+	UploadID  int64             `json:"upload_id"`
+	Sheet     *string           `json:"sheet"`
+	RowNumber *int              `json:"row_number"`
+	Message   string            `json:"message"`
+	Row       map[string]string `json:"row,omitempty"`
+}
+
 type EngineReading struct {
 	ID             int64           `json:"id"`
 	VesselID       int64           `json:"vessel_id"`
@@ -91,6 +125,78 @@ type ImpactVibrationReading struct {
 	CreatedAt time.Time       `json:"created_at"`
 }
 
+type BilgeBallastReading struct {
+	ID           int64           `json:"id"`
+	VesselID     int64           `json:"vessel_id"`
+	TankID       *string         `json:"tank_id"`
+	Timestamp    time.Time       `json:"ts"`
+	LevelPercent *float64        `json:"level_percent"`
+	VolumeM3     *float64        `json:"volume_m3"`
+	PumpStatus   *string         `json:"pump_status"`
+	Alarm        *string         `json:"alarm"`
+	RowHash      string          `json:"row_hash"`
+	ExtraJSON    json.RawMessage `json:"extra_json"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+type NavigationReading struct {
+	ID                 int64           `json:"id"`
+	VesselID           int64           `json:"vessel_id"`
+	Timestamp          time.Time       `json:"ts"`
+	HeadingDegrees     *float64        `json:"heading_degrees"`
+	RudderAngleDegrees *float64        `json:"rudder_angle_degrees"`
+	ROTDegreesPerMin   *float64        `json:"rot_degrees_per_min"`
+	DepthUnderKeelM    *float64        `json:"depth_under_keel_m"`
+	RowHash            string          `json:"row_hash"`
+	ExtraJSON          json.RawMessage `json:"extra_json"`
+	CreatedAt          time.Time       `json:"created_at"`
+}
+
+type MetReading struct {
+	ID               int64           `json:"id"`
+	VesselID         int64           `json:"vessel_id"`
+	Timestamp        time.Time       `json:"ts"`
+	WindSpeedKnots   *float64        `json:"wind_speed_knots"`
+	WindDirectionDeg *float64        `json:"wind_direction_deg"`
+	AirTempC         *float64        `json:"air_temp_c"`
+	PressureHPa      *float64        `json:"pressure_hpa"`
+	SeaState         *int            `json:"sea_state"`
+	Source           string          `json:"source"`
+	RowHash          string          `json:"row_hash"`
+	ExtraJSON        json.RawMessage `json:"extra_json"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+type PowerReading struct {
+	ID          int64           `json:"id"`
+	VesselID    int64           `json:"vessel_id"`
+	BankID      *string         `json:"bank_id"`
+	Timestamp   time.Time       `json:"ts"`
+	ShoreStatus *string         `json:"shore_status"`
+	ShoreKW     *float64        `json:"shore_kw"`
+	SOCPercent  *float64        `json:"soc_percent"`
+	BatteryKW   *float64        `json:"battery_kw"`
+	Source      string          `json:"source"`
+	RowHash     string          `json:"row_hash"`
+	ExtraJSON   json.RawMessage `json:"extra_json"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type NetworkDeviceReading struct {
+	ID                  int64           `json:"id"`
+	VesselID            int64           `json:"vessel_id"`
+	DeviceID            *string         `json:"device_id"`
+	Timestamp           time.Time       `json:"ts"`
+	DeviceType          *string         `json:"device_type"`
+	Status              *string         `json:"status"`
+	UptimeHours         *float64        `json:"uptime_hours"`
+	AvailabilityPercent *float64        `json:"availability_percent"`
+	Source              string          `json:"source"`
+	RowHash             string          `json:"row_hash"`
+	ExtraJSON           json.RawMessage `json:"extra_json"`
+	CreatedAt           time.Time       `json:"created_at"`
+}
+
 type LocationReading struct {
 	ID            int64           `json:"id"`
 	VesselID      int64           `json:"vessel_id"`
@@ -100,6 +206,7 @@ type LocationReading struct {
 	CourseDegrees *float64        `json:"course_degrees"`
 	SpeedKnots    *float64        `json:"speed_knots"`
 	Status        *string         `json:"status"`
+	Source        *string         `json:"source"`
 	RowHash       string          `json:"row_hash"`
 	ExtraJSON     json.RawMessage `json:"extra_json"`
 	CreatedAt     time.Time       `json:"created_at"`
@@ -110,9 +217,659 @@ type IngestResponse struct {
 	UploadID     *int64         `json:"upload_id,omitempty"`
 	VesselID     *int64         `json:"vessel_id,omitempty"`
 	RowsInserted map[string]int `json:"rows_inserted,omitempty"`
+	RowsUpdated  map[string]int `json:"rows_updated,omitempty"`
 	Warnings     []string       `json:"warnings,omitempty"`
 }
 
+// ArchiveFileResult is the outcome of one file of an archive. Status is
+// that of an IngestResponse, or duplicate (same content as an earlier file of
+// the archive), skipped (not a spreadsheet or CSV file) or failed (see Error).
+type ArchiveFileResult struct {
+	Filename string `json:"filename"`
+	IngestResponse
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ArchiveResponse combines the results of the files of an archive. Status is
+// ingested if any file was, else already_ingested if every file had been,
+// else failed.
+type ArchiveResponse struct {
+	Status       string              `json:"status"`
+	VesselID     *int64              `json:"vessel_id,omitempty"`
+	RowsInserted map[string]int      `json:"rows_inserted"`
+	RowsUpdated  map[string]int      `json:"rows_updated,omitempty"`
+	Files        []ArchiveFileResult `json:"files"`
+}
+
+// InspectResponse is how the sheets of an uploaded file would be read.
+// Warnings are about sheet overrides naming no stream or no sheet.
+type InspectResponse struct {
+	Filename string            `json:"filename"`
+	Sheets   []SheetInspection `json:"sheets"`
+	Warnings []string          `json:"warnings,omitempty"`
+}
+
+// SheetInspection is how a sheet would be read without ingesting it: the
+// stream it holds (nil if none, so it is skipped) and its headers.
+type SheetInspection struct {
+	Sheet   string             `json:"sheet"`
+	Stream  *string            `json:"stream"`
+	Rows    int                `json:"rows"`
+	Headers []HeaderInspection `json:"headers"`
+}
+
+// HeaderInspection is one header of a sheet and the field it fills, ts for
+// the timestamp or "unmapped" if its cells would go to extra_json, with the
+// confidence of the match (0 to 1). Samples are its first non-empty cells.
+type HeaderInspection struct {
+	Header        string   `json:"header"`
+	Field         string   `json:"field"`
+	Confidence    float64  `json:"confidence"`
+	LowConfidence bool     `json:"low_confidence,omitempty"`
+	Samples       []string `json:"samples"`
+}
+
+// QuotaPolicy limits how many rows a vessel may ingest per UTC day. A
+// DailyRowLimit of 0 disables the quota. Without Throttle the quota only
+// produces warnings and alerts; with it further ingests are refused.
+type QuotaPolicy struct {
+	DailyRowLimit int  `json:"daily_row_limit"`
+	Throttle      bool `json:"throttle"`
+}
+
+type QuotaStatus struct {
+	VesselID      int64        `json:"vessel_id"`
+	DailyRowLimit int          `json:"daily_row_limit"`
+	Throttle      bool         `json:"throttle"`
+	Override      bool         `json:"override"`
+	Day           string       `json:"day"`
+	RowsToday     int          `json:"rows_today"`
+	Exceeded      bool         `json:"exceeded"`
+	Alerts        []QuotaAlert `json:"alerts"`
+}
+
+type QuotaAlert struct {
+	Day       string    `json:"day"`
+	Rows      int       `json:"rows"`
+	AlertedAt time.Time `json:"alerted_at"`
+}
+
+// BucketObject is an object of the watched S3 bucket as the bucket ingester
+// last left it. Status is that of an IngestResponse, or failed (see Error);
+// failed objects are tried again from RetryAt, if set.
+type BucketObject struct {
+	Bucket    string     `json:"bucket"`
+	Key       string     `json:"key"`
+	ETag      string     `json:"etag"`
+	Status    string     `json:"status"`
+	UploadID  *int64     `json:"upload_id,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Attempts  int        `json:"attempts"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ChunkedUpload is a file being uploaded in chunks. Received bytes have
+// arrived so far; the upload is dropped if no chunk arrives before
+// ExpiresAt.
+type ChunkedUpload struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256,omitempty"`
+	Received  int64     `json:"received"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CameraStatus is the latest CCTV reading of one camera.
+type CameraStatus struct {
+	VesselID      int64
+	VesselName    string
+	IMO           *string
+	CamID         *string
+	TS            time.Time
+	Status        *string
+	UptimePercent *float64
+}
+
+// CCTVSnapshot is a camera image: a URL reference or an image uploaded to
+// the object store. Status and UptimePercent come from the camera's status
+// reading at TS, if there is one.
+type CCTVSnapshot struct {
+	ID            int64     `json:"id"`
+	CamID         string    `json:"cam_id"`
+	TS            time.Time `json:"ts"`
+	URL           *string   `json:"url"`
+	ObjectKey     *string   `json:"-"`
+	ContentType   *string   `json:"content_type"`
+	SizeBytes     *int64    `json:"size_bytes"`
+	ReadingID     *int64    `json:"reading_id"`
+	Status        *string   `json:"status"`
+	UptimePercent *float64  `json:"uptime_percent"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Tank is a registered fuel tank of a vessel.
+type Tank struct {
+	TankNo         int       `json:"tank_no"`
+	Name           *string   `json:"name"`
+	CapacityLiters float64   `json:"capacity_liters"`
+	FuelType       *string   `json:"fuel_type"` // emission-factors code
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Engine is a registered engine of a vessel.
+type Engine struct {
+	EngineNo       int       `json:"engine_no"`
+	Name           *string   `json:"name"`
+	Maker          *string   `json:"maker"`
+	Model          *string   `json:"model"`
+	RatedRPM       *float64  `json:"rated_rpm"`
+	RatedPowerKW   *float64  `json:"rated_power_kw"`
+	CommissionedOn *string   `json:"commissioned_on"` // YYYY-MM-DD
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Sensor is a unit of a vessel (engine, tank, generator, camera or impact
+// sensor), registered when its first reading is ingested.
+type Sensor struct {
+	ID          int64      `json:"id"`
+	Stream      string     `json:"stream"`
+	Kind        string     `json:"kind"`
+	Unit        string     `json:"unit"` // the readings' unit column, e.g. 2 or CAM-01
+	Location    *string    `json:"location"`
+	InstalledOn *string    `json:"installed_on"` // YYYY-MM-DD
+	FirstSeen   time.Time  `json:"first_seen"`
+	LastSeen    time.Time  `json:"last_seen"`
+	UpdatedAt   *time.Time `json:"updated_at"` // last metadata edit, nil if never edited
+	// Filters replace spikes in the sensor's readings on ingest
+	Filters []SensorFilter `json:"filters"`
+}
+
+// SensorFilter is a spike filter on one field of a sensor's readings, see
+// package outliers. Zero Window, Threshold, Low and High take the method's
+// defaults.
+type SensorFilter struct {
+	Field     string  `json:"field"`
+	Method    string  `json:"method"` // median, hampel or clamp
+	Window    int     `json:"window"`
+	Threshold float64 `json:"threshold,omitempty"`
+	Low       float64 `json:"low,omitempty"`
+	High      float64 `json:"high,omitempty"`
+}
+
+// Outlier is a reading value replaced by a sensor filter on ingest; the
+// reading holds Stored, Raw is what the sheet said.
+type Outlier struct {
+	ID        int64     `json:"id"`
+	VesselID  int64     `json:"vessel_id"`
+	Stream    string    `json:"stream"`
+	SensorID  int64     `json:"sensor_id"`
+	Unit      string    `json:"unit"`
+	TS        time.Time `json:"ts"`
+	Field     string    `json:"field"`
+	Raw       float64   `json:"raw_value"`
+	Stored    float64   `json:"stored_value"`
+	Method    string    `json:"method"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CustomStream is a stream defined at runtime for a sheet type without a
+// built-in stream.
+type CustomStream struct {
+	ID          int64          `json:"-"`
+	Name        string         `json:"name"`
+	Description *string        `json:"description"`
+	Sheets      []string       `json:"sheets"`      // lower-case substrings of sheet names; defaults to the name
+	UnitColumn  *string        `json:"unit_column"` // int or text column identifying the unit, if any
+	Columns     []CustomColumn `json:"columns"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// Types of custom stream columns.
+const (
+	CustomInt   = "int"
+	CustomFloat = "float"
+	CustomText  = "text"
+)
+
+// CustomColumn is a column of a custom stream. Rows with a value outside
+// Min..Max are refused on ingest.
+type CustomColumn struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`    // int, float or text
+	Headers []string `json:"headers"` // header aliases; defaults to the name
+	Min     *float64 `json:"min"`
+	Max     *float64 `json:"max"`
+}
+
+// HeaderAlias maps a header of vendor spreadsheets, e.g. "Suhu Mesin", to
+// the field it holds, for the sheets of one vessel or of all (VesselID nil)
+// and of one stream or of any with the field (Stream nil). Field ts is the
+// row's timestamp.
+type HeaderAlias struct {
+	ID        int64     `json:"id"`
+	VesselID  *int64    `json:"vessel_id"`
+	Stream    *string   `json:"stream"`
+	Header    string    `json:"header"`
+	Field     string    `json:"field"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ValidationRule is a plausibility check on the readings of a stream read
+// from sheets, in the syntax of package rules, e.g.
+// "oil_pressure_bar > 1 when rpm > 600". A row failing it is skipped with a
+// warning (Action reject) or written with one (Action warn).
+type ValidationRule struct {
+	ID          int64     `json:"id"`
+	Stream      string    `json:"stream"`
+	Expression  string    `json:"expression"`
+	Action      string    `json:"action"`
+	Description *string   `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Actions of validation rules.
+const (
+	RuleReject = "reject"
+	RuleWarn   = "warn"
+)
+
+// CustomReading is one row of a custom stream.
+type CustomReading struct {
+	ID        int64                  `json:"id"`
+	VesselID  int64                  `json:"vessel_id"`
+	TS        time.Time              `json:"ts"`
+	Unit      *string                `json:"unit"`
+	Values    map[string]interface{} `json:"values"`
+	Source    *string                `json:"source"`
+	RowHash   string                 `json:"row_hash"`
+	ExtraJSON json.RawMessage        `json:"extra_json"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// AlarmEvent is an engine alarm from the reading that raised it until the
+// reading that cleared it.
+type AlarmEvent struct {
+	ID          int64      `json:"id"`
+	EngineNo    *int       `json:"engine_no"`
+	Code        string     `json:"code"`
+	Severity    string     `json:"severity"`
+	Message     string     `json:"message"`
+	Start       time.Time  `json:"start"`
+	End         *time.Time `json:"end"` // nil while active
+	LastSeen    time.Time  `json:"last_seen"`
+	Occurrences int        `json:"occurrences"`
+}
+
+// EngineRunningHours are an engine's running hours on one UTC day.
+type EngineRunningHours struct {
+	EngineNo     *int     `json:"engine_no"`
+	Day          string   `json:"day"`
+	Hours        float64  `json:"hours"`
+	Source       string   `json:"source"` // counter|rpm
+	CounterHours *float64 `json:"counter_hours"`
+}
+
+// MaintenanceItem is a recurring maintenance task of an engine or generator,
+// with its status as of the request.
+type MaintenanceItem struct {
+	ID            int64     `json:"id"`
+	VesselID      int64     `json:"vessel_id"`
+	Equipment     string    `json:"equipment"` // engine|generator
+	UnitNo        int       `json:"unit_no"`
+	Task          string    `json:"task"`
+	IntervalHours *float64  `json:"interval_hours"`
+	IntervalDays  *int      `json:"interval_days"`
+	LastDoneOn    string    `json:"last_done_on"`
+	Notes         *string   `json:"notes"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// Running hours tracked on the days after LastDoneOn
+	HoursSinceDone float64  `json:"hours_since_done"`
+	HoursRemaining *float64 `json:"hours_remaining"`
+	DueOn          *string  `json:"due_on"`
+	DaysRemaining  *int     `json:"days_remaining"`
+	Status         string   `json:"status"` // ok|due|overdue
+}
+
+// Equipment of maintenance items.
+const (
+	EquipmentEngine    = "engine"
+	EquipmentGenerator = "generator"
+)
+
+// EquipmentLogEntry is completed maintenance or a defect of a vessel or one
+// of its units.
+type EquipmentLogEntry struct {
+	ID                int64     `json:"id"`
+	VesselID          int64     `json:"vessel_id"`
+	Kind              string    `json:"kind"`      // maintenance|defect
+	Equipment         *string   `json:"equipment"` // sensor kind, nil for the vessel
+	Unit              *string   `json:"unit"`
+	SensorID          *int64    `json:"sensor_id"`
+	MaintenanceItemID *int64    `json:"maintenance_item_id"`
+	Title             string    `json:"title"`
+	Description       *string   `json:"description"`
+	Severity          *string   `json:"severity"` // defects only
+	OccurredOn        string    `json:"occurred_on"`
+	Status            *string   `json:"status"` // defects only
+	ClosedOn          *string   `json:"closed_on"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Kinds, severities and statuses of equipment log entries.
+const (
+	LogMaintenance = "maintenance"
+	LogDefect      = "defect"
+
+	DefectOpen   = "open"
+	DefectClosed = "closed"
+)
+
+// DefectSeverities are the severities of defects, least severe first.
+var DefectSeverities = []string{"minor", "major", "critical"}
+
+// FuelDropAlert is a run of abnormally fast fuel volume drops of one tank
+// while the engines were off or the vessel was not moving.
+type FuelDropAlert struct {
+	ID          int64     `json:"id"`
+	TankNo      *int      `json:"tank_no"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	StartLiters float64   `json:"start_liters"`
+	EndLiters   float64   `json:"end_liters"`
+	DropLiters  float64   `json:"drop_liters"`
+	RateLPH     float64   `json:"rate_lph"`
+	Reason      string    `json:"reason"`
+	RaisedAt    time.Time `json:"raised_at"`
+}
+
+type WeatherReading struct {
+	Hour             string   `json:"hour"`
+	Latitude         *float64 `json:"latitude"`
+	Longitude        *float64 `json:"longitude"`
+	WindSpeedKnots   *float64 `json:"wind_speed_knots"`
+	WindDirectionDeg *float64 `json:"wind_direction_deg"`
+	WaveHeightM      *float64 `json:"wave_height_m"`
+	WavePeriodS      *float64 `json:"wave_period_s"`
+	Beaufort         *int     `json:"beaufort"`
+}
+
+// FuelWeatherHour is the vessel's generator fuel rate in an hour with known weather.
+type FuelWeatherHour struct {
+	WeatherReading
+	FuelRateLPH float64 `json:"fuel_rate_lph"`
+}
+
+// DailySummary is one vessel's UTC day in the morning fleet report.
+type DailySummary struct {
+	VesselID           int64    `json:"vessel_id"`
+	Day                string   `json:"day"` // YYYY-MM-DD
+	DistanceNM         float64  `json:"distance_nm"`
+	AvgSpeedKnots      *float64 `json:"avg_speed_knots"` // null without reported speeds
+	FuelConsumedLiters float64  `json:"fuel_consumed_liters"`
+	EngineRunningHours float64  `json:"engine_running_hours"` // summed over engines
+	AlarmCount         int      `json:"alarm_count"`
+	// CompletenessPercent is the share of the day's hours with readings,
+	// over the streams the vessel reports.
+	CompletenessPercent float64   `json:"completeness_percent"`
+	ComputedAt          time.Time `json:"computed_at"`
+}
+
+// DataChannelMapping maps an ISO 19848 data channel of a vessel to a stream
+// field.
+type DataChannelMapping struct {
+	ChannelID string     `json:"channel_id"` // local ID
+	Stream    string     `json:"stream"`
+	Field     string     `json:"field"`
+	Unit      *string    `json:"unit"`
+	Source    string     `json:"source"` // vessel or catalog
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// ChannelReading is a value of an ISO 19848 data channel mapped to no
+// stream field.
+type ChannelReading struct {
+	ID        int64     `json:"id"`
+	ChannelID string    `json:"channel_id"`
+	TS        time.Time `json:"ts"`
+	Value     *float64  `json:"value"`
+	TextValue *string   `json:"text_value"`
+	Quality   *string   `json:"quality"`
+	Event     bool      `json:"event"`
+	UploadID  *int64    `json:"upload_id"`
+}
+
+// ChannelSummary is what a vessel has of one data channel.
+type ChannelSummary struct {
+	ChannelID string    `json:"channel_id"`
+	Readings  int       `json:"readings"`
+	FirstTS   time.Time `json:"first_ts"`
+	LastTS    time.Time `json:"last_ts"`
+}
+
+// ModbusRegister is a Modbus TCP register polled for a vessel's readings of
+// a stream field: value = raw * Scale + Offset.
+type ModbusRegister struct {
+	ID       int64   `json:"id"`
+	VesselID int64   `json:"vessel_id"`
+	Device   string  `json:"device"`   // host:port
+	SlaveID  int     `json:"slave_id"` // unit identifier
+	Table    string  `json:"table"`    // holding or input
+	Address  int     `json:"address"`  // 0-based
+	DataType string  `json:"data_type"`
+	WordSwap bool    `json:"word_swap"` // 32-bit values low word first
+	Scale    float64 `json:"scale"`
+	Offset   float64 `json:"offset"`
+	Stream   string  `json:"stream"`
+	Field    string  `json:"field"`
+	Unit     *string `json:"unit"`
+	// LastValue and LastPolledAt are those of the latest poll, with the
+	// error it failed with, if it did
+	LastValue    *float64   `json:"last_value"`
+	LastPolledAt *time.Time `json:"last_polled_at"`
+	LastError    *string    `json:"last_error"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// SNMPDevice is a camera, NVR or network device polled over SNMP for a
+// vessel's readings: cameras and NVRs as CCTV readings of cam_id Name, the
+// others as network device readings of device_id Name.
+type SNMPDevice struct {
+	ID        int64   `json:"id"`
+	VesselID  int64   `json:"vessel_id"`
+	Name      string  `json:"name"`
+	Kind      string  `json:"kind"`
+	Address   string  `json:"address"` // host or host:port
+	Version   string  `json:"version"` // 1 or 2c
+	Community string  `json:"-"`
+	StatusOID *string `json:"status_oid"`
+	// LastStatus, LastUptimeHours and LastPolledAt are those of the latest
+	// poll, with the error it failed with, if it did
+	LastStatus      *string    `json:"last_status"`
+	LastUptimeHours *float64   `json:"last_uptime_hours"`
+	LastPolledAt    *time.Time `json:"last_polled_at"`
+	LastError       *string    `json:"last_error"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// ONVIFCamera is a camera polled over ONVIF for a vessel's CCTV readings
+// of cam_id CamID.
+type ONVIFCamera struct {
+	ID       int64   `json:"id"`
+	VesselID int64   `json:"vessel_id"`
+	CamID    string  `json:"cam_id"`
+	Endpoint string  `json:"endpoint"` // URL of the device service
+	Username *string `json:"username"`
+	Password string  `json:"-"`
+	// Manufacturer, Model and FirmwareVersion are as the camera reported
+	// at the latest poll
+	Manufacturer    *string `json:"manufacturer"`
+	Model           *string `json:"model"`
+	FirmwareVersion *string `json:"firmware_version"`
+	// LastStatus and LastPolledAt are those of the latest poll, with the
+	// error it failed with, if it did; LastSeenAt is the latest poll the
+	// camera answered
+	LastStatus   *string    `json:"last_status"`
+	LastPolledAt *time.Time `json:"last_polled_at"`
+	LastSeenAt   *time.Time `json:"last_seen_at"`
+	LastError    *string    `json:"last_error"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// ONVIFPoll is the outcome of a poll of an ONVIF camera.
+type ONVIFPoll struct {
+	At       time.Time
+	Status   string
+	Answered bool
+	// Info is nil if the camera did not report it
+	Info  *ONVIFDeviceInfo
+	Error *string
+}
+
+// ONVIFDeviceInfo is what a camera reports of itself.
+type ONVIFDeviceInfo struct {
+	Manufacturer, Model, FirmwareVersion string
+}
+
+// CameraAlert is raised when a camera stops responding to polls, and
+// resolved by the first poll it answers after.
+type CameraAlert struct {
+	ID         int64      `json:"id"`
+	VesselID   int64      `json:"vessel_id"`
+	CamID      string     `json:"cam_id"`
+	RaisedAt   time.Time  `json:"raised_at"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	Message    string     `json:"message"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+}
+
+// NoonReport is a vessel's noon report as ingested from a noon report sheet,
+// with the values computed from its telemetry over the same period and the
+// differences between the two that exceeded the tolerances.
+type NoonReport struct {
+	ID            int64     `json:"id"`
+	VesselID      int64     `json:"vessel_id"`
+	ReportedAt    time.Time `json:"reported_at"`
+	UploadID      *int64    `json:"upload_id"`
+	ROBFuelLiters *float64  `json:"rob_fuel_liters"`
+	DistanceNM    *float64  `json:"distance_nm"`
+	AvgSpeedKnots *float64  `json:"avg_speed_knots"`
+	Weather       *string   `json:"weather"`
+	Remarks       *string   `json:"remarks"`
+	// PeriodStart is the previous report's time, or a day before ReportedAt
+	// for the first report
+	PeriodStart           time.Time         `json:"period_start"`
+	ComputedROBLiters     *float64          `json:"computed_rob_liters"`      // null without recent tank readings
+	ComputedDistanceNM    *float64          `json:"computed_distance_nm"`     // null without positions spanning the period
+	ComputedAvgSpeedKnots *float64          `json:"computed_avg_speed_knots"` // computed distance over the period
+	Discrepancies         []NoonDiscrepancy `json:"discrepancies"`
+	Flagged               bool              `json:"flagged"`
+	ReconciledAt          time.Time         `json:"reconciled_at"`
+}
+
+// NoonDiscrepancy is a noon report value too far from its computed value.
+type NoonDiscrepancy struct {
+	Field    string  `json:"field"` // rob_fuel_liters, distance_nm or avg_speed_knots
+	Reported float64 `json:"reported"`
+	Computed float64 `json:"computed"`
+	// Percent is the difference relative to the computed value
+	Percent float64 `json:"difference_percent"`
+}
+
+// Report schedule frequencies.
+const (
+	ReportDaily   = "daily"
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+)
+
+// ReportSchedule emails the report of a vessel, or of every vessel of a
+// fleet, after each day, week (Monday to Sunday) or month, UTC.
+type ReportSchedule struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Frequency  string    `json:"frequency"`
+	VesselID   *int64    `json:"vessel_id"`
+	Fleet      *string   `json:"fleet"`
+	Recipients []string  `json:"recipients"`
+	Template   *string   `json:"template"` // report template name, nil for the default layout
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Report template section types.
+const (
+	SectionSummary     = "summary"
+	SectionTrack       = "track"
+	SectionFuel        = "fuel"
+	SectionEngines     = "engines"
+	SectionAlarms      = "alarms"
+	SectionDataQuality = "data_quality"
+	SectionChart       = "chart"
+)
+
+// ReportTemplate is a layout of the vessel report, such as one per
+// charterer: the sections it has, in order, and its branding.
+type ReportTemplate struct {
+	Name        string          `json:"name"`
+	Description *string         `json:"description"`
+	Sections    []ReportSection `json:"sections"`
+	Branding    ReportBranding  `json:"branding"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ReportSection is one section of a report template. A chart section plots
+// a stream's metric per day, of one unit or of all of them.
+type ReportSection struct {
+	Type      string  `json:"type"`
+	Title     *string `json:"title,omitempty"` // replaces the default heading
+	Stream    string  `json:"stream,omitempty"`
+	Metric    string  `json:"metric,omitempty"`
+	Unit      *string `json:"unit,omitempty"`
+	Aggregate string  `json:"aggregate,omitempty"` // avg, min or max per day
+}
+
+// ReportBranding dresses a report template's reports.
+type ReportBranding struct {
+	Company *string `json:"company"` // above the title and in the footer
+	Color   *string `json:"color"`   // #rrggbb, of the headings and charts
+	Footer  *string `json:"footer"`  // e.g. a confidentiality note, on every page
+}
+
+// Report delivery statuses.
+const (
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed"
+)
+
+// ReportDelivery is one attempt to email a scheduled report.
+type ReportDelivery struct {
+	ID         int64    `json:"id"`
+	ScheduleID int64    `json:"schedule_id"`
+	Period     string   `json:"period"`
+	Recipients []string `json:"recipients"`
+	Vessels    int      `json:"vessels"` // reports attached, one per vessel
+	Status     string   `json:"status"`
+	Error      *string  `json:"error"`
+	// Manual is set for reports sent on request rather than on schedule.
+	Manual bool      `json:"manual"`
+	At     time.Time `json:"at"`
+}
+
 type PaginatedResponse struct {
 	Items      interface{} `json:"items"`
 	NextCursor *string     `json:"next_cursor,omitempty"`
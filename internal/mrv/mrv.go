@@ -0,0 +1,446 @@
+// Package mrv compiles a vessel's EU MRV figures (Regulation (EU) 2015/757)
+// voyage by voyage: each voyage between port calls that departs from or
+// arrives at a port of the EU or EEA, and each stay in such a port, with the
+// fuel burnt, the CO2 that emits and the transport work done. Tables in the
+// layout of the EMSA per-voyage monitoring template are built from the
+// report for CSV and XLSX export.
+package mrv
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"vessel-telemetry-api/internal/daily"
+	"vessel-telemetry-api/internal/deltas"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/resample"
+)
+
+// Types of voyage, as the EMSA template names them.
+const (
+	BetweenEU = "EU-EU"
+	FromEU    = "EU-non-EU"
+	ToEU      = "non-EU-EU"
+)
+
+// Lookback is how long before the period positions and tank readings are
+// read, so voyages under way at its start are found from their departure.
+const Lookback = 45 * 24 * time.Hour
+
+// EEA are the countries (ISO 3166 alpha-2, as the port index has them) whose
+// ports the regulation covers: the EU member states, Iceland and Norway.
+var EEA = map[string]bool{
+	"AT": true, "BE": true, "BG": true, "CY": true, "CZ": true, "DE": true, "DK": true, "EE": true,
+	"ES": true, "FI": true, "FR": true, "GR": true, "HR": true, "HU": true, "IE": true, "IT": true,
+	"LT": true, "LU": true, "LV": true, "MT": true, "NL": true, "PL": true, "PT": true, "RO": true,
+	"SE": true, "SI": true, "SK": true, "IS": true, "NO": true,
+}
+
+// Densities (t/m3) convert the liters measured in the tanks to the metric
+// tonnes reported, by emission-factors code.
+var Densities = map[string]float64{
+	"HFO":         0.991,
+	"LFO":         0.955,
+	"MGO":         0.890,
+	"LNG":         0.450,
+	"LPG_PROPANE": 0.500,
+	"LPG_BUTANE":  0.580,
+	"ETHANE":      0.546,
+	"METHANOL":    0.796,
+	"ETHANOL":     0.789,
+}
+
+// Options tune the report.
+type Options struct {
+	// DefaultFuel is the emission-factors code of tanks without a fuel type
+	DefaultFuel string
+	// CargoTonnes is the cargo carried on every voyage, which the transport
+	// work is taken from; nil leaves it out
+	CargoTonnes *float64
+	// BunkeringLiters is the rise of a tank's volume between two readings
+	// taken as bunkering, not consumption
+	BunkeringLiters float64
+	// TankMaxGap is the longest time between two tank readings whose
+	// difference still counts as consumption
+	TankMaxGap time.Duration
+}
+
+// DefaultOptions take untyped tanks as HFO and count tank rises of 1 m3 as
+// bunkering, as the DCS report does.
+var DefaultOptions = Options{
+	DefaultFuel:     "HFO",
+	BunkeringLiters: 1000,
+	TankMaxGap:      48 * time.Hour,
+}
+
+// Tank is the volume readings of one tank, oldest first.
+type Tank struct {
+	FuelType string // emission-factors code, empty for Options.DefaultFuel
+	Points   []resample.Point
+}
+
+// Inputs are a vessel's data of the period and the Lookback before it.
+type Inputs struct {
+	Vessel models.Vessel
+	Fixes  []ports.Fix
+	// Calls are the port calls detected in the fixes, oldest first
+	Calls []ports.Call
+	Tanks []Tank
+	// Factors are the CO2 emission factors (t CO2 per t fuel) by
+	// emission-factors code
+	Factors map[string]float64
+}
+
+// Fuel is the consumption of one fuel type.
+type Fuel struct {
+	FuelType  string  `json:"fuel_type"`
+	Liters    float64 `json:"liters"`
+	Tonnes    float64 `json:"metric_tonnes"`
+	CO2Tonnes float64 `json:"co2_tonnes"`
+}
+
+// Voyage is a passage between two port calls, at least one of them in the
+// EEA.
+type Voyage struct {
+	Number            int       `json:"voyage_no"`
+	Type              string    `json:"type"`
+	DeparturePort     string    `json:"departure_port"`
+	DeparturePortName string    `json:"departure_port_name"`
+	DepartureCountry  string    `json:"departure_country"`
+	Departure         time.Time `json:"departure"`
+	ArrivalPort       string    `json:"arrival_port"`
+	ArrivalPortName   string    `json:"arrival_port_name"`
+	ArrivalCountry    string    `json:"arrival_country"`
+	Arrival           time.Time `json:"arrival"`
+	HoursAtSea        float64   `json:"time_at_sea_hours"`
+	DistanceNM        float64   `json:"distance_nm"`
+	Fuel              []Fuel    `json:"fuel"`
+	CO2Tonnes         float64   `json:"co2_tonnes"`
+	CargoTonnes       *float64  `json:"cargo_tonnes"`
+	// TransportWork is the cargo carried times the distance, in tonne-miles
+	TransportWork *float64 `json:"transport_work_tonne_nm"`
+}
+
+// Berth is a completed stay in a port of the EEA.
+type Berth struct {
+	PortCode  string    `json:"port_code"`
+	PortName  string    `json:"port_name"`
+	Country   string    `json:"country"`
+	Arrival   time.Time `json:"arrival"`
+	Departure time.Time `json:"departure"`
+	Hours     float64   `json:"hours"`
+	Fuel      []Fuel    `json:"fuel"`
+	CO2Tonnes float64   `json:"co2_tonnes"`
+}
+
+// Totals are the annual figures of the report.
+type Totals struct {
+	Voyages        int      `json:"voyages"`
+	Fuel           []Fuel   `json:"fuel"`
+	CO2Tonnes      float64  `json:"co2_tonnes"`
+	CO2BetweenEU   float64  `json:"co2_between_eu_ports_tonnes"`
+	CO2FromEU      float64  `json:"co2_departing_eu_ports_tonnes"`
+	CO2ToEU        float64  `json:"co2_arriving_eu_ports_tonnes"`
+	CO2AtBerth     float64  `json:"co2_at_berth_tonnes"`
+	DistanceNM     float64  `json:"distance_nm"`
+	HoursAtSea     float64  `json:"time_at_sea_hours"`
+	TransportWork  *float64 `json:"transport_work_tonne_nm"`
+	BerthHours     float64  `json:"time_at_berth_hours"`
+	CO2PerDistance *float64 `json:"co2_per_distance_kg_per_nm"`
+}
+
+// Report is a vessel's EU MRV figures of one period.
+type Report struct {
+	IMONumber   *string  `json:"imo_number"`
+	ShipName    string   `json:"ship_name"`
+	Year        int      `json:"year"`
+	PeriodStart string   `json:"period_start"` // YYYY-MM-DD
+	PeriodEnd   string   `json:"period_end"`   // YYYY-MM-DD, inclusive
+	Voyages     []Voyage `json:"voyages"`
+	Berths      []Berth  `json:"berths"`
+	Totals      Totals   `json:"totals"`
+}
+
+// burn is a fall of one tank's volume.
+type burn struct {
+	at     time.Time
+	fuel   string
+	liters float64
+}
+
+// Build compiles the report of the period from..to, within one year. A
+// voyage belongs to the period it arrives in and a stay to the one it ends
+// in; the vessel's last call, still open, is left out.
+func Build(from, to time.Time, in Inputs, opts Options) Report {
+	r := Report{
+		IMONumber:   in.Vessel.IMO,
+		ShipName:    in.Vessel.Name,
+		Year:        from.Year(),
+		PeriodStart: from.Format(daily.DayLayout),
+		PeriodEnd:   to.Add(-time.Nanosecond).Format(daily.DayLayout),
+		Voyages:     []Voyage{},
+		Berths:      []Berth{},
+	}
+	inPeriod := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+
+	// Tank volume falls, leaving out bunkering and gaps, each at the reading
+	// it ends on
+	var burns []burn
+	for _, tank := range in.Tanks {
+		fuel := tank.FuelType
+		if fuel == "" {
+			fuel = opts.DefaultFuel
+		}
+		d, _ := deltas.Compute(tank.Points, deltas.Options{MaxIncrease: &opts.BunkeringLiters, MaxGap: opts.TankMaxGap})
+		for _, delta := range d {
+			if delta.Delta != nil && *delta.Delta < 0 {
+				burns = append(burns, burn{at: delta.To, fuel: fuel, liters: -*delta.Delta})
+			}
+		}
+	}
+	fuelBetween := func(start, end time.Time) []Fuel {
+		liters := make(map[string]float64)
+		for _, b := range burns {
+			if b.at.After(start) && !b.at.After(end) {
+				liters[b.fuel] += b.liters
+			}
+		}
+		return fuels(liters, in.Factors)
+	}
+
+	fixes := append([]ports.Fix(nil), in.Fixes...)
+	sort.SliceStable(fixes, func(i, j int) bool { return fixes[i].Timestamp.Before(fixes[j].Timestamp) })
+
+	totals := make(map[string]float64)
+	t := &r.Totals
+	for i, call := range in.Calls {
+		if call.Departure == nil {
+			continue
+		}
+		if EEA[call.Country] && inPeriod(*call.Departure) {
+			b := Berth{
+				PortCode: call.PortCode, PortName: call.PortName, Country: call.Country,
+				Arrival: call.Arrival, Departure: *call.Departure,
+				Hours: round(call.Departure.Sub(call.Arrival).Hours(), 2),
+				Fuel:  fuelBetween(call.Arrival, *call.Departure),
+			}
+			b.CO2Tonnes = co2(b.Fuel)
+			t.CO2AtBerth += b.CO2Tonnes
+			t.BerthHours += b.Hours
+			addFuel(totals, b.Fuel)
+			r.Berths = append(r.Berths, b)
+		}
+
+		if i+1 == len(in.Calls) {
+			continue
+		}
+		next := in.Calls[i+1]
+		var kind string
+		switch {
+		case EEA[call.Country] && EEA[next.Country]:
+			kind = BetweenEU
+		case EEA[call.Country]:
+			kind = FromEU
+		case EEA[next.Country]:
+			kind = ToEU
+		}
+		if kind == "" || !inPeriod(next.Arrival) {
+			continue
+		}
+		v := Voyage{
+			Number: len(r.Voyages) + 1, Type: kind,
+			DeparturePort: call.PortCode, DeparturePortName: call.PortName, DepartureCountry: call.Country, Departure: *call.Departure,
+			ArrivalPort: next.PortCode, ArrivalPortName: next.PortName, ArrivalCountry: next.Country, Arrival: next.Arrival,
+			HoursAtSea:  round(next.Arrival.Sub(*call.Departure).Hours(), 2),
+			DistanceNM:  round(daily.Distance(between(fixes, *call.Departure, next.Arrival)), 2),
+			Fuel:        fuelBetween(*call.Departure, next.Arrival),
+			CargoTonnes: opts.CargoTonnes,
+		}
+		v.CO2Tonnes = co2(v.Fuel)
+		if opts.CargoTonnes != nil {
+			work := round(*opts.CargoTonnes*v.DistanceNM, 0)
+			v.TransportWork = &work
+			if t.TransportWork == nil {
+				t.TransportWork = new(float64)
+			}
+			*t.TransportWork += work
+		}
+		switch kind {
+		case BetweenEU:
+			t.CO2BetweenEU += v.CO2Tonnes
+		case FromEU:
+			t.CO2FromEU += v.CO2Tonnes
+		case ToEU:
+			t.CO2ToEU += v.CO2Tonnes
+		}
+		t.DistanceNM += v.DistanceNM
+		t.HoursAtSea += v.HoursAtSea
+		addFuel(totals, v.Fuel)
+		r.Voyages = append(r.Voyages, v)
+	}
+
+	t.Voyages = len(r.Voyages)
+	t.Fuel = fuels(totals, in.Factors)
+	t.CO2Tonnes = co2(t.Fuel)
+	t.CO2BetweenEU, t.CO2FromEU, t.CO2ToEU, t.CO2AtBerth = round(t.CO2BetweenEU, 3), round(t.CO2FromEU, 3), round(t.CO2ToEU, 3), round(t.CO2AtBerth, 3)
+	t.DistanceNM, t.HoursAtSea, t.BerthHours = round(t.DistanceNM, 2), round(t.HoursAtSea, 2), round(t.BerthHours, 2)
+	if t.DistanceNM > 0 {
+		perNM := round((t.CO2Tonnes-t.CO2AtBerth)*1000/t.DistanceNM, 3)
+		t.CO2PerDistance = &perNM
+	}
+	return r
+}
+
+// between returns the fixes (ordered by time) from the last one at or before
+// start to the first one at or after end.
+func between(fixes []ports.Fix, start, end time.Time) []ports.Fix {
+	var track []ports.Fix
+	for _, f := range fixes {
+		switch {
+		case !f.Timestamp.After(start):
+			track = append(track[:0], f)
+		case !f.Timestamp.Before(end):
+			return append(track, f)
+		default:
+			track = append(track, f)
+		}
+	}
+	return track
+}
+
+// fuels converts liters by fuel type to a list ordered by fuel type. Fuel
+// types without a density are taken as HFO, those without an emission
+// factor emit nothing.
+func fuels(liters map[string]float64, factors map[string]float64) []Fuel {
+	list := make([]Fuel, 0, len(liters))
+	for code, l := range liters {
+		density, ok := Densities[code]
+		if !ok {
+			density = Densities["HFO"]
+		}
+		tonnes := round(l/1000*density, 3)
+		list = append(list, Fuel{FuelType: code, Liters: round(l, 1), Tonnes: tonnes, CO2Tonnes: round(tonnes*factors[code], 3)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].FuelType < list[j].FuelType })
+	return list
+}
+
+func addFuel(liters map[string]float64, list []Fuel) {
+	for _, f := range list {
+		liters[f.FuelType] += f.Liters
+	}
+}
+
+func co2(list []Fuel) float64 {
+	var total float64
+	for _, f := range list {
+		total += f.CO2Tonnes
+	}
+	return round(total, 3)
+}
+
+func round(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// FuelTypes returns the fuel types the report has consumption of, in order;
+// the tables have a column for each.
+func (r Report) FuelTypes() []string {
+	codes := make([]string, 0, len(r.Totals.Fuel))
+	for _, f := range r.Totals.Fuel {
+		codes = append(codes, f.FuelType)
+	}
+	return codes
+}
+
+// Table returns the voyages and stays in port in the layout of the EMSA
+// per-voyage template, a header row first. Stays in port are rows of type
+// "at berth" with the port as both departure and arrival.
+func (r Report) Table() [][]string {
+	codes := r.FuelTypes()
+	header := []string{"Voyage No", "Type", "Port of departure", "Port of arrival", "Departure (UTC)", "Arrival (UTC)",
+		"Time at sea (h)", "Distance (nm)"}
+	for _, code := range codes {
+		header = append(header, code+" consumed (t)")
+	}
+	header = append(header, "CO2 emitted (t)", "Cargo carried (t)", "Transport work (t nm)")
+	rows := [][]string{header}
+
+	fuelCells := func(list []Fuel) []string {
+		cells := make([]string, len(codes))
+		for i, code := range codes {
+			cells[i] = "0"
+			for _, f := range list {
+				if f.FuelType == code {
+					cells[i] = number(f.Tonnes, 3)
+				}
+			}
+		}
+		return cells
+	}
+	optional := func(v *float64, places int) string {
+		if v == nil {
+			return ""
+		}
+		return number(*v, places)
+	}
+
+	for _, v := range r.Voyages {
+		row := []string{strconv.Itoa(v.Number), v.Type, v.DeparturePort, v.ArrivalPort,
+			v.Departure.UTC().Format(time.RFC3339), v.Arrival.UTC().Format(time.RFC3339),
+			number(v.HoursAtSea, 2), number(v.DistanceNM, 2)}
+		row = append(row, fuelCells(v.Fuel)...)
+		rows = append(rows, append(row, number(v.CO2Tonnes, 3), optional(v.CargoTonnes, 0), optional(v.TransportWork, 0)))
+	}
+	for _, b := range r.Berths {
+		row := []string{"", "at berth", b.PortCode, b.PortCode,
+			b.Departure.UTC().Format(time.RFC3339), b.Arrival.UTC().Format(time.RFC3339), "0", "0"}
+		row = append(row, fuelCells(b.Fuel)...)
+		rows = append(rows, append(row, number(b.CO2Tonnes, 3), "", ""))
+	}
+	return rows
+}
+
+// Summary returns the annual figures as label and value rows, as the EMSA
+// template's annual sheet has them.
+func (r Report) Summary() [][]string {
+	imo := ""
+	if r.IMONumber != nil {
+		imo = *r.IMONumber
+	}
+	t := r.Totals
+	rows := [][]string{
+		{"IMO number", imo},
+		{"Ship name", r.ShipName},
+		{"Reporting period", r.PeriodStart + " to " + r.PeriodEnd},
+		{"Voyages", strconv.Itoa(t.Voyages)},
+	}
+	for _, f := range t.Fuel {
+		rows = append(rows, []string{f.FuelType + " consumed (t)", number(f.Tonnes, 3)})
+	}
+	rows = append(rows,
+		[]string{"Total CO2 emitted (t)", number(t.CO2Tonnes, 3)},
+		[]string{"CO2 on voyages between EU ports (t)", number(t.CO2BetweenEU, 3)},
+		[]string{"CO2 on voyages departing from EU ports (t)", number(t.CO2FromEU, 3)},
+		[]string{"CO2 on voyages arriving at EU ports (t)", number(t.CO2ToEU, 3)},
+		[]string{"CO2 at berth in EU ports (t)", number(t.CO2AtBerth, 3)},
+		[]string{"Distance travelled (nm)", number(t.DistanceNM, 2)},
+		[]string{"Time at sea (h)", number(t.HoursAtSea, 2)},
+		[]string{"Time at berth (h)", number(t.BerthHours, 2)},
+	)
+	if t.TransportWork != nil {
+		rows = append(rows, []string{"Transport work (t nm)", number(*t.TransportWork, 0)})
+	}
+	if t.CO2PerDistance != nil {
+		rows = append(rows, []string{"CO2 per distance (kg/nm)", number(*t.CO2PerDistance, 3)})
+	}
+	return rows
+}
+
+func number(v float64, places int) string {
+	return strconv.FormatFloat(v, 'f', places, 64)
+}
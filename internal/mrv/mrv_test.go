@@ -0,0 +1,90 @@
+package mrv
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/dcs"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/resample"
+)
+
+func TestBuild(t *testing.T) {
+	from, to := dcs.Period(2025, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	at := func(month time.Month, day int) time.Time {
+		return time.Date(2025, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	call := func(code, country string, arrival, departure time.Time) ports.Call {
+		return ports.Call{PortCode: code, PortName: code, Country: country, Arrival: arrival, Departure: &departure}
+	}
+	cargo := 1000.0
+
+	in := Inputs{
+		Vessel: models.Vessel{Name: "Equator"},
+		// 1 degree of longitude along the equator is about 60 nm
+		Fixes: []ports.Fix{
+			{Timestamp: at(1, 20)}, {Timestamp: at(1, 31), Longitude: 1},
+			{Timestamp: at(2, 3)}, {Timestamp: at(2, 4), Longitude: 0.5},
+		},
+		Calls: []ports.Call{
+			// Departed before the year, so only the arrival voyage counts
+			call("SGSIN", "SG", time.Date(2024, 12, 20, 0, 0, 0, 0, time.UTC), at(1, 20)),
+			call("NLRTM", "NL", at(1, 31), at(2, 3)),
+			call("DEHAM", "DE", at(2, 4), at(2, 5)),
+			call("GBFXT", "GB", at(2, 7), at(2, 8)),
+			call("AEJEA", "AE", at(3, 1), at(3, 2)),
+			// Still in port
+			{PortCode: "SGSIN", Country: "SG", Arrival: at(4, 1)},
+		},
+		Tanks: []Tank{
+			// The last fall is at berth in Rotterdam
+			{FuelType: "MGO", Points: []resample.Point{{TS: at(1, 20), Value: 50000}, {TS: at(1, 21), Value: 48000}, {TS: at(1, 31), Value: 47000}, {TS: at(2, 1), Value: 46500}}},
+			// Untyped, so HFO; the rise is bunkering
+			{Points: []resample.Point{{TS: at(2, 3), Value: 100000}, {TS: at(2, 4), Value: 99000}, {TS: at(2, 5), Value: 120000}, {TS: at(2, 6), Value: 119000}}},
+		},
+		Factors: map[string]float64{"HFO": 3.114, "MGO": 3.206},
+	}
+	opts := DefaultOptions
+	opts.CargoTonnes = &cargo
+	opts.TankMaxGap = 15 * 24 * time.Hour
+
+	r := Build(from, to, in, opts)
+	if len(r.Voyages) != 3 || len(r.Berths) != 2 {
+		t.Fatalf("Expected 3 voyages and 2 berths, got %+v %+v", r.Voyages, r.Berths)
+	}
+	toEU, between, fromEU := r.Voyages[0], r.Voyages[1], r.Voyages[2]
+	if toEU.Type != ToEU || between.Type != BetweenEU || fromEU.Type != FromEU || fromEU.ArrivalPort != "GBFXT" {
+		t.Errorf("Unexpected voyages %+v", r.Voyages)
+	}
+	if toEU.HoursAtSea != 264 || toEU.DistanceNM < 59.9 || toEU.DistanceNM > 60.1 || *toEU.TransportWork != 60040 {
+		t.Errorf("Unexpected voyage figures %+v", toEU)
+	}
+	if len(toEU.Fuel) != 1 || toEU.Fuel[0].FuelType != "MGO" || toEU.Fuel[0].Liters != 3000 || toEU.Fuel[0].Tonnes != 2.67 || toEU.CO2Tonnes != 8.56 {
+		t.Errorf("Unexpected voyage fuel %+v, %v t CO2", toEU.Fuel, toEU.CO2Tonnes)
+	}
+	if len(between.Fuel) != 1 || between.Fuel[0].FuelType != "HFO" || between.Fuel[0].Tonnes != 0.991 || between.CO2Tonnes != 3.086 {
+		t.Errorf("Unexpected voyage fuel %+v, %v t CO2", between.Fuel, between.CO2Tonnes)
+	}
+	// The Hamburg stay ends on the bunkering, which is not consumption
+	if berth := r.Berths[1]; berth.PortCode != "DEHAM" || berth.Hours != 24 || len(berth.Fuel) != 0 {
+		t.Errorf("Unexpected berth %+v", berth)
+	}
+
+	totals := r.Totals
+	if totals.Voyages != 3 || totals.CO2Tonnes != 16.159 || totals.CO2ToEU != 8.56 || totals.CO2BetweenEU != 3.086 ||
+		totals.CO2FromEU != 3.086 || totals.CO2AtBerth != 1.427 || totals.HoursAtSea != 336 || totals.BerthHours != 96 {
+		t.Errorf("Unexpected totals %+v", totals)
+	}
+	if len(totals.Fuel) != 2 || totals.Fuel[0].FuelType != "HFO" || totals.Fuel[0].Liters != 2000 {
+		t.Errorf("Unexpected fuel totals %+v", totals.Fuel)
+	}
+
+	table := r.Table()
+	if len(table) != 6 || len(table[0]) != 13 || table[0][8] != "HFO consumed (t)" || table[1][1] != ToEU || table[1][9] != "2.670" {
+		t.Errorf("Unexpected table %v", table)
+	}
+	if table[4][1] != "at berth" || table[4][2] != "NLRTM" || table[4][9] != "0.445" {
+		t.Errorf("Unexpected berth row %v", table[4])
+	}
+}
@@ -0,0 +1,304 @@
+// Package nats is the NATS JetStream publisher of the reading sink (see
+// internal/sink).
+//
+// Readings go to subjects named prefix, IMO number and stream, e.g.
+// telemetry.9811000.engines; vessels without an IMO number have vessel-<id>
+// in its place. A JetStream stream has to capture the subjects. Each
+// message carries a Nats-Msg-Id of stream and reading id, so JetStream
+// drops what a retried batch sends again within its duplicate window.
+//
+// The client speaks the core text protocol itself: TLS when the server
+// requires it or the URL is tls://, and user and password or a token from
+// the URL. Credentials files and NKeys are not supported.
+package nats
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/sink"
+)
+
+// subjectPrefix is a run of subject tokens, each followed by a dot.
+var subjectPrefix = regexp.MustCompile(`^([^.\s*>]+\.)*$`)
+
+// ValidSubjectPrefix reports whether subjects named prefix, an IMO number
+// and a stream are valid.
+func ValidSubjectPrefix(prefix string) bool {
+	return subjectPrefix.MatchString(prefix)
+}
+
+// tokenChars are the characters kept in the IMO token of a subject.
+var tokenChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// ErrNoStream means no JetStream stream captures a subject.
+var ErrNoStream = errors.New("no JetStream stream for subject")
+
+// Publisher is the sink publisher of a NATS JetStream server.
+type Publisher struct {
+	servers []*url.URL
+	prefix  string
+	out     *outbound.Integration
+}
+
+// NewPublisher creates a publisher to the first reachable of servers
+// (nats:// or tls:// URLs) and subjects starting with prefix, its calls
+// guarded by policy as the "nats" integration.
+func NewPublisher(servers []string, prefix string, policy outbound.Policy) (*Publisher, error) {
+	p := &Publisher{prefix: prefix, out: outbound.New("nats", policy)}
+	for _, s := range servers {
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid server %q, use nats://host:4222 or tls://host:4222", s)
+		}
+		p.servers = append(p.servers, u)
+	}
+	return p, nil
+}
+
+// Target names the outbox cursor of the publisher; it follows the
+// subjects, not the servers.
+func (p *Publisher) Target() string {
+	return "nats:" + p.prefix
+}
+
+// Subject returns the subject of an event.
+func (p *Publisher) Subject(e sink.Event) string {
+	token := tokenChars.ReplaceAllString(e.IMO, "_")
+	if token == "" {
+		token = "vessel-" + strconv.FormatInt(e.VesselID, 10)
+	}
+	return p.prefix + token + "." + e.Stream
+}
+
+// Publish sends events and returns once JetStream has stored each.
+func (p *Publisher) Publish(ctx context.Context, events []sink.Event) error {
+	return p.out.Do(ctx, func(ctx context.Context) error {
+		return p.publish(ctx, events)
+	})
+}
+
+func (p *Publisher) publish(ctx context.Context, events []sink.Event) error {
+	var c *conn
+	var err error
+	for _, u := range p.servers {
+		if c, err = dial(ctx, u); err == nil {
+			break
+		}
+	}
+	if c == nil {
+		return fmt.Errorf("no server reachable: %w", err)
+	}
+	defer c.Close()
+
+	// Acks come to an inbox of ours, one reply subject per message
+	var id [8]byte
+	rand.Read(id[:])
+	inbox := "_INBOX." + hex.EncodeToString(id[:])
+	fmt.Fprintf(c.w, "SUB %s.* 1\r\n", inbox)
+	subjects := make([]string, len(events))
+	for i, e := range events {
+		subjects[i] = p.Subject(e)
+		header := "NATS/1.0\r\nNats-Msg-Id: " + e.Stream + "-" + strconv.FormatInt(e.ReadingID, 10) + "\r\n\r\n"
+		fmt.Fprintf(c.w, "HPUB %s %s.%d %d %d\r\n", subjects[i], inbox, i, len(header), len(header)+len(e.Value))
+		c.w.WriteString(header)
+		c.w.Write(e.Value)
+		c.w.WriteString("\r\n")
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	for acked := 0; acked < len(events); {
+		msg, err := c.next()
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimPrefix(msg.subject, inbox+"."))
+		if err != nil || i < 0 || i >= len(events) {
+			continue
+		}
+		if strings.HasPrefix(msg.header, "NATS/1.0 503") {
+			return outbound.Permanent(fmt.Errorf("%s: %w", subjects[i], ErrNoStream))
+		}
+		var ack struct {
+			Stream string `json:"stream"`
+			Error  *struct {
+				Code        int    `json:"code"`
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(msg.payload, &ack); err != nil {
+			return fmt.Errorf("%s: invalid ack %q", subjects[i], msg.payload)
+		}
+		if ack.Error != nil {
+			err := fmt.Errorf("%s: JetStream error %d: %s", subjects[i], ack.Error.Code, ack.Error.Description)
+			if ack.Error.Code >= 500 {
+				return err
+			}
+			return outbound.Permanent(err)
+		}
+		acked++
+	}
+	return nil
+}
+
+// conn is a connection to a server.
+type conn struct {
+	net net.Conn
+	r   *bufio.Reader
+	w   *bufio.Writer
+}
+
+// info is the part of the server's INFO the client needs.
+type info struct {
+	TLSRequired bool `json:"tls_required"`
+	Headers     bool `json:"headers"`
+}
+
+func dial(ctx context.Context, u *url.URL) (*conn, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// Reads and writes do not watch ctx themselves
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+	c := &conn{net: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	line, err := c.line()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	var srv info
+	if !strings.HasPrefix(line, "INFO ") || json.Unmarshal([]byte(line[5:]), &srv) != nil {
+		c.Close()
+		return nil, fmt.Errorf("%s: unexpected greeting %q", addr, line)
+	}
+	if !srv.Headers {
+		c.Close()
+		return nil, outbound.Permanent(fmt.Errorf("%s: server does not support headers (NATS 2.2 or later needed)", addr))
+	}
+	if srv.TLSRequired || u.Scheme == "tls" {
+		tc := tls.Client(nc, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.net, c.r, c.w = tc, bufio.NewReader(tc), bufio.NewWriter(tc)
+	}
+
+	connect := map[string]interface{}{
+		"verbose": false, "pedantic": false, "name": "vessel-telemetry-api", "lang": "go", "version": "1",
+		"protocol": 1, "headers": true, "no_responders": true, "tls_required": srv.TLSRequired || u.Scheme == "tls",
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			connect["user"], connect["pass"] = u.User.Username(), pass
+		} else {
+			connect["auth_token"] = u.User.Username()
+		}
+	}
+	body, _ := json.Marshal(connect)
+	fmt.Fprintf(c.w, "CONNECT %s\r\nPING\r\n", body)
+	if err := c.w.Flush(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	// The server answers the PING once it accepted CONNECT
+	for {
+		line, err := c.line()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		switch {
+		case line == "PONG":
+			return c, nil
+		case strings.HasPrefix(line, "-ERR"):
+			c.Close()
+			return nil, outbound.Permanent(fmt.Errorf("%s: %s", addr, line))
+		}
+	}
+}
+
+func (c *conn) Close() error { return c.net.Close() }
+
+// line reads one protocol line without its CRLF.
+func (c *conn) line() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// message is a MSG or HMSG received.
+type message struct {
+	subject string
+	header  string
+	payload []byte
+}
+
+// next reads the next protocol message, answering PINGs. It returns nil for
+// anything but a message.
+func (c *conn) next() (*message, error) {
+	line, err := c.line()
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	switch fields[0] {
+	case "PING":
+		c.w.WriteString("PONG\r\n")
+		return nil, c.w.Flush()
+	case "-ERR":
+		return nil, errors.New(line)
+	case "MSG", "HMSG":
+	default:
+		return nil, nil // +OK, PONG, INFO
+	}
+
+	// MSG subject sid [reply] size; HMSG subject sid [reply] header-size size
+	headerSize, size := 0, 0
+	n := len(fields)
+	if size, err = strconv.Atoi(fields[n-1]); err != nil || n < 4 {
+		return nil, fmt.Errorf("invalid message line %q", line)
+	}
+	if fields[0] == "HMSG" {
+		if headerSize, err = strconv.Atoi(fields[n-2]); err != nil || n < 5 || headerSize > size {
+			return nil, fmt.Errorf("invalid message line %q", line)
+		}
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return nil, err
+	}
+	return &message{subject: fields[1], header: string(data[:headerSize]), payload: data[headerSize:size]}, nil
+}
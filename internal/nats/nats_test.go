@@ -0,0 +1,173 @@
+package nats
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/sink"
+)
+
+// published is a message received by fakeServer.
+type published struct {
+	subject string
+	header  string
+	payload string
+}
+
+// fakeServer acks every message as JetStream would, or answers as if no
+// stream captured its subject.
+type fakeServer struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu       sync.Mutex
+	noStream bool
+	connect  map[string]interface{}
+	messages []published
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{t: t, ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	fmt.Fprintf(c, "INFO {\"server_id\":\"fake\",\"headers\":true,\"jetstream\":true}\r\n")
+	seq := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "CONNECT":
+			s.mu.Lock()
+			json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &s.connect)
+			s.mu.Unlock()
+		case "PING":
+			fmt.Fprintf(c, "PONG\r\n")
+		case "SUB":
+		case "HPUB":
+			// HPUB subject reply header-size size
+			headerSize, _ := strconv.Atoi(fields[3])
+			size, _ := strconv.Atoi(fields[4])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			s.mu.Lock()
+			noStream := s.noStream
+			if !noStream {
+				s.messages = append(s.messages, published{fields[1], string(data[:headerSize]), string(data[headerSize:size])})
+			}
+			s.mu.Unlock()
+			// Ask for a pong first, as servers do now and then
+			fmt.Fprintf(c, "PING\r\n")
+			if noStream {
+				header := "NATS/1.0 503\r\n\r\n"
+				fmt.Fprintf(c, "HMSG %s 1 %d %d\r\n%s\r\n", fields[2], len(header), len(header), header)
+				continue
+			}
+			seq++
+			ack := fmt.Sprintf(`{"stream":"TELEMETRY","seq":%d}`, seq)
+			fmt.Fprintf(c, "MSG %s 1 %d\r\n%s\r\n", fields[2], len(ack), ack)
+		case "PONG":
+		default:
+			s.t.Errorf("Unexpected line %q", line)
+			return
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeServer(t)
+	p, err := NewPublisher([]string{"nats://user:s3cret@" + srv.ln.Addr().String()}, "telemetry.", outbound.Policy{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Target() != "nats:telemetry." {
+		t.Errorf("Unexpected target %q", p.Target())
+	}
+
+	events := []sink.Event{
+		{Stream: "engines", ReadingID: 1, VesselID: 1, IMO: "9811000", Value: []byte(`{"id":1}`)},
+		{Stream: "engines", ReadingID: 2, VesselID: 2, Value: []byte(`{"id":2}`)},
+		{Stream: "fuel", ReadingID: 7, VesselID: 1, IMO: "IMO 9811000", Value: []byte(`{"id":7}`)},
+	}
+	if err := p.Publish(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	messages, connect := srv.messages, srv.connect
+	srv.mu.Unlock()
+	if connect["user"] != "user" || connect["pass"] != "s3cret" || connect["headers"] != true {
+		t.Errorf("Unexpected CONNECT %v", connect)
+	}
+	want := []published{
+		{"telemetry.9811000.engines", "NATS/1.0\r\nNats-Msg-Id: engines-1\r\n\r\n", `{"id":1}`},
+		{"telemetry.vessel-2.engines", "NATS/1.0\r\nNats-Msg-Id: engines-2\r\n\r\n", `{"id":2}`},
+		{"telemetry.IMO_9811000.fuel", "NATS/1.0\r\nNats-Msg-Id: fuel-7\r\n\r\n", `{"id":7}`},
+	}
+	if len(messages) != len(want) {
+		t.Fatalf("Expected %d messages, got %v", len(want), messages)
+	}
+	for i := range want {
+		if messages[i] != want[i] {
+			t.Errorf("Message %d: expected %q, got %q", i, want[i], messages[i])
+		}
+	}
+
+	srv.mu.Lock()
+	srv.noStream = true
+	srv.mu.Unlock()
+	if err := p.Publish(ctx, events[:1]); !errors.Is(err, ErrNoStream) {
+		t.Errorf("Expected ErrNoStream, got %v", err)
+	}
+}
+
+func TestSubjectPrefix(t *testing.T) {
+	for prefix, valid := range map[string]bool{
+		"": true, "telemetry.": true, "fleet.north.": true,
+		"telemetry": false, "tele metry.": false, "*.": false, "a..": false,
+	} {
+		if ValidSubjectPrefix(prefix) != valid {
+			t.Errorf("ValidSubjectPrefix(%q) = %v", prefix, !valid)
+		}
+	}
+	if _, err := NewPublisher([]string{"http://localhost:4222"}, "", outbound.Policy{}); err == nil {
+		t.Error("Expected an error for an http URL")
+	}
+}
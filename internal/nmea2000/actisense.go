@@ -0,0 +1,110 @@
+package nmea2000
+
+import (
+	"bufio"
+	"io"
+)
+
+// Actisense binary framing: DLE STX, the command, the length, the payload
+// and a checksum making the bytes from the command on sum to 0, then DLE
+// ETX; DLE bytes within are doubled.
+const (
+	dle = 0x10
+	stx = 0x02
+	etx = 0x03
+
+	// n2kReceived is the command of a message received from the bus
+	n2kReceived = 0x93
+)
+
+// ActisenseReader reads the messages of an Actisense binary stream, as
+// an NGT-1 sends them, already reassembled. Other frames and those whose
+// checksum fails are skipped. The NGT-1 dates messages by its uptime, so
+// their TS is left zero.
+type ActisenseReader struct {
+	r *bufio.Reader
+}
+
+// NewActisenseReader creates a reader of r.
+func NewActisenseReader(r io.Reader) *ActisenseReader {
+	return &ActisenseReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next message; the error is that of the underlying
+// reader, io.EOF at its end.
+func (a *ActisenseReader) Next() (Message, error) {
+	for {
+		frame, err := a.frame()
+		if err != nil {
+			return Message{}, err
+		}
+		if m, ok := parseActisense(frame); ok {
+			return m, nil
+		}
+	}
+}
+
+// frame returns the unescaped bytes between the next DLE STX and DLE ETX.
+func (a *ActisenseReader) frame() ([]byte, error) {
+	// Find the start
+	for {
+		b, err := a.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != dle {
+			continue
+		}
+		if b, err = a.r.ReadByte(); err != nil {
+			return nil, err
+		}
+		if b == stx {
+			break
+		}
+	}
+	var frame []byte
+	for {
+		b, err := a.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != dle {
+			frame = append(frame, b)
+			continue
+		}
+		if b, err = a.r.ReadByte(); err != nil {
+			return nil, err
+		}
+		switch b {
+		case dle:
+			frame = append(frame, dle)
+		case etx:
+			return frame, nil
+		default:
+			// The frame was cut short; DLE STX starts the next
+			frame = frame[:0]
+		}
+	}
+}
+
+// parseActisense reads the message of a frame, false if it holds none.
+func parseActisense(frame []byte) (Message, bool) {
+	if len(frame) < 3 || frame[0] != n2kReceived || int(frame[1]) != len(frame)-3 {
+		return Message{}, false
+	}
+	var sum byte
+	for _, b := range frame {
+		sum += b
+	}
+	p := frame[2 : len(frame)-1]
+	if sum != 0 || len(p) < 11 || int(p[10]) != len(p)-11 {
+		return Message{}, false
+	}
+	return Message{
+		Priority: p[0],
+		PGN:      uint32(p[1]) | uint32(p[2])<<8 | uint32(p[3])<<16,
+		Dest:     p[4],
+		Source:   p[5],
+		Data:     append([]byte(nil), p[11:]...),
+	}, true
+}
@@ -0,0 +1,265 @@
+package nmea2000
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+)
+
+// Defaults of Config.
+const (
+	DefaultInterval = 10 * time.Second
+	DefaultFlush    = time.Minute
+)
+
+// maxDatagram is the largest UDP datagram read.
+const maxDatagram = 64 << 10
+
+// Processor ingests the readings of a batch of messages.
+type Processor interface {
+	ProcessFeed(ctx context.Context, data []byte, readings []ingest.FeedReading, filename, imo string, mode ingest.IngestMode, source string) (*models.IngestResponse, error)
+}
+
+// Config says where messages come from and how they are kept.
+type Config struct {
+	// UDPAddr is the address gateways send datagrams to, e.g. :60002;
+	// empty if none.
+	UDPAddr string
+	// Device is the serial port of an Actisense NGT-1, e.g. /dev/ttyUSB0,
+	// already set to its speed (stty -F /dev/ttyUSB0 115200 raw); empty if
+	// none.
+	Device string
+	// IMO is the vessel of the bus.
+	IMO string
+	// Source tags the readings; sensor if empty.
+	Source string
+	// Interval is the resolution readings are kept at: of the values a
+	// field of a unit takes in an interval, the last is kept, dated at the
+	// start of the interval.
+	Interval time.Duration
+	// Flush is how often the readings gathered are ingested, as one upload.
+	Flush time.Duration
+}
+
+// bucketKey is a unit of a stream in an interval.
+type bucketKey struct {
+	stream, unit string
+	ts           time.Time
+}
+
+// Listener ingests the messages gateways bridge from a vessel's bus.
+type Listener struct {
+	processor Processor
+	cfg       Config
+
+	mu        sync.Mutex
+	assembler *Assembler
+	pending   map[bucketKey]map[string]string
+}
+
+// NewListener creates a listener of cfg.UDPAddr and cfg.Device.
+func NewListener(processor Processor, cfg Config) (*Listener, error) {
+	if cfg.UDPAddr == "" && cfg.Device == "" {
+		return nil, errors.New("a UDP address or a serial device is required")
+	}
+	if cfg.IMO == "" {
+		return nil, errors.New("the IMO number of the vessel is required")
+	}
+	if cfg.UDPAddr != "" {
+		if _, err := net.ResolveUDPAddr("udp", cfg.UDPAddr); err != nil {
+			return nil, fmt.Errorf("invalid UDP address %q: %w", cfg.UDPAddr, err)
+		}
+	}
+	if cfg.Source == "" {
+		cfg.Source = models.SourceSensor
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Flush <= 0 {
+		cfg.Flush = DefaultFlush
+	}
+	return &Listener{processor: processor, cfg: cfg, assembler: NewAssembler(), pending: make(map[bucketKey]map[string]string)}, nil
+}
+
+// Run reads messages and ingests their readings every cfg.Flush until ctx
+// is cancelled, then ingests those still gathered.
+func (l *Listener) Run(ctx context.Context) {
+	if l.cfg.UDPAddr != "" {
+		go l.listenUDP(ctx)
+	}
+	if l.cfg.Device != "" {
+		go l.readDevice(ctx)
+	}
+
+	ticker := time.NewTicker(l.cfg.Flush)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := l.Flush(flushCtx); err != nil {
+				log.Printf("nmea2000: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := l.Flush(ctx); err != nil {
+				log.Printf("nmea2000: %v", err)
+			}
+		}
+	}
+}
+
+func (l *Listener) listenUDP(ctx context.Context) {
+	conn, err := net.ListenPacket("udp", l.cfg.UDPAddr)
+	if err != nil {
+		log.Printf("nmea2000: listening on %s: %v", l.cfg.UDPAddr, err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, maxDatagram)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("nmea2000: reading %s: %v", l.cfg.UDPAddr, err)
+			}
+			return
+		}
+		l.AddDatagram(buf[:n], time.Now())
+	}
+}
+
+// readDevice reads the serial port, opening it again a while after it
+// fails, e.g. when the adapter is unplugged.
+func (l *Listener) readDevice(ctx context.Context) {
+	for {
+		f, err := os.Open(l.cfg.Device)
+		if err != nil {
+			log.Printf("nmea2000: opening %s: %v", l.cfg.Device, err)
+		} else {
+			stop := context.AfterFunc(ctx, func() { f.Close() })
+			err = l.read(NewActisenseReader(f))
+			stop()
+			f.Close()
+			if ctx.Err() == nil {
+				log.Printf("nmea2000: reading %s: %v", l.cfg.Device, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// read adds the messages of r until it fails.
+func (l *Listener) read(r *ActisenseReader) error {
+	for {
+		m, err := r.Next()
+		if err != nil {
+			return err
+		}
+		m.TS = time.Now()
+		l.Add(m)
+	}
+}
+
+// AddDatagram adds the messages of a datagram received at: Actisense binary
+// frames, or lines of the plain format. Lines that cannot be read are
+// skipped.
+func (l *Listener) AddDatagram(data []byte, at time.Time) {
+	if len(data) > 0 && data[0] == dle {
+		r := NewActisenseReader(bytes.NewReader(data))
+		for {
+			m, err := r.Next()
+			if err != nil {
+				return
+			}
+			m.TS = at
+			l.Add(m)
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			if m, err := ParsePlain(line, at); err == nil {
+				l.Add(m)
+			}
+		}
+	}
+}
+
+// Add gathers the readings of a message, or of the fast packet it
+// completes.
+func (l *Listener) Add(m Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m, ok := l.assembler.Add(m)
+	if !ok {
+		return
+	}
+	for _, r := range Decode(m) {
+		key := bucketKey{stream: r.Stream, unit: r.Unit, ts: r.TS.UTC().Truncate(l.cfg.Interval)}
+		if l.pending[key] == nil {
+			l.pending[key] = make(map[string]string)
+		}
+		for field, v := range r.Values {
+			l.pending[key][field] = v
+		}
+	}
+}
+
+// Flush ingests the readings gathered, if any. They are dropped if the
+// ingest fails.
+func (l *Listener) Flush(ctx context.Context) error {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = make(map[bucketKey]map[string]string)
+	l.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	readings := make([]ingest.FeedReading, 0, len(pending))
+	for key, values := range pending {
+		readings = append(readings, ingest.FeedReading{Stream: key.stream, Unit: key.unit, TS: key.ts, Values: values})
+	}
+	sort.Slice(readings, func(i, j int) bool {
+		a, b := readings[i], readings[j]
+		if !a.TS.Equal(b.TS) {
+			return a.TS.Before(b.TS)
+		}
+		if a.Stream != b.Stream {
+			return a.Stream < b.Stream
+		}
+		return a.Unit < b.Unit
+	})
+
+	filename := "nmea2000-" + readings[0].TS.Format("20060102T150405Z") + ".txt"
+	response, err := l.processor.ProcessFeed(ctx, ingest.FeedData(readings), readings, filename, l.cfg.IMO, ingest.ModeInsert, l.cfg.Source)
+	if err != nil {
+		return fmt.Errorf("ingesting %d reading(s): %w", len(readings), err)
+	}
+	for _, w := range response.Warnings {
+		log.Printf("nmea2000: %s: %s", filename, w)
+	}
+	return nil
+}
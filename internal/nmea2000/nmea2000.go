@@ -0,0 +1,284 @@
+// Package nmea2000 decodes NMEA 2000 engine, tank and position messages
+// into readings of the engines, fuel, bilge and location streams, and
+// ingests those a gateway bridges from the bus.
+//
+// Messages arrive over UDP, as lines of the Actisense/canboat plain text
+// format (timestamp,priority,PGN,source,destination,length,data bytes in
+// hex) or as Actisense binary frames, or from the serial port of an
+// Actisense NGT-1, as binary frames. Fast-packet PGNs sent frame by frame
+// are reassembled.
+//
+// NMEA 2000 instances count from 0; engines and tanks count from 1, so
+// instance 0 is engine or tank 1.
+package nmea2000
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+)
+
+// PGNs decoded.
+const (
+	PGNEngineRapid   = 127488 // Engine Parameters, Rapid Update
+	PGNEngineDynamic = 127489 // Engine Parameters, Dynamic
+	PGNFluidLevel    = 127505 // Fluid Level
+	PGNGNSSPosition  = 129029 // GNSS Position Data
+)
+
+// fastPacket are the decoded PGNs sent as fast packets, in several frames
+// when on the bus.
+var fastPacket = map[uint32]bool{PGNEngineDynamic: true, PGNGNSSPosition: true}
+
+// Message is an NMEA 2000 message: its PGN, source address and payload,
+// reassembled if it took several frames.
+type Message struct {
+	TS       time.Time
+	Priority uint8
+	PGN      uint32
+	Source   uint8
+	Dest     uint8
+	Data     []byte
+}
+
+// engineAlarms are the names of the bits of the first discrete status
+// field of 127489, lowest first.
+var engineAlarms = []string{
+	"Check Engine", "Over Temperature", "Low Oil Pressure", "Low Oil Level",
+	"Low Fuel Pressure", "Low System Voltage", "Low Coolant Level", "Water Flow",
+	"Water In Fuel", "Charge Indicator", "Preheat Indicator", "High Boost Pressure",
+	"Rev Limit Exceeded", "EGR System", "Throttle Position Sensor", "Emergency Stop",
+}
+
+// waterTanks name the tanks of the fluid types read into the bilge stream.
+var waterTanks = map[byte]string{1: "fresh_water", 2: "gray_water", 5: "black_water"}
+
+// Decode returns the readings of a message, none if its PGN is not decoded
+// or it carries no value.
+func Decode(m Message) []ingest.FeedReading {
+	d := m.Data
+	values := map[string]string{}
+	var stream, unit string
+	switch m.PGN {
+	case PGNEngineRapid:
+		if len(d) < 3 {
+			return nil
+		}
+		stream, unit = "engines", instance(d[0])
+		if v, ok := uint16At(d, 1); ok {
+			values["rpm"] = number(float64(v) * 0.25)
+		}
+	case PGNEngineDynamic:
+		if len(d) < 22 {
+			return nil
+		}
+		stream, unit = "engines", instance(d[0])
+		// hPa
+		if v, ok := uint16At(d, 1); ok {
+			values["oil_pressure_bar"] = number(float64(v) / 1000)
+		}
+		// Coolant, in 0.01 K
+		if v, ok := uint16At(d, 5); ok {
+			values["temp_c"] = number(float64(v)*0.01 - 273.15)
+		}
+		if v, ok := uint16At(d, 20); ok {
+			var alarms []string
+			for i, name := range engineAlarms {
+				if v&(1<<i) != 0 {
+					alarms = append(alarms, name)
+				}
+			}
+			values["alarms"] = strings.Join(alarms, ", ")
+			if len(alarms) == 0 {
+				values["alarms"] = "OK"
+			}
+		}
+	case PGNFluidLevel:
+		if len(d) < 7 {
+			return nil
+		}
+		tank := instance(d[0] & 0x0f)
+		level, hasLevel := int16At(d, 1)
+		capacity, hasCapacity := uint32At(d, 3)
+		percent := float64(level) * 0.004
+		liters := float64(capacity) * 0.1 * percent / 100
+		switch fluid := d[0] >> 4; {
+		case fluid == 0:
+			// Fuel levels are derived from the volume and the capacity,
+			// the tank registry's if the message has none
+			stream, unit = "fuel", tank
+			if hasCapacity {
+				values["capacity"] = number(float64(capacity) * 0.1)
+			}
+			if hasLevel && hasCapacity {
+				values["volume_liters"] = number(liters)
+			}
+		case waterTanks[fluid] != "":
+			stream, unit = "bilge", waterTanks[fluid]+"_"+tank
+			if hasLevel {
+				values["level_percent"] = number(percent)
+			}
+			if hasLevel && hasCapacity {
+				values["volume_m3"] = number(liters / 1000)
+			}
+		default:
+			return nil
+		}
+	case PGNGNSSPosition:
+		if len(d) < 23 {
+			return nil
+		}
+		lat, hasLat := int64At(d, 7)
+		lon, hasLon := int64At(d, 15)
+		if !hasLat || !hasLon {
+			return nil
+		}
+		stream = ingest.FeedLocation
+		values["latitude"] = number(float64(lat) * 1e-16)
+		values["longitude"] = number(float64(lon) * 1e-16)
+	default:
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return []ingest.FeedReading{{Stream: stream, Unit: unit, TS: m.TS, Values: values}}
+}
+
+// instance returns the engine or tank number of an instance.
+func instance(b byte) string {
+	return strconv.Itoa(int(b) + 1)
+}
+
+// number formats a value as read from a sheet, to the micro-unit.
+func number(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64)
+}
+
+// uint16At and the like read a little-endian field, reporting false for
+// the largest values of its size, which mean "not available" or an error.
+func uint16At(d []byte, i int) (uint16, bool) {
+	v := binary.LittleEndian.Uint16(d[i:])
+	return v, v < 0xfffd
+}
+
+func int16At(d []byte, i int) (int16, bool) {
+	v := int16(binary.LittleEndian.Uint16(d[i:]))
+	return v, v < 0x7ffd
+}
+
+func uint32At(d []byte, i int) (uint32, bool) {
+	v := binary.LittleEndian.Uint32(d[i:])
+	return v, v < 0xfffffffd
+}
+
+func int64At(d []byte, i int) (int64, bool) {
+	v := int64(binary.LittleEndian.Uint64(d[i:]))
+	return v, v < 0x7ffffffffffffffd
+}
+
+// Assembler joins the frames of fast-packet messages, by source and PGN.
+type Assembler struct {
+	partial map[[2]uint32]*partialMessage
+}
+
+type partialMessage struct {
+	seq    byte
+	next   byte
+	length int
+	data   []byte
+}
+
+// NewAssembler creates an assembler with no frames.
+func NewAssembler() *Assembler {
+	return &Assembler{partial: make(map[[2]uint32]*partialMessage)}
+}
+
+// Add returns the message a frame completes: the frame itself unless its
+// PGN is sent as fast packets. Frames out of order drop the message they
+// belong to.
+func (a *Assembler) Add(m Message) (Message, bool) {
+	// Gateways that reassemble send the whole payload at once
+	if !fastPacket[m.PGN] || len(m.Data) != 8 {
+		return m, true
+	}
+	key := [2]uint32{uint32(m.Source), m.PGN}
+	seq, frame := m.Data[0]>>5, m.Data[0]&0x1f
+	if frame == 0 {
+		p := &partialMessage{seq: seq, next: 1, length: int(m.Data[1])}
+		p.data = append(p.data, m.Data[2:]...)
+		a.partial[key] = p
+	} else {
+		p := a.partial[key]
+		if p == nil || p.seq != seq || p.next != frame {
+			delete(a.partial, key)
+			return Message{}, false
+		}
+		p.next++
+		p.data = append(p.data, m.Data[1:]...)
+	}
+	p := a.partial[key]
+	if len(p.data) < p.length {
+		return Message{}, false
+	}
+	delete(a.partial, key)
+	m.Data = p.data[:p.length]
+	return m, true
+}
+
+// ParsePlain reads a line of the Actisense/canboat plain format, e.g.
+// "2025-08-08T10:00:00.123Z,2,127488,0,255,8,00,c0,12,ff,ff,7f,ff,ff".
+// Lines without a timestamp it can read are dated at.
+func ParsePlain(line string, at time.Time) (Message, error) {
+	parts := strings.Split(strings.TrimSpace(line), ",")
+	if len(parts) < 6 {
+		return Message{}, fmt.Errorf("invalid NMEA 2000 line %q", line)
+	}
+	m := Message{TS: at}
+	if ts, ok := parseTimestamp(parts[0]); ok {
+		m.TS = ts
+	}
+	fields := make([]uint64, 5)
+	for i := range fields {
+		v, err := strconv.ParseUint(strings.TrimSpace(parts[i+1]), 10, 32)
+		if err != nil {
+			return Message{}, fmt.Errorf("invalid NMEA 2000 line %q", line)
+		}
+		fields[i] = v
+	}
+	m.Priority, m.PGN, m.Source, m.Dest = uint8(fields[0]), uint32(fields[1]), uint8(fields[2]), uint8(fields[3])
+	if int(fields[4]) != len(parts)-6 {
+		return Message{}, fmt.Errorf("invalid NMEA 2000 line %q: %d data bytes for length %d", line, len(parts)-6, fields[4])
+	}
+	for _, h := range parts[6:] {
+		b, err := strconv.ParseUint(strings.TrimSpace(h), 16, 8)
+		if err != nil {
+			return Message{}, fmt.Errorf("invalid NMEA 2000 line %q", line)
+		}
+		m.Data = append(m.Data, byte(b))
+	}
+	return m, nil
+}
+
+// timestampLayouts are those of the timestamps gateways and canboat write.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02-15:04:05.000",
+	"2006-01-02-15:04:05",
+	"2006-01-02Z15:04:05.000",
+	"2006-01-02 15:04:05.000",
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if ts, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return ts.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
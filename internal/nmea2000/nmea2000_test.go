@@ -0,0 +1,256 @@
+package nmea2000
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+)
+
+var at = time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+
+func TestDecode(t *testing.T) {
+	dynamic := make([]byte, 26)
+	for i := range dynamic {
+		dynamic[i] = 0xff
+	}
+	dynamic[0] = 1
+	binary.LittleEndian.PutUint16(dynamic[1:], 4200)  // 4.2 bar
+	binary.LittleEndian.PutUint16(dynamic[5:], 35815) // 85 °C
+	binary.LittleEndian.PutUint16(dynamic[20:], 0x0006)
+
+	fuel := []byte{0x00, 0, 0, 0, 0, 0, 0xff}
+	binary.LittleEndian.PutUint16(fuel[1:], 18750)  // 75 %
+	binary.LittleEndian.PutUint32(fuel[3:], 200000) // 20000 l
+
+	gray := []byte{0x21, 0, 0, 0xff, 0xff, 0xff, 0xff}
+	binary.LittleEndian.PutUint16(gray[1:], 5000) // 20 %
+
+	position := make([]byte, 43)
+	binary.LittleEndian.PutUint64(position[7:], uint64(int64(59.4372*1e16)))
+	binary.LittleEndian.PutUint64(position[15:], uint64(int64(math.Round(24.7536*1e16))))
+
+	tests := []struct {
+		name   string
+		m      Message
+		stream string
+		unit   string
+		values map[string]string
+	}{
+		{"rapid", Message{PGN: PGNEngineRapid, Data: []byte{0, 0xc0, 0x12, 0xff, 0xff, 0x7f, 0xff, 0xff}}, "engines", "1", map[string]string{"rpm": "1200"}},
+		{"dynamic", Message{PGN: PGNEngineDynamic, Data: dynamic}, "engines", "2", map[string]string{"oil_pressure_bar": "4.2", "temp_c": "85", "alarms": "Over Temperature, Low Oil Pressure"}},
+		{"fuel", Message{PGN: PGNFluidLevel, Data: fuel}, "fuel", "1", map[string]string{"capacity": "20000", "volume_liters": "15000"}},
+		{"gray water", Message{PGN: PGNFluidLevel, Data: gray}, "bilge", "gray_water_2", map[string]string{"level_percent": "20"}},
+		{"position", Message{PGN: PGNGNSSPosition, Data: position}, ingest.FeedLocation, "", map[string]string{"latitude": "59.4372", "longitude": "24.7536"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.m.TS = at
+			readings := Decode(tt.m)
+			if len(readings) != 1 {
+				t.Fatalf("Expected 1 reading, got %+v", readings)
+			}
+			r := readings[0]
+			if r.Stream != tt.stream || r.Unit != tt.unit || !r.TS.Equal(at) {
+				t.Errorf("Expected %s unit %q, got %+v", tt.stream, tt.unit, r)
+			}
+			if len(r.Values) != len(tt.values) {
+				t.Errorf("Expected values %v, got %v", tt.values, r.Values)
+			}
+			for field, want := range tt.values {
+				if r.Values[field] != want {
+					t.Errorf("Expected %s %s, got %q", field, want, r.Values[field])
+				}
+			}
+		})
+	}
+
+	// Not available, not decoded
+	if readings := Decode(Message{PGN: PGNEngineRapid, Data: []byte{0, 0xff, 0xff, 0xff, 0xff, 0x7f, 0xff, 0xff}}); readings != nil {
+		t.Errorf("Expected no reading without rpm, got %+v", readings)
+	}
+	if readings := Decode(Message{PGN: 130306, Data: make([]byte, 8)}); readings != nil {
+		t.Errorf("Expected no reading of wind, got %+v", readings)
+	}
+}
+
+func TestAssembler(t *testing.T) {
+	payload := make([]byte, 20)
+	for i := range payload {
+		payload[i] = byte(i + 1)
+	}
+	frames := [][]byte{
+		append([]byte{0x40, 20}, payload[0:6]...),
+		append([]byte{0x41}, payload[6:13]...),
+		append([]byte{0x42}, payload[13:20]...),
+	}
+	a := NewAssembler()
+	for i, frame := range frames {
+		m, ok := a.Add(Message{PGN: PGNEngineDynamic, Source: 3, Data: frame})
+		if i < len(frames)-1 {
+			if ok {
+				t.Fatalf("Expected frame %d to be held", i)
+			}
+			continue
+		}
+		if !ok || string(m.Data) != string(payload) {
+			t.Fatalf("Expected the payload, got %v %v", ok, m.Data)
+		}
+	}
+
+	// A missing frame drops the message
+	a.Add(Message{PGN: PGNEngineDynamic, Source: 3, Data: frames[0]})
+	if _, ok := a.Add(Message{PGN: PGNEngineDynamic, Source: 3, Data: frames[2]}); ok {
+		t.Error("Expected a message with a missing frame to be dropped")
+	}
+
+	// Single-frame PGNs and whole payloads pass as they are
+	if m, ok := a.Add(Message{PGN: PGNEngineRapid, Data: frames[0]}); !ok || len(m.Data) != 8 {
+		t.Errorf("Expected a single-frame message to pass, got %v", ok)
+	}
+	if m, ok := a.Add(Message{PGN: PGNGNSSPosition, Data: make([]byte, 43)}); !ok || len(m.Data) != 43 {
+		t.Errorf("Expected a reassembled message to pass, got %v", ok)
+	}
+}
+
+func TestParsePlain(t *testing.T) {
+	m, err := ParsePlain("2025-08-08-10:00:05.250,2,127488,17,255,8,00,c0,12,ff,ff,7f,ff,ff", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.PGN != PGNEngineRapid || m.Source != 17 || m.Priority != 2 || len(m.Data) != 8 || m.Data[1] != 0xc0 {
+		t.Errorf("Unexpected message %+v", m)
+	}
+	if want := at.Add(5250 * time.Millisecond); !m.TS.Equal(want) {
+		t.Errorf("Expected %s, got %s", want, m.TS)
+	}
+
+	m, err = ParsePlain("-,2,127488,17,255,3,00,c0,12", at)
+	if err != nil || !m.TS.Equal(at) {
+		t.Errorf("Expected a line without timestamp dated at %s, got %v %v", at, m.TS, err)
+	}
+
+	for _, line := range []string{"", "2,127488", "x,2,127488,17,255,3,00,c0", "x,2,127488,17,255,2,00,zz"} {
+		if _, err := ParsePlain(line, at); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
+
+// actisenseFrame frames a message as an NGT-1 sends it.
+func actisenseFrame(pgn uint32, source byte, data []byte) []byte {
+	payload := []byte{2, byte(pgn), byte(pgn >> 8), byte(pgn >> 16), 255, source, 0, 0, 0, 0, byte(len(data))}
+	payload = append(payload, data...)
+	body := append([]byte{n2kReceived, byte(len(payload))}, payload...)
+	var sum byte
+	for _, b := range body {
+		sum += b
+	}
+	body = append(body, -sum)
+	frame := []byte{dle, stx}
+	for _, b := range body {
+		if b == dle {
+			frame = append(frame, dle)
+		}
+		frame = append(frame, b)
+	}
+	return append(frame, dle, etx)
+}
+
+func TestActisenseReader(t *testing.T) {
+	stream := []byte{0x55, dle, stx, 0x01, dle, etx} // noise, a frame of another command
+	stream = append(stream, actisenseFrame(PGNEngineRapid, dle, []byte{0, 0x10, 0x10, 0xff, 0xff, 0x7f, 0xff, 0xff})...)
+	broken := actisenseFrame(PGNEngineRapid, 5, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	broken[len(broken)-3]++
+	stream = append(stream, broken...)
+	stream = append(stream, actisenseFrame(PGNFluidLevel, 6, []byte{0, 1, 2, 3, 4, 5, 6})...)
+
+	r := NewActisenseReader(bytes.NewReader(stream))
+	m, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.PGN != PGNEngineRapid || m.Source != dle || m.Data[1] != dle || m.Data[2] != dle {
+		t.Errorf("Unexpected message %+v", m)
+	}
+	if m, err = r.Next(); err != nil || m.PGN != PGNFluidLevel || m.Source != 6 || len(m.Data) != 7 {
+		t.Errorf("Expected the fluid level after the broken frame, got %+v %v", m, err)
+	}
+	if _, err = r.Next(); err == nil {
+		t.Error("Expected the end of the stream")
+	}
+}
+
+type fakeProcessor struct {
+	batches  [][]ingest.FeedReading
+	data     [][]byte
+	imo      string
+	filename string
+}
+
+func (p *fakeProcessor) ProcessFeed(ctx context.Context, data []byte, readings []ingest.FeedReading, filename, imo string, mode ingest.IngestMode, source string) (*models.IngestResponse, error) {
+	p.batches = append(p.batches, readings)
+	p.data = append(p.data, data)
+	p.imo, p.filename = imo, filename
+	return &models.IngestResponse{Status: "success"}, nil
+}
+
+func TestListener(t *testing.T) {
+	if _, err := NewListener(&fakeProcessor{}, Config{IMO: "9811000"}); err == nil {
+		t.Error("Expected an error without a UDP address or device")
+	}
+	if _, err := NewListener(&fakeProcessor{}, Config{UDPAddr: ":60002"}); err == nil {
+		t.Error("Expected an error without an IMO number")
+	}
+
+	processor := &fakeProcessor{}
+	l, err := NewListener(processor, Config{UDPAddr: ":0", IMO: "9811000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.AddDatagram([]byte("2025-08-08T10:00:01Z,2,127488,17,255,8,00,c0,12,ff,ff,7f,ff,ff\n"+
+		"2025-08-08T10:00:04Z,2,127488,17,255,8,00,00,19,ff,ff,7f,ff,ff\n"+
+		"not a message\n"+
+		"2025-08-08T10:00:12Z,2,127488,17,255,8,01,c0,12,ff,ff,7f,ff,ff\n"), at)
+	l.AddDatagram(actisenseFrame(PGNEngineRapid, 17, []byte{0, 0x40, 0x1f, 0xff, 0xff, 0x7f, 0xff, 0xff}), at.Add(25*time.Second))
+
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(processor.batches) != 1 {
+		t.Fatalf("Expected 1 batch, got %d", len(processor.batches))
+	}
+	readings := processor.batches[0]
+	// The last value of each interval, dated at its start
+	want := []struct {
+		unit string
+		ts   time.Time
+		rpm  string
+	}{
+		{"1", at, "1600"},
+		{"2", at.Add(10 * time.Second), "1200"},
+		{"1", at.Add(20 * time.Second), "2000"},
+	}
+	if len(readings) != len(want) {
+		t.Fatalf("Expected %d readings, got %+v", len(want), readings)
+	}
+	for i, w := range want {
+		r := readings[i]
+		if r.Stream != "engines" || r.Unit != w.unit || !r.TS.Equal(w.ts) || r.Values["rpm"] != w.rpm {
+			t.Errorf("Reading %d: expected engine %s at %s with rpm %s, got %+v", i, w.unit, w.ts, w.rpm, r)
+		}
+	}
+	if processor.imo != "9811000" || processor.filename != "nmea2000-20250808T100000Z.txt" {
+		t.Errorf("Unexpected upload %s of %s", processor.filename, processor.imo)
+	}
+
+	// Nothing gathered since
+	if err := l.Flush(context.Background()); err != nil || len(processor.batches) != 1 {
+		t.Errorf("Expected no batch without readings, got %d (%v)", len(processor.batches), err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package noon reconciles a vessel's noon reports with its telemetry: the
+// distance sailed along its positions since the previous report, the average
+// speed that makes, and the fuel its tanks held at the time of the report.
+// Values too far from what the crew reported are flagged as discrepancies.
+package noon
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"vessel-telemetry-api/internal/daily"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/store"
+)
+
+// Fields of a discrepancy.
+const (
+	FieldROB      = "rob_fuel_liters"
+	FieldDistance = "distance_nm"
+	FieldSpeed    = "avg_speed_knots"
+)
+
+// DefaultPeriod is the period of the first report of a vessel, or of one
+// more than MaxPeriod after the previous report.
+const DefaultPeriod = 24 * time.Hour
+
+// MaxPeriod is the longest time since the previous report taken as the
+// report's period.
+const MaxPeriod = 72 * time.Hour
+
+// Options are the tolerances of the reconciliation. A reported value is a
+// discrepancy when it is off by more than both the absolute and the relative
+// tolerance, so small values are not flagged for small differences.
+type Options struct {
+	DistanceNM, DistancePercent float64
+	SpeedKnots, SpeedPercent    float64
+	ROBLiters, ROBPercent       float64
+	// MaxGap is how far from the start and end of the period the positions
+	// must reach, and how old the tank readings at the report may be
+	MaxGap time.Duration
+}
+
+// DefaultOptions flag distances 5 nm and 10% off, speeds 1 knot and 10% off
+// and fuel 1 m3 and 5% off.
+var DefaultOptions = Options{
+	DistanceNM: 5, DistancePercent: 10,
+	SpeedKnots: 1, SpeedPercent: 10,
+	ROBLiters: 1000, ROBPercent: 5,
+	MaxGap: 3 * time.Hour,
+}
+
+// Inputs is the telemetry of one report's period.
+type Inputs struct {
+	// Fixes are the positions from MaxGap before the period to its end
+	Fixes []ports.Fix
+	// ROBLiters is the fuel in the tanks at the report, nil without tank
+	// readings
+	ROBLiters *float64
+}
+
+// Compare fills in the report's computed values and discrepancies from the
+// telemetry of its period, r.PeriodStart to r.ReportedAt.
+func Compare(r *models.NoonReport, in Inputs, opts Options) {
+	r.ComputedROBLiters, r.ComputedDistanceNM, r.ComputedAvgSpeedKnots = in.ROBLiters, nil, nil
+	r.Discrepancies = []models.NoonDiscrepancy{}
+
+	if fixes := periodFixes(in.Fixes, r.PeriodStart, r.ReportedAt, opts.MaxGap); fixes != nil {
+		distance := daily.Distance(fixes)
+		r.ComputedDistanceNM = &distance
+		if hours := r.ReportedAt.Sub(r.PeriodStart).Hours(); hours > 0 {
+			speed := distance / hours
+			r.ComputedAvgSpeedKnots = &speed
+		}
+	}
+
+	r.Discrepancies = appendDiscrepancy(r.Discrepancies, FieldROB, r.ROBFuelLiters, r.ComputedROBLiters, opts.ROBLiters, opts.ROBPercent)
+	r.Discrepancies = appendDiscrepancy(r.Discrepancies, FieldDistance, r.DistanceNM, r.ComputedDistanceNM, opts.DistanceNM, opts.DistancePercent)
+	r.Discrepancies = appendDiscrepancy(r.Discrepancies, FieldSpeed, r.AvgSpeedKnots, r.ComputedAvgSpeedKnots, opts.SpeedKnots, opts.SpeedPercent)
+	r.Flagged = len(r.Discrepancies) > 0
+}
+
+// periodFixes returns the fixes (ordered by time) of the track from start to
+// end: the last one at or before start and those after it up to end. Nil
+// unless the track reaches within maxGap of both start and end, as the
+// distance would fall short.
+func periodFixes(fixes []ports.Fix, start, end time.Time, maxGap time.Duration) []ports.Fix {
+	var period []ports.Fix
+	for _, f := range fixes {
+		switch {
+		case f.Timestamp.After(end):
+		case !f.Timestamp.After(start):
+			period = append(period[:0], f)
+		default:
+			period = append(period, f)
+		}
+	}
+	if len(period) < 2 ||
+		math.Abs(period[0].Timestamp.Sub(start).Hours()) > maxGap.Hours() ||
+		end.Sub(period[len(period)-1].Timestamp) > maxGap {
+		return nil
+	}
+	return period
+}
+
+func appendDiscrepancy(list []models.NoonDiscrepancy, field string, reported, computed *float64, tolerance, percent float64) []models.NoonDiscrepancy {
+	if reported == nil || computed == nil {
+		return list
+	}
+	diff := math.Abs(*reported - *computed)
+	// Anything reported against nothing computed is all off
+	relative := 100.0
+	if *computed != 0 {
+		relative = diff / math.Abs(*computed) * 100
+	}
+	if diff <= tolerance || relative <= percent {
+		return list
+	}
+	return append(list, models.NoonDiscrepancy{Field: field, Reported: *reported, Computed: *computed, Percent: math.Round(relative*10) / 10})
+}
+
+// Period returns the start of the period of a report at reportedAt, given
+// the time of the vessel's previous report, if any.
+func Period(reportedAt time.Time, previous *time.Time) time.Time {
+	if previous == nil || reportedAt.Sub(*previous) > MaxPeriod {
+		return reportedAt.Add(-DefaultPeriod)
+	}
+	return *previous
+}
+
+// Reconcile reads the telemetry of the report's period, from the vessel's
+// previous report, and compares the report with it.
+func Reconcile(ctx context.Context, st store.Store, r *models.NoonReport, opts Options) error {
+	previous, err := st.PreviousNoonReport(ctx, r.VesselID, r.ReportedAt)
+	if err != nil {
+		return err
+	}
+	r.PeriodStart = Period(r.ReportedAt, previous)
+
+	var in Inputs
+	from := r.PeriodStart.Add(-opts.MaxGap)
+	if in.Fixes, err = st.Positions(ctx, r.VesselID, &from, &r.ReportedAt); err != nil {
+		return err
+	}
+	if in.ROBLiters, err = st.FuelOnBoard(ctx, r.VesselID, r.ReportedAt, opts.MaxGap); err != nil {
+		return err
+	}
+	Compare(r, in, opts)
+	r.ReconciledAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+// ReconcileFrom reconciles the vessel's reports from the given time on, or
+// all of them, e.g. after reports or telemetry of that time were written,
+// and saves the results. It returns the reports, oldest first.
+func ReconcileFrom(ctx context.Context, st store.Store, vesselID int64, from *time.Time, opts Options) ([]models.NoonReport, error) {
+	reports, err := st.NoonReports(ctx, store.NoonReportFilter{VesselID: vesselID, From: from})
+	if err != nil {
+		return nil, err
+	}
+	for i := range reports {
+		if err := Reconcile(ctx, st, &reports[i], opts); err != nil {
+			return nil, err
+		}
+		if err := st.SetNoonReconciliation(ctx, reports[i]); err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
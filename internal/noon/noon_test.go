@@ -0,0 +1,74 @@
+package noon
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+)
+
+func TestCompare(t *testing.T) {
+	start := time.Date(2025, 8, 10, 12, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	value := func(v float64) *float64 { return &v }
+	// 1 degree of longitude along the equator is about 60 nm
+	fix := func(hours, lon float64) ports.Fix {
+		return ports.Fix{Timestamp: start.Add(time.Duration(hours * float64(time.Hour))), Longitude: lon}
+	}
+
+	tests := []struct {
+		name     string
+		fixes    []ports.Fix
+		reported *float64
+		want     []string
+	}{
+		{"within tolerance", []ports.Fix{fix(-1, 0), fix(12, 2), fix(24, 4)}, value(245), nil},
+		{"under-reported", []ports.Fix{fix(0, 0), fix(24, 4)}, value(200), []string{FieldDistance, FieldSpeed}},
+		{"small values", []ports.Fix{fix(0, 0), fix(24, 0.05)}, value(1), nil},
+		{"track ends early", []ports.Fix{fix(0, 0), fix(12, 2)}, value(200), nil},
+		{"track starts late", []ports.Fix{fix(4, 0), fix(24, 4)}, value(200), nil},
+		{"not reported", []ports.Fix{fix(0, 0), fix(24, 4)}, nil, nil},
+	}
+	for _, tt := range tests {
+		r := models.NoonReport{ReportedAt: end, PeriodStart: start, DistanceNM: tt.reported}
+		if tt.reported != nil {
+			r.AvgSpeedKnots = value(*tt.reported / 24)
+		}
+		Compare(&r, Inputs{Fixes: tt.fixes}, DefaultOptions)
+		var got []string
+		for _, d := range r.Discrepancies {
+			got = append(got, d.Field)
+		}
+		if len(got) != len(tt.want) || r.Flagged != (len(tt.want) > 0) {
+			t.Errorf("%s: expected %v, got %+v", tt.name, tt.want, r.Discrepancies)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+	}
+
+	r := models.NoonReport{ReportedAt: end, PeriodStart: start, ROBFuelLiters: value(90000)}
+	Compare(&r, Inputs{ROBLiters: value(100000)}, DefaultOptions)
+	if len(r.Discrepancies) != 1 || r.Discrepancies[0].Percent != 10 || r.ComputedDistanceNM != nil {
+		t.Errorf("Unexpected fuel reconciliation %+v", r)
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	at := time.Date(2025, 8, 11, 12, 0, 0, 0, time.UTC)
+	previous := at.Add(-25 * time.Hour)
+	if got := Period(at, &previous); !got.Equal(previous) {
+		t.Errorf("Expected the previous report, got %v", got)
+	}
+	stale := at.Add(-MaxPeriod - time.Hour)
+	if got := Period(at, &stale); !got.Equal(at.Add(-DefaultPeriod)) {
+		t.Errorf("Expected a day for a stale previous report, got %v", got)
+	}
+	if got := Period(at, nil); !got.Equal(at.Add(-DefaultPeriod)) {
+		t.Errorf("Expected a day for the first report, got %v", got)
+	}
+}
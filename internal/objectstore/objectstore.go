@@ -0,0 +1,96 @@
+// Package objectstore keeps binary objects, such as camera snapshots, out of
+// the database. Objects are addressed by slash-separated keys. Dir keeps them
+// in a local directory; a remote backend (S3) only has to implement Store.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for a key without an object.
+var ErrNotFound = errors.New("object not found")
+
+// Store puts and gets whole objects by key.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// ValidKey reports whether key is made of non-empty segments of letters,
+// digits, '.', '-' and '_', none of them "." or "..".
+func ValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, r := range segment {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Dir stores objects as files below a root directory.
+type Dir struct {
+	root string
+}
+
+// NewDir returns a store keeping objects below root, which is created on
+// the first Put.
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+func (d *Dir) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", errors.New("invalid object key " + key)
+	}
+	return filepath.Join(d.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the object, replacing any under the same key. Readers never see
+// a partly written object.
+func (d *Dir) Put(ctx context.Context, key string, data []byte) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get reads the object, or returns ErrNotFound.
+func (d *Dir) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
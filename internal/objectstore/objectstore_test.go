@@ -0,0 +1,45 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"snapshots/1/CAM-01/20250808T100000Z.jpg": true,
+		"a":                  true,
+		"":                   false,
+		"/etc/passwd":        false,
+		"snapshots/../db":    false,
+		"snapshots//x":       false,
+		"snapshots/cam 1/x":  false,
+		`snapshots\..\x.jpg`: false,
+	} {
+		if got := ValidKey(key); got != want {
+			t.Errorf("ValidKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	ctx := context.Background()
+	d := NewDir(t.TempDir())
+
+	if _, err := d.Get(ctx, "snapshots/1/a.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := d.Put(ctx, "snapshots/1/a.jpg", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Put(ctx, "snapshots/1/a.jpg", []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := d.Get(ctx, "snapshots/1/a.jpg"); err != nil || string(data) != "two" {
+		t.Errorf("Expected the replaced object, got %q, %v", data, err)
+	}
+	if err := d.Put(ctx, "../outside", []byte("x")); err == nil {
+		t.Error("Expected an invalid key to be refused")
+	}
+}
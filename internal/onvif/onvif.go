@@ -0,0 +1,265 @@
+// Package onvif polls the cameras registered for a vessel over ONVIF for
+// their state and recording status, ingests what they report as CCTV
+// readings and raises an alert when one stops responding.
+//
+// Only what polling needs is spoken: SOAP 1.2 calls of the device and
+// recording services, authenticated with a WS-Security UsernameToken
+// digest dated by the camera's clock.
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Namespaces of the services called.
+const (
+	NSDevice    = "http://www.onvif.org/ver10/device/wsdl"
+	NSRecording = "http://www.onvif.org/ver10/recording/wsdl"
+)
+
+// DevicePath is the usual path of the device service, for endpoints given
+// as a bare host.
+const DevicePath = "/onvif/device_service"
+
+// maxResponse is the largest response read.
+const maxResponse = 1 << 20
+
+// FaultError is a SOAP fault a camera answered a call with, e.g.
+// ter:NotAuthorized.
+type FaultError struct {
+	Code, Subcode, Reason string
+}
+
+func (e *FaultError) Error() string {
+	code := e.Code
+	if e.Subcode != "" {
+		code = e.Subcode
+	}
+	if e.Reason != "" {
+		return fmt.Sprintf("onvif fault %s: %s", code, e.Reason)
+	}
+	return "onvif fault " + code
+}
+
+// HTTPError is an HTTP error status a camera answered a call with, without
+// a SOAP fault, e.g. 401 from cameras that want HTTP digest authentication.
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("onvif: HTTP %d", e.StatusCode)
+}
+
+// Answered reports whether err came from the camera, rather than from not
+// reaching it.
+func Answered(err error) bool {
+	var fault *FaultError
+	var status *HTTPError
+	return err == nil || errors.As(err, &fault) || errors.As(err, &status)
+}
+
+// DeviceInformation is what GetDeviceInformation returns.
+type DeviceInformation struct {
+	Manufacturer    string `xml:"Manufacturer"`
+	Model           string `xml:"Model"`
+	FirmwareVersion string `xml:"FirmwareVersion"`
+	SerialNumber    string `xml:"SerialNumber"`
+	HardwareID      string `xml:"HardwareId"`
+}
+
+// Client calls the services of one camera. It is not safe for concurrent
+// use.
+type Client struct {
+	endpoint           string
+	username, password string
+	http               *http.Client
+	// offset is the camera's clock minus ours, which tokens are dated by
+	offset time.Duration
+}
+
+// NewClient creates a client of the device service at endpoint, e.g.
+// http://10.0.20.7/onvif/device_service. Calls are not authenticated
+// without a username.
+func NewClient(endpoint, username, password string, client *http.Client) *Client {
+	return &Client{endpoint: endpoint, username: username, password: password, http: client}
+}
+
+// SystemDateAndTime returns the camera's clock, which later calls are
+// dated by. It needs no authentication, so it tells whether the camera
+// answers at all.
+func (c *Client) SystemDateAndTime(ctx context.Context) (time.Time, error) {
+	var resp struct {
+		UTC struct {
+			Date struct {
+				Year  int `xml:"Year"`
+				Month int `xml:"Month"`
+				Day   int `xml:"Day"`
+			} `xml:"Date"`
+			Time struct {
+				Hour   int `xml:"Hour"`
+				Minute int `xml:"Minute"`
+				Second int `xml:"Second"`
+			} `xml:"Time"`
+		} `xml:"SystemDateAndTime>UTCDateTime"`
+	}
+	sent := time.Now()
+	if err := c.call(ctx, c.endpoint, `<GetSystemDateAndTime xmlns="`+NSDevice+`"/>`, false, &resp); err != nil {
+		return time.Time{}, err
+	}
+	d, t := resp.UTC.Date, resp.UTC.Time
+	if d.Year == 0 {
+		// Cameras that only report local time
+		c.offset = 0
+		return sent.UTC(), nil
+	}
+	at := time.Date(d.Year, time.Month(d.Month), d.Day, t.Hour, t.Minute, t.Second, 0, time.UTC)
+	c.offset = at.Sub(sent)
+	return at, nil
+}
+
+// DeviceInformation returns the camera's maker, model and firmware.
+func (c *Client) DeviceInformation(ctx context.Context) (*DeviceInformation, error) {
+	var info DeviceInformation
+	if err := c.call(ctx, c.endpoint, `<GetDeviceInformation xmlns="`+NSDevice+`"/>`, true, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ServiceAddress returns the address of the camera's service of namespace,
+// "" if it has none.
+func (c *Client) ServiceAddress(ctx context.Context, namespace string) (string, error) {
+	var resp struct {
+		Services []struct {
+			Namespace string `xml:"Namespace"`
+			XAddr     string `xml:"XAddr"`
+		} `xml:"Service"`
+	}
+	body := `<GetServices xmlns="` + NSDevice + `"><IncludeCapability>false</IncludeCapability></GetServices>`
+	if err := c.call(ctx, c.endpoint, body, true, &resp); err != nil {
+		return "", err
+	}
+	for _, s := range resp.Services {
+		if strings.TrimSpace(s.Namespace) == namespace {
+			return strings.TrimSpace(s.XAddr), nil
+		}
+	}
+	return "", nil
+}
+
+// RecordingJobStates returns the state of each recording job of the
+// recording service at address, by job token: Idle, Active,
+// PartiallyActive or Error.
+func (c *Client) RecordingJobStates(ctx context.Context, address string) (map[string]string, error) {
+	var jobs struct {
+		Items []struct {
+			Token string `xml:"JobToken"`
+		} `xml:"JobItem"`
+	}
+	if err := c.call(ctx, address, `<GetRecordingJobs xmlns="`+NSRecording+`"/>`, true, &jobs); err != nil {
+		return nil, err
+	}
+	states := make(map[string]string, len(jobs.Items))
+	for _, job := range jobs.Items {
+		var resp struct {
+			State string `xml:"State>State"`
+		}
+		var token bytes.Buffer
+		xml.EscapeText(&token, []byte(job.Token))
+		body := `<GetRecordingJobState xmlns="` + NSRecording + `"><JobToken>` + token.String() + `</JobToken></GetRecordingJobState>`
+		if err := c.call(ctx, address, body, true, &resp); err != nil {
+			return nil, err
+		}
+		states[job.Token] = strings.TrimSpace(resp.State)
+	}
+	return states, nil
+}
+
+// call posts a SOAP request of body to address and decodes the element of
+// the response body into out.
+func (c *Client) call(ctx context.Context, address, body string, auth bool, out interface{}) error {
+	var envelope bytes.Buffer
+	envelope.WriteString(`<?xml version="1.0" encoding="UTF-8"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">`)
+	if auth && c.username != "" {
+		envelope.WriteString("<s:Header>")
+		envelope.WriteString(c.securityHeader(time.Now().Add(c.offset)))
+		envelope.WriteString("</s:Header>")
+	}
+	envelope.WriteString("<s:Body>" + body + "</s:Body></s:Envelope>")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", address, &envelope)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return err
+	}
+
+	var env struct {
+		Body struct {
+			Fault *struct {
+				Code    string `xml:"Code>Value"`
+				Subcode string `xml:"Code>Subcode>Value"`
+				Reason  string `xml:"Reason>Text"`
+			} `xml:"Fault"`
+			Content []byte `xml:",innerxml"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &env); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &HTTPError{StatusCode: resp.StatusCode}
+		}
+		return fmt.Errorf("onvif: invalid response: %w", err)
+	}
+	if f := env.Body.Fault; f != nil {
+		return &FaultError{Code: strings.TrimSpace(f.Code), Subcode: strings.TrimSpace(f.Subcode), Reason: strings.TrimSpace(f.Reason)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{StatusCode: resp.StatusCode}
+	}
+	if err := xml.Unmarshal(env.Body.Content, out); err != nil {
+		return fmt.Errorf("onvif: invalid response: %w", err)
+	}
+	return nil
+}
+
+// securityHeader returns a WS-Security UsernameToken created at: the
+// password digest is base64(SHA-1(nonce + created + password)).
+func (c *Client) securityHeader(at time.Time) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	created := at.UTC().Format("2006-01-02T15:04:05.000Z")
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(c.password))
+	var username bytes.Buffer
+	xml.EscapeText(&username, []byte(c.username))
+	return `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">` +
+		`<UsernameToken><Username>` + username.String() + `</Username>` +
+		`<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">` +
+		base64.StdEncoding.EncodeToString(h.Sum(nil)) + `</Password>` +
+		`<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">` +
+		base64.StdEncoding.EncodeToString(nonce) + `</Nonce>` +
+		`<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">` + created + `</Created>` +
+		`</UsernameToken></Security>`
+}
@@ -0,0 +1,255 @@
+package onvif
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// testCamera answers the calls polling makes as a camera of user admin,
+// password secret, whose recording job is in state.
+type testCamera struct {
+	server    *httptest.Server
+	state     string
+	recording bool
+}
+
+func newTestCamera(t *testing.T, recording bool, state string) *testCamera {
+	t.Helper()
+	c := &testCamera{state: state, recording: recording}
+	c.server = httptest.NewServer(http.HandlerFunc(c.serve))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+func (c *testCamera) endpoint() string { return c.server.URL + DevicePath }
+
+func (c *testCamera) serve(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	var env struct {
+		Token struct {
+			Username string `xml:"Username"`
+			Password string `xml:"Password"`
+			Nonce    string `xml:"Nonce"`
+			Created  string `xml:"Created"`
+		} `xml:"Header>Security>UsernameToken"`
+		Body struct {
+			Call struct {
+				XMLName xml.Name
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &env); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	call := env.Body.Call.XMLName.Local
+	if call != "GetSystemDateAndTime" {
+		nonce, _ := base64.StdEncoding.DecodeString(env.Token.Nonce)
+		h := sha1.New()
+		h.Write(nonce)
+		h.Write([]byte(env.Token.Created))
+		h.Write([]byte("secret"))
+		if env.Token.Username != "admin" || env.Token.Password != base64.StdEncoding.EncodeToString(h.Sum(nil)) {
+			w.WriteHeader(400)
+			io.WriteString(w, envelope(`<s:Fault><s:Code><s:Value>s:Sender</s:Value><s:Subcode><s:Value>ter:NotAuthorized</s:Value></s:Subcode></s:Code><s:Reason><s:Text xml:lang="en">Sender not authorized</s:Text></s:Reason></s:Fault>`))
+			return
+		}
+	}
+
+	var body string
+	switch call {
+	case "GetSystemDateAndTime":
+		now := time.Now().UTC()
+		body = `<tds:GetSystemDateAndTimeResponse xmlns:tds="` + NSDevice + `" xmlns:tt="http://www.onvif.org/ver10/schema"><tds:SystemDateAndTime>` +
+			`<tt:DateTimeType>NTP</tt:DateTimeType><tt:UTCDateTime><tt:Time><tt:Hour>` + strconv.Itoa(now.Hour()) + `</tt:Hour><tt:Minute>` + strconv.Itoa(now.Minute()) +
+			`</tt:Minute><tt:Second>` + strconv.Itoa(now.Second()) + `</tt:Second></tt:Time><tt:Date><tt:Year>` + strconv.Itoa(now.Year()) + `</tt:Year><tt:Month>` +
+			strconv.Itoa(int(now.Month())) + `</tt:Month><tt:Day>` + strconv.Itoa(now.Day()) + `</tt:Day></tt:Date></tt:UTCDateTime></tds:SystemDateAndTime></tds:GetSystemDateAndTimeResponse>`
+	case "GetDeviceInformation":
+		body = `<tds:GetDeviceInformationResponse xmlns:tds="` + NSDevice + `"><tds:Manufacturer>Axis</tds:Manufacturer><tds:Model>P3245</tds:Model>` +
+			`<tds:FirmwareVersion>10.12.1</tds:FirmwareVersion><tds:SerialNumber>ACCC8E000001</tds:SerialNumber><tds:HardwareId>7A1</tds:HardwareId></tds:GetDeviceInformationResponse>`
+	case "GetServices":
+		body = `<tds:GetServicesResponse xmlns:tds="` + NSDevice + `"><tds:Service><tds:Namespace>` + NSDevice + `</tds:Namespace><tds:XAddr>` + c.endpoint() + `</tds:XAddr></tds:Service>`
+		if c.recording {
+			body += `<tds:Service><tds:Namespace>` + NSRecording + `</tds:Namespace><tds:XAddr>` + c.server.URL + `/onvif/recording_service</tds:XAddr></tds:Service>`
+		}
+		body += `</tds:GetServicesResponse>`
+	case "GetRecordingJobs":
+		body = `<trc:GetRecordingJobsResponse xmlns:trc="` + NSRecording + `"><trc:JobItem><trc:JobToken>Job&amp;1</trc:JobToken></trc:JobItem></trc:GetRecordingJobsResponse>`
+	case "GetRecordingJobState":
+		body = `<trc:GetRecordingJobStateResponse xmlns:trc="` + NSRecording + `" xmlns:tt="http://www.onvif.org/ver10/schema"><trc:State><tt:RecordingToken>Rec1</tt:RecordingToken>` +
+			`<tt:State>` + c.state + `</tt:State></trc:State></trc:GetRecordingJobStateResponse>`
+	default:
+		http.Error(w, "unknown call "+call, 400)
+		return
+	}
+	io.WriteString(w, envelope(body))
+}
+
+func envelope(body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>` + body + `</s:Body></s:Envelope>`
+}
+
+func TestClient(t *testing.T) {
+	cam := newTestCamera(t, true, "Active")
+	client := NewClient(cam.endpoint(), "admin", "secret", &http.Client{Timeout: time.Second})
+	ctx := context.Background()
+
+	at, err := client.SystemDateAndTime(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(at); d < -2*time.Second || d > 2*time.Second {
+		t.Errorf("Unexpected camera clock %v", at)
+	}
+	info, err := client.DeviceInformation(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Manufacturer != "Axis" || info.Model != "P3245" || info.FirmwareVersion != "10.12.1" {
+		t.Errorf("Unexpected device information %+v", info)
+	}
+	address, err := client.ServiceAddress(ctx, NSRecording)
+	if err != nil || address != cam.server.URL+"/onvif/recording_service" {
+		t.Fatalf("Unexpected recording service %q, %v", address, err)
+	}
+	states, err := client.RecordingJobStates(ctx, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states["Job&1"] != "Active" {
+		t.Errorf("Unexpected job states %v", states)
+	}
+
+	wrong := NewClient(cam.endpoint(), "admin", "guess", &http.Client{Timeout: time.Second})
+	_, err = wrong.DeviceInformation(ctx)
+	var fault *FaultError
+	if !errors.As(err, &fault) || fault.Subcode != "ter:NotAuthorized" || !Answered(err) {
+		t.Errorf("Expected a NotAuthorized fault, got %v", err)
+	}
+
+	unreachable := NewClient("http://127.0.0.1:1"+DevicePath, "", "", &http.Client{Timeout: 100 * time.Millisecond})
+	if _, err := unreachable.SystemDateAndTime(ctx); err == nil || Answered(err) {
+		t.Errorf("Expected an unreachable camera, got %v", err)
+	}
+}
+
+type fakeStore struct {
+	cameras []models.ONVIFCamera
+	polls   map[int64]models.ONVIFPoll
+	alerts  []models.CameraAlert
+}
+
+func (s *fakeStore) ONVIFCameras(ctx context.Context, vesselID int64) ([]models.ONVIFCamera, error) {
+	return s.cameras, nil
+}
+
+func (s *fakeStore) RecordONVIFPoll(ctx context.Context, id int64, poll models.ONVIFPoll) error {
+	s.polls[id] = poll
+	return nil
+}
+
+func (s *fakeStore) RaiseCameraAlert(ctx context.Context, a models.CameraAlert) (bool, error) {
+	for _, open := range s.alerts {
+		if open.VesselID == a.VesselID && open.CamID == a.CamID && open.ResolvedAt == nil {
+			return false, nil
+		}
+	}
+	s.alerts = append(s.alerts, a)
+	return true, nil
+}
+
+func (s *fakeStore) ResolveCameraAlerts(ctx context.Context, vesselID int64, camID string, at time.Time) (int64, error) {
+	var n int64
+	for i, a := range s.alerts {
+		if a.VesselID == vesselID && a.CamID == camID && a.ResolvedAt == nil {
+			s.alerts[i].ResolvedAt = &at
+			n++
+		}
+	}
+	return n, nil
+}
+
+type fakeProcessor struct {
+	readings map[int64][]ingest.FeedReading
+}
+
+func (p *fakeProcessor) ProcessVesselFeed(ctx context.Context, data []byte, readings []ingest.FeedReading, filename string, vesselID int64, mode ingest.IngestMode, source string) (*models.IngestResponse, error) {
+	p.readings[vesselID] = readings
+	return &models.IngestResponse{Status: "success"}, nil
+}
+
+func TestPollOnce(t *testing.T) {
+	recording := newTestCamera(t, true, "Active")
+	idle := newTestCamera(t, true, "Idle")
+	plain := newTestCamera(t, false, "")
+	admin := "admin"
+	long := time.Now().UTC().Add(-time.Hour)
+	st := &fakeStore{polls: map[int64]models.ONVIFPoll{}, cameras: []models.ONVIFCamera{
+		{ID: 1, VesselID: 1, CamID: "CAM-01", Endpoint: recording.endpoint(), Username: &admin, Password: "secret"},
+		{ID: 2, VesselID: 1, CamID: "CAM-02", Endpoint: idle.endpoint(), Username: &admin, Password: "secret"},
+		{ID: 3, VesselID: 1, CamID: "CAM-03", Endpoint: plain.endpoint(), Username: &admin, Password: "wrong"},
+		// Unreachable, for long enough to be alerted on
+		{ID: 4, VesselID: 2, CamID: "CAM-04", Endpoint: "http://127.0.0.1:1" + DevicePath, UpdatedAt: long},
+		// Unreachable, but only just added
+		{ID: 5, VesselID: 2, CamID: "CAM-05", Endpoint: "http://127.0.0.1:1" + DevicePath, UpdatedAt: time.Now().UTC()},
+	}}
+	processor := &fakeProcessor{readings: map[int64][]ingest.FeedReading{}}
+	p := NewPoller(st, processor, outbound.Policy{Timeout: 200 * time.Millisecond}, 5*time.Minute)
+	if err := p.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	readings := processor.readings[1]
+	if len(readings) != 3 {
+		t.Fatalf("Expected 3 readings of vessel 1, got %+v", processor.readings)
+	}
+	for i, status := range []string{StatusRecording, StatusNotRecording, StatusOnline} {
+		if r := readings[i]; r.Stream != "cctv" || r.Values["status"] != status || r.Values["uptime_percent"] != "100.0" {
+			t.Errorf("Expected reading %d %s, got %+v", i, status, r)
+		}
+	}
+	if poll := st.polls[1]; poll.Info == nil || poll.Info.Model != "P3245" || poll.Error != nil || !poll.Answered {
+		t.Errorf("Unexpected poll of camera 1 %+v", poll)
+	}
+	if poll := st.polls[3]; poll.Error == nil || !strings.Contains(*poll.Error, "NotAuthorized") || !poll.Answered {
+		t.Errorf("Expected camera 3 to answer unauthorized, got %+v", poll)
+	}
+	if r := processor.readings[2]; len(r) != 2 || r[0].Values["status"] != StatusOffline || r[0].Values["uptime_percent"] != "0.0" {
+		t.Errorf("Unexpected readings of vessel 2 %+v", r)
+	}
+	if len(st.alerts) != 1 || st.alerts[0].CamID != "CAM-04" || st.alerts[0].VesselID != 2 {
+		t.Fatalf("Expected an alert for CAM-04, got %+v", st.alerts)
+	}
+
+	// Still down: no second alert. Then it answers.
+	if err := p.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.alerts) != 1 {
+		t.Errorf("Expected the alert not raised again, got %+v", st.alerts)
+	}
+	st.cameras[3].Endpoint = plain.endpoint()
+	if err := p.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if st.alerts[0].ResolvedAt == nil {
+		t.Error("Expected the alert resolved once the camera answers")
+	}
+	if r := processor.readings[2]; r[0].Values["status"] != StatusOnline || r[0].Values["uptime_percent"] != "33.3" {
+		t.Errorf("Expected CAM-04 online a third of the time, got %+v", r[0])
+	}
+}
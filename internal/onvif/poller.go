@@ -0,0 +1,302 @@
+package onvif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// Statuses reported. Cameras without a recording service, which record on
+// an NVR if at all, are ONLINE when they answer.
+const (
+	StatusRecording      = "RECORDING"
+	StatusNotRecording   = "NOT_RECORDING"
+	StatusRecordingError = "RECORDING_ERROR"
+	StatusOnline         = "ONLINE"
+	StatusOffline        = "OFFLINE"
+)
+
+// DefaultAlertAfter is how long a camera may not answer before an alert
+// is raised.
+const DefaultAlertAfter = 5 * time.Minute
+
+// AvailabilityWindow is the span of polls uptime is the share answered
+// of. It only covers polls since the process started.
+const AvailabilityWindow = 24 * time.Hour
+
+// parallel is how many cameras are polled at once, so that a few
+// unreachable ones do not hold up the rest until their timeouts.
+const parallel = 8
+
+// Store holds the cameras polled and their alerts.
+type Store interface {
+	ONVIFCameras(ctx context.Context, vesselID int64) ([]models.ONVIFCamera, error)
+	RecordONVIFPoll(ctx context.Context, id int64, poll models.ONVIFPoll) error
+	RaiseCameraAlert(ctx context.Context, a models.CameraAlert) (bool, error)
+	ResolveCameraAlerts(ctx context.Context, vesselID int64, camID string, at time.Time) (int64, error)
+}
+
+// Processor ingests the readings of a poll.
+type Processor interface {
+	ProcessVesselFeed(ctx context.Context, data []byte, readings []ingest.FeedReading, filename string, vesselID int64, mode ingest.IngestMode, source string) (*models.IngestResponse, error)
+}
+
+// Poller polls every vessel's cameras, ingests their status and raises
+// alerts for those that stop responding.
+type Poller struct {
+	store      Store
+	processor  Processor
+	client     *http.Client
+	out        *outbound.Integration
+	alertAfter time.Duration
+
+	mu sync.Mutex
+	// polls holds whether each camera answered its polls of the window,
+	// by camera ID
+	polls map[int64][]outcome
+}
+
+type outcome struct {
+	at       time.Time
+	answered bool
+}
+
+// NewPoller creates a poller whose calls to cameras are guarded by policy,
+// its timeout bounding each, raising an alert for a camera that has not
+// answered for alertAfter (DefaultAlertAfter if 0).
+func NewPoller(st Store, processor Processor, policy outbound.Policy, alertAfter time.Duration) *Poller {
+	if alertAfter <= 0 {
+		alertAfter = DefaultAlertAfter
+	}
+	return &Poller{
+		store: st, processor: processor, alertAfter: alertAfter,
+		client: &http.Client{Timeout: policy.Timeout},
+		out:    outbound.New("onvif", policy),
+		polls:  make(map[int64][]outcome),
+	}
+}
+
+// PollOnce polls the cameras of every vessel and ingests the status of each
+// vessel's as CCTV readings, one upload dated at the poll. A camera that
+// has not answered for the alert delay gets an alert, resolved by the
+// first poll it answers.
+func (p *Poller) PollOnce(ctx context.Context) error {
+	cameras, err := p.store.ONVIFCameras(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("onvif: reading cameras: %w", err)
+	}
+	at := time.Now().UTC().Truncate(time.Second)
+	polls := make([]models.ONVIFPoll, len(cameras))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallel)
+	for i := range cameras {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			polls[i] = p.pollCamera(ctx, cameras[i])
+			polls[i].At = at
+		}(i)
+	}
+	wg.Wait()
+	p.forget(cameras)
+
+	readings := make(map[int64][]ingest.FeedReading)
+	var vessels []int64
+	for i, cam := range cameras {
+		poll := polls[i]
+		if err := p.store.RecordONVIFPoll(ctx, cam.ID, poll); err != nil {
+			log.Printf("onvif: recording poll of camera %d: %v", cam.ID, err)
+		}
+		p.alert(ctx, cam, poll)
+
+		if readings[cam.VesselID] == nil {
+			vessels = append(vessels, cam.VesselID)
+		}
+		readings[cam.VesselID] = append(readings[cam.VesselID], ingest.FeedReading{
+			Stream: "cctv", Unit: cam.CamID, TS: at,
+			Values: map[string]string{
+				"status":         poll.Status,
+				"uptime_percent": strconv.FormatFloat(p.availability(cam.ID, at, poll.Answered), 'f', 1, 64),
+			},
+		})
+	}
+
+	var errs []error
+	for _, vesselID := range vessels {
+		filename := fmt.Sprintf("onvif-%d-%s.txt", vesselID, at.Format("20060102T150405Z"))
+		response, err := p.processor.ProcessVesselFeed(ctx, ingest.FeedData(readings[vesselID]), readings[vesselID], filename, vesselID, ingest.ModeInsert, models.SourceSensor)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("onvif: vessel %d: %w", vesselID, err))
+			continue
+		}
+		for _, w := range response.Warnings {
+			log.Printf("onvif: %s: %s", filename, w)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pollCamera asks a camera for its clock, which tells whether it answers,
+// then for its device information and the state of its recording jobs.
+// The first error is noted; the status is still that of what answered.
+func (p *Poller) pollCamera(ctx context.Context, cam models.ONVIFCamera) models.ONVIFPoll {
+	username := ""
+	if cam.Username != nil {
+		username = *cam.Username
+	}
+	client := NewClient(cam.Endpoint, username, cam.Password, p.client)
+	poll := models.ONVIFPoll{Status: StatusOffline}
+	var firstErr error
+	note := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := p.call(ctx, func(ctx context.Context) error {
+		_, err := client.SystemDateAndTime(ctx)
+		return err
+	}); !Answered(err) {
+		note(err)
+	} else {
+		note(err)
+		poll.Answered, poll.Status = true, StatusOnline
+		var info *DeviceInformation
+		if err := p.call(ctx, func(ctx context.Context) (err error) {
+			info, err = client.DeviceInformation(ctx)
+			return err
+		}); err != nil {
+			note(err)
+		} else {
+			poll.Info = &models.ONVIFDeviceInfo{Manufacturer: info.Manufacturer, Model: info.Model, FirmwareVersion: info.FirmwareVersion}
+		}
+		var address string
+		if err := p.call(ctx, func(ctx context.Context) (err error) {
+			address, err = client.ServiceAddress(ctx, NSRecording)
+			return err
+		}); err != nil {
+			note(err)
+		} else if address != "" {
+			var states map[string]string
+			err := p.call(ctx, func(ctx context.Context) (err error) {
+				states, err = client.RecordingJobStates(ctx, address)
+				return err
+			})
+			if err != nil {
+				note(err)
+			} else {
+				poll.Status = recordingStatus(states)
+			}
+		}
+	}
+	if firstErr != nil {
+		msg := firstErr.Error()
+		poll.Error = &msg
+	}
+	return poll
+}
+
+// call makes one call to a camera through the breaker. An error the camera
+// answered with is not tried again, nor held against it.
+func (p *Poller) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	return p.out.Do(ctx, func(ctx context.Context) error {
+		err := fn(ctx)
+		if Answered(err) {
+			return outbound.Permanent(err)
+		}
+		return err
+	})
+}
+
+// recordingStatus sums up the states of a camera's recording jobs: any
+// job recording makes it RECORDING, else any failed RECORDING_ERROR.
+func recordingStatus(states map[string]string) string {
+	status := StatusNotRecording
+	for _, state := range states {
+		switch state {
+		case "Active", "PartiallyActive":
+			return StatusRecording
+		case "Error":
+			status = StatusRecordingError
+		}
+	}
+	return status
+}
+
+// alert raises an alert for a camera that has not answered since the alert
+// delay, counted from when it was added or changed if it never did, and
+// resolves its alerts once it answers.
+func (p *Poller) alert(ctx context.Context, cam models.ONVIFCamera, poll models.ONVIFPoll) {
+	if poll.Answered {
+		if n, err := p.store.ResolveCameraAlerts(ctx, cam.VesselID, cam.CamID, poll.At); err != nil {
+			log.Printf("onvif: resolving alerts of camera %d: %v", cam.ID, err)
+		} else if n > 0 {
+			log.Printf("onvif: camera %s of vessel %d responds again", cam.CamID, cam.VesselID)
+		}
+		return
+	}
+	since := cam.UpdatedAt
+	if cam.LastSeenAt != nil {
+		since = *cam.LastSeenAt
+	}
+	if poll.At.Sub(since) < p.alertAfter {
+		return
+	}
+	message := "no answer"
+	if poll.Error != nil {
+		message = *poll.Error
+	}
+	raised, err := p.store.RaiseCameraAlert(ctx, models.CameraAlert{
+		VesselID: cam.VesselID, CamID: cam.CamID, RaisedAt: poll.At, LastSeenAt: cam.LastSeenAt, Message: message,
+	})
+	if err != nil {
+		log.Printf("onvif: raising alert of camera %d: %v", cam.ID, err)
+	} else if raised {
+		log.Printf("onvif: camera %s of vessel %d stopped responding: %s", cam.CamID, cam.VesselID, message)
+	}
+}
+
+// availability adds a poll of a camera and returns the percentage of its
+// polls in the window up to at that it answered.
+func (p *Poller) availability(id int64, at time.Time, answered bool) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	polls := append(p.polls[id], outcome{at: at, answered: answered})
+	for len(polls) > 0 && !polls[0].at.After(at.Add(-AvailabilityWindow)) {
+		polls = polls[1:]
+	}
+	p.polls[id] = polls
+	n := 0
+	for _, o := range polls {
+		if o.answered {
+			n++
+		}
+	}
+	return 100 * float64(n) / float64(len(polls))
+}
+
+// forget drops the polls of cameras no longer polled.
+func (p *Poller) forget(cameras []models.ONVIFCamera) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	polled := make(map[int64]bool, len(cameras))
+	for _, cam := range cameras {
+		polled[cam.ID] = true
+	}
+	for id := range p.polls {
+		if !polled[id] {
+			delete(p.polls, id)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// Package outbound guards calls to external services (AIS and weather
+// providers, webhook targets...) with per-attempt timeouts, retries with
+// jittered backoff and a circuit breaker, so a hung or failing service cannot
+// stall the workers that call it.
+//
+// Every Integration registers itself by name; Statuses reports their breaker
+// state and call counters for the metrics endpoint.
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the service while its circuit
+// is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Policy configures one integration.
+type Policy struct {
+	Timeout          time.Duration // per attempt; 0 means no timeout
+	Retries          int           // attempts after the first for retryable errors
+	RetryBackoff     time.Duration // base delay, doubled per retry, with full jitter
+	FailureThreshold int           // consecutive failed calls that open the circuit; 0 disables it
+	OpenDuration     time.Duration // time the circuit stays open before a trial call
+}
+
+// Circuit states.
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// Status is a snapshot of an integration for metrics.
+type Status struct {
+	Name                string
+	State               string
+	ConsecutiveFailures int
+	Successes           int64
+	Failures            int64
+	Rejected            int64 // calls refused while the circuit was open
+	Retries             int64
+}
+
+// Integration is one external service.
+type Integration struct {
+	name   string
+	policy Policy
+
+	mu       sync.Mutex
+	state    string
+	failures int // consecutive
+	openedAt time.Time
+	trial    bool // a half-open trial call is in flight
+	counts   Status
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*Integration{}
+)
+
+// New creates an integration and registers it for Statuses, replacing any
+// earlier one with the same name.
+func New(name string, policy Policy) *Integration {
+	i := &Integration{name: name, policy: policy, state: StateClosed}
+	registryMu.Lock()
+	registry[name] = i
+	registryMu.Unlock()
+	return i
+}
+
+// Statuses returns every registered integration, ordered by name.
+func Statuses() []Status {
+	registryMu.Lock()
+	integrations := make([]*Integration, 0, len(registry))
+	for _, i := range registry {
+		integrations = append(integrations, i)
+	}
+	registryMu.Unlock()
+
+	statuses := make([]Status, len(integrations))
+	for n, i := range integrations {
+		statuses[n] = i.Status()
+	}
+	sort.Slice(statuses, func(a, b int) bool { return statuses[a].Name < statuses[b].Name })
+	return statuses
+}
+
+// Status returns the integration's current state and counters.
+func (i *Integration) Status() Status {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	s := i.counts
+	s.Name = i.name
+	s.State = i.currentState(time.Now())
+	s.ConsecutiveFailures = i.failures
+	return s
+}
+
+// currentState reports an open circuit whose open duration has passed as
+// half-open. Callers hold mu.
+func (i *Integration) currentState(now time.Time) string {
+	if i.state == StateOpen && now.Sub(i.openedAt) >= i.policy.OpenDuration {
+		return StateHalfOpen
+	}
+	return i.state
+}
+
+// allow reports whether a call may go ahead, and whether it is the half-open
+// trial call.
+func (i *Integration) allow() (ok, trial bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	switch i.currentState(time.Now()) {
+	case StateOpen:
+		i.counts.Rejected++
+		return false, false
+	case StateHalfOpen:
+		if i.trial {
+			i.counts.Rejected++
+			return false, false
+		}
+		i.state, i.trial = StateHalfOpen, true
+		return true, true
+	}
+	return true, false
+}
+
+func (i *Integration) record(err error, trial bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if trial {
+		i.trial = false
+	}
+
+	// Permanent errors (e.g. 404) mean the service answered
+	if err == nil || isPermanent(err) {
+		i.counts.Successes++
+		i.failures = 0
+		i.state = StateClosed
+		return
+	}
+
+	i.counts.Failures++
+	i.failures++
+	if trial || (i.policy.FailureThreshold > 0 && i.failures >= i.policy.FailureThreshold) {
+		i.state = StateOpen
+		i.openedAt = time.Now()
+	}
+}
+
+// Do calls fn with a per-attempt timeout, retrying retryable errors, unless
+// the circuit is open. Wrap errors that retrying cannot fix with Permanent.
+func (i *Integration) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	ok, trial := i.allow()
+	if !ok {
+		return fmt.Errorf("%s: %w", i.name, ErrCircuitOpen)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = i.attempt(ctx, fn)
+		if err == nil || isPermanent(err) || ctx.Err() != nil || attempt >= i.policy.Retries || trial {
+			break
+		}
+
+		i.mu.Lock()
+		i.counts.Retries++
+		i.mu.Unlock()
+
+		if sleepErr := sleep(ctx, backoff(i.policy.RetryBackoff, attempt)); sleepErr != nil {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		// Cancelled by the caller (e.g. shutdown); says nothing about the service
+		i.release(trial)
+		return err
+	}
+	i.record(err, trial)
+	return err
+}
+
+func (i *Integration) release(trial bool) {
+	if trial {
+		i.mu.Lock()
+		i.trial = false
+		i.mu.Unlock()
+	}
+}
+
+func (i *Integration) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if i.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.policy.Timeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+// backoff returns a random delay in [0, base*2^attempt] ("full jitter"), so
+// workers retrying the same service spread out.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	max := base << uint(attempt)
+	if max <= 0 || max > time.Minute {
+		max = time.Minute
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying. It does not count against
+// the circuit breaker either.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// Get fetches u and returns up to maxBody bytes of a 200 response. Network
+// errors, 5xx and 429 are retried; other statuses fail permanently. The
+// request carries the given headers.
+func (i *Integration) Get(ctx context.Context, client *http.Client, u string, header http.Header, maxBody int64) ([]byte, error) {
+	var body []byte
+	err := i.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return Permanent(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			err := fmt.Errorf("provider returned %s", resp.Status)
+			if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+				return err
+			}
+			return Permanent(err)
+		}
+
+		// Read inside the attempt so the timeout covers a stalled body too
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxBody))
+		return err
+	})
+	return body, err
+}
+
+// Post sends body to u and succeeds on any 2xx response. Like Get, network
+// errors, 5xx and 429 are retried and other statuses fail permanently.
+func (i *Integration) Post(ctx context.Context, client *http.Client, u string, header http.Header, body []byte) error {
+	_, err := i.PostRead(ctx, client, u, header, body, 64<<10)
+	return err
+}
+
+// PostRead is Post returning up to maxBody bytes of the response.
+func (i *Integration) PostRead(ctx context.Context, client *http.Client, u string, header http.Header, body []byte, maxBody int64) ([]byte, error) {
+	var response []byte
+	err := i.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+		if err != nil {
+			return Permanent(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		response, err = io.ReadAll(io.LimitReader(resp.Body, maxBody))
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err := fmt.Errorf("target returned %s", resp.Status)
+			if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+				return err
+			}
+			return Permanent(err)
+		}
+		return err
+	})
+	return response, err
+}
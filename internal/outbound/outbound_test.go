@@ -0,0 +1,206 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("down")
+
+func TestRetries(t *testing.T) {
+	i := New("test-retries", Policy{Retries: 2})
+
+	calls := 0
+	err := i.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errDown
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Expected success on the third attempt, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = i.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return Permanent(errDown)
+	})
+	if !errors.Is(err, errDown) || calls != 1 {
+		t.Errorf("Expected permanent errors not to be retried, got %v after %d calls", err, calls)
+	}
+
+	if s := i.Status(); s.Retries != 2 || s.Successes != 2 || s.Failures != 0 {
+		t.Errorf("Unexpected counters %+v", s)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	i := New("test-breaker", Policy{FailureThreshold: 2, OpenDuration: 50 * time.Millisecond})
+	fail := func(ctx context.Context) error { return errDown }
+	succeed := func(ctx context.Context) error { return nil }
+
+	i.Do(context.Background(), fail)
+	if s := i.Status(); s.State != StateClosed {
+		t.Fatalf("Expected closed after one failure, got %s", s.State)
+	}
+	i.Do(context.Background(), fail)
+	if s := i.Status(); s.State != StateOpen {
+		t.Fatalf("Expected open after two failures, got %s", s.State)
+	}
+
+	called := false
+	err := i.Do(context.Background(), func(ctx context.Context) error { called = true; return nil })
+	if !errors.Is(err, ErrCircuitOpen) || called {
+		t.Fatalf("Expected the call to be rejected, got %v (called %v)", err, called)
+	}
+
+	// After the open duration one trial call goes through; failing it reopens
+	time.Sleep(60 * time.Millisecond)
+	if s := i.Status(); s.State != StateHalfOpen {
+		t.Fatalf("Expected half-open, got %s", s.State)
+	}
+	i.Do(context.Background(), fail)
+	if s := i.Status(); s.State != StateOpen {
+		t.Fatalf("Expected a failed trial to reopen the circuit, got %s", s.State)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := i.Do(context.Background(), succeed); err != nil {
+		t.Fatalf("Expected the trial call to succeed, got %v", err)
+	}
+	if s := i.Status(); s.State != StateClosed || s.ConsecutiveFailures != 0 || s.Rejected != 1 {
+		t.Errorf("Expected closed circuit after a successful trial, got %+v", s)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	i := New("test-timeout", Policy{Timeout: 20 * time.Millisecond})
+	start := time.Now()
+	err := i.Do(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Errorf("Expected the attempt to time out, got %v after %s", err, time.Since(start))
+	}
+	if s := i.Status(); s.Failures != 1 {
+		t.Errorf("Expected a timeout to count as a failure, got %+v", s)
+	}
+}
+
+func TestCancelledCallsDoNotCount(t *testing.T) {
+	i := New("test-cancel", Policy{FailureThreshold: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	i.Do(ctx, func(ctx context.Context) error { return ctx.Err() })
+	if s := i.Status(); s.State != StateClosed || s.Failures != 0 {
+		t.Errorf("Expected a cancelled call not to open the circuit, got %+v", s)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 5; attempt++ {
+		max := 100 * time.Millisecond << uint(attempt)
+		if d := backoff(100*time.Millisecond, attempt); d < 0 || d > max {
+			t.Errorf("attempt %d: backoff %s outside [0, %s]", attempt, d, max)
+		}
+	}
+	if d := backoff(time.Second, 40); d > time.Minute {
+		t.Errorf("Expected backoff to be capped at a minute, got %s", d)
+	}
+}
+
+func TestGet(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if atomic.AddInt32(&hits, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(r.Header.Get("Authorization")))
+		case "/hang":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	i := New("test-get", Policy{Timeout: 50 * time.Millisecond, Retries: 1, FailureThreshold: 5})
+	header := http.Header{"Authorization": {"Bearer k"}}
+
+	body, err := i.Get(context.Background(), srv.Client(), srv.URL+"/flaky", header, 1024)
+	if err != nil || string(body) != "Bearer k" {
+		t.Errorf("Expected the retry to succeed with headers, got %q, %v", body, err)
+	}
+
+	if _, err := i.Get(context.Background(), srv.Client(), srv.URL+"/missing", nil, 1024); err == nil || !isPermanent(err) {
+		t.Errorf("Expected a permanent error for 404, got %v", err)
+	}
+
+	start := time.Now()
+	if _, err := i.Get(context.Background(), srv.Client(), srv.URL+"/hang", nil, 1024); err == nil {
+		t.Error("Expected a hung request to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 190*time.Millisecond {
+		t.Errorf("Expected the timeout to cut the hung request short, took %s", elapsed)
+	}
+}
+
+func TestPost(t *testing.T) {
+	var hits int32
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if atomic.AddInt32(&hits, 1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			got = r.Header.Get("Content-Type") + " " + string(body)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer srv.Close()
+
+	i := New("test-post", Policy{Retries: 1, FailureThreshold: 5})
+	header := http.Header{"Content-Type": {"application/json"}}
+
+	if err := i.Post(context.Background(), srv.Client(), srv.URL+"/flaky", header, []byte(`{}`)); err != nil {
+		t.Errorf("Expected the retry to succeed, got %v", err)
+	}
+	if got != "application/json {}" {
+		t.Errorf("Expected the body to be resent with headers, got %q", got)
+	}
+	if err := i.Post(context.Background(), srv.Client(), srv.URL+"/gone", nil, nil); err == nil || !isPermanent(err) {
+		t.Errorf("Expected a permanent error for 410, got %v", err)
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	New("test-status-b", Policy{})
+	New("test-status-a", Policy{})
+
+	var names []string
+	for _, s := range Statuses() {
+		names = append(names, s.Name)
+	}
+	for n := 1; n < len(names); n++ {
+		if names[n-1] > names[n] {
+			t.Fatalf("Expected statuses ordered by name, got %v", names)
+		}
+	}
+}
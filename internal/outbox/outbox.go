@@ -0,0 +1,212 @@
+// Package outbox delivers inserted readings to webhooks and reading sinks
+// from a transactional outbox.
+//
+// Triggers on every reading table log each insert in the outbox table in
+// the transaction of the insert, so no reading is committed without its
+// event. The dispatcher runs a goroutine per consumer that delivers the
+// events after the consumer's cursor in seq order, a batch at a time, and
+// moves the cursor once the batch is acknowledged. Cursors live in the
+// database, so delivery resumes where it stopped after a restart or a
+// failover: at least once, and in insert order per vessel, since a batch
+// that fails is sent again before anything newer.
+package outbox
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxBackoff bounds the wait before a consumer retries a failed batch.
+const maxBackoff = 5 * time.Minute
+
+// Source reads the outbox and keeps the cursors.
+type Source interface {
+	OutboxEvents(ctx context.Context, afterSeq int64, streams []string, limit int) ([]store.OutboxEvent, error)
+	OutboxHead(ctx context.Context) (int64, error)
+	OutboxCursor(ctx context.Context, consumer string) (int64, error)
+	SetOutboxCursor(ctx context.Context, consumer string, seq int64, at time.Time) error
+	PruneOutbox(ctx context.Context, consumers []string) (int64, error)
+}
+
+// Consumer is a destination of events.
+type Consumer struct {
+	// Name keys the cursor, e.g. webhook:<url> or kafka:<prefix>.
+	Name string
+	// Streams are the streams delivered; empty for all.
+	Streams []string
+	// Interval is how often new events are looked for.
+	Interval time.Duration
+	// Deliver returns once the destination has every event. Events whose
+	// reading has been deleted since have no Row.
+	Deliver func(ctx context.Context, events []store.OutboxEvent) error
+}
+
+// Status is how delivery to a consumer goes.
+type Status struct {
+	Consumer       string     `json:"consumer"`
+	Cursor         int64      `json:"cursor"`
+	LastDeliveryAt *time.Time `json:"last_delivery_at"`
+	LastError      string     `json:"last_error,omitempty"`
+	Failures       int        `json:"consecutive_failures"`
+}
+
+// Dispatcher delivers the outbox to its consumers.
+type Dispatcher struct {
+	source    Source
+	batch     int
+	consumers []Consumer
+
+	mu     sync.Mutex
+	status map[string]*Status
+}
+
+// New creates a dispatcher delivering batch events at a time.
+func New(source Source, batch int) *Dispatcher {
+	return &Dispatcher{source: source, batch: batch, status: map[string]*Status{}}
+}
+
+// Add adds a consumer; call it before Run.
+func (d *Dispatcher) Add(c Consumer) {
+	d.consumers = append(d.consumers, c)
+	d.status[c.Name] = &Status{Consumer: c.Name}
+}
+
+// Consumers returns the names of the consumers.
+func (d *Dispatcher) Consumers() []string {
+	names := make([]string, len(d.consumers))
+	for i, c := range d.consumers {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Run delivers to every consumer until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range d.consumers {
+		wg.Add(1)
+		go func(c Consumer) {
+			defer wg.Done()
+			d.run(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) run(ctx context.Context, c Consumer) {
+	wait := c.Interval
+	for {
+		if _, err := d.DispatchOnce(ctx, c); err != nil && ctx.Err() == nil {
+			log.Printf("outbox: %s: %v", c.Name, err)
+			// Back off, but retry the same batch: nothing newer goes first
+			if wait *= 2; wait > maxBackoff {
+				wait = maxBackoff
+			}
+		} else {
+			wait = c.Interval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// DispatchOnce delivers the events after the consumer's cursor, a batch at
+// a time, until it is caught up, and returns how many it delivered.
+func (d *Dispatcher) DispatchOnce(ctx context.Context, c Consumer) (int, error) {
+	delivered, err := d.dispatch(ctx, c)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := d.status[c.Name]
+	if status == nil {
+		status = &Status{Consumer: c.Name}
+		d.status[c.Name] = status
+	}
+	if err != nil {
+		status.LastError = err.Error()
+		status.Failures++
+	} else {
+		status.LastError, status.Failures = "", 0
+	}
+	if delivered > 0 {
+		now := time.Now().UTC()
+		status.LastDeliveryAt = &now
+	}
+	return delivered, err
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, c Consumer) (int, error) {
+	// Every event up to head is committed, so once caught up the cursor
+	// can skip to it past the events of other streams
+	head, err := d.source.OutboxHead(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := d.source.OutboxCursor(ctx, c.Name)
+	if err != nil {
+		return 0, err
+	}
+	d.setCursor(c.Name, cursor)
+
+	delivered := 0
+	for ctx.Err() == nil {
+		events, err := d.source.OutboxEvents(ctx, cursor, c.Streams, d.batch)
+		if err != nil {
+			return delivered, err
+		}
+		if len(events) > 0 {
+			if err := c.Deliver(ctx, events); err != nil {
+				return delivered, err
+			}
+			cursor = events[len(events)-1].Seq
+			delivered += len(events)
+		}
+		if len(events) < d.batch && head > cursor {
+			cursor = head
+		}
+		if len(events) > 0 || cursor == head {
+			if err := d.source.SetOutboxCursor(ctx, c.Name, cursor, time.Now().UTC()); err != nil {
+				return delivered, err
+			}
+			d.setCursor(c.Name, cursor)
+		}
+		if len(events) < d.batch {
+			break
+		}
+	}
+	return delivered, ctx.Err()
+}
+
+func (d *Dispatcher) setCursor(name string, cursor int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if status := d.status[name]; status != nil {
+		status.Cursor = cursor
+	}
+}
+
+// Statuses returns the status of every consumer by name.
+func (d *Dispatcher) Statuses() []Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	statuses := make([]Status, 0, len(d.status))
+	for _, s := range d.status {
+		statuses = append(statuses, *s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Consumer < statuses[j].Consumer })
+	return statuses
+}
+
+// Prune deletes the events every consumer has been delivered, and returns
+// how many were removed.
+func (d *Dispatcher) Prune(ctx context.Context) (int64, error) {
+	return d.source.PruneOutbox(ctx, d.Consumers())
+}
@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+func newTestStore(t *testing.T) *store.SQLStore {
+	t.Helper()
+	database, err := db.Connect(filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	return store.New(database)
+}
+
+// recorder is a consumer that keeps what it is delivered, or fails.
+type recorder struct {
+	batches [][]store.OutboxEvent
+	err     error
+}
+
+func (r *recorder) consumer(name string, streams ...string) Consumer {
+	return Consumer{Name: name, Streams: streams, Interval: time.Minute, Deliver: func(ctx context.Context, events []store.OutboxEvent) error {
+		if r.err != nil {
+			return r.err
+		}
+		r.batches = append(r.batches, events)
+		return nil
+	}}
+}
+
+func TestDispatchOnce(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	vessel, err := st.CreateVessel(ctx, models.Vessel{Name: "Alpha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := 0
+	write := func() {
+		engine++
+		_, err := st.WriteReading(ctx, store.ReadingWrite{
+			Table: "engine_readings", UnitCol: "engine_no", Unit: engine, VesselID: vessel,
+			TS:      time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC),
+			RowHash: strconv.Itoa(engine),
+			Cols:    []string{"engine_no", "rpm", "extra_json"}, Vals: []interface{}{engine, 1500.0, []byte("{}")},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write()
+	write()
+	write()
+
+	all, fuel := &recorder{}, &recorder{}
+	d := New(st, 2)
+	d.Add(all.consumer("all"))
+	d.Add(fuel.consumer("fuel", "fuel"))
+
+	// Batches of 2, in seq order, with the readings
+	if n, err := d.DispatchOnce(ctx, d.consumers[0]); err != nil || n != 3 {
+		t.Fatalf("Expected 3 events delivered, got %d, %v", n, err)
+	}
+	if len(all.batches) != 2 || len(all.batches[0]) != 2 || len(all.batches[1]) != 1 {
+		t.Fatalf("Unexpected batches %v", all.batches)
+	}
+	for i, e := range append(all.batches[0], all.batches[1]...) {
+		if e.Seq != int64(i+1) || e.Stream != "engines" || e.Row == nil || e.Row.ID != e.ReadingID {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	}
+
+	// Nothing of its streams, yet the cursor moves past the others
+	if n, err := d.DispatchOnce(ctx, d.consumers[1]); err != nil || n != 0 || len(fuel.batches) != 0 {
+		t.Errorf("Expected nothing delivered, got %d, %v", n, err)
+	}
+	if cursor, _ := st.OutboxCursor(ctx, "fuel"); cursor != 3 {
+		t.Errorf("Expected the fuel cursor at 3, got %d", cursor)
+	}
+
+	// A failed delivery leaves the cursor, and is retried after a restart
+	write()
+	all.err = errors.New("target down")
+	if _, err := d.DispatchOnce(ctx, d.consumers[0]); err == nil {
+		t.Error("Expected an error from a failed delivery")
+	}
+	if statuses := d.Statuses(); statuses[0].Consumer != "all" || statuses[0].Cursor != 3 || statuses[0].Failures != 1 || statuses[0].LastError == "" {
+		t.Errorf("Unexpected statuses %+v", statuses)
+	}
+	all.err = nil
+	restarted := New(st, 2)
+	restarted.Add(all.consumer("all"))
+	if n, err := restarted.DispatchOnce(ctx, restarted.consumers[0]); err != nil || n != 1 || all.batches[2][0].Seq != 4 {
+		t.Errorf("Expected the failed event delivered again, got %d, %v", n, err)
+	}
+
+	// Pruning keeps what the fuel consumer has not been delivered
+	if n, err := d.Prune(ctx); err != nil || n != 3 {
+		t.Errorf("Expected 3 events pruned, got %d, %v", n, err)
+	}
+	if events, _ := st.OutboxEvents(ctx, 0, nil, 10); len(events) != 1 || events[0].Seq != 4 {
+		t.Errorf("Unexpected events left %+v", events)
+	}
+}
@@ -0,0 +1,132 @@
+// Package outliers filters spikes out of a sensor's readings, such as the
+// 65535 °C of a disconnected temperature sensor, by comparing each value with
+// the readings before it.
+package outliers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Methods of a Filter.
+const (
+	// Median replaces values further than Threshold from the median of the
+	// window with the median.
+	Median = "median"
+	// Hampel replaces values more than Threshold scaled median absolute
+	// deviations from the median of the window with the median.
+	Hampel = "hampel"
+	// Clamp limits values to the Low and High percentiles of the window.
+	Clamp = "clamp"
+)
+
+// MinHistory is how many earlier readings a filter needs; values before
+// that are kept as they are.
+const MinHistory = 3
+
+// madScale makes the median absolute deviation estimate the standard
+// deviation of normally distributed values.
+const madScale = 1.4826
+
+// Filter is a spike filter. Window is how many earlier readings it looks at.
+type Filter struct {
+	Method    string
+	Window    int
+	Threshold float64 // Median: largest deviation kept; Hampel: deviations in MADs
+	Low, High float64 // Clamp: percentiles, 0-100
+}
+
+// Defaults of the fields of a Filter left zero.
+const (
+	DefaultWindow    = 7
+	DefaultClampLow  = 1
+	DefaultClampHigh = 99
+	DefaultHampelK   = 3
+)
+
+// Validate fills in the defaults and checks the filter.
+func (f *Filter) Validate() error {
+	if f.Window == 0 {
+		f.Window = DefaultWindow
+	}
+	if f.Window < MinHistory || f.Window > 1000 {
+		return fmt.Errorf("window must be %d to 1000 readings", MinHistory)
+	}
+	switch f.Method {
+	case Median:
+		if f.Threshold <= 0 {
+			return fmt.Errorf("median filter needs a positive threshold")
+		}
+	case Hampel:
+		if f.Threshold == 0 {
+			f.Threshold = DefaultHampelK
+		}
+		if f.Threshold < 0 {
+			return fmt.Errorf("hampel threshold must be positive")
+		}
+	case Clamp:
+		if f.Low == 0 && f.High == 0 {
+			f.Low, f.High = DefaultClampLow, DefaultClampHigh
+		}
+		if f.Low < 0 || f.High > 100 || f.Low >= f.High {
+			return fmt.Errorf("clamp percentiles must satisfy 0 <= low < high <= 100")
+		}
+	default:
+		return fmt.Errorf("unknown method %q, use median, hampel or clamp", f.Method)
+	}
+	return nil
+}
+
+// Apply checks x against history, the readings before it oldest first, of
+// which it uses the last Window. It returns the value to keep and whether x
+// was an outlier.
+func (f Filter) Apply(history []float64, x float64) (float64, bool) {
+	if len(history) > f.Window {
+		history = history[len(history)-f.Window:]
+	}
+	if len(history) < MinHistory {
+		return x, false
+	}
+	sorted := append([]float64(nil), history...)
+	sort.Float64s(sorted)
+
+	switch f.Method {
+	case Median:
+		m := percentile(sorted, 50)
+		if math.Abs(x-m) > f.Threshold {
+			return m, true
+		}
+	case Hampel:
+		m := percentile(sorted, 50)
+		deviations := make([]float64, len(sorted))
+		for i, v := range sorted {
+			deviations[i] = math.Abs(v - m)
+		}
+		sort.Float64s(deviations)
+		mad := madScale * percentile(deviations, 50)
+		// A flat window has no spread; anything off it is a spike
+		if math.Abs(x-m) > f.Threshold*mad && x != m {
+			return m, true
+		}
+	case Clamp:
+		if low := percentile(sorted, f.Low); x < low {
+			return low, true
+		}
+		if high := percentile(sorted, f.High); x > high {
+			return high, true
+		}
+	}
+	return x, false
+}
+
+// percentile returns the p-th percentile of sorted values, interpolating
+// between neighbours.
+func percentile(sorted []float64, p float64) float64 {
+	pos := p / 100 * float64(len(sorted)-1)
+	i := int(pos)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
@@ -0,0 +1,54 @@
+package outliers
+
+import "testing"
+
+func TestApply(t *testing.T) {
+	temps := []float64{81, 82, 80.5, 83, 81.5, 82.5, 81}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		history []float64
+		x       float64
+		want    float64
+		outlier bool
+	}{
+		{"hampel spike", Filter{Method: Hampel, Window: 7, Threshold: 3}, temps, 65535, 81.5, true},
+		{"hampel normal", Filter{Method: Hampel, Window: 7, Threshold: 3}, temps, 83.5, 83.5, false},
+		{"median spike", Filter{Method: Median, Window: 5, Threshold: 20}, temps, 150, 81.5, true},
+		{"median within", Filter{Method: Median, Window: 5, Threshold: 20}, temps, 95, 95, false},
+		{"clamp high", Filter{Method: Clamp, Window: 7, Low: 0, High: 100}, temps, 90, 83, true},
+		{"clamp low", Filter{Method: Clamp, Window: 7, Low: 0, High: 100}, temps, -1, 80.5, true},
+		{"clamp inside", Filter{Method: Clamp, Window: 7, Low: 0, High: 100}, temps, 82, 82, false},
+		{"too little history", Filter{Method: Hampel, Window: 7, Threshold: 3}, temps[:2], 65535, 65535, false},
+		// Only the last Window readings count
+		{"window", Filter{Method: Median, Window: 3, Threshold: 5}, []float64{500, 500, 500, 80, 81, 82}, 400, 81, true},
+	}
+	for _, tt := range tests {
+		got, outlier := tt.filter.Apply(tt.history, tt.x)
+		if got != tt.want || outlier != tt.outlier {
+			t.Errorf("%s: got %v %v, expected %v %v", tt.name, got, outlier, tt.want, tt.outlier)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	f := Filter{Method: Hampel}
+	if err := f.Validate(); err != nil || f.Window != DefaultWindow || f.Threshold != DefaultHampelK {
+		t.Errorf("Expected hampel defaults, got %+v (%v)", f, err)
+	}
+	f = Filter{Method: Clamp, Window: 50}
+	if err := f.Validate(); err != nil || f.Low != DefaultClampLow || f.High != DefaultClampHigh {
+		t.Errorf("Expected clamp defaults, got %+v (%v)", f, err)
+	}
+	for _, bad := range []Filter{
+		{Method: "mean"},
+		{Method: Median},
+		{Method: Hampel, Window: 2},
+		{Method: Clamp, Low: 90, High: 10},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Expected %+v to be refused", bad)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package pdf writes simple PDF documents: A4 pages of text in the standard
+// Helvetica fonts, lines and filled rectangles. It is just enough for the
+// vessel reports and needs no fonts or images on disk, since readers ship
+// the standard fonts themselves.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Width and Height are the size of an A4 page in points.
+const (
+	Width  = 595.28
+	Height = 841.89
+)
+
+// Point is a position on a page, in points from its top left corner.
+type Point struct {
+	X, Y float64
+}
+
+// Document is a PDF being drawn.
+type Document struct {
+	Title   string
+	Created time.Time
+	pages   []*Page
+}
+
+// New starts an empty document.
+func New(title string) *Document {
+	return &Document{Title: title, Created: time.Now().UTC()}
+}
+
+// Page is one page of a document. Positions are in points from the top
+// left corner, unlike in PDF itself.
+type Page struct {
+	content bytes.Buffer
+}
+
+// AddPage appends a blank page and returns it.
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Color sets the color of the lines, fills and text drawn next, each of
+// r, g and b from 0 to 1.
+func (p *Page) Color(r, g, b float64) {
+	fmt.Fprintf(&p.content, "%s %s %s RG %s %s %s rg\n", num(r), num(g), num(b), num(r), num(g), num(b))
+}
+
+// LineWidth sets the width of the lines drawn next.
+func (p *Page) LineWidth(w float64) {
+	fmt.Fprintf(&p.content, "%s w\n", num(w))
+}
+
+// Text draws s with its baseline starting at x, y.
+func (p *Page) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n", font, num(size), num(x), num(Height-y), escape(s))
+}
+
+// Line draws a straight line from x1, y1 to x2, y2.
+func (p *Page) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "%s %s m %s %s l S\n", num(x1), num(Height-y1), num(x2), num(Height-y2))
+}
+
+// Polyline draws lines through points in turn.
+func (p *Page) Polyline(points []Point) {
+	if len(points) < 2 {
+		return
+	}
+	for i, pt := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(&p.content, "%s %s %s ", num(pt.X), num(Height-pt.Y), op)
+	}
+	p.content.WriteString("S\n")
+}
+
+// Rect draws a rectangle with its top left corner at x, y, filled or
+// outlined.
+func (p *Page) Rect(x, y, w, h float64, fill bool) {
+	op := "S"
+	if fill {
+		op = "f"
+	}
+	fmt.Fprintf(&p.content, "%s %s %s %s re %s\n", num(x), num(Height-y-h), num(w), num(h), op)
+}
+
+// TextWidth estimates the width of s in points, from the average width of
+// Helvetica's characters; good enough to lay out columns.
+func TextWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * size * 0.52
+}
+
+// Bytes returns the finished document.
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 page tree, 3 and 4 fonts, 5 info, then each page and
+	// its content
+	const firstPage = 6
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (vessel-telemetry-api) /CreationDate (D:%s) >>",
+		escape(d.Title), d.Created.UTC().Format("20060102150405Z")))
+
+	for i, p := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			num(Width), num(Height), firstPage+2*i+1))
+
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		w.Write(p.content.Bytes())
+		w.Close()
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), z.Bytes()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// num formats a coordinate without needless digits.
+func num(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" || s == "" {
+		return "0"
+	}
+	return s
+}
+
+// escape encodes s as the body of a PDF string in WinAnsiEncoding. Latin-1
+// characters are kept, others become '?'.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
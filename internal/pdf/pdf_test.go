@@ -0,0 +1,69 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	doc := New("Report (draft)")
+	page := doc.AddPage()
+	page.Color(0.2, 0.4, 0.8)
+	page.Text(40, 60, 12, true, "Vessel")
+	page.Polyline([]Point{{40, 100}, {80, 120}, {120, 90}})
+	page.Rect(40, 200, 100, 20, true)
+	doc.AddPage().Line(0, 0, Width, Height)
+	out := doc.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("Unexpected header or trailer in %q", out)
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) || !bytes.Contains(out, []byte(`/Title (Report \(draft\))`)) {
+		t.Errorf("Expected two pages and an escaped title")
+	}
+
+	// Every cross-reference entry points at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("Expected startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("Expected 9 objects, got %d", len(entries))
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(out[off:], []byte(want)) {
+			t.Errorf("Entry %d points at %q", i+1, out[off:off+10])
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for in, want := range map[string]string{
+		`a\b`:       `a\\b`,
+		"(x)":       `\(x\)`,
+		"Tromsø":    "Troms\xf8",
+		"line\nnew": "line new",
+		"船":         "?",
+	} {
+		if got := escape(in); got != want {
+			t.Errorf("escape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNum(t *testing.T) {
+	for in, want := range map[float64]string{0: "0", 1.5: "1.5", 2.004: "2", -0.001: "0", 841.89: "841.89"} {
+		if got := num(in); got != want {
+			t.Errorf("num(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ports
+
+import "time"
+
+// Fix is one vessel position, as read from location_readings.
+type Fix struct {
+	Timestamp time.Time
+	Latitude  float64
+	Longitude float64
+	Speed     *float64 // knots, nil when not reported
+}
+
+// Call is a stay of a vessel in a port. Departure is nil while the vessel is
+// still in port at its last known position.
+type Call struct {
+	PortCode  string     `json:"port_code"`
+	PortName  string     `json:"port_name"`
+	Country   string     `json:"country"`
+	Arrival   time.Time  `json:"arrival"`
+	Departure *time.Time `json:"departure"`
+	Positions int        `json:"positions"`
+}
+
+// Duration is the length of a completed call, zero while still in port.
+func (c Call) Duration() time.Duration {
+	if c.Departure == nil {
+		return 0
+	}
+	return c.Departure.Sub(c.Arrival)
+}
+
+// DetectCalls finds port calls in fixes ordered by time. A vessel is in port
+// while it is stationary (speed at or below maxSpeed, or speed unknown) inside
+// a port polygon. Arrival and departure are the first and last such fixes; a
+// call only closes once a fix shows the vessel moving or outside the port.
+func DetectCalls(fixes []Fix, index []Port, maxSpeed float64) []Call {
+	calls := []Call{}
+	var current *Call
+	var currentPort *Port
+	var lastInPort time.Time
+
+	closeCall := func() {
+		departure := lastInPort
+		current.Departure = &departure
+		calls = append(calls, *current)
+		current, currentPort = nil, nil
+	}
+
+	for _, fix := range fixes {
+		stationary := fix.Speed == nil || *fix.Speed <= maxSpeed
+
+		if current != nil {
+			if stationary && currentPort.Contains(fix.Latitude, fix.Longitude) {
+				current.Positions++
+				lastInPort = fix.Timestamp
+				continue
+			}
+			closeCall()
+		}
+
+		if !stationary {
+			continue
+		}
+		for i := range index {
+			if index[i].Contains(fix.Latitude, fix.Longitude) {
+				currentPort = &index[i]
+				current = &Call{
+					PortCode:  currentPort.Code,
+					PortName:  currentPort.Name,
+					Country:   currentPort.Country,
+					Arrival:   fix.Timestamp,
+					Positions: 1,
+				}
+				lastInPort = fix.Timestamp
+				break
+			}
+		}
+	}
+
+	if current != nil {
+		calls = append(calls, *current)
+	}
+	return calls
+}
@@ -0,0 +1,80 @@
+// Package ports holds the port index and detects port calls from vessel
+// positions.
+//
+// A starter index of major container ports (approximate harbour outlines) is
+// bundled and loaded on first start; a fuller world port index can be imported
+// through the API in the same JSON format.
+package ports
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed world_ports.json
+var bundledIndex []byte
+
+// Port is a named port and the polygon outlining its harbour area.
+type Port struct {
+	ID      int64        `json:"id,omitempty"`
+	Code    string       `json:"code"`
+	Name    string       `json:"name"`
+	Country string       `json:"country"`
+	Polygon [][2]float64 `json:"polygon"` // [lat, lon] vertices
+}
+
+// Validate checks the fields required to store a port.
+func (p Port) Validate() error {
+	if strings.TrimSpace(p.Code) == "" {
+		return fmt.Errorf("port code is required")
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("port %s: name is required", p.Code)
+	}
+	if len(p.Polygon) < 3 {
+		return fmt.Errorf("port %s: polygon needs at least 3 points", p.Code)
+	}
+	for _, pt := range p.Polygon {
+		if pt[0] < -90 || pt[0] > 90 || pt[1] < -180 || pt[1] > 180 {
+			return fmt.Errorf("port %s: polygon point out of range", p.Code)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether the position lies inside the port polygon
+// (ray casting; polygons crossing the antimeridian are not supported).
+func (p Port) Contains(lat, lon float64) bool {
+	inside := false
+	n := len(p.Polygon)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		latI, lonI := p.Polygon[i][0], p.Polygon[i][1]
+		latJ, lonJ := p.Polygon[j][0], p.Polygon[j][1]
+		if (latI > lat) != (latJ > lat) &&
+			lon < (lonJ-lonI)*(lat-latI)/(latJ-latI)+lonI {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// ParseIndex decodes a JSON port list and validates every entry.
+func ParseIndex(data []byte) ([]Port, error) {
+	var ports []Port
+	if err := json.Unmarshal(data, &ports); err != nil {
+		return nil, fmt.Errorf("invalid port index: %w", err)
+	}
+	for _, p := range ports {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return ports, nil
+}
+
+// Bundled returns the starter port index shipped with the binary.
+func Bundled() ([]Port, error) {
+	return ParseIndex(bundledIndex)
+}
@@ -0,0 +1,78 @@
+package ports
+
+import (
+	"testing"
+	"time"
+)
+
+var testPort = Port{
+	Code:    "NLRTM",
+	Name:    "Rotterdam",
+	Country: "NL",
+	Polygon: [][2]float64{{51.88, 3.95}, {51.88, 4.50}, {51.99, 4.50}, {51.99, 3.95}},
+}
+
+func TestContains(t *testing.T) {
+	if !testPort.Contains(51.95, 4.1) {
+		t.Error("Expected position inside the port polygon")
+	}
+	if testPort.Contains(52.1, 4.1) || testPort.Contains(51.95, 5.0) {
+		t.Error("Expected positions outside the port polygon")
+	}
+}
+
+func TestBundledIndexIsValid(t *testing.T) {
+	ports, err := Bundled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) == 0 {
+		t.Fatal("Expected bundled ports")
+	}
+}
+
+func TestParseIndexRejectsInvalidPolygon(t *testing.T) {
+	if _, err := ParseIndex([]byte(`[{"code":"X","name":"X","polygon":[[1,1],[2,2]]}]`)); err == nil {
+		t.Error("Expected error for polygon with two points")
+	}
+}
+
+func TestDetectCalls(t *testing.T) {
+	start := time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)
+	slow, fast := 0.2, 12.0
+	fix := func(hours int, lat, lon float64, speed *float64) Fix {
+		return Fix{Timestamp: start.Add(time.Duration(hours) * time.Hour), Latitude: lat, Longitude: lon, Speed: speed}
+	}
+
+	fixes := []Fix{
+		fix(0, 51.5, 3.0, &fast),  // at sea
+		fix(1, 51.95, 4.1, &fast), // entering port, still moving
+		fix(2, 51.95, 4.1, &slow), // berthed
+		fix(3, 51.95, 4.1, nil),   // no speed reported
+		fix(4, 51.95, 4.1, &slow), // berthed
+		fix(5, 51.95, 4.1, &fast), // leaving
+		fix(6, 51.5, 3.0, &fast),  // at sea
+		fix(7, 51.96, 4.2, &slow), // back in port
+	}
+
+	calls := DetectCalls(fixes, []Port{testPort}, 1)
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 calls, got %d", len(calls))
+	}
+
+	first := calls[0]
+	if first.PortCode != "NLRTM" || !first.Arrival.Equal(fixes[2].Timestamp) || first.Positions != 3 {
+		t.Errorf("Unexpected first call: %+v", first)
+	}
+	if first.Departure == nil || !first.Departure.Equal(fixes[4].Timestamp) {
+		t.Errorf("Expected departure at %s, got %v", fixes[4].Timestamp, first.Departure)
+	}
+	if first.Duration() != 2*time.Hour {
+		t.Errorf("Expected 2h duration, got %s", first.Duration())
+	}
+
+	// Still in port at the last fix
+	if calls[1].Departure != nil {
+		t.Errorf("Expected open call, got departure %v", calls[1].Departure)
+	}
+}
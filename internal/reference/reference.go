@@ -0,0 +1,114 @@
+// Package reference holds the lookup tables shared across the system: fuel
+// emission factors, flag codes and vessel types. (Ports have their own
+// package.)
+//
+// Starter values are bundled and loaded on first start; admins maintain them
+// through the API afterwards.
+package reference
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//go:embed reference.json
+var bundledData []byte
+
+// Kinds of reference data, as used in URLs.
+const (
+	KindEmissionFactors = "emission-factors"
+	KindFlags           = "flags"
+	KindVesselTypes     = "vessel-types"
+)
+
+// attributes lists the numeric attributes each kind requires; entries may
+// not carry others.
+var attributes = map[string][]string{
+	KindEmissionFactors: {"co2_factor"}, // t CO2 per t fuel (IMO Cf)
+	KindFlags:           nil,
+	KindVesselTypes:     nil,
+}
+
+// Kinds returns the known kinds, sorted.
+func Kinds() []string {
+	kinds := make([]string, 0, len(attributes))
+	for kind := range attributes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Known reports whether kind is a known kind.
+func Known(kind string) bool {
+	_, ok := attributes[kind]
+	return ok
+}
+
+// Entry is one lookup value.
+type Entry struct {
+	Code       string             `json:"code"` // upper case, e.g. HFO, PA, BULK_CARRIER
+	Name       string             `json:"name"`
+	Attributes map[string]float64 `json:"attributes,omitempty"`
+}
+
+// NormalizeCode trims and upper-cases a code.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate normalizes the entry's code and checks it fits kind.
+func Validate(kind string, e *Entry) error {
+	required, ok := attributes[kind]
+	if !ok {
+		return fmt.Errorf("unknown reference data %q", kind)
+	}
+	e.Code = NormalizeCode(e.Code)
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Code == "" {
+		return fmt.Errorf("code is required")
+	}
+	if e.Name == "" {
+		return fmt.Errorf("%s: name is required", e.Code)
+	}
+
+	for _, attr := range required {
+		if v, ok := e.Attributes[attr]; !ok || v <= 0 {
+			return fmt.Errorf("%s: %s must be a positive number", e.Code, attr)
+		}
+	}
+	for attr := range e.Attributes {
+		if !contains(required, attr) {
+			return fmt.Errorf("%s: unknown attribute %q", e.Code, attr)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Bundled returns the starter entries shipped with the binary, by kind.
+func Bundled() (map[string][]Entry, error) {
+	var data map[string][]Entry
+	if err := json.Unmarshal(bundledData, &data); err != nil {
+		return nil, fmt.Errorf("invalid bundled reference data: %w", err)
+	}
+	for kind, entries := range data {
+		for i := range entries {
+			if err := Validate(kind, &entries[i]); err != nil {
+				return nil, fmt.Errorf("bundled %s: %w", kind, err)
+			}
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,38 @@
+package reference
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	e := Entry{Code: " hfo ", Name: "Heavy fuel oil", Attributes: map[string]float64{"co2_factor": 3.114}}
+	if err := Validate(KindEmissionFactors, &e); err != nil || e.Code != "HFO" {
+		t.Errorf("Expected a valid entry with code HFO, got %v, %q", err, e.Code)
+	}
+
+	for _, tt := range []struct {
+		kind  string
+		entry Entry
+	}{
+		{"colours", Entry{Code: "R", Name: "Red"}},
+		{KindFlags, Entry{Code: " ", Name: "Nowhere"}},
+		{KindFlags, Entry{Code: "PA"}},
+		{KindFlags, Entry{Code: "PA", Name: "Panama", Attributes: map[string]float64{"co2_factor": 1}}},
+		{KindEmissionFactors, Entry{Code: "HFO", Name: "Heavy fuel oil"}},
+		{KindEmissionFactors, Entry{Code: "HFO", Name: "Heavy fuel oil", Attributes: map[string]float64{"co2_factor": -1}}},
+	} {
+		if err := Validate(tt.kind, &tt.entry); err == nil {
+			t.Errorf("Expected %s %+v to be rejected", tt.kind, tt.entry)
+		}
+	}
+}
+
+func TestBundled(t *testing.T) {
+	data, err := Bundled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range Kinds() {
+		if len(data[kind]) == 0 {
+			t.Errorf("Expected bundled %s", kind)
+		}
+	}
+}
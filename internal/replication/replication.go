@@ -0,0 +1,736 @@
+// Package replication pushes the readings of an instance running onboard
+// (the edge) to the one ashore (the central API) over a link that is often
+// down.
+//
+// The edge keeps a cursor per stream, and one for upload records: the
+// highest id the central API has taken. Every run it pushes what lies above
+// each cursor in batches and moves the cursor once a batch is accepted, so
+// a run cut off by the link resumes where it stopped. Batches carry the
+// vessels they refer to; the central API maps each edge's vessel ids to its
+// own vessels, by IMO number when there is one, and writes readings as
+// ingest does, skipping those whose row hash it already has, so a batch
+// pushed twice changes nothing.
+//
+// An upsert that updates a reading on the edge keeps its id, so updates go
+// by a second cursor per stream over the change data capture log: readings
+// updated since, as they are now, which the central API upserts by vessel,
+// timestamp and unit. Updates of readings not pushed yet go with them.
+//
+// The link is often metered, so readings go as rows of columns named once
+// per batch, gzipped, and an edge may be given a budget of bytes per
+// window of time it stops pushing at until the next window.
+//
+// Vessel metadata edits go both ways. Every run ends with an exchange: the
+// edge pushes its own edits above its cursor and the central API answers
+// with its edits to the edge's vessels since the last exchange. Each side
+// merges the other's per field, the last write winning and the greater
+// origin on a tie, so both settle on the same values whatever the order;
+// the value that loses is kept in the audit log.
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/store"
+)
+
+// Roles of an instance. Instances without a role do not replicate.
+const (
+	RoleEdge    = "edge"
+	RoleCentral = "central"
+)
+
+// TokenHeader carries the shared token on pushes.
+const TokenHeader = "X-Replication-Token"
+
+// ErrInvalid is wrapped by the errors of batches the central API rejects.
+var ErrInvalid = errors.New("invalid batch")
+
+// Batch is one push of an edge, of a reading stream or of uploads.
+type Batch struct {
+	Edge   string `json:"edge"`
+	Stream string `json:"stream"` // a stream name, or uploads
+	// Vessels are the edge's vessels the readings or uploads refer to.
+	Vessels  []models.Vessel   `json:"vessels"`
+	Readings []json.RawMessage `json:"readings,omitempty"` // as the API returns them
+	// Compact batches send readings as rows of Columns instead.
+	Columns []string            `json:"columns,omitempty"`
+	Rows    [][]json.RawMessage `json:"rows,omitempty"`
+	Uploads []models.Upload     `json:"uploads,omitempty"`
+	// Vessels batches carry the edge's own vessel edits, and ask for up to
+	// Limit of the central API's edits above its seq Since.
+	Fields []store.VesselField `json:"fields,omitempty"`
+	Since  int64               `json:"since,omitempty"`
+	Limit  int                 `json:"limit,omitempty"`
+	// Upsert batches carry readings updated on the edge, to overwrite the
+	// central API's reading of the same vessel, timestamp and unit.
+	Upsert bool `json:"upsert,omitempty"`
+}
+
+// Result is the central API's answer to a batch.
+type Result struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated,omitempty"`
+	Skipped  int `json:"skipped"` // already there, or superseded
+	// Fields are the central API's vessel edits for a vessels batch, with
+	// the edge's vessel ids.
+	Fields []store.VesselField `json:"fields,omitempty"`
+}
+
+// maxResponse bounds the central API's answers, and maxFields the vessel
+// edits in one. maxSkew is how far ahead of the central API's clock an
+// edit may be stamped, so an edge with a fast clock can't win every later
+// edit.
+const (
+	maxResponse = 16 << 20
+	maxFields   = 1000
+	maxSkew     = 5 * time.Minute
+)
+
+// Source is the edge's store.
+type Source interface {
+	GetVessel(ctx context.Context, id int64) (*models.Vessel, error)
+	ListVessels(ctx context.Context, f store.VesselFilter) ([]models.Vessel, error)
+	VesselFieldsAfter(ctx context.Context, afterSeq int64, vesselIDs []int64, limit int) ([]store.VesselField, error)
+	MergeVesselField(ctx context.Context, f store.VesselField) (bool, error)
+	ReplicationCursors(ctx context.Context) (map[string]int64, error)
+	SetReplicationCursor(ctx context.Context, stream string, lastID int64, at time.Time) error
+	ReadingsAfter(ctx context.Context, stream string, afterID int64, limit int) ([]store.Reading, error)
+	UpdatesAfter(ctx context.Context, stream string, afterSeq int64, limit int) ([]store.Change, int64, error)
+	UploadsAfter(ctx context.Context, afterID int64, limit int) ([]models.Upload, error)
+	ReplicationUsage(ctx context.Context, windowStart time.Time) (int64, error)
+	AddReplicationUsage(ctx context.Context, windowStart time.Time, bytes int64) error
+}
+
+// Budget bounds the bytes an edge pushes per window of time, windows
+// starting at multiples of Window since the Unix epoch (UTC midnights for
+// a day). Zero Bytes is no bound.
+type Budget struct {
+	Bytes  int64
+	Window time.Duration
+}
+
+// WindowStart returns the start of the window holding t.
+func (b Budget) WindowStart(t time.Time) time.Time {
+	return t.UTC().Truncate(b.Window)
+}
+
+// errBudgetSpent stops a run once the next batch would go over budget.
+var errBudgetSpent = errors.New("replication budget of the window spent")
+
+// Pusher pushes an edge's new readings and uploads to the central API, and
+// exchanges vessel edits with it.
+type Pusher struct {
+	source  Source
+	url     string
+	token   string
+	edge    string
+	batch   int
+	budget  Budget
+	out     *outbound.Integration
+	client  *http.Client
+	streams []string
+}
+
+// NewPusher creates a pusher of the edge named edge to the central API at
+// centralURL, batch rows at a time within budget, its calls guarded by
+// policy as the "replication" integration.
+func NewPusher(source Source, centralURL, token, edge string, batch int, budget Budget, policy outbound.Policy) *Pusher {
+	return &Pusher{
+		source:  source,
+		url:     strings.TrimSuffix(centralURL, "/") + "/replication/batches",
+		token:   token,
+		edge:    edge,
+		batch:   batch,
+		budget:  budget,
+		out:     outbound.New("replication", policy),
+		client:  &http.Client{}, // timeouts come from the policy
+		streams: append([]string{store.UploadsStream}, store.StreamOrder...),
+	}
+}
+
+// PushOnce pushes everything above the cursors, a batch at a time, until
+// every stream is caught up, then the updates of readings pushed, then
+// exchanges vessel edits. A stream that fails does not hold back the
+// others; the errors are returned together. Once the budget of the window
+// is spent the rest waits for the next one.
+func (p *Pusher) PushOnce(ctx context.Context) error {
+	cursors, err := p.source.ReplicationCursors(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, stream := range p.streams {
+		err := p.pushStream(ctx, stream, cursors[stream])
+		if errors.Is(err, errBudgetSpent) {
+			return errors.Join(errs...)
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", stream, err))
+		}
+		if ctx.Err() != nil {
+			return errors.Join(errs...)
+		}
+	}
+	// The insert cursors have moved: updates of readings below them go now
+	if cursors, err = p.source.ReplicationCursors(ctx); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, stream := range store.StreamOrder {
+		err := p.pushUpdates(ctx, stream, cursors[store.UpdatesCursor(stream)], cursors[stream])
+		if errors.Is(err, errBudgetSpent) {
+			return errors.Join(errs...)
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", store.UpdatesCursor(stream), err))
+		}
+		if ctx.Err() != nil {
+			return errors.Join(errs...)
+		}
+	}
+	err = p.syncVessels(ctx, cursors[store.VesselsStream], cursors[store.VesselsPulled])
+	if err != nil && !errors.Is(err, errBudgetSpent) {
+		errs = append(errs, fmt.Errorf("%s: %w", store.VesselsStream, err))
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pusher) pushStream(ctx context.Context, stream string, cursor int64) error {
+	vessels := map[int64]*models.Vessel{}
+	for ctx.Err() == nil {
+		// Rows as sent, the id of each and of its vessel
+		var rows, vesselIDs []int64
+		b := Batch{Edge: p.edge, Stream: stream, Vessels: []models.Vessel{}}
+		if stream == store.UploadsStream {
+			uploads, err := p.source.UploadsAfter(ctx, cursor, p.batch)
+			if err != nil {
+				return err
+			}
+			b.Uploads = uploads
+			for _, u := range uploads {
+				rows, vesselIDs = append(rows, u.ID), append(vesselIDs, u.VesselID)
+			}
+		} else {
+			readings, err := p.source.ReadingsAfter(ctx, stream, cursor, p.batch)
+			if err != nil {
+				return err
+			}
+			if b.Rows, err = compactRows(store.Streams[stream], readings); err != nil {
+				return err
+			}
+			b.Columns = readingColumns(store.Streams[stream])
+			for _, r := range readings {
+				rows, vesselIDs = append(rows, r.ID), append(vesselIDs, r.VesselID)
+			}
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		var err error
+		if b.Vessels, err = p.batchVessels(ctx, vessels, vesselIDs); err != nil {
+			return err
+		}
+
+		sent, _, err := p.push(ctx, b, func(n int) Batch {
+			if b.Uploads != nil {
+				b.Uploads = b.Uploads[:n]
+			} else {
+				b.Rows = b.Rows[:n]
+			}
+			return b
+		}, len(rows))
+		if err != nil {
+			return err
+		}
+		if err := p.source.SetReplicationCursor(ctx, stream, rows[sent-1], time.Now().UTC()); err != nil {
+			return err
+		}
+		cursor = rows[sent-1]
+		if len(rows) < p.batch {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// pushUpdates pushes the readings of a stream updated since the change
+// seq cursor, as they are now, up to the insert cursor pushed: readings
+// above it go as inserts with their updates. A reading updated more than
+// once goes once.
+func (p *Pusher) pushUpdates(ctx context.Context, stream string, cursor, pushed int64) error {
+	vessels := map[int64]*models.Vessel{}
+	for ctx.Err() == nil {
+		changes, head, err := p.source.UpdatesAfter(ctx, stream, cursor, p.batch)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			if head > cursor {
+				return p.source.SetReplicationCursor(ctx, store.UpdatesCursor(stream), head, time.Now().UTC())
+			}
+			return nil
+		}
+
+		// Readings in the order of their last update, and the seq of it
+		lastUpdate := map[int64]int64{}
+		for _, c := range changes {
+			lastUpdate[c.ReadingID] = c.Seq
+		}
+		var readings []store.Reading
+		var seqs []int64
+		for _, c := range changes {
+			if c.Row != nil && c.ReadingID <= pushed && c.Seq == lastUpdate[c.ReadingID] {
+				readings = append(readings, *c.Row)
+				seqs = append(seqs, c.Seq)
+			}
+		}
+		// With a short batch every change up to the head has been read
+		last := changes[len(changes)-1].Seq
+		if len(changes) < p.batch {
+			last = max(last, head)
+		}
+
+		if len(readings) > 0 {
+			b := Batch{Edge: p.edge, Stream: stream, Upsert: true, Columns: readingColumns(store.Streams[stream])}
+			if b.Rows, err = compactRows(store.Streams[stream], readings); err != nil {
+				return err
+			}
+			vesselIDs := make([]int64, len(readings))
+			for i, r := range readings {
+				vesselIDs[i] = r.VesselID
+			}
+			if b.Vessels, err = p.batchVessels(ctx, vessels, vesselIDs); err != nil {
+				return err
+			}
+			sent, _, err := p.push(ctx, b, func(n int) Batch {
+				b.Rows = b.Rows[:n]
+				return b
+			}, len(readings))
+			if err != nil {
+				return err
+			}
+			if sent < len(readings) {
+				// Readings past those sent were updated after seqs[sent-1]
+				last = seqs[sent-1]
+			}
+		}
+		if err := p.source.SetReplicationCursor(ctx, store.UpdatesCursor(stream), last, time.Now().UTC()); err != nil {
+			return err
+		}
+		cursor = last
+		if len(changes) < p.batch {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// batchVessels returns the vessels of ids for a batch, each once, looked up
+// through the cache vessels.
+func (p *Pusher) batchVessels(ctx context.Context, vessels map[int64]*models.Vessel, ids []int64) ([]models.Vessel, error) {
+	batch := []models.Vessel{}
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		v, ok := vessels[id]
+		if !ok {
+			var err error
+			if v, err = p.source.GetVessel(ctx, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return nil, err
+			}
+			vessels[id] = v
+		}
+		if v == nil {
+			v = &models.Vessel{ID: id, Name: fmt.Sprintf("Vessel %d", id)} // deleted since
+		}
+		batch = append(batch, *v)
+	}
+	return batch, nil
+}
+
+// syncVessels exchanges vessel edits with the central API, pushing the
+// edge's own above pushed and merging the central API's above pulled,
+// until neither side has a full batch left.
+func (p *Pusher) syncVessels(ctx context.Context, pushed, pulled int64) error {
+	vessels, err := p.source.ListVessels(ctx, store.VesselFilter{IncludeArchived: true})
+	if err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		fields, err := p.source.VesselFieldsAfter(ctx, pushed, nil, p.batch)
+		if err != nil {
+			return err
+		}
+		// All vessels go along, so the central API can map those it has
+		// edits for before they send any reading
+		b := Batch{Edge: p.edge, Stream: store.VesselsStream, Vessels: vessels, Since: pulled, Limit: p.batch}
+		if b.Vessels == nil {
+			b.Vessels = []models.Vessel{}
+		}
+		for _, f := range fields {
+			if f.Origin == p.edge { // not those merged from the central API
+				b.Fields = append(b.Fields, f)
+			}
+		}
+
+		_, result, err := p.push(ctx, b, nil, 1)
+		if err != nil {
+			return err
+		}
+		for _, f := range result.Fields {
+			if _, err := p.source.MergeVesselField(ctx, f); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+			pulled = max(pulled, f.Seq)
+		}
+		now := time.Now().UTC()
+		if len(result.Fields) > 0 {
+			if err := p.source.SetReplicationCursor(ctx, store.VesselsPulled, pulled, now); err != nil {
+				return err
+			}
+		}
+		if len(fields) > 0 {
+			pushed = fields[len(fields)-1].Seq
+			if err := p.source.SetReplicationCursor(ctx, store.VesselsStream, pushed, now); err != nil {
+				return err
+			}
+		}
+		if len(fields) < p.batch && len(result.Fields) < p.batch {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// push posts a batch of n rows to the central API, gzipped, and returns
+// how many rows went and the answer. A batch larger than what is left of
+// the budget is cut in half with first, which returns the batch of its
+// first rows, until it fits; without first, or down to one row, that is
+// errBudgetSpent.
+func (p *Pusher) push(ctx context.Context, b Batch, first func(n int) Batch, n int) (int, Result, error) {
+	var result Result
+	body, err := EncodeBatch(b)
+	if err != nil {
+		return 0, result, err
+	}
+	var window time.Time
+	if p.budget.Bytes > 0 {
+		window = p.budget.WindowStart(time.Now())
+		used, err := p.source.ReplicationUsage(ctx, window)
+		if err != nil {
+			return 0, result, err
+		}
+		for used+int64(len(body)) > p.budget.Bytes {
+			if first == nil || n == 1 {
+				return 0, result, errBudgetSpent
+			}
+			n /= 2
+			if body, err = EncodeBatch(first(n)); err != nil {
+				return 0, result, err
+			}
+		}
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {Encoding}}
+	if p.token != "" {
+		header.Set(TokenHeader, p.token)
+	}
+	response, err := p.out.PostRead(ctx, p.client, p.url, header, body, maxResponse)
+	if p.budget.Bytes > 0 {
+		// Sent at least once, even when the answer is lost
+		if err := p.source.AddReplicationUsage(ctx, window, int64(len(body))); err != nil {
+			return 0, result, err
+		}
+	}
+	if err != nil {
+		return 0, result, err
+	}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return 0, result, fmt.Errorf("invalid answer: %w", err)
+	}
+	return n, result, nil
+}
+
+// Target is the central API's store.
+type Target interface {
+	ReplicaVessel(ctx context.Context, edge string, edgeVesselID int64) (int64, error)
+	SetReplicaVessel(ctx context.Context, edge string, edgeVesselID, vesselID int64) error
+	FindVesselByIMO(ctx context.Context, imo string) (int64, error)
+	CreateVessel(ctx context.Context, v models.Vessel) (int64, error)
+	WriteReading(ctx context.Context, w store.ReadingWrite, upsert bool) (store.WriteResult, error)
+	FindUploadByHash(ctx context.Context, fileHash string) (int64, error)
+	CreateUpload(ctx context.Context, u models.Upload) (int64, error)
+	SetStreamLatest(ctx context.Context, vesselID int64, stream string, ts time.Time) error
+	RefreshRollups(ctx context.Context, stream *store.Stream, vesselID int64, from, to time.Time) error
+	ReplicaVessels(ctx context.Context, edge string) (map[int64]int64, error)
+	MergeVesselField(ctx context.Context, f store.VesselField) (bool, error)
+	VesselFieldsAfter(ctx context.Context, afterSeq int64, vesselIDs []int64, limit int) ([]store.VesselField, error)
+}
+
+// Apply writes a batch pushed by an edge. Errors of batches that can never
+// be written wrap ErrInvalid.
+func Apply(ctx context.Context, target Target, b Batch) (Result, error) {
+	var result Result
+	if strings.TrimSpace(b.Edge) == "" {
+		return result, fmt.Errorf("%w: edge is required", ErrInvalid)
+	}
+	vessels := map[int64]int64{}
+	for _, v := range b.Vessels {
+		id, err := resolveVessel(ctx, target, b.Edge, v)
+		if err != nil {
+			return result, err
+		}
+		vessels[v.ID] = id
+	}
+	vessel := func(edgeID int64) (int64, error) {
+		id, ok := vessels[edgeID]
+		if !ok {
+			return 0, fmt.Errorf("%w: vessel %d is not in the batch", ErrInvalid, edgeID)
+		}
+		return id, nil
+	}
+
+	if b.Stream == store.UploadsStream {
+		for _, u := range b.Uploads {
+			if _, err := target.FindUploadByHash(ctx, u.FileHash); err == nil {
+				result.Skipped++
+				continue
+			} else if !errors.Is(err, store.ErrNotFound) {
+				return result, err
+			}
+			id, err := vessel(u.VesselID)
+			if err != nil {
+				return result, err
+			}
+			u.VesselID = id
+			if _, err := target.CreateUpload(ctx, u); err != nil {
+				return result, err
+			}
+			result.Inserted++
+		}
+		return result, nil
+	}
+
+	if b.Stream == store.VesselsStream {
+		return applyVessels(ctx, target, b, vessel)
+	}
+
+	stream, ok := store.Streams[b.Stream]
+	if !ok {
+		return result, fmt.Errorf("%w: unknown stream %q", ErrInvalid, b.Stream)
+	}
+	// Rollups of the span written, per vessel
+	type span struct{ from, to time.Time }
+	written := map[int64]*span{}
+	readings, err := readingObjects(b)
+	if err != nil {
+		return result, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	for i, raw := range readings {
+		w, err := readingWrite(stream, raw)
+		if err != nil {
+			return result, fmt.Errorf("%w: reading %d: %v", ErrInvalid, i, err)
+		}
+		if w.VesselID, err = vessel(w.VesselID); err != nil {
+			return result, err
+		}
+		res, err := target.WriteReading(ctx, w, b.Upsert)
+		if err != nil {
+			return result, err
+		}
+		switch res {
+		case store.WriteSkipped:
+			result.Skipped++
+			continue
+		case store.WriteUpdated:
+			result.Updated++
+		default:
+			result.Inserted++
+		}
+		if s := written[w.VesselID]; s == nil {
+			written[w.VesselID] = &span{w.TS, w.TS}
+		} else if w.TS.Before(s.from) {
+			s.from = w.TS
+		} else if w.TS.After(s.to) {
+			s.to = w.TS
+		}
+	}
+	now := time.Now().UTC()
+	for vesselID, s := range written {
+		if err := target.RefreshRollups(ctx, stream, vesselID, s.from, s.to); err != nil {
+			return result, err
+		}
+		if err := target.SetStreamLatest(ctx, vesselID, stream.Name, now); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// applyVessels merges the vessel edits of an edge and answers with the
+// central API's edits to the edge's vessels it asked for.
+func applyVessels(ctx context.Context, target Target, b Batch, vessel func(edgeID int64) (int64, error)) (Result, error) {
+	var result Result
+	latest := time.Now().UTC().Add(maxSkew)
+	for i, f := range b.Fields {
+		if f.Origin != b.Edge {
+			return result, fmt.Errorf("%w: field %d: origin %q is not the pushing edge", ErrInvalid, i, f.Origin)
+		}
+		if !store.ValidVesselField(f.Field) {
+			return result, fmt.Errorf("%w: field %d: unknown vessel field %q", ErrInvalid, i, f.Field)
+		}
+		if f.Field == "name" && (f.Value == nil || strings.TrimSpace(*f.Value) == "") {
+			return result, fmt.Errorf("%w: field %d: name is required", ErrInvalid, i)
+		}
+		if f.UpdatedAt.After(latest) {
+			f.UpdatedAt = latest
+		}
+		var err error
+		if f.VesselID, err = vessel(f.VesselID); err != nil {
+			return result, err
+		}
+		applied, err := target.MergeVesselField(ctx, f)
+		if err != nil {
+			return result, err
+		}
+		if applied {
+			result.Inserted++
+		} else {
+			result.Skipped++
+		}
+	}
+
+	mapped, err := target.ReplicaVessels(ctx, b.Edge)
+	if err != nil {
+		return result, err
+	}
+	edgeIDs := map[int64][]int64{}
+	ids := []int64{}
+	for edgeID, id := range mapped {
+		if len(edgeIDs[id]) == 0 {
+			ids = append(ids, id)
+		}
+		edgeIDs[id] = append(edgeIDs[id], edgeID)
+	}
+	limit := b.Limit
+	if limit <= 0 || limit > maxFields {
+		limit = maxFields
+	}
+	fields, err := target.VesselFieldsAfter(ctx, b.Since, ids, limit)
+	if err != nil {
+		return result, err
+	}
+	result.Fields = []store.VesselField{}
+	for _, f := range fields {
+		for _, edgeID := range edgeIDs[f.VesselID] {
+			f.VesselID = edgeID
+			result.Fields = append(result.Fields, f)
+		}
+	}
+	return result, nil
+}
+
+// resolveVessel returns the central vessel of an edge's vessel, mapping it
+// on first sight: to the vessel of its IMO number, or to a new one.
+func resolveVessel(ctx context.Context, target Target, edge string, v models.Vessel) (int64, error) {
+	id, err := target.ReplicaVessel(ctx, edge, v.ID)
+	if err == nil {
+		return id, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return 0, err
+	}
+
+	err = store.ErrNotFound
+	if v.IMO != nil && *v.IMO != "" {
+		id, err = target.FindVesselByIMO(ctx, *v.IMO)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		if strings.TrimSpace(v.Name) == "" {
+			return 0, fmt.Errorf("%w: vessel %d has no name", ErrInvalid, v.ID)
+		}
+		id, err = target.CreateVessel(ctx, v)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, target.SetReplicaVessel(ctx, edge, v.ID, id)
+}
+
+// readingWrite turns a reading as the API returns it back into a write;
+// VesselID is still the edge's.
+func readingWrite(stream *store.Stream, raw json.RawMessage) (store.ReadingWrite, error) {
+	var values map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return store.ReadingWrite{}, err
+	}
+
+	w := store.ReadingWrite{Table: stream.Table, UnitCol: stream.Unit}
+	vesselID, ok := values["vessel_id"].(json.Number)
+	if !ok {
+		return w, errors.New("vessel_id is required")
+	}
+	var err error
+	if w.VesselID, err = vesselID.Int64(); err != nil {
+		return w, fmt.Errorf("vessel_id: %v", err)
+	}
+	ts, _ := values["ts"].(string)
+	if w.TS, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+		return w, fmt.Errorf("ts: %v", err)
+	}
+	if w.RowHash, _ = values["row_hash"].(string); w.RowHash == "" {
+		return w, errors.New("row_hash is required")
+	}
+
+	for _, f := range stream.Fields {
+		var v interface{}
+		switch raw := values[f.Name].(type) {
+		case nil:
+		case json.Number:
+			switch f.Kind {
+			case store.IntField:
+				v, err = raw.Int64()
+			case store.FloatField:
+				v, err = raw.Float64()
+			default:
+				err = errors.New("not text")
+			}
+		case string:
+			if f.Kind != store.TextField {
+				err = errors.New("not a number")
+			}
+			v = raw
+		default:
+			err = fmt.Errorf("unexpected %T", raw)
+		}
+		if err != nil {
+			return w, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		if f.Name == stream.Unit {
+			w.Unit = v
+		}
+		w.Cols = append(w.Cols, f.Name)
+		w.Vals = append(w.Vals, v)
+	}
+
+	extra := []byte("{}")
+	if v, ok := values["extra_json"]; ok && v != nil {
+		if extra, err = json.Marshal(v); err != nil {
+			return w, fmt.Errorf("extra_json: %v", err)
+		}
+	}
+	w.Cols = append(w.Cols, "extra_json")
+	w.Vals = append(w.Vals, extra)
+	return w, nil
+}
@@ -0,0 +1,453 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/store"
+)
+
+func newTestStore(t *testing.T, name string) *store.SQLStore {
+	t.Helper()
+	database, err := db.Connect(filepath.Join(t.TempDir(), name+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	return store.New(database)
+}
+
+func TestPushOnce(t *testing.T) {
+	ctx := context.Background()
+	edge, central := newTestStore(t, "edge"), newTestStore(t, "central")
+
+	// The central API already knows Alpha by its IMO number
+	imo := "9811000"
+	shoreAlpha, err := central.CreateVessel(ctx, models.Vessel{Name: "MV Alpha", IMO: &imo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alpha, err := edge.CreateVessel(ctx, models.Vessel{Name: "Alpha", IMO: &imo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bravo, err := edge.CreateVessel(ctx, models.Vessel{Name: "Bravo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := 0
+	write := func(vesselID int64) {
+		engine++
+		_, err := edge.WriteReading(ctx, store.ReadingWrite{
+			Table: "engine_readings", UnitCol: "engine_no", Unit: engine, VesselID: vesselID,
+			TS:      time.Date(2025, 8, 8, engine, 0, 0, 0, time.UTC),
+			RowHash: strconv.Itoa(engine),
+			Cols:    []string{"engine_no", "rpm", "alarms", "source", "extra_json"},
+			Vals:    []interface{}{engine, 1500.5, "HT", models.SourceSensor, []byte(`{"note":"ok"}`)},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(alpha)
+	write(bravo)
+	write(alpha)
+	if _, err := edge.CreateUpload(ctx, models.Upload{VesselID: bravo, SourceFilename: "noon.xlsx", FileHash: "abc", UploadedAt: time.Now().UTC()}); err != nil {
+		t.Fatal(err)
+	}
+
+	down := false
+	var batches []Batch
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get(TokenHeader) != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		b, err := DecodeBatch(body, r.Header.Get("Content-Encoding"))
+		if err != nil {
+			t.Error(err)
+		}
+		if b.Stream != store.VesselsStream {
+			batches = append(batches, b)
+		}
+		result, err := Apply(r.Context(), central, b)
+		if err != nil {
+			t.Errorf("Apply: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer srv.Close()
+
+	p := NewPusher(edge, srv.URL+"/", "s3cret", "alpha-edge", 2, Budget{}, outbound.Policy{Timeout: 5 * time.Second})
+	if err := p.PushOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Uploads, then engines in batches of 2
+	if len(batches) != 3 || batches[0].Stream != store.UploadsStream || len(batches[1].Rows) != 2 || len(batches[2].Rows) != 1 {
+		t.Fatalf("Unexpected batches %+v", batches)
+	}
+	cursors, _ := edge.ReplicationCursors(ctx)
+	if cursors["engines"] != 3 || cursors[store.UploadsStream] != 1 {
+		t.Errorf("Unexpected cursors %v", cursors)
+	}
+
+	// Alpha is mapped by IMO, Bravo created
+	shoreBravo, err := central.ReplicaVessel(ctx, "alpha-edge", bravo)
+	if err != nil || shoreBravo == shoreAlpha {
+		t.Fatalf("Expected Bravo created ashore, got %d, %v", shoreBravo, err)
+	}
+	if id, _ := central.ReplicaVessel(ctx, "alpha-edge", alpha); id != shoreAlpha {
+		t.Errorf("Expected Alpha mapped to %d, got %d", shoreAlpha, id)
+	}
+	readings, err := central.ReadingsAfter(ctx, "engines", 0, 10)
+	if err != nil || len(readings) != 3 {
+		t.Fatalf("Expected 3 readings ashore, got %d, %v", len(readings), err)
+	}
+	r := readings[1]
+	if v, _ := r.Get("rpm"); r.VesselID != shoreBravo || v != 1500.5 || r.RowHash != "2" || string(r.ExtraJSON) != `{"note":"ok"}` {
+		t.Errorf("Unexpected reading %+v", r)
+	}
+	if v, _ := r.Get("engine_no"); v != int64(2) {
+		t.Errorf("Expected engine 2, got %v", v)
+	}
+	if id, err := central.FindUploadByHash(ctx, "abc"); err != nil {
+		t.Errorf("Expected the upload ashore, got %d, %v", id, err)
+	}
+
+	// Nothing new, nothing pushed
+	if err := p.PushOnce(ctx); err != nil || len(batches) != 3 {
+		t.Errorf("Expected nothing pushed, got %d batches, %v", len(batches), err)
+	}
+
+	// The link is down: the cursor stays, and the reading goes next time
+	write(bravo)
+	down = true
+	if err := p.PushOnce(ctx); err == nil {
+		t.Error("Expected an error while the central API is down")
+	}
+	if cursors, _ := edge.ReplicationCursors(ctx); cursors["engines"] != 3 {
+		t.Errorf("Expected the cursor kept at 3, got %v", cursors)
+	}
+	down = false
+	if err := p.PushOnce(ctx); err != nil || len(batches) != 4 {
+		t.Fatalf("Expected the reading pushed, got %d batches, %v", len(batches), err)
+	}
+
+	// A batch pushed twice changes nothing
+	result, err := Apply(ctx, central, batches[1])
+	if err != nil || result.Inserted != 0 || result.Skipped != 2 {
+		t.Errorf("Expected the readings skipped, got %+v, %v", result, err)
+	}
+}
+
+func TestSyncVessels(t *testing.T) {
+	ctx := context.Background()
+	edge, central := newTestStore(t, "edge"), newTestStore(t, "central")
+	alpha, err := edge.CreateVessel(ctx, models.Vessel{Name: "Alpha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		b, err := DecodeBatch(body, r.Header.Get("Content-Encoding"))
+		if err != nil {
+			t.Error(err)
+		}
+		result, err := Apply(r.Context(), central, b)
+		if err != nil {
+			t.Errorf("Apply: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer srv.Close()
+	p := NewPusher(edge, srv.URL, "", "alpha-edge", 2, Budget{}, outbound.Policy{Timeout: 5 * time.Second})
+
+	// The first exchange maps Alpha ashore
+	if err := p.PushOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	shoreAlpha, err := central.ReplicaVessel(ctx, "alpha-edge", alpha)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both sides edit while the link is down; ashore later
+	str := func(s string) *string { return &s }
+	at := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+	if err := edge.EditVessel(ctx, alpha, map[string]*string{"name": str("Alpha I"), "flag": str("PA")}, "alpha-edge", at); err != nil {
+		t.Fatal(err)
+	}
+	if err := central.EditVessel(ctx, shoreAlpha, map[string]*string{"name": str("MV Alpha"), "mmsi": str("351000000"), "fleet": str("North")}, RoleCentral, at.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := central.EditVessel(ctx, shoreAlpha, map[string]*string{"fleet": nil}, RoleCentral, at.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PushOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Last writer wins per field, on both sides
+	for name, id := range map[string]int64{"edge": alpha, "central": shoreAlpha} {
+		st := map[string]*store.SQLStore{"edge": edge, "central": central}[name]
+		v, err := st.GetVessel(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Name != "MV Alpha" || v.Flag == nil || *v.Flag != "PA" || v.MMSI == nil || *v.MMSI != "351000000" || v.Fleet != nil {
+			t.Errorf("%s: unexpected vessel %+v", name, v)
+		}
+	}
+
+	// The name lost on the edge is in its audit log, and not again ashore
+	entries, err := edge.AuditEntries(ctx, store.AuditFilter{Limit: 10})
+	if err != nil || len(entries) != 1 || entries[0].Action != "vessel.sync" || entries[0].Subject != fmt.Sprintf("vessels/%d/name", alpha) {
+		t.Fatalf("Expected the overwritten name audited, got %+v, %v", entries, err)
+	}
+	var detail map[string]store.VesselField
+	if err := json.Unmarshal([]byte(entries[0].Detail), &detail); err != nil || *detail["overwritten"].Value != "Alpha I" || *detail["kept"].Value != "MV Alpha" {
+		t.Errorf("Unexpected detail %s", entries[0].Detail)
+	}
+	if entries, _ := central.AuditEntries(ctx, store.AuditFilter{Limit: 10}); len(entries) != 1 || entries[0].Actor != "replication:central" {
+		t.Errorf("Expected the discarded name audited ashore, got %+v", entries)
+	}
+
+	// Caught up: nothing is merged again
+	if err := p.PushOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := edge.AuditEntries(ctx, store.AuditFilter{Limit: 10}); len(entries) != 1 {
+		t.Errorf("Expected no new audit entries, got %d", len(entries))
+	}
+	cursors, _ := edge.ReplicationCursors(ctx)
+	if cursors[store.VesselsStream] == 0 || cursors[store.VesselsPulled] == 0 {
+		t.Errorf("Unexpected cursors %v", cursors)
+	}
+}
+
+func TestPushBudget(t *testing.T) {
+	ctx := context.Background()
+	edge, central := newTestStore(t, "edge"), newTestStore(t, "central")
+	alpha, err := edge.CreateVessel(ctx, models.Vessel{Name: "Alpha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 8; i++ {
+		_, err := edge.WriteReading(ctx, store.ReadingWrite{
+			Table: "engine_readings", UnitCol: "engine_no", Unit: i, VesselID: alpha,
+			TS:      time.Date(2025, 8, 8, i, 0, 0, 0, time.UTC),
+			RowHash: strconv.Itoa(i),
+			Cols:    []string{"engine_no", "rpm", "extra_json"}, Vals: []interface{}{i, 1500.0 + float64(i), []byte("{}")},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		b, err := DecodeBatch(body, r.Header.Get("Content-Encoding"))
+		if err != nil {
+			t.Error(err)
+		}
+		result, err := Apply(r.Context(), central, b)
+		if err != nil {
+			t.Errorf("Apply: %v", err)
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer srv.Close()
+
+	// Just short of the batch of all 8 readings
+	readings, _ := edge.ReadingsAfter(ctx, "engines", 0, 8)
+	rows, err := compactRows(store.Streams["engines"], readings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vessel, _ := edge.GetVessel(ctx, alpha)
+	full, err := EncodeBatch(Batch{Edge: "alpha-edge", Stream: "engines", Vessels: []models.Vessel{*vessel}, Columns: readingColumns(store.Streams["engines"]), Rows: rows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	budget := Budget{Bytes: int64(len(full)) - 1, Window: 24 * time.Hour}
+
+	// Half the batch fits, and the run ends quietly once the budget is spent
+	p := NewPusher(edge, srv.URL, "", "alpha-edge", 8, budget, outbound.Policy{Timeout: 5 * time.Second})
+	for i := 0; i < 3; i++ {
+		if err := p.PushOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cursors, _ := edge.ReplicationCursors(ctx)
+	if cursors["engines"] < 4 || cursors["engines"] == 8 {
+		t.Errorf("Expected part of the readings pushed, got cursor %d", cursors["engines"])
+	}
+	used, err := edge.ReplicationUsage(ctx, budget.WindowStart(time.Now()))
+	if err != nil || used == 0 || used > budget.Bytes {
+		t.Errorf("Expected usage within %d bytes, got %d, %v", budget.Bytes, used, err)
+	}
+
+	// A larger budget lets the rest go
+	budget.Bytes *= 4
+	p = NewPusher(edge, srv.URL, "", "alpha-edge", 8, budget, outbound.Policy{Timeout: 5 * time.Second})
+	if err := p.PushOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if readings, _ := central.ReadingsAfter(ctx, "engines", 0, 10); len(readings) != 8 {
+		t.Errorf("Expected 8 readings ashore, got %d", len(readings))
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	ctx := context.Background()
+	central := newTestStore(t, "central")
+	for name, b := range map[string]Batch{
+		"no edge":        {Stream: "engines"},
+		"unknown stream": {Edge: "e", Stream: "nope"},
+		"unknown vessel": {Edge: "e", Stream: "engines", Readings: []json.RawMessage{[]byte(`{"vessel_id":1,"ts":"2025-08-08T10:00:00Z","row_hash":"x"}`)}},
+		"unknown vessel field": {Edge: "e", Stream: store.VesselsStream, Vessels: []models.Vessel{{ID: 1, Name: "Alpha"}},
+			Fields: []store.VesselField{{VesselID: 1, Field: "imo", Origin: "e"}}},
+		"foreign origin": {Edge: "e", Stream: store.VesselsStream, Vessels: []models.Vessel{{ID: 1, Name: "Alpha"}},
+			Fields: []store.VesselField{{VesselID: 1, Field: "flag", Origin: RoleCentral}}},
+		"bad field": {Edge: "e", Stream: "engines", Vessels: []models.Vessel{{ID: 1, Name: "Alpha"}},
+			Readings: []json.RawMessage{[]byte(`{"vessel_id":1,"ts":"2025-08-08T10:00:00Z","row_hash":"x","rpm":"fast"}`)}},
+	} {
+		if _, err := Apply(ctx, central, b); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+	for _, encoding := range []string{"gzip", "br"} {
+		if _, err := DecodeBatch([]byte("{}"), encoding); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", encoding, err)
+		}
+	}
+	if _, err := Apply(ctx, central, Batch{Edge: "e", Stream: "engines", Columns: []string{"id", "ts"}, Rows: [][]json.RawMessage{{[]byte("1")}}}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Short row: expected ErrInvalid, got %v", err)
+	}
+}
+
+func TestApplyClampsFutureEdits(t *testing.T) {
+	ctx := context.Background()
+	central := newTestStore(t, "central")
+	str := func(s string) *string { return &s }
+	future := time.Now().UTC().Add(24 * time.Hour)
+	b := Batch{Edge: "e", Stream: store.VesselsStream, Vessels: []models.Vessel{{ID: 1, Name: "Alpha"}},
+		Fields: []store.VesselField{{VesselID: 1, Field: "flag", Value: str("PA"), UpdatedAt: future, Origin: "e"}}}
+	if _, err := Apply(ctx, central, b); err != nil {
+		t.Fatal(err)
+	}
+	id, err := central.ReplicaVessel(ctx, "e", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields, err := central.VesselFieldsAfter(ctx, 0, []int64{id}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 1 || fields[0].UpdatedAt.After(time.Now().UTC().Add(maxSkew)) {
+		t.Errorf("Expected the edit stamped at most maxSkew ahead, got %+v", fields)
+	}
+}
+
+func TestPushUpdates(t *testing.T) {
+	ctx := context.Background()
+	edge, central := newTestStore(t, "edge"), newTestStore(t, "central")
+	alpha, err := edge.CreateVessel(ctx, models.Vessel{Name: "Alpha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(engine int, rpm float64, hash string) {
+		_, err := edge.WriteReading(ctx, store.ReadingWrite{
+			Table: "engine_readings", UnitCol: "engine_no", Unit: engine, VesselID: alpha,
+			TS:      time.Date(2025, 8, 8, engine, 0, 0, 0, time.UTC),
+			RowHash: hash,
+			Cols:    []string{"engine_no", "rpm", "extra_json"}, Vals: []interface{}{engine, rpm, []byte("{}")},
+		}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var batches []Batch
+	var results []Result
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		b, err := DecodeBatch(body, r.Header.Get("Content-Encoding"))
+		if err != nil {
+			t.Error(err)
+		}
+		result, err := Apply(r.Context(), central, b)
+		if err != nil {
+			t.Errorf("Apply: %v", err)
+		}
+		if b.Stream != store.VesselsStream {
+			batches, results = append(batches, b), append(results, result)
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer srv.Close()
+	p := NewPusher(edge, srv.URL, "", "alpha-edge", 10, Budget{}, outbound.Policy{Timeout: 5 * time.Second})
+
+	write(1, 1500, "a")
+	if err := p.PushOnce(ctx); err != nil || len(batches) != 1 {
+		t.Fatalf("Expected the reading pushed, got %d batches, %v", len(batches), err)
+	}
+
+	// A correction of the pushed reading, twice, and of one not pushed yet:
+	// that one goes as it is now, and again as an upsert changing nothing
+	write(1, 1510, "b")
+	write(1, 1520, "c")
+	write(2, 1600, "d")
+	write(2, 1610, "e")
+	if err := p.PushOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || batches[1].Upsert || !batches[2].Upsert || len(batches[2].Rows) != 2 {
+		t.Fatalf("Expected an insert then an upsert of each reading once, got %+v", batches)
+	}
+	if results[2].Updated != 1 || results[2].Skipped != 1 {
+		t.Errorf("Expected one reading updated ashore, got %+v", results[2])
+	}
+	readings, err := central.ReadingsAfter(ctx, "engines", 0, 10)
+	if err != nil || len(readings) != 2 {
+		t.Fatalf("Expected 2 readings ashore, got %d, %v", len(readings), err)
+	}
+	for i, want := range []float64{1520, 1610} {
+		if v, _ := readings[i].Get("rpm"); v != want {
+			t.Errorf("Reading %d: expected rpm %v, got %v", i, want, v)
+		}
+	}
+	pending, _ := edge.PendingReplication(ctx)
+	if pending[store.UpdatesCursor("engines")] != 0 {
+		t.Errorf("Expected no updates pending, got %v", pending)
+	}
+
+	// Nothing new, nothing pushed
+	if err := p.PushOnce(ctx); err != nil || len(batches) != 3 {
+		t.Errorf("Expected nothing pushed, got %d batches, %v", len(batches), err)
+	}
+}
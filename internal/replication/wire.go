@@ -0,0 +1,115 @@
+package replication
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxBatch bounds a batch once decompressed.
+const maxBatch = 64 << 20
+
+// Encoding is the Content-Encoding of the batches an edge pushes.
+const Encoding = "gzip"
+
+// readingColumns are the keys of a stream's readings sent in compact
+// batches: all but created_at, which the central API sets anew.
+func readingColumns(stream *store.Stream) []string {
+	keys := stream.ReadingKeys()
+	return keys[:len(keys)-1]
+}
+
+// compactRows turns readings into rows of the stream's readingColumns, so
+// the keys go once per batch rather than once per reading.
+func compactRows(stream *store.Stream, readings []store.Reading) ([][]json.RawMessage, error) {
+	columns := readingColumns(stream)
+	rows := make([][]json.RawMessage, len(readings))
+	for i, r := range readings {
+		row := make([]json.RawMessage, len(columns))
+		for j, key := range columns {
+			v, _ := r.Get(key)
+			value, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			row[j] = value
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// EncodeBatch returns a batch as gzipped JSON, to be sent with
+// Content-Encoding Encoding.
+func EncodeBatch(b Batch) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(zw).Encode(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeBatch reads a batch sent with the given Content-Encoding, gzip or
+// none. Errors wrap ErrInvalid.
+func DecodeBatch(body []byte, encoding string) (Batch, error) {
+	var b Batch
+	var r io.Reader = bytes.NewReader(body)
+	switch encoding {
+	case "", "identity":
+	case Encoding:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return b, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return b, fmt.Errorf("%w: unsupported Content-Encoding %q", ErrInvalid, encoding)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxBatch+1))
+	if err != nil {
+		return b, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if len(data) > maxBatch {
+		return b, fmt.Errorf("%w: larger than %d bytes", ErrInvalid, maxBatch)
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return b, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return b, nil
+}
+
+// readingObjects returns the readings of a batch as objects, whether sent
+// as such or as columns and rows.
+func readingObjects(b Batch) ([]json.RawMessage, error) {
+	if len(b.Columns) == 0 {
+		return b.Readings, nil
+	}
+	readings := append([]json.RawMessage{}, b.Readings...)
+	for i, row := range b.Rows {
+		if len(row) != len(b.Columns) {
+			return nil, fmt.Errorf("row %d: %d values for %d columns", i, len(row), len(b.Columns))
+		}
+		object := make(map[string]json.RawMessage, len(row))
+		for j, column := range b.Columns {
+			object[column] = row[j]
+		}
+		raw, err := json.Marshal(object)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		readings = append(readings, raw)
+	}
+	return readings, nil
+}
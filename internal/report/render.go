@@ -0,0 +1,503 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/pdf"
+)
+
+// Page layout, in points.
+const (
+	margin      = 40.0
+	contentW    = pdf.Width - 2*margin
+	pageBottom  = pdf.Height - 50
+	rowHeight   = 13.0
+	mapHeight   = 300.0
+	chartHeight = 150.0
+)
+
+// maxAlarmRows caps the alarm list; a month of a chattering sensor would
+// otherwise run to dozens of pages.
+const maxAlarmRows = 200
+
+// writer lays out the report top to bottom, starting new pages as they
+// fill up.
+type writer struct {
+	doc    *pdf.Document
+	pages  []*pdf.Page
+	page   *pdf.Page
+	y      float64
+	accent [3]float64 // colour of the headings
+}
+
+func (w *writer) newPage() {
+	w.page = w.doc.AddPage()
+	w.pages = append(w.pages, w.page)
+	w.y = margin
+}
+
+// need starts a new page unless h more points fit on this one.
+func (w *writer) need(h float64) {
+	if w.page == nil || w.y+h > pageBottom {
+		w.newPage()
+	}
+}
+
+func (w *writer) heading(s string) {
+	w.need(30 + rowHeight)
+	w.y += 18
+	w.page.Color(w.accent[0], w.accent[1], w.accent[2])
+	w.page.Text(margin, w.y, 13, true, s)
+	w.page.Color(0, 0, 0)
+	w.y += 12
+}
+
+// row writes cells at the x offsets of cols.
+func (w *writer) row(cols []float64, bold bool, cells ...string) {
+	w.need(rowHeight)
+	w.y += rowHeight
+	for i, cell := range cells {
+		w.page.Text(margin+cols[i], w.y, 9, bold, cell)
+	}
+}
+
+// Default colours of the charts.
+var (
+	fuelColor     = [3]float64{0.85, 0.5, 0.1}
+	engineColor   = [3]float64{0.2, 0.45, 0.75}
+	completeColor = [3]float64{0.3, 0.6, 0.35}
+)
+
+// PDF renders the report in the layout and branding of its template, if
+// it has one.
+func (r *Report) PDF() []byte {
+	var branding models.ReportBranding
+	if r.Template != nil {
+		branding = r.Template.Branding
+	}
+	title := r.Vessel.Name + " - " + r.PeriodName
+	w := &writer{doc: pdf.New(title)}
+	accent, branded := [3]float64{}, false
+	if branding.Color != nil {
+		accent, branded = rgb(*branding.Color)
+		w.accent = accent
+	}
+	w.newPage()
+
+	if branding.Company != nil {
+		w.page.Color(0.35, 0.35, 0.35)
+		w.page.Text(margin, w.y+8, 10, true, *branding.Company)
+		w.y += 14
+	}
+	w.page.Color(w.accent[0], w.accent[1], w.accent[2])
+	w.page.Text(margin, w.y+20, 20, true, title)
+	w.y += 38
+	var about []string
+	for _, field := range []struct {
+		label string
+		value *string
+	}{{"IMO", r.Vessel.IMO}, {"Flag", r.Vessel.Flag}, {"Type", r.Vessel.Type}, {"Fleet", r.Vessel.Fleet}} {
+		if field.value != nil && *field.value != "" {
+			about = append(about, field.label+" "+*field.value)
+		}
+	}
+	w.page.Color(0.35, 0.35, 0.35)
+	if len(about) > 0 {
+		w.page.Text(margin, w.y, 10, false, strings.Join(about, "   "))
+		w.y += 14
+	}
+	w.page.Text(margin, w.y, 10, false, fmt.Sprintf("%s to %s UTC, generated %s",
+		r.From.Format("2 Jan 2006 15:04"), r.To.Format("2 Jan 2006 15:04"), r.GeneratedAt.Format("2 Jan 2006 15:04")))
+	w.y += 6
+
+	days := make([]string, len(r.Days))
+	for i, d := range r.Days {
+		days[i] = strings.TrimLeft(d.Day[len(d.Day)-2:], "0")
+	}
+	perDay := func(value func(models.DailySummary) float64) []float64 {
+		values := make([]float64, len(r.Days))
+		for i, d := range r.Days {
+			values[i] = value(d)
+		}
+		return values
+	}
+	// A branded report draws its bar charts in its colour
+	barColor := func(color [3]float64) [3]float64 {
+		if branded {
+			return accent
+		}
+		return color
+	}
+
+	charts := r.Charts
+	for _, section := range r.Sections() {
+		heading := func(s string) {
+			if section.Title != nil {
+				s = *section.Title
+			}
+			w.heading(s)
+		}
+		switch section.Type {
+		case models.SectionSummary:
+			distance, fuel, engineHours, alarms := r.Totals()
+			heading("Summary")
+			cols := []float64{0, 130, 260, 390}
+			w.row(cols, true, "Distance", "Generator fuel", "Engine running", "Alarms")
+			w.row(cols, false, fmt.Sprintf("%.1f nm", distance), fmt.Sprintf("%.0f l", fuel),
+				fmt.Sprintf("%.1f h", engineHours), strconv.Itoa(alarms))
+
+		case models.SectionTrack:
+			heading("Positions")
+			w.need(mapHeight)
+			drawTrack(w.page, r, margin, w.y, contentW, mapHeight)
+			w.y += mapHeight
+
+		case models.SectionFuel:
+			heading("Generator fuel per day (l)")
+			w.need(chartHeight + rowHeight)
+			drawBars(w.page, margin, w.y, contentW, chartHeight, days,
+				perDay(func(d models.DailySummary) float64 { return d.FuelConsumedLiters }), 0, barColor(fuelColor))
+			w.y += chartHeight + rowHeight
+
+		case models.SectionEngines:
+			heading("Engine running hours per day")
+			w.need(chartHeight + rowHeight)
+			drawBars(w.page, margin, w.y, contentW, chartHeight, days,
+				perDay(func(d models.DailySummary) float64 { return d.EngineRunningHours }), 0, barColor(engineColor))
+			w.y += chartHeight + rowHeight
+
+		case models.SectionAlarms:
+			heading("Alarms")
+			w.alarms(r)
+
+		case models.SectionDataQuality:
+			heading("Data quality")
+			w.dataQuality(r)
+			w.y += 8
+			w.need(rowHeight + chartHeight + rowHeight)
+			w.y += rowHeight
+			w.page.Text(margin, w.y, 10, true, "Completeness per day (%)")
+			w.y += 6
+			drawBars(w.page, margin, w.y, contentW, chartHeight, days,
+				perDay(func(d models.DailySummary) float64 { return d.CompletenessPercent }), 100, barColor(completeColor))
+			w.y += chartHeight + rowHeight
+
+		case models.SectionChart:
+			if len(charts) == 0 {
+				continue
+			}
+			chart := charts[0]
+			charts = charts[1:]
+			name := chart.Stream + " " + chart.Metric
+			if chart.Unit != nil {
+				name += " (" + *chart.Unit + ")"
+			}
+			heading(fmt.Sprintf("%s per day, %s", name, chart.Aggregate))
+			w.need(chartHeight + rowHeight)
+			drawSeries(w.page, margin, w.y, contentW, chartHeight, days, chart.Values, barColor(engineColor))
+			w.y += chartHeight + rowHeight
+		}
+	}
+
+	// Footers, now that the page count is known
+	footer := title
+	if branding.Company != nil {
+		footer = *branding.Company + " - " + title
+	}
+	for i, page := range w.pages {
+		page.Color(0.5, 0.5, 0.5)
+		page.Text(margin, pdf.Height-25, 8, false, footer)
+		n := fmt.Sprintf("Page %d of %d", i+1, len(w.pages))
+		page.Text(pdf.Width-margin-pdf.TextWidth(n, 8), pdf.Height-25, 8, false, n)
+		if branding.Footer != nil {
+			page.Text(margin, pdf.Height-14, 7, false, clip(*branding.Footer, contentW, 7))
+		}
+	}
+	return w.doc.Bytes()
+}
+
+func (w *writer) alarms(r *Report) {
+	if len(r.Alarms) == 0 {
+		w.row([]float64{0}, false, "No alarms in the period.")
+		return
+	}
+	cols := []float64{0, 85, 170, 210, 270, 340}
+	w.row(cols, true, "Start", "End", "Engine", "Severity", "Code", "Message")
+	for i, a := range r.Alarms {
+		if i == maxAlarmRows {
+			w.row([]float64{0}, false, fmt.Sprintf("... and %d more, see /vessels/%d/alarms.", len(r.Alarms)-i, r.Vessel.ID))
+			break
+		}
+		end, engine := "active", ""
+		if a.End != nil {
+			end = a.End.UTC().Format("02 Jan 15:04")
+		}
+		if a.EngineNo != nil {
+			engine = strconv.Itoa(*a.EngineNo)
+		}
+		w.row(cols, false, a.Start.UTC().Format("02 Jan 15:04"), end, engine, a.Severity,
+			clip(a.Code, 65, 9), clip(a.Message, contentW-cols[5], 9))
+	}
+}
+
+func (w *writer) dataQuality(r *Report) {
+	if len(r.Streams) == 0 {
+		w.row([]float64{0}, false, "The vessel has not reported any data.")
+		return
+	}
+	cols := []float64{0, 120, 220, 320}
+	w.row(cols, true, "Stream", "Readings", "Days with data", "Hours with data")
+	for _, s := range r.Streams {
+		w.row(cols, false, s.Stream, strconv.FormatInt(s.Readings, 10),
+			fmt.Sprintf("%d of %d", s.DaysWithData, len(r.Days)), fmt.Sprintf("%.1f%%", s.CompletenessPercent))
+	}
+}
+
+// rgb parses a #rrggbb colour.
+func rgb(hex string) ([3]float64, bool) {
+	var c [3]float64
+	if len(hex) != 7 || hex[0] != '#' {
+		return c, false
+	}
+	for i := range c {
+		v, err := strconv.ParseUint(hex[1+2*i:3+2*i], 16, 8)
+		if err != nil {
+			return [3]float64{}, false
+		}
+		c[i] = float64(v) / 255
+	}
+	return c, true
+}
+
+// clip shortens s to fit width points at size.
+func clip(s string, width, size float64) string {
+	if pdf.TextWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdf.TextWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// niceStep returns a round step of about span/n: 1, 2 or 5 times a power
+// of ten.
+func niceStep(span float64, n int) float64 {
+	if span <= 0 {
+		return 1
+	}
+	raw := span / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if m*mag >= raw {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// drawBars draws a bar chart of values labelled by labels into the box at
+// x, y. The axis runs to max, or to a round number above the largest value
+// if max is 0.
+func drawBars(p *pdf.Page, x, y, w, h float64, labels []string, values []float64, max float64, color [3]float64) {
+	const axisW = 40.0
+	if max == 0 {
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+		step := niceStep(max, 4)
+		max = math.Max(step, math.Ceil(max/step)*step)
+	}
+	step := niceStep(max, 4)
+
+	plotX, plotW := x+axisW, w-axisW
+	p.LineWidth(0.5)
+	for i := 0; float64(i)*step <= max+step/2; i++ {
+		v := math.Round(float64(i)*step*1e6) / 1e6
+		ly := y + h - v/max*h
+		p.Color(0.85, 0.85, 0.85)
+		p.Line(plotX, ly, plotX+plotW, ly)
+		p.Color(0.4, 0.4, 0.4)
+		label := strconv.FormatFloat(v, 'f', -1, 64)
+		p.Text(plotX-6-pdf.TextWidth(label, 7), ly+2.5, 7, false, label)
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	slot := plotW / float64(len(values))
+	p.Color(color[0], color[1], color[2])
+	for i, v := range values {
+		bh := math.Min(v, max) / max * h
+		if bh > 0 {
+			p.Rect(plotX+float64(i)*slot+slot*0.15, y+h-bh, slot*0.7, bh, true)
+		}
+	}
+	p.Color(0.4, 0.4, 0.4)
+	for i, label := range labels {
+		p.Text(plotX+(float64(i)+0.5)*slot-pdf.TextWidth(label, 7)/2, y+h+9, 7, false, label)
+	}
+}
+
+// drawSeries draws a line chart of values, one per label, into the box at
+// x, y. Unlike drawBars the axis need not start at zero, and days without a
+// value break the line.
+func drawSeries(p *pdf.Page, x, y, w, h float64, labels []string, values []*float64, color [3]float64) {
+	const axisW = 40.0
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if v != nil {
+			lo, hi = math.Min(lo, *v), math.Max(hi, *v)
+		}
+	}
+	if math.IsInf(lo, 1) {
+		p.Color(0.4, 0.4, 0.4)
+		p.Text(x+axisW, y+20, 10, false, "No readings in the period.")
+		return
+	}
+	step := niceStep(hi-lo, 4)
+	lo, hi = math.Floor(lo/step)*step, math.Ceil(hi/step)*step
+	if hi == lo {
+		hi = lo + step
+	}
+
+	plotX, plotW := x+axisW, w-axisW
+	project := func(i int, v float64) pdf.Point {
+		slot := plotW / float64(len(values))
+		return pdf.Point{X: plotX + (float64(i)+0.5)*slot, Y: y + h - (v-lo)/(hi-lo)*h}
+	}
+	p.LineWidth(0.5)
+	for i := 0; lo+float64(i)*step <= hi+step/2; i++ {
+		v := math.Round((lo+float64(i)*step)*1e6) / 1e6
+		ly := y + h - (v-lo)/(hi-lo)*h
+		p.Color(0.85, 0.85, 0.85)
+		p.Line(plotX, ly, plotX+plotW, ly)
+		p.Color(0.4, 0.4, 0.4)
+		label := strconv.FormatFloat(v, 'f', -1, 64)
+		p.Text(plotX-6-pdf.TextWidth(label, 7), ly+2.5, 7, false, label)
+	}
+
+	p.Color(color[0], color[1], color[2])
+	p.LineWidth(1.5)
+	var line []pdf.Point
+	for i, v := range values {
+		if v == nil {
+			if len(line) > 1 {
+				p.Polyline(line)
+			}
+			line = nil
+			continue
+		}
+		pt := project(i, *v)
+		p.Rect(pt.X-1.5, pt.Y-1.5, 3, 3, true)
+		line = append(line, pt)
+	}
+	if len(line) > 1 {
+		p.Polyline(line)
+	}
+
+	p.Color(0.4, 0.4, 0.4)
+	for i, label := range labels {
+		pt := project(i, lo)
+		p.Text(pt.X-pdf.TextWidth(label, 7)/2, y+h+9, 7, false, label)
+	}
+}
+
+// drawTrack plots the track on a latitude/longitude grid in the box at x,
+// y, scaled alike in both directions at its middle latitude.
+func drawTrack(p *pdf.Page, r *Report, x, y, w, h float64) {
+	p.LineWidth(0.5)
+	p.Color(0.6, 0.6, 0.6)
+	p.Rect(x, y, w, h, false)
+	if len(r.Track) == 0 {
+		p.Color(0.4, 0.4, 0.4)
+		p.Text(x+10, y+20, 10, false, "No positions reported in the period.")
+		return
+	}
+
+	// A track across the antimeridian is kept in one piece
+	lons := make([]float64, len(r.Track))
+	minLon, maxLon := 180.0, -180.0
+	for i, f := range r.Track {
+		lons[i] = f.Longitude
+		minLon, maxLon = math.Min(minLon, f.Longitude), math.Max(maxLon, f.Longitude)
+	}
+	if maxLon-minLon > 180 {
+		minLon, maxLon = 360, 0
+		for i := range lons {
+			if lons[i] < 0 {
+				lons[i] += 360
+			}
+			minLon, maxLon = math.Min(minLon, lons[i]), math.Max(maxLon, lons[i])
+		}
+	}
+	minLat, maxLat := 90.0, -90.0
+	for _, f := range r.Track {
+		minLat, maxLat = math.Min(minLat, f.Latitude), math.Max(maxLat, f.Latitude)
+	}
+
+	// Pad the extent and widen it to the box's shape
+	const pad = 20.0
+	kx := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	spanX := math.Max((maxLon-minLon)*kx, 0.05)
+	spanY := math.Max(maxLat-minLat, 0.05)
+	scale := math.Min((w-2*pad)/spanX, (h-2*pad)/spanY)
+	midLon, midLat := (minLon+maxLon)/2, (minLat+maxLat)/2
+	project := func(lat, lon float64) pdf.Point {
+		return pdf.Point{X: x + w/2 + (lon-midLon)*kx*scale, Y: y + h/2 - (lat-midLat)*scale}
+	}
+	lonFrom, lonTo := midLon-w/2/scale/kx, midLon+w/2/scale/kx
+	latFrom, latTo := midLat-h/2/scale, midLat+h/2/scale
+
+	// Graticule
+	p.Color(0.88, 0.88, 0.88)
+	step := niceStep(latTo-latFrom, 5)
+	for lat := math.Ceil(latFrom/step) * step; lat < latTo; lat += step {
+		pt := project(lat, lonFrom)
+		p.Color(0.88, 0.88, 0.88)
+		p.Line(x, pt.Y, x+w, pt.Y)
+		p.Color(0.5, 0.5, 0.5)
+		p.Text(x+3, pt.Y-2, 7, false, degrees(lat, "N", "S"))
+	}
+	step = niceStep(lonTo-lonFrom, 6)
+	for lon := math.Ceil(lonFrom/step) * step; lon < lonTo; lon += step {
+		pt := project(latFrom, lon)
+		p.Color(0.88, 0.88, 0.88)
+		p.Line(pt.X, y, pt.X, y+h)
+		p.Color(0.5, 0.5, 0.5)
+		p.Text(pt.X+2, y+h-3, 7, false, degrees(math.Remainder(lon, 360), "E", "W"))
+	}
+
+	points := make([]pdf.Point, len(r.Track))
+	for i, f := range r.Track {
+		points[i] = project(f.Latitude, lons[i])
+	}
+	p.LineWidth(1.5)
+	p.Color(0.1, 0.35, 0.7)
+	p.Polyline(points)
+
+	first, last := points[0], points[len(points)-1]
+	p.Color(0.15, 0.6, 0.25)
+	p.Rect(first.X-3, first.Y-3, 6, 6, true)
+	p.Color(0.8, 0.15, 0.15)
+	p.Rect(last.X-3, last.Y-3, 6, 6, true)
+
+	p.Color(0.3, 0.3, 0.3)
+	legend := fmt.Sprintf("%d positions, first %s, last %s", len(r.Track),
+		r.Track[0].Timestamp.UTC().Format("02 Jan 15:04"), r.Track[len(r.Track)-1].Timestamp.UTC().Format("02 Jan 15:04"))
+	p.Text(x+w-pdf.TextWidth(legend, 8)-4, y+11, 8, false, legend)
+}
+
+// degrees formats a latitude or longitude as e.g. 12.5°N.
+func degrees(v float64, pos, neg string) string {
+	hemi := pos
+	if v < 0 {
+		hemi, v = neg, -v
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64) + "°" + hemi
+}
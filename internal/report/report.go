@@ -0,0 +1,263 @@
+// Package report puts together a vessel's monthly report for people who do
+// not use the API, such as charterers: the track sailed, fuel and engine
+// hours per day, the alarms raised and how complete the data is, rendered
+// as a PDF.
+//
+// Days are summarized as by the daily-summary job, so the report agrees
+// with /vessels/:id/daily.
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"vessel-telemetry-api/internal/daily"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/store"
+)
+
+// PeriodLayout is the format of a monthly report period (UTC).
+const PeriodLayout = "2006-01"
+
+// ErrFuturePeriod is returned for a period that has not started yet.
+var ErrFuturePeriod = errors.New("period has not started")
+
+// Period is the span a report covers, From up to To, UTC.
+type Period struct {
+	Label    string // 2025-08-01, 2025-W31 or 2025-08
+	Name     string // for titles, e.g. August 2025
+	From, To time.Time
+}
+
+// Day returns the day starting at t's UTC midnight.
+func Day(t time.Time) Period {
+	from := t.UTC().Truncate(24 * time.Hour)
+	return Period{Label: from.Format(daily.DayLayout), Name: from.Format("2 January 2006"), From: from, To: from.AddDate(0, 0, 1)}
+}
+
+// Week returns the ISO week, Monday to Sunday, t falls in.
+func Week(t time.Time) Period {
+	day := t.UTC().Truncate(24 * time.Hour)
+	from := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	to := from.AddDate(0, 0, 7)
+	year, week := from.ISOWeek()
+	return Period{
+		Label: fmt.Sprintf("%d-W%02d", year, week),
+		Name:  fmt.Sprintf("Week %d, %d (%s to %s)", week, year, from.Format("2 Jan"), to.AddDate(0, 0, -1).Format("2 Jan")),
+		From:  from,
+		To:    to,
+	}
+}
+
+// Month returns the period of a YYYY-MM month.
+func Month(label string) (Period, error) {
+	from, err := time.Parse(PeriodLayout, label)
+	if err != nil {
+		return Period{}, err
+	}
+	return Period{Label: label, Name: from.Format("January 2006"), From: from, To: from.AddDate(0, 1, 0)}, nil
+}
+
+// Last returns the latest period of a schedule frequency to have ended by
+// now: yesterday, last week or last month.
+func Last(frequency string, now time.Time) (Period, error) {
+	now = now.UTC()
+	switch frequency {
+	case models.ReportDaily:
+		return Day(now.AddDate(0, 0, -1)), nil
+	case models.ReportWeekly:
+		return Week(now.AddDate(0, 0, -7)), nil
+	case models.ReportMonthly:
+		return Month(time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC).Format(PeriodLayout))
+	}
+	return Period{}, fmt.Errorf("unknown frequency %q", frequency)
+}
+
+// Report is the data of a vessel's report.
+type Report struct {
+	Vessel     models.Vessel `json:"vessel"`
+	Period     string        `json:"period"`
+	PeriodName string        `json:"period_name"`
+	// From..To is the part of the period reported on; To is now while the
+	// period is under way.
+	From    time.Time             `json:"from"`
+	To      time.Time             `json:"to"`
+	Days    []models.DailySummary `json:"days"`
+	Track   []ports.Fix           `json:"-"`
+	Alarms  []models.AlarmEvent   `json:"alarms"`
+	Streams []StreamQuality       `json:"streams"`
+	// Charts are the series of the template's chart sections, in order.
+	Charts      []Chart                `json:"charts,omitempty"`
+	Template    *models.ReportTemplate `json:"template,omitempty"`
+	GeneratedAt time.Time              `json:"generated_at"`
+}
+
+// defaultSections is the layout of reports without a template.
+var defaultSections = []models.ReportSection{
+	{Type: models.SectionSummary},
+	{Type: models.SectionTrack},
+	{Type: models.SectionFuel},
+	{Type: models.SectionEngines},
+	{Type: models.SectionAlarms},
+	{Type: models.SectionDataQuality},
+}
+
+// Sections returns the report's sections: its template's, or the default
+// layout.
+func (r *Report) Sections() []models.ReportSection {
+	if r.Template != nil {
+		return r.Template.Sections
+	}
+	return defaultSections
+}
+
+// Chart is a stream's metric per day of the report.
+type Chart struct {
+	Stream    string  `json:"stream"`
+	Metric    string  `json:"metric"`
+	Unit      *string `json:"unit"`
+	Aggregate string  `json:"aggregate"`
+	// Values has one entry per day of Days, nil for days without readings.
+	Values []*float64 `json:"values"`
+}
+
+// StreamQuality is how complete one stream's data of the period is.
+type StreamQuality struct {
+	Stream       string `json:"stream"`
+	Readings     int64  `json:"readings"`
+	DaysWithData int    `json:"days_with_data"`
+	// CompletenessPercent is the share of the period's hours with at least
+	// one reading.
+	CompletenessPercent float64 `json:"completeness_percent"`
+}
+
+// Totals adds up the days of the report.
+func (r *Report) Totals() (distanceNM, fuelLiters, engineHours float64, alarms int) {
+	for _, d := range r.Days {
+		distanceNM += d.DistanceNM
+		fuelLiters += d.FuelConsumedLiters
+		engineHours += d.EngineRunningHours
+	}
+	return distanceNM, fuelLiters, engineHours, len(r.Alarms)
+}
+
+// Filename names the report's PDF.
+func (r *Report) Filename() string {
+	return fmt.Sprintf("vessel-%d-%s.pdf", r.Vessel.ID, r.Period)
+}
+
+// Gather reads the vessel's data of the period, up to now, for the layout
+// of tpl, or the default layout if tpl is nil.
+func Gather(ctx context.Context, st store.Store, vesselID int64, period Period, tpl *models.ReportTemplate, now time.Time) (*Report, error) {
+	from, end := period.From, period.To
+	if !now.After(from) {
+		return nil, ErrFuturePeriod
+	}
+	if now.Before(end) {
+		end = now
+	}
+	// Ranges include their end
+	to := end.Add(-time.Nanosecond)
+
+	vessel, err := st.GetVessel(ctx, vesselID)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{Vessel: *vessel, Period: period.Label, PeriodName: period.Name, From: from, To: end, Template: tpl, GeneratedAt: now.UTC()}
+
+	for day := from; day.Before(end); day = day.AddDate(0, 0, 1) {
+		summary, err := daily.Summarize(ctx, st, vesselID, day)
+		if err != nil {
+			return nil, err
+		}
+		r.Days = append(r.Days, summary)
+	}
+
+	if r.Track, err = st.Positions(ctx, vesselID, &from, &to); err != nil {
+		return nil, err
+	}
+	if r.Alarms, err = st.AlarmEvents(ctx, store.AlarmFilter{VesselID: vesselID, From: &from, To: &to}); err != nil {
+		return nil, err
+	}
+
+	latest, err := st.StreamLatest(ctx, vesselID)
+	if err != nil {
+		return nil, err
+	}
+	hours := math.Ceil(end.Sub(from).Hours())
+	for _, name := range store.StreamOrder {
+		if _, ok := latest[name]; !ok {
+			continue
+		}
+		def := store.Streams[name]
+		counts, err := st.DailyCounts(ctx, def, vesselID, &from, &to)
+		if err != nil {
+			return nil, err
+		}
+		withData, err := st.HoursWithData(ctx, def, vesselID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		q := StreamQuality{Stream: name, DaysWithData: len(counts), CompletenessPercent: float64(withData) / hours * 100}
+		for _, n := range counts {
+			q.Readings += n
+		}
+		r.Streams = append(r.Streams, q)
+	}
+
+	for _, section := range r.Sections() {
+		if section.Type != models.SectionChart {
+			continue
+		}
+		chart, err := gatherChart(ctx, st, vesselID, section, from, to, len(r.Days))
+		if err != nil {
+			return nil, err
+		}
+		r.Charts = append(r.Charts, chart)
+	}
+	return r, nil
+}
+
+// gatherChart reads the daily series of a chart section, from the rollups
+// where it can.
+func gatherChart(ctx context.Context, st store.Store, vesselID int64, section models.ReportSection, from, to time.Time, days int) (Chart, error) {
+	chart := Chart{Stream: section.Stream, Metric: section.Metric, Unit: section.Unit, Aggregate: section.Aggregate, Values: make([]*float64, days)}
+	if chart.Aggregate == "" {
+		chart.Aggregate = "avg"
+	}
+	def, ok := store.Streams[section.Stream]
+	if !ok {
+		return chart, fmt.Errorf("unknown stream %q", section.Stream)
+	}
+	q := store.SeriesQuery{Stream: def, Metric: section.Metric, VesselIDs: []int64{vesselID}, Bucket: 24 * time.Hour, From: &from, To: &to}
+	if section.Unit != nil {
+		unit, ok := def.ParseUnit(*section.Unit)
+		if !ok {
+			return chart, fmt.Errorf("invalid %s unit %q", def.Name, *section.Unit)
+		}
+		q.Unit = unit
+	}
+	buckets, err := st.BucketSeries(ctx, q)
+	if err != nil {
+		return chart, err
+	}
+	for _, b := range buckets {
+		i := int(b.Start.Sub(from) / (24 * time.Hour))
+		if i < 0 || i >= days {
+			continue
+		}
+		v := b.Avg
+		switch chart.Aggregate {
+		case "min":
+			v = b.Min
+		case "max":
+			v = b.Max
+		}
+		chart.Values[i] = &v
+	}
+	return chart, nil
+}
@@ -0,0 +1,159 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+)
+
+func TestMonth(t *testing.T) {
+	p, err := Month("2025-02")
+	if err != nil || p.Name != "February 2025" || !p.From.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) || !p.To.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected month %+v, %v", p, err)
+	}
+	for _, label := range []string{"", "2025", "2025-13", "2025-02-01"} {
+		if _, err := Month(label); err == nil {
+			t.Errorf("Expected %q to be refused", label)
+		}
+	}
+}
+
+func TestLast(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2025, 1, 1, 6, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		frequency, label string
+		from, to         time.Time
+	}{
+		{models.ReportDaily, "2024-12-31", time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// ISO week 1 of 2025 starts on 30 December 2024
+		{models.ReportWeekly, "2024-W52", time.Date(2024, 12, 23, 0, 0, 0, 0, time.UTC), time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)},
+		{models.ReportMonthly, "2024-12", time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		p, err := Last(tc.frequency, now)
+		if err != nil || p.Label != tc.label || !p.From.Equal(tc.from) || !p.To.Equal(tc.to) {
+			t.Errorf("%s: unexpected period %+v, %v", tc.frequency, p, err)
+		}
+	}
+	if w := Week(now); w.Label != "2025-W01" || w.Name != "Week 1, 2025 (30 Dec to 5 Jan)" {
+		t.Errorf("Unexpected week %+v", w)
+	}
+	if _, err := Last("hourly", now); err == nil {
+		t.Error("Expected an unknown frequency to be refused")
+	}
+}
+
+func TestNiceStep(t *testing.T) {
+	for _, tc := range []struct {
+		span float64
+		n    int
+		want float64
+	}{{100, 4, 50}, {7, 4, 2}, {0.3, 5, 0.1}, {0, 4, 1}, {24, 4, 10}} {
+		if got := niceStep(tc.span, tc.n); got != tc.want {
+			t.Errorf("niceStep(%v, %d) = %v, want %v", tc.span, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestClip(t *testing.T) {
+	if got := clip("short", 100, 9); got != "short" {
+		t.Errorf("Expected short text to be kept, got %q", got)
+	}
+	if got := clip("a rather long alarm message that does not fit", 60, 9); len(got) >= 40 || got[len(got)-3:] != "..." {
+		t.Errorf("Expected a clipped message, got %q", got)
+	}
+}
+
+func TestPDF(t *testing.T) {
+	imo := "9811000"
+	at := func(day, hour int) time.Time { return time.Date(2025, 8, day, hour, 0, 0, 0, time.UTC) }
+	speed := 12.0
+	r := &Report{
+		Vessel:     models.Vessel{ID: 1, Name: "Ever (Given)", IMO: &imo},
+		Period:     "2025-08",
+		PeriodName: "August 2025",
+		From:       at(1, 0),
+		To:         at(3, 0),
+		Days: []models.DailySummary{
+			{Day: "2025-08-01", DistanceNM: 30, FuelConsumedLiters: 400, EngineRunningHours: 5.5, CompletenessPercent: 50},
+			{Day: "2025-08-02", DistanceNM: 10, FuelConsumedLiters: 100, EngineRunningHours: 1},
+		},
+		// Across the antimeridian
+		Track: []ports.Fix{
+			{Timestamp: at(1, 10), Latitude: 10, Longitude: 179.5, Speed: &speed},
+			{Timestamp: at(2, 10), Latitude: 10.5, Longitude: -179.5},
+		},
+		Streams:     []StreamQuality{{Stream: "location", Readings: 2, DaysWithData: 2, CompletenessPercent: 4.2}},
+		GeneratedAt: at(3, 0),
+	}
+	for i := 0; i < 80; i++ {
+		r.Alarms = append(r.Alarms, models.AlarmEvent{Code: "HIGH_TEMP", Severity: "warning", Message: "High temperature", Start: at(1, 12)})
+	}
+
+	distance, fuel, hours, alarms := r.Totals()
+	if distance != 40 || fuel != 500 || hours != 6.5 || alarms != 80 {
+		t.Errorf("Unexpected totals %v %v %v %v", distance, fuel, hours, alarms)
+	}
+
+	out := r.PDF()
+	if !bytes.HasPrefix(out, []byte("%PDF-")) {
+		t.Fatal("Expected a PDF")
+	}
+	// The alarm list runs onto further pages
+	if !bytes.Contains(out, []byte("/Count 3")) {
+		t.Errorf("Expected 3 pages")
+	}
+	if !bytes.Contains(out, []byte(`/Title (Ever \(Given\) - August 2025)`)) {
+		t.Errorf("Expected the vessel and month as title")
+	}
+}
+
+func TestTemplatePDF(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2025, 8, day, 0, 0, 0, 0, time.UTC) }
+	company, color, footer, title := "Acme Chartering", "#1a5fb4", "Confidential", "Main engine"
+	temp, none := 82.5, (*float64)(nil)
+	r := &Report{
+		Vessel:     models.Vessel{ID: 1, Name: "Aurora"},
+		Period:     "2025-08",
+		PeriodName: "August 2025",
+		From:       at(1),
+		To:         at(4),
+		Days:       []models.DailySummary{{Day: "2025-08-01"}, {Day: "2025-08-02"}, {Day: "2025-08-03"}},
+		Template: &models.ReportTemplate{
+			Name: "acme",
+			Sections: []models.ReportSection{
+				{Type: models.SectionSummary},
+				{Type: models.SectionChart, Title: &title, Stream: "engines", Metric: "temp_c", Aggregate: "max"},
+			},
+			Branding: models.ReportBranding{Company: &company, Color: &color, Footer: &footer},
+		},
+		Charts:      []Chart{{Stream: "engines", Metric: "temp_c", Aggregate: "max", Values: []*float64{&temp, none, &temp}}},
+		GeneratedAt: at(4),
+	}
+
+	out := r.PDF()
+	if !bytes.Contains(out, []byte("/Count 1")) {
+		t.Errorf("Expected the two sections on 1 page")
+	}
+	if sections := r.Sections(); len(sections) != 2 || sections[1].Type != models.SectionChart {
+		t.Errorf("Expected the template's sections, got %+v", sections)
+	}
+	r.Template = nil
+	if sections := r.Sections(); len(sections) != len(defaultSections) {
+		t.Errorf("Expected the default sections without a template, got %d", len(sections))
+	}
+}
+
+func TestRGB(t *testing.T) {
+	if c, ok := rgb("#ff8000"); !ok || c != [3]float64{1, 128.0 / 255, 0} {
+		t.Errorf("Unexpected colour %v %v", c, ok)
+	}
+	for _, hex := range []string{"ff8000", "#ff80", "#gg8000"} {
+		if _, ok := rgb(hex); ok {
+			t.Errorf("Expected %q to be refused", hex)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/mailer"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxAttempts is how often a period's scheduled report is tried before it
+// is given up on.
+const maxAttempts = 3
+
+// Mailer sends the reports, see mailer.Mailer.
+type Mailer interface {
+	Send(ctx context.Context, msg mailer.Message) error
+}
+
+// Sender emails the reports of the report schedules.
+type Sender struct {
+	store  store.Store
+	mailer Mailer
+}
+
+// NewSender creates a sender mailing through m.
+func NewSender(st store.Store, m Mailer) *Sender {
+	return &Sender{store: st, mailer: m}
+}
+
+// SendDue sends the report of every enabled schedule's last period unless
+// it was sent already, or failed maxAttempts times. Periods that ended
+// before the schedule was created are left out, so a new schedule starts
+// with its next period.
+func (s *Sender) SendDue(ctx context.Context, now time.Time) error {
+	schedules, err := s.store.ReportSchedules(ctx)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, rs := range schedules {
+		if !rs.Enabled {
+			continue
+		}
+		period, err := Last(rs.Frequency, now)
+		if err != nil {
+			return fmt.Errorf("report schedule %d: %w", rs.ID, err)
+		}
+		if period.To.Before(rs.CreatedAt) {
+			continue
+		}
+
+		deliveries, err := s.store.ReportDeliveries(ctx, rs.ID, period.Label, maxAttempts)
+		if err != nil {
+			return err
+		}
+		if len(deliveries) >= maxAttempts || sent(deliveries) {
+			continue
+		}
+		if _, err := s.Send(ctx, rs, period, now, false); err != nil {
+			log.Printf("reports: schedule %d (%s), %s: %v", rs.ID, rs.Name, period.Label, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d report(s) not sent", failed)
+	}
+	return nil
+}
+
+func sent(deliveries []models.ReportDelivery) bool {
+	for _, d := range deliveries {
+		if d.Status == models.DeliverySent {
+			return true
+		}
+	}
+	return false
+}
+
+// Send emails the schedule's report of period, one PDF per vessel, and
+// records the delivery, failed or not.
+func (s *Sender) Send(ctx context.Context, rs models.ReportSchedule, period Period, now time.Time, manual bool) (models.ReportDelivery, error) {
+	d := models.ReportDelivery{
+		ScheduleID: rs.ID,
+		Period:     period.Label,
+		Recipients: rs.Recipients,
+		Manual:     manual,
+		At:         now.UTC().Truncate(time.Second),
+	}
+
+	msg, vessels, err := s.compose(ctx, rs, period, now)
+	if err == nil {
+		d.Vessels = vessels
+		err = s.mailer.Send(ctx, msg)
+	}
+	d.Status = models.DeliverySent
+	if err != nil {
+		d.Status = models.DeliveryFailed
+		e := err.Error()
+		d.Error = &e
+	}
+
+	var recordErr error
+	if d.ID, recordErr = s.store.AddReportDelivery(ctx, d); recordErr != nil && err == nil {
+		err = recordErr
+	}
+	return d, err
+}
+
+// compose renders the reports of the schedule's vessels, in its template's
+// layout, into a message.
+func (s *Sender) compose(ctx context.Context, rs models.ReportSchedule, period Period, now time.Time) (mailer.Message, int, error) {
+	var vessels []models.Vessel
+	if rs.VesselID != nil {
+		v, err := s.store.GetVessel(ctx, *rs.VesselID)
+		if err != nil {
+			return mailer.Message{}, 0, err
+		}
+		vessels = append(vessels, *v)
+	} else if rs.Fleet != nil {
+		var err error
+		if vessels, err = s.store.ListVessels(ctx, store.VesselFilter{Fleet: *rs.Fleet}); err != nil {
+			return mailer.Message{}, 0, err
+		}
+	}
+	if len(vessels) == 0 {
+		return mailer.Message{}, 0, errors.New("no vessels to report on")
+	}
+
+	var tpl *models.ReportTemplate
+	if rs.Template != nil {
+		var err error
+		if tpl, err = s.store.ReportTemplate(ctx, *rs.Template); err != nil {
+			return mailer.Message{}, 0, fmt.Errorf("report template %s: %w", *rs.Template, err)
+		}
+	}
+
+	msg := mailer.Message{To: rs.Recipients, Subject: rs.Name + ": " + period.Name}
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s, %s. The report of each vessel is attached.\n\n", rs.Name, period.Name)
+	for _, v := range vessels {
+		r, err := Gather(ctx, s.store, v.ID, period, tpl, now)
+		if err != nil {
+			return mailer.Message{}, 0, fmt.Errorf("vessel %d: %w", v.ID, err)
+		}
+		distance, fuel, engineHours, alarms := r.Totals()
+		fmt.Fprintf(&body, "%s: %.1f nm, %.0f l generator fuel, %.1f engine hours, %d alarm(s)\n", v.Name, distance, fuel, engineHours, alarms)
+		msg.Attachments = append(msg.Attachments, mailer.Attachment{Filename: r.Filename(), ContentType: "application/pdf", Data: r.PDF()})
+	}
+	msg.Body = body.String()
+	return msg, len(vessels), nil
+}
@@ -0,0 +1,112 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/mailer"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+type fakeMailer struct {
+	sent []mailer.Message
+	err  error
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newTestStore(t *testing.T) store.Store {
+	t.Helper()
+	database, err := db.Connect(filepath.Join(t.TempDir(), "reports.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	return store.New(database)
+}
+
+func TestSendDue(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	fleet := "North"
+	var vessels []int64
+	for _, name := range []string{"Aurora", "Boreal"} {
+		id, err := st.CreateVessel(ctx, models.Vessel{Name: name, Fleet: &fleet})
+		if err != nil {
+			t.Fatal(err)
+		}
+		vessels = append(vessels, id)
+	}
+
+	created := time.Date(2025, 1, 1, 6, 0, 0, 0, time.UTC)
+	schedules := []models.ReportSchedule{
+		{Name: "Aurora daily", Frequency: models.ReportDaily, VesselID: &vessels[0], Recipients: []string{"ops@example.com"}, Enabled: true},
+		{Name: "North fleet", Frequency: models.ReportDaily, Fleet: &fleet, Recipients: []string{"charterer@example.com"}, Enabled: true},
+		{Name: "Paused", Frequency: models.ReportDaily, VesselID: &vessels[1], Recipients: []string{"ops@example.com"}},
+	}
+	for i := range schedules {
+		schedules[i].CreatedAt, schedules[i].UpdatedAt = created, created
+		var err error
+		if schedules[i].ID, err = st.CreateReportSchedule(ctx, schedules[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &fakeMailer{}
+	sender := NewSender(st, m)
+
+	// Yesterday ended before the schedules were created
+	if err := sender.SendDue(ctx, created.Add(time.Hour)); err != nil || len(m.sent) != 0 {
+		t.Fatalf("Expected nothing sent, got %d (%v)", len(m.sent), err)
+	}
+
+	now := time.Date(2025, 1, 2, 0, 15, 0, 0, time.UTC)
+	if err := sender.SendDue(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.sent) != 2 {
+		t.Fatalf("Expected 2 reports sent, got %d", len(m.sent))
+	}
+	if msg := m.sent[0]; msg.Subject != "Aurora daily: 1 January 2025" || len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "vessel-1-2025-01-01.pdf" {
+		t.Errorf("Unexpected vessel report %q with %d attachment(s)", msg.Subject, len(msg.Attachments))
+	}
+	if msg := m.sent[1]; len(msg.Attachments) != 2 || msg.To[0] != "charterer@example.com" {
+		t.Errorf("Expected a report per vessel of the fleet, got %d", len(msg.Attachments))
+	}
+
+	// Sent once per period
+	if err := sender.SendDue(ctx, now.Add(time.Hour)); err != nil || len(m.sent) != 2 {
+		t.Errorf("Expected no second send, got %d (%v)", len(m.sent), err)
+	}
+	deliveries, err := st.ReportDeliveries(ctx, schedules[1].ID, "", 10)
+	if err != nil || len(deliveries) != 1 || deliveries[0].Status != models.DeliverySent || deliveries[0].Vessels != 2 || deliveries[0].Period != "2025-01-01" {
+		t.Errorf("Unexpected deliveries %+v (%v)", deliveries, err)
+	}
+
+	// Failures are recorded and retried up to maxAttempts times
+	m.err = errors.New("relay down")
+	next := now.AddDate(0, 0, 1)
+	for i := 0; i < maxAttempts+1; i++ {
+		if err := sender.SendDue(ctx, next.Add(time.Duration(i)*time.Hour)); (err == nil) != (i >= maxAttempts) {
+			t.Errorf("Attempt %d: unexpected error %v", i+1, err)
+		}
+	}
+	deliveries, err = st.ReportDeliveries(ctx, schedules[0].ID, "2025-01-02", 10)
+	if err != nil || len(deliveries) != maxAttempts || deliveries[0].Status != models.DeliveryFailed || deliveries[0].Error == nil || *deliveries[0].Error != "relay down" {
+		t.Errorf("Unexpected failed deliveries %+v (%v)", deliveries, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package resample turns a metric's irregularly timed readings into an evenly
+// spaced series, for charts and feature pipelines that need a fixed step.
+package resample
+
+import (
+	"time"
+)
+
+// Methods of filling in the points of a series.
+const (
+	// Linear interpolates between the readings before and after each point.
+	Linear = "linear"
+	// LOCF carries the last reading at or before each point forward.
+	LOCF = "locf"
+)
+
+// Point is one reading of a metric.
+type Point struct {
+	TS    time.Time
+	Value float64
+}
+
+// Grid returns the times from start to end, both inclusive, every interval.
+// They are aligned to the Unix epoch, like the buckets of a series, so the
+// first is the first multiple of interval at or after start.
+func Grid(start, end time.Time, interval time.Duration) []time.Time {
+	first := firstAt(start, interval)
+	grid := []time.Time{}
+	for t := first; !t.After(end); t = t.Add(interval) {
+		grid = append(grid, t)
+	}
+	return grid
+}
+
+// Count returns how many times Grid would return, without building them.
+func Count(start, end time.Time, interval time.Duration) int64 {
+	first := firstAt(start, interval)
+	if first.After(end) {
+		return 0
+	}
+	return int64(end.Sub(first)/interval) + 1
+}
+
+// firstAt returns the first multiple of interval since the Unix epoch at or
+// after start.
+func firstAt(start time.Time, interval time.Duration) time.Time {
+	n, d := start.UnixNano(), int64(interval)
+	first := n - n%d
+	if first < n {
+		first += d
+	}
+	return time.Unix(0, first).UTC()
+}
+
+// Series returns the value at each time of grid from points, oldest first.
+// A time without a reading at or before it is nil, as is, with Linear, one
+// without a reading at or after it. With maxGap set, Linear leaves times
+// between readings further apart than maxGap nil, and LOCF times more than
+// maxGap after the last reading.
+func Series(points []Point, grid []time.Time, method string, maxGap time.Duration) []*float64 {
+	values := make([]*float64, len(grid))
+	// prev is the last point at or before the grid time, -1 if none
+	prev := -1
+	for i, t := range grid {
+		for prev+1 < len(points) && !points[prev+1].TS.After(t) {
+			prev++
+		}
+		if prev < 0 {
+			continue
+		}
+		p := points[prev]
+		if p.TS.Equal(t) {
+			v := p.Value
+			values[i] = &v
+			continue
+		}
+
+		switch method {
+		case LOCF:
+			if maxGap > 0 && t.Sub(p.TS) > maxGap {
+				continue
+			}
+			v := p.Value
+			values[i] = &v
+		case Linear:
+			if prev+1 >= len(points) {
+				continue
+			}
+			next := points[prev+1]
+			span := next.TS.Sub(p.TS)
+			if maxGap > 0 && span > maxGap {
+				continue
+			}
+			v := p.Value + (next.Value-p.Value)*float64(t.Sub(p.TS))/float64(span)
+			values[i] = &v
+		}
+	}
+	return values
+}
@@ -0,0 +1,71 @@
+package resample
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGrid(t *testing.T) {
+	start := time.Date(2025, 8, 8, 10, 1, 30, 0, time.UTC)
+	end := time.Date(2025, 8, 8, 10, 15, 0, 0, time.UTC)
+	grid := Grid(start, end, 5*time.Minute)
+	if len(grid) != 3 || grid[0].Minute() != 5 || grid[2].Minute() != 15 {
+		t.Errorf("Expected 10:05, 10:10 and 10:15, got %v", grid)
+	}
+	if n := Count(start, end, 5*time.Minute); n != 3 {
+		t.Errorf("Expected a count of 3, got %d", n)
+	}
+	// Aligned to the Unix epoch, not to the hour
+	if grid := Grid(start, end, 7*time.Minute); len(grid) != 2 || grid[0].Unix()%420 != 0 {
+		t.Errorf("Expected 7 minute steps since the epoch, got %v", grid)
+	}
+	if n := Count(end, start, time.Minute); n != 0 || len(Grid(end, start, time.Minute)) != 0 {
+		t.Errorf("Expected an empty grid when start is after end, got %d", n)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2025, 8, 8, 10, minute, 0, 0, time.UTC) }
+	points := []Point{{at(1), 10}, {at(5), 20}, {at(6), 30}, {at(30), 40}}
+	grid := Grid(at(0), at(40), 5*time.Minute) // 10:00 ... 10:40
+
+	format := func(values []*float64) []interface{} {
+		out := make([]interface{}, len(values))
+		for i, v := range values {
+			if v != nil {
+				out[i] = *v
+			}
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		method string
+		maxGap time.Duration
+		want   []interface{}
+	}{
+		// 10:10 lies between 10:06 (30) and 10:30 (40)
+		{"linear", Linear, 0, []interface{}{nil, 20.0, 30 + 10*4/24.0, 30 + 10*9/24.0, 30 + 10*14/24.0, 30 + 10*19/24.0, 40.0, nil, nil}},
+		{"linear gap", Linear, 10 * time.Minute, []interface{}{nil, 20.0, nil, nil, nil, nil, 40.0, nil, nil}},
+		{"locf", LOCF, 0, []interface{}{nil, 20.0, 30.0, 30.0, 30.0, 30.0, 40.0, 40.0, 40.0}},
+		{"locf gap", LOCF, 5 * time.Minute, []interface{}{nil, 20.0, 30.0, nil, nil, nil, 40.0, 40.0, nil}},
+	}
+	for _, tt := range tests {
+		got := format(Series(points, grid, tt.method, tt.maxGap))
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: expected %d values, got %v", tt.name, len(tt.want), got)
+		}
+		for i := range got {
+			g, gok := got[i].(float64)
+			w, wok := tt.want[i].(float64)
+			if gok != wok || (gok && (g-w > 1e-9 || w-g > 1e-9)) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+				break
+			}
+		}
+	}
+
+	if values := Series(nil, grid, Linear, 0); len(values) != len(grid) || values[0] != nil {
+		t.Errorf("Expected an empty series to be all nil, got %v", values)
+	}
+}
@@ -0,0 +1,500 @@
+// Package rules parses and evaluates plausibility rules over the fields of a
+// reading, such as
+//
+//	rpm > 0 && rpm < rated_rpm * 1.1
+//	oil_pressure_bar > 1 when rpm > 600
+//
+// A rule is a condition, optionally followed by "when" and a guard: the
+// condition only has to hold for readings where the guard does. Conditions
+// combine comparisons (<, <=, >, >=, ==, !=) of arithmetic (+, -, *, /) over
+// numbers, fields and parentheses with &&, || and !. Fields compared with ==
+// or != may also be strings, as in alarms != "HIGH TEMP".
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Rule is a parsed rule.
+type Rule struct {
+	cond  node
+	guard node // nil without a when clause
+	vars  []string
+}
+
+// Vars returns the fields the rule reads, sorted.
+func (r *Rule) Vars() []string {
+	return r.vars
+}
+
+// Lookup returns the value of a field: a float64, a string, or nil if the
+// reading has none. ok is false for names that are not fields.
+type Lookup func(name string) (value interface{}, ok bool)
+
+// Eval evaluates the rule against a reading. applies is false when a field
+// it reads is empty or the guard does not hold, so there was nothing to
+// check; holds is then true.
+func (r *Rule) Eval(lookup Lookup) (holds, applies bool, err error) {
+	if r.guard != nil {
+		v, err := r.guard.eval(lookup)
+		if err != nil || v == nil {
+			return true, false, err
+		}
+		guard, ok := v.(bool)
+		if !ok {
+			return true, false, fmt.Errorf("when clause is not a condition")
+		}
+		if !guard {
+			return true, false, nil
+		}
+	}
+	v, err := r.cond.eval(lookup)
+	if err != nil || v == nil {
+		return true, false, err
+	}
+	cond, ok := v.(bool)
+	if !ok {
+		return true, false, fmt.Errorf("rule is not a condition")
+	}
+	return cond, true, nil
+}
+
+// Parse parses a rule.
+func Parse(s string) (*Rule, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, vars: make(map[string]bool)}
+	r := &Rule{}
+	if r.cond, err = p.condition(); err != nil {
+		return nil, err
+	}
+	if p.peek().text == "when" {
+		p.next()
+		if r.guard, err = p.condition(); err != nil {
+			return nil, err
+		}
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos+1)
+	}
+	for name := range p.vars {
+		r.vars = append(r.vars, name)
+	}
+	sort.Strings(r.vars)
+	return r, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "!", "+", "-", "*", "/", "(", ")"}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, string(runes[i:j]), i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[i:j]), i})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				j++
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", i+1)
+			}
+			tokens = append(tokens, token{tokString, string(runes[i+1 : j]), i})
+			i = j + 1
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(string(runes[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", string(c), i+1)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "end of rule", len(runes)}), nil
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	vars   map[string]bool
+}
+
+func (p *parser) peek() token { return p.tokens[p.i] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.i++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// condition parses an expression that has to be true or false.
+func (p *parser) condition() (node, error) {
+	pos := p.peek().pos
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !isCondition(n) {
+		return nil, fmt.Errorf("expression at %d is not a condition", pos+1)
+	}
+	return n, nil
+}
+
+// isCondition reports whether n evaluates to true or false.
+func isCondition(n node) bool {
+	switch n := n.(type) {
+	case comparison, logical, negation:
+		return true
+	case literal:
+		_, ok := n.value.(bool)
+		return ok
+	}
+	return false
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{"||", left, right}
+	}
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{"&&", left, right}
+	}
+}
+
+func (p *parser) not() (node, error) {
+	if _, ok := p.accept("!"); ok {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return negation{operand}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("<", "<=", ">", ">=", "==", "!=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return comparison{op, left, right}, nil
+}
+
+func (p *parser) sum() (node, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic{op, left, right}
+	}
+}
+
+func (p *parser) product() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic{op, left, right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic{"-", literal{0.0}, operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos+1)
+		}
+		return literal{f}, nil
+	case tokString:
+		return literal{t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "when":
+			return nil, fmt.Errorf("unexpected when at %d", t.pos+1)
+		}
+		p.vars[t.text] = true
+		return field(t.text), nil
+	case tokOp:
+		if t.text == "(" {
+			inner, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, fmt.Errorf("missing ) at %d", p.peek().pos+1)
+			}
+			return inner, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos+1)
+}
+
+// node is a parsed expression. eval returns a float64, string or bool, or
+// nil if a field it reads is empty.
+type node interface {
+	eval(lookup Lookup) (interface{}, error)
+}
+
+type literal struct{ value interface{} }
+
+func (n literal) eval(Lookup) (interface{}, error) { return n.value, nil }
+
+type field string
+
+func (n field) eval(lookup Lookup) (interface{}, error) {
+	v, ok := lookup(string(n))
+	if !ok {
+		return nil, fmt.Errorf("unknown field %s", string(n))
+	}
+	return v, nil
+}
+
+type arithmetic struct {
+	op          string
+	left, right node
+}
+
+func (n arithmetic) eval(lookup Lookup) (interface{}, error) {
+	l, r, err := evalBoth(lookup, n.left, n.right)
+	if err != nil || l == nil || r == nil {
+		return nil, err
+	}
+	a, aok := l.(float64)
+	b, bok := r.(float64)
+	if !aok || !bok {
+		return nil, fmt.Errorf("%s needs numbers", n.op)
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	if b == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return a / b, nil
+}
+
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (n comparison) eval(lookup Lookup) (interface{}, error) {
+	l, r, err := evalBoth(lookup, n.left, n.right)
+	if err != nil || l == nil || r == nil {
+		return nil, err
+	}
+	if a, ok := l.(float64); ok {
+		b, ok := r.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s compares a number with a non-number", n.op)
+		}
+		switch n.op {
+		case "<":
+			return a < b, nil
+		case "<=":
+			return a <= b, nil
+		case ">":
+			return a > b, nil
+		case ">=":
+			return a >= b, nil
+		case "==":
+			return a == b, nil
+		}
+		return a != b, nil
+	}
+	switch n.op {
+	case "==":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	}
+	return nil, fmt.Errorf("%s needs numbers", n.op)
+}
+
+type logical struct {
+	op          string
+	left, right node
+}
+
+// eval gives the result as soon as one side decides it, even if the other
+// reads an empty field.
+func (n logical) eval(lookup Lookup) (interface{}, error) {
+	l, r, err := evalBoth(lookup, n.left, n.right)
+	if err != nil {
+		return nil, err
+	}
+	a, aok := l.(bool)
+	b, bok := r.(bool)
+	if (l != nil && !aok) || (r != nil && !bok) {
+		return nil, fmt.Errorf("%s needs conditions", n.op)
+	}
+	decisive := n.op == "||" // true decides ||, false decides &&
+	if (l != nil && a == decisive) || (r != nil && b == decisive) {
+		return decisive, nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	return !decisive, nil
+}
+
+type negation struct{ operand node }
+
+func (n negation) eval(lookup Lookup) (interface{}, error) {
+	v, err := n.operand.eval(lookup)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! needs a condition")
+	}
+	return !b, nil
+}
+
+func evalBoth(lookup Lookup, left, right node) (interface{}, interface{}, error) {
+	l, err := left.eval(lookup)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := right.eval(lookup)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, r, nil
+}
@@ -0,0 +1,67 @@
+package rules
+
+import "testing"
+
+func TestEval(t *testing.T) {
+	reading := map[string]interface{}{
+		"rpm": 720.0, "rated_rpm": 700.0, "oil_pressure_bar": 0.5, "alarms": "OK", "temp_c": nil,
+	}
+	lookup := func(name string) (interface{}, bool) {
+		v, ok := reading[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		rule           string
+		holds, applies bool
+	}{
+		{"rpm > 0 && rpm < rated_rpm * 1.1", true, true},
+		{"rpm <= rated_rpm", false, true},
+		{"oil_pressure_bar > 1 when rpm > 600", false, true},
+		{"oil_pressure_bar > 1 when rpm > 800", true, false},
+		{"-rpm < -(rated_rpm - 100) / 2", true, true},
+		{`alarms == "OK" || rpm > 1000`, true, true},
+		{`!(alarms != "OK")`, true, true},
+		// Empty fields leave nothing to check, unless the other side decides
+		{"temp_c < 90", true, false},
+		{"temp_c < 90 && rpm > 1000", false, true},
+		{"temp_c < 90 || rpm > 0", true, true},
+		{"rpm > 0 when temp_c > 50", true, false},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.rule, err)
+			continue
+		}
+		holds, applies, err := r.Eval(lookup)
+		if err != nil || holds != tt.holds || applies != tt.applies {
+			t.Errorf("%q: got holds %v applies %v (%v), expected %v %v", tt.rule, holds, applies, err, tt.holds, tt.applies)
+		}
+	}
+
+	r, _ := Parse("rpm / 0 > 1")
+	if _, _, err := r.Eval(lookup); err == nil {
+		t.Error("Expected an error dividing by zero")
+	}
+	r, _ = Parse(`alarms > 1`)
+	if _, _, err := r.Eval(lookup); err == nil {
+		t.Error("Expected an error comparing a string with a number")
+	}
+}
+
+func TestParse(t *testing.T) {
+	r, err := Parse("oil_pressure_bar > 1 when rpm > 600 && rpm < rated_rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars := r.Vars(); len(vars) != 3 || vars[0] != "oil_pressure_bar" || vars[1] != "rated_rpm" || vars[2] != "rpm" {
+		t.Errorf("Unexpected vars %v", vars)
+	}
+
+	for _, bad := range []string{"", "rpm", "rpm * 2 when rpm > 0", "rpm >", "rpm > 1 when", "(rpm > 1", "rpm > 1)", "rpm # 2", `alarms == "OK`, "rpm > 1 when rpm < 2 when rpm > 0"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Expected %q to be refused", bad)
+		}
+	}
+}
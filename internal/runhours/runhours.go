@@ -0,0 +1,222 @@
+// Package runhours derives the running hours per day of an engine or a
+// generator, the basis of its maintenance intervals. Where its readings carry
+// the machine's own running hours counter, in a column no mapper recognized,
+// a day's hours are the counter's increase; otherwise they are the time it
+// ran above a threshold of rpm or load, each reading standing for the time
+// until the next.
+package runhours
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DayLayout is the format of Day.Day.
+const DayLayout = "2006-01-02"
+
+// Sources of a Day's hours.
+const (
+	FromCounter = "counter"
+	FromRPM     = "rpm"
+	FromLoad    = "load"
+)
+
+// Options tune the derivation.
+type Options struct {
+	RunningAbove float64       // machines whose Sample.Level is above it run
+	MaxGap       time.Duration // longest time one reading stands for
+	Source       string        // of hours not from the counter
+	// CounterMaxGap is how far apart counter readings may be and still be
+	// differenced; it is also how far back a rebuild reads.
+	CounterMaxGap time.Duration
+}
+
+// EngineOptions match the utilization report: engines run above 10 rpm.
+var EngineOptions = Options{
+	RunningAbove:  10,
+	MaxGap:        time.Hour,
+	Source:        FromRPM,
+	CounterMaxGap: 7 * 24 * time.Hour,
+}
+
+// GeneratorOptions take generators under any load as running.
+var GeneratorOptions = Options{
+	RunningAbove:  0,
+	MaxGap:        time.Hour,
+	Source:        FromLoad,
+	CounterMaxGap: 7 * 24 * time.Hour,
+}
+
+// Sample is one reading of an engine or generator.
+type Sample struct {
+	TS      time.Time
+	Level   *float64 // rpm of an engine, load kW of a generator
+	Counter *float64 // running hours counter, nil if the reading has none
+}
+
+// Day is an engine's running hours on one UTC day.
+type Day struct {
+	Day    string
+	Hours  float64
+	Source string
+	// Counter is the last counter reading of the day, nil if none
+	Counter *float64
+}
+
+// counterKeys are the headers of running hours counters, lower case with
+// only letters and digits.
+var counterKeys = map[string]bool{
+	"runninghours":      true,
+	"runhours":          true,
+	"runninghrs":        true,
+	"runhrs":            true,
+	"hoursrun":          true,
+	"hourcounter":       true,
+	"hourmeter":         true,
+	"enginehours":       true,
+	"totalrunninghours": true,
+	"rhs":               true,
+}
+
+// normalize lower-cases a header and keeps only its letters and digits.
+func normalize(header string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(header) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Counter returns the running hours counter in a reading's extra_json, by
+// the leading number of its value ("5200 h" counts as 5200), nil if none.
+func Counter(extra []byte) *float64 {
+	if len(extra) == 0 {
+		return nil
+	}
+	var values map[string]string
+	if err := json.Unmarshal(extra, &values); err != nil {
+		return nil
+	}
+	for key, value := range values {
+		if counterKeys[normalize(key)] {
+			if v, ok := leadingNumber(value); ok {
+				return &v
+			}
+		}
+	}
+	return nil
+}
+
+// leadingNumber parses the number a value starts with, ignoring thousands
+// separators.
+func leadingNumber(s string) (float64, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.') {
+		end++
+	}
+	v, err := strconv.ParseFloat(s[:end], 64)
+	return v, err == nil
+}
+
+// Daily returns the running hours of a machine on each day from the day of
+// from on, oldest first, from its samples ordered by time. Samples before
+// from only count for the time after it. A day on which counter readings
+// cover any time takes its hours from the counter; a counter going down or
+// up faster than the clock (by more than an hour, for counters that round)
+// is skipped as a reset or a bad reading.
+func Daily(samples []Sample, from time.Time, opts Options) []Day {
+	start := from.UTC().Truncate(24 * time.Hour)
+	counted := make(map[string]float64)
+	hasCounter := make(map[string]bool)
+	byLevel := make(map[string]float64)
+	lastCounter := make(map[string]float64)
+
+	var prevCounter *Sample
+	for i, s := range samples {
+		if s.Counter != nil {
+			if !s.TS.Before(start) {
+				lastCounter[s.TS.UTC().Format(DayLayout)] = *s.Counter
+			}
+			if p := prevCounter; p != nil {
+				elapsed := s.TS.Sub(p.TS)
+				increase := *s.Counter - *p.Counter
+				if elapsed > 0 && elapsed <= opts.CounterMaxGap && increase >= 0 && increase <= elapsed.Hours()+1 {
+					spread(p.TS, s.TS, start, func(day string, part float64) {
+						counted[day] += increase * part
+						hasCounter[day] = true
+					})
+				}
+			}
+			prevCounter = &samples[i]
+		}
+
+		if i+1 < len(samples) && s.Level != nil && *s.Level > opts.RunningAbove {
+			end := samples[i+1].TS
+			if opts.MaxGap > 0 && end.Sub(s.TS) > opts.MaxGap {
+				end = s.TS.Add(opts.MaxGap)
+			}
+			spread(s.TS, end, start, func(day string, part float64) {
+				byLevel[day] += end.Sub(s.TS).Hours() * part
+			})
+		}
+	}
+
+	seen := make(map[string]bool)
+	var days []string
+	for _, m := range []map[string]float64{counted, byLevel, lastCounter} {
+		for day := range m {
+			if !seen[day] {
+				seen[day] = true
+				days = append(days, day)
+			}
+		}
+	}
+	sort.Strings(days)
+
+	result := make([]Day, 0, len(days))
+	for _, day := range days {
+		d := Day{Day: day, Hours: byLevel[day], Source: opts.Source}
+		if hasCounter[day] {
+			d.Hours, d.Source = counted[day], FromCounter
+		}
+		if d.Hours > 24 {
+			d.Hours = 24
+		}
+		if v, ok := lastCounter[day]; ok {
+			d.Counter = &v
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// spread calls add with each UTC day a..b overlaps, from the day of start
+// on, and the part of a..b on that day.
+func spread(a, b, start time.Time, add func(day string, part float64)) {
+	total := b.Sub(a)
+	if total <= 0 {
+		return
+	}
+	for day := a.UTC().Truncate(24 * time.Hour); day.Before(b); day = day.Add(24 * time.Hour) {
+		if day.Before(start) {
+			continue
+		}
+		lo, hi := day, day.Add(24*time.Hour)
+		if a.After(lo) {
+			lo = a
+		}
+		if b.Before(hi) {
+			hi = b
+		}
+		if hi.After(lo) {
+			add(day.Format(DayLayout), float64(hi.Sub(lo))/float64(total))
+		}
+	}
+}
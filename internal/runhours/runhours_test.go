@@ -0,0 +1,76 @@
+package runhours
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCounter(t *testing.T) {
+	tests := map[string]float64{
+		`{"Running Hours":"5200 h"}`:          5200,
+		`{"Mode":"ECO","RUN HRS":"12,345.5"}`: 12345.5,
+		`{"Hour-Meter":"77"}`:                 77,
+	}
+	for extra, want := range tests {
+		if got := Counter([]byte(extra)); got == nil || *got != want {
+			t.Errorf("%s: expected %v, got %v", extra, want, got)
+		}
+	}
+	for _, extra := range []string{``, `{}`, `{"Running Hours":"n/a"}`, `{"Hours":"12"}`, `not json`} {
+		if got := Counter([]byte(extra)); got != nil {
+			t.Errorf("%s: expected no counter, got %v", extra, *got)
+		}
+	}
+}
+
+func TestDaily(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2025, 8, day, hour, 0, 0, 0, time.UTC) }
+	rpm := func(v float64) *float64 { return &v }
+
+	// Running from 22:00 to 02:00 across midnight, readings every hour;
+	// the 05:00 reading stands for an hour at most
+	samples := []Sample{
+		{TS: at(8, 22), Level: rpm(700)},
+		{TS: at(8, 23), Level: rpm(700)},
+		{TS: at(9, 0), Level: rpm(700)},
+		{TS: at(9, 1), Level: rpm(700)},
+		{TS: at(9, 2), Level: rpm(0)},
+		{TS: at(9, 5), Level: rpm(700)},
+		{TS: at(9, 12), Level: rpm(0)},
+	}
+	days := Daily(samples, at(8, 0), EngineOptions)
+	if len(days) != 2 || days[0].Day != "2025-08-08" || days[0].Hours != 2 || days[1].Hours != 3 || days[1].Source != FromRPM {
+		t.Errorf("Expected 2 and 3 hours from rpm, got %+v", days)
+	}
+	// Only from the 9th on
+	if days := Daily(samples, at(9, 6), EngineOptions); len(days) != 1 || days[0].Day != "2025-08-09" {
+		t.Errorf("Expected only the 9th, got %+v", days)
+	}
+	// Generators run under any load
+	if days := Daily(samples, at(8, 0), GeneratorOptions); len(days) != 2 || days[1].Hours != 3 || days[1].Source != FromLoad {
+		t.Errorf("Expected 3 hours under load on the 9th, got %+v", days)
+	}
+
+	// A counter read at noon each day wins over rpm, spread over the days
+	// it covers; the reset on the 12th is skipped
+	counter := func(v float64) *float64 { return &v }
+	samples = []Sample{
+		{TS: at(8, 12), Level: rpm(700), Counter: counter(5000)},
+		{TS: at(9, 12), Level: rpm(700), Counter: counter(5020)},
+		{TS: at(10, 12), Level: rpm(700), Counter: counter(5030)},
+		{TS: at(11, 12), Level: rpm(700), Counter: counter(0)},
+	}
+	days = Daily(samples, at(8, 0), EngineOptions)
+	if len(days) != 4 {
+		t.Fatalf("Expected 4 days, got %+v", days)
+	}
+	want := []float64{10, 15, 5, 0}
+	for i, d := range days {
+		if d.Hours != want[i] {
+			t.Errorf("%s: expected %v hours, got %+v", d.Day, want[i], d)
+		}
+	}
+	if days[0].Source != FromCounter || *days[1].Counter != 5020 || days[3].Source != FromRPM || *days[3].Counter != 0 {
+		t.Errorf("Unexpected sources or counters %+v", days)
+	}
+}
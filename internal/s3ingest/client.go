@@ -0,0 +1,282 @@
+package s3ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// errNoSuchKey is returned by get for objects deleted since listed.
+var errNoSuchKey = errors.New("object not found")
+
+// client speaks the few S3 calls needed, signed with AWS Signature Version 4,
+// to any S3-compatible service. Buckets are addressed path-style
+// (endpoint/bucket/key), which AWS and MinIO both accept.
+type client struct {
+	http      *http.Client
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	bucket    string
+	now       func() time.Time
+}
+
+// object is an entry of a bucket listing.
+type object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+}
+
+type listResult struct {
+	Contents              []object `xml:"Contents"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// list returns one page of the objects under prefix, and the token of the
+// next page, "" after the last.
+func (c *client) list(ctx context.Context, prefix, token string) ([]object, string, error) {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	resp, err := c.do(ctx, http.MethodGet, "", query, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var result listResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, "", fmt.Errorf("decoding bucket listing: %w", err)
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+	return result.Contents, result.NextContinuationToken, nil
+}
+
+// get downloads an object of at most maxBytes and returns it with its ETag.
+func (c *client) get(ctx context.Context, key string, maxBytes int64) ([]byte, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength > maxBytes {
+		return nil, "", outbound.Permanent(fmt.Errorf("object exceeds %d MB", maxBytes>>20))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", outbound.Permanent(fmt.Errorf("object exceeds %d MB", maxBytes>>20))
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Tags    []tag    `xml:"TagSet>Tag"`
+}
+
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// setTags sets tags on an object, keeping the other tags it has.
+func (c *client) setTags(ctx context.Context, key string, tags map[string]string) error {
+	resp, err := c.do(ctx, http.MethodGet, key, url.Values{"tagging": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	var current tagging
+	err = xml.NewDecoder(resp.Body).Decode(&current)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("decoding object tags: %w", err)
+	}
+
+	merged := tagging{}
+	for _, t := range current.Tags {
+		if _, ok := tags[t.Key]; !ok {
+			merged.Tags = append(merged.Tags, t)
+		}
+	}
+	for k, v := range tags {
+		merged.Tags = append(merged.Tags, tag{Key: k, Value: v})
+	}
+	sort.Slice(merged.Tags, func(i, j int) bool { return merged.Tags[i].Key < merged.Tags[j].Key })
+	body, err := xml.Marshal(merged)
+	if err != nil {
+		return outbound.Permanent(err)
+	}
+	resp, err = c.do(ctx, http.MethodPut, key, url.Values{"tagging": {""}}, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3Error is the body of an S3 error response.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed request for an object of the bucket (the bucket itself
+// if key is empty). Responses other than 2xx become errors, permanent
+// unless the service is failing or throttling.
+func (c *client) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	// Sent encoded as signed
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, outbound.Permanent(err)
+	}
+	if body != nil {
+		sum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	c.sign(req, body)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var e s3Error
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+	if e.Code == "NoSuchKey" {
+		return nil, outbound.Permanent(errNoSuchKey)
+	}
+	err = fmt.Errorf("s3 returned %s", resp.Status)
+	if e.Code != "" {
+		err = fmt.Errorf("s3 returned %s: %s: %s", resp.Status, e.Code, e.Message)
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, err
+	}
+	return nil, outbound.Permanent(err)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (c *client) sign(req *http.Request, body []byte) {
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + c.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by name, as both the request and its
+// signature need it.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '.' || ch == '_' || ch == '~' || ch == '/' && !encodeSlash {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
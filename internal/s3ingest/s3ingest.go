@@ -0,0 +1,350 @@
+// Package s3ingest ingests the telemetry files put into an S3-compatible
+// bucket (AWS S3, MinIO...), under a prefix.
+//
+// The bucket is listed periodically, and objects can also be announced as
+// they are created through the bucket's event notifications (see Notify).
+// Every object is recorded in the database with the ETag tried and the upload
+// it became, so each version is ingested once. Objects that fail are tagged
+// ingest-status=failed in the bucket and tried again with a growing delay,
+// at most a few times, or as soon as a new version is put.
+package s3ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/store"
+)
+
+// maxObjectSize bounds the objects downloaded.
+const maxObjectSize = 256 << 20
+
+// maxRetryDelay caps the delay between attempts at a failing object.
+const maxRetryDelay = 24 * time.Hour
+
+// Config says which bucket to watch and how.
+type Config struct {
+	Endpoint  string // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// Interval between listings; 0 only ingests the objects notified.
+	Interval time.Duration
+	// MaxAttempts bounds how often a failing object is tried.
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry, doubled after each.
+	RetryBackoff time.Duration
+}
+
+// Processor ingests the files collected.
+type Processor interface {
+	ProcessDropped(ctx context.Context, data []byte, filename, imo, vesselName, source string) (ingest.DroppedResult, error)
+}
+
+// Watcher ingests the new objects of a bucket.
+type Watcher struct {
+	store     store.Store
+	processor Processor
+	client    *client
+	out       *outbound.Integration
+	cfg       Config
+	notified  chan string
+	mu        sync.Mutex // one object at a time, whether listed or notified
+}
+
+// NewWatcher creates a watcher of the bucket cfg names. Requests to the
+// bucket are guarded by policy.
+func NewWatcher(st store.Store, processor Processor, cfg Config, policy outbound.Policy) (*Watcher, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("no bucket")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	return &Watcher{
+		store:     st,
+		processor: processor,
+		client: &client{
+			http:      &http.Client{}, // timeouts come from the policy
+			endpoint:  endpoint,
+			region:    cfg.Region,
+			accessKey: cfg.AccessKey,
+			secretKey: cfg.SecretKey,
+			bucket:    cfg.Bucket,
+			now:       time.Now,
+		},
+		out:      outbound.New("s3:"+cfg.Bucket, policy),
+		cfg:      cfg,
+		notified: make(chan string, 1000),
+	}, nil
+}
+
+// Bucket returns the name of the bucket watched.
+func (w *Watcher) Bucket() string {
+	return w.cfg.Bucket
+}
+
+// Run lists the bucket every interval, and ingests the objects notified in
+// between, until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	var tick <-chan time.Time
+	if w.cfg.Interval > 0 {
+		ticker := time.NewTicker(w.cfg.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+		w.PollOnce(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			w.PollOnce(ctx)
+		case key := <-w.notified:
+			if err := w.IngestKey(ctx, key); err != nil {
+				log.Printf("s3 %s: %s: %v", w.cfg.Bucket, key, err)
+			}
+		}
+	}
+}
+
+// Notify queues objects reported created, e.g. by the bucket's event
+// notifications, and returns how many were queued. Keys outside the prefix,
+// not a file to ingest, or beyond what the queue holds are left to the
+// next listing.
+func (w *Watcher) Notify(keys ...string) int {
+	queued := 0
+	for _, key := range keys {
+		if !w.wanted(key) {
+			continue
+		}
+		select {
+		case w.notified <- key:
+			queued++
+		default:
+		}
+	}
+	return queued
+}
+
+func (w *Watcher) wanted(key string) bool {
+	return strings.HasPrefix(key, w.cfg.Prefix) && ingest.IsDroppedFile(key)
+}
+
+// PollOnce lists the bucket and ingests the objects not ingested yet.
+func (w *Watcher) PollOnce(ctx context.Context) {
+	token := ""
+	for {
+		var objects []object
+		err := w.out.Do(ctx, func(ctx context.Context) error {
+			var err error
+			objects, token, err = w.client.list(ctx, w.cfg.Prefix, token)
+			return err
+		})
+		if err != nil {
+			log.Printf("s3 %s: listing: %v", w.cfg.Bucket, err)
+			return
+		}
+		for _, o := range objects {
+			if ctx.Err() != nil {
+				return
+			}
+			if !w.wanted(o.Key) {
+				continue
+			}
+			if err := w.ingest(ctx, o.Key, o.ETag); err != nil {
+				log.Printf("s3 %s: %s: %v", w.cfg.Bucket, o.Key, err)
+			}
+		}
+		if token == "" {
+			return
+		}
+	}
+}
+
+// IngestKey ingests an object unless its current version was already.
+func (w *Watcher) IngestKey(ctx context.Context, key string) error {
+	return w.ingest(ctx, key, "")
+}
+
+// ingest ingests an object whose listed ETag is etag, "" if not known,
+// unless it was already or is waiting for a retry.
+func (w *Watcher) ingest(ctx context.Context, key, etag string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rec, err := w.store.BucketObject(ctx, w.cfg.Bucket, key)
+	if errors.Is(err, store.ErrNotFound) {
+		rec = nil
+	} else if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if rec != nil && etag != "" && rec.ETag == etag && !w.due(rec, now) {
+		return nil
+	}
+
+	var data []byte
+	err = w.out.Do(ctx, func(ctx context.Context) error {
+		var err error
+		data, etag, err = w.client.get(ctx, key, maxObjectSize)
+		return err
+	})
+	if errors.Is(err, errNoSuchKey) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if rec != nil && rec.ETag == etag && !w.due(rec, now) {
+		return nil
+	}
+
+	result, err := w.processor.ProcessDropped(ctx, data, key, imoOf(strings.TrimPrefix(key, w.cfg.Prefix)), "", models.SourceSensor)
+	if err == nil && result.Status == "failed" {
+		err = errors.New("no file of the archive could be ingested")
+	}
+	if errors.Is(err, ingest.ErrQuotaExceeded) {
+		// The file is fine; it is tried again next listing
+		return err
+	}
+	if err != nil {
+		return w.fail(ctx, key, etag, rec, err, now)
+	}
+
+	o := models.BucketObject{Bucket: w.cfg.Bucket, Key: key, ETag: etag, Status: result.Status, UpdatedAt: now}
+	if len(result.UploadIDs) > 0 {
+		o.UploadID = &result.UploadIDs[0]
+	}
+	if err := w.store.PutBucketObject(ctx, o); err != nil {
+		return err
+	}
+	log.Printf("s3 %s: %s: %s", w.cfg.Bucket, key, result.Status)
+	if rec != nil && rec.Status == "failed" {
+		w.tag(ctx, key, map[string]string{"ingest-status": result.Status, "ingest-error": ""})
+	}
+	return nil
+}
+
+// due reports whether a recorded object is to be tried again: it failed,
+// has attempts left and its retry time has come.
+func (w *Watcher) due(rec *models.BucketObject, now time.Time) bool {
+	return rec.Status == "failed" && rec.Attempts < w.cfg.MaxAttempts && rec.RetryAt != nil && !now.Before(*rec.RetryAt)
+}
+
+// fail records a failed attempt at an object and tags it in the bucket.
+func (w *Watcher) fail(ctx context.Context, key, etag string, rec *models.BucketObject, cause error, now time.Time) error {
+	o := models.BucketObject{Bucket: w.cfg.Bucket, Key: key, ETag: etag, Status: "failed", Error: cause.Error(), Attempts: 1, UpdatedAt: now}
+	if rec != nil && rec.ETag == etag {
+		o.Attempts = rec.Attempts + 1
+	}
+	if o.Attempts < w.cfg.MaxAttempts {
+		delay := w.cfg.RetryBackoff
+		for i := 1; i < o.Attempts && delay < maxRetryDelay; i++ {
+			delay *= 2
+		}
+		retryAt := now.Add(min(delay, maxRetryDelay))
+		o.RetryAt = &retryAt
+	}
+	if err := w.store.PutBucketObject(ctx, o); err != nil {
+		return err
+	}
+	w.tag(ctx, key, map[string]string{"ingest-status": "failed", "ingest-error": tagValue(cause.Error())})
+	return fmt.Errorf("attempt %d of %d: %w", o.Attempts, w.cfg.MaxAttempts, cause)
+}
+
+// tag sets tags on an object; failing to is only logged, the database has
+// the outcome anyway.
+func (w *Watcher) tag(ctx context.Context, key string, tags map[string]string) {
+	err := w.out.Do(ctx, func(ctx context.Context) error {
+		return w.client.setTags(ctx, key, tags)
+	})
+	if err != nil {
+		log.Printf("s3 %s: %s: tagging: %v", w.cfg.Bucket, key, err)
+	}
+}
+
+// tagValue fits s into an S3 tag value: at most 256 characters of letters,
+// digits, spaces and + - = . _ : / @.
+func tagValue(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if b.Len() >= 256 {
+			break
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune(" +-=._:/@", r):
+			b.WriteRune(r)
+		default:
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// imoOf returns the IMO number a key names by its first folder, as in
+// 9811000/2025-08-08.xlsx, or "" for the workbook to name the vessel.
+func imoOf(key string) string {
+	folder, _, ok := strings.Cut(key, "/")
+	if !ok || len(folder) != 7 {
+		return ""
+	}
+	for _, r := range folder {
+		if r < '0' || r > '9' {
+			return ""
+		}
+	}
+	return folder
+}
+
+// Event is an S3 event notification, as AWS and MinIO send them.
+type Event struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// CreatedKeys returns the keys of the objects of bucket an event reports
+// created. Keys come URL-encoded in events.
+func (e Event) CreatedKeys(bucket string) []string {
+	var keys []string
+	for _, r := range e.Records {
+		if r.S3.Bucket.Name != bucket || !strings.Contains(r.EventName, "ObjectCreated:") {
+			continue
+		}
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,339 @@
+// Package sftpingest collects telemetry files from SFTP servers, the way
+// satcom providers pass on what vessels send ashore.
+//
+// Each remote is a directory on a server, usually one per vessel. Every poll
+// lists it, downloads the workbooks and ZIP archives that have not changed
+// for a while (so files still being written are left alone), ingests them
+// and moves each file ingested, or already ingested before, to the remote's
+// archive directory. Files that fail stay where they are and are not tried
+// again until they change.
+package sftpingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// maxFileSize bounds the files downloaded.
+const maxFileSize = 256 << 20
+
+// DefaultArchiveDir is where ingested files go when a remote names no
+// archive directory, relative to its directory.
+const DefaultArchiveDir = "processed"
+
+// Remote is a directory files are collected from, as configured in the
+// remotes file.
+type Remote struct {
+	// Name identifies the remote in logs and metrics; defaults to the host
+	// and directory.
+	Name string `json:"name"`
+	// IMO or VesselName say which vessel files that name none belong to,
+	// as the imo and vessel_name parameters of an upload do.
+	IMO        string `json:"imo"`
+	VesselName string `json:"vessel_name"`
+
+	Host string `json:"host"` // host or host:port
+	User string `json:"user"`
+	// Password or PrivateKeyFile (with PrivateKeyPassphrase if encrypted)
+	// authenticate the user.
+	Password             string `json:"password"`
+	PrivateKeyFile       string `json:"private_key_file"`
+	PrivateKeyPassphrase string `json:"private_key_passphrase"`
+	// HostKey is the server's public key in authorized_keys format, e.g.
+	// "ssh-ed25519 AAAA..."; InsecureIgnoreHostKey skips the check.
+	HostKey               string `json:"host_key"`
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key"`
+
+	Dir        string `json:"dir"`
+	ArchiveDir string `json:"archive_dir"` // absolute, or relative to Dir
+	// Source tags the readings of the remote's files; sensor if empty.
+	Source string `json:"source"`
+}
+
+// LoadRemotes reads a JSON array of remotes and checks them.
+func LoadRemotes(file string) ([]Remote, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var remotes []Remote
+	if err := json.Unmarshal(data, &remotes); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	for i := range remotes {
+		r := &remotes[i]
+		if r.Host == "" || r.User == "" || r.Dir == "" {
+			return nil, fmt.Errorf("%s: remote %d needs host, user and dir", file, i+1)
+		}
+		if r.IMO == "" && r.VesselName == "" {
+			return nil, fmt.Errorf("%s: remote %d needs imo or vessel_name", file, i+1)
+		}
+		if r.Password == "" && r.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("%s: remote %d needs password or private_key_file", file, i+1)
+		}
+		if r.HostKey == "" && !r.InsecureIgnoreHostKey {
+			return nil, fmt.Errorf("%s: remote %d needs host_key", file, i+1)
+		}
+		if r.Source == "" {
+			r.Source = models.SourceSensor
+		}
+		if r.Name == "" {
+			r.Name = r.Host + ":" + r.Dir
+		}
+		if r.ArchiveDir == "" {
+			r.ArchiveDir = DefaultArchiveDir
+		}
+		if !path.IsAbs(r.ArchiveDir) {
+			r.ArchiveDir = path.Join(r.Dir, r.ArchiveDir)
+		}
+	}
+	return remotes, nil
+}
+
+// Processor ingests the files collected.
+type Processor interface {
+	ProcessDropped(ctx context.Context, data []byte, filename, imo, vesselName, source string) (ingest.DroppedResult, error)
+}
+
+// remoteFS is what is needed of an SFTP session.
+type remoteFS interface {
+	ReadDir(dir string) ([]fs.FileInfo, error)
+	Open(name string) (io.ReadCloser, error)
+	Rename(oldname, newname string) error
+	MkdirAll(dir string) error
+	Close() error
+}
+
+type remote struct {
+	Remote
+	out *outbound.Integration
+	// failed holds the modification time of files that failed, so they
+	// are only tried again once changed
+	failed map[string]time.Time
+}
+
+// Poller collects the files of every remote.
+type Poller struct {
+	processor Processor
+	remotes   []*remote
+	minAge    time.Duration
+	dial      func(ctx context.Context, r Remote) (remoteFS, error)
+}
+
+// NewPoller creates a poller that ingests files once they have not changed
+// for minAge. Connections are guarded by policy, one integration per remote.
+func NewPoller(processor Processor, remotes []Remote, minAge time.Duration, policy outbound.Policy) *Poller {
+	p := &Poller{processor: processor, minAge: minAge, dial: dialSFTP}
+	for _, r := range remotes {
+		p.remotes = append(p.remotes, &remote{Remote: r, out: outbound.New("sftp:"+r.Name, policy), failed: make(map[string]time.Time)})
+	}
+	return p
+}
+
+// PollOnce collects the files of every remote.
+func (p *Poller) PollOnce(ctx context.Context) {
+	for _, r := range p.remotes {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := p.poll(ctx, r); err != nil {
+			log.Printf("sftp %s: %v", r.Name, err)
+		}
+	}
+}
+
+func (p *Poller) poll(ctx context.Context, r *remote) error {
+	var conn remoteFS
+	var files []fs.FileInfo
+	err := r.out.Do(ctx, func(ctx context.Context) error {
+		c, err := p.dial(ctx, r.Remote)
+		if err != nil {
+			return err
+		}
+		if files, err = c.ReadDir(r.Dir); err != nil {
+			c.Close()
+			return err
+		}
+		conn = c
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Oldest first, so readings arrive in the order they were sent
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	archiveReady := false
+	now := time.Now()
+	for _, fi := range files {
+		if ctx.Err() != nil {
+			return nil
+		}
+		name := fi.Name()
+		if !fi.Mode().IsRegular() || !ingest.IsDroppedFile(name) || now.Sub(fi.ModTime()) < p.minAge {
+			continue
+		}
+		if failedAt, ok := r.failed[name]; ok && failedAt.Equal(fi.ModTime()) {
+			continue
+		}
+		if fi.Size() > maxFileSize {
+			log.Printf("sftp %s: %s: file exceeds %d MB", r.Name, name, maxFileSize>>20)
+			r.failed[name] = fi.ModTime()
+			continue
+		}
+
+		status, err := p.ingest(ctx, conn, r, name)
+		if err != nil {
+			log.Printf("sftp %s: %s: %v", r.Name, name, err)
+			// Over quota the file is fine; it is tried again next poll
+			if !errors.Is(err, ingest.ErrQuotaExceeded) {
+				r.failed[name] = fi.ModTime()
+			}
+			continue
+		}
+		delete(r.failed, name)
+		log.Printf("sftp %s: %s: %s", r.Name, name, status)
+
+		if !archiveReady {
+			if err := conn.MkdirAll(r.ArchiveDir); err != nil {
+				return fmt.Errorf("creating %s: %w", r.ArchiveDir, err)
+			}
+			archiveReady = true
+		}
+		if err := archive(conn, path.Join(r.Dir, name), r.ArchiveDir, now); err != nil {
+			// Left in place it would be read again each poll, but never
+			// ingested twice
+			log.Printf("sftp %s: %s: moving to %s: %v", r.Name, name, r.ArchiveDir, err)
+		}
+	}
+	return nil
+}
+
+// ingest downloads and ingests one file.
+func (p *Poller) ingest(ctx context.Context, conn remoteFS, r *remote, name string) (string, error) {
+	f, err := conn.Open(path.Join(r.Dir, name))
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxFileSize {
+		return "", fmt.Errorf("file exceeds %d MB", maxFileSize>>20)
+	}
+	result, err := p.processor.ProcessDropped(ctx, data, name, r.IMO, r.VesselName, r.Source)
+	if err != nil {
+		return "", err
+	}
+	if result.Status == "failed" {
+		return "", errors.New("no file of the archive could be ingested")
+	}
+	return result.Status, nil
+}
+
+// archive moves a file into dir, adding a timestamp to its name if dir
+// already has a file of that name.
+func archive(conn remoteFS, file, dir string, now time.Time) error {
+	target := path.Join(dir, path.Base(file))
+	if err := conn.Rename(file, target); err == nil {
+		return nil
+	}
+	ext := path.Ext(target)
+	return conn.Rename(file, strings.TrimSuffix(target, ext)+now.UTC().Format(".20060102T150405Z")+ext)
+}
+
+// dialSFTP opens an SFTP session to a remote.
+func dialSFTP(ctx context.Context, r Remote) (remoteFS, error) {
+	cfg := &ssh.ClientConfig{User: r.User}
+	if r.Password != "" {
+		cfg.Auth = append(cfg.Auth, ssh.Password(r.Password))
+	}
+	if r.PrivateKeyFile != "" {
+		key, err := os.ReadFile(r.PrivateKeyFile)
+		if err != nil {
+			return nil, outbound.Permanent(err)
+		}
+		var signer ssh.Signer
+		if r.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(r.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, outbound.Permanent(fmt.Errorf("%s: %w", r.PrivateKeyFile, err))
+		}
+		cfg.Auth = append(cfg.Auth, ssh.PublicKeys(signer))
+	}
+	if r.InsecureIgnoreHostKey {
+		cfg.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(r.HostKey))
+		if err != nil {
+			return nil, outbound.Permanent(fmt.Errorf("invalid host_key: %w", err))
+		}
+		cfg.HostKeyCallback = ssh.FixedHostKey(hostKey)
+	}
+
+	addr := r.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// The handshake does not watch ctx itself
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, cfg)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+	client := ssh.NewClient(sshConn, chans, reqs)
+	session, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &sftpFS{session, client}, nil
+}
+
+// sftpFS is an SFTP session over its SSH connection.
+type sftpFS struct {
+	*sftp.Client
+	ssh *ssh.Client
+}
+
+func (s *sftpFS) Open(name string) (io.ReadCloser, error) {
+	return s.Client.Open(name)
+}
+
+func (s *sftpFS) Close() error {
+	s.Client.Close()
+	return s.ssh.Close()
+}
@@ -0,0 +1,170 @@
+package sftpingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+type fakeFile struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+
+func (f fakeFile) Name() string       { return path.Base(f.name) }
+func (f fakeFile) Size() int64        { return int64(len(f.data)) }
+func (f fakeFile) Mode() fs.FileMode  { return 0o644 }
+func (f fakeFile) ModTime() time.Time { return f.modTime }
+func (f fakeFile) IsDir() bool        { return false }
+func (f fakeFile) Sys() interface{}   { return nil }
+
+// fakeFS is a remote directory tree of files by path.
+type fakeFS struct {
+	files map[string]fakeFile
+	dirs  map[string]bool
+}
+
+func (f *fakeFS) ReadDir(dir string) ([]fs.FileInfo, error) {
+	var list []fs.FileInfo
+	for name, file := range f.files {
+		if path.Dir(name) == dir {
+			list = append(list, file)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+func (f *fakeFS) Open(name string) (io.ReadCloser, error) {
+	file, ok := f.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(file.data)), nil
+}
+
+func (f *fakeFS) Rename(oldname, newname string) error {
+	if _, ok := f.files[newname]; ok {
+		return os.ErrExist
+	}
+	file := f.files[oldname]
+	delete(f.files, oldname)
+	file.name = newname
+	f.files[newname] = file
+	return nil
+}
+
+func (f *fakeFS) MkdirAll(dir string) error { f.dirs[dir] = true; return nil }
+func (f *fakeFS) Close() error              { return nil }
+
+type fakeProcessor struct{ ingested []string }
+
+func (p *fakeProcessor) ProcessDropped(ctx context.Context, data []byte, filename, imo, vesselName, source string) (ingest.DroppedResult, error) {
+	switch string(data) {
+	case "broken":
+		return ingest.DroppedResult{}, ingest.ErrUnsupportedFormat
+	case "over quota":
+		return ingest.DroppedResult{}, ingest.ErrQuotaExceeded
+	}
+	p.ingested = append(p.ingested, filename)
+	return ingest.DroppedResult{Status: "ingested"}, nil
+}
+
+func TestPollOnce(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	remoteFiles := &fakeFS{dirs: map[string]bool{}, files: map[string]fakeFile{}}
+	for _, f := range []fakeFile{
+		{"/out/day2.xlsx", []byte("ok"), old.Add(time.Minute)},
+		{"/out/day1.xlsx", []byte("ok"), old},
+		{"/out/writing.xlsx", []byte("ok"), time.Now()},
+		{"/out/readme.txt", []byte("ok"), old},
+		{"/out/~$day1.xlsx", []byte("ok"), old},
+		{"/out/broken.xls", []byte("broken"), old},
+		{"/out/quota.xlsx", []byte("over quota"), old},
+		{"/out/processed/day1.xlsx", []byte("ok"), old},
+	} {
+		remoteFiles.files[f.name] = f
+	}
+
+	processor := &fakeProcessor{}
+	p := NewPoller(processor, []Remote{{Name: "test", IMO: "9811000", Dir: "/out", ArchiveDir: "/out/processed"}}, time.Minute, outbound.Policy{})
+	dials := 0
+	p.dial = func(ctx context.Context, r Remote) (remoteFS, error) {
+		dials++
+		return remoteFiles, nil
+	}
+	p.PollOnce(context.Background())
+
+	if strings.Join(processor.ingested, ",") != "day1.xlsx,day2.xlsx" {
+		t.Errorf("Expected day1 then day2, got %v", processor.ingested)
+	}
+	for _, name := range []string{"/out/processed/day2.xlsx", "/out/writing.xlsx", "/out/broken.xls", "/out/quota.xlsx", "/out/readme.txt"} {
+		if _, ok := remoteFiles.files[name]; !ok {
+			t.Errorf("Expected %s", name)
+		}
+	}
+	renamed := 0
+	for name := range remoteFiles.files {
+		if strings.HasPrefix(name, "/out/processed/day1.2") {
+			renamed++
+		}
+	}
+	if renamed != 1 || len(remoteFiles.files) != 8 {
+		t.Errorf("Expected day1 archived under a new name, got %v", remoteFiles.files)
+	}
+
+	// The broken file is not tried again until it changes; the quota is
+	processor.ingested = nil
+	p.PollOnce(context.Background())
+	if len(processor.ingested) != 0 || dials != 2 {
+		t.Errorf("Expected nothing new, got %v", processor.ingested)
+	}
+	broken := remoteFiles.files["/out/broken.xls"]
+	broken.data, broken.modTime = []byte("fixed"), old.Add(time.Second)
+	remoteFiles.files["/out/broken.xls"] = broken
+	p.PollOnce(context.Background())
+	if strings.Join(processor.ingested, ",") != "broken.xls" {
+		t.Errorf("Expected the fixed file, got %v", processor.ingested)
+	}
+}
+
+func TestPollOnceDialError(t *testing.T) {
+	p := NewPoller(&fakeProcessor{}, []Remote{{Name: "down", Dir: "/out"}}, 0, outbound.Policy{FailureThreshold: 1, OpenDuration: time.Hour})
+	p.dial = func(ctx context.Context, r Remote) (remoteFS, error) {
+		return nil, errors.New("connection refused")
+	}
+	p.PollOnce(context.Background())
+	if status := p.remotes[0].out.Status(); status.State != outbound.StateOpen {
+		t.Errorf("Expected the circuit to open, got %+v", status)
+	}
+}
+
+func TestLoadRemotes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "remotes.json")
+	os.WriteFile(file, []byte(`[{"imo": "9811000", "host": "sftp.example.com", "user": "ship", "password": "x", "host_key": "ssh-ed25519 AAAA", "dir": "/outbox"}]`), 0o600)
+	remotes, err := LoadRemotes(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := remotes[0]; r.ArchiveDir != "/outbox/processed" || r.Source != "sensor" || r.Name != "sftp.example.com:/outbox" {
+		t.Errorf("Unexpected defaults %+v", r)
+	}
+
+	os.WriteFile(file, []byte(`[{"imo": "9811000", "host": "sftp.example.com", "user": "ship", "password": "x", "dir": "/outbox"}]`), 0o600)
+	if _, err := LoadRemotes(file); err == nil || !strings.Contains(err.Error(), "host_key") {
+		t.Errorf("Expected host_key to be required, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Package shipdata reads ISO 19848 ship data packages, the JSON that
+// ISO 19847 shipboard data servers send ashore: tabular data (one value per
+// data channel per time stamp) and event data (one channel's value at a
+// time), each channel named by its ID.
+//
+// Channel IDs are local IDs (e.g. /dnv-v2/vis-3-4a/411.1-1/C101.31/meta/
+// qty-revolution), or universal IDs naming the ship as well
+// (data.dnv.com/IMO1234567/dnv-v2/...); both are read as the local ID. A
+// starter catalog maps well-known local IDs to stream fields; vessels map
+// their own through the API.
+package shipdata
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//go:embed channels.json
+var bundledCatalog []byte
+
+// Location is the stream name mappings of position channels use; the
+// newest position of a package is the vessel's position, as a Ship Info
+// sheet's is. It is ingest.FeedLocation.
+const Location = "location"
+
+// LocationFields are the fields of the location stream channels map to.
+var LocationFields = []string{"latitude", "longitude", "speed_knots", "course_degrees"}
+
+// Package is the JSON document of a ship data package.
+type Package struct {
+	Package struct {
+		Header         Header       `json:"Header"`
+		TimeSeriesData []TimeSeries `json:"TimeSeriesData"`
+	} `json:"Package"`
+}
+
+// Header identifies the ship and the span of the data.
+type Header struct {
+	ShipID   string `json:"ShipID"`
+	TimeSpan *struct {
+		Start time.Time `json:"Start"`
+		End   time.Time `json:"End"`
+	} `json:"TimeSpan,omitempty"`
+	Author string `json:"Author,omitempty"`
+}
+
+// TimeSeries is the data of one data channel list configuration.
+type TimeSeries struct {
+	TabularData []Tabular `json:"TabularData"`
+	EventData   *Events   `json:"EventData,omitempty"`
+}
+
+// Tabular is a table of values: a column per data channel, a row per time
+// stamp.
+type Tabular struct {
+	DataChannelID []string     `json:"DataChannelID"`
+	DataSet       []TabularRow `json:"DataSet"`
+}
+
+// TabularRow is the values of the channels at one time stamp, in the order
+// of DataChannelID; an empty value means none.
+type TabularRow struct {
+	TimeStamp time.Time `json:"TimeStamp"`
+	Value     []string  `json:"Value"`
+	Quality   []string  `json:"Quality,omitempty"`
+}
+
+// Events is a list of channel values at their own time stamps.
+type Events struct {
+	DataSet []Event `json:"DataSet"`
+}
+
+// Event is the value of one channel at a time stamp.
+type Event struct {
+	TimeStamp     time.Time `json:"TimeStamp"`
+	DataChannelID string    `json:"DataChannelID"`
+	Value         string    `json:"Value"`
+	Quality       *string   `json:"Quality,omitempty"`
+}
+
+// Sample is one value of a channel.
+type Sample struct {
+	ChannelID string // local ID
+	TS        time.Time
+	Value     string
+	Quality   *string
+	// Event is set for event data
+	Event bool
+}
+
+// Parse reads a ship data package, checking that every row of a table has a
+// value for each of its channels.
+func Parse(data []byte) (*Package, error) {
+	var p Package
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid ISO 19848 package: %w", err)
+	}
+	if len(p.Package.TimeSeriesData) == 0 {
+		return nil, fmt.Errorf("invalid ISO 19848 package: no TimeSeriesData")
+	}
+	for _, ts := range p.Package.TimeSeriesData {
+		for _, t := range ts.TabularData {
+			for _, row := range t.DataSet {
+				if len(row.Value) != len(t.DataChannelID) || (row.Quality != nil && len(row.Quality) != len(t.DataChannelID)) {
+					return nil, fmt.Errorf("invalid ISO 19848 package: data set at %s has %d values for %d data channels",
+						row.TimeStamp.Format(time.RFC3339), len(row.Value), len(t.DataChannelID))
+				}
+				if row.TimeStamp.IsZero() {
+					return nil, fmt.Errorf("invalid ISO 19848 package: data set without TimeStamp")
+				}
+			}
+		}
+		if ts.EventData != nil {
+			for _, e := range ts.EventData.DataSet {
+				if e.TimeStamp.IsZero() || strings.TrimSpace(e.DataChannelID) == "" {
+					return nil, fmt.Errorf("invalid ISO 19848 package: event without TimeStamp or DataChannelID")
+				}
+			}
+		}
+	}
+	return &p, nil
+}
+
+// imoNumber finds the IMO number in a ship ID.
+var imoNumber = regexp.MustCompile(`(?i)(?:^|[^0-9])(?:IMO)?([0-9]{7})(?:[^0-9]|$)`)
+
+// IMO returns the IMO number of the ship ID in the header, "" if it has
+// none (e.g. an MMSI or a name).
+func (p *Package) IMO() string {
+	m := imoNumber.FindStringSubmatch(p.Package.Header.ShipID)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// Samples returns the values of the package, tables first, leaving out
+// empty ones.
+func (p *Package) Samples() []Sample {
+	var samples []Sample
+	for _, ts := range p.Package.TimeSeriesData {
+		for _, t := range ts.TabularData {
+			ids := make([]string, len(t.DataChannelID))
+			for i, id := range t.DataChannelID {
+				ids[i] = LocalID(id)
+			}
+			for _, row := range t.DataSet {
+				for i, v := range row.Value {
+					if strings.TrimSpace(v) == "" {
+						continue
+					}
+					s := Sample{ChannelID: ids[i], TS: row.TimeStamp.UTC(), Value: strings.TrimSpace(v)}
+					if row.Quality != nil {
+						q := row.Quality[i]
+						s.Quality = &q
+					}
+					samples = append(samples, s)
+				}
+			}
+		}
+		if ts.EventData != nil {
+			for _, e := range ts.EventData.DataSet {
+				if strings.TrimSpace(e.Value) == "" {
+					continue
+				}
+				samples = append(samples, Sample{ChannelID: LocalID(e.DataChannelID), TS: e.TimeStamp.UTC(), Value: strings.TrimSpace(e.Value), Quality: e.Quality, Event: true})
+			}
+		}
+	}
+	return samples
+}
+
+// LocalID returns the local ID of a channel ID: universal IDs lose the
+// naming authority and ship ID in front of it.
+func LocalID(id string) string {
+	id = strings.TrimSpace(id)
+	if parts := strings.SplitN(id, "/", 3); len(parts) == 3 && parts[0] != "" && strings.HasPrefix(strings.ToUpper(parts[1]), "IMO") {
+		return "/" + parts[2]
+	}
+	return id
+}
+
+// Mapping maps a data channel to a stream field; Unit is the engine, tank,
+// generator etc. for streams with units.
+type Mapping struct {
+	ChannelID string  `json:"channel_id"`
+	Stream    string  `json:"stream"`
+	Field     string  `json:"field"`
+	Unit      *string `json:"unit"`
+}
+
+// Catalog returns the bundled mappings of well-known local IDs.
+func Catalog() ([]Mapping, error) {
+	var mappings []Mapping
+	if err := json.Unmarshal(bundledCatalog, &mappings); err != nil {
+		return nil, fmt.Errorf("invalid bundled channel catalog: %w", err)
+	}
+	return mappings, nil
+}
+
+// Resolve returns the mapping of each channel: the vessel's own, else the
+// catalog's. Local IDs are compared case-insensitively.
+func Resolve(vessel, catalog []Mapping) map[string]Mapping {
+	mappings := make(map[string]Mapping, len(vessel)+len(catalog))
+	for _, list := range [][]Mapping{catalog, vessel} {
+		for _, m := range list {
+			mappings[strings.ToLower(LocalID(m.ChannelID))] = m
+		}
+	}
+	return mappings
+}
+
+// Lookup returns the mapping of a channel from those Resolve returns.
+func Lookup(mappings map[string]Mapping, channelID string) (Mapping, bool) {
+	m, ok := mappings[strings.ToLower(LocalID(channelID))]
+	return m, ok
+}
@@ -0,0 +1,77 @@
+package shipdata
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	pkg, err := Parse([]byte(`{"Package": {"Header": {"ShipID": "IMO9811000"}, "TimeSeriesData": [{
+		"TabularData": [{"DataChannelID": ["data.dnv.com/IMO9811000/dnv-v2/vis-3-4a/411.1-1/C101.31/meta/qty-revolution", "/a"],
+			"DataSet": [{"TimeStamp": "2025-08-08T12:00:00+02:00", "Value": ["80", ""], "Quality": ["0", "1"]}]}],
+		"EventData": {"DataSet": [{"TimeStamp": "2025-08-08T10:05:00Z", "DataChannelID": "/b", "Value": " open "}]}
+	}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.IMO() != "9811000" {
+		t.Errorf("Expected IMO 9811000, got %q", pkg.IMO())
+	}
+	samples := pkg.Samples()
+	if len(samples) != 2 {
+		t.Fatalf("Expected the empty value left out, got %+v", samples)
+	}
+	if s := samples[0]; s.ChannelID != "/dnv-v2/vis-3-4a/411.1-1/C101.31/meta/qty-revolution" || s.TS.Format("15:04") != "10:00" || s.Quality == nil || *s.Quality != "0" || s.Event {
+		t.Errorf("Unexpected tabular sample %+v", s)
+	}
+	if s := samples[1]; s.ChannelID != "/b" || s.Value != "open" || !s.Event {
+		t.Errorf("Unexpected event sample %+v", s)
+	}
+
+	for _, bad := range []string{
+		`[]`,
+		`{"Package": {"Header": {"ShipID": "IMO9811000"}}}`,
+		`{"Package": {"TimeSeriesData": [{"TabularData": [{"DataChannelID": ["/a", "/b"], "DataSet": [{"TimeStamp": "2025-08-08T12:00:00Z", "Value": ["1"]}]}]}]}}`,
+		`{"Package": {"TimeSeriesData": [{"TabularData": [{"DataChannelID": ["/a"], "DataSet": [{"Value": ["1"]}]}]}]}}`,
+		`{"Package": {"TimeSeriesData": [{"EventData": {"DataSet": [{"TimeStamp": "2025-08-08T12:00:00Z", "Value": "1"}]}}]}}`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestIMO(t *testing.T) {
+	for shipID, want := range map[string]string{
+		"IMO9811000":              "9811000",
+		"imo-9811000":             "9811000",
+		"9811000":                 "9811000",
+		"data.dnv.com/IMO9811000": "9811000",
+		"MMSI 244123456":          "",
+		"Equator":                 "",
+	} {
+		var p Package
+		p.Package.Header.ShipID = shipID
+		if got := p.IMO(); got != want {
+			t.Errorf("%s: expected %q, got %q", shipID, want, got)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	catalog, err := Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const rpm = "/dnv-v2/vis-3-4a/411.1-1/C101.31/meta/qty-revolution"
+	unit := "3"
+	mappings := Resolve([]Mapping{{ChannelID: "data.dnv.com/IMO9811000" + rpm, Stream: "engines", Field: "rpm", Unit: &unit}}, catalog)
+	if m, ok := Lookup(mappings, "/DNV-V2/vis-3-4a/411.1-1/C101.31/meta/qty-revolution"); !ok || m.Unit == nil || *m.Unit != "3" {
+		t.Errorf("Expected the vessel's mapping, got %+v", m)
+	}
+	if m, ok := Lookup(mappings, "/dnv-v2/vis-3-4a/411.1/meta/qty-latitude"); !ok || m.Stream != Location || m.Field != "latitude" {
+		t.Errorf("Expected the catalog's mapping, got %+v", m)
+	}
+	if _, ok := Lookup(mappings, "/unknown"); ok {
+		t.Error("Expected no mapping of an unknown channel")
+	}
+}
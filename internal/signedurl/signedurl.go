@@ -0,0 +1,111 @@
+// Package signedurl signs and verifies time-limited download links, so a
+// report or export can be shared with someone who holds no API key.
+//
+// A signed link is the resource's path and query plus expires (unix
+// seconds), signer (the signing key's fingerprint), an optional recipient
+// label and signature, an HMAC-SHA256 over the method, path and every other
+// query parameter. Changing any parameter, or the path, breaks the signature.
+//
+// Share tokens are signed alike and grant read-only access to one vessel's
+// data over a date range rather than to one resource.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Query parameters of a signed link.
+const (
+	ParamExpires   = "expires"
+	ParamSigner    = "signer"
+	ParamRecipient = "recipient"
+	ParamSignature = "signature"
+)
+
+var (
+	// ErrInvalid means the signature does not match the link.
+	ErrInvalid = errors.New("invalid signature")
+	// ErrExpired means the link was valid but has expired.
+	ErrExpired = errors.New("link expired")
+)
+
+// Link is what a verified link carries besides the resource.
+type Link struct {
+	Signer    string    `json:"signer"`
+	Recipient string    `json:"recipient,omitempty"`
+	Expires   time.Time `json:"expires_at"`
+}
+
+// Signed reports whether query carries a signature.
+func Signed(query url.Values) bool {
+	return query.Get(ParamSignature) != ""
+}
+
+// signature is the HMAC over the method, the path and the query without
+// the signature. url.Values.Encode sorts by key, so the order of the
+// parameters in the link does not matter.
+func signature(secret, method, path string, query url.Values) string {
+	unsigned := url.Values{}
+	for k, v := range query {
+		if k != ParamSignature {
+			unsigned[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + unsigned.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns query with the link parameters and signature added, encoded.
+// Link parameters already in query are replaced.
+func Sign(secret, method, path string, query url.Values, link Link) string {
+	signed := url.Values{}
+	for k, v := range query {
+		signed[k] = v
+	}
+	signed.Del(ParamSignature)
+	signed.Del(ParamRecipient)
+	signed.Set(ParamExpires, strconv.FormatInt(link.Expires.Unix(), 10))
+	signed.Set(ParamSigner, link.Signer)
+	if link.Recipient != "" {
+		signed.Set(ParamRecipient, link.Recipient)
+	}
+	signed.Set(ParamSignature, signature(secret, method, path, signed))
+	return signed.Encode()
+}
+
+// Verify checks a signed request against each of secrets, so a secret can
+// be rotated while links signed with the previous one stay valid.
+func Verify(secrets []string, method, path string, query url.Values, now time.Time) (*Link, error) {
+	got := query.Get(ParamSignature)
+	valid := false
+	for _, secret := range secrets {
+		if hmac.Equal([]byte(got), []byte(signature(secret, method, path, query))) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrInvalid
+	}
+
+	expires, err := strconv.ParseInt(query.Get(ParamExpires), 10, 64)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	link := &Link{
+		Signer:    query.Get(ParamSigner),
+		Recipient: query.Get(ParamRecipient),
+		Expires:   time.Unix(expires, 0).UTC(),
+	}
+	if !now.Before(link.Expires) {
+		return link, ErrExpired
+	}
+	return link, nil
+}
@@ -0,0 +1,85 @@
+package signedurl
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+	link := Link{Signer: "ab12", Recipient: "Surveyor", Expires: now.Add(time.Hour)}
+	encoded := Sign("secret", "GET", "/vessels/1/export", url.Values{"stream": {"engines"}, "format": {"csv"}}, link)
+	query, err := url.ParseQuery(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Verify([]string{"old", "secret"}, "GET", "/vessels/1/export", query, now)
+	if err != nil {
+		t.Fatalf("Expected a valid link, got %v", err)
+	}
+	if got.Signer != "ab12" || got.Recipient != "Surveyor" || !got.Expires.Equal(link.Expires) {
+		t.Errorf("Unexpected link %+v", got)
+	}
+
+	if _, err := Verify([]string{"secret"}, "GET", "/vessels/1/export", query, now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected the link to expire, got %v", err)
+	}
+	if _, err := Verify([]string{"other"}, "GET", "/vessels/1/export", query, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected another secret to fail, got %v", err)
+	}
+	if _, err := Verify([]string{"secret"}, "GET", "/vessels/2/export", query, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected another path to fail, got %v", err)
+	}
+
+	tampered := url.Values{}
+	for k, v := range query {
+		tampered[k] = v
+	}
+	tampered.Set("stream", "fuel")
+	if _, err := Verify([]string{"secret"}, "GET", "/vessels/1/export", tampered, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a changed parameter to fail, got %v", err)
+	}
+	tampered = url.Values{}
+	for k, v := range query {
+		tampered[k] = v
+	}
+	tampered.Set(ParamExpires, "9999999999")
+	if _, err := Verify([]string{"secret"}, "GET", "/vessels/1/export", tampered, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an extended expiry to fail, got %v", err)
+	}
+}
+
+func TestShare(t *testing.T) {
+	now := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+	share := Share{VesselID: 7, From: now.AddDate(0, 0, -7), To: now, Signer: "ab12", Recipient: "Acme", Expires: now.Add(time.Hour)}
+	token := SignShare("secret", share)
+
+	got, err := VerifyShare([]string{"old", "secret"}, token, now)
+	if err != nil {
+		t.Fatalf("Expected a valid token, got %v", err)
+	}
+	if *got != share {
+		t.Errorf("Expected %+v, got %+v", share, *got)
+	}
+
+	if _, err := VerifyShare([]string{"secret"}, token, now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected the token to expire, got %v", err)
+	}
+	if _, err := VerifyShare([]string{"other"}, token, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected another secret to fail, got %v", err)
+	}
+
+	// Claims of another vessel with the original signature
+	other := SignShare("secret", Share{VesselID: 8, From: share.From, To: share.To, Signer: "ab12", Expires: share.Expires})
+	claims, _, _ := strings.Cut(other, ".")
+	_, sig, _ := strings.Cut(token, ".")
+	for _, tampered := range []string{claims + "." + sig, token[:len(token)-1], "nodot", ""} {
+		if _, err := VerifyShare([]string{"secret"}, tampered, now); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected an invalid token, got %v", tampered, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Package sink publishes every inserted reading to a message broker (Kafka,
+// NATS JetStream), so a shore data lake ingests telemetry as it arrives
+// instead of re-querying the API.
+//
+// A sink is a consumer of the transactional outbox (see internal/outbox):
+// its cursor moves only once the broker has acknowledged a batch, so every
+// reading is published at least once, in insert order per vessel. Only
+// inserts are published: an upsert that updates a reading keeps its id.
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbox"
+	"vessel-telemetry-api/internal/store"
+)
+
+// Event is one reading to publish.
+type Event struct {
+	Stream    string
+	ReadingID int64
+	VesselID  int64
+	IMO       string // "" if the vessel has none
+	Value     []byte // the reading as the API returns it
+}
+
+// Publisher delivers events to one broker.
+type Publisher interface {
+	// Target names the publisher's outbox cursor, e.g. "kafka:" and the
+	// topic prefix, so it follows where events go rather than the servers.
+	Target() string
+	// Publish returns once the broker has every event. On error any part
+	// may have been delivered.
+	Publish(ctx context.Context, events []Event) error
+}
+
+// Source looks up the vessels of readings.
+type Source interface {
+	GetVessel(ctx context.Context, id int64) (*models.Vessel, error)
+}
+
+// Sink publishes the readings of some streams through a publisher.
+type Sink struct {
+	source    Source
+	publisher Publisher
+	streams   []string
+	interval  time.Duration
+}
+
+// New creates a sink publishing the readings of streams (all if empty)
+// every interval.
+func New(source Source, publisher Publisher, streams []string, interval time.Duration) *Sink {
+	return &Sink{source: source, publisher: publisher, streams: streams, interval: interval}
+}
+
+// Consumer returns the sink's outbox consumer, its cursor named after the
+// publisher's target.
+func (s *Sink) Consumer() outbox.Consumer {
+	return outbox.Consumer{
+		Name:     s.publisher.Target(),
+		Streams:  s.streams,
+		Interval: s.interval,
+		Deliver:  s.Deliver,
+	}
+}
+
+// Deliver publishes the readings of events in their order; readings deleted
+// since they were inserted are skipped.
+func (s *Sink) Deliver(ctx context.Context, events []store.OutboxEvent) error {
+	imos := map[int64]string{}
+	batch := make([]Event, 0, len(events))
+	for _, e := range events {
+		if e.Row == nil {
+			continue
+		}
+		imo, ok := imos[e.VesselID]
+		if !ok {
+			var err error
+			if imo, err = s.imo(ctx, e.VesselID); err != nil {
+				return err
+			}
+			imos[e.VesselID] = imo
+		}
+		value, err := json.Marshal(e.Row)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, Event{Stream: e.Stream, ReadingID: e.ReadingID, VesselID: e.VesselID, IMO: imo, Value: value})
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := s.publisher.Publish(ctx, batch); err != nil {
+		return fmt.Errorf("%s: %w", s.publisher.Target(), err)
+	}
+	return nil
+}
+
+// imo returns the IMO number of a vessel, "" if it has none or was deleted.
+func (s *Sink) imo(ctx context.Context, vesselID int64) (string, error) {
+	v, err := s.source.GetVessel(ctx, vesselID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if v.IMO == nil {
+		return "", nil
+	}
+	return *v.IMO, nil
+}
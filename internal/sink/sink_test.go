@@ -0,0 +1,113 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/store"
+)
+
+type fakePublisher struct {
+	batches [][]Event
+	err     error
+}
+
+func (p *fakePublisher) Target() string { return "fake:" }
+
+func (p *fakePublisher) Publish(ctx context.Context, events []Event) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.batches = append(p.batches, events)
+	return nil
+}
+
+func newTestStore(t *testing.T) *store.SQLStore {
+	t.Helper()
+	database, err := db.Connect(filepath.Join(t.TempDir(), "sink.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	return store.New(database)
+}
+
+func TestDeliver(t *testing.T) {
+	ctx := context.Background()
+	st := newTestStore(t)
+	imo := "9811000"
+	alpha, err := st.CreateVessel(ctx, models.Vessel{Name: "Alpha", IMO: &imo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bravo, err := st.CreateVessel(ctx, models.Vessel{Name: "Bravo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(vesselID int64, engine int, rpm float64) {
+		_, err := st.WriteReading(ctx, store.ReadingWrite{
+			Table: "engine_readings", UnitCol: "engine_no", Unit: engine, VesselID: vesselID,
+			TS:      time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC),
+			RowHash: strconv.FormatInt(vesselID, 10) + "/" + strconv.Itoa(engine),
+			Cols:    []string{"engine_no", "rpm", "extra_json"}, Vals: []interface{}{engine, rpm, []byte("{}")},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(alpha, 1, 1500)
+	write(bravo, 1, 1400)
+	write(alpha, 2, 1450)
+
+	events, err := st.OutboxEvents(ctx, 0, nil, 10)
+	if err != nil || len(events) != 3 {
+		t.Fatalf("Expected 3 outbox events, got %v, %v", events, err)
+	}
+	// A reading deleted since is skipped
+	events = append(events, store.OutboxEvent{Seq: 4, Stream: "engines", VesselID: bravo, ReadingID: 9})
+
+	publisher := &fakePublisher{}
+	s := New(st, publisher, []string{"engines", "fuel"}, time.Minute)
+	if c := s.Consumer(); c.Name != "fake:" || len(c.Streams) != 2 {
+		t.Errorf("Unexpected consumer %+v", c)
+	}
+	if err := s.Deliver(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.batches) != 1 || len(publisher.batches[0]) != 3 {
+		t.Fatalf("Unexpected batches %v", publisher.batches)
+	}
+	// In outbox order
+	for i, e := range publisher.batches[0] {
+		var reading map[string]interface{}
+		if err := json.Unmarshal(e.Value, &reading); err != nil {
+			t.Fatal(err)
+		}
+		if e.Stream != "engines" || e.ReadingID != int64(i+1) || reading["id"] != float64(i+1) || reading["vessel_id"] != float64(e.VesselID) {
+			t.Errorf("Unexpected event %+v", e)
+		}
+		if (e.VesselID == alpha && e.IMO != imo) || (e.VesselID == bravo && e.IMO != "") {
+			t.Errorf("Unexpected IMO %q of vessel %d", e.IMO, e.VesselID)
+		}
+	}
+
+	// Nothing left to publish, nothing sent
+	if err := s.Deliver(ctx, events[3:]); err != nil || len(publisher.batches) != 1 {
+		t.Errorf("Expected nothing published, got %v, %v", publisher.batches, err)
+	}
+
+	publisher.err = errors.New("broker down")
+	if err := s.Deliver(ctx, events); err == nil {
+		t.Error("Expected the error of the publisher")
+	}
+}
@@ -0,0 +1,245 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// Kinds are the kinds of device polled.
+var Kinds = []string{"camera", "nvr", "switch", "router", "firewall", "access_point", "other"}
+
+// Stream returns the stream the readings of a kind of device go to.
+func Stream(kind string) string {
+	if kind == "camera" || kind == "nvr" {
+		return "cctv"
+	}
+	return "network_device"
+}
+
+// Statuses reported when a device has no status OID, or does not answer.
+const (
+	StatusOnline  = "ONLINE"
+	StatusOffline = "OFFLINE"
+)
+
+// AvailabilityWindow is the span of polls availability is the share
+// answered of. It only covers polls since the process started.
+const AvailabilityWindow = 24 * time.Hour
+
+// parallel is how many devices are polled at once, so that a few
+// unreachable ones do not hold up the rest until their timeouts.
+const parallel = 8
+
+// Store holds the devices polled.
+type Store interface {
+	SNMPDevices(ctx context.Context, vesselID int64) ([]models.SNMPDevice, error)
+	RecordSNMPPoll(ctx context.Context, id int64, status *string, uptimeHours *float64, at time.Time, pollErr *string) error
+}
+
+// Processor ingests the readings of a poll.
+type Processor interface {
+	ProcessVesselFeed(ctx context.Context, data []byte, readings []ingest.FeedReading, filename string, vesselID int64, mode ingest.IngestMode, source string) (*models.IngestResponse, error)
+}
+
+// Poller polls every vessel's devices and ingests what they report.
+type Poller struct {
+	store     Store
+	processor Processor
+	timeout   time.Duration
+	out       *outbound.Integration
+
+	mu sync.Mutex
+	// polls holds whether each device answered its polls of the window,
+	// by device ID
+	polls map[int64][]outcome
+}
+
+type outcome struct {
+	at       time.Time
+	answered bool
+}
+
+// NewPoller creates a poller whose requests are guarded by policy, its
+// timeout bounding each. The client sends a request again itself, so
+// policy's retries are not taken.
+func NewPoller(st Store, processor Processor, policy outbound.Policy) *Poller {
+	policy.Retries = 0
+	return &Poller{store: st, processor: processor, timeout: policy.Timeout, out: outbound.New("snmp", policy), polls: make(map[int64][]outcome)}
+}
+
+// result is what a device reported at a poll.
+type result struct {
+	status      string
+	uptimeHours *float64
+	err         error // of the poll, even if the device answered
+	answered    bool
+}
+
+// PollOnce polls the devices of every vessel and ingests what each vessel's
+// report as one upload dated at the poll: cameras and NVRs as CCTV
+// readings, the others as network device readings. Devices that do not
+// answer are reported OFFLINE.
+func (p *Poller) PollOnce(ctx context.Context) error {
+	devices, err := p.store.SNMPDevices(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("snmp: reading devices: %w", err)
+	}
+	at := time.Now().UTC().Truncate(time.Second)
+	results := make([]result, len(devices))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallel)
+	for i := range devices {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = p.pollDevice(ctx, devices[i])
+		}(i)
+	}
+	wg.Wait()
+	p.forget(devices)
+
+	readings := make(map[int64][]ingest.FeedReading)
+	var vessels []int64
+	for i, d := range devices {
+		r := results[i]
+		var pollErr *string
+		if r.err != nil {
+			msg := r.err.Error()
+			pollErr = &msg
+		}
+		if err := p.store.RecordSNMPPoll(ctx, d.ID, &r.status, r.uptimeHours, at, pollErr); err != nil {
+			log.Printf("snmp: recording poll of device %d: %v", d.ID, err)
+		}
+		availability := strconv.FormatFloat(p.availability(d.ID, at, r.answered), 'f', 1, 64)
+
+		values := map[string]string{"status": r.status}
+		if Stream(d.Kind) == "cctv" {
+			values["uptime_percent"] = availability
+		} else {
+			values["device_type"] = d.Kind
+			values["availability_percent"] = availability
+			if r.uptimeHours != nil {
+				values["uptime_hours"] = strconv.FormatFloat(*r.uptimeHours, 'f', -1, 64)
+			}
+		}
+		if readings[d.VesselID] == nil {
+			vessels = append(vessels, d.VesselID)
+		}
+		readings[d.VesselID] = append(readings[d.VesselID], ingest.FeedReading{Stream: Stream(d.Kind), Unit: d.Name, TS: at, Values: values})
+	}
+
+	var errs []error
+	for _, vesselID := range vessels {
+		filename := fmt.Sprintf("snmp-%d-%s.txt", vesselID, at.Format("20060102T150405Z"))
+		response, err := p.processor.ProcessVesselFeed(ctx, ingest.FeedData(readings[vesselID]), readings[vesselID], filename, vesselID, ingest.ModeInsert, models.SourceSensor)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("snmp: vessel %d: %w", vesselID, err))
+			continue
+		}
+		for _, w := range response.Warnings {
+			log.Printf("snmp: %s: %s", filename, w)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pollDevice reads the uptime of a device and its status OID, if it has
+// one. A v1 agent that lacks the status OID fails the whole request, so
+// the uptime is then read again alone.
+func (p *Poller) pollDevice(ctx context.Context, d models.SNMPDevice) result {
+	oids := []string{OIDSysUpTime}
+	if d.StatusOID != nil {
+		oids = append(oids, *d.StatusOID)
+	}
+	var values map[string]Value
+	var answerErr error // of a device that answered
+	err := p.out.Do(ctx, func(ctx context.Context) error {
+		client, err := Dial(ctx, d.Address, d.Version, d.Community, p.timeout)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		values, answerErr = client.Get(oids...)
+		var statusErr *StatusError
+		if errors.As(answerErr, &statusErr) && len(oids) > 1 {
+			values, answerErr = client.Get(OIDSysUpTime)
+			if answerErr == nil {
+				answerErr = fmt.Errorf("status OID %s: %w", *d.StatusOID, statusErr)
+			}
+		}
+		if values != nil {
+			return nil
+		} else if errors.As(answerErr, &statusErr) {
+			return outbound.Permanent(answerErr) // refused, asking again will not help
+		}
+		return answerErr
+	})
+	if err != nil {
+		return result{status: StatusOffline, err: err}
+	}
+
+	r := result{status: StatusOnline, err: answerErr, answered: true}
+	if v := values[OIDSysUpTime]; v.Type == TypeTimeTicks {
+		// Hundredths of a second, to hundredths of an hour
+		hours := math.Round(float64(v.Uint)/360000*100) / 100
+		r.uptimeHours = &hours
+	}
+	if d.StatusOID != nil {
+		if v, ok := values[*d.StatusOID]; ok && v.Exists() {
+			if status := strings.TrimSpace(v.String()); status != "" {
+				r.status = status
+			}
+		} else if r.err == nil && ok {
+			r.err = fmt.Errorf("status OID %s: no such object", *d.StatusOID)
+		}
+	}
+	return r
+}
+
+// availability adds a poll of a device and returns the percentage of its
+// polls in the window up to at that it answered.
+func (p *Poller) availability(id int64, at time.Time, answered bool) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	polls := append(p.polls[id], outcome{at: at, answered: answered})
+	for len(polls) > 0 && !polls[0].at.After(at.Add(-AvailabilityWindow)) {
+		polls = polls[1:]
+	}
+	p.polls[id] = polls
+	n := 0
+	for _, o := range polls {
+		if o.answered {
+			n++
+		}
+	}
+	return 100 * float64(n) / float64(len(polls))
+}
+
+// forget drops the polls of devices no longer polled.
+func (p *Poller) forget(devices []models.SNMPDevice) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	polled := make(map[int64]bool, len(devices))
+	for _, d := range devices {
+		polled[d.ID] = true
+	}
+	for id := range p.polls {
+		if !polled[id] {
+			delete(p.polls, id)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+// Package snmp polls the cameras, NVRs, switches and other network devices
+// registered for a vessel over SNMP and ingests what they report as CCTV
+// and network device readings, in place of the CCTV status sheet on
+// installs whose devices are on the ship's network.
+//
+// Only what polling needs is spoken: GetRequest of SNMP v1 and v2c over
+// UDP, encoded in BER.
+package snmp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versions are the protocol versions spoken.
+const (
+	Version1  = "1"
+	Version2c = "2c"
+)
+
+// DefaultPort is the port agents listen on.
+const DefaultPort = "161"
+
+// OIDs of MIB-2 read from every device.
+const (
+	OIDSysUpTime = "1.3.6.1.2.1.1.3.0"
+	OIDSysName   = "1.3.6.1.2.1.1.5.0"
+)
+
+// BER tags of the values and PDUs used.
+const (
+	TypeInteger        byte = 0x02
+	TypeOctetString    byte = 0x04
+	TypeNull           byte = 0x05
+	TypeOID            byte = 0x06
+	TypeIPAddress      byte = 0x40
+	TypeCounter32      byte = 0x41
+	TypeGauge32        byte = 0x42
+	TypeTimeTicks      byte = 0x43
+	TypeOpaque         byte = 0x44
+	TypeCounter64      byte = 0x46
+	TypeNoSuchObject   byte = 0x80
+	TypeNoSuchInstance byte = 0x81
+	TypeEndOfMibView   byte = 0x82
+
+	typeSequence    byte = 0x30
+	typeGetRequest  byte = 0xa0
+	typeGetResponse byte = 0xa2
+)
+
+// Value is the value of a variable an agent answered with.
+type Value struct {
+	Type byte
+	// Int is set for integers, Uint for counters, gauges and time ticks,
+	// Bytes for strings, addresses and opaque values, OID for identifiers
+	Int   int64
+	Uint  uint64
+	Bytes []byte
+	OID   string
+}
+
+// Exists reports whether the agent has the variable.
+func (v Value) Exists() bool {
+	switch v.Type {
+	case TypeNull, TypeNoSuchObject, TypeNoSuchInstance, TypeEndOfMibView:
+		return false
+	}
+	return true
+}
+
+// String returns the value as text: strings as they are, addresses dotted.
+func (v Value) String() string {
+	switch v.Type {
+	case TypeInteger:
+		return strconv.FormatInt(v.Int, 10)
+	case TypeCounter32, TypeGauge32, TypeTimeTicks, TypeCounter64:
+		return strconv.FormatUint(v.Uint, 10)
+	case TypeOctetString, TypeOpaque:
+		return string(v.Bytes)
+	case TypeIPAddress:
+		return net.IP(v.Bytes).String()
+	case TypeOID:
+		return v.OID
+	}
+	return ""
+}
+
+// Float returns a numeric value as a number.
+func (v Value) Float() (float64, bool) {
+	switch v.Type {
+	case TypeInteger:
+		return float64(v.Int), true
+	case TypeCounter32, TypeGauge32, TypeTimeTicks, TypeCounter64:
+		return float64(v.Uint), true
+	}
+	return 0, false
+}
+
+// StatusError is an error status an agent answered a request with.
+type StatusError struct {
+	Status, Index int
+}
+
+var statuses = map[int]string{
+	1: "tooBig", 2: "noSuchName", 3: "badValue", 4: "readOnly", 5: "genErr",
+	6: "noAccess", 16: "authorizationError",
+}
+
+func (e *StatusError) Error() string {
+	name, ok := statuses[e.Status]
+	if !ok {
+		name = strconv.Itoa(e.Status)
+	}
+	return fmt.Sprintf("snmp error %s for variable %d", name, e.Index)
+}
+
+// Client sends requests to one agent. It is not safe for concurrent use.
+type Client struct {
+	conn      net.Conn
+	version   int
+	community string
+	timeout   time.Duration
+	requestID int32
+}
+
+// Dial sets up requests to the agent at address (host, or host:port), each
+// attempt then bounded by timeout.
+func Dial(ctx context.Context, address, version, community string, timeout time.Duration) (*Client, error) {
+	c := &Client{community: community, timeout: timeout}
+	switch version {
+	case Version1:
+	case Version2c:
+		c.version = 1
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version %q", version)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPort)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.requestID = int32(time.Now().UnixNano() & 0x3fffffff)
+	return c, nil
+}
+
+// Close releases the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// attempts is how many times a request is sent before giving up, as
+// datagrams get lost.
+const attempts = 2
+
+// Get reads the variables of oids, returning their values by OID. Variables
+// a v2c agent lacks are returned with Exists false; a v1 agent fails the
+// whole request instead.
+func (c *Client) Get(oids ...string) (map[string]Value, error) {
+	c.requestID++
+	req, err := c.getRequest(c.requestID, oids)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if c.timeout > 0 {
+			c.conn.SetDeadline(time.Now().Add(c.timeout))
+		}
+		if _, err := c.conn.Write(req); err != nil {
+			return nil, err
+		}
+		for {
+			n, err := c.conn.Read(buf)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			id, values, err := parseResponse(buf[:n])
+			// Answers to earlier attempts, or garbage (ID 0)
+			if id != c.requestID {
+				continue
+			}
+			return values, err
+		}
+		var netErr net.Error
+		if !errors.As(lastErr, &netErr) || !netErr.Timeout() {
+			return nil, lastErr
+		}
+	}
+	return nil, lastErr
+}
+
+func (c *Client) getRequest(requestID int32, oids []string) ([]byte, error) {
+	var varbinds []byte
+	for _, oid := range oids {
+		encoded, err := encodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		varbinds = append(varbinds, tlv(typeSequence, append(tlv(TypeOID, encoded), TypeNull, 0))...)
+	}
+	pdu := tlv(TypeInteger, encodeInt(int64(requestID)))
+	pdu = append(pdu, tlv(TypeInteger, encodeInt(0))...)
+	pdu = append(pdu, tlv(TypeInteger, encodeInt(0))...)
+	pdu = append(pdu, tlv(typeSequence, varbinds)...)
+	msg := tlv(TypeInteger, encodeInt(int64(c.version)))
+	msg = append(msg, tlv(TypeOctetString, []byte(c.community))...)
+	msg = append(msg, tlv(typeGetRequest, pdu)...)
+	return tlv(typeSequence, msg), nil
+}
+
+// parseResponse returns the request ID and values of a GetResponse; the ID
+// is 0 if the message cannot be read.
+func parseResponse(data []byte) (int32, map[string]Value, error) {
+	tag, msg, _, err := parseTLV(data)
+	if err != nil || tag != typeSequence {
+		return 0, nil, errors.New("not an SNMP message")
+	}
+	// Version and community
+	for i := 0; i < 2; i++ {
+		if _, _, msg, err = parseTLV(msg); err != nil {
+			return 0, nil, err
+		}
+	}
+	tag, pdu, _, err := parseTLV(msg)
+	if err != nil || tag != typeGetResponse {
+		return 0, nil, errors.New("not a GetResponse")
+	}
+	var fields [3]int64
+	for i := range fields {
+		var content []byte
+		if tag, content, pdu, err = parseTLV(pdu); err != nil || tag != TypeInteger {
+			return 0, nil, errors.New("invalid PDU header")
+		}
+		fields[i] = decodeInt(content)
+	}
+	requestID := int32(fields[0])
+	if fields[1] != 0 {
+		return requestID, nil, &StatusError{Status: int(fields[1]), Index: int(fields[2])}
+	}
+	tag, varbinds, _, err := parseTLV(pdu)
+	if err != nil || tag != typeSequence {
+		return 0, nil, errors.New("invalid variable bindings")
+	}
+	values := make(map[string]Value)
+	for len(varbinds) > 0 {
+		var varbind []byte
+		if tag, varbind, varbinds, err = parseTLV(varbinds); err != nil || tag != typeSequence {
+			return 0, nil, errors.New("invalid variable binding")
+		}
+		tag, name, rest, err := parseTLV(varbind)
+		if err != nil || tag != TypeOID {
+			return 0, nil, errors.New("invalid variable name")
+		}
+		tag, content, _, err := parseTLV(rest)
+		if err != nil {
+			return 0, nil, err
+		}
+		v := Value{Type: tag}
+		switch tag {
+		case TypeInteger:
+			v.Int = decodeInt(content)
+		case TypeCounter32, TypeGauge32, TypeTimeTicks, TypeCounter64:
+			v.Uint = decodeUint(content)
+		case TypeOID:
+			v.OID = decodeOID(content)
+		default:
+			v.Bytes = content
+		}
+		values[decodeOID(name)] = v
+	}
+	return requestID, values, nil
+}
+
+func tlv(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	if n := len(content); n < 0x80 {
+		out = append(out, byte(n))
+	} else if n <= 0xff {
+		out = append(out, 0x81, byte(n))
+	} else {
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+// parseTLV splits the first element off data.
+func parseTLV(data []byte) (tag byte, content, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("truncated element")
+	}
+	tag, length, data := data[0], int(data[1]), data[2:]
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(data) < n {
+			return 0, nil, nil, errors.New("invalid length")
+		}
+		length = 0
+		for _, b := range data[:n] {
+			length = length<<8 | int(b)
+		}
+		data = data[n:]
+	}
+	if length < 0 || length > len(data) {
+		return 0, nil, nil, errors.New("truncated element")
+	}
+	return tag, data[:length], data[length:], nil
+}
+
+func encodeInt(v int64) []byte {
+	b := binary.BigEndian.AppendUint64(nil, uint64(v))
+	for len(b) > 1 && (b[0] == 0 && b[1]&0x80 == 0 || b[0] == 0xff && b[1]&0x80 != 0) {
+		b = b[1:]
+	}
+	return b
+}
+
+func decodeInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+func decodeUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func encodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		arcs[i] = n
+	}
+	if arcs[0] > 2 || arcs[0] < 2 && arcs[1] >= 40 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	var out []byte
+	for _, arc := range append([]uint64{arcs[0]*40 + arcs[1]}, arcs[2:]...) {
+		var chunk []byte
+		for {
+			chunk = append([]byte{byte(arc & 0x7f)}, chunk...)
+			arc >>= 7
+			if arc == 0 {
+				break
+			}
+		}
+		for j := 0; j < len(chunk)-1; j++ {
+			chunk[j] |= 0x80
+		}
+		out = append(out, chunk...)
+	}
+	return out, nil
+}
+
+func decodeOID(b []byte) string {
+	var arcs []string
+	var arc uint64
+	for _, c := range b {
+		arc = arc<<7 | uint64(c&0x7f)
+		if c&0x80 != 0 {
+			continue
+		}
+		// The first subidentifier holds the first two arcs
+		if len(arcs) == 0 {
+			first := min(arc/40, 2)
+			arcs = append(arcs, strconv.FormatUint(first, 10), strconv.FormatUint(arc-40*first, 10))
+		} else {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+		}
+		arc = 0
+	}
+	return strings.Join(arcs, ".")
+}
+
+// ValidOID reports whether oid is a dotted object identifier.
+func ValidOID(oid string) bool {
+	_, err := encodeOID(oid)
+	return err == nil
+}
@@ -0,0 +1,252 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/ingest"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+)
+
+// testAgent answers GetRequests of community public from values; variables
+// it lacks are noSuchObject in v2c and fail the request with noSuchName in
+// v1.
+type testAgent struct {
+	conn net.PacketConn
+
+	mu     sync.Mutex
+	values map[string]Value
+}
+
+func newTestAgent(t *testing.T, values map[string]Value) *testAgent {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &testAgent{conn: conn, values: values}
+	t.Cleanup(func() { conn.Close() })
+	go a.serve()
+	return a
+}
+
+func (a *testAgent) addr() string { return a.conn.LocalAddr().String() }
+
+func (a *testAgent) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := a.answer(buf[:n]); resp != nil {
+			a.conn.WriteTo(resp, from)
+		}
+	}
+}
+
+func (a *testAgent) answer(req []byte) []byte {
+	_, msg, _, _ := parseTLV(req)
+	_, version, msg, _ := parseTLV(msg)
+	_, community, msg, _ := parseTLV(msg)
+	if string(community) != "public" {
+		return nil
+	}
+	_, pdu, _, _ := parseTLV(msg)
+	_, requestID, pdu, _ := parseTLV(pdu)
+	_, _, pdu, _ = parseTLV(pdu)
+	_, _, pdu, _ = parseTLV(pdu)
+	_, varbinds, _, _ := parseTLV(pdu)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out []byte
+	status, index := 0, 0
+	for i := 1; len(varbinds) > 0; i++ {
+		var varbind []byte
+		_, varbind, varbinds, _ = parseTLV(varbinds)
+		_, name, _, _ := parseTLV(varbind)
+		v, ok := a.values[decodeOID(name)]
+		var value []byte
+		switch {
+		case !ok && decodeInt(version) == 0:
+			status, index = 2, i
+		case !ok:
+			value = tlv(TypeNoSuchObject, nil)
+		case v.Type == TypeInteger:
+			value = tlv(v.Type, encodeInt(v.Int))
+		case v.Type == TypeTimeTicks:
+			value = tlv(v.Type, encodeInt(int64(v.Uint)))
+		default:
+			value = tlv(v.Type, v.Bytes)
+		}
+		out = append(out, tlv(typeSequence, append(tlv(TypeOID, name), value...))...)
+	}
+	resp := tlv(TypeInteger, requestID)
+	resp = append(resp, tlv(TypeInteger, encodeInt(int64(status)))...)
+	resp = append(resp, tlv(TypeInteger, encodeInt(int64(index)))...)
+	resp = append(resp, tlv(typeSequence, out)...)
+	full := tlv(TypeInteger, version)
+	full = append(full, tlv(TypeOctetString, community)...)
+	full = append(full, tlv(typeGetResponse, resp)...)
+	return tlv(typeSequence, full)
+}
+
+func TestEncoding(t *testing.T) {
+	for _, oid := range []string{OIDSysUpTime, "1.3.6.1.4.1.2636.3.1.13.1.7.9.1.0.0", "2.999.3"} {
+		encoded, err := encodeOID(oid)
+		if err != nil || decodeOID(encoded) != oid {
+			t.Errorf("OID %s round-tripped to %q, %v", oid, decodeOID(encoded), err)
+		}
+	}
+	for _, oid := range []string{"", "1", "1.3.x", "3.1", "1.40"} {
+		if ValidOID(oid) {
+			t.Errorf("Expected %q to be invalid", oid)
+		}
+	}
+	for _, v := range []int64{0, 1, 127, 128, -1, -129, 1 << 40} {
+		if got := decodeInt(encodeInt(v)); got != v {
+			t.Errorf("Integer %d round-tripped to %d", v, got)
+		}
+	}
+	if got := encodeInt(128); len(got) != 2 || got[0] != 0 {
+		t.Errorf("Expected 128 encoded as 00 80, got % x", got)
+	}
+	long := tlv(TypeOctetString, make([]byte, 300))
+	if _, content, rest, err := parseTLV(long); err != nil || len(content) != 300 || len(rest) != 0 {
+		t.Errorf("Unexpected long element: %d bytes, %v", len(content), err)
+	}
+}
+
+func TestGet(t *testing.T) {
+	const statusOID = "1.3.6.1.4.1.99.1.0"
+	a := newTestAgent(t, map[string]Value{
+		OIDSysUpTime: {Type: TypeTimeTicks, Uint: 123456789},
+		OIDSysName:   {Type: TypeOctetString, Bytes: []byte("cam-bridge")},
+		statusOID:    {Type: TypeInteger, Int: -2},
+	})
+
+	c, err := Dial(context.Background(), a.addr(), Version2c, "public", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	values, err := c.Get(OIDSysUpTime, OIDSysName, statusOID, "1.3.6.1.2.1.1.6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := values[OIDSysUpTime]; v.Type != TypeTimeTicks || v.Uint != 123456789 {
+		t.Errorf("Unexpected uptime %+v", v)
+	}
+	if v := values[OIDSysName]; v.String() != "cam-bridge" {
+		t.Errorf("Unexpected name %+v", v)
+	}
+	if f, ok := values[statusOID].Float(); !ok || f != -2 {
+		t.Errorf("Unexpected status %v", f)
+	}
+	if v, ok := values["1.3.6.1.2.1.1.6.0"]; !ok || v.Exists() {
+		t.Errorf("Expected a missing location, got %+v", v)
+	}
+
+	v1, err := Dial(context.Background(), a.addr(), Version1, "public", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v1.Close()
+	var statusErr *StatusError
+	if _, err := v1.Get(OIDSysUpTime, "1.3.6.1.2.1.1.6.0"); !errors.As(err, &statusErr) || statusErr.Status != 2 || statusErr.Index != 2 {
+		t.Errorf("Expected noSuchName for variable 2, got %v", err)
+	}
+
+	wrong, err := Dial(context.Background(), a.addr(), Version2c, "private", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wrong.Close()
+	if _, err := wrong.Get(OIDSysUpTime); err == nil {
+		t.Error("Expected a timeout for an unknown community")
+	}
+	if _, err := Dial(context.Background(), a.addr(), "3", "public", time.Second); err == nil {
+		t.Error("Expected an error for SNMPv3")
+	}
+}
+
+type fakeStore struct {
+	devices []models.SNMPDevice
+	polls   map[int64]*string // status by device
+}
+
+func (s *fakeStore) SNMPDevices(ctx context.Context, vesselID int64) ([]models.SNMPDevice, error) {
+	return s.devices, nil
+}
+
+func (s *fakeStore) RecordSNMPPoll(ctx context.Context, id int64, status *string, uptimeHours *float64, at time.Time, pollErr *string) error {
+	s.polls[id] = status
+	return nil
+}
+
+type fakeProcessor struct {
+	readings map[int64][]ingest.FeedReading
+}
+
+func (p *fakeProcessor) ProcessVesselFeed(ctx context.Context, data []byte, readings []ingest.FeedReading, filename string, vesselID int64, mode ingest.IngestMode, source string) (*models.IngestResponse, error) {
+	p.readings[vesselID] = readings
+	return &models.IngestResponse{Status: "success"}, nil
+}
+
+func TestPollOnce(t *testing.T) {
+	const recordingOID = "1.3.6.1.4.1.99.2.0"
+	camera := newTestAgent(t, map[string]Value{
+		OIDSysUpTime: {Type: TypeTimeTicks, Uint: 100},
+		recordingOID: {Type: TypeOctetString, Bytes: []byte("RECORDING ")},
+	})
+	sw := newTestAgent(t, map[string]Value{
+		// 50 hours
+		OIDSysUpTime: {Type: TypeTimeTicks, Uint: 50 * 360000},
+	})
+	recording := recordingOID
+	st := &fakeStore{polls: map[int64]*string{}, devices: []models.SNMPDevice{
+		{ID: 1, VesselID: 1, Name: "CAM-01", Kind: "camera", Address: camera.addr(), Version: Version2c, Community: "public", StatusOID: &recording},
+		{ID: 2, VesselID: 1, Name: "SW-BRIDGE", Kind: "switch", Address: sw.addr(), Version: Version1, Community: "public"},
+		// Unreachable
+		{ID: 3, VesselID: 2, Name: "NVR-1", Kind: "nvr", Address: "127.0.0.1:1", Version: Version2c, Community: "public"},
+	}}
+	processor := &fakeProcessor{readings: map[int64][]ingest.FeedReading{}}
+	p := NewPoller(st, processor, outbound.Policy{Timeout: 100 * time.Millisecond})
+	if err := p.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	readings := processor.readings[1]
+	if len(readings) != 2 {
+		t.Fatalf("Expected 2 readings of vessel 1, got %+v", processor.readings)
+	}
+	if r := readings[0]; r.Stream != "cctv" || r.Unit != "CAM-01" || r.Values["status"] != "RECORDING" || r.Values["uptime_percent"] != "100.0" {
+		t.Errorf("Unexpected camera reading %+v", r)
+	}
+	if r := readings[1]; r.Stream != "network_device" || r.Unit != "SW-BRIDGE" || r.Values["status"] != StatusOnline ||
+		r.Values["uptime_hours"] != "50" || r.Values["device_type"] != "switch" || r.Values["availability_percent"] != "100.0" {
+		t.Errorf("Unexpected switch reading %+v", r)
+	}
+	if r := processor.readings[2]; len(r) != 1 || r[0].Stream != "cctv" || r[0].Values["status"] != StatusOffline || r[0].Values["uptime_percent"] != "0.0" {
+		t.Errorf("Unexpected NVR reading %+v", r)
+	}
+	if s := st.polls[3]; s == nil || *s != StatusOffline {
+		t.Errorf("Expected the NVR recorded offline, got %v", s)
+	}
+
+	// The NVR answers the next poll
+	nvr := newTestAgent(t, map[string]Value{OIDSysUpTime: {Type: TypeTimeTicks, Uint: 1}})
+	st.devices[2].Address = nvr.addr()
+	if err := p.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := processor.readings[2]; r[0].Values["status"] != StatusOnline || r[0].Values["uptime_percent"] != "50.0" {
+		t.Errorf("Expected the NVR online half the time, got %+v", r)
+	}
+}
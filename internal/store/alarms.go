@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/alarms"
+	"vessel-telemetry-api/internal/models"
+)
+
+// AlarmFilter selects alarm events of a vessel. Zero values mean "no filter".
+type AlarmFilter struct {
+	VesselID   int64
+	Severities []string
+	EngineNo   *int
+	Code       string
+	ActiveOnly bool
+	From, To   *time.Time // events overlapping the range
+}
+
+// RebuildAlarmEvents re-derives the vessel's alarm events from its engine
+// readings after readings at or after since were written. Events that end
+// before since are kept; the others are deleted and rebuilt, starting from
+// the earliest of them so an alarm that was already active stays one event.
+func (s *SQLStore) RebuildAlarmEvents(ctx context.Context, vesselID int64, since time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Deleting first takes the write lock before anything is read
+	from := since
+	for {
+		earliest, err := deleteAlarmEventsFrom(ctx, tx, vesselID, from)
+		if err != nil {
+			return err
+		}
+		if earliest == nil || !earliest.Before(from) {
+			break
+		}
+		from = *earliest
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT engine_no, ts, alarms FROM engine_readings
+		WHERE vessel_id = ? AND ts >= ?
+		ORDER BY engine_no, ts, id`, vesselID, from)
+	if err != nil {
+		return err
+	}
+
+	type unit struct {
+		engineNo sql.NullInt64
+		readings []alarms.Reading
+	}
+	var units []*unit
+	for rows.Next() {
+		var engineNo sql.NullInt64
+		var ts time.Time
+		var text sql.NullString
+		if err := rows.Scan(&engineNo, &ts, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		if len(units) == 0 || units[len(units)-1].engineNo != engineNo {
+			units = append(units, &unit{engineNo: engineNo})
+		}
+		u := units[len(units)-1]
+		u.readings = append(u.readings, alarms.Reading{TS: ts, Alarms: alarms.Parse(text.String)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range units {
+		for _, e := range alarms.Pair(u.readings) {
+			var end interface{}
+			if e.End != nil {
+				end = *e.End
+			}
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO alarm_events (vessel_id, engine_no, code, severity, message, start_ts, end_ts, last_seen_ts, occurrences)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				vesselID, u.engineNo, e.Code, e.Severity, e.Message, e.Start, end, e.LastSeen, e.Occurrences)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deleteAlarmEventsFrom deletes the vessel's events still active at or after
+// from and returns the earliest start among them.
+func deleteAlarmEventsFrom(ctx context.Context, tx *sql.Tx, vesselID int64, from time.Time) (*time.Time, error) {
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM alarm_events
+		WHERE vessel_id = ? AND (end_ts IS NULL OR end_ts >= ?)
+		RETURNING start_ts`, vesselID, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var earliest *time.Time
+	for rows.Next() {
+		var raw sql.NullString
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		start, err := parseTime(raw)
+		if err != nil {
+			return nil, err
+		}
+		if start != nil && (earliest == nil || start.Before(*earliest)) {
+			earliest = start
+		}
+	}
+	return earliest, rows.Err()
+}
+
+// AlarmEvents returns the events matching f, oldest first.
+func (s *SQLStore) AlarmEvents(ctx context.Context, f AlarmFilter) ([]models.AlarmEvent, error) {
+	query := `SELECT id, engine_no, code, severity, message, start_ts, end_ts, last_seen_ts, occurrences
+		FROM alarm_events WHERE vessel_id = ?`
+	args := []interface{}{f.VesselID}
+	if len(f.Severities) > 0 {
+		query += " AND severity IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(f.Severities)), ", ") + ")"
+		for _, severity := range f.Severities {
+			args = append(args, severity)
+		}
+	}
+	if f.EngineNo != nil {
+		query += " AND engine_no = ?"
+		args = append(args, *f.EngineNo)
+	}
+	if f.Code != "" {
+		query += " AND code = ?"
+		args = append(args, f.Code)
+	}
+	if f.ActiveOnly {
+		query += " AND end_ts IS NULL"
+	}
+	if f.From != nil {
+		query += " AND (end_ts IS NULL OR end_ts >= ?)"
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		query += " AND start_ts <= ?"
+		args = append(args, *f.To)
+	}
+	query += " ORDER BY start_ts, engine_no, code"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AlarmEvent{}
+	for rows.Next() {
+		var e models.AlarmEvent
+		var engineNo sql.NullInt64
+		var message sql.NullString
+		var end sql.NullTime
+		if err := rows.Scan(&e.ID, &engineNo, &e.Code, &e.Severity, &message, &e.Start, &end, &e.LastSeen, &e.Occurrences); err != nil {
+			return nil, err
+		}
+		if engineNo.Valid {
+			n := int(engineNo.Int64)
+			e.EngineNo = &n
+		}
+		if end.Valid {
+			t := end.Time.UTC()
+			e.End = &t
+		}
+		e.Message = message.String
+		e.Start, e.LastSeen = e.Start.UTC(), e.LastSeen.UTC()
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
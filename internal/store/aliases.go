@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const headerAliasColumns = "id, vessel_id, stream, header, field, created_at, updated_at"
+
+// HeaderAliases returns the header aliases, those of a vessel before the
+// global ones, so they win on ingest, then by ID.
+func (s *SQLStore) HeaderAliases(ctx context.Context) ([]models.HeaderAlias, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+headerAliasColumns+" FROM header_aliases ORDER BY vessel_id IS NULL, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := []models.HeaderAlias{}
+	for rows.Next() {
+		a, err := scanHeaderAlias(rows)
+		if err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// HeaderAlias returns one header alias, or ErrNotFound.
+func (s *SQLStore) HeaderAlias(ctx context.Context, id int64) (*models.HeaderAlias, error) {
+	a, err := scanHeaderAlias(s.db.QueryRowContext(ctx, "SELECT "+headerAliasColumns+" FROM header_aliases WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func scanHeaderAlias(row rowScanner) (models.HeaderAlias, error) {
+	var a models.HeaderAlias
+	if err := row.Scan(&a.ID, &a.VesselID, &a.Stream, &a.Header, &a.Field, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		return a, err
+	}
+	a.CreatedAt, a.UpdatedAt = a.CreatedAt.UTC(), a.UpdatedAt.UTC()
+	return a, nil
+}
+
+// CreateHeaderAlias stores a new header alias and returns its ID.
+func (s *SQLStore) CreateHeaderAlias(ctx context.Context, a models.HeaderAlias) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO header_aliases (vessel_id, stream, header, field, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		a.VesselID, a.Stream, a.Header, a.Field, a.CreatedAt, a.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateHeaderAlias replaces a header alias, or returns ErrNotFound.
+func (s *SQLStore) UpdateHeaderAlias(ctx context.Context, a models.HeaderAlias) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE header_aliases SET vessel_id = ?, stream = ?, header = ?, field = ?, updated_at = ?
+		WHERE id = ?`,
+		a.VesselID, a.Stream, a.Header, a.Field, a.UpdatedAt, a.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteHeaderAlias removes a header alias, or returns ErrNotFound.
+func (s *SQLStore) DeleteHeaderAlias(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM header_aliases WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
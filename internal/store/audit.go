@@ -0,0 +1,318 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/audit"
+)
+
+// ChainStreams adds every later write to the given streams to the audit
+// log. Call it before the store is used.
+func (s *SQLStore) ChainStreams(streams ...*Stream) {
+	s.chained = make(map[string]*Stream, len(streams))
+	for _, stream := range streams {
+		s.chained[stream.Table] = stream
+	}
+}
+
+// AuditFilter selects audit log entries. Zero values mean "no filter".
+type AuditFilter struct {
+	AfterSeq int64
+	Limit    int
+	VesselID *int64
+	Kind     string
+}
+
+// ReadingCheck summarizes how chained readings compare with their latest
+// audit log entry.
+type ReadingCheck struct {
+	Checked   int64            `json:"checked"`
+	Changed   int64            `json:"changed"`
+	Deleted   int64            `json:"deleted"`
+	Unchained map[string]int64 `json:"unchained"` // per chained stream, readings without an entry
+}
+
+const auditColumns = `seq, recorded_at, kind, action, actor, vessel_id, subject, stream, reading_id, digest, detail_json, prev_hash, hash`
+
+func scanAuditEntry(scan func(dest ...interface{}) error) (audit.Entry, error) {
+	var e audit.Entry
+	var recordedAt string
+	var actor, subject, stream, digest, detail sql.NullString
+	var vesselID, readingID sql.NullInt64
+	if err := scan(&e.Seq, &recordedAt, &e.Kind, &e.Action, &actor, &vesselID, &subject, &stream, &readingID, &digest, &detail, &e.PrevHash, &e.Hash); err != nil {
+		return e, err
+	}
+	t, err := time.Parse(audit.TimeFormat, recordedAt)
+	if err != nil {
+		return e, fmt.Errorf("audit entry %d: invalid recorded_at %q", e.Seq, recordedAt)
+	}
+	e.RecordedAt = t.UTC()
+	e.Actor, e.Subject, e.Stream, e.Digest, e.Detail = actor.String, subject.String, stream.String, digest.String, detail.String
+	if vesselID.Valid {
+		e.VesselID = &vesselID.Int64
+	}
+	if readingID.Valid {
+		e.ReadingID = &readingID.Int64
+	}
+	return e, nil
+}
+
+// nullString stores "" as NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// appendAuditEntry links e to the end of the chain. Inserting first takes
+// the write lock, so concurrent appends cannot link to the same predecessor.
+func appendAuditEntry(ctx context.Context, tx *sql.Tx, e audit.Entry) (audit.Entry, error) {
+	e.RecordedAt = time.Now().UTC()
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_log (recorded_at, kind, action, actor, vessel_id, subject, stream, reading_id, digest, detail_json, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '', '')`,
+		e.RecordedAt.Format(audit.TimeFormat), e.Kind, e.Action, nullString(e.Actor), e.VesselID,
+		nullString(e.Subject), nullString(e.Stream), e.ReadingID, nullString(e.Digest), nullString(e.Detail))
+	if err != nil {
+		return e, err
+	}
+	if e.Seq, err = result.LastInsertId(); err != nil {
+		return e, err
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT hash FROM audit_log WHERE seq < ? ORDER BY seq DESC LIMIT 1", e.Seq).Scan(&e.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return e, err
+	}
+	e.Hash = e.ComputeHash()
+	_, err = tx.ExecContext(ctx, "UPDATE audit_log SET prev_hash = ?, hash = ? WHERE seq = ?", e.PrevHash, e.Hash, e.Seq)
+	return e, err
+}
+
+// AppendAudit adds an audit entry and returns it as stored.
+func (s *SQLStore) AppendAudit(ctx context.Context, e audit.Entry) (audit.Entry, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return e, err
+	}
+	defer tx.Rollback()
+
+	e.Kind = audit.KindAudit
+	if e.Detail != "" {
+		e.Digest = audit.Digest(e.Detail)
+	}
+	if e, err = appendAuditEntry(ctx, tx, e); err != nil {
+		return e, err
+	}
+	return e, tx.Commit()
+}
+
+// readingDigestQuery selects the columns a reading's digest covers, from r.
+func readingDigestQuery(stream *Stream) string {
+	cols := []string{"r.ts"}
+	for _, name := range stream.FieldNames() {
+		cols = append(cols, "r."+name)
+	}
+	cols = append(cols, extraJSONColumn("r."), "r.row_hash")
+	return strings.Join(cols, ", ")
+}
+
+// scanReadingDigest scans the readingDigestQuery columns, after dest, and
+// digests them.
+func scanReadingDigest(scan func(dest ...interface{}) error, stream *Stream, dest ...interface{}) (string, error) {
+	values := make([]interface{}, len(stream.Fields)+3)
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+	if err := scan(dest...); err != nil {
+		return "", err
+	}
+	// Columns added after readings were first chained are left out while
+	// NULL, so those entries still verify. values[0] is ts.
+	digested := values[:0]
+	for i, v := range values {
+		if v == nil && i >= 1 && i <= len(stream.Fields) && lateField(stream, stream.Fields[i-1].Name) {
+			continue
+		}
+		digested = append(digested, v)
+	}
+	return audit.Digest(digested...), nil
+}
+
+// lateField reports whether the column was added to the stream's table
+// after the audit log started chaining its readings. Only location had a
+// source then.
+func lateField(stream *Stream, name string) bool {
+	return name == "uncertainty_percent" || name == "source" && stream.Name != "location"
+}
+
+// chainReading adds a write of reading id to the audit log.
+func chainReading(ctx context.Context, tx *sql.Tx, stream *Stream, vesselID, id int64, result WriteResult) error {
+	row := tx.QueryRowContext(ctx, "SELECT "+readingDigestQuery(stream)+" FROM "+stream.Table+" r WHERE r.id = ?", id)
+	digest, err := scanReadingDigest(row.Scan, stream)
+	if err != nil {
+		return err
+	}
+	action := "insert"
+	if result == WriteUpdated {
+		action = "update"
+	}
+	_, err = appendAuditEntry(ctx, tx, audit.Entry{
+		Kind:      audit.KindReading,
+		Action:    action,
+		VesselID:  &vesselID,
+		Stream:    stream.Name,
+		ReadingID: &id,
+		Digest:    digest,
+	})
+	return err
+}
+
+// AuditEntries returns entries matching f in seq order.
+func (s *SQLStore) AuditEntries(ctx context.Context, f AuditFilter) ([]audit.Entry, error) {
+	query := "SELECT " + auditColumns + " FROM audit_log WHERE seq > ?"
+	args := []interface{}{f.AfterSeq}
+	if f.VesselID != nil {
+		query += " AND vessel_id = ?"
+		args = append(args, *f.VesselID)
+	}
+	if f.Kind != "" {
+		query += " AND kind = ?"
+		args = append(args, f.Kind)
+	}
+	query += " ORDER BY seq"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []audit.Entry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// VerifyAudit walks the whole chain, then compares every chained reading
+// (of one vessel, if vesselID is set) with its latest entry.
+func (s *SQLStore) VerifyAudit(ctx context.Context, vesselID *int64) (*audit.Checker, ReadingCheck, error) {
+	checker := &audit.Checker{}
+	readings := ReadingCheck{Unchained: map[string]int64{}}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+auditColumns+" FROM audit_log ORDER BY seq")
+	if err != nil {
+		return nil, readings, err
+	}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return nil, readings, err
+		}
+		checker.Add(e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, readings, err
+	}
+
+	var streams []string
+	rows, err = s.db.QueryContext(ctx, "SELECT DISTINCT stream FROM audit_log WHERE kind = ? ORDER BY stream", audit.KindReading)
+	if err != nil {
+		return nil, readings, err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, readings, err
+		}
+		streams = append(streams, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, readings, err
+	}
+
+	for _, name := range streams {
+		stream, ok := Streams[name]
+		if !ok {
+			continue
+		}
+		if err := s.checkChainedReadings(ctx, stream, vesselID, checker, &readings); err != nil {
+			return nil, readings, err
+		}
+	}
+
+	for _, stream := range s.chained {
+		query := "SELECT COUNT(*) FROM " + stream.Table + ` r
+			WHERE NOT EXISTS (SELECT 1 FROM audit_log a WHERE a.stream = ? AND a.reading_id = r.id)`
+		args := []interface{}{stream.Name}
+		if vesselID != nil {
+			query += " AND r.vessel_id = ?"
+			args = append(args, *vesselID)
+		}
+		var n int64
+		if err := s.db.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+			return nil, readings, err
+		}
+		readings.Unchained[stream.Name] = n
+	}
+
+	return checker, readings, nil
+}
+
+// checkChainedReadings compares the readings of stream with the digest of
+// their latest audit log entry.
+func (s *SQLStore) checkChainedReadings(ctx context.Context, stream *Stream, vesselID *int64, checker *audit.Checker, readings *ReadingCheck) error {
+	query := "SELECT a.seq, a.reading_id, a.digest, r.id, " + readingDigestQuery(stream) + `
+		FROM audit_log a LEFT JOIN ` + stream.Table + ` r ON r.id = a.reading_id
+		WHERE a.seq IN (SELECT MAX(seq) FROM audit_log WHERE kind = ? AND stream = ? GROUP BY reading_id)`
+	args := []interface{}{audit.KindReading, stream.Name}
+	if vesselID != nil {
+		query += " AND a.vessel_id = ?"
+		args = append(args, *vesselID)
+	}
+	query += " ORDER BY a.seq"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seq, readingID int64
+		var recorded string
+		var id sql.NullInt64
+		digest, err := scanReadingDigest(rows.Scan, stream, &seq, &readingID, &recorded, &id)
+		if err != nil {
+			return err
+		}
+		readings.Checked++
+		switch {
+		case !id.Valid:
+			readings.Deleted++
+			checker.Report(seq, fmt.Sprintf("%s reading %d was deleted", stream.Name, readingID))
+		case digest != recorded:
+			readings.Changed++
+			checker.Report(seq, fmt.Sprintf("%s reading %d was changed after it was recorded", stream.Name, readingID))
+		}
+	}
+	return rows.Err()
+}
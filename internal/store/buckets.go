@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const bucketObjectColumns = "bucket, object_key, etag, status, upload_id, error, attempts, retry_at, updated_at"
+
+// BucketObject returns what the bucket ingester recorded of an object.
+func (s *SQLStore) BucketObject(ctx context.Context, bucket, key string) (*models.BucketObject, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+bucketObjectColumns+" FROM bucket_objects WHERE bucket = ? AND object_key = ?", bucket, key)
+	o, err := scanBucketObject(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return o, err
+}
+
+// PutBucketObject records the outcome of ingesting an object, replacing
+// what was recorded of it before.
+func (s *SQLStore) PutBucketObject(ctx context.Context, o models.BucketObject) error {
+	var errText *string
+	if o.Error != "" {
+		errText = &o.Error
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO bucket_objects (`+bucketObjectColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(bucket, object_key) DO UPDATE SET
+			etag = excluded.etag, status = excluded.status, upload_id = excluded.upload_id,
+			error = excluded.error, attempts = excluded.attempts, retry_at = excluded.retry_at,
+			updated_at = excluded.updated_at`,
+		o.Bucket, o.Key, o.ETag, o.Status, o.UploadID, errText, o.Attempts, o.RetryAt, o.UpdatedAt)
+	return err
+}
+
+// BucketObjects lists the objects recorded for a bucket, most recently
+// updated first, optionally only those of one status.
+func (s *SQLStore) BucketObjects(ctx context.Context, bucket, status string, limit int) ([]models.BucketObject, error) {
+	query := "SELECT " + bucketObjectColumns + " FROM bucket_objects WHERE bucket = ?"
+	args := []interface{}{bucket}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY updated_at DESC, object_key LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []models.BucketObject{}
+	for rows.Next() {
+		o, err := scanBucketObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *o)
+	}
+	return objects, rows.Err()
+}
+
+func scanBucketObject(row interface{ Scan(...interface{}) error }) (*models.BucketObject, error) {
+	var o models.BucketObject
+	var errText sql.NullString
+	var uploadID sql.NullInt64
+	var retryAt sql.NullTime
+	if err := row.Scan(&o.Bucket, &o.Key, &o.ETag, &o.Status, &uploadID, &errText, &o.Attempts, &retryAt, &o.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if uploadID.Valid {
+		o.UploadID = &uploadID.Int64
+	}
+	if retryAt.Valid {
+		t := retryAt.Time.UTC()
+		o.RetryAt = &t
+	}
+	o.Error = errText.String
+	o.UpdatedAt = o.UpdatedAt.UTC()
+	return &o, nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// LatestCameraStatuses returns the latest reading of every camera, ordered by
+// vessel name and camera. Archived vessels are left out unless
+// includeArchived is set.
+func (s *SQLStore) LatestCameraStatuses(ctx context.Context, includeArchived bool) ([]models.CameraStatus, error) {
+	query := `
+		SELECT v.id, v.name, v.imo, r.cam_id, r.ts, r.status, r.uptime_percent
+		FROM (
+			SELECT vessel_id, cam_id, ts, status, uptime_percent,
+				ROW_NUMBER() OVER (PARTITION BY vessel_id, cam_id ORDER BY ts DESC, id DESC) AS n
+			FROM cctv_status_readings
+		) r
+		JOIN vessels v ON v.id = r.vessel_id
+		WHERE r.n = 1`
+	if !includeArchived {
+		query += " AND v.archived_at IS NULL"
+	}
+	query += " ORDER BY v.name, v.id, r.cam_id"
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cameras []models.CameraStatus
+	for rows.Next() {
+		var cam models.CameraStatus
+		var name, imo, camID, status, ts sql.NullString
+		var uptime sql.NullFloat64
+		if err := rows.Scan(&cam.VesselID, &name, &imo, &camID, &ts, &status, &uptime); err != nil {
+			return nil, err
+		}
+		// ts comes out of the subquery as text
+		parsed, err := parseTime(ts)
+		if err != nil {
+			return nil, err
+		}
+		cam.TS = *parsed
+		cam.VesselName = name.String
+		if imo.Valid {
+			cam.IMO = &imo.String
+		}
+		if camID.Valid {
+			cam.CamID = &camID.String
+		}
+		if status.Valid {
+			cam.Status = &status.String
+		}
+		if uptime.Valid {
+			cam.UptimePercent = &uptime.Float64
+		}
+		cameras = append(cameras, cam)
+	}
+	return cameras, rows.Err()
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrCDCGone means changes after a feed token have been pruned; the
+// consumer has to start over from a full copy.
+var ErrCDCGone = errors.New("changes after this token have been pruned")
+
+// cdcTimeFormat is how the cdc triggers write changed_at.
+const cdcTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// Change is one entry of the change data capture feed.
+type Change struct {
+	Seq       int64     `json:"seq"`
+	Op        string    `json:"op"` // insert, update or delete
+	Stream    string    `json:"stream"`
+	VesselID  int64     `json:"vessel_id"`
+	ReadingID int64     `json:"reading_id"`
+	ChangedAt time.Time `json:"changed_at"`
+	// Row is the reading as it is now: nil for deletes, and for inserts and
+	// updates of readings deleted since (a delete follows in the feed).
+	Row *Reading `json:"row"`
+}
+
+// ErrCDCToken means a feed token is ahead of the log, e.g. it was issued by
+// another database.
+var ErrCDCToken = errors.New("token is ahead of the change log")
+
+// Changes returns up to limit changes after seq afterSeq, oldest first, and
+// the seq of the newest change ever logged. It returns ErrCDCGone if some
+// of the changes have been pruned.
+func (s *SQLStore) Changes(ctx context.Context, afterSeq int64, limit int) ([]Change, int64, error) {
+	// Read the head first: every change up to it is visible to the query
+	// below, so a missing one was pruned rather than not yet committed
+	var head int64
+	err := s.db.QueryRowContext(ctx, "SELECT seq FROM sqlite_sequence WHERE name = 'cdc_log'").Scan(&head)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, 0, err
+	}
+	if afterSeq > head {
+		return nil, head, ErrCDCToken
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT seq, op, stream, vessel_id, reading_id, changed_at
+		FROM cdc_log WHERE seq > ? ORDER BY seq LIMIT ?`, afterSeq, limit)
+	if err != nil {
+		return nil, head, err
+	}
+	changes := []Change{}
+	for rows.Next() {
+		var c Change
+		var changedAt string
+		if err := rows.Scan(&c.Seq, &c.Op, &c.Stream, &c.VesselID, &c.ReadingID, &changedAt); err != nil {
+			rows.Close()
+			return nil, head, err
+		}
+		if c.ChangedAt, err = time.Parse(time.RFC3339Nano, changedAt); err != nil {
+			rows.Close()
+			return nil, head, fmt.Errorf("change %d: invalid changed_at %q", c.Seq, changedAt)
+		}
+		changes = append(changes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, head, err
+	}
+
+	// seq has no gaps but pruned changes: a rolled back insert gives its
+	// AUTOINCREMENT value back
+	if afterSeq < head && (len(changes) == 0 || changes[0].Seq != afterSeq+1) {
+		return nil, head, ErrCDCGone
+	}
+
+	if err := s.attachRows(ctx, changes); err != nil {
+		return nil, head, err
+	}
+	return changes, head, nil
+}
+
+// attachRows loads the current row of every insert and update.
+func (s *SQLStore) attachRows(ctx context.Context, changes []Change) error {
+	ids := map[string][]int64{}
+	for _, c := range changes {
+		if c.Op != "delete" {
+			ids[c.Stream] = append(ids[c.Stream], c.ReadingID)
+		}
+	}
+	current, err := s.readingsByID(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("cdc_log: %w", err)
+	}
+	for i := range changes {
+		if changes[i].Op != "delete" {
+			changes[i].Row = current[changes[i].Stream][changes[i].ReadingID]
+		}
+	}
+	return nil
+}
+
+// readingsByID loads readings by stream and id. Readings deleted since are
+// missing from the result.
+func (s *SQLStore) readingsByID(ctx context.Context, ids map[string][]int64) (map[string]map[int64]*Reading, error) {
+	current := map[string]map[int64]*Reading{}
+	for name, list := range ids {
+		stream, ok := Streams[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown stream %q", name)
+		}
+		args := make([]interface{}, len(list))
+		for i, id := range list {
+			args[i] = id
+		}
+		query := stream.readingColumns() + " WHERE id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(list)), ", ") + ")"
+		rows, err := s.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		current[name] = map[int64]*Reading{}
+		for rows.Next() {
+			r, err := stream.ScanReading(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			current[name][r.ID] = &r
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+// PruneChanges deletes changes logged before the given time, up to seq
+// maxSeq, and returns how many were removed. An edge passes the lowest of
+// its update cursors so updates not yet pushed ashore are kept.
+func (s *SQLStore) PruneChanges(ctx context.Context, before time.Time, maxSeq int64) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM cdc_log WHERE changed_at < ? AND seq <= ?", before.UTC().Format(cdcTimeFormat), maxSeq)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
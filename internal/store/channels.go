@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// ChannelReadingFilter selects a vessel's readings of one data channel. Zero
+// values mean "no filter".
+type ChannelReadingFilter struct {
+	VesselID  int64
+	ChannelID string
+	From, To  *time.Time
+	Limit     int
+}
+
+// DataChannelMappings returns the vessel's own data channel mappings,
+// ordered by channel ID.
+func (s *SQLStore) DataChannelMappings(ctx context.Context, vesselID int64) ([]models.DataChannelMapping, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT channel_id, stream, field, unit, updated_at FROM data_channel_mappings
+		WHERE vessel_id = ? ORDER BY channel_id`, vesselID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappings := []models.DataChannelMapping{}
+	for rows.Next() {
+		m := models.DataChannelMapping{Source: "vessel"}
+		var updated time.Time
+		if err := rows.Scan(&m.ChannelID, &m.Stream, &m.Field, &m.Unit, &updated); err != nil {
+			return nil, err
+		}
+		updated = updated.UTC()
+		m.UpdatedAt = &updated
+		mappings = append(mappings, m)
+	}
+	return mappings, rows.Err()
+}
+
+// PutDataChannelMapping creates or replaces the vessel's mapping of a
+// channel; it reports whether the mapping is new.
+func (s *SQLStore) PutDataChannelMapping(ctx context.Context, vesselID int64, m models.DataChannelMapping) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE data_channel_mappings SET stream = ?, field = ?, unit = ?, updated_at = ?
+		WHERE vessel_id = ? AND channel_id = ?`, m.Stream, m.Field, m.Unit, m.UpdatedAt, vesselID, m.ChannelID)
+	if err != nil {
+		return false, err
+	}
+	created := false
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO data_channel_mappings (vessel_id, channel_id, stream, field, unit, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			vesselID, m.ChannelID, m.Stream, m.Field, m.Unit, m.UpdatedAt); err != nil {
+			return false, err
+		}
+		created = true
+	}
+	return created, tx.Commit()
+}
+
+// DeleteDataChannelMapping removes the vessel's mapping of a channel.
+func (s *SQLStore) DeleteDataChannelMapping(ctx context.Context, vesselID int64, channelID string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM data_channel_mappings WHERE vessel_id = ? AND channel_id = ?", vesselID, channelID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PutChannelReading writes a reading unless the vessel already has one of
+// the channel at its time, which upsert replaces, keeping its ID.
+func (s *SQLStore) PutChannelReading(ctx context.Context, vesselID int64, r models.ChannelReading, upsert bool) (WriteResult, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id FROM channel_readings WHERE vessel_id = ? AND channel_id = ? AND ts = ?", vesselID, r.ChannelID, r.TS).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err := s.db.ExecContext(ctx, `
+			INSERT INTO channel_readings (vessel_id, channel_id, ts, value, text_value, quality, event, upload_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			vesselID, r.ChannelID, r.TS, r.Value, r.TextValue, r.Quality, r.Event, r.UploadID); err != nil {
+			return WriteSkipped, err
+		}
+		return WriteInserted, nil
+	case err != nil:
+		return WriteSkipped, err
+	case !upsert:
+		return WriteSkipped, nil
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE channel_readings SET value = ?, text_value = ?, quality = ?, event = ?, upload_id = ? WHERE id = ?`,
+		r.Value, r.TextValue, r.Quality, r.Event, r.UploadID, id); err != nil {
+		return WriteSkipped, err
+	}
+	return WriteUpdated, nil
+}
+
+// ChannelReadings returns the readings matching f, oldest first.
+func (s *SQLStore) ChannelReadings(ctx context.Context, f ChannelReadingFilter) ([]models.ChannelReading, error) {
+	query := `SELECT id, channel_id, ts, value, text_value, quality, event, upload_id FROM channel_readings
+		WHERE vessel_id = ? AND channel_id = ?`
+	args := []interface{}{f.VesselID, f.ChannelID}
+	query, args = timeRange(query, args, f.From, f.To)
+	query += " ORDER BY ts"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []models.ChannelReading{}
+	for rows.Next() {
+		var r models.ChannelReading
+		if err := rows.Scan(&r.ID, &r.ChannelID, &r.TS, &r.Value, &r.TextValue, &r.Quality, &r.Event, &r.UploadID); err != nil {
+			return nil, err
+		}
+		r.TS = r.TS.UTC()
+		readings = append(readings, r)
+	}
+	return readings, rows.Err()
+}
+
+// ChannelSummaries returns the channels the vessel has readings of, ordered
+// by channel ID.
+func (s *SQLStore) ChannelSummaries(ctx context.Context, vesselID int64) ([]models.ChannelSummary, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT channel_id, COUNT(*), MIN(ts), MAX(ts) FROM channel_readings
+		WHERE vessel_id = ? GROUP BY channel_id ORDER BY channel_id`, vesselID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.ChannelSummary{}
+	for rows.Next() {
+		var c models.ChannelSummary
+		var first, last sql.NullString
+		if err := rows.Scan(&c.ChannelID, &c.Readings, &first, &last); err != nil {
+			return nil, err
+		}
+		if t, err := parseTime(first); err != nil {
+			return nil, err
+		} else if t != nil {
+			c.FirstTS = *t
+		}
+		if t, err := parseTime(last); err != nil {
+			return nil, err
+		} else if t != nil {
+			c.LastTS = *t
+		}
+		summaries = append(summaries, c)
+	}
+	return summaries, rows.Err()
+}
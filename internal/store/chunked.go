@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// CreateChunkedUpload records a new chunked upload.
+func (s *SQLStore) CreateChunkedUpload(ctx context.Context, u models.ChunkedUpload) error {
+	var sha *string
+	if u.SHA256 != "" {
+		sha = &u.SHA256
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO chunked_uploads (id, filename, size, sha256, received, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.Filename, u.Size, sha, u.Received, u.CreatedAt, u.ExpiresAt)
+	return err
+}
+
+// ChunkedUpload returns a chunked upload in progress.
+func (s *SQLStore) ChunkedUpload(ctx context.Context, id string) (*models.ChunkedUpload, error) {
+	var u models.ChunkedUpload
+	var sha sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, filename, size, sha256, received, created_at, expires_at
+		FROM chunked_uploads WHERE id = ?`, id).
+		Scan(&u.ID, &u.Filename, &u.Size, &sha, &u.Received, &u.CreatedAt, &u.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.SHA256 = sha.String
+	u.CreatedAt, u.ExpiresAt = u.CreatedAt.UTC(), u.ExpiresAt.UTC()
+	return &u, nil
+}
+
+// AdvanceChunkedUpload moves the bytes received of an upload from from to
+// to, and reports false if another chunk moved them first.
+func (s *SQLStore) AdvanceChunkedUpload(ctx context.Context, id string, from, to int64, expiresAt time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE chunked_uploads SET received = ?, expires_at = ? WHERE id = ? AND received = ?",
+		to, expiresAt, id, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DeleteChunkedUpload forgets a chunked upload.
+func (s *SQLStore) DeleteChunkedUpload(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM chunked_uploads WHERE id = ?", id)
+	return err
+}
+
+// ExpiredChunkedUploads returns the uploads that expired by now.
+func (s *SQLStore) ExpiredChunkedUploads(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM chunked_uploads WHERE expires_at <= ? ORDER BY expires_at", now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const customStreamColumns = "id, name, description, sheets_json, unit_column, created_at, updated_at"
+
+// CustomStreams returns the custom stream definitions by name.
+func (s *SQLStore) CustomStreams(ctx context.Context) ([]models.CustomStream, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+customStreamColumns+" FROM custom_streams ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := []models.CustomStream{}
+	for rows.Next() {
+		def, err := scanCustomStream(rows)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range defs {
+		if defs[i].Columns, err = s.customColumns(ctx, defs[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return defs, nil
+}
+
+// CustomStream returns the custom stream called name, or ErrNotFound.
+func (s *SQLStore) CustomStream(ctx context.Context, name string) (*models.CustomStream, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+customStreamColumns+" FROM custom_streams WHERE name = ?", name)
+	def, err := scanCustomStream(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if def.Columns, err = s.customColumns(ctx, def.ID); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+func scanCustomStream(row rowScanner) (models.CustomStream, error) {
+	var def models.CustomStream
+	var sheets string
+	if err := row.Scan(&def.ID, &def.Name, &def.Description, &sheets, &def.UnitColumn, &def.CreatedAt, &def.UpdatedAt); err != nil {
+		return def, err
+	}
+	def.CreatedAt, def.UpdatedAt = def.CreatedAt.UTC(), def.UpdatedAt.UTC()
+	return def, json.Unmarshal([]byte(sheets), &def.Sheets)
+}
+
+func (s *SQLStore) customColumns(ctx context.Context, streamID int64) ([]models.CustomColumn, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT name, type, headers_json, min_value, max_value FROM custom_stream_columns WHERE stream_id = ? ORDER BY position", streamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []models.CustomColumn{}
+	for rows.Next() {
+		var col models.CustomColumn
+		var headers string
+		if err := rows.Scan(&col.Name, &col.Type, &headers, &col.Min, &col.Max); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(headers), &col.Headers); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// PutCustomStream defines or redefines a custom stream as of def.UpdatedAt
+// and reports whether it is new. Readings already written keep their values.
+func (s *SQLStore) PutCustomStream(ctx context.Context, def models.CustomStream) (bool, error) {
+	sheets, err := json.Marshal(def.Sheets)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	created := false
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE custom_streams SET description = ?, sheets_json = ?, unit_column = ?, updated_at = ?
+		WHERE name = ? RETURNING id`,
+		def.Description, string(sheets), def.UnitColumn, def.UpdatedAt, def.Name).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO custom_streams (name, description, sheets_json, unit_column, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+			def.Name, def.Description, string(sheets), def.UnitColumn, def.UpdatedAt, def.UpdatedAt).Scan(&id)
+		created = true
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM custom_stream_columns WHERE stream_id = ?", id); err != nil {
+		return false, err
+	}
+	for i, col := range def.Columns {
+		headers, err := json.Marshal(col.Headers)
+		if err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO custom_stream_columns (stream_id, position, name, type, headers_json, min_value, max_value)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, i, col.Name, col.Type, string(headers), col.Min, col.Max); err != nil {
+			return false, err
+		}
+	}
+	return created, tx.Commit()
+}
+
+// CountCustomReadings returns the number of readings of a custom stream.
+func (s *SQLStore) CountCustomReadings(ctx context.Context, streamID int64) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM custom_readings WHERE stream_id = ?", streamID).Scan(&n)
+	return n, err
+}
+
+// DeleteCustomStream removes a custom stream with its readings.
+func (s *SQLStore) DeleteCustomStream(ctx context.Context, name string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM custom_streams WHERE name = ?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"DELETE FROM custom_readings WHERE stream_id = ?",
+		"DELETE FROM custom_stream_columns WHERE stream_id = ?",
+		"DELETE FROM custom_streams WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CustomWrite is one reading of a custom stream to write.
+type CustomWrite struct {
+	StreamID  int64
+	VesselID  int64
+	TS        time.Time
+	Unit      *string
+	Values    map[string]interface{}
+	Source    string
+	RowHash   string
+	ExtraJSON json.RawMessage
+}
+
+// WriteCustomReading writes a custom stream reading the way WriteReading
+// writes built-in ones: duplicates by row_hash are ignored, and with upsert
+// a reading matched by vessel, timestamp and unit is overwritten.
+func (s *SQLStore) WriteCustomReading(ctx context.Context, w CustomWrite, upsert bool) (WriteResult, error) {
+	values, err := json.Marshal(w.Values)
+	if err != nil {
+		return WriteSkipped, err
+	}
+
+	if upsert {
+		var existingID int64
+		err := s.db.QueryRowContext(ctx,
+			"SELECT id FROM custom_readings WHERE stream_id = ? AND vessel_id = ? AND ts = ? AND unit IS ? ORDER BY id LIMIT 1",
+			w.StreamID, w.VesselID, w.TS, w.Unit).Scan(&existingID)
+		if err == nil {
+			result, err := s.db.ExecContext(ctx, `
+				UPDATE custom_readings SET values_json = ?, source = ?, extra_json = ?, row_hash = ?
+				WHERE id = ? AND NOT (values_json IS ? AND source IS ? AND extra_json IS ?)`,
+				string(values), w.Source, w.ExtraJSON, w.RowHash, existingID, string(values), w.Source, w.ExtraJSON)
+			if err != nil {
+				return WriteSkipped, err
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				return WriteSkipped, nil
+			}
+			return WriteUpdated, nil
+		} else if err != sql.ErrNoRows {
+			return WriteSkipped, err
+		}
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO custom_readings (stream_id, vessel_id, ts, unit, values_json, source, row_hash, extra_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.StreamID, w.VesselID, w.TS, w.Unit, string(values), w.Source, w.RowHash, w.ExtraJSON)
+	if err != nil {
+		return WriteSkipped, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return WriteSkipped, nil
+	}
+	return WriteInserted, nil
+}
+
+// CustomQuery selects readings of a custom stream. Zero values mean "no
+// filter"; pages are keyset-paginated on (ts, id) like ReadingQuery.
+type CustomQuery struct {
+	StreamID int64
+	VesselID int64
+	Unit     *string
+	From, To *time.Time
+	Desc     bool
+	AfterTS  time.Time
+	AfterID  int64
+	Limit    int
+}
+
+// CustomReadings returns the readings selected by q.
+func (s *SQLStore) CustomReadings(ctx context.Context, q CustomQuery) ([]models.CustomReading, error) {
+	query := `SELECT id, vessel_id, ts, unit, values_json, source, row_hash, extra_json, created_at
+		FROM custom_readings WHERE stream_id = ? AND vessel_id = ?`
+	args := []interface{}{q.StreamID, q.VesselID}
+	if q.Unit != nil {
+		query += " AND unit = ?"
+		args = append(args, *q.Unit)
+	}
+	query, args = timeRange(query, args, q.From, q.To)
+	dir, op := "", ">"
+	if q.Desc {
+		dir, op = " DESC", "<"
+	}
+	if !q.AfterTS.IsZero() {
+		query += " AND (ts " + op + " ? OR (ts = ? AND id " + op + " ?))"
+		args = append(args, q.AfterTS, q.AfterTS, q.AfterID)
+	}
+	query += " ORDER BY ts" + dir + ", id" + dir
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []models.CustomReading{}
+	for rows.Next() {
+		var r models.CustomReading
+		var values string
+		if err := rows.Scan(&r.ID, &r.VesselID, &r.TS, &r.Unit, &values, &r.Source, &r.RowHash, &r.ExtraJSON, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(values), &r.Values); err != nil {
+			return nil, err
+		}
+		r.TS, r.CreatedAt = r.TS.UTC(), r.CreatedAt.UTC()
+		readings = append(readings, r)
+	}
+	return readings, rows.Err()
+}
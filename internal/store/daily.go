@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const dailySummaryColumns = "vessel_id, day, distance_nm, avg_speed_knots, fuel_consumed_liters, engine_running_hours, alarm_count, completeness_percent, computed_at"
+
+// HoursWithData returns how many of the hours from..to hold at least one
+// reading of the vessel's stream.
+func (s *SQLStore) HoursWithData(ctx context.Context, stream *Stream, vesselID int64, from, to time.Time) (int, error) {
+	query := "SELECT COUNT(DISTINCT strftime('%Y-%m-%dT%H', ts)) FROM " + stream.Table + " WHERE vessel_id = ?"
+	query, args := timeRange(query, []interface{}{vesselID}, &from, &to)
+	var hours int
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&hours)
+	return hours, err
+}
+
+// PutDailySummary stores the summary of a vessel's day, replacing an
+// earlier one.
+func (s *SQLStore) PutDailySummary(ctx context.Context, d models.DailySummary) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO vessel_daily_summaries (`+dailySummaryColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(vessel_id, day) DO UPDATE SET
+			distance_nm = excluded.distance_nm, avg_speed_knots = excluded.avg_speed_knots,
+			fuel_consumed_liters = excluded.fuel_consumed_liters, engine_running_hours = excluded.engine_running_hours,
+			alarm_count = excluded.alarm_count, completeness_percent = excluded.completeness_percent,
+			computed_at = excluded.computed_at`,
+		d.VesselID, d.Day, d.DistanceNM, d.AvgSpeedKnots, d.FuelConsumedLiters, d.EngineRunningHours,
+		d.AlarmCount, d.CompletenessPercent, d.ComputedAt)
+	return err
+}
+
+// DailySummaries returns the vessel's summaries of the days from..to
+// (YYYY-MM-DD, inclusive, empty for unbounded), oldest first.
+func (s *SQLStore) DailySummaries(ctx context.Context, vesselID int64, from, to string) ([]models.DailySummary, error) {
+	query := "SELECT " + dailySummaryColumns + " FROM vessel_daily_summaries WHERE vessel_id = ?"
+	args := []interface{}{vesselID}
+	if from != "" {
+		query += " AND day >= ?"
+		args = append(args, from)
+	}
+	if to != "" {
+		query += " AND day <= ?"
+		args = append(args, to)
+	}
+	query += " ORDER BY day"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.DailySummary{}
+	for rows.Next() {
+		var d models.DailySummary
+		var speed sql.NullFloat64
+		if err := rows.Scan(&d.VesselID, &d.Day, &d.DistanceNM, &speed, &d.FuelConsumedLiters, &d.EngineRunningHours,
+			&d.AlarmCount, &d.CompletenessPercent, &d.ComputedAt); err != nil {
+			return nil, err
+		}
+		if speed.Valid {
+			d.AvgSpeedKnots = &speed.Float64
+		}
+		d.ComputedAt = d.ComputedAt.UTC()
+		summaries = append(summaries, d)
+	}
+	return summaries, rows.Err()
+}
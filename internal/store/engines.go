@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const engineColumns = "engine_no, name, maker, model, rated_rpm, rated_power_kw, commissioned_on, updated_at"
+
+// Engines returns the vessel's registered engines by engine number.
+func (s *SQLStore) Engines(ctx context.Context, vesselID int64) ([]models.Engine, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+engineColumns+" FROM engines WHERE vessel_id = ? ORDER BY engine_no", vesselID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	engines := []models.Engine{}
+	for rows.Next() {
+		var e models.Engine
+		if err := rows.Scan(&e.EngineNo, &e.Name, &e.Maker, &e.Model, &e.RatedRPM, &e.RatedPowerKW, &e.CommissionedOn, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		e.UpdatedAt = e.UpdatedAt.UTC()
+		engines = append(engines, e)
+	}
+	return engines, rows.Err()
+}
+
+// PutEngine registers or replaces an engine as of e.UpdatedAt and reports
+// whether it is new.
+func (s *SQLStore) PutEngine(ctx context.Context, vesselID int64, e models.Engine) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE engines SET name = ?, maker = ?, model = ?, rated_rpm = ?, rated_power_kw = ?, commissioned_on = ?, updated_at = ?
+		WHERE vessel_id = ? AND engine_no = ?`,
+		e.Name, e.Maker, e.Model, e.RatedRPM, e.RatedPowerKW, e.CommissionedOn, e.UpdatedAt, vesselID, e.EngineNo)
+	if err != nil {
+		return false, err
+	}
+	created := false
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO engines (vessel_id, "+engineColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			vesselID, e.EngineNo, e.Name, e.Maker, e.Model, e.RatedRPM, e.RatedPowerKW, e.CommissionedOn, e.UpdatedAt); err != nil {
+			return false, err
+		}
+		created = true
+	}
+	return created, tx.Commit()
+}
+
+// DeleteEngine removes an engine from the registry.
+func (s *SQLStore) DeleteEngine(ctx context.Context, vesselID int64, engineNo int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM engines WHERE vessel_id = ? AND engine_no = ?", vesselID, engineNo)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// EquipmentLogFilter selects equipment log entries of a vessel. Zero values
+// mean "no filter".
+type EquipmentLogFilter struct {
+	VesselID  int64
+	Kind      string
+	Equipment string
+	Unit      string
+	Status    string
+	From, To  string // YYYY-MM-DD, inclusive
+	// NewestFirst with Limit returns the latest entries
+	NewestFirst bool
+	Limit       int
+}
+
+const equipmentLogColumns = `id, vessel_id, kind, equipment, unit, sensor_ref, maintenance_item_id, title, description,
+	severity, occurred_on, status, closed_on, created_at, updated_at`
+
+// EquipmentLog returns the entries matching f, oldest first unless
+// f.NewestFirst.
+func (s *SQLStore) EquipmentLog(ctx context.Context, f EquipmentLogFilter) ([]models.EquipmentLogEntry, error) {
+	query := "SELECT " + equipmentLogColumns + " FROM equipment_log WHERE vessel_id = ?"
+	args := []interface{}{f.VesselID}
+	for _, eq := range []struct{ col, value string }{
+		{"kind", f.Kind}, {"equipment", f.Equipment}, {"unit", f.Unit}, {"status", f.Status},
+	} {
+		if eq.value != "" {
+			query += " AND " + eq.col + " = ?"
+			args = append(args, eq.value)
+		}
+	}
+	if f.From != "" {
+		query += " AND occurred_on >= ?"
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		query += " AND occurred_on <= ?"
+		args = append(args, f.To)
+	}
+	if f.NewestFirst {
+		query += " ORDER BY occurred_on DESC, id DESC"
+	} else {
+		query += " ORDER BY occurred_on, id"
+	}
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.EquipmentLogEntry{}
+	for rows.Next() {
+		e, err := scanEquipmentLogEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// EquipmentLogEntry returns one entry of the vessel's log, or ErrNotFound.
+func (s *SQLStore) EquipmentLogEntry(ctx context.Context, vesselID, id int64) (*models.EquipmentLogEntry, error) {
+	e, err := scanEquipmentLogEntry(s.db.QueryRowContext(ctx,
+		"SELECT "+equipmentLogColumns+" FROM equipment_log WHERE vessel_id = ? AND id = ?", vesselID, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func scanEquipmentLogEntry(row rowScanner) (models.EquipmentLogEntry, error) {
+	var e models.EquipmentLogEntry
+	var sensorRef, itemID sql.NullInt64
+	if err := row.Scan(&e.ID, &e.VesselID, &e.Kind, &e.Equipment, &e.Unit, &sensorRef, &itemID, &e.Title, &e.Description,
+		&e.Severity, &e.OccurredOn, &e.Status, &e.ClosedOn, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return e, err
+	}
+	if sensorRef.Valid {
+		e.SensorID = &sensorRef.Int64
+	}
+	if itemID.Valid {
+		e.MaintenanceItemID = &itemID.Int64
+	}
+	e.CreatedAt, e.UpdatedAt = e.CreatedAt.UTC(), e.UpdatedAt.UTC()
+	return e, nil
+}
+
+// CreateEquipmentLogEntry stores a new entry and returns its ID. Maintenance
+// completing a maintenance item moves the item's last_done_on up to it.
+func (s *SQLStore) CreateEquipmentLogEntry(ctx context.Context, e models.EquipmentLogEntry) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO equipment_log (vessel_id, kind, equipment, unit, sensor_ref, maintenance_item_id, title, description,
+			severity, occurred_on, status, closed_on, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.VesselID, e.Kind, e.Equipment, e.Unit, e.SensorID, e.MaintenanceItemID, e.Title, e.Description,
+		e.Severity, e.OccurredOn, e.Status, e.ClosedOn, e.CreatedAt, e.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := completeMaintenanceItem(ctx, tx, e); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateEquipmentLogEntry replaces an entry, or returns ErrNotFound.
+func (s *SQLStore) UpdateEquipmentLogEntry(ctx context.Context, e models.EquipmentLogEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE equipment_log SET kind = ?, equipment = ?, unit = ?, sensor_ref = ?, maintenance_item_id = ?, title = ?,
+			description = ?, severity = ?, occurred_on = ?, status = ?, closed_on = ?, updated_at = ?
+		WHERE vessel_id = ? AND id = ?`,
+		e.Kind, e.Equipment, e.Unit, e.SensorID, e.MaintenanceItemID, e.Title,
+		e.Description, e.Severity, e.OccurredOn, e.Status, e.ClosedOn, e.UpdatedAt, e.VesselID, e.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if err := completeMaintenanceItem(ctx, tx, e); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// completeMaintenanceItem moves the last_done_on of the maintenance item an
+// entry completed up to the entry's day.
+func completeMaintenanceItem(ctx context.Context, tx *sql.Tx, e models.EquipmentLogEntry) error {
+	if e.Kind != models.LogMaintenance || e.MaintenanceItemID == nil {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		UPDATE maintenance_items SET last_done_on = ?, updated_at = ?
+		WHERE vessel_id = ? AND id = ? AND last_done_on < ?`,
+		e.OccurredOn, time.Now().UTC().Truncate(time.Second), e.VesselID, *e.MaintenanceItemID, e.OccurredOn)
+	return err
+}
+
+// DeleteEquipmentLogEntry removes an entry of the vessel's log, or returns
+// ErrNotFound. A maintenance item it completed keeps its last_done_on.
+func (s *SQLStore) DeleteEquipmentLogEntry(ctx context.Context, vesselID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM equipment_log WHERE vessel_id = ? AND id = ?", vesselID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/util"
+)
+
+// extraInlineMax is the longest extra_json payload always kept in its
+// reading's row. Longer ones, which tend to be static metadata repeated on
+// every row of a sheet, are stored once in extra_payloads and referenced by
+// hash from their second sight on, so unique payloads stay inline and their
+// reads skip the lookup of extraJSONColumn.
+const extraInlineMax = 64
+
+const (
+	// extraSeenWindow is how long a payload seen once is remembered: one
+	// repeated less often stays inline.
+	extraSeenWindow = 24 * time.Hour
+	// extraPruneGrace keeps payloads no reading references for a while, so
+	// a write that has just referenced one does not lose it to the prune.
+	extraPruneGrace = time.Hour
+)
+
+// extraJSONColumn is the SQL of a reading's extra_json, taken back from
+// extra_payloads when kept there. prefix qualifies the columns, e.g. "r.".
+// COALESCE stops at the inline payload, so only referenced ones are looked up.
+func extraJSONColumn(prefix string) string {
+	return "COALESCE(" + prefix + "extra_json, (SELECT payload FROM extra_payloads WHERE hash = " + prefix + "extra_hash))"
+}
+
+// storeExtra moves the extra_json of a write to extra_payloads when longer
+// than extraInlineMax and seen before, adding the payload there unless
+// already in, and sets the extra_hash the row references it by (NULL when
+// kept inline, so an update clears the old reference). A payload seen for
+// the first time is kept inline and remembered in extra_seen.
+func storeExtra(ctx context.Context, db execer, w ReadingWrite) (ReadingWrite, error) {
+	for i, col := range w.Cols {
+		if col != "extra_json" {
+			continue
+		}
+		var payload []byte
+		switch v := w.Vals[i].(type) {
+		case []byte:
+			payload = v
+		case json.RawMessage:
+			payload = v
+		case string:
+			payload = []byte(v)
+		}
+		vals := append([]interface{}{}, w.Vals...)
+		var hash interface{}
+		if len(payload) > extraInlineMax {
+			sum := util.SHA256Hex(payload)
+			shared, err := shareExtra(ctx, db, sum, payload)
+			if err != nil {
+				return w, err
+			}
+			if shared {
+				vals[i], hash = nil, sum
+			}
+		}
+		w.Cols = append(w.Cols[:len(w.Cols):len(w.Cols)], "extra_hash")
+		w.Vals = append(vals, hash)
+		return w, nil
+	}
+	return w, nil
+}
+
+// shareExtra reports whether a long payload is to be referenced from
+// extra_payloads: it is there already, or was seen before and is moved
+// there now. Either way its used_at is bumped.
+func shareExtra(ctx context.Context, db execer, hash string, payload []byte) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	result, err := db.ExecContext(ctx, "UPDATE extra_payloads SET used_at = ? WHERE hash = ?", now, hash)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return true, nil
+	}
+
+	result, err = db.ExecContext(ctx, "INSERT INTO extra_seen (hash, seen_at) VALUES (?, ?) ON CONFLICT (hash) DO NOTHING", hash, now)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return false, nil // first sight
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO extra_payloads (hash, payload, used_at) VALUES (?, ?, ?)
+		ON CONFLICT (hash) DO UPDATE SET used_at = excluded.used_at`, hash, payload, now)
+	if err == nil {
+		_, err = db.ExecContext(ctx, "DELETE FROM extra_seen WHERE hash = ?", hash)
+	}
+	return err == nil, err
+}
+
+// PruneExtraPayloads deletes the extra_payloads no reading references and
+// no write has used for extraPruneGrace, and forgets the payloads seen once
+// more than extraSeenWindow before now. It returns how many payloads were
+// deleted.
+func (s *SQLStore) PruneExtraPayloads(ctx context.Context, now time.Time) (int64, error) {
+	var unreferenced []string
+	for _, stream := range Streams {
+		unreferenced = append(unreferenced,
+			"NOT EXISTS (SELECT 1 FROM "+stream.Table+" WHERE extra_hash = extra_payloads.hash)")
+	}
+	// used_at is NULL for payloads stored before it was recorded
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM extra_payloads
+		WHERE (used_at IS NULL OR used_at < ?) AND `+strings.Join(unreferenced, " AND "),
+		now.Add(-extraPruneGrace).UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM extra_seen WHERE seen_at < ?", now.Add(-extraSeenWindow).UTC().Format(time.RFC3339))
+	return n, err
+}
+
+// extraOps are the comparisons of an ExtraFilter, two-character ones first
+// so ">=" is not read as ">".
+var extraOps = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// ExtraFilter compares the value of a key of extra_json, where the columns
+// no mapper recognized are kept. Readings without the key never match.
+type ExtraFilter struct {
+	Key   string
+	Op    string // one of extraOps
+	Value string
+	// number is Value as a number; the reading's value then compares by its
+	// leading number, so "5200" and "5200 h" both exceed 5000
+	number *float64
+}
+
+// ParseExtraFilter parses "<key><op><value>", e.g. "Running Hours>5000".
+// Keys are matched exactly as shown in extra_json. Text values can only be
+// compared with = and !=.
+func ParseExtraFilter(s string) (ExtraFilter, error) {
+	i := strings.IndexAny(s, "!<>=")
+	if i < 0 {
+		return ExtraFilter{}, errors.New("missing comparison, use e.g. Running Hours>5000")
+	}
+	f := ExtraFilter{Key: strings.TrimSpace(s[:i])}
+	for _, op := range extraOps {
+		if strings.HasPrefix(s[i:], op) {
+			f.Op = op
+			f.Value = strings.TrimSpace(s[i+len(op):])
+			break
+		}
+	}
+	switch {
+	case f.Key == "":
+		return f, errors.New("missing key")
+	case strings.Contains(f.Key, `"`):
+		return f, errors.New("keys cannot contain quotes")
+	case f.Op == "":
+		return f, errors.New("invalid comparison, use one of " + strings.Join(extraOps, " "))
+	case f.Value == "":
+		return f, errors.New("missing value")
+	}
+	if n, err := strconv.ParseFloat(f.Value, 64); err == nil {
+		f.number = &n
+	} else if f.Op != "=" && f.Op != "!=" {
+		return f, errors.New("text values can only be compared with = or !=")
+	}
+	return f, nil
+}
+
+func (f ExtraFilter) apply(query string, args []interface{}) (string, []interface{}) {
+	// extra_json is stored as a blob, which newer SQLite versions would read as JSONB
+	value := "json_extract(CAST(" + extraJSONColumn("") + " AS TEXT), ?)"
+	path := `$."` + f.Key + `"`
+	if f.number == nil {
+		return query + " AND " + value + " " + f.Op + " ?", append(args, path, f.Value)
+	}
+	return query + " AND " + value + " GLOB '*[0-9]*' AND CAST(" + value + " AS REAL) " + f.Op + " ?",
+		append(args, path, path, *f.number)
+}
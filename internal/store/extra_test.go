@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/models"
+)
+
+func TestParseExtraFilter(t *testing.T) {
+	for s, want := range map[string]ExtraFilter{
+		"Running Hours>5000": {Key: "Running Hours", Op: ">", Value: "5000"},
+		" Load % >= 12.5 ":   {Key: "Load %", Op: ">=", Value: "12.5"},
+		"Mode=ECO":           {Key: "Mode", Op: "=", Value: "ECO"},
+		"Mode != ECO":        {Key: "Mode", Op: "!=", Value: "ECO"},
+		"Note=a=b":           {Key: "Note", Op: "=", Value: "a=b"},
+	} {
+		got, err := ParseExtraFilter(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if got.Key != want.Key || got.Op != want.Op || got.Value != want.Value {
+			t.Errorf("%q: expected %+v, got %+v", s, want, got)
+		}
+		if numeric := got.number != nil; numeric != (got.Value != "ECO" && got.Value != "a=b") {
+			t.Errorf("%q: unexpected numeric %v", s, numeric)
+		}
+	}
+	for _, s := range []string{"Running Hours", ">5000", "Running Hours>", "Mode>ECO", `a"b=1`, "Mode!ECO"} {
+		if _, err := ParseExtraFilter(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestExtraPayloads(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.Connect(filepath.Join(t.TempDir(), "extra.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	s := New(database)
+	vessel, err := s.CreateVessel(ctx, models.Vessel{Name: "Alpha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	static := `{"Installation":"Main engine room, port side","Maker":"MAN B&W","Running Hours":"5200 h"}`
+	write := func(engine int, extra string, upsert bool) {
+		_, err := s.WriteReading(ctx, ReadingWrite{
+			Table: "engine_readings", UnitCol: "engine_no", Unit: engine, VesselID: vessel,
+			TS:      time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC),
+			RowHash: strconv.Itoa(engine) + extra,
+			Cols:    []string{"engine_no", "rpm", "extra_json"}, Vals: []interface{}{engine, 1500.0, []byte(extra)},
+		}, upsert)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	unique := `{"Installation":"Auxiliary engine room, starboard side","Maker":"Wartsila"}`
+	write(1, static, false)
+	write(2, static, false)
+	write(3, `{"Mode":"ECO"}`, false)
+	write(4, unique, false)
+
+	// The long payload is stored once from its second sight on; the short
+	// one and the one seen once stay inline
+	var payloads, inline int
+	database.QueryRow("SELECT COUNT(*) FROM extra_payloads").Scan(&payloads)
+	database.QueryRow("SELECT COUNT(*) FROM engine_readings WHERE extra_json IS NOT NULL").Scan(&inline)
+	if payloads != 1 || inline != 3 {
+		t.Errorf("Expected 1 payload and 3 inline, got %d and %d", payloads, inline)
+	}
+
+	// Readings and filters see the payload as written
+	readings, err := s.ReadingsAfter(ctx, "engines", 0, 10)
+	if err != nil || len(readings) != 4 {
+		t.Fatalf("Expected 4 readings, got %d, %v", len(readings), err)
+	}
+	for i, want := range []string{static, static, `{"Mode":"ECO"}`, unique} {
+		if string(readings[i].ExtraJSON) != want {
+			t.Errorf("Reading %d: expected %s, got %s", i, want, readings[i].ExtraJSON)
+		}
+	}
+	filter, _ := ParseExtraFilter("Running Hours>5000")
+	rows, err := s.QueryReadings(ctx, ReadingQuery{Stream: Streams["engines"], VesselID: vessel, Extra: []ExtraFilter{filter}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	rows.Close()
+	if n != 2 {
+		t.Errorf("Expected 2 readings over 5000 running hours, got %d", n)
+	}
+
+	// Updated to a short payload, the reading no longer references the long one
+	write(2, `{}`, true)
+	var hash sql.NullString
+	database.QueryRow("SELECT extra_hash FROM engine_readings WHERE engine_no = 2").Scan(&hash)
+	if hash.Valid {
+		t.Errorf("Expected no reference left, got %s", hash.String)
+	}
+
+	// The unreferenced payload is pruned once its grace is over, and the
+	// payload seen once forgotten after the window
+	if n, err := s.PruneExtraPayloads(ctx, time.Now()); err != nil || n != 0 {
+		t.Errorf("Expected the payload kept within its grace, got %d pruned, %v", n, err)
+	}
+	if n, err := s.PruneExtraPayloads(ctx, time.Now().Add(extraSeenWindow+time.Hour)); err != nil || n != 1 {
+		t.Errorf("Expected the payload pruned, got %d, %v", n, err)
+	}
+	var seen int
+	database.QueryRow("SELECT COUNT(*) FROM extra_seen").Scan(&seen)
+	if seen != 0 {
+		t.Errorf("Expected the payloads seen once forgotten, got %d", seen)
+	}
+	if readings, _ := s.ReadingsAfter(ctx, "engines", 0, 10); string(readings[0].ExtraJSON) != static {
+		t.Errorf("Expected the inline payload kept, got %s", readings[0].ExtraJSON)
+	}
+}
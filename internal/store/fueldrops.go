@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"vessel-telemetry-api/internal/fueldrop"
+	"vessel-telemetry-api/internal/models"
+)
+
+// RebuildFuelDropAlerts re-runs fuel drop detection for the vessel after
+// fuel, engine or position readings at or after since were written, and
+// returns the alerts raised for the first time. As with alarm events,
+// alerts ending before since are kept and the others rebuilt from the
+// earliest of them; rebuilt alerts keep their raised_at.
+func (s *SQLStore) RebuildFuelDropAlerts(ctx context.Context, vesselID int64, since time.Time, opts fueldrop.Options) ([]models.FuelDropAlert, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Deleting first takes the write lock before anything is read
+	raised := map[string]time.Time{}
+	from := since
+	for {
+		earliest, err := deleteFuelDropAlertsFrom(ctx, tx, vesselID, from, raised)
+		if err != nil {
+			return nil, err
+		}
+		if earliest == nil || !earliest.Before(from) {
+			break
+		}
+		from = *earliest
+	}
+
+	// A drop into from starts at the tanks' previous reading
+	levelsFrom := from
+	var previous sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT MIN(last) FROM (
+			SELECT MAX(ts) AS last FROM fuel_tank_readings
+			WHERE vessel_id = ? AND ts < ? AND volume_liters IS NOT NULL
+			GROUP BY tank_no)`, vesselID, from).Scan(&previous)
+	if err != nil {
+		return nil, err
+	}
+	if t, err := parseTime(previous); err != nil {
+		return nil, err
+	} else if t != nil {
+		levelsFrom = *t
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT tank_no, ts, volume_liters FROM fuel_tank_readings
+		WHERE vessel_id = ? AND ts >= ? AND volume_liters IS NOT NULL
+		ORDER BY tank_no, ts, id`, vesselID, levelsFrom)
+	if err != nil {
+		return nil, err
+	}
+	var levels []fueldrop.Level
+	for rows.Next() {
+		var l fueldrop.Level
+		var tankNo sql.NullInt64
+		if err := rows.Scan(&tankNo, &l.TS, &l.Liters); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if tankNo.Valid {
+			n := int(tankNo.Int64)
+			l.TankNo = &n
+		}
+		levels = append(levels, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	contextFrom := levelsFrom.Add(-opts.Window)
+	engines, err := fuelDropSamples(ctx, tx, "SELECT ts, rpm FROM engine_readings WHERE vessel_id = ? AND ts >= ? AND rpm IS NOT NULL ORDER BY ts", vesselID, contextFrom)
+	if err != nil {
+		return nil, err
+	}
+	speeds, err := fuelDropSamples(ctx, tx, "SELECT ts, speed_knots FROM location_readings WHERE vessel_id = ? AND ts >= ? AND speed_knots IS NOT NULL ORDER BY ts", vesselID, contextFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var fresh []models.FuelDropAlert
+	for _, a := range fueldrop.Detect(levels, engines, speeds, opts) {
+		// Alerts ending before from were kept
+		if a.End.Before(from) {
+			continue
+		}
+		raisedAt, seen := raised[fuelDropKey(a.TankNo, a.Start)]
+		if !seen {
+			raisedAt = now
+		}
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO fuel_drop_alerts (vessel_id, tank_no, start_ts, end_ts, start_liters, end_liters, drop_liters, rate_lph, reason, raised_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			vesselID, a.TankNo, a.Start, a.End, a.StartLiters, a.EndLiters, a.DropLiters, a.RateLPH, a.Reason(), raisedAt)
+		if err != nil {
+			return nil, err
+		}
+		if !seen {
+			id, _ := result.LastInsertId()
+			fresh = append(fresh, models.FuelDropAlert{
+				ID: id, TankNo: a.TankNo, Start: a.Start, End: a.End,
+				StartLiters: a.StartLiters, EndLiters: a.EndLiters, DropLiters: a.DropLiters, RateLPH: a.RateLPH,
+				Reason: a.Reason(), RaisedAt: raisedAt,
+			})
+		}
+	}
+
+	return fresh, tx.Commit()
+}
+
+// fuelDropKey identifies an alert across rebuilds.
+func fuelDropKey(tankNo *int, start time.Time) string {
+	if tankNo == nil {
+		return fmt.Sprintf("-/%d", start.UnixNano())
+	}
+	return fmt.Sprintf("%d/%d", *tankNo, start.UnixNano())
+}
+
+// deleteFuelDropAlertsFrom deletes the vessel's alerts ending at or after
+// from, notes when each was raised and returns the earliest start.
+func deleteFuelDropAlertsFrom(ctx context.Context, tx *sql.Tx, vesselID int64, from time.Time, raised map[string]time.Time) (*time.Time, error) {
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM fuel_drop_alerts
+		WHERE vessel_id = ? AND end_ts >= ?
+		RETURNING tank_no, start_ts, raised_at`, vesselID, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var earliest *time.Time
+	for rows.Next() {
+		var tankNo sql.NullInt64
+		var rawStart, rawRaised sql.NullString
+		if err := rows.Scan(&tankNo, &rawStart, &rawRaised); err != nil {
+			return nil, err
+		}
+		start, err := parseTime(rawStart)
+		if err != nil {
+			return nil, err
+		}
+		raisedAt, err := parseTime(rawRaised)
+		if err != nil {
+			return nil, err
+		}
+		var tank *int
+		if tankNo.Valid {
+			n := int(tankNo.Int64)
+			tank = &n
+		}
+		if start != nil && raisedAt != nil {
+			raised[fuelDropKey(tank, *start)] = *raisedAt
+		}
+		if start != nil && (earliest == nil || start.Before(*earliest)) {
+			earliest = start
+		}
+	}
+	return earliest, rows.Err()
+}
+
+func fuelDropSamples(ctx context.Context, tx *sql.Tx, query string, vesselID int64, from time.Time) ([]fueldrop.Sample, error) {
+	rows, err := tx.QueryContext(ctx, query, vesselID, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []fueldrop.Sample
+	for rows.Next() {
+		var s fueldrop.Sample
+		if err := rows.Scan(&s.TS, &s.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+// FuelDropAlerts returns the vessel's alerts overlapping from..to, oldest
+// first.
+func (s *SQLStore) FuelDropAlerts(ctx context.Context, vesselID int64, from, to *time.Time) ([]models.FuelDropAlert, error) {
+	query := `SELECT id, tank_no, start_ts, end_ts, start_liters, end_liters, drop_liters, rate_lph, reason, raised_at
+		FROM fuel_drop_alerts WHERE vessel_id = ?`
+	args := []interface{}{vesselID}
+	if from != nil {
+		query += " AND end_ts >= ?"
+		args = append(args, *from)
+	}
+	if to != nil {
+		query += " AND start_ts <= ?"
+		args = append(args, *to)
+	}
+	query += " ORDER BY start_ts, tank_no"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []models.FuelDropAlert{}
+	for rows.Next() {
+		var a models.FuelDropAlert
+		var tankNo sql.NullInt64
+		if err := rows.Scan(&a.ID, &tankNo, &a.Start, &a.End, &a.StartLiters, &a.EndLiters, &a.DropLiters, &a.RateLPH, &a.Reason, &a.RaisedAt); err != nil {
+			return nil, err
+		}
+		if tankNo.Valid {
+			n := int(tankNo.Int64)
+			a.TankNo = &n
+		}
+		a.Start, a.End, a.RaisedAt = a.Start.UTC(), a.End.UTC(), a.RaisedAt.UTC()
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// maintenanceItemColumns select an item with the running hours tracked for
+// its engine or generator on the days after it was last done.
+const maintenanceItemColumns = `m.id, m.vessel_id, m.equipment, m.unit_no, m.task, m.interval_hours, m.interval_days,
+	m.last_done_on, m.notes, m.created_at, m.updated_at,
+	CASE m.equipment
+		WHEN 'engine' THEN (SELECT COALESCE(SUM(hours), 0) FROM engine_running_hours r
+			WHERE r.vessel_id = m.vessel_id AND r.engine_no = m.unit_no AND r.day > m.last_done_on)
+		ELSE (SELECT COALESCE(SUM(hours), 0) FROM generator_running_hours r
+			WHERE r.vessel_id = m.vessel_id AND r.gen_no = m.unit_no AND r.day > m.last_done_on)
+	END`
+
+// MaintenanceItems returns the maintenance items of the vessels, by vessel,
+// equipment, unit and ID, without their status.
+func (s *SQLStore) MaintenanceItems(ctx context.Context, vesselIDs []int64) ([]models.MaintenanceItem, error) {
+	items := []models.MaintenanceItem{}
+	if len(vesselIDs) == 0 {
+		return items, nil
+	}
+	args := make([]interface{}, len(vesselIDs))
+	for i, id := range vesselIDs {
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT "+maintenanceItemColumns+" FROM maintenance_items m"+
+		" WHERE m.vessel_id IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(vesselIDs)), ", ")+")"+
+		" ORDER BY m.vessel_id, m.equipment, m.unit_no, m.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanMaintenanceItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// MaintenanceItem returns one maintenance item of the vessel, or ErrNotFound.
+func (s *SQLStore) MaintenanceItem(ctx context.Context, vesselID, id int64) (*models.MaintenanceItem, error) {
+	item, err := scanMaintenanceItem(s.db.QueryRowContext(ctx,
+		"SELECT "+maintenanceItemColumns+" FROM maintenance_items m WHERE m.vessel_id = ? AND m.id = ?", vesselID, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func scanMaintenanceItem(row rowScanner) (models.MaintenanceItem, error) {
+	var item models.MaintenanceItem
+	var intervalHours sql.NullFloat64
+	var intervalDays sql.NullInt64
+	if err := row.Scan(&item.ID, &item.VesselID, &item.Equipment, &item.UnitNo, &item.Task, &intervalHours, &intervalDays,
+		&item.LastDoneOn, &item.Notes, &item.CreatedAt, &item.UpdatedAt, &item.HoursSinceDone); err != nil {
+		return item, err
+	}
+	if intervalHours.Valid {
+		item.IntervalHours = &intervalHours.Float64
+	}
+	if intervalDays.Valid {
+		n := int(intervalDays.Int64)
+		item.IntervalDays = &n
+	}
+	item.CreatedAt, item.UpdatedAt = item.CreatedAt.UTC(), item.UpdatedAt.UTC()
+	return item, nil
+}
+
+// CreateMaintenanceItem stores a new maintenance item and returns its ID.
+func (s *SQLStore) CreateMaintenanceItem(ctx context.Context, item models.MaintenanceItem) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO maintenance_items (vessel_id, equipment, unit_no, task, interval_hours, interval_days, last_done_on, notes, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		item.VesselID, item.Equipment, item.UnitNo, item.Task, item.IntervalHours, item.IntervalDays,
+		item.LastDoneOn, item.Notes, item.CreatedAt, item.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateMaintenanceItem replaces a maintenance item, or returns ErrNotFound.
+func (s *SQLStore) UpdateMaintenanceItem(ctx context.Context, item models.MaintenanceItem) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE maintenance_items SET equipment = ?, unit_no = ?, task = ?, interval_hours = ?, interval_days = ?,
+			last_done_on = ?, notes = ?, updated_at = ?
+		WHERE vessel_id = ? AND id = ?`,
+		item.Equipment, item.UnitNo, item.Task, item.IntervalHours, item.IntervalDays,
+		item.LastDoneOn, item.Notes, item.UpdatedAt, item.VesselID, item.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteMaintenanceItem removes a maintenance item of the vessel, or returns
+// ErrNotFound.
+func (s *SQLStore) DeleteMaintenanceItem(ctx context.Context, vesselID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM maintenance_items WHERE vessel_id = ? AND id = ?", vesselID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const modbusRegisterColumns = `id, vessel_id, device, slave_id, register_table, address, data_type, word_swap, scale, value_offset,
+	stream, field, unit, last_value, last_polled_at, last_error, created_at, updated_at`
+
+// ModbusRegisters returns the Modbus registers of a vessel, of every vessel
+// if vesselID is 0, by vessel, device, slave, table and address.
+func (s *SQLStore) ModbusRegisters(ctx context.Context, vesselID int64) ([]models.ModbusRegister, error) {
+	query := "SELECT " + modbusRegisterColumns + " FROM modbus_registers"
+	var args []interface{}
+	if vesselID != 0 {
+		query += " WHERE vessel_id = ?"
+		args = append(args, vesselID)
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY vessel_id, device, slave_id, register_table, address, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	registers := []models.ModbusRegister{}
+	for rows.Next() {
+		r, err := scanModbusRegister(rows)
+		if err != nil {
+			return nil, err
+		}
+		registers = append(registers, r)
+	}
+	return registers, rows.Err()
+}
+
+// ModbusRegister returns one Modbus register of the vessel, or ErrNotFound.
+func (s *SQLStore) ModbusRegister(ctx context.Context, vesselID, id int64) (*models.ModbusRegister, error) {
+	r, err := scanModbusRegister(s.db.QueryRowContext(ctx,
+		"SELECT "+modbusRegisterColumns+" FROM modbus_registers WHERE vessel_id = ? AND id = ?", vesselID, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func scanModbusRegister(row rowScanner) (models.ModbusRegister, error) {
+	var r models.ModbusRegister
+	var polledAt sql.NullTime
+	if err := row.Scan(&r.ID, &r.VesselID, &r.Device, &r.SlaveID, &r.Table, &r.Address, &r.DataType, &r.WordSwap, &r.Scale, &r.Offset,
+		&r.Stream, &r.Field, &r.Unit, &r.LastValue, &polledAt, &r.LastError, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return r, err
+	}
+	if polledAt.Valid {
+		at := polledAt.Time.UTC()
+		r.LastPolledAt = &at
+	}
+	r.CreatedAt, r.UpdatedAt = r.CreatedAt.UTC(), r.UpdatedAt.UTC()
+	return r, nil
+}
+
+// CreateModbusRegister stores a new Modbus register and returns its ID.
+func (s *SQLStore) CreateModbusRegister(ctx context.Context, r models.ModbusRegister) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO modbus_registers (vessel_id, device, slave_id, register_table, address, data_type, word_swap, scale, value_offset,
+			stream, field, unit, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.VesselID, r.Device, r.SlaveID, r.Table, r.Address, r.DataType, r.WordSwap, r.Scale, r.Offset,
+		r.Stream, r.Field, r.Unit, r.CreatedAt, r.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateModbusRegister replaces a Modbus register, forgetting its latest
+// poll, or returns ErrNotFound.
+func (s *SQLStore) UpdateModbusRegister(ctx context.Context, r models.ModbusRegister) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE modbus_registers SET device = ?, slave_id = ?, register_table = ?, address = ?, data_type = ?, word_swap = ?,
+			scale = ?, value_offset = ?, stream = ?, field = ?, unit = ?,
+			last_value = NULL, last_polled_at = NULL, last_error = NULL, updated_at = ?
+		WHERE vessel_id = ? AND id = ?`,
+		r.Device, r.SlaveID, r.Table, r.Address, r.DataType, r.WordSwap, r.Scale, r.Offset, r.Stream, r.Field, r.Unit,
+		r.UpdatedAt, r.VesselID, r.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteModbusRegister removes a Modbus register of the vessel, or returns
+// ErrNotFound.
+func (s *SQLStore) DeleteModbusRegister(ctx context.Context, vesselID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM modbus_registers WHERE vessel_id = ? AND id = ?", vesselID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordModbusPoll notes the value a register was read as at a time, or the
+// error reading it failed with.
+func (s *SQLStore) RecordModbusPoll(ctx context.Context, id int64, value *float64, at time.Time, pollErr *string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE modbus_registers SET last_value = ?, last_polled_at = ?, last_error = ? WHERE id = ?", value, at, pollErr, id)
+	return err
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// NoonReportFilter selects noon reports of a vessel. Zero values mean "no
+// filter".
+type NoonReportFilter struct {
+	VesselID    int64
+	From, To    *time.Time
+	FlaggedOnly bool
+}
+
+const noonReportColumns = `id, vessel_id, reported_at, upload_id, rob_fuel_liters, distance_nm, avg_speed_knots, weather, remarks,
+	period_start, computed_rob_liters, computed_distance_nm, computed_avg_speed_knots, discrepancies_json, flagged, reconciled_at`
+
+// NoonReports returns the reports matching f, oldest first.
+func (s *SQLStore) NoonReports(ctx context.Context, f NoonReportFilter) ([]models.NoonReport, error) {
+	query := "SELECT " + noonReportColumns + " FROM noon_reports WHERE vessel_id = ?"
+	args := []interface{}{f.VesselID}
+	if f.From != nil {
+		query += " AND reported_at >= ?"
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		query += " AND reported_at <= ?"
+		args = append(args, *f.To)
+	}
+	if f.FlaggedOnly {
+		query += " AND flagged = 1"
+	}
+	query += " ORDER BY reported_at"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []models.NoonReport{}
+	for rows.Next() {
+		var r models.NoonReport
+		var discrepancies string
+		if err := rows.Scan(&r.ID, &r.VesselID, &r.ReportedAt, &r.UploadID, &r.ROBFuelLiters, &r.DistanceNM, &r.AvgSpeedKnots,
+			&r.Weather, &r.Remarks, &r.PeriodStart, &r.ComputedROBLiters, &r.ComputedDistanceNM, &r.ComputedAvgSpeedKnots,
+			&discrepancies, &r.Flagged, &r.ReconciledAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(discrepancies), &r.Discrepancies); err != nil {
+			return nil, err
+		}
+		r.ReportedAt, r.PeriodStart, r.ReconciledAt = r.ReportedAt.UTC(), r.PeriodStart.UTC(), r.ReconciledAt.UTC()
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// PreviousNoonReport returns the time of the vessel's last report before
+// the given time, nil if none.
+func (s *SQLStore) PreviousNoonReport(ctx context.Context, vesselID int64, before time.Time) (*time.Time, error) {
+	var last sql.NullString
+	if err := s.db.QueryRowContext(ctx,
+		"SELECT MAX(reported_at) FROM noon_reports WHERE vessel_id = ? AND reported_at < ?", vesselID, before).Scan(&last); err != nil {
+		return nil, err
+	}
+	return parseTime(last)
+}
+
+// PutNoonReport writes a report unless the vessel already has one at its
+// time, which upsert replaces, keeping its ID.
+func (s *SQLStore) PutNoonReport(ctx context.Context, r models.NoonReport, upsert bool) (WriteResult, error) {
+	discrepancies, err := json.Marshal(r.Discrepancies)
+	if err != nil {
+		return WriteSkipped, err
+	}
+	var id int64
+	err = s.db.QueryRowContext(ctx,
+		"SELECT id FROM noon_reports WHERE vessel_id = ? AND reported_at = ?", r.VesselID, r.ReportedAt).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = s.db.ExecContext(ctx, `
+			INSERT INTO noon_reports (vessel_id, reported_at, upload_id, rob_fuel_liters, distance_nm, avg_speed_knots, weather, remarks,
+				period_start, computed_rob_liters, computed_distance_nm, computed_avg_speed_knots, discrepancies_json, flagged, reconciled_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.VesselID, r.ReportedAt, r.UploadID, r.ROBFuelLiters, r.DistanceNM, r.AvgSpeedKnots, r.Weather, r.Remarks,
+			r.PeriodStart, r.ComputedROBLiters, r.ComputedDistanceNM, r.ComputedAvgSpeedKnots, string(discrepancies), r.Flagged, r.ReconciledAt)
+		if err != nil {
+			return WriteSkipped, err
+		}
+		return WriteInserted, nil
+	case err != nil:
+		return WriteSkipped, err
+	case !upsert:
+		return WriteSkipped, nil
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE noon_reports SET upload_id = ?, rob_fuel_liters = ?, distance_nm = ?, avg_speed_knots = ?, weather = ?, remarks = ?,
+			period_start = ?, computed_rob_liters = ?, computed_distance_nm = ?, computed_avg_speed_knots = ?, discrepancies_json = ?,
+			flagged = ?, reconciled_at = ?
+		WHERE id = ?`,
+		r.UploadID, r.ROBFuelLiters, r.DistanceNM, r.AvgSpeedKnots, r.Weather, r.Remarks,
+		r.PeriodStart, r.ComputedROBLiters, r.ComputedDistanceNM, r.ComputedAvgSpeedKnots, string(discrepancies),
+		r.Flagged, r.ReconciledAt, id)
+	if err != nil {
+		return WriteSkipped, err
+	}
+	return WriteUpdated, nil
+}
+
+// SetNoonReconciliation replaces the computed values and discrepancies of a
+// report.
+func (s *SQLStore) SetNoonReconciliation(ctx context.Context, r models.NoonReport) error {
+	discrepancies, err := json.Marshal(r.Discrepancies)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE noon_reports SET period_start = ?, computed_rob_liters = ?, computed_distance_nm = ?, computed_avg_speed_knots = ?,
+			discrepancies_json = ?, flagged = ?, reconciled_at = ?
+		WHERE vessel_id = ? AND id = ?`,
+		r.PeriodStart, r.ComputedROBLiters, r.ComputedDistanceNM, r.ComputedAvgSpeedKnots,
+		string(discrepancies), r.Flagged, r.ReconciledAt, r.VesselID, r.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FuelOnBoard returns the fuel in the vessel's tanks at the given time: the
+// sum of each tank's last volume reading no more than maxAge before it, nil
+// if no tank has one.
+func (s *SQLStore) FuelOnBoard(ctx context.Context, vesselID int64, at time.Time, maxAge time.Duration) (*float64, error) {
+	// With MAX(ts) SQLite takes volume_liters from the row holding the maximum
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT MAX(ts), volume_liters FROM fuel_tank_readings
+		WHERE vessel_id = ? AND ts >= ? AND ts <= ? AND volume_liters IS NOT NULL
+		GROUP BY tank_no`, vesselID, at.Add(-maxAge), at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var total *float64
+	for rows.Next() {
+		var ts sql.NullString
+		var volume float64
+		if err := rows.Scan(&ts, &volume); err != nil {
+			return nil, err
+		}
+		if total == nil {
+			total = new(float64)
+		}
+		*total += volume
+	}
+	return total, rows.Err()
+}
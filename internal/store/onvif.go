@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const onvifCameraColumns = `id, vessel_id, cam_id, endpoint, username, password, manufacturer, model, firmware_version,
+	last_status, last_polled_at, last_seen_at, last_error, created_at, updated_at`
+
+// ONVIFCameras returns the ONVIF cameras of a vessel, of every vessel if
+// vesselID is 0, by vessel and camera.
+func (s *SQLStore) ONVIFCameras(ctx context.Context, vesselID int64) ([]models.ONVIFCamera, error) {
+	query := "SELECT " + onvifCameraColumns + " FROM onvif_cameras"
+	var args []interface{}
+	if vesselID != 0 {
+		query += " WHERE vessel_id = ?"
+		args = append(args, vesselID)
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY vessel_id, cam_id, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cameras := []models.ONVIFCamera{}
+	for rows.Next() {
+		cam, err := scanONVIFCamera(rows)
+		if err != nil {
+			return nil, err
+		}
+		cameras = append(cameras, cam)
+	}
+	return cameras, rows.Err()
+}
+
+// ONVIFCamera returns one ONVIF camera of the vessel, or ErrNotFound.
+func (s *SQLStore) ONVIFCamera(ctx context.Context, vesselID, id int64) (*models.ONVIFCamera, error) {
+	cam, err := scanONVIFCamera(s.db.QueryRowContext(ctx,
+		"SELECT "+onvifCameraColumns+" FROM onvif_cameras WHERE vessel_id = ? AND id = ?", vesselID, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cam, nil
+}
+
+func scanONVIFCamera(row rowScanner) (models.ONVIFCamera, error) {
+	var cam models.ONVIFCamera
+	var password sql.NullString
+	var polledAt, seenAt sql.NullTime
+	if err := row.Scan(&cam.ID, &cam.VesselID, &cam.CamID, &cam.Endpoint, &cam.Username, &password,
+		&cam.Manufacturer, &cam.Model, &cam.FirmwareVersion,
+		&cam.LastStatus, &polledAt, &seenAt, &cam.LastError, &cam.CreatedAt, &cam.UpdatedAt); err != nil {
+		return cam, err
+	}
+	cam.Password = password.String
+	if polledAt.Valid {
+		at := polledAt.Time.UTC()
+		cam.LastPolledAt = &at
+	}
+	if seenAt.Valid {
+		at := seenAt.Time.UTC()
+		cam.LastSeenAt = &at
+	}
+	cam.CreatedAt, cam.UpdatedAt = cam.CreatedAt.UTC(), cam.UpdatedAt.UTC()
+	return cam, nil
+}
+
+// CreateONVIFCamera stores a new ONVIF camera and returns its ID.
+func (s *SQLStore) CreateONVIFCamera(ctx context.Context, cam models.ONVIFCamera) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO onvif_cameras (vessel_id, cam_id, endpoint, username, password, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		cam.VesselID, cam.CamID, cam.Endpoint, cam.Username, cam.Password, cam.CreatedAt, cam.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateONVIFCamera replaces an ONVIF camera, forgetting its latest poll and
+// what it reported of itself, or returns ErrNotFound.
+func (s *SQLStore) UpdateONVIFCamera(ctx context.Context, cam models.ONVIFCamera) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE onvif_cameras SET cam_id = ?, endpoint = ?, username = ?, password = ?,
+			manufacturer = NULL, model = NULL, firmware_version = NULL,
+			last_status = NULL, last_polled_at = NULL, last_seen_at = NULL, last_error = NULL, updated_at = ?
+		WHERE vessel_id = ? AND id = ?`,
+		cam.CamID, cam.Endpoint, cam.Username, cam.Password, cam.UpdatedAt, cam.VesselID, cam.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteONVIFCamera removes an ONVIF camera of the vessel, or returns
+// ErrNotFound. Its alerts are kept.
+func (s *SQLStore) DeleteONVIFCamera(ctx context.Context, vesselID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM onvif_cameras WHERE vessel_id = ? AND id = ?", vesselID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordONVIFPoll notes the outcome of a poll of a camera. What the camera
+// reported of itself and when it last answered are kept from earlier polls
+// this one lacks.
+func (s *SQLStore) RecordONVIFPoll(ctx context.Context, id int64, poll models.ONVIFPoll) error {
+	var manufacturer, model, firmware interface{}
+	if poll.Info != nil {
+		manufacturer, model, firmware = nullString(poll.Info.Manufacturer), nullString(poll.Info.Model), nullString(poll.Info.FirmwareVersion)
+	}
+	var seenAt *time.Time
+	if poll.Answered {
+		seenAt = &poll.At
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE onvif_cameras SET last_status = ?, last_polled_at = ?, last_error = ?,
+			last_seen_at = COALESCE(?, last_seen_at),
+			manufacturer = COALESCE(?, manufacturer), model = COALESCE(?, model), firmware_version = COALESCE(?, firmware_version)
+		WHERE id = ?`,
+		poll.Status, poll.At, poll.Error, seenAt, manufacturer, model, firmware, id)
+	return err
+}
+
+// CameraAlerts returns the camera alerts of a vessel, newest first; with
+// openOnly, those not resolved yet.
+func (s *SQLStore) CameraAlerts(ctx context.Context, vesselID int64, openOnly bool) ([]models.CameraAlert, error) {
+	query := "SELECT id, vessel_id, cam_id, raised_at, last_seen_at, message, resolved_at FROM camera_alerts WHERE vessel_id = ?"
+	if openOnly {
+		query += " AND resolved_at IS NULL"
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY raised_at DESC, id DESC", vesselID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []models.CameraAlert{}
+	for rows.Next() {
+		var a models.CameraAlert
+		var seenAt, resolvedAt sql.NullTime
+		if err := rows.Scan(&a.ID, &a.VesselID, &a.CamID, &a.RaisedAt, &seenAt, &a.Message, &resolvedAt); err != nil {
+			return nil, err
+		}
+		a.RaisedAt = a.RaisedAt.UTC()
+		if seenAt.Valid {
+			at := seenAt.Time.UTC()
+			a.LastSeenAt = &at
+		}
+		if resolvedAt.Valid {
+			at := resolvedAt.Time.UTC()
+			a.ResolvedAt = &at
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// RaiseCameraAlert stores an alert unless the camera has one open,
+// reporting whether it did.
+func (s *SQLStore) RaiseCameraAlert(ctx context.Context, a models.CameraAlert) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO camera_alerts (vessel_id, cam_id, raised_at, last_seen_at, message)
+		SELECT ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM camera_alerts WHERE vessel_id = ? AND cam_id = ? AND resolved_at IS NULL)`,
+		a.VesselID, a.CamID, a.RaisedAt, a.LastSeenAt, a.Message, a.VesselID, a.CamID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ResolveCameraAlerts resolves the open alerts of a camera at a time,
+// returning how many there were.
+func (s *SQLStore) ResolveCameraAlerts(ctx context.Context, vesselID int64, camID string, at time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE camera_alerts SET resolved_at = ? WHERE vessel_id = ? AND cam_id = ? AND resolved_at IS NULL", at, vesselID, camID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OutboxEvent is a reading inserted, as logged in the outbox.
+type OutboxEvent struct {
+	Seq       int64
+	Stream    string
+	VesselID  int64
+	ReadingID int64
+	CreatedAt time.Time
+	// Row is the reading as it is now, nil if it has been deleted since.
+	Row *Reading
+}
+
+// OutboxEvents returns up to limit events of streams (all if empty) after
+// seq afterSeq, oldest first, with their readings.
+func (s *SQLStore) OutboxEvents(ctx context.Context, afterSeq int64, streams []string, limit int) ([]OutboxEvent, error) {
+	query := "SELECT seq, stream, vessel_id, reading_id, created_at FROM outbox WHERE seq > ?"
+	args := []interface{}{afterSeq}
+	if len(streams) > 0 {
+		query += " AND stream IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(streams)), ", ") + ")"
+		for _, stream := range streams {
+			args = append(args, stream)
+		}
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY seq LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	var events []OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		var createdAt string
+		if err := rows.Scan(&e.Seq, &e.Stream, &e.VesselID, &e.ReadingID, &createdAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if e.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("outbox event %d: invalid created_at %q", e.Seq, createdAt)
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := map[string][]int64{}
+	for _, e := range events {
+		ids[e.Stream] = append(ids[e.Stream], e.ReadingID)
+	}
+	current, err := s.readingsByID(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	for i := range events {
+		events[i].Row = current[events[i].Stream][events[i].ReadingID]
+	}
+	return events, nil
+}
+
+// OutboxHead returns the seq of the newest event ever logged.
+func (s *SQLStore) OutboxHead(ctx context.Context) (int64, error) {
+	var head int64
+	err := s.db.QueryRowContext(ctx, "SELECT seq FROM sqlite_sequence WHERE name = 'outbox'").Scan(&head)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return head, err
+}
+
+// OutboxCursor returns the last seq delivered to a consumer, 0 if none was.
+func (s *SQLStore) OutboxCursor(ctx context.Context, consumer string) (int64, error) {
+	var seq int64
+	err := s.db.QueryRowContext(ctx, "SELECT last_seq FROM outbox_cursors WHERE consumer = ?", consumer).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// SetOutboxCursor moves a consumer's cursor after a delivery.
+func (s *SQLStore) SetOutboxCursor(ctx context.Context, consumer string, seq int64, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO outbox_cursors (consumer, last_seq, delivered_at) VALUES (?, ?, ?)
+		ON CONFLICT(consumer) DO UPDATE SET last_seq = MAX(last_seq, excluded.last_seq), delivered_at = excluded.delivered_at`,
+		consumer, seq, at)
+	return err
+}
+
+// PruneOutbox deletes the events every one of consumers has been delivered,
+// all of them if there are no consumers, and returns how many were removed.
+func (s *SQLStore) PruneOutbox(ctx context.Context, consumers []string) (int64, error) {
+	var upTo int64 = -1 // all
+	for _, c := range consumers {
+		seq, err := s.OutboxCursor(ctx, c)
+		if err != nil {
+			return 0, err
+		}
+		if upTo < 0 || seq < upTo {
+			upTo = seq
+		}
+	}
+	query, args := "DELETE FROM outbox", []interface{}{}
+	if upTo >= 0 {
+		query, args = query+" WHERE seq <= ?", append(args, upTo)
+	}
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
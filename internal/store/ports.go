@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"vessel-telemetry-api/internal/ports"
+)
+
+const portColumns = "id, code, name, country, polygon_json"
+
+func scanPort(scan func(dest ...interface{}) error) (ports.Port, error) {
+	var p ports.Port
+	var country sql.NullString
+	var polygon string
+	if err := scan(&p.ID, &p.Code, &p.Name, &country, &polygon); err != nil {
+		return p, err
+	}
+	p.Country = country.String
+	if err := json.Unmarshal([]byte(polygon), &p.Polygon); err != nil {
+		return p, fmt.Errorf("port %s: invalid polygon: %w", p.Code, err)
+	}
+	return p, nil
+}
+
+// ListPorts returns every port in the index, ordered by code.
+func (s *SQLStore) ListPorts(ctx context.Context) ([]ports.Port, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+portColumns+" FROM ports ORDER BY code")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := []ports.Port{}
+	for rows.Next() {
+		p, err := scanPort(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		index = append(index, p)
+	}
+	return index, rows.Err()
+}
+
+// GetPort returns the port with the given code, or ErrNotFound.
+func (s *SQLStore) GetPort(ctx context.Context, code string) (*ports.Port, error) {
+	p, err := scanPort(s.db.QueryRowContext(ctx, "SELECT "+portColumns+" FROM ports WHERE code = ?", code).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// DeletePort removes a port from the index, or returns ErrNotFound.
+func (s *SQLStore) DeletePort(ctx context.Context, code string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM ports WHERE code = ?", code)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ImportPorts inserts the ports, replacing existing entries with the same code.
+func (s *SQLStore) ImportPorts(ctx context.Context, index []ports.Port) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, p := range index {
+		polygon, err := json.Marshal(p.Polygon)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO ports (code, name, country, polygon_json)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(code) DO UPDATE SET
+				name = excluded.name,
+				country = excluded.country,
+				polygon_json = excluded.polygon_json,
+				updated_at = datetime('now')
+		`, strings.ToUpper(strings.TrimSpace(p.Code)), p.Name, p.Country, string(polygon))
+		if err != nil {
+			return 0, fmt.Errorf("importing port %s: %w", p.Code, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(index), nil
+}
+
+// SeedPorts imports the index only when no ports are stored yet.
+func (s *SQLStore) SeedPorts(ctx context.Context, index []ports.Port) error {
+	var count int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM ports").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := s.ImportPorts(ctx, index)
+	return err
+}
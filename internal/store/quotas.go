@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// QuotaOverride returns the per-vessel quota override, if one is set.
+func (s *SQLStore) QuotaOverride(ctx context.Context, vesselID int64) (models.QuotaPolicy, bool, error) {
+	var policy models.QuotaPolicy
+	err := s.db.QueryRowContext(ctx,
+		"SELECT daily_row_limit, throttle FROM vessel_quotas WHERE vessel_id = ?", vesselID,
+	).Scan(&policy.DailyRowLimit, &policy.Throttle)
+	if err == sql.ErrNoRows {
+		return models.QuotaPolicy{}, false, nil
+	}
+	if err != nil {
+		return models.QuotaPolicy{}, false, err
+	}
+	return policy, true, nil
+}
+
+func (s *SQLStore) SetQuotaOverride(ctx context.Context, vesselID int64, policy models.QuotaPolicy) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO vessel_quotas (vessel_id, daily_row_limit, throttle, updated_at)
+		VALUES (?, ?, ?, datetime('now'))
+		ON CONFLICT(vessel_id) DO UPDATE SET
+			daily_row_limit = excluded.daily_row_limit,
+			throttle = excluded.throttle,
+			updated_at = excluded.updated_at`,
+		vesselID, policy.DailyRowLimit, policy.Throttle,
+	)
+	return err
+}
+
+func (s *SQLStore) ClearQuotaOverride(ctx context.Context, vesselID int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM vessel_quotas WHERE vessel_id = ?", vesselID)
+	return err
+}
+
+// DailyUsage returns the rows written for the vessel on day (YYYY-MM-DD).
+func (s *SQLStore) DailyUsage(ctx context.Context, vesselID int64, day string) (int, error) {
+	var rows int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT rows FROM vessel_daily_usage WHERE vessel_id = ? AND day = ?", vesselID, day,
+	).Scan(&rows)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return rows, err
+}
+
+func (s *SQLStore) AddDailyUsage(ctx context.Context, vesselID int64, day string, rows int) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO vessel_daily_usage (vessel_id, day, rows) VALUES (?, ?, ?)
+		ON CONFLICT(vessel_id, day) DO UPDATE SET rows = rows + excluded.rows`,
+		vesselID, day, rows,
+	)
+	return err
+}
+
+// MarkQuotaAlerted records the quota alert for a day and reports whether this
+// was the first alert for it.
+func (s *SQLStore) MarkQuotaAlerted(ctx context.Context, vesselID int64, day string, at time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE vessel_daily_usage SET alerted_at = ? WHERE vessel_id = ? AND day = ? AND alerted_at IS NULL",
+		at, vesselID, day,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// QuotaAlerts returns the most recent days on which the quota was exceeded.
+func (s *SQLStore) QuotaAlerts(ctx context.Context, vesselID int64, limit int) ([]models.QuotaAlert, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT day, rows, alerted_at FROM vessel_daily_usage
+		WHERE vessel_id = ? AND alerted_at IS NOT NULL
+		ORDER BY day DESC LIMIT ?`, vesselID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []models.QuotaAlert{}
+	for rows.Next() {
+		var alert models.QuotaAlert
+		if err := rows.Scan(&alert.Day, &alert.Rows, &alert.AlertedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
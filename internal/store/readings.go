@@ -0,0 +1,1085 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vessel-telemetry-api/internal/gensets"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/resample"
+	"vessel-telemetry-api/internal/utilization"
+)
+
+type WriteResult int
+
+const (
+	WriteSkipped WriteResult = iota
+	WriteInserted
+	WriteUpdated
+)
+
+// ReadingWrite is a single reading row ready to be written. Cols/Vals hold the
+// domain columns only; vessel_id, ts and row_hash are added by WriteReading.
+type ReadingWrite struct {
+	Table    string
+	UnitCol  string // column identifying the unit (engine_no, tank_no...), empty if none
+	Unit     interface{}
+	VesselID int64
+	TS       time.Time
+	RowHash  string
+	Cols     []string
+	Vals     []interface{}
+}
+
+// WriteReading inserts a reading, ignoring rows whose row_hash already exists.
+// With upsert, a reading matched by vessel, timestamp and unit is overwritten
+// instead. Writes to chained streams are added to the audit log in the same
+// transaction.
+func (s *SQLStore) WriteReading(ctx context.Context, w ReadingWrite, upsert bool) (WriteResult, error) {
+	stream := s.chained[w.Table]
+	if stream == nil {
+		result, _, err := writeReading(ctx, s.db, w, upsert)
+		return result, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return WriteSkipped, err
+	}
+	defer tx.Rollback()
+
+	result, id, err := writeReading(ctx, tx, w, upsert)
+	if err != nil || result == WriteSkipped {
+		return result, err
+	}
+	if err := chainReading(ctx, tx, stream, w.VesselID, id, result); err != nil {
+		return WriteSkipped, fmt.Errorf("audit log: %w", err)
+	}
+	return result, tx.Commit()
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// writeReading does the work of WriteReading and also returns the id of the
+// row written.
+func writeReading(ctx context.Context, db execer, w ReadingWrite, upsert bool) (WriteResult, int64, error) {
+	w, err := storeExtra(ctx, db, w)
+	if err != nil {
+		return WriteSkipped, 0, fmt.Errorf("storing extra_json: %w", err)
+	}
+	if ref, err := registerSensor(ctx, db, w); err != nil {
+		return WriteSkipped, 0, fmt.Errorf("registering sensor: %w", err)
+	} else if ref != 0 {
+		w.Cols = append(w.Cols[:len(w.Cols):len(w.Cols)], "sensor_ref")
+		w.Vals = append(w.Vals[:len(w.Vals):len(w.Vals)], ref)
+	}
+
+	if upsert {
+		matchQuery := "SELECT id FROM " + w.Table + " WHERE vessel_id = ? AND ts = ?"
+		matchArgs := []interface{}{w.VesselID, w.TS}
+		if w.UnitCol != "" {
+			matchQuery += " AND " + w.UnitCol + " IS ?"
+			matchArgs = append(matchArgs, w.Unit)
+		}
+		matchQuery += " ORDER BY id LIMIT 1"
+
+		var existingID int64
+		err := db.QueryRowContext(ctx, matchQuery, matchArgs...).Scan(&existingID)
+		if err == nil {
+			// row_hash only covers the unit and unmapped columns, so compare the
+			// values themselves and leave identical rows untouched.
+			sets := make([]string, 0, len(w.Cols)+1)
+			same := make([]string, 0, len(w.Cols))
+			for _, col := range w.Cols {
+				sets = append(sets, col+" = ?")
+				same = append(same, col+" IS ?")
+			}
+			sets = append(sets, "row_hash = ?")
+			args := append(append([]interface{}{}, w.Vals...), w.RowHash, existingID)
+			args = append(args, w.Vals...)
+
+			result, err := db.ExecContext(ctx,
+				"UPDATE "+w.Table+" SET "+strings.Join(sets, ", ")+
+					" WHERE id = ? AND NOT ("+strings.Join(same, " AND ")+")",
+				args...,
+			)
+			if err != nil {
+				return WriteSkipped, 0, err
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				return WriteSkipped, 0, nil
+			}
+			return WriteUpdated, existingID, nil
+		} else if err != sql.ErrNoRows {
+			return WriteSkipped, 0, err
+		}
+	}
+
+	cols := append([]string{"vessel_id", "ts"}, w.Cols...)
+	cols = append(cols, "row_hash")
+	args := append([]interface{}{w.VesselID, w.TS}, w.Vals...)
+	args = append(args, w.RowHash)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+
+	result, err := db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO "+w.Table+" ("+strings.Join(cols, ", ")+") VALUES ("+placeholders+")",
+		args...,
+	)
+	if err != nil {
+		return WriteSkipped, 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return WriteSkipped, 0, nil
+	}
+	id, err := result.LastInsertId()
+	return WriteInserted, id, err
+}
+
+// sensorUnit returns a unit value as registered in the sensors table, and
+// false for a missing or blank unit.
+func sensorUnit(unit interface{}) (string, bool) {
+	switch u := unit.(type) {
+	case *int:
+		if u != nil {
+			return strconv.Itoa(*u), true
+		}
+	case int:
+		return strconv.Itoa(u), true
+	case int64:
+		return strconv.FormatInt(u, 10), true
+	case *string:
+		if u != nil && strings.TrimSpace(*u) != "" {
+			return *u, true
+		}
+	case string:
+		if strings.TrimSpace(u) != "" {
+			return u, true
+		}
+	}
+	return "", false
+}
+
+// registerSensor registers the unit of a reading on first sight, widens its
+// first and last seen to the reading and returns its id. It returns 0 for
+// streams without units and readings without one.
+func registerSensor(ctx context.Context, db execer, w ReadingWrite) (int64, error) {
+	unit, ok := sensorUnit(w.Unit)
+	if !ok || w.UnitCol == "" {
+		return 0, nil
+	}
+	var stream *Stream
+	for _, s := range Streams {
+		if s.Table == w.Table {
+			stream = s
+		}
+	}
+	if stream == nil || stream.Unit != w.UnitCol {
+		return 0, nil
+	}
+
+	var id int64
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO sensors (vessel_id, stream, unit, first_seen, last_seen) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(vessel_id, stream, unit) DO UPDATE SET
+			first_seen = MIN(first_seen, excluded.first_seen),
+			last_seen = MAX(last_seen, excluded.last_seen)
+		RETURNING id`, w.VesselID, stream.Name, unit, w.TS, w.TS).Scan(&id)
+	return id, err
+}
+
+// ReadingQuery selects readings of one stream for a vessel, ordered by
+// (ts, id), or (ts, unit, id) with ByUnit. Zero values mean "no filter".
+type ReadingQuery struct {
+	Stream    *Stream
+	VesselID  int64
+	Unit      interface{} // value of the stream's unit column, see Stream.ParseUnit
+	SensorRef int64       // id of the unit in the sensor registry; streams with units only
+	From, To  *time.Time
+	Desc      bool        // newest first
+	ByUnit    bool        // order readings with equal ts by unit
+	AfterTS   time.Time   // keyset cursor: only rows after (AfterTS, AfterUnit, AfterID) in query order
+	AfterUnit interface{} // see Stream.UnitSortKey; used with ByUnit
+	AfterID   int64
+	NotNull   []string // fields that must be set; text fields must also be non-blank
+	Sources   SourceFilter
+	Extra     []ExtraFilter // all must match
+	Limit     int
+}
+
+// SourceFilter selects readings by source (see models.ReadingSources), or
+// models.SourceAIS for the synced positions from the AIS provider. Only
+// keeps readings from one of the sources; Exclude drops readings from any of
+// them but keeps those recorded before sources were.
+type SourceFilter struct {
+	Only    []string
+	Exclude []string
+}
+
+func (f SourceFilter) apply(stream *Stream, query string, args []interface{}) (string, []interface{}) {
+	if len(f.Only) > 0 {
+		var cond string
+		cond, args = sourceCondition(stream, f.Only, args)
+		query += " AND " + cond
+	}
+	if len(f.Exclude) > 0 {
+		var cond string
+		cond, args = sourceCondition(stream, f.Exclude, args)
+		query += " AND (source IS NULL OR NOT " + cond + ")"
+	}
+	return query, args
+}
+
+// sourceCondition matches readings from any of sources. models.SourceAIS
+// matches the synced readings of origin models.OriginAIS, on streams with
+// an origin column, and nothing on others.
+func sourceCondition(stream *Stream, sources []string, args []interface{}) (string, []interface{}) {
+	var terms, stored []string
+	for _, source := range sources {
+		if source != models.SourceAIS {
+			stored = append(stored, source)
+		} else if stream.Origin {
+			terms = append(terms, "(source = ? AND origin IS ?)")
+			args = append(args, models.SourceSynced, models.OriginAIS)
+		}
+	}
+	if len(stored) > 0 {
+		terms = append(terms, "source IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(stored)), ", ")+")")
+		for _, source := range stored {
+			args = append(args, source)
+		}
+	}
+	if len(terms) == 0 {
+		return "0", args
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", args
+}
+
+func (q ReadingQuery) build() (string, []interface{}) {
+	query, args := q.Stream.selectReadings(q.VesselID)
+	if q.Unit != nil {
+		query += " AND " + q.Stream.Unit + " = ?"
+		args = append(args, q.Unit)
+	}
+	if q.SensorRef != 0 {
+		query += " AND sensor_ref = ?"
+		args = append(args, q.SensorRef)
+	}
+	query, args = timeRange(query, args, q.From, q.To)
+	query, args = q.Sources.apply(q.Stream, query, args)
+	for _, f := range q.Extra {
+		query, args = f.apply(query, args)
+	}
+	for _, name := range q.NotNull {
+		if field, ok := q.Stream.Field(name); ok && field.Kind == TextField {
+			query += " AND TRIM(" + field.Name + ") != ''"
+		} else if ok {
+			query += " AND " + field.Name + " IS NOT NULL"
+		}
+	}
+	if !q.AfterTS.IsZero() {
+		op := ">"
+		if q.Desc {
+			op = "<"
+		}
+		if q.ByUnit {
+			unit := q.Stream.unitSortExpr()
+			query += fmt.Sprintf(" AND (ts %[1]s ? OR (ts = ? AND (%[2]s %[1]s ? OR (%[2]s = ? AND id %[1]s ?))))", op, unit)
+			args = append(args, q.AfterTS, q.AfterTS, q.AfterUnit, q.AfterUnit, q.AfterID)
+		} else {
+			query += fmt.Sprintf(" AND (ts %[1]s ? OR (ts = ? AND id %[1]s ?))", op)
+			args = append(args, q.AfterTS, q.AfterTS, q.AfterID)
+		}
+	}
+	return query, args
+}
+
+// order returns the ORDER BY clause matching the keyset condition of build.
+func (q ReadingQuery) order() string {
+	dir := ""
+	if q.Desc {
+		dir = " DESC"
+	}
+	keys := []string{"ts" + dir}
+	if q.ByUnit {
+		keys = append(keys, q.Stream.unitSortExpr()+dir)
+	}
+	keys = append(keys, "id"+dir)
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
+
+// QueryReadings returns rows to be scanned with Stream.ScanReading.
+func (s *SQLStore) QueryReadings(ctx context.Context, q ReadingQuery) (Rows, error) {
+	query, args := q.build()
+	query += q.order()
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+	return s.db.QueryContext(ctx, query, args...)
+}
+
+// LatestReading returns the most recent reading matching the query.
+func (s *SQLStore) LatestReading(ctx context.Context, q ReadingQuery) (*Reading, error) {
+	query, args := q.build()
+	query += " ORDER BY ts DESC, id DESC LIMIT 1"
+
+	reading, err := q.Stream.ScanReading(s.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reading, nil
+}
+
+// ExportReadings returns id, ts, the stream fields and extra_json, ordered by
+// (ts, unit, id) so repeated exports are identical.
+func (s *SQLStore) ExportReadings(ctx context.Context, stream *Stream, vesselID int64, from, to *time.Time, sources SourceFilter) (Rows, error) {
+	query := "SELECT id, ts, " + strings.Join(stream.FieldNames(), ", ") + ", " + extraJSONColumn("") + " FROM " + stream.Table + " WHERE vessel_id = ?"
+	query, args := timeRange(query, []interface{}{vesselID}, from, to)
+	query, args = sources.apply(stream, query, args)
+	query += " ORDER BY ts"
+	if stream.Unit != "" {
+		query += ", " + stream.Unit
+	}
+	query += ", id"
+
+	return s.db.QueryContext(ctx, query, args...)
+}
+
+// DailyCounts returns the number of readings per UTC day (YYYY-MM-DD).
+func (s *SQLStore) DailyCounts(ctx context.Context, stream *Stream, vesselID int64, from, to *time.Time) (map[string]int64, error) {
+	query := "SELECT date(ts) AS day, COUNT(*) FROM " + stream.Table + " WHERE vessel_id = ?"
+	query, args := timeRange(query, []interface{}{vesselID}, from, to)
+	query += " GROUP BY day"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var day string
+		var n int64
+		if err := rows.Scan(&day, &n); err != nil {
+			return nil, err
+		}
+		counts[day] = n
+	}
+	return counts, rows.Err()
+}
+
+// StreamSummary is the extent of one stream's data for a vessel.
+type StreamSummary struct {
+	Rows           int64
+	Earliest       *time.Time
+	Latest         *time.Time
+	Units          int64 // distinct units; 0 for streams without units
+	LastIngestedAt *time.Time
+}
+
+// SummarizeStream counts a vessel's readings of one stream and returns their
+// time span, distinct units and when rows were last ingested.
+func (s *SQLStore) SummarizeStream(ctx context.Context, stream *Stream, vesselID int64) (StreamSummary, error) {
+	units := "0"
+	if stream.Unit != "" {
+		units = "COUNT(DISTINCT " + stream.Unit + ")"
+	}
+
+	var summary StreamSummary
+	var earliest, latest, ingested sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*), MIN(ts), MAX(ts), "+units+", MAX(created_at) FROM "+stream.Table+" WHERE vessel_id = ?",
+		vesselID,
+	).Scan(&summary.Rows, &earliest, &latest, &summary.Units, &ingested)
+	if err != nil {
+		return summary, err
+	}
+
+	if summary.Earliest, err = parseTime(earliest); err != nil {
+		return summary, err
+	}
+	if summary.Latest, err = parseTime(latest); err != nil {
+		return summary, err
+	}
+	if summary.LastIngestedAt, err = parseTime(ingested); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// FieldStats summarises one column of a stream.
+type FieldStats struct {
+	Field    string
+	NonNull  int64
+	Min      interface{}
+	Max      interface{}
+	Distinct int64
+	Samples  []interface{}
+}
+
+// ProfileStream returns the row count and per-field statistics with up to
+// samples distinct non-null example values per field.
+func (s *SQLStore) ProfileStream(ctx context.Context, stream *Stream, vesselID int64, from, to *time.Time, samples int) (int64, []FieldStats, error) {
+	where, args := timeRange(" WHERE vessel_id = ?", []interface{}{vesselID}, from, to)
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+stream.Table+where, args...).Scan(&total); err != nil {
+		return 0, nil, err
+	}
+
+	stats := make([]FieldStats, 0, len(stream.Fields))
+	for _, field := range stream.FieldNames() {
+		fs := FieldStats{Field: field, Samples: []interface{}{}}
+
+		query := fmt.Sprintf("SELECT COUNT(%[1]s), MIN(%[1]s), MAX(%[1]s), COUNT(DISTINCT %[1]s) FROM %[2]s", field, stream.Table)
+		err := s.db.QueryRowContext(ctx, query+where, args...).Scan(&fs.NonNull, &fs.Min, &fs.Max, &fs.Distinct)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		sampleQuery := fmt.Sprintf("SELECT DISTINCT %s FROM %s", field, stream.Table) + where +
+			fmt.Sprintf(" AND %s IS NOT NULL LIMIT %d", field, samples)
+		rows, err := s.db.QueryContext(ctx, sampleQuery, args...)
+		if err != nil {
+			return 0, nil, err
+		}
+		for rows.Next() {
+			var v interface{}
+			if err := rows.Scan(&v); err == nil {
+				fs.Samples = append(fs.Samples, v)
+			}
+		}
+		rows.Close()
+
+		stats = append(stats, fs)
+	}
+	return total, stats, nil
+}
+
+// SeriesQuery aggregates one metric of a stream into fixed time buckets for
+// several vessels. Buckets are aligned to the Unix epoch, so daily buckets
+// start at UTC midnight.
+type SeriesQuery struct {
+	Stream    *Stream
+	Metric    string // must satisfy Stream.IsMetric
+	VesselIDs []int64
+	Unit      interface{} // optional unit filter, see Stream.ParseUnit
+	Bucket    time.Duration
+	From, To  *time.Time
+	Sources   SourceFilter
+	// TimeWeighted weighs each reading's value in Avg by the time until the
+	// next reading of its unit, capped at MaxGap (DefaultWeightMaxGap if
+	// zero), rather than counting every reading once, for streams whose
+	// readings come at varying intervals.
+	TimeWeighted bool
+	MaxGap       time.Duration
+}
+
+// BucketStats is the aggregate of one vessel's metric over one bucket.
+type BucketStats struct {
+	VesselID int64
+	Start    time.Time
+	Avg      float64
+	Min      float64
+	Max      float64
+	Count    int64
+	// Uncertainty is the ± of Avg from the readings' uncertainty estimates,
+	// nil if none has one. Errors are taken as fully correlated (a sounding
+	// table off by 3% is off for every reading), so it is the average of the
+	// readings' absolute uncertainties; readings without one count as exact.
+	Uncertainty *float64
+}
+
+// BucketSeries returns the non-empty buckets of every vessel, ordered by
+// bucket start and vessel. Buckets of whole hours or days are read from
+// the rollups where they cover the range; time-weighted averages always
+// come from the readings.
+func (s *SQLStore) BucketSeries(ctx context.Context, q SeriesQuery) ([]BucketStats, error) {
+	if !q.Stream.IsMetric(q.Metric) {
+		return nil, fmt.Errorf("%s is not a metric of %s", q.Metric, q.Stream.Name)
+	}
+	if len(q.VesselIDs) == 0 {
+		return []BucketStats{}, nil
+	}
+
+	secs := int64(q.Bucket / time.Second)
+	if secs <= 0 {
+		return nil, fmt.Errorf("bucket must be at least one second")
+	}
+
+	totals := make(map[[2]int64]*bucketTotals)
+	if err := s.seriesTotals(ctx, q, secs, totals); err != nil {
+		return nil, err
+	}
+
+	var weighted map[[2]int64]*weightedBucket
+	if q.TimeWeighted {
+		var err error
+		if weighted, err = s.weightedBuckets(ctx, q, secs); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := make([]BucketStats, 0, len(totals))
+	for key, t := range totals {
+		b := BucketStats{
+			VesselID: key[0],
+			Start:    time.Unix(key[1], 0).UTC(),
+			Avg:      t.sum / float64(t.count),
+			Min:      t.min,
+			Max:      t.max,
+			Count:    t.count,
+		}
+		if t.uncertaintyCount > 0 {
+			u := t.uncertaintySum / float64(t.count)
+			b.Uncertainty = &u
+		}
+		// Readings all at the same time keep their plain average
+		if w := weighted[key]; w != nil && w.weight > 0 {
+			b.Avg = w.sum / w.weight
+			if b.Uncertainty != nil {
+				u := w.uncertaintySum / w.weight
+				b.Uncertainty = &u
+			}
+		}
+		stats = append(stats, b)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if !stats[i].Start.Equal(stats[j].Start) {
+			return stats[i].Start.Before(stats[j].Start)
+		}
+		return stats[i].VesselID < stats[j].VesselID
+	})
+	return stats, nil
+}
+
+// LatestPerUnit returns the newest reading of each of the vessel's units
+// (engines, tanks...), ordered by unit; for streams without units, the
+// newest reading.
+func (s *SQLStore) LatestPerUnit(ctx context.Context, stream *Stream, vesselID int64) ([]Reading, error) {
+	query := stream.readingColumns() + " WHERE vessel_id = ? ORDER BY ts DESC, id DESC LIMIT 1"
+	if stream.Unit != "" {
+		query = stream.readingColumns() + ` WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY ` + stream.Unit + ` ORDER BY ts DESC, id DESC) AS n
+				FROM ` + stream.Table + ` WHERE vessel_id = ?)
+			WHERE n = 1)
+			ORDER BY ` + stream.unitSortExpr()
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, vesselID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []Reading{}
+	for rows.Next() {
+		r, err := stream.ScanReading(rows)
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, r)
+	}
+	return readings, rows.Err()
+}
+
+// MetricStats aggregates one metric's non-null values.
+type MetricStats struct {
+	Count int64    `json:"count"`
+	Min   *float64 `json:"min"`
+	Avg   *float64 `json:"avg"`
+	Max   *float64 `json:"max"`
+}
+
+// UnitStats holds the metric aggregates of one unit, nil for streams
+// without units.
+type UnitStats struct {
+	Unit    interface{}            `json:"unit"`
+	Metrics map[string]MetricStats `json:"metrics"`
+}
+
+// AggregateUnits returns count, min, average and max of every metric of the
+// stream per unit over from..to, ordered by unit. Averages are time-weighted
+// (see timeWeighter), with readings standing for DefaultWeightMaxGap at most.
+func (s *SQLStore) AggregateUnits(ctx context.Context, stream *Stream, vesselID int64, from, to *time.Time) ([]UnitStats, error) {
+	var metrics []string
+	for _, f := range stream.Fields {
+		if stream.IsMetric(f.Name) {
+			metrics = append(metrics, f.Name)
+		}
+	}
+
+	unit := "NULL"
+	if stream.Unit != "" {
+		unit = stream.Unit
+	}
+	cols := []string{unit}
+	for _, m := range metrics {
+		cols = append(cols, "COUNT("+m+")", "MIN("+m+")", "AVG("+m+")", "MAX("+m+")")
+	}
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM " + stream.Table + " WHERE vessel_id = ?"
+	query, args := timeRange(query, []interface{}{vesselID}, from, to)
+	if stream.Unit != "" {
+		query += " GROUP BY " + stream.Unit + " ORDER BY " + stream.unitSortExpr()
+	} else {
+		// Without GROUP BY an empty range still yields one row of zeros
+		query += " HAVING COUNT(*) > 0"
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := []UnitStats{}
+	for rows.Next() {
+		u := UnitStats{Metrics: make(map[string]MetricStats, len(metrics))}
+		stats := make([]MetricStats, len(metrics))
+		mins := make([]sql.NullFloat64, len(metrics))
+		avgs := make([]sql.NullFloat64, len(metrics))
+		maxs := make([]sql.NullFloat64, len(metrics))
+		dest := []interface{}{&u.Unit}
+		for i := range metrics {
+			dest = append(dest, &stats[i].Count, &mins[i], &avgs[i], &maxs[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, m := range metrics {
+			if stats[i].Count > 0 {
+				stats[i].Min, stats[i].Avg, stats[i].Max = &mins[i].Float64, &avgs[i].Float64, &maxs[i].Float64
+			}
+			u.Metrics[m] = stats[i]
+		}
+		if b, ok := u.Unit.([]byte); ok {
+			u.Unit = string(b)
+		}
+		units = append(units, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.weighUnitAverages(ctx, stream, vesselID, from, to, metrics, units); err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+// weighUnitAverages replaces the plain averages of units, as read by
+// AggregateUnits, with time-weighted ones.
+func (s *SQLStore) weighUnitAverages(ctx context.Context, stream *Stream, vesselID int64, from, to *time.Time, metrics []string, units []UnitStats) error {
+	if len(metrics) == 0 || len(units) == 0 {
+		return nil
+	}
+	unit := "NULL"
+	if stream.Unit != "" {
+		unit = stream.Unit
+	}
+	query := "SELECT " + unit + ", ts, " + strings.Join(metrics, ", ") + " FROM " + stream.Table + " WHERE vessel_id = ?"
+	query, args := timeRange(query, []interface{}{vesselID}, from, to)
+	query += " ORDER BY " + unit + ", ts, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byUnit := make(map[string]*UnitStats, len(units))
+	for i := range units {
+		if units[i].Unit != nil {
+			byUnit[fmt.Sprint(units[i].Unit)] = &units[i]
+		} else {
+			byUnit[""] = &units[i]
+		}
+	}
+	// One weighter per metric of the current unit
+	var current *UnitStats
+	var weighters []*timeWeighter
+	settle := func() {
+		for i, w := range weighters {
+			w.flush()
+			if avg := w.mean(vesselID); avg != nil {
+				stats := current.Metrics[metrics[i]]
+				stats.Avg = avg
+				current.Metrics[metrics[i]] = stats
+			}
+		}
+	}
+	for rows.Next() {
+		var unitValue sql.NullString
+		var ts time.Time
+		values := make([]sql.NullFloat64, len(metrics))
+		dest := []interface{}{&unitValue, &ts}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if u := byUnit[unitValue.String]; u != current {
+			if current != nil {
+				settle()
+			}
+			current = u
+			weighters = make([]*timeWeighter, len(metrics))
+			for i := range weighters {
+				weighters[i] = newTimeWeighter(0, DefaultWeightMaxGap)
+			}
+		}
+		if current == nil {
+			continue
+		}
+		for i, v := range values {
+			if v.Valid {
+				weighters[i].add(weightedSample{vesselID: vesselID, ts: ts, value: v.Float64})
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if current != nil {
+		settle()
+	}
+	return nil
+}
+
+// Positions returns the vessel's positions with coordinates, ordered by time.
+func (s *SQLStore) Positions(ctx context.Context, vesselID int64, from, to *time.Time) ([]ports.Fix, error) {
+	query := `
+		SELECT ts, latitude, longitude, speed_knots
+		FROM location_readings
+		WHERE vessel_id = ? AND latitude IS NOT NULL AND longitude IS NOT NULL`
+	query, args := timeRange(query, []interface{}{vesselID}, from, to)
+	query += " ORDER BY ts, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fixes []ports.Fix
+	for rows.Next() {
+		var fix ports.Fix
+		var speed sql.NullFloat64
+		if err := rows.Scan(&fix.Timestamp, &fix.Latitude, &fix.Longitude, &speed); err != nil {
+			return nil, err
+		}
+		if speed.Valid {
+			fix.Speed = &speed.Float64
+		}
+		fixes = append(fixes, fix)
+	}
+	return fixes, rows.Err()
+}
+
+// GeneratorReadings returns the vessel's generator loads and fuel rates with
+// their uncertainty, oldest first. Readings without a generator number are
+// left out.
+func (s *SQLStore) GeneratorReadings(ctx context.Context, vesselID int64, from, to *time.Time) ([]gensets.Reading, error) {
+	query := `
+		SELECT gen_no, ts, load_kw, fuel_rate_lph, uncertainty_percent
+		FROM generator_readings
+		WHERE vessel_id = ? AND gen_no IS NOT NULL`
+	query, args := timeRange(query, []interface{}{vesselID}, from, to)
+	query += " ORDER BY ts, gen_no, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readings []gensets.Reading
+	for rows.Next() {
+		var r gensets.Reading
+		var load, fuelRate, uncertainty sql.NullFloat64
+		if err := rows.Scan(&r.GenNo, &r.TS, &load, &fuelRate, &uncertainty); err != nil {
+			return nil, err
+		}
+		if load.Valid {
+			r.LoadKW = &load.Float64
+		}
+		if fuelRate.Valid {
+			r.FuelRateLPH = &fuelRate.Float64
+		}
+		if uncertainty.Valid {
+			r.FuelRateUncertaintyPercent = &uncertainty.Float64
+		}
+		readings = append(readings, r)
+	}
+	return readings, rows.Err()
+}
+
+// EngineRPMs returns the vessel's engine speeds, oldest first. Readings
+// without an engine number are left out.
+func (s *SQLStore) EngineRPMs(ctx context.Context, vesselID int64, from, to *time.Time) ([]utilization.EngineSample, error) {
+	query := `
+		SELECT engine_no, ts, rpm
+		FROM engine_readings
+		WHERE vessel_id = ? AND engine_no IS NOT NULL`
+	query, args := timeRange(query, []interface{}{vesselID}, from, to)
+	query += " ORDER BY ts, engine_no, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []utilization.EngineSample
+	for rows.Next() {
+		var e utilization.EngineSample
+		var rpm sql.NullFloat64
+		if err := rows.Scan(&e.EngineNo, &e.TS, &rpm); err != nil {
+			return nil, err
+		}
+		if rpm.Valid {
+			e.RPM = &rpm.Float64
+		}
+		samples = append(samples, e)
+	}
+	return samples, rows.Err()
+}
+
+// UnitSamples are one unit's readings of some metrics, oldest first.
+type UnitSamples struct {
+	Unit    interface{} // nil for streams without units
+	Metrics map[string][]resample.Point
+}
+
+// MetricSamples returns the vessel's readings of the metrics from..to by
+// unit, ordered by unit, leaving out null values; unit, if set, keeps one
+// unit's.
+func (s *SQLStore) MetricSamples(ctx context.Context, stream *Stream, vesselID int64, metrics []string, unit interface{}, from, to *time.Time, sources SourceFilter) ([]UnitSamples, error) {
+	for _, m := range metrics {
+		if !stream.IsMetric(m) {
+			return nil, fmt.Errorf("%s is not a metric of %s", m, stream.Name)
+		}
+	}
+	return s.unitSamples(ctx, stream, vesselID, metrics, strings.Join(metrics, ", "), nil, unit, from, to, sources)
+}
+
+// ExtraSamples is MetricSamples for a key of extra_json, such as a running
+// hours counter no stream maps, by the leading number of its values
+// ("5200 h" counts as 5200). Readings without a number there are left out.
+func (s *SQLStore) ExtraSamples(ctx context.Context, stream *Stream, vesselID int64, key string, unit interface{}, from, to *time.Time, sources SourceFilter) ([]UnitSamples, error) {
+	if strings.Contains(key, `"`) {
+		return nil, errors.New("keys cannot contain quotes")
+	}
+	value := "json_extract(CAST(" + extraJSONColumn("") + " AS TEXT), ?)"
+	path := `$."` + key + `"`
+	col := "CASE WHEN " + value + " GLOB '*[0-9]*' THEN CAST(" + value + " AS REAL) END"
+	return s.unitSamples(ctx, stream, vesselID, []string{key}, col, []interface{}{path, path}, unit, from, to, sources)
+}
+
+// unitSamples reads the values of cols, the SQL of the columns names, with
+// colArgs as their arguments.
+func (s *SQLStore) unitSamples(ctx context.Context, stream *Stream, vesselID int64, names []string, cols string, colArgs []interface{}, unit interface{}, from, to *time.Time, sources SourceFilter) ([]UnitSamples, error) {
+	unitCol := "NULL"
+	if stream.Unit != "" {
+		unitCol = stream.Unit
+	}
+	query := "SELECT " + unitCol + ", ts, " + cols + " FROM " + stream.Table + " WHERE vessel_id = ?"
+	args := append(append([]interface{}{}, colArgs...), vesselID)
+	if unit != nil {
+		query += " AND " + stream.Unit + " = ?"
+		args = append(args, unit)
+	}
+	query, args = timeRange(query, args, from, to)
+	query, args = sources.apply(stream, query, args)
+	query += " ORDER BY "
+	if stream.Unit != "" {
+		query += stream.unitSortExpr() + ", "
+	}
+	query += "ts, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []UnitSamples{}
+	var current *UnitSamples
+	values := make([]sql.NullFloat64, len(names))
+	dest := make([]interface{}, 0, len(names)+2)
+	// Units scan as their field's kind; some unit columns predate it
+	var intUnit sql.NullInt64
+	var textUnit sql.NullString
+	var ts time.Time
+	if stream.Unit != "" && stream.Fields[0].Kind == IntField {
+		dest = append(dest, &intUnit, &ts)
+	} else {
+		dest = append(dest, &textUnit, &ts)
+	}
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		var unitValue interface{}
+		if intUnit.Valid {
+			unitValue = intUnit.Int64
+		} else if textUnit.Valid {
+			unitValue = textUnit.String
+		}
+		if current == nil || current.Unit != unitValue {
+			samples = append(samples, UnitSamples{Unit: unitValue, Metrics: make(map[string][]resample.Point, len(names))})
+			current = &samples[len(samples)-1]
+		}
+		for i, v := range values {
+			if v.Valid {
+				current.Metrics[names[i]] = append(current.Metrics[names[i]], resample.Point{TS: ts, Value: v.Float64})
+			}
+		}
+	}
+	return samples, rows.Err()
+}
+
+// streamLatest is vessel_stream_latest in memory: the vessel list reads it
+// for every vessel, and only ingest writes to it.
+type streamLatest struct {
+	mu       sync.Mutex
+	loaded   bool
+	byVessel map[int64]map[string]time.Time
+}
+
+// StreamLatest returns the latest ingested timestamp per stream. The table
+// is read once, in a single query, and then kept up to date by
+// SetStreamLatest.
+func (s *SQLStore) StreamLatest(ctx context.Context, vesselID int64) (map[string]time.Time, error) {
+	s.latest.mu.Lock()
+	defer s.latest.mu.Unlock()
+	if !s.latest.loaded {
+		byVessel, err := s.loadStreamLatest(ctx, `SELECT vessel_id, stream, latest_ts FROM vessel_stream_latest`)
+		if err != nil {
+			return nil, err
+		}
+		s.latest.byVessel, s.latest.loaded = byVessel, true
+	}
+
+	latest := make(map[string]time.Time, len(s.latest.byVessel[vesselID]))
+	for stream, ts := range s.latest.byVessel[vesselID] {
+		latest[stream] = ts
+	}
+	return latest, nil
+}
+
+func (s *SQLStore) SetStreamLatest(ctx context.Context, vesselID int64, stream string, ts time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO vessel_stream_latest (vessel_id, stream, latest_ts, version, updated_at)
+		VALUES (?, ?, ?, 1, ?)
+		ON CONFLICT(vessel_id, stream) DO UPDATE SET
+			latest_ts = excluded.latest_ts, version = version + 1, updated_at = excluded.updated_at`,
+		vesselID, stream, ts, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Read back rather than kept as given, to be the same as loaded
+	s.latest.mu.Lock()
+	defer s.latest.mu.Unlock()
+	if !s.latest.loaded {
+		return nil
+	}
+	byVessel, err := s.loadStreamLatest(ctx, `SELECT vessel_id, stream, latest_ts FROM vessel_stream_latest WHERE vessel_id = ?`, vesselID)
+	if err != nil {
+		s.latest.loaded = false
+		return nil // the row is written; the next read loads the table
+	}
+	s.latest.byVessel[vesselID] = byVessel[vesselID]
+	return nil
+}
+
+// ReloadStreamLatest drops the copy of vessel_stream_latest kept in memory,
+// after something else wrote to the table; the next read loads it again.
+func (s *SQLStore) ReloadStreamLatest() {
+	s.latest.mu.Lock()
+	defer s.latest.mu.Unlock()
+	s.latest.loaded = false
+	s.latest.byVessel = nil
+}
+
+// loadStreamLatest runs a query of vessel_id, stream and latest_ts.
+func (s *SQLStore) loadStreamLatest(ctx context.Context, query string, args ...interface{}) (map[int64]map[string]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byVessel := make(map[int64]map[string]time.Time)
+	for rows.Next() {
+		var vesselID int64
+		var stream string
+		var ts time.Time
+		if err := rows.Scan(&vesselID, &stream, &ts); err != nil {
+			continue
+		}
+		if byVessel[vesselID] == nil {
+			byVessel[vesselID] = make(map[string]time.Time)
+		}
+		byVessel[vesselID][stream] = ts
+	}
+	return byVessel, rows.Err()
+}
+
+// StreamVersion is how often a vessel's stream was written, and when last.
+type StreamVersion struct {
+	Version   int64
+	UpdatedAt time.Time
+}
+
+// StreamVersions returns the StreamVersion of each stream of a vessel.
+func (s *SQLStore) StreamVersions(ctx context.Context, vesselID int64) (map[string]StreamVersion, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT stream, version, updated_at, latest_ts
+		FROM vessel_stream_latest
+		WHERE vessel_id = ?
+	`, vesselID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[string]StreamVersion)
+	for rows.Next() {
+		var stream string
+		var v StreamVersion
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&stream, &v.Version, &updatedAt, &v.UpdatedAt); err != nil {
+			return nil, err
+		}
+		// Rows written before versions were kept only have latest_ts
+		if updatedAt.Valid {
+			v.UpdatedAt = updatedAt.Time
+		}
+		versions[stream] = v
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/models"
+)
+
+func TestProfileStream(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.Connect(filepath.Join(t.TempDir(), "profile.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	s := New(database)
+	vessel, err := s.CreateVessel(ctx, models.Vessel{Name: "Alpha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.CreateVessel(ctx, models.Vessel{Name: "Bravo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One engine at hours 1-7, rpm missing at hour 4 and repeated at hour 2,
+	// alarms only at hour 5
+	hour := func(h int) time.Time { return time.Date(2025, 8, 8, h, 0, 0, 0, time.UTC) }
+	write := func(vesselID int64, h int, rpm, alarms interface{}) {
+		_, err := s.WriteReading(ctx, ReadingWrite{
+			Table: "engine_readings", UnitCol: "engine_no", Unit: 1, VesselID: vesselID,
+			TS: hour(h), RowHash: strconv.FormatInt(vesselID, 10) + "-" + strconv.Itoa(h),
+			Cols: []string{"engine_no", "rpm", "alarms", "extra_json"}, Vals: []interface{}{1, rpm, alarms, []byte("{}")},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for h, rpm := range []interface{}{1500.0, 1500.0, 1600.0, nil, 1700.0, 1800.0, 1900.0} {
+		var alarms interface{}
+		if h+1 == 5 {
+			alarms = "HT"
+		}
+		write(vessel, h+1, rpm, alarms)
+	}
+	write(other, 1, 9999.0, "LO") // another vessel's reading is left out
+
+	field := func(stats []FieldStats, name string) FieldStats {
+		t.Helper()
+		for _, fs := range stats {
+			if fs.Field == name {
+				return fs
+			}
+		}
+		t.Fatalf("No stats for %s in %+v", name, stats)
+		return FieldStats{}
+	}
+
+	total, stats, err := s.ProfileStream(ctx, Streams["engines"], vessel, nil, nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 7 || len(stats) != len(Streams["engines"].Fields) {
+		t.Fatalf("Expected 7 rows and a profile per field, got %d, %d", total, len(stats))
+	}
+	rpm := field(stats, "rpm")
+	if rpm.NonNull != 6 || rpm.Min != 1500.0 || rpm.Max != 1900.0 || rpm.Distinct != 5 {
+		t.Errorf("Unexpected rpm profile %+v", rpm)
+	}
+	// Samples are distinct and capped at the sample size
+	if len(rpm.Samples) != 3 || rpm.Samples[0] == rpm.Samples[1] {
+		t.Errorf("Expected 3 distinct rpm samples, got %v", rpm.Samples)
+	}
+	alarms := field(stats, "alarms")
+	if alarms.NonNull != 1 || alarms.Min != "HT" || alarms.Max != "HT" || alarms.Distinct != 1 || len(alarms.Samples) != 1 {
+		t.Errorf("Unexpected alarms profile %+v", alarms)
+	}
+	temp := field(stats, "temp_c")
+	if temp.NonNull != 0 || temp.Min != nil || temp.Max != nil || temp.Distinct != 0 || len(temp.Samples) != 0 {
+		t.Errorf("Expected an empty temp_c profile, got %+v", temp)
+	}
+
+	// from and to are inclusive
+	from, to := hour(3), hour(5)
+	total, stats, err = s.ProfileStream(ctx, Streams["engines"], vessel, &from, &to, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpm = field(stats, "rpm")
+	if total != 3 || rpm.NonNull != 2 || rpm.Min != 1600.0 || rpm.Max != 1700.0 || rpm.Distinct != 2 || len(rpm.Samples) != 2 {
+		t.Errorf("Unexpected rpm profile from 03:00 to 05:00: %d rows, %+v", total, rpm)
+	}
+
+	// Nothing in range
+	from = hour(12)
+	if total, stats, err = s.ProfileStream(ctx, Streams["engines"], vessel, &from, nil, 5); err != nil || total != 0 {
+		t.Fatalf("Expected no rows after 12:00, got %d, %v", total, err)
+	}
+	if rpm = field(stats, "rpm"); rpm.NonNull != 0 || rpm.Min != nil || len(rpm.Samples) != 0 {
+		t.Errorf("Expected an empty rpm profile, got %+v", rpm)
+	}
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"vessel-telemetry-api/internal/reference"
+)
+
+func scanReferenceEntry(scan func(dest ...interface{}) error) (reference.Entry, error) {
+	var e reference.Entry
+	var attrs sql.NullString
+	if err := scan(&e.Code, &e.Name, &attrs); err != nil {
+		return e, err
+	}
+	if attrs.Valid && attrs.String != "" {
+		if err := json.Unmarshal([]byte(attrs.String), &e.Attributes); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// ListReference returns the entries of one kind, ordered by code.
+func (s *SQLStore) ListReference(ctx context.Context, kind string) ([]reference.Entry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT code, name, attributes_json FROM reference_entries WHERE kind = ? ORDER BY code", kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []reference.Entry{}
+	for rows.Next() {
+		e, err := scanReferenceEntry(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetReference returns one entry, or ErrNotFound.
+func (s *SQLStore) GetReference(ctx context.Context, kind, code string) (*reference.Entry, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT code, name, attributes_json FROM reference_entries WHERE kind = ? AND code = ?", kind, code)
+	e, err := scanReferenceEntry(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// PutReference creates or replaces an entry and reports whether it is new.
+// The entry must have been validated with reference.Validate.
+func (s *SQLStore) PutReference(ctx context.Context, kind string, e reference.Entry) (bool, error) {
+	var attrs interface{}
+	if len(e.Attributes) > 0 {
+		data, err := json.Marshal(e.Attributes)
+		if err != nil {
+			return false, err
+		}
+		attrs = string(data)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE reference_entries SET name = ?, attributes_json = ?, updated_at = datetime('now')
+		WHERE kind = ? AND code = ?`, e.Name, attrs, kind, e.Code)
+	if err != nil {
+		return false, err
+	}
+	created := false
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO reference_entries (kind, code, name, attributes_json) VALUES (?, ?, ?, ?)",
+			kind, e.Code, e.Name, attrs); err != nil {
+			return false, err
+		}
+		created = true
+	}
+	return created, tx.Commit()
+}
+
+// DeleteReference removes an entry, or returns ErrNotFound.
+func (s *SQLStore) DeleteReference(ctx context.Context, kind, code string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM reference_entries WHERE kind = ? AND code = ?", kind, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SeedReference stores the bundled entries of every kind that has none yet.
+func (s *SQLStore) SeedReference(ctx context.Context, data map[string][]reference.Entry) error {
+	for kind, entries := range data {
+		var count int
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM reference_entries WHERE kind = ?", kind).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		for _, e := range entries {
+			if _, err := s.PutReference(ctx, kind, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// Replication cursors besides those of the reading streams: upload records
+// and vessel metadata edits pushed ashore, and the central API's edits
+// taken (by their seq there).
+const (
+	UploadsStream = "uploads"
+	VesselsStream = "vessels"
+	VesselsPulled = "vessels.pulled"
+)
+
+// UpdatesCursor names the replication cursor of a stream's reading updates:
+// the cdc_log seq of the last update pushed ashore.
+func UpdatesCursor(stream string) string {
+	return "updates." + stream
+}
+
+// ReplicationCursors returns the highest id pushed ashore per stream, and
+// for uploads.
+func (s *SQLStore) ReplicationCursors(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT stream, last_id FROM replication_cursors")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cursors := map[string]int64{}
+	for rows.Next() {
+		var stream string
+		var lastID int64
+		if err := rows.Scan(&stream, &lastID); err != nil {
+			return nil, err
+		}
+		cursors[stream] = lastID
+	}
+	return cursors, rows.Err()
+}
+
+// SetReplicationCursor moves a stream's cursor once the central API has
+// taken a batch.
+func (s *SQLStore) SetReplicationCursor(ctx context.Context, stream string, lastID int64, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO replication_cursors (stream, last_id, pushed_at) VALUES (?, ?, ?)
+		ON CONFLICT(stream) DO UPDATE SET last_id = MAX(last_id, excluded.last_id), pushed_at = excluded.pushed_at`,
+		stream, lastID, at)
+	return err
+}
+
+// PendingReplication counts the readings of every stream, their updates,
+// the uploads and the vessel metadata edits not yet pushed ashore.
+func (s *SQLStore) PendingReplication(ctx context.Context) (map[string]int64, error) {
+	cursors, err := s.ReplicationCursors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string]string{UploadsStream: "uploads"}
+	for name, stream := range Streams {
+		tables[name] = stream.Table
+	}
+	pending := map[string]int64{}
+	for name, table := range tables {
+		var n int64
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+" WHERE id > ?", cursors[name]).Scan(&n); err != nil {
+			return nil, err
+		}
+		pending[name] = n
+	}
+	var n int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM vessel_field_versions WHERE seq > ?", cursors[VesselsStream]).Scan(&n); err != nil {
+		return nil, err
+	}
+	pending[VesselsStream] = n
+	for name := range Streams {
+		var n int64
+		err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM cdc_log WHERE stream = ? AND op = 'update' AND seq > ?",
+			name, cursors[UpdatesCursor(name)]).Scan(&n)
+		if err != nil {
+			return nil, err
+		}
+		pending[UpdatesCursor(name)] = n
+	}
+	return pending, nil
+}
+
+// ReadingsAfter returns up to limit readings of a stream above afterID,
+// oldest first.
+func (s *SQLStore) ReadingsAfter(ctx context.Context, stream string, afterID int64, limit int) ([]Reading, error) {
+	def, ok := Streams[stream]
+	if !ok {
+		return nil, fmt.Errorf("unknown stream %q", stream)
+	}
+	rows, err := s.db.QueryContext(ctx, def.readingColumns()+" WHERE id > ? ORDER BY id LIMIT ?", afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readings []Reading
+	for rows.Next() {
+		r, err := def.ScanReading(rows)
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, r)
+	}
+	return readings, rows.Err()
+}
+
+// UpdatesAfter returns up to limit updates of a stream's readings logged in
+// cdc_log above afterSeq, oldest first, each with the reading as it is now
+// (nil if deleted since), and the seq of the newest change logged before
+// them: with fewer than limit updates, none up to it is left.
+func (s *SQLStore) UpdatesAfter(ctx context.Context, stream string, afterSeq int64, limit int) ([]Change, int64, error) {
+	if _, ok := Streams[stream]; !ok {
+		return nil, 0, fmt.Errorf("unknown stream %q", stream)
+	}
+	// Read the head first, as Changes does
+	var head int64
+	err := s.db.QueryRowContext(ctx, "SELECT seq FROM sqlite_sequence WHERE name = 'cdc_log'").Scan(&head)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, 0, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT seq, op, stream, vessel_id, reading_id, changed_at
+		FROM cdc_log WHERE seq > ? AND stream = ? AND op = 'update' ORDER BY seq LIMIT ?`, afterSeq, stream, limit)
+	if err != nil {
+		return nil, head, err
+	}
+	var changes []Change
+	for rows.Next() {
+		var c Change
+		var changedAt string
+		if err := rows.Scan(&c.Seq, &c.Op, &c.Stream, &c.VesselID, &c.ReadingID, &changedAt); err != nil {
+			rows.Close()
+			return nil, head, err
+		}
+		if c.ChangedAt, err = time.Parse(time.RFC3339Nano, changedAt); err != nil {
+			rows.Close()
+			return nil, head, fmt.Errorf("change %d: invalid changed_at %q", c.Seq, changedAt)
+		}
+		changes = append(changes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, head, err
+	}
+	return changes, head, s.attachRows(ctx, changes)
+}
+
+// UploadsAfter returns up to limit uploads above afterID, oldest first.
+func (s *SQLStore) UploadsAfter(ctx context.Context, afterID int64, limit int) ([]models.Upload, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, vessel_id, source_filename, file_hash, uploaded_at, note
+		FROM uploads
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploads []models.Upload
+	for rows.Next() {
+		var u models.Upload
+		var filename, note sql.NullString
+		if err := rows.Scan(&u.ID, &u.VesselID, &filename, &u.FileHash, &u.UploadedAt, &note); err != nil {
+			return nil, err
+		}
+		u.SourceFilename = filename.String
+		if note.Valid {
+			u.Note = &note.String
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
+
+// ReplicationUsage returns the bytes pushed ashore in the window starting
+// at windowStart.
+func (s *SQLStore) ReplicationUsage(ctx context.Context, windowStart time.Time) (int64, error) {
+	var bytes int64
+	err := s.db.QueryRowContext(ctx, "SELECT bytes FROM replication_usage WHERE window_start = ?", windowStart.UTC()).Scan(&bytes)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return bytes, err
+}
+
+// AddReplicationUsage counts bytes pushed ashore in the window starting at
+// windowStart, and forgets windows older than a year.
+func (s *SQLStore) AddReplicationUsage(ctx context.Context, windowStart time.Time, bytes int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO replication_usage (window_start, bytes) VALUES (?, ?)
+		ON CONFLICT(window_start) DO UPDATE SET bytes = bytes + excluded.bytes`,
+		windowStart.UTC(), bytes)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM replication_usage WHERE window_start < ?", windowStart.UTC().AddDate(-1, 0, 0))
+	return err
+}
+
+// ReplicaVessel returns the vessel an edge's vessel id was mapped to.
+func (s *SQLStore) ReplicaVessel(ctx context.Context, edge string, edgeVesselID int64) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT vessel_id FROM replica_vessels WHERE edge = ? AND edge_vessel_id = ?", edge, edgeVesselID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+// SetReplicaVessel maps an edge's vessel id to a vessel.
+func (s *SQLStore) SetReplicaVessel(ctx context.Context, edge string, edgeVesselID, vesselID int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO replica_vessels (edge, edge_vessel_id, vessel_id) VALUES (?, ?, ?)
+		ON CONFLICT(edge, edge_vessel_id) DO UPDATE SET vessel_id = excluded.vessel_id`,
+		edge, edgeVesselID, vesselID)
+	return err
+}
+
+// ReplicaVessels returns the vessels an edge's vessel ids were mapped to.
+func (s *SQLStore) ReplicaVessels(ctx context.Context, edge string) (map[int64]int64, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT edge_vessel_id, vessel_id FROM replica_vessels WHERE edge = ?", edge)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vessels := map[int64]int64{}
+	for rows.Next() {
+		var edgeVesselID, vesselID int64
+		if err := rows.Scan(&edgeVesselID, &vesselID); err != nil {
+			return nil, err
+		}
+		vessels[edgeVesselID] = vesselID
+	}
+	return vessels, rows.Err()
+}
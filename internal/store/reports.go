@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const reportScheduleColumns = "id, name, frequency, vessel_id, fleet, recipients_json, template, enabled, created_at, updated_at"
+
+const reportDeliveryColumns = "id, schedule_id, period, recipients_json, vessels, status, error, manual, at"
+
+// ReportSchedules returns the report schedules by ID.
+func (s *SQLStore) ReportSchedules(ctx context.Context) ([]models.ReportSchedule, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+reportScheduleColumns+" FROM report_schedules ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []models.ReportSchedule{}
+	for rows.Next() {
+		rs, err := scanReportSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, rs)
+	}
+	return schedules, rows.Err()
+}
+
+// ReportSchedule returns one report schedule, or ErrNotFound.
+func (s *SQLStore) ReportSchedule(ctx context.Context, id int64) (*models.ReportSchedule, error) {
+	rs, err := scanReportSchedule(s.db.QueryRowContext(ctx, "SELECT "+reportScheduleColumns+" FROM report_schedules WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+func scanReportSchedule(row rowScanner) (models.ReportSchedule, error) {
+	var rs models.ReportSchedule
+	var recipients string
+	if err := row.Scan(&rs.ID, &rs.Name, &rs.Frequency, &rs.VesselID, &rs.Fleet, &recipients, &rs.Template, &rs.Enabled, &rs.CreatedAt, &rs.UpdatedAt); err != nil {
+		return rs, err
+	}
+	rs.CreatedAt, rs.UpdatedAt = rs.CreatedAt.UTC(), rs.UpdatedAt.UTC()
+	return rs, json.Unmarshal([]byte(recipients), &rs.Recipients)
+}
+
+// CreateReportSchedule stores a new report schedule and returns its ID.
+func (s *SQLStore) CreateReportSchedule(ctx context.Context, rs models.ReportSchedule) (int64, error) {
+	recipients, err := json.Marshal(rs.Recipients)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO report_schedules (name, frequency, vessel_id, fleet, recipients_json, template, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rs.Name, rs.Frequency, rs.VesselID, rs.Fleet, string(recipients), rs.Template, rs.Enabled, rs.CreatedAt, rs.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateReportSchedule replaces a report schedule, or returns ErrNotFound.
+func (s *SQLStore) UpdateReportSchedule(ctx context.Context, rs models.ReportSchedule) error {
+	recipients, err := json.Marshal(rs.Recipients)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE report_schedules SET name = ?, frequency = ?, vessel_id = ?, fleet = ?, recipients_json = ?, template = ?, enabled = ?, updated_at = ?
+		WHERE id = ?`,
+		rs.Name, rs.Frequency, rs.VesselID, rs.Fleet, string(recipients), rs.Template, rs.Enabled, rs.UpdatedAt, rs.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteReportSchedule removes a report schedule and its send history, or
+// returns ErrNotFound.
+func (s *SQLStore) DeleteReportSchedule(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM report_schedules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddReportDelivery records an attempt to send a scheduled report and
+// returns its ID.
+func (s *SQLStore) AddReportDelivery(ctx context.Context, d models.ReportDelivery) (int64, error) {
+	recipients, err := json.Marshal(d.Recipients)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO report_deliveries (schedule_id, period, recipients_json, vessels, status, error, manual, at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.ScheduleID, d.Period, string(recipients), d.Vessels, d.Status, d.Error, d.Manual, d.At)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ReportDeliveries returns the schedule's most recent deliveries, newest
+// first, of one period unless period is empty.
+func (s *SQLStore) ReportDeliveries(ctx context.Context, scheduleID int64, period string, limit int) ([]models.ReportDelivery, error) {
+	query := "SELECT " + reportDeliveryColumns + " FROM report_deliveries WHERE schedule_id = ?"
+	args := []interface{}{scheduleID}
+	if period != "" {
+		query += " AND period = ?"
+		args = append(args, period)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.ReportDelivery{}
+	for rows.Next() {
+		var d models.ReportDelivery
+		var recipients string
+		if err := rows.Scan(&d.ID, &d.ScheduleID, &d.Period, &recipients, &d.Vessels, &d.Status, &d.Error, &d.Manual, &d.At); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(recipients), &d.Recipients); err != nil {
+			return nil, err
+		}
+		d.At = d.At.UTC()
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+const reportTemplateColumns = "name, description, sections_json, branding_json, created_at, updated_at"
+
+// ReportTemplates returns the report templates by name.
+func (s *SQLStore) ReportTemplates(ctx context.Context) ([]models.ReportTemplate, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+reportTemplateColumns+" FROM report_templates ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []models.ReportTemplate{}
+	for rows.Next() {
+		t, err := scanReportTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// ReportTemplate returns one report template, or ErrNotFound.
+func (s *SQLStore) ReportTemplate(ctx context.Context, name string) (*models.ReportTemplate, error) {
+	t, err := scanReportTemplate(s.db.QueryRowContext(ctx, "SELECT "+reportTemplateColumns+" FROM report_templates WHERE name = ?", name))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func scanReportTemplate(row rowScanner) (models.ReportTemplate, error) {
+	var t models.ReportTemplate
+	var sections, branding string
+	if err := row.Scan(&t.Name, &t.Description, &sections, &branding, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return t, err
+	}
+	t.CreatedAt, t.UpdatedAt = t.CreatedAt.UTC(), t.UpdatedAt.UTC()
+	if err := json.Unmarshal([]byte(sections), &t.Sections); err != nil {
+		return t, err
+	}
+	return t, json.Unmarshal([]byte(branding), &t.Branding)
+}
+
+// PutReportTemplate creates or replaces a report template by name, and
+// reports whether it was created. The creation time of a replaced template
+// is kept.
+func (s *SQLStore) PutReportTemplate(ctx context.Context, t models.ReportTemplate) (bool, error) {
+	sections, err := json.Marshal(t.Sections)
+	if err != nil {
+		return false, err
+	}
+	branding, err := json.Marshal(t.Branding)
+	if err != nil {
+		return false, err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE report_templates SET description = ?, sections_json = ?, branding_json = ?, updated_at = ?
+		WHERE name = ?`,
+		t.Description, string(sections), string(branding), t.UpdatedAt, t.Name)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return false, nil
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO report_templates (name, description, sections_json, branding_json, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		t.Name, t.Description, string(sections), string(branding), t.UpdatedAt, t.UpdatedAt)
+	return err == nil, err
+}
+
+// DeleteReportTemplate removes a report template, or returns ErrNotFound.
+func (s *SQLStore) DeleteReportTemplate(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM report_templates WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
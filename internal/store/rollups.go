@@ -0,0 +1,292 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// rollupPeriods are the bucket lengths of stream_rollups in seconds,
+// coarsest first.
+var rollupPeriods = []int64{86400, 3600}
+
+// rollupPeriod returns the longest rollup period that divides a bucket of
+// secs seconds, 0 if none does.
+func rollupPeriod(secs int64) int64 {
+	for _, period := range rollupPeriods {
+		if secs%period == 0 {
+			return period
+		}
+	}
+	return 0
+}
+
+// floorTo rounds t down to a multiple of period seconds since the epoch.
+func floorTo(t time.Time, period int64) int64 {
+	secs := t.Unix()
+	start := secs / period * period
+	if start > secs {
+		start -= period // before the epoch
+	}
+	return start
+}
+
+// RefreshRollups recomputes the rollups of a vessel's stream over every
+// bucket that overlaps from..to, after readings in that range were written.
+func (s *SQLStore) RefreshRollups(ctx context.Context, stream *Stream, vesselID int64, from, to time.Time) error {
+	return s.refreshRollups(ctx, stream, &vesselID, &from, &to)
+}
+
+// RebuildRollups recomputes the rollups of a stream for every vessel from
+// since on, or altogether if since is nil, after readings were written
+// other than by ingest.
+func (s *SQLStore) RebuildRollups(ctx context.Context, stream *Stream, since *time.Time) error {
+	return s.refreshRollups(ctx, stream, nil, since, nil)
+}
+
+// BackfillRollups builds the rollups of a database that has none, such as
+// one created before they were kept.
+func (s *SQLStore) BackfillRollups(ctx context.Context) error {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM stream_rollups)").Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	for _, name := range StreamOrder {
+		if err := s.RebuildRollups(ctx, Streams[name], nil); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// refreshRollups replaces the rollups of the buckets overlapping from..to,
+// unbounded where nil, of one vessel or all of them.
+func (s *SQLStore) refreshRollups(ctx context.Context, stream *Stream, vesselID *int64, from, to *time.Time) error {
+	var metrics []string
+	for _, f := range stream.Fields {
+		if stream.IsMetric(f.Name) {
+			metrics = append(metrics, f.Name)
+		}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	unit := "''"
+	if stream.Unit != "" {
+		unit = "COALESCE(CAST(" + stream.Unit + " AS TEXT), '')"
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, period := range rollupPeriods {
+		deleteQuery := "DELETE FROM stream_rollups WHERE stream = ? AND period = ?"
+		deleteArgs := []interface{}{stream.Name, period}
+		where := " WHERE 1 = 1"
+		var args []interface{}
+		if vesselID != nil {
+			deleteQuery += " AND vessel_id = ?"
+			deleteArgs = append(deleteArgs, *vesselID)
+			where += " AND vessel_id = ?"
+			args = append(args, *vesselID)
+		}
+		if from != nil {
+			start := floorTo(*from, period)
+			deleteQuery += " AND bucket >= ?"
+			deleteArgs = append(deleteArgs, start)
+			where += " AND ts >= ?"
+			args = append(args, time.Unix(start, 0).UTC())
+		}
+		if to != nil {
+			end := floorTo(*to, period) + period
+			deleteQuery += " AND bucket < ?"
+			deleteArgs = append(deleteArgs, end)
+			where += " AND ts < ?"
+			args = append(args, time.Unix(end, 0).UTC())
+		}
+		if _, err := tx.ExecContext(ctx, deleteQuery, deleteArgs...); err != nil {
+			return err
+		}
+
+		for _, metric := range metrics {
+			uncertainty := "0, 0"
+			if stream.HasUncertainty(metric) {
+				uncertainty = "SUM(ABS(" + metric + ") * COALESCE(uncertainty_percent, 0) / 100), COUNT(uncertainty_percent)"
+			}
+			query := `INSERT INTO stream_rollups (vessel_id, stream, metric, unit, period, bucket, count, sum, min, max, uncertainty_sum, uncertainty_count)
+				SELECT vessel_id, ?, ?, ` + unit + `, ?, (CAST(strftime('%s', ts) AS INTEGER) / ?) * ? AS bucket,
+					COUNT(*), SUM(` + metric + `), MIN(` + metric + `), MAX(` + metric + `), ` + uncertainty + `
+				FROM ` + stream.Table + where + ` AND ` + metric + ` IS NOT NULL
+				GROUP BY vessel_id, ` + unit + `, bucket`
+			queryArgs := append([]interface{}{stream.Name, metric, period, period, period}, args...)
+			if _, err := tx.ExecContext(ctx, query, queryArgs...); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// bucketTotals accumulates the readings of one vessel's bucket, from
+// rollups and readings alike.
+type bucketTotals struct {
+	count            int64
+	sum, min, max    float64
+	uncertaintySum   float64
+	uncertaintyCount int64
+}
+
+func (t *bucketTotals) add(o bucketTotals) {
+	if t.count == 0 || o.min < t.min {
+		t.min = o.min
+	}
+	if t.count == 0 || o.max > t.max {
+		t.max = o.max
+	}
+	t.count += o.count
+	t.sum += o.sum
+	t.uncertaintySum += o.uncertaintySum
+	t.uncertaintyCount += o.uncertaintyCount
+}
+
+// seriesTotals adds up the buckets of a series query into totals, keyed by
+// vessel and bucket start. Whole rollup periods within From..To are read
+// from stream_rollups, when the bucket is a multiple of one and no sources
+// are filtered; the rest of the range from the readings.
+func (s *SQLStore) seriesTotals(ctx context.Context, q SeriesQuery, secs int64, totals map[[2]int64]*bucketTotals) error {
+	period := rollupPeriod(secs)
+	if period == 0 || len(q.Sources.Only) > 0 || len(q.Sources.Exclude) > 0 {
+		return s.readingTotals(ctx, q, secs, q.From, q.To, false, totals)
+	}
+
+	// Rollups cover the whole periods start..end; the readings before and
+	// after them are read as they are
+	var start, end *time.Time
+	if q.From != nil {
+		t := time.Unix(floorTo(*q.From, period), 0).UTC()
+		if t.Before(*q.From) {
+			t = t.Add(time.Duration(period) * time.Second)
+		}
+		start = &t
+	}
+	if q.To != nil {
+		// To is inclusive, so a reading at a period start is read after it
+		t := time.Unix(floorTo(*q.To, period), 0).UTC()
+		end = &t
+	}
+	if start != nil && end != nil && start.After(*end) {
+		// From and To within one period
+		return s.readingTotals(ctx, q, secs, q.From, q.To, false, totals)
+	}
+
+	if start != nil && start.After(*q.From) {
+		if err := s.readingTotals(ctx, q, secs, q.From, start, true, totals); err != nil {
+			return err
+		}
+	}
+	if end != nil {
+		if err := s.readingTotals(ctx, q, secs, end, q.To, false, totals); err != nil {
+			return err
+		}
+	}
+	if start != nil && end != nil && !start.Before(*end) {
+		return nil
+	}
+	return s.rollupTotals(ctx, q, secs, period, start, end, totals)
+}
+
+// readingTotals adds the readings from..to to totals, excluding to if
+// toExclusive.
+func (s *SQLStore) readingTotals(ctx context.Context, q SeriesQuery, secs int64, from, to *time.Time, toExclusive bool, totals map[[2]int64]*bucketTotals) error {
+	uncertainty := "0, 0"
+	if q.Stream.HasUncertainty(q.Metric) {
+		uncertainty = "SUM(ABS(" + q.Metric + ") * COALESCE(uncertainty_percent, 0) / 100), COUNT(uncertainty_percent)"
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(q.VesselIDs)), ", ")
+	query := `SELECT vessel_id, (CAST(strftime('%s', ts) AS INTEGER) / ?) * ? AS bucket,
+		COUNT(*), SUM(` + q.Metric + `), MIN(` + q.Metric + `), MAX(` + q.Metric + `), ` + uncertainty + `
+		FROM ` + q.Stream.Table + `
+		WHERE vessel_id IN (` + placeholders + `) AND ` + q.Metric + ` IS NOT NULL`
+	args := []interface{}{secs, secs}
+	for _, id := range q.VesselIDs {
+		args = append(args, id)
+	}
+	if q.Unit != nil {
+		query += " AND " + q.Stream.Unit + " = ?"
+		args = append(args, q.Unit)
+	}
+	if toExclusive {
+		query, args = timeRange(query, args, from, nil)
+		query += " AND ts < ?"
+		args = append(args, *to)
+	} else {
+		query, args = timeRange(query, args, from, to)
+	}
+	query, args = q.Sources.apply(q.Stream, query, args)
+	query += " GROUP BY vessel_id, bucket"
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return addTotals(rows, totals)
+}
+
+// rollupTotals adds the rollups of the periods within start..end, unbounded
+// where nil, to totals.
+func (s *SQLStore) rollupTotals(ctx context.Context, q SeriesQuery, secs, period int64, start, end *time.Time, totals map[[2]int64]*bucketTotals) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(q.VesselIDs)), ", ")
+	query := `SELECT vessel_id, (bucket / ?) * ? AS series_bucket,
+		SUM(count), SUM(sum), MIN(min), MAX(max), SUM(uncertainty_sum), SUM(uncertainty_count)
+		FROM stream_rollups
+		WHERE stream = ? AND metric = ? AND period = ? AND vessel_id IN (` + placeholders + `)`
+	args := []interface{}{secs, secs, q.Stream.Name, q.Metric, period}
+	for _, id := range q.VesselIDs {
+		args = append(args, id)
+	}
+	if q.Unit != nil {
+		query += " AND unit = CAST(? AS TEXT)"
+		args = append(args, q.Unit)
+	}
+	if start != nil {
+		query += " AND bucket >= ?"
+		args = append(args, start.Unix())
+	}
+	if end != nil {
+		query += " AND bucket < ?"
+		args = append(args, end.Unix())
+	}
+	query += " GROUP BY vessel_id, series_bucket"
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return addTotals(rows, totals)
+}
+
+// addTotals adds rows of vessel_id, bucket, count, sum, min, max,
+// uncertainty sum and count to totals, and closes them.
+func addTotals(rows *sql.Rows, totals map[[2]int64]*bucketTotals) error {
+	defer rows.Close()
+	for rows.Next() {
+		var key [2]int64
+		var t bucketTotals
+		if err := rows.Scan(&key[0], &key[1], &t.count, &t.sum, &t.min, &t.max, &t.uncertaintySum, &t.uncertaintyCount); err != nil {
+			return err
+		}
+		if totals[key] == nil {
+			totals[key] = &bucketTotals{}
+		}
+		totals[key].add(t)
+	}
+	return rows.Err()
+}
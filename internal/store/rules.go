@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const validationRuleColumns = "id, stream, expression, action, description, created_at, updated_at"
+
+// ValidationRules returns the validation rules by ID.
+func (s *SQLStore) ValidationRules(ctx context.Context) ([]models.ValidationRule, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+validationRuleColumns+" FROM validation_rules ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.ValidationRule{}
+	for rows.Next() {
+		r, err := scanValidationRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// ValidationRule returns one validation rule, or ErrNotFound.
+func (s *SQLStore) ValidationRule(ctx context.Context, id int64) (*models.ValidationRule, error) {
+	r, err := scanValidationRule(s.db.QueryRowContext(ctx, "SELECT "+validationRuleColumns+" FROM validation_rules WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func scanValidationRule(row rowScanner) (models.ValidationRule, error) {
+	var r models.ValidationRule
+	if err := row.Scan(&r.ID, &r.Stream, &r.Expression, &r.Action, &r.Description, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return r, err
+	}
+	r.CreatedAt, r.UpdatedAt = r.CreatedAt.UTC(), r.UpdatedAt.UTC()
+	return r, nil
+}
+
+// CreateValidationRule stores a new validation rule and returns its ID.
+func (s *SQLStore) CreateValidationRule(ctx context.Context, r models.ValidationRule) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO validation_rules (stream, expression, action, description, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		r.Stream, r.Expression, r.Action, r.Description, r.CreatedAt, r.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateValidationRule replaces a validation rule, or returns ErrNotFound.
+func (s *SQLStore) UpdateValidationRule(ctx context.Context, r models.ValidationRule) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE validation_rules SET stream = ?, expression = ?, action = ?, description = ?, updated_at = ?
+		WHERE id = ?`,
+		r.Stream, r.Expression, r.Action, r.Description, r.UpdatedAt, r.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteValidationRule removes a validation rule, or returns ErrNotFound.
+func (s *SQLStore) DeleteValidationRule(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM validation_rules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
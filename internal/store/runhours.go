@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/runhours"
+)
+
+// runningHoursTable is where the running hours of one kind of machine are
+// kept and the readings they are derived from.
+type runningHoursTable struct {
+	table, readings string
+	unit, level     string // unit and running level columns of the readings
+	opts            runhours.Options
+}
+
+var (
+	engineRunningHours    = runningHoursTable{"engine_running_hours", "engine_readings", "engine_no", "rpm", runhours.EngineOptions}
+	generatorRunningHours = runningHoursTable{"generator_running_hours", "generator_readings", "gen_no", "load_kw", runhours.GeneratorOptions}
+)
+
+// RebuildRunningHours re-derives the vessel's engine running hours after
+// engine readings at or after since were written.
+func (s *SQLStore) RebuildRunningHours(ctx context.Context, vesselID int64, since time.Time) error {
+	return s.rebuildRunningHours(ctx, engineRunningHours, vesselID, since)
+}
+
+// RebuildGeneratorRunningHours re-derives the vessel's generator running
+// hours after generator readings at or after since were written.
+func (s *SQLStore) RebuildGeneratorRunningHours(ctx context.Context, vesselID int64, since time.Time) error {
+	return s.rebuildRunningHours(ctx, generatorRunningHours, vesselID, since)
+}
+
+// rebuildRunningHours re-derives the running hours kept in t. A new reading
+// also changes the time since each unit's previous reading, so the days are
+// rebuilt from the earliest of those; readings up to the counter's max gap
+// before that day are read too, for the counter increase leading into it.
+func (s *SQLStore) rebuildRunningHours(ctx context.Context, t runningHoursTable, vesselID int64, since time.Time) error {
+	opts := t.opts
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Deleting first takes the write lock before anything is read
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+t.table+` WHERE vessel_id = ? AND day >= ?`,
+		vesselID, since.UTC().Format(runhours.DayLayout)); err != nil {
+		return err
+	}
+	var raw sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT MIN(last_ts) FROM (
+			SELECT MAX(ts) AS last_ts FROM `+t.readings+`
+			WHERE vessel_id = ? AND ts < ? AND ts >= ?
+			GROUP BY `+t.unit+`)`, vesselID, since, since.Add(-opts.CounterMaxGap)).Scan(&raw)
+	if err != nil {
+		return err
+	}
+	previous, err := parseTime(raw)
+	if err != nil {
+		return err
+	}
+	if previous == nil || !previous.Before(since) {
+		previous = &since
+	}
+	start := previous.UTC().Truncate(24 * time.Hour)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+t.table+` WHERE vessel_id = ? AND day >= ?`,
+		vesselID, start.Format(runhours.DayLayout)); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+t.unit+`, ts, `+t.level+`, `+extraJSONColumn("")+` FROM `+t.readings+`
+		WHERE vessel_id = ? AND ts >= ?
+		ORDER BY `+t.unit+`, ts, id`, vesselID, start.Add(-opts.CounterMaxGap))
+	if err != nil {
+		return err
+	}
+
+	type unit struct {
+		unitNo  sql.NullInt64
+		samples []runhours.Sample
+	}
+	var units []*unit
+	for rows.Next() {
+		var unitNo sql.NullInt64
+		var ts time.Time
+		var level sql.NullFloat64
+		var extra sql.NullString
+		if err := rows.Scan(&unitNo, &ts, &level, &extra); err != nil {
+			rows.Close()
+			return err
+		}
+		if len(units) == 0 || units[len(units)-1].unitNo != unitNo {
+			units = append(units, &unit{unitNo: unitNo})
+		}
+		u := units[len(units)-1]
+		sample := runhours.Sample{TS: ts, Counter: runhours.Counter([]byte(extra.String))}
+		if level.Valid {
+			sample.Level = &level.Float64
+		}
+		u.samples = append(u.samples, sample)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range units {
+		for _, d := range runhours.Daily(u.samples, start, opts) {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO `+t.table+` (vessel_id, `+t.unit+`, day, hours, source, counter_hours)
+				VALUES (?, ?, ?, ?, ?, ?)`,
+				vesselID, u.unitNo, d.Day, d.Hours, d.Source, d.Counter)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RunningHours returns the vessel's engine running hours on the days from..to
+// (YYYY-MM-DD, both optional and inclusive), by engine then day, optionally
+// of one engine.
+func (s *SQLStore) RunningHours(ctx context.Context, vesselID int64, engineNo *int, from, to string) ([]models.EngineRunningHours, error) {
+	query := `SELECT engine_no, day, hours, source, counter_hours
+		FROM engine_running_hours WHERE vessel_id = ?`
+	args := []interface{}{vesselID}
+	if engineNo != nil {
+		query += " AND engine_no = ?"
+		args = append(args, *engineNo)
+	}
+	if from != "" {
+		query += " AND day >= ?"
+		args = append(args, from)
+	}
+	if to != "" {
+		query += " AND day <= ?"
+		args = append(args, to)
+	}
+	query += " ORDER BY engine_no, day"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.EngineRunningHours{}
+	for rows.Next() {
+		var h models.EngineRunningHours
+		var engineNo sql.NullInt64
+		var counter sql.NullFloat64
+		if err := rows.Scan(&engineNo, &h.Day, &h.Hours, &h.Source, &counter); err != nil {
+			return nil, err
+		}
+		if engineNo.Valid {
+			n := int(engineNo.Int64)
+			h.EngineNo = &n
+		}
+		if counter.Valid {
+			h.CounterHours = &counter.Float64
+		}
+		items = append(items, h)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const sensorColumns = "id, stream, unit, location, installed_on, first_seen, last_seen, updated_at, filters_json"
+
+func scanSensor(row rowScanner) (models.Sensor, error) {
+	var s models.Sensor
+	var updatedAt sql.NullTime
+	var filters sql.NullString
+	if err := row.Scan(&s.ID, &s.Stream, &s.Unit, &s.Location, &s.InstalledOn, &s.FirstSeen, &s.LastSeen, &updatedAt, &filters); err != nil {
+		return s, err
+	}
+	s.Filters = []models.SensorFilter{}
+	if filters.Valid {
+		if err := json.Unmarshal([]byte(filters.String), &s.Filters); err != nil {
+			return s, err
+		}
+	}
+	if stream, ok := Streams[s.Stream]; ok {
+		s.Kind = stream.Kind
+	}
+	s.FirstSeen, s.LastSeen = s.FirstSeen.UTC(), s.LastSeen.UTC()
+	if updatedAt.Valid {
+		t := updatedAt.Time.UTC()
+		s.UpdatedAt = &t
+	}
+	return s, nil
+}
+
+// Sensors returns the vessel's registered sensors by stream and unit, only
+// those of stream unless it is empty.
+func (s *SQLStore) Sensors(ctx context.Context, vesselID int64, stream string) ([]models.Sensor, error) {
+	query := "SELECT " + sensorColumns + " FROM sensors WHERE vessel_id = ?"
+	args := []interface{}{vesselID}
+	if stream != "" {
+		query += " AND stream = ?"
+		args = append(args, stream)
+	}
+	// Numeric units sort by number, camera ids by text
+	query += " ORDER BY stream, CAST(unit AS INTEGER), unit"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sensors := []models.Sensor{}
+	for rows.Next() {
+		sensor, err := scanSensor(rows)
+		if err != nil {
+			return nil, err
+		}
+		sensors = append(sensors, sensor)
+	}
+	return sensors, rows.Err()
+}
+
+// Sensor returns one of the vessel's sensors, or ErrNotFound.
+func (s *SQLStore) Sensor(ctx context.Context, vesselID, id int64) (*models.Sensor, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+sensorColumns+" FROM sensors WHERE vessel_id = ? AND id = ?", vesselID, id)
+	sensor, err := scanSensor(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sensor, nil
+}
+
+// UpdateSensor replaces the editable metadata of a sensor (location and
+// installed_on) as of sensor.UpdatedAt.
+func (s *SQLStore) UpdateSensor(ctx context.Context, vesselID int64, sensor models.Sensor) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE sensors SET location = ?, installed_on = ?, updated_at = ? WHERE vessel_id = ? AND id = ?",
+		sensor.Location, sensor.InstalledOn, sensor.UpdatedAt, vesselID, sensor.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetSensorFilters replaces the spike filters of a sensor as of at.
+func (s *SQLStore) SetSensorFilters(ctx context.Context, vesselID, id int64, filters []models.SensorFilter, at time.Time) error {
+	var raw interface{}
+	if len(filters) > 0 {
+		b, err := json.Marshal(filters)
+		if err != nil {
+			return err
+		}
+		raw = string(b)
+	}
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE sensors SET filters_json = ?, updated_at = ? WHERE vessel_id = ? AND id = ?",
+		raw, at, vesselID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecentValues returns up to n values of field from a sensor's readings
+// before ts, oldest first, skipping readings without one.
+func (s *SQLStore) RecentValues(ctx context.Context, stream *Stream, sensorID int64, field string, before time.Time, n int) ([]float64, error) {
+	if _, ok := stream.Field(field); !ok {
+		return nil, fmt.Errorf("unknown field %s of %s", field, stream.Name)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+field+" FROM "+stream.Table+" WHERE sensor_ref = ? AND ts < ? AND "+field+" IS NOT NULL ORDER BY ts DESC, id DESC LIMIT ?",
+		sensorID, before, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []float64
+	for rows.Next() {
+		var v float64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
+	}
+	return values, rows.Err()
+}
+
+// AddOutlier records a value a sensor filter replaced; one already recorded
+// for the same reading and field is kept.
+func (s *SQLStore) AddOutlier(ctx context.Context, o models.Outlier) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO reading_outliers (vessel_id, stream, sensor_id, ts, field, raw_value, stored_value, method, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(sensor_id, ts, field) DO NOTHING`,
+		o.VesselID, o.Stream, o.SensorID, o.TS, o.Field, o.Raw, o.Stored, o.Method, o.CreatedAt)
+	return err
+}
+
+// Outliers returns the vessel's replaced values by reading time, those of
+// stream only unless it is empty.
+func (s *SQLStore) Outliers(ctx context.Context, vesselID int64, stream string, from, to *time.Time) ([]models.Outlier, error) {
+	query := `
+		SELECT o.id, o.vessel_id, o.stream, o.sensor_id, s.unit, o.ts, o.field, o.raw_value, o.stored_value, o.method, o.created_at
+		FROM reading_outliers o JOIN sensors s ON s.id = o.sensor_id
+		WHERE o.vessel_id = ?`
+	args := []interface{}{vesselID}
+	if stream != "" {
+		query += " AND o.stream = ?"
+		args = append(args, stream)
+	}
+	if from != nil {
+		query += " AND o.ts >= ?"
+		args = append(args, *from)
+	}
+	if to != nil {
+		query += " AND o.ts < ?"
+		args = append(args, *to)
+	}
+	query += " ORDER BY o.ts, o.id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outliers := []models.Outlier{}
+	for rows.Next() {
+		var o models.Outlier
+		if err := rows.Scan(&o.ID, &o.VesselID, &o.Stream, &o.SensorID, &o.Unit, &o.TS, &o.Field, &o.Raw, &o.Stored, &o.Method, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		o.TS, o.CreatedAt = o.TS.UTC(), o.CreatedAt.UTC()
+		outliers = append(outliers, o)
+	}
+	return outliers, rows.Err()
+}
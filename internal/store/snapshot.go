@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Snapshot writes a consistent copy of the whole database to path, which
+// must not exist yet.
+func (s *SQLStore) Snapshot(ctx context.Context, path string) error {
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("building snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the contents of the database with the SQLite database at
+// path, using the online backup API so open connections see the new data. A
+// damaged file (e.g. a cut-off download) is refused before anything changes.
+func (s *SQLStore) Restore(ctx context.Context, path string) error {
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var check string
+	if err := src.QueryRowContext(ctx, "PRAGMA quick_check").Scan(&check); err != nil {
+		return fmt.Errorf("checking snapshot: %w", err)
+	}
+	if check != "ok" {
+		return fmt.Errorf("snapshot is damaged: %s", check)
+	}
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	dstConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	// Whatever happens, the copy in memory may be out of date
+	defer s.ReloadStreamLatest()
+
+	return dstConn.Raw(func(dst interface{}) error {
+		return srcConn.Raw(func(src interface{}) error {
+			backup, err := dst.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("restoring snapshot: %w", err)
+			}
+			return backup.Finish()
+		})
+	})
+}
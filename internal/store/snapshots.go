@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// snapshotQuery selects snapshots with the status reading of their camera at
+// the same ts, the newest if several.
+const snapshotQuery = `
+	SELECT s.id, s.cam_id, s.ts, s.url, s.object_key, s.content_type, s.size_bytes, s.created_at,
+		r.id, r.status, r.uptime_percent
+	FROM cctv_snapshots s
+	LEFT JOIN cctv_status_readings r ON r.id = (
+		SELECT id FROM cctv_status_readings
+		WHERE vessel_id = s.vessel_id AND cam_id = s.cam_id AND ts = s.ts
+		ORDER BY id DESC LIMIT 1)`
+
+func scanSnapshot(row rowScanner) (*models.CCTVSnapshot, error) {
+	var s models.CCTVSnapshot
+	err := row.Scan(&s.ID, &s.CamID, &s.TS, &s.URL, &s.ObjectKey, &s.ContentType, &s.SizeBytes, &s.CreatedAt,
+		&s.ReadingID, &s.Status, &s.UptimePercent)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.TS, s.CreatedAt = s.TS.UTC(), s.CreatedAt.UTC()
+	return &s, nil
+}
+
+// PutCCTVSnapshot records a snapshot of a camera and returns its id. A second
+// snapshot of the camera at the same ts fills in what the first lacks, so a
+// sheet's URL and an uploaded image end up on one snapshot.
+func (s *SQLStore) PutCCTVSnapshot(ctx context.Context, vesselID int64, snapshot models.CCTVSnapshot) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO cctv_snapshots (vessel_id, cam_id, ts, url, object_key, content_type, size_bytes)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(vessel_id, cam_id, ts) DO UPDATE SET
+			url = COALESCE(excluded.url, url),
+			object_key = COALESCE(excluded.object_key, object_key),
+			content_type = COALESCE(excluded.content_type, content_type),
+			size_bytes = COALESCE(excluded.size_bytes, size_bytes)
+		RETURNING id`,
+		vesselID, snapshot.CamID, snapshot.TS, snapshot.URL, snapshot.ObjectKey, snapshot.ContentType, snapshot.SizeBytes).Scan(&id)
+	return id, err
+}
+
+// LatestCCTVSnapshot returns the camera's newest snapshot, or ErrNotFound.
+func (s *SQLStore) LatestCCTVSnapshot(ctx context.Context, vesselID int64, camID string) (*models.CCTVSnapshot, error) {
+	return scanSnapshot(s.db.QueryRowContext(ctx,
+		snapshotQuery+" WHERE s.vessel_id = ? AND s.cam_id = ? ORDER BY s.ts DESC, s.id DESC LIMIT 1", vesselID, camID))
+}
+
+// CCTVSnapshot returns one of the vessel's snapshots, or ErrNotFound.
+func (s *SQLStore) CCTVSnapshot(ctx context.Context, vesselID, id int64) (*models.CCTVSnapshot, error) {
+	return scanSnapshot(s.db.QueryRowContext(ctx, snapshotQuery+" WHERE s.vessel_id = ? AND s.id = ?", vesselID, id))
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const snmpDeviceColumns = `id, vessel_id, name, kind, address, version, community, status_oid,
+	last_status, last_uptime_hours, last_polled_at, last_error, created_at, updated_at`
+
+// SNMPDevices returns the SNMP devices of a vessel, of every vessel if
+// vesselID is 0, by vessel and name.
+func (s *SQLStore) SNMPDevices(ctx context.Context, vesselID int64) ([]models.SNMPDevice, error) {
+	query := "SELECT " + snmpDeviceColumns + " FROM snmp_devices"
+	var args []interface{}
+	if vesselID != 0 {
+		query += " WHERE vessel_id = ?"
+		args = append(args, vesselID)
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY vessel_id, name, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.SNMPDevice{}
+	for rows.Next() {
+		d, err := scanSNMPDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// SNMPDevice returns one SNMP device of the vessel, or ErrNotFound.
+func (s *SQLStore) SNMPDevice(ctx context.Context, vesselID, id int64) (*models.SNMPDevice, error) {
+	d, err := scanSNMPDevice(s.db.QueryRowContext(ctx,
+		"SELECT "+snmpDeviceColumns+" FROM snmp_devices WHERE vessel_id = ? AND id = ?", vesselID, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func scanSNMPDevice(row rowScanner) (models.SNMPDevice, error) {
+	var d models.SNMPDevice
+	var polledAt sql.NullTime
+	if err := row.Scan(&d.ID, &d.VesselID, &d.Name, &d.Kind, &d.Address, &d.Version, &d.Community, &d.StatusOID,
+		&d.LastStatus, &d.LastUptimeHours, &polledAt, &d.LastError, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return d, err
+	}
+	if polledAt.Valid {
+		at := polledAt.Time.UTC()
+		d.LastPolledAt = &at
+	}
+	d.CreatedAt, d.UpdatedAt = d.CreatedAt.UTC(), d.UpdatedAt.UTC()
+	return d, nil
+}
+
+// CreateSNMPDevice stores a new SNMP device and returns its ID.
+func (s *SQLStore) CreateSNMPDevice(ctx context.Context, d models.SNMPDevice) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO snmp_devices (vessel_id, name, kind, address, version, community, status_oid, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.VesselID, d.Name, d.Kind, d.Address, d.Version, d.Community, d.StatusOID, d.CreatedAt, d.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateSNMPDevice replaces an SNMP device, forgetting its latest poll, or
+// returns ErrNotFound.
+func (s *SQLStore) UpdateSNMPDevice(ctx context.Context, d models.SNMPDevice) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE snmp_devices SET name = ?, kind = ?, address = ?, version = ?, community = ?, status_oid = ?,
+			last_status = NULL, last_uptime_hours = NULL, last_polled_at = NULL, last_error = NULL, updated_at = ?
+		WHERE vessel_id = ? AND id = ?`,
+		d.Name, d.Kind, d.Address, d.Version, d.Community, d.StatusOID, d.UpdatedAt, d.VesselID, d.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteSNMPDevice removes an SNMP device of the vessel, or returns
+// ErrNotFound.
+func (s *SQLStore) DeleteSNMPDevice(ctx context.Context, vesselID, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM snmp_devices WHERE vessel_id = ? AND id = ?", vesselID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordSNMPPoll notes the status and uptime a device reported at a time, or
+// the error polling it failed with.
+func (s *SQLStore) RecordSNMPPoll(ctx context.Context, id int64, status *string, uptimeHours *float64, at time.Time, pollErr *string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE snmp_devices SET last_status = ?, last_uptime_hours = ?, last_polled_at = ?, last_error = ? WHERE id = ?",
+		status, uptimeHours, at, pollErr, id)
+	return err
+}
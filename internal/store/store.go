@@ -0,0 +1,346 @@
+// Package store is the persistence layer. Handlers and ingest talk to the
+// Store interface only, so the SQL lives in one place, every query honours the
+// caller's context, and handlers can be tested against a fake store.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"vessel-telemetry-api/internal/audit"
+	"vessel-telemetry-api/internal/fueldrop"
+	"vessel-telemetry-api/internal/gensets"
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/ports"
+	"vessel-telemetry-api/internal/reference"
+	"vessel-telemetry-api/internal/utilization"
+	"vessel-telemetry-api/internal/watermark"
+	"vessel-telemetry-api/internal/weather"
+)
+
+// ErrNotFound is returned by single-row lookups that match nothing.
+var ErrNotFound = errors.New("not found")
+
+// Rows is a forward-only result set; *sql.Rows satisfies it. Callers must
+// Close it.
+type Rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+// Store is everything the API and ingest need from the database.
+type Store interface {
+	Ping(ctx context.Context) error
+
+	// Vessels
+	CountVessels(ctx context.Context) (int, error)
+	ListVessels(ctx context.Context, f VesselFilter) ([]models.Vessel, error)
+	GetVessel(ctx context.Context, id int64) (*models.Vessel, error)
+	VesselVisible(ctx context.Context, id int64, includeArchived bool) (bool, error)
+	SetVesselArchived(ctx context.Context, id int64, archived bool) (*time.Time, error)
+	FindVesselByIMO(ctx context.Context, imo string) (int64, error)
+	CreateVessel(ctx context.Context, v models.Vessel) (int64, error)
+	UpdateVesselInfo(ctx context.Context, id int64, v models.Vessel) error
+	EditVessel(ctx context.Context, id int64, values map[string]*string, origin string, at time.Time) error
+	StreamLatest(ctx context.Context, vesselID int64) (map[string]time.Time, error)
+	SetStreamLatest(ctx context.Context, vesselID int64, stream string, ts time.Time) error
+	StreamVersions(ctx context.Context, vesselID int64) (map[string]StreamVersion, error)
+
+	// Uploads
+	FindUploadByHash(ctx context.Context, fileHash string) (int64, error)
+	CreateUpload(ctx context.Context, u models.Upload) (int64, error)
+	GetUpload(ctx context.Context, id int64) (*models.Upload, error)
+	AddUploadWarnings(ctx context.Context, uploadID int64, warnings []models.UploadWarning) error
+	UploadWarnings(ctx context.Context, uploadID, afterID int64, limit int) ([]models.UploadWarning, error)
+
+	// Readings
+	WriteReading(ctx context.Context, w ReadingWrite, upsert bool) (WriteResult, error)
+	QueryReadings(ctx context.Context, q ReadingQuery) (Rows, error)
+	LatestReading(ctx context.Context, q ReadingQuery) (*Reading, error)
+	ExportReadings(ctx context.Context, stream *Stream, vesselID int64, from, to *time.Time, sources SourceFilter) (Rows, error)
+	DailyCounts(ctx context.Context, stream *Stream, vesselID int64, from, to *time.Time) (map[string]int64, error)
+	SummarizeStream(ctx context.Context, stream *Stream, vesselID int64) (StreamSummary, error)
+	ProfileStream(ctx context.Context, stream *Stream, vesselID int64, from, to *time.Time, samples int) (int64, []FieldStats, error)
+	Positions(ctx context.Context, vesselID int64, from, to *time.Time) ([]ports.Fix, error)
+	GeneratorReadings(ctx context.Context, vesselID int64, from, to *time.Time) ([]gensets.Reading, error)
+	EngineRPMs(ctx context.Context, vesselID int64, from, to *time.Time) ([]utilization.EngineSample, error)
+	MetricSamples(ctx context.Context, stream *Stream, vesselID int64, metrics []string, unit interface{}, from, to *time.Time, sources SourceFilter) ([]UnitSamples, error)
+	ExtraSamples(ctx context.Context, stream *Stream, vesselID int64, key string, unit interface{}, from, to *time.Time, sources SourceFilter) ([]UnitSamples, error)
+	HoursWithData(ctx context.Context, stream *Stream, vesselID int64, from, to time.Time) (int, error)
+	PutDailySummary(ctx context.Context, d models.DailySummary) error
+	DailySummaries(ctx context.Context, vesselID int64, from, to string) ([]models.DailySummary, error)
+	BucketSeries(ctx context.Context, q SeriesQuery) ([]BucketStats, error)
+	LatestPerUnit(ctx context.Context, stream *Stream, vesselID int64) ([]Reading, error)
+	AggregateUnits(ctx context.Context, stream *Stream, vesselID int64, from, to *time.Time) ([]UnitStats, error)
+	RefreshRollups(ctx context.Context, stream *Stream, vesselID int64, from, to time.Time) error
+
+	LatestCameraStatuses(ctx context.Context, includeArchived bool) ([]models.CameraStatus, error)
+	PutCCTVSnapshot(ctx context.Context, vesselID int64, snapshot models.CCTVSnapshot) (int64, error)
+	LatestCCTVSnapshot(ctx context.Context, vesselID int64, camID string) (*models.CCTVSnapshot, error)
+	CCTVSnapshot(ctx context.Context, vesselID, id int64) (*models.CCTVSnapshot, error)
+
+	// Tank registry
+	Tanks(ctx context.Context, vesselID int64) ([]models.Tank, error)
+	PutTank(ctx context.Context, vesselID int64, t models.Tank) (bool, error)
+	DeleteTank(ctx context.Context, vesselID int64, tankNo int) error
+
+	// Engine registry
+	Engines(ctx context.Context, vesselID int64) ([]models.Engine, error)
+	PutEngine(ctx context.Context, vesselID int64, e models.Engine) (bool, error)
+	DeleteEngine(ctx context.Context, vesselID int64, engineNo int) error
+
+	// Sensor registry, filled as readings are written
+	Sensors(ctx context.Context, vesselID int64, stream string) ([]models.Sensor, error)
+	Sensor(ctx context.Context, vesselID, id int64) (*models.Sensor, error)
+	UpdateSensor(ctx context.Context, vesselID int64, sensor models.Sensor) error
+	SetSensorFilters(ctx context.Context, vesselID, id int64, filters []models.SensorFilter, at time.Time) error
+	RecentValues(ctx context.Context, stream *Stream, sensorID int64, field string, before time.Time, n int) ([]float64, error)
+	AddOutlier(ctx context.Context, o models.Outlier) error
+	Outliers(ctx context.Context, vesselID int64, stream string, from, to *time.Time) ([]models.Outlier, error)
+
+	// Custom streams, defined at runtime
+	CustomStreams(ctx context.Context) ([]models.CustomStream, error)
+	CustomStream(ctx context.Context, name string) (*models.CustomStream, error)
+	PutCustomStream(ctx context.Context, def models.CustomStream) (bool, error)
+	DeleteCustomStream(ctx context.Context, name string) error
+	CountCustomReadings(ctx context.Context, streamID int64) (int64, error)
+	WriteCustomReading(ctx context.Context, w CustomWrite, upsert bool) (WriteResult, error)
+	CustomReadings(ctx context.Context, q CustomQuery) ([]models.CustomReading, error)
+
+	// Header aliases, vessel-specific ones first
+	HeaderAliases(ctx context.Context) ([]models.HeaderAlias, error)
+	HeaderAlias(ctx context.Context, id int64) (*models.HeaderAlias, error)
+	CreateHeaderAlias(ctx context.Context, a models.HeaderAlias) (int64, error)
+	UpdateHeaderAlias(ctx context.Context, a models.HeaderAlias) error
+	DeleteHeaderAlias(ctx context.Context, id int64) error
+
+	// Validation rules
+	ValidationRules(ctx context.Context) ([]models.ValidationRule, error)
+	ValidationRule(ctx context.Context, id int64) (*models.ValidationRule, error)
+	CreateValidationRule(ctx context.Context, r models.ValidationRule) (int64, error)
+	UpdateValidationRule(ctx context.Context, r models.ValidationRule) error
+	DeleteValidationRule(ctx context.Context, id int64) error
+
+	// Alarms
+	RebuildAlarmEvents(ctx context.Context, vesselID int64, since time.Time) error
+	AlarmEvents(ctx context.Context, f AlarmFilter) ([]models.AlarmEvent, error)
+	RebuildFuelDropAlerts(ctx context.Context, vesselID int64, since time.Time, opts fueldrop.Options) ([]models.FuelDropAlert, error)
+	FuelDropAlerts(ctx context.Context, vesselID int64, from, to *time.Time) ([]models.FuelDropAlert, error)
+
+	// Running hours
+	RebuildRunningHours(ctx context.Context, vesselID int64, since time.Time) error
+	RebuildGeneratorRunningHours(ctx context.Context, vesselID int64, since time.Time) error
+	RunningHours(ctx context.Context, vesselID int64, engineNo *int, from, to string) ([]models.EngineRunningHours, error)
+
+	// Maintenance
+	MaintenanceItems(ctx context.Context, vesselIDs []int64) ([]models.MaintenanceItem, error)
+	MaintenanceItem(ctx context.Context, vesselID, id int64) (*models.MaintenanceItem, error)
+	CreateMaintenanceItem(ctx context.Context, item models.MaintenanceItem) (int64, error)
+	UpdateMaintenanceItem(ctx context.Context, item models.MaintenanceItem) error
+	DeleteMaintenanceItem(ctx context.Context, vesselID, id int64) error
+	EquipmentLog(ctx context.Context, f EquipmentLogFilter) ([]models.EquipmentLogEntry, error)
+	EquipmentLogEntry(ctx context.Context, vesselID, id int64) (*models.EquipmentLogEntry, error)
+	CreateEquipmentLogEntry(ctx context.Context, e models.EquipmentLogEntry) (int64, error)
+	UpdateEquipmentLogEntry(ctx context.Context, e models.EquipmentLogEntry) error
+	DeleteEquipmentLogEntry(ctx context.Context, vesselID, id int64) error
+
+	// Noon reports
+	NoonReports(ctx context.Context, f NoonReportFilter) ([]models.NoonReport, error)
+	PreviousNoonReport(ctx context.Context, vesselID int64, before time.Time) (*time.Time, error)
+	PutNoonReport(ctx context.Context, r models.NoonReport, upsert bool) (WriteResult, error)
+	SetNoonReconciliation(ctx context.Context, r models.NoonReport) error
+	FuelOnBoard(ctx context.Context, vesselID int64, at time.Time, maxAge time.Duration) (*float64, error)
+
+	// ISO 19848 data channels
+	DataChannelMappings(ctx context.Context, vesselID int64) ([]models.DataChannelMapping, error)
+	PutDataChannelMapping(ctx context.Context, vesselID int64, m models.DataChannelMapping) (bool, error)
+	DeleteDataChannelMapping(ctx context.Context, vesselID int64, channelID string) error
+	PutChannelReading(ctx context.Context, vesselID int64, r models.ChannelReading, upsert bool) (WriteResult, error)
+	ChannelReadings(ctx context.Context, f ChannelReadingFilter) ([]models.ChannelReading, error)
+	ChannelSummaries(ctx context.Context, vesselID int64) ([]models.ChannelSummary, error)
+
+	// Modbus registers
+	ModbusRegisters(ctx context.Context, vesselID int64) ([]models.ModbusRegister, error)
+	ModbusRegister(ctx context.Context, vesselID, id int64) (*models.ModbusRegister, error)
+	CreateModbusRegister(ctx context.Context, r models.ModbusRegister) (int64, error)
+	UpdateModbusRegister(ctx context.Context, r models.ModbusRegister) error
+	DeleteModbusRegister(ctx context.Context, vesselID, id int64) error
+	RecordModbusPoll(ctx context.Context, id int64, value *float64, at time.Time, pollErr *string) error
+
+	// SNMP devices
+	SNMPDevices(ctx context.Context, vesselID int64) ([]models.SNMPDevice, error)
+	SNMPDevice(ctx context.Context, vesselID, id int64) (*models.SNMPDevice, error)
+	CreateSNMPDevice(ctx context.Context, d models.SNMPDevice) (int64, error)
+	UpdateSNMPDevice(ctx context.Context, d models.SNMPDevice) error
+	DeleteSNMPDevice(ctx context.Context, vesselID, id int64) error
+	RecordSNMPPoll(ctx context.Context, id int64, status *string, uptimeHours *float64, at time.Time, pollErr *string) error
+
+	// ONVIF cameras
+	ONVIFCameras(ctx context.Context, vesselID int64) ([]models.ONVIFCamera, error)
+	ONVIFCamera(ctx context.Context, vesselID, id int64) (*models.ONVIFCamera, error)
+	CreateONVIFCamera(ctx context.Context, cam models.ONVIFCamera) (int64, error)
+	UpdateONVIFCamera(ctx context.Context, cam models.ONVIFCamera) error
+	DeleteONVIFCamera(ctx context.Context, vesselID, id int64) error
+	RecordONVIFPoll(ctx context.Context, id int64, poll models.ONVIFPoll) error
+
+	// Camera alerts
+	CameraAlerts(ctx context.Context, vesselID int64, openOnly bool) ([]models.CameraAlert, error)
+	RaiseCameraAlert(ctx context.Context, a models.CameraAlert) (bool, error)
+	ResolveCameraAlerts(ctx context.Context, vesselID int64, camID string, at time.Time) (int64, error)
+
+	// Quotas
+	QuotaOverride(ctx context.Context, vesselID int64) (models.QuotaPolicy, bool, error)
+	SetQuotaOverride(ctx context.Context, vesselID int64, policy models.QuotaPolicy) error
+	ClearQuotaOverride(ctx context.Context, vesselID int64) error
+	DailyUsage(ctx context.Context, vesselID int64, day string) (int, error)
+	AddDailyUsage(ctx context.Context, vesselID int64, day string, rows int) error
+	MarkQuotaAlerted(ctx context.Context, vesselID int64, day string, at time.Time) (bool, error)
+	QuotaAlerts(ctx context.Context, vesselID int64, limit int) ([]models.QuotaAlert, error)
+
+	// Scheduled reports and their send history
+	ReportSchedules(ctx context.Context) ([]models.ReportSchedule, error)
+	ReportSchedule(ctx context.Context, id int64) (*models.ReportSchedule, error)
+	CreateReportSchedule(ctx context.Context, rs models.ReportSchedule) (int64, error)
+	UpdateReportSchedule(ctx context.Context, rs models.ReportSchedule) error
+	DeleteReportSchedule(ctx context.Context, id int64) error
+	AddReportDelivery(ctx context.Context, d models.ReportDelivery) (int64, error)
+	ReportDeliveries(ctx context.Context, scheduleID int64, period string, limit int) ([]models.ReportDelivery, error)
+
+	// Report templates
+	ReportTemplates(ctx context.Context) ([]models.ReportTemplate, error)
+	ReportTemplate(ctx context.Context, name string) (*models.ReportTemplate, error)
+	PutReportTemplate(ctx context.Context, t models.ReportTemplate) (bool, error)
+	DeleteReportTemplate(ctx context.Context, name string) error
+
+	// Weather
+	WeatherReadings(ctx context.Context, vesselID int64, from, to *time.Time) ([]models.WeatherReading, error)
+	HourlyFuelWeather(ctx context.Context, vesselID int64, from, to *time.Time) ([]models.FuelWeatherHour, error)
+	QueueWeatherHours(ctx context.Context, due time.Time) error
+	DueWeatherHours(ctx context.Context, now time.Time, limit int) ([]weather.Pending, error)
+	PutWeather(ctx context.Context, p weather.Pending, cond weather.Conditions, raw json.RawMessage) error
+	RetryWeatherHour(ctx context.Context, p weather.Pending, attempts int, next time.Time, cause string) error
+
+	// Ports
+	ListPorts(ctx context.Context) ([]ports.Port, error)
+	ImportPorts(ctx context.Context, index []ports.Port) (int, error)
+	GetPort(ctx context.Context, code string) (*ports.Port, error)
+	DeletePort(ctx context.Context, code string) error
+	SeedPorts(ctx context.Context, index []ports.Port) error
+
+	// Reference data
+	ListReference(ctx context.Context, kind string) ([]reference.Entry, error)
+	GetReference(ctx context.Context, kind, code string) (*reference.Entry, error)
+	PutReference(ctx context.Context, kind string, e reference.Entry) (bool, error)
+	DeleteReference(ctx context.Context, kind, code string) error
+	SeedReference(ctx context.Context, data map[string][]reference.Entry) error
+
+	// Export watermarks
+	CreateExportWatermark(ctx context.Context, r watermark.Record) error
+	CompleteExportWatermark(ctx context.Context, m watermark.Manifest, at time.Time) error
+	GetExportWatermark(ctx context.Context, id string) (*watermark.Record, error)
+
+	// Audit log
+	AppendAudit(ctx context.Context, e audit.Entry) (audit.Entry, error)
+	AuditEntries(ctx context.Context, f AuditFilter) ([]audit.Entry, error)
+	VerifyAudit(ctx context.Context, vesselID *int64) (*audit.Checker, ReadingCheck, error)
+
+	// Change data capture
+	Changes(ctx context.Context, afterSeq int64, limit int) ([]Change, int64, error)
+	PruneChanges(ctx context.Context, before time.Time, maxSeq int64) (int64, error)
+
+	// extra_json payloads shared by readings
+	PruneExtraPayloads(ctx context.Context, now time.Time) (int64, error)
+
+	// Transactional outbox of webhooks and reading sinks
+	OutboxEvents(ctx context.Context, afterSeq int64, streams []string, limit int) ([]OutboxEvent, error)
+	OutboxHead(ctx context.Context) (int64, error)
+	OutboxCursor(ctx context.Context, consumer string) (int64, error)
+	SetOutboxCursor(ctx context.Context, consumer string, seq int64, at time.Time) error
+	PruneOutbox(ctx context.Context, consumers []string) (int64, error)
+
+	// Edge-to-shore replication
+	ReplicationCursors(ctx context.Context) (map[string]int64, error)
+	SetReplicationCursor(ctx context.Context, stream string, lastID int64, at time.Time) error
+	PendingReplication(ctx context.Context) (map[string]int64, error)
+	ReplicationUsage(ctx context.Context, windowStart time.Time) (int64, error)
+	AddReplicationUsage(ctx context.Context, windowStart time.Time, bytes int64) error
+	ReadingsAfter(ctx context.Context, stream string, afterID int64, limit int) ([]Reading, error)
+	UpdatesAfter(ctx context.Context, stream string, afterSeq int64, limit int) ([]Change, int64, error)
+	UploadsAfter(ctx context.Context, afterID int64, limit int) ([]models.Upload, error)
+	ReplicaVessel(ctx context.Context, edge string, edgeVesselID int64) (int64, error)
+	SetReplicaVessel(ctx context.Context, edge string, edgeVesselID, vesselID int64) error
+	ReplicaVessels(ctx context.Context, edge string) (map[int64]int64, error)
+	MergeVesselField(ctx context.Context, f VesselField) (bool, error)
+	VesselFieldsAfter(ctx context.Context, afterSeq int64, vesselIDs []int64, limit int) ([]VesselField, error)
+
+	// S3 bucket ingest
+	BucketObject(ctx context.Context, bucket, key string) (*models.BucketObject, error)
+	PutBucketObject(ctx context.Context, o models.BucketObject) error
+	BucketObjects(ctx context.Context, bucket, status string, limit int) ([]models.BucketObject, error)
+
+	// Resumable chunked uploads
+	CreateChunkedUpload(ctx context.Context, u models.ChunkedUpload) error
+	ChunkedUpload(ctx context.Context, id string) (*models.ChunkedUpload, error)
+	AdvanceChunkedUpload(ctx context.Context, id string, from, to int64, expiresAt time.Time) (bool, error)
+	DeleteChunkedUpload(ctx context.Context, id string) error
+	ExpiredChunkedUploads(ctx context.Context, now time.Time) ([]string, error)
+
+	// Replication
+	Snapshot(ctx context.Context, path string) error
+	Restore(ctx context.Context, path string) error
+}
+
+// SQLStore implements Store on SQLite.
+type SQLStore struct {
+	db      *sql.DB
+	chained map[string]*Stream // by table, see ChainStreams
+	latest  streamLatest
+}
+
+var _ Store = (*SQLStore)(nil)
+
+func New(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func (s *SQLStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// timeRange appends optional ts bounds to a query.
+func timeRange(query string, args []interface{}, from, to *time.Time) (string, []interface{}) {
+	if from != nil {
+		query += " AND ts >= ?"
+		args = append(args, *from)
+	}
+	if to != nil {
+		query += " AND ts <= ?"
+		args = append(args, *to)
+	}
+	return query, args
+}
+
+// parseTime parses a DATETIME that lost its column type, e.g. the result of
+// MIN(ts), which the driver returns as text. NULL parses to nil.
+func parseTime(s sql.NullString) (*time.Time, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	value := strings.TrimSuffix(s.String, "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid timestamp %q", s.String)
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+	for _, s := range []string{
+		"2025-08-08 10:00:00+00:00",
+		"2025-08-08 12:00:00+02:00",
+		"2025-08-08T10:00:00Z",
+		"2025-08-08 10:00:00",
+	} {
+		got, err := parseTime(sql.NullString{String: s, Valid: true})
+		if err != nil || got == nil || !got.Equal(want) {
+			t.Errorf("%s: expected %s, got %v (%v)", s, want, got, err)
+		}
+	}
+
+	if got, err := parseTime(sql.NullString{}); err != nil || got != nil {
+		t.Errorf("Expected nil for NULL, got %v (%v)", got, err)
+	}
+	if _, err := parseTime(sql.NullString{String: "yesterday", Valid: true}); err == nil {
+		t.Error("Expected an error for an invalid timestamp")
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`50%_off\`); got != `50\%\_off\\` {
+		t.Errorf("Unexpected escaped pattern %q", got)
+	}
+}
+
+func TestStreamKinds(t *testing.T) {
+	for name, stream := range Streams {
+		if (stream.Kind == "") != (stream.Unit == "") {
+			t.Errorf("%s: streams with units must name their kind", name)
+		}
+	}
+}
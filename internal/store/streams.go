@@ -0,0 +1,354 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+)
+
+// FieldKind is the SQL type of a stream column, used to pick the scan target.
+type FieldKind int
+
+const (
+	IntField FieldKind = iota
+	FloatField
+	TextField
+)
+
+type Field struct {
+	Name string
+	Kind FieldKind
+}
+
+// Stream describes where a telemetry stream lives and which of its columns
+// carry measured values (as opposed to bookkeeping columns). Every stream
+// ends with source, see models.ReadingSources. Adding a stream takes a new
+// entry in Streams and StreamOrder and its table in the schema; change
+// capture, the sensor registry and workbook ingest are derived from them.
+type Stream struct {
+	Name   string
+	Table  string
+	Unit   string // column identifying the unit (engine, tank...), empty if none; must be Fields[0]
+	Kind   string // what a unit is, e.g. tank; units are registered as sensors
+	Fields []Field
+	// Uncertain lists the metrics the reading's uncertainty_percent applies
+	// to; streams without one have no such column.
+	Uncertain []string
+	// Origin is set for streams with an origin column, naming the system
+	// synced readings came from (see models.OriginAIS).
+	Origin bool
+}
+
+var Streams = map[string]*Stream{
+	"engines": {Name: "engines", Table: "engine_readings", Unit: "engine_no", Kind: "engine", Fields: []Field{
+		{"engine_no", IntField}, {"rpm", FloatField}, {"temp_c", FloatField}, {"oil_pressure_bar", FloatField}, {"alarms", TextField}, {"source", TextField},
+	}},
+	"fuel": {Name: "fuel", Table: "fuel_tank_readings", Unit: "tank_no", Kind: "tank", Fields: []Field{
+		{"tank_no", IntField}, {"level_percent", FloatField}, {"volume_liters", FloatField}, {"temp_c", FloatField},
+		{"uncertainty_percent", FloatField}, {"source", TextField},
+	}, Uncertain: []string{"level_percent", "volume_liters"}},
+	"generators": {Name: "generators", Table: "generator_readings", Unit: "gen_no", Kind: "generator", Fields: []Field{
+		{"gen_no", IntField}, {"load_kw", FloatField}, {"voltage_v", FloatField}, {"frequency_hz", FloatField}, {"fuel_rate_lph", FloatField},
+		{"uncertainty_percent", FloatField}, {"source", TextField},
+	}, Uncertain: []string{"fuel_rate_lph"}},
+	"cctv": {Name: "cctv", Table: "cctv_status_readings", Unit: "cam_id", Kind: "camera", Fields: []Field{
+		{"cam_id", TextField}, {"status", TextField}, {"uptime_percent", FloatField}, {"source", TextField},
+	}},
+	"impact": {Name: "impact", Table: "impact_vibration_readings", Unit: "sensor_id", Kind: "impact_sensor", Fields: []Field{
+		{"sensor_id", TextField}, {"accel_g", FloatField}, {"shock_g", FloatField}, {"notes", TextField}, {"source", TextField},
+	}},
+	"bilge": {Name: "bilge", Table: "bilge_ballast_readings", Unit: "tank_id", Kind: "water_tank", Fields: []Field{
+		{"tank_id", TextField}, {"level_percent", FloatField}, {"volume_m3", FloatField}, {"pump_status", TextField}, {"alarm", TextField},
+		{"source", TextField},
+	}},
+	"navigation": {Name: "navigation", Table: "navigation_readings", Fields: []Field{
+		{"heading_degrees", FloatField}, {"rudder_angle_degrees", FloatField}, {"rot_degrees_per_min", FloatField},
+		{"depth_under_keel_m", FloatField}, {"source", TextField},
+	}},
+	"met": {Name: "met", Table: "met_readings", Fields: []Field{
+		{"wind_speed_knots", FloatField}, {"wind_direction_deg", FloatField}, {"air_temp_c", FloatField}, {"pressure_hpa", FloatField},
+		{"sea_state", IntField}, {"source", TextField},
+	}},
+	"power": {Name: "power", Table: "power_readings", Unit: "bank_id", Kind: "battery", Fields: []Field{
+		{"bank_id", TextField}, {"shore_status", TextField}, {"shore_kw", FloatField}, {"soc_percent", FloatField},
+		{"battery_kw", FloatField}, {"source", TextField},
+	}},
+	"network_device": {Name: "network_device", Table: "network_device_readings", Unit: "device_id", Kind: "network_device", Fields: []Field{
+		{"device_id", TextField}, {"device_type", TextField}, {"status", TextField}, {"uptime_hours", FloatField},
+		{"availability_percent", FloatField}, {"source", TextField},
+	}},
+	"location": {Name: "location", Table: "location_readings", Fields: []Field{
+		{"latitude", FloatField}, {"longitude", FloatField}, {"course_degrees", FloatField}, {"speed_knots", FloatField},
+		{"status", TextField}, {"source", TextField},
+	}, Origin: true},
+}
+
+// StreamOrder lists the streams in a stable order for responses that cover
+// every stream.
+var StreamOrder = []string{"engines", "fuel", "generators", "cctv", "impact", "bilge", "navigation", "met", "power", "network_device", "location"}
+
+// The schema captures changes of every stream's table and registers the
+// units of streams that have them.
+func init() {
+	for name, stream := range Streams {
+		db.CDCTables[name] = stream.Table
+		if stream.Unit != "" {
+			db.SensorUnits[name] = stream.Unit
+		}
+	}
+}
+
+// FieldNames returns the measured columns in definition order.
+func (s *Stream) FieldNames() []string {
+	names := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Field returns the measured column called name.
+func (s *Stream) Field(name string) (Field, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// IsMetric reports whether name is a numeric measured column that can be
+// aggregated. The unit column and uncertainty_percent are not metrics.
+func (s *Stream) IsMetric(name string) bool {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f.Kind != TextField && f.Name != s.Unit && f.Name != "uncertainty_percent"
+		}
+	}
+	return false
+}
+
+// HasUncertainty reports whether readings can carry an uncertainty estimate
+// of the metric.
+func (s *Stream) HasUncertainty(metric string) bool {
+	for _, m := range s.Uncertain {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseUnit converts a unit filter value (e.g. ?engine_no=2) to the unit
+// column's type. It reports false for streams without units and for values
+// that do not parse for numeric units.
+func (s *Stream) ParseUnit(value string) (interface{}, bool) {
+	if s.Unit == "" || value == "" {
+		return nil, false
+	}
+	if s.Fields[0].Kind == IntField {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, false
+		}
+		return n, true
+	}
+	return value, true
+}
+
+// unitNullKey stands in for a NULL integer unit in unit sort keys, so NULL
+// units sort first and keyset comparisons never meet NULL.
+const unitNullKey = math.MinInt64
+
+// unitSortExpr is the SQL readings are ordered by when sorted by unit.
+func (s *Stream) unitSortExpr() string {
+	if s.Fields[0].Kind == IntField {
+		return fmt.Sprintf("COALESCE(%s, %d)", s.Unit, int64(unitNullKey))
+	}
+	return "COALESCE(" + s.Unit + ", '')"
+}
+
+// UnitSortKey returns the sort key of a reading's unit value (Values[0]) for
+// ReadingQuery.AfterUnit.
+func (s *Stream) UnitSortKey(unit interface{}) interface{} {
+	if unit != nil {
+		return unit
+	}
+	if s.Fields[0].Kind == IntField {
+		return int64(unitNullKey)
+	}
+	return ""
+}
+
+// ParseUnitSortKey reverses fmt.Sprint of a UnitSortKey, e.g. from a cursor.
+func (s *Stream) ParseUnitSortKey(value string) (interface{}, error) {
+	if s.Unit == "" {
+		return nil, fmt.Errorf("stream %s has no units", s.Name)
+	}
+	if s.Fields[0].Kind == IntField {
+		return strconv.ParseInt(value, 10, 64)
+	}
+	return value, nil
+}
+
+// selectReadings starts a query for a vessel's full reading rows, in the
+// column order ScanReading expects. Callers append further conditions.
+func (s *Stream) selectReadings(vesselID int64) (string, []interface{}) {
+	return s.readingColumns() + " WHERE vessel_id = ?", []interface{}{vesselID}
+}
+
+// readingColumns is the SELECT ... FROM part of selectReadings.
+func (s *Stream) readingColumns() string {
+	return "SELECT id, vessel_id, ts, " + strings.Join(s.FieldNames(), ", ") +
+		", row_hash, " + extraJSONColumn("") + ", created_at FROM " + s.Table
+}
+
+// ReadingKeys returns the keys of the stream's readings, in the order they
+// are marshalled.
+func (s *Stream) ReadingKeys() []string {
+	keys := []string{"id", "vessel_id"}
+	fields := s.FieldNames()
+	if s.Unit != "" {
+		keys, fields = append(keys, fields[0]), fields[1:]
+	}
+	keys = append(keys, "ts")
+	keys = append(keys, fields...)
+	return append(keys, "row_hash", "extra_json", "created_at")
+}
+
+// Reading is one row of any stream. It marshals to a flat object: id,
+// vessel_id, unit, ts, fields, row_hash, extra_json, created_at.
+type Reading struct {
+	stream    *Stream
+	ID        int64
+	VesselID  int64
+	Timestamp time.Time
+	Values    []interface{} // nil, int64, float64 or string, in stream.Fields order
+	RowHash   string
+	ExtraJSON json.RawMessage
+	CreatedAt time.Time
+
+	keys map[string]bool // marshalled keys, nil for all
+}
+
+// Select returns the reading marshalling only the keys given, which should
+// be among the stream's ReadingKeys.
+func (r Reading) Select(keys []string) Reading {
+	r.keys = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		r.keys[key] = true
+	}
+	return r
+}
+
+// Get returns the value of one of the reading's keys.
+func (r Reading) Get(key string) (interface{}, bool) {
+	switch key {
+	case "id":
+		return r.ID, true
+	case "vessel_id":
+		return r.VesselID, true
+	case "ts":
+		return r.Timestamp, true
+	case "row_hash":
+		return r.RowHash, true
+	case "extra_json":
+		return r.ExtraJSON, true
+	case "created_at":
+		return r.CreatedAt, true
+	}
+	for i, f := range r.stream.Fields {
+		if f.Name == key {
+			return r.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// NewReading builds a reading of the stream, e.g. for fake stores in tests.
+func NewReading(stream *Stream, id, vesselID int64, ts time.Time, values ...interface{}) Reading {
+	return Reading{stream: stream, ID: id, VesselID: vesselID, Timestamp: ts, Values: values}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ScanReading scans a row returned by QueryReadings.
+func (s *Stream) ScanReading(row rowScanner) (Reading, error) {
+	r := Reading{stream: s, Values: make([]interface{}, len(s.Fields))}
+
+	targets := make([]interface{}, len(s.Fields))
+	for i, f := range s.Fields {
+		switch f.Kind {
+		case IntField:
+			targets[i] = &sql.NullInt64{}
+		case FloatField:
+			targets[i] = &sql.NullFloat64{}
+		default:
+			targets[i] = &sql.NullString{}
+		}
+	}
+
+	dest := append([]interface{}{&r.ID, &r.VesselID, &r.Timestamp}, targets...)
+	dest = append(dest, &r.RowHash, &r.ExtraJSON, &r.CreatedAt)
+	if err := row.Scan(dest...); err != nil {
+		return r, err
+	}
+
+	for i, target := range targets {
+		switch v := target.(type) {
+		case *sql.NullInt64:
+			if v.Valid {
+				r.Values[i] = v.Int64
+			}
+		case *sql.NullFloat64:
+			if v.Valid {
+				r.Values[i] = v.Float64
+			}
+		case *sql.NullString:
+			if v.Valid {
+				r.Values[i] = v.String
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r Reading) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	write := func(key string, v interface{}) {
+		if err != nil {
+			return
+		}
+		var data []byte
+		if data, err = json.Marshal(v); err != nil {
+			return
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%q:", key)
+		buf.Write(data)
+	}
+
+	// The unit column comes before ts, as in the per-stream models
+	buf.WriteByte('{')
+	for _, key := range r.stream.ReadingKeys() {
+		if r.keys != nil && !r.keys[key] {
+			continue
+		}
+		v, _ := r.Get(key)
+		write(key, v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), err
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestReadingJSON(t *testing.T) {
+	ts := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+	reading := NewReading(Streams["cctv"], 7, 1, ts, "bridgeCam1", "active", nil, "sensor")
+	reading.RowHash = "abc"
+	reading.ExtraJSON = json.RawMessage(`{"a":"1"}`)
+	reading.CreatedAt = ts.Add(5 * time.Minute)
+
+	data, err := json.Marshal(reading)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The unit comes before ts, matching the per-stream models
+	want := `{"id":7,"vessel_id":1,"cam_id":"bridgeCam1","ts":"2025-08-08T10:00:00Z","status":"active","uptime_percent":null,"source":"sensor",` +
+		`"row_hash":"abc","extra_json":{"a":"1"},"created_at":"2025-08-08T10:05:00Z"}`
+	if string(data) != want {
+		t.Errorf("Unexpected JSON:\n got %s\nwant %s", data, want)
+	}
+}
+
+func TestReadingSelect(t *testing.T) {
+	ts := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+	reading := NewReading(Streams["cctv"], 7, 1, ts, "bridgeCam1", "active", nil, "sensor")
+
+	// Keys keep the stream's order, whatever the order asked for
+	data, err := json.Marshal(reading.Select([]string{"status", "ts", "cam_id"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"cam_id":"bridgeCam1","ts":"2025-08-08T10:00:00Z","status":"active"}`; string(data) != want {
+		t.Errorf("Unexpected JSON:\n got %s\nwant %s", data, want)
+	}
+	if v, ok := reading.Get("status"); !ok || v != "active" {
+		t.Errorf("Unexpected status %v %v", v, ok)
+	}
+	if _, ok := reading.Get("rpm"); ok {
+		t.Error("Expected no rpm on a cctv reading")
+	}
+}
+
+func TestStreamUnitIsFirstField(t *testing.T) {
+	for name, stream := range Streams {
+		if stream.Name != name {
+			t.Errorf("%s: stream is named %s", name, stream.Name)
+		}
+		if stream.Unit != "" && stream.Fields[0].Name != stream.Unit {
+			t.Errorf("%s: unit %s must be the first field", name, stream.Unit)
+		}
+		if last := stream.Fields[len(stream.Fields)-1]; last.Name != "source" {
+			t.Errorf("%s: source must be the last field, got %s", name, last.Name)
+		}
+		_, hasColumn := stream.Field("uncertainty_percent")
+		if hasColumn != (len(stream.Uncertain) > 0) {
+			t.Errorf("%s: uncertainty_percent column and Uncertain metrics must come together", name)
+		}
+		for _, m := range stream.Uncertain {
+			if !stream.IsMetric(m) {
+				t.Errorf("%s: uncertain %s is not a metric", name, m)
+			}
+		}
+	}
+	if len(StreamOrder) != len(Streams) {
+		t.Errorf("StreamOrder lists %d streams, Streams has %d", len(StreamOrder), len(Streams))
+	}
+}
+
+func TestParseUnit(t *testing.T) {
+	if v, ok := Streams["engines"].ParseUnit("2"); !ok || v != 2 {
+		t.Errorf("Expected engine 2, got %v", v)
+	}
+	if _, ok := Streams["engines"].ParseUnit("two"); ok {
+		t.Error("Expected non-numeric engine number to be ignored")
+	}
+	if v, ok := Streams["cctv"].ParseUnit("deckCam1"); !ok || v != "deckCam1" {
+		t.Errorf("Expected camera id, got %v", v)
+	}
+	if _, ok := Streams["location"].ParseUnit("1"); ok {
+		t.Error("Expected location to have no unit")
+	}
+}
+
+func TestIsMetric(t *testing.T) {
+	fuel := Streams["fuel"]
+	if !fuel.IsMetric("volume_liters") {
+		t.Error("Expected volume_liters to be a metric")
+	}
+	if fuel.IsMetric("tank_no") {
+		t.Error("Expected the unit column not to be a metric")
+	}
+	if fuel.IsMetric("row_hash") || fuel.IsMetric("bogus") {
+		t.Error("Expected non-field columns not to be metrics")
+	}
+	if fuel.IsMetric("uncertainty_percent") {
+		t.Error("Expected uncertainty_percent not to be a metric")
+	}
+	if Streams["cctv"].IsMetric("status") {
+		t.Error("Expected text fields not to be metrics")
+	}
+}
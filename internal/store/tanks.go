@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// Tanks returns the vessel's registered tanks by tank number.
+func (s *SQLStore) Tanks(ctx context.Context, vesselID int64) ([]models.Tank, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT tank_no, name, capacity_liters, fuel_type, updated_at FROM tanks WHERE vessel_id = ? ORDER BY tank_no", vesselID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tanks := []models.Tank{}
+	for rows.Next() {
+		var t models.Tank
+		if err := rows.Scan(&t.TankNo, &t.Name, &t.CapacityLiters, &t.FuelType, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		t.UpdatedAt = t.UpdatedAt.UTC()
+		tanks = append(tanks, t)
+	}
+	return tanks, rows.Err()
+}
+
+// PutTank registers or replaces a tank as of t.UpdatedAt and reports whether
+// it is new.
+func (s *SQLStore) PutTank(ctx context.Context, vesselID int64, t models.Tank) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE tanks SET name = ?, capacity_liters = ?, fuel_type = ?, updated_at = ?
+		WHERE vessel_id = ? AND tank_no = ?`, t.Name, t.CapacityLiters, t.FuelType, t.UpdatedAt, vesselID, t.TankNo)
+	if err != nil {
+		return false, err
+	}
+	created := false
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO tanks (vessel_id, tank_no, name, capacity_liters, fuel_type, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			vesselID, t.TankNo, t.Name, t.CapacityLiters, t.FuelType, t.UpdatedAt); err != nil {
+			return false, err
+		}
+		created = true
+	}
+	return created, tx.Commit()
+}
+
+// DeleteTank removes a tank from the registry.
+func (s *SQLStore) DeleteTank(ctx context.Context, vesselID int64, tankNo int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM tanks WHERE vessel_id = ? AND tank_no = ?", vesselID, tankNo)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// DefaultWeightMaxGap is the longest time one reading stands for in a
+// time-weighted average, unless SeriesQuery.MaxGap says otherwise.
+const DefaultWeightMaxGap = time.Hour
+
+// weightedBucket accumulates the time-weighted values of one vessel's bucket.
+type weightedBucket struct {
+	weight         float64 // seconds
+	sum            float64
+	uncertaintySum float64
+}
+
+// weightedSample is a reading waiting for the next one of its unit, which
+// settles how long it stands for.
+type weightedSample struct {
+	vesselID    int64
+	unit        interface{}
+	ts          time.Time
+	value       float64
+	uncertainty float64
+}
+
+// timeWeighter weighs each reading by the time until the next reading of
+// the same vessel and unit, capped at maxGap so a logging outage does not
+// make one reading stand for hours. A unit's last reading stands for as long
+// as the one before it, its only reading for maxGap. Readings must come
+// ordered by vessel, unit and time; each counts in its own bucket of secs
+// seconds, or in one bucket per vessel if secs is 0.
+type timeWeighter struct {
+	secs    int64
+	maxGap  time.Duration
+	buckets map[[2]int64]*weightedBucket
+	pending *weightedSample
+	// last is how long the pending reading's predecessor stood for, 0 if
+	// it has none
+	last time.Duration
+}
+
+func newTimeWeighter(secs int64, maxGap time.Duration) *timeWeighter {
+	return &timeWeighter{secs: secs, maxGap: maxGap, buckets: make(map[[2]int64]*weightedBucket)}
+}
+
+func (w *timeWeighter) add(s weightedSample) {
+	if p := w.pending; p != nil {
+		if p.vesselID == s.vesselID && p.unit == s.unit {
+			d := s.ts.Sub(p.ts)
+			if d > w.maxGap {
+				d = w.maxGap
+			}
+			w.settle(d)
+			w.last = d
+		} else {
+			w.flush()
+		}
+	}
+	w.pending = &s
+}
+
+// flush settles the pending reading as the last of its unit.
+func (w *timeWeighter) flush() {
+	if w.pending == nil {
+		return
+	}
+	d := w.maxGap
+	if w.last > 0 {
+		d = w.last
+	}
+	w.settle(d)
+	w.pending, w.last = nil, 0
+}
+
+func (w *timeWeighter) settle(d time.Duration) {
+	p := w.pending
+	key := [2]int64{p.vesselID, 0}
+	if w.secs > 0 {
+		key[1] = p.ts.Unix() / w.secs * w.secs
+	}
+	b := w.buckets[key]
+	if b == nil {
+		b = &weightedBucket{}
+		w.buckets[key] = b
+	}
+	weight := d.Seconds()
+	b.weight += weight
+	b.sum += p.value * weight
+	b.uncertaintySum += p.uncertainty * weight
+}
+
+// weightedBuckets weighs the readings of a series query by time, keyed by
+// vessel and bucket start like seriesTotals.
+func (s *SQLStore) weightedBuckets(ctx context.Context, q SeriesQuery, secs int64) (map[[2]int64]*weightedBucket, error) {
+	maxGap := q.MaxGap
+	if maxGap <= 0 {
+		maxGap = DefaultWeightMaxGap
+	}
+	unit := "NULL"
+	if q.Stream.Unit != "" {
+		unit = q.Stream.Unit
+	}
+	uncertainty := "0"
+	if q.Stream.HasUncertainty(q.Metric) {
+		uncertainty = "ABS(" + q.Metric + ") * COALESCE(uncertainty_percent, 0) / 100"
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(q.VesselIDs)), ", ")
+	query := `SELECT vessel_id, ` + unit + `, ts, ` + q.Metric + `, ` + uncertainty + `
+		FROM ` + q.Stream.Table + `
+		WHERE vessel_id IN (` + placeholders + `) AND ` + q.Metric + ` IS NOT NULL`
+	args := make([]interface{}, 0, len(q.VesselIDs))
+	for _, id := range q.VesselIDs {
+		args = append(args, id)
+	}
+	if q.Unit != nil {
+		query += " AND " + q.Stream.Unit + " = ?"
+		args = append(args, q.Unit)
+	}
+	query, args = timeRange(query, args, q.From, q.To)
+	query, args = q.Sources.apply(q.Stream, query, args)
+	query += " ORDER BY vessel_id, " + unit + ", ts, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	w := newTimeWeighter(secs, maxGap)
+	for rows.Next() {
+		var sample weightedSample
+		var unitValue sql.NullString
+		if err := rows.Scan(&sample.vesselID, &unitValue, &sample.ts, &sample.value, &sample.uncertainty); err != nil {
+			return nil, err
+		}
+		if unitValue.Valid {
+			sample.unit = unitValue.String
+		}
+		w.add(sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	w.flush()
+	return w.buckets, nil
+}
+
+// TimedValue is a value logged at TS.
+type TimedValue struct {
+	TS    time.Time
+	Value float64
+}
+
+// TimeWeightedMean weighs each value by the time until the next, capped at
+// maxGap, the way time-weighted averages of readings are. Values must be
+// ordered by time; it returns nil for none.
+func TimeWeightedMean(values []TimedValue, maxGap time.Duration) *float64 {
+	w := newTimeWeighter(0, maxGap)
+	for _, v := range values {
+		w.add(weightedSample{ts: v.TS, value: v.Value})
+	}
+	w.flush()
+	return w.mean(0)
+}
+
+// mean returns the time-weighted average of the vessel's single bucket, nil
+// if it has no weight.
+func (w *timeWeighter) mean(vesselID int64) *float64 {
+	b := w.buckets[[2]int64{vesselID, 0}]
+	if b == nil || b.weight == 0 {
+		return nil
+	}
+	avg := b.sum / b.weight
+	return &avg
+}
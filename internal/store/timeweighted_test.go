@@ -0,0 +1,53 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWeighter(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2025, 8, 8, hour, minute, 0, 0, time.UTC) }
+	day := at(0, 0).Unix()
+	w := newTimeWeighter(24*3600, time.Hour)
+	for _, s := range []weightedSample{
+		// Tank 1 logs every 45 minutes, then every 15
+		{vesselID: 1, unit: "1", ts: at(0, 0), value: 300},
+		{vesselID: 1, unit: "1", ts: at(0, 45), value: 100},
+		{vesselID: 1, unit: "1", ts: at(1, 0), value: 100},
+		// A logging outage counts for an hour at most
+		{vesselID: 1, unit: "2", ts: at(2, 0), value: 10},
+		{vesselID: 1, unit: "2", ts: at(8, 0), value: 40},
+		// Another vessel's only reading
+		{vesselID: 2, unit: "1", ts: at(3, 0), value: 5, uncertainty: 0.5},
+	} {
+		w.add(s)
+	}
+	w.flush()
+
+	// 300*45m + 100*15m + 100*15m (as long as the reading before), then
+	// 10*60m + 40*60m
+	b := w.buckets[[2]int64{1, day}]
+	if b == nil || b.weight != 195*60 || b.sum != (300*45+100*15+100*15+10*60+40*60)*60 {
+		t.Errorf("Unexpected vessel 1 bucket %+v", b)
+	}
+	if b := w.buckets[[2]int64{2, day}]; b == nil || b.weight != 3600 || b.sum/b.weight != 5 || b.uncertaintySum/b.weight != 0.5 {
+		t.Errorf("Expected vessel 2's reading to stand for an hour, got %+v", b)
+	}
+}
+
+func TestTimeWeightedMean(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2025, 8, 8, 0, minute, 0, 0, time.UTC) }
+	if TimeWeightedMean(nil, time.Hour) != nil {
+		t.Error("Expected no mean without values")
+	}
+	// 10 for 30 minutes, 20 for 10, and 20 again for as long
+	avg := TimeWeightedMean([]TimedValue{{at(0), 10}, {at(30), 20}, {at(40), 20}}, time.Hour)
+	if avg == nil || *avg != 14 {
+		t.Errorf("Expected 14, got %v", avg)
+	}
+	// A gap counts for max_gap at most
+	avg = TimeWeightedMean([]TimedValue{{at(0), 10}, {at(600), 40}}, 15*time.Minute)
+	if avg == nil || *avg != 25 {
+		t.Errorf("Expected 25, got %v", avg)
+	}
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/audit"
+)
+
+// VesselFields are the vessel metadata fields that can be edited, and that
+// are replicated both ways between an edge and the central API. The IMO
+// number identifies a vessel across instances and is not edited.
+var VesselFields = []string{"name", "mmsi", "flag", "type", "fleet"}
+
+// ValidVesselField reports whether field is one of VesselFields.
+func ValidVesselField(field string) bool {
+	for _, f := range VesselFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// VesselField is the last write of one metadata field of a vessel: its
+// value, when and by which instance it was written. Seq orders the writes
+// on the instance holding them.
+type VesselField struct {
+	VesselID  int64     `json:"vessel_id"`
+	Field     string    `json:"field"`
+	Value     *string   `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Origin    string    `json:"origin"`
+	Seq       int64     `json:"seq"`
+}
+
+// Supersedes reports whether f wins over g: the later write or, written at
+// the same time, that of the greater origin, so every instance picks the
+// same.
+func (f VesselField) Supersedes(g VesselField) bool {
+	if !f.UpdatedAt.Equal(g.UpdatedAt) {
+		return f.UpdatedAt.After(g.UpdatedAt)
+	}
+	return f.Origin > g.Origin
+}
+
+// EditVessel sets metadata fields of a vessel, written by origin at at. An
+// edit always wins: should the last write of a field be stamped later (by
+// an instance whose clock is ahead), the edit is stamped just after it.
+func (s *SQLStore) EditVessel(ctx context.Context, id int64, values map[string]*string, origin string, at time.Time) error {
+	for field := range values {
+		if !ValidVesselField(field) {
+			return fmt.Errorf("unknown vessel field %q", field)
+		}
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, field := range VesselFields {
+		value, ok := values[field]
+		if !ok {
+			continue
+		}
+		current, err := vesselField(ctx, tx, id, field)
+		if err != nil {
+			return err
+		}
+		f := VesselField{VesselID: id, Field: field, Value: value, UpdatedAt: at, Origin: origin}
+		if !f.Supersedes(current) {
+			f.UpdatedAt = current.UpdatedAt.Add(time.Nanosecond)
+		}
+		if err := writeVesselField(ctx, tx, f); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MergeVesselField applies a write replicated from another instance if it
+// supersedes the stored one, and reports whether it did. When the two came
+// from different instances with different values, the one overwritten or
+// discarded is kept in the audit log as a vessel.sync entry.
+func (s *SQLStore) MergeVesselField(ctx context.Context, f VesselField) (bool, error) {
+	if !ValidVesselField(f.Field) {
+		return false, fmt.Errorf("unknown vessel field %q", f.Field)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	current, err := vesselField(ctx, tx, f.VesselID, f.Field)
+	if err != nil {
+		return false, err
+	}
+	if current.UpdatedAt.Equal(f.UpdatedAt) && current.Origin == f.Origin {
+		return false, nil // seen already
+	}
+	kept, lost := current, f
+	applied := f.Supersedes(current)
+	if applied {
+		kept, lost = f, current
+		if err := writeVesselField(ctx, tx, f); err != nil {
+			return false, err
+		}
+	}
+
+	if current.Origin != "" && current.Origin != f.Origin && !sameValue(current.Value, f.Value) {
+		kept.Seq, lost.Seq = 0, 0
+		detail, err := json.Marshal(map[string]VesselField{"kept": kept, "overwritten": lost})
+		if err != nil {
+			return false, err
+		}
+		vesselID := f.VesselID
+		_, err = appendAuditEntry(ctx, tx, audit.Entry{
+			Kind:     audit.KindAudit,
+			Action:   "vessel.sync",
+			Actor:    "replication:" + kept.Origin,
+			VesselID: &vesselID,
+			Subject:  fmt.Sprintf("vessels/%d/%s", f.VesselID, f.Field),
+			Digest:   audit.Digest(string(detail)),
+			Detail:   string(detail),
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return applied, tx.Commit()
+}
+
+// vesselField returns the last write of a vessel's field. A field never
+// written here has no origin and the zero time, so any write supersedes it.
+func vesselField(ctx context.Context, tx *sql.Tx, vesselID int64, field string) (VesselField, error) {
+	f := VesselField{VesselID: vesselID, Field: field}
+	var value sql.NullString
+	err := tx.QueryRowContext(ctx,
+		"SELECT value, updated_at, origin, seq FROM vessel_field_versions WHERE vessel_id = ? AND field = ?", vesselID, field,
+	).Scan(&value, &f.UpdatedAt, &f.Origin, &f.Seq)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRowContext(ctx, "SELECT "+field+" FROM vessels WHERE id = ?", vesselID).Scan(&value)
+	}
+	if err == sql.ErrNoRows {
+		return f, ErrNotFound
+	}
+	if err != nil {
+		return f, err
+	}
+	if value.Valid {
+		f.Value = &value.String
+	}
+	return f, nil
+}
+
+// writeVesselField sets a vessel's field and records the write as the
+// newest here.
+func writeVesselField(ctx context.Context, tx *sql.Tx, f VesselField) error {
+	_, err := tx.ExecContext(ctx, "UPDATE vessels SET "+f.Field+" = ?, updated_at = datetime('now') WHERE id = ?", f.Value, f.VesselID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO vessel_field_versions (vessel_id, field, value, updated_at, origin, seq)
+		VALUES (?, ?, ?, ?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM vessel_field_versions))
+		ON CONFLICT(vessel_id, field) DO UPDATE SET
+			value = excluded.value, updated_at = excluded.updated_at, origin = excluded.origin, seq = excluded.seq`,
+		f.VesselID, f.Field, f.Value, f.UpdatedAt.UTC(), f.Origin)
+	return err
+}
+
+func sameValue(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// VesselFieldsAfter returns up to limit field writes above afterSeq, of the
+// given vessels unless vesselIDs is nil, in seq order.
+func (s *SQLStore) VesselFieldsAfter(ctx context.Context, afterSeq int64, vesselIDs []int64, limit int) ([]VesselField, error) {
+	query := "SELECT vessel_id, field, value, updated_at, origin, seq FROM vessel_field_versions WHERE seq > ?"
+	args := []interface{}{afterSeq}
+	if vesselIDs != nil {
+		if len(vesselIDs) == 0 {
+			return nil, nil
+		}
+		query += " AND vessel_id IN (?" + strings.Repeat(", ?", len(vesselIDs)-1) + ")"
+		for _, id := range vesselIDs {
+			args = append(args, id)
+		}
+	}
+	query += " ORDER BY seq LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fields []VesselField
+	for rows.Next() {
+		var f VesselField
+		var value sql.NullString
+		if err := rows.Scan(&f.VesselID, &f.Field, &value, &f.UpdatedAt, &f.Origin, &f.Seq); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			f.Value = &value.String
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
@@ -0,0 +1,282 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+const vesselColumns = "id, imo, mmsi, name, flag, type, fleet, archived_at, created_at, updated_at"
+
+func scanVessel(row rowScanner) (models.Vessel, error) {
+	var vessel models.Vessel
+	var imo, mmsi, flag, vesselType, fleet sql.NullString
+	var archivedAt sql.NullTime
+
+	err := row.Scan(
+		&vessel.ID, &imo, &mmsi, &vessel.Name, &flag, &vesselType, &fleet,
+		&archivedAt, &vessel.CreatedAt, &vessel.UpdatedAt,
+	)
+	if err != nil {
+		return vessel, err
+	}
+
+	if imo.Valid {
+		vessel.IMO = &imo.String
+	}
+	if mmsi.Valid {
+		vessel.MMSI = &mmsi.String
+	}
+	if flag.Valid {
+		vessel.Flag = &flag.String
+	}
+	if vesselType.Valid {
+		vessel.Type = &vesselType.String
+	}
+	if fleet.Valid {
+		vessel.Fleet = &fleet.String
+	}
+	if archivedAt.Valid {
+		vessel.ArchivedAt = &archivedAt.Time
+	}
+	return vessel, nil
+}
+
+func (s *SQLStore) CountVessels(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM vessels").Scan(&count)
+	return count, err
+}
+
+// VesselFilter narrows and orders ListVessels. Empty fields match everything.
+type VesselFilter struct {
+	IncludeArchived bool
+	Name            string // case-insensitive substring of the name
+	IMO             string
+	Flag            string // case-insensitive exact match, as are Type and Fleet
+	Type            string
+	Fleet           string
+	DataSince       *time.Time // latest reading of any stream is at or after this time
+	Sort            string     // one of VesselSorts; defaults to name
+	Desc            bool
+}
+
+// VesselSorts maps the sort keys accepted by ListVessels to their SQL.
+var VesselSorts = map[string]string{
+	"name":       "name",
+	"imo":        "imo",
+	"flag":       "flag",
+	"type":       "type",
+	"fleet":      "fleet",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"last_data":  lastReadingExpr(),
+}
+
+// lastReadingExpr is the SQL for a vessel's latest reading time across all
+// streams. vessel_stream_latest can't be used: it holds upload times.
+func lastReadingExpr() string {
+	parts := make([]string, len(StreamOrder))
+	for i, name := range StreamOrder {
+		parts[i] = "SELECT MAX(ts) AS ts FROM " + Streams[name].Table + " WHERE vessel_id = vessels.id"
+	}
+	return "(SELECT MAX(ts) FROM (" + strings.Join(parts, " UNION ALL ") + "))"
+}
+
+// ListVessels returns the vessels matching f. Archived (decommissioned)
+// vessels are left out unless f.IncludeArchived is set. Vessels without a
+// value for the sort key come last.
+func (s *SQLStore) ListVessels(ctx context.Context, f VesselFilter) ([]models.Vessel, error) {
+	query := "SELECT " + vesselColumns + " FROM vessels WHERE 1=1"
+	var args []interface{}
+	if !f.IncludeArchived {
+		query += " AND archived_at IS NULL"
+	}
+	if f.Name != "" {
+		query += ` AND name LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLike(f.Name)+"%")
+	}
+	if f.IMO != "" {
+		query += " AND imo = ?"
+		args = append(args, f.IMO)
+	}
+	for _, m := range []struct{ column, value string }{{"flag", f.Flag}, {"type", f.Type}, {"fleet", f.Fleet}} {
+		if m.value != "" {
+			query += " AND " + m.column + " = ? COLLATE NOCASE"
+			args = append(args, m.value)
+		}
+	}
+	if f.DataSince != nil {
+		query += " AND " + VesselSorts["last_data"] + " >= ?"
+		args = append(args, *f.DataSince)
+	}
+
+	sortExpr, ok := VesselSorts[f.Sort]
+	if !ok {
+		sortExpr = VesselSorts["name"]
+	}
+	dir := "ASC"
+	if f.Desc {
+		dir = "DESC"
+	}
+	query += fmt.Sprintf(" ORDER BY %s IS NULL, %s %s, name, id", sortExpr, sortExpr, dir)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vessels []models.Vessel
+	for rows.Next() {
+		vessel, err := scanVessel(rows)
+		if err != nil {
+			return nil, err
+		}
+		vessels = append(vessels, vessel)
+	}
+	return vessels, rows.Err()
+}
+
+func (s *SQLStore) GetVessel(ctx context.Context, id int64) (*models.Vessel, error) {
+	vessel, err := scanVessel(s.db.QueryRowContext(ctx, "SELECT "+vesselColumns+" FROM vessels WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &vessel, nil
+}
+
+// VesselVisible reports whether a vessel exists and, unless includeArchived
+// is set, has not been archived.
+func (s *SQLStore) VesselVisible(ctx context.Context, id int64, includeArchived bool) (bool, error) {
+	var archivedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, "SELECT archived_at FROM vessels WHERE id = ?", id).Scan(&archivedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return includeArchived || !archivedAt.Valid, nil
+}
+
+// SetVesselArchived archives or restores a vessel and returns its archive
+// time (nil when not archived). Archiving twice keeps the original time.
+func (s *SQLStore) SetVesselArchived(ctx context.Context, id int64, archived bool) (*time.Time, error) {
+	var result sql.Result
+	var err error
+	if archived {
+		result, err = s.db.ExecContext(ctx,
+			"UPDATE vessels SET archived_at = COALESCE(archived_at, ?), updated_at = datetime('now') WHERE id = ?",
+			time.Now().UTC(), id,
+		)
+	} else {
+		result, err = s.db.ExecContext(ctx,
+			"UPDATE vessels SET archived_at = NULL, updated_at = datetime('now') WHERE id = ?",
+			id,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+
+	var archivedAt sql.NullTime
+	if err := s.db.QueryRowContext(ctx, "SELECT archived_at FROM vessels WHERE id = ?", id).Scan(&archivedAt); err != nil {
+		return nil, err
+	}
+	if !archivedAt.Valid {
+		return nil, nil
+	}
+	return &archivedAt.Time, nil
+}
+
+func (s *SQLStore) FindVesselByIMO(ctx context.Context, imo string) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM vessels WHERE imo = ?", imo).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+// CreateVessel inserts a vessel from its identity fields and returns its id.
+func (s *SQLStore) CreateVessel(ctx context.Context, v models.Vessel) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO vessels (imo, mmsi, name, flag, type, fleet) VALUES (?, ?, ?, ?, ?, ?)",
+		v.IMO, v.MMSI, v.Name, v.Flag, v.Type, v.Fleet,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateVesselInfo refreshes name, flag and type from a newer Ship Info
+// sheet. A missing MMSI or fleet keeps the stored one.
+func (s *SQLStore) UpdateVesselInfo(ctx context.Context, id int64, v models.Vessel) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE vessels SET name = ?, flag = ?, type = ?, mmsi = COALESCE(?, mmsi), fleet = COALESCE(?, fleet), updated_at = datetime('now') WHERE id = ?",
+		v.Name, v.Flag, v.Type, v.MMSI, v.Fleet, id,
+	)
+	return err
+}
+
+func (s *SQLStore) FindUploadByHash(ctx context.Context, fileHash string) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM uploads WHERE file_hash = ?", fileHash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+func (s *SQLStore) CreateUpload(ctx context.Context, u models.Upload) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO uploads (vessel_id, source_filename, file_hash, uploaded_at) VALUES (?, ?, ?, ?)",
+		u.VesselID, u.SourceFilename, u.FileHash, u.UploadedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s *SQLStore) GetUpload(ctx context.Context, id int64) (*models.Upload, error) {
+	var upload models.Upload
+	var note sql.NullString
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, vessel_id, source_filename, file_hash, uploaded_at, note
+		FROM uploads
+		WHERE id = ?
+	`, id).Scan(
+		&upload.ID, &upload.VesselID, &upload.SourceFilename,
+		&upload.FileHash, &upload.UploadedAt, &note,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if note.Valid {
+		upload.Note = &note.String
+	}
+	return &upload, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
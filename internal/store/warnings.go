@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"vessel-telemetry-api/internal/models"
+)
+
+// AddUploadWarnings stores the warnings of an upload's ingest, in order.
+func (s *SQLStore) AddUploadWarnings(ctx context.Context, uploadID int64, warnings []models.UploadWarning) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO upload_warnings (upload_id, sheet, row_number, message, row_json) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, w := range warnings {
+		var row interface{}
+		if w.Row != nil {
+			raw, err := json.Marshal(w.Row)
+			if err != nil {
+				return err
+			}
+			row = string(raw)
+		}
+		if _, err := stmt.ExecContext(ctx, uploadID, w.Sheet, w.RowNumber, w.Message, row); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UploadWarnings returns up to limit warnings of an upload with IDs above
+// afterID, in the order they were raised.
+func (s *SQLStore) UploadWarnings(ctx context.Context, uploadID, afterID int64, limit int) ([]models.UploadWarning, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, upload_id, sheet, row_number, message, row_json
+		FROM upload_warnings
+		WHERE upload_id = ? AND id > ?
+		ORDER BY id
+		LIMIT ?`, uploadID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	warnings := []models.UploadWarning{}
+	for rows.Next() {
+		var w models.UploadWarning
+		var row sql.NullString
+		if err := rows.Scan(&w.ID, &w.UploadID, &w.Sheet, &w.RowNumber, &w.Message, &row); err != nil {
+			return nil, err
+		}
+		if row.Valid {
+			if err := json.Unmarshal([]byte(row.String), &w.Row); err != nil {
+				return nil, err
+			}
+		}
+		warnings = append(warnings, w)
+	}
+	return warnings, rows.Err()
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"vessel-telemetry-api/internal/watermark"
+)
+
+// CreateExportWatermark records an export before it is written.
+func (s *SQLStore) CreateExportWatermark(ctx context.Context, r watermark.Record) error {
+	var from, to interface{}
+	if r.From != nil {
+		from = *r.From
+	}
+	if r.To != nil {
+		to = *r.To
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO export_watermarks (id, recipient, org, client_ip, vessel_id, stream, format, from_ts, to_ts, issued_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ExportID, r.Recipient, r.Org, r.ClientIP, r.VesselID, r.Stream, r.Format, from, to, r.IssuedAt)
+	return err
+}
+
+// CompleteExportWatermark stores the manifest of a fully written export.
+func (s *SQLStore) CompleteExportWatermark(ctx context.Context, m watermark.Manifest, at time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE export_watermarks SET rows = ?, chain_hash = ?, completed_at = ? WHERE id = ?",
+		m.Rows, m.ChainHash, at, m.ExportID)
+	return err
+}
+
+// GetExportWatermark returns the record of an export, or ErrNotFound.
+func (s *SQLStore) GetExportWatermark(ctx context.Context, id string) (*watermark.Record, error) {
+	var r watermark.Record
+	var org, clientIP, chainHash sql.NullString
+	var from, to, completed sql.NullString
+	var rows sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, recipient, org, client_ip, vessel_id, stream, format, from_ts, to_ts, issued_at, rows, chain_hash, completed_at
+		FROM export_watermarks WHERE id = ?`, id).Scan(
+		&r.ExportID, &r.Recipient, &org, &clientIP, &r.VesselID, &r.Stream, &r.Format,
+		&from, &to, &r.IssuedAt, &rows, &chainHash, &completed)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.Org, r.ClientIP = org.String, clientIP.String
+	r.IssuedAt = r.IssuedAt.UTC()
+	if r.From, err = parseTime(from); err != nil {
+		return nil, err
+	}
+	if r.To, err = parseTime(to); err != nil {
+		return nil, err
+	}
+	if r.CompletedAt, err = parseTime(completed); err != nil {
+		return nil, err
+	}
+	if rows.Valid {
+		r.Rows = &rows.Int64
+	}
+	if chainHash.Valid {
+		r.ChainHash = &chainHash.String
+	}
+	return &r, nil
+}
@@ -0,0 +1,244 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/weather"
+)
+
+// weatherScanCount is how many location_readings ids are queued per
+// transaction.
+const weatherScanCount = 10000
+
+const weatherColumns = "hour, latitude, longitude, wind_speed_knots, wind_direction_deg, wave_height_m, wave_period_s"
+
+func scanWeatherReading(rows *sql.Rows, extra ...interface{}) (models.WeatherReading, error) {
+	var r models.WeatherReading
+	var lat, lon, wind, windDir, wave, period sql.NullFloat64
+
+	dest := append([]interface{}{&r.Hour, &lat, &lon, &wind, &windDir, &wave, &period}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return r, err
+	}
+
+	if lat.Valid {
+		r.Latitude = &lat.Float64
+	}
+	if lon.Valid {
+		r.Longitude = &lon.Float64
+	}
+	if wind.Valid {
+		r.WindSpeedKnots = &wind.Float64
+		force := weather.Beaufort(wind.Float64)
+		r.Beaufort = &force
+	}
+	if windDir.Valid {
+		r.WindDirectionDeg = &windDir.Float64
+	}
+	if wave.Valid {
+		r.WaveHeightM = &wave.Float64
+	}
+	if period.Valid {
+		r.WavePeriodS = &period.Float64
+	}
+	return r, nil
+}
+
+// WeatherReadings returns the enriched weather per hour, oldest first.
+func (s *SQLStore) WeatherReadings(ctx context.Context, vesselID int64, from, to *time.Time) ([]models.WeatherReading, error) {
+	query := "SELECT " + weatherColumns + " FROM weather_readings WHERE vessel_id = ?"
+	args := []interface{}{vesselID}
+	if from != nil {
+		query += " AND hour >= ?"
+		args = append(args, from.UTC().Format(weather.HourLayout))
+	}
+	if to != nil {
+		query += " AND hour <= ?"
+		args = append(args, to.UTC().Format(weather.HourLayout))
+	}
+	query += " ORDER BY hour"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []models.WeatherReading{}
+	for rows.Next() {
+		r, err := scanWeatherReading(rows)
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, r)
+	}
+	return readings, rows.Err()
+}
+
+// HourlyFuelWeather joins the vessel's hourly generator fuel rate with the
+// weather of the same hour. Hours without weather are left out.
+func (s *SQLStore) HourlyFuelWeather(ctx context.Context, vesselID int64, from, to *time.Time) ([]models.FuelWeatherHour, error) {
+	// Vessel fuel rate per hour = sum over generators of their hourly average
+	query := `
+		WITH per_gen AS (
+			SELECT strftime('%Y-%m-%dT%H:00:00Z', ts) AS hour, gen_no, AVG(fuel_rate_lph) AS rate
+			FROM generator_readings
+			WHERE vessel_id = ? AND fuel_rate_lph IS NOT NULL`
+	query, args := timeRange(query, []interface{}{vesselID}, from, to)
+	query += `
+			GROUP BY hour, gen_no
+		), fuel AS (
+			SELECT hour, SUM(rate) AS rate FROM per_gen GROUP BY hour
+		)
+		SELECT w.hour, w.latitude, w.longitude, w.wind_speed_knots, w.wind_direction_deg,
+		       w.wave_height_m, w.wave_period_s, f.rate
+		FROM fuel f
+		JOIN weather_readings w ON w.vessel_id = ? AND w.hour = f.hour
+		ORDER BY w.hour`
+	args = append(args, vesselID)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hours := []models.FuelWeatherHour{}
+	for rows.Next() {
+		var rate float64
+		r, err := scanWeatherReading(rows, &rate)
+		if err != nil {
+			return nil, err
+		}
+		hours = append(hours, models.FuelWeatherHour{WeatherReading: r, FuelRateLPH: rate})
+	}
+	return hours, rows.Err()
+}
+
+// QueueWeatherHours adds the vessel-hours of positions past weather_cursor
+// that have no weather yet to weather_pending, due at due, weatherScanCount
+// ids at a time, and moves the cursor past them. A vessel-hour already
+// queued keeps its attempts.
+func (s *SQLStore) QueueWeatherHours(ctx context.Context, due time.Time) error {
+	var maxID int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM location_readings").Scan(&maxID); err != nil {
+		return err
+	}
+	var lastID int64
+	err := s.db.QueryRowContext(ctx, "SELECT last_id FROM weather_cursor WHERE id = 1").Scan(&lastID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	dueAt := due.UTC().Format(time.RFC3339)
+	for lastID < maxID {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		upTo := min(lastID+weatherScanCount, maxID)
+
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		// Bare columns take the values of the row with MAX(id): the hour's
+		// latest position
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO weather_pending (vessel_id, hour, location_reading_id, latitude, longitude, next_attempt_at)
+			SELECT b.vessel_id, b.hour, b.id, b.latitude, b.longitude, ?
+			FROM (
+				SELECT vessel_id, strftime('%Y-%m-%dT%H:00:00Z', ts) AS hour, MAX(id) AS id, latitude, longitude
+				FROM location_readings
+				WHERE id > ? AND id <= ? AND latitude IS NOT NULL AND longitude IS NOT NULL
+				GROUP BY vessel_id, hour
+			) b
+			WHERE b.hour IS NOT NULL AND NOT EXISTS (
+				SELECT 1 FROM weather_readings w WHERE w.vessel_id = b.vessel_id AND w.hour = b.hour
+			)
+			ON CONFLICT (vessel_id, hour) DO NOTHING`, dueAt, lastID, upTo)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO weather_cursor (id, last_id) VALUES (1, ?)
+				ON CONFLICT (id) DO UPDATE SET last_id = excluded.last_id`, upTo)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		lastID = upTo
+	}
+	return nil
+}
+
+// DueWeatherHours returns up to limit queued vessel-hours due at now:
+// vessel-hours not tried yet first, newest first.
+func (s *SQLStore) DueWeatherHours(ctx context.Context, now time.Time, limit int) ([]weather.Pending, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT vessel_id, hour, location_reading_id, latitude, longitude, attempts
+		FROM weather_pending
+		WHERE next_attempt_at <= ?
+		ORDER BY attempts, hour DESC
+		LIMIT ?`, now.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []weather.Pending
+	for rows.Next() {
+		var p weather.Pending
+		var hour string
+		if err := rows.Scan(&p.VesselID, &hour, &p.ReadingID, &p.Latitude, &p.Longitude, &p.Attempts); err != nil {
+			return nil, err
+		}
+		if p.Hour, err = time.Parse(weather.HourLayout, hour); err != nil {
+			continue
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// PutWeather stores the conditions of a queued vessel-hour and takes it off
+// the queue.
+func (s *SQLStore) PutWeather(ctx context.Context, p weather.Pending, cond weather.Conditions, raw json.RawMessage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hour := p.Hour.UTC().Format(weather.HourLayout)
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO weather_readings
+		(vessel_id, hour, ts, location_reading_id, latitude, longitude,
+		 wind_speed_knots, wind_direction_deg, wave_height_m, wave_period_s, raw_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.VesselID, hour, p.Hour, p.ReadingID, p.Latitude, p.Longitude,
+		cond.WindSpeedKnots, cond.WindDirectionDeg, cond.WaveHeightM, cond.WavePeriodS, raw,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM weather_pending WHERE vessel_id = ? AND hour = ?", p.VesselID, hour); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RetryWeatherHour records a failed fetch of a queued vessel-hour and when to
+// try again.
+func (s *SQLStore) RetryWeatherHour(ctx context.Context, p weather.Pending, attempts int, next time.Time, cause string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE weather_pending SET attempts = ?, next_attempt_at = ?, last_error = ?
+		WHERE vessel_id = ? AND hour = ?`,
+		attempts, next.UTC().Format(time.RFC3339), cause, p.VesselID, p.Hour.UTC().Format(weather.HourLayout))
+	return err
+}
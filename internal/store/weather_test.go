@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/db"
+	"vessel-telemetry-api/internal/weather"
+)
+
+func TestWeatherQueue(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.Connect(filepath.Join(t.TempDir(), "weather.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := db.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Exec("INSERT INTO vessels (imo, name) VALUES ('9811000', 'Weather')"); err != nil {
+		t.Fatal(err)
+	}
+	s := New(database)
+
+	n := 0
+	position := func(ts time.Time) {
+		t.Helper()
+		n++
+		_, err := database.Exec(`INSERT INTO location_readings (vessel_id, ts, latitude, longitude, row_hash)
+			VALUES (1, ?, 1.25, 103.8, ?)`, ts, fmt.Sprint(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)
+	position(day.Add(8 * time.Hour))
+	position(day.Add(9 * time.Hour))
+	for i := 0; i < 3; i++ {
+		position(day.Add(10*time.Hour + time.Duration(i)*time.Second))
+	}
+
+	now := day.Add(12 * time.Hour)
+	due := func(at time.Time) []weather.Pending {
+		t.Helper()
+		if err := s.QueueWeatherHours(ctx, now); err != nil {
+			t.Fatal(err)
+		}
+		pending, err := s.DueWeatherHours(ctx, at, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pending
+	}
+
+	// One entry per vessel-hour, at its latest position, newest first
+	pending := due(now)
+	if len(pending) != 3 || !pending[0].Hour.Equal(day.Add(10*time.Hour)) || pending[0].ReadingID != 5 || !pending[2].Hour.Equal(day.Add(8*time.Hour)) {
+		t.Fatalf("Expected hours 10, 9 and 8 due, got %+v", pending)
+	}
+
+	wind := 12.0
+	for _, p := range []weather.Pending{pending[0], pending[2]} {
+		if err := s.PutWeather(ctx, p, weather.Conditions{WindSpeedKnots: &wind}, json.RawMessage(`{"wind_speed_knots": 12}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RetryWeatherHour(ctx, pending[1], 1, now.Add(time.Hour), "no data"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is due before the retry, and positions are not rescanned
+	if pending := due(now); len(pending) != 0 {
+		t.Errorf("Expected nothing due, got %+v", pending)
+	}
+
+	// New positions are queued unless their hour has weather, and come
+	// before the retried hour
+	position(day.Add(10*time.Hour + time.Minute))
+	position(day.Add(11 * time.Hour))
+	pending = due(now.Add(time.Hour))
+	if len(pending) != 2 || !pending[0].Hour.Equal(day.Add(11*time.Hour)) || pending[1].Attempts != 1 {
+		t.Errorf("Expected the new hour, then the retried one, got %+v", pending)
+	}
+
+	readings, err := s.WeatherReadings(ctx, 1, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readings) != 2 || readings[0].Beaufort == nil || *readings[0].Beaufort != 4 {
+		t.Errorf("Expected 2 hours of weather stored, got %+v", readings)
+	}
+}
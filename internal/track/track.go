@@ -0,0 +1,106 @@
+// Package track simplifies vessel tracks for display.
+package track
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"vessel-telemetry-api/internal/ports"
+)
+
+const earthRadiusM = 6371000.0
+
+// Simplify reduces a track with the Douglas-Peucker algorithm, dropping every
+// fix that lies within toleranceM metres of the simplified line. The first and
+// last fixes are always kept; a tolerance of zero or less returns the track
+// unchanged.
+func Simplify(fixes []ports.Fix, toleranceM float64) []ports.Fix {
+	if toleranceM <= 0 || len(fixes) < 3 {
+		return fixes
+	}
+
+	keep := make([]bool, len(fixes))
+	keep[0], keep[len(fixes)-1] = true, true
+
+	// Explicit stack: a long straight passage would recurse once per fix
+	type span struct{ first, last int }
+	stack := []span{{0, len(fixes) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		maxDist, maxIdx := 0.0, -1
+		for i := s.first + 1; i < s.last; i++ {
+			if d := crossTrackDistance(fixes[i], fixes[s.first], fixes[s.last]); d > maxDist {
+				maxDist, maxIdx = d, i
+			}
+		}
+		if maxIdx < 0 || maxDist <= toleranceM {
+			continue
+		}
+		keep[maxIdx] = true
+		stack = append(stack, span{s.first, maxIdx}, span{maxIdx, s.last})
+	}
+
+	simplified := make([]ports.Fix, 0, len(fixes)/4+2)
+	for i, fix := range fixes {
+		if keep[i] {
+			simplified = append(simplified, fix)
+		}
+	}
+	return simplified
+}
+
+// crossTrackDistance is the distance in metres from p to the segment a-b, on
+// an equirectangular projection centred on a. Good enough at the scale of a
+// tolerance; not meant for segments spanning oceans.
+func crossTrackDistance(p, a, b ports.Fix) float64 {
+	cosLat := math.Cos(a.Latitude * math.Pi / 180)
+	project := func(f ports.Fix) (x, y float64) {
+		dLon := f.Longitude - a.Longitude
+		// Take the short way round across the antimeridian
+		if dLon > 180 {
+			dLon -= 360
+		} else if dLon < -180 {
+			dLon += 360
+		}
+		x = dLon * math.Pi / 180 * cosLat * earthRadiusM
+		y = (f.Latitude - a.Latitude) * math.Pi / 180 * earthRadiusM
+		return x, y
+	}
+
+	px, py := project(p)
+	bx, by := project(b)
+
+	segLen2 := bx*bx + by*by
+	if segLen2 == 0 {
+		return math.Hypot(px, py)
+	}
+	t := (px*bx + py*by) / segLen2
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(px-t*bx, py-t*by)
+}
+
+// Nearest returns the fix of a track (ordered by time) closest in time to t,
+// if one is within maxGap. Of two equally close fixes the earlier wins.
+func Nearest(fixes []ports.Fix, t time.Time, maxGap time.Duration) (ports.Fix, bool) {
+	i := sort.Search(len(fixes), func(i int) bool { return !fixes[i].Timestamp.Before(t) })
+	best, gap := -1, maxGap
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(fixes) {
+			continue
+		}
+		d := fixes[j].Timestamp.Sub(t)
+		if d < 0 {
+			d = -d
+		}
+		if d <= gap && (best < 0 || d < gap) {
+			best, gap = j, d
+		}
+	}
+	if best < 0 {
+		return ports.Fix{}, false
+	}
+	return fixes[best], true
+}
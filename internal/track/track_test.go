@@ -0,0 +1,94 @@
+package track
+
+import (
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/ports"
+)
+
+func fix(lat, lon float64) ports.Fix {
+	return ports.Fix{Latitude: lat, Longitude: lon}
+}
+
+func TestSimplifyStraightLine(t *testing.T) {
+	var fixes []ports.Fix
+	for i := 0; i <= 100; i++ {
+		fixes = append(fixes, fix(0, float64(i)*0.01))
+	}
+
+	got := Simplify(fixes, 10)
+	if len(got) != 2 {
+		t.Fatalf("Expected a straight line to reduce to 2 fixes, got %d", len(got))
+	}
+	if got[0] != fixes[0] || got[1] != fixes[100] {
+		t.Errorf("Expected the first and last fixes to be kept")
+	}
+}
+
+func TestSimplifyKeepsCorners(t *testing.T) {
+	// Out along the equator and back up: the corner is ~11km off the chord
+	fixes := []ports.Fix{
+		fix(0, 0), fix(0, 0.05), fix(0, 0.1), fix(0.05, 0.1), fix(0.1, 0.1),
+	}
+
+	got := Simplify(fixes, 100)
+	if len(got) != 3 || got[1] != fixes[2] {
+		t.Errorf("Expected start, corner and end, got %v", got)
+	}
+
+	if got := Simplify(fixes, 20000); len(got) != 2 {
+		t.Errorf("Expected a large tolerance to drop the corner, got %d fixes", len(got))
+	}
+}
+
+func TestSimplifyZeroTolerance(t *testing.T) {
+	fixes := []ports.Fix{fix(0, 0), fix(0, 0.5), fix(0, 1)}
+	if got := Simplify(fixes, 0); len(got) != 3 {
+		t.Errorf("Expected zero tolerance to keep every fix, got %d", len(got))
+	}
+}
+
+func TestCrossTrackDistance(t *testing.T) {
+	// 0.01 degrees of latitude is ~1112m
+	d := crossTrackDistance(fix(0.01, 0.5), fix(0, 0), fix(0, 1))
+	if d < 1100 || d > 1125 {
+		t.Errorf("Expected ~1112m, got %.1f", d)
+	}
+
+	// Beyond the segment end the distance is to the end point
+	d = crossTrackDistance(fix(0, 1.01), fix(0, 0), fix(0, 1))
+	if d < 1100 || d > 1125 {
+		t.Errorf("Expected ~1112m past the end, got %.1f", d)
+	}
+}
+
+func TestNearest(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fixes := []ports.Fix{
+		{Timestamp: t0, Latitude: 1},
+		{Timestamp: t0.Add(10 * time.Minute), Latitude: 2},
+		{Timestamp: t0.Add(20 * time.Minute), Latitude: 3},
+	}
+	for _, tc := range []struct {
+		at   time.Duration
+		gap  time.Duration
+		want float64 // latitude, 0 for none
+	}{
+		{0, time.Minute, 1},
+		{4 * time.Minute, 5 * time.Minute, 1},
+		{6 * time.Minute, 5 * time.Minute, 2},
+		{5 * time.Minute, 5 * time.Minute, 1}, // a tie goes to the earlier fix
+		{-2 * time.Minute, time.Minute, 0},
+		{25 * time.Minute, 5 * time.Minute, 3},
+		{26 * time.Minute, 5 * time.Minute, 0},
+	} {
+		got, ok := Nearest(fixes, t0.Add(tc.at), tc.gap)
+		if (tc.want == 0) == ok || (ok && got.Latitude != tc.want) {
+			t.Errorf("at %v within %v: expected %v, got %v %v", tc.at, tc.gap, tc.want, got.Latitude, ok)
+		}
+	}
+	if _, ok := Nearest(nil, t0, time.Hour); ok {
+		t.Error("Expected no fix on an empty track")
+	}
+}
@@ -0,0 +1,212 @@
+// Package urlfetch downloads spreadsheets to ingest from a link, such as a
+// file shared from a web server or a Google Sheets document.
+//
+// Links are rewritten to a download of the workbook where the service needs
+// it (Google Sheets edit and publish links), and downloads are bounded in
+// size and checked for a spreadsheet content type. Unless private addresses
+// are allowed, links to loopback, private and link-local hosts are refused so
+// the endpoint cannot be used to reach the internal network.
+package urlfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+var (
+	// ErrInvalidURL is returned for links that are not absolute http(s) URLs.
+	ErrInvalidURL = errors.New("invalid url")
+	// ErrForbiddenHost is returned for links to private addresses.
+	ErrForbiddenHost = errors.New("url points at a private address")
+	// ErrTooLarge is returned for downloads over the size limit.
+	ErrTooLarge = errors.New("file too large")
+	// ErrUnsupportedContent is returned for downloads that are not a
+	// spreadsheet, e.g. the sign-in page of a sheet that is not shared.
+	ErrUnsupportedContent = errors.New("not a spreadsheet")
+)
+
+// spreadsheetTypes are the content types accepted. Servers often send
+// generic binary types for files they do not know.
+var spreadsheetTypes = map[string]bool{
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
+	"application/vnd.ms-excel":                       true,
+	"application/vnd.oasis.opendocument.spreadsheet": true,
+	"application/octet-stream":                       true,
+	"binary/octet-stream":                            true,
+	"application/zip":                                true,
+	"application/x-zip-compressed":                   true,
+}
+
+// File is a downloaded spreadsheet.
+type File struct {
+	Name string // from Content-Disposition, else the last path segment
+	URL  string // the URL downloaded, after rewriting
+	Data []byte
+}
+
+// Fetcher downloads spreadsheets.
+type Fetcher struct {
+	client   *http.Client
+	out      *outbound.Integration
+	maxBytes int64
+}
+
+// NewFetcher creates a fetcher for files of up to maxBytes whose downloads
+// take policy's timeout and at most one of its retries. Links point at any
+// number of unrelated servers, so there is no circuit breaker: one failing
+// server must not refuse downloads from the others. allowPrivate permits
+// links to private addresses, e.g. a file server on the vessel's LAN.
+func NewFetcher(maxBytes int64, allowPrivate bool, policy outbound.Policy) *Fetcher {
+	policy.FailureThreshold = 0
+	policy.Retries = min(policy.Retries, 1)
+
+	dialer := &net.Dialer{}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		// Checked on the address dialled, so names resolving to private
+		// addresses and redirects to them are refused too
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+				return ErrForbiddenHost
+			}
+			return nil
+		}
+		// A proxy would dial on our behalf
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &Fetcher{
+		client:   &http.Client{Transport: transport}, // timeouts come from the policy
+		out:      outbound.New("ingest_url", policy),
+		maxBytes: maxBytes,
+	}
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// Fetch downloads the spreadsheet a link points at.
+func (f *Fetcher) Fetch(ctx context.Context, link string) (*File, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: use an http or https link", ErrInvalidURL)
+	}
+	u.User = nil
+	u = DownloadURL(u)
+
+	file := &File{URL: u.String()}
+	err = f.out.Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.URL, nil)
+		if err != nil {
+			return outbound.Permanent(err)
+		}
+		resp, err := f.client.Do(req)
+		if errors.Is(err, ErrForbiddenHost) {
+			return outbound.Permanent(ErrForbiddenHost)
+		} else if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			err := fmt.Errorf("server returned %s", resp.Status)
+			if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+				return err
+			}
+			return outbound.Permanent(err)
+		}
+		if err := checkContentType(resp.Header.Get("Content-Type")); err != nil {
+			return outbound.Permanent(err)
+		}
+		if resp.ContentLength > f.maxBytes {
+			return outbound.Permanent(fmt.Errorf("%w: the file exceeds %d MB", ErrTooLarge, f.maxBytes>>20))
+		}
+
+		// Read inside the attempt so the timeout covers a stalled body too
+		data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) > f.maxBytes {
+			return outbound.Permanent(fmt.Errorf("%w: the file exceeds %d MB", ErrTooLarge, f.maxBytes>>20))
+		}
+		file.Data = data
+		file.Name = filename(resp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// checkContentType refuses responses that are not a spreadsheet. A missing
+// type is let through; the workbook reader has the last word.
+func checkContentType(header string) error {
+	if header == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return fmt.Errorf("%w: invalid content type %q", ErrUnsupportedContent, header)
+	}
+	if spreadsheetTypes[mediaType] {
+		return nil
+	}
+	if mediaType == "text/html" {
+		return fmt.Errorf("%w: the link returned a web page; share the file publicly or use its download link", ErrUnsupportedContent)
+	}
+	return fmt.Errorf("%w: content type %s", ErrUnsupportedContent, mediaType)
+}
+
+// filename names the downloaded file after its Content-Disposition, else
+// the last segment of its URL.
+func filename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return path.Base(params["filename"])
+	}
+	if name := path.Base(resp.Request.URL.Path); name != "/" && name != "." {
+		return name
+	}
+	return "download"
+}
+
+// DownloadURL rewrites links to a Google Sheets document, whether to edit,
+// view or publish it, to an XLSX export of the whole workbook. Other links
+// are returned as they are.
+func DownloadURL(u *url.URL) *url.URL {
+	if u.Host != "docs.google.com" || !strings.HasPrefix(u.Path, "/spreadsheets/d/") {
+		return u
+	}
+	parts := strings.Split(strings.TrimPrefix(u.Path, "/spreadsheets/d/"), "/")
+	out := &url.URL{Scheme: "https", Host: u.Host}
+	if parts[0] == "e" && len(parts) > 1 && parts[1] != "" {
+		// Published to the web: /spreadsheets/d/e/<id>/pubhtml
+		out.Path = "/spreadsheets/d/e/" + parts[1] + "/pub"
+		out.RawQuery = "output=xlsx"
+		return out
+	}
+	if parts[0] == "" {
+		return u
+	}
+	out.Path = "/spreadsheets/d/" + parts[0] + "/export"
+	out.RawQuery = "format=xlsx"
+	return out
+}
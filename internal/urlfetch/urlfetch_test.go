@@ -0,0 +1,111 @@
+package urlfetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+func TestDownloadURL(t *testing.T) {
+	for link, want := range map[string]string{
+		"https://docs.google.com/spreadsheets/d/1AbC/edit#gid=0":           "https://docs.google.com/spreadsheets/d/1AbC/export?format=xlsx",
+		"https://docs.google.com/spreadsheets/d/1AbC/export?format=csv":    "https://docs.google.com/spreadsheets/d/1AbC/export?format=xlsx",
+		"https://docs.google.com/spreadsheets/d/e/2PACX-1v/pubhtml":        "https://docs.google.com/spreadsheets/d/e/2PACX-1v/pub?output=xlsx",
+		"https://docs.google.com/spreadsheets/d/e/2PACX-1v/pub?output=csv": "https://docs.google.com/spreadsheets/d/e/2PACX-1v/pub?output=xlsx",
+		"https://docs.google.com/document/d/1AbC/edit":                     "https://docs.google.com/document/d/1AbC/edit",
+		"https://files.example.com/daily.xlsx?token=x":                     "https://files.example.com/daily.xlsx?token=x",
+	} {
+		u, _ := url.Parse(link)
+		if got := DownloadURL(u).String(); got != want {
+			t.Errorf("DownloadURL(%s) = %s, want %s", link, got, want)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/daily.xlsx":
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+			w.Write([]byte("PK workbook"))
+		case "/export":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="Noon report.xlsx"`)
+			w.Write([]byte("PK workbook"))
+		case "/big.xlsx":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte(strings.Repeat("x", 64)))
+		case "/login":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>Sign in</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	policy := outbound.Policy{}
+	f := NewFetcher(32, true, policy)
+	ctx := context.Background()
+
+	file, err := f.Fetch(ctx, srv.URL+"/daily.xlsx")
+	if err != nil || file.Name != "daily.xlsx" || string(file.Data) != "PK workbook" {
+		t.Errorf("Expected daily.xlsx, got %+v, %v", file, err)
+	}
+	if file, err := f.Fetch(ctx, srv.URL+"/export"); err != nil || file.Name != "Noon report.xlsx" {
+		t.Errorf("Expected the Content-Disposition name, got %+v, %v", file, err)
+	}
+	if _, err := f.Fetch(ctx, srv.URL+"/big.xlsx"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+	if _, err := f.Fetch(ctx, srv.URL+"/login"); !errors.Is(err, ErrUnsupportedContent) {
+		t.Errorf("Expected ErrUnsupportedContent, got %v", err)
+	}
+	if _, err := f.Fetch(ctx, srv.URL+"/missing.xlsx"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected the 404 to be reported, got %v", err)
+	}
+	for _, link := range []string{"ftp://example.com/a.xlsx", "/daily.xlsx", "https://"} {
+		if _, err := f.Fetch(ctx, link); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("%s: expected ErrInvalidURL, got %v", link, err)
+		}
+	}
+
+	// The test server listens on loopback
+	if _, err := NewFetcher(32, false, policy).Fetch(ctx, srv.URL+"/daily.xlsx"); !errors.Is(err, ErrForbiddenHost) {
+		t.Errorf("Expected ErrForbiddenHost, got %v", err)
+	}
+}
+
+func TestFetchFailingHost(t *testing.T) {
+	var failing int
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("PK workbook"))
+	}))
+	defer up.Close()
+
+	f := NewFetcher(32, true, outbound.Policy{Retries: 3, FailureThreshold: 1, OpenDuration: time.Hour})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := f.Fetch(ctx, down.URL+"/daily.xlsx"); err == nil || errors.Is(err, outbound.ErrCircuitOpen) {
+			t.Fatalf("Expected the failing server's 503, got %v", err)
+		}
+	}
+	if failing != 6 {
+		t.Errorf("Expected each download tried twice, got %d requests for 3", failing)
+	}
+	if file, err := f.Fetch(ctx, up.URL+"/daily.xlsx"); err != nil || string(file.Data) != "PK workbook" {
+		t.Errorf("Expected another server unaffected, got %+v, %v", file, err)
+	}
+}
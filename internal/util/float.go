@@ -0,0 +1,12 @@
+package util
+
+// FirstFloat returns the first of vals that is set, nil if none is. Decoders
+// use it to accept a value under any of its field names.
+func FirstFloat(vals ...*float64) *float64 {
+	for _, v := range vals {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package utilization reports, per calendar month, how many hours a vessel's
+// engines ran and how much of the time it spent underway and in port.
+//
+// A reading stands for the time until the next one of the same engine (or
+// the next position), capped at MaxGap so a logging outage does not count
+// as running or sailing. Time in port is the span of detected port calls.
+package utilization
+
+import (
+	"sort"
+	"time"
+
+	"vessel-telemetry-api/internal/ports"
+)
+
+// EngineSample is one engine's rpm at a time.
+type EngineSample struct {
+	EngineNo int
+	TS       time.Time
+	RPM      *float64
+}
+
+// Options tune the report.
+type Options struct {
+	EngineRunningRPM float64       // engines above it are running
+	UnderwayKnots    float64       // speeds above it are underway
+	MaxGap           time.Duration // longest time one reading stands for
+}
+
+// DefaultOptions match the port-call detection, which takes a vessel at or
+// below 1 knot as stationary.
+var DefaultOptions = Options{
+	EngineRunningRPM: 10,
+	UnderwayKnots:    1,
+	MaxGap:           time.Hour,
+}
+
+// Month is the utilization of one calendar month (UTC).
+type Month struct {
+	Month string `json:"month"` // YYYY-MM
+	// PeriodHours is the part of the month inside the report period.
+	PeriodHours   float64 `json:"period_hours"`
+	EngineHours   float64 `json:"engine_hours"` // summed over engines
+	UnderwayHours float64 `json:"underway_hours"`
+	PortHours     float64 `json:"port_hours"`
+	// The percentages are of PeriodHours.
+	UnderwayPercent float64 `json:"underway_percent"`
+	PortPercent     float64 `json:"port_percent"`
+
+	start, end time.Time
+}
+
+// Months returns the months overlapping from..to, without any hours.
+func Months(from, to time.Time) []Month {
+	from, to = from.UTC(), to.UTC()
+	var months []Month
+	if !from.Before(to) {
+		return months
+	}
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for start.Before(to) {
+		next := start.AddDate(0, 1, 0)
+		m := Month{Month: start.Format("2006-01"), start: start, end: next}
+		m.PeriodHours = overlap(m.start, m.end, from, to)
+		months = append(months, m)
+		start = next
+	}
+	return months
+}
+
+// overlap returns the hours [a, b) and [c, d) have in common.
+func overlap(a, b, c, d time.Time) float64 {
+	if c.After(a) {
+		a = c
+	}
+	if d.Before(b) {
+		b = d
+	}
+	if !b.After(a) {
+		return 0
+	}
+	return b.Sub(a).Hours()
+}
+
+// add spreads [start, end) over the months, clipped to the period.
+func add(months []Month, from, to, start, end time.Time, field func(*Month) *float64) {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	for i := range months {
+		*field(&months[i]) += overlap(months[i].start, months[i].end, start, end)
+	}
+}
+
+// Build computes the months of from..to. Engine samples and fixes may come
+// in any order.
+func Build(from, to time.Time, engines []EngineSample, fixes []ports.Fix, calls []ports.Call, opts Options) []Month {
+	months := Months(from, to)
+	capped := func(start, next time.Time) time.Time {
+		if opts.MaxGap > 0 && next.Sub(start) > opts.MaxGap {
+			return start.Add(opts.MaxGap)
+		}
+		return next
+	}
+
+	sorted := append([]EngineSample(nil), engines...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].EngineNo != sorted[j].EngineNo {
+			return sorted[i].EngineNo < sorted[j].EngineNo
+		}
+		return sorted[i].TS.Before(sorted[j].TS)
+	})
+	for i := 0; i+1 < len(sorted); i++ {
+		s, next := sorted[i], sorted[i+1]
+		if next.EngineNo != s.EngineNo || s.RPM == nil || *s.RPM <= opts.EngineRunningRPM {
+			continue
+		}
+		add(months, from, to, s.TS, capped(s.TS, next.TS), func(m *Month) *float64 { return &m.EngineHours })
+	}
+
+	positions := append([]ports.Fix(nil), fixes...)
+	sort.SliceStable(positions, func(i, j int) bool { return positions[i].Timestamp.Before(positions[j].Timestamp) })
+	for i := 0; i+1 < len(positions); i++ {
+		f := positions[i]
+		if f.Speed == nil || *f.Speed <= opts.UnderwayKnots {
+			continue
+		}
+		add(months, from, to, f.Timestamp, capped(f.Timestamp, positions[i+1].Timestamp), func(m *Month) *float64 { return &m.UnderwayHours })
+	}
+
+	for _, call := range calls {
+		// A call still open lasts until the last known position, in port
+		end := call.Arrival
+		if call.Departure != nil {
+			end = *call.Departure
+		} else if len(positions) > 0 {
+			end = positions[len(positions)-1].Timestamp
+		}
+		add(months, from, to, call.Arrival, end, func(m *Month) *float64 { return &m.PortHours })
+	}
+
+	for i := range months {
+		if m := &months[i]; m.PeriodHours > 0 {
+			m.UnderwayPercent = m.UnderwayHours / m.PeriodHours * 100
+			m.PortPercent = m.PortHours / m.PeriodHours * 100
+		}
+	}
+	return months
+}
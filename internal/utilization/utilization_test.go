@@ -0,0 +1,75 @@
+package utilization
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/ports"
+)
+
+func f(v float64) *float64 { return &v }
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestMonths(t *testing.T) {
+	from := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	months := Months(from, to)
+	if len(months) != 3 || months[0].Month != "2025-01" || months[2].Month != "2025-03" {
+		t.Fatalf("Unexpected months %+v", months)
+	}
+	if months[0].PeriodHours != 17*24 || months[1].PeriodHours != 28*24 || months[2].PeriodHours != 24 {
+		t.Errorf("Unexpected period hours %v, %v, %v", months[0].PeriodHours, months[1].PeriodHours, months[2].PeriodHours)
+	}
+	if len(Months(to, to)) != 0 {
+		t.Error("Expected no months for an empty period")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time { return time.Date(2025, 1, day, hour, 0, 0, 0, time.UTC) }
+
+	engines := []EngineSample{
+		// Engine 1 runs across the month boundary: 22:00 Jan 31 to 02:00 Feb 1
+		{EngineNo: 1, TS: at(31, 22), RPM: f(700)},
+		{EngineNo: 1, TS: at(32, 2), RPM: f(0)},
+		// Engine 2 runs 1 h, then logging stops for a day (capped at MaxGap, 4 h)
+		{EngineNo: 2, TS: at(10, 0), RPM: f(600)},
+		{EngineNo: 2, TS: at(10, 1), RPM: f(600)},
+		{EngineNo: 2, TS: at(11, 1), RPM: f(5)},
+	}
+	fixes := []ports.Fix{
+		{Timestamp: at(5, 0), Speed: f(12)},
+		{Timestamp: at(5, 1), Speed: f(12)},
+		{Timestamp: at(5, 2), Speed: f(0)},
+		{Timestamp: at(7, 2)},
+	}
+	departure := at(7, 2)
+	calls := []ports.Call{{PortCode: "NLRTM", Arrival: at(5, 2), Departure: &departure}}
+
+	months := Build(from, to, engines, fixes, calls, Options{EngineRunningRPM: 10, UnderwayKnots: 1, MaxGap: 4 * time.Hour})
+	if len(months) != 2 {
+		t.Fatalf("Expected 2 months, got %+v", months)
+	}
+	jan, feb := months[0], months[1]
+
+	// Engine 1: 2 h in January, 2 h in February; engine 2: 1 h + 4 h capped
+	if jan.EngineHours != 7 || feb.EngineHours != 2 {
+		t.Errorf("Expected 7 and 2 engine hours, got %v and %v", jan.EngineHours, feb.EngineHours)
+	}
+	if jan.UnderwayHours != 2 || jan.PortHours != 48 || feb.PortHours != 0 {
+		t.Errorf("Unexpected January %+v", jan)
+	}
+	if !near(jan.PortPercent, 48/(31*24.0)*100) || !near(jan.UnderwayPercent, 2/(31*24.0)*100) {
+		t.Errorf("Unexpected percentages %v, %v", jan.UnderwayPercent, jan.PortPercent)
+	}
+
+	// An open call lasts until the last position
+	open := []ports.Call{{PortCode: "NLRTM", Arrival: at(5, 2)}}
+	if months := Build(from, to, nil, fixes, open, DefaultOptions); months[0].PortHours != 48 {
+		t.Errorf("Expected an open call to last until the last position, got %v h", months[0].PortHours)
+	}
+}
@@ -0,0 +1,268 @@
+// Package watermark marks exported files so a leaked copy can be traced to
+// the recipient.
+//
+// A watermarked export starts with a watermark line naming the export, the
+// recipient's key fingerprint and organization, and ends with a manifest
+// line. Every line in between is hash-chained from the watermark line, so the
+// manifest's chain hash only matches if the rows and the watermark are
+// unchanged. Exports are also recorded server-side under their ID.
+package watermark
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Formats of watermarked files.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// csvPrefix starts the watermark and manifest lines of a CSV file; CSV
+// readers with '#' comments skip them.
+const csvPrefix = "# "
+
+// Mark identifies an export and its recipient.
+type Mark struct {
+	ExportID  string     `json:"export_id"`
+	Recipient string     `json:"recipient"` // API key fingerprint, empty without a key
+	Org       string     `json:"org,omitempty"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	VesselID  int64      `json:"vessel_id"`
+	Stream    string     `json:"stream"`
+	From      *time.Time `json:"from,omitempty"`
+	To        *time.Time `json:"to,omitempty"`
+}
+
+// Manifest closes a watermarked file.
+type Manifest struct {
+	ExportID  string `json:"export_id"`
+	Rows      int64  `json:"rows"`       // data rows, without the CSV header
+	ChainHash string `json:"chain_hash"` // hex sha256 over the watermark and every line
+}
+
+// Record is the server-side copy of an export's watermark.
+type Record struct {
+	Mark
+	Format      string     `json:"format"`
+	ClientIP    string     `json:"client_ip"`
+	Rows        *int64     `json:"rows"`       // nil until the export completes
+	ChainHash   *string    `json:"chain_hash"` // nil until the export completes
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// NewID returns a random export ID.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Fingerprint identifies an API key without revealing it.
+func Fingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// line renders a watermark or manifest line for format.
+func line(format, name string, v interface{}) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatCSV {
+		return []byte(csvPrefix + name + " " + string(body) + "\n"), nil
+	}
+	body, err = json.Marshal(map[string]json.RawMessage{name: body})
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
+
+// Note renders a note line, e.g. a summary of the export: "# name <json>"
+// in CSV, {"name": <json>} in NDJSON. Notes are chained but not rows.
+func Note(format, name string, v interface{}) ([]byte, error) {
+	return line(format, name, v)
+}
+
+// isNote reports whether l, a line between the watermark and the manifest,
+// is a note; data rows are neither comments nor objects of a single key.
+func isNote(format string, l []byte) bool {
+	if format == FormatCSV {
+		return bytes.HasPrefix(l, []byte(csvPrefix))
+	}
+	var wrapper map[string]json.RawMessage
+	return json.Unmarshal(l, &wrapper) == nil && len(wrapper) == 1
+}
+
+// parseLine is the inverse of line; it reports false if l is not a name line.
+func parseLine(format, name string, l []byte, v interface{}) bool {
+	if format == FormatCSV {
+		prefix := []byte(csvPrefix + name + " ")
+		if !bytes.HasPrefix(l, prefix) {
+			return false
+		}
+		return json.Unmarshal(bytes.TrimPrefix(l, prefix), v) == nil
+	}
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(l, &wrapper); err != nil || len(wrapper) != 1 || wrapper[name] == nil {
+		return false
+	}
+	return json.Unmarshal(wrapper[name], v) == nil
+}
+
+// Writer writes a watermarked file. Lines must be passed whole, including
+// the trailing newline.
+type Writer struct {
+	w      io.Writer
+	format string
+	id     string
+	chain  [sha256.Size]byte
+	rows   int64
+	header bool // the next line is the CSV header, which is not a row
+}
+
+// NewWriter writes the watermark line for m and returns a Writer for the
+// lines that follow.
+func NewWriter(w io.Writer, format string, m Mark) (*Writer, error) {
+	l, err := line(format, "watermark", m)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(l); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, format: format, id: m.ExportID, chain: sha256.Sum256(l), header: format == FormatCSV}, nil
+}
+
+// WriteLine writes one line and adds it to the chain.
+func (w *Writer) WriteLine(l []byte) error {
+	w.chain = next(w.chain, l)
+	if w.header {
+		w.header = false
+	} else {
+		w.rows++
+	}
+	_, err := w.w.Write(l)
+	return err
+}
+
+// WriteNote writes a line of Note and adds it to the chain, not counting it
+// as a row.
+func (w *Writer) WriteNote(l []byte) error {
+	w.chain = next(w.chain, l)
+	_, err := w.w.Write(l)
+	return err
+}
+
+// Close writes the manifest line and returns the manifest.
+func (w *Writer) Close() (Manifest, error) {
+	m := Manifest{ExportID: w.id, Rows: w.rows, ChainHash: hex.EncodeToString(w.chain[:])}
+	l, err := line(w.format, "manifest", m)
+	if err != nil {
+		return m, err
+	}
+	_, err = w.w.Write(l)
+	return m, err
+}
+
+func next(chain [sha256.Size]byte, l []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(chain[:])
+	h.Write(l)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// ErrNoWatermark is returned by Verify for files without a watermark line.
+var ErrNoWatermark = errors.New("no watermark found")
+
+// Verification is what Verify finds in a file.
+type Verification struct {
+	Format    string    `json:"format"`
+	Mark      Mark      `json:"watermark"`
+	Manifest  *Manifest `json:"manifest"`   // nil if the manifest line is missing
+	Rows      int64     `json:"rows"`       // data rows found
+	ChainHash string    `json:"chain_hash"` // recomputed over the lines found
+	// Intact reports whether the manifest is present and matches the
+	// recomputed chain, i.e. nothing was changed, added or removed.
+	Intact bool `json:"intact"`
+}
+
+// Verify reads a watermarked file and recomputes its chain. Files cut short
+// still identify their recipient; they are just not intact.
+func Verify(r io.Reader) (*Verification, error) {
+	br := bufio.NewReader(r)
+	first, err := br.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	v := &Verification{}
+	switch {
+	case parseLine(FormatCSV, "watermark", bytes.TrimSuffix(first, []byte("\n")), &v.Mark):
+		v.Format = FormatCSV
+	case parseLine(FormatNDJSON, "watermark", bytes.TrimSuffix(first, []byte("\n")), &v.Mark):
+		v.Format = FormatNDJSON
+	default:
+		return nil, ErrNoWatermark
+	}
+
+	chain := sha256.Sum256(first)
+	header := v.Format == FormatCSV
+	for {
+		l, err := br.ReadBytes('\n')
+		if len(l) > 0 {
+			var m Manifest
+			if parseLine(v.Format, "manifest", bytes.TrimSuffix(l, []byte("\n")), &m) {
+				v.Manifest = &m
+				break
+			}
+			chain = next(chain, l)
+			if header {
+				header = false
+			} else if !isNote(v.Format, l) {
+				v.Rows++
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading export: %w", err)
+		}
+	}
+
+	// Anything after the manifest was appended later
+	trailing := false
+	if v.Manifest != nil {
+		rest, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("reading export: %w", err)
+		}
+		trailing = len(bytes.TrimSpace(rest)) > 0
+	}
+
+	v.ChainHash = hex.EncodeToString(chain[:])
+	v.Intact = v.Manifest != nil && !trailing &&
+		v.Manifest.ExportID == v.Mark.ExportID &&
+		v.Manifest.Rows == v.Rows &&
+		v.Manifest.ChainHash == v.ChainHash
+	return v, nil
+}
@@ -0,0 +1,110 @@
+package watermark
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, format string, lines ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, Mark{ExportID: "abc", Recipient: Fingerprint("key-1"), Org: "acme", IssuedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), VesselID: 1, Stream: "engines"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range lines {
+		if err := w.WriteLine([]byte(l + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerify(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		lines := []string{`{"id":1,"rpm":1500}`, `{"id":2,"rpm":1510}`}
+		if format == FormatCSV {
+			lines = []string{"id,ts", "1,2025-01-01T00:00:00Z", "2,2025-01-01T00:01:00Z"}
+		}
+		file := write(t, format, lines...)
+
+		v, err := Verify(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !v.Intact || v.Format != format || v.Rows != 2 || v.Mark.Org != "acme" || v.Mark.Recipient != Fingerprint("key-1") {
+			t.Errorf("%s: expected an intact file with 2 rows for acme, got %+v", format, v)
+		}
+
+		tampered := map[string][]byte{
+			"changed row":   bytes.Replace(file, []byte(lines[1]), []byte(strings.Replace(lines[1], "1", "9", 1)), 1),
+			"dropped row":   bytes.Replace(file, []byte(lines[1]+"\n"), nil, 1),
+			"new recipient": bytes.Replace(file, []byte("acme"), []byte("evil"), 1),
+			"appended":      append(append([]byte{}, file...), []byte(lines[1]+"\n")...),
+		}
+		for name, f := range tampered {
+			v, err := Verify(bytes.NewReader(f))
+			if err != nil || v.Intact {
+				t.Errorf("%s %s: expected a traceable but not intact file, got %+v, %v", format, name, v, err)
+			}
+		}
+
+		// Without the manifest the recipient is still known
+		cut := file[:bytes.LastIndexByte(file[:len(file)-1], '\n')+1]
+		if v, err := Verify(bytes.NewReader(cut)); err != nil || v.Intact || v.Manifest != nil || v.Mark.ExportID != "abc" {
+			t.Errorf("%s: expected a cut file to name its export, got %+v, %v", format, v, err)
+		}
+	}
+
+	if _, err := Verify(strings.NewReader("id,ts\n1,2025-01-01T00:00:00Z\n")); !errors.Is(err, ErrNoWatermark) {
+		t.Errorf("Expected ErrNoWatermark, got %v", err)
+	}
+}
+
+func TestVerifyNote(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format, Mark{ExportID: "abc", VesselID: 1, Stream: "engines"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		row := `{"id":1,"rpm":1500}` + "\n"
+		if format == FormatCSV {
+			row = "1,2025-01-01T00:00:00Z\n"
+			if err := w.WriteLine([]byte("id,ts\n")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		note, err := Note(format, "duplicates_collapsed", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteLine([]byte(row)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteNote(note); err != nil {
+			t.Fatal(err)
+		}
+		m, err := w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Rows != 1 {
+			t.Errorf("%s: expected the note not counted as a row, got %d rows", format, m.Rows)
+		}
+		if v, err := Verify(bytes.NewReader(buf.Bytes())); err != nil || !v.Intact || v.Rows != 1 {
+			t.Errorf("%s: expected an intact file with 1 row, got %+v, %v", format, v, err)
+		}
+		// The note is chained like the rows
+		changed := bytes.Replace(buf.Bytes(), note, bytes.Replace(note, []byte("3"), []byte("0"), 1), 1)
+		if v, err := Verify(bytes.NewReader(changed)); err != nil || v.Intact {
+			t.Errorf("%s: expected a changed note to break the chain, got %+v, %v", format, v, err)
+		}
+	}
+}
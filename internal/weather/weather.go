@@ -0,0 +1,216 @@
+// Package weather enriches vessel positions with wind and wave conditions from
+// an external marine weather provider.
+//
+// The provider URL is a template with {lat}, {lon} and {time} placeholders
+// ({time} is the RFC 3339 UTC hour), e.g.
+// https://weather.example.com/v1/marine?lat={lat}&lon={lon}&time={time}.
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/util"
+)
+
+// HourLayout is the format of weather_readings.hour, matching
+// strftime('%Y-%m-%dT%H:00:00Z', ts) in SQLite.
+const HourLayout = "2006-01-02T15:00:00Z"
+
+const (
+	// batchSize bounds how many vessel-hours are fetched per run.
+	batchSize = 100
+	// maxBackoff caps the wait before retrying a vessel-hour whose fetch failed.
+	maxBackoff = 24 * time.Hour
+)
+
+// Conditions are the weather conditions at one position and hour.
+type Conditions struct {
+	WindSpeedKnots   *float64 `json:"wind_speed_knots"`
+	WindDirectionDeg *float64 `json:"wind_direction_deg"`
+	WaveHeightM      *float64 `json:"wave_height_m"`
+	WavePeriodS      *float64 `json:"wave_period_s"`
+}
+
+type rawConditions struct {
+	WindSpeedKnots *float64 `json:"wind_speed_knots"`
+	WindSpeed      *float64 `json:"wind_speed"` // m/s
+	WindDirection  *float64 `json:"wind_direction"`
+	WindDirDeg     *float64 `json:"wind_direction_deg"`
+	WaveHeight     *float64 `json:"wave_height"`
+	WaveHeightM    *float64 `json:"wave_height_m"`
+	WavePeriod     *float64 `json:"wave_period"`
+	WavePeriodS    *float64 `json:"wave_period_s"`
+}
+
+const knotsPerMS = 1.943844
+
+// ParseConditions decodes a provider response. Wind speed is accepted in knots
+// (wind_speed_knots) or metres per second (wind_speed).
+func ParseConditions(body []byte) (Conditions, error) {
+	var raw rawConditions
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Conditions{}, err
+	}
+
+	cond := Conditions{
+		WindSpeedKnots:   raw.WindSpeedKnots,
+		WindDirectionDeg: util.FirstFloat(raw.WindDirDeg, raw.WindDirection),
+		WaveHeightM:      util.FirstFloat(raw.WaveHeightM, raw.WaveHeight),
+		WavePeriodS:      util.FirstFloat(raw.WavePeriodS, raw.WavePeriod),
+	}
+	if cond.WindSpeedKnots == nil && raw.WindSpeed != nil {
+		knots := *raw.WindSpeed * knotsPerMS
+		cond.WindSpeedKnots = &knots
+	}
+
+	if cond.WindSpeedKnots == nil && cond.WaveHeightM == nil {
+		return Conditions{}, fmt.Errorf("response contains no wind or wave data")
+	}
+	return cond, nil
+}
+
+// Beaufort converts a wind speed in knots to the Beaufort scale (0-12).
+func Beaufort(knots float64) int {
+	limits := []float64{1, 4, 7, 11, 17, 22, 28, 34, 41, 48, 56, 64}
+	for force, limit := range limits {
+		if knots < limit {
+			return force
+		}
+	}
+	return 12
+}
+
+// BuildURL fills the {lat}, {lon} and {time} placeholders of a URL template.
+func BuildURL(template string, lat, lon float64, hour time.Time) string {
+	u := strings.ReplaceAll(template, "{lat}", strconv.FormatFloat(lat, 'f', 4, 64))
+	u = strings.ReplaceAll(u, "{lon}", strconv.FormatFloat(lon, 'f', 4, 64))
+	return strings.ReplaceAll(u, "{time}", url.QueryEscape(hour.UTC().Format(time.RFC3339)))
+}
+
+// Pending is a vessel-hour queued for a fetch, at the hour's latest position.
+type Pending struct {
+	VesselID  int64
+	Hour      time.Time
+	ReadingID int64
+	Latitude  float64
+	Longitude float64
+	Attempts  int
+}
+
+// Store queues the vessel-hours of new positions and keeps their weather.
+type Store interface {
+	QueueWeatherHours(ctx context.Context, due time.Time) error
+	DueWeatherHours(ctx context.Context, now time.Time, limit int) ([]Pending, error)
+	PutWeather(ctx context.Context, p Pending, cond Conditions, raw json.RawMessage) error
+	RetryWeatherHour(ctx context.Context, p Pending, attempts int, next time.Time, cause string) error
+}
+
+// Enricher fetches weather for the vessel-hours of location readings that do
+// not have weather yet and stores it in weather_readings.
+//
+// New positions are queued once per vessel-hour in weather_pending, scanning
+// location_readings from weather_cursor on, so each position is looked at
+// once. A vessel-hour whose fetch fails is retried after a backoff doubling
+// from the poll interval up to maxBackoff, behind vessel-hours not tried yet.
+type Enricher struct {
+	store       Store
+	urlTemplate string
+	apiKey      string
+	interval    time.Duration
+	client      *http.Client
+	out         *outbound.Integration
+	now         func() time.Time
+}
+
+// NewEnricher creates an enricher whose provider calls are guarded by policy.
+func NewEnricher(st Store, urlTemplate, apiKey string, interval time.Duration, policy outbound.Policy) *Enricher {
+	return &Enricher{
+		store:       st,
+		urlTemplate: urlTemplate,
+		apiKey:      apiKey,
+		interval:    interval,
+		client:      &http.Client{}, // timeouts come from the policy
+		out:         outbound.New("weather", policy),
+		now:         time.Now,
+	}
+}
+
+// EnrichOnce queues the vessel-hours of new positions, then fetches weather
+// for one batch of those due: vessel-hours not tried yet first, newest first.
+func (e *Enricher) EnrichOnce(ctx context.Context) {
+	now := e.now().UTC()
+	if err := e.store.QueueWeatherHours(ctx, now); err != nil {
+		log.Printf("weather: queueing positions: %v", err)
+		return
+	}
+
+	pending, err := e.store.DueWeatherHours(ctx, now, batchSize)
+	if err != nil {
+		log.Printf("weather: listing vessel-hours: %v", err)
+		return
+	}
+
+	stored := 0
+	for _, p := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+
+		cond, body, err := e.fetch(ctx, BuildURL(e.urlTemplate, p.Latitude, p.Longitude, p.Hour))
+		if err != nil {
+			log.Printf("weather: vessel %d at %s: %v", p.VesselID, p.Hour.Format(time.RFC3339), err)
+			attempts := p.Attempts + 1
+			if err := e.store.RetryWeatherHour(ctx, p, attempts, now.Add(e.backoff(attempts)), err.Error()); err != nil {
+				log.Printf("weather: recording failure for vessel %d at %s: %v", p.VesselID, p.Hour.Format(time.RFC3339), err)
+			}
+			continue
+		}
+
+		if err := e.store.PutWeather(ctx, p, cond, body); err != nil {
+			log.Printf("weather: storing vessel %d at %s: %v", p.VesselID, p.Hour.Format(time.RFC3339), err)
+			continue
+		}
+		stored++
+	}
+
+	if stored > 0 {
+		log.Printf("weather: stored conditions for %d vessel-hour(s)", stored)
+	}
+}
+
+// backoff is the wait after the given number of failed fetches: the poll
+// interval, doubled per further failure, up to maxBackoff.
+func (e *Enricher) backoff(attempts int) time.Duration {
+	wait := e.interval
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+func (e *Enricher) fetch(ctx context.Context, u string) (Conditions, json.RawMessage, error) {
+	header := http.Header{"Accept": {"application/json"}}
+	if e.apiKey != "" {
+		header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	body, err := e.out.Get(ctx, e.client, u, header, 1<<20)
+	if err != nil {
+		return Conditions{}, nil, err
+	}
+
+	cond, err := ParseConditions(body)
+	if err != nil {
+		return Conditions{}, nil, err
+	}
+	return cond, json.RawMessage(body), nil
+}
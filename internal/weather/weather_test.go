@@ -0,0 +1,181 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/outbound"
+)
+
+func TestParseConditions(t *testing.T) {
+	// Wind in m/s is converted to knots
+	cond, err := ParseConditions([]byte(`{"wind_speed": 10, "wind_direction": 270, "wave_height": 2.5}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cond.WindSpeedKnots == nil || *cond.WindSpeedKnots < 19.4 || *cond.WindSpeedKnots > 19.5 {
+		t.Errorf("Expected ~19.44 knots, got %v", cond.WindSpeedKnots)
+	}
+	if cond.WaveHeightM == nil || *cond.WaveHeightM != 2.5 {
+		t.Errorf("Expected wave height 2.5, got %v", cond.WaveHeightM)
+	}
+
+	// Nothing useful
+	if _, err := ParseConditions([]byte(`{"temperature": 20}`)); err == nil {
+		t.Errorf("Expected error for response without wind or wave data")
+	}
+}
+
+func TestBeaufort(t *testing.T) {
+	cases := map[float64]int{0: 0, 3: 1, 10: 3, 30: 7, 70: 12}
+	for knots, want := range cases {
+		if got := Beaufort(knots); got != want {
+			t.Errorf("Beaufort(%v) = %d, want %d", knots, got, want)
+		}
+	}
+}
+
+func TestBuildURL(t *testing.T) {
+	hour := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+	got := BuildURL("https://wx.example/v1?lat={lat}&lon={lon}&time={time}", 1.25, 103.8, hour)
+	want := "https://wx.example/v1?lat=1.2500&lon=103.8000&time=2025-08-08T10%3A00%3A00Z"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// fakeStore keeps the queue in memory; each vessel-hour is due from its
+// next attempt on.
+type fakeStore struct {
+	pending []Pending
+	next    map[time.Time]time.Time
+	stored  []time.Time
+}
+
+func (s *fakeStore) QueueWeatherHours(ctx context.Context, due time.Time) error {
+	for _, p := range s.pending {
+		if _, ok := s.next[p.Hour]; !ok {
+			s.next[p.Hour] = due
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) DueWeatherHours(ctx context.Context, now time.Time, limit int) ([]Pending, error) {
+	var due []Pending
+	for _, p := range s.pending {
+		if !s.next[p.Hour].After(now) && len(due) < limit {
+			due = append(due, p)
+		}
+	}
+	return due, nil
+}
+
+func (s *fakeStore) PutWeather(ctx context.Context, p Pending, cond Conditions, raw json.RawMessage) error {
+	for i := range s.pending {
+		if s.pending[i].Hour.Equal(p.Hour) {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			break
+		}
+	}
+	s.stored = append(s.stored, p.Hour)
+	return nil
+}
+
+func (s *fakeStore) RetryWeatherHour(ctx context.Context, p Pending, attempts int, next time.Time, cause string) error {
+	for i := range s.pending {
+		if s.pending[i].Hour.Equal(p.Hour) {
+			s.pending[i].Attempts = attempts
+		}
+	}
+	s.next[p.Hour] = next
+	return nil
+}
+
+func TestEnrichOnce(t *testing.T) {
+	day := time.Date(2025, 8, 8, 0, 0, 0, 0, time.UTC)
+	failing := "2025-08-08T09:00:00Z"
+	st := &fakeStore{next: map[time.Time]time.Time{}}
+	for h := 0; h < batchSize+2; h++ {
+		st.pending = append(st.pending, Pending{VesselID: 1, Hour: day.Add(time.Duration(h) * time.Hour), Latitude: 1.25, Longitude: 103.8})
+	}
+
+	var mu sync.Mutex
+	var fetched []string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hour := r.URL.Query().Get("time")
+		fetched = append(fetched, hour)
+		if hour == failing {
+			http.Error(w, "no data", 500)
+			return
+		}
+		w.Write([]byte(`{"wind_speed_knots": 12, "wave_height": 1.5}`))
+	}))
+	defer provider.Close()
+
+	e := NewEnricher(st, provider.URL+"?time={time}", "", time.Hour, outbound.Policy{Timeout: 5 * time.Second})
+	now := day.Add(200 * time.Hour)
+	e.now = func() time.Time { return now }
+	run := func() []string {
+		t.Helper()
+		mu.Lock()
+		fetched = nil
+		mu.Unlock()
+		e.EnrichOnce(context.Background())
+		mu.Lock()
+		defer mu.Unlock()
+		return fetched
+	}
+
+	// One batch per run
+	if got := run(); len(got) != batchSize {
+		t.Fatalf("Expected %d fetches, got %d", batchSize, len(got))
+	}
+	if len(st.stored) != batchSize-1 {
+		t.Errorf("Expected the hours that did not fail stored, got %d", len(st.stored))
+	}
+	failed := day.Add(9 * time.Hour)
+	if next := st.next[failed]; !next.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected the failed hour retried after the poll interval, got %s", next)
+	}
+
+	// The rest of the queue is fetched, but not the failed hour before the
+	// backoff
+	if got := run(); len(got) != 2 {
+		t.Errorf("Expected the 2 hours left fetched, got %v", got)
+	}
+	if got := run(); len(got) != 0 {
+		t.Errorf("Expected no fetch before the backoff, got %v", got)
+	}
+
+	// The backoff doubles with each failure
+	now = now.Add(time.Hour)
+	if got := run(); len(got) != 1 || got[0] != failing {
+		t.Errorf("Expected the failed hour retried, got %v", got)
+	}
+	if next := st.next[failed]; st.pending[0].Attempts != 2 || !next.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("Expected a doubled backoff, got %d attempts, next at %s", st.pending[0].Attempts, next)
+	}
+
+	mu.Lock()
+	failing = ""
+	mu.Unlock()
+	now = now.Add(2 * time.Hour)
+	if got := run(); len(got) != 1 {
+		t.Errorf("Expected the failed hour retried once due, got %v", got)
+	}
+	if len(st.pending) != 0 || len(st.stored) != batchSize+2 {
+		t.Errorf("Expected all hours stored and none pending, got %d stored, %d pending", len(st.stored), len(st.pending))
+	}
+
+	if e.backoff(20) != maxBackoff {
+		t.Errorf("Expected the backoff capped at %s, got %s", maxBackoff, e.backoff(20))
+	}
+}
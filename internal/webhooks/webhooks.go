@@ -0,0 +1,293 @@
+// Package webhooks tells downstream systems (warehouses, ETL jobs) that new
+// telemetry has arrived, so they can pull increments instead of everything.
+//
+// Each target is a consumer of the transactional outbox (see
+// internal/outbox): a delivery reports, per vessel and stream, the readings
+// inserted since the last one, and the target's cursor moves once it is
+// acknowledged. A delivery that fails is sent again, with anything newer
+// only after it (at-least-once).
+//
+// Ingest-completion events are sent as each upload is ingested instead, with
+// its rows per stream and warnings, for systems that react to an upload
+// rather than pull data.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/outbox"
+	"vessel-telemetry-api/internal/store"
+)
+
+// Events sent.
+const (
+	Event         = "data.available"
+	EventIngested = "upload.ingested"
+)
+
+// Item is the new data of one vessel's stream.
+type Item struct {
+	VesselID  int64     `json:"vessel_id"`
+	Stream    string    `json:"stream"`
+	RowsAdded int64     `json:"rows_added"`
+	FirstTS   time.Time `json:"first_ts"`  // oldest new reading; backfills can predate earlier ones
+	LastTS    time.Time `json:"last_ts"`   // newest new reading
+	LatestTS  time.Time `json:"latest_ts"` // newest reading of the stream overall
+}
+
+// Payload is the body of a delivery.
+type Payload struct {
+	Event  string    `json:"event"`
+	SentAt time.Time `json:"sent_at"`
+	Items  []Item    `json:"items"`
+	// HighWaterMarks are the highest reading ids reported, per stream.
+	HighWaterMarks map[string]int64 `json:"high_water_marks"`
+	// OutboxSeq is the outbox seq of the newest reading reported; a
+	// delivery sent again carries the same.
+	OutboxSeq int64 `json:"outbox_seq"`
+}
+
+// Source looks up the newest reading of a vessel's stream.
+type Source interface {
+	LatestReading(ctx context.Context, q store.ReadingQuery) (*store.Reading, error)
+}
+
+// Sign returns the signature header value of body: "sha256=" and the hex
+// HMAC-SHA256 under secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type target struct {
+	url string
+	out *outbound.Integration
+}
+
+// newTargets creates a target per URL, its integration named prefix and the
+// URL's host.
+func newTargets(prefix string, urls []string, policy outbound.Policy) []target {
+	var targets []target
+	seen := map[string]int{}
+	for _, u := range urls {
+		name := prefix + u
+		if parsed, err := url.Parse(u); err == nil {
+			name = prefix + parsed.Host // keep tokens in the URL out of metrics
+		}
+		if seen[name]++; seen[name] > 1 {
+			name = fmt.Sprintf("%s#%d", name, seen[name])
+		}
+		targets = append(targets, target{url: u, out: outbound.New(name, policy)})
+	}
+	return targets
+}
+
+// post delivers body as event to t, signed under secret if set.
+func post(ctx context.Context, client *http.Client, t target, event, secret string, body []byte) error {
+	header := http.Header{
+		"Content-Type":    {"application/json"},
+		"X-Webhook-Event": {event},
+	}
+	if secret != "" {
+		header.Set("X-Webhook-Signature", Sign(secret, body))
+	}
+	return t.out.Post(ctx, client, t.url, header, body)
+}
+
+// Notifier delivers new-data events to every target.
+type Notifier struct {
+	source   Source
+	streams  []string
+	targets  []target
+	secret   string
+	interval time.Duration
+	client   *http.Client
+}
+
+// NewNotifier creates a notifier for the given streams (all if empty) whose
+// deliveries are guarded by policy, one integration per target.
+func NewNotifier(source Source, streams, urls []string, secret string, interval time.Duration, policy outbound.Policy) *Notifier {
+	return &Notifier{
+		source:   source,
+		streams:  streams,
+		targets:  newTargets("webhook:", urls, policy),
+		secret:   secret,
+		interval: interval,
+		client:   &http.Client{}, // timeouts come from the policy
+	}
+}
+
+// Consumers returns the outbox consumer of every target, its cursor named
+// webhook: and the URL.
+func (n *Notifier) Consumers() []outbox.Consumer {
+	consumers := make([]outbox.Consumer, len(n.targets))
+	for i, t := range n.targets {
+		consumers[i] = outbox.Consumer{
+			Name:     "webhook:" + t.url,
+			Streams:  n.streams,
+			Interval: n.interval,
+			Deliver: func(ctx context.Context, events []store.OutboxEvent) error {
+				return n.deliver(ctx, t, events)
+			},
+		}
+	}
+	return consumers
+}
+
+func (n *Notifier) deliver(ctx context.Context, t target, events []store.OutboxEvent) error {
+	type key struct {
+		stream   string
+		vesselID int64
+	}
+	items := map[key]*Item{}
+	payload := Payload{Event: Event, Items: []Item{}, HighWaterMarks: map[string]int64{}}
+	for _, e := range events {
+		payload.OutboxSeq = e.Seq
+		if e.Row == nil {
+			continue // deleted since
+		}
+		item := items[key{e.Stream, e.VesselID}]
+		if item == nil {
+			item = &Item{VesselID: e.VesselID, Stream: e.Stream, FirstTS: e.Row.Timestamp, LastTS: e.Row.Timestamp}
+			items[key{e.Stream, e.VesselID}] = item
+		}
+		item.RowsAdded++
+		if e.Row.Timestamp.Before(item.FirstTS) {
+			item.FirstTS = e.Row.Timestamp
+		}
+		if e.Row.Timestamp.After(item.LastTS) {
+			item.LastTS = e.Row.Timestamp
+		}
+		if e.ReadingID > payload.HighWaterMarks[e.Stream] {
+			payload.HighWaterMarks[e.Stream] = e.ReadingID
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	for k, item := range items {
+		latest, err := n.source.LatestReading(ctx, store.ReadingQuery{Stream: store.Streams[k.stream], VesselID: k.vesselID})
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		item.LatestTS = item.LastTS
+		if latest != nil && latest.Timestamp.After(item.LatestTS) {
+			item.LatestTS = latest.Timestamp
+		}
+		payload.Items = append(payload.Items, *item)
+	}
+	sort.Slice(payload.Items, func(i, j int) bool {
+		a, b := payload.Items[i], payload.Items[j]
+		if a.Stream != b.Stream {
+			return a.Stream < b.Stream
+		}
+		return a.VesselID < b.VesselID
+	})
+
+	payload.SentAt = time.Now().UTC()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(ctx, n.client, t, Event, n.secret, body)
+}
+
+// Ingested is the body of an upload.ingested delivery.
+type Ingested struct {
+	Event        string         `json:"event"`
+	SentAt       time.Time      `json:"sent_at"`
+	UploadID     *int64         `json:"upload_id"`
+	VesselID     int64          `json:"vessel_id"`
+	Filename     string         `json:"filename"`
+	Streams      []string       `json:"streams"` // with rows inserted or updated, by name
+	RowsInserted map[string]int `json:"rows_inserted"`
+	RowsUpdated  map[string]int `json:"rows_updated"` // upserts only
+	Warnings     []string       `json:"warnings"`
+}
+
+// IngestNotifier tells every target of each upload ingested.
+type IngestNotifier struct {
+	targets []target
+	secret  string
+	client  *http.Client
+}
+
+// NewIngestNotifier creates a notifier whose deliveries are guarded by
+// policy, one integration per target.
+func NewIngestNotifier(urls []string, secret string, policy outbound.Policy) *IngestNotifier {
+	return &IngestNotifier{
+		targets: newTargets("ingest-webhook:", urls, policy),
+		secret:  secret,
+		client:  &http.Client{},
+	}
+}
+
+// Notify delivers the event of an ingested upload to every target in the
+// background, so uploads do not wait on them. A delivery that still fails
+// after the policy's retries is logged and dropped.
+func (n *IngestNotifier) Notify(filename string, resp *models.IngestResponse) {
+	if resp.VesselID == nil {
+		return
+	}
+	event := Ingested{
+		Event:        EventIngested,
+		SentAt:       time.Now().UTC(),
+		UploadID:     resp.UploadID,
+		VesselID:     *resp.VesselID,
+		Filename:     filename,
+		Streams:      []string{},
+		RowsInserted: map[string]int{},
+		RowsUpdated:  map[string]int{},
+		Warnings:     resp.Warnings,
+	}
+	for stream, n := range resp.RowsInserted {
+		if n > 0 {
+			event.RowsInserted[stream] = n
+		}
+	}
+	for stream, n := range resp.RowsUpdated {
+		if n > 0 {
+			event.RowsUpdated[stream] = n
+		}
+	}
+	for stream := range event.RowsInserted {
+		event.Streams = append(event.Streams, stream)
+	}
+	for stream := range event.RowsUpdated {
+		if _, ok := event.RowsInserted[stream]; !ok {
+			event.Streams = append(event.Streams, stream)
+		}
+	}
+	sort.Strings(event.Streams)
+	if event.Warnings == nil {
+		event.Warnings = []string{}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("ingest webhooks: %v", err)
+		return
+	}
+	for _, t := range n.targets {
+		go func(t target) {
+			if err := post(context.Background(), n.client, t, EventIngested, n.secret, body); err != nil {
+				log.Printf("ingest webhooks: %s: %v", t.out.Status().Name, err)
+			}
+		}(t)
+	}
+}
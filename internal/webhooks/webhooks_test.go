@@ -0,0 +1,133 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"vessel-telemetry-api/internal/models"
+	"vessel-telemetry-api/internal/outbound"
+	"vessel-telemetry-api/internal/store"
+)
+
+// fakeSource has readings of vessel 1 up to latest.
+type fakeSource struct {
+	latest time.Time
+}
+
+func (f *fakeSource) LatestReading(ctx context.Context, q store.ReadingQuery) (*store.Reading, error) {
+	return &store.Reading{VesselID: q.VesselID, Timestamp: f.latest}, nil
+}
+
+// event returns the outbox event of a reading of vessel 1, taken hours
+// after midnight.
+func event(seq int64, stream string, id int64, hours int) store.OutboxEvent {
+	ts := time.Date(2025, 8, 8, hours, 0, 0, 0, time.UTC)
+	return store.OutboxEvent{Seq: seq, Stream: stream, VesselID: 1, ReadingID: id, Row: &store.Reading{ID: id, VesselID: 1, Timestamp: ts}}
+}
+
+func TestNotify(t *testing.T) {
+	fail := false
+	var deliveries []Payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Webhook-Signature") != Sign("s3cret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var p Payload
+		json.Unmarshal(body, &p)
+		deliveries = append(deliveries, p)
+	}))
+	defer srv.Close()
+
+	source := &fakeSource{latest: time.Date(2025, 8, 8, 12, 0, 0, 0, time.UTC)}
+	n := NewNotifier(source, []string{"engines", "fuel"}, []string{srv.URL}, "s3cret", time.Minute, outbound.Policy{})
+	consumers := n.Consumers()
+	if len(consumers) != 1 || consumers[0].Name != "webhook:"+srv.URL || len(consumers[0].Streams) != 2 {
+		t.Fatalf("Unexpected consumers %+v", consumers)
+	}
+	deliver := consumers[0].Deliver
+
+	// Backfilled rows report the oldest as first_ts
+	if err := deliver(context.Background(), []store.OutboxEvent{event(4, "engines", 1, 10), event(5, "engines", 2, 8)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || len(deliveries[0].Items) != 1 {
+		t.Fatalf("Expected one delivery of one item, got %+v", deliveries)
+	}
+	item := deliveries[0].Items[0]
+	if item.RowsAdded != 2 || item.FirstTS.Hour() != 8 || item.LastTS.Hour() != 10 || !item.LatestTS.Equal(source.latest) {
+		t.Errorf("Unexpected item %+v", item)
+	}
+	if p := deliveries[0]; p.HighWaterMarks["engines"] != 2 || p.HighWaterMarks["fuel"] != 0 || p.OutboxSeq != 5 {
+		t.Errorf("Unexpected high-water marks %v, seq %d", p.HighWaterMarks, p.OutboxSeq)
+	}
+
+	// Only deleted readings, nothing sent
+	if err := deliver(context.Background(), []store.OutboxEvent{{Seq: 6, Stream: "engines", VesselID: 1, ReadingID: 3}}); err != nil || len(deliveries) != 1 {
+		t.Errorf("Expected no delivery without readings, got %d, %v", len(deliveries), err)
+	}
+
+	// A failed delivery is an error, for the dispatcher to send it again
+	fail = true
+	if err := deliver(context.Background(), []store.OutboxEvent{event(7, "fuel", 7, 11)}); err == nil {
+		t.Error("Expected an error from a failed delivery")
+	}
+	fail = false
+	if err := deliver(context.Background(), []store.OutboxEvent{event(7, "fuel", 7, 11), event(8, "engines", 4, 11)}); err != nil {
+		t.Fatal(err)
+	}
+	// Items by stream
+	if p := deliveries[1]; len(p.Items) != 2 || p.Items[0].Stream != "engines" || p.Items[1].Stream != "fuel" || p.HighWaterMarks["fuel"] != 7 {
+		t.Errorf("Unexpected delivery %+v", p)
+	}
+}
+
+func TestIngestNotifier(t *testing.T) {
+	delivered := make(chan Ingested, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Webhook-Event") != EventIngested || r.Header.Get("X-Webhook-Signature") != Sign("s3cret", body) {
+			t.Errorf("Unexpected headers %v", r.Header)
+		}
+		var event Ingested
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+		}
+		delivered <- event
+	}))
+	defer srv.Close()
+
+	n := NewIngestNotifier([]string{srv.URL}, "s3cret", outbound.Policy{})
+	uploadID, vesselID := int64(4), int64(7)
+	n.Notify("noon.xlsx", &models.IngestResponse{
+		Status:       "ingested",
+		UploadID:     &uploadID,
+		VesselID:     &vesselID,
+		RowsInserted: map[string]int{"engines": 3, "fuel": 0},
+		RowsUpdated:  map[string]int{"location": 1},
+		Warnings:     []string{"Engines: row 4 skipped"},
+	})
+
+	select {
+	case event := <-delivered:
+		if event.VesselID != 7 || *event.UploadID != 4 || event.Filename != "noon.xlsx" || len(event.Warnings) != 1 {
+			t.Errorf("Unexpected event %+v", event)
+		}
+		// Streams without rows are left out
+		if len(event.Streams) != 2 || event.Streams[0] != "engines" || event.Streams[1] != "location" || len(event.RowsInserted) != 1 {
+			t.Errorf("Unexpected streams %v %v", event.Streams, event.RowsInserted)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a delivery")
+	}
+}
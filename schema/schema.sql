@@ -8,9 +8,12 @@ PRAGMA cache_size=-20000;
 CREATE TABLE IF NOT EXISTS vessels (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     imo TEXT UNIQUE,            -- nullable if unknown
+    mmsi TEXT,                  -- used for AIS lookups
     name TEXT,
     flag TEXT,
     type TEXT,
+    fleet TEXT,                 -- operator's fleet grouping, from Ship Info
+    archived_at DATETIME,       -- set when decommissioned; hidden from default listings
     created_at DATETIME DEFAULT (datetime('now')),
     updated_at DATETIME DEFAULT (datetime('now'))
 );
@@ -39,6 +42,8 @@ CREATE TABLE IF NOT EXISTS engine_readings (
     temp_c REAL,
     oil_pressure_bar REAL,
     alarms TEXT,
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
     extra_json TEXT,            -- JSON dump of unmapped cols
     created_at DATETIME DEFAULT (datetime('now')),
@@ -56,6 +61,9 @@ CREATE TABLE IF NOT EXISTS fuel_tank_readings (
     level_percent REAL,          -- 0..100
     volume_liters REAL,          -- >= 0
     temp_c REAL,
+    uncertainty_percent REAL,    -- ± of level and volume when estimated (e.g. soundings), NULL if exact
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
     extra_json TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
@@ -74,6 +82,9 @@ CREATE TABLE IF NOT EXISTS generator_readings (
     voltage_v REAL,
     frequency_hz REAL,
     fuel_rate_lph REAL,
+    uncertainty_percent REAL,    -- ± of fuel_rate_lph when estimated, NULL if exact
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
     extra_json TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
@@ -90,6 +101,8 @@ CREATE TABLE IF NOT EXISTS cctv_status_readings (
     ts DATETIME NOT NULL,
     status TEXT,               -- e.g., OK, OFFLINE
     uptime_percent REAL,
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
     extra_json TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
@@ -107,6 +120,8 @@ CREATE TABLE IF NOT EXISTS impact_vibration_readings (
     accel_g REAL,
     shock_g REAL,
     notes TEXT,
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
     row_hash TEXT NOT NULL,
     extra_json TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
@@ -116,6 +131,103 @@ CREATE TABLE IF NOT EXISTS impact_vibration_readings (
 
 CREATE INDEX IF NOT EXISTS idx_imp_ts ON impact_vibration_readings(vessel_id, ts);
 
+CREATE TABLE IF NOT EXISTS bilge_ballast_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    tank_id TEXT,               -- bilge well or ballast tank, e.g. BW-AFT, WBT 3P
+    ts DATETIME NOT NULL,
+    level_percent REAL,
+    volume_m3 REAL,
+    pump_status TEXT,           -- e.g., RUNNING, STOPPED, AUTO
+    alarm TEXT,                 -- e.g., HIGH LEVEL
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bilge_ts ON bilge_ballast_readings(vessel_id, ts);
+
+CREATE TABLE IF NOT EXISTS navigation_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    ts DATETIME NOT NULL,
+    heading_degrees REAL,       -- 0-360, true heading
+    rudder_angle_degrees REAL,  -- negative to port, positive to starboard
+    rot_degrees_per_min REAL,   -- rate of turn, positive to starboard
+    depth_under_keel_m REAL,    -- >= 0
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_nav_ts ON navigation_readings(vessel_id, ts);
+
+CREATE TABLE IF NOT EXISTS met_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    ts DATETIME NOT NULL,
+    wind_speed_knots REAL,      -- >= 0, relative to the ship as measured
+    wind_direction_deg REAL,    -- 0-360, direction the wind comes from
+    air_temp_c REAL,
+    pressure_hpa REAL,          -- barometric pressure
+    sea_state INTEGER,          -- Douglas scale, 0-9
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_met_ts ON met_readings(vessel_id, ts);
+
+CREATE TABLE IF NOT EXISTS power_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    bank_id TEXT,               -- battery bank, e.g. ESS-1; NULL for shore-only rows
+    ts DATETIME NOT NULL,
+    shore_status TEXT,          -- e.g., CONNECTED, DISCONNECTED
+    shore_kw REAL,              -- >= 0, drawn from the shore connection
+    soc_percent REAL,           -- battery state of charge, 0-100
+    battery_kw REAL,            -- positive charging, negative discharging
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_power_ts ON power_readings(vessel_id, ts);
+
+CREATE TABLE IF NOT EXISTS network_device_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    device_id TEXT,             -- switch, router, access point, etc., e.g. SW-BRIDGE
+    ts DATETIME NOT NULL,
+    device_type TEXT,           -- e.g., switch, router, access_point
+    status TEXT,                -- e.g., ONLINE, OFFLINE, DEGRADED
+    uptime_hours REAL,          -- >= 0, since the device last started
+    availability_percent REAL,  -- 0-100, share of recent polls answered
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
+    sensor_ref INTEGER,         -- sensors.id of the unit, NULL without one
+    row_hash TEXT NOT NULL,
+    extra_json TEXT,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, ts, row_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_network_device_ts ON network_device_readings(vessel_id, ts);
+
 CREATE TABLE IF NOT EXISTS location_readings (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     vessel_id INTEGER NOT NULL,
@@ -125,6 +237,7 @@ CREATE TABLE IF NOT EXISTS location_readings (
     course_degrees REAL,        -- 0-360
     speed_knots REAL,           -- >= 0
     status TEXT,                -- underway, anchored, moored, etc.
+    source TEXT,                -- sensor|manual|derived|synced, NULL if ingested before sources were recorded
     row_hash TEXT NOT NULL,
     extra_json TEXT,
     created_at DATETIME DEFAULT (datetime('now')),
@@ -134,6 +247,300 @@ CREATE TABLE IF NOT EXISTS location_readings (
 
 CREATE INDEX IF NOT EXISTS idx_location_ts ON location_readings(vessel_id, ts);
 
+-- alarms parsed from engine_readings.alarms; repeated readings of the same
+-- alarm on the same engine form one event, ended by the first reading without it
+CREATE TABLE IF NOT EXISTS alarm_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    engine_no INTEGER,
+    code TEXT NOT NULL,         -- normalized, e.g. LOW_OIL_PRESSURE
+    severity TEXT NOT NULL,     -- info|warning|critical
+    message TEXT,               -- alarm text of the first reading
+    start_ts DATETIME NOT NULL,
+    end_ts DATETIME,            -- NULL while still active
+    last_seen_ts DATETIME NOT NULL,
+    occurrences INTEGER NOT NULL,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alarm_events_start ON alarm_events(vessel_id, start_ts);
+
+-- fuel tank volumes falling abnormally fast while the engines are off or the
+-- vessel is not moving (see internal/fueldrop); rebuilt like alarm_events
+CREATE TABLE IF NOT EXISTS fuel_drop_alerts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    tank_no INTEGER,
+    start_ts DATETIME NOT NULL,
+    end_ts DATETIME NOT NULL,
+    start_liters REAL NOT NULL,
+    end_liters REAL NOT NULL,
+    drop_liters REAL NOT NULL,
+    rate_lph REAL NOT NULL,
+    reason TEXT NOT NULL,       -- engines_off|stationary|engines_off_stationary
+    raised_at DATETIME NOT NULL, -- first detection, kept when rebuilt
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fuel_drop_alerts_start ON fuel_drop_alerts(vessel_id, start_ts);
+
+-- wind/wave conditions from the external weather provider, one row per vessel-hour
+CREATE TABLE IF NOT EXISTS weather_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    hour TEXT NOT NULL,         -- YYYY-MM-DDTHH:00:00Z (UTC)
+    ts DATETIME NOT NULL,
+    location_reading_id INTEGER,
+    latitude REAL,
+    longitude REAL,
+    wind_speed_knots REAL,
+    wind_direction_deg REAL,
+    wave_height_m REAL,
+    wave_period_s REAL,
+    raw_json TEXT,              -- provider response
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, hour)
+);
+
+-- port index used for port-call detection; polygon_json is [[lat,lon],...]
+CREATE TABLE IF NOT EXISTS ports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT UNIQUE NOT NULL,  -- UN/LOCODE
+    name TEXT NOT NULL,
+    country TEXT,
+    polygon_json TEXT NOT NULL,
+    created_at DATETIME DEFAULT (datetime('now')),
+    updated_at DATETIME DEFAULT (datetime('now'))
+);
+
+-- lookup values shared across the system (emission-factors, flags,
+-- vessel-types); attributes_json holds kind-specific numbers
+CREATE TABLE IF NOT EXISTS reference_entries (
+    kind TEXT NOT NULL,
+    code TEXT NOT NULL,         -- upper case
+    name TEXT NOT NULL,
+    attributes_json TEXT,
+    updated_at DATETIME DEFAULT (datetime('now')),
+    PRIMARY KEY (kind, code)
+);
+
+-- per-vessel overrides of the default daily row quota
+CREATE TABLE IF NOT EXISTS vessel_quotas (
+    vessel_id INTEGER PRIMARY KEY,
+    daily_row_limit INTEGER NOT NULL,   -- 0 disables the quota
+    throttle INTEGER NOT NULL DEFAULT 0, -- refuse ingest once exceeded
+    updated_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- rows written per vessel per UTC day (by ingest time), used for quotas
+CREATE TABLE IF NOT EXISTS vessel_daily_usage (
+    vessel_id INTEGER NOT NULL,
+    day TEXT NOT NULL,          -- YYYY-MM-DD
+    rows INTEGER NOT NULL DEFAULT 0,
+    alerted_at DATETIME,        -- set the first time the quota was exceeded that day
+    PRIMARY KEY (vessel_id, day),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- watermarked exports, so a leaked file can be traced to its recipient;
+-- rows and chain_hash are set once the export has been written
+CREATE TABLE IF NOT EXISTS export_watermarks (
+    id TEXT PRIMARY KEY,        -- export_id in the file
+    recipient TEXT NOT NULL,    -- API key fingerprint, empty without a key
+    org TEXT,
+    client_ip TEXT,
+    vessel_id INTEGER NOT NULL,
+    stream TEXT NOT NULL,
+    format TEXT NOT NULL,       -- csv|ndjson
+    from_ts DATETIME,
+    to_ts DATETIME,
+    issued_at DATETIME NOT NULL,
+    rows INTEGER,
+    chain_hash TEXT,
+    completed_at DATETIME,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- tamper-evident log of API changes and chained readings; each hash covers
+-- the entry and prev_hash (see internal/audit). Rows are never changed once
+-- hashed nor deleted.
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    recorded_at TEXT NOT NULL,  -- RFC 3339 with nanoseconds, as hashed
+    kind TEXT NOT NULL,         -- audit|reading
+    action TEXT NOT NULL,
+    actor TEXT,                 -- org and/or API key fingerprint
+    vessel_id INTEGER,
+    subject TEXT,
+    stream TEXT,                -- reading entries: stream and reading id
+    reading_id INTEGER,
+    digest TEXT,
+    detail_json TEXT,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL          -- '' only while the entry is being appended
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_reading ON audit_log(stream, reading_id);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+WHEN OLD.hash != ''
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+-- high-water marks of new-data webhooks: the highest reading id of each
+-- stream already reported to a target (see internal/webhooks)
+CREATE TABLE IF NOT EXISTS webhook_marks (
+    target TEXT NOT NULL,       -- webhook URL
+    stream TEXT NOT NULL,
+    last_id INTEGER NOT NULL,
+    notified_at DATETIME NOT NULL,
+    PRIMARY KEY (target, stream)
+);
+
+-- change data capture: every insert, update and delete of a reading, in
+-- order; filled by the cdc_* triggers on each reading table
+CREATE TABLE IF NOT EXISTS cdc_log (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,  -- the feed's resume token
+    stream TEXT NOT NULL,
+    op TEXT NOT NULL,           -- insert|update|delete
+    vessel_id INTEGER NOT NULL,
+    reading_id INTEGER NOT NULL,
+    changed_at TEXT NOT NULL    -- RFC 3339, UTC
+);
+
+CREATE INDEX IF NOT EXISTS idx_cdc_log_changed ON cdc_log(changed_at);
+
+-- Migrate creates these triggers for each reading table and its stream
+-- (see cdcTriggers in internal/db/migrate.go), e.g. for engines:
+CREATE TRIGGER IF NOT EXISTS cdc_engine_readings_insert AFTER INSERT ON engine_readings
+BEGIN
+    INSERT INTO cdc_log (stream, op, vessel_id, reading_id, changed_at)
+    VALUES ('engines', 'insert', NEW.vessel_id, NEW.id, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'));
+END;
+
+CREATE TRIGGER IF NOT EXISTS cdc_engine_readings_update AFTER UPDATE ON engine_readings
+BEGIN
+    INSERT INTO cdc_log (stream, op, vessel_id, reading_id, changed_at)
+    VALUES ('engines', 'update', NEW.vessel_id, NEW.id, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'));
+END;
+
+CREATE TRIGGER IF NOT EXISTS cdc_engine_readings_delete AFTER DELETE ON engine_readings
+BEGIN
+    INSERT INTO cdc_log (stream, op, vessel_id, reading_id, changed_at)
+    VALUES ('engines', 'delete', OLD.vessel_id, OLD.id, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'));
+END;
+
+-- tank registry: capacities fill in level_percent when a fuel sheet has no
+-- capacity column and bound the volumes it may report
+CREATE TABLE IF NOT EXISTS tanks (
+    vessel_id INTEGER NOT NULL,
+    tank_no INTEGER NOT NULL,
+    name TEXT,
+    capacity_liters REAL NOT NULL, -- > 0
+    fuel_type TEXT,                -- emission-factors code, e.g. HFO
+    updated_at DATETIME DEFAULT (datetime('now')),
+    PRIMARY KEY (vessel_id, tank_no),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+CREATE TABLE IF NOT EXISTS engines (
+    vessel_id INTEGER NOT NULL,
+    engine_no INTEGER NOT NULL,
+    name TEXT,
+    maker TEXT,
+    model TEXT,
+    rated_rpm REAL,                -- > 0; readings above it are flagged on ingest
+    rated_power_kw REAL,           -- > 0
+    commissioned_on TEXT,          -- YYYY-MM-DD
+    updated_at DATETIME DEFAULT (datetime('now')),
+    PRIMARY KEY (vessel_id, engine_no),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- every unit (engine, tank, generator, camera, impact sensor) seen in the
+-- readings, registered on first sight; location and installed_on are edited
+-- through the API
+CREATE TABLE IF NOT EXISTS sensors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    stream TEXT NOT NULL,       -- engines|fuel|generators|cctv|impact
+    unit TEXT NOT NULL,         -- the readings' unit column as text, e.g. 2 or CAM-01
+    location TEXT,              -- where on the vessel, e.g. engine room port side
+    installed_on TEXT,          -- YYYY-MM-DD
+    first_seen DATETIME NOT NULL, -- earliest reading ts
+    last_seen DATETIME NOT NULL,  -- latest reading ts
+    updated_at DATETIME,        -- last metadata edit
+    UNIQUE(vessel_id, stream, unit),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+
+-- camera snapshots: a URL from the CCTV sheet or an image uploaded to the
+-- object store (object_key); linked to the camera's status reading at ts,
+-- if any, by (vessel_id, cam_id, ts)
+CREATE TABLE IF NOT EXISTS cctv_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    vessel_id INTEGER NOT NULL,
+    cam_id TEXT NOT NULL,
+    ts DATETIME NOT NULL,
+    url TEXT,                   -- external reference
+    object_key TEXT,            -- uploaded image
+    content_type TEXT,          -- of the uploaded image
+    size_bytes INTEGER,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id),
+    UNIQUE(vessel_id, cam_id, ts)
+);
+
+-- streams defined at runtime by admins for sheet types without a built-in
+-- stream; their readings keep the column values as JSON in custom_readings
+CREATE TABLE IF NOT EXISTS custom_streams (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    sheets_json TEXT NOT NULL,  -- lower-case substrings of the sheet names it is read from
+    unit_column TEXT,           -- column identifying the unit, if any
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS custom_stream_columns (
+    stream_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,         -- int|float|text
+    headers_json TEXT NOT NULL, -- header aliases matched as for built-in streams
+    min_value REAL,             -- valid range of numeric columns
+    max_value REAL,
+    PRIMARY KEY (stream_id, position),
+    UNIQUE(stream_id, name),
+    FOREIGN KEY(stream_id) REFERENCES custom_streams(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS custom_readings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    stream_id INTEGER NOT NULL,
+    vessel_id INTEGER NOT NULL,
+    ts DATETIME NOT NULL,
+    unit TEXT,
+    values_json TEXT NOT NULL,
+    source TEXT,
+    row_hash TEXT NOT NULL UNIQUE,
+    extra_json BLOB,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY(stream_id) REFERENCES custom_streams(id) ON DELETE CASCADE,
+    FOREIGN KEY(vessel_id) REFERENCES vessels(id)
+);
+CREATE INDEX IF NOT EXISTS idx_custom_ts ON custom_readings(stream_id, vessel_id, ts);
+
 -- lightweight materialized view for "latest timestamp per stream"
 CREATE TABLE IF NOT EXISTS vessel_stream_latest (
     vessel_id INTEGER NOT NULL,